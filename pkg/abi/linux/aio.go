@@ -19,6 +19,29 @@ import "encoding/binary"
 // AIORingSize is sizeof(struct aio_ring).
 const AIORingSize = 32
 
+// aio_ring constants, from fs/aio.c.
+const (
+	AIO_RING_MAGIC             = 0xa10a10a1
+	AIO_RING_COMPAT_FEATURES   = 1
+	AIO_RING_INCOMPAT_FEATURES = 0
+)
+
+// AIORing is struct aio_ring, from fs/aio.c. It is the header of the
+// completion ring shared with userspace; it is followed by an array of Nr
+// IOEvents.
+//
+// +marshal
+type AIORing struct {
+	ID               uint32
+	Nr               uint32
+	Head             uint32
+	Tail             uint32
+	Magic            uint32
+	CompatFeatures   uint32
+	IncompatFeatures uint32
+	HeaderLength     uint32
+}
+
 // I/O commands.
 const (
 	IOCB_CMD_PREAD  = 0
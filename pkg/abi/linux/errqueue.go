@@ -24,6 +24,26 @@ const (
 	SO_EE_ORIGIN_LOCAL = 1
 	SO_EE_ORIGIN_ICMP  = 2
 	SO_EE_ORIGIN_ICMP6 = 3
+	// SO_EE_ORIGIN_TXSTATUS is the origin of transmit timestamps.
+	SO_EE_ORIGIN_TXSTATUS     = 4
+	SO_EE_ORIGIN_ZEROCOPY     = 5
+	SO_EE_ORIGIN_TXTIME       = 6
+	SO_EE_ORIGIN_TIMESTAMPING = SO_EE_ORIGIN_TXSTATUS
+)
+
+// Transmit timestamp types reported in sock_extended_err.ee_info, as defined
+// in include/uapi/linux/errqueue.h.
+const (
+	SCM_TSTAMP_SND   = 0
+	SCM_TSTAMP_SCHED = 1
+	SCM_TSTAMP_ACK   = 2
+)
+
+// Error codes for SO_EE_ORIGIN_TXTIME, as defined in
+// include/uapi/linux/errqueue.h.
+const (
+	SO_EE_CODE_TXTIME_INVALID_PARAM = 1
+	SO_EE_CODE_TXTIME_MISSED        = 2
 )
 
 // SockExtendedErr represents struct sock_extended_err in Linux defined in
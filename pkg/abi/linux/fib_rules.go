@@ -0,0 +1,90 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// FibRuleHdr is struct fib_rule_hdr, from uapi/linux/fib_rules.h.
+//
+// +marshal
+type FibRuleHdr struct {
+	Family uint8
+	DstLen uint8
+	SrcLen uint8
+	TOS    uint8
+
+	Table  uint8
+	Res1   uint8
+	Res2   uint8
+	Action uint8
+
+	Flags uint32
+}
+
+// SizeOfFibRuleHdr is the size of FibRuleHdr.
+const SizeOfFibRuleHdr = 12
+
+// FibRuleUIDRange is struct fib_rule_uid_range, from uapi/linux/fib_rules.h.
+//
+// +marshal
+type FibRuleUIDRange struct {
+	Start uint32
+	End   uint32
+}
+
+// Rule flags, from uapi/linux/fib_rules.h.
+const (
+	FIB_RULE_PERMANENT    = 0x00000001
+	FIB_RULE_INVERT       = 0x00000002
+	FIB_RULE_UNRESOLVED   = 0x00000004
+	FIB_RULE_IIF_DETACHED = 0x00000008
+	FIB_RULE_DEV_DETACHED = FIB_RULE_IIF_DETACHED
+	FIB_RULE_OIF_DETACHED = 0x00000010
+	FIB_RULE_FIND_SADDR   = 0x00010000
+)
+
+// Rule attributes, from uapi/linux/fib_rules.h.
+const (
+	FRA_UNSPEC             = 0
+	FRA_DST                = 1
+	FRA_SRC                = 2
+	FRA_IIFNAME            = 3
+	FRA_GOTO               = 4
+	FRA_PRIORITY           = 6
+	FRA_FWMARK             = 10
+	FRA_FLOW               = 11
+	FRA_TUN_ID             = 12
+	FRA_SUPPRESS_IFGROUP   = 13
+	FRA_SUPPRESS_PREFIXLEN = 14
+	FRA_TABLE              = 15
+	FRA_FWMASK             = 16
+	FRA_OIFNAME            = 17
+	FRA_PAD                = 18
+	FRA_L3MDEV             = 19
+	FRA_UID_RANGE          = 20
+	FRA_PROTOCOL           = 21
+	FRA_IP_PROTO           = 22
+	FRA_SPORT_RANGE        = 23
+	FRA_DPORT_RANGE        = 24
+)
+
+// Rule actions, from uapi/linux/fib_rules.h.
+const (
+	FR_ACT_UNSPEC      = 0
+	FR_ACT_TO_TBL      = 1
+	FR_ACT_GOTO        = 2
+	FR_ACT_NOP         = 3
+	FR_ACT_BLACKHOLE   = 6
+	FR_ACT_UNREACHABLE = 7
+	FR_ACT_PROHIBIT    = 8
+)
@@ -405,6 +405,16 @@ var fileType = abi.ValueSet{
 const (
 	MFD_CLOEXEC       = 0x0001
 	MFD_ALLOW_SEALING = 0x0002
+	MFD_HUGETLB       = 0x0004
+	MFD_NOEXEC_SEAL   = 0x0008
+	MFD_EXEC          = 0x0010
+
+	// MFD_HUGE_SHIFT and MFD_HUGE_MASK encode the log2 of the huge page size
+	// used by MFD_HUGETLB memfds, as for MAP_HUGE_SHIFT and MAP_HUGE_MASK.
+	MFD_HUGE_SHIFT = 26
+	MFD_HUGE_MASK  = 0x3f
+	MFD_HUGE_2MB   = 21 << MFD_HUGE_SHIFT
+	MFD_HUGE_1GB   = 30 << MFD_HUGE_SHIFT
 )
 
 // Constants related to file seals. Source: include/uapi/{asm-generic,linux}/fcntl.h
@@ -417,6 +427,7 @@ const (
 	F_SEAL_SHRINK = 0x0002 // Prevent file from shrinking.
 	F_SEAL_GROW   = 0x0004 // Prevent file from growing.
 	F_SEAL_WRITE  = 0x0008 // Prevent writes.
+	F_SEAL_EXEC   = 0x0020 // Prevent chmod modifying exec bits.
 )
 
 // Constants related to fallocate(2). Source: include/uapi/linux/falloc.h
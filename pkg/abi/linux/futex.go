@@ -52,6 +52,43 @@ const (
 	FUTEX_OP_CMP_GE      = 5
 )
 
+// Flags used by futex_waitv(2), futex_wake(2), futex_wait(2) and struct
+// futex_waitv, from <linux/futex.h>.
+const (
+	FUTEX2_SIZE_U8   = 0x00
+	FUTEX2_SIZE_U16  = 0x01
+	FUTEX2_SIZE_U32  = 0x02
+	FUTEX2_SIZE_U64  = 0x03
+	FUTEX2_NUMA      = 0x04
+	FUTEX2_PRIVATE   = FUTEX_PRIVATE_FLAG
+	FUTEX2_SIZE_MASK = 0x03
+
+	// FUTEX2_VALID_MASK is the set of all valid FUTEX2 flags. It does not
+	// include FUTEX2_NUMA, which is not supported.
+	FUTEX2_VALID_MASK = FUTEX2_SIZE_MASK | FUTEX2_PRIVATE
+)
+
+// FUTEX_WAITV_MAX is the maximum number of futexes that may be waited on by a
+// single call to futex_waitv(2).
+const FUTEX_WAITV_MAX = 128
+
+// FutexWaitv corresponds to Linux's struct futex_waitv.
+//
+// +marshal slice:FutexWaitvSlice
+type FutexWaitv struct {
+	// Val is the expected value of the futex word.
+	Val uint64
+
+	// Uaddr is the address of the futex word.
+	Uaddr uint64
+
+	// Flags is a combination of FUTEX2_* flags.
+	Flags uint32
+
+	// Reserved must be 0.
+	Reserved uint32
+}
+
 // FUTEX_TID_MASK is the TID portion of a PI futex word.
 const FUTEX_TID_MASK = 0x3fffffff
 
@@ -0,0 +1,96 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// GenericNetlinkHeader is struct genlmsghdr, from uapi/linux/genetlink.h.
+//
+// +marshal
+type GenericNetlinkHeader struct {
+	Command  uint8
+	Version  uint8
+	Reserved uint16
+}
+
+// GenericNetlinkHeaderSize is the size of GenericNetlinkHeader.
+const GenericNetlinkHeaderSize = 4
+
+// Generic netlink family IDs, from uapi/linux/genetlink.h.
+const (
+	GENL_NAMSIZ       = 16
+	GENL_MIN_ID       = NLMSG_MIN_TYPE
+	GENL_MAX_ID       = 1023
+	GENL_ID_CTRL      = GENL_MIN_ID
+	GENL_ID_VFS_DQUOT = GENL_MIN_ID + 1
+	GENL_ID_PMCRAID   = GENL_MIN_ID + 2
+
+	// GENL_START_ALLOC is the first dynamically allocated family ID, from
+	// net/netlink/genetlink.c.
+	GENL_START_ALLOC = GENL_MIN_ID + 3
+)
+
+// Generic netlink operation flags, from uapi/linux/genetlink.h.
+const (
+	GENL_ADMIN_PERM     = 0x01
+	GENL_CMD_CAP_DO     = 0x02
+	GENL_CMD_CAP_DUMP   = 0x04
+	GENL_CMD_CAP_HASPOL = 0x08
+	GENL_UNS_ADMIN_PERM = 0x10
+)
+
+// Generic netlink controller commands, from uapi/linux/genetlink.h.
+const (
+	CTRL_CMD_UNSPEC       = 0
+	CTRL_CMD_NEWFAMILY    = 1
+	CTRL_CMD_DELFAMILY    = 2
+	CTRL_CMD_GETFAMILY    = 3
+	CTRL_CMD_NEWOPS       = 4
+	CTRL_CMD_DELOPS       = 5
+	CTRL_CMD_GETOPS       = 6
+	CTRL_CMD_NEWMCAST_GRP = 7
+	CTRL_CMD_DELMCAST_GRP = 8
+	CTRL_CMD_GETMCAST_GRP = 9
+	CTRL_CMD_GETPOLICY    = 10
+)
+
+// Generic netlink controller attributes, from uapi/linux/genetlink.h.
+const (
+	CTRL_ATTR_UNSPEC       = 0
+	CTRL_ATTR_FAMILY_ID    = 1
+	CTRL_ATTR_FAMILY_NAME  = 2
+	CTRL_ATTR_VERSION      = 3
+	CTRL_ATTR_HDRSIZE      = 4
+	CTRL_ATTR_MAXATTR      = 5
+	CTRL_ATTR_OPS          = 6
+	CTRL_ATTR_MCAST_GROUPS = 7
+	CTRL_ATTR_POLICY       = 8
+	CTRL_ATTR_OP_POLICY    = 9
+	CTRL_ATTR_OP           = 10
+)
+
+// Generic netlink controller operation attributes, from
+// uapi/linux/genetlink.h.
+const (
+	CTRL_ATTR_OP_UNSPEC = 0
+	CTRL_ATTR_OP_ID     = 1
+	CTRL_ATTR_OP_FLAGS  = 2
+)
+
+// Generic netlink controller multicast group attributes, from
+// uapi/linux/genetlink.h.
+const (
+	CTRL_ATTR_MCAST_GRP_UNSPEC = 0
+	CTRL_ATTR_MCAST_GRP_NAME   = 1
+	CTRL_ATTR_MCAST_GRP_ID     = 2
+)
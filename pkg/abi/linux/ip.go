@@ -103,6 +103,12 @@ const (
 	IP_PMTUDISC_OMIT      = 5
 )
 
+// Multicast source filter modes from uapi/linux/in.h
+const (
+	MCAST_EXCLUDE = 0
+	MCAST_INCLUDE = 1
+)
+
 // Socket options from uapi/linux/in6.h
 const (
 	IPV6_ADDRFORM         = 1
@@ -0,0 +1,92 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// SO_TIMESTAMPING flags, from include/uapi/linux/net_tstamp.h.
+const (
+	SOF_TIMESTAMPING_TX_HARDWARE  = 1 << 0
+	SOF_TIMESTAMPING_TX_SOFTWARE  = 1 << 1
+	SOF_TIMESTAMPING_RX_HARDWARE  = 1 << 2
+	SOF_TIMESTAMPING_RX_SOFTWARE  = 1 << 3
+	SOF_TIMESTAMPING_SOFTWARE     = 1 << 4
+	SOF_TIMESTAMPING_SYS_HARDWARE = 1 << 5
+	SOF_TIMESTAMPING_RAW_HARDWARE = 1 << 6
+	SOF_TIMESTAMPING_OPT_ID       = 1 << 7
+	SOF_TIMESTAMPING_TX_SCHED     = 1 << 8
+	SOF_TIMESTAMPING_TX_ACK       = 1 << 9
+	SOF_TIMESTAMPING_OPT_CMSG     = 1 << 10
+	SOF_TIMESTAMPING_OPT_TSONLY   = 1 << 11
+	SOF_TIMESTAMPING_OPT_STATS    = 1 << 12
+	SOF_TIMESTAMPING_OPT_PKTINFO  = 1 << 13
+	SOF_TIMESTAMPING_OPT_TX_SWHW  = 1 << 14
+	SOF_TIMESTAMPING_BIND_PHC     = 1 << 15
+	SOF_TIMESTAMPING_OPT_ID_TCP   = 1 << 16
+
+	SOF_TIMESTAMPING_LAST = SOF_TIMESTAMPING_OPT_ID_TCP
+	SOF_TIMESTAMPING_MASK = SOF_TIMESTAMPING_LAST<<1 - 1
+
+	// SOF_TIMESTAMPING_TX_RECORD_MASK is the set of flags that may be passed
+	// in a per-message SO_TIMESTAMPING control message.
+	SOF_TIMESTAMPING_TX_RECORD_MASK = SOF_TIMESTAMPING_TX_HARDWARE |
+		SOF_TIMESTAMPING_TX_SOFTWARE |
+		SOF_TIMESTAMPING_TX_SCHED |
+		SOF_TIMESTAMPING_TX_ACK
+)
+
+// SO_TXTIME flags, from include/uapi/linux/net_tstamp.h.
+const (
+	SOF_TXTIME_DEADLINE_MODE = 1 << 0
+	SOF_TXTIME_REPORT_ERRORS = 1 << 1
+
+	SOF_TXTIME_FLAGS_LAST = SOF_TXTIME_REPORT_ERRORS
+	SOF_TXTIME_FLAGS_MASK = SOF_TXTIME_FLAGS_LAST<<1 - 1
+)
+
+// Control message types for timestamping, from
+// include/uapi/asm-generic/socket.h.
+const (
+	SCM_TIMESTAMPING = SO_TIMESTAMPING
+	SCM_TXTIME       = SO_TXTIME
+)
+
+// SizeOfControlMessageTimestamping is the size of a per-message
+// SO_TIMESTAMPING control message on send.
+const SizeOfControlMessageTimestamping = 4
+
+// SizeOfControlMessageTXTime is the size of a SCM_TXTIME control message.
+const SizeOfControlMessageTXTime = 8
+
+// ScmTimestamping is struct scm_timestamping, from
+// include/uapi/linux/errqueue.h. Ts[0] holds the software timestamp; Ts[2]
+// holds the raw hardware timestamp and Ts[1] is unused.
+//
+// +marshal
+type ScmTimestamping struct {
+	Ts [3]Timespec
+}
+
+// SizeOfScmTimestamping is the size of ScmTimestamping.
+const SizeOfScmTimestamping = 48
+
+// SockTxtime is struct sock_txtime, from include/uapi/linux/net_tstamp.h.
+//
+// +marshal
+type SockTxtime struct {
+	ClockID int32
+	Flags   uint32
+}
+
+// SizeOfSockTxtime is the size of SockTxtime.
+const SizeOfSockTxtime = 8
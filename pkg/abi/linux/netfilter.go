@@ -436,6 +436,78 @@ type XTNATTargetV2 struct {
 // SizeOfXTNATTargetV2 is the size of an XTNATTargetV2.
 const SizeOfXTNATTargetV2 = SizeOfXTEntryTarget + SizeOfNFNATRange2
 
+// XTTPROXYTargetV0 redirects packets to a local transparent socket when
+// reached. It corresponds to struct xt_tproxy_target_info in
+// include/uapi/linux/netfilter/xt_TPROXY.h, padded to be 8 byte aligned.
+//
+// +marshal
+type XTTPROXYTargetV0 struct {
+	Target    XTEntryTarget
+	MarkMask  uint32
+	MarkValue uint32
+	LocalAddr InetAddr
+	LocalPort uint16
+	_         [2]byte
+}
+
+// SizeOfXTTPROXYTargetV0 is the size of an XTTPROXYTargetV0.
+const SizeOfXTTPROXYTargetV0 = 48
+
+// XTTPROXYTargetV1 redirects packets to a local transparent socket when
+// reached. It corresponds to struct xt_tproxy_target_info_v1 in
+// include/uapi/linux/netfilter/xt_TPROXY.h, padded to be 8 byte aligned.
+//
+// +marshal
+type XTTPROXYTargetV1 struct {
+	Target    XTEntryTarget
+	MarkMask  uint32
+	MarkValue uint32
+	LocalAddr [16]byte
+	LocalPort uint16
+	_         [6]byte
+}
+
+// SizeOfXTTPROXYTargetV1 is the size of an XTTPROXYTargetV1.
+const SizeOfXTTPROXYTargetV1 = 64
+
+// XTMarkTargetV2 changes the mark of packets when reached. It corresponds to
+// struct xt_mark_tginfo2 in include/uapi/linux/netfilter/xt_mark.h.
+//
+// +marshal
+type XTMarkTargetV2 struct {
+	Target XTEntryTarget
+	Mark   uint32
+	Mask   uint32
+}
+
+// SizeOfXTMarkTargetV2 is the size of an XTMarkTargetV2.
+const SizeOfXTMarkTargetV2 = 40
+
+// XTConnMarkTargetV1 changes the mark of connections, or restores the mark of
+// packets from it, when reached. It corresponds to struct xt_connmark_tginfo1
+// in include/uapi/linux/netfilter/xt_connmark.h, padded to be 8 byte aligned.
+//
+// +marshal
+type XTConnMarkTargetV1 struct {
+	Target XTEntryTarget
+	CTMark uint32
+	CTMask uint32
+	NFMask uint32
+	Mode   uint8
+	_      [3]byte
+}
+
+// SizeOfXTConnMarkTargetV1 is the size of an XTConnMarkTargetV1.
+const SizeOfXTConnMarkTargetV1 = 48
+
+// Modes of XTConnMarkTargetV1. Corresponding constants are in
+// include/uapi/linux/netfilter/xt_connmark.h.
+const (
+	XT_CONNMARK_SET = iota
+	XT_CONNMARK_SAVE
+	XT_CONNMARK_RESTORE
+)
+
 // IPTGetinfo is the argument for the IPT_SO_GET_INFO sockopt. It corresponds
 // to struct ipt_getinfo in include/uapi/linux/netfilter_ipv4/ip_tables.h.
 //
@@ -716,6 +788,47 @@ type XTOwnerMatchInfo struct {
 // SizeOfXTOwnerMatchInfo is the size of an XTOwnerMatchInfo.
 const SizeOfXTOwnerMatchInfo = 20
 
+// XTSocketMatchInfo holds data for matching packets with revisions 1 to 3 of
+// the socket matcher. It corresponds to struct xt_socket_mtinfo1,
+// xt_socket_mtinfo2 and xt_socket_mtinfo3 in
+// include/uapi/linux/netfilter/xt_socket.h.
+//
+// +marshal
+type XTSocketMatchInfo struct {
+	// Flags is a combination of the XT_SOCKET_* flags below.
+	Flags uint8
+}
+
+// SizeOfXTSocketMatchInfo is the size of an XTSocketMatchInfo.
+const SizeOfXTSocketMatchInfo = 1
+
+// XTMarkMatchInfo holds data for matching packets with revision 1 of the mark
+// and connmark matchers. It corresponds to struct xt_mark_mtinfo1 in
+// include/uapi/linux/netfilter/xt_mark.h and struct xt_connmark_mtinfo1 in
+// include/uapi/linux/netfilter/xt_connmark.h, which have the same layout.
+//
+// +marshal
+type XTMarkMatchInfo struct {
+	Mark   uint32
+	Mask   uint32
+	Invert uint8
+	_      [3]byte
+}
+
+// SizeOfXTMarkMatchInfo is the size of an XTMarkMatchInfo.
+const SizeOfXTMarkMatchInfo = 12
+
+// Flags in XTSocketMatchInfo. Corresponding constants are in
+// include/uapi/linux/netfilter/xt_socket.h.
+const (
+	// Only match transparent sockets.
+	XT_SOCKET_TRANSPARENT = 1 << 0
+	// Also match sockets bound to the unspecified address.
+	XT_SOCKET_NOWILDCARD = 1 << 1
+	// Restore the packet mark from the socket.
+	XT_SOCKET_RESTORE_SKMARK = 1 << 2
+)
+
 // Flags in IPTOwnerInfo.Match and XTOwnerMatchInfo.Match. Corresponding
 // constants are in include/uapi/linux/netfilter/xt_owner.h.
 const (
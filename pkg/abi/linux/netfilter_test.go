@@ -35,6 +35,12 @@ func TestSizes(t *testing.T) {
 		{XTEntryTarget{}, SizeOfXTEntryTarget},
 		{XTErrorTarget{}, SizeOfXTErrorTarget},
 		{XTStandardTarget{}, SizeOfXTStandardTarget},
+		{XTTPROXYTargetV0{}, SizeOfXTTPROXYTargetV0},
+		{XTTPROXYTargetV1{}, SizeOfXTTPROXYTargetV1},
+		{XTSocketMatchInfo{}, SizeOfXTSocketMatchInfo},
+		{XTMarkTargetV2{}, SizeOfXTMarkTargetV2},
+		{XTConnMarkTargetV1{}, SizeOfXTConnMarkTargetV1},
+		{XTMarkMatchInfo{}, SizeOfXTMarkMatchInfo},
 		{IP6TReplace{}, SizeOfIP6TReplace},
 		{IP6TEntry{}, SizeOfIP6TEntry},
 		{IP6TIP{}, SizeOfIP6TIP},
@@ -183,6 +183,104 @@ const (
 	VETH_INFO_PEER = 1
 )
 
+// VXLAN link info data attributes, from uapi/linux/if_link.h.
+const (
+	IFLA_VXLAN_UNSPEC            = 0
+	IFLA_VXLAN_ID                = 1
+	IFLA_VXLAN_GROUP             = 2
+	IFLA_VXLAN_LINK              = 3
+	IFLA_VXLAN_LOCAL             = 4
+	IFLA_VXLAN_TTL               = 5
+	IFLA_VXLAN_TOS               = 6
+	IFLA_VXLAN_LEARNING          = 7
+	IFLA_VXLAN_AGEING            = 8
+	IFLA_VXLAN_LIMIT             = 9
+	IFLA_VXLAN_PORT_RANGE        = 10
+	IFLA_VXLAN_PROXY             = 11
+	IFLA_VXLAN_RSC               = 12
+	IFLA_VXLAN_L2MISS            = 13
+	IFLA_VXLAN_L3MISS            = 14
+	IFLA_VXLAN_PORT              = 15
+	IFLA_VXLAN_GROUP6            = 16
+	IFLA_VXLAN_LOCAL6            = 17
+	IFLA_VXLAN_UDP_CSUM          = 18
+	IFLA_VXLAN_UDP_ZERO_CSUM6_TX = 19
+	IFLA_VXLAN_UDP_ZERO_CSUM6_RX = 20
+	IFLA_VXLAN_REMCSUM_TX        = 21
+	IFLA_VXLAN_REMCSUM_RX        = 22
+	IFLA_VXLAN_GBP               = 23
+	IFLA_VXLAN_REMCSUM_NOPARTIAL = 24
+	IFLA_VXLAN_COLLECT_METADATA  = 25
+	IFLA_VXLAN_LABEL             = 26
+	IFLA_VXLAN_GPE               = 27
+	IFLA_VXLAN_TTL_INHERIT       = 28
+	IFLA_VXLAN_DF                = 29
+)
+
+// GRE link info data attributes, from uapi/linux/if_tunnel.h.
+const (
+	IFLA_GRE_UNSPEC           = 0
+	IFLA_GRE_LINK             = 1
+	IFLA_GRE_IFLAGS           = 2
+	IFLA_GRE_OFLAGS           = 3
+	IFLA_GRE_IKEY             = 4
+	IFLA_GRE_OKEY             = 5
+	IFLA_GRE_LOCAL            = 6
+	IFLA_GRE_REMOTE           = 7
+	IFLA_GRE_TTL              = 8
+	IFLA_GRE_TOS              = 9
+	IFLA_GRE_PMTUDISC         = 10
+	IFLA_GRE_ENCAP_LIMIT      = 11
+	IFLA_GRE_FLOWINFO         = 12
+	IFLA_GRE_FLAGS            = 13
+	IFLA_GRE_ENCAP_TYPE       = 14
+	IFLA_GRE_ENCAP_FLAGS      = 15
+	IFLA_GRE_ENCAP_SPORT      = 16
+	IFLA_GRE_ENCAP_DPORT      = 17
+	IFLA_GRE_COLLECT_METADATA = 18
+	IFLA_GRE_IGNORE_DF        = 19
+	IFLA_GRE_FWMARK           = 20
+)
+
+// GRE flags carried in IFLA_GRE_IFLAGS and IFLA_GRE_OFLAGS in network byte
+// order, from uapi/linux/if_tunnel.h.
+const (
+	GRE_CSUM    = 0x8000
+	GRE_ROUTING = 0x4000
+	GRE_KEY     = 0x2000
+	GRE_SEQ     = 0x1000
+	GRE_STRICT  = 0x0800
+	GRE_REC     = 0x0700
+	GRE_ACK     = 0x0080
+	GRE_FLAGS   = 0x0078
+	GRE_VERSION = 0x0007
+)
+
+// IP tunnel link info data attributes, from uapi/linux/if_tunnel.h.
+const (
+	IFLA_IPTUN_UNSPEC              = 0
+	IFLA_IPTUN_LINK                = 1
+	IFLA_IPTUN_LOCAL               = 2
+	IFLA_IPTUN_REMOTE              = 3
+	IFLA_IPTUN_TTL                 = 4
+	IFLA_IPTUN_TOS                 = 5
+	IFLA_IPTUN_ENCAP_LIMIT         = 6
+	IFLA_IPTUN_FLOWINFO            = 7
+	IFLA_IPTUN_FLAGS               = 8
+	IFLA_IPTUN_PROTO               = 9
+	IFLA_IPTUN_PMTUDISC            = 10
+	IFLA_IPTUN_6RD_PREFIX          = 11
+	IFLA_IPTUN_6RD_RELAY_PREFIX    = 12
+	IFLA_IPTUN_6RD_PREFIXLEN       = 13
+	IFLA_IPTUN_6RD_RELAY_PREFIXLEN = 14
+	IFLA_IPTUN_ENCAP_TYPE          = 15
+	IFLA_IPTUN_ENCAP_FLAGS         = 16
+	IFLA_IPTUN_ENCAP_SPORT         = 17
+	IFLA_IPTUN_ENCAP_DPORT         = 18
+	IFLA_IPTUN_COLLECT_METADATA    = 19
+	IFLA_IPTUN_FWMARK              = 20
+)
+
 // InterfaceAddrMessage is struct ifaddrmsg, from uapi/linux/if_addr.h.
 //
 // +marshal
@@ -214,7 +312,10 @@ const (
 const (
 	ARPHRD_NONE     = 65534
 	ARPHRD_ETHER    = 1
+	ARPHRD_TUNNEL   = 768
 	ARPHRD_LOOPBACK = 772
+	ARPHRD_SIT      = 776
+	ARPHRD_IPGRE    = 778
 )
 
 // RouteMessage is struct rtmsg, from uapi/linux/rtnetlink.h.
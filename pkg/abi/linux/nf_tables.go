@@ -207,3 +207,324 @@ const (
 	NFT_META_SDIFNAME             // Slave device interface name
 	NFT_META_BRI_BROUTE           // Packet br_netfilter_broute bit
 )
+
+// Maximum lengths of nf_tables object names, from
+// include/uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_NAME_MAXLEN      = 256
+	NFT_TABLE_MAXNAMELEN = NFT_NAME_MAXLEN
+	NFT_CHAIN_MAXNAMELEN = NFT_NAME_MAXLEN
+	NFT_SET_MAXNAMELEN   = NFT_NAME_MAXLEN
+	NFT_USERDATA_MAXLEN  = 256
+)
+
+// Message types of the NFNL_SUBSYS_NFTABLES netfilter netlink subsystem.
+// These correspond to enum nf_tables_msg_types in
+// include/uapi/linux/netfilter/nf_tables.h.
+const (
+	NFT_MSG_NEWTABLE = iota
+	NFT_MSG_GETTABLE
+	NFT_MSG_DELTABLE
+	NFT_MSG_NEWCHAIN
+	NFT_MSG_GETCHAIN
+	NFT_MSG_DELCHAIN
+	NFT_MSG_NEWRULE
+	NFT_MSG_GETRULE
+	NFT_MSG_DELRULE
+	NFT_MSG_NEWSET
+	NFT_MSG_GETSET
+	NFT_MSG_DELSET
+	NFT_MSG_NEWSETELEM
+	NFT_MSG_GETSETELEM
+	NFT_MSG_DELSETELEM
+	NFT_MSG_NEWGEN
+	NFT_MSG_GETGEN
+	NFT_MSG_TRACE
+	NFT_MSG_NEWOBJ
+	NFT_MSG_GETOBJ
+	NFT_MSG_DELOBJ
+	NFT_MSG_GETOBJ_RESET
+	NFT_MSG_NEWFLOWTABLE
+	NFT_MSG_GETFLOWTABLE
+	NFT_MSG_DELFLOWTABLE
+	NFT_MSG_GETRULE_RESET
+	NFT_MSG_DESTROYTABLE
+	NFT_MSG_DESTROYCHAIN
+	NFT_MSG_DESTROYRULE
+	NFT_MSG_DESTROYSET
+	NFT_MSG_DESTROYSETELEM
+	NFT_MSG_DESTROYOBJ
+	NFT_MSG_DESTROYFLOWTABLE
+	NFT_MSG_GETSETELEM_RESET
+	NFT_MSG_MAX
+)
+
+// NFTA_LIST_ELEM is the attribute type of the elements of a nested list.
+const NFTA_LIST_ELEM = 1
+
+// Attributes of a hook, nested in NFTA_CHAIN_HOOK.
+// These correspond to enum nft_hook_attributes in
+// include/uapi/linux/netfilter/nf_tables.h.
+const (
+	NFTA_HOOK_UNSPEC = iota
+	NFTA_HOOK_HOOKNUM
+	NFTA_HOOK_PRIORITY
+	NFTA_HOOK_DEV
+	NFTA_HOOK_DEVS
+)
+
+// Table flags, from enum nft_table_flags.
+const (
+	NFT_TABLE_F_DORMANT = 0x1
+	NFT_TABLE_F_OWNER   = 0x2
+	NFT_TABLE_F_PERSIST = 0x4
+)
+
+// Attributes of a table.
+// These correspond to enum nft_table_attributes.
+const (
+	NFTA_TABLE_UNSPEC = iota
+	NFTA_TABLE_NAME
+	NFTA_TABLE_FLAGS
+	NFTA_TABLE_USE
+	NFTA_TABLE_HANDLE
+	NFTA_TABLE_PAD
+	NFTA_TABLE_USERDATA
+	NFTA_TABLE_OWNER
+)
+
+// Chain flags, from enum nft_chain_flags.
+const (
+	NFT_CHAIN_BASE       = 0x1
+	NFT_CHAIN_HW_OFFLOAD = 0x2
+	NFT_CHAIN_BINDING    = 0x4
+)
+
+// Attributes of a chain.
+// These correspond to enum nft_chain_attributes.
+const (
+	NFTA_CHAIN_UNSPEC = iota
+	NFTA_CHAIN_TABLE
+	NFTA_CHAIN_HANDLE
+	NFTA_CHAIN_NAME
+	NFTA_CHAIN_HOOK
+	NFTA_CHAIN_POLICY
+	NFTA_CHAIN_USE
+	NFTA_CHAIN_TYPE
+	NFTA_CHAIN_COUNTERS
+	NFTA_CHAIN_PAD
+	NFTA_CHAIN_FLAGS
+	NFTA_CHAIN_ID
+	NFTA_CHAIN_USERDATA
+)
+
+// Attributes of a rule.
+// These correspond to enum nft_rule_attributes.
+const (
+	NFTA_RULE_UNSPEC = iota
+	NFTA_RULE_TABLE
+	NFTA_RULE_CHAIN
+	NFTA_RULE_HANDLE
+	NFTA_RULE_EXPRESSIONS
+	NFTA_RULE_COMPAT
+	NFTA_RULE_POSITION
+	NFTA_RULE_USERDATA
+	NFTA_RULE_PAD
+	NFTA_RULE_ID
+	NFTA_RULE_POSITION_ID
+	NFTA_RULE_CHAIN_ID
+)
+
+// Set flags, from enum nft_set_flags.
+const (
+	NFT_SET_ANONYMOUS = 0x1
+	NFT_SET_CONSTANT  = 0x2
+	NFT_SET_INTERVAL  = 0x4
+	NFT_SET_MAP       = 0x8
+	NFT_SET_TIMEOUT   = 0x10
+	NFT_SET_EVAL      = 0x20
+	NFT_SET_OBJECT    = 0x40
+	NFT_SET_CONCAT    = 0x80
+	NFT_SET_EXPR      = 0x100
+)
+
+// Attributes of a set.
+// These correspond to enum nft_set_attributes.
+const (
+	NFTA_SET_UNSPEC = iota
+	NFTA_SET_TABLE
+	NFTA_SET_NAME
+	NFTA_SET_FLAGS
+	NFTA_SET_KEY_TYPE
+	NFTA_SET_KEY_LEN
+	NFTA_SET_DATA_TYPE
+	NFTA_SET_DATA_LEN
+	NFTA_SET_POLICY
+	NFTA_SET_DESC
+	NFTA_SET_ID
+	NFTA_SET_TIMEOUT
+	NFTA_SET_GC_INTERVAL
+	NFTA_SET_USERDATA
+	NFTA_SET_PAD
+	NFTA_SET_OBJ_TYPE
+	NFTA_SET_HANDLE
+	NFTA_SET_EXPR
+	NFTA_SET_EXPRESSIONS
+)
+
+// NFT_SET_ELEM_INTERVAL_END marks a set element as the (exclusive) end of an
+// interval, from enum nft_set_elem_flags.
+const NFT_SET_ELEM_INTERVAL_END = 0x1
+
+// Attributes of a set element.
+// These correspond to enum nft_set_elem_attributes.
+const (
+	NFTA_SET_ELEM_UNSPEC = iota
+	NFTA_SET_ELEM_KEY
+	NFTA_SET_ELEM_DATA
+	NFTA_SET_ELEM_FLAGS
+	NFTA_SET_ELEM_TIMEOUT
+	NFTA_SET_ELEM_EXPIRATION
+	NFTA_SET_ELEM_USERDATA
+	NFTA_SET_ELEM_EXPR
+	NFTA_SET_ELEM_PAD
+	NFTA_SET_ELEM_OBJREF
+	NFTA_SET_ELEM_KEY_END
+	NFTA_SET_ELEM_EXPRESSIONS
+)
+
+// Attributes of a list of set elements.
+// These correspond to enum nft_set_elem_list_attributes.
+const (
+	NFTA_SET_ELEM_LIST_UNSPEC = iota
+	NFTA_SET_ELEM_LIST_TABLE
+	NFTA_SET_ELEM_LIST_SET
+	NFTA_SET_ELEM_LIST_ELEMENTS
+	NFTA_SET_ELEM_LIST_SET_ID
+)
+
+// Attributes of data, from enum nft_data_attributes.
+const (
+	NFTA_DATA_UNSPEC = iota
+	NFTA_DATA_VALUE
+	NFTA_DATA_VERDICT
+)
+
+// Attributes of a verdict, from enum nft_verdict_attributes.
+const (
+	NFTA_VERDICT_UNSPEC = iota
+	NFTA_VERDICT_CODE
+	NFTA_VERDICT_CHAIN
+	NFTA_VERDICT_CHAIN_ID
+)
+
+// Attributes of an expression, from enum nft_expr_attributes.
+const (
+	NFTA_EXPR_UNSPEC = iota
+	NFTA_EXPR_NAME
+	NFTA_EXPR_DATA
+)
+
+// Attributes of the immediate expression, from enum nft_immediate_attributes.
+const (
+	NFTA_IMMEDIATE_UNSPEC = iota
+	NFTA_IMMEDIATE_DREG
+	NFTA_IMMEDIATE_DATA
+)
+
+// Attributes of the bitwise expression, from enum nft_bitwise_attributes.
+const (
+	NFTA_BITWISE_UNSPEC = iota
+	NFTA_BITWISE_SREG
+	NFTA_BITWISE_DREG
+	NFTA_BITWISE_LEN
+	NFTA_BITWISE_MASK
+	NFTA_BITWISE_XOR
+	NFTA_BITWISE_OP
+	NFTA_BITWISE_DATA
+)
+
+// Attributes of the byteorder expression, from enum nft_byteorder_attributes.
+const (
+	NFTA_BYTEORDER_UNSPEC = iota
+	NFTA_BYTEORDER_SREG
+	NFTA_BYTEORDER_DREG
+	NFTA_BYTEORDER_OP
+	NFTA_BYTEORDER_LEN
+	NFTA_BYTEORDER_SIZE
+)
+
+// Attributes of the cmp expression, from enum nft_cmp_attributes.
+const (
+	NFTA_CMP_UNSPEC = iota
+	NFTA_CMP_SREG
+	NFTA_CMP_OP
+	NFTA_CMP_DATA
+)
+
+// Attributes of the range expression, from enum nft_range_attributes.
+const (
+	NFTA_RANGE_UNSPEC = iota
+	NFTA_RANGE_SREG
+	NFTA_RANGE_OP
+	NFTA_RANGE_FROM_DATA
+	NFTA_RANGE_TO_DATA
+)
+
+// NFT_LOOKUP_F_INV inverts the result of a lookup, from enum
+// nft_lookup_flags.
+const NFT_LOOKUP_F_INV = 0x1
+
+// Attributes of the lookup expression, from enum nft_lookup_attributes.
+const (
+	NFTA_LOOKUP_UNSPEC = iota
+	NFTA_LOOKUP_SET
+	NFTA_LOOKUP_SREG
+	NFTA_LOOKUP_DREG
+	NFTA_LOOKUP_SET_ID
+	NFTA_LOOKUP_FLAGS
+)
+
+// Attributes of the payload expression, from enum nft_payload_attributes.
+const (
+	NFTA_PAYLOAD_UNSPEC = iota
+	NFTA_PAYLOAD_DREG
+	NFTA_PAYLOAD_BASE
+	NFTA_PAYLOAD_OFFSET
+	NFTA_PAYLOAD_LEN
+	NFTA_PAYLOAD_SREG
+	NFTA_PAYLOAD_CSUM_TYPE
+	NFTA_PAYLOAD_CSUM_OFFSET
+	NFTA_PAYLOAD_CSUM_FLAGS
+)
+
+// Attributes of the meta expression, from enum nft_meta_attributes.
+const (
+	NFTA_META_UNSPEC = iota
+	NFTA_META_DREG
+	NFTA_META_KEY
+	NFTA_META_SREG
+)
+
+// Attributes of the rt expression, from enum nft_rt_attributes.
+const (
+	NFTA_RT_UNSPEC = iota
+	NFTA_RT_DREG
+	NFTA_RT_KEY
+)
+
+// Attributes of the counter expression, from enum nft_counter_attributes.
+const (
+	NFTA_COUNTER_UNSPEC = iota
+	NFTA_COUNTER_BYTES
+	NFTA_COUNTER_PACKETS
+	NFTA_COUNTER_PAD
+)
+
+// Attributes of the ruleset generation, from enum nft_gen_attributes.
+const (
+	NFTA_GEN_UNSPEC = iota
+	NFTA_GEN_ID
+	NFTA_GEN_PROC_PID
+	NFTA_GEN_PROC_NAME
+)
@@ -0,0 +1,85 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Netfilter netlink subsystem IDs, from uapi/linux/netfilter/nfnetlink.h.
+const (
+	NFNL_SUBSYS_NONE              = 0
+	NFNL_SUBSYS_CTNETLINK         = 1
+	NFNL_SUBSYS_CTNETLINK_EXP     = 2
+	NFNL_SUBSYS_QUEUE             = 3
+	NFNL_SUBSYS_ULOG              = 4
+	NFNL_SUBSYS_OSF               = 5
+	NFNL_SUBSYS_IPSET             = 6
+	NFNL_SUBSYS_ACCT              = 7
+	NFNL_SUBSYS_CTNETLINK_TIMEOUT = 8
+	NFNL_SUBSYS_CTHELPER          = 9
+	NFNL_SUBSYS_NFTABLES          = 10
+	NFNL_SUBSYS_NFT_COMPAT        = 11
+	NFNL_SUBSYS_HOOK              = 12
+	NFNL_SUBSYS_COUNT             = 13
+)
+
+// Netfilter netlink batch message types, from
+// uapi/linux/netfilter/nfnetlink.h.
+const (
+	NFNL_MSG_BATCH_BEGIN = NLMSG_MIN_TYPE
+	NFNL_MSG_BATCH_END   = NLMSG_MIN_TYPE + 1
+)
+
+// Netfilter netlink multicast groups, from uapi/linux/netfilter/nfnetlink.h.
+const (
+	NFNLGRP_NONE                  = 0
+	NFNLGRP_CONNTRACK_NEW         = 1
+	NFNLGRP_CONNTRACK_UPDATE      = 2
+	NFNLGRP_CONNTRACK_DESTROY     = 3
+	NFNLGRP_CONNTRACK_EXP_NEW     = 4
+	NFNLGRP_CONNTRACK_EXP_UPDATE  = 5
+	NFNLGRP_CONNTRACK_EXP_DESTROY = 6
+	NFNLGRP_NFTABLES              = 7
+	NFNLGRP_ACCT_QUOTA            = 8
+	NFNLGRP_NFTRACE               = 9
+	NFNLGRP_MAX                   = 9
+)
+
+// NFNETLINK_V0 is the only netfilter netlink message version.
+const NFNETLINK_V0 = 0
+
+// NFNLSubsysID returns the subsystem of a netfilter netlink message type.
+func NFNLSubsysID(msgType uint16) uint16 {
+	return (msgType & 0xff00) >> 8
+}
+
+// NFNLMsgType returns the subsystem-specific message type of a netfilter
+// netlink message type.
+func NFNLMsgType(msgType uint16) uint16 {
+	return msgType & 0x00ff
+}
+
+// NetFilterGenMsg is the header of all netfilter netlink messages.
+//
+// ResourceID is in network byte order.
+//
+// This is struct nfgenmsg, from uapi/linux/netfilter/nfnetlink.h.
+//
+// +marshal
+type NetFilterGenMsg struct {
+	Family     uint8
+	Version    uint8
+	ResourceID uint16
+}
+
+// NetFilterGenMsgSize is the size of NetFilterGenMsg.
+const NetFilterGenMsgSize = 4
@@ -0,0 +1,193 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// TcMsg is struct tcmsg, from uapi/linux/rtnetlink.h.
+//
+// +marshal
+type TcMsg struct {
+	Family  uint8
+	Pad1    uint8
+	Pad2    uint16
+	Ifindex int32
+	Handle  uint32
+	Parent  uint32
+	Info    uint32
+}
+
+// SizeOfTcMsg is the size of TcMsg.
+const SizeOfTcMsg = 20
+
+// Traffic control attributes, from uapi/linux/rtnetlink.h.
+const (
+	TCA_UNSPEC         = 0
+	TCA_KIND           = 1
+	TCA_OPTIONS        = 2
+	TCA_STATS          = 3
+	TCA_XSTATS         = 4
+	TCA_RATE           = 5
+	TCA_FCNT           = 6
+	TCA_STATS2         = 7
+	TCA_STAB           = 8
+	TCA_PAD            = 9
+	TCA_DUMP_INVISIBLE = 10
+	TCA_CHAIN          = 11
+	TCA_HW_OFFLOAD     = 12
+	TCA_INGRESS_BLOCK  = 13
+	TCA_EGRESS_BLOCK   = 14
+	TCA_DUMP_FLAGS     = 15
+	TCA_EXT_WARN_MSG   = 16
+)
+
+// Traffic control handles, from uapi/linux/pkt_sched.h.
+const (
+	TC_H_MAJ_MASK = 0xFFFF0000
+	TC_H_MIN_MASK = 0x0000FFFF
+	TC_H_UNSPEC   = 0
+	TC_H_ROOT     = 0xFFFFFFFF
+	TC_H_INGRESS  = 0xFFFFFFF1
+	TC_H_CLSACT   = TC_H_INGRESS
+)
+
+// PSCHED_SHIFT is the number of bits a packet scheduler tick is shifted by to
+// convert it to nanoseconds, from include/net/pkt_sched.h.
+const PSCHED_SHIFT = 6
+
+// TcRateSpec is struct tc_ratespec, from uapi/linux/pkt_sched.h.
+//
+// +marshal
+type TcRateSpec struct {
+	CellLog   uint8
+	Linklayer uint8
+	Overhead  uint16
+	CellAlign int16
+	MPU       uint16
+	Rate      uint32
+}
+
+// TBF attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_TBF_UNSPEC  = 0
+	TCA_TBF_PARMS   = 1
+	TCA_TBF_RTAB    = 2
+	TCA_TBF_PTAB    = 3
+	TCA_TBF_RATE64  = 4
+	TCA_TBF_PRATE64 = 5
+	TCA_TBF_BURST   = 6
+	TCA_TBF_PBURST  = 7
+	TCA_TBF_PAD     = 8
+)
+
+// TcTbfQopt is struct tc_tbf_qopt, from uapi/linux/pkt_sched.h.
+//
+// +marshal
+type TcTbfQopt struct {
+	Rate     TcRateSpec
+	PeakRate TcRateSpec
+	Limit    uint32
+	Buffer   uint32
+	MTU      uint32
+}
+
+// SizeOfTcTbfQopt is the size of TcTbfQopt.
+const SizeOfTcTbfQopt = 36
+
+// FQ_CoDel attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_FQ_CODEL_UNSPEC                = 0
+	TCA_FQ_CODEL_TARGET                = 1
+	TCA_FQ_CODEL_LIMIT                 = 2
+	TCA_FQ_CODEL_INTERVAL              = 3
+	TCA_FQ_CODEL_ECN                   = 4
+	TCA_FQ_CODEL_FLOWS                 = 5
+	TCA_FQ_CODEL_QUANTUM               = 6
+	TCA_FQ_CODEL_CE_THRESHOLD          = 7
+	TCA_FQ_CODEL_DROP_BATCH_SIZE       = 8
+	TCA_FQ_CODEL_MEMORY_LIMIT          = 9
+	TCA_FQ_CODEL_CE_THRESHOLD_SELECTOR = 10
+	TCA_FQ_CODEL_CE_THRESHOLD_MASK     = 11
+)
+
+// PRIO constants, from uapi/linux/pkt_sched.h.
+const (
+	TCQ_PRIO_BANDS     = 16
+	TCQ_MIN_PRIO_BANDS = 2
+	TC_PRIO_MAX        = 15
+)
+
+// TcPrioQopt is struct tc_prio_qopt, from uapi/linux/pkt_sched.h.
+//
+// +marshal
+type TcPrioQopt struct {
+	Bands   int32
+	Priomap [TC_PRIO_MAX + 1]uint8
+}
+
+// SizeOfTcPrioQopt is the size of TcPrioQopt.
+const SizeOfTcPrioQopt = 20
+
+// NETEM attributes, from uapi/linux/pkt_sched.h.
+const (
+	TCA_NETEM_UNSPEC     = 0
+	TCA_NETEM_CORR       = 1
+	TCA_NETEM_DELAY_DIST = 2
+	TCA_NETEM_REORDER    = 3
+	TCA_NETEM_CORRUPT    = 4
+	TCA_NETEM_LOSS       = 5
+	TCA_NETEM_RATE       = 6
+	TCA_NETEM_ECN        = 7
+	TCA_NETEM_RATE64     = 8
+	TCA_NETEM_PAD        = 9
+	TCA_NETEM_LATENCY64  = 10
+	TCA_NETEM_JITTER64   = 11
+	TCA_NETEM_SLOT       = 12
+	TCA_NETEM_SLOT_DIST  = 13
+	TCA_NETEM_PRNG_SEED  = 14
+)
+
+// TcNetemQopt is struct tc_netem_qopt, from uapi/linux/pkt_sched.h.
+//
+// +marshal
+type TcNetemQopt struct {
+	Latency   uint32
+	Limit     uint32
+	Loss      uint32
+	Gap       uint32
+	Duplicate uint32
+	Jitter    uint32
+}
+
+// SizeOfTcNetemQopt is the size of TcNetemQopt.
+const SizeOfTcNetemQopt = 24
+
+// TcNetemCorr is struct tc_netem_corr, from uapi/linux/pkt_sched.h.
+//
+// +marshal
+type TcNetemCorr struct {
+	DelayCorr uint32
+	LossCorr  uint32
+	DupCorr   uint32
+}
+
+// TcNetemReorder is struct tc_netem_reorder, from uapi/linux/pkt_sched.h.
+//
+// +marshal
+type TcNetemReorder struct {
+	Probability uint32
+	Correlation uint32
+}
+
+// SizeOfTcNetemReorder is the size of TcNetemReorder.
+const SizeOfTcNetemReorder = 8
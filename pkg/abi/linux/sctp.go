@@ -0,0 +1,285 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// SOL_SCTP is the socket option level for SCTP, from include/linux/socket.h.
+const SOL_SCTP = 132
+
+// MSG_NOTIFICATION marks a message read from an SCTP socket as a
+// notification, from include/uapi/linux/sctp.h.
+const MSG_NOTIFICATION = 0x8000
+
+// Socket options from include/uapi/linux/sctp.h.
+const (
+	SCTP_RTOINFO                = 0
+	SCTP_ASSOCINFO              = 1
+	SCTP_INITMSG                = 2
+	SCTP_NODELAY                = 3
+	SCTP_AUTOCLOSE              = 4
+	SCTP_SET_PEER_PRIMARY_ADDR  = 5
+	SCTP_PRIMARY_ADDR           = 6
+	SCTP_ADAPTATION_LAYER       = 7
+	SCTP_DISABLE_FRAGMENTS      = 8
+	SCTP_PEER_ADDR_PARAMS       = 9
+	SCTP_DEFAULT_SEND_PARAM     = 10
+	SCTP_EVENTS                 = 11
+	SCTP_I_WANT_MAPPED_V4_ADDR  = 12
+	SCTP_MAXSEG                 = 13
+	SCTP_STATUS                 = 14
+	SCTP_GET_PEER_ADDR_INFO     = 15
+	SCTP_DELAYED_ACK_TIME       = 16
+	SCTP_CONTEXT                = 17
+	SCTP_FRAGMENT_INTERLEAVE    = 18
+	SCTP_PARTIAL_DELIVERY_POINT = 19
+	SCTP_MAX_BURST              = 20
+	SCTP_GET_ASSOC_NUMBER       = 28
+	SCTP_GET_ASSOC_ID_LIST      = 29
+	SCTP_RECVRCVINFO            = 32
+	SCTP_RECVNXTINFO            = 33
+	SCTP_DEFAULT_SNDINFO        = 34
+	SCTP_SOCKOPT_BINDX_ADD      = 100
+	SCTP_SOCKOPT_BINDX_REM      = 101
+	SCTP_SOCKOPT_PEELOFF        = 102
+	SCTP_SOCKOPT_CONNECTX_OLD   = 107
+	SCTP_GET_PEER_ADDRS         = 108
+	SCTP_GET_LOCAL_ADDRS        = 109
+	SCTP_SOCKOPT_CONNECTX       = 110
+	SCTP_SOCKOPT_CONNECTX3      = 111
+	SCTP_SOCKOPT_PEELOFF_FLAGS  = 122
+)
+
+// Association IDs with special meaning, from include/uapi/linux/sctp.h.
+const (
+	SCTP_FUTURE_ASSOC  = 0
+	SCTP_CURRENT_ASSOC = 1
+	SCTP_ALL_ASSOC     = 2
+)
+
+// Control message types from include/uapi/linux/sctp.h.
+const (
+	SCTP_INIT    = 0
+	SCTP_SNDRCV  = 1
+	SCTP_SNDINFO = 2
+	SCTP_RCVINFO = 3
+)
+
+// Flags of struct sctp_sndinfo and struct sctp_sndrcvinfo, from
+// include/uapi/linux/sctp.h.
+const (
+	SCTP_UNORDERED        = 1 << 0
+	SCTP_ADDR_OVER        = 1 << 1
+	SCTP_ABORT            = 1 << 2
+	SCTP_SACK_IMMEDIATELY = 1 << 3
+	SCTP_SENDALL          = 1 << 6
+	SCTP_EOF              = MSG_FIN
+)
+
+// Association states reported by SCTP_STATUS, from enum sctp_sstat_state in
+// include/uapi/linux/sctp.h.
+const (
+	SCTP_EMPTY             = 0
+	SCTP_CLOSED            = 1
+	SCTP_COOKIE_WAIT       = 2
+	SCTP_COOKIE_ECHOED     = 3
+	SCTP_ESTABLISHED       = 4
+	SCTP_SHUTDOWN_PENDING  = 5
+	SCTP_SHUTDOWN_SENT     = 6
+	SCTP_SHUTDOWN_RECEIVED = 7
+	SCTP_SHUTDOWN_ACK_SENT = 8
+)
+
+// Path states reported by SCTP_GET_PEER_ADDR_INFO, from enum
+// sctp_spinfo_state in include/uapi/linux/sctp.h.
+const (
+	SCTP_INACTIVE    = 0
+	SCTP_PF          = 1
+	SCTP_ACTIVE      = 2
+	SCTP_UNCONFIRMED = 3
+)
+
+// SCTPInitMsg is struct sctp_initmsg, from include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPInitMsg struct {
+	NumOStreams    uint16
+	MaxInStreams   uint16
+	MaxAttempts    uint16
+	MaxInitTimeout uint16
+}
+
+// SCTPSndRcvInfo is struct sctp_sndrcvinfo, from include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPSndRcvInfo struct {
+	Stream     uint16
+	SSN        uint16
+	Flags      uint16
+	_          uint16
+	PPID       uint32
+	Context    uint32
+	TimeToLive uint32
+	TSN        uint32
+	CumTSN     uint32
+	AssocID    int32
+}
+
+// SizeOfSCTPSndRcvInfo is the size of struct sctp_sndrcvinfo.
+const SizeOfSCTPSndRcvInfo = 32
+
+// SCTPSndInfo is struct sctp_sndinfo, from include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPSndInfo struct {
+	Stream  uint16
+	Flags   uint16
+	PPID    uint32
+	Context uint32
+	AssocID int32
+}
+
+// SizeOfSCTPSndInfo is the size of struct sctp_sndinfo.
+const SizeOfSCTPSndInfo = 16
+
+// SCTPRcvInfo is struct sctp_rcvinfo, from include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPRcvInfo struct {
+	Stream  uint16
+	SSN     uint16
+	Flags   uint16
+	_       uint16
+	PPID    uint32
+	TSN     uint32
+	CumTSN  uint32
+	Context uint32
+	AssocID int32
+}
+
+// SizeOfSCTPRcvInfo is the size of struct sctp_rcvinfo.
+const SizeOfSCTPRcvInfo = 28
+
+// SCTPRTOInfo is struct sctp_rtoinfo, from include/uapi/linux/sctp.h. The
+// timeouts are in milliseconds.
+//
+// +marshal
+type SCTPRTOInfo struct {
+	AssocID int32
+	Initial uint32
+	Max     uint32
+	Min     uint32
+}
+
+// SCTPAssocParams is struct sctp_assocparams, from
+// include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPAssocParams struct {
+	AssocID                int32
+	AssocMaxRxt            uint16
+	NumberPeerDestinations uint16
+	PeerRwnd               uint32
+	LocalRwnd              uint32
+	CookieLife             uint32
+}
+
+// SCTPEventSubscribe is struct sctp_event_subscribe, from
+// include/uapi/linux/sctp.h. Each byte enables one type of notification.
+//
+// +marshal
+type SCTPEventSubscribe struct {
+	Events [14]uint8
+}
+
+// SCTPSetPrim is struct sctp_setprim, from include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPSetPrim struct {
+	AssocID int32
+	Addr    [SockAddrMax]byte
+}
+
+// SCTPPAddrInfo is struct sctp_paddrinfo, from include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPPAddrInfo struct {
+	AssocID int32
+	Address [SockAddrMax]byte
+	State   int32
+	Cwnd    uint32
+	SRTT    uint32
+	RTO     uint32
+	MTU     uint32
+}
+
+// SCTPStatus is struct sctp_status, from include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPStatus struct {
+	AssocID            int32
+	State              int32
+	Rwnd               uint32
+	UnackData          uint16
+	PendData           uint16
+	InStreams          uint16
+	OutStreams         uint16
+	FragmentationPoint uint32
+	Primary            SCTPPAddrInfo
+}
+
+// SCTPGetAddrs is the header of struct sctp_getaddrs, from
+// include/uapi/linux/sctp.h. It is followed by AddrNum packed socket
+// addresses.
+//
+// +marshal
+type SCTPGetAddrs struct {
+	AssocID int32
+	AddrNum uint32
+}
+
+// SCTPPeeloffArg is sctp_peeloff_arg_t, from include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPPeeloffArg struct {
+	AssocID int32
+	SD      int32
+}
+
+// SCTPPeeloffFlagsArg is sctp_peeloff_flags_arg_t, from
+// include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPPeeloffFlagsArg struct {
+	PArg  SCTPPeeloffArg
+	Flags uint32
+}
+
+// SCTPAssocValue is struct sctp_assoc_value, from include/uapi/linux/sctp.h.
+//
+// +marshal
+type SCTPAssocValue struct {
+	AssocID int32
+	Value   uint32
+}
+
+// SCTPGetAddrsOld is struct sctp_getaddrs_old, from
+// include/uapi/linux/sctp.h, as used by SCTP_SOCKOPT_CONNECTX3. AddrNum is the
+// size in bytes of the packed socket addresses at Addrs.
+//
+// +marshal
+type SCTPGetAddrsOld struct {
+	AssocID int32
+	AddrNum int32
+	Addrs   uint64
+}
@@ -203,6 +203,7 @@ const (
 	SO_PEERGROUPS            = 59
 	SO_ZEROCOPY              = 60
 	SO_TXTIME                = 61
+	SO_DETACH_REUSEPORT_BPF  = 68
 )
 
 // enum socket_state, from uapi/linux/net.h.
@@ -276,6 +277,66 @@ type InetMulticastRequestWithNIC struct {
 	InterfaceIndex int32
 }
 
+// InetMulticastSourceRequest is struct ip_mreq_source, from uapi/linux/in.h.
+//
+// +marshal
+type InetMulticastSourceRequest struct {
+	MulticastAddr InetAddr
+	InterfaceAddr InetAddr
+	SourceAddr    InetAddr
+}
+
+// InetMulticastSourceFilter is the fixed-size header of struct ip_msfilter,
+// from uapi/linux/in.h. It is followed by NumSources source addresses.
+//
+// +marshal
+type InetMulticastSourceFilter struct {
+	MulticastAddr InetAddr
+	InterfaceAddr InetAddr
+	FilterMode    uint32
+	NumSources    uint32
+}
+
+// SockAddrStorage is struct __kernel_sockaddr_storage, from
+// uapi/linux/socket.h.
+//
+// +marshal
+type SockAddrStorage struct {
+	Family uint16
+	Data   [SockAddrMax - 2]byte
+}
+
+// GroupRequest is struct group_req, from uapi/linux/in.h.
+//
+// +marshal
+type GroupRequest struct {
+	Interface uint32
+	_         uint32
+	Group     SockAddrStorage
+}
+
+// GroupSourceRequest is struct group_source_req, from uapi/linux/in.h.
+//
+// +marshal
+type GroupSourceRequest struct {
+	Interface uint32
+	_         uint32
+	Group     SockAddrStorage
+	Source    SockAddrStorage
+}
+
+// GroupFilter is the fixed-size header of struct group_filter, from
+// uapi/linux/in.h. It is followed by NumSources SockAddrStorages.
+//
+// +marshal
+type GroupFilter struct {
+	Interface  uint32
+	_          uint32
+	Group      SockAddrStorage
+	FilterMode uint32
+	NumSources uint32
+}
+
 // Inet6Addr is struct in6_addr, from uapi/linux/in6.h.
 //
 // +marshal
@@ -58,6 +58,7 @@ const (
 	MAX_TCP_KEEPIDLE  = 32767
 	MAX_TCP_KEEPINTVL = 32767
 	MAX_TCP_KEEPCNT   = 127
+	TCP_CA_NAME_MAX   = 16
 )
 
 // Congestion control states from include/uapi/linux/tcp.h.
@@ -68,3 +69,36 @@ const (
 	TCP_CA_Recovery = 3
 	TCP_CA_Loss     = 4
 )
+
+// TCP info options from include/uapi/linux/tcp.h.
+const (
+	TCPI_OPT_TIMESTAMPS = 1
+	TCPI_OPT_SACK       = 2
+	TCPI_OPT_WSCALE     = 4
+	TCPI_OPT_ECN        = 8
+	TCPI_OPT_ECN_SEEN   = 16
+	TCPI_OPT_SYN_DATA   = 32
+)
+
+// TCP_MD5SIG_MAXKEYLEN is the maximum length of a TCP MD5 signature key, from
+// include/uapi/linux/tcp.h.
+const TCP_MD5SIG_MAXKEYLEN = 80
+
+// Flags for struct tcp_md5sig from include/uapi/linux/tcp.h.
+const (
+	TCP_MD5SIG_FLAG_PREFIX  = 0x1
+	TCP_MD5SIG_FLAG_IFINDEX = 0x2
+)
+
+// TCPMD5Sig is struct tcp_md5sig, from include/uapi/linux/tcp.h. It is the
+// argument of the TCP_MD5SIG and TCP_MD5SIG_EXT socket options.
+//
+// +marshal
+type TCPMD5Sig struct {
+	Addr      SockAddrStorage
+	Flags     uint8
+	PrefixLen uint8
+	KeyLen    uint16
+	IfIndex   int32
+	Key       [TCP_MD5SIG_MAXKEYLEN]byte
+}
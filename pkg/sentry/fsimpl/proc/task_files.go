@@ -521,7 +521,7 @@ func (fd *memFD) PRead(ctx context.Context, dst usermem.IOSequence, offset int64
 	defer m.DecUsers(ctx)
 	// Buffer the read data because of MM locks
 	buf := make([]byte, dst.NumBytes())
-	n, readErr := m.CopyIn(ctx, hostarch.Addr(offset), buf, usermem.IOOpts{IgnorePermissions: true})
+	n, readErr := m.CopyIn(ctx, hostarch.Addr(offset), buf, usermem.IOOpts{IgnorePermissions: true, Remote: true})
 	if n > 0 {
 		if _, err := dst.CopyOut(ctx, buf[:n]); err != nil {
 			return 0, linuxerr.EFAULT
@@ -848,7 +848,7 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	egid := creds.EffectiveKGID.In(s.userns).OrOverflow()
 	sgid := creds.SavedKGID.In(s.userns).OrOverflow()
 	var fds int
-	var vss, rss, data uint64
+	var vss, lck, rss, data uint64
 	s.task.WithMuLocked(func(t *kernel.Task) {
 		if fdTable := t.FDTable(); fdTable != nil {
 			fds = fdTable.CurrentMaxFDs()
@@ -856,6 +856,7 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	})
 	if mm := getMM(s.task); mm != nil {
 		vss = mm.VirtualMemorySize()
+		lck = mm.LockedSize()
 		rss = mm.ResidentSetSize()
 		data = mm.VirtualDataSize()
 	}
@@ -875,6 +876,9 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	buf.WriteString(" \n")
 
 	fmt.Fprintf(buf, "VmSize:\t%d kB\n", vss>>10)
+	fmt.Fprintf(buf, "VmLck:\t%d kB\n", lck>>10)
+	// No memory is pinned in the Linux sense (e.g. for RDMA).
+	fmt.Fprintf(buf, "VmPin:\t0 kB\n")
 	fmt.Fprintf(buf, "VmRSS:\t%d kB\n", rss>>10)
 	fmt.Fprintf(buf, "VmData:\t%d kB\n", data>>10)
 
@@ -884,13 +888,35 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "CapEff:\t%016x\n", creds.EffectiveCaps)
 	fmt.Fprintf(buf, "CapBnd:\t%016x\n", creds.BoundingCaps)
 	fmt.Fprintf(buf, "Seccomp:\t%d\n", s.task.SeccompMode())
-	// We unconditionally report a single NUMA node. See
+	// All NUMA nodes are always allowed. See
 	// pkg/sentry/syscalls/linux/sys_mempolicy.go.
-	fmt.Fprintf(buf, "Mems_allowed:\t1\n")
-	fmt.Fprintf(buf, "Mems_allowed_list:\t0\n")
+	nodes := s.task.Kernel().NUMANodes()
+	fmt.Fprintf(buf, "Mems_allowed:\t%s\n", allNodesMask(nodes))
+	if nodes == 1 {
+		fmt.Fprintf(buf, "Mems_allowed_list:\t0\n")
+	} else {
+		fmt.Fprintf(buf, "Mems_allowed_list:\t0-%d\n", nodes-1)
+	}
 	return nil
 }
 
+// allNodesMask returns the mask of the first nodes NUMA nodes formatted as by
+// Linux's "%*pb": comma-separated 32-bit hex words, most significant first,
+// with the first word padded to the number of bits it holds.
+func allNodesMask(nodes uint) string {
+	var b strings.Builder
+	for i := (nodes + 31) / 32; i > 0; i-- {
+		bits := min(nodes-(i-1)*32, 32)
+		word := uint64(1)<<bits - 1
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "%0*x", int(bits+3)/4, word)
+		} else {
+			fmt.Fprintf(&b, ",%08x", word)
+		}
+	}
+	return b.String()
+}
+
 // ioUsage is the /proc/[pid]/io and /proc/[pid]/task/[tid]/io data provider.
 type ioUsage interface {
 	// IOUsage returns the io usage data.
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -34,7 +35,9 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/socket/unix"
 	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
 )
 
 func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kernfs.Inode {
@@ -62,8 +65,9 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 		// TODO(gvisor.dev/issue/1833): Make sure file contents reflect the task
 		// network namespace.
 		contents = map[string]kernfs.Inode{
-			"dev":  fs.newInode(ctx, root, 0444, &netDevData{stack: stack}),
-			"snmp": fs.newInode(ctx, root, 0444, &netSnmpData{stack: stack}),
+			"dev":          fs.newInode(ctx, root, 0444, &netDevData{stack: stack}),
+			"nf_conntrack": fs.newInode(ctx, root, 0440, &netConntrackData{stack: stack}),
+			"snmp":         fs.newInode(ctx, root, 0444, &netSnmpData{stack: stack}),
 
 			// The following files are simple stubs until they are implemented in
 			// netstack, if the file contains a header the stub is just the header
@@ -770,6 +774,107 @@ func (d *netRouteData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// netConntrackData implements vfs.DynamicBytesSource for
+// /proc/net/nf_conntrack.
+//
+// +stateify savable
+type netConntrackData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack
+}
+
+var _ dynamicInode = (*netConntrackData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+// See Linux's net/netfilter/nf_conntrack_standalone.c:ct_seq_show.
+func (d *netConntrackData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	for _, e := range d.stack.ConntrackEntries() {
+		l3, l3num := "ipv4", linux.AF_INET
+		if e.Original.NetProto == header.IPv6ProtocolNumber {
+			l3, l3num = "ipv6", linux.AF_INET6
+		}
+		fmt.Fprintf(buf, "%-8s %d %-8s %d %d ", l3, l3num, conntrackProtoName(e.Original.TransProto), e.Original.TransProto, e.Timeout/time.Second)
+		if e.Original.TransProto == header.TCPProtocolNumber {
+			fmt.Fprintf(buf, "%s ", e.TCPState)
+		}
+		writeConntrackTuple(buf, &e.Original, false /* reply */)
+		fmt.Fprintf(buf, "packets=%d bytes=%d ", e.OriginalCounters.Packets, e.OriginalCounters.Bytes)
+		if !e.SeenReply {
+			buf.WriteString("[UNREPLIED] ")
+		}
+		writeConntrackTuple(buf, &e.Reply, true /* reply */)
+		fmt.Fprintf(buf, "packets=%d bytes=%d ", e.ReplyCounters.Packets, e.ReplyCounters.Bytes)
+		if e.Assured {
+			buf.WriteString("[ASSURED] ")
+		}
+		fmt.Fprintf(buf, "mark=%d use=1\n", e.Mark)
+	}
+	return nil
+}
+
+// conntrackProtoName returns the name Linux gives to a tracked transport
+// protocol.
+func conntrackProtoName(proto tcpip.TransportProtocolNumber) string {
+	switch proto {
+	case header.TCPProtocolNumber:
+		return "tcp"
+	case header.UDPProtocolNumber:
+		return "udp"
+	case header.SCTPProtocolNumber:
+		return "sctp"
+	case header.ICMPv4ProtocolNumber:
+		return "icmp"
+	case header.ICMPv6ProtocolNumber:
+		return "icmpv6"
+	default:
+		return "unknown"
+	}
+}
+
+// writeConntrackTuple writes a tuple of a tracked connection to buf, as
+// Linux's print_tuple does.
+func writeConntrackTuple(buf *bytes.Buffer, t *stack.ConntrackTuple, reply bool) {
+	if t.NetProto == header.IPv6ProtocolNumber {
+		// Linux prints IPv6 addresses uncompressed.
+		src, dst := t.SrcAddr.As16(), t.DstAddr.As16()
+		fmt.Fprintf(buf, "src=%s dst=%s ", fullIPv6(src[:]), fullIPv6(dst[:]))
+	} else {
+		fmt.Fprintf(buf, "src=%s dst=%s ", t.SrcAddr, t.DstAddr)
+	}
+	switch t.TransProto {
+	case header.ICMPv4ProtocolNumber, header.ICMPv6ProtocolNumber:
+		// Only echo connections are tracked. The identifier is the source
+		// port of requests and the destination port of replies.
+		typ, id := uint8(header.ICMPv4Echo), t.SrcPort
+		if t.TransProto == header.ICMPv6ProtocolNumber {
+			typ = uint8(header.ICMPv6EchoRequest)
+		}
+		if reply {
+			typ, id = uint8(header.ICMPv4EchoReply), t.DstPort
+			if t.TransProto == header.ICMPv6ProtocolNumber {
+				typ = uint8(header.ICMPv6EchoReply)
+			}
+		}
+		fmt.Fprintf(buf, "type=%d code=0 id=%d ", typ, id)
+	default:
+		fmt.Fprintf(buf, "sport=%d dport=%d ", t.SrcPort, t.DstPort)
+	}
+}
+
+// fullIPv6 formats an IPv6 address with all its groups, as Linux's %pI6
+// does.
+func fullIPv6(a []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(a); i += 2 {
+		if i != 0 {
+			b.WriteByte(':')
+		}
+		fmt.Fprintf(&b, "%02x%02x", a[i], a[i+1])
+	}
+	return b.String()
+}
+
 // netStatData implements vfs.DynamicBytesSource for /proc/net/netstat.
 //
 // +stateify savable
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"strings"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
@@ -87,12 +88,16 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 	if stack := k.RootNetworkNamespace().Stack(); stack != nil {
 		contents = map[string]kernfs.Inode{
 			"ipv4": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-				"ip_forward":          fs.newInode(ctx, root, 0444, &ipForwarding{stack: stack}),
-				"ip_local_port_range": fs.newInode(ctx, root, 0644, &portRange{stack: stack}),
-				"tcp_recovery":        fs.newInode(ctx, root, 0644, &tcpRecoveryData{stack: stack}),
-				"tcp_rmem":            fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpRMem}),
-				"tcp_sack":            fs.newInode(ctx, root, 0644, &tcpSackData{stack: stack}),
-				"tcp_wmem":            fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpWMem}),
+				"ip_forward":                       fs.newInode(ctx, root, 0444, &ipForwarding{stack: stack}),
+				"ip_local_port_range":              fs.newInode(ctx, root, 0644, &portRange{stack: stack}),
+				"tcp_available_congestion_control": fs.newInode(ctx, root, 0444, &tcpAvailableCongestionControlData{stack: stack}),
+				"tcp_congestion_control":           fs.newInode(ctx, root, 0644, &tcpCongestionControlData{stack: stack}),
+				"tcp_ecn":                          fs.newInode(ctx, root, 0644, &tcpECNData{stack: stack}),
+				"tcp_fastopen":                     fs.newInode(ctx, root, 0644, &tcpFastOpenData{stack: stack}),
+				"tcp_recovery":                     fs.newInode(ctx, root, 0644, &tcpRecoveryData{stack: stack}),
+				"tcp_rmem":                         fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpRMem}),
+				"tcp_sack":                         fs.newInode(ctx, root, 0644, &tcpSackData{stack: stack}),
+				"tcp_wmem":                         fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpWMem}),
 
 				// The following files are simple stubs until they are implemented in
 				// netstack, most of these files are configuration related. We use the
@@ -105,9 +110,7 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 
 				// tcp_allowed_congestion_control tell the user what they are able to
 				// do as an unprivledged process so we leave it empty.
-				"tcp_allowed_congestion_control":   fs.newInode(ctx, root, 0444, newStaticFile("")),
-				"tcp_available_congestion_control": fs.newInode(ctx, root, 0444, newStaticFile("reno")),
-				"tcp_congestion_control":           fs.newInode(ctx, root, 0444, newStaticFile("reno")),
+				"tcp_allowed_congestion_control": fs.newInode(ctx, root, 0444, newStaticFile("")),
 
 				// Many of the following stub files are features netstack doesn't
 				// support. The unsupported features return "0" to indicate they are
@@ -116,7 +119,6 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 				"tcp_dsack":                 fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_early_retrans":         fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_fack":                  fs.newInode(ctx, root, 0444, newStaticFile("0")),
-				"tcp_fastopen":              fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_fastopen_key":          fs.newInode(ctx, root, 0444, newStaticFile("")),
 				"tcp_invalid_ratelimit":     fs.newInode(ctx, root, 0444, newStaticFile("0")),
 				"tcp_keepalive_intvl":       fs.newInode(ctx, root, 0444, newStaticFile("0")),
@@ -279,6 +281,151 @@ func (d *tcpRecoveryData) Write(ctx context.Context, _ *vfs.FileDescription, src
 	return n, nil
 }
 
+// tcpECNData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_ecn.
+//
+// +stateify savable
+type tcpECNData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*tcpECNData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *tcpECNData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	ecn, err := d.stack.TCPECN()
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteString(fmt.Sprintf("%d\n", ecn))
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *tcpECNData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]int32, 1)
+	n, err := ParseInt32Vec(ctx, src, buf)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if err := d.stack.SetTCPECN(buf[0]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// tcpFastOpenData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_fastopen.
+//
+// +stateify savable
+type tcpFastOpenData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*tcpFastOpenData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *tcpFastOpenData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fastOpen, err := d.stack.TCPFastOpen()
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteString(fmt.Sprintf("%d\n", fastOpen))
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *tcpFastOpenData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	buf := make([]int32, 1)
+	n, err := ParseInt32Vec(ctx, src, buf)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if err := d.stack.SetTCPFastOpen(buf[0]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// tcpAvailableCongestionControlData implements vfs.DynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_available_congestion_control.
+//
+// +stateify savable
+type tcpAvailableCongestionControlData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ dynamicInode = (*tcpAvailableCongestionControlData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *tcpAvailableCongestionControlData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	avail, err := d.stack.TCPAvailableCongestionControl()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(buf, "%s\n", avail)
+	return nil
+}
+
+// tcpCongestionControlData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/net/ipv4/tcp_congestion_control.
+//
+// +stateify savable
+type tcpCongestionControlData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack `state:"wait"`
+}
+
+var _ vfs.WritableDynamicBytesSource = (*tcpCongestionControlData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *tcpCongestionControlData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	cc, err := d.stack.TCPCongestionControl()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(buf, "%s\n", cc)
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *tcpCongestionControlData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	// Congestion control names are limited to TCP_CA_NAME_MAX bytes.
+	srclen := src.NumBytes()
+	if srclen > linux.TCP_CA_NAME_MAX {
+		return 0, linuxerr.EINVAL
+	}
+	name := make([]byte, srclen)
+	if _, err := src.CopyIn(ctx, name); err != nil {
+		return 0, err
+	}
+	if err := d.stack.SetTCPCongestionControl(strings.TrimSpace(string(name))); err != nil {
+		return 0, err
+	}
+	return srclen, nil
+}
+
 // tcpMemData implements vfs.WritableDynamicBytesSource for
 // /proc/sys/net/ipv4/tcp_rmem and /proc/sys/net/ipv4/tcp_wmem.
 //
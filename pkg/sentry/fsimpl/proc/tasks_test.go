@@ -509,3 +509,23 @@ func TestTree(t *testing.T) {
 	iterateDir(ctx, t, s, fd)
 	fd.DecRef(ctx)
 }
+
+func TestAllNodesMask(t *testing.T) {
+	for _, tc := range []struct {
+		nodes uint
+		want  string
+	}{
+		{nodes: 1, want: "1"},
+		{nodes: 4, want: "f"},
+		{nodes: 6, want: "3f"},
+		{nodes: 32, want: "ffffffff"},
+		{nodes: 33, want: "1,ffffffff"},
+		{nodes: 40, want: "ff,ffffffff"},
+		{nodes: 64, want: "ffffffff,ffffffff"},
+		{nodes: 65, want: "1,ffffffff,ffffffff"},
+	} {
+		if got := allNodesMask(tc.nodes); got != tc.want {
+			t.Errorf("allNodesMask(%d) = %q, want %q", tc.nodes, got, tc.want)
+		}
+	}
+}
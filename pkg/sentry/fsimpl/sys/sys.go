@@ -122,7 +122,8 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	}
 	devicesSub := map[string]kernfs.Inode{
 		"system": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
-			"cpu": cpuDir(ctx, fs, creds),
+			"cpu":  cpuDir(ctx, fs, creds),
+			"node": nodeDir(ctx, fs, creds),
 		}),
 	}
 
@@ -229,6 +230,65 @@ func cpuDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) kernfs
 	return fs.newDir(ctx, creds, defaultSysDirMode, children)
 }
 
+func nodeDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) kernfs.Inode {
+	k := kernel.KernelFromContext(ctx)
+	nodes := k.NUMANodes()
+	maxCPUCores := k.ApplicationCores()
+	allNodes := cpuList(0, nodes) + "\n"
+	children := map[string]kernfs.Inode{
+		"online":            fs.newStaticFile(ctx, creds, defaultSysMode, allNodes),
+		"possible":          fs.newStaticFile(ctx, creds, defaultSysMode, allNodes),
+		"has_memory":        fs.newStaticFile(ctx, creds, defaultSysMode, allNodes),
+		"has_normal_memory": fs.newStaticFile(ctx, creds, defaultSysMode, allNodes),
+	}
+	var (
+		hasCPU    strings.Builder
+		hasCPUSep string
+	)
+	for i := uint(0); i < nodes; i++ {
+		start, end := k.NUMANodeCPUs(i)
+		if start < end {
+			fmt.Fprintf(&hasCPU, "%s%d", hasCPUSep, i)
+			hasCPUSep = ","
+		}
+		// Like Linux's default SLIT, use distance 10 for local accesses and 20
+		// for remote accesses.
+		var (
+			distance    strings.Builder
+			distanceSep string
+		)
+		for j := uint(0); j < nodes; j++ {
+			d := 20
+			if i == j {
+				d = 10
+			}
+			fmt.Fprintf(&distance, "%s%d", distanceSep, d)
+			distanceSep = " "
+		}
+		children[fmt.Sprintf("node%d", i)] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"cpulist":  fs.newStaticFile(ctx, creds, defaultSysMode, cpuList(start, end)+"\n"),
+			"cpumap":   fs.newStaticFile(ctx, creds, defaultSysMode, rangeCPUMask(start, end, maxCPUCores)+"\n"),
+			"distance": fs.newStaticFile(ctx, creds, defaultSysMode, distance.String()+"\n"),
+		})
+	}
+	children["has_cpu"] = fs.newStaticFile(ctx, creds, defaultSysMode, hasCPU.String()+"\n")
+	return fs.newDir(ctx, creds, defaultSysDirMode, children)
+}
+
+// cpuList returns a "list format ASCII string", consistent with Linux's
+// lib/bitmap.c:bitmap_print_to_pagebuf(list=true), representing the
+// contiguous range of CPUs or nodes [start, end).
+func cpuList(start, end uint) string {
+	switch {
+	case start >= end:
+		return ""
+	case start+1 == end:
+		return fmt.Sprintf("%d", start)
+	default:
+		return fmt.Sprintf("%d-%d", start, end-1)
+	}
+}
+
 // fullCPUMask returns a "hex format ASCII string", consistent with Linux's
 // include/linux/cpumask.h:cpumap_print_to_pagebuf(list=false) =>
 // lib/bitmap.c:bitmap_print_to_pagebuf(list=false), representing a CPU bitmask
@@ -282,6 +342,39 @@ func oneCPUMask(i, cores uint) string {
 	return b.String()
 }
 
+// rangeCPUMask returns a "hex format ASCII string", consistent with Linux's
+// include/linux/cpumask.h:cpumap_print_to_pagebuf(list=false) =>
+// lib/bitmap.c:bitmap_print_to_pagebuf(list=false), representing a CPU bitmask
+// for `cores` CPUs in which CPUs [start, end) are set.
+//
+// Preconditions: start <= end <= cores.
+func rangeCPUMask(start, end, cores uint) string {
+	var (
+		b   strings.Builder
+		sep string
+	)
+	word := func() (w uint32) {
+		for i := uint(0); i < 32; i++ {
+			if cpu := cores + i; cpu >= start && cpu < end {
+				w |= uint32(1) << i
+			}
+		}
+		return
+	}
+	if rem := cores % 32; rem != 0 {
+		cores -= rem
+		chars := (rem + 3) / 4 // 4 bits per hex character
+		fmt.Fprintf(&b, "%0*x", chars, word())
+		sep = ","
+	}
+	for cores != 0 {
+		cores -= 32
+		fmt.Fprintf(&b, "%s%08x", sep, word())
+		sep = ","
+	}
+	return b.String()
+}
+
 // Returns a map from a PCI device name to its IOMMU group if available.
 func pciDeviceIOMMUGroups(iommuGroupsPath string) (map[string]string, error) {
 	// IOMMU groups are organized as iommu_group_path/$GROUP, where $GROUP is
@@ -74,3 +74,47 @@ func TestOneCPUMask(t *testing.T) {
 		}
 	}
 }
+
+func TestRangeCPUMask(t *testing.T) {
+	for _, test := range []struct {
+		start uint
+		end   uint
+		cores uint
+		want  string
+	}{
+		{0, 1, 1, "1"},
+		{0, 4, 4, "f"},
+		{0, 2, 4, "3"},
+		{2, 4, 4, "c"},
+		{2, 2, 4, "0"},
+		{0, 3, 5, "07"},
+		{3, 5, 5, "18"},
+		{16, 32, 32, "ffff0000"},
+		{0, 33, 33, "1,ffffffff"},
+		{16, 48, 64, "0000ffff,ffff0000"},
+		{32, 64, 64, "ffffffff,00000000"},
+		{32, 65, 65, "1,ffffffff,00000000"},
+	} {
+		if got := rangeCPUMask(test.start, test.end, test.cores); got != test.want {
+			t.Errorf("rangeCPUMask(%d, %d, %d): got %s, want %s", test.start, test.end, test.cores, got, test.want)
+		}
+	}
+}
+
+func TestCPUList(t *testing.T) {
+	for _, test := range []struct {
+		start uint
+		end   uint
+		want  string
+	}{
+		{0, 0, ""},
+		{0, 1, "0"},
+		{3, 4, "3"},
+		{0, 4, "0-3"},
+		{4, 8, "4-7"},
+	} {
+		if got := cpuList(test.start, test.end); got != test.want {
+			t.Errorf("cpuList(%d, %d): got %q, want %q", test.start, test.end, got, test.want)
+		}
+	}
+}
@@ -80,6 +80,17 @@ type regularFile struct {
 	// Protected by dataMu.
 	seals uint32
 
+	// hugetlb is true if this is a MFD_HUGETLB memfd, whose contents are
+	// allocated in huge pages.
+	//
+	// hugetlb is immutable.
+	hugetlb bool
+
+	// secret is true if this is a memfd_secret(2) file.
+	//
+	// secret is immutable.
+	secret bool
+
 	// size is the size of data.
 	//
 	// Protected by both dataMu and inode.mu; reading it requires holding
@@ -144,21 +155,69 @@ func NewZeroFile(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount,
 	return &fd.vfsfd, err
 }
 
+// MemfdOpts contains options to NewMemfd.
+type MemfdOpts struct {
+	// If AllowSeals is true, seals may be added to the memfd using
+	// fcntl(F_ADD_SEALS).
+	AllowSeals bool
+
+	// If NoExec is true, the memfd is created without execute permissions and
+	// with F_SEAL_EXEC set, as for MFD_NOEXEC_SEAL. NoExec implies AllowSeals.
+	NoExec bool
+
+	// If Hugetlb is true, the memfd's contents are allocated in huge pages,
+	// as for MFD_HUGETLB.
+	Hugetlb bool
+}
+
 // NewMemfd creates a new regular file and file description as for
 // memfd_create.
 //
 // Preconditions: mount must be a tmpfs mount.
-func NewMemfd(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount, allowSeals bool, name string) (*vfs.FileDescription, error) {
+func NewMemfd(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount, name string, opts MemfdOpts) (*vfs.FileDescription, error) {
 	fd, err := newUnlinkedRegularFileDescription(ctx, creds, mount, name)
 	if err != nil {
 		return nil, err
 	}
-	if allowSeals {
-		fd.inode().impl.(*regularFile).seals = 0
+	rf := fd.inode().impl.(*regularFile)
+	if opts.AllowSeals || opts.NoExec {
+		rf.seals = 0
+	}
+	if opts.NoExec {
+		// Compare Linux's mm/memfd.c:memfd_create().
+		rf.inode.mode.Store(linux.S_IFREG | 0666)
+		rf.seals |= linux.F_SEAL_EXEC
+	}
+	rf.hugetlb = opts.Hugetlb
+	return &fd.vfsfd, nil
+}
+
+// NewSecretMem creates a new regular file and file description as for
+// memfd_secret. The file's contents can only be accessed through MAP_SHARED
+// mappings, and are inaccessible to other processes.
+//
+// Preconditions: mount must be a tmpfs mount.
+func NewSecretMem(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount) (*vfs.FileDescription, error) {
+	// Compare Linux's mm/secretmem.c:secretmem_file_create().
+	fd, err := newUnlinkedRegularFileDescription(ctx, creds, mount, "[secretmem]")
+	if err != nil {
+		return nil, err
 	}
+	rf := fd.inode().impl.(*regularFile)
+	rf.memoryUsageKind = usage.Anonymous
+	rf.secret = true
+	rf.inode.fs.secretFiles.Add(1)
 	return &fd.vfsfd, nil
 }
 
+// HasSecretMem returns true if the tmpfs filesystem mounted at mount contains
+// any files created by NewSecretMem that have not yet been released.
+//
+// Preconditions: mount must be a tmpfs mount.
+func HasSecretMem(mount *vfs.Mount) bool {
+	return mount.Filesystem().Impl().(*filesystem).secretFiles.Load() != 0
+}
+
 // truncate grows or shrinks the file to the given size. It returns true if the
 // file size was updated.
 func (rf *regularFile) truncate(newSize uint64) (bool, error) {
@@ -187,6 +246,15 @@ func (rf *regularFile) truncateLocked(newSize uint64) (bool, error) {
 		// Nothing to do.
 		return false, nil
 	}
+	if rf.hugetlb && !hostarch.IsHugePageAligned(newSize) {
+		// Compare Linux's fs/hugetlbfs/inode.c:hugetlbfs_setattr().
+		return false, linuxerr.EINVAL
+	}
+	if rf.secret && oldSize != 0 {
+		// The size of a memfd_secret file can only be set once; compare
+		// Linux's mm/secretmem.c:secretmem_setattr().
+		return false, linuxerr.EINVAL
+	}
 
 	// Need to hold inode.mu and dataMu while modifying size.
 	rf.dataMu.Lock()
@@ -288,6 +356,11 @@ func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.
 	// Constrain translations to f.attr.Size (rounded up) to prevent
 	// translation to pages that may be concurrently truncated.
 	pgend := offsetPageEnd(int64(rf.size.RacyLoad()))
+	if rf.hugetlb {
+		// The size of a hugetlb file is not necessarily huge page-aligned
+		// after fallocate(2), but its last huge page is still mappable.
+		pgend, _ = hostarch.HugePageRoundUp(rf.size.RacyLoad())
+	}
 	var beyondEOF bool
 	if required.End > pgend {
 		if required.Start >= pgend {
@@ -299,20 +372,30 @@ func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.
 	if optional.End > pgend {
 		optional.End = pgend
 	}
-	pagesToFill := rf.data.PagesToFill(required, optional)
+	// Allocations for hugetlb files must consist of whole huge pages, so
+	// expand the allocated ranges accordingly; the returned translations are
+	// still limited to optional.
+	fillRequired, fillOptional := required, optional
+	if rf.hugetlb {
+		fillRequired = hugePageRange(required, rf.size.RacyLoad())
+		fillOptional = hugePageRange(optional, rf.size.RacyLoad())
+	}
+	pagesToFill := rf.data.PagesToFill(fillRequired, fillOptional)
 	if !rf.inode.fs.accountPages(pagesToFill) {
 		// If we can not accommodate pagesToFill pages, then retry with just
 		// the required range. Because optional may be larger than required.
 		// Only error out if even the required range can not be allocated for.
-		pagesToFill = rf.data.PagesToFill(required, required)
+		pagesToFill = rf.data.PagesToFill(fillRequired, fillRequired)
 		if !rf.inode.fs.accountPages(pagesToFill) {
 			return nil, &memmap.BusError{linuxerr.ENOSPC}
 		}
 		optional = required
+		fillOptional = fillRequired
 	}
-	pagesAlloced, cerr := rf.data.Fill(ctx, required, optional, rf.size.RacyLoad(), rf.inode.fs.mf, pgalloc.AllocOpts{
+	pagesAlloced, cerr := rf.data.Fill(ctx, fillRequired, fillOptional, rf.size.RacyLoad(), rf.inode.fs.mf, pgalloc.AllocOpts{
 		Kind:    rf.memoryUsageKind,
 		MemCgID: memCgID,
+		Huge:    rf.hugetlb,
 	}, nil)
 	// rf.data.Fill() may fail mid-way. We still want to account any pages that
 	// were allocated, irrespective of an error.
@@ -342,6 +425,21 @@ func (rf *regularFile) Translate(ctx context.Context, required, optional memmap.
 	return ts, nil
 }
 
+// hugePageRange returns mr expanded to huge page boundaries, but not beyond
+// the end of the huge page containing the last byte of a file of the given
+// size.
+func hugePageRange(mr memmap.MappableRange, size uint64) memmap.MappableRange {
+	end, _ := hostarch.HugePageRoundUp(size)
+	hmr := memmap.MappableRange{
+		Start: hostarch.HugePageRoundDown(mr.Start),
+		End:   end,
+	}
+	if mrEnd, ok := hostarch.HugePageRoundUp(mr.End); ok && mrEnd < hmr.End {
+		hmr.End = mrEnd
+	}
+	return hmr
+}
+
 // InvalidateUnsavable implements memmap.Mappable.InvalidateUnsavable.
 func (*regularFile) InvalidateUnsavable(context.Context) error {
 	return nil
@@ -368,13 +466,25 @@ func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint
 	memCgID := pgalloc.MemoryCgroupIDFromContext(ctx)
 
 	// To be consistent with Linux, inode.mu must be locked throughout.
+	if f.secret {
+		return linuxerr.EOPNOTSUPP
+	}
+
 	f.inode.mu.Lock()
 	defer f.inode.mu.Unlock()
 	end := offset + length
+	pgStart := hostarch.PageRoundDown(offset)
 	pgEnd, ok := hostarch.PageRoundUp(end)
 	if !ok {
 		return linuxerr.EFBIG
 	}
+	if f.hugetlb {
+		// Compare Linux's fs/hugetlbfs/inode.c:hugetlbfs_fallocate().
+		pgStart = hostarch.HugePageRoundDown(offset)
+		if pgEnd, ok = hostarch.HugePageRoundUp(end); !ok {
+			return linuxerr.EFBIG
+		}
+	}
 	// Allocate in chunks for the following reasons:
 	// 1. Size limit may permit really large fallocate, which can take a long
 	//    time to execute on the host. This can cause watchdog to timeout and
@@ -382,7 +492,7 @@ func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint
 	// 2. Linux allocates folios iteratively while checking for interrupts. In
 	//    gVisor, we need to manually check for interrupts between chunks.
 	const chunkSize = 4 << 30 // 4 GiB
-	for curPgStart := hostarch.PageRoundDown(offset); curPgStart < pgEnd; {
+	for curPgStart := pgStart; curPgStart < pgEnd; {
 		curPgEnd := pgEnd
 		newSize := end
 		if curPgEnd-curPgStart > chunkSize {
@@ -438,6 +548,7 @@ func (rf *regularFile) allocateLocked(ctx context.Context, mode, newSize uint64,
 		Kind:    rf.memoryUsageKind,
 		MemCgID: memCgID,
 		Mode:    allocMode,
+		Huge:    rf.hugetlb,
 	}, nil /* r */)
 	// f.data.Fill() may fail mid-way. We still want to account any pages that
 	// were allocated, irrespective of an error.
@@ -471,10 +582,15 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		return 0, linuxerr.EOPNOTSUPP
 	}
 
+	f := fd.inode().impl.(*regularFile)
+	if f.secret {
+		// memfd_secret files can't be read; compare Linux's
+		// mm/secretmem.c:secretmem_fops.
+		return 0, linuxerr.EINVAL
+	}
 	if dst.NumBytes() == 0 {
 		return 0, nil
 	}
-	f := fd.inode().impl.(*regularFile)
 	// memCgID can be 0 here because regularFileReadWriter.ReadToBlocks() never
 	// allocates from pgalloc.
 	rw := getRegularFileReadWriter(f, offset, 0)
@@ -514,11 +630,17 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 		return 0, offset, linuxerr.EOPNOTSUPP
 	}
 
+	f := fd.inode().impl.(*regularFile)
+	if f.hugetlb || f.secret {
+		// Neither hugetlbfs nor secretmem files support write(2); compare
+		// Linux's fs/hugetlbfs/inode.c:hugetlbfs_file_operations and
+		// mm/secretmem.c:secretmem_fops.
+		return 0, offset, linuxerr.EINVAL
+	}
 	srclen := src.NumBytes()
 	if srclen == 0 {
 		return 0, offset, nil
 	}
-	f := fd.inode().impl.(*regularFile)
 	f.inode.mu.Lock()
 	defer f.inode.mu.Unlock()
 	// If the file is opened with O_APPEND, update offset to file size.
@@ -587,6 +709,20 @@ func (fd *regularFileFD) Seek(ctx context.Context, offset int64, whence int32) (
 // ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
 func (fd *regularFileFD) ConfigureMMap(ctx context.Context, opts *memmap.MMapOpts) error {
 	file := fd.inode().impl.(*regularFile)
+	if file.hugetlb && !hostarch.IsHugePageAligned(opts.Offset) {
+		// Compare Linux's fs/hugetlbfs/inode.c:hugetlbfs_file_mmap().
+		return linuxerr.EINVAL
+	}
+	if file.secret {
+		// Compare Linux's mm/secretmem.c:secretmem_mmap().
+		if opts.Private {
+			return linuxerr.EINVAL
+		}
+		opts.Secret = true
+		if opts.MLockMode == memmap.MLockNone {
+			opts.MLockMode = memmap.MLockEager
+		}
+	}
 	opts.SentryOwnedContent = true
 	return vfs.GenericConfigureMMap(&fd.vfsfd, file, opts)
 }
@@ -868,6 +1004,13 @@ func AddSeals(fd *vfs.FileDescription, val uint32) error {
 		return linuxerr.EPERM
 	}
 
+	// F_SEAL_EXEC on an executable file implies write seals, such that the
+	// file is W^X from that point on. Compare Linux's
+	// mm/memfd.c:memfd_add_seals().
+	if val&linux.F_SEAL_EXEC != 0 && rf.inode.mode.Load()&0111 != 0 {
+		val |= linux.F_SEAL_SHRINK | linux.F_SEAL_GROW | linux.F_SEAL_WRITE
+	}
+
 	// F_SEAL_WRITE can only be added if there are no active writable maps.
 	if rf.seals&linux.F_SEAL_WRITE == 0 && val&linux.F_SEAL_WRITE != 0 {
 		if rf.writableMappingPages > 0 {
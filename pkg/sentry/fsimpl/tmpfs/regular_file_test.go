@@ -22,8 +22,10 @@ import (
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
 	"gvisor.dev/gvisor/pkg/sentry/fsimpl/lock"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/usermem"
 )
@@ -347,3 +349,159 @@ func TestTruncate(t *testing.T) {
 		t.Errorf("fd.Stat got Ctime %v, want %v", got, statAfterTruncateUp.Ctime)
 	}
 }
+
+func TestMemfdNoExecSeal(t *testing.T) {
+	ctx := contexttest.Context(t)
+	creds := auth.CredentialsFromContext(ctx)
+	_, root, cleanup, err := newTmpfsRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	fd, err := NewMemfd(ctx, creds, root.Mount(), "memfd:test", MemfdOpts{NoExec: true})
+	if err != nil {
+		t.Fatalf("NewMemfd failed: %v", err)
+	}
+	defer fd.DecRef(ctx)
+
+	stat, err := fd.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_MODE})
+	if err != nil {
+		t.Fatalf("fd.Stat failed: %v", err)
+	}
+	if got, want := stat.Mode&^linux.S_IFMT, uint16(0666); got != want {
+		t.Errorf("fd.Stat got mode %#o, want %#o", got, want)
+	}
+	seals, err := GetSeals(fd)
+	if err != nil {
+		t.Fatalf("GetSeals failed: %v", err)
+	}
+	if want := uint32(linux.F_SEAL_EXEC); seals != want {
+		t.Errorf("GetSeals got %#x, want %#x", seals, want)
+	}
+	// MFD_NOEXEC_SEAL implies MFD_ALLOW_SEALING.
+	if err := AddSeals(fd, linux.F_SEAL_GROW); err != nil {
+		t.Errorf("AddSeals(F_SEAL_GROW) failed: %v", err)
+	}
+
+	// Changing execute permissions is prohibited by F_SEAL_EXEC, but other
+	// mode changes are permitted.
+	if err := fd.SetStat(ctx, vfs.SetStatOptions{
+		Stat: linux.Statx{Mask: linux.STATX_MODE, Mode: 0755},
+	}); !linuxerr.Equals(linuxerr.EPERM, err) {
+		t.Errorf("fd.SetStat(0755) got err %v, want EPERM", err)
+	}
+	if err := fd.SetStat(ctx, vfs.SetStatOptions{
+		Stat: linux.Statx{Mask: linux.STATX_MODE, Mode: 0600},
+	}); err != nil {
+		t.Errorf("fd.SetStat(0600) failed: %v", err)
+	}
+}
+
+func TestMemfdSealExecImpliesWriteSeals(t *testing.T) {
+	ctx := contexttest.Context(t)
+	creds := auth.CredentialsFromContext(ctx)
+	_, root, cleanup, err := newTmpfsRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	fd, err := NewMemfd(ctx, creds, root.Mount(), "memfd:test", MemfdOpts{AllowSeals: true})
+	if err != nil {
+		t.Fatalf("NewMemfd failed: %v", err)
+	}
+	defer fd.DecRef(ctx)
+
+	if err := AddSeals(fd, linux.F_SEAL_EXEC); err != nil {
+		t.Fatalf("AddSeals failed: %v", err)
+	}
+	seals, err := GetSeals(fd)
+	if err != nil {
+		t.Fatalf("GetSeals failed: %v", err)
+	}
+	if want := uint32(linux.F_SEAL_EXEC | linux.F_SEAL_SHRINK | linux.F_SEAL_GROW | linux.F_SEAL_WRITE); seals != want {
+		t.Errorf("GetSeals got %#x, want %#x", seals, want)
+	}
+}
+
+func TestMemfdHugetlb(t *testing.T) {
+	ctx := contexttest.Context(t)
+	creds := auth.CredentialsFromContext(ctx)
+	_, root, cleanup, err := newTmpfsRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	fd, err := NewMemfd(ctx, creds, root.Mount(), "memfd:test", MemfdOpts{Hugetlb: true})
+	if err != nil {
+		t.Fatalf("NewMemfd failed: %v", err)
+	}
+	defer fd.DecRef(ctx)
+
+	if _, err := fd.Write(ctx, usermem.BytesIOSequence([]byte("foo")), vfs.WriteOptions{}); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("fd.Write got err %v, want EINVAL", err)
+	}
+	// Hugetlb files can only be truncated to a multiple of the huge page
+	// size.
+	for _, tc := range []struct {
+		size       uint64
+		wantEINVAL bool
+	}{
+		{size: hostarch.PageSize, wantEINVAL: true},
+		{size: hostarch.HugePageSize},
+		{size: 2 * hostarch.HugePageSize},
+	} {
+		err := fd.SetStat(ctx, vfs.SetStatOptions{
+			Stat: linux.Statx{Mask: linux.STATX_SIZE, Size: tc.size},
+		})
+		if got := linuxerr.Equals(linuxerr.EINVAL, err); got != tc.wantEINVAL || (!tc.wantEINVAL && err != nil) {
+			t.Errorf("fd.SetStat(size=%#x) got err %v, want EINVAL: %t", tc.size, err, tc.wantEINVAL)
+		}
+	}
+}
+
+func TestSecretMem(t *testing.T) {
+	ctx := contexttest.Context(t)
+	creds := auth.CredentialsFromContext(ctx)
+	_, root, cleanup, err := newTmpfsRoot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	fd, err := NewSecretMem(ctx, creds, root.Mount())
+	if err != nil {
+		t.Fatalf("NewSecretMem failed: %v", err)
+	}
+	if !HasSecretMem(root.Mount()) {
+		t.Errorf("HasSecretMem got false after NewSecretMem, want true")
+	}
+
+	buf := make([]byte, 8)
+	if _, err := fd.Write(ctx, usermem.BytesIOSequence(buf), vfs.WriteOptions{}); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("fd.Write got err %v, want EINVAL", err)
+	}
+	if _, err := fd.Read(ctx, usermem.BytesIOSequence(buf), vfs.ReadOptions{}); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("fd.Read got err %v, want EINVAL", err)
+	}
+
+	// The size of a secret memory file can only be set once.
+	truncate := func(size uint64) error {
+		return fd.SetStat(ctx, vfs.SetStatOptions{
+			Stat: linux.Statx{Mask: linux.STATX_SIZE, Size: size},
+		})
+	}
+	if err := truncate(hostarch.PageSize); err != nil {
+		t.Errorf("first truncate failed: %v", err)
+	}
+	if err := truncate(2 * hostarch.PageSize); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("second truncate got err %v, want EINVAL", err)
+	}
+
+	fd.DecRef(ctx)
+	if HasSecretMem(root.Mount()) {
+		t.Errorf("HasSecretMem got true after releasing secret memory, want false")
+	}
+}
@@ -96,6 +96,9 @@ type filesystem struct {
 	// pagesUsed is the number of pages used by this filesystem.
 	pagesUsed atomicbitops.Uint64
 
+	// secretFiles is the number of memfd_secret files in this filesystem.
+	secretFiles atomicbitops.Int64
+
 	// allowXattrPrefix is a set of xattr namespace prefixes that this
 	// tmpfs mount will allow. It is immutable.
 	allowXattrPrefix map[string]struct{}
@@ -579,6 +582,9 @@ func (i *inode) decRef(ctx context.Context) {
 			// metadata.
 			pagesDec := impl.data.DropAll(i.fs.mf)
 			impl.inode.fs.unaccountPages(pagesDec)
+			if impl.secret {
+				i.fs.secretFiles.Add(-1)
+			}
 		}
 
 	})
@@ -655,6 +661,16 @@ func (i *inode) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs.
 	)
 	clearSID := false
 	mask := stat.Mask
+	if rf, ok := i.impl.(*regularFile); ok && mask&linux.STATX_MODE != 0 && (uint16(mode)^stat.Mode)&0111 != 0 {
+		// F_SEAL_EXEC prevents changes to execute permissions; compare Linux's
+		// mm/shmem.c:shmem_setattr().
+		rf.dataMu.RLock()
+		seals := rf.seals
+		rf.dataMu.RUnlock()
+		if seals&linux.F_SEAL_EXEC != 0 {
+			return linuxerr.EPERM
+		}
+	}
 	if mask&linux.STATX_SIZE != 0 {
 		switch impl := i.impl.(type) {
 		case *regularFile:
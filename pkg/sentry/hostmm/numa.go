@@ -0,0 +1,70 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostmm
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OnlineNUMANodes returns the host NUMA nodes that are online, in increasing
+// order.
+func OnlineNUMANodes() ([]int, error) {
+	const pathname = "/sys/devices/system/node/online"
+	data, err := os.ReadFile(pathname)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := ParseNodeList(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", pathname, err)
+	}
+	return nodes, nil
+}
+
+// ParseNodeList parses a list of NUMA nodes in the format used by Linux's
+// lib/bitmap.c:bitmap_parselist() (e.g. "0-2,4"), as used in
+// /sys/devices/system/node/online and cpuset.mems. The returned nodes are in
+// the order in which they appear in s.
+func ParseNodeList(s string) ([]int, error) {
+	var nodes []int
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	for _, r := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(r), "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node %q: %w", first, err)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node %q: %w", last, err)
+			}
+		}
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("invalid node range %q", r)
+		}
+		for n := start; n <= end; n++ {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
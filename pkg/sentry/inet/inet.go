@@ -79,6 +79,33 @@ type Stack interface {
 	// SetTCPRecovery attempts to change TCP loss detection algorithm.
 	SetTCPRecovery(recovery TCPLossRecovery) error
 
+	// TCPECN returns the TCP Explicit Congestion Notification setting, as
+	// in /proc/sys/net/ipv4/tcp_ecn.
+	TCPECN() (int32, error)
+
+	// SetTCPECN attempts to change the TCP Explicit Congestion Notification
+	// setting.
+	SetTCPECN(mode int32) error
+
+	// TCPFastOpen returns the TCP Fast Open setting, as in
+	// /proc/sys/net/ipv4/tcp_fastopen.
+	TCPFastOpen() (int32, error)
+
+	// SetTCPFastOpen attempts to change the TCP Fast Open setting.
+	SetTCPFastOpen(mode int32) error
+
+	// TCPAvailableCongestionControl returns the space separated names of the
+	// available TCP congestion control algorithms.
+	TCPAvailableCongestionControl() (string, error)
+
+	// TCPCongestionControl returns the name of the default TCP congestion
+	// control algorithm.
+	TCPCongestionControl() (string, error)
+
+	// SetTCPCongestionControl attempts to change the default TCP congestion
+	// control algorithm.
+	SetTCPCongestionControl(name string) error
+
 	// Statistics reports stack statistics.
 	Statistics(stat any, arg string) error
 
@@ -91,6 +118,39 @@ type Stack interface {
 	// NewRoute adds the given route to the network stack's route table.
 	NewRoute(ctx context.Context, msg *nlmsg.Message) *syserr.Error
 
+	// RuleTable returns the network stack's policy routing rules.
+	RuleTable() []Rule
+
+	// RemoveRule deletes the specified policy routing rule.
+	RemoveRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// NewRule adds the given policy routing rule to the network stack.
+	NewRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// FDB returns the forwarding database entries of the network stack's
+	// interfaces.
+	FDB() []FDBEntry
+
+	// RemoveFDBEntry deletes the specified forwarding database entry.
+	RemoveFDBEntry(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// NewFDBEntry adds the given forwarding database entry.
+	NewFDBEntry(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// QDiscs returns the queueing disciplines of the network stack's
+	// interfaces.
+	QDiscs() []QDisc
+
+	// RemoveQDisc deletes the specified queueing discipline.
+	RemoveQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// NewQDisc adds or changes the given queueing discipline.
+	NewQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error
+
+	// ConntrackEntries returns the connections tracked by the network
+	// stack.
+	ConntrackEntries() []stack.ConntrackEntry
+
 	// Pause pauses the network stack before save.
 	Pause()
 
@@ -146,6 +206,9 @@ type Interface struct {
 	// MTU is the maximum transmission unit.
 	MTU uint32
 
+	// Kind is the link type reported in IFLA_INFO_KIND, if any.
+	Kind string
+
 	// Features are the device features queried from the host at
 	// stack creation time. These are immutable after startup.
 	Features []linux.EthtoolGetFeaturesBlock
@@ -199,7 +262,7 @@ type Route struct {
 	TOS uint8
 
 	// Table is the routing table ID.
-	Table uint8
+	Table uint32
 
 	// Protocol is the route origin, a Linux RTPROT_* constant.
 	Protocol uint8
@@ -224,6 +287,105 @@ type Route struct {
 
 	// GatewayAddr is the route gateway address (RTA_GATEWAY).
 	GatewayAddr []byte
+
+	// Priority is the route priority (RTA_PRIORITY).
+	Priority uint32
+}
+
+// Rule contains information about a policy routing rule.
+type Rule struct {
+	// Family is the address family, a Linux AF_* constant.
+	Family uint8
+
+	// DstLen is the length of the destination address.
+	DstLen uint8
+
+	// SrcLen is the length of the source address.
+	SrcLen uint8
+
+	// TOS is the Type of Service filter.
+	TOS uint8
+
+	// Action is the rule action, a Linux FR_ACT_* constant.
+	Action uint8
+
+	// Flags are rule flags, Linux FIB_RULE_* constants.
+	Flags uint32
+
+	// Table is the routing table ID (FRA_TABLE).
+	Table uint32
+
+	// Priority is the rule priority (FRA_PRIORITY).
+	Priority uint32
+
+	// DstAddr is the destination address (FRA_DST).
+	DstAddr []byte
+
+	// SrcAddr is the source address (FRA_SRC).
+	SrcAddr []byte
+
+	// Mark is the firewall mark (FRA_FWMARK).
+	Mark uint32
+
+	// MarkMask is the firewall mark mask (FRA_FWMASK).
+	MarkMask uint32
+
+	// InputInterface is the input interface name (FRA_IIFNAME).
+	InputInterface string
+
+	// OutputInterface is the output interface name (FRA_OIFNAME).
+	OutputInterface string
+
+	// HasUIDRange indicates whether UIDRange is set.
+	HasUIDRange bool
+
+	// UIDRange is the user ID range (FRA_UID_RANGE).
+	UIDRange linux.FibRuleUIDRange
+}
+
+// FDBEntry contains information about a forwarding database entry of an
+// interface, such as the remote end of a link address behind a VXLAN
+// interface.
+type FDBEntry struct {
+	// Index is the interface index.
+	Index int32
+
+	// State is the entry state, a Linux NUD_* constant.
+	State uint16
+
+	// Flags are the entry flags, Linux NTF_* constants.
+	Flags uint8
+
+	// LinkAddr is the link address (NDA_LLADDR).
+	LinkAddr []byte
+
+	// DstAddr is the underlay address of the remote end (NDA_DST).
+	DstAddr []byte
+
+	// Port is the UDP port of the remote end (NDA_PORT).
+	Port uint16
+
+	// VNI is the VXLAN network identifier of the remote end (NDA_VNI).
+	VNI uint32
+}
+
+// QDisc contains information about the queueing discipline of an interface.
+type QDisc struct {
+	// Index is the interface index.
+	Index int32
+
+	// Handle is the handle of the queueing discipline.
+	Handle uint32
+
+	// Parent is the handle of the parent, TC_H_ROOT for the root queueing
+	// discipline.
+	Parent uint32
+
+	// Kind is the name of the queueing discipline (TCA_KIND).
+	Kind string
+
+	// Options is the payload of the TCA_OPTIONS attribute, if any.
+	Options []byte
 }
 
 // Below SNMP metrics are from Linux/usr/include/linux/snmp.h.
@@ -33,11 +33,17 @@ type TestStack struct {
 	InterfacesMap     map[int32]Interface
 	InterfaceAddrsMap map[int32][]InterfaceAddr
 	RouteList         []Route
+	RuleList          []Rule
+	FDBList           []FDBEntry
+	QDiscList         []QDisc
 	SupportsIPv6Flag  bool
 	TCPRecvBufSize    TCPBufferSize
 	TCPSendBufSize    TCPBufferSize
 	TCPSACKFlag       bool
 	Recovery          TCPLossRecovery
+	ECN               int32
+	FastOpen          int32
+	CongestionControl string
 	IPForwarding      bool
 }
 
@@ -149,6 +155,44 @@ func (s *TestStack) SetTCPRecovery(recovery TCPLossRecovery) error {
 	return nil
 }
 
+// TCPECN implements Stack.
+func (s *TestStack) TCPECN() (int32, error) {
+	return s.ECN, nil
+}
+
+// SetTCPECN implements Stack.
+func (s *TestStack) SetTCPECN(mode int32) error {
+	s.ECN = mode
+	return nil
+}
+
+// TCPFastOpen implements Stack.
+func (s *TestStack) TCPFastOpen() (int32, error) {
+	return s.FastOpen, nil
+}
+
+// SetTCPFastOpen implements Stack.
+func (s *TestStack) SetTCPFastOpen(mode int32) error {
+	s.FastOpen = mode
+	return nil
+}
+
+// TCPAvailableCongestionControl implements Stack.
+func (s *TestStack) TCPAvailableCongestionControl() (string, error) {
+	return "reno cubic bbr", nil
+}
+
+// TCPCongestionControl implements Stack.
+func (s *TestStack) TCPCongestionControl() (string, error) {
+	return s.CongestionControl, nil
+}
+
+// SetTCPCongestionControl implements Stack.
+func (s *TestStack) SetTCPCongestionControl(name string) error {
+	s.CongestionControl = name
+	return nil
+}
+
 // Statistics implements Stack.
 func (s *TestStack) Statistics(stat any, arg string) error {
 	return nil
@@ -169,6 +213,56 @@ func (s *TestStack) NewRoute(ctx context.Context, msg *nlmsg.Message) *syserr.Er
 	return syserr.ErrNotPermitted
 }
 
+// RuleTable implements Stack.
+func (s *TestStack) RuleTable() []Rule {
+	return s.RuleList
+}
+
+// RemoveRule implements Stack.
+func (s *TestStack) RemoveRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return nil
+}
+
+// NewRule implements Stack.
+func (s *TestStack) NewRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotPermitted
+}
+
+// FDB implements Stack.
+func (s *TestStack) FDB() []FDBEntry {
+	return s.FDBList
+}
+
+// RemoveFDBEntry implements Stack.
+func (s *TestStack) RemoveFDBEntry(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return nil
+}
+
+// NewFDBEntry implements Stack.
+func (s *TestStack) NewFDBEntry(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotPermitted
+}
+
+// QDiscs implements Stack.
+func (s *TestStack) QDiscs() []QDisc {
+	return s.QDiscList
+}
+
+// RemoveQDisc implements Stack.
+func (s *TestStack) RemoveQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return nil
+}
+
+// NewQDisc implements Stack.
+func (s *TestStack) NewQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotPermitted
+}
+
+// ConntrackEntries implements Stack.
+func (s *TestStack) ConntrackEntries() []stack.ConntrackEntry {
+	return nil
+}
+
 // Pause implements Stack.
 func (s *TestStack) Pause() {}
 
@@ -241,6 +241,17 @@ func NewWaiter() *Waiter {
 	}
 }
 
+// NewWaiters returns n new unqueued Waiters that share the same channel C, for
+// use with WaitvPrepare.
+func NewWaiters(n int) []Waiter {
+	c := make(chan struct{}, 1)
+	ws := make([]Waiter, n)
+	for i := range ws {
+		ws[i].C = c
+	}
+	return ws
+}
+
 // woken returns true if w has been woken since the last call to WaitPrepare.
 func (w *Waiter) woken() bool {
 	return len(w.C) != 0
@@ -281,7 +292,12 @@ func (b *bucket) wakeLocked(key *Key, bitmask uint32, n int) int {
 func (b *bucket) wakeWaiterLocked(w *Waiter) {
 	// Remove from the bucket and wake the waiter.
 	b.waiters.Remove(w)
-	w.C <- struct{}{}
+	select {
+	case w.C <- struct{}{}:
+	default:
+		// w.C is shared with other Waiters (see NewWaiters), and another
+		// Waiter sharing it has already been woken.
+	}
 
 	// NOTE: The above channel write establishes a write barrier according
 	// to the memory model, so nothing may be ordered around it. Since
@@ -604,6 +620,13 @@ func (m *Manager) WaitPrepare(w *Waiter, t Target, addr hostarch.Addr, private b
 // WaitComplete must be called when a Waiter previously added by WaitPrepare is
 // no longer eligible to be woken.
 func (m *Manager) WaitComplete(w *Waiter, t Target) {
+	m.waitComplete(w, t)
+}
+
+// waitComplete implements WaitComplete. It returns true if w was dequeued by
+// a wakeup rather than by waitComplete.
+func (m *Manager) waitComplete(w *Waiter, t Target) bool {
+	woken := true
 	// Remove w from the bucket it's in.
 	for {
 		b := w.bucket.Load()
@@ -631,11 +654,90 @@ func (m *Manager) WaitComplete(w *Waiter, t Target) {
 		b.waiters.Remove(w)
 		w.bucket.Store(nil)
 		b.mu.Unlock()
+		woken = false
 		break
 	}
 
 	// Release references held by the waiter.
 	w.key.release(t)
+	return woken
+}
+
+// WaitvFutex describes one of the futexes waited on by WaitvPrepare.
+type WaitvFutex struct {
+	// Addr is the address of the futex word.
+	Addr hostarch.Addr
+
+	// Private is true if the futex is private to the address space.
+	Private bool
+
+	// Val is the expected value of the futex word.
+	Val uint32
+}
+
+// WaitvPrepare implements the setup phase of futex_waitv(2). For each futex i
+// in fs, it atomically checks that the futex word contains fs[i].Val, then
+// enqueues ws[i] to be woken by a wakeup on that futex. All Waiters in ws
+// must share the same channel C (see NewWaiters), which receives a send when
+// any of them is woken.
+//
+// If all futexes are successfully enqueued, WaitvPrepare returns (-1, nil),
+// and the Waiters must be subsequently removed by calling WaitvComplete,
+// whether or not a wakeup is received on C. Otherwise, all Waiters enqueued by
+// WaitvPrepare have already been removed; WaitvPrepare returns the index of a
+// Waiter that was woken before it could be removed if one exists, and an error
+// (EAGAIN if a futex word did not contain the expected value) otherwise.
+//
+// Preconditions: len(ws) == len(fs).
+func (m *Manager) WaitvPrepare(ws []Waiter, t Target, fs []WaitvFutex) (int, error) {
+	if len(ws) == 0 {
+		return -1, nil
+	}
+	// Prepare the Waiters before taking any bucket lock.
+	select {
+	case <-ws[0].C:
+	default:
+	}
+	for i := range fs {
+		f := &fs[i]
+		w := &ws[i]
+		k, err := getKey(t, f.Addr, f.Private)
+		if err == nil {
+			// Ownership of k is transferred to w below.
+			w.key = k
+			w.bitmask = linux.FUTEX_BITSET_MATCH_ANY
+			b := m.lockBucket(&k)
+			if err = check(t, f.Addr, f.Val); err == nil {
+				b.waiters.PushBack(w)
+				w.bucket.Store(b)
+			} else {
+				w.key.release(t)
+			}
+			b.mu.Unlock()
+		}
+		if err != nil {
+			if woken := m.WaitvComplete(ws[:i], t); woken >= 0 {
+				return woken, nil
+			}
+			return -1, err
+		}
+	}
+	return -1, nil
+}
+
+// WaitvComplete must be called when Waiters previously added by WaitvPrepare
+// are no longer eligible to be woken. It returns the index of a Waiter in ws
+// that was woken, or -1 if no Waiter was woken.
+func (m *Manager) WaitvComplete(ws []Waiter, t Target) int {
+	woken := -1
+	for i := range ws {
+		// Like Linux's futex_unqueue_multiple(), report the woken Waiter with
+		// the highest index.
+		if m.waitComplete(&ws[i], t) {
+			woken = i
+		}
+	}
+	return woken
 }
 
 // LockPI attempts to lock the futex following the Priority-inheritance futex
@@ -200,6 +200,90 @@ func TestFutexWakeUnrelated(t *testing.T) {
 	}
 }
 
+func TestWaitvWake(t *testing.T) {
+	for _, private := range []bool{false, true} {
+		t.Run(futexKind(private), func(t *testing.T) {
+			m := NewManager()
+			d := newTestData(3 * sizeofInt32)
+
+			// Start waiting for wakeup on three addresses.
+			ws := NewWaiters(3)
+			fs := []WaitvFutex{
+				{Addr: 0 * sizeofInt32, Private: private},
+				{Addr: 1 * sizeofInt32, Private: private},
+				{Addr: 2 * sizeofInt32, Private: private},
+			}
+			if woken, err := m.WaitvPrepare(ws, d, fs); woken != -1 || err != nil {
+				t.Fatalf("WaitvPrepare: got (%d, %v), wanted (-1, nil)", woken, err)
+			}
+
+			// Perform two wakeups on the second address.
+			if n, err := m.Wake(d, 1*sizeofInt32, private, ^uint32(0), 2); err != nil || n != 1 {
+				t.Errorf("Wake: got (%d, %v), wanted (1, nil)", n, err)
+			}
+
+			// Expect the shared channel to have been notified, and only the
+			// second waiter to have been woken.
+			if !ws[0].woken() {
+				t.Error("channel not notified")
+			}
+			if woken := m.WaitvComplete(ws, d); woken != 1 {
+				t.Errorf("WaitvComplete: got %d, wanted 1", woken)
+			}
+		})
+	}
+}
+
+func TestWaitvWakeMultiple(t *testing.T) {
+	m := NewManager()
+	d := newTestData(2 * sizeofInt32)
+
+	ws := NewWaiters(2)
+	fs := []WaitvFutex{
+		{Addr: 0 * sizeofInt32, Private: true},
+		{Addr: 1 * sizeofInt32, Private: true},
+	}
+	if woken, err := m.WaitvPrepare(ws, d, fs); woken != -1 || err != nil {
+		t.Fatalf("WaitvPrepare: got (%d, %v), wanted (-1, nil)", woken, err)
+	}
+
+	// Wake both waiters. The second wakeup must not block, even though the
+	// shared channel is already full.
+	for _, addr := range []hostarch.Addr{0 * sizeofInt32, 1 * sizeofInt32} {
+		if n, err := m.Wake(d, addr, true, ^uint32(0), 1); err != nil || n != 1 {
+			t.Errorf("Wake(%d): got (%d, %v), wanted (1, nil)", addr, n, err)
+		}
+	}
+
+	// The woken waiter with the highest index is reported.
+	if woken := m.WaitvComplete(ws, d); woken != 1 {
+		t.Errorf("WaitvComplete: got %d, wanted 1", woken)
+	}
+}
+
+func TestWaitvWrongVal(t *testing.T) {
+	for _, private := range []bool{false, true} {
+		t.Run(futexKind(private), func(t *testing.T) {
+			m := NewManager()
+			d := newTestData(2 * sizeofInt32)
+
+			ws := NewWaiters(2)
+			fs := []WaitvFutex{
+				{Addr: 0 * sizeofInt32, Private: private},
+				{Addr: 1 * sizeofInt32, Private: private, Val: 1},
+			}
+			if woken, err := m.WaitvPrepare(ws, d, fs); woken != -1 || err != linuxerr.EAGAIN {
+				t.Fatalf("WaitvPrepare: got (%d, %v), wanted (-1, %v)", woken, err, linuxerr.EAGAIN)
+			}
+
+			// The first waiter must have been dequeued.
+			if n, err := m.Wake(d, 0*sizeofInt32, private, ^uint32(0), 1); err != nil || n != 0 {
+				t.Errorf("Wake: got (%d, %v), wanted (0, nil)", n, err)
+			}
+		})
+	}
+}
+
 func TestWakeOpEmpty(t *testing.T) {
 	for _, private := range []bool{false, true} {
 		t.Run(futexKind(private), func(t *testing.T) {
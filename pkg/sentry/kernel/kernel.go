@@ -158,7 +158,9 @@ type Kernel struct {
 	rootUserNamespace    *auth.UserNamespace
 	rootNetworkNamespace *inet.Namespace
 	applicationCores     uint
+	numaNodes            uint
 	useHostCores         bool
+	allowSecretMemSave   bool
 	extraAuxv            []arch.AuxEntry
 	vdso                 *loader.VDSO
 	vdsoParams           *VDSOParamPage
@@ -420,6 +422,11 @@ type InitKernelArgs struct {
 	// most significant bit in cpu_possible_mask + 1.
 	ApplicationCores uint
 
+	// NUMANodes is the number of NUMA nodes visible to sandboxed
+	// applications. Application CPUs are divided between nodes in contiguous
+	// ranges. If NUMANodes is 0, it is treated as 1.
+	NUMANodes uint
+
 	// If UseHostCores is true, Task.CPU() returns the task goroutine's CPU
 	// instead of a virtualized CPU number, and Task.CopyToCPUMask() is a
 	// no-op. If ApplicationCores is less than hostcpu.MaxPossibleCPU(), it
@@ -452,6 +459,12 @@ type InitKernelArgs struct {
 
 	// UnixSocketOpts contains configuration options for unix sockets.
 	UnixSocketOpts transport.UnixSocketOpts
+
+	// If AllowSecretMemSave is true, the kernel may be saved while
+	// memfd_secret(2) memory exists, in which case that memory is included in
+	// the saved state. Otherwise, such saves fail, as Linux does not permit
+	// hibernation while secretmem is in use.
+	AllowSecretMemSave bool
 }
 
 // Init initialize the Kernel with no tasks.
@@ -487,6 +500,8 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	k.cpuClockTickerWakeCh = make(chan struct{}, 1)
 	k.cpuClockTickerStopCond.L = &k.runningTasksMu
 	k.applicationCores = args.ApplicationCores
+	k.numaNodes = args.NUMANodes
+	k.allowSecretMemSave = args.AllowSecretMemSave
 	if args.UseHostCores {
 		k.useHostCores = true
 		maxCPU, err := hostcpu.MaxPossibleCPU()
@@ -644,6 +659,12 @@ func (k *Kernel) SaveTo(ctx context.Context, w, pagesMetadata io.Writer, pagesFi
 	k.pauseTimeLocked(ctx)
 	defer k.resumeTimeLocked(ctx)
 
+	// Compare Linux's kernel/power/hibernate.c:hibernate() =>
+	// secretmem_active().
+	if !k.allowSecretMemSave && tmpfs.HasSecretMem(k.shmMount) {
+		return fmt.Errorf("memfd_secret memory is in use")
+	}
+
 	// Evict all evictable MemoryFile allocations.
 	k.mf.StartEvictions()
 	k.mf.WaitForEvictions()
@@ -1639,6 +1660,36 @@ func (k *Kernel) ApplicationCores() uint {
 	return k.applicationCores
 }
 
+// NUMANodes returns the number of NUMA nodes visible to sandboxed
+// applications.
+func (k *Kernel) NUMANodes() uint {
+	if k.numaNodes == 0 {
+		return 1
+	}
+	return k.numaNodes
+}
+
+// NUMANodeForCPU returns the NUMA node containing the given CPU.
+func (k *Kernel) NUMANodeForCPU(cpu int32) uint {
+	nodes := k.NUMANodes()
+	if nodes == 1 || cpu < 0 || k.applicationCores == 0 {
+		return 0
+	}
+	return uint(uint64(cpu) * uint64(nodes) / uint64(k.applicationCores))
+}
+
+// NUMANodeCPUs returns the range of CPUs [start, end) contained by the given
+// NUMA node. The range may be empty if there are more nodes than CPUs.
+func (k *Kernel) NUMANodeCPUs(node uint) (start, end uint) {
+	nodes := k.NUMANodes()
+	// NUMANodeForCPU(cpu) == node iff node*cores <= cpu*nodes <
+	// (node+1)*cores.
+	first := func(n uint) uint {
+		return uint((uint64(n)*uint64(k.applicationCores) + uint64(nodes) - 1) / uint64(nodes))
+	}
+	return first(node), first(node + 1)
+}
+
 // RealtimeClock returns the application CLOCK_REALTIME clock.
 func (k *Kernel) RealtimeClock() ktime.Clock {
 	return k.timekeeper.realtimeClock
@@ -29,6 +29,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel/futex"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
@@ -497,17 +498,17 @@ type Task struct {
 	niceness int
 
 	// This is used to track the numa policy for the current thread. This can be
-	// modified through a set_mempolicy(2) syscall. Since we always report a
-	// single numa node, all policies are no-ops. We only track this information
-	// so that we can return reasonable values if the application calls
-	// get_mempolicy(2) after setting a non-default policy. Note that in the
-	// real syscall, nodemask can be longer than a single unsigned long, but we
-	// always report a single node so never need to save more than a single
-	// bit.
-	//
-	// numaPolicy and numaNodeMask are protected by mu.
-	numaPolicy   linux.NumaPolicy
-	numaNodeMask uint64
+	// modified through a set_mempolicy(2) syscall, and is honored by the
+	// MemoryManager (via mm.CtxNUMAPolicy) when allocating memory for vmas
+	// without a policy set by mbind(2). Note that in the real syscall,
+	// nodemask can be longer than a single unsigned long, but we report at
+	// most 64 nodes (see Kernel.NUMANodes) so never need to save more than a
+	// single unsigned long.
+	//
+	// numaPolicy is replaced as a whole, and is read without locking since
+	// the MemoryManager reads it with mm.MemoryManager.activeMu locked, which
+	// is ordered after mu. A nil policy is MPOL_DEFAULT.
+	numaPolicy atomic.Pointer[mm.NUMAPolicy] `state:".(*mm.NUMAPolicy)"`
 
 	// netns is the task's network namespace. It has to be changed under mu
 	// so that GetNetworkNamespace can take a reference before it is
@@ -655,6 +656,14 @@ func (t *Task) loadSeccomp(_ gocontext.Context, seccompData *taskSeccomp) {
 	t.seccomp.Store(seccompData)
 }
 
+func (t *Task) saveNumaPolicy() *mm.NUMAPolicy {
+	return t.numaPolicy.Load()
+}
+
+func (t *Task) loadNumaPolicy(_ gocontext.Context, policy *mm.NUMAPolicy) {
+	t.numaPolicy.Store(policy)
+}
+
 // afterLoad is invoked by stateify.
 func (t *Task) afterLoad(gocontext.Context) {
 	t.updateInfoLocked()
@@ -27,6 +27,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel/shm"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/unimpl"
@@ -118,6 +119,11 @@ func (t *Task) contextValue(key any, isTaskGoroutine bool) any {
 		return func(sig linux.Signal) error {
 			return t.SendSignal(SignalInfoNoInfo(sig, t, t))
 		}
+	case mm.CtxNUMAPolicy:
+		policy, nodemask := t.NumaPolicy()
+		return mm.NUMAPolicy{Mode: policy, Nodemask: nodemask}
+	case mm.CtxNUMALocalNode:
+		return t.k.NUMANodeForCPU(t.CPU())
 	case pgalloc.CtxMemoryCgroupID:
 		return t.memCgID.Load()
 	case pgalloc.CtxMemoryFile:
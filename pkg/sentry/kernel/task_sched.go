@@ -644,15 +644,16 @@ func (t *Task) SetNiceness(n int) {
 
 // NumaPolicy returns t's current numa policy.
 func (t *Task) NumaPolicy() (policy linux.NumaPolicy, nodeMask uint64) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	return t.numaPolicy, t.numaNodeMask
+	if p := t.numaPolicy.Load(); p != nil {
+		return p.Mode, p.Nodemask
+	}
+	return linux.MPOL_DEFAULT, 0
 }
 
 // SetNumaPolicy sets t's numa policy.
 func (t *Task) SetNumaPolicy(policy linux.NumaPolicy, nodeMask uint64) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.numaPolicy = policy
-	t.numaNodeMask = nodeMask
+	t.numaPolicy.Store(&mm.NUMAPolicy{
+		Mode:     policy,
+		Nodemask: nodeMask,
+	})
 }
@@ -391,6 +391,11 @@ type MMapOpts struct {
 	// underlying memory backing the mapping thus the memory content is
 	// guaranteed not to be modified outside the sentry's purview.
 	SentryOwnedContent bool
+
+	// If Secret is true, the mapping's contents may not be accessed by I/O on
+	// behalf of other processes (usermem.IOOpts.Remote), and are excluded
+	// from core dumps. This is analogous to Linux's secretmem mappings.
+	Secret bool
 }
 
 // MMapPlatformEffect is the type of MMapOpts.PlatformEffect.
@@ -15,10 +15,13 @@
 package mm
 
 import (
+	"fmt"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/safemem"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
@@ -45,10 +48,11 @@ func (mm *MemoryManager) destroyAIOManager(ctx context.Context) {
 	}
 }
 
-// newAIOContext creates a new context for asynchronous I/O.
+// newAIOContext creates a new context for asynchronous I/O whose completions
+// are delivered to ring.
 //
 // Returns false if 'id' is currently in use.
-func (a *aioManager) newAIOContext(events uint32, id uint64) bool {
+func (a *aioManager) newAIOContext(events uint32, id uint64, ring *aioMappable) bool {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -56,8 +60,10 @@ func (a *aioManager) newAIOContext(events uint32, id uint64) bool {
 		return false
 	}
 
+	ring.IncRef()
 	a.contexts[id] = &AIOContext{
 		requestReady:   make(chan struct{}, 1),
+		ring:           ring,
 		maxOutstanding: events,
 	}
 	return true
@@ -91,16 +97,13 @@ func (a *aioManager) lookupAIOContext(id uint64) (*AIOContext, bool) {
 	return ctx, ok
 }
 
-// ioResult is a completed I/O operation.
-//
-// +stateify savable
-type ioResult struct {
-	data any
-	ioEntry
-}
-
 // AIOContext is a single asynchronous I/O context.
 //
+// Completed requests are stored in the context's aio_ring, which is mapped
+// into the application's address space at the context ID. This allows
+// applications (e.g. libaio) to reap completions without a system call by
+// consuming events between the ring's head and tail and advancing its head.
+//
 // +stateify savable
 type AIOContext struct {
 	// requestReady is the notification channel used for all requests.
@@ -109,20 +112,22 @@ type AIOContext struct {
 	// mu protects below.
 	mu aioContextMutex `state:"nosave"`
 
-	// results is the set of completed requests.
-	results ioList
+	// ring is the memory containing the aio_ring. AIOContext holds a
+	// reference on ring until it is destroyed and no requests are pending,
+	// since completions may be written to it until then.
+	ring *aioMappable
 
 	// maxOutstanding is the maximum number of outstanding entries; this value
 	// is immutable.
 	maxOutstanding uint32
 
-	// outstanding is the number of requests outstanding; this will effectively
-	// be the number of entries in the result list or that are expected to be
-	// added to the result list.
-	outstanding uint32
+	// pending is the number of requests that have been prepared but have
+	// not yet completed. The number of outstanding requests is pending plus
+	// the number of completed events in the ring.
+	pending uint32
 
 	// dead is set when the context is destroyed.
-	dead bool `state:"zerovalue"`
+	dead bool
 }
 
 // destroy marks the context dead.
@@ -135,9 +140,10 @@ func (aio *AIOContext) destroy() {
 
 // Preconditions: ctx.mu must be held by caller.
 func (aio *AIOContext) checkForDone() {
-	if aio.dead && aio.outstanding == 0 {
+	if aio.dead && aio.pending == 0 && aio.requestReady != nil {
 		close(aio.requestReady)
 		aio.requestReady = nil
+		aio.ring.DecRef(context.Background())
 	}
 }
 
@@ -150,48 +156,65 @@ func (aio *AIOContext) Prepare() error {
 		// Context died after the caller looked it up.
 		return linuxerr.EINVAL
 	}
-	if aio.outstanding >= aio.maxOutstanding {
+	// Events consumed by the application directly from the ring make room
+	// for new requests.
+	head, tail := aio.ring.headTail()
+	if aio.pending+aio.ring.count(head, tail) >= aio.maxOutstanding {
 		// Context is busy.
 		return linuxerr.EAGAIN
 	}
-	aio.outstanding++
+	aio.pending++
 	return nil
 }
 
 // PopRequest pops a completed request if available, this function does not do
 // any blocking. Returns false if no request is available.
-func (aio *AIOContext) PopRequest() (any, bool) {
+func (aio *AIOContext) PopRequest() (linux.IOEvent, bool) {
 	aio.mu.Lock()
 	defer aio.mu.Unlock()
 
+	if aio.requestReady == nil {
+		// The ring has already been released.
+		return linux.IOEvent{}, false
+	}
+
 	// Is there anything ready?
-	if e := aio.results.Front(); e != nil {
-		if aio.outstanding == 0 {
-			panic("AIOContext outstanding is going negative")
-		}
-		aio.outstanding--
-		aio.results.Remove(e)
-		aio.checkForDone()
-		return e.data, true
+	head, tail := aio.ring.headTail()
+	if head == tail {
+		return linux.IOEvent{}, false
 	}
-	return nil, false
+	ev := aio.ring.event(head)
+	aio.ring.setHead((head + 1) % aio.ring.nr)
+	return ev, true
 }
 
 // FinishRequest finishes a pending request. It queues up the data
 // and notifies listeners.
-func (aio *AIOContext) FinishRequest(data any) {
+func (aio *AIOContext) FinishRequest(ev *linux.IOEvent) {
 	aio.mu.Lock()
 	defer aio.mu.Unlock()
 
-	// Push to the list and notify opportunistically. The channel notify
-	// here is guaranteed to be safe because outstanding must be non-zero.
-	// The requestReady channel is only closed when outstanding reaches zero.
-	aio.results.PushBack(&ioResult{data: data})
+	if aio.pending == 0 {
+		panic("AIOContext pending is going negative")
+	}
+	aio.pending--
+
+	// Push to the ring and notify opportunistically. The channel notify here
+	// is guaranteed to be safe because pending was non-zero. The
+	// requestReady channel is only closed when pending reaches zero.
+	//
+	// The ring can't overflow since the number of outstanding requests is
+	// bounded by maxOutstanding, which is less than ring.nr. (If the
+	// application corrupts the ring's head, it only loses its own events.)
+	_, tail := aio.ring.headTail()
+	aio.ring.setEvent(tail, ev)
+	aio.ring.setTail((tail + 1) % aio.ring.nr)
 
 	select {
 	case aio.requestReady <- struct{}{}:
 	default:
 	}
+	aio.checkForDone()
 }
 
 // WaitChannel returns a channel that is notified when an AIO request is
@@ -215,10 +238,10 @@ func (aio *AIOContext) CancelPendingRequest() {
 	aio.mu.Lock()
 	defer aio.mu.Unlock()
 
-	if aio.outstanding == 0 {
-		panic("AIOContext outstanding is going negative")
+	if aio.pending == 0 {
+		panic("AIOContext pending is going negative")
 	}
-	aio.outstanding--
+	aio.pending--
 	aio.checkForDone()
 }
 
@@ -227,16 +250,12 @@ func (aio *AIOContext) Drain() {
 	aio.mu.Lock()
 	defer aio.mu.Unlock()
 
-	if aio.outstanding == 0 {
+	if aio.requestReady == nil {
+		// The ring has already been released.
 		return
 	}
-	size := uint32(aio.results.Len())
-	if aio.outstanding < size {
-		panic("AIOContext outstanding is going negative")
-	}
-	aio.outstanding -= size
-	aio.results.Reset()
-	aio.checkForDone()
+	_, tail := aio.ring.headTail()
+	aio.ring.setHead(tail)
 }
 
 // aioMappable implements memmap.MappingIdentity and memmap.Mappable for AIO
@@ -248,20 +267,112 @@ type aioMappable struct {
 
 	mf *pgalloc.MemoryFile `state:"nosave"`
 	fr memmap.FileRange
+
+	// nr is the number of io_event slots in the ring; this value is
+	// immutable. One slot is always left empty to distinguish a full ring
+	// from an empty one.
+	nr uint32
 }
 
-var aioRingBufferSize = uint64(hostarch.Addr(linux.AIORingSize).MustRoundUp())
+// aioMaxEvents is the maximum number of events in an AIO context.
+//
+// Linux: fs/aio.c:ioctx_alloc()
+var aioMaxEvents = uint32(0x10000000 / linux.IOEventSize)
 
-func newAIOMappable(ctx context.Context, mf *pgalloc.MemoryFile) (*aioMappable, error) {
-	fr, err := mf.Allocate(aioRingBufferSize, pgalloc.AllocOpts{Kind: usage.Anonymous, MemCgID: pgalloc.MemoryCgroupIDFromContext(ctx)})
+func newAIOMappable(ctx context.Context, mf *pgalloc.MemoryFile, events uint32) (*aioMappable, error) {
+	// Linux: fs/aio.c:aio_setup_ring()
+	size := uint64(hostarch.Addr(linux.AIORingSize + (uint64(events)+1)*uint64(linux.IOEventSize)).MustRoundUp())
+	fr, err := mf.Allocate(size, pgalloc.AllocOpts{Kind: usage.Anonymous, MemCgID: pgalloc.MemoryCgroupIDFromContext(ctx)})
 	if err != nil {
 		return nil, err
 	}
-	m := aioMappable{mf: mf, fr: fr}
+	m := aioMappable{
+		mf: mf,
+		fr: fr,
+		nr: uint32((size - linux.AIORingSize) / uint64(linux.IOEventSize)),
+	}
 	m.InitRefs()
+	hdr := linux.AIORing{
+		Nr:               m.nr,
+		Magic:            linux.AIO_RING_MAGIC,
+		CompatFeatures:   linux.AIO_RING_COMPAT_FEATURES,
+		IncompatFeatures: linux.AIO_RING_INCOMPAT_FEATURES,
+		HeaderLength:     linux.AIORingSize,
+	}
+	buf := make([]byte, linux.AIORingSize)
+	hdr.MarshalUnsafe(buf)
+	if _, err := safemem.Copy(m.block(0, linux.AIORingSize), safemem.BlockFromSafeSlice(buf)); err != nil {
+		m.DecRef(ctx)
+		return nil, err
+	}
 	return &m, nil
 }
 
+// block returns an internal mapping of the given range of the ring. The range
+// must not cross a page boundary.
+func (m *aioMappable) block(off, length uint64) safemem.Block {
+	bs, err := m.mf.MapInternal(memmap.FileRange{m.fr.Start + off, m.fr.Start + off + length}, hostarch.ReadWrite)
+	if err != nil {
+		// The ring is always allocated from, and stays in, m.mf.
+		panic(fmt.Sprintf("failed to map AIO ring: %v", err))
+	}
+	return bs.Head()
+}
+
+// Offsets of the fields of struct aio_ring that are updated after
+// initialization.
+const (
+	aioRingHeadOffset = 8
+	aioRingTailOffset = 12
+)
+
+// headTail returns the ring's head and tail. Since head is written by the
+// application, it is sanitized in the same way as Linux's
+// fs/aio.c:aio_read_events_ring().
+func (m *aioMappable) headTail() (uint32, uint32) {
+	head, _ := safemem.LoadUint32(m.block(aioRingHeadOffset, 4))
+	tail, _ := safemem.LoadUint32(m.block(aioRingTailOffset, 4))
+	return head % m.nr, tail % m.nr
+}
+
+// count returns the number of completed events between head and tail.
+func (m *aioMappable) count(head, tail uint32) uint32 {
+	if tail >= head {
+		return tail - head
+	}
+	return m.nr - head + tail
+}
+
+func (m *aioMappable) setHead(head uint32) {
+	safemem.SwapUint32(m.block(aioRingHeadOffset, 4), head)
+}
+
+// setTail publishes all events preceding tail to the application. It must be
+// called after the corresponding setEvent.
+func (m *aioMappable) setTail(tail uint32) {
+	safemem.SwapUint32(m.block(aioRingTailOffset, 4), tail)
+}
+
+func (m *aioMappable) eventOffset(i uint32) uint64 {
+	return linux.AIORingSize + uint64(i)*uint64(linux.IOEventSize)
+}
+
+// event returns the event in slot i.
+func (m *aioMappable) event(i uint32) linux.IOEvent {
+	var ev linux.IOEvent
+	buf := make([]byte, linux.IOEventSize)
+	safemem.Copy(safemem.BlockFromSafeSlice(buf), m.block(m.eventOffset(i), uint64(linux.IOEventSize)))
+	ev.UnmarshalUnsafe(buf)
+	return ev
+}
+
+// setEvent stores ev in slot i.
+func (m *aioMappable) setEvent(i uint32, ev *linux.IOEvent) {
+	buf := make([]byte, linux.IOEventSize)
+	ev.MarshalUnsafe(buf)
+	safemem.Copy(m.block(m.eventOffset(i), uint64(linux.IOEventSize)), safemem.BlockFromSafeSlice(buf))
+}
+
 // DecRef implements refs.RefCounter.DecRef.
 func (m *aioMappable) DecRef(ctx context.Context) {
 	m.aioMappableRefs.DecRef(func() {
@@ -294,7 +405,7 @@ func (m *aioMappable) Msync(ctx context.Context, mr memmap.MappableRange) error
 func (m *aioMappable) AddMapping(_ context.Context, _ memmap.MappingSpace, ar hostarch.AddrRange, offset uint64, _ bool) error {
 	// Don't allow mappings to be expanded (in Linux, fs/aio.c:aio_ring_mmap()
 	// sets VM_DONTEXPAND).
-	if offset != 0 || uint64(ar.Length()) != aioRingBufferSize {
+	if offset != 0 || uint64(ar.Length()) != m.fr.Length() {
 		return linuxerr.EFAULT
 	}
 	return nil
@@ -308,7 +419,7 @@ func (m *aioMappable) RemoveMapping(context.Context, memmap.MappingSpace, hostar
 func (m *aioMappable) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR, dstAR hostarch.AddrRange, offset uint64, _ bool) error {
 	// Don't allow mappings to be expanded (in Linux, fs/aio.c:aio_ring_mmap()
 	// sets VM_DONTEXPAND).
-	if offset != 0 || uint64(dstAR.Length()) != aioRingBufferSize {
+	if offset != 0 || uint64(dstAR.Length()) != m.fr.Length() {
 		return linuxerr.EFAULT
 	}
 	// Require that the mapping correspond to a live AIOContext. Compare
@@ -364,31 +475,32 @@ func (m *aioMappable) InvalidateUnsavable(ctx context.Context) error {
 //
 // NewAIOContext is analogous to Linux's fs/aio.c:ioctx_alloc().
 func (mm *MemoryManager) NewAIOContext(ctx context.Context, events uint32) (uint64, error) {
-	// libaio get_ioevents() expects context "handle" to be a valid address.
-	// libaio peeks inside looking for a magic number. This function allocates
-	// a page per context and keeps it set to zeroes to ensure it will not
-	// match AIO_RING_MAGIC and make libaio happy.
-	m, err := newAIOMappable(ctx, mm.mf)
+	if events == 0 || events > aioMaxEvents {
+		return 0, linuxerr.EINVAL
+	}
+	// The context "handle" is the address of the aio_ring, which libaio uses
+	// to reap completions from userspace when it finds AIO_RING_MAGIC.
+	m, err := newAIOMappable(ctx, mm.mf, events)
 	if err != nil {
 		return 0, err
 	}
 	defer m.DecRef(ctx)
 	addr, err := mm.MMap(ctx, memmap.MMapOpts{
-		Length:          aioRingBufferSize,
+		Length:          m.fr.Length(),
 		MappingIdentity: m,
 		Mappable:        m,
 		// Linux uses "do_mmap_pgoff(..., PROT_READ | PROT_WRITE, ...)" in
-		// fs/aio.c:aio_setup_ring(). Since we don't implement AIO_RING_MAGIC,
-		// user mode should not write to this page.
-		Perms:    hostarch.Read,
-		MaxPerms: hostarch.Read,
+		// fs/aio.c:aio_setup_ring(). User mode writes the ring's head after
+		// consuming events.
+		Perms:    hostarch.ReadWrite,
+		MaxPerms: hostarch.ReadWrite,
 	})
 	if err != nil {
 		return 0, err
 	}
 	id := uint64(addr)
-	if !mm.aioManager.newAIOContext(events, id) {
-		mm.MUnmap(ctx, addr, aioRingBufferSize)
+	if !mm.aioManager.newAIOContext(events, id, m) {
+		mm.MUnmap(ctx, addr, m.fr.Length())
 		return 0, linuxerr.EINVAL
 	}
 	return id, nil
@@ -397,7 +509,8 @@ func (mm *MemoryManager) NewAIOContext(ctx context.Context, events uint32) (uint
 // DestroyAIOContext destroys an asynchronous I/O context. It returns the
 // destroyed context. nil if the context does not exist.
 func (mm *MemoryManager) DestroyAIOContext(ctx context.Context, id uint64) *AIOContext {
-	if !mm.isValidAddr(ctx, id) {
+	aioCtx, ok := mm.LookupAIOContext(ctx, id)
+	if !ok {
 		return nil
 	}
 
@@ -408,7 +521,7 @@ func (mm *MemoryManager) DestroyAIOContext(ctx context.Context, id uint64) *AIOC
 	// the same address. Then it would be unmapping memory that it doesn't own.
 	// This is, however, the way Linux implements AIO. Keeps the same [weird]
 	// semantics in case anyone relies on it.
-	mm.MUnmap(ctx, hostarch.Addr(id), aioRingBufferSize)
+	mm.MUnmap(ctx, hostarch.Addr(id), aioCtx.ring.fr.Length())
 
 	mm.aioManager.mu.Lock()
 	defer mm.aioManager.mu.Unlock()
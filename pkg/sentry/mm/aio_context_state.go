@@ -22,7 +22,11 @@ import (
 
 // afterLoad is invoked by stateify.
 func (aio *AIOContext) afterLoad(context.Context) {
-	aio.requestReady = make(chan struct{}, 1)
+	// A dead context without pending requests has already closed its
+	// channel and released its ring.
+	if !aio.dead || aio.pending > 0 {
+		aio.requestReady = make(chan struct{}, 1)
+	}
 }
 
 // afterLoad is invoked by stateify.
@@ -92,6 +92,25 @@ func (mm *MemoryManager) asioEnabled(opts usermem.IOOpts) bool {
 	return mm.haveASIO && !opts.IgnorePermissions && opts.AddressSpaceActive
 }
 
+// checkRemoteIO returns EFAULT if opts.Remote is true and any address in ars
+// is mapped by a vma that may not be accessed remotely.
+func (mm *MemoryManager) checkRemoteIO(ars hostarch.AddrRangeSeq, opts usermem.IOOpts) error {
+	if !opts.Remote {
+		return nil
+	}
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	for ; !ars.IsEmpty(); ars = ars.Tail() {
+		ar := ars.Head()
+		for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+			if vseg.ValuePtr().secret {
+				return linuxerr.EFAULT
+			}
+		}
+	}
+	return nil
+}
+
 // translateIOError converts errors to EFAULT, as is usually reported for all
 // I/O errors originating from MM in Linux.
 func translateIOError(ctx context.Context, err error) error {
@@ -114,6 +133,9 @@ func (mm *MemoryManager) CopyOut(ctx context.Context, addr hostarch.Addr, src []
 	if len(src) == 0 {
 		return 0, nil
 	}
+	if err := mm.checkRemoteIO(hostarch.AddrRangeSeqOf(ar), opts); err != nil {
+		return 0, err
+	}
 
 	// Do AddressSpace IO if applicable.
 	if mm.asioEnabled(opts) && len(src) < copyMapMinBytes {
@@ -162,6 +184,9 @@ func (mm *MemoryManager) CopyIn(ctx context.Context, addr hostarch.Addr, dst []b
 	if len(dst) == 0 {
 		return 0, nil
 	}
+	if err := mm.checkRemoteIO(hostarch.AddrRangeSeqOf(ar), opts); err != nil {
+		return 0, err
+	}
 
 	// Do AddressSpace IO if applicable.
 	if mm.asioEnabled(opts) && len(dst) < copyMapMinBytes {
@@ -210,6 +235,9 @@ func (mm *MemoryManager) ZeroOut(ctx context.Context, addr hostarch.Addr, toZero
 	if toZero == 0 {
 		return 0, nil
 	}
+	if err := mm.checkRemoteIO(hostarch.AddrRangeSeqOf(ar), opts); err != nil {
+		return 0, err
+	}
 
 	// Do AddressSpace IO if applicable.
 	if mm.asioEnabled(opts) && toZero < copyMapMinBytes {
@@ -251,6 +279,9 @@ func (mm *MemoryManager) CopyOutFrom(ctx context.Context, ars hostarch.AddrRange
 	if ars.NumBytes() == 0 {
 		return 0, nil
 	}
+	if err := mm.checkRemoteIO(ars, opts); err != nil {
+		return 0, err
+	}
 
 	// Do AddressSpace IO if applicable.
 	if mm.asioEnabled(opts) && ars.NumBytes() < rwMapMinBytes {
@@ -296,6 +327,9 @@ func (mm *MemoryManager) CopyInTo(ctx context.Context, ars hostarch.AddrRangeSeq
 	if ars.NumBytes() == 0 {
 		return 0, nil
 	}
+	if err := mm.checkRemoteIO(ars, opts); err != nil {
+		return 0, err
+	}
 
 	// Do AddressSpace IO if applicable.
 	if mm.asioEnabled(opts) && ars.NumBytes() < rwMapMinBytes {
@@ -17,6 +17,7 @@ package mm
 import (
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
@@ -123,6 +124,50 @@ func TestDataASUpdates(t *testing.T) {
 	}
 }
 
+func (mm *MemoryManager) realLockedAS() uint64 {
+	var sz uint64
+	for seg := mm.vmas.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.ValuePtr().mlockMode != memmap.MLockNone {
+			sz += uint64(seg.Range().Length())
+		}
+	}
+	return sz
+}
+
+func TestLockedASUpdates(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   4 * hostarch.PageSize,
+		Private:  true,
+		Perms:    hostarch.ReadWrite,
+		MaxPerms: hostarch.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if err := mm.MLock(ctx, addr, 3*hostarch.PageSize, memmap.MLockLazy); err != nil {
+		t.Fatalf("MLock got err %v want nil", err)
+	}
+	if got, want := mm.LockedSize(), uint64(3*hostarch.PageSize); got != want {
+		t.Fatalf("LockedSize got %v want %v", got, want)
+	}
+
+	mm.MUnmap(ctx, addr, hostarch.PageSize)
+	if got, want := mm.LockedSize(), mm.realLockedAS(); got != want {
+		t.Fatalf("lockedAS believes %v bytes are locked; %v bytes are actually locked", got, want)
+	}
+
+	if err := mm.MLock(ctx, addr+hostarch.PageSize, 3*hostarch.PageSize, memmap.MLockNone); err != nil {
+		t.Fatalf("MLock(MLockNone) got err %v want nil", err)
+	}
+	if got := mm.LockedSize(); got != 0 {
+		t.Fatalf("LockedSize got %v want 0", got)
+	}
+}
+
 func TestBrkDataLimitUpdates(t *testing.T) {
 	limitSet := limits.NewLimitSet()
 	limitSet.Set(limits.Data, limits.Limit{}, true /* privileged */) // zero RLIMIT_DATA
@@ -272,3 +317,72 @@ func TestAIOLookupAfterDestroy(t *testing.T) {
 		t.Errorf("AIOContext found even after AIOContext manager is destroyed")
 	}
 }
+
+// TestAIORing tests that completions are visible in, and can be consumed
+// from, the application's mapping of the AIO ring.
+func TestAIORing(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	const events = 2
+	id, err := mm.NewAIOContext(ctx, events)
+	if err != nil {
+		t.Fatalf("mm.NewAIOContext got err %v want nil", err)
+	}
+	aioCtx, ok := mm.LookupAIOContext(ctx, id)
+	if !ok {
+		t.Fatalf("AIOContext not found")
+	}
+
+	for i := 0; i < events; i++ {
+		if err := aioCtx.Prepare(); err != nil {
+			t.Fatalf("aioCtx.Prepare got err %v want nil", err)
+		}
+	}
+	if err := aioCtx.Prepare(); !linuxerr.Equals(linuxerr.EAGAIN, err) {
+		t.Fatalf("aioCtx.Prepare got err %v want EAGAIN", err)
+	}
+	aioCtx.FinishRequest(&linux.IOEvent{Data: 1})
+	aioCtx.FinishRequest(&linux.IOEvent{Data: 2})
+
+	cc := &usermem.IOCopyContext{Ctx: ctx, IO: mm}
+	var ring linux.AIORing
+	if _, err := ring.CopyIn(cc, hostarch.Addr(id)); err != nil {
+		t.Fatalf("ring.CopyIn got err %v want nil", err)
+	}
+	if ring.Magic != linux.AIO_RING_MAGIC || ring.HeaderLength != linux.AIORingSize {
+		t.Fatalf("got ring header %+v, want magic %#x and header length %d", ring, linux.AIO_RING_MAGIC, linux.AIORingSize)
+	}
+	if ring.Nr <= events {
+		t.Fatalf("got ring.Nr %d, want > %d", ring.Nr, events)
+	}
+	if ring.Head != 0 || ring.Tail != events {
+		t.Fatalf("got ring head %d tail %d, want head 0 tail %d", ring.Head, ring.Tail, events)
+	}
+	var ev linux.IOEvent
+	if _, err := ev.CopyIn(cc, hostarch.Addr(id)+linux.AIORingSize); err != nil {
+		t.Fatalf("ev.CopyIn got err %v want nil", err)
+	}
+	if ev.Data != 1 {
+		t.Errorf("got first event data %d, want 1", ev.Data)
+	}
+
+	// Consume the first event from "userspace" by advancing head.
+	ring.Head = 1
+	if _, err := ring.CopyOut(cc, hostarch.Addr(id)); err != nil {
+		t.Fatalf("ring.CopyOut got err %v want nil", err)
+	}
+	if err := aioCtx.Prepare(); err != nil {
+		t.Fatalf("aioCtx.Prepare after consuming event got err %v want nil", err)
+	}
+	aioCtx.CancelPendingRequest()
+
+	ev, ok = aioCtx.PopRequest()
+	if !ok || ev.Data != 2 {
+		t.Fatalf("aioCtx.PopRequest got (%+v, %t), want event with data 2", ev, ok)
+	}
+	if _, ok := aioCtx.PopRequest(); ok {
+		t.Errorf("aioCtx.PopRequest got event from empty ring")
+	}
+}
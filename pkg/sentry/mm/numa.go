@@ -0,0 +1,141 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"math/bits"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+// contextID is this package's type for context.Context.Value keys.
+type contextID int
+
+const (
+	// CtxNUMAPolicy is a Context.Value key for the NUMAPolicy that applies to
+	// memory allocated on behalf of the context, in the absence of a vma
+	// policy set by mbind(2).
+	CtxNUMAPolicy contextID = iota
+
+	// CtxNUMALocalNode is a Context.Value key for the NUMA node (as a uint)
+	// that is local to the CPU on which the context is running.
+	CtxNUMALocalNode
+)
+
+// NUMAPolicy is a NUMA memory policy, as set by set_mempolicy(2).
+//
+// +stateify savable
+type NUMAPolicy struct {
+	// Mode is the policy mode, possibly including mode flags.
+	Mode linux.NumaPolicy
+
+	// Nodemask is the set of nodes associated with the policy.
+	Nodemask uint64
+}
+
+// numaPolicyFromContext returns the NUMAPolicy used by ctx, or a policy with
+// mode MPOL_DEFAULT if no such policy exists.
+//
+// Since it is called with MemoryManager.activeMu locked, implementations of
+// Context.Value(CtxNUMAPolicy) must not take locks ordered before activeMu.
+func numaPolicyFromContext(ctx context.Context) NUMAPolicy {
+	if v := ctx.Value(CtxNUMAPolicy); v != nil {
+		return v.(NUMAPolicy)
+	}
+	return NUMAPolicy{Mode: linux.MPOL_DEFAULT}
+}
+
+// numaLocalNodeFromContext returns the NUMA node local to ctx, or 0 if no such
+// node is known.
+func numaLocalNodeFromContext(ctx context.Context) uint {
+	if v := ctx.Value(CtxNUMALocalNode); v != nil {
+		return v.(uint)
+	}
+	return 0
+}
+
+// numaPolicyLocked returns the NUMA policy that governs allocations for the
+// given vma.
+func numaPolicyLocked(ctx context.Context, vma *vma) NUMAPolicy {
+	if vma.numaPolicy&^linux.MPOL_MODE_FLAGS != linux.MPOL_DEFAULT {
+		return NUMAPolicy{Mode: vma.numaPolicy, Nodemask: vma.numaNodemask}
+	}
+	return numaPolicyFromContext(ctx)
+}
+
+// numaInterleaving returns true if allocations for the given vma are
+// interleaved between NUMA nodes, in which case each allocation must be
+// limited to a single page (or huge page).
+func (mm *MemoryManager) numaInterleaving(ctx context.Context, vma *vma) bool {
+	if mm.mf.NUMANodes() <= 1 {
+		return false
+	}
+	return numaPolicyLocked(ctx, vma).Mode&^linux.MPOL_MODE_FLAGS == linux.MPOL_INTERLEAVE
+}
+
+// numaAllocNodemask returns the pgalloc.AllocOpts.NUMANodemask that should be
+// used for an allocation backing the given address in the given vma.
+func (mm *MemoryManager) numaAllocNodemask(ctx context.Context, vma *vma, addr hostarch.Addr, huge bool) uint64 {
+	if mm.mf.NUMANodes() <= 1 {
+		return 0
+	}
+	policy := numaPolicyLocked(ctx, vma)
+	switch policy.Mode &^ linux.MPOL_MODE_FLAGS {
+	case linux.MPOL_BIND:
+		return policy.Nodemask
+	case linux.MPOL_PREFERRED:
+		if policy.Nodemask != 0 {
+			return uint64(1) << bits.TrailingZeros64(policy.Nodemask)
+		}
+	case linux.MPOL_INTERLEAVE:
+		if n := bits.OnesCount64(policy.Nodemask); n != 0 {
+			// Like Linux's interleave_nid(), select nodes by page offset so
+			// that the result is independent of the order of faults.
+			shift := uint(hostarch.PageShift)
+			if huge {
+				shift = hostarch.HugePageShift
+			}
+			idx := int((uint64(addr) >> shift) % uint64(n))
+			mask := policy.Nodemask
+			for ; idx > 0; idx-- {
+				mask &= mask - 1
+			}
+			return uint64(1) << bits.TrailingZeros64(mask)
+		}
+	}
+	// MPOL_DEFAULT and MPOL_LOCAL allocate from the local node.
+	return uint64(1) << numaLocalNodeFromContext(ctx)
+}
+
+// NUMANodeOf returns the NUMA node whose memory backs the page containing
+// addr, which must already be mapped by a pma. If no such node exists,
+// NUMANodeOf returns false.
+func (mm *MemoryManager) NUMANodeOf(addr hostarch.Addr) (uint, bool) {
+	mm.activeMu.RLock()
+	defer mm.activeMu.RUnlock()
+	pseg := mm.pmas.FindSegment(addr)
+	if !pseg.Ok() {
+		return 0, false
+	}
+	pma := pseg.ValuePtr()
+	if pma.file != mm.mf {
+		// Only the MemoryFile distinguishes between NUMA nodes.
+		return 0, true
+	}
+	off := pma.off + uint64(addr-pseg.Start())
+	return uint(mm.mf.NUMANodeOf(off)), true
+}
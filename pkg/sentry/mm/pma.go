@@ -260,12 +260,22 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 					// Don't back stacks with huge pages due to low utilization
 					// and because they're often fragmented by copy-on-write.
 					huge := mm.mf.HugepagesEnabled() && allocAR.IsHugePageAligned() && !vma.growsDown && !vma.isStack
+					if mm.numaInterleaving(ctx, vma) {
+						// Each page (or huge page) may need to come from a
+						// different NUMA node.
+						if huge {
+							allocAR.End = allocAR.Start + hostarch.HugePageSize
+						} else {
+							allocAR.End = allocAR.Start + hostarch.PageSize
+						}
+					}
 					allocOpts := pgalloc.AllocOpts{
-						Kind:    usage.Anonymous,
-						MemCgID: memCgID,
-						Mode:    pgalloc.AllocateUncommitted,
-						Huge:    huge,
-						Dir:     allocDir,
+						Kind:         usage.Anonymous,
+						MemCgID:      memCgID,
+						Mode:         pgalloc.AllocateUncommitted,
+						Huge:         huge,
+						Dir:          allocDir,
+						NUMANodemask: mm.numaAllocNodemask(ctx, vma, allocAR.Start, huge),
 					}
 					// If the allocation is hugepage-backed and
 					// callerIndirectCommit is true, the caller will commit every
@@ -411,14 +421,22 @@ func (mm *MemoryManager) getPMAsInternalLocked(ctx context.Context, vseg vmaIter
 					}
 					// Copy contents.
 					huge := mm.mf.HugepagesEnabled() && copyAR.IsHugePageAligned()
+					if mm.numaInterleaving(ctx, vma) {
+						if huge {
+							copyAR.End = copyAR.Start + hostarch.HugePageSize
+						} else {
+							copyAR.End = copyAR.Start + hostarch.PageSize
+						}
+					}
 					reader := safemem.BlockSeqReader{Blocks: mm.internalMappingsLocked(pseg, copyAR)}
 					fr, err := mm.mf.Allocate(uint64(copyAR.Length()), pgalloc.AllocOpts{
-						Kind:       usage.Anonymous,
-						MemCgID:    memCgID,
-						Mode:       pgalloc.AllocateAndWritePopulate,
-						Huge:       huge,
-						Dir:        allocDir,
-						ReaderFunc: reader.ReadToBlocks,
+						Kind:         usage.Anonymous,
+						MemCgID:      memCgID,
+						Mode:         pgalloc.AllocateAndWritePopulate,
+						Huge:         huge,
+						Dir:          allocDir,
+						ReaderFunc:   reader.ReadToBlocks,
+						NUMANodemask: mm.numaAllocNodemask(ctx, vma, copyAR.Start, huge),
 					})
 					if _, ok := err.(safecopy.BusError); ok {
 						// If we got SIGBUS during the copy, deliver SIGBUS to
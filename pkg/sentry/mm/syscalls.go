@@ -956,21 +956,23 @@ func (mm *MemoryManager) MLockAll(ctx context.Context, opts MLockAllOpts) error
 	mm.mappingMu.Lock()
 	// Can't defer mm.mappingMu.Unlock(); see below.
 
-	if opts.Current {
-		if opts.Mode != memmap.MLockNone {
-			// Check against RLIMIT_MEMLOCK.
-			if creds := auth.CredentialsFromContext(ctx); !creds.HasCapabilityIn(linux.CAP_IPC_LOCK, creds.UserNamespace.Root()) {
-				mlockLimit := limits.FromContext(ctx).Get(limits.MemoryLocked).Cur
-				if mlockLimit == 0 {
-					mm.mappingMu.Unlock()
-					return linuxerr.EPERM
-				}
-				if uint64(mm.vmas.Span()) > mlockLimit {
-					mm.mappingMu.Unlock()
-					return linuxerr.ENOMEM
-				}
+	if opts.Mode != memmap.MLockNone {
+		// Check against RLIMIT_MEMLOCK. As in Linux, a zero limit prevents
+		// MCL_FUTURE as well as MCL_CURRENT.
+		if creds := auth.CredentialsFromContext(ctx); !creds.HasCapabilityIn(linux.CAP_IPC_LOCK, creds.UserNamespace.Root()) {
+			mlockLimit := limits.FromContext(ctx).Get(limits.MemoryLocked).Cur
+			if mlockLimit == 0 {
+				mm.mappingMu.Unlock()
+				return linuxerr.EPERM
+			}
+			if opts.Current && uint64(mm.vmas.Span()) > mlockLimit {
+				mm.mappingMu.Unlock()
+				return linuxerr.ENOMEM
 			}
 		}
+	}
+
+	if opts.Current {
 		for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
 			vma := vseg.ValuePtr()
 			prevMode := vma.mlockMode
@@ -1360,6 +1362,14 @@ func (mm *MemoryManager) VirtualMemorySizeRange(ar hostarch.AddrRange) uint64 {
 	return uint64(mm.vmas.SpanRange(ar))
 }
 
+// LockedSize returns the combined length in bytes of all mlocked mappings in
+// mm.
+func (mm *MemoryManager) LockedSize() uint64 {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	return mm.lockedAS
+}
+
 // ResidentSetSize returns the value advertised as mm's RSS in bytes.
 func (mm *MemoryManager) ResidentSetSize() uint64 {
 	mm.activeMu.RLock()
@@ -0,0 +1,154 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"math/bits"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+)
+
+// maxNUMANodes is the maximum number of NUMA nodes supported by a
+// MemoryFile, limited by the width of AllocOpts.NUMANodemask.
+const maxNUMANodes = 64
+
+// NUMANodes returns the number of NUMA nodes presented by f.
+func (f *MemoryFile) NUMANodes() int {
+	if n := len(f.opts.NUMAHostNodes); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// numaEnabled returns true if f distinguishes between NUMA nodes.
+func (f *MemoryFile) numaEnabled() bool {
+	return len(f.opts.NUMAHostNodes) > 1
+}
+
+// numaNodeForNewChunks returns the NUMA node that should back chunks created
+// to satisfy an allocation with the given AllocOpts.NUMANodemask.
+func (f *MemoryFile) numaNodeForNewChunks(nodemask uint64) int {
+	if !f.numaEnabled() {
+		return 0
+	}
+	nodemask &= f.numaNodemaskAll()
+	if nodemask == 0 {
+		return 0
+	}
+	return bits.TrailingZeros64(nodemask)
+}
+
+// numaNodemaskAll returns a nodemask containing all nodes presented by f.
+func (f *MemoryFile) numaNodemaskAll() uint64 {
+	n := f.NUMANodes()
+	if n == maxNUMANodes {
+		return ^uint64(0)
+	}
+	return (uint64(1) << n) - 1
+}
+
+// numaNodeAllowed returns true if memory on the given node may be used to
+// satisfy alloc.
+func (f *MemoryFile) numaNodeAllowed(alloc *allocState, node int) bool {
+	nodemask := alloc.opts.NUMANodemask & f.numaNodemaskAll()
+	return nodemask == 0 || nodemask&(uint64(1)<<node) != 0
+}
+
+// fitLocked returns a subrange of r of length alloc.length that may be used
+// to satisfy alloc, preferring lower offsets if alloc.opts.Dir == BottomUp
+// and higher offsets otherwise. If no such subrange exists, fitLocked returns
+// false.
+//
+// Preconditions:
+//   - f.mu must be locked.
+//   - r.Length() >= alloc.length.
+//   - r is contained by existing chunks.
+func (f *MemoryFile) fitLocked(r memmap.FileRange, alloc *allocState) (memmap.FileRange, bool) {
+	if !f.numaEnabled() || alloc.opts.NUMANodemask&f.numaNodemaskAll() == 0 {
+		if alloc.opts.Dir == BottomUp {
+			return memmap.FileRange{r.Start, r.Start + alloc.length}, true
+		}
+		return memmap.FileRange{r.End - alloc.length, r.End}, true
+	}
+
+	// Find a run of contiguous chunks backed by allowed NUMA nodes, whose
+	// intersection with r is large enough to satisfy alloc.
+	chunks := f.chunksLoad()
+	if alloc.opts.Dir == BottomUp {
+		runStart := r.Start
+		for i := r.Start / chunkSize; i*chunkSize < r.End; i++ {
+			chunkFR := memmap.FileRange{i * chunkSize, (i + 1) * chunkSize}.Intersect(r)
+			if !f.numaNodeAllowed(alloc, chunks[i].node) {
+				runStart = chunkFR.End
+				continue
+			}
+			if chunkFR.End-runStart >= alloc.length {
+				return memmap.FileRange{runStart, runStart + alloc.length}, true
+			}
+		}
+		return memmap.FileRange{}, false
+	}
+	runEnd := r.End
+	for i := (r.End - 1) / chunkSize; i*chunkSize+chunkSize > r.Start; i-- {
+		chunkFR := memmap.FileRange{i * chunkSize, (i + 1) * chunkSize}.Intersect(r)
+		if !f.numaNodeAllowed(alloc, chunks[i].node) {
+			runEnd = chunkFR.Start
+		} else if runEnd-chunkFR.Start >= alloc.length {
+			return memmap.FileRange{runEnd - alloc.length, runEnd}, true
+		}
+		if i == 0 {
+			break
+		}
+	}
+	return memmap.FileRange{}, false
+}
+
+// NUMANodeOf returns the NUMA node, as visible to the application, whose
+// memory backs the page at offset off in f.
+//
+// Preconditions: off must be an allocated offset.
+func (f *MemoryFile) NUMANodeOf(off uint64) int {
+	chunks := f.chunksLoad()
+	if i := off / chunkSize; i < uint64(len(chunks)) {
+		return chunks[i].node
+	}
+	return 0
+}
+
+// bindChunkMapping requests that the host back the given chunk mapping with
+// memory from the host NUMA node corresponding to the given node. Since a
+// memory policy applied to a shared mapping of a memory-backed file is stored
+// in the file itself, this also affects application mappings of the same
+// range.
+func (f *MemoryFile) bindChunkMapping(addr, length uintptr, node int) {
+	if !f.numaEnabled() {
+		return
+	}
+	if node >= len(f.opts.NUMAHostNodes) {
+		// This can happen after restore onto a host with fewer NUMA nodes.
+		log.Warningf("Not binding MemoryFile chunk mapping at %#x to NUMA node %d: only %d nodes configured", addr, node, len(f.opts.NUMAHostNodes))
+		return
+	}
+	hostNode := f.opts.NUMAHostNodes[node]
+	nodemask := make([]uint64, hostNode/64+1)
+	nodemask[hostNode/64] = uint64(1) << (hostNode % 64)
+	if err := mbind(addr, length, linux.MPOL_BIND, nodemask); err != nil {
+		// Log this failure but continue; allocations will simply lose
+		// locality.
+		log.Warningf("mbind(%#x, %d, MPOL_BIND, host node %d) failed: %v", addr, length, hostNode, err)
+	}
+}
@@ -221,6 +221,13 @@ type chunkInfo struct {
 	//
 	// huge is immutable.
 	huge bool
+
+	// node is the NUMA node, as visible to the application, whose memory
+	// backs this chunk. node is always 0 if NUMA emulation is disabled; see
+	// MemoryFileOpts.NUMAHostNodes.
+	//
+	// node is immutable.
+	node int
 }
 
 func (f *MemoryFile) chunksLoad() []chunkInfo {
@@ -372,6 +379,13 @@ type MemoryFileOpts struct {
 	// If DisableMemoryAccounting is true, memory usage observed by the
 	// MemoryFile will not be reported in usage.MemoryAccounting.
 	DisableMemoryAccounting bool
+
+	// NUMAHostNodes maps each NUMA node visible to the application (the index
+	// into NUMAHostNodes) to the host NUMA node whose memory backs it. If
+	// NUMAHostNodes contains fewer than two elements, NUMA emulation is
+	// disabled: the MemoryFile presents a single node, and
+	// AllocOpts.NUMANodemask is ignored.
+	NUMAHostNodes []int
 }
 
 // DelayedEvictionType is the type of MemoryFileOpts.DelayedEviction.
@@ -419,6 +433,9 @@ func NewMemoryFile(file *os.File, opts MemoryFileOpts) (*MemoryFile, error) {
 	default:
 		return nil, fmt.Errorf("invalid MemoryFileOpts.DelayedEviction: %v", opts.DelayedEviction)
 	}
+	if len(opts.NUMAHostNodes) > maxNUMANodes {
+		return nil, fmt.Errorf("too many NUMA nodes: got %d, max %d", len(opts.NUMAHostNodes), maxNUMANodes)
+	}
 
 	// Truncate the file to 0 bytes first to ensure that it's empty.
 	if err := file.Truncate(0); err != nil {
@@ -561,6 +578,11 @@ type AllocOpts struct {
 	// Dir indicates the direction in which offsets are allocated.
 	Dir Direction
 
+	// NUMANodemask is a bitmask of the NUMA nodes from which the allocation
+	// may be made. If NUMANodemask is 0, or NUMA emulation is disabled, the
+	// allocation may be made from any node.
+	NUMANodemask uint64
+
 	// If ReaderFunc is provided, the allocated memory is filled by calling it
 	// repeatedly until either length bytes are read or a non-nil error is
 	// returned. It returns the allocated memory, truncated down to the nearest
@@ -623,6 +645,7 @@ type allocState struct {
 	willCommit bool // either us or our caller
 	recycled   bool
 	huge       bool
+	node       int // NUMA node for new chunks
 }
 
 // Allocate returns a range of initially-zeroed pages of the given length, with
@@ -644,6 +667,7 @@ func (f *MemoryFile) Allocate(length uint64, opts AllocOpts) (memmap.FileRange,
 		opts:       opts,
 		willCommit: opts.Mode != AllocateUncommitted,
 		huge:       opts.Huge && f.opts.ExpectHugepages,
+		node:       f.numaNodeForNewChunks(opts.NUMANodemask),
 	}
 
 	fr, err := f.findAllocatableAndMarkUsed(&alloc)
@@ -780,19 +804,19 @@ func (f *MemoryFile) findAllocatableAndMarkUsed(alloc *allocState) (fr memmap.Fi
 		} else {
 			uwgap = unwaste.LastLargeEnoughGap(alloc.length)
 		}
-		if uwgap.Ok() {
-			alloc.recycled = true
+		for uwgap.Ok() {
+			var ok bool
+			if fr, ok = f.fitLocked(uwgap.Range(), alloc); ok {
+				break
+			}
 			if alloc.opts.Dir == BottomUp {
-				fr = memmap.FileRange{
-					Start: uwgap.Start(),
-					End:   uwgap.Start() + alloc.length,
-				}
+				uwgap = uwgap.NextLargeEnoughGap(alloc.length)
 			} else {
-				fr = memmap.FileRange{
-					Start: uwgap.End() - alloc.length,
-					End:   uwgap.End(),
-				}
+				uwgap = uwgap.PrevLargeEnoughGap(alloc.length)
 			}
+		}
+		if uwgap.Ok() {
+			alloc.recycled = true
 			unwaste.Insert(uwgap, fr, unwasteInfo{})
 			// Update reference count for these pages from 0 to 1.
 			unfree.MutateFullRange(fr, func(ufseg unfreeIterator) bool {
@@ -838,6 +862,17 @@ retryFree:
 	} else {
 		ufgap = unfree.LastLargeEnoughGap(alloc.length)
 	}
+	for ufgap.Ok() {
+		var ok bool
+		if fr, ok = f.fitLocked(ufgap.Range(), alloc); ok {
+			break
+		}
+		if alloc.opts.Dir == BottomUp {
+			ufgap = ufgap.NextLargeEnoughGap(alloc.length)
+		} else {
+			ufgap = ufgap.PrevLargeEnoughGap(alloc.length)
+		}
+	}
 	if !ufgap.Ok() {
 		// Extend the file to create more chunks.
 		err = f.extendChunksLocked(alloc)
@@ -847,17 +882,6 @@ retryFree:
 		// Retry the allocation using new chunks.
 		goto retryFree
 	}
-	if alloc.opts.Dir == BottomUp {
-		fr = memmap.FileRange{
-			Start: ufgap.Start(),
-			End:   ufgap.Start() + alloc.length,
-		}
-	} else {
-		fr = memmap.FileRange{
-			Start: ufgap.End() - alloc.length,
-			End:   ufgap.End(),
-		}
-	}
 	unfree.Insert(ufgap, fr, unfreeInfo{refs: 1})
 	// These pages should all be known-decommitted; mark them
 	// unknown-commitment, since they can be concurrently committed by the
@@ -890,7 +914,7 @@ func (f *MemoryFile) extendChunksLocked(alloc *allocState) error {
 	// Determine how many chunks we need to satisfy alloc.
 	tail := uint64(0)
 	if oldNrChunks != 0 {
-		if lastChunk := oldChunks[oldNrChunks-1]; lastChunk.huge == alloc.huge {
+		if lastChunk := oldChunks[oldNrChunks-1]; lastChunk.huge == alloc.huge && lastChunk.node == alloc.node {
 			// We can use free pages at the end of the current last chunk.
 			if ufgap := unfree.FindGap(oldFileSize - 1); ufgap.Ok() {
 				tail = ufgap.Range().Length()
@@ -929,6 +953,7 @@ func (f *MemoryFile) extendChunksLocked(alloc *allocState) error {
 		}
 		mapStart = m
 		f.madviseChunkMapping(mapStart, uintptr(incFileSize), alloc.huge)
+		f.bindChunkMapping(mapStart, uintptr(incFileSize), alloc.node)
 	}
 
 	// Update chunk state.
@@ -937,6 +962,7 @@ func (f *MemoryFile) extendChunksLocked(alloc *allocState) error {
 	m := mapStart
 	for i := oldNrChunks; i < newNrChunks; i++ {
 		newChunks[i].huge = alloc.huge
+		newChunks[i].node = alloc.node
 		if f.file != nil {
 			newChunks[i].mapping = m
 			m += chunkSize
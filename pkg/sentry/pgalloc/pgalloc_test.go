@@ -47,12 +47,14 @@ func TestFindAllocatable(t *testing.T) {
 		name string
 		// Initial state:
 		chunkHuge []bool
+		chunkNode []int // if non-nil, enables NUMA emulation with 2 nodes
 		existing  []existingSegment
 		// Allocation parameters:
-		length  uint64
-		huge    bool
-		recycle bool
-		dir     Direction
+		length   uint64
+		huge     bool
+		recycle  bool
+		dir      Direction
+		nodemask uint64
 		// Expected outcome:
 		want uint64
 	}{
@@ -512,6 +514,44 @@ func TestFindAllocatable(t *testing.T) {
 			dir:     TopDown,
 			want:    chunkSize - 2*hugepage,
 		},
+		{
+			name:      "NUMA bottom-up small allocation skips chunks on other nodes",
+			chunkHuge: []bool{false, false, false},
+			chunkNode: []int{0, 1, 0},
+			length:    page,
+			nodemask:  1 << 1,
+			want:      chunkSize,
+		},
+		{
+			name:      "NUMA top-down small allocation skips chunks on other nodes",
+			chunkHuge: []bool{false, false, false},
+			chunkNode: []int{0, 1, 0},
+			existing: []existingSegment{
+				{2*chunkSize - page, 2 * chunkSize, existingUsed},
+			},
+			length:   page,
+			dir:      TopDown,
+			nodemask: 1 << 1,
+			want:     2*chunkSize - 2*page,
+		},
+		{
+			name:      "NUMA allocation does not span chunks on different nodes",
+			chunkHuge: []bool{false, false, false},
+			chunkNode: []int{0, 1, 1},
+			existing: []existingSegment{
+				{0, chunkSize - page, existingUsed},
+			},
+			length:   2 * page,
+			nodemask: 1 << 0,
+			want:     3 * chunkSize,
+		},
+		{
+			name:      "NUMA allocation with empty nodemask uses any node",
+			chunkHuge: []bool{false, false},
+			chunkNode: []int{1, 0},
+			length:    page,
+			want:      0,
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			// Build the fake MemoryFile.
@@ -521,10 +561,16 @@ func TestFindAllocatable(t *testing.T) {
 					DisableMemoryAccounting: true,
 				},
 			}
+			if test.chunkNode != nil {
+				f.opts.NUMAHostNodes = []int{0, 1}
+			}
 			f.initFields()
 			chunks := make([]chunkInfo, len(test.chunkHuge))
 			for i, huge := range test.chunkHuge {
 				chunks[i].huge = huge
+				if test.chunkNode != nil {
+					chunks[i].node = test.chunkNode[i]
+				}
 				chunkFR := memmap.FileRange{uint64(i) * chunkSize, uint64(i+1) * chunkSize}
 				if huge {
 					f.unfreeHuge.RemoveRange(chunkFR)
@@ -561,8 +607,9 @@ func TestFindAllocatable(t *testing.T) {
 			alloc := allocState{
 				length: test.length,
 				opts: AllocOpts{
-					Huge: test.huge,
-					Dir:  test.dir,
+					Huge:         test.huge,
+					Dir:          test.dir,
+					NUMANodemask: test.nodemask,
 				},
 				huge: test.huge,
 			}
@@ -18,6 +18,7 @@ import (
 	"unsafe"
 
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 )
 
@@ -44,3 +45,20 @@ func sliceFromIovec(iov unix.Iovec) []byte {
 func canMergeIovecAndSlice(iov unix.Iovec, bs []byte) bool {
 	return uintptr(unsafe.Pointer(iov.Base))+uintptr(iov.Len) == uintptr(unsafe.Pointer(unsafe.SliceData(bs)))
 }
+
+// mbind applies the given host memory policy to the given range of the
+// sentry's address space.
+func mbind(addr, length uintptr, mode linux.NumaPolicy, nodemask []uint64) error {
+	if _, _, errno := unix.Syscall6(
+		unix.SYS_MBIND,
+		addr,
+		length,
+		uintptr(mode),
+		uintptr(unsafe.Pointer(&nodemask[0])),
+		// mm/mempolicy.c:get_nodes() uses maxnode-1 as the number of bits.
+		uintptr(len(nodemask)*64+1),
+		0 /* flags */); errno != 0 {
+		return errno
+	}
+	return nil
+}
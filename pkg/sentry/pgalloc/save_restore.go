@@ -322,6 +322,7 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r io.Reader, opts *LoadOpts)
 			for i := range chunks {
 				chunk := &chunks[i]
 				f.madviseChunkMapping(chunk.mapping, chunkSize, chunk.huge)
+				f.bindChunkMapping(chunk.mapping, chunkSize, chunk.node)
 				madviseEnd.Add(chunkSize)
 				select {
 				case madviseChan <- struct{}{}:
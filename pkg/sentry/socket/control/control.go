@@ -207,6 +207,17 @@ func PackTimestamp(t *kernel.Task, timestamp time.Time, buf []byte) []byte {
 	)
 }
 
+// PackTimestamping packs a SCM_TIMESTAMPING socket control message.
+func PackTimestamping(t *kernel.Task, timestamping *linux.ScmTimestamping, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_SOCKET,
+		linux.SCM_TIMESTAMPING,
+		t.Arch().Width(),
+		timestamping,
+	)
+}
+
 // PackInq packs a TCP_INQ socket control message.
 func PackInq(t *kernel.Task, inq int32, buf []byte) []byte {
 	return putCmsgStruct(
@@ -313,6 +324,39 @@ func PackSockExtendedErr(t *kernel.Task, sockErr linux.SockErrCMsg, buf []byte)
 	)
 }
 
+// PackSCTPRcvInfo packs an SCTP_RCVINFO socket control message.
+func PackSCTPRcvInfo(t *kernel.Task, info *linux.SCTPRcvInfo, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_SCTP,
+		linux.SCTP_RCVINFO,
+		t.Arch().Width(),
+		info,
+	)
+}
+
+// PackSCTPSndRcvInfo packs an SCTP_SNDRCV socket control message.
+func PackSCTPSndRcvInfo(t *kernel.Task, info *linux.SCTPSndRcvInfo, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_SCTP,
+		linux.SCTP_SNDRCV,
+		t.Arch().Width(),
+		info,
+	)
+}
+
+// PackUDPGRO packs a UDP_GRO socket control message.
+func PackUDPGRO(t *kernel.Task, size int32, buf []byte) []byte {
+	return putCmsgStruct(
+		buf,
+		linux.SOL_UDP,
+		linux.UDP_GRO,
+		t.Arch().Width(),
+		primitive.AllocateInt32(size),
+	)
+}
+
 // PackControlMessages packs control messages into the given buffer.
 //
 // We skip control messages specific to Unix domain sockets.
@@ -324,6 +368,10 @@ func PackControlMessages(t *kernel.Task, cmsgs socket.ControlMessages, buf []byt
 		buf = PackTimestamp(t, cmsgs.IP.Timestamp, buf)
 	}
 
+	if cmsgs.IP.HasTimestamping {
+		buf = PackTimestamping(t, &cmsgs.IP.Timestamping, buf)
+	}
+
 	if cmsgs.IP.HasInq {
 		// In Linux, TCP_CM_INQ is added after SO_TIMESTAMP.
 		buf = PackInq(t, cmsgs.IP.Inq, buf)
@@ -361,6 +409,18 @@ func PackControlMessages(t *kernel.Task, cmsgs socket.ControlMessages, buf []byt
 		buf = PackSockExtendedErr(t, cmsgs.IP.SockErr, buf)
 	}
 
+	if cmsgs.IP.HasSCTPSndRcvInfo {
+		buf = PackSCTPSndRcvInfo(t, &cmsgs.IP.SCTPSndRcvInfo, buf)
+	}
+
+	if cmsgs.IP.HasSCTPRcvInfo {
+		buf = PackSCTPRcvInfo(t, &cmsgs.IP.SCTPRcvInfo, buf)
+	}
+
+	if cmsgs.IP.HasUDPGROSize {
+		buf = PackUDPGRO(t, cmsgs.IP.UDPGROSize, buf)
+	}
+
 	return buf
 }
 
@@ -378,6 +438,10 @@ func CmsgsSpace(t *kernel.Task, cmsgs socket.ControlMessages) int {
 		space += cmsgSpace(t, linux.SizeOfTimeval)
 	}
 
+	if cmsgs.IP.HasTimestamping {
+		space += cmsgSpace(t, linux.SizeOfScmTimestamping)
+	}
+
 	if cmsgs.IP.HasInq {
 		space += cmsgSpace(t, linux.SizeOfControlMessageInq)
 	}
@@ -414,6 +478,18 @@ func CmsgsSpace(t *kernel.Task, cmsgs socket.ControlMessages) int {
 		space += cmsgSpace(t, cmsgs.IP.SockErr.SizeBytes())
 	}
 
+	if cmsgs.IP.HasSCTPSndRcvInfo {
+		space += cmsgSpace(t, linux.SizeOfSCTPSndRcvInfo)
+	}
+
+	if cmsgs.IP.HasSCTPRcvInfo {
+		space += cmsgSpace(t, linux.SizeOfSCTPRcvInfo)
+	}
+
+	if cmsgs.IP.HasUDPGROSize {
+		space += cmsgSpace(t, linux.SizeOfControlMessageUDPGRO)
+	}
+
 	return space
 }
 
@@ -482,6 +558,28 @@ func Parse(t *kernel.Task, socketOrEndpoint any, buf []byte, width uint) (socket
 				cmsgs.IP.Timestamp = ts.ToTime()
 				cmsgs.IP.HasTimestamp = true
 
+			case linux.SCM_TIMESTAMPING:
+				if length < linux.SizeOfControlMessageTimestamping {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				var flags primitive.Uint32
+				flags.UnmarshalUnsafe(buf)
+				// Only the transmit recording flags may be set per message.
+				if flags&^linux.SOF_TIMESTAMPING_TX_RECORD_MASK != 0 {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				cmsgs.IP.TXTimestamping = uint32(flags)
+				cmsgs.IP.HasTXTimestamping = true
+
+			case linux.SCM_TXTIME:
+				if length < linux.SizeOfControlMessageTXTime {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				var txTime primitive.Uint64
+				txTime.UnmarshalUnsafe(buf)
+				cmsgs.IP.TXTime = uint64(txTime)
+				cmsgs.IP.HasTXTime = true
+
 			default:
 				// Unknown message type.
 				return socket.ControlMessages{}, linuxerr.EINVAL
@@ -589,6 +687,39 @@ func Parse(t *kernel.Task, socketOrEndpoint any, buf []byte, width uint) (socket
 				errCmsg.UnmarshalBytes(buf)
 				cmsgs.IP.SockErr = &errCmsg
 
+			default:
+				return socket.ControlMessages{}, linuxerr.EINVAL
+			}
+		case linux.SOL_SCTP:
+			switch h.Type {
+			case linux.SCTP_SNDINFO:
+				if length < linux.SizeOfSCTPSndInfo {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				cmsgs.IP.HasSCTPSndInfo = true
+				cmsgs.IP.SCTPSndInfo.UnmarshalUnsafe(buf)
+
+			case linux.SCTP_SNDRCV:
+				if length < linux.SizeOfSCTPSndRcvInfo {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				cmsgs.IP.HasSCTPSndRcvInfo = true
+				cmsgs.IP.SCTPSndRcvInfo.UnmarshalUnsafe(buf)
+
+			default:
+				return socket.ControlMessages{}, linuxerr.EINVAL
+			}
+		case linux.SOL_UDP:
+			switch h.Type {
+			case linux.UDP_SEGMENT:
+				if length < linux.SizeOfControlMessageUDPSegment {
+					return socket.ControlMessages{}, linuxerr.EINVAL
+				}
+				var size primitive.Uint16
+				size.UnmarshalUnsafe(buf)
+				cmsgs.IP.HasUDPSegmentSize = true
+				cmsgs.IP.UDPSegmentSize = uint16(size)
+
 			default:
 				return socket.ControlMessages{}, linuxerr.EINVAL
 			}
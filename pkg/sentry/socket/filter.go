@@ -0,0 +1,85 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bpf"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// sockFprog is struct sock_fprog, from include/uapi/linux/filter.h, on 64-bit
+// architectures.
+//
+// +marshal
+type sockFprog struct {
+	// Len is the length of the program in BPF instructions.
+	Len uint16
+
+	_ [6]byte
+
+	// Filter is a user pointer to the instructions of the program.
+	Filter uint64
+}
+
+// Filter is a classic BPF program attached to a socket with SO_ATTACH_FILTER
+// or SO_ATTACH_REUSEPORT_CBPF.
+//
+// +stateify savable
+type Filter struct {
+	program bpf.Program
+}
+
+var _ tcpip.SocketFilter = (*Filter)(nil)
+
+// Run implements tcpip.SocketFilter.Run. As in Linux, a program that loads
+// data out of the bounds of pkt returns 0.
+func (f *Filter) Run(pkt []byte) uint32 {
+	ret, err := bpf.Exec[bpf.BigEndian](f.program, bpf.Input(pkt))
+	if err != nil {
+		return 0
+	}
+	return ret
+}
+
+// CopyInFilter reads the struct sock_fprog passed to setsockopt(2) in optVal,
+// copies the program it points to in from the task's memory and compiles it.
+func CopyInFilter(t *kernel.Task, optVal []byte) (*Filter, *syserr.Error) {
+	var fprog sockFprog
+	if len(optVal) < fprog.SizeBytes() {
+		return nil, syserr.ErrInvalidArgument
+	}
+	fprog.UnmarshalUnsafe(optVal)
+	if fprog.Len == 0 || fprog.Len > bpf.MaxInstructions {
+		return nil, syserr.ErrInvalidArgument
+	}
+	insns := make([]linux.BPFInstruction, int(fprog.Len))
+	if _, err := linux.CopyBPFInstructionSliceIn(t, hostarch.Addr(fprog.Filter), insns); err != nil {
+		return nil, syserr.FromError(err)
+	}
+	bpfInsns := make([]bpf.Instruction, len(insns))
+	for i, ins := range insns {
+		bpfInsns[i] = bpf.Instruction(ins)
+	}
+	program, err := bpf.Compile(bpfInsns, true /* optimize */)
+	if err != nil {
+		t.Debugf("Invalid socket filter: %v", err)
+		return nil, syserr.ErrInvalidArgument
+	}
+	return &Filter{program: program}, nil
+}
@@ -146,7 +146,7 @@ func extractRoutes(routeMsgs []syscall.NetlinkMessage) ([]inet.Route, error) {
 			DstLen:   ifRoute.DstLen,
 			SrcLen:   ifRoute.SrcLen,
 			TOS:      ifRoute.TOS,
-			Table:    ifRoute.Table,
+			Table:    uint32(ifRoute.Table),
 			Protocol: ifRoute.Protocol,
 			Scope:    ifRoute.Scope,
 			Type:     ifRoute.Type,
@@ -177,6 +177,17 @@ func extractRoutes(routeMsgs []syscall.NetlinkMessage) ([]inet.Route, error) {
 				var outputIF primitive.Int32
 				outputIF.UnmarshalUnsafe(attr.Value)
 				inetRoute.OutputInterface = int32(outputIF)
+			case unix.RTA_TABLE, unix.RTA_PRIORITY:
+				var v primitive.Uint32
+				if len(attr.Value) != v.SizeBytes() {
+					return nil, fmt.Errorf("RTM_GETROUTE returned RTM_NEWROUTE message with invalid attribute data length (%d bytes, expected %d bytes)", len(attr.Value), v.SizeBytes())
+				}
+				v.UnmarshalUnsafe(attr.Value)
+				if attr.Attr.Type == unix.RTA_TABLE {
+					inetRoute.Table = uint32(v)
+				} else {
+					inetRoute.Priority = uint32(v)
+				}
 			}
 		}
 
@@ -54,6 +54,10 @@ type Stack struct {
 	tcpRecvBufSize inet.TCPBufferSize
 	tcpSendBufSize inet.TCPBufferSize
 	tcpSACKEnabled bool
+	tcpECN         int32
+	tcpFastOpen    int32
+	tcpAvailableCC string
+	tcpCC          string
 	netDevFile     *os.File
 	netSNMPFile    *os.File
 	// allowedSocketTypes is the list of allowed socket types
@@ -98,6 +102,39 @@ func (s *Stack) Configure(allowRawSockets bool) error {
 		log.Warningf("Failed to read if TCP SACK if enabled, setting to true")
 	}
 
+	// Linux defaults to accepting ECN on incoming connections only.
+	s.tcpECN = 2
+	if ecn, err := os.ReadFile("/proc/sys/net/ipv4/tcp_ecn"); err == nil {
+		if v, err := strconv.ParseInt(strings.TrimSpace(string(ecn)), 10, 32); err == nil {
+			s.tcpECN = int32(v)
+		}
+	} else {
+		log.Warningf("Failed to read TCP ECN setting, using 2")
+	}
+
+	// Linux defaults to enabling Fast Open on outgoing connections only.
+	s.tcpFastOpen = 1
+	if fastOpen, err := os.ReadFile("/proc/sys/net/ipv4/tcp_fastopen"); err == nil {
+		if v, err := strconv.ParseInt(strings.TrimSpace(string(fastOpen)), 10, 32); err == nil {
+			s.tcpFastOpen = int32(v)
+		}
+	} else {
+		log.Warningf("Failed to read TCP Fast Open setting, using 1")
+	}
+
+	s.tcpAvailableCC = "reno"
+	if cc, err := os.ReadFile("/proc/sys/net/ipv4/tcp_available_congestion_control"); err == nil {
+		s.tcpAvailableCC = strings.TrimSpace(string(cc))
+	} else {
+		log.Warningf("Failed to read available TCP congestion control algorithms, using reno")
+	}
+	s.tcpCC = "reno"
+	if cc, err := os.ReadFile("/proc/sys/net/ipv4/tcp_congestion_control"); err == nil {
+		s.tcpCC = strings.TrimSpace(string(cc))
+	} else {
+		log.Warningf("Failed to read TCP congestion control algorithm, using reno")
+	}
+
 	if f, err := os.Open("/proc/net/dev"); err != nil {
 		log.Warningf("Failed to open /proc/net/dev: %v", err)
 	} else {
@@ -279,6 +316,42 @@ func (*Stack) SetTCPRecovery(inet.TCPLossRecovery) error {
 	return linuxerr.EACCES
 }
 
+// TCPECN implements inet.Stack.TCPECN.
+func (s *Stack) TCPECN() (int32, error) {
+	return s.tcpECN, nil
+}
+
+// SetTCPECN implements inet.Stack.SetTCPECN.
+func (*Stack) SetTCPECN(int32) error {
+	return linuxerr.EACCES
+}
+
+// TCPFastOpen implements inet.Stack.TCPFastOpen.
+func (s *Stack) TCPFastOpen() (int32, error) {
+	return s.tcpFastOpen, nil
+}
+
+// SetTCPFastOpen implements inet.Stack.SetTCPFastOpen.
+func (*Stack) SetTCPFastOpen(int32) error {
+	return linuxerr.EACCES
+}
+
+// TCPAvailableCongestionControl implements
+// inet.Stack.TCPAvailableCongestionControl.
+func (s *Stack) TCPAvailableCongestionControl() (string, error) {
+	return s.tcpAvailableCC, nil
+}
+
+// TCPCongestionControl implements inet.Stack.TCPCongestionControl.
+func (s *Stack) TCPCongestionControl() (string, error) {
+	return s.tcpCC, nil
+}
+
+// SetTCPCongestionControl implements inet.Stack.SetTCPCongestionControl.
+func (*Stack) SetTCPCongestionControl(string) error {
+	return linuxerr.EACCES
+}
+
 // getLine reads one line from proc file, with specified prefix.
 // The last argument, withHeader, specifies if it contains line header.
 func getLine(f *os.File, prefix string, withHeader bool) string {
@@ -392,6 +465,56 @@ func (*Stack) RemoveRoute(context.Context, *nlmsg.Message) *syserr.Error {
 	return syserr.ErrNotSupported
 }
 
+// RuleTable implements inet.Stack.RuleTable.
+func (*Stack) RuleTable() []inet.Rule {
+	return nil
+}
+
+// NewRule implements inet.Stack.NewRule.
+func (*Stack) NewRule(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// RemoveRule implements inet.Stack.RemoveRule.
+func (*Stack) RemoveRule(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// FDB implements inet.Stack.FDB.
+func (*Stack) FDB() []inet.FDBEntry {
+	return nil
+}
+
+// NewFDBEntry implements inet.Stack.NewFDBEntry.
+func (*Stack) NewFDBEntry(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// RemoveFDBEntry implements inet.Stack.RemoveFDBEntry.
+func (*Stack) RemoveFDBEntry(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// QDiscs implements inet.Stack.QDiscs.
+func (*Stack) QDiscs() []inet.QDisc {
+	return nil
+}
+
+// NewQDisc implements inet.Stack.NewQDisc.
+func (*Stack) NewQDisc(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// RemoveQDisc implements inet.Stack.RemoveQDisc.
+func (*Stack) RemoveQDisc(context.Context, *nlmsg.Message) *syserr.Error {
+	return syserr.ErrNotSupported
+}
+
+// ConntrackEntries implements inet.Stack.ConntrackEntries.
+func (*Stack) ConntrackEntries() []stack.ConntrackEntry {
+	return nil
+}
+
 // Pause implements inet.Stack.Pause.
 func (*Stack) Pause() {}
 
@@ -37,8 +37,8 @@ type matchMaker interface {
 	marshal(matcher matcher) []byte
 
 	// unmarshal converts from the ABI matcher struct to an
-	// stack.Matcher.
-	unmarshal(mapper IDMapper, buf []byte, filter stack.IPHeaderFilter) (stack.Matcher, error)
+	// stack.Matcher. stk is the stack the matcher will be installed in.
+	unmarshal(mapper IDMapper, stk *stack.Stack, buf []byte, filter stack.IPHeaderFilter) (stack.Matcher, error)
 }
 
 type matchKey struct {
@@ -71,6 +71,27 @@ func registerMatchMaker(mm matchMaker) {
 	matchMakers[key(mm)] = mm
 }
 
+// matchRevision returns the maximum supported revision of the matcher with
+// name `name` up to rev, and whether any such matcher with that name exists.
+func matchRevision(name string, rev uint8) (uint8, bool) {
+	if _, ok := matchMakers[matchKey{name: name, revision: rev}]; ok {
+		return rev, true
+	}
+
+	// Return the highest supported revision.
+	var found bool
+	var ret uint8
+	for key := range matchMakers {
+		if key.name == name {
+			found = true
+			if key.revision > ret {
+				ret = key.revision
+			}
+		}
+	}
+	return ret, found
+}
+
 func marshalMatcher(mr stack.Matcher) []byte {
 	matcher := mr.(matcher)
 	key := matchKey{
@@ -84,9 +105,9 @@ func marshalMatcher(mr stack.Matcher) []byte {
 	return matchMaker.marshal(matcher)
 }
 
-// marshalEntryMatch creates a marshalled XTEntryMatch with the given name and
-// data appended at the end.
-func marshalEntryMatch(name string, data []byte) []byte {
+// marshalEntryMatch creates a marshalled XTEntryMatch with the given name,
+// revision and data appended at the end.
+func marshalEntryMatch(name string, revision uint8, data []byte) []byte {
 	nflog("marshaling matcher %q", name)
 
 	// We have to pad this struct size to a multiple of 8 bytes.
@@ -94,6 +115,7 @@ func marshalEntryMatch(name string, data []byte) []byte {
 	matcher := linux.KernelXTEntryMatch{
 		XTEntryMatch: linux.XTEntryMatch{
 			MatchSize: uint16(size),
+			Revision:  revision,
 		},
 		Data: data,
 	}
@@ -105,7 +127,7 @@ func marshalEntryMatch(name string, data []byte) []byte {
 	return buf
 }
 
-func unmarshalMatcher(mapper IDMapper, match linux.XTEntryMatch, filter stack.IPHeaderFilter, buf []byte) (stack.Matcher, error) {
+func unmarshalMatcher(mapper IDMapper, stk *stack.Stack, match linux.XTEntryMatch, filter stack.IPHeaderFilter, buf []byte) (stack.Matcher, error) {
 	key := matchKey{
 		name:     match.Name.String(),
 		revision: match.Revision,
@@ -114,7 +136,7 @@ func unmarshalMatcher(mapper IDMapper, match linux.XTEntryMatch, filter stack.IP
 	if !ok {
 		return nil, fmt.Errorf("unsupported matcher with name %q and revision %d", match.Name.String(), match.Revision)
 	}
-	return matchMaker.unmarshal(mapper, buf, filter)
+	return matchMaker.unmarshal(mapper, stk, buf, filter)
 }
 
 // targetMaker knows how to (un)marshal a target. Once registered,
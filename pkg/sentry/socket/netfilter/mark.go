@@ -0,0 +1,182 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// MarkTargetName is used to mark targets as MARK targets. MARK targets change
+// the mark of packets.
+const MarkTargetName = "MARK"
+
+// ConnMarkTargetName is used to mark targets as CONNMARK targets. CONNMARK
+// targets change the mark of connections, or restore the mark of packets from
+// the mark of their connection.
+const ConnMarkTargetName = "CONNMARK"
+
+func init() {
+	registerTargetMaker(&markTargetMakerV2{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&markTargetMakerV2{
+		NetworkProtocol: header.IPv6ProtocolNumber,
+	})
+	registerTargetMaker(&connMarkTargetMakerV1{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&connMarkTargetMakerV1{
+		NetworkProtocol: header.IPv6ProtocolNumber,
+	})
+}
+
+// +stateify savable
+type markTarget struct {
+	stack.MarkTarget
+}
+
+func (mt *markTarget) id() targetID {
+	return targetID{
+		name:            MarkTargetName,
+		networkProtocol: mt.NetworkProtocol,
+		revision:        2,
+	}
+}
+
+// +stateify savable
+type markTargetMakerV2 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (mm *markTargetMakerV2) id() targetID {
+	return targetID{
+		name:            MarkTargetName,
+		networkProtocol: mm.NetworkProtocol,
+		revision:        2,
+	}
+}
+
+func (*markTargetMakerV2) marshal(target target) []byte {
+	mt := target.(*markTarget)
+	xt := linux.XTMarkTargetV2{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTMarkTargetV2,
+			Revision:   2,
+		},
+		Mark: mt.Mark,
+		Mask: mt.Mask,
+	}
+	copy(xt.Target.Name[:], MarkTargetName)
+	return marshal.Marshal(&xt)
+}
+
+func (*markTargetMakerV2) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if len(buf) < linux.SizeOfXTMarkTargetV2 {
+		nflog("markTargetMakerV2: buf has insufficient size for MARK target %d", len(buf))
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var xt linux.XTMarkTargetV2
+	xt.UnmarshalUnsafe(buf)
+
+	return &markTarget{stack.MarkTarget{
+		Mark:            xt.Mark,
+		Mask:            xt.Mask,
+		NetworkProtocol: filter.NetworkProtocol(),
+	}}, nil
+}
+
+// +stateify savable
+type connMarkTarget struct {
+	stack.ConnMarkTarget
+}
+
+func (ct *connMarkTarget) id() targetID {
+	return targetID{
+		name:            ConnMarkTargetName,
+		networkProtocol: ct.NetworkProtocol,
+		revision:        1,
+	}
+}
+
+// +stateify savable
+type connMarkTargetMakerV1 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (cm *connMarkTargetMakerV1) id() targetID {
+	return targetID{
+		name:            ConnMarkTargetName,
+		networkProtocol: cm.NetworkProtocol,
+		revision:        1,
+	}
+}
+
+func (*connMarkTargetMakerV1) marshal(target target) []byte {
+	ct := target.(*connMarkTarget)
+	xt := linux.XTConnMarkTargetV1{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTConnMarkTargetV1,
+			Revision:   1,
+		},
+		CTMark: ct.Mark,
+		CTMask: ct.CTMask,
+		NFMask: ct.NFMask,
+	}
+	switch ct.Mode {
+	case stack.ConnMarkSet:
+		xt.Mode = linux.XT_CONNMARK_SET
+	case stack.ConnMarkSave:
+		xt.Mode = linux.XT_CONNMARK_SAVE
+	case stack.ConnMarkRestore:
+		xt.Mode = linux.XT_CONNMARK_RESTORE
+	}
+	copy(xt.Target.Name[:], ConnMarkTargetName)
+	return marshal.Marshal(&xt)
+}
+
+func (*connMarkTargetMakerV1) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if len(buf) < linux.SizeOfXTConnMarkTargetV1 {
+		nflog("connMarkTargetMakerV1: buf has insufficient size for CONNMARK target %d", len(buf))
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var xt linux.XTConnMarkTargetV1
+	xt.UnmarshalUnsafe(buf)
+
+	target := connMarkTarget{stack.ConnMarkTarget{
+		Mark:            xt.CTMark,
+		CTMask:          xt.CTMask,
+		NFMask:          xt.NFMask,
+		NetworkProtocol: filter.NetworkProtocol(),
+	}}
+	switch xt.Mode {
+	case linux.XT_CONNMARK_SET:
+		target.Mode = stack.ConnMarkSet
+	case linux.XT_CONNMARK_SAVE:
+		target.Mode = stack.ConnMarkSave
+	case linux.XT_CONNMARK_RESTORE:
+		target.Mode = stack.ConnMarkRestore
+	default:
+		nflog("connMarkTargetMakerV1: unknown mode %d", xt.Mode)
+		return nil, syserr.ErrInvalidArgument
+	}
+	return &target, nil
+}
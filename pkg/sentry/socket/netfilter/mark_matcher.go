@@ -0,0 +1,117 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	matcherNameMark     = "mark"
+	matcherNameConnMark = "connmark"
+)
+
+func init() {
+	registerMatchMaker(markMarshaler{matcherName: matcherNameMark})
+	registerMatchMaker(markMarshaler{matcherName: matcherNameConnMark})
+}
+
+// markMarshaler implements matchMaker for mark and connmark matching, whose
+// arguments have the same layout.
+type markMarshaler struct {
+	matcherName string
+}
+
+// name implements matchMaker.name.
+func (mm markMarshaler) name() string {
+	return mm.matcherName
+}
+
+// revision implements matchMaker.revision.
+func (markMarshaler) revision() uint8 {
+	return 1
+}
+
+// marshal implements matchMaker.marshal.
+func (mm markMarshaler) marshal(mr matcher) []byte {
+	matcher := mr.(*MarkMatcher)
+	info := linux.XTMarkMatchInfo{
+		Mark: matcher.mark,
+		Mask: matcher.mask,
+	}
+	if matcher.invert {
+		info.Invert = 1
+	}
+	return marshalEntryMatch(mm.matcherName, 1 /* revision */, marshal.Marshal(&info))
+}
+
+// unmarshal implements matchMaker.unmarshal.
+func (mm markMarshaler) unmarshal(_ IDMapper, _ *stack.Stack, buf []byte, filter stack.IPHeaderFilter) (stack.Matcher, error) {
+	if len(buf) < linux.SizeOfXTMarkMatchInfo {
+		return nil, fmt.Errorf("buf has insufficient size for %s match: %d", mm.matcherName, len(buf))
+	}
+
+	// For alignment reasons, the match's total size may exceed what's
+	// strictly necessary to hold matchData.
+	var matchData linux.XTMarkMatchInfo
+	matchData.UnmarshalUnsafe(buf)
+	nflog("parsed XTMarkMatchInfo for %s: %+v", mm.matcherName, matchData)
+
+	return &MarkMatcher{
+		connMark: mm.matcherName == matcherNameConnMark,
+		mark:     matchData.Mark,
+		mask:     matchData.Mask,
+		invert:   matchData.Invert != 0,
+	}, nil
+}
+
+// MarkMatcher matches against the mark of packets or, for connmark matching,
+// of their connection.
+type MarkMatcher struct {
+	connMark bool
+	mark     uint32
+	mask     uint32
+	invert   bool
+}
+
+// name implements matcher.name.
+func (mm *MarkMatcher) name() string {
+	if mm.connMark {
+		return matcherNameConnMark
+	}
+	return matcherNameMark
+}
+
+// revision implements matcher.revision.
+func (*MarkMatcher) revision() uint8 {
+	return 1
+}
+
+// Match implements Matcher.Match.
+func (mm *MarkMatcher) Match(_ stack.Hook, pkt *stack.PacketBuffer, _, _ string) (bool, bool) {
+	mark := pkt.Mark
+	if mm.connMark {
+		var ok bool
+		// As in Linux, untracked packets never match.
+		if mark, ok = pkt.ConnMark(); !ok {
+			return false, false
+		}
+	}
+	return (mark&mm.mask == mm.mark) != mm.invert, false
+}
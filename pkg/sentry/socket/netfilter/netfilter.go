@@ -192,6 +192,8 @@ func SetEntries(mapper IDMapper, stk *stack.Stack, optVal []byte, ipv6 bool) *sy
 		table = stack.EmptyFilterTable()
 	case natTable:
 		table = stack.EmptyNATTable()
+	case mangleTable:
+		table = stack.EmptyMangleTable()
 	default:
 		nflog("unknown iptables table %q", replace.Name.String())
 		return syserr.ErrInvalidArgument
@@ -238,6 +240,16 @@ func SetEntries(mapper IDMapper, stk *stack.Stack, optVal []byte, ipv6 bool) *sy
 		}
 	}
 
+	// TPROXY targets are only valid in the mangle table.
+	if replace.Name.String() != mangleTable {
+		for _, rule := range table.Rules {
+			if _, ok := rule.Target.(*tproxyTarget); ok {
+				nflog("TPROXY target used outside of the mangle table")
+				return syserr.ErrInvalidArgument
+			}
+		}
+	}
+
 	// Check the user chains.
 	for ruleIdx, rule := range table.Rules {
 		if _, ok := rule.Target.(*stack.UserChainTarget); !ok {
@@ -288,7 +300,7 @@ func SetEntries(mapper IDMapper, stk *stack.Stack, optVal []byte, ipv6 bool) *sy
 
 // parseMatchers parses 0 or more matchers from optVal. optVal should contain
 // only the matchers.
-func parseMatchers(mapper IDMapper, filter stack.IPHeaderFilter, optVal []byte) ([]stack.Matcher, error) {
+func parseMatchers(mapper IDMapper, stk *stack.Stack, filter stack.IPHeaderFilter, optVal []byte) ([]stack.Matcher, error) {
 	nflog("set entries: parsing matchers of size %d", len(optVal))
 	var matchers []stack.Matcher
 	for len(optVal) > 0 {
@@ -311,7 +323,7 @@ func parseMatchers(mapper IDMapper, filter stack.IPHeaderFilter, optVal []byte)
 		}
 
 		// Parse the specific matcher.
-		matcher, err := unmarshalMatcher(mapper, match, filter, optVal[linux.SizeOfXTEntryMatch:match.MatchSize])
+		matcher, err := unmarshalMatcher(mapper, stk, match, filter, optVal[linux.SizeOfXTEntryMatch:match.MatchSize])
 		if err != nil {
 			return nil, fmt.Errorf("failed to create matcher: %v", err)
 		}
@@ -388,6 +400,27 @@ func TargetRevision(t *kernel.Task, revPtr hostarch.Addr, netProto tcpip.Network
 	return rev, nil
 }
 
+// MatchRevision returns a linux.XTGetRevision for a given matcher. It sets
+// Revision to the highest supported value, unless the provided revision number
+// is larger.
+func MatchRevision(t *kernel.Task, revPtr hostarch.Addr) (linux.XTGetRevision, *syserr.Error) {
+	// Read in the matcher name and version.
+	var rev linux.XTGetRevision
+	if _, err := rev.CopyIn(t, revPtr); err != nil {
+		return linux.XTGetRevision{}, syserr.FromError(err)
+	}
+	maxSupported, ok := matchRevision(rev.Name.String(), rev.Revision)
+	if !ok {
+		// Return ENOENT if there's no matcher with that name.
+		return linux.XTGetRevision{}, syserr.ErrNoFileOrDir
+	}
+	if maxSupported < rev.Revision {
+		// Return EPROTONOSUPPORT if we have an insufficient revision.
+		return linux.XTGetRevision{}, syserr.ErrProtocolNotSupported
+	}
+	return rev, nil
+}
+
 func trimNullBytes(b []byte) []byte {
 	n := bytes.IndexByte(b, 0)
 	if n == -1 {
@@ -64,11 +64,11 @@ func (ownerMarshaler) marshal(mr matcher) []byte {
 	}
 
 	buf := marshal.Marshal(&iptOwnerInfo)
-	return marshalEntryMatch(matcherNameOwner, buf)
+	return marshalEntryMatch(matcherNameOwner, 0 /* revision */, buf)
 }
 
 // unmarshal implements matchMaker.unmarshal.
-func (ownerMarshaler) unmarshal(mapper IDMapper, buf []byte, filter stack.IPHeaderFilter) (stack.Matcher, error) {
+func (ownerMarshaler) unmarshal(mapper IDMapper, _ *stack.Stack, buf []byte, filter stack.IPHeaderFilter) (stack.Matcher, error) {
 	if len(buf) < linux.SizeOfIPTOwnerInfo {
 		return nil, fmt.Errorf("buf has insufficient size for owner match: %d", len(buf))
 	}
@@ -0,0 +1,160 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const matcherNameSocket = "socket"
+
+// socketMatcherFlags maps each supported revision of the socket matcher to
+// the flags it accepts. Revision 0 takes no arguments.
+var socketMatcherFlags = [...]uint8{
+	0: 0,
+	1: linux.XT_SOCKET_TRANSPARENT,
+	2: linux.XT_SOCKET_TRANSPARENT | linux.XT_SOCKET_NOWILDCARD,
+	3: linux.XT_SOCKET_TRANSPARENT | linux.XT_SOCKET_NOWILDCARD | linux.XT_SOCKET_RESTORE_SKMARK,
+}
+
+func init() {
+	for rev := range socketMatcherFlags {
+		registerMatchMaker(socketMarshaler{rev: uint8(rev)})
+	}
+}
+
+// socketMarshaler implements matchMaker for socket matching.
+type socketMarshaler struct {
+	rev uint8
+}
+
+// name implements matchMaker.name.
+func (socketMarshaler) name() string {
+	return matcherNameSocket
+}
+
+// revision implements matchMaker.revision.
+func (sm socketMarshaler) revision() uint8 {
+	return sm.rev
+}
+
+// marshal implements matchMaker.marshal.
+func (sm socketMarshaler) marshal(mr matcher) []byte {
+	matcher := mr.(*SocketMatcher)
+	var buf []byte
+	if sm.rev > 0 {
+		buf = marshal.Marshal(&linux.XTSocketMatchInfo{Flags: matcher.flags})
+	}
+	return marshalEntryMatch(matcherNameSocket, sm.rev, buf)
+}
+
+// unmarshal implements matchMaker.unmarshal.
+func (sm socketMarshaler) unmarshal(_ IDMapper, stk *stack.Stack, buf []byte, filter stack.IPHeaderFilter) (stack.Matcher, error) {
+	var matchData linux.XTSocketMatchInfo
+	if sm.rev > 0 {
+		if len(buf) < linux.SizeOfXTSocketMatchInfo {
+			return nil, fmt.Errorf("buf has insufficient size for socket match: %d", len(buf))
+		}
+		matchData.UnmarshalUnsafe(buf)
+		nflog("parsed XTSocketMatchInfo: %+v", matchData)
+	}
+
+	if matchData.Flags&^socketMatcherFlags[sm.rev] != 0 {
+		return nil, fmt.Errorf("unknown socket matcher flags set for revision %d: %#x", sm.rev, matchData.Flags)
+	}
+
+	return &SocketMatcher{
+		stack: stk,
+		flags: matchData.Flags,
+		rev:   sm.rev,
+	}, nil
+}
+
+// SocketMatcher matches packets that belong to a local socket. It corresponds
+// to the xt_socket matcher in Linux.
+type SocketMatcher struct {
+	stack *stack.Stack
+	flags uint8
+	rev   uint8
+}
+
+// name implements matcher.name.
+func (*SocketMatcher) name() string {
+	return matcherNameSocket
+}
+
+// revision implements matcher.revision.
+func (sm *SocketMatcher) revision() uint8 {
+	return sm.rev
+}
+
+// Match implements Matcher.Match.
+func (sm *SocketMatcher) Match(hook stack.Hook, pkt *stack.PacketBuffer, _, _ string) (bool, bool) {
+	var srcPort, dstPort uint16
+	switch pkt.TransportProtocolNumber {
+	case header.TCPProtocolNumber:
+		tcpHeader := header.TCP(pkt.TransportHeader().Slice())
+		if len(tcpHeader) < header.TCPMinimumSize {
+			return false, false
+		}
+		srcPort, dstPort = tcpHeader.SourcePort(), tcpHeader.DestinationPort()
+	case header.UDPProtocolNumber:
+		udpHeader := header.UDP(pkt.TransportHeader().Slice())
+		if len(udpHeader) < header.UDPMinimumSize {
+			return false, false
+		}
+		srcPort, dstPort = udpHeader.SourcePort(), udpHeader.DestinationPort()
+	default:
+		// As in Linux, only TCP and UDP packets are looked up.
+		return false, false
+	}
+
+	netHeader := pkt.Network()
+	id := stack.TransportEndpointID{
+		LocalPort:     dstPort,
+		LocalAddress:  netHeader.DestinationAddress(),
+		RemotePort:    srcPort,
+		RemoteAddress: netHeader.SourceAddress(),
+	}
+	tep := sm.stack.FindTransportEndpoint(pkt.NetworkProtocolNumber, pkt.TransportProtocolNumber, id, pkt.NICID)
+	if tep == nil {
+		return false, false
+	}
+	ep, ok := tep.(tcpip.Endpoint)
+	if !ok {
+		return false, false
+	}
+
+	// Sockets bound to the unspecified address don't match unless
+	// XT_SOCKET_NOWILDCARD is set.
+	if sm.flags&linux.XT_SOCKET_NOWILDCARD == 0 {
+		if addr, err := ep.GetLocalAddress(); err == nil && (addr.Addr.BitLen() == 0 || addr.Addr.Unspecified()) {
+			return false, false
+		}
+	}
+	if sm.flags&linux.XT_SOCKET_TRANSPARENT != 0 && !ep.SocketOptions().GetTransparent() {
+		return false, false
+	}
+	if sm.flags&linux.XT_SOCKET_RESTORE_SKMARK != 0 {
+		pkt.Mark = ep.SocketOptions().GetMark()
+	}
+	return true, false
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// TPROXYTargetName is used to mark targets as TPROXY targets. TPROXY targets
+// should be reached for only the mangle table. These targets deliver packets
+// to local transparent sockets without changing their addresses.
+const TPROXYTargetName = "TPROXY"
+
+func init() {
+	registerTargetMaker(&tproxyTargetMakerV0{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&tproxyTargetMakerV1{
+		NetworkProtocol: header.IPv4ProtocolNumber,
+	})
+	registerTargetMaker(&tproxyTargetMakerV1{
+		NetworkProtocol: header.IPv6ProtocolNumber,
+	})
+}
+
+// +stateify savable
+type tproxyTarget struct {
+	stack.TPROXYTarget
+	revision uint8
+}
+
+func (tt *tproxyTarget) id() targetID {
+	return targetID{
+		name:            TPROXYTargetName,
+		networkProtocol: tt.NetworkProtocol,
+		revision:        tt.revision,
+	}
+}
+
+// tproxyAddress converts the local address of a TPROXY target to a
+// tcpip.Address. The unspecified address is converted to the empty address,
+// which makes the target use the address of the incoming interface.
+func tproxyAddress(addr tcpip.Address) tcpip.Address {
+	if addr.Unspecified() {
+		return tcpip.Address{}
+	}
+	return addr
+}
+
+// +stateify savable
+type tproxyTargetMakerV0 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (tm *tproxyTargetMakerV0) id() targetID {
+	return targetID{
+		name:            TPROXYTargetName,
+		networkProtocol: tm.NetworkProtocol,
+	}
+}
+
+func (*tproxyTargetMakerV0) marshal(target target) []byte {
+	tt := target.(*tproxyTarget)
+	xt := linux.XTTPROXYTargetV0{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTTPROXYTargetV0,
+		},
+		MarkMask:  tt.MarkMask,
+		MarkValue: tt.Mark,
+		LocalPort: htons(tt.Port),
+	}
+	copy(xt.Target.Name[:], TPROXYTargetName)
+	copy(xt.LocalAddr[:], tt.Addr.AsSlice())
+	return marshal.Marshal(&xt)
+}
+
+func (*tproxyTargetMakerV0) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if len(buf) < linux.SizeOfXTTPROXYTargetV0 {
+		nflog("tproxyTargetMakerV0: buf has insufficient size for TPROXY target %d", len(buf))
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	if p := filter.Protocol; p != header.TCPProtocolNumber && p != header.UDPProtocolNumber {
+		nflog("tproxyTargetMakerV0: bad proto %d", p)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var xt linux.XTTPROXYTargetV0
+	xt.UnmarshalUnsafe(buf)
+
+	return &tproxyTarget{
+		TPROXYTarget: stack.TPROXYTarget{
+			Addr:            tproxyAddress(tcpip.AddrFrom4(xt.LocalAddr)),
+			Port:            ntohs(xt.LocalPort),
+			Mark:            xt.MarkValue,
+			MarkMask:        xt.MarkMask,
+			NetworkProtocol: filter.NetworkProtocol(),
+		},
+	}, nil
+}
+
+// +stateify savable
+type tproxyTargetMakerV1 struct {
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+func (tm *tproxyTargetMakerV1) id() targetID {
+	return targetID{
+		name:            TPROXYTargetName,
+		networkProtocol: tm.NetworkProtocol,
+		revision:        1,
+	}
+}
+
+func (*tproxyTargetMakerV1) marshal(target target) []byte {
+	tt := target.(*tproxyTarget)
+	xt := linux.XTTPROXYTargetV1{
+		Target: linux.XTEntryTarget{
+			TargetSize: linux.SizeOfXTTPROXYTargetV1,
+			Revision:   1,
+		},
+		MarkMask:  tt.MarkMask,
+		MarkValue: tt.Mark,
+		LocalPort: htons(tt.Port),
+	}
+	copy(xt.Target.Name[:], TPROXYTargetName)
+	copy(xt.LocalAddr[:], tt.Addr.AsSlice())
+	return marshal.Marshal(&xt)
+}
+
+func (*tproxyTargetMakerV1) unmarshal(buf []byte, filter stack.IPHeaderFilter) (target, *syserr.Error) {
+	if len(buf) < linux.SizeOfXTTPROXYTargetV1 {
+		nflog("tproxyTargetMakerV1: buf has insufficient size for TPROXY target %d", len(buf))
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	if p := filter.Protocol; p != header.TCPProtocolNumber && p != header.UDPProtocolNumber {
+		nflog("tproxyTargetMakerV1: bad proto %d", p)
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	var xt linux.XTTPROXYTargetV1
+	xt.UnmarshalUnsafe(buf)
+
+	var addr tcpip.Address
+	switch filter.NetworkProtocol() {
+	case header.IPv4ProtocolNumber:
+		addr = tcpip.AddrFrom4Slice(xt.LocalAddr[:header.IPv4AddressSize])
+	case header.IPv6ProtocolNumber:
+		addr = tcpip.AddrFrom16(xt.LocalAddr)
+	}
+
+	return &tproxyTarget{
+		TPROXYTarget: stack.TPROXYTarget{
+			Addr:            tproxyAddress(addr),
+			Port:            ntohs(xt.LocalPort),
+			Mark:            xt.MarkValue,
+			MarkMask:        xt.MarkMask,
+			NetworkProtocol: filter.NetworkProtocol(),
+		},
+		revision: 1,
+	}, nil
+}
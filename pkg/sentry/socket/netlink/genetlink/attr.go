@@ -0,0 +1,111 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package genetlink
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bits"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+)
+
+// ParseAttrs parses netlink attributes, keyed by type with the NLA_F_NESTED
+// and NLA_F_NET_BYTEORDER flags removed. Generic netlink users such as libmnl
+// set NLA_F_NESTED on nested attributes.
+func ParseAttrs(v nlmsg.AttrsView) (map[uint16]nlmsg.BytesView, bool) {
+	attrs := make(map[uint16]nlmsg.BytesView)
+	for !v.Empty() {
+		hdr, value, rest, ok := v.ParseFirst()
+		if !ok {
+			return nil, false
+		}
+		v = rest
+		attrs[hdr.Type&linux.NLA_TYPE_MASK] = nlmsg.BytesView(value)
+	}
+	return attrs, true
+}
+
+// ParseList parses a nested attribute that is an array, returning the payload
+// of its elements in order. The types of the elements are ignored.
+func ParseList(v nlmsg.BytesView) ([]nlmsg.AttrsView, bool) {
+	var elems []nlmsg.AttrsView
+	attrs := nlmsg.AttrsView(v)
+	for !attrs.Empty() {
+		_, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return nil, false
+		}
+		attrs = rest
+		elems = append(elems, nlmsg.AttrsView(value))
+	}
+	return elems, true
+}
+
+// Uint16 parses a u16 attribute.
+func Uint16(v nlmsg.BytesView) (uint16, bool) {
+	if len(v) != 2 {
+		return 0, false
+	}
+	return hostarch.ByteOrder.Uint16(v), true
+}
+
+// AttrWriter serializes netlink attributes, including nested ones.
+type AttrWriter []byte
+
+// Put adds an attribute with the given payload.
+func (w *AttrWriter) Put(atype uint16, v []byte) {
+	l := linux.NetlinkAttrHeaderSize + len(v)
+	*w = hostarch.ByteOrder.AppendUint16(*w, uint16(l))
+	*w = hostarch.ByteOrder.AppendUint16(*w, atype)
+	*w = append(*w, v...)
+	for i := l; i < bits.AlignUp(l, linux.NLA_ALIGNTO); i++ {
+		*w = append(*w, 0)
+	}
+}
+
+// PutString adds a NUL-terminated string attribute.
+func (w *AttrWriter) PutString(atype uint16, s string) {
+	w.Put(atype, append([]byte(s), 0))
+}
+
+// PutUint16 adds a u16 attribute.
+func (w *AttrWriter) PutUint16(atype uint16, v uint16) {
+	w.Put(atype, hostarch.ByteOrder.AppendUint16(nil, v))
+}
+
+// PutUint32 adds a u32 attribute.
+func (w *AttrWriter) PutUint32(atype uint16, v uint32) {
+	w.Put(atype, hostarch.ByteOrder.AppendUint32(nil, v))
+}
+
+// PutUint64 adds a u64 attribute.
+func (w *AttrWriter) PutUint64(atype uint16, v uint64) {
+	w.Put(atype, hostarch.ByteOrder.AppendUint64(nil, v))
+}
+
+// PutNested adds a nested attribute whose contents are written by fn.
+func (w *AttrWriter) PutNested(atype uint16, fn func(w *AttrWriter)) {
+	var nested AttrWriter
+	fn(&nested)
+	w.Put(atype|linux.NLA_F_NESTED, nested)
+}
+
+// AppendTo adds the attributes to m.
+func (w AttrWriter) AppendTo(m *nlmsg.Message) {
+	if len(w) > 0 {
+		m.Put(primitive.AsByteSlice(w))
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package genetlink
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+const (
+	// ctrlName is the name of the controller family.
+	ctrlName = "nlctrl"
+
+	// ctrlVersion is the version of the controller family, from
+	// net/netlink/genetlink.c.
+	ctrlVersion = 2
+)
+
+// controller is the "nlctrl" family, which resolves the names of families and
+// their multicast groups to their IDs. See net/netlink/genetlink.c.
+type controller struct{}
+
+// Name implements Family.Name.
+func (controller) Name() string {
+	return ctrlName
+}
+
+// Version implements Family.Version.
+func (controller) Version() uint32 {
+	return ctrlVersion
+}
+
+// MaxAttr implements Family.MaxAttr.
+func (controller) MaxAttr() uint32 {
+	return linux.CTRL_ATTR_OP
+}
+
+// Ops implements Family.Ops.
+func (controller) Ops() []Op {
+	return []Op{{
+		Cmd:   linux.CTRL_CMD_GETFAMILY,
+		Flags: linux.GENL_CMD_CAP_DO | linux.GENL_CMD_CAP_DUMP,
+	}}
+}
+
+// MulticastGroups implements Family.MulticastGroups.
+func (controller) MulticastGroups() []MulticastGroup {
+	return []MulticastGroup{{Name: "notify"}}
+}
+
+// ProcessMessage implements Family.ProcessMessage.
+func (controller) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, hdr linux.GenericNetlinkHeader, attrs nlmsg.AttrsView, ms *nlmsg.MessageSet) *syserr.Error {
+	if msg.Header().Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP {
+		for i := range families {
+			addFamilyMessage(ms, &families[i])
+		}
+		return nil
+	}
+
+	parsed, ok := ParseAttrs(attrs)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	var f *registeredFamily
+	if v, ok := parsed[linux.CTRL_ATTR_FAMILY_ID]; ok {
+		id, ok := Uint16(v)
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		f = familyByID(id)
+	} else if v, ok := parsed[linux.CTRL_ATTR_FAMILY_NAME]; ok {
+		f = familyByName(v.String())
+	} else {
+		return syserr.ErrInvalidArgument
+	}
+	if f == nil {
+		return syserr.ErrNoFileOrDir
+	}
+	addFamilyMessage(ms, f)
+	return nil
+}
+
+// addFamilyMessage adds a CTRL_CMD_NEWFAMILY message describing f to ms.
+func addFamilyMessage(ms *nlmsg.MessageSet, f *registeredFamily) {
+	var attrs AttrWriter
+	attrs.PutString(linux.CTRL_ATTR_FAMILY_NAME, f.family.Name())
+	attrs.PutUint16(linux.CTRL_ATTR_FAMILY_ID, f.id)
+	attrs.PutUint32(linux.CTRL_ATTR_VERSION, f.family.Version())
+	// No family has a header of its own after the generic netlink header.
+	attrs.PutUint32(linux.CTRL_ATTR_HDRSIZE, 0)
+	attrs.PutUint32(linux.CTRL_ATTR_MAXATTR, f.family.MaxAttr())
+	// Like on Linux, the elements of nested arrays are numbered from 1.
+	if ops := f.family.Ops(); len(ops) > 0 {
+		attrs.PutNested(linux.CTRL_ATTR_OPS, func(w *AttrWriter) {
+			for i, op := range ops {
+				w.PutNested(uint16(i+1), func(w *AttrWriter) {
+					w.PutUint32(linux.CTRL_ATTR_OP_ID, uint32(op.Cmd))
+					w.PutUint32(linux.CTRL_ATTR_OP_FLAGS, op.Flags)
+				})
+			}
+		})
+	}
+	if groups := f.family.MulticastGroups(); len(groups) > 0 {
+		attrs.PutNested(linux.CTRL_ATTR_MCAST_GROUPS, func(w *AttrWriter) {
+			for i, g := range groups {
+				w.PutNested(uint16(i+1), func(w *AttrWriter) {
+					w.PutString(linux.CTRL_ATTR_MCAST_GRP_NAME, g.Name)
+					w.PutUint32(linux.CTRL_ATTR_MCAST_GRP_ID, f.groups[i])
+				})
+			}
+		})
+	}
+
+	m := AddMessage(ms, linux.GENL_ID_CTRL, linux.CTRL_CMD_NEWFAMILY, ctrlVersion)
+	attrs.AppendTo(m)
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package genetlink
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// Family is the implementation of a generic netlink family.
+type Family interface {
+	// Name returns the name of the family, which userspace resolves to
+	// its ID.
+	Name() string
+
+	// Version returns the version of the family.
+	Version() uint32
+
+	// MaxAttr returns the highest top-level attribute type of the
+	// family.
+	MaxAttr() uint32
+
+	// Ops returns the commands that the family supports. Messages with
+	// other commands are rejected before reaching ProcessMessage.
+	Ops() []Op
+
+	// MulticastGroups returns the multicast groups of the family.
+	MulticastGroups() []MulticastGroup
+
+	// ProcessMessage processes a single message of the family from
+	// userspace. hdr is the generic netlink header of msg, and attrs are
+	// the attributes following it. The command of hdr is one of Ops, and
+	// the caller has checked its flags.
+	//
+	// Replies are added to ms, like in netlink.Protocol.ProcessMessage,
+	// with the family ID as message type.
+	ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, hdr linux.GenericNetlinkHeader, attrs nlmsg.AttrsView, ms *nlmsg.MessageSet) *syserr.Error
+}
+
+// Op describes a command of a family.
+type Op struct {
+	// Cmd is the command.
+	Cmd uint8
+
+	// Flags is a mask of GENL_CMD_CAP_DO and GENL_CMD_CAP_DUMP, which
+	// allow the command without and with NLM_F_DUMP respectively, and
+	// GENL_ADMIN_PERM or GENL_UNS_ADMIN_PERM, which require
+	// CAP_NET_ADMIN.
+	Flags uint32
+}
+
+// MulticastGroup describes a multicast group of a family.
+type MulticastGroup struct {
+	// Name is the name of the group, which userspace resolves to its ID.
+	Name string
+
+	// Flags is GENL_ADMIN_PERM or GENL_UNS_ADMIN_PERM if joining the
+	// group requires CAP_NET_ADMIN, and zero otherwise.
+	Flags uint32
+}
+
+// registeredFamily is a family and the IDs it was allocated.
+type registeredFamily struct {
+	id     uint16
+	family Family
+
+	// groups holds the IDs of the multicast groups of family, in the order
+	// of family.MulticastGroups().
+	groups []uint32
+}
+
+// op returns the op of f with the given command.
+func (f *registeredFamily) op(cmd uint8) (Op, bool) {
+	for _, op := range f.family.Ops() {
+		if op.Cmd == cmd {
+			return op, true
+		}
+	}
+	return Op{}, false
+}
+
+// families holds the registered families, in the order of their IDs. The
+// controller family and its "notify" group have a fixed ID.
+var families = []registeredFamily{{
+	id:     linux.GENL_ID_CTRL,
+	family: controller{},
+	groups: []uint32{linux.GENL_ID_CTRL},
+}}
+
+// nextID is the ID of the next registered family.
+var nextID uint16 = linux.GENL_START_ALLOC
+
+// nextGroup is the ID of the next registered multicast group.
+var nextGroup uint32 = 1
+
+// allocGroup allocates the ID of a multicast group. Like on Linux, the IDs
+// of the groups of the controller and of families with fixed IDs upstream
+// are skipped, so that they don't collide.
+func allocGroup() uint32 {
+	for nextGroup >= linux.GENL_MIN_ID && nextGroup < linux.GENL_START_ALLOC {
+		nextGroup++
+	}
+	g := nextGroup
+	nextGroup++
+	return g
+}
+
+// RegisterFamily registers a generic netlink family, and returns the ID that
+// was allocated to it.
+//
+// Preconditions: May only be called before any netlink sockets are created.
+func RegisterFamily(f Family) uint16 {
+	if familyByName(f.Name()) != nil {
+		panic(fmt.Sprintf("generic netlink family %q already registered", f.Name()))
+	}
+	if nextID > linux.GENL_MAX_ID {
+		panic("too many generic netlink families")
+	}
+	id := nextID
+	nextID++
+	var groups []uint32
+	for range f.MulticastGroups() {
+		groups = append(groups, allocGroup())
+	}
+	families = append(families, registeredFamily{
+		id:     id,
+		family: f,
+		groups: groups,
+	})
+	return id
+}
+
+// familyByName returns the family with the given name, or nil.
+func familyByName(name string) *registeredFamily {
+	for i := range families {
+		if families[i].family.Name() == name {
+			return &families[i]
+		}
+	}
+	return nil
+}
+
+// familyByID returns the family with the given ID, or nil.
+func familyByID(id uint16) *registeredFamily {
+	for i := range families {
+		if families[i].id == id {
+			return &families[i]
+		}
+	}
+	return nil
+}
+
+// groupByID returns the multicast group with the given ID and its family, or
+// nils.
+func groupByID(group uint32) (*registeredFamily, *MulticastGroup) {
+	for i := range families {
+		f := &families[i]
+		for j, id := range f.groups {
+			if id == group {
+				return f, &f.family.MulticastGroups()[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// GroupID returns the ID of the multicast group with the given name of the
+// family with the given ID, or zero if there is none.
+func GroupID(familyID uint16, name string) uint32 {
+	f := familyByID(familyID)
+	if f == nil {
+		return 0
+	}
+	for i, g := range f.family.MulticastGroups() {
+		if g.Name == name {
+			return f.groups[i]
+		}
+	}
+	return 0
+}
+
+// Notify sends a message of the family with the given ID and command, with
+// attrs as attributes, to the sockets in netns that are members of the
+// multicast group with the given name.
+func Notify(ctx context.Context, netns *inet.Namespace, familyID uint16, group string, cmd uint8, attrs AttrWriter) {
+	f := familyByID(familyID)
+	if f == nil {
+		panic(fmt.Sprintf("generic netlink family %d not registered", familyID))
+	}
+	id := GroupID(familyID, group)
+	if id == 0 {
+		panic(fmt.Sprintf("generic netlink family %q has no multicast group %q", f.family.Name(), group))
+	}
+	ms := nlmsg.NewMessageSet(0, 0)
+	m := AddMessage(ms, familyID, cmd, f.family.Version())
+	attrs.AppendTo(m)
+	netlink.Broadcast(ctx, linux.NETLINK_GENERIC, netns, id, ms)
+}
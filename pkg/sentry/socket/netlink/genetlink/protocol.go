@@ -0,0 +1,122 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package genetlink provides a NETLINK_GENERIC socket protocol.
+//
+// Generic netlink multiplexes families, identified by name, over a single
+// netlink protocol. The message type of a family's messages is the ID that
+// the family was allocated when it was registered, which userspace resolves
+// through the "nlctrl" controller family along with the IDs of the family's
+// multicast groups.
+//
+// Sentry subsystems expose families by calling RegisterFamily from their init
+// functions, and send events to the multicast groups of their families with
+// Notify.
+package genetlink
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_GENERIC netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_GENERIC
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var hdr linux.GenericNetlinkHeader
+	attrs, ok := msg.GetData(&hdr)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	f := familyByID(msg.Header().Type)
+	if f == nil {
+		return syserr.ErrNoFileOrDir
+	}
+	op, ok := f.op(hdr.Command)
+	if !ok {
+		return syserr.ErrNotSupported
+	}
+
+	// See net/netlink/genetlink.c:genl_family_rcv_msg.
+	if op.Flags&(linux.GENL_ADMIN_PERM|linux.GENL_UNS_ADMIN_PERM) != 0 {
+		creds := auth.CredentialsFromContext(ctx)
+		if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+			return syserr.ErrNotPermitted
+		}
+	}
+	if msg.Header().Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP {
+		if op.Flags&linux.GENL_CMD_CAP_DUMP == 0 {
+			return syserr.ErrNotSupported
+		}
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+	} else if op.Flags&linux.GENL_CMD_CAP_DO == 0 {
+		return syserr.ErrNotSupported
+	}
+	return f.family.ProcessMessage(ctx, s, msg, hdr, attrs, ms)
+}
+
+// CanJoinGroup implements netlink.MulticastProtocol.CanJoinGroup.
+func (p *Protocol) CanJoinGroup(ctx context.Context, s *netlink.Socket, group uint32) *syserr.Error {
+	_, g := groupByID(group)
+	if g == nil {
+		return syserr.ErrInvalidArgument
+	}
+	if g.Flags&(linux.GENL_ADMIN_PERM|linux.GENL_UNS_ADMIN_PERM) != 0 {
+		creds := auth.CredentialsFromContext(ctx)
+		if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+			return syserr.ErrNotPermitted
+		}
+	}
+	return nil
+}
+
+// AddMessage adds a message of the family with the given ID to ms, and
+// returns it for the addition of attributes.
+func AddMessage(ms *nlmsg.MessageSet, id uint16, cmd uint8, version uint32) *nlmsg.Message {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: id,
+	})
+	m.Put(&linux.GenericNetlinkHeader{
+		Command: cmd,
+		Version: uint8(version),
+	})
+	return m
+}
+
+// init registers the NETLINK_GENERIC provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_GENERIC, NewProtocol)
+}
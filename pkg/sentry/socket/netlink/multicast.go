@@ -0,0 +1,172 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netlink
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// MulticastProtocol is implemented by protocols whose sockets can join
+// multicast groups. Sockets of other protocols can't.
+type MulticastProtocol interface {
+	Protocol
+
+	// CanJoinGroup returns nil if the socket can join the given multicast
+	// group, which is never zero.
+	CanJoinGroup(ctx context.Context, s *Socket, group uint32) *syserr.Error
+}
+
+// groupKey identifies a multicast group.
+type groupKey struct {
+	protocol int
+	group    uint32
+}
+
+// multicastMembers holds the sockets that are members of each multicast
+// group. It isn't saved: restored sockets join their groups again.
+var multicastMembers struct {
+	mu      sync.Mutex
+	members map[groupKey]map[*Socket]struct{}
+}
+
+// joinGroupLocked adds s to the members of group.
+//
+// Preconditions: s.mu is held.
+func (s *Socket) joinGroupLocked(group uint32) {
+	if s.groups == nil {
+		s.groups = make(map[uint32]struct{})
+	}
+	s.groups[group] = struct{}{}
+
+	key := groupKey{s.protocol.Protocol(), group}
+	multicastMembers.mu.Lock()
+	defer multicastMembers.mu.Unlock()
+	if multicastMembers.members == nil {
+		multicastMembers.members = make(map[groupKey]map[*Socket]struct{})
+	}
+	if multicastMembers.members[key] == nil {
+		multicastMembers.members[key] = make(map[*Socket]struct{})
+	}
+	multicastMembers.members[key][s] = struct{}{}
+}
+
+// leaveGroupLocked removes s from the members of group.
+//
+// Preconditions: s.mu is held.
+func (s *Socket) leaveGroupLocked(group uint32) {
+	delete(s.groups, group)
+
+	key := groupKey{s.protocol.Protocol(), group}
+	multicastMembers.mu.Lock()
+	defer multicastMembers.mu.Unlock()
+	delete(multicastMembers.members[key], s)
+	if len(multicastMembers.members[key]) == 0 {
+		delete(multicastMembers.members, key)
+	}
+}
+
+// checkJoinGroup returns nil if the protocol of s allows it to join group.
+func (s *Socket) checkJoinGroup(ctx context.Context, group uint32) *syserr.Error {
+	mp, ok := s.protocol.(MulticastProtocol)
+	if !ok {
+		return syserr.ErrPermissionDenied
+	}
+	if group == 0 {
+		return syserr.ErrInvalidArgument
+	}
+	return mp.CanJoinGroup(ctx, s, group)
+}
+
+// joinGroup adds s to the members of group, checking that the protocol
+// allows it.
+func (s *Socket) joinGroup(ctx context.Context, group uint32) *syserr.Error {
+	if err := s.checkJoinGroup(ctx, group); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.joinGroupLocked(group)
+	return nil
+}
+
+// leaveAllGroupsLocked removes s from all the multicast groups it is a member
+// of.
+//
+// Preconditions: s.mu is held.
+func (s *Socket) leaveAllGroupsLocked() {
+	for group := range s.groups {
+		s.leaveGroupLocked(group)
+	}
+}
+
+// groupsMask returns the bit mask of the first 32 multicast groups s is a
+// member of, as reported by getsockname(2).
+//
+// Preconditions: s.mu is held.
+func (s *Socket) groupsMask() uint32 {
+	var mask uint32
+	for group := range s.groups {
+		if group <= 32 {
+			mask |= 1 << (group - 1)
+		}
+	}
+	return mask
+}
+
+// afterLoad is invoked by stateify.
+func (s *Socket) afterLoad(context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for group := range s.groups {
+		s.joinGroupLocked(group)
+	}
+}
+
+// Broadcast sends the messages of ms to the sockets of the given protocol
+// that are members of the multicast group in the network namespace netns.
+// The PortID and Seq of ms should be zero, as the messages come from the
+// kernel rather than answering a request.
+func Broadcast(ctx context.Context, protocol int, netns *inet.Namespace, group uint32, ms *nlmsg.MessageSet) {
+	// The lock is held while sending, so that members can't be released
+	// concurrently.
+	multicastMembers.mu.Lock()
+	defer multicastMembers.mu.Unlock()
+	for s := range multicastMembers.members[groupKey{protocol, group}] {
+		if s.netns != netns {
+			continue
+		}
+		// Like on Linux, messages that don't fit in the receive buffer of
+		// a member are dropped.
+		s.sendResponse(ctx, ms)
+	}
+}
+
+// HasMembers returns whether any socket of the given protocol in the network
+// namespace netns is a member of the multicast group. Protocols can use it
+// to avoid building messages that nobody receives.
+func HasMembers(protocol int, netns *inet.Namespace, group uint32) bool {
+	multicastMembers.mu.Lock()
+	defer multicastMembers.mu.Unlock()
+	for s := range multicastMembers.members[groupKey{protocol, group}] {
+		if s.netns == netns {
+			return true
+		}
+	}
+	return false
+}
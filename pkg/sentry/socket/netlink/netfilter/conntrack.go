@@ -0,0 +1,323 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"encoding/binary"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/nftables"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// processConntrackMessage handles a message of the conntrack subsystem
+// (NFNL_SUBSYS_CTNETLINK). See net/netfilter/nf_conntrack_netlink.c.
+func processConntrackMessage(stk *stack.Stack, req *request, ms *nlmsg.MessageSet) *syserr.Error {
+	it := stk.IPTables()
+	dump := req.hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+	switch msgType := linux.NFNLMsgType(req.hdr.Type); msgType {
+	case linux.IPCTNL_MSG_CT_GET, linux.IPCTNL_MSG_CT_GET_CTRZERO:
+		zero := msgType == linux.IPCTNL_MSG_CT_GET_CTRZERO
+		if dump {
+			filter, err := conntrackFilterOf(req)
+			if err != nil {
+				return err
+			}
+			// We always send back an NLMSG_DONE.
+			ms.Multi = true
+			for _, e := range it.ConntrackEntries(filter, zero) {
+				addConntrackMessage(ms, linux.IPCTNL_MSG_CT_NEW, 0 /* flags */, &e, true /* timeout */)
+			}
+			return nil
+		}
+		t, ok, err := conntrackTupleOf(req.attrs)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		e, ok := it.ConntrackEntry(t, zero)
+		if !ok {
+			return syserr.ErrNoFileOrDir
+		}
+		addConntrackMessage(ms, linux.IPCTNL_MSG_CT_NEW, 0 /* flags */, &e, true /* timeout */)
+		return nil
+	case linux.IPCTNL_MSG_CT_DELETE:
+		t, ok, err := conntrackTupleOf(req.attrs)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Deleting without a tuple flushes the table.
+			filter, err := conntrackFilterOf(req)
+			if err != nil {
+				return err
+			}
+			it.FlushConntrack(filter)
+			return nil
+		}
+		id, _ := req.attrs.BE32(linux.CTA_ID)
+		if _, err := it.DeleteConntrackEntry(t, id); err != nil {
+			return syserr.ErrNoFileOrDir
+		}
+		return nil
+	default:
+		// Entries can't be created or modified from userspace, and there
+		// are no per-CPU statistics.
+		return syserr.ErrNotSupported
+	}
+}
+
+// conntrackFilterOf returns the filter of the entries a dump or flush
+// applies to.
+func conntrackFilterOf(req *request) (stack.ConntrackFilter, *syserr.Error) {
+	var f stack.ConntrackFilter
+	switch req.family {
+	case linux.AF_UNSPEC:
+	case linux.AF_INET:
+		f.NetProto = header.IPv4ProtocolNumber
+	case linux.AF_INET6:
+		f.NetProto = header.IPv6ProtocolNumber
+	default:
+		return f, syserr.ErrAddressFamilyNotSupported
+	}
+	if mark, ok := req.attrs.BE32(linux.CTA_MARK); ok {
+		f.Mark = mark
+		f.MarkMask = ^uint32(0)
+		if mask, ok := req.attrs.BE32(linux.CTA_MARK_MASK); ok {
+			f.Mark &= mask
+			f.MarkMask = mask
+		}
+	}
+	return f, nil
+}
+
+// conntrackTupleOf returns the tuple of CTA_TUPLE_ORIG or CTA_TUPLE_REPLY,
+// and false if neither is present.
+func conntrackTupleOf(attrs nftables.Attrs) (stack.ConntrackTuple, bool, *syserr.Error) {
+	v, ok := attrs[linux.CTA_TUPLE_ORIG]
+	if !ok {
+		if v, ok = attrs[linux.CTA_TUPLE_REPLY]; !ok {
+			return stack.ConntrackTuple{}, false, nil
+		}
+	}
+	tupleAttrs, err := nftables.ParseAttrs(v)
+	if err != nil {
+		return stack.ConntrackTuple{}, false, syserr.ErrInvalidArgument
+	}
+	ipAttrs, err := nftables.ParseAttrs(tupleAttrs[linux.CTA_TUPLE_IP])
+	if err != nil {
+		return stack.ConntrackTuple{}, false, syserr.ErrInvalidArgument
+	}
+	protoAttrs, err := nftables.ParseAttrs(tupleAttrs[linux.CTA_TUPLE_PROTO])
+	if err != nil {
+		return stack.ConntrackTuple{}, false, syserr.ErrInvalidArgument
+	}
+
+	var t stack.ConntrackTuple
+	switch {
+	case len(ipAttrs[linux.CTA_IP_V4_SRC]) == header.IPv4AddressSize && len(ipAttrs[linux.CTA_IP_V4_DST]) == header.IPv4AddressSize:
+		t.NetProto = header.IPv4ProtocolNumber
+		t.SrcAddr = tcpip.AddrFromSlice(ipAttrs[linux.CTA_IP_V4_SRC])
+		t.DstAddr = tcpip.AddrFromSlice(ipAttrs[linux.CTA_IP_V4_DST])
+	case len(ipAttrs[linux.CTA_IP_V6_SRC]) == header.IPv6AddressSize && len(ipAttrs[linux.CTA_IP_V6_DST]) == header.IPv6AddressSize:
+		t.NetProto = header.IPv6ProtocolNumber
+		t.SrcAddr = tcpip.AddrFromSlice(ipAttrs[linux.CTA_IP_V6_SRC])
+		t.DstAddr = tcpip.AddrFromSlice(ipAttrs[linux.CTA_IP_V6_DST])
+	default:
+		return stack.ConntrackTuple{}, false, syserr.ErrInvalidArgument
+	}
+
+	num := protoAttrs[linux.CTA_PROTO_NUM]
+	if len(num) != 1 {
+		return stack.ConntrackTuple{}, false, syserr.ErrInvalidArgument
+	}
+	t.TransProto = tcpip.TransportProtocolNumber(num[0])
+	switch t.TransProto {
+	case header.ICMPv4ProtocolNumber, header.ICMPv6ProtocolNumber:
+		idAttr, typeAttr, request := uint16(linux.CTA_PROTO_ICMP_ID), uint16(linux.CTA_PROTO_ICMP_TYPE), uint8(header.ICMPv4Echo)
+		if t.TransProto == header.ICMPv6ProtocolNumber {
+			idAttr, typeAttr, request = linux.CTA_PROTO_ICMPV6_ID, linux.CTA_PROTO_ICMPV6_TYPE, uint8(header.ICMPv6EchoRequest)
+		}
+		id, typ := protoAttrs[idAttr], protoAttrs[typeAttr]
+		if len(id) != 2 || len(typ) != 1 {
+			return stack.ConntrackTuple{}, false, syserr.ErrInvalidArgument
+		}
+		// The identifier of echo connections is the source port of
+		// requests and the destination port of replies.
+		if typ[0] == request {
+			t.SrcPort = binary.BigEndian.Uint16(id)
+		} else {
+			t.DstPort = binary.BigEndian.Uint16(id)
+		}
+	default:
+		src, dst := protoAttrs[linux.CTA_PROTO_SRC_PORT], protoAttrs[linux.CTA_PROTO_DST_PORT]
+		if len(src) != 2 || len(dst) != 2 {
+			return stack.ConntrackTuple{}, false, syserr.ErrInvalidArgument
+		}
+		t.SrcPort = binary.BigEndian.Uint16(src)
+		t.DstPort = binary.BigEndian.Uint16(dst)
+	}
+	return t, true, nil
+}
+
+// putConntrackTuple adds a tuple attribute. reply is whether the tuple is
+// in the reply direction.
+func putConntrackTuple(w *attrWriter, atype uint16, t *stack.ConntrackTuple, reply bool) {
+	w.putNested(atype, func(w *attrWriter) {
+		w.putNested(linux.CTA_TUPLE_IP, func(w *attrWriter) {
+			if t.NetProto == header.IPv6ProtocolNumber {
+				w.put(linux.CTA_IP_V6_SRC, t.SrcAddr.AsSlice())
+				w.put(linux.CTA_IP_V6_DST, t.DstAddr.AsSlice())
+			} else {
+				w.put(linux.CTA_IP_V4_SRC, t.SrcAddr.AsSlice())
+				w.put(linux.CTA_IP_V4_DST, t.DstAddr.AsSlice())
+			}
+		})
+		w.putNested(linux.CTA_TUPLE_PROTO, func(w *attrWriter) {
+			w.putUint8(linux.CTA_PROTO_NUM, uint8(t.TransProto))
+			switch t.TransProto {
+			case header.ICMPv4ProtocolNumber:
+				typ, id := uint8(header.ICMPv4Echo), t.SrcPort
+				if reply {
+					typ, id = uint8(header.ICMPv4EchoReply), t.DstPort
+				}
+				w.putBE16(linux.CTA_PROTO_ICMP_ID, id)
+				w.putUint8(linux.CTA_PROTO_ICMP_TYPE, typ)
+				w.putUint8(linux.CTA_PROTO_ICMP_CODE, 0)
+			case header.ICMPv6ProtocolNumber:
+				typ, id := uint8(header.ICMPv6EchoRequest), t.SrcPort
+				if reply {
+					typ, id = uint8(header.ICMPv6EchoReply), t.DstPort
+				}
+				w.putBE16(linux.CTA_PROTO_ICMPV6_ID, id)
+				w.putUint8(linux.CTA_PROTO_ICMPV6_TYPE, typ)
+				w.putUint8(linux.CTA_PROTO_ICMPV6_CODE, 0)
+			default:
+				w.putBE16(linux.CTA_PROTO_SRC_PORT, t.SrcPort)
+				w.putBE16(linux.CTA_PROTO_DST_PORT, t.DstPort)
+			}
+		})
+	})
+}
+
+// putConntrackCounters adds a counters attribute.
+func putConntrackCounters(w *attrWriter, atype uint16, c *stack.ConntrackCounters) {
+	w.putNested(atype, func(w *attrWriter) {
+		w.putBE64(linux.CTA_COUNTERS_PACKETS, c.Packets)
+		w.putBE64(linux.CTA_COUNTERS_BYTES, c.Bytes)
+	})
+}
+
+// addConntrackMessage adds a message describing e to ms. The timeout is
+// omitted from the messages of destroyed entries, as on Linux.
+func addConntrackMessage(ms *nlmsg.MessageSet, msgType, flags uint16, e *stack.ConntrackEntry, timeout bool) {
+	status := uint32(linux.IPS_CONFIRMED)
+	if e.SeenReply {
+		status |= linux.IPS_SEEN_REPLY
+	}
+	if e.Assured {
+		status |= linux.IPS_ASSURED
+	}
+	if e.SrcNAT {
+		status |= linux.IPS_SRC_NAT | linux.IPS_SRC_NAT_DONE
+	}
+	if e.DstNAT {
+		status |= linux.IPS_DST_NAT | linux.IPS_DST_NAT_DONE
+	}
+
+	var attrs attrWriter
+	putConntrackTuple(&attrs, linux.CTA_TUPLE_ORIG, &e.Original, false /* reply */)
+	putConntrackTuple(&attrs, linux.CTA_TUPLE_REPLY, &e.Reply, true /* reply */)
+	attrs.putBE32(linux.CTA_STATUS, status)
+	if timeout {
+		attrs.putBE32(linux.CTA_TIMEOUT, uint32(e.Timeout/time.Second))
+	}
+	putConntrackCounters(&attrs, linux.CTA_COUNTERS_ORIG, &e.OriginalCounters)
+	putConntrackCounters(&attrs, linux.CTA_COUNTERS_REPLY, &e.ReplyCounters)
+	if e.Original.TransProto == header.TCPProtocolNumber {
+		attrs.putNested(linux.CTA_PROTOINFO, func(w *attrWriter) {
+			w.putNested(linux.CTA_PROTOINFO_TCP, func(w *attrWriter) {
+				// The states of the stack have the values of Linux.
+				w.putUint8(linux.CTA_PROTOINFO_TCP_STATE, uint8(e.TCPState))
+			})
+		})
+	}
+	attrs.putBE32(linux.CTA_MARK, e.Mark)
+	attrs.putBE32(linux.CTA_ID, e.ID)
+	attrs.putBE32(linux.CTA_USE, 1)
+
+	family := uint8(linux.AF_INET)
+	if e.Original.NetProto == header.IPv6ProtocolNumber {
+		family = linux.AF_INET6
+	}
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type:  linux.NFNL_SUBSYS_CTNETLINK<<8 | msgType,
+		Flags: flags,
+	})
+	m.Put(&linux.NetFilterGenMsg{
+		Family:  family,
+		Version: linux.NFNETLINK_V0,
+	})
+	m.Put(primitive.AsByteSlice(attrs))
+}
+
+// conntrackDispatcher reports the conntrack events of a stack to the members
+// of the multicast groups of its network namespace.
+//
+// +stateify savable
+type conntrackDispatcher struct {
+	k     *kernel.Kernel
+	netns *inet.Namespace
+}
+
+var _ stack.ConntrackDispatcher = (*conntrackDispatcher)(nil)
+
+// OnConntrackEvent implements stack.ConntrackDispatcher.OnConntrackEvent.
+func (d *conntrackDispatcher) OnConntrackEvent(ev stack.ConntrackEvent, e stack.ConntrackEntry) {
+	var (
+		group   uint32
+		msgType uint16
+		flags   uint16
+	)
+	switch ev {
+	case stack.ConntrackEventNew:
+		group, msgType, flags = linux.NFNLGRP_CONNTRACK_NEW, linux.IPCTNL_MSG_CT_NEW, linux.NLM_F_CREATE|linux.NLM_F_EXCL
+	case stack.ConntrackEventUpdate:
+		group, msgType = linux.NFNLGRP_CONNTRACK_UPDATE, linux.IPCTNL_MSG_CT_NEW
+	case stack.ConntrackEventDestroy:
+		group, msgType = linux.NFNLGRP_CONNTRACK_DESTROY, linux.IPCTNL_MSG_CT_DELETE
+	default:
+		return
+	}
+	// Events are reported while processing packets, so don't build
+	// messages nobody receives.
+	if !netlink.HasMembers(linux.NETLINK_NETFILTER, d.netns, group) {
+		return
+	}
+	ms := nlmsg.NewMessageSet(0, 0)
+	addConntrackMessage(ms, msgType, flags, &e, ev != stack.ConntrackEventDestroy /* timeout */)
+	netlink.Broadcast(d.k.SupervisorContext(), linux.NETLINK_NETFILTER, d.netns, group, ms)
+}
@@ -0,0 +1,343 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bits"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// attrWriter serializes netlink attributes.
+type attrWriter []byte
+
+// put adds an attribute with the given payload.
+func (w *attrWriter) put(atype uint16, v []byte) {
+	l := linux.NetlinkAttrHeaderSize + len(v)
+	*w = hostarch.ByteOrder.AppendUint16(*w, uint16(l))
+	*w = hostarch.ByteOrder.AppendUint16(*w, atype)
+	*w = append(*w, v...)
+	for i := l; i < bits.AlignUp(l, linux.NLA_ALIGNTO); i++ {
+		*w = append(*w, 0)
+	}
+}
+
+// putString adds a NUL-terminated string attribute.
+func (w *attrWriter) putString(atype uint16, s string) {
+	w.put(atype, append([]byte(s), 0))
+}
+
+// putUint8 adds an 8-bit attribute.
+func (w *attrWriter) putUint8(atype uint16, v uint8) {
+	w.put(atype, []byte{v})
+}
+
+// putBE16 adds a big-endian 16-bit attribute.
+func (w *attrWriter) putBE16(atype uint16, v uint16) {
+	w.put(atype, binary.BigEndian.AppendUint16(nil, v))
+}
+
+// putBE32 adds a big-endian 32-bit attribute.
+func (w *attrWriter) putBE32(atype uint16, v uint32) {
+	w.put(atype, binary.BigEndian.AppendUint32(nil, v))
+}
+
+// putBE64 adds a big-endian 64-bit attribute.
+func (w *attrWriter) putBE64(atype uint16, v uint64) {
+	w.put(atype, binary.BigEndian.AppendUint64(nil, v))
+}
+
+// putNested adds a nested attribute whose contents are written by fn.
+func (w *attrWriter) putNested(atype uint16, fn func(w *attrWriter)) {
+	var nested attrWriter
+	fn(&nested)
+	w.put(atype|linux.NLA_F_NESTED, nested)
+}
+
+// addMessage adds an nf_tables message with the given type and attributes to
+// ms.
+func addMessage(ms *nlmsg.MessageSet, msgType uint16, family uint8, gen uint32, attrs attrWriter) {
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.NFNL_SUBSYS_NFTABLES<<8 | msgType,
+	})
+	m.Put(&linux.NetFilterGenMsg{
+		Family:     family,
+		Version:    linux.NFNETLINK_V0,
+		ResourceID: socket.Htons(uint16(gen)),
+	})
+	if len(attrs) > 0 {
+		m.Put(primitive.AsByteSlice(attrs))
+	}
+}
+
+// get handles a query message.
+func (p *Protocol) get(ctx context.Context, stk *stack.Stack, req *request, msgType uint16, ms *nlmsg.MessageSet) *syserr.Error {
+	m := &model{}
+	var gen uint32
+	if rs := getRuleset(stk, false /* create */); rs != nil {
+		rs.mu.Lock()
+		m, gen = rs.model, rs.gen
+		rs.mu.Unlock()
+	}
+
+	dump := req.hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+	if dump {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+	}
+
+	switch msgType {
+	case linux.NFT_MSG_GETTABLE:
+		return getTables(m, gen, req, dump, ms)
+	case linux.NFT_MSG_GETCHAIN:
+		return getChains(m, gen, req, dump, ms)
+	case linux.NFT_MSG_GETRULE:
+		return getRules(m, gen, req, dump, ms)
+	case linux.NFT_MSG_GETSET:
+		return getSets(m, gen, req, dump, ms)
+	case linux.NFT_MSG_GETSETELEM:
+		return getSetElems(m, gen, req, ms)
+	case linux.NFT_MSG_GETGEN:
+		var attrs attrWriter
+		attrs.putBE32(linux.NFTA_GEN_ID, gen)
+		if t := kernel.TaskFromContext(ctx); t != nil {
+			attrs.putBE32(linux.NFTA_GEN_PROC_PID, uint32(t.PIDNamespace().IDOfThreadGroup(t.ThreadGroup())))
+			attrs.putString(linux.NFTA_GEN_PROC_NAME, t.Name())
+		}
+		addMessage(ms, linux.NFT_MSG_NEWGEN, linux.NFPROTO_UNSPEC, gen, attrs)
+		return nil
+	default:
+		// Stateful objects and flowtables are not supported, so there are
+		// never any to dump.
+		if dump {
+			return nil
+		}
+		return syserr.ErrNoFileOrDir
+	}
+}
+
+// matchesFamily returns whether a table belongs to the requested family.
+func (req *request) matchesFamily(t *table) bool {
+	return req.family == linux.NFPROTO_UNSPEC || req.family == t.family
+}
+
+// matchesName returns whether name matches the optional name attribute of the
+// given type.
+func (req *request) matchesName(atype uint16, name string) bool {
+	want, ok := req.attrs.String(atype)
+	return !ok || want == name
+}
+
+// getTables handles NFT_MSG_GETTABLE.
+func getTables(m *model, gen uint32, req *request, dump bool, ms *nlmsg.MessageSet) *syserr.Error {
+	if _, ok := req.attrs[linux.NFTA_TABLE_NAME]; !dump && !ok {
+		return syserr.ErrInvalidArgument
+	}
+	found := false
+	for _, t := range m.tables {
+		if !req.matchesFamily(t) || (!dump && !req.matchesName(linux.NFTA_TABLE_NAME, t.name)) {
+			continue
+		}
+		var attrs attrWriter
+		attrs.putString(linux.NFTA_TABLE_NAME, t.name)
+		attrs.putBE32(linux.NFTA_TABLE_FLAGS, t.flags)
+		attrs.putBE32(linux.NFTA_TABLE_USE, uint32(len(t.chains)+len(t.sets)))
+		attrs.putBE64(linux.NFTA_TABLE_HANDLE, t.handle)
+		if t.userdata != nil {
+			attrs.put(linux.NFTA_TABLE_USERDATA, t.userdata)
+		}
+		addMessage(ms, linux.NFT_MSG_NEWTABLE, t.family, gen, attrs)
+		found = true
+		if !dump {
+			break
+		}
+	}
+	if !dump && !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// getChains handles NFT_MSG_GETCHAIN.
+func getChains(m *model, gen uint32, req *request, dump bool, ms *nlmsg.MessageSet) *syserr.Error {
+	found := false
+	for _, t := range m.tables {
+		if !req.matchesFamily(t) || !req.matchesName(linux.NFTA_CHAIN_TABLE, t.name) {
+			continue
+		}
+		for _, ch := range t.chains {
+			if !dump && !req.matchesName(linux.NFTA_CHAIN_NAME, ch.name) {
+				continue
+			}
+			var attrs attrWriter
+			attrs.putString(linux.NFTA_CHAIN_TABLE, t.name)
+			attrs.putString(linux.NFTA_CHAIN_NAME, ch.name)
+			attrs.putBE64(linux.NFTA_CHAIN_HANDLE, ch.handle)
+			if b := ch.base; b != nil {
+				attrs.putNested(linux.NFTA_CHAIN_HOOK, func(w *attrWriter) {
+					w.putBE32(linux.NFTA_HOOK_HOOKNUM, b.hooknum)
+					w.putBE32(linux.NFTA_HOOK_PRIORITY, uint32(b.priority))
+				})
+				attrs.putBE32(linux.NFTA_CHAIN_POLICY, b.policy)
+				attrs.putString(linux.NFTA_CHAIN_TYPE, b.ctype)
+			}
+			if ch.flags != 0 {
+				attrs.putBE32(linux.NFTA_CHAIN_FLAGS, ch.flags)
+			}
+			attrs.putBE32(linux.NFTA_CHAIN_USE, 0)
+			if ch.userdata != nil {
+				attrs.put(linux.NFTA_CHAIN_USERDATA, ch.userdata)
+			}
+			addMessage(ms, linux.NFT_MSG_NEWCHAIN, t.family, gen, attrs)
+			found = true
+			if !dump {
+				return nil
+			}
+		}
+	}
+	if !dump && !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// getRules handles NFT_MSG_GETRULE.
+func getRules(m *model, gen uint32, req *request, dump bool, ms *nlmsg.MessageSet) *syserr.Error {
+	handle, hasHandle := req.attrs.BE64(linux.NFTA_RULE_HANDLE)
+	if !dump && !hasHandle {
+		return syserr.ErrInvalidArgument
+	}
+	found := false
+	for _, t := range m.tables {
+		if !req.matchesFamily(t) || !req.matchesName(linux.NFTA_RULE_TABLE, t.name) {
+			continue
+		}
+		for _, ch := range t.chains {
+			if !req.matchesName(linux.NFTA_RULE_CHAIN, ch.name) {
+				continue
+			}
+			for _, r := range ch.rules {
+				if !dump && r.handle != handle {
+					continue
+				}
+				var attrs attrWriter
+				attrs.putString(linux.NFTA_RULE_TABLE, t.name)
+				attrs.putString(linux.NFTA_RULE_CHAIN, ch.name)
+				attrs.putBE64(linux.NFTA_RULE_HANDLE, r.handle)
+				attrs.put(linux.NFTA_RULE_EXPRESSIONS|linux.NLA_F_NESTED, r.exprs)
+				if r.userdata != nil {
+					attrs.put(linux.NFTA_RULE_USERDATA, r.userdata)
+				}
+				addMessage(ms, linux.NFT_MSG_NEWRULE, t.family, gen, attrs)
+				found = true
+				if !dump {
+					return nil
+				}
+			}
+		}
+	}
+	if !dump && !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// getSets handles NFT_MSG_GETSET.
+func getSets(m *model, gen uint32, req *request, dump bool, ms *nlmsg.MessageSet) *syserr.Error {
+	found := false
+	for _, t := range m.tables {
+		if !req.matchesFamily(t) || !req.matchesName(linux.NFTA_SET_TABLE, t.name) {
+			continue
+		}
+		for _, s := range t.sets {
+			if !dump && !req.matchesName(linux.NFTA_SET_NAME, s.name) {
+				continue
+			}
+			var attrs attrWriter
+			attrs.putString(linux.NFTA_SET_TABLE, t.name)
+			attrs.putString(linux.NFTA_SET_NAME, s.name)
+			attrs.putBE64(linux.NFTA_SET_HANDLE, s.handle)
+			if s.flags != 0 {
+				attrs.putBE32(linux.NFTA_SET_FLAGS, s.flags)
+			}
+			attrs.putBE32(linux.NFTA_SET_KEY_TYPE, s.keyType)
+			attrs.putBE32(linux.NFTA_SET_KEY_LEN, s.keyLen)
+			if s.policy != nil {
+				attrs.putBE32(linux.NFTA_SET_POLICY, *s.policy)
+			}
+			if s.desc != nil {
+				attrs.put(linux.NFTA_SET_DESC|linux.NLA_F_NESTED, s.desc)
+			}
+			if s.userdata != nil {
+				attrs.put(linux.NFTA_SET_USERDATA, s.userdata)
+			}
+			addMessage(ms, linux.NFT_MSG_NEWSET, t.family, gen, attrs)
+			found = true
+			if !dump {
+				return nil
+			}
+		}
+	}
+	if !dump && !found {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
+// getSetElems handles NFT_MSG_GETSETELEM.
+func getSetElems(m *model, gen uint32, req *request, ms *nlmsg.MessageSet) *syserr.Error {
+	tableName, ok := req.attrs.String(linux.NFTA_SET_ELEM_LIST_TABLE)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	setName, ok := req.attrs.String(linux.NFTA_SET_ELEM_LIST_SET)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	_, t := m.findTable(req.family, tableName, 0)
+	if t == nil {
+		return syserr.ErrNoFileOrDir
+	}
+	_, s := t.findSet(setName, 0)
+	if s == nil {
+		return syserr.ErrNoFileOrDir
+	}
+	var attrs attrWriter
+	attrs.putString(linux.NFTA_SET_ELEM_LIST_TABLE, t.name)
+	attrs.putString(linux.NFTA_SET_ELEM_LIST_SET, s.name)
+	attrs.putNested(linux.NFTA_SET_ELEM_LIST_ELEMENTS, func(w *attrWriter) {
+		for _, e := range s.elems {
+			w.putNested(linux.NFTA_LIST_ELEM, func(w *attrWriter) {
+				w.putNested(linux.NFTA_SET_ELEM_KEY, func(w *attrWriter) {
+					w.put(linux.NFTA_DATA_VALUE, e.key)
+				})
+				if e.flags != 0 {
+					w.putBE32(linux.NFTA_SET_ELEM_FLAGS, e.flags)
+				}
+			})
+		}
+	})
+	addMessage(ms, linux.NFT_MSG_NEWSETELEM, t.family, gen, attrs)
+	return nil
+}
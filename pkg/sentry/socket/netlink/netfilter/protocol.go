@@ -0,0 +1,249 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netfilter provides a NETLINK_NETFILTER socket protocol.
+//
+// The nf_tables (NFNL_SUBSYS_NFTABLES) and conntrack (NFNL_SUBSYS_CTNETLINK)
+// subsystems are supported. Rulesets are modified by batches of messages
+// (NFNL_MSG_BATCH_BEGIN ... NFNL_MSG_BATCH_END) which are applied atomically,
+// and are evaluated by pkg/tcpip/nftables alongside legacy iptables.
+// Conntrack entries can be dumped, queried and deleted, and their events are
+// reported to the NFNLGRP_CONNTRACK_* multicast groups.
+package netfilter
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip/nftables"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// nfnlBatchGenID is the NFNL_BATCH_GENID attribute of NFNL_MSG_BATCH_BEGIN,
+// from uapi/linux/netfilter/nfnetlink.h.
+const nfnlBatchGenID = 1
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct {
+	// batch is the batch being received, if any. Batches are not preserved
+	// across save/restore; an interrupted batch is discarded as if it were
+	// aborted.
+	batch *batch `state:"nosave"`
+}
+
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
+
+// batch is a transaction of nf_tables changes.
+type batch struct {
+	rs *Ruleset
+
+	// model is the ruleset as modified by the batch so far.
+	model *model
+
+	// gen is the ruleset generation the batch is based on.
+	gen uint32
+
+	// failed is set if any message in the batch failed, in which case the
+	// batch is aborted rather than committed.
+	failed bool
+
+	// sets maps the transaction-local IDs of sets created by the batch to
+	// their names.
+	sets map[uint32]string
+}
+
+// NewProtocol creates a NETLINK_NETFILTER netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	netns := t.NetworkNamespace()
+	if stk, ok := netns.Stack().(*netstack.Stack); ok {
+		stk.Stack.IPTables().SetConntrackDispatcher(&conntrackDispatcher{
+			k:     t.Kernel(),
+			netns: netns,
+		})
+	}
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_NETFILTER
+}
+
+// CanJoinGroup implements netlink.MulticastProtocol.CanJoinGroup.
+func (p *Protocol) CanJoinGroup(ctx context.Context, s *netlink.Socket, group uint32) *syserr.Error {
+	if group > linux.NFNLGRP_MAX {
+		return syserr.ErrInvalidArgument
+	}
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrNotPermitted
+	}
+	return nil
+}
+
+// netstackOf returns the netstack stack of the socket, or nil if the socket
+// isn't backed by netstack.
+func netstackOf(s *netlink.Socket) *stack.Stack {
+	if stk, ok := s.Stack().(*netstack.Stack); ok {
+		return stk.Stack
+	}
+	return nil
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	hdr := msg.Header()
+
+	// All netfilter netlink messages require CAP_NET_ADMIN. See
+	// net/netfilter/nfnetlink.c:nfnetlink_rcv.
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrNotPermitted
+	}
+
+	var nfgen linux.NetFilterGenMsg
+	attrs, ok := msg.GetData(&nfgen)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	parsed, err := nftables.ParseAttrs(attrs)
+	if err != nil {
+		return syserr.ErrInvalidArgument
+	}
+
+	stk := netstackOf(s)
+	if stk == nil {
+		return syserr.ErrNotSupported
+	}
+
+	switch hdr.Type {
+	case linux.NFNL_MSG_BATCH_BEGIN:
+		return p.beginBatch(stk, &nfgen, parsed)
+	case linux.NFNL_MSG_BATCH_END:
+		return p.endBatch()
+	}
+
+	req := request{
+		hdr:    hdr,
+		family: nfgen.Family,
+		attrs:  parsed,
+	}
+	switch linux.NFNLSubsysID(hdr.Type) {
+	case linux.NFNL_SUBSYS_NFTABLES:
+	case linux.NFNL_SUBSYS_CTNETLINK:
+		return processConntrackMessage(stk, &req, ms)
+	default:
+		return syserr.ErrNotSupported
+	}
+	msgType := linux.NFNLMsgType(hdr.Type)
+
+	if p.batch == nil {
+		if !isGetMessage(msgType) {
+			// Modifications are only accepted within a batch.
+			return syserr.ErrInvalidArgument
+		}
+		return p.get(ctx, stk, &req, msgType, ms)
+	}
+
+	if err := p.batch.apply(&req, msgType); err != nil {
+		p.batch.failed = true
+		return err
+	}
+	return nil
+}
+
+// beginBatch handles NFNL_MSG_BATCH_BEGIN.
+func (p *Protocol) beginBatch(stk *stack.Stack, nfgen *linux.NetFilterGenMsg, attrs nftables.Attrs) *syserr.Error {
+	// An unterminated batch is aborted by a new one.
+	p.batch = nil
+
+	if socket.Ntohs(nfgen.ResourceID) != linux.NFNL_SUBSYS_NFTABLES {
+		return syserr.ErrInvalidArgument
+	}
+
+	rs := getRuleset(stk, true /* create */)
+	rs.mu.Lock()
+	b := &batch{
+		rs:    rs,
+		model: rs.model.clone(),
+		gen:   rs.gen,
+		sets:  make(map[uint32]string),
+	}
+	rs.mu.Unlock()
+	p.batch = b
+
+	if genID, ok := attrs.BE32(nfnlBatchGenID); ok && genID != b.gen {
+		// The ruleset has changed since userspace last read it; userspace is
+		// expected to retry.
+		b.failed = true
+		return syserr.ErrShouldRestart
+	}
+	return nil
+}
+
+// endBatch handles NFNL_MSG_BATCH_END, committing the batch unless any of its
+// messages failed.
+func (p *Protocol) endBatch() *syserr.Error {
+	b := p.batch
+	p.batch = nil
+	if b == nil {
+		return syserr.ErrInvalidArgument
+	}
+	if b.failed {
+		return nil
+	}
+
+	b.rs.mu.Lock()
+	defer b.rs.mu.Unlock()
+	if b.rs.gen != b.gen {
+		// Another batch was committed concurrently.
+		return syserr.ErrShouldRestart
+	}
+	if err := b.rs.commit(b.model); err != nil {
+		return syserr.ErrInvalidArgument
+	}
+	return nil
+}
+
+// isGetMessage returns whether the nf_tables message type is a query.
+func isGetMessage(msgType uint16) bool {
+	switch msgType {
+	case linux.NFT_MSG_GETTABLE, linux.NFT_MSG_GETCHAIN, linux.NFT_MSG_GETRULE,
+		linux.NFT_MSG_GETSET, linux.NFT_MSG_GETSETELEM, linux.NFT_MSG_GETGEN,
+		linux.NFT_MSG_GETOBJ, linux.NFT_MSG_GETFLOWTABLE:
+		return true
+	default:
+		return false
+	}
+}
+
+// request is a decoded netfilter message.
+type request struct {
+	hdr    linux.NetlinkMessageHeader
+	family uint8
+	attrs  nftables.Attrs
+}
+
+// init registers the NETLINK_NETFILTER provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_NETFILTER, NewProtocol)
+}
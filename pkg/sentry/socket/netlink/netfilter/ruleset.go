@@ -0,0 +1,444 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip/nftables"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// Ruleset is the nf_tables ruleset of a network stack.
+//
+// The ruleset is kept in its netlink (declarative) form so that it can be
+// dumped back to userspace, and is compiled into an nftables.NFTables each
+// time a batch is committed. The compiled ruleset is evaluated by the stack
+// via stack.PacketFilter. Only the model is saved; it is compiled again when
+// the stack is restored.
+//
+// +stateify savable
+type Ruleset struct {
+	// stk is the stack the ruleset filters packets for.
+	stk *stack.Stack
+
+	// mu serializes batch commits and protects the fields below.
+	mu sync.Mutex `state:"nosave"`
+
+	// model is the committed ruleset.
+	model *model
+
+	// gen is the ruleset generation, incremented by every commit.
+	gen uint32
+
+	// filter is the compiled form of model.
+	filter atomic.Pointer[nftables.NFTables] `state:"nosave"`
+}
+
+var (
+	_ stack.PacketFilter     = (*Ruleset)(nil)
+	_ stack.RestoredEndpoint = (*Ruleset)(nil)
+)
+
+// rulesetMu serializes the creation of Rulesets.
+var rulesetMu sync.Mutex
+
+// getRuleset returns the Ruleset of the stack, creating and installing it if
+// create is true. It returns nil if the stack has no ruleset and create is
+// false.
+func getRuleset(stk *stack.Stack, create bool) *Ruleset {
+	rulesetMu.Lock()
+	defer rulesetMu.Unlock()
+
+	if rs, ok := stk.IPTables().PacketFilter().(*Ruleset); ok {
+		return rs
+	}
+	if !create {
+		return nil
+	}
+	rs := &Ruleset{
+		stk:   stk,
+		model: &model{nextHandle: 1},
+	}
+	stk.IPTables().SetPacketFilter(rs)
+	return rs
+}
+
+// CheckPacket implements stack.PacketFilter.CheckPacket.
+func (rs *Ruleset) CheckPacket(hook stack.Hook, pkt *stack.PacketBuffer) bool {
+	nf := rs.filter.Load()
+	if nf == nil {
+		return true
+	}
+	return nf.CheckPacket(hook, pkt)
+}
+
+// Generation returns the current ruleset generation.
+func (rs *Ruleset) Generation() uint32 {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.gen
+}
+
+// commit compiles m and installs it as the committed ruleset.
+//
+// Preconditions: rs.mu is locked.
+func (rs *Ruleset) commit(m *model) error {
+	nf, err := m.compile(rs.stk)
+	if err != nil {
+		return err
+	}
+	rs.model = m
+	rs.gen++
+	rs.filter.Store(nf)
+	return nil
+}
+
+// afterLoad is invoked by stateify.
+func (rs *Ruleset) afterLoad(ctx context.Context) {
+	// The compiled ruleset needs the clock and random number generator of
+	// the stack, which are only usable once the stack is restored.
+	stack.RestoreStackFromContext(ctx).RegisterRestoredEndpoint(rs)
+}
+
+// Restore implements stack.RestoredEndpoint.Restore.
+func (rs *Ruleset) Restore(*stack.Stack) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	nf, err := rs.model.compile(rs.stk)
+	if err != nil {
+		// The model compiled when it was committed.
+		panic(fmt.Sprintf("failed to compile restored nf_tables ruleset: %v", err))
+	}
+	rs.filter.Store(nf)
+}
+
+// model is the declarative form of an nf_tables ruleset.
+//
+// +stateify savable
+type model struct {
+	// tables are the ruleset's tables in creation order.
+	tables []*table
+
+	// nextHandle is the handle assigned to the next created object.
+	nextHandle uint64
+}
+
+// table is an nf_tables table.
+//
+// +stateify savable
+type table struct {
+	family   uint8
+	name     string
+	handle   uint64
+	flags    uint32
+	userdata []byte
+	chains   []*chain
+	sets     []*set
+}
+
+// chain is an nf_tables chain.
+//
+// +stateify savable
+type chain struct {
+	name     string
+	handle   uint64
+	flags    uint32
+	userdata []byte
+
+	// base is set for base chains.
+	base *baseChain
+
+	rules []*rule
+}
+
+// baseChain holds the hook of a base chain.
+//
+// +stateify savable
+type baseChain struct {
+	hooknum  uint32
+	priority int32
+	policy   uint32
+	ctype    string
+	dev      string
+}
+
+// rule is an nf_tables rule. Rules are immutable once added to a model.
+//
+// +stateify savable
+type rule struct {
+	handle uint64
+
+	// exprs is the NFTA_RULE_EXPRESSIONS payload.
+	exprs []byte
+
+	userdata []byte
+
+	// setIDs maps the transaction-local set IDs referenced by the rule's
+	// lookups to set names, as set IDs are only meaningful within the batch
+	// that created the rule.
+	setIDs map[uint32]string
+}
+
+// set is an nf_tables set.
+//
+// +stateify savable
+type set struct {
+	name     string
+	handle   uint64
+	flags    uint32
+	keyType  uint32
+	keyLen   uint32
+	policy   *uint32
+	desc     []byte
+	userdata []byte
+	elems    []setElem
+}
+
+// setElem is an element of a set.
+//
+// +stateify savable
+type setElem struct {
+	key   []byte
+	flags uint32
+}
+
+// clone returns a copy of m that can be modified without affecting m.
+func (m *model) clone() *model {
+	c := &model{
+		tables:     make([]*table, 0, len(m.tables)),
+		nextHandle: m.nextHandle,
+	}
+	for _, t := range m.tables {
+		tc := *t
+		tc.chains = make([]*chain, 0, len(t.chains))
+		for _, ch := range t.chains {
+			chc := *ch
+			if ch.base != nil {
+				b := *ch.base
+				chc.base = &b
+			}
+			chc.rules = slices.Clone(ch.rules)
+			tc.chains = append(tc.chains, &chc)
+		}
+		tc.sets = make([]*set, 0, len(t.sets))
+		for _, s := range t.sets {
+			sc := *s
+			sc.elems = slices.Clone(s.elems)
+			tc.sets = append(tc.sets, &sc)
+		}
+		c.tables = append(c.tables, &tc)
+	}
+	return c
+}
+
+// newHandle allocates a new object handle.
+func (m *model) newHandle() uint64 {
+	h := m.nextHandle
+	m.nextHandle++
+	return h
+}
+
+// findTable returns the table with the given family and name or handle.
+func (m *model) findTable(family uint8, name string, handle uint64) (int, *table) {
+	for i, t := range m.tables {
+		if t.family == family && ((name != "" && t.name == name) || (name == "" && t.handle == handle)) {
+			return i, t
+		}
+	}
+	return -1, nil
+}
+
+// findChain returns the chain with the given name or handle.
+func (t *table) findChain(name string, handle uint64) (int, *chain) {
+	for i, ch := range t.chains {
+		if (name != "" && ch.name == name) || (name == "" && ch.handle == handle) {
+			return i, ch
+		}
+	}
+	return -1, nil
+}
+
+// findSet returns the set with the given name or handle.
+func (t *table) findSet(name string, handle uint64) (int, *set) {
+	for i, s := range t.sets {
+		if (name != "" && s.name == name) || (name == "" && s.handle == handle) {
+			return i, s
+		}
+	}
+	return -1, nil
+}
+
+// findRule returns the index of the rule with the given handle.
+func (ch *chain) findRule(handle uint64) int {
+	return slices.IndexFunc(ch.rules, func(r *rule) bool { return r.handle == handle })
+}
+
+// addressFamily returns the nftables address family of an NFPROTO_* value.
+func addressFamily(family uint8) (nftables.AddressFamily, bool) {
+	switch family {
+	case linux.NFPROTO_IPV4:
+		return nftables.IP, true
+	case linux.NFPROTO_IPV6:
+		return nftables.IP6, true
+	case linux.NFPROTO_INET:
+		return nftables.Inet, true
+	case linux.NFPROTO_ARP:
+		return nftables.Arp, true
+	case linux.NFPROTO_BRIDGE:
+		return nftables.Bridge, true
+	case linux.NFPROTO_NETDEV:
+		return nftables.Netdev, true
+	default:
+		return 0, false
+	}
+}
+
+// hooks maps NF_INET_* hook numbers to nftables hooks.
+var hooks = [linux.NF_INET_NUMHOOKS]nftables.Hook{
+	linux.NF_INET_PRE_ROUTING:  nftables.Prerouting,
+	linux.NF_INET_LOCAL_IN:     nftables.Input,
+	linux.NF_INET_FORWARD:      nftables.Forward,
+	linux.NF_INET_LOCAL_OUT:    nftables.Output,
+	linux.NF_INET_POST_ROUTING: nftables.Postrouting,
+}
+
+// chainTypes maps chain type names to nftables base chain types.
+var chainTypes = map[string]nftables.BaseChainType{
+	"filter": nftables.BaseChainTypeFilter,
+	"nat":    nftables.BaseChainTypeNat,
+	"route":  nftables.BaseChainTypeRoute,
+}
+
+// info returns the nftables base chain info of a base chain.
+func (b *baseChain) info() (*nftables.BaseChainInfo, error) {
+	if b.hooknum >= linux.NF_INET_NUMHOOKS {
+		return nil, fmt.Errorf("unsupported hook %d", b.hooknum)
+	}
+	bcType, ok := chainTypes[b.ctype]
+	if !ok {
+		return nil, fmt.Errorf("unsupported chain type %q", b.ctype)
+	}
+	return nftables.NewBaseChainInfo(bcType, hooks[b.hooknum], nftables.NewIntPriority(int(b.priority)), b.dev, b.policy == linux.NF_DROP), nil
+}
+
+// newSet creates an empty nftables set for s.
+func (s *set) newSet() (*nftables.Set, error) {
+	return nftables.NewSet(s.name, int(s.keyLen), s.flags&linux.NFT_SET_INTERVAL != 0)
+}
+
+// setResolver returns a resolver for the sets referenced by lookups, given
+// the table's sets by name. ids maps transaction-local set IDs to set names
+// and may be nil.
+func setResolver(sets map[string]*nftables.Set, ids map[uint32]string) nftables.SetResolver {
+	return func(name string, id uint32, hasID bool) (*nftables.Set, error) {
+		if s, ok := sets[name]; ok {
+			return s, nil
+		}
+		if hasID {
+			if s, ok := sets[ids[id]]; ok {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("set %q does not exist", name)
+	}
+}
+
+// addExpressions decodes the rule's expressions into r.
+func addExpressions(r *nftables.Rule, exprs []byte, resolve nftables.SetResolver) error {
+	elems, err := nftables.ParseList(exprs)
+	if err != nil {
+		return err
+	}
+	for _, elem := range elems {
+		attrs, err := nftables.ParseAttrs(elem)
+		if err != nil {
+			return err
+		}
+		name, ok := attrs.String(linux.NFTA_EXPR_NAME)
+		if !ok {
+			return fmt.Errorf("expression without name")
+		}
+		if err := r.AddExpression(name, attrs[linux.NFTA_EXPR_DATA], resolve); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compile builds the nftables representation of m.
+//
+// TODO(b/345684870): Preserve counters across commits.
+func (m *model) compile(stk *stack.Stack) (*nftables.NFTables, error) {
+	nf := nftables.NewNFTables(stk.Clock(), stk.SecureRNG())
+	for _, t := range m.tables {
+		family, ok := addressFamily(t.family)
+		if !ok {
+			return nil, fmt.Errorf("unsupported family %d", t.family)
+		}
+		nt, err := nf.CreateTable(family, t.name, "")
+		if err != nil {
+			return nil, err
+		}
+		nt.SetDormant(t.flags&linux.NFT_TABLE_F_DORMANT != 0)
+
+		sets := make(map[string]*nftables.Set, len(t.sets))
+		for _, s := range t.sets {
+			ns, err := s.newSet()
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range s.elems {
+				if err := ns.AddElement(e.key, e.flags&linux.NFT_SET_ELEM_INTERVAL_END != 0); err != nil {
+					return nil, err
+				}
+			}
+			sets[s.name] = ns
+		}
+
+		for _, ch := range t.chains {
+			var info *nftables.BaseChainInfo
+			if ch.base != nil {
+				if info, err = ch.base.info(); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := nt.AddChain(ch.name, info, "", true); err != nil {
+				return nil, err
+			}
+		}
+		for _, ch := range t.chains {
+			nch, err := nt.GetChain(ch.name)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range ch.rules {
+				nr := &nftables.Rule{}
+				if err := addExpressions(nr, r.exprs, setResolver(sets, r.setIDs)); err != nil {
+					return nil, err
+				}
+				if err := nch.RegisterRule(nr, -1); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return nf, nil
+}
@@ -0,0 +1,723 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netfilter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip/nftables"
+)
+
+// Set flags that are supported by NFT_MSG_NEWSET.
+const supportedSetFlags = linux.NFT_SET_ANONYMOUS | linux.NFT_SET_CONSTANT | linux.NFT_SET_INTERVAL
+
+// apply applies a modification message to the batch.
+func (b *batch) apply(req *request, msgType uint16) *syserr.Error {
+	switch msgType {
+	case linux.NFT_MSG_NEWTABLE:
+		return b.newTable(req)
+	case linux.NFT_MSG_DELTABLE, linux.NFT_MSG_DESTROYTABLE:
+		return b.delTable(req, msgType == linux.NFT_MSG_DESTROYTABLE)
+	case linux.NFT_MSG_NEWCHAIN:
+		return b.newChain(req)
+	case linux.NFT_MSG_DELCHAIN, linux.NFT_MSG_DESTROYCHAIN:
+		return b.delChain(req, msgType == linux.NFT_MSG_DESTROYCHAIN)
+	case linux.NFT_MSG_NEWRULE:
+		return b.newRule(req)
+	case linux.NFT_MSG_DELRULE, linux.NFT_MSG_DESTROYRULE:
+		return b.delRule(req, msgType == linux.NFT_MSG_DESTROYRULE)
+	case linux.NFT_MSG_NEWSET:
+		return b.newSet(req)
+	case linux.NFT_MSG_DELSET, linux.NFT_MSG_DESTROYSET:
+		return b.delSet(req, msgType == linux.NFT_MSG_DESTROYSET)
+	case linux.NFT_MSG_NEWSETELEM:
+		return b.newSetElems(req)
+	case linux.NFT_MSG_DELSETELEM, linux.NFT_MSG_DESTROYSETELEM:
+		return b.delSetElems(req, msgType == linux.NFT_MSG_DESTROYSETELEM)
+	default:
+		// TODO(b/345684870): Support stateful objects and flowtables.
+		return syserr.ErrNotSupported
+	}
+}
+
+// validName returns the name attribute of the given type, if it is present
+// and not too long.
+func validName(attrs nftables.Attrs, atype uint16) (string, bool, *syserr.Error) {
+	name, ok := attrs.String(atype)
+	if !ok {
+		return "", false, nil
+	}
+	if len(name) >= linux.NFT_NAME_MAXLEN {
+		return "", false, syserr.ErrRange
+	}
+	return name, true, nil
+}
+
+// userdata returns a copy of the userdata attribute of the given type.
+func userdata(attrs nftables.Attrs, atype uint16) ([]byte, *syserr.Error) {
+	v, ok := attrs[atype]
+	if !ok {
+		return nil, nil
+	}
+	if len(v) > linux.NFT_USERDATA_MAXLEN {
+		return nil, syserr.ErrRange
+	}
+	return slices.Clone(v), nil
+}
+
+// lookupTable returns the table referenced by the message.
+func (b *batch) lookupTable(req *request, atype uint16) (int, *table, *syserr.Error) {
+	name, ok, err := validName(req.attrs, atype)
+	if err != nil {
+		return -1, nil, err
+	}
+	if !ok {
+		return -1, nil, syserr.ErrInvalidArgument
+	}
+	i, t := b.model.findTable(req.family, name, 0)
+	if t == nil {
+		return -1, nil, syserr.ErrNoFileOrDir
+	}
+	return i, t, nil
+}
+
+// newTable handles NFT_MSG_NEWTABLE.
+func (b *batch) newTable(req *request) *syserr.Error {
+	if _, ok := addressFamily(req.family); !ok {
+		return syserr.ErrAddressFamilyNotSupported
+	}
+	name, ok, err := validName(req.attrs, linux.NFTA_TABLE_NAME)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	var flags uint32
+	if _, ok := req.attrs[linux.NFTA_TABLE_FLAGS]; ok {
+		if flags, ok = req.attrs.BE32(linux.NFTA_TABLE_FLAGS); !ok {
+			return syserr.ErrInvalidArgument
+		}
+		if flags&^linux.NFT_TABLE_F_DORMANT != 0 {
+			// TODO(b/345684870): Support owned tables.
+			return syserr.ErrNotSupported
+		}
+	}
+	ud, err := userdata(req.attrs, linux.NFTA_TABLE_USERDATA)
+	if err != nil {
+		return err
+	}
+
+	if _, t := b.model.findTable(req.family, name, 0); t != nil {
+		if req.hdr.Flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		if req.hdr.Flags&linux.NLM_F_REPLACE != 0 {
+			return syserr.ErrNotSupported
+		}
+		// Updates the table's flags.
+		if _, ok := req.attrs[linux.NFTA_TABLE_FLAGS]; ok {
+			t.flags = flags
+		}
+		return nil
+	}
+	b.model.tables = append(b.model.tables, &table{
+		family:   req.family,
+		name:     name,
+		handle:   b.model.newHandle(),
+		flags:    flags,
+		userdata: ud,
+	})
+	return nil
+}
+
+// delTable handles NFT_MSG_DELTABLE and NFT_MSG_DESTROYTABLE. Deleting a table
+// with an unspecified family and no name deletes the whole ruleset.
+func (b *batch) delTable(req *request, destroy bool) *syserr.Error {
+	name, hasName, err := validName(req.attrs, linux.NFTA_TABLE_NAME)
+	if err != nil {
+		return err
+	}
+	handle, hasHandle := req.attrs.BE64(linux.NFTA_TABLE_HANDLE)
+	if !hasName && !hasHandle {
+		// Flushes all tables of the family (or all families).
+		b.model.tables = slices.DeleteFunc(b.model.tables, func(t *table) bool {
+			return req.family == linux.NFPROTO_UNSPEC || t.family == req.family
+		})
+		return nil
+	}
+	if hasName {
+		handle = 0
+	}
+	i, t := b.model.findTable(req.family, name, handle)
+	if t == nil {
+		if destroy {
+			return nil
+		}
+		return syserr.ErrNoFileOrDir
+	}
+	b.model.tables = slices.Delete(b.model.tables, i, i+1)
+	return nil
+}
+
+// newChain handles NFT_MSG_NEWCHAIN.
+func (b *batch) newChain(req *request) *syserr.Error {
+	_, t, err := b.lookupTable(req, linux.NFTA_CHAIN_TABLE)
+	if err != nil {
+		return err
+	}
+	name, hasName, err := validName(req.attrs, linux.NFTA_CHAIN_NAME)
+	if err != nil {
+		return err
+	}
+	handle, hasHandle := req.attrs.BE64(linux.NFTA_CHAIN_HANDLE)
+	if !hasName && !hasHandle {
+		return syserr.ErrInvalidArgument
+	}
+	if _, ok := req.attrs[linux.NFTA_CHAIN_ID]; ok && !hasName {
+		// TODO(b/345684870): Support anonymous (binding) chains.
+		return syserr.ErrNotSupported
+	}
+	var flags uint32
+	if _, ok := req.attrs[linux.NFTA_CHAIN_FLAGS]; ok {
+		if flags, ok = req.attrs.BE32(linux.NFTA_CHAIN_FLAGS); !ok {
+			return syserr.ErrInvalidArgument
+		}
+		if flags&^linux.NFT_CHAIN_BASE != 0 {
+			return syserr.ErrNotSupported
+		}
+	}
+	var policy *uint32
+	if _, ok := req.attrs[linux.NFTA_CHAIN_POLICY]; ok {
+		p, ok := req.attrs.BE32(linux.NFTA_CHAIN_POLICY)
+		if !ok || (p != linux.NF_ACCEPT && p != linux.NF_DROP) {
+			return syserr.ErrInvalidArgument
+		}
+		policy = &p
+	}
+
+	lookupName := name
+	if hasHandle {
+		lookupName = ""
+	}
+	if _, ch := t.findChain(lookupName, handle); ch != nil {
+		if req.hdr.Flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		if req.hdr.Flags&linux.NLM_F_REPLACE != 0 {
+			return syserr.ErrNotSupported
+		}
+		// Updates the chain's policy (and name, if given by handle).
+		if policy != nil {
+			if ch.base == nil {
+				return syserr.ErrNotSupported
+			}
+			ch.base.policy = *policy
+		}
+		if hasHandle && hasName && name != ch.name {
+			if _, other := t.findChain(name, 0); other != nil {
+				return syserr.ErrExists
+			}
+			ch.name = name
+		}
+		return nil
+	}
+	if !hasName {
+		return syserr.ErrNoFileOrDir
+	}
+
+	ud, err := userdata(req.attrs, linux.NFTA_CHAIN_USERDATA)
+	if err != nil {
+		return err
+	}
+	ch := &chain{
+		name:     name,
+		handle:   b.model.newHandle(),
+		userdata: ud,
+	}
+	if hookAttr, ok := req.attrs[linux.NFTA_CHAIN_HOOK]; ok {
+		base, err := parseBaseChain(t, req.attrs, hookAttr)
+		if err != nil {
+			return err
+		}
+		if policy != nil {
+			base.policy = *policy
+		}
+		ch.base = base
+		ch.flags = flags | linux.NFT_CHAIN_BASE
+	} else if policy != nil || flags&linux.NFT_CHAIN_BASE != 0 {
+		return syserr.ErrInvalidArgument
+	}
+	t.chains = append(t.chains, ch)
+	return nil
+}
+
+// parseBaseChain parses the NFTA_CHAIN_HOOK attribute (and related attributes)
+// of a new base chain.
+func parseBaseChain(t *table, attrs nftables.Attrs, hookAttr []byte) (*baseChain, *syserr.Error) {
+	switch t.family {
+	case linux.NFPROTO_IPV4, linux.NFPROTO_IPV6, linux.NFPROTO_INET:
+	default:
+		// TODO(b/345684870): Support base chains for the ARP, bridge and
+		// netdev families.
+		return nil, syserr.ErrNotSupported
+	}
+	hattrs, err := nftables.ParseAttrs(hookAttr)
+	if err != nil {
+		return nil, syserr.ErrInvalidArgument
+	}
+	hooknum, ok := hattrs.BE32(linux.NFTA_HOOK_HOOKNUM)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	prio, ok := hattrs.BE32(linux.NFTA_HOOK_PRIORITY)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if hooknum >= linux.NF_INET_NUMHOOKS {
+		return nil, syserr.ErrNotSupported
+	}
+	if _, ok := hattrs[linux.NFTA_HOOK_DEV]; ok {
+		return nil, syserr.ErrNotSupported
+	}
+	base := &baseChain{
+		hooknum:  hooknum,
+		priority: int32(prio),
+		policy:   linux.NF_ACCEPT,
+		ctype:    "filter",
+	}
+	if ctype, ok := attrs.String(linux.NFTA_CHAIN_TYPE); ok {
+		base.ctype = ctype
+	}
+	// Validates the chain against the nftables package's constraints.
+	info, err := base.info()
+	if err != nil {
+		return nil, syserr.ErrNotSupported
+	}
+	family, _ := addressFamily(t.family)
+	if err := nftables.ValidateBaseChainInfo(info, family); err != nil {
+		return nil, syserr.ErrNotSupported
+	}
+	return base, nil
+}
+
+// delChain handles NFT_MSG_DELCHAIN and NFT_MSG_DESTROYCHAIN.
+func (b *batch) delChain(req *request, destroy bool) *syserr.Error {
+	_, t, err := b.lookupTable(req, linux.NFTA_CHAIN_TABLE)
+	if err != nil {
+		if destroy && err == syserr.ErrNoFileOrDir {
+			return nil
+		}
+		return err
+	}
+	name, hasName, err := validName(req.attrs, linux.NFTA_CHAIN_NAME)
+	if err != nil {
+		return err
+	}
+	handle, hasHandle := req.attrs.BE64(linux.NFTA_CHAIN_HANDLE)
+	if !hasName && !hasHandle {
+		return syserr.ErrInvalidArgument
+	}
+	if hasHandle {
+		name = ""
+	}
+	i, _ := t.findChain(name, handle)
+	if i < 0 {
+		if destroy {
+			return nil
+		}
+		return syserr.ErrNoFileOrDir
+	}
+	// Rules of the deleted chain are deleted with it; rules jumping to it
+	// cause the batch to fail when it is compiled.
+	t.chains = slices.Delete(t.chains, i, i+1)
+	return nil
+}
+
+// newRule handles NFT_MSG_NEWRULE.
+func (b *batch) newRule(req *request) *syserr.Error {
+	_, t, err := b.lookupTable(req, linux.NFTA_RULE_TABLE)
+	if err != nil {
+		return err
+	}
+	chainName, ok, err := validName(req.attrs, linux.NFTA_RULE_CHAIN)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// TODO(b/345684870): Support NFTA_RULE_CHAIN_ID.
+		return syserr.ErrNotSupported
+	}
+	_, ch := t.findChain(chainName, 0)
+	if ch == nil {
+		return syserr.ErrNoFileOrDir
+	}
+	exprs := req.attrs[linux.NFTA_RULE_EXPRESSIONS]
+	ud, err := userdata(req.attrs, linux.NFTA_RULE_USERDATA)
+	if err != nil {
+		return err
+	}
+
+	// Validates the rule's expressions, resolving the sets it references.
+	r := &rule{
+		exprs:    slices.Clone(exprs),
+		userdata: ud,
+	}
+	sets := make(map[string]*nftables.Set, len(t.sets))
+	for _, s := range t.sets {
+		ns, serr := s.newSet()
+		if serr != nil {
+			return syserr.ErrInvalidArgument
+		}
+		sets[s.name] = ns
+	}
+	resolve := setResolver(sets, b.sets)
+	record := func(name string, id uint32, hasID bool) (*nftables.Set, error) {
+		s, err := resolve(name, id, hasID)
+		if err == nil && s.GetName() != name {
+			if r.setIDs == nil {
+				r.setIDs = make(map[uint32]string)
+			}
+			r.setIDs[id] = s.GetName()
+		}
+		return s, err
+	}
+	if err := addExpressions(&nftables.Rule{}, exprs, record); err != nil {
+		if errors.Is(err, nftables.ErrUnsupportedExpression) {
+			return syserr.ErrNotSupported
+		}
+		return syserr.ErrInvalidArgument
+	}
+
+	if handle, ok := req.attrs.BE64(linux.NFTA_RULE_HANDLE); ok {
+		// Replaces an existing rule.
+		if req.hdr.Flags&linux.NLM_F_REPLACE == 0 {
+			return syserr.ErrNotSupported
+		}
+		i := ch.findRule(handle)
+		if i < 0 {
+			return syserr.ErrNoFileOrDir
+		}
+		r.handle = ch.rules[i].handle
+		ch.rules[i] = r
+		return nil
+	}
+
+	r.handle = b.model.newHandle()
+	appendRule := req.hdr.Flags&linux.NLM_F_APPEND != 0
+	pos := 0
+	if appendRule {
+		pos = len(ch.rules)
+	}
+	if handle, ok := req.attrs.BE64(linux.NFTA_RULE_POSITION); ok {
+		i := ch.findRule(handle)
+		if i < 0 {
+			return syserr.ErrNoFileOrDir
+		}
+		pos = i
+		if appendRule {
+			pos = i + 1
+		}
+	} else if _, ok := req.attrs[linux.NFTA_RULE_POSITION_ID]; ok {
+		return syserr.ErrNotSupported
+	}
+	ch.rules = slices.Insert(ch.rules, pos, r)
+	return nil
+}
+
+// delRule handles NFT_MSG_DELRULE and NFT_MSG_DESTROYRULE. Deleting a rule
+// without a handle flushes the chain, or all chains of the table if no chain
+// is given.
+func (b *batch) delRule(req *request, destroy bool) *syserr.Error {
+	_, t, err := b.lookupTable(req, linux.NFTA_RULE_TABLE)
+	if err != nil {
+		if destroy && err == syserr.ErrNoFileOrDir {
+			return nil
+		}
+		return err
+	}
+	chainName, hasChain, err := validName(req.attrs, linux.NFTA_RULE_CHAIN)
+	if err != nil {
+		return err
+	}
+	if !hasChain {
+		for _, ch := range t.chains {
+			ch.rules = nil
+		}
+		return nil
+	}
+	_, ch := t.findChain(chainName, 0)
+	if ch == nil {
+		if destroy {
+			return nil
+		}
+		return syserr.ErrNoFileOrDir
+	}
+	handle, ok := req.attrs.BE64(linux.NFTA_RULE_HANDLE)
+	if !ok {
+		ch.rules = nil
+		return nil
+	}
+	i := ch.findRule(handle)
+	if i < 0 {
+		if destroy {
+			return nil
+		}
+		return syserr.ErrNoFileOrDir
+	}
+	ch.rules = slices.Delete(ch.rules, i, i+1)
+	return nil
+}
+
+// newSet handles NFT_MSG_NEWSET.
+func (b *batch) newSet(req *request) *syserr.Error {
+	_, t, err := b.lookupTable(req, linux.NFTA_SET_TABLE)
+	if err != nil {
+		return err
+	}
+	name, ok, err := validName(req.attrs, linux.NFTA_SET_NAME)
+	if err != nil {
+		return err
+	}
+	if !ok || name == "" {
+		return syserr.ErrInvalidArgument
+	}
+	var flags uint32
+	if _, ok := req.attrs[linux.NFTA_SET_FLAGS]; ok {
+		if flags, ok = req.attrs.BE32(linux.NFTA_SET_FLAGS); !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+	if flags&^supportedSetFlags != 0 {
+		// TODO(b/345684870): Support maps, timeouts and concatenations.
+		return syserr.ErrNotSupported
+	}
+	keyLen, ok := req.attrs.BE32(linux.NFTA_SET_KEY_LEN)
+	if !ok || keyLen == 0 || keyLen > linux.NFT_REG_SIZE*linux.NFT_REG_MAX {
+		return syserr.ErrInvalidArgument
+	}
+	keyType, _ := req.attrs.BE32(linux.NFTA_SET_KEY_TYPE)
+	ud, err := userdata(req.attrs, linux.NFTA_SET_USERDATA)
+	if err != nil {
+		return err
+	}
+
+	// Names containing "%d" (used for anonymous sets) are completed with the
+	// lowest unused number. See net/netfilter/nf_tables_api.c:
+	// nf_tables_set_alloc_name.
+	if strings.Contains(name, "%") {
+		if strings.Count(name, "%") != 1 || !strings.Contains(name, "%d") {
+			return syserr.ErrInvalidArgument
+		}
+		for n := 0; ; n++ {
+			candidate := strings.Replace(name, "%d", fmt.Sprint(n), 1)
+			if _, s := t.findSet(candidate, 0); s == nil {
+				name = candidate
+				break
+			}
+		}
+	}
+
+	if _, s := t.findSet(name, 0); s != nil {
+		if req.hdr.Flags&linux.NLM_F_EXCL != 0 {
+			return syserr.ErrExists
+		}
+		if req.hdr.Flags&linux.NLM_F_REPLACE != 0 {
+			return syserr.ErrNotSupported
+		}
+		if s.flags != flags || s.keyLen != keyLen {
+			return syserr.ErrExists
+		}
+		return nil
+	}
+
+	s := &set{
+		name:     name,
+		handle:   b.model.newHandle(),
+		flags:    flags,
+		keyType:  keyType,
+		keyLen:   keyLen,
+		desc:     slices.Clone(req.attrs[linux.NFTA_SET_DESC]),
+		userdata: ud,
+	}
+	if policy, ok := req.attrs.BE32(linux.NFTA_SET_POLICY); ok {
+		s.policy = &policy
+	}
+	if _, err := s.newSet(); err != nil {
+		return syserr.ErrInvalidArgument
+	}
+	if id, ok := req.attrs.BE32(linux.NFTA_SET_ID); ok {
+		b.sets[id] = name
+	}
+	t.sets = append(t.sets, s)
+	return nil
+}
+
+// lookupSet returns the set referenced by the message.
+func (b *batch) lookupSet(t *table, req *request, nameAttr, idAttr uint16) (*set, *syserr.Error) {
+	name, hasName, err := validName(req.attrs, nameAttr)
+	if err != nil {
+		return nil, err
+	}
+	if hasName {
+		if _, s := t.findSet(name, 0); s != nil {
+			return s, nil
+		}
+	}
+	if id, ok := req.attrs.BE32(idAttr); ok {
+		if _, s := t.findSet(b.sets[id], 0); s != nil {
+			return s, nil
+		}
+	}
+	return nil, syserr.ErrNoFileOrDir
+}
+
+// delSet handles NFT_MSG_DELSET and NFT_MSG_DESTROYSET.
+func (b *batch) delSet(req *request, destroy bool) *syserr.Error {
+	_, t, err := b.lookupTable(req, linux.NFTA_SET_TABLE)
+	if err != nil {
+		if destroy && err == syserr.ErrNoFileOrDir {
+			return nil
+		}
+		return err
+	}
+	name, hasName, err := validName(req.attrs, linux.NFTA_SET_NAME)
+	if err != nil {
+		return err
+	}
+	handle, hasHandle := req.attrs.BE64(linux.NFTA_SET_HANDLE)
+	if !hasName && !hasHandle {
+		return syserr.ErrInvalidArgument
+	}
+	if hasHandle {
+		name = ""
+	}
+	i, _ := t.findSet(name, handle)
+	if i < 0 {
+		if destroy {
+			return nil
+		}
+		return syserr.ErrNoFileOrDir
+	}
+	// Rules referencing the deleted set cause the batch to fail when it is
+	// compiled.
+	t.sets = slices.Delete(t.sets, i, i+1)
+	return nil
+}
+
+// parseSetElems parses the elements of a NFT_MSG_NEWSETELEM or
+// NFT_MSG_DELSETELEM message.
+func parseSetElems(s *set, req *request) ([]setElem, *syserr.Error) {
+	list, err := nftables.ParseList(req.attrs[linux.NFTA_SET_ELEM_LIST_ELEMENTS])
+	if err != nil {
+		return nil, syserr.ErrInvalidArgument
+	}
+	elems := make([]setElem, 0, len(list))
+	for _, buf := range list {
+		attrs, err := nftables.ParseAttrs(buf)
+		if err != nil {
+			return nil, syserr.ErrInvalidArgument
+		}
+		if _, ok := attrs[linux.NFTA_SET_ELEM_KEY_END]; ok {
+			return nil, syserr.ErrNotSupported
+		}
+		if _, ok := attrs[linux.NFTA_SET_ELEM_DATA]; ok {
+			return nil, syserr.ErrNotSupported
+		}
+		var flags uint32
+		if _, ok := attrs[linux.NFTA_SET_ELEM_FLAGS]; ok {
+			if flags, ok = attrs.BE32(linux.NFTA_SET_ELEM_FLAGS); !ok {
+				return nil, syserr.ErrInvalidArgument
+			}
+		}
+		if flags&^linux.NFT_SET_ELEM_INTERVAL_END != 0 {
+			return nil, syserr.ErrNotSupported
+		}
+		if flags != 0 && s.flags&linux.NFT_SET_INTERVAL == 0 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		key, err := nftables.ParseDataValue(attrs[linux.NFTA_SET_ELEM_KEY])
+		if err != nil || len(key) != int(s.keyLen) {
+			return nil, syserr.ErrInvalidArgument
+		}
+		elems = append(elems, setElem{key: slices.Clone(key), flags: flags})
+	}
+	return elems, nil
+}
+
+// newSetElems handles NFT_MSG_NEWSETELEM.
+func (b *batch) newSetElems(req *request) *syserr.Error {
+	_, t, err := b.lookupTable(req, linux.NFTA_SET_ELEM_LIST_TABLE)
+	if err != nil {
+		return err
+	}
+	s, err := b.lookupSet(t, req, linux.NFTA_SET_ELEM_LIST_SET, linux.NFTA_SET_ELEM_LIST_SET_ID)
+	if err != nil {
+		return err
+	}
+	elems, err := parseSetElems(s, req)
+	if err != nil {
+		return err
+	}
+	for _, e := range elems {
+		i := slices.IndexFunc(s.elems, func(o setElem) bool { return string(o.key) == string(e.key) })
+		if i >= 0 {
+			if req.hdr.Flags&linux.NLM_F_EXCL != 0 && s.elems[i].flags == e.flags {
+				return syserr.ErrExists
+			}
+			s.elems[i] = e
+			continue
+		}
+		s.elems = append(s.elems, e)
+	}
+	return nil
+}
+
+// delSetElems handles NFT_MSG_DELSETELEM and NFT_MSG_DESTROYSETELEM.
+func (b *batch) delSetElems(req *request, destroy bool) *syserr.Error {
+	_, t, err := b.lookupTable(req, linux.NFTA_SET_ELEM_LIST_TABLE)
+	if err != nil {
+		return err
+	}
+	s, err := b.lookupSet(t, req, linux.NFTA_SET_ELEM_LIST_SET, linux.NFTA_SET_ELEM_LIST_SET_ID)
+	if err != nil {
+		return err
+	}
+	if _, ok := req.attrs[linux.NFTA_SET_ELEM_LIST_ELEMENTS]; !ok {
+		// Flushes the set.
+		s.elems = nil
+		return nil
+	}
+	elems, err := parseSetElems(s, req)
+	if err != nil {
+		return err
+	}
+	for _, e := range elems {
+		i := slices.IndexFunc(s.elems, func(o setElem) bool { return string(o.key) == string(e.key) })
+		if i < 0 {
+			if destroy {
+				continue
+			}
+			return syserr.ErrNoFileOrDir
+		}
+		s.elems = slices.Delete(s.elems, i, i+1)
+	}
+	return nil
+}
@@ -17,10 +17,13 @@ package route
 
 import (
 	"bytes"
+	"encoding/binary"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bits"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/marshal"
 	"gvisor.dev/gvisor/pkg/marshal/primitive"
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
@@ -64,11 +67,6 @@ func (p *Protocol) Protocol() int {
 	return linux.NETLINK_ROUTE
 }
 
-// CanSend implements netlink.Protocol.CanSend.
-func (p *Protocol) CanSend() bool {
-	return true
-}
-
 // dumpLinks handles RTM_GETLINK dump requests.
 func (p *Protocol) dumpLinks(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
 	// NLM_F_DUMP + RTM_GETLINK messages are supposed to include an
@@ -255,6 +253,19 @@ func addNewLinkMessage(ms *nlmsg.MessageSet, idx int32, i inet.Interface) {
 	m.PutAttr(linux.IFLA_ADDRESS, primitive.AsByteSlice(mac))
 	m.PutAttr(linux.IFLA_BROADCAST, primitive.AsByteSlice(brd))
 
+	if i.Kind != "" {
+		// IFLA_LINKINFO is a nested attribute, here only containing
+		// IFLA_INFO_KIND.
+		kind := append([]byte(i.Kind), 0)
+		info := marshal.Marshal(&linux.NetlinkAttrHeader{
+			Type:   linux.IFLA_INFO_KIND,
+			Length: uint16(linux.NetlinkAttrHeaderSize + len(kind)),
+		})
+		info = append(info, kind...)
+		info = append(info, make([]byte, bits.AlignUp(len(info), linux.NLA_ALIGNTO)-len(info))...)
+		m.PutAttr(linux.IFLA_LINKINFO, primitive.AsByteSlice(info))
+	}
+
 	// TODO(gvisor.dev/issue/578): There are many more attributes.
 }
 
@@ -376,6 +387,42 @@ func fillRoute(routes []inet.Route, addr []byte) (inet.Route, *syserr.Error) {
 	return route, nil
 }
 
+// lookupRoute returns the route to addr in the first routing table, selected
+// by the policy routing rules, that has one. As the request only carries the
+// destination, rules that select on anything else are skipped.
+func lookupRoute(rules []inet.Rule, routes []inet.Route, addr []byte) (inet.Route, *syserr.Error) {
+	if len(rules) == 0 {
+		// The stack doesn't support policy routing.
+		return fillRoute(routes, addr)
+	}
+
+	family := uint8(linux.AF_INET)
+	if len(addr) != 4 {
+		family = linux.AF_INET6
+	}
+	for _, rule := range rules {
+		if rule.Family != family || rule.SrcLen != 0 || rule.TOS != 0 || rule.Mark != 0 || rule.InputInterface != "" || rule.OutputInterface != "" || rule.HasUIDRange || rule.Flags&linux.FIB_RULE_INVERT != 0 {
+			continue
+		}
+		if rule.DstLen != 0 && commonPrefixLen(addr, rule.DstAddr) < int(rule.DstLen) {
+			continue
+		}
+		if rule.Action != linux.FR_ACT_TO_TBL {
+			return inet.Route{}, syserr.ErrHostUnreachable
+		}
+		var table []inet.Route
+		for _, route := range routes {
+			if route.Table == rule.Table {
+				table = append(table, route)
+			}
+		}
+		if route, err := fillRoute(table, addr); err == nil {
+			return route, nil
+		}
+	}
+	return inet.Route{}, syserr.ErrHostUnreachable
+}
+
 // parseForDestination parses a message as format of RouteMessage-RtAttr-dst.
 func parseForDestination(msg *nlmsg.Message) ([]byte, *syserr.Error) {
 	var rtMsg linux.RouteMessage
@@ -443,7 +490,7 @@ func (p *Protocol) dumpRoutes(ctx context.Context, s *netlink.Socket, msg *nlmsg
 		if err != nil {
 			return err
 		}
-		route, err := fillRoute(routeTables, dst)
+		route, err := lookupRoute(stack.RuleTable(), routeTables, dst)
 		if err != nil {
 			// TODO(gvisor.dev/issue/1237): return NLMSG_ERROR with ENETUNREACH.
 			return syserr.ErrNotSupported
@@ -468,9 +515,7 @@ func (p *Protocol) dumpRoutes(ctx context.Context, s *netlink.Socket, msg *nlmsg
 			SrcLen: rt.SrcLen,
 			TOS:    rt.TOS,
 
-			// Always return the main table since we don't have multiple
-			// routing tables.
-			Table:    linux.RT_TABLE_MAIN,
+			Table:    compatTable(rt.Table),
 			Protocol: rt.Protocol,
 			Scope:    rt.Scope,
 			Type:     rt.Type,
@@ -491,6 +536,10 @@ func (p *Protocol) dumpRoutes(ctx context.Context, s *netlink.Socket, msg *nlmsg
 		if len(rt.GatewayAddr) > 0 {
 			m.PutAttr(linux.RTA_GATEWAY, primitive.AsByteSlice(rt.GatewayAddr))
 		}
+		if rt.Priority != 0 {
+			m.PutAttr(linux.RTA_PRIORITY, primitive.AllocateUint32(rt.Priority))
+		}
+		m.PutAttr(linux.RTA_TABLE, primitive.AllocateUint32(rt.Table))
 
 		// TODO(gvisor.dev/issue/578): There are many more attributes.
 	}
@@ -498,6 +547,234 @@ func (p *Protocol) dumpRoutes(ctx context.Context, s *netlink.Socket, msg *nlmsg
 	return nil
 }
 
+// compatTable returns the routing table ID to report in the one byte table
+// fields of route and rule messages. Tables with larger IDs are only
+// reported by the RTA_TABLE and FRA_TABLE attributes.
+func compatTable(table uint32) uint8 {
+	if table > linux.RT_TABLE_LOCAL {
+		return linux.RT_TABLE_COMPAT
+	}
+	return uint8(table)
+}
+
+// newRule handles RTM_NEWRULE requests.
+func (p *Protocol) newRule(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		return syserr.ErrNoNet
+	}
+	return stack.NewRule(ctx, msg)
+}
+
+// delRule handles RTM_DELRULE requests.
+func (p *Protocol) delRule(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		return syserr.ErrNoNet
+	}
+	return stack.RemoveRule(ctx, msg)
+}
+
+// dumpRules handles RTM_GETRULE dump requests.
+func (p *Protocol) dumpRules(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var family primitive.Uint8
+	if _, ok := msg.GetData(&family); !ok {
+		return syserr.ErrInvalidArgument
+	}
+
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	stack := s.Stack()
+	if stack == nil {
+		// No policy routing rules.
+		return nil
+	}
+
+	for _, r := range stack.RuleTable() {
+		if uint8(family) != linux.AF_UNSPEC && uint8(family) != r.Family {
+			continue
+		}
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWRULE,
+		})
+
+		m.Put(&linux.FibRuleHdr{
+			Family: r.Family,
+			DstLen: r.DstLen,
+			SrcLen: r.SrcLen,
+			TOS:    r.TOS,
+			Table:  compatTable(r.Table),
+			Action: r.Action,
+			Flags:  r.Flags,
+		})
+
+		m.PutAttr(linux.FRA_TABLE, primitive.AllocateUint32(r.Table))
+		if r.Priority != 0 {
+			m.PutAttr(linux.FRA_PRIORITY, primitive.AllocateUint32(r.Priority))
+		}
+		if r.DstLen > 0 {
+			m.PutAttr(linux.FRA_DST, primitive.AsByteSlice(r.DstAddr))
+		}
+		if r.SrcLen > 0 {
+			m.PutAttr(linux.FRA_SRC, primitive.AsByteSlice(r.SrcAddr))
+		}
+		if r.InputInterface != "" {
+			m.PutAttrString(linux.FRA_IIFNAME, r.InputInterface)
+		}
+		if r.OutputInterface != "" {
+			m.PutAttrString(linux.FRA_OIFNAME, r.OutputInterface)
+		}
+		if r.Mark != 0 {
+			m.PutAttr(linux.FRA_FWMARK, primitive.AllocateUint32(r.Mark))
+		}
+		if r.Mark != 0 || r.MarkMask != 0 {
+			m.PutAttr(linux.FRA_FWMASK, primitive.AllocateUint32(r.MarkMask))
+		}
+		if r.HasUIDRange {
+			uidRange := r.UIDRange
+			m.PutAttr(linux.FRA_UID_RANGE, &uidRange)
+		}
+	}
+
+	return nil
+}
+
+// newNeigh handles RTM_NEWNEIGH requests.
+func (p *Protocol) newNeigh(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		return syserr.ErrNoNet
+	}
+	return stack.NewFDBEntry(ctx, msg)
+}
+
+// delNeigh handles RTM_DELNEIGH requests.
+func (p *Protocol) delNeigh(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		return syserr.ErrNoNet
+	}
+	return stack.RemoveFDBEntry(ctx, msg)
+}
+
+// dumpNeighs handles RTM_GETNEIGH dump requests. Only the forwarding
+// databases of interfaces (the AF_BRIDGE family) are supported.
+func (p *Protocol) dumpNeighs(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var ndm linux.NeighborMessage
+	if _, ok := msg.GetData(&ndm); !ok {
+		// Old tools may send a struct rtgenmsg with the family only.
+		var family primitive.Uint8
+		if _, ok := msg.GetData(&family); !ok {
+			return syserr.ErrInvalidArgument
+		}
+		ndm.Family = uint8(family)
+	}
+	if ndm.Family != linux.AF_BRIDGE {
+		return syserr.ErrNotSupported
+	}
+
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	stack := s.Stack()
+	if stack == nil {
+		// No interfaces.
+		return nil
+	}
+
+	for _, e := range stack.FDB() {
+		if ndm.Index != 0 && ndm.Index != e.Index {
+			continue
+		}
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWNEIGH,
+		})
+
+		m.Put(&linux.NeighborMessage{
+			Family: linux.AF_BRIDGE,
+			Index:  e.Index,
+			State:  e.State,
+			Flags:  e.Flags,
+		})
+
+		m.PutAttr(linux.NDA_LLADDR, primitive.AsByteSlice(e.LinkAddr))
+		if len(e.DstAddr) > 0 {
+			m.PutAttr(linux.NDA_DST, primitive.AsByteSlice(e.DstAddr))
+		}
+		// The port is in network byte order.
+		m.PutAttr(linux.NDA_PORT, primitive.AsByteSlice(binary.BigEndian.AppendUint16(nil, e.Port)))
+		m.PutAttr(linux.NDA_VNI, primitive.AllocateUint32(e.VNI))
+	}
+
+	return nil
+}
+
+// newQDisc handles RTM_NEWQDISC requests.
+func (p *Protocol) newQDisc(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		return syserr.ErrNoNet
+	}
+	return stack.NewQDisc(ctx, msg)
+}
+
+// delQDisc handles RTM_DELQDISC requests.
+func (p *Protocol) delQDisc(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	stack := s.Stack()
+	if stack == nil {
+		return syserr.ErrNoNet
+	}
+	return stack.RemoveQDisc(ctx, msg)
+}
+
+// dumpQDiscs handles RTM_GETQDISC requests.
+func (p *Protocol) dumpQDiscs(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var tcm linux.TcMsg
+	if _, ok := msg.GetData(&tcm); !ok {
+		// Old tools may send a struct rtgenmsg with the family only.
+		var family primitive.Uint8
+		if _, ok := msg.GetData(&family); !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+
+	stack := s.Stack()
+	if stack == nil {
+		// No interfaces.
+		return nil
+	}
+
+	for _, q := range stack.QDiscs() {
+		if tcm.Ifindex != 0 && tcm.Ifindex != q.Index {
+			continue
+		}
+		m := ms.AddMessage(linux.NetlinkMessageHeader{
+			Type: linux.RTM_NEWQDISC,
+		})
+
+		m.Put(&linux.TcMsg{
+			Family:  linux.AF_UNSPEC,
+			Ifindex: q.Index,
+			Handle:  q.Handle,
+			Parent:  q.Parent,
+			// The reference count of the queueing discipline, which
+			// Linux reports as 1 for root disciplines.
+			Info: 1,
+		})
+
+		m.PutAttrString(linux.TCA_KIND, q.Kind)
+		if len(q.Options) > 0 {
+			m.PutAttr(linux.TCA_OPTIONS, primitive.AsByteSlice(q.Options))
+		}
+	}
+
+	return nil
+}
+
 // newAddr handles RTM_NEWADDR requests.
 func (p *Protocol) newAddr(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
 	stack := s.Stack()
@@ -629,6 +906,12 @@ func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *n
 			return p.dumpAddrs(ctx, s, msg, ms)
 		case linux.RTM_GETROUTE:
 			return p.dumpRoutes(ctx, s, msg, ms)
+		case linux.RTM_GETRULE:
+			return p.dumpRules(ctx, s, msg, ms)
+		case linux.RTM_GETNEIGH:
+			return p.dumpNeighs(ctx, s, msg, ms)
+		case linux.RTM_GETQDISC:
+			return p.dumpQDiscs(ctx, s, msg, ms)
 		default:
 			return syserr.ErrNotSupported
 		}
@@ -653,6 +936,20 @@ func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *n
 			return p.newAddr(ctx, s, msg, ms)
 		case linux.RTM_DELADDR:
 			return p.delAddr(ctx, s, msg, ms)
+		case linux.RTM_NEWRULE:
+			return p.newRule(ctx, s, msg, ms)
+		case linux.RTM_DELRULE:
+			return p.delRule(ctx, s, msg, ms)
+		case linux.RTM_NEWNEIGH:
+			return p.newNeigh(ctx, s, msg, ms)
+		case linux.RTM_DELNEIGH:
+			return p.delNeigh(ctx, s, msg, ms)
+		case linux.RTM_NEWQDISC:
+			return p.newQDisc(ctx, s, msg, ms)
+		case linux.RTM_GETQDISC:
+			return p.dumpQDiscs(ctx, s, msg, ms)
+		case linux.RTM_DELQDISC:
+			return p.delQDisc(ctx, s, msg, ms)
 		default:
 			return syserr.ErrNotSupported
 		}
@@ -0,0 +1,269 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"bytes"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// bytecodeEntry holds the fields of a socket that inet_diag bytecode filters
+// on. See net/ipv4/inet_diag.c:struct inet_diag_entry.
+type bytecodeEntry struct {
+	family uint8
+
+	// saddr and daddr are the local and remote addresses, in network byte
+	// order. They have 4 bytes for AF_INET and 16 bytes for AF_INET6.
+	saddr []byte
+	daddr []byte
+
+	// sport and dport are the local and remote ports, in host byte order.
+	sport uint16
+	dport uint16
+
+	ifindex  uint32
+	mark     uint32
+	cgroupID uint64
+}
+
+// bytecodeOp is struct inet_diag_bc_op. Yes and No are the offsets of the next
+// operation when the condition of the operation is true and false.
+type bytecodeOp struct {
+	code uint8
+	yes  int
+	no   int
+}
+
+// opAt parses the operation at the start of bc.
+//
+// Preconditions: len(bc) >= linux.InetDiagBcOpSize.
+func opAt(bc []byte) bytecodeOp {
+	return bytecodeOp{
+		code: bc[0],
+		yes:  int(bc[1]),
+		no:   int(hostarch.ByteOrder.Uint16(bc[2:4])),
+	}
+}
+
+// validJump returns whether the operation of bc at the given offset from its
+// end is at an operation boundary. See net/ipv4/inet_diag.c:valid_cc.
+func validJump(bc []byte, remaining int) bool {
+	l := len(bc)
+	for l >= 0 {
+		if remaining > l {
+			return false
+		}
+		if remaining == l {
+			return true
+		}
+		if l < linux.InetDiagBcOpSize {
+			return false
+		}
+		op := opAt(bc[len(bc)-l:])
+		if op.yes < linux.InetDiagBcOpSize || op.yes&3 != 0 {
+			return false
+		}
+		l -= op.yes
+	}
+	return false
+}
+
+// hostcondAddrLen returns the length of the address of a hostcond of the
+// given family.
+func hostcondAddrLen(family uint8) (int, bool) {
+	switch family {
+	case linux.AF_UNSPEC:
+		return 0, true
+	case linux.AF_INET:
+		return 4, true
+	case linux.AF_INET6:
+		return 16, true
+	default:
+		return 0, false
+	}
+}
+
+// auditBytecode checks that bc is a valid program, which can only jump forward
+// to operation boundaries and reads no operands past its end. Filtering on
+// socket marks requires netAdmin. See net/ipv4/inet_diag.c:inet_diag_bc_audit.
+func auditBytecode(bc []byte, netAdmin bool) *syserr.Error {
+	if len(bc) < linux.InetDiagBcOpSize {
+		return syserr.ErrInvalidArgument
+	}
+	rest := bc
+	for len(rest) > 0 {
+		if len(rest) < linux.InetDiagBcOpSize {
+			return syserr.ErrInvalidArgument
+		}
+		op := opAt(rest)
+		minLen := linux.InetDiagBcOpSize
+		switch op.code {
+		case linux.INET_DIAG_BC_S_COND, linux.INET_DIAG_BC_D_COND:
+			minLen += linux.InetDiagHostcondSize
+			if len(rest) < minLen {
+				return syserr.ErrInvalidArgument
+			}
+			addrLen, ok := hostcondAddrLen(rest[linux.InetDiagBcOpSize])
+			if !ok {
+				return syserr.ErrInvalidArgument
+			}
+			minLen += addrLen
+			if len(rest) < minLen || int(rest[linux.InetDiagBcOpSize+1]) > 8*addrLen {
+				return syserr.ErrInvalidArgument
+			}
+		case linux.INET_DIAG_BC_DEV_COND:
+			minLen += 4
+		case linux.INET_DIAG_BC_S_EQ, linux.INET_DIAG_BC_S_GE, linux.INET_DIAG_BC_S_LE,
+			linux.INET_DIAG_BC_D_EQ, linux.INET_DIAG_BC_D_GE, linux.INET_DIAG_BC_D_LE:
+			minLen += linux.InetDiagBcOpSize
+		case linux.INET_DIAG_BC_MARK_COND:
+			if !netAdmin {
+				return syserr.ErrNotPermitted
+			}
+			minLen += linux.InetDiagMarkcondSize
+		case linux.INET_DIAG_BC_CGROUP_COND:
+			minLen += 8
+		case linux.INET_DIAG_BC_AUTO, linux.INET_DIAG_BC_JMP, linux.INET_DIAG_BC_NOP:
+		default:
+			return syserr.ErrInvalidArgument
+		}
+		if len(rest) < minLen {
+			return syserr.ErrInvalidArgument
+		}
+
+		if op.code != linux.INET_DIAG_BC_NOP {
+			if op.no < minLen || op.no > len(rest)+4 || op.no&3 != 0 {
+				return syserr.ErrInvalidArgument
+			}
+			if op.no < len(rest) && !validJump(bc, len(rest)-op.no) {
+				return syserr.ErrInvalidArgument
+			}
+		}
+		if op.yes < minLen || op.yes > len(rest)+4 || op.yes&3 != 0 {
+			return syserr.ErrInvalidArgument
+		}
+		if op.yes > len(rest) {
+			// The program must end exactly at its last
+			// operation.
+			return syserr.ErrInvalidArgument
+		}
+		rest = rest[op.yes:]
+	}
+	return nil
+}
+
+// prefixMatch returns whether the first bits bits of a and b are equal.
+func prefixMatch(a, b []byte, bits int) bool {
+	n := bits / 8
+	if len(a) < n || len(b) < n || !bytes.Equal(a[:n], b[:n]) {
+		return false
+	}
+	if bits%8 == 0 {
+		return true
+	}
+	if len(a) <= n || len(b) <= n {
+		return false
+	}
+	mask := byte(0xff << (8 - bits%8))
+	return a[n]&mask == b[n]&mask
+}
+
+// v4MappedPrefix is the prefix of IPv4-mapped IPv6 addresses.
+var v4MappedPrefix = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}
+
+// matchHostcond returns whether the operand of a S_COND or D_COND operation
+// matches addr and port.
+func matchHostcond(cond []byte, family uint8, addr []byte, port uint16) bool {
+	condFamily := cond[0]
+	prefixLen := int(cond[1])
+	condPort := int32(hostarch.ByteOrder.Uint32(cond[4:8]))
+	condAddr := cond[linux.InetDiagHostcondSize:]
+
+	if condPort != -1 && condPort != int32(port) {
+		return false
+	}
+	if condFamily != linux.AF_UNSPEC && condFamily != family {
+		// IPv4 conditions match the IPv4-mapped addresses of IPv6
+		// sockets.
+		return family == linux.AF_INET6 && condFamily == linux.AF_INET &&
+			bytes.HasPrefix(addr, v4MappedPrefix) &&
+			prefixMatch(addr[len(v4MappedPrefix):], condAddr, prefixLen)
+	}
+	return prefixLen == 0 || prefixMatch(addr, condAddr, prefixLen)
+}
+
+// runBytecode returns whether e passes the filter bc, which has been audited.
+// See net/ipv4/inet_diag.c:inet_diag_bc_run.
+func runBytecode(bc []byte, e *bytecodeEntry) bool {
+	for len(bc) > 0 {
+		op := opAt(bc)
+		operand := bc[linux.InetDiagBcOpSize:]
+		yes := true
+		switch op.code {
+		case linux.INET_DIAG_BC_NOP:
+		case linux.INET_DIAG_BC_JMP:
+			yes = false
+		case linux.INET_DIAG_BC_S_EQ:
+			yes = e.sport == opAt(operand).portOperand()
+		case linux.INET_DIAG_BC_S_GE:
+			yes = e.sport >= opAt(operand).portOperand()
+		case linux.INET_DIAG_BC_S_LE:
+			yes = e.sport <= opAt(operand).portOperand()
+		case linux.INET_DIAG_BC_D_EQ:
+			yes = e.dport == opAt(operand).portOperand()
+		case linux.INET_DIAG_BC_D_GE:
+			yes = e.dport >= opAt(operand).portOperand()
+		case linux.INET_DIAG_BC_D_LE:
+			yes = e.dport <= opAt(operand).portOperand()
+		case linux.INET_DIAG_BC_AUTO:
+			// Netstack doesn't track whether ports were bound
+			// explicitly, so no socket is reported as autobound.
+			yes = false
+		case linux.INET_DIAG_BC_S_COND:
+			yes = matchHostcond(operand, e.family, e.saddr, e.sport)
+		case linux.INET_DIAG_BC_D_COND:
+			yes = matchHostcond(operand, e.family, e.daddr, e.dport)
+		case linux.INET_DIAG_BC_DEV_COND:
+			yes = hostarch.ByteOrder.Uint32(operand) == e.ifindex
+		case linux.INET_DIAG_BC_MARK_COND:
+			mark := hostarch.ByteOrder.Uint32(operand)
+			mask := hostarch.ByteOrder.Uint32(operand[4:])
+			yes = e.mark&mask == mark
+		case linux.INET_DIAG_BC_CGROUP_COND:
+			yes = hostarch.ByteOrder.Uint64(operand) == e.cgroupID
+		}
+
+		next := op.no
+		if yes {
+			next = op.yes
+		}
+		if next > len(bc) {
+			// Jumps may go up to 4 bytes past the end, which
+			// rejects the socket.
+			return false
+		}
+		bc = bc[next:]
+	}
+	return true
+}
+
+// portOperand returns the port of a port comparison, which is stored in the
+// no field of the operation following it.
+func (op bytecodeOp) portOperand() uint16 {
+	return uint16(op.no)
+}
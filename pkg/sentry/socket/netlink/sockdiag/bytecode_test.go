@@ -0,0 +1,211 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// op encodes a struct inet_diag_bc_op.
+func op(code uint8, yes uint8, no uint16) []byte {
+	b := []byte{code, yes, 0, 0}
+	hostarch.ByteOrder.PutUint16(b[2:], no)
+	return b
+}
+
+// hostcond encodes a S_COND or D_COND operation and its operand.
+func hostcond(code, yes uint8, no uint16, family, prefixLen uint8, port int32, addr []byte) []byte {
+	b := op(code, yes, no)
+	cond := []byte{family, prefixLen, 0, 0, 0, 0, 0, 0}
+	hostarch.ByteOrder.PutUint32(cond[4:], uint32(port))
+	b = append(b, cond...)
+	return append(b, addr...)
+}
+
+func concat(ops ...[]byte) []byte {
+	var b []byte
+	for _, o := range ops {
+		b = append(b, o...)
+	}
+	return b
+}
+
+func TestPortRange(t *testing.T) {
+	// sport >= 1000 && sport <= 2000, as generated by ss(8).
+	bc := concat(
+		op(linux.INET_DIAG_BC_S_GE, 8, 20),
+		op(0, 0, 1000),
+		op(linux.INET_DIAG_BC_S_LE, 8, 12),
+		op(0, 0, 2000),
+	)
+	if err := auditBytecode(bc, false); err != nil {
+		t.Fatalf("auditBytecode() = %v, want nil", err)
+	}
+	for _, test := range []struct {
+		port uint16
+		want bool
+	}{
+		{999, false},
+		{1000, true},
+		{1500, true},
+		{2000, true},
+		{2001, false},
+	} {
+		e := bytecodeEntry{sport: test.port}
+		if got := runBytecode(bc, &e); got != test.want {
+			t.Errorf("runBytecode(sport=%d) = %t, want %t", test.port, got, test.want)
+		}
+	}
+}
+
+func TestHostcond(t *testing.T) {
+	// src 10.0.0.0/8.
+	bc := hostcond(linux.INET_DIAG_BC_S_COND, 16, 20, linux.AF_INET, 8, -1, []byte{10, 0, 0, 0})
+	if err := auditBytecode(bc, false); err != nil {
+		t.Fatalf("auditBytecode() = %v, want nil", err)
+	}
+	for _, test := range []struct {
+		name string
+		e    bytecodeEntry
+		want bool
+	}{
+		{
+			name: "IPv4 match",
+			e:    bytecodeEntry{family: linux.AF_INET, saddr: []byte{10, 1, 2, 3}},
+			want: true,
+		},
+		{
+			name: "IPv4 mismatch",
+			e:    bytecodeEntry{family: linux.AF_INET, saddr: []byte{11, 1, 2, 3}},
+			want: false,
+		},
+		{
+			name: "IPv4-mapped match",
+			e: bytecodeEntry{
+				family: linux.AF_INET6,
+				saddr:  []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 10, 1, 2, 3},
+			},
+			want: true,
+		},
+		{
+			name: "IPv6 mismatch",
+			e: bytecodeEntry{
+				family: linux.AF_INET6,
+				saddr:  []byte{0x20, 0x01, 0xd, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+			},
+			want: false,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := runBytecode(bc, &test.e); got != test.want {
+				t.Errorf("runBytecode() = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJump(t *testing.T) {
+	// dport == 80 || dport == 443.
+	// The first D_EQ continues to the JMP when it matches, which skips
+	// the second comparison.
+	bc := concat(
+		op(linux.INET_DIAG_BC_D_EQ, 8, 12),
+		op(0, 0, 80),
+		op(linux.INET_DIAG_BC_JMP, 4, 12),
+		op(linux.INET_DIAG_BC_D_EQ, 8, 12),
+		op(0, 0, 443),
+	)
+	if err := auditBytecode(bc, false); err != nil {
+		t.Fatalf("auditBytecode() = %v, want nil", err)
+	}
+	for _, test := range []struct {
+		port uint16
+		want bool
+	}{
+		{80, true},
+		{443, true},
+		{8080, false},
+	} {
+		e := bytecodeEntry{dport: test.port}
+		if got := runBytecode(bc, &e); got != test.want {
+			t.Errorf("runBytecode(dport=%d) = %t, want %t", test.port, got, test.want)
+		}
+	}
+}
+
+func TestAuditInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		bc       []byte
+		netAdmin bool
+		want     *syserr.Error
+	}{
+		{
+			name: "empty",
+			bc:   nil,
+			want: syserr.ErrInvalidArgument,
+		},
+		{
+			name: "unknown operation",
+			bc:   op(0xff, 4, 8),
+			want: syserr.ErrInvalidArgument,
+		},
+		{
+			name: "unaligned yes",
+			bc:   concat(op(linux.INET_DIAG_BC_NOP, 2, 0), op(linux.INET_DIAG_BC_NOP, 4, 0)),
+			want: syserr.ErrInvalidArgument,
+		},
+		{
+			name: "missing port",
+			bc:   op(linux.INET_DIAG_BC_S_GE, 4, 8),
+			want: syserr.ErrInvalidArgument,
+		},
+		{
+			name: "jump into operand",
+			bc: concat(
+				op(linux.INET_DIAG_BC_JMP, 4, 8),
+				op(linux.INET_DIAG_BC_S_GE, 8, 12),
+				op(0, 0, 1),
+			),
+			want: syserr.ErrInvalidArgument,
+		},
+		{
+			name: "prefix too long",
+			bc:   hostcond(linux.INET_DIAG_BC_S_COND, 16, 20, linux.AF_INET, 33, -1, []byte{10, 0, 0, 0}),
+			want: syserr.ErrInvalidArgument,
+		},
+		{
+			name: "unprivileged mark",
+			bc:   concat(op(linux.INET_DIAG_BC_MARK_COND, 12, 16), make([]byte, 8)),
+			want: syserr.ErrNotPermitted,
+		},
+		{
+			name:     "privileged mark",
+			bc:       concat(op(linux.INET_DIAG_BC_MARK_COND, 12, 16), make([]byte, 8)),
+			netAdmin: true,
+			want:     nil,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := auditBytecode(test.bc, test.netAdmin); got != test.want {
+				t.Errorf("auditBytecode() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// inetSocket is a netstack socket described by inet_diag.
+type inetSocket struct {
+	fd     *vfs.FileDescription
+	cookie uint64
+	diag   netstack.SockDiag
+}
+
+// supportedProtocol returns whether inet_diag describes sockets of the
+// protocol of req.
+func supportedProtocol(req *linux.InetDiagReqV2) bool {
+	switch req.Protocol {
+	case linux.IPPROTO_TCP, linux.IPPROTO_UDP, linux.IPPROTO_RAW:
+		return true
+	default:
+		return false
+	}
+}
+
+// matchesProtocol returns whether d has the family and protocol of req.
+func matchesProtocol(req *linux.InetDiagReqV2, d *netstack.SockDiag) bool {
+	if d.Family != int(req.Family) {
+		return false
+	}
+	switch req.Protocol {
+	case linux.IPPROTO_TCP:
+		return d.Type == linux.SOCK_STREAM && (d.Protocol == 0 || d.Protocol == linux.IPPROTO_TCP)
+	case linux.IPPROTO_UDP:
+		return d.Type == linux.SOCK_DGRAM && (d.Protocol == 0 || d.Protocol == linux.IPPROTO_UDP)
+	case linux.IPPROTO_RAW:
+		// The protocol of raw sockets is in sdiag_raw_protocol, where
+		// IPPROTO_RAW matches all of them.
+		return d.Type == linux.SOCK_RAW && (req.Pad == linux.IPPROTO_RAW || int(req.Pad) == d.Protocol)
+	default:
+		return false
+	}
+}
+
+// addrBytes returns addr as in struct inet_diag_sockid for a socket of the
+// given family. IPv4 addresses of IPv6 sockets are IPv4-mapped.
+func addrBytes(family int, addr tcpip.Address) []byte {
+	if family == linux.AF_INET {
+		b := make([]byte, 4)
+		if addr.Len() == 4 {
+			copy(b, addr.AsSlice())
+		}
+		return b
+	}
+	b := make([]byte, 16)
+	switch addr.Len() {
+	case 4:
+		copy(b, v4MappedPrefix)
+		copy(b[len(v4MappedPrefix):], addr.AsSlice())
+	case 16:
+		copy(b, addr.AsSlice())
+	}
+	return b
+}
+
+// sockID returns the inet_diag_sockid of is.
+func (is *inetSocket) sockID() linux.InetDiagSockID {
+	d := &is.diag
+	id := linux.InetDiagSockID{
+		If:     uint32(d.BoundDevice),
+		Cookie: splitCookie(is.cookie),
+	}
+	id.SPort = [2]byte{byte(d.Local.Port >> 8), byte(d.Local.Port)}
+	id.DPort = [2]byte{byte(d.Remote.Port >> 8), byte(d.Remote.Port)}
+	copy(id.Src[:], addrBytes(d.Family, d.Local.Addr))
+	copy(id.Dst[:], addrBytes(d.Family, d.Remote.Addr))
+	return id
+}
+
+// entry returns the fields of is that bytecode filters on.
+func (is *inetSocket) entry() bytecodeEntry {
+	d := &is.diag
+	return bytecodeEntry{
+		family:  uint8(d.Family),
+		saddr:   addrBytes(d.Family, d.Local.Addr),
+		daddr:   addrBytes(d.Family, d.Remote.Addr),
+		sport:   d.Local.Port,
+		dport:   d.Remote.Port,
+		ifindex: uint32(d.BoundDevice),
+	}
+}
+
+// matchesID returns whether is is the socket identified by the addresses,
+// ports and interface of id. See net/ipv4/inet_diag.c:inet_diag_find_one_icsk.
+func (is *inetSocket) matchesID(id *linux.InetDiagSockID) bool {
+	own := is.sockID()
+	addrLen := 16
+	if is.diag.Family == linux.AF_INET {
+		addrLen = 4
+	}
+	if own.SPort != id.SPort || own.DPort != id.DPort {
+		return false
+	}
+	if string(own.Src[:addrLen]) != string(id.Src[:addrLen]) || string(own.Dst[:addrLen]) != string(id.Dst[:addrLen]) {
+		return false
+	}
+	return id.If == 0 || id.If == own.If
+}
+
+// inetSockets returns the sockets matching the family and protocol of req in
+// the network namespace of s.
+func inetSockets(ctx context.Context, s *netlink.Socket, req *linux.InetDiagReqV2) []inetSocket {
+	var socks []inetSocket
+	forEachSocket(ctx, func(fd *vfs.FileDescription, cookie uint64) bool {
+		d, ok := netstack.Diag(fd)
+		if !ok || d.Namespace != s.NetworkNamespace() || !matchesProtocol(req, &d) {
+			return true
+		}
+		// Take a reference for the caller.
+		fd.IncRef()
+		socks = append(socks, inetSocket{
+			fd:     fd,
+			cookie: cookie,
+			diag:   d,
+		})
+		return true
+	})
+	return socks
+}
+
+// releaseSockets drops the references on socks taken by inetSockets.
+func releaseSockets(ctx context.Context, socks []inetSocket) {
+	for _, is := range socks {
+		is.fd.DecRef(ctx)
+	}
+}
+
+// processInet handles an inet_diag request.
+func processInet(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var req linux.InetDiagReqV2
+	attrs, ok := msg.GetData(&req)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	if !supportedProtocol(&req) {
+		return syserr.ErrNoFileOrDir
+	}
+
+	destroy := msg.Header().Type == linux.SOCK_DESTROY
+	if destroy && !netAdmin(ctx) {
+		return syserr.ErrNotPermitted
+	}
+
+	socks := inetSockets(ctx, s, &req)
+	defer releaseSockets(ctx, socks)
+
+	if !destroy && isDump(msg) {
+		parsed, ok := attrs.Parse()
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+		bc, hasBytecode := parsed[linux.INET_DIAG_REQ_BYTECODE]
+		if hasBytecode {
+			if err := auditBytecode(bc, netAdmin(ctx)); err != nil {
+				return err
+			}
+		}
+
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+		for i := range socks {
+			is := &socks[i]
+			if req.States&(1<<is.diag.State) == 0 {
+				continue
+			}
+			if hasBytecode {
+				e := is.entry()
+				if !runBytecode(bc, &e) {
+					continue
+				}
+			}
+			addInetMessage(ctx, ms, &req, is)
+		}
+		return nil
+	}
+
+	// Find the socket identified by the request.
+	var found *inetSocket
+	for i := range socks {
+		if socks[i].matchesID(&req.ID) {
+			found = &socks[i]
+			break
+		}
+	}
+	if found == nil {
+		return syserr.ErrNoFileOrDir
+	}
+	if err := checkCookie(req.ID.Cookie, found.cookie); err != nil {
+		return err
+	}
+	if destroy {
+		netstack.Destroy(found.fd)
+		return nil
+	}
+	addInetMessage(ctx, ms, &req, found)
+	return nil
+}
+
+// hasExt returns whether req requests the extension attribute ext.
+func hasExt(req *linux.InetDiagReqV2, ext int) bool {
+	return req.Ext&(1<<(ext-1)) != 0
+}
+
+// addInetMessage adds the description of is to ms. See
+// net/ipv4/inet_diag.c:inet_sk_diag_fill.
+func addInetMessage(ctx context.Context, ms *nlmsg.MessageSet, req *linux.InetDiagReqV2, is *inetSocket) {
+	d := &is.diag
+	uid, ino := statSocket(ctx, is.fd)
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.SOCK_DIAG_BY_FAMILY,
+	})
+	m.Put(&linux.InetDiagMsg{
+		Family: uint8(d.Family),
+		State:  uint8(d.State),
+		ID:     is.sockID(),
+		RQueue: d.RecvQueue,
+		WQueue: d.SendQueue,
+		UID:    uid,
+		Inode:  uint32(ino),
+	})
+
+	if d.Family == linux.AF_INET6 {
+		var v6Only uint8
+		if d.V6Only {
+			v6Only = 1
+		}
+		m.PutAttr(linux.INET_DIAG_SKV6ONLY, primitive.AllocateUint8(v6Only))
+	}
+	if d.Type == linux.SOCK_RAW {
+		m.PutAttr(linux.INET_DIAG_PROTOCOL, primitive.AllocateUint8(uint8(d.Protocol)))
+	}
+	if hasExt(req, linux.INET_DIAG_MEMINFO) {
+		m.PutAttr(linux.INET_DIAG_MEMINFO, &linux.InetDiagMemInfo{
+			RMem: d.RecvQueue,
+			WMem: d.SendQueue,
+			TMem: d.SendQueue,
+		})
+	}
+	if hasExt(req, linux.INET_DIAG_SKMEMINFO) {
+		var mem linux.SockMemInfo
+		mem[linux.SK_MEMINFO_RMEM_ALLOC] = d.RecvQueue
+		mem[linux.SK_MEMINFO_RCVBUF] = d.RecvBuf
+		mem[linux.SK_MEMINFO_WMEM_ALLOC] = d.SendQueue
+		mem[linux.SK_MEMINFO_SNDBUF] = d.SendBuf
+		mem[linux.SK_MEMINFO_WMEM_QUEUED] = d.SendQueue
+		m.PutAttr(linux.INET_DIAG_SKMEMINFO, &mem)
+	}
+	if hasExt(req, linux.INET_DIAG_TOS) {
+		m.PutAttr(linux.INET_DIAG_TOS, primitive.AllocateUint8(d.TOS))
+	}
+	if hasExt(req, linux.INET_DIAG_TCLASS) && d.Family == linux.AF_INET6 {
+		m.PutAttr(linux.INET_DIAG_TCLASS, primitive.AllocateUint8(d.TClass))
+	}
+	if d.TCPInfo != nil {
+		if hasExt(req, linux.INET_DIAG_INFO) {
+			m.PutAttr(linux.INET_DIAG_INFO, d.TCPInfo)
+		}
+		if hasExt(req, linux.INET_DIAG_CONG) && d.Congestion != "" {
+			m.PutAttrString(linux.INET_DIAG_CONG, d.Congestion)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sockdiag provides a NETLINK_SOCK_DIAG socket protocol.
+//
+// NETLINK_SOCK_DIAG sockets describe the sockets of the sandbox to tools like
+// ss(8), see sock_diag(7). AF_INET and AF_INET6 requests describe the TCP, UDP
+// and raw sockets of netstack, and AF_UNIX requests describe Unix domain
+// sockets.
+package sockdiag
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+)
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.Protocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_SOCK_DIAG netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_SOCK_DIAG
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	switch msg.Header().Type {
+	case linux.SOCK_DIAG_BY_FAMILY, linux.SOCK_DESTROY:
+	default:
+		// The legacy TCPDIAG_GETSOCK and DCCPDIAG_GETSOCK requests
+		// aren't supported.
+		return syserr.ErrNotSupported
+	}
+
+	var req linux.SockDiagReq
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	switch req.Family {
+	case linux.AF_INET, linux.AF_INET6:
+		return processInet(ctx, s, msg, ms)
+	case linux.AF_UNIX:
+		return processUnix(ctx, s, msg, ms)
+	default:
+		// Like on Linux, families without a handler don't exist. See
+		// net/core/sock_diag.c:__sock_diag_cmd.
+		return syserr.ErrNoFileOrDir
+	}
+}
+
+// isDump returns whether msg requests all matching sockets rather than a
+// single one.
+func isDump(msg *nlmsg.Message) bool {
+	return msg.Header().Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+}
+
+// netAdmin returns whether the caller has CAP_NET_ADMIN.
+func netAdmin(ctx context.Context) bool {
+	return auth.CredentialsFromContext(ctx).HasCapability(linux.CAP_NET_ADMIN)
+}
+
+// forEachSocket calls fn with each socket of the kernel and its cookie, until
+// fn returns false. fn holds a reference on the socket.
+func forEachSocket(ctx context.Context, fn func(fd *vfs.FileDescription, cookie uint64) bool) {
+	for _, se := range kernel.KernelFromContext(ctx).ListSockets() {
+		if !se.Sock.TryIncRef() {
+			// Racing with socket destruction, this is ok.
+			continue
+		}
+		cont := fn(se.Sock, se.ID)
+		se.Sock.DecRef(ctx)
+		if !cont {
+			return
+		}
+	}
+}
+
+// splitCookie splits a socket cookie as in the requests and replies.
+func splitCookie(cookie uint64) [2]uint32 {
+	return [2]uint32{uint32(cookie), uint32(cookie >> 32)}
+}
+
+// checkCookie returns nil if the cookie of a request matches a socket. See
+// net/core/sock_diag.c:sock_diag_check_cookie.
+func checkCookie(req [2]uint32, cookie uint64) *syserr.Error {
+	if req[0] == linux.INET_DIAG_NOCOOKIE && req[1] == linux.INET_DIAG_NOCOOKIE {
+		return nil
+	}
+	if req != splitCookie(cookie) {
+		return syserr.ErrStaleFileHandle
+	}
+	return nil
+}
+
+// statSocket returns the owner of fd in the user namespace of the caller, and
+// its inode number.
+func statSocket(ctx context.Context, fd *vfs.FileDescription) (uint32, uint64) {
+	stat, err := fd.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_UID | linux.STATX_INO})
+	if err != nil {
+		return 0, 0
+	}
+	creds := auth.CredentialsFromContext(ctx)
+	return uint32(auth.KUID(stat.UID).In(creds.UserNamespace).OrOverflow()), stat.Ino
+}
+
+// init registers the NETLINK_SOCK_DIAG provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_SOCK_DIAG, NewProtocol)
+}
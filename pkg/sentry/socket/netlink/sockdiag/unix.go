@@ -0,0 +1,196 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sockdiag
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix"
+	"gvisor.dev/gvisor/pkg/sentry/socket/unix/transport"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// unixSocket is a Unix domain socket described by unix_diag.
+type unixSocket struct {
+	fd     *vfs.FileDescription
+	cookie uint64
+	sock   *unix.Socket
+	uid    uint32
+	ino    uint64
+}
+
+// state returns the TCP_* state of the socket, as reported by Linux for Unix
+// domain sockets.
+func (us *unixSocket) state() uint32 {
+	ep := us.sock.Endpoint()
+	if _, _, listening := transport.ListenQueue(ep); listening {
+		return linux.TCP_LISTEN
+	}
+	if _, connected := transport.Peer(ep); connected {
+		return linux.TCP_ESTABLISHED
+	}
+	return linux.TCP_CLOSE
+}
+
+// unixSockets returns the Unix domain sockets in the network namespace of s.
+// The caller must release them with releaseUnixSockets.
+func unixSockets(ctx context.Context, s *netlink.Socket) []unixSocket {
+	var socks []unixSocket
+	forEachSocket(ctx, func(fd *vfs.FileDescription, cookie uint64) bool {
+		sock, ok := fd.Impl().(*unix.Socket)
+		if !ok || sock.NetworkNamespace() != s.NetworkNamespace() {
+			return true
+		}
+		uid, ino := statSocket(ctx, fd)
+		// Take a reference for the caller.
+		fd.IncRef()
+		socks = append(socks, unixSocket{
+			fd:     fd,
+			cookie: cookie,
+			sock:   sock,
+			uid:    uid,
+			ino:    ino,
+		})
+		return true
+	})
+	return socks
+}
+
+// releaseUnixSockets drops the references on socks taken by unixSockets.
+func releaseUnixSockets(ctx context.Context, socks []unixSocket) {
+	for _, us := range socks {
+		us.fd.DecRef(ctx)
+	}
+}
+
+// processUnix handles a unix_diag request.
+func processUnix(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var req linux.UnixDiagReq
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	if msg.Header().Type == linux.SOCK_DESTROY {
+		// Like on Linux, Unix domain sockets can't be destroyed.
+		return syserr.ErrNotSupported
+	}
+
+	socks := unixSockets(ctx, s)
+	defer releaseUnixSockets(ctx, socks)
+
+	// Peers are identified by their inode number.
+	inodes := make(map[transport.Endpoint]uint64)
+	for _, us := range socks {
+		inodes[us.sock.Endpoint()] = us.ino
+	}
+
+	if isDump(msg) {
+		// We always send back an NLMSG_DONE.
+		ms.Multi = true
+		for i := range socks {
+			us := &socks[i]
+			if req.States&(1<<us.state()) == 0 {
+				continue
+			}
+			addUnixMessage(ms, &req, us, inodes)
+		}
+		return nil
+	}
+
+	if req.Ino == 0 {
+		return syserr.ErrNoFileOrDir
+	}
+	for i := range socks {
+		us := &socks[i]
+		if uint32(us.ino) != req.Ino {
+			continue
+		}
+		if err := checkCookie(req.Cookie, us.cookie); err != nil {
+			return err
+		}
+		addUnixMessage(ms, &req, us, inodes)
+		return nil
+	}
+	return syserr.ErrNoFileOrDir
+}
+
+// addUnixMessage adds the description of us to ms. inodes maps the endpoints
+// of all Unix domain sockets to their inode number. See
+// net/unix/diag.c:sk_diag_fill.
+//
+// The UNIX_DIAG_VFS and UNIX_DIAG_ICONS attributes aren't supported: the
+// inodes of bound paths aren't tracked by endpoints, and connections pending
+// on a listening socket have no inode until they are accepted.
+func addUnixMessage(ms *nlmsg.MessageSet, req *linux.UnixDiagReq, us *unixSocket, inodes map[transport.Endpoint]uint64) {
+	ep := us.sock.Endpoint()
+	m := ms.AddMessage(linux.NetlinkMessageHeader{
+		Type: linux.SOCK_DIAG_BY_FAMILY,
+	})
+	m.Put(&linux.UnixDiagMsg{
+		Family: linux.AF_UNIX,
+		Type:   uint8(ep.Type()),
+		State:  uint8(us.state()),
+		Ino:    uint32(us.ino),
+		Cookie: splitCookie(us.cookie),
+	})
+
+	if req.Show&linux.UDIAG_SHOW_NAME != 0 {
+		if addr, err := ep.GetLocalAddress(); err == nil && addr.Addr != "" {
+			name := primitive.ByteSlice(addr.Addr)
+			m.PutAttr(linux.UNIX_DIAG_NAME, &name)
+		}
+	}
+	if req.Show&linux.UDIAG_SHOW_PEER != 0 {
+		if peer, _ := transport.Peer(ep); peer != nil {
+			if ino, ok := inodes[peer]; ok {
+				m.PutAttr(linux.UNIX_DIAG_PEER, primitive.AllocateUint32(uint32(ino)))
+			}
+		}
+	}
+	if req.Show&linux.UDIAG_SHOW_RQLEN != 0 {
+		var rql linux.UnixDiagRQLen
+		if pending, backlog, listening := transport.ListenQueue(ep); listening {
+			rql.RQueue = uint32(pending)
+			rql.WQueue = uint32(backlog)
+		} else {
+			if v, err := ep.GetSockOptInt(tcpip.ReceiveQueueSizeOption); err == nil {
+				rql.RQueue = uint32(v)
+			}
+			if v, err := ep.GetSockOptInt(tcpip.SendQueueSizeOption); err == nil {
+				rql.WQueue = uint32(v)
+			}
+		}
+		m.PutAttr(linux.UNIX_DIAG_RQLEN, &rql)
+	}
+	if req.Show&linux.UDIAG_SHOW_MEMINFO != 0 {
+		var mem linux.SockMemInfo
+		mem[linux.SK_MEMINFO_RCVBUF] = uint32(ep.SocketOptions().GetReceiveBufferSize())
+		mem[linux.SK_MEMINFO_SNDBUF] = uint32(ep.SocketOptions().GetSendBufferSize())
+		if v, err := ep.GetSockOptInt(tcpip.ReceiveQueueSizeOption); err == nil {
+			mem[linux.SK_MEMINFO_RMEM_ALLOC] = uint32(v)
+		}
+		if v, err := ep.GetSockOptInt(tcpip.SendQueueSizeOption); err == nil {
+			mem[linux.SK_MEMINFO_WMEM_ALLOC] = uint32(v)
+		}
+		m.PutAttr(linux.UNIX_DIAG_MEMINFO, &mem)
+	}
+	if req.Show&linux.UDIAG_SHOW_UID != 0 {
+		m.PutAttr(linux.UNIX_DIAG_UID, primitive.AllocateUint32(us.uid))
+	}
+}
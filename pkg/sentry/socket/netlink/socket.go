@@ -21,7 +21,6 @@ import (
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
-	"gvisor.dev/gvisor/pkg/abi/linux/errno"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
 	"gvisor.dev/gvisor/pkg/hostarch"
@@ -57,8 +56,6 @@ const (
 	maxSendBufferSize = 4 << 20 // 4MB
 )
 
-var errNoFilter = syserr.New("no filter attached", errno.ENOENT)
-
 // Socket is the base socket type for netlink sockets.
 //
 // This implementation only supports userspace sending and receiving messages
@@ -105,14 +102,11 @@ type Socket struct {
 	// fixed buffer but only consume this many bytes.
 	sendBufferSize uint32
 
-	// filter indicates that this socket has a BPF filter "installed".
-	//
-	// TODO(gvisor.dev/issue/1119): We don't actually support filtering,
-	// this is just bookkeeping for tracking add/remove.
-	filter bool
-
 	// netns is the network namespace associated with the socket.
 	netns *inet.Namespace
+
+	// groups is the set of multicast groups the socket is a member of.
+	groups map[uint32]struct{}
 }
 
 var _ socket.Socket = (*Socket)(nil)
@@ -155,6 +149,11 @@ func (s *Socket) Stack() inet.Stack {
 	return s.netns.Stack()
 }
 
+// NetworkNamespace returns the network namespace of the socket.
+func (s *Socket) NetworkNamespace() *inet.Namespace {
+	return s.netns
+}
+
 // Release implements vfs.FileDescriptionImpl.Release.
 func (s *Socket) Release(ctx context.Context) {
 	t := kernel.TaskFromContext(ctx)
@@ -162,6 +161,10 @@ func (s *Socket) Release(ctx context.Context) {
 	s.connection.Release(ctx)
 	s.ep.Close(ctx)
 
+	s.mu.Lock()
+	s.leaveAllGroupsLocked()
+	s.mu.Unlock()
+
 	if s.bound {
 		s.ports.Release(s.protocol.Protocol(), s.portID)
 	}
@@ -311,15 +314,31 @@ func (s *Socket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 		return err
 	}
 
-	// No support for multicast groups yet.
-	if a.Groups != 0 {
-		return syserr.ErrPermissionDenied
+	// Multicast groups 1 to 32 can be joined by bind(2), which replaces
+	// the memberships of these groups.
+	for group := uint32(1); group <= 32; group++ {
+		if a.Groups&(1<<(group-1)) == 0 {
+			continue
+		}
+		if err := s.checkJoinGroup(t, group); err != nil {
+			return err
+		}
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.bindPort(t, int32(a.PortID))
+	if err := s.bindPort(t, int32(a.PortID)); err != nil {
+		return err
+	}
+	for group := uint32(1); group <= 32; group++ {
+		if a.Groups&(1<<(group-1)) != 0 {
+			s.joinGroupLocked(group)
+		} else if _, ok := s.groups[group]; ok {
+			s.leaveGroupLocked(group)
+		}
+	}
+	return nil
 }
 
 // Connect implements socket.Socket.Connect.
@@ -414,6 +433,16 @@ func (s *Socket) GetSockOpt(t *kernel.Task, level int, name int, outPtr hostarch
 			}
 			recvTimeout := linux.NsecToTimeval(s.RecvTimeout())
 			return &recvTimeout, nil
+
+		case linux.SO_LOCK_FILTER:
+			if outLen < sizeOfInt32 {
+				return nil, syserr.ErrInvalidArgument
+			}
+			var locked primitive.Int32
+			if s.ep.SocketOptions().GetLockFilter() {
+				locked = 1
+			}
+			return &locked, nil
 		}
 	case linux.SOL_NETLINK:
 		switch name {
@@ -469,36 +498,22 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *sy
 			return nil
 
 		case linux.SO_ATTACH_FILTER:
-			// TODO(gvisor.dev/issue/1119): We don't actually
-			// support filtering. If this socket can't ever send
-			// messages, then there is nothing to filter and we can
-			// advertise support. Otherwise, be conservative and
-			// return an error.
-			if s.protocol.CanSend() {
-				return syserr.ErrProtocolNotAvailable
+			f, err := socket.CopyInFilter(t, opt)
+			if err != nil {
+				return err
 			}
-
-			s.mu.Lock()
-			s.filter = true
-			s.mu.Unlock()
-			return nil
+			return syserr.TranslateNetstackError(s.ep.SocketOptions().SetFilter(f))
 
 		case linux.SO_DETACH_FILTER:
-			// TODO(gvisor.dev/issue/1119): See above.
-			if s.protocol.CanSend() {
-				return syserr.ErrProtocolNotAvailable
-			}
-
-			s.mu.Lock()
-			filter := s.filter
-			s.filter = false
-			s.mu.Unlock()
+			// optval is ignored.
+			return syserr.TranslateNetstackError(s.ep.SocketOptions().SetFilter(nil))
 
-			if !filter {
-				return errNoFilter
+		case linux.SO_LOCK_FILTER:
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
 			}
-
-			return nil
+			v := hostarch.ByteOrder.Uint32(opt)
+			return syserr.TranslateNetstackError(s.ep.SocketOptions().SetLockFilter(v != 0))
 
 		case linux.SO_SNDTIMEO:
 			if len(opt) < linux.SizeOfTimeval {
@@ -528,10 +543,30 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *sy
 		}
 	case linux.SOL_NETLINK:
 		switch name {
-		case linux.NETLINK_ADD_MEMBERSHIP,
-			linux.NETLINK_BROADCAST_ERROR,
+		case linux.NETLINK_ADD_MEMBERSHIP, linux.NETLINK_DROP_MEMBERSHIP:
+			if _, ok := s.protocol.(MulticastProtocol); !ok {
+				// Not supported.
+				break
+			}
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+			group := hostarch.ByteOrder.Uint32(opt)
+			if name == linux.NETLINK_ADD_MEMBERSHIP {
+				return s.joinGroup(t, group)
+			}
+			if group == 0 {
+				return syserr.ErrInvalidArgument
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if _, ok := s.groups[group]; ok {
+				s.leaveGroupLocked(group)
+			}
+			return nil
+
+		case linux.NETLINK_BROADCAST_ERROR,
 			linux.NETLINK_CAP_ACK,
-			linux.NETLINK_DROP_MEMBERSHIP,
 			linux.NETLINK_DUMP_STRICT_CHK,
 			linux.NETLINK_EXT_ACK,
 			linux.NETLINK_LISTEN_ALL_NSID,
@@ -553,6 +588,7 @@ func (s *Socket) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Er
 	sa := &linux.SockAddrNetlink{
 		Family: linux.AF_NETLINK,
 		PortID: uint32(s.portID),
+		Groups: s.groupsMask(),
 	}
 	return sa, uint32(sa.SizeBytes()), nil
 }
@@ -661,6 +697,29 @@ func (kernelSCM) Credentials(*kernel.Task) (kernel.ThreadID, auth.UID, auth.GID)
 // kernelCreds is the concrete version of kernelSCM used in all creds.
 var kernelCreds = &kernelSCM{}
 
+// filterDatagram runs the filter attached to the socket, if any, over the
+// datagram made of bufs. It returns nil if the datagram must be dropped, and
+// otherwise the datagram truncated to the length accepted by the filter. See
+// net/netlink/af_netlink.c:netlink_unicast.
+func (s *Socket) filterDatagram(bufs [][]byte) [][]byte {
+	filter := s.ep.SocketOptions().GetFilter()
+	if filter == nil {
+		return bufs
+	}
+	var datagram []byte
+	for _, buf := range bufs {
+		datagram = append(datagram, buf...)
+	}
+	n := filter.Run(datagram)
+	if n == 0 {
+		return nil
+	}
+	if int(n) < len(datagram) {
+		return [][]byte{datagram[:n]}
+	}
+	return bufs
+}
+
 // sendResponse sends the response messages in ms back to userspace.
 func (s *Socket) sendResponse(ctx context.Context, ms *nlmsg.MessageSet) *syserr.Error {
 	// Linux combines multiple netlink messages into a single datagram.
@@ -674,6 +733,9 @@ func (s *Socket) sendResponse(ctx context.Context, ms *nlmsg.MessageSet) *syserr
 		Credentials: kernelCreds,
 	}
 
+	if len(bufs) > 0 {
+		bufs = s.filterDatagram(bufs)
+	}
 	if len(bufs) > 0 {
 		// RecvMsg never receives the address, so we don't need to send
 		// one.
@@ -704,12 +766,14 @@ func (s *Socket) sendResponse(ctx context.Context, ms *nlmsg.MessageSet) *syserr
 		// Add the dump_done_errno payload.
 		m.Put(primitive.AllocateInt64(0))
 
-		_, notify, err := s.connection.Send(ctx, [][]byte{m.Finalize()}, cms, transport.Address{})
-		if err != nil && err != syserr.ErrWouldBlock {
-			return err
-		}
-		if notify {
-			s.connection.SendNotify()
+		if done := s.filterDatagram([][]byte{m.Finalize()}); done != nil {
+			_, notify, err := s.connection.Send(ctx, done, cms, transport.Address{})
+			if err != nil && err != syserr.ErrWouldBlock {
+				return err
+			}
+			if notify {
+				s.connection.SendNotify()
+			}
 		}
 	}
 
@@ -44,11 +44,6 @@ func (p *Protocol) Protocol() int {
 	return linux.NETLINK_KOBJECT_UEVENT
 }
 
-// CanSend implements netlink.Protocol.CanSend.
-func (p *Protocol) CanSend() bool {
-	return false
-}
-
 // ProcessMessage implements netlink.Protocol.ProcessMessage.
 func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
 	// Silently ignore all messages.
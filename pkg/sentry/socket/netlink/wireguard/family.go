@@ -0,0 +1,417 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wireguard provides the "wireguard" generic netlink family, which
+// configures the WireGuard interfaces of netstack. It is the interface used by
+// wg(8).
+package wireguard
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/genetlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	wglink "gvisor.dev/gvisor/pkg/tcpip/link/wireguard"
+)
+
+// maxNestedLen is the maximum size of the payload of a nested attribute,
+// whose length is 16 bits. Replies with more peers or allowed IPs than fit are
+// split across messages, which wg(8) merges.
+const maxNestedLen = math.MaxUint16 - linux.NetlinkAttrHeaderSize
+
+// familyID is the generic netlink ID of the family.
+var familyID uint16
+
+// family implements genetlink.Family.
+type family struct{}
+
+// Name implements genetlink.Family.Name.
+func (family) Name() string {
+	return linux.WG_GENL_NAME
+}
+
+// Version implements genetlink.Family.Version.
+func (family) Version() uint32 {
+	return linux.WG_GENL_VERSION
+}
+
+// MaxAttr implements genetlink.Family.MaxAttr.
+func (family) MaxAttr() uint32 {
+	return linux.WGDEVICE_A_PEERS
+}
+
+// Ops implements genetlink.Family.Ops.
+func (family) Ops() []genetlink.Op {
+	// Both commands need CAP_NET_ADMIN, as they expose or change private
+	// keys. Like on Linux, the device can only be dumped.
+	return []genetlink.Op{
+		{
+			Cmd:   linux.WG_CMD_GET_DEVICE,
+			Flags: linux.GENL_UNS_ADMIN_PERM | linux.GENL_CMD_CAP_DUMP,
+		},
+		{
+			Cmd:   linux.WG_CMD_SET_DEVICE,
+			Flags: linux.GENL_UNS_ADMIN_PERM | linux.GENL_CMD_CAP_DO,
+		},
+	}
+}
+
+// MulticastGroups implements genetlink.Family.MulticastGroups.
+func (family) MulticastGroups() []genetlink.MulticastGroup {
+	return nil
+}
+
+// ProcessMessage implements genetlink.Family.ProcessMessage.
+func (family) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, hdr linux.GenericNetlinkHeader, attrs nlmsg.AttrsView, ms *nlmsg.MessageSet) *syserr.Error {
+	parsed, ok := genetlink.ParseAttrs(attrs)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	stk, ok := s.Stack().(*netstack.Stack)
+	if !ok {
+		return syserr.ErrNotSupported
+	}
+	ep, index, name, err := lookupDevice(stk, parsed)
+	if err != nil {
+		return err
+	}
+
+	switch hdr.Command {
+	case linux.WG_CMD_GET_DEVICE:
+		getDevice(ep, index, name, ms)
+		return nil
+	case linux.WG_CMD_SET_DEVICE:
+		cfg, err := parseDeviceConfig(parsed)
+		if err != nil {
+			return err
+		}
+		if err := ep.Configure(cfg); err != nil {
+			return syserr.TranslateNetstackError(err)
+		}
+		return nil
+	default:
+		return syserr.ErrNotSupported
+	}
+}
+
+// lookupDevice returns the WireGuard interface identified by the
+// WGDEVICE_A_IFINDEX or WGDEVICE_A_IFNAME attribute.
+func lookupDevice(stk *netstack.Stack, attrs map[uint16]nlmsg.BytesView) (*wglink.Endpoint, int32, string, *syserr.Error) {
+	v, hasIndex := attrs[linux.WGDEVICE_A_IFINDEX]
+	name, hasName := attrs[linux.WGDEVICE_A_IFNAME]
+	if hasIndex == hasName {
+		return nil, 0, "", syserr.ErrInvalidArgument
+	}
+	if hasIndex {
+		index, ok := v.Uint32()
+		if !ok || index == 0 {
+			return nil, 0, "", syserr.ErrInvalidArgument
+		}
+		return stk.WireGuardInterface(int32(index), "")
+	}
+	return stk.WireGuardInterface(0, name.String())
+}
+
+// getDevice adds the messages describing the interface to ms.
+func getDevice(ep *wglink.Endpoint, index int32, name string, ms *nlmsg.MessageSet) {
+	info := ep.Info()
+
+	var attrs genetlink.AttrWriter
+	attrs.PutUint32(linux.WGDEVICE_A_IFINDEX, uint32(index))
+	attrs.PutString(linux.WGDEVICE_A_IFNAME, name)
+	if !info.PrivateKey.IsZero() {
+		attrs.Put(linux.WGDEVICE_A_PRIVATE_KEY, info.PrivateKey[:])
+		attrs.Put(linux.WGDEVICE_A_PUBLIC_KEY, info.PublicKey[:])
+	}
+	attrs.PutUint16(linux.WGDEVICE_A_LISTEN_PORT, info.ListenPort)
+	attrs.PutUint32(linux.WGDEVICE_A_FWMARK, info.Fwmark)
+
+	// Peers are written to as many messages as needed. A peer whose allowed
+	// IPs don't fit is continued in the next message, identified by its
+	// public key alone.
+	var peers genetlink.AttrWriter
+	flush := func() {
+		if len(peers) > 0 {
+			attrs.Put(linux.WGDEVICE_A_PEERS|linux.NLA_F_NESTED, peers)
+		}
+		m := genetlink.AddMessage(ms, familyID, linux.WG_CMD_GET_DEVICE, linux.WG_GENL_VERSION)
+		attrs.AppendTo(m)
+		attrs = nil
+		peers = nil
+		attrs.PutUint32(linux.WGDEVICE_A_IFINDEX, uint32(index))
+		attrs.PutString(linux.WGDEVICE_A_IFNAME, name)
+	}
+	for i := range info.Peers {
+		p := &info.Peers[i]
+		allowedIPs := p.AllowedIPs
+		first := true
+		for first || len(allowedIPs) > 0 {
+			peer, n := peerAttrs(p, first, allowedIPs, maxNestedLen-len(peers))
+			if peer == nil {
+				// Not even the peer header fits.
+				flush()
+				continue
+			}
+			peers.Put(uint16(i)|linux.NLA_F_NESTED, peer)
+			allowedIPs = allowedIPs[n:]
+			first = false
+			if len(allowedIPs) > 0 {
+				flush()
+			}
+		}
+	}
+	flush()
+}
+
+// peerAttrs returns the attributes of p, including as many of allowedIPs as
+// fit in space, and the number of allowed IPs included. It returns nil if the
+// attributes don't fit in space without allowed IPs. If first is false, only
+// the public key of p and its allowed IPs are included.
+func peerAttrs(p *wglink.PeerInfo, first bool, allowedIPs []tcpip.Subnet, space int) (genetlink.AttrWriter, int) {
+	var attrs genetlink.AttrWriter
+	attrs.Put(linux.WGPEER_A_PUBLIC_KEY, p.PublicKey[:])
+	if first {
+		attrs.Put(linux.WGPEER_A_PRESHARED_KEY, p.PresharedKey[:])
+		var ts linux.Timespec
+		if !p.LastHandshake.IsZero() {
+			ts = linux.NsecToTimespec(p.LastHandshake.UnixNano())
+		}
+		attrs.Put(linux.WGPEER_A_LAST_HANDSHAKE_TIME, marshal.Marshal(&ts))
+		attrs.PutUint16(linux.WGPEER_A_PERSISTENT_KEEPALIVE_INTERVAL, uint16(p.PersistentKeepalive/time.Second))
+		attrs.PutUint64(linux.WGPEER_A_TX_BYTES, p.TxBytes)
+		attrs.PutUint64(linux.WGPEER_A_RX_BYTES, p.RxBytes)
+		attrs.PutUint32(linux.WGPEER_A_PROTOCOL_VERSION, 1)
+		if p.Endpoint.Addr.Len() != 0 {
+			family := linux.AF_INET
+			if p.Endpoint.Addr.Len() == header.IPv6AddressSize {
+				family = linux.AF_INET6
+			}
+			addr, _ := socket.ConvertAddress(family, p.Endpoint)
+			attrs.Put(linux.WGPEER_A_ENDPOINT, marshal.Marshal(addr))
+		}
+	}
+	// The nested headers of the peer and its allowed IPs.
+	overhead := 2 * linux.NetlinkAttrHeaderSize
+	if len(attrs)+overhead > space {
+		return nil, 0
+	}
+
+	var ips genetlink.AttrWriter
+	n := 0
+	for _, subnet := range allowedIPs {
+		var ip genetlink.AttrWriter
+		id := subnet.ID()
+		family := uint16(linux.AF_INET)
+		if id.Len() == header.IPv6AddressSize {
+			family = linux.AF_INET6
+		}
+		ip.PutUint16(linux.WGALLOWEDIP_A_FAMILY, family)
+		ip.Put(linux.WGALLOWEDIP_A_IPADDR, id.AsSlice())
+		ip.Put(linux.WGALLOWEDIP_A_CIDR_MASK, []byte{uint8(subnet.Prefix())})
+		if len(attrs)+overhead+len(ips)+linux.NetlinkAttrHeaderSize+len(ip) > space {
+			break
+		}
+		ips.Put(uint16(n)|linux.NLA_F_NESTED, ip)
+		n++
+	}
+	if len(ips) > 0 {
+		attrs.Put(linux.WGPEER_A_ALLOWEDIPS|linux.NLA_F_NESTED, ips)
+	}
+	return attrs, n
+}
+
+// parseDeviceConfig parses the attributes of WG_CMD_SET_DEVICE.
+func parseDeviceConfig(attrs map[uint16]nlmsg.BytesView) (wglink.Config, *syserr.Error) {
+	var cfg wglink.Config
+	if v, ok := attrs[linux.WGDEVICE_A_FLAGS]; ok {
+		flags, ok := v.Uint32()
+		if !ok {
+			return cfg, syserr.ErrInvalidArgument
+		}
+		if flags&^linux.WGDEVICE_F_REPLACE_PEERS != 0 {
+			return cfg, syserr.ErrNotSupported
+		}
+		cfg.ReplacePeers = flags&linux.WGDEVICE_F_REPLACE_PEERS != 0
+	}
+	if v, ok := attrs[linux.WGDEVICE_A_PRIVATE_KEY]; ok {
+		key, ok := parseKey(v)
+		if !ok {
+			return cfg, syserr.ErrInvalidArgument
+		}
+		cfg.PrivateKey = &key
+	}
+	if v, ok := attrs[linux.WGDEVICE_A_LISTEN_PORT]; ok {
+		port, ok := genetlink.Uint16(v)
+		if !ok {
+			return cfg, syserr.ErrInvalidArgument
+		}
+		cfg.ListenPort = &port
+	}
+	if v, ok := attrs[linux.WGDEVICE_A_FWMARK]; ok {
+		mark, ok := v.Uint32()
+		if !ok {
+			return cfg, syserr.ErrInvalidArgument
+		}
+		cfg.Fwmark = &mark
+	}
+	if v, ok := attrs[linux.WGDEVICE_A_PEERS]; ok {
+		peers, ok := genetlink.ParseList(v)
+		if !ok {
+			return cfg, syserr.ErrInvalidArgument
+		}
+		for _, peer := range peers {
+			pc, err := parsePeerConfig(peer)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.Peers = append(cfg.Peers, pc)
+		}
+	}
+	return cfg, nil
+}
+
+// parsePeerConfig parses a peer of WG_CMD_SET_DEVICE.
+func parsePeerConfig(v nlmsg.AttrsView) (wglink.PeerConfig, *syserr.Error) {
+	var pc wglink.PeerConfig
+	attrs, ok := genetlink.ParseAttrs(v)
+	if !ok {
+		return pc, syserr.ErrInvalidArgument
+	}
+	key, ok := attrs[linux.WGPEER_A_PUBLIC_KEY]
+	if !ok {
+		return pc, syserr.ErrInvalidArgument
+	}
+	if pc.PublicKey, ok = parseKey(key); !ok {
+		return pc, syserr.ErrInvalidArgument
+	}
+	if v, ok := attrs[linux.WGPEER_A_PROTOCOL_VERSION]; ok {
+		version, ok := v.Uint32()
+		if !ok {
+			return pc, syserr.ErrInvalidArgument
+		}
+		if version != 1 {
+			return pc, syserr.ErrProtocolNotSupported
+		}
+	}
+	if v, ok := attrs[linux.WGPEER_A_FLAGS]; ok {
+		flags, ok := v.Uint32()
+		if !ok {
+			return pc, syserr.ErrInvalidArgument
+		}
+		if flags&^(linux.WGPEER_F_REMOVE_ME|linux.WGPEER_F_REPLACE_ALLOWEDIPS|linux.WGPEER_F_UPDATE_ONLY) != 0 {
+			return pc, syserr.ErrNotSupported
+		}
+		pc.Remove = flags&linux.WGPEER_F_REMOVE_ME != 0
+		pc.ReplaceAllowedIPs = flags&linux.WGPEER_F_REPLACE_ALLOWEDIPS != 0
+		pc.UpdateOnly = flags&linux.WGPEER_F_UPDATE_ONLY != 0
+	}
+	if v, ok := attrs[linux.WGPEER_A_PRESHARED_KEY]; ok {
+		psk, ok := parseKey(v)
+		if !ok {
+			return pc, syserr.ErrInvalidArgument
+		}
+		pc.PresharedKey = &psk
+	}
+	if v, ok := attrs[linux.WGPEER_A_ENDPOINT]; ok {
+		addr, family, err := socket.AddressAndFamily(v)
+		if err != nil {
+			return pc, err
+		}
+		if (family != linux.AF_INET && family != linux.AF_INET6) || addr.Addr.Len() == 0 {
+			return pc, syserr.ErrInvalidArgument
+		}
+		pc.Endpoint = &addr
+	}
+	if v, ok := attrs[linux.WGPEER_A_PERSISTENT_KEEPALIVE_INTERVAL]; ok {
+		secs, ok := genetlink.Uint16(v)
+		if !ok {
+			return pc, syserr.ErrInvalidArgument
+		}
+		interval := time.Duration(secs) * time.Second
+		pc.PersistentKeepalive = &interval
+	}
+	if v, ok := attrs[linux.WGPEER_A_ALLOWEDIPS]; ok {
+		ips, ok := genetlink.ParseList(v)
+		if !ok {
+			return pc, syserr.ErrInvalidArgument
+		}
+		for _, ip := range ips {
+			subnet, err := parseAllowedIP(ip)
+			if err != nil {
+				return pc, err
+			}
+			pc.AllowedIPs = append(pc.AllowedIPs, subnet)
+		}
+	}
+	return pc, nil
+}
+
+// parseAllowedIP parses an allowed IP of a peer.
+func parseAllowedIP(v nlmsg.AttrsView) (tcpip.Subnet, *syserr.Error) {
+	attrs, ok := genetlink.ParseAttrs(v)
+	if !ok {
+		return tcpip.Subnet{}, syserr.ErrInvalidArgument
+	}
+	familyAttr, hasFamily := attrs[linux.WGALLOWEDIP_A_FAMILY]
+	addr, hasAddr := attrs[linux.WGALLOWEDIP_A_IPADDR]
+	mask, hasMask := attrs[linux.WGALLOWEDIP_A_CIDR_MASK]
+	if !hasFamily || !hasAddr || !hasMask || len(mask) != 1 {
+		return tcpip.Subnet{}, syserr.ErrInvalidArgument
+	}
+	family, ok := genetlink.Uint16(familyAttr)
+	if !ok {
+		return tcpip.Subnet{}, syserr.ErrInvalidArgument
+	}
+	var size int
+	switch family {
+	case linux.AF_INET:
+		size = header.IPv4AddressSize
+	case linux.AF_INET6:
+		size = header.IPv6AddressSize
+	default:
+		return tcpip.Subnet{}, syserr.ErrAddressFamilyNotSupported
+	}
+	if len(addr) != size || int(mask[0]) > size*8 {
+		return tcpip.Subnet{}, syserr.ErrInvalidArgument
+	}
+	return tcpip.AddressWithPrefix{
+		Address:   tcpip.AddrFromSlice(addr),
+		PrefixLen: int(mask[0]),
+	}.Subnet(), nil
+}
+
+// parseKey parses a key attribute.
+func parseKey(v nlmsg.BytesView) (wglink.Key, bool) {
+	var key wglink.Key
+	if len(v) != len(key) {
+		return key, false
+	}
+	copy(key[:], v)
+	return key, true
+}
+
+// init registers the family.
+func init() {
+	familyID = genetlink.RegisterFamily(family{})
+}
@@ -0,0 +1,906 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package xfrm provides a NETLINK_XFRM socket protocol, which configures the
+// IPsec states and policies of netstack.
+//
+// Only ESP states with the rfc4106(gcm(aes)) AEAD algorithm are supported.
+// Acquire, migrate and asynchronous event messages are not supported.
+package xfrm
+
+import (
+	"math"
+	"math/bits"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// maxTemplates is the maximum number of templates of a policy, XFRM_MAX_DEPTH
+// in include/net/xfrm.h.
+const maxTemplates = 6
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct{}
+
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_XFRM netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	netns := t.NetworkNamespace()
+	if stk, ok := netns.Stack().(*netstack.Stack); ok {
+		stk.Stack.SetXFRMDispatcher(&dispatcher{
+			k:     t.Kernel(),
+			netns: netns,
+		})
+	}
+	return &Protocol{}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_XFRM
+}
+
+// CanJoinGroup implements netlink.MulticastProtocol.CanJoinGroup.
+func (p *Protocol) CanJoinGroup(ctx context.Context, s *netlink.Socket, group uint32) *syserr.Error {
+	if group > linux.XFRMNLGRP_MAPPING {
+		return syserr.ErrInvalidArgument
+	}
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrNotPermitted
+	}
+	return nil
+}
+
+// netstackOf returns the netstack stack of the socket, or nil if the socket
+// isn't backed by netstack.
+func netstackOf(s *netlink.Socket) *stack.Stack {
+	if stk, ok := s.Stack().(*netstack.Stack); ok {
+		return stk.Stack
+	}
+	return nil
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, s *netlink.Socket, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	// All XFRM messages require CAP_NET_ADMIN. See
+	// net/xfrm/xfrm_user.c:xfrm_user_rcv_msg.
+	creds := auth.CredentialsFromContext(ctx)
+	if !creds.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrNotPermitted
+	}
+	stk := netstackOf(s)
+	if stk == nil {
+		return syserr.ErrNotSupported
+	}
+
+	hdr := msg.Header()
+	dump := hdr.Flags&linux.NLM_F_DUMP == linux.NLM_F_DUMP
+	switch hdr.Type {
+	case linux.XFRM_MSG_NEWSA, linux.XFRM_MSG_UPDSA:
+		return newSA(ctx, s, stk, msg)
+	case linux.XFRM_MSG_DELSA:
+		return delSA(ctx, s, stk, msg)
+	case linux.XFRM_MSG_GETSA:
+		if dump {
+			return dumpSA(stk, ms)
+		}
+		return getSA(stk, msg, ms)
+	case linux.XFRM_MSG_FLUSHSA:
+		return flushSA(ctx, s, stk, msg)
+	case linux.XFRM_MSG_ALLOCSPI:
+		return allocSPI(stk, msg, ms)
+	case linux.XFRM_MSG_NEWPOLICY, linux.XFRM_MSG_UPDPOLICY:
+		return newPolicy(ctx, s, stk, msg)
+	case linux.XFRM_MSG_DELPOLICY:
+		return delPolicy(ctx, s, stk, msg)
+	case linux.XFRM_MSG_GETPOLICY:
+		if dump {
+			return dumpPolicy(stk, ms)
+		}
+		return getPolicy(stk, msg, ms)
+	case linux.XFRM_MSG_FLUSHPOLICY:
+		return flushPolicy(ctx, s, stk)
+	default:
+		return syserr.ErrNotSupported
+	}
+}
+
+// translateError translates the errors of the XFRM databases of the stack
+// to the errors returned by Linux. notFound is the error of missing entries,
+// which differs between states and policies.
+func translateError(err tcpip.Error, notFound *syserr.Error) *syserr.Error {
+	switch err.(type) {
+	case *tcpip.ErrDuplicateAddress:
+		return syserr.ErrExists
+	case *tcpip.ErrNoSuchFile:
+		return notFound
+	default:
+		return syserr.TranslateNetstackError(err)
+	}
+}
+
+// ntohl converts a 32-bit number from network byte order to host byte order.
+// It assumes that the host is little endian.
+func ntohl(v uint32) uint32 {
+	return bits.ReverseBytes32(v)
+}
+
+// htonl converts a 32-bit number from host byte order to network byte order.
+// It assumes that the host is little endian.
+func htonl(v uint32) uint32 {
+	return ntohl(v)
+}
+
+// netProtoOf returns the network protocol of an address family.
+func netProtoOf(family uint16) (tcpip.NetworkProtocolNumber, bool) {
+	switch family {
+	case linux.AF_INET:
+		return header.IPv4ProtocolNumber, true
+	case linux.AF_INET6:
+		return header.IPv6ProtocolNumber, true
+	default:
+		return 0, false
+	}
+}
+
+// familyOf returns the address family of a network protocol.
+func familyOf(netProto tcpip.NetworkProtocolNumber) uint16 {
+	switch netProto {
+	case header.IPv4ProtocolNumber:
+		return linux.AF_INET
+	case header.IPv6ProtocolNumber:
+		return linux.AF_INET6
+	default:
+		return linux.AF_UNSPEC
+	}
+}
+
+// addrOf returns the address of the given protocol stored in a.
+func addrOf(netProto tcpip.NetworkProtocolNumber, a linux.Inet6Addr) tcpip.Address {
+	switch netProto {
+	case header.IPv4ProtocolNumber:
+		return tcpip.AddrFrom4Slice(a[:header.IPv4AddressSize])
+	case header.IPv6ProtocolNumber:
+		return tcpip.AddrFrom16(a)
+	default:
+		return tcpip.Address{}
+	}
+}
+
+// optionalAddrOf is like addrOf, but returns no address for the unspecified
+// address, which templates use as a wildcard.
+func optionalAddrOf(netProto tcpip.NetworkProtocolNumber, a linux.Inet6Addr) tcpip.Address {
+	if a == (linux.Inet6Addr{}) {
+		return tcpip.Address{}
+	}
+	return addrOf(netProto, a)
+}
+
+// inet6AddrOf returns addr as an xfrm_address_t.
+func inet6AddrOf(addr tcpip.Address) linux.Inet6Addr {
+	var a linux.Inet6Addr
+	copy(a[:], addr.AsSlice())
+	return a
+}
+
+// selectorOf converts an xfrm_selector.
+func selectorOf(sel *linux.XFRMSelector) (stack.XFRMSelector, *syserr.Error) {
+	var netProto tcpip.NetworkProtocolNumber
+	if sel.Family != linux.AF_UNSPEC {
+		var ok bool
+		if netProto, ok = netProtoOf(sel.Family); !ok {
+			return stack.XFRMSelector{}, syserr.ErrAddressFamilyNotSupported
+		}
+	}
+	// See net/xfrm/xfrm_user.c:verify_newpolicy_info.
+	maxPrefixLen := uint8(header.IPv6AddressSize * 8)
+	if netProto == header.IPv4ProtocolNumber {
+		maxPrefixLen = uint8(header.IPv4AddressSize * 8)
+	}
+	if sel.PrefixlenD > maxPrefixLen || sel.PrefixlenS > maxPrefixLen {
+		return stack.XFRMSelector{}, syserr.ErrInvalidArgument
+	}
+	return stack.XFRMSelector{
+		NetProto:             netProto,
+		SourceAddress:        addrOf(netProto, sel.Saddr),
+		SourcePrefixLen:      sel.PrefixlenS,
+		DestinationAddress:   addrOf(netProto, sel.Daddr),
+		DestinationPrefixLen: sel.PrefixlenD,
+		Protocol:             tcpip.TransportProtocolNumber(sel.Proto),
+		SourcePort:           socket.Ntohs(sel.Sport),
+		SourcePortMask:       socket.Ntohs(sel.SportMask),
+		DestinationPort:      socket.Ntohs(sel.Dport),
+		DestinationPortMask:  socket.Ntohs(sel.DportMask),
+		NICID:                tcpip.NICID(sel.Ifindex),
+	}, nil
+}
+
+// xfrmSelectorOf converts a selector to an xfrm_selector.
+func xfrmSelectorOf(sel *stack.XFRMSelector) linux.XFRMSelector {
+	return linux.XFRMSelector{
+		Daddr:      inet6AddrOf(sel.DestinationAddress),
+		Saddr:      inet6AddrOf(sel.SourceAddress),
+		Dport:      socket.Htons(sel.DestinationPort),
+		DportMask:  socket.Htons(sel.DestinationPortMask),
+		Sport:      socket.Htons(sel.SourcePort),
+		SportMask:  socket.Htons(sel.SourcePortMask),
+		Family:     familyOf(sel.NetProto),
+		PrefixlenD: sel.DestinationPrefixLen,
+		PrefixlenS: sel.SourcePrefixLen,
+		Proto:      uint8(sel.Protocol),
+		Ifindex:    int32(sel.NICID),
+	}
+}
+
+// limitOf converts a byte or packet limit, where XFRM_INF is unlimited.
+func limitOf(v uint64) uint64 {
+	if v == linux.XFRM_INF {
+		return 0
+	}
+	return v
+}
+
+// xfrmLimitOf converts a byte or packet limit to its XFRM value.
+func xfrmLimitOf(v uint64) uint64 {
+	if v == 0 {
+		return linux.XFRM_INF
+	}
+	return v
+}
+
+// durationOf converts a time limit in seconds.
+func durationOf(v uint64) time.Duration {
+	if v > math.MaxInt64/uint64(time.Second) {
+		// Too far to ever expire.
+		return 0
+	}
+	return time.Duration(v) * time.Second
+}
+
+// lifetimeOf converts an xfrm_lifetime_cfg.
+func lifetimeOf(l *linux.XFRMLifetimeConfig) stack.XFRMLifetime {
+	return stack.XFRMLifetime{
+		SoftBytes:   limitOf(l.SoftByteLimit),
+		HardBytes:   limitOf(l.HardByteLimit),
+		SoftPackets: limitOf(l.SoftPacketLimit),
+		HardPackets: limitOf(l.HardPacketLimit),
+		SoftAdd:     durationOf(l.SoftAddExpiresSeconds),
+		HardAdd:     durationOf(l.HardAddExpiresSeconds),
+		SoftUse:     durationOf(l.SoftUseExpiresSeconds),
+		HardUse:     durationOf(l.HardUseExpiresSeconds),
+	}
+}
+
+// xfrmLifetimeOf converts a lifetime to an xfrm_lifetime_cfg.
+func xfrmLifetimeOf(l *stack.XFRMLifetime) linux.XFRMLifetimeConfig {
+	return linux.XFRMLifetimeConfig{
+		SoftByteLimit:         xfrmLimitOf(l.SoftBytes),
+		HardByteLimit:         xfrmLimitOf(l.HardBytes),
+		SoftPacketLimit:       xfrmLimitOf(l.SoftPackets),
+		HardPacketLimit:       xfrmLimitOf(l.HardPackets),
+		SoftAddExpiresSeconds: uint64(l.SoftAdd / time.Second),
+		HardAddExpiresSeconds: uint64(l.HardAdd / time.Second),
+		SoftUseExpiresSeconds: uint64(l.SoftUse / time.Second),
+		HardUseExpiresSeconds: uint64(l.HardUse / time.Second),
+	}
+}
+
+// unixSeconds returns t in seconds since the Unix epoch, or zero if t is
+// unset.
+func unixSeconds(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix())
+}
+
+// stateOf converts an xfrm_usersa_info, without the algorithm of the state.
+// See net/xfrm/xfrm_user.c:verify_newsa_info.
+func stateOf(info *linux.XFRMUserSAInfo) (stack.XFRMState, *syserr.Error) {
+	netProto, ok := netProtoOf(info.Family)
+	if !ok {
+		return stack.XFRMState{}, syserr.ErrAddressFamilyNotSupported
+	}
+	if info.ID.Proto != linux.IPPROTO_ESP {
+		return stack.XFRMState{}, syserr.ErrProtocolNotSupported
+	}
+	var mode stack.XFRMMode
+	switch info.Mode {
+	case linux.XFRM_MODE_TRANSPORT:
+		mode = stack.XFRMModeTransport
+	case linux.XFRM_MODE_TUNNEL:
+		mode = stack.XFRMModeTunnel
+	case linux.XFRM_MODE_ROUTEOPTIMIZATION, linux.XFRM_MODE_IN_TRIGGER, linux.XFRM_MODE_BEET:
+		return stack.XFRMState{}, syserr.ErrNotSupported
+	default:
+		return stack.XFRMState{}, syserr.ErrInvalidArgument
+	}
+	sel, err := selectorOf(&info.Sel)
+	if err != nil {
+		return stack.XFRMState{}, err
+	}
+	return stack.XFRMState{
+		ID: stack.XFRMStateID{
+			Destination: addrOf(netProto, info.ID.Daddr),
+			SPI:         ntohl(info.ID.SPI),
+			Protocol:    tcpip.TransportProtocolNumber(info.ID.Proto),
+		},
+		NetProto:     netProto,
+		Source:       addrOf(netProto, info.Saddr),
+		Mode:         mode,
+		ReqID:        info.ReqID,
+		Selector:     sel,
+		ReplayWindow: info.ReplayWindow,
+		Flags:        info.Flags,
+		Lifetime:     lifetimeOf(&info.Lft),
+	}, nil
+}
+
+// saInfoOf converts a state to an xfrm_usersa_info.
+func saInfoOf(info *stack.XFRMStateInfo) linux.XFRMUserSAInfo {
+	mode := uint8(linux.XFRM_MODE_TRANSPORT)
+	if info.Mode == stack.XFRMModeTunnel {
+		mode = linux.XFRM_MODE_TUNNEL
+	}
+	return linux.XFRMUserSAInfo{
+		Sel: xfrmSelectorOf(&info.Selector),
+		ID: linux.XFRMID{
+			Daddr: inet6AddrOf(info.ID.Destination),
+			SPI:   htonl(info.ID.SPI),
+			Proto: uint8(info.ID.Protocol),
+		},
+		Saddr: inet6AddrOf(info.Source),
+		Lft:   xfrmLifetimeOf(&info.Lifetime),
+		Curlft: linux.XFRMLifetimeCurrent{
+			Bytes:   info.Bytes,
+			Packets: info.Packets,
+			AddTime: unixSeconds(info.AddTime),
+			UseTime: unixSeconds(info.UseTime),
+		},
+		Stats: linux.XFRMStats{
+			ReplayWindow:    uint32(info.ReplayWindow),
+			Replay:          info.ReplayDrops,
+			IntegrityFailed: info.IntegrityFailures,
+		},
+		ReqID:        info.ReqID,
+		Family:       familyOf(info.NetProto),
+		Mode:         mode,
+		ReplayWindow: info.ReplayWindow,
+		Flags:        info.Flags,
+	}
+}
+
+// putSA adds a state to m, as Linux does in
+// net/xfrm/xfrm_user.c:copy_to_user_state_extra.
+func putSA(m *nlmsg.Message, info *stack.XFRMStateInfo) {
+	sa := saInfoOf(info)
+	m.Put(&sa)
+	if alg := info.AEAD; alg != nil {
+		aead := linux.XFRMAlgoAEAD{
+			KeyLen: uint32(len(alg.Key) * 8),
+			ICVLen: uint32(alg.ICVLength * 8),
+		}
+		copy(aead.Name[:len(aead.Name)-1], alg.Name)
+		buf := make([]byte, linux.SizeOfXFRMAlgoAEAD+len(alg.Key))
+		aead.MarshalUnsafe(buf)
+		copy(buf[linux.SizeOfXFRMAlgoAEAD:], alg.Key)
+		m.PutAttr(linux.XFRMA_ALG_AEAD, primitive.AsByteSlice(buf))
+	}
+	m.PutAttr(linux.XFRMA_REPLAY_VAL, &linux.XFRMReplayState{
+		OSeq:   info.OutputSequence,
+		Seq:    info.InputSequence,
+		Bitmap: info.ReplayBitmap,
+	})
+}
+
+// aeadOf parses an XFRMA_ALG_AEAD attribute.
+func aeadOf(v nlmsg.BytesView) (*stack.XFRMAlgorithm, *syserr.Error) {
+	b, ok := v.Extract(linux.SizeOfXFRMAlgoAEAD)
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var aead linux.XFRMAlgoAEAD
+	aead.UnmarshalUnsafe(b)
+	if aead.KeyLen%8 != 0 || aead.ICVLen%8 != 0 {
+		return nil, syserr.ErrInvalidArgument
+	}
+	key, ok := v.Extract(int(aead.KeyLen / 8))
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	name := aead.Name[:]
+	for i, c := range name {
+		if c == 0 {
+			name = name[:i]
+			break
+		}
+	}
+	return &stack.XFRMAlgorithm{
+		Name:      string(name),
+		Key:       append([]byte(nil), key...),
+		ICVLength: int(aead.ICVLen / 8),
+	}, nil
+}
+
+// notify sends the messages of ms to the members of the multicast group in
+// the network namespace of s.
+func notify(ctx context.Context, s *netlink.Socket, group uint32, ms *nlmsg.MessageSet) {
+	netlink.Broadcast(ctx, linux.NETLINK_XFRM, s.NetworkNamespace(), group, ms)
+}
+
+// newSA handles XFRM_MSG_NEWSA and XFRM_MSG_UPDSA.
+func newSA(ctx context.Context, s *netlink.Socket, stk *stack.Stack, msg *nlmsg.Message) *syserr.Error {
+	var sa linux.XFRMUserSAInfo
+	attrs, ok := msg.GetData(&sa)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	parsed, ok := attrs.Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	cfg, err := stateOf(&sa)
+	if err != nil {
+		return err
+	}
+	for _, t := range []uint16{
+		linux.XFRMA_ALG_AUTH,
+		linux.XFRMA_ALG_AUTH_TRUNC,
+		linux.XFRMA_ALG_CRYPT,
+		linux.XFRMA_ALG_COMP,
+		linux.XFRMA_ENCAP,
+		linux.XFRMA_REPLAY_ESN_VAL,
+		linux.XFRMA_SEC_CTX,
+		linux.XFRMA_OFFLOAD_DEV,
+	} {
+		if _, ok := parsed[t]; ok {
+			return syserr.ErrNotSupported
+		}
+	}
+	v, ok := parsed[linux.XFRMA_ALG_AEAD]
+	if !ok {
+		// ESP needs an algorithm.
+		return syserr.ErrInvalidArgument
+	}
+	if cfg.AEAD, err = aeadOf(v); err != nil {
+		return err
+	}
+
+	var (
+		info  stack.XFRMStateInfo
+		nserr tcpip.Error
+	)
+	msgType := msg.Header().Type
+	if msgType == linux.XFRM_MSG_UPDSA {
+		info, nserr = stk.UpdateXFRMState(cfg)
+	} else {
+		info, nserr = stk.AddXFRMState(cfg)
+	}
+	if nserr != nil {
+		return translateError(nserr, syserr.ErrNoProcess)
+	}
+
+	ms := nlmsg.NewMessageSet(0, 0)
+	putSA(ms.AddMessage(linux.NetlinkMessageHeader{Type: msgType}), &info)
+	notify(ctx, s, linux.XFRMNLGRP_SA, ms)
+	return nil
+}
+
+// stateIDOf converts an xfrm_usersa_id.
+func stateIDOf(id *linux.XFRMUserSAID) (stack.XFRMStateID, *syserr.Error) {
+	netProto, ok := netProtoOf(id.Family)
+	if !ok {
+		return stack.XFRMStateID{}, syserr.ErrAddressFamilyNotSupported
+	}
+	return stack.XFRMStateID{
+		Destination: addrOf(netProto, id.Daddr),
+		SPI:         ntohl(id.SPI),
+		Protocol:    tcpip.TransportProtocolNumber(id.Proto),
+	}, nil
+}
+
+// delSA handles XFRM_MSG_DELSA.
+func delSA(ctx context.Context, s *netlink.Socket, stk *stack.Stack, msg *nlmsg.Message) *syserr.Error {
+	var said linux.XFRMUserSAID
+	if _, ok := msg.GetData(&said); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	id, err := stateIDOf(&said)
+	if err != nil {
+		return err
+	}
+	info, nserr := stk.RemoveXFRMState(id)
+	if nserr != nil {
+		return translateError(nserr, syserr.ErrNoProcess)
+	}
+
+	ms := nlmsg.NewMessageSet(0, 0)
+	m := ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.XFRM_MSG_DELSA})
+	m.Put(&said)
+	sa := saInfoOf(&info)
+	m.PutAttr(linux.XFRMA_SA, &sa)
+	notify(ctx, s, linux.XFRMNLGRP_SA, ms)
+	return nil
+}
+
+// getSA handles XFRM_MSG_GETSA requests for a state.
+func getSA(stk *stack.Stack, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var said linux.XFRMUserSAID
+	if _, ok := msg.GetData(&said); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	id, err := stateIDOf(&said)
+	if err != nil {
+		return err
+	}
+	info, ok := stk.GetXFRMState(id)
+	if !ok {
+		return syserr.ErrNoProcess
+	}
+	putSA(ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.XFRM_MSG_NEWSA}), &info)
+	return nil
+}
+
+// dumpSA handles XFRM_MSG_GETSA dump requests.
+func dumpSA(stk *stack.Stack, ms *nlmsg.MessageSet) *syserr.Error {
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+	for _, info := range stk.XFRMStates() {
+		putSA(ms.AddMessage(linux.NetlinkMessageHeader{
+			Type:  linux.XFRM_MSG_NEWSA,
+			Flags: linux.NLM_F_MULTI,
+		}), &info)
+	}
+	return nil
+}
+
+// flushSA handles XFRM_MSG_FLUSHSA.
+func flushSA(ctx context.Context, s *netlink.Socket, stk *stack.Stack, msg *nlmsg.Message) *syserr.Error {
+	var flush linux.XFRMUserSAFlush
+	if _, ok := msg.GetData(&flush); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	var proto tcpip.TransportProtocolNumber
+	if flush.Proto != linux.IPSEC_PROTO_ANY {
+		proto = tcpip.TransportProtocolNumber(flush.Proto)
+	}
+	if stk.FlushXFRMStates(proto) == 0 {
+		return nil
+	}
+
+	ms := nlmsg.NewMessageSet(0, 0)
+	ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.XFRM_MSG_FLUSHSA}).Put(&flush)
+	notify(ctx, s, linux.XFRMNLGRP_SA, ms)
+	return nil
+}
+
+// allocSPI handles XFRM_MSG_ALLOCSPI. The allocated state is sent back.
+func allocSPI(stk *stack.Stack, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var spi linux.XFRMUserSPIInfo
+	if _, ok := msg.GetData(&spi); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	cfg, err := stateOf(&spi.Info)
+	if err != nil {
+		return err
+	}
+	// See net/xfrm/xfrm_user.c:verify_spi_info.
+	if spi.Min > spi.Max {
+		return syserr.ErrInvalidArgument
+	}
+	info, nserr := stk.AllocateXFRMSPI(cfg, spi.Min, spi.Max)
+	if nserr != nil {
+		return translateError(nserr, syserr.ErrNoProcess)
+	}
+	putSA(ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.XFRM_MSG_NEWSA}), &info)
+	return nil
+}
+
+// templatesOf parses an XFRMA_TMPL attribute. family is that of the selector
+// of the policy, which templates inherit by default. See
+// net/xfrm/xfrm_user.c:validate_tmpl.
+func templatesOf(v nlmsg.BytesView, family uint16) ([]stack.XFRMTemplate, *syserr.Error) {
+	if len(v)%linux.SizeOfXFRMUserTemplate != 0 || len(v)/linux.SizeOfXFRMUserTemplate > maxTemplates {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var templates []stack.XFRMTemplate
+	for len(v) > 0 {
+		b, _ := v.Extract(linux.SizeOfXFRMUserTemplate)
+		var ut linux.XFRMUserTemplate
+		ut.UnmarshalUnsafe(b)
+		if ut.Family == linux.AF_UNSPEC {
+			ut.Family = family
+		}
+		netProto, ok := netProtoOf(ut.Family)
+		if !ok {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var mode stack.XFRMMode
+		switch ut.Mode {
+		case linux.XFRM_MODE_TRANSPORT:
+			mode = stack.XFRMModeTransport
+		case linux.XFRM_MODE_TUNNEL:
+			mode = stack.XFRMModeTunnel
+		case linux.XFRM_MODE_ROUTEOPTIMIZATION, linux.XFRM_MODE_IN_TRIGGER, linux.XFRM_MODE_BEET:
+			return nil, syserr.ErrNotSupported
+		default:
+			return nil, syserr.ErrInvalidArgument
+		}
+		templates = append(templates, stack.XFRMTemplate{
+			ID: stack.XFRMStateID{
+				Destination: optionalAddrOf(netProto, ut.ID.Daddr),
+				SPI:         ntohl(ut.ID.SPI),
+				Protocol:    tcpip.TransportProtocolNumber(ut.ID.Proto),
+			},
+			NetProto:              netProto,
+			Source:                optionalAddrOf(netProto, ut.Saddr),
+			ReqID:                 ut.ReqID,
+			Mode:                  mode,
+			Share:                 ut.Share,
+			Optional:              ut.Optional != 0,
+			AuthAlgorithms:        ut.Aalgos,
+			EncryptionAlgorithms:  ut.Ealgos,
+			CompressionAlgorithms: ut.Calgos,
+		})
+	}
+	return templates, nil
+}
+
+// xfrmTemplatesOf converts templates to an XFRMA_TMPL attribute.
+func xfrmTemplatesOf(templates []stack.XFRMTemplate) []byte {
+	buf := make([]byte, len(templates)*linux.SizeOfXFRMUserTemplate)
+	for i := range templates {
+		t := &templates[i]
+		mode := uint8(linux.XFRM_MODE_TRANSPORT)
+		if t.Mode == stack.XFRMModeTunnel {
+			mode = linux.XFRM_MODE_TUNNEL
+		}
+		var optional uint8
+		if t.Optional {
+			optional = 1
+		}
+		ut := linux.XFRMUserTemplate{
+			ID: linux.XFRMID{
+				Daddr: inet6AddrOf(t.ID.Destination),
+				SPI:   htonl(t.ID.SPI),
+				Proto: uint8(t.ID.Protocol),
+			},
+			Family:   familyOf(t.NetProto),
+			Saddr:    inet6AddrOf(t.Source),
+			ReqID:    t.ReqID,
+			Mode:     mode,
+			Share:    t.Share,
+			Optional: optional,
+			Aalgos:   t.AuthAlgorithms,
+			Ealgos:   t.EncryptionAlgorithms,
+			Calgos:   t.CompressionAlgorithms,
+		}
+		ut.MarshalUnsafe(buf[i*linux.SizeOfXFRMUserTemplate:])
+	}
+	return buf
+}
+
+// policyInfoOf converts a policy to an xfrm_userpolicy_info.
+func policyInfoOf(info *stack.XFRMPolicyInfo) linux.XFRMUserPolicyInfo {
+	return linux.XFRMUserPolicyInfo{
+		Sel: xfrmSelectorOf(&info.Selector),
+		Lft: xfrmLifetimeOf(&info.Lifetime),
+		Curlft: linux.XFRMLifetimeCurrent{
+			AddTime: unixSeconds(info.AddTime),
+			UseTime: unixSeconds(info.UseTime),
+		},
+		Priority: info.Priority,
+		Index:    info.Index,
+		Dir:      uint8(info.Direction),
+		Action:   uint8(info.Action),
+		Flags:    info.Flags,
+		Share:    info.Share,
+	}
+}
+
+// putPolicy adds a policy to m, as Linux does in
+// net/xfrm/xfrm_user.c:dump_one_policy.
+func putPolicy(m *nlmsg.Message, info *stack.XFRMPolicyInfo) {
+	pi := policyInfoOf(info)
+	m.Put(&pi)
+	if len(info.Templates) != 0 {
+		m.PutAttr(linux.XFRMA_TMPL, primitive.AsByteSlice(xfrmTemplatesOf(info.Templates)))
+	}
+}
+
+// newPolicy handles XFRM_MSG_NEWPOLICY and XFRM_MSG_UPDPOLICY.
+func newPolicy(ctx context.Context, s *netlink.Socket, stk *stack.Stack, msg *nlmsg.Message) *syserr.Error {
+	var pi linux.XFRMUserPolicyInfo
+	attrs, ok := msg.GetData(&pi)
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	parsed, ok := attrs.Parse()
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	// See net/xfrm/xfrm_user.c:verify_newpolicy_info.
+	if pi.Share > linux.XFRM_SHARE_UNIQUE || pi.Action > linux.XFRM_POLICY_BLOCK || pi.Dir > linux.XFRM_POLICY_FWD {
+		return syserr.ErrInvalidArgument
+	}
+	if pi.Index != 0 && pi.Index%8 != uint32(pi.Dir) {
+		return syserr.ErrInvalidArgument
+	}
+	sel, err := selectorOf(&pi.Sel)
+	if err != nil {
+		return err
+	}
+	for _, t := range []uint16{linux.XFRMA_SEC_CTX, linux.XFRMA_MARK, linux.XFRMA_IF_ID} {
+		if _, ok := parsed[t]; ok {
+			return syserr.ErrNotSupported
+		}
+	}
+	if v, ok := parsed[linux.XFRMA_POLICY_TYPE]; ok && len(v) > 0 && v[0] != linux.XFRM_POLICY_TYPE_MAIN {
+		return syserr.ErrNotSupported
+	}
+	cfg := stack.XFRMPolicy{
+		Selector:  sel,
+		Direction: stack.XFRMDirection(pi.Dir),
+		Priority:  pi.Priority,
+		Index:     pi.Index,
+		Action:    stack.XFRMPolicyAction(pi.Action),
+		Flags:     pi.Flags,
+		Share:     pi.Share,
+		Lifetime:  lifetimeOf(&pi.Lft),
+	}
+	if v, ok := parsed[linux.XFRMA_TMPL]; ok {
+		if cfg.Templates, err = templatesOf(v, pi.Sel.Family); err != nil {
+			return err
+		}
+	}
+
+	msgType := msg.Header().Type
+	info, nserr := stk.AddXFRMPolicy(cfg, msgType == linux.XFRM_MSG_UPDPOLICY)
+	if nserr != nil {
+		return translateError(nserr, syserr.ErrNoFileOrDir)
+	}
+
+	ms := nlmsg.NewMessageSet(0, 0)
+	putPolicy(ms.AddMessage(linux.NetlinkMessageHeader{Type: msgType}), &info)
+	notify(ctx, s, linux.XFRMNLGRP_POLICY, ms)
+	return nil
+}
+
+// policyIDOf converts an xfrm_userpolicy_id.
+func policyIDOf(id *linux.XFRMUserPolicyID) (stack.XFRMDirection, stack.XFRMSelector, *syserr.Error) {
+	if id.Dir > linux.XFRM_POLICY_FWD {
+		return 0, stack.XFRMSelector{}, syserr.ErrInvalidArgument
+	}
+	var sel stack.XFRMSelector
+	if id.Index == 0 {
+		var err *syserr.Error
+		if sel, err = selectorOf(&id.Sel); err != nil {
+			return 0, stack.XFRMSelector{}, err
+		}
+	}
+	return stack.XFRMDirection(id.Dir), sel, nil
+}
+
+// delPolicy handles XFRM_MSG_DELPOLICY.
+func delPolicy(ctx context.Context, s *netlink.Socket, stk *stack.Stack, msg *nlmsg.Message) *syserr.Error {
+	var pid linux.XFRMUserPolicyID
+	if _, ok := msg.GetData(&pid); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	dir, sel, err := policyIDOf(&pid)
+	if err != nil {
+		return err
+	}
+	info, nserr := stk.RemoveXFRMPolicy(dir, sel, pid.Index)
+	if nserr != nil {
+		return translateError(nserr, syserr.ErrNoFileOrDir)
+	}
+
+	ms := nlmsg.NewMessageSet(0, 0)
+	m := ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.XFRM_MSG_DELPOLICY})
+	m.Put(&pid)
+	pi := policyInfoOf(&info)
+	m.PutAttr(linux.XFRMA_POLICY, &pi)
+	notify(ctx, s, linux.XFRMNLGRP_POLICY, ms)
+	return nil
+}
+
+// getPolicy handles XFRM_MSG_GETPOLICY requests for a policy.
+func getPolicy(stk *stack.Stack, msg *nlmsg.Message, ms *nlmsg.MessageSet) *syserr.Error {
+	var pid linux.XFRMUserPolicyID
+	if _, ok := msg.GetData(&pid); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	dir, sel, err := policyIDOf(&pid)
+	if err != nil {
+		return err
+	}
+	info, ok := stk.GetXFRMPolicy(dir, sel, pid.Index)
+	if !ok {
+		return syserr.ErrNoFileOrDir
+	}
+	putPolicy(ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.XFRM_MSG_NEWPOLICY}), &info)
+	return nil
+}
+
+// dumpPolicy handles XFRM_MSG_GETPOLICY dump requests.
+func dumpPolicy(stk *stack.Stack, ms *nlmsg.MessageSet) *syserr.Error {
+	// We always send back an NLMSG_DONE.
+	ms.Multi = true
+	for _, info := range stk.XFRMPolicies() {
+		putPolicy(ms.AddMessage(linux.NetlinkMessageHeader{
+			Type:  linux.XFRM_MSG_NEWPOLICY,
+			Flags: linux.NLM_F_MULTI,
+		}), &info)
+	}
+	return nil
+}
+
+// flushPolicy handles XFRM_MSG_FLUSHPOLICY.
+func flushPolicy(ctx context.Context, s *netlink.Socket, stk *stack.Stack) *syserr.Error {
+	if stk.FlushXFRMPolicies() == 0 {
+		return nil
+	}
+	ms := nlmsg.NewMessageSet(0, 0)
+	ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.XFRM_MSG_FLUSHPOLICY})
+	notify(ctx, s, linux.XFRMNLGRP_POLICY, ms)
+	return nil
+}
+
+// dispatcher reports the IPsec events of a stack to the members of the
+// multicast groups of its network namespace.
+//
+// +stateify savable
+type dispatcher struct {
+	k     *kernel.Kernel
+	netns *inet.Namespace
+}
+
+var _ stack.XFRMDispatcher = (*dispatcher)(nil)
+
+// OnXFRMStateExpired implements stack.XFRMDispatcher.OnXFRMStateExpired.
+func (d *dispatcher) OnXFRMStateExpired(info stack.XFRMStateInfo, hard bool) {
+	expire := linux.XFRMUserExpire{
+		State: saInfoOf(&info),
+	}
+	if hard {
+		expire.Hard = 1
+	}
+	ms := nlmsg.NewMessageSet(0, 0)
+	ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.XFRM_MSG_EXPIRE}).Put(&expire)
+	netlink.Broadcast(d.k.SupervisorContext(), linux.NETLINK_XFRM, d.netns, linux.XFRMNLGRP_EXPIRE, ms)
+}
+
+// init registers the NETLINK_XFRM provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_XFRM, NewProtocol)
+}
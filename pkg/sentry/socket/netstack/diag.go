@@ -0,0 +1,142 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+)
+
+// SockDiag describes a netstack socket, as reported by NETLINK_SOCK_DIAG.
+type SockDiag struct {
+	// Family, Type and Protocol are the arguments the socket was created
+	// with.
+	Family   int
+	Type     linux.SockType
+	Protocol int
+
+	// State is the TCP_* state of the socket.
+	State uint32
+
+	// Local and Remote are the addresses of the socket. Their Port is in
+	// host byte order.
+	Local  tcpip.FullAddress
+	Remote tcpip.FullAddress
+
+	// BoundDevice is the index of the interface the socket is bound to
+	// with SO_BINDTODEVICE, or zero.
+	BoundDevice int32
+
+	// RecvQueue and SendQueue are the number of bytes in the receive and
+	// send queues.
+	RecvQueue uint32
+	SendQueue uint32
+
+	// RecvBuf and SendBuf are SO_RCVBUF and SO_SNDBUF.
+	RecvBuf uint32
+	SendBuf uint32
+
+	// TOS and TClass are IP_TOS and IPV6_TCLASS.
+	TOS    uint8
+	TClass uint8
+
+	// V6Only is IPV6_V6ONLY.
+	V6Only bool
+
+	// TCPInfo is the TCP_INFO of TCP sockets, and nil otherwise.
+	TCPInfo *linux.TCPInfo
+
+	// Congestion is the TCP_CONGESTION of TCP sockets.
+	Congestion string
+
+	// Namespace is the network namespace of the socket.
+	Namespace *inet.Namespace
+}
+
+// Diag returns the description of fd, and whether fd is a netstack socket.
+func Diag(fd *vfs.FileDescription) (SockDiag, bool) {
+	s, ok := fd.Impl().(*sock)
+	if !ok {
+		return SockDiag{}, false
+	}
+	d := SockDiag{
+		Family:      s.family,
+		Type:        s.skType,
+		Protocol:    s.protocol,
+		State:       s.State(),
+		BoundDevice: s.Endpoint.SocketOptions().GetBindToDevice(),
+		RecvBuf:     uint32(s.Endpoint.SocketOptions().GetReceiveBufferSize()),
+		SendBuf:     uint32(s.Endpoint.SocketOptions().GetSendBufferSize()),
+		V6Only:      s.Endpoint.SocketOptions().GetV6Only(),
+		Namespace:   s.namespace,
+	}
+	if d.State == 0 {
+		// Raw and ping sockets have no states in netstack. Like on
+		// Linux, they are closed until connected.
+		d.State = linux.TCP_CLOSE
+		if _, err := s.Endpoint.GetRemoteAddress(); err == nil {
+			d.State = linux.TCP_ESTABLISHED
+		}
+	}
+	// Addresses and queues are left empty if the endpoint doesn't have
+	// them, e.g. because it is unbound or listening.
+	if addr, err := s.Endpoint.GetLocalAddress(); err == nil {
+		d.Local = addr
+	}
+	if addr, err := s.Endpoint.GetRemoteAddress(); err == nil {
+		d.Remote = addr
+	}
+	if v, err := s.Endpoint.GetSockOptInt(tcpip.ReceiveQueueSizeOption); err == nil {
+		d.RecvQueue = uint32(v)
+	}
+	if v, err := s.Endpoint.GetSockOptInt(tcpip.SendQueueSizeOption); err == nil {
+		d.SendQueue = uint32(v)
+	}
+	if v, err := s.Endpoint.GetSockOptInt(tcpip.IPv4TOSOption); err == nil {
+		d.TOS = uint8(v)
+	}
+	if v, err := s.Endpoint.GetSockOptInt(tcpip.IPv6TrafficClassOption); err == nil {
+		d.TClass = uint8(v)
+	}
+	if socket.IsTCP(s) {
+		if info, err := tcpInfo(s.Endpoint); err == nil {
+			d.TCPInfo = &info
+		}
+		var cc tcpip.CongestionControlOption
+		if err := s.Endpoint.GetSockOpt(&cc); err == nil {
+			d.Congestion = string(cc)
+		}
+	}
+	return d, true
+}
+
+// Destroy aborts the connection of the netstack socket fd, as requested by
+// SOCK_DESTROY. The socket itself remains open, and reports an error to its
+// users.
+func Destroy(fd *vfs.FileDescription) {
+	s, ok := fd.Impl().(*sock)
+	if !ok {
+		return
+	}
+	if ep, ok := s.Endpoint.(*tcp.Endpoint); ok {
+		ep.Destroy()
+		return
+	}
+	s.Endpoint.Abort()
+}
@@ -0,0 +1,314 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+var (
+	inetMulticastSourceFilterSize = (*linux.InetMulticastSourceFilter)(nil).SizeBytes()
+	groupFilterSize               = (*linux.GroupFilter)(nil).SizeBytes()
+	sockAddrStorageSize           = (*linux.SockAddrStorage)(nil).SizeBytes()
+)
+
+// multicastFilterMode converts a MCAST_INCLUDE or MCAST_EXCLUDE filter mode to
+// the value of tcpip.MulticastSourceFilter.Exclude.
+func multicastFilterMode(mode uint32) (bool, *syserr.Error) {
+	switch mode {
+	case linux.MCAST_INCLUDE:
+		return false, nil
+	case linux.MCAST_EXCLUDE:
+		return true, nil
+	default:
+		return false, syserr.ErrInvalidArgument
+	}
+}
+
+// linuxMulticastFilterMode is the inverse of multicastFilterMode.
+func linuxMulticastFilterMode(exclude bool) uint32 {
+	if exclude {
+		return linux.MCAST_EXCLUDE
+	}
+	return linux.MCAST_INCLUDE
+}
+
+// sockAddrStorageToAddress returns the IP address held by ss, which must be an
+// address of the given family.
+func sockAddrStorageToAddress(ss *linux.SockAddrStorage, family int) (tcpip.Address, *syserr.Error) {
+	if int(ss.Family) != family {
+		return tcpip.Address{}, syserr.ErrAddressNotAvailable
+	}
+	// Data starts after the family field of struct sockaddr_in and struct
+	// sockaddr_in6.
+	switch family {
+	case linux.AF_INET:
+		return tcpip.AddrFrom4Slice(ss.Data[2:6]), nil
+	case linux.AF_INET6:
+		return tcpip.AddrFrom16Slice(ss.Data[6:22]), nil
+	default:
+		return tcpip.Address{}, syserr.ErrAddressNotAvailable
+	}
+}
+
+// addressToSockAddrStorage is the inverse of sockAddrStorageToAddress.
+func addressToSockAddrStorage(addr tcpip.Address, family int) linux.SockAddrStorage {
+	ss := linux.SockAddrStorage{Family: uint16(family)}
+	switch family {
+	case linux.AF_INET:
+		copy(ss.Data[2:6], addr.AsSlice())
+	case linux.AF_INET6:
+		copy(ss.Data[6:22], addr.AsSlice())
+	}
+	return ss
+}
+
+// setSourceMembership applies a source-specific membership change to ep.
+//
+// name is one of IP_ADD_SOURCE_MEMBERSHIP, IP_DROP_SOURCE_MEMBERSHIP,
+// IP_BLOCK_SOURCE, IP_UNBLOCK_SOURCE or their protocol-independent MCAST_*
+// equivalents.
+func setSourceMembership(ep commonEndpoint, name int, opt tcpip.SourceMembershipOption) *syserr.Error {
+	var o tcpip.SettableSocketOption
+	switch name {
+	case linux.IP_ADD_SOURCE_MEMBERSHIP, linux.MCAST_JOIN_SOURCE_GROUP:
+		v := tcpip.AddSourceMembershipOption(opt)
+		o = &v
+	case linux.IP_DROP_SOURCE_MEMBERSHIP, linux.MCAST_LEAVE_SOURCE_GROUP:
+		v := tcpip.DropSourceMembershipOption(opt)
+		o = &v
+	case linux.IP_BLOCK_SOURCE, linux.MCAST_BLOCK_SOURCE:
+		v := tcpip.BlockSourceOption(opt)
+		o = &v
+	case linux.IP_UNBLOCK_SOURCE, linux.MCAST_UNBLOCK_SOURCE:
+		v := tcpip.UnblockSourceOption(opt)
+		o = &v
+	default:
+		return syserr.ErrUnknownProtocolOption
+	}
+	return syserr.TranslateNetstackError(ep.SetSockOpt(o))
+}
+
+// setSockOptIPSourceMembership implements IP_ADD_SOURCE_MEMBERSHIP,
+// IP_DROP_SOURCE_MEMBERSHIP, IP_BLOCK_SOURCE and IP_UNBLOCK_SOURCE.
+func setSockOptIPSourceMembership(ep commonEndpoint, name int, optVal []byte) *syserr.Error {
+	var req linux.InetMulticastSourceRequest
+	if len(optVal) < req.SizeBytes() {
+		return syserr.ErrInvalidArgument
+	}
+	req.UnmarshalUnsafe(optVal)
+
+	return setSourceMembership(ep, name, tcpip.SourceMembershipOption{
+		InterfaceAddr: tcpip.AddrFrom4(req.InterfaceAddr),
+		MulticastAddr: tcpip.AddrFrom4(req.MulticastAddr),
+		SourceAddr:    tcpip.AddrFrom4(req.SourceAddr),
+	})
+}
+
+// setSockOptIPMulticastFilter implements setsockopt(IP_MSFILTER).
+func setSockOptIPMulticastFilter(ep commonEndpoint, optVal []byte) *syserr.Error {
+	if len(optVal) < inetMulticastSourceFilterSize {
+		return syserr.ErrInvalidArgument
+	}
+	var msf linux.InetMulticastSourceFilter
+	msf.UnmarshalUnsafe(optVal)
+	sources := optVal[inetMulticastSourceFilterSize:]
+	if uint64(len(sources)) < uint64(msf.NumSources)*uint64(len(linux.InetAddr{})) {
+		return syserr.ErrInvalidArgument
+	}
+
+	exclude, err := multicastFilterMode(msf.FilterMode)
+	if err != nil {
+		return err
+	}
+	opt := tcpip.MulticastSourceFilterOption{
+		InterfaceAddr: tcpip.AddrFrom4(msf.InterfaceAddr),
+		MulticastAddr: tcpip.AddrFrom4(msf.MulticastAddr),
+		Filter:        tcpip.MulticastSourceFilter{Exclude: exclude},
+	}
+	for i := 0; i < int(msf.NumSources); i++ {
+		opt.Filter.Sources = append(opt.Filter.Sources, tcpip.AddrFrom4Slice(sources[i*len(linux.InetAddr{}):][:len(linux.InetAddr{})]))
+	}
+	return syserr.TranslateNetstackError(ep.SetSockOpt(&opt))
+}
+
+// getSockOptIPMulticastFilter implements getsockopt(IP_MSFILTER).
+//
+// As in Linux, the caller passes the group to read in the struct ip_msfilter
+// it provides, along with the number of sources it has room for.
+func getSockOptIPMulticastFilter(t *kernel.Task, ep commonEndpoint, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if outLen < inetMulticastSourceFilterSize {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var msf linux.InetMulticastSourceFilter
+	if _, err := msf.CopyIn(t, outPtr); err != nil {
+		return nil, syserr.FromError(err)
+	}
+
+	opt := tcpip.MulticastSourceFilterOption{
+		InterfaceAddr: tcpip.AddrFrom4(msf.InterfaceAddr),
+		MulticastAddr: tcpip.AddrFrom4(msf.MulticastAddr),
+	}
+	if err := ep.GetSockOpt(&opt); err != nil {
+		return nil, syserr.TranslateNetstackError(err)
+	}
+
+	n := min(len(opt.Filter.Sources), int(msf.NumSources), (outLen-inetMulticastSourceFilterSize)/len(linux.InetAddr{}))
+	msf.FilterMode = linuxMulticastFilterMode(opt.Filter.Exclude)
+	msf.NumSources = uint32(len(opt.Filter.Sources))
+
+	buf := make([]byte, inetMulticastSourceFilterSize, inetMulticastSourceFilterSize+n*len(linux.InetAddr{}))
+	msf.MarshalUnsafe(buf)
+	for _, source := range opt.Filter.Sources[:n] {
+		buf = append(buf, source.AsSlice()...)
+	}
+	bufP := primitive.ByteSlice(buf)
+	return &bufP, nil
+}
+
+// setSockOptMulticastGroup implements the protocol-independent
+// MCAST_JOIN_GROUP, MCAST_LEAVE_GROUP, MCAST_JOIN_SOURCE_GROUP,
+// MCAST_LEAVE_SOURCE_GROUP, MCAST_BLOCK_SOURCE and MCAST_UNBLOCK_SOURCE options
+// of RFC 3678 for a socket of the given family.
+func setSockOptMulticastGroup(ep commonEndpoint, family, name int, optVal []byte) *syserr.Error {
+	switch name {
+	case linux.MCAST_JOIN_GROUP, linux.MCAST_LEAVE_GROUP:
+		var req linux.GroupRequest
+		if len(optVal) < req.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		req.UnmarshalUnsafe(optVal)
+
+		group, err := sockAddrStorageToAddress(&req.Group, family)
+		if err != nil {
+			return err
+		}
+		if name == linux.MCAST_JOIN_GROUP {
+			return syserr.TranslateNetstackError(ep.SetSockOpt(&tcpip.AddMembershipOption{
+				NIC:           tcpip.NICID(req.Interface),
+				MulticastAddr: group,
+			}))
+		}
+		return syserr.TranslateNetstackError(ep.SetSockOpt(&tcpip.RemoveMembershipOption{
+			NIC:           tcpip.NICID(req.Interface),
+			MulticastAddr: group,
+		}))
+
+	default:
+		var req linux.GroupSourceRequest
+		if len(optVal) < req.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		req.UnmarshalUnsafe(optVal)
+
+		group, err := sockAddrStorageToAddress(&req.Group, family)
+		if err != nil {
+			return err
+		}
+		source, err := sockAddrStorageToAddress(&req.Source, family)
+		if err != nil {
+			return err
+		}
+		return setSourceMembership(ep, name, tcpip.SourceMembershipOption{
+			NIC:           tcpip.NICID(req.Interface),
+			MulticastAddr: group,
+			SourceAddr:    source,
+		})
+	}
+}
+
+// setSockOptMulticastGroupFilter implements setsockopt(MCAST_MSFILTER) for a
+// socket of the given family.
+func setSockOptMulticastGroupFilter(ep commonEndpoint, family int, optVal []byte) *syserr.Error {
+	if len(optVal) < groupFilterSize {
+		return syserr.ErrInvalidArgument
+	}
+	var gf linux.GroupFilter
+	gf.UnmarshalUnsafe(optVal)
+	sources := optVal[groupFilterSize:]
+	if uint64(len(sources)) < uint64(gf.NumSources)*uint64(sockAddrStorageSize) {
+		return syserr.ErrInvalidArgument
+	}
+
+	exclude, err := multicastFilterMode(gf.FilterMode)
+	if err != nil {
+		return err
+	}
+	group, err := sockAddrStorageToAddress(&gf.Group, family)
+	if err != nil {
+		return err
+	}
+	opt := tcpip.MulticastSourceFilterOption{
+		NIC:           tcpip.NICID(gf.Interface),
+		MulticastAddr: group,
+		Filter:        tcpip.MulticastSourceFilter{Exclude: exclude},
+	}
+	for i := 0; i < int(gf.NumSources); i++ {
+		var ss linux.SockAddrStorage
+		ss.UnmarshalUnsafe(sources[i*sockAddrStorageSize:])
+		source, err := sockAddrStorageToAddress(&ss, family)
+		if err != nil {
+			return err
+		}
+		opt.Filter.Sources = append(opt.Filter.Sources, source)
+	}
+	return syserr.TranslateNetstackError(ep.SetSockOpt(&opt))
+}
+
+// getSockOptMulticastGroupFilter implements getsockopt(MCAST_MSFILTER) for a
+// socket of the given family.
+//
+// As in Linux, the caller passes the group to read in the struct group_filter
+// it provides, along with the number of sources it has room for.
+func getSockOptMulticastGroupFilter(t *kernel.Task, ep commonEndpoint, family int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if outLen < groupFilterSize {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var gf linux.GroupFilter
+	if _, err := gf.CopyIn(t, outPtr); err != nil {
+		return nil, syserr.FromError(err)
+	}
+
+	group, err := sockAddrStorageToAddress(&gf.Group, family)
+	if err != nil {
+		return nil, err
+	}
+	opt := tcpip.MulticastSourceFilterOption{
+		NIC:           tcpip.NICID(gf.Interface),
+		MulticastAddr: group,
+	}
+	if err := ep.GetSockOpt(&opt); err != nil {
+		return nil, syserr.TranslateNetstackError(err)
+	}
+
+	n := min(len(opt.Filter.Sources), int(gf.NumSources), (outLen-groupFilterSize)/sockAddrStorageSize)
+	gf.FilterMode = linuxMulticastFilterMode(opt.Filter.Exclude)
+	gf.NumSources = uint32(len(opt.Filter.Sources))
+
+	buf := make([]byte, groupFilterSize+n*sockAddrStorageSize)
+	gf.MarshalUnsafe(buf)
+	for i, source := range opt.Filter.Sources[:n] {
+		ss := addressToSockAddrStorage(source, family)
+		ss.MarshalUnsafe(buf[groupFilterSize+i*sockAddrStorageSize:])
+	}
+	bufP := primitive.ByteSlice(buf)
+	return &bufP, nil
+}
@@ -297,6 +297,18 @@ var Metrics = tcpip.Stats{
 		SegmentsAckedWithDSACK:             mustCreateMetric("/netstack/tcp/segments_acked_with_dsack", "Number of segments for which DSACK was received."),
 		SpuriousRecovery:                   mustCreateMetric("/netstack/tcp/spurious_recovery", "Number of times the connection entered loss recovery spuriously."),
 		SpuriousRTORecovery:                mustCreateMetric("/netstack/tcp/spurious_rto_recovery", "Number of times the connection entered RTO spuriously."),
+		ECNNegotiated:                      mustCreateMetric("/netstack/tcp/ecn_negotiated", "Number of connections that negotiated ECN."),
+		CESegmentsReceived:                 mustCreateMetric("/netstack/tcp/ce_segments_received", "Number of data segments received with the CE codepoint set."),
+		ECNReductions:                      mustCreateMetric("/netstack/tcp/ecn_reductions", "Number of congestion window reductions caused by ECN-Echo."),
+		FastOpenActive:                     mustCreateMetric("/netstack/tcp/fast_open_active", "Number of outgoing connections whose data sent in the SYN was acknowledged."),
+		FastOpenActiveFail:                 mustCreateMetric("/netstack/tcp/fast_open_active_fail", "Number of outgoing connections whose data sent in the SYN was not acknowledged."),
+		FastOpenPassive:                    mustCreateMetric("/netstack/tcp/fast_open_passive", "Number of incoming connections accepted with data in the SYN."),
+		FastOpenPassiveFail:                mustCreateMetric("/netstack/tcp/fast_open_passive_fail", "Number of incoming SYNs with an invalid Fast Open cookie."),
+		FastOpenListenOverflow:             mustCreateMetric("/netstack/tcp/fast_open_listen_overflow", "Number of incoming Fast Open SYNs handled as regular SYNs because the Fast Open queue was full."),
+		FastOpenCookieReqd:                 mustCreateMetric("/netstack/tcp/fast_open_cookie_reqd", "Number of incoming SYNs requesting a Fast Open cookie."),
+		MD5NotFound:                        mustCreateMetric("/netstack/tcp/md5_not_found", "Number of segments dropped because they lacked the MD5 signature expected for the peer."),
+		MD5Unexpected:                      mustCreateMetric("/netstack/tcp/md5_unexpected", "Number of segments dropped because they carried an MD5 signature not expected for the peer."),
+		MD5Failure:                         mustCreateMetric("/netstack/tcp/md5_failure", "Number of segments dropped because their MD5 signature was invalid."),
 		ForwardMaxInFlightDrop:             mustCreateMetric("/netstack/tcp/forward_max_in_flight_drop", "Number of connection requests dropped due to exceeding in-flight limit."),
 	},
 	UDP: tcpip.UDPStats{
@@ -393,9 +405,26 @@ type sock struct {
 	// valid when timestampValid is true. It is protected by readMu.
 	timestamp time.Time `state:".(int64)"`
 
+	// sockOptTimestamping holds the SOF_TIMESTAMPING_* flags set with
+	// SO_TIMESTAMPING. The transmit flags are also passed to the endpoint's
+	// SocketOptions, where they are acted upon. It is protected by readMu.
+	sockOptTimestamping uint32
+
 	// TODO(b/153685824): Move this to SocketOptions.
 	// sockOptInq corresponds to TCP_INQ.
 	sockOptInq bool
+
+	// txTimeMu protects access to the below fields.
+	txTimeMu sync.Mutex `state:"nosave"`
+
+	// txTimeEnabled indicates whether SO_TXTIME is set, in which case
+	// txTimeClockID and txTimeFlags hold its struct sock_txtime.
+	// +checklocks:txTimeMu
+	txTimeEnabled bool
+	// +checklocks:txTimeMu
+	txTimeClockID int32
+	// +checklocks:txTimeMu
+	txTimeFlags uint32
 }
 
 var _ = socket.Socket(&sock{})
@@ -598,6 +627,33 @@ func (s *sock) GetSockOpt(t *kernel.Task, level, name int, outPtr hostarch.Addr,
 		}
 		return &val, nil
 	}
+	if level == linux.SOL_SOCKET && name == linux.SO_TIMESTAMPING {
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		s.readMu.Lock()
+		defer s.readMu.Unlock()
+		val := primitive.Int32(s.sockOptTimestamping)
+		return &val, nil
+	}
+	if level == linux.SOL_SOCKET && name == linux.SO_TXTIME {
+		if outLen < linux.SizeOfSockTxtime {
+			return nil, syserr.ErrInvalidArgument
+		}
+		s.txTimeMu.Lock()
+		defer s.txTimeMu.Unlock()
+		var val linux.SockTxtime
+		if s.txTimeEnabled {
+			val = linux.SockTxtime{
+				ClockID: s.txTimeClockID,
+				Flags:   s.txTimeFlags,
+			}
+		}
+		return &val, nil
+	}
+	if level == linux.SOL_SCTP && s.protocol == linux.IPPROTO_SCTP {
+		return s.getSockOptSCTP(t, name, outPtr, outLen)
+	}
 
 	return GetSockOpt(t, s, s.Endpoint, s.family, s.skType, level, name, outPtr, outLen)
 }
@@ -628,10 +684,118 @@ func (s *sock) SetSockOpt(t *kernel.Task, level int, name int, optVal []byte) *s
 		s.sockOptInq = hostarch.ByteOrder.Uint32(optVal) != 0
 		return nil
 	}
+	if level == linux.SOL_SOCKET && name == linux.SO_TIMESTAMPING {
+		return s.setSockOptTimestamping(optVal)
+	}
+	if level == linux.SOL_SOCKET && name == linux.SO_TXTIME {
+		return s.setSockOptTXTime(t, optVal)
+	}
+	if level == linux.SOL_SCTP && s.protocol == linux.IPPROTO_SCTP {
+		return s.setSockOptSCTP(t, name, optVal)
+	}
 
 	return SetSockOpt(t, s, s.Endpoint, level, name, optVal)
 }
 
+// setSockOptTimestamping implements SO_TIMESTAMPING. This is analogous to
+// net/core/sock.c:sock_set_timestamping().
+func (s *sock) setSockOptTimestamping(optVal []byte) *syserr.Error {
+	if len(optVal) < sizeOfInt32 {
+		return syserr.ErrInvalidArgument
+	}
+	flags := hostarch.ByteOrder.Uint32(optVal)
+	if flags&^linux.SOF_TIMESTAMPING_MASK != 0 {
+		return syserr.ErrInvalidArgument
+	}
+	// Options that aren't supported by netstack, such as hardware
+	// timestamps, are accepted and stored but otherwise ignored. Linux does
+	// the same for devices that lack hardware timestamping.
+	if flags&linux.SOF_TIMESTAMPING_OPT_ID_TCP != 0 && flags&linux.SOF_TIMESTAMPING_OPT_ID == 0 {
+		return syserr.ErrInvalidArgument
+	}
+	if flags&linux.SOF_TIMESTAMPING_BIND_PHC != 0 {
+		// There are no PTP hardware clocks to bind to.
+		return syserr.ErrNoDevice
+	}
+
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+	s.sockOptTimestamping = flags
+	s.Endpoint.SocketOptions().SetTimestamping(timestampingFlagsToNetstack(flags))
+	return nil
+}
+
+// timestampingFlagsToNetstack converts the SOF_TIMESTAMPING_* flags that
+// affect transmitted packets to their netstack equivalents.
+func timestampingFlagsToNetstack(flags uint32) tcpip.TimestampingFlags {
+	var tf tcpip.TimestampingFlags
+	if flags&linux.SOF_TIMESTAMPING_TX_SCHED != 0 {
+		tf |= tcpip.TimestampingTXSched
+	}
+	if flags&linux.SOF_TIMESTAMPING_TX_SOFTWARE != 0 {
+		tf |= tcpip.TimestampingTXSoftware
+	}
+	if flags&linux.SOF_TIMESTAMPING_OPT_ID != 0 {
+		tf |= tcpip.TimestampingOptID
+	}
+	if flags&linux.SOF_TIMESTAMPING_OPT_TSONLY != 0 {
+		tf |= tcpip.TimestampingOptTSOnly
+	}
+	return tf
+}
+
+// setSockOptTXTime implements SO_TXTIME. This is analogous to the SO_TXTIME
+// case of net/core/sock.c:sk_setsockopt().
+func (s *sock) setSockOptTXTime(t *kernel.Task, optVal []byte) *syserr.Error {
+	if len(optVal) < linux.SizeOfSockTxtime {
+		return syserr.ErrInvalidArgument
+	}
+	var txTime linux.SockTxtime
+	txTime.UnmarshalUnsafe(optVal)
+
+	// Only the monotonic clock may be used without privileges, as it is the
+	// clock fq paces packets with. As in Linux, other clocks aren't
+	// validated.
+	if txTime.ClockID != linux.CLOCK_MONOTONIC {
+		if creds := auth.CredentialsFromContext(t); !creds.HasCapability(linux.CAP_NET_ADMIN) {
+			return syserr.ErrNotPermitted
+		}
+	}
+	if txTime.Flags&^linux.SOF_TXTIME_FLAGS_MASK != 0 {
+		return syserr.ErrInvalidArgument
+	}
+
+	s.txTimeMu.Lock()
+	defer s.txTimeMu.Unlock()
+	s.txTimeEnabled = true
+	s.txTimeClockID = txTime.ClockID
+	s.txTimeFlags = txTime.Flags
+	return nil
+}
+
+// txTimeToNetstack converts a SCM_TXTIME departure time to the stack's
+// monotonic clock.
+func (s *sock) txTimeToNetstack(t *kernel.Task, txTime uint64) (tcpip.MonotonicTime, *syserr.Error) {
+	s.txTimeMu.Lock()
+	enabled, clockID := s.txTimeEnabled, s.txTimeClockID
+	s.txTimeMu.Unlock()
+	if !enabled {
+		return tcpip.MonotonicTime{}, syserr.ErrInvalidArgument
+	}
+
+	ns := int64(txTime)
+	if clockID == linux.CLOCK_REALTIME {
+		// Translate the deadline to the monotonic clock by its distance
+		// from now.
+		k := t.Kernel()
+		ns += k.MonotonicClock().Now().Nanoseconds() - k.RealtimeClock().Now().Nanoseconds()
+	}
+	// The stack clock's monotonic time is CLOCK_MONOTONIC. Other clocks,
+	// including CLOCK_BOOTTIME which is the same clock in gVisor, are taken
+	// to be monotonic as well.
+	return tcpip.MonotonicTime{}.Add(time.Duration(ns)), nil
+}
+
 var sockAddrInetSize = (*linux.SockAddrInet)(nil).SizeBytes()
 var sockAddrInet6Size = (*linux.SockAddrInet6)(nil).SizeBytes()
 var sockAddrLinkSize = (*linux.SockAddrLink)(nil).SizeBytes()
@@ -663,7 +827,13 @@ func (s *sock) isPacketBased() bool {
 
 // Readiness returns a mask of ready events for socket s.
 func (s *sock) Readiness(mask waiter.EventMask) waiter.EventMask {
-	return s.Endpoint.Readiness(mask)
+	r := s.Endpoint.Readiness(mask)
+	// Transmit timestamps are not errors to the endpoint, but they are
+	// reported as such while they wait in the error queue.
+	if mask&waiter.EventErr != 0 && s.Endpoint.SocketOptions().PeekErr() != nil {
+		r |= waiter.EventErr
+	}
+	return r
 }
 
 // checkFamily returns true iff the specified address family may be used with
@@ -905,8 +1075,10 @@ func GetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, family int,
 	case linux.SOL_ICMPV6:
 		return getSockOptICMPv6(t, s, ep, name, outLen)
 
-	case linux.SOL_UDP,
-		linux.SOL_RAW,
+	case linux.SOL_UDP:
+		return getSockOptUDP(t, s, ep, name, outLen)
+
+	case linux.SOL_RAW,
 		linux.SOL_PACKET:
 		// Not supported.
 	}
@@ -1107,6 +1279,22 @@ func getSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, family
 
 		v := primitive.Int32(ep.SocketOptions().GetRcvlowat())
 		return &v, nil
+
+	case linux.SO_MARK:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(ep.SocketOptions().GetMark())
+		return &v, nil
+
+	case linux.SO_LOCK_FILTER:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetLockFilter()))
+		return &v, nil
 	}
 	return nil, syserr.ErrProtocolNotAvailable
 }
@@ -1203,38 +1391,11 @@ func getSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, out
 		return &tcpUserTimeout, nil
 
 	case linux.TCP_INFO:
-		var v tcpip.TCPInfoOption
-		if err := ep.GetSockOpt(&v); err != nil {
+		info, err := tcpInfo(ep)
+		if err != nil {
 			return nil, syserr.TranslateNetstackError(err)
 		}
 
-		info := linux.TCPInfo{
-			State:       uint8(v.State),
-			RTO:         uint32(v.RTO / time.Microsecond),
-			RTT:         uint32(v.RTT / time.Microsecond),
-			RTTVar:      uint32(v.RTTVar / time.Microsecond),
-			SndSsthresh: v.SndSsthresh,
-			SndCwnd:     v.SndCwnd,
-		}
-		switch v.CcState {
-		case tcpip.RTORecovery:
-			info.CaState = linux.TCP_CA_Loss
-		case tcpip.FastRecovery, tcpip.SACKRecovery:
-			info.CaState = linux.TCP_CA_Recovery
-		case tcpip.Disorder:
-			info.CaState = linux.TCP_CA_Disorder
-		case tcpip.Open:
-			info.CaState = linux.TCP_CA_Open
-		}
-
-		// In netstack reorderSeen is updated only when RACK is enabled.
-		// We only track whether the reordering is seen, which is
-		// different than Linux where reorderSeen is not specific to
-		// RACK and is incremented when a reordering event is seen.
-		if v.ReorderSeen {
-			info.ReordSeen = 1
-		}
-
 		// Linux truncates the output binary to outLen.
 		buf := t.CopyScratchBuffer(info.SizeBytes())
 		info.MarshalUnsafe(buf)
@@ -1329,6 +1490,30 @@ func getSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, out
 		}
 		vP := primitive.Int32(v)
 		return &vP, nil
+
+	case linux.TCP_FASTOPEN:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.TCPFastOpenQueueLenOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
+
+	case linux.TCP_FASTOPEN_CONNECT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v, err := ep.GetSockOptInt(tcpip.TCPFastOpenConnectOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
 	}
 	return nil, syserr.ErrProtocolNotAvailable
 }
@@ -1373,6 +1558,45 @@ func defaultTTL(t *kernel.Task, network tcpip.NetworkProtocolNumber) (primitive.
 	return primitive.Int32(opt), nil
 }
 
+// tcpInfo returns the TCP_INFO of a TCP endpoint.
+func tcpInfo(ep commonEndpoint) (linux.TCPInfo, tcpip.Error) {
+	var v tcpip.TCPInfoOption
+	if err := ep.GetSockOpt(&v); err != nil {
+		return linux.TCPInfo{}, err
+	}
+
+	info := linux.TCPInfo{
+		State:       uint8(v.State),
+		RTO:         uint32(v.RTO / time.Microsecond),
+		RTT:         uint32(v.RTT / time.Microsecond),
+		RTTVar:      uint32(v.RTTVar / time.Microsecond),
+		SndSsthresh: v.SndSsthresh,
+		SndCwnd:     v.SndCwnd,
+	}
+	switch v.CcState {
+	case tcpip.RTORecovery:
+		info.CaState = linux.TCP_CA_Loss
+	case tcpip.FastRecovery, tcpip.SACKRecovery:
+		info.CaState = linux.TCP_CA_Recovery
+	case tcpip.Disorder:
+		info.CaState = linux.TCP_CA_Disorder
+	case tcpip.Open:
+		info.CaState = linux.TCP_CA_Open
+	}
+
+	// In netstack reorderSeen is updated only when RACK is enabled.
+	// We only track whether the reordering is seen, which is
+	// different than Linux where reorderSeen is not specific to
+	// RACK and is incremented when a reordering event is seen.
+	if v.ReorderSeen {
+		info.ReordSeen = 1
+	}
+	if v.ECN {
+		info.Options |= linux.TCPI_OPT_ECN
+	}
+	return info, nil
+}
+
 // getSockOptIPv6 implements GetSockOpt when level is SOL_IPV6.
 func getSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
@@ -1407,6 +1631,9 @@ func getSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetV6Only()))
 		return &v, nil
 
+	case linux.MCAST_MSFILTER:
+		return getSockOptMulticastGroupFilter(t, ep, linux.AF_INET6, outPtr, outLen)
+
 	case linux.IPV6_UNICAST_HOPS:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1484,6 +1711,22 @@ func getSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveOriginalDstAddress()))
 		return &v, nil
 
+	case linux.IPV6_TRANSPARENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetTransparent()))
+		return &v, nil
+
+	case linux.IPV6_FREEBIND:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetFreeBind()))
+		return &v, nil
+
 	case linux.IPV6_RECVPKTINFO:
 		if outLen < sizeOfInt32 {
 			return nil, syserr.ErrInvalidArgument
@@ -1545,6 +1788,26 @@ func getSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		}
 		return &entries, nil
 
+	case linux.IP6T_SO_GET_REVISION_MATCH:
+		if outLen < linux.SizeOfXTGetRevision {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		// Only valid for raw IPv6 sockets.
+		if skType != linux.SOCK_RAW {
+			return nil, syserr.ErrProtocolNotAvailable
+		}
+
+		stk := inet.StackFromContext(t)
+		if stk == nil {
+			return nil, syserr.ErrNoDevice
+		}
+		ret, err := netfilter.MatchRevision(t, outPtr)
+		if err != nil {
+			return nil, err
+		}
+		return &ret, nil
+
 	case linux.IP6T_SO_GET_REVISION_TARGET:
 		if outLen < linux.SizeOfXTGetRevision {
 			return nil, syserr.ErrInvalidArgument
@@ -1640,6 +1903,12 @@ func getSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetMulticastLoop()))
 		return &v, nil
 
+	case linux.IP_MSFILTER:
+		return getSockOptIPMulticastFilter(t, ep, outPtr, outLen)
+
+	case linux.MCAST_MSFILTER:
+		return getSockOptMulticastGroupFilter(t, ep, linux.AF_INET, outPtr, outLen)
+
 	case linux.IP_TOS:
 		// Length handling for parity with Linux.
 		if outLen == 0 {
@@ -1697,6 +1966,22 @@ func getSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetReceiveOriginalDstAddress()))
 		return &v, nil
 
+	case linux.IP_TRANSPARENT:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetTransparent()))
+		return &v, nil
+
+	case linux.IP_FREEBIND:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		v := primitive.Int32(boolToInt32(ep.SocketOptions().GetFreeBind()))
+		return &v, nil
+
 	case linux.SO_ORIGINAL_DST:
 		if outLen < sockAddrInetSize {
 			return nil, syserr.ErrInvalidArgument
@@ -1750,6 +2035,26 @@ func getSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		}
 		return &entries, nil
 
+	case linux.IPT_SO_GET_REVISION_MATCH:
+		if outLen < linux.SizeOfXTGetRevision {
+			return nil, syserr.ErrInvalidArgument
+		}
+
+		// Only valid for raw IPv4 sockets.
+		if family, skType, _ := s.Type(); family != linux.AF_INET || skType != linux.SOCK_RAW {
+			return nil, syserr.ErrProtocolNotAvailable
+		}
+
+		stk := inet.StackFromContext(t)
+		if stk == nil {
+			return nil, syserr.ErrNoDevice
+		}
+		ret, err := netfilter.MatchRevision(t, outPtr)
+		if err != nil {
+			return nil, err
+		}
+		return &ret, nil
+
 	case linux.IPT_SO_GET_REVISION_TARGET:
 		if outLen < linux.SizeOfXTGetRevision {
 			return nil, syserr.ErrInvalidArgument
@@ -1822,8 +2127,10 @@ func SetSockOpt(t *kernel.Task, s socket.Socket, ep commonEndpoint, level int, n
 		// features are supported and proceed to use them and break.
 		return syserr.ErrProtocolNotAvailable
 
-	case linux.SOL_UDP,
-		linux.SOL_RAW:
+	case linux.SOL_UDP:
+		return setSockOptUDP(t, s, ep, name, optVal)
+
+	case linux.SOL_RAW:
 		// Not supported.
 	}
 
@@ -2013,10 +2320,35 @@ func setSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		})
 		return nil
 
+	case linux.SO_ATTACH_FILTER:
+		f, err := socket.CopyInFilter(t, optVal)
+		if err != nil {
+			return err
+		}
+		return syserr.TranslateNetstackError(ep.SocketOptions().SetFilter(f))
+
 	case linux.SO_DETACH_FILTER:
 		// optval is ignored.
-		var v tcpip.SocketDetachFilterOption
-		return syserr.TranslateNetstackError(ep.SetSockOpt(&v))
+		return syserr.TranslateNetstackError(ep.SocketOptions().SetFilter(nil))
+
+	case linux.SO_LOCK_FILTER:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		v := hostarch.ByteOrder.Uint32(optVal)
+		return syserr.TranslateNetstackError(ep.SocketOptions().SetLockFilter(v != 0))
+
+	case linux.SO_ATTACH_REUSEPORT_CBPF:
+		f, err := socket.CopyInFilter(t, optVal)
+		if err != nil {
+			return err
+		}
+		return syserr.TranslateNetstackError(ep.SocketOptions().SetReusePortFilter(f))
+
+	case linux.SO_DETACH_REUSEPORT_BPF:
+		// optval is ignored.
+		return syserr.TranslateNetstackError(ep.SocketOptions().SetReusePortFilter(nil))
 
 	// TODO(b/226603727): Add support for SO_RCVLOWAT option. For now, only
 	// the unsupported syscall message is removed.
@@ -2028,6 +2360,17 @@ func setSockOptSocket(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 		v := hostarch.ByteOrder.Uint32(optVal)
 		ep.SocketOptions().SetRcvlowat(int32(v))
 		return nil
+
+	case linux.SO_MARK:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+
+		if !hasNetRawOrAdmin(t) {
+			return syserr.ErrNotPermitted
+		}
+		ep.SocketOptions().SetMark(hostarch.ByteOrder.Uint32(optVal))
+		return nil
 	}
 
 	return nil
@@ -2165,6 +2508,26 @@ func setSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 
 		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.TCPWindowClampOption, int(v)))
 
+	case linux.TCP_FASTOPEN:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.TCPFastOpenQueueLenOption, int(v)))
+
+	case linux.TCP_FASTOPEN_CONNECT:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.TCPFastOpenConnectOption, int(v)))
+
+	case linux.TCP_MD5SIG, linux.TCP_MD5SIG_EXT:
+		family, _, _ := s.Type()
+		return setSockOptTCPMD5Sig(ep, family, name, optVal)
+
 	case linux.TCP_REPAIR_OPTIONS:
 		// Not supported.
 	}
@@ -2172,6 +2535,80 @@ func setSockOptTCP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 	return nil
 }
 
+// setSockOptTCPMD5Sig implements setsockopt(TCP_MD5SIG) and
+// setsockopt(TCP_MD5SIG_EXT) for a TCP socket of the given family.
+func setSockOptTCPMD5Sig(ep commonEndpoint, family, name int, optVal []byte) *syserr.Error {
+	var cmd linux.TCPMD5Sig
+	if len(optVal) < cmd.SizeBytes() {
+		return syserr.ErrInvalidArgument
+	}
+	cmd.UnmarshalUnsafe(optVal)
+
+	if int(cmd.Addr.Family) != family {
+		return syserr.ErrInvalidArgument
+	}
+	addr, err := sockAddrStorageToAddress(&cmd.Addr, family)
+	if err != nil {
+		return err
+	}
+	// Like Linux, keys for IPv4-mapped addresses are used with IPv4 peers.
+	if header.IsV4MappedAddress(addr) {
+		addr = tcpip.AddrFrom4Slice(addr.AsSlice()[header.IPv6AddressSize-header.IPv4AddressSize:])
+	}
+
+	prefixLen := addr.BitLen()
+	var nic tcpip.NICID
+	if name == linux.TCP_MD5SIG_EXT {
+		if cmd.Flags&linux.TCP_MD5SIG_FLAG_PREFIX != 0 {
+			if int(cmd.PrefixLen) > prefixLen {
+				return syserr.ErrInvalidArgument
+			}
+			prefixLen = int(cmd.PrefixLen)
+		}
+		if cmd.Flags&linux.TCP_MD5SIG_FLAG_IFINDEX != 0 {
+			nic = tcpip.NICID(cmd.IfIndex)
+		}
+	}
+	if cmd.KeyLen > linux.TCP_MD5SIG_MAXKEYLEN {
+		return syserr.ErrInvalidArgument
+	}
+
+	return syserr.TranslateNetstackError(ep.SetSockOpt(&tcpip.TCPMD5SigOption{
+		Address:   addr,
+		PrefixLen: prefixLen,
+		NIC:       nic,
+		Key:       cmd.Key[:cmd.KeyLen],
+	}))
+}
+
+// getSockOptUDP implements GetSockOpt when level is SOL_UDP.
+func getSockOptUDP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if !socket.IsUDP(s) {
+		return nil, syserr.ErrUnknownProtocolOption
+	}
+
+	var opt tcpip.SockOptInt
+	switch name {
+	case linux.UDP_SEGMENT:
+		opt = tcpip.UDPSegmentOption
+	case linux.UDP_GRO:
+		opt = tcpip.UDPGROOption
+	default:
+		return nil, syserr.ErrProtocolNotAvailable
+	}
+
+	if outLen < sizeOfInt32 {
+		return nil, syserr.ErrInvalidArgument
+	}
+
+	v, err := ep.GetSockOptInt(opt)
+	if err != nil {
+		return nil, syserr.TranslateNetstackError(err)
+	}
+	vP := primitive.Int32(v)
+	return &vP, nil
+}
+
 func setSockOptICMPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
 		log.Warningf("SOL_ICMPV6 options not supported on endpoints other than tcpip.Endpoint: option = %d", name)
@@ -2196,6 +2633,30 @@ func setSockOptICMPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name i
 	return nil
 }
 
+// setSockOptUDP implements SetSockOpt when level is SOL_UDP.
+func setSockOptUDP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
+	if !socket.IsUDP(s) {
+		return syserr.ErrUnknownProtocolOption
+	}
+
+	var opt tcpip.SockOptInt
+	switch name {
+	case linux.UDP_SEGMENT:
+		opt = tcpip.UDPSegmentOption
+	case linux.UDP_GRO:
+		opt = tcpip.UDPGROOption
+	default:
+		return nil
+	}
+
+	if len(optVal) < sizeOfInt32 {
+		return syserr.ErrInvalidArgument
+	}
+
+	v := int32(hostarch.ByteOrder.Uint32(optVal))
+	return syserr.TranslateNetstackError(ep.SetSockOptInt(opt, int(v)))
+}
+
 // setSockOptIPv6 implements SetSockOpt when level is SOL_IPV6.
 func setSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
@@ -2255,20 +2716,27 @@ func setSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 			MulticastAddr: tcpip.AddrFrom16(req.MulticastAddr),
 		}))
 
+	case linux.IPV6_XFRM_POLICY:
+		return setSockOptXFRMPolicy(t, ep, optVal)
+
 	case linux.IPV6_IPSEC_POLICY,
 		linux.IPV6_JOIN_ANYCAST,
 		linux.IPV6_LEAVE_ANYCAST,
 		// TODO(b/148887420): Add support for IPV6_PKTINFO.
 		linux.IPV6_PKTINFO,
-		linux.IPV6_ROUTER_ALERT,
-		linux.IPV6_XFRM_POLICY,
-		linux.MCAST_BLOCK_SOURCE,
-		linux.MCAST_JOIN_GROUP,
-		linux.MCAST_JOIN_SOURCE_GROUP,
+		linux.IPV6_ROUTER_ALERT:
+		// Not supported.
+
+	case linux.MCAST_JOIN_GROUP,
 		linux.MCAST_LEAVE_GROUP,
+		linux.MCAST_JOIN_SOURCE_GROUP,
 		linux.MCAST_LEAVE_SOURCE_GROUP,
+		linux.MCAST_BLOCK_SOURCE,
 		linux.MCAST_UNBLOCK_SOURCE:
-		// Not supported.
+		return setSockOptMulticastGroup(ep, linux.AF_INET6, name, optVal)
+
+	case linux.MCAST_MSFILTER:
+		return setSockOptMulticastGroupFilter(ep, linux.AF_INET6, optVal)
 
 	case linux.IPV6_RECVORIGDSTADDR:
 		if len(optVal) < sizeOfInt32 {
@@ -2279,6 +2747,27 @@ func setSockOptIPv6(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int
 		ep.SocketOptions().SetReceiveOriginalDstAddress(v != 0)
 		return nil
 
+	case linux.IPV6_TRANSPARENT:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		if v != 0 && !hasNetRawOrAdmin(t) {
+			return syserr.ErrNotPermitted
+		}
+		ep.SocketOptions().SetTransparent(v != 0)
+		return nil
+
+	case linux.IPV6_FREEBIND:
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+
+		ep.SocketOptions().SetFreeBind(v != 0)
+		return nil
+
 	case linux.IPV6_RECVPKTINFO:
 		if len(optVal) < sizeOfInt32 {
 			return syserr.ErrInvalidArgument
@@ -2426,6 +2915,13 @@ func parseIntOrChar(buf []byte) (int32, *syserr.Error) {
 	return int32(buf[0]), nil
 }
 
+// hasNetRawOrAdmin returns true if t has CAP_NET_RAW or CAP_NET_ADMIN, which
+// are required to set IP_TRANSPARENT, IPV6_TRANSPARENT and SO_MARK.
+func hasNetRawOrAdmin(t *kernel.Task) bool {
+	creds := auth.CredentialsFromContext(t)
+	return creds.HasCapability(linux.CAP_NET_RAW) || creds.HasCapability(linux.CAP_NET_ADMIN)
+}
+
 // setSockOptIP implements SetSockOpt when level is SOL_IP.
 func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int, optVal []byte) *syserr.Error {
 	if _, ok := ep.(tcpip.Endpoint); !ok {
@@ -2497,9 +2993,25 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		ep.SocketOptions().SetMulticastLoop(v != 0)
 		return nil
 
-	case linux.MCAST_JOIN_GROUP:
-		// FIXME(b/124219304): Implement MCAST_JOIN_GROUP.
-		return syserr.ErrInvalidArgument
+	case linux.IP_ADD_SOURCE_MEMBERSHIP,
+		linux.IP_DROP_SOURCE_MEMBERSHIP,
+		linux.IP_BLOCK_SOURCE,
+		linux.IP_UNBLOCK_SOURCE:
+		return setSockOptIPSourceMembership(ep, name, optVal)
+
+	case linux.IP_MSFILTER:
+		return setSockOptIPMulticastFilter(ep, optVal)
+
+	case linux.MCAST_JOIN_GROUP,
+		linux.MCAST_LEAVE_GROUP,
+		linux.MCAST_JOIN_SOURCE_GROUP,
+		linux.MCAST_LEAVE_SOURCE_GROUP,
+		linux.MCAST_BLOCK_SOURCE,
+		linux.MCAST_UNBLOCK_SOURCE:
+		return setSockOptMulticastGroup(ep, linux.AF_INET, name, optVal)
+
+	case linux.MCAST_MSFILTER:
+		return setSockOptMulticastGroupFilter(ep, linux.AF_INET, optVal)
 
 	case linux.IP_TTL:
 		v, err := parseIntOrChar(optVal)
@@ -2586,6 +3098,27 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		ep.SocketOptions().SetReceiveOriginalDstAddress(v != 0)
 		return nil
 
+	case linux.IP_TRANSPARENT:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		if v != 0 && !hasNetRawOrAdmin(t) {
+			return syserr.ErrNotPermitted
+		}
+		ep.SocketOptions().SetTransparent(v != 0)
+		return nil
+
+	case linux.IP_FREEBIND:
+		v, err := parseIntOrChar(optVal)
+		if err != nil {
+			return err
+		}
+
+		ep.SocketOptions().SetFreeBind(v != 0)
+		return nil
+
 	case linux.IPT_SO_SET_REPLACE:
 		if len(optVal) < linux.SizeOfIPTReplace {
 			return syserr.ErrInvalidArgument
@@ -2631,15 +3164,10 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		}
 		return syserr.TranslateNetstackError(ep.SetSockOptInt(tcpip.MTUDiscoverOption, int(v)))
 
-	case linux.IP_ADD_SOURCE_MEMBERSHIP,
-		linux.IP_BIND_ADDRESS_NO_PORT,
-		linux.IP_BLOCK_SOURCE,
+	case linux.IP_BIND_ADDRESS_NO_PORT,
 		linux.IP_CHECKSUM,
-		linux.IP_DROP_SOURCE_MEMBERSHIP,
-		linux.IP_FREEBIND,
 		linux.IP_IPSEC_POLICY,
 		linux.IP_MINTTL,
-		linux.IP_MSFILTER,
 		linux.IP_MULTICAST_ALL,
 		linux.IP_NODEFRAG,
 		linux.IP_OPTIONS,
@@ -2647,22 +3175,50 @@ func setSockOptIP(t *kernel.Task, s socket.Socket, ep commonEndpoint, name int,
 		linux.IP_RECVFRAGSIZE,
 		linux.IP_RECVOPTS,
 		linux.IP_RETOPTS,
-		linux.IP_TRANSPARENT,
-		linux.IP_UNBLOCK_SOURCE,
-		linux.IP_UNICAST_IF,
-		linux.IP_XFRM_POLICY,
-		linux.MCAST_BLOCK_SOURCE,
-		linux.MCAST_JOIN_SOURCE_GROUP,
-		linux.MCAST_LEAVE_GROUP,
-		linux.MCAST_LEAVE_SOURCE_GROUP,
-		linux.MCAST_MSFILTER,
-		linux.MCAST_UNBLOCK_SOURCE:
+		linux.IP_UNICAST_IF:
 		// Not supported.
+
+	case linux.IP_XFRM_POLICY:
+		return setSockOptXFRMPolicy(t, ep, optVal)
 	}
 
 	return nil
 }
 
+// setSockOptXFRMPolicy implements IP_XFRM_POLICY and IPV6_XFRM_POLICY. Only
+// policies letting all packets of a direction through, which make the socket
+// bypass the IPsec policies of the stack, are supported.
+func setSockOptXFRMPolicy(t *kernel.Task, ep commonEndpoint, optVal []byte) *syserr.Error {
+	if creds := auth.CredentialsFromContext(t); !creds.HasCapability(linux.CAP_NET_ADMIN) {
+		return syserr.ErrNotPermitted
+	}
+	ops := ep.SocketOptions()
+	if len(optVal) == 0 {
+		// Remove the policies of both directions.
+		ops.SetXFRMInputBypass(false)
+		ops.SetXFRMOutputBypass(false)
+		return nil
+	}
+	if len(optVal) < linux.SizeOfXFRMUserPolicyInfo {
+		return syserr.ErrInvalidArgument
+	}
+	var info linux.XFRMUserPolicyInfo
+	info.UnmarshalUnsafe(optVal)
+	if info.Dir > linux.XFRM_POLICY_OUT {
+		return syserr.ErrInvalidArgument
+	}
+	if info.Action != linux.XFRM_POLICY_ALLOW || len(optVal) > linux.SizeOfXFRMUserPolicyInfo {
+		// Per-socket policies with templates aren't supported.
+		return syserr.ErrNotSupported
+	}
+	if info.Dir == linux.XFRM_POLICY_IN {
+		ops.SetXFRMInputBypass(true)
+	} else {
+		ops.SetXFRMOutputBypass(true)
+	}
+	return nil
+}
+
 // GetSockName implements the linux syscall getsockname(2) for sockets backed by
 // tcpip.Endpoint.
 func (s *sock) GetSockName(*kernel.Task) (linux.SockAddr, uint32, *syserr.Error) {
@@ -2769,6 +3325,25 @@ func (s *sock) nonBlockingRead(ctx context.Context, dst usermem.IOSequence, peek
 	// Set the control message, even if 0 bytes were read.
 	s.updateTimestamp(res.ControlMessages)
 
+	if s.protocol == linux.IPPROTO_SCTP {
+		// SCTP preserves message boundaries without truncating messages: a
+		// message that doesn't fit is read in several parts, the last of
+		// which is marked with MSG_EOR.
+		var flags int
+		if res.EndOfRecord {
+			flags |= linux.MSG_EOR
+		}
+		if res.Notification {
+			flags |= linux.MSG_NOTIFICATION
+		}
+		var addr linux.SockAddr
+		var addrLen uint32
+		if senderRequested && !res.Notification {
+			addr, addrLen = socket.ConvertAddress(s.family, res.RemoteAddr)
+		}
+		return res.Count, flags, addr, addrLen, s.netstackToLinuxControlMessages(res.ControlMessages), nil
+	}
+
 	if isPacket {
 		var addr linux.SockAddr
 		var addrLen uint32
@@ -2821,10 +3396,18 @@ func (s *sock) nonBlockingRead(ctx context.Context, dst usermem.IOSequence, peek
 
 func (s *sock) netstackToLinuxControlMessages(cm tcpip.ReceivableControlMessages) socket.ControlMessages {
 	readCM := socket.NewIPControlMessages(s.family, cm)
+	const rxSoftware = linux.SOF_TIMESTAMPING_SOFTWARE | linux.SOF_TIMESTAMPING_RX_SOFTWARE
+	var timestamping linux.ScmTimestamping
+	hasTimestamping := readCM.HasTimestamp && s.sockOptTimestamping&rxSoftware == rxSoftware
+	if hasTimestamping {
+		timestamping.Ts[0] = linux.NsecToTimespec(readCM.Timestamp.UnixNano())
+	}
 	return socket.ControlMessages{
 		IP: socket.IPControlMessages{
 			HasTimestamp:       readCM.HasTimestamp && s.sockOptTimestamp,
 			Timestamp:          readCM.Timestamp,
+			HasTimestamping:    hasTimestamping,
+			Timestamping:       timestamping,
 			HasInq:             readCM.HasInq,
 			Inq:                readCM.Inq,
 			HasTOS:             readCM.HasTOS,
@@ -2841,17 +3424,64 @@ func (s *sock) netstackToLinuxControlMessages(cm tcpip.ReceivableControlMessages
 			IPv6PacketInfo:     readCM.IPv6PacketInfo,
 			OriginalDstAddress: readCM.OriginalDstAddress,
 			SockErr:            readCM.SockErr,
+			HasSCTPRcvInfo:     readCM.HasSCTPRcvInfo,
+			SCTPRcvInfo:        readCM.SCTPRcvInfo,
+			HasSCTPSndRcvInfo:  readCM.HasSCTPSndRcvInfo,
+			SCTPSndRcvInfo:     readCM.SCTPSndRcvInfo,
+			HasUDPGROSize:      readCM.HasUDPGROSize,
+			UDPGROSize:         readCM.UDPGROSize,
 		},
 	}
 }
 
-func (s *sock) linuxToNetstackControlMessages(cm socket.ControlMessages) tcpip.SendableControlMessages {
-	return tcpip.SendableControlMessages{
-		HasTTL:      cm.IP.HasTTL,
-		TTL:         uint8(cm.IP.TTL),
-		HasHopLimit: cm.IP.HasHopLimit,
-		HopLimit:    uint8(cm.IP.HopLimit),
+func (s *sock) linuxToNetstackControlMessages(t *kernel.Task, cm socket.ControlMessages) (tcpip.SendableControlMessages, *syserr.Error) {
+	scm := tcpip.SendableControlMessages{
+		HasTTL:            cm.IP.HasTTL,
+		TTL:               uint8(cm.IP.TTL),
+		HasHopLimit:       cm.IP.HasHopLimit,
+		HopLimit:          uint8(cm.IP.HopLimit),
+		HasUDPSegmentSize: cm.IP.HasUDPSegmentSize,
+		UDPSegmentSize:    cm.IP.UDPSegmentSize,
+	}
+	if cm.IP.HasTXTimestamping {
+		// The per-message flags replace the transmit recording flags set
+		// with SO_TIMESTAMPING, but not its options.
+		opts := s.Endpoint.SocketOptions().GetTimestamping() &^ tcpip.TimestampingTXFlags
+		scm.HasTimestamping = true
+		scm.Timestamping = opts | timestampingFlagsToNetstack(cm.IP.TXTimestamping)
+	}
+	if cm.IP.HasTXTime {
+		txTime, err := s.txTimeToNetstack(t, cm.IP.TXTime)
+		if err != nil {
+			return tcpip.SendableControlMessages{}, err
+		}
+		scm.HasTXTime = true
+		scm.TXTime = txTime
+	}
+	// SCTP_SNDINFO takes precedence over the deprecated SCTP_SNDRCV.
+	switch {
+	case cm.IP.HasSCTPSndInfo:
+		info := &cm.IP.SCTPSndInfo
+		scm.HasSCTPSndInfo = true
+		scm.SCTPSndInfo = tcpip.SCTPSndInfo{
+			Stream:  info.Stream,
+			Flags:   info.Flags,
+			PPID:    info.PPID,
+			Context: info.Context,
+			AssocID: tcpip.SCTPAssocID(info.AssocID),
+		}
+	case cm.IP.HasSCTPSndRcvInfo:
+		info := &cm.IP.SCTPSndRcvInfo
+		scm.HasSCTPSndInfo = true
+		scm.SCTPSndInfo = tcpip.SCTPSndInfo{
+			Stream:  info.Stream,
+			Flags:   info.Flags,
+			PPID:    info.PPID,
+			Context: info.Context,
+			AssocID: tcpip.SCTPAssocID(info.AssocID),
+		}
 	}
+	return scm, nil
 }
 
 // updateTimestamp sets the timestamp for SIOCGSTAMP. It should be called after
@@ -2915,10 +3545,23 @@ func (s *sock) recvErr(t *kernel.Task, dst usermem.IOSequence) (int, int, linux.
 	}
 	n, err := dst.CopyOut(t, sockErr.Payload.AsSlice())
 
+	cmgs := socket.ControlMessages{IP: socket.NewIPControlMessages(s.family, tcpip.ReceivableControlMessages{SockErr: sockErr})}
+	if sockErr.Cause.Origin() == tcpip.SockExtErrorOriginTimestamping {
+		// Transmit timestamps carry no address, and their time is only
+		// reported if software timestamps were requested.
+		s.readMu.Lock()
+		reportSoftware := s.sockOptTimestamping&linux.SOF_TIMESTAMPING_SOFTWARE != 0
+		s.readMu.Unlock()
+		if reportSoftware {
+			cmgs.IP.HasTimestamping = true
+			cmgs.IP.Timestamping.Ts[0] = linux.NsecToTimespec(sockErr.Timestamp.UnixNano())
+		}
+		return n, msgFlags, nil, 0, cmgs, syserr.FromError(err)
+	}
+
 	// The original destination address of the datagram that caused the error is
 	// supplied via msg_name.  -- recvmsg(2)
 	dstAddr, dstAddrLen := socket.ConvertAddress(addrFamilyFromNetProto(sockErr.NetProto), sockErr.Dst)
-	cmgs := socket.ControlMessages{IP: socket.NewIPControlMessages(s.family, tcpip.ReceivableControlMessages{SockErr: sockErr})}
 	return n, msgFlags, dstAddr, dstAddrLen, cmgs, syserr.FromError(err)
 }
 
@@ -2932,8 +3575,9 @@ func (s *sock) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDe
 	trunc := flags&linux.MSG_TRUNC != 0
 	peek := flags&linux.MSG_PEEK != 0
 	dontWait := flags&linux.MSG_DONTWAIT != 0
-	waitAll := flags&linux.MSG_WAITALL != 0
-	if senderRequested && !s.isPacketBased() {
+	// SCTP reads never span messages.
+	waitAll := flags&linux.MSG_WAITALL != 0 && s.protocol != linux.IPPROTO_SCTP
+	if senderRequested && !s.isPacketBased() && s.protocol != linux.IPPROTO_SCTP {
 		// Stream sockets ignore the sender address.
 		senderRequested = false
 	}
@@ -3016,11 +3660,16 @@ func (s *sock) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags
 		addr = &addrBuf
 	}
 
+	scm, err := s.linuxToNetstackControlMessages(t, controlMessages)
+	if err != nil {
+		return 0, err
+	}
 	opts := tcpip.WriteOptions{
 		To:              addr,
 		More:            flags&linux.MSG_MORE != 0,
 		EndOfRecord:     flags&linux.MSG_EOR != 0,
-		ControlMessages: s.linuxToNetstackControlMessages(controlMessages),
+		FastOpen:        flags&linux.MSG_FASTOPEN != 0 && s.skType == linux.SOCK_STREAM,
+		ControlMessages: scm,
 	}
 
 	r := src.Reader(t)
@@ -3032,6 +3681,8 @@ func (s *sock) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags
 	for {
 		n, err := s.Endpoint.Write(r, opts)
 		total += n
+		// Only the first write may connect the endpoint.
+		opts.FastOpen = false
 		if flags&linux.MSG_DONTWAIT != 0 {
 			return int(total), syserr.TranslateNetstackError(err)
 		}
@@ -3039,7 +3690,7 @@ func (s *sock) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags
 		switch err.(type) {
 		case nil:
 			block = total != src.NumBytes()
-		case *tcpip.ErrWouldBlock:
+		case *tcpip.ErrWouldBlock, *tcpip.ErrConnectStarted:
 		default:
 			block = false
 		}
@@ -30,6 +30,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/sctp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
 	"gvisor.dev/gvisor/pkg/waiter"
@@ -44,16 +45,24 @@ type provider struct {
 var rawMissingLogger = log.BasicRateLimitedLogger(time.Minute)
 
 // getTransportProtocol figures out transport protocol. Currently only TCP,
-// UDP, and ICMP are supported. The bool return value is true when this socket
-// is associated with a transport protocol. This is only false for SOCK_RAW,
-// IPPROTO_IP sockets.
+// UDP, SCTP and ICMP are supported. The bool return value is true when this
+// socket is associated with a transport protocol. This is only false for
+// SOCK_RAW, IPPROTO_IP sockets.
 func getTransportProtocol(ctx context.Context, stype linux.SockType, protocol int) (tcpip.TransportProtocolNumber, bool, *syserr.Error) {
 	switch stype {
 	case linux.SOCK_STREAM:
-		if protocol != 0 && protocol != unix.IPPROTO_TCP {
-			return 0, true, syserr.ErrInvalidArgument
+		switch protocol {
+		case 0, unix.IPPROTO_TCP:
+			return tcp.ProtocolNumber, true, nil
+		case unix.IPPROTO_SCTP:
+			return sctp.ProtocolNumber, true, nil
+		}
+		return 0, true, syserr.ErrInvalidArgument
+
+	case linux.SOCK_SEQPACKET:
+		if protocol == unix.IPPROTO_SCTP {
+			return sctp.ProtocolNumber, true, nil
 		}
-		return tcp.ProtocolNumber, true, nil
 
 	case linux.SOCK_DGRAM:
 		switch protocol {
@@ -82,6 +91,8 @@ func getTransportProtocol(ctx context.Context, stype linux.SockType, protocol in
 			return header.UDPProtocolNumber, true, nil
 		case unix.IPPROTO_TCP:
 			return header.TCPProtocolNumber, true, nil
+		case unix.IPPROTO_SCTP:
+			return header.SCTPProtocolNumber, true, nil
 		// IPPROTO_RAW signifies that the raw socket isn't assigned to
 		// a transport protocol. Users will be able to write packets'
 		// IP headers and won't receive anything.
@@ -123,9 +134,16 @@ func (p *provider) Socket(t *kernel.Task, stype linux.SockType, protocol int) (*
 	var ep tcpip.Endpoint
 	var e tcpip.Error
 	wq := &waiter.Queue{}
-	if stype == linux.SOCK_RAW {
+	switch {
+	case stype == linux.SOCK_RAW:
 		ep, e = eps.Stack.NewRawEndpoint(transProto, p.netProto, wq, associated)
-	} else {
+	case stype == linux.SOCK_SEQPACKET && transProto == sctp.ProtocolNumber:
+		// SOCK_SEQPACKET selects the one-to-many style of SCTP.
+		ep, e = sctp.NewOneToManyEndpoint(eps.Stack, p.netProto, wq)
+		if e == nil {
+			ep.SetOwner(t)
+		}
+	default:
 		ep, e = eps.Stack.NewEndpoint(transProto, p.netProto, wq)
 
 		// Assign task to PacketOwner interface to get the UID and GID for
@@ -0,0 +1,584 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/bits"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fqcodel"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/netem"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/prio"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/tbf"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// autoQDiscHandle is the handle of queueing disciplines created without one.
+// It is the first handle Linux allocates in net/sched/sch_api.c:
+// qdisc_alloc_handle().
+const autoQDiscHandle = 0x80010000
+
+// qDiscConfig is the configuration of a queueing discipline set with
+// RTM_NEWQDISC.
+type qDiscConfig interface {
+	// kind returns the name of the queueing discipline.
+	kind() string
+
+	// options returns the payload of the TCA_OPTIONS attribute describing
+	// the configuration.
+	options() []byte
+
+	// newQDisc creates the queueing discipline on top of lower.
+	newQDisc(s *stack.Stack, lower stack.LinkWriter) stack.QueueingDiscipline
+}
+
+// netlinkQDisc is a queueing discipline set with RTM_NEWQDISC.
+//
+// +stateify savable
+type netlinkQDisc struct {
+	stack.QueueingDiscipline
+	handle uint32
+	config qDiscConfig
+}
+
+// appendAttr appends a netlink attribute to b.
+func appendAttr(b []byte, atype uint16, v []byte) []byte {
+	l := linux.NetlinkAttrHeaderSize + len(v)
+	b = hostarch.ByteOrder.AppendUint16(b, uint16(l))
+	b = hostarch.ByteOrder.AppendUint16(b, atype)
+	b = append(b, v...)
+	return append(b, make([]byte, bits.AlignUp(l, linux.NLA_ALIGNTO)-l)...)
+}
+
+// appendUint32Attr appends a u32 netlink attribute to b.
+func appendUint32Attr(b []byte, atype uint16, v uint32) []byte {
+	return appendAttr(b, atype, hostarch.ByteOrder.AppendUint32(nil, v))
+}
+
+// appendUint64Attr appends a u64 netlink attribute to b.
+func appendUint64Attr(b []byte, atype uint16, v uint64) []byte {
+	return appendAttr(b, atype, hostarch.ByteOrder.AppendUint64(nil, v))
+}
+
+// parseUint64 parses a u64 attribute.
+func parseUint64(v nlmsg.BytesView) (uint64, bool) {
+	if len(v) != 8 {
+		return 0, false
+	}
+	return hostarch.ByteOrder.Uint64(v), true
+}
+
+// parseQDiscOptions parses the attributes nested in TCA_OPTIONS. Like Linux,
+// it ignores the NLA_F_NESTED flag that iproute2 sets on TCA_OPTIONS.
+func parseQDiscOptions(v nlmsg.AttrsView) (map[uint16]nlmsg.BytesView, bool) {
+	attrs := make(map[uint16]nlmsg.BytesView)
+	for !v.Empty() {
+		hdr, value, rest, ok := v.ParseFirst()
+		if !ok {
+			return nil, false
+		}
+		v = rest
+		attrs[hdr.Type&linux.NLA_TYPE_MASK] = nlmsg.BytesView(value)
+	}
+	return attrs, true
+}
+
+// ticksToDuration converts packet scheduler ticks, in which iproute2 passes
+// times, to a duration.
+func ticksToDuration(ticks uint32) time.Duration {
+	return time.Duration(ticks) << linux.PSCHED_SHIFT
+}
+
+// durationToTicks converts a duration to packet scheduler ticks, saturating
+// at the largest u32.
+func durationToTicks(d time.Duration) uint32 {
+	return uint32(min(uint64(d>>linux.PSCHED_SHIFT), math.MaxUint32))
+}
+
+// tbfConfig is the configuration of a token bucket queueing discipline.
+//
+// +stateify savable
+type tbfConfig struct {
+	opts tbf.Options
+}
+
+// kind implements qDiscConfig.kind.
+func (*tbfConfig) kind() string {
+	return "tbf"
+}
+
+// options implements qDiscConfig.options.
+func (c *tbfConfig) options() []byte {
+	buffer := time.Duration(uint64(c.opts.Burst) * uint64(time.Second) / c.opts.Rate)
+	qopt := linux.TcTbfQopt{
+		Rate:   linux.TcRateSpec{Rate: uint32(min(c.opts.Rate, math.MaxUint32))},
+		Limit:  c.opts.Limit,
+		Buffer: durationToTicks(buffer),
+	}
+	b := appendAttr(nil, linux.TCA_TBF_PARMS, marshal.Marshal(&qopt))
+	if c.opts.Rate >= math.MaxUint32 {
+		b = appendUint64Attr(b, linux.TCA_TBF_RATE64, c.opts.Rate)
+	}
+	return appendUint32Attr(b, linux.TCA_TBF_BURST, c.opts.Burst)
+}
+
+// newQDisc implements qDiscConfig.newQDisc.
+func (c *tbfConfig) newQDisc(s *stack.Stack, lower stack.LinkWriter) stack.QueueingDiscipline {
+	return tbf.New(lower, s.Clock(), c.opts)
+}
+
+// parseTBF parses the options of a token bucket queueing discipline.
+func parseTBF(attrs map[uint16]nlmsg.BytesView) (qDiscConfig, *syserr.Error) {
+	v, ok := attrs[linux.TCA_TBF_PARMS]
+	if !ok || len(v) < linux.SizeOfTcTbfQopt {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var qopt linux.TcTbfQopt
+	qopt.UnmarshalUnsafe(v)
+	if _, ok := attrs[linux.TCA_TBF_PRATE64]; ok || qopt.PeakRate.Rate != 0 {
+		// Peak rates aren't supported.
+		return nil, syserr.ErrNotSupported
+	}
+
+	c := &tbfConfig{opts: tbf.Options{
+		Rate:  uint64(qopt.Rate.Rate),
+		Limit: qopt.Limit,
+	}}
+	if v, ok := attrs[linux.TCA_TBF_RATE64]; ok {
+		if c.opts.Rate, ok = parseUint64(v); !ok {
+			return nil, syserr.ErrInvalidArgument
+		}
+	}
+	if c.opts.Rate == 0 {
+		return nil, syserr.ErrInvalidArgument
+	}
+	// The bucket holds the bytes that can be sent at the rate within the
+	// buffer time, unless its size is given in bytes.
+	burst := ticksToDuration(qopt.Buffer).Seconds() * float64(c.opts.Rate)
+	c.opts.Burst = uint32(min(burst, math.MaxUint32))
+	if v, ok := attrs[linux.TCA_TBF_BURST]; ok {
+		if c.opts.Burst, ok = v.Uint32(); !ok {
+			return nil, syserr.ErrInvalidArgument
+		}
+	}
+	if c.opts.Burst == 0 {
+		return nil, syserr.ErrInvalidArgument
+	}
+	if c.opts.Limit == 0 {
+		c.opts.Limit = tbf.DefaultLimit
+	}
+	return c, nil
+}
+
+// fqCoDelConfig is the configuration of a fair queueing discipline with
+// controlled delay.
+//
+// +stateify savable
+type fqCoDelConfig struct {
+	opts fqcodel.Options
+}
+
+// kind implements qDiscConfig.kind.
+func (*fqCoDelConfig) kind() string {
+	return "fq_codel"
+}
+
+// options implements qDiscConfig.options.
+func (c *fqCoDelConfig) options() []byte {
+	ecn := uint32(1)
+	if c.opts.DisableECN {
+		ecn = 0
+	}
+	b := appendUint32Attr(nil, linux.TCA_FQ_CODEL_TARGET, uint32(c.opts.Target.Microseconds()))
+	b = appendUint32Attr(b, linux.TCA_FQ_CODEL_LIMIT, uint32(c.opts.Limit))
+	b = appendUint32Attr(b, linux.TCA_FQ_CODEL_INTERVAL, uint32(c.opts.Interval.Microseconds()))
+	b = appendUint32Attr(b, linux.TCA_FQ_CODEL_ECN, ecn)
+	b = appendUint32Attr(b, linux.TCA_FQ_CODEL_QUANTUM, uint32(c.opts.Quantum))
+	b = appendUint32Attr(b, linux.TCA_FQ_CODEL_DROP_BATCH_SIZE, uint32(c.opts.DropBatchSize))
+	return appendUint32Attr(b, linux.TCA_FQ_CODEL_FLOWS, uint32(c.opts.Flows))
+}
+
+// newQDisc implements qDiscConfig.newQDisc.
+func (c *fqCoDelConfig) newQDisc(s *stack.Stack, lower stack.LinkWriter) stack.QueueingDiscipline {
+	return fqcodel.New(lower, s.Clock(), c.opts)
+}
+
+// parseFQCoDel parses the options of a fair queueing discipline with
+// controlled delay.
+func parseFQCoDel(attrs map[uint16]nlmsg.BytesView) (qDiscConfig, *syserr.Error) {
+	c := &fqCoDelConfig{opts: fqcodel.Options{
+		Target:        fqcodel.DefaultTarget,
+		Interval:      fqcodel.DefaultInterval,
+		Limit:         fqcodel.DefaultLimit,
+		Flows:         fqcodel.DefaultFlows,
+		Quantum:       fqcodel.DefaultQuantum,
+		DropBatchSize: fqcodel.DefaultDropBatchSize,
+	}}
+	for attr, v := range attrs {
+		switch attr {
+		case linux.TCA_FQ_CODEL_MEMORY_LIMIT:
+			// Memory use is bounded by the packet limit.
+			continue
+		case linux.TCA_FQ_CODEL_CE_THRESHOLD, linux.TCA_FQ_CODEL_CE_THRESHOLD_SELECTOR, linux.TCA_FQ_CODEL_CE_THRESHOLD_MASK:
+			return nil, syserr.ErrNotSupported
+		}
+		val, ok := v.Uint32()
+		if !ok {
+			return nil, syserr.ErrInvalidArgument
+		}
+		switch attr {
+		case linux.TCA_FQ_CODEL_TARGET:
+			c.opts.Target = time.Duration(val) * time.Microsecond
+		case linux.TCA_FQ_CODEL_INTERVAL:
+			c.opts.Interval = time.Duration(val) * time.Microsecond
+		case linux.TCA_FQ_CODEL_LIMIT:
+			c.opts.Limit = int(val)
+		case linux.TCA_FQ_CODEL_ECN:
+			c.opts.DisableECN = val == 0
+		case linux.TCA_FQ_CODEL_FLOWS:
+			c.opts.Flows = int(val)
+		case linux.TCA_FQ_CODEL_QUANTUM:
+			c.opts.Quantum = int(val)
+		case linux.TCA_FQ_CODEL_DROP_BATCH_SIZE:
+			c.opts.DropBatchSize = int(val)
+		}
+	}
+	// As in Linux's net/sched/sch_fq_codel.c:fq_codel_change(), all values
+	// must be positive.
+	if c.opts.Target == 0 || c.opts.Interval == 0 || c.opts.Limit <= 0 || c.opts.Flows <= 0 || c.opts.Quantum <= 0 || c.opts.DropBatchSize <= 0 {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return c, nil
+}
+
+// prioConfig is the configuration of a priority queueing discipline.
+//
+// +stateify savable
+type prioConfig struct {
+	opts prio.Options
+}
+
+// kind implements qDiscConfig.kind.
+func (*prioConfig) kind() string {
+	return "prio"
+}
+
+// options implements qDiscConfig.options.
+func (c *prioConfig) options() []byte {
+	// The options are a struct tc_prio_qopt rather than attributes.
+	return marshal.Marshal(&linux.TcPrioQopt{
+		Bands:   int32(c.opts.Bands),
+		Priomap: c.opts.Priomap,
+	})
+}
+
+// newQDisc implements qDiscConfig.newQDisc.
+func (c *prioConfig) newQDisc(s *stack.Stack, lower stack.LinkWriter) stack.QueueingDiscipline {
+	return prio.New(lower, c.opts)
+}
+
+// parsePrio parses the options of a priority queueing discipline.
+func parsePrio(v nlmsg.BytesView) (qDiscConfig, *syserr.Error) {
+	if len(v) < linux.SizeOfTcPrioQopt {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var qopt linux.TcPrioQopt
+	qopt.UnmarshalUnsafe(v)
+	if qopt.Bands < linux.TCQ_MIN_PRIO_BANDS || qopt.Bands > linux.TCQ_PRIO_BANDS {
+		return nil, syserr.ErrInvalidArgument
+	}
+	for _, band := range qopt.Priomap {
+		if int32(band) >= qopt.Bands {
+			return nil, syserr.ErrInvalidArgument
+		}
+	}
+	return &prioConfig{opts: prio.Options{
+		Bands:   int(qopt.Bands),
+		Priomap: qopt.Priomap,
+		Limit:   prio.DefaultLimit,
+	}}, nil
+}
+
+// netemConfig is the configuration of a network emulation queueing
+// discipline.
+//
+// +stateify savable
+type netemConfig struct {
+	opts netem.Options
+}
+
+// kind implements qDiscConfig.kind.
+func (*netemConfig) kind() string {
+	return "netem"
+}
+
+// options implements qDiscConfig.options.
+func (c *netemConfig) options() []byte {
+	// The options are a struct tc_netem_qopt followed by attributes.
+	b := marshal.Marshal(&linux.TcNetemQopt{
+		Latency:   durationToTicks(c.opts.Latency),
+		Limit:     uint32(c.opts.Limit),
+		Loss:      c.opts.Loss,
+		Gap:       c.opts.Gap,
+		Duplicate: c.opts.Duplicate,
+		Jitter:    durationToTicks(c.opts.Jitter),
+	})
+	b = append(b, make([]byte, bits.AlignUp(len(b), linux.NLA_ALIGNTO)-len(b))...)
+	b = appendAttr(b, linux.TCA_NETEM_REORDER, marshal.Marshal(&linux.TcNetemReorder{
+		Probability: c.opts.Reorder,
+	}))
+	b = appendUint64Attr(b, linux.TCA_NETEM_LATENCY64, uint64(c.opts.Latency))
+	return appendUint64Attr(b, linux.TCA_NETEM_JITTER64, uint64(c.opts.Jitter))
+}
+
+// newQDisc implements qDiscConfig.newQDisc.
+func (c *netemConfig) newQDisc(s *stack.Stack, lower stack.LinkWriter) stack.QueueingDiscipline {
+	return netem.New(lower, s.Clock(), s.InsecureRNG(), c.opts)
+}
+
+// parseNetem parses the options of a network emulation queueing discipline.
+func parseNetem(v nlmsg.BytesView) (qDiscConfig, *syserr.Error) {
+	if len(v) < linux.SizeOfTcNetemQopt {
+		return nil, syserr.ErrInvalidArgument
+	}
+	var qopt linux.TcNetemQopt
+	qopt.UnmarshalUnsafe(v)
+	c := &netemConfig{opts: netem.Options{
+		Latency:   ticksToDuration(qopt.Latency),
+		Jitter:    ticksToDuration(qopt.Jitter),
+		Limit:     int(qopt.Limit),
+		Loss:      qopt.Loss,
+		Duplicate: qopt.Duplicate,
+		Gap:       qopt.Gap,
+	}}
+
+	// Attributes follow the struct, as in Linux's
+	// net/sched/sch_netem.c:parse_attr().
+	attrs, ok := parseQDiscOptions(nlmsg.AttrsView(v[bits.AlignUp(linux.SizeOfTcNetemQopt, linux.NLA_ALIGNTO):]))
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	for attr, v := range attrs {
+		switch attr {
+		case linux.TCA_NETEM_REORDER:
+			if len(v) < linux.SizeOfTcNetemReorder {
+				return nil, syserr.ErrInvalidArgument
+			}
+			var reorder linux.TcNetemReorder
+			reorder.UnmarshalUnsafe(v)
+			if reorder.Correlation != 0 {
+				return nil, syserr.ErrNotSupported
+			}
+			c.opts.Reorder = reorder.Probability
+		case linux.TCA_NETEM_LATENCY64, linux.TCA_NETEM_JITTER64:
+			val, ok := parseUint64(v)
+			if !ok || int64(val) < 0 {
+				return nil, syserr.ErrInvalidArgument
+			}
+			if attr == linux.TCA_NETEM_LATENCY64 {
+				c.opts.Latency = time.Duration(val)
+			} else {
+				c.opts.Jitter = time.Duration(val)
+			}
+		case linux.TCA_NETEM_CORR, linux.TCA_NETEM_CORRUPT, linux.TCA_NETEM_ECN, linux.TCA_NETEM_RATE, linux.TCA_NETEM_RATE64, linux.TCA_NETEM_SLOT:
+			// Correlations, corruption, rate and slot emulation aren't
+			// supported, but may be passed disabled.
+			if !isZero(v) {
+				return nil, syserr.ErrNotSupported
+			}
+		case linux.TCA_NETEM_PRNG_SEED:
+			// Impairments are drawn from the stack's generator.
+		default:
+			return nil, syserr.ErrNotSupported
+		}
+	}
+	if c.opts.Limit == 0 {
+		c.opts.Limit = netem.DefaultLimit
+	}
+	return c, nil
+}
+
+// parseQDisc parses the kind and options of a queueing discipline.
+func parseQDisc(kind string, options nlmsg.BytesView) (qDiscConfig, *syserr.Error) {
+	switch kind {
+	case "prio":
+		return parsePrio(options)
+	case "netem":
+		return parseNetem(options)
+	}
+	attrs, ok := parseQDiscOptions(nlmsg.AttrsView(options))
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	switch kind {
+	case "tbf":
+		return parseTBF(attrs)
+	case "fq_codel":
+		return parseFQCoDel(attrs)
+	default:
+		// Like Linux, report unknown kinds with ENOENT.
+		return nil, syserr.ErrNoFileOrDir
+	}
+}
+
+// parseQDiscMessage parses the header and attributes of an RTM_NEWQDISC or
+// RTM_DELQDISC request, and returns the queueing discipline of the interface
+// it targets.
+func (s *Stack) parseQDiscMessage(msg *nlmsg.Message) (*linux.TcMsg, map[uint16]nlmsg.BytesView, stack.QueueingDiscipline, *syserr.Error) {
+	var tcm linux.TcMsg
+	attrsView, ok := msg.GetData(&tcm)
+	if !ok {
+		return nil, nil, nil, syserr.ErrInvalidArgument
+	}
+	attrs, ok := parseQDiscOptions(attrsView)
+	if !ok {
+		return nil, nil, nil, syserr.ErrInvalidArgument
+	}
+	qDisc, tcpipErr := s.Stack.NICQueueingDiscipline(tcpip.NICID(tcm.Ifindex))
+	if tcpipErr != nil {
+		return nil, nil, nil, syserr.ErrNoDevice
+	}
+	if tcm.Parent != linux.TC_H_ROOT {
+		// Only root queueing disciplines are supported; they have no
+		// classes to attach others to.
+		return nil, nil, nil, syserr.ErrNotSupported
+	}
+	if tcm.Handle&linux.TC_H_MIN_MASK != 0 {
+		return nil, nil, nil, syserr.ErrInvalidArgument
+	}
+	return &tcm, attrs, qDisc, nil
+}
+
+// NewQDisc implements inet.Stack.NewQDisc.
+//
+// Changing a queueing discipline replaces it with a new one, dropping the
+// packets it holds.
+func (s *Stack) NewQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	tcm, attrs, qDisc, err := s.parseQDiscMessage(msg)
+	if err != nil {
+		return err
+	}
+	kindView, ok := attrs[linux.TCA_KIND]
+	if !ok {
+		return syserr.ErrInvalidArgument
+	}
+	config, err := parseQDisc(kindView.String(), attrs[linux.TCA_OPTIONS])
+	if err != nil {
+		return err
+	}
+
+	flags := msg.Header().Flags
+	handle := tcm.Handle
+	if current, ok := qDisc.(*netlinkQDisc); ok {
+		switch {
+		case flags&linux.NLM_F_EXCL != 0:
+			return syserr.ErrExists
+		case handle != 0 && handle != current.handle && flags&linux.NLM_F_REPLACE == 0:
+			return syserr.ErrNoFileOrDir
+		case current.config.kind() != config.kind() && flags&linux.NLM_F_REPLACE == 0:
+			// Only the options of a queueing discipline may be changed.
+			return syserr.ErrInvalidArgument
+		}
+		if handle == 0 {
+			handle = current.handle
+		}
+	} else if flags&linux.NLM_F_CREATE == 0 {
+		return syserr.ErrNoFileOrDir
+	}
+	if handle == 0 {
+		handle = autoQDiscHandle
+	}
+
+	if tcpipErr := s.Stack.SetNICQueueingDiscipline(tcpip.NICID(tcm.Ifindex), func(lower stack.LinkWriter) stack.QueueingDiscipline {
+		return &netlinkQDisc{
+			QueueingDiscipline: config.newQDisc(s.Stack, lower),
+			handle:             handle,
+			config:             config,
+		}
+	}); tcpipErr != nil {
+		return syserr.TranslateNetstackError(tcpipErr)
+	}
+	return nil
+}
+
+// RemoveQDisc implements inet.Stack.RemoveQDisc.
+//
+// The interface falls back to the queueing discipline it was created with.
+func (s *Stack) RemoveQDisc(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	tcm, attrs, qDisc, err := s.parseQDiscMessage(msg)
+	if err != nil {
+		return err
+	}
+	current, ok := qDisc.(*netlinkQDisc)
+	if !ok {
+		// The default queueing discipline can't be deleted.
+		return syserr.ErrNoFileOrDir
+	}
+	if tcm.Handle != 0 && tcm.Handle != current.handle {
+		return syserr.ErrNoFileOrDir
+	}
+	if kind, ok := attrs[linux.TCA_KIND]; ok && kind.String() != current.config.kind() {
+		return syserr.ErrInvalidArgument
+	}
+	if tcpipErr := s.Stack.SetNICQueueingDiscipline(tcpip.NICID(tcm.Ifindex), nil); tcpipErr != nil {
+		return syserr.TranslateNetstackError(tcpipErr)
+	}
+	return nil
+}
+
+// QDiscs implements inet.Stack.QDiscs.
+//
+// Interfaces without a queueing discipline are reported with the noqueue
+// discipline. Queueing disciplines interfaces were created with are not
+// reported.
+func (s *Stack) QDiscs() []inet.QDisc {
+	var qDiscs []inet.QDisc
+	for id := range s.Stack.NICInfo() {
+		qDisc, err := s.Stack.NICQueueingDiscipline(id)
+		if err != nil {
+			continue
+		}
+		switch qDisc := qDisc.(type) {
+		case nil:
+			qDiscs = append(qDiscs, inet.QDisc{
+				Index:  int32(id),
+				Parent: linux.TC_H_ROOT,
+				Kind:   "noqueue",
+			})
+		case *netlinkQDisc:
+			qDiscs = append(qDiscs, inet.QDisc{
+				Index:   int32(id),
+				Handle:  qDisc.handle,
+				Parent:  linux.TC_H_ROOT,
+				Kind:    qDisc.config.kind(),
+				Options: qDisc.config.options(),
+			})
+		}
+	}
+	slices.SortFunc(qDiscs, func(a, b inet.QDisc) int {
+		return int(a.Index) - int(b.Index)
+	})
+	return qDiscs
+}
@@ -0,0 +1,619 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/marshal"
+	"gvisor.dev/gvisor/pkg/marshal/primitive"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/socket"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// maxSCTPAddrsLen bounds the size of the packed address list passed to
+// SCTP_SOCKOPT_CONNECTX3, which isn't bounded by the setsockopt(2) option
+// length check.
+const maxSCTPAddrsLen = 64 << 10
+
+// sctpIntOptions maps the integer SOL_SCTP options to netstack options.
+var sctpIntOptions = map[int]tcpip.SockOptInt{
+	linux.SCTP_NODELAY:           tcpip.SCTPNoDelayOption,
+	linux.SCTP_AUTOCLOSE:         tcpip.SCTPAutocloseOption,
+	linux.SCTP_DISABLE_FRAGMENTS: tcpip.SCTPDisableFragmentsOption,
+	linux.SCTP_RECVRCVINFO:       tcpip.SCTPRecvRcvInfoOption,
+}
+
+func msToDuration(ms uint32) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+func durationToMS(d time.Duration) uint32 {
+	return uint32(d / time.Millisecond)
+}
+
+// copyInSCTPOpt reads the option value that getsockopt(2) was called with
+// into v. SCTP uses it to pass the association that the option applies to.
+func copyInSCTPOpt(t *kernel.Task, outPtr hostarch.Addr, outLen int, v marshal.Marshallable) *syserr.Error {
+	if outLen < v.SizeBytes() {
+		return syserr.ErrInvalidArgument
+	}
+	if _, err := v.CopyIn(t, outPtr); err != nil {
+		return syserr.FromError(err)
+	}
+	return nil
+}
+
+// parseSCTPAddrs parses a list of packed socket addresses, as passed to the
+// bindx and connectx options.
+func (s *sock) parseSCTPAddrs(buf []byte) ([]tcpip.FullAddress, *syserr.Error) {
+	var addrs []tcpip.FullAddress
+	for len(buf) > 0 {
+		if len(buf) < 2 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var size int
+		switch hostarch.ByteOrder.Uint16(buf) {
+		case linux.AF_INET:
+			size = sockAddrInetSize
+		case linux.AF_INET6:
+			size = sockAddrInet6Size
+		default:
+			return nil, syserr.ErrInvalidArgument
+		}
+		if len(buf) < size {
+			return nil, syserr.ErrInvalidArgument
+		}
+		addr, family, err := socket.AddressAndFamily(buf[:size])
+		if err != nil {
+			return nil, err
+		}
+		if !s.checkFamily(family, false /* exact */) {
+			return nil, syserr.ErrInvalidArgument
+		}
+		addrs = append(addrs, s.mapFamily(addr, family))
+		buf = buf[size:]
+	}
+	if len(addrs) == 0 {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return addrs, nil
+}
+
+// packSCTPAddrs appends addrs to buf as packed socket addresses, failing if
+// they don't fit in space bytes.
+func (s *sock) packSCTPAddrs(buf []byte, addrs []tcpip.FullAddress, space int) ([]byte, *syserr.Error) {
+	for _, addr := range addrs {
+		sa, size := socket.ConvertAddress(s.family, addr)
+		if int(size) > space {
+			return nil, syserr.ErrNoMemory
+		}
+		space -= int(size)
+		buf = append(buf, make([]byte, size)...)
+		sa.MarshalBytes(buf[len(buf)-int(size):])
+	}
+	return buf, nil
+}
+
+// sctpPAddrInfo converts info to its Linux representation.
+func (s *sock) sctpPAddrInfo(info *tcpip.SCTPPeerAddrInfo) linux.SCTPPAddrInfo {
+	out := linux.SCTPPAddrInfo{
+		AssocID: int32(info.AssocID),
+		State:   linux.SCTP_INACTIVE,
+		Cwnd:    info.Cwnd,
+		SRTT:    durationToMS(info.SRTT),
+		RTO:     durationToMS(info.RTO),
+		MTU:     info.MTU,
+	}
+	if info.Active {
+		out.State = linux.SCTP_ACTIVE
+	}
+	sa, _ := socket.ConvertAddress(s.family, info.Addr)
+	sa.MarshalBytes(out.Address[:sa.SizeBytes()])
+	return out
+}
+
+// sctpConnectx starts an association to addrs, waiting for it to be set up
+// if the socket is blocking.
+func (s *sock) sctpConnectx(t *kernel.Task, addrs []tcpip.FullAddress) (tcpip.SCTPAssocID, *syserr.Error) {
+	opt := tcpip.SCTPConnectxOption{Addrs: addrs}
+	if s.vfsfd.StatusFlags()&linux.O_NONBLOCK != 0 {
+		err := s.Endpoint.SetSockOpt(&opt)
+		return opt.AssocID, syserr.TranslateNetstackError(err)
+	}
+
+	e, ch := waiter.NewChannelEntry(waiter.WritableEvents)
+	s.EventRegister(&e)
+	defer s.EventUnregister(&e)
+
+	switch err := s.Endpoint.SetSockOpt(&opt); err.(type) {
+	case *tcpip.ErrConnectStarted:
+	default:
+		return opt.AssocID, syserr.TranslateNetstackError(err)
+	}
+	if err := t.Block(ch); err != nil {
+		return 0, syserr.FromError(err)
+	}
+	// As in Connect, connecting again reports the result.
+	return opt.AssocID, syserr.TranslateNetstackError(s.Endpoint.Connect(addrs[0]))
+}
+
+// sctpPeeloff branches the association id off into a new socket and returns
+// its file descriptor.
+func (s *sock) sctpPeeloff(t *kernel.Task, id int32, flags uint32) (int32, *syserr.Error) {
+	if flags&^(linux.SOCK_CLOEXEC|linux.SOCK_NONBLOCK) != 0 {
+		return 0, syserr.ErrInvalidArgument
+	}
+	opt := tcpip.SCTPPeeloffOption{
+		AssocID:     tcpip.SCTPAssocID(id),
+		WaiterQueue: &waiter.Queue{},
+	}
+	if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+		return 0, syserr.TranslateNetstackError(err)
+	}
+	ns, err := New(t, s.family, linux.SOCK_STREAM, s.protocol, opt.WaiterQueue, opt.Endpoint)
+	if err != nil {
+		opt.Endpoint.Close()
+		return 0, err
+	}
+	defer ns.DecRef(t)
+
+	if err := ns.SetStatusFlags(t, t.Credentials(), flags&linux.SOCK_NONBLOCK); err != nil {
+		return 0, syserr.FromError(err)
+	}
+	fd, e := t.NewFDFrom(0, ns, kernel.FDFlags{
+		CloseOnExec: flags&linux.SOCK_CLOEXEC != 0,
+	})
+	if e != nil {
+		return 0, syserr.FromError(e)
+	}
+	t.Kernel().RecordSocket(ns)
+	return fd, nil
+}
+
+// getSockOptSCTP implements GetSockOpt when level is SOL_SCTP.
+func (s *sock) getSockOptSCTP(t *kernel.Task, name int, outPtr hostarch.Addr, outLen int) (marshal.Marshallable, *syserr.Error) {
+	if opt, ok := sctpIntOptions[name]; ok {
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		v, err := s.Endpoint.GetSockOptInt(opt)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
+	}
+
+	switch name {
+	case linux.SCTP_MAXSEG:
+		v, err := s.Endpoint.GetSockOptInt(tcpip.SCTPMaxSegOption)
+		if err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		// The value is either an int or, preferably, a struct
+		// sctp_assoc_value.
+		var av linux.SCTPAssocValue
+		if outLen >= av.SizeBytes() {
+			if err := copyInSCTPOpt(t, outPtr, outLen, &av); err != nil {
+				return nil, err
+			}
+			av.Value = uint32(v)
+			return &av, nil
+		}
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		vP := primitive.Int32(v)
+		return &vP, nil
+
+	case linux.SCTP_EVENTS:
+		if outLen == 0 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var opt tcpip.SCTPEventsOption
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		var v linux.SCTPEventSubscribe
+		for i := range v.Events {
+			if opt&(1<<i) != 0 {
+				v.Events[i] = 1
+			}
+		}
+		b := primitive.ByteSlice(v.Events[:min(outLen, len(v.Events))])
+		return &b, nil
+
+	case linux.SCTP_INITMSG:
+		var v linux.SCTPInitMsg
+		if outLen < v.SizeBytes() {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var opt tcpip.SCTPInitMsgOption
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		v = linux.SCTPInitMsg{
+			NumOStreams:    opt.NumOStreams,
+			MaxInStreams:   opt.MaxInStreams,
+			MaxAttempts:    opt.MaxAttempts,
+			MaxInitTimeout: uint16(min(durationToMS(opt.MaxInitTimeout), 0xffff)),
+		}
+		return &v, nil
+
+	case linux.SCTP_RTOINFO:
+		var v linux.SCTPRTOInfo
+		if err := copyInSCTPOpt(t, outPtr, outLen, &v); err != nil {
+			return nil, err
+		}
+		opt := tcpip.SCTPRTOInfoOption{AssocID: tcpip.SCTPAssocID(v.AssocID)}
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		v.Initial = durationToMS(opt.Initial)
+		v.Max = durationToMS(opt.Max)
+		v.Min = durationToMS(opt.Min)
+		return &v, nil
+
+	case linux.SCTP_ASSOCINFO:
+		var v linux.SCTPAssocParams
+		if err := copyInSCTPOpt(t, outPtr, outLen, &v); err != nil {
+			return nil, err
+		}
+		opt := tcpip.SCTPAssocInfoOption{AssocID: tcpip.SCTPAssocID(v.AssocID)}
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		v.AssocMaxRxt = opt.MaxRetrans
+		v.NumberPeerDestinations = opt.PeerDestinations
+		v.PeerRwnd = opt.PeerRwnd
+		v.LocalRwnd = opt.LocalRwnd
+		v.CookieLife = durationToMS(opt.CookieLife)
+		return &v, nil
+
+	case linux.SCTP_DEFAULT_SNDINFO:
+		var v linux.SCTPSndInfo
+		if err := copyInSCTPOpt(t, outPtr, outLen, &v); err != nil {
+			return nil, err
+		}
+		var opt tcpip.SCTPDefaultSndInfoOption
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		v.Stream = opt.Stream
+		v.Flags = opt.Flags
+		v.PPID = opt.PPID
+		v.Context = opt.Context
+		return &v, nil
+
+	case linux.SCTP_DEFAULT_SEND_PARAM:
+		var v linux.SCTPSndRcvInfo
+		if err := copyInSCTPOpt(t, outPtr, outLen, &v); err != nil {
+			return nil, err
+		}
+		var opt tcpip.SCTPDefaultSndInfoOption
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		v.Stream = opt.Stream
+		v.Flags = opt.Flags
+		v.PPID = opt.PPID
+		v.Context = opt.Context
+		return &v, nil
+
+	case linux.SCTP_PRIMARY_ADDR:
+		var v linux.SCTPSetPrim
+		if err := copyInSCTPOpt(t, outPtr, outLen, &v); err != nil {
+			return nil, err
+		}
+		opt := tcpip.SCTPPrimaryAddrOption{AssocID: tcpip.SCTPAssocID(v.AssocID)}
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		clear(v.Addr[:])
+		sa, _ := socket.ConvertAddress(s.family, opt.Addr)
+		sa.MarshalBytes(v.Addr[:sa.SizeBytes()])
+		return &v, nil
+
+	case linux.SCTP_STATUS:
+		var v linux.SCTPStatus
+		if err := copyInSCTPOpt(t, outPtr, outLen, &v); err != nil {
+			return nil, err
+		}
+		opt := tcpip.SCTPStatusOption{AssocID: tcpip.SCTPAssocID(v.AssocID)}
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		v = linux.SCTPStatus{
+			AssocID:            int32(opt.AssocID),
+			State:              opt.State,
+			Rwnd:               opt.Rwnd,
+			UnackData:          opt.UnackedData,
+			PendData:           opt.PendingData,
+			InStreams:          opt.InStreams,
+			OutStreams:         opt.OutStreams,
+			FragmentationPoint: opt.FragmentationPoint,
+			Primary:            s.sctpPAddrInfo(&opt.Primary),
+		}
+		return &v, nil
+
+	case linux.SCTP_GET_ASSOC_NUMBER:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var opt tcpip.SCTPAssocIDListOption
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		v := primitive.Uint32(len(opt))
+		return &v, nil
+
+	case linux.SCTP_GET_ASSOC_ID_LIST:
+		if outLen < sizeOfInt32 {
+			return nil, syserr.ErrInvalidArgument
+		}
+		var opt tcpip.SCTPAssocIDListOption
+		if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+			return nil, syserr.TranslateNetstackError(err)
+		}
+		if sizeOfInt32*(1+len(opt)) > outLen {
+			return nil, syserr.ErrInvalidArgument
+		}
+		b := hostarch.ByteOrder.AppendUint32(nil, uint32(len(opt)))
+		for _, id := range opt {
+			b = hostarch.ByteOrder.AppendUint32(b, uint32(id))
+		}
+		bP := primitive.ByteSlice(b)
+		return &bP, nil
+
+	case linux.SCTP_GET_PEER_ADDRS, linux.SCTP_GET_LOCAL_ADDRS:
+		var hdr linux.SCTPGetAddrs
+		if err := copyInSCTPOpt(t, outPtr, outLen, &hdr); err != nil {
+			return nil, err
+		}
+		var addrs []tcpip.FullAddress
+		if name == linux.SCTP_GET_PEER_ADDRS {
+			opt := tcpip.SCTPPeerAddrsOption{AssocID: tcpip.SCTPAssocID(hdr.AssocID)}
+			if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+				return nil, syserr.TranslateNetstackError(err)
+			}
+			addrs = opt.Addrs
+		} else {
+			opt := tcpip.SCTPLocalAddrsOption{AssocID: tcpip.SCTPAssocID(hdr.AssocID)}
+			if err := s.Endpoint.GetSockOpt(&opt); err != nil {
+				return nil, syserr.TranslateNetstackError(err)
+			}
+			addrs = opt.Addrs
+		}
+		hdr.AddrNum = uint32(len(addrs))
+		b := make([]byte, hdr.SizeBytes())
+		hdr.MarshalUnsafe(b)
+		b, err := s.packSCTPAddrs(b, addrs, outLen-hdr.SizeBytes())
+		if err != nil {
+			return nil, err
+		}
+		bP := primitive.ByteSlice(b)
+		return &bP, nil
+
+	case linux.SCTP_SOCKOPT_CONNECTX3:
+		var v linux.SCTPGetAddrsOld
+		if err := copyInSCTPOpt(t, outPtr, outLen, &v); err != nil {
+			return nil, err
+		}
+		if v.AddrNum <= 0 || v.AddrNum > maxSCTPAddrsLen {
+			return nil, syserr.ErrInvalidArgument
+		}
+		buf := make([]byte, v.AddrNum)
+		if _, err := t.CopyInBytes(hostarch.Addr(v.Addrs), buf); err != nil {
+			return nil, syserr.FromError(err)
+		}
+		addrs, err := s.parseSCTPAddrs(buf)
+		if err != nil {
+			return nil, err
+		}
+		id, err := s.sctpConnectx(t, addrs)
+		if err != nil {
+			return nil, err
+		}
+		// Only the association ID is written back.
+		idP := primitive.Int32(id)
+		return &idP, nil
+
+	case linux.SCTP_SOCKOPT_PEELOFF:
+		var v linux.SCTPPeeloffArg
+		if err := copyInSCTPOpt(t, outPtr, outLen, &v); err != nil {
+			return nil, err
+		}
+		fd, err := s.sctpPeeloff(t, v.AssocID, 0 /* flags */)
+		if err != nil {
+			return nil, err
+		}
+		v.SD = fd
+		return &v, nil
+
+	case linux.SCTP_SOCKOPT_PEELOFF_FLAGS:
+		var v linux.SCTPPeeloffFlagsArg
+		if err := copyInSCTPOpt(t, outPtr, outLen, &v); err != nil {
+			return nil, err
+		}
+		fd, err := s.sctpPeeloff(t, v.PArg.AssocID, v.Flags)
+		if err != nil {
+			return nil, err
+		}
+		v.PArg.SD = fd
+		return &v, nil
+	}
+
+	return nil, syserr.ErrProtocolNotAvailable
+}
+
+// setSockOptSCTP implements SetSockOpt when level is SOL_SCTP.
+func (s *sock) setSockOptSCTP(t *kernel.Task, name int, optVal []byte) *syserr.Error {
+	if opt, ok := sctpIntOptions[name]; ok {
+		if len(optVal) < sizeOfInt32 {
+			return syserr.ErrInvalidArgument
+		}
+		v := int32(hostarch.ByteOrder.Uint32(optVal))
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOptInt(opt, int(v)))
+	}
+
+	switch name {
+	case linux.SCTP_MAXSEG:
+		var v int32
+		var av linux.SCTPAssocValue
+		switch {
+		case len(optVal) >= av.SizeBytes():
+			av.UnmarshalUnsafe(optVal)
+			v = int32(av.Value)
+		case len(optVal) >= sizeOfInt32:
+			v = int32(hostarch.ByteOrder.Uint32(optVal))
+		default:
+			return syserr.ErrInvalidArgument
+		}
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOptInt(tcpip.SCTPMaxSegOption, int(v)))
+
+	case linux.SCTP_EVENTS:
+		var v linux.SCTPEventSubscribe
+		if len(optVal) > len(v.Events) {
+			return syserr.ErrInvalidArgument
+		}
+		var opt tcpip.SCTPEventsOption
+		for i, b := range optVal {
+			if b != 0 {
+				opt |= 1 << i
+			}
+		}
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOpt(&opt))
+
+	case linux.SCTP_INITMSG:
+		var v linux.SCTPInitMsg
+		if len(optVal) < v.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		v.UnmarshalUnsafe(optVal)
+		opt := tcpip.SCTPInitMsgOption{
+			NumOStreams:    v.NumOStreams,
+			MaxInStreams:   v.MaxInStreams,
+			MaxAttempts:    v.MaxAttempts,
+			MaxInitTimeout: msToDuration(uint32(v.MaxInitTimeout)),
+		}
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOpt(&opt))
+
+	case linux.SCTP_RTOINFO:
+		var v linux.SCTPRTOInfo
+		if len(optVal) < v.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		v.UnmarshalUnsafe(optVal)
+		opt := tcpip.SCTPRTOInfoOption{
+			AssocID: tcpip.SCTPAssocID(v.AssocID),
+			Initial: msToDuration(v.Initial),
+			Max:     msToDuration(v.Max),
+			Min:     msToDuration(v.Min),
+		}
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOpt(&opt))
+
+	case linux.SCTP_ASSOCINFO:
+		var v linux.SCTPAssocParams
+		if len(optVal) < v.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		v.UnmarshalUnsafe(optVal)
+		opt := tcpip.SCTPAssocInfoOption{
+			AssocID:    tcpip.SCTPAssocID(v.AssocID),
+			MaxRetrans: v.AssocMaxRxt,
+			CookieLife: msToDuration(v.CookieLife),
+		}
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOpt(&opt))
+
+	case linux.SCTP_DEFAULT_SNDINFO:
+		var v linux.SCTPSndInfo
+		if len(optVal) < v.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		v.UnmarshalUnsafe(optVal)
+		opt := tcpip.SCTPDefaultSndInfoOption{
+			Stream:  v.Stream,
+			Flags:   v.Flags,
+			PPID:    v.PPID,
+			Context: v.Context,
+			AssocID: tcpip.SCTPAssocID(v.AssocID),
+		}
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOpt(&opt))
+
+	case linux.SCTP_DEFAULT_SEND_PARAM:
+		var v linux.SCTPSndRcvInfo
+		if len(optVal) < v.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		v.UnmarshalUnsafe(optVal)
+		opt := tcpip.SCTPDefaultSndInfoOption{
+			Stream:  v.Stream,
+			Flags:   v.Flags,
+			PPID:    v.PPID,
+			Context: v.Context,
+			AssocID: tcpip.SCTPAssocID(v.AssocID),
+		}
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOpt(&opt))
+
+	case linux.SCTP_PRIMARY_ADDR:
+		var v linux.SCTPSetPrim
+		if len(optVal) < v.SizeBytes() {
+			return syserr.ErrInvalidArgument
+		}
+		v.UnmarshalUnsafe(optVal)
+		addr, family, err := socket.AddressAndFamily(v.Addr[:])
+		if err != nil {
+			return err
+		}
+		if !s.checkFamily(family, false /* exact */) {
+			return syserr.ErrInvalidArgument
+		}
+		opt := tcpip.SCTPPrimaryAddrOption{
+			AssocID: tcpip.SCTPAssocID(v.AssocID),
+			Addr:    s.mapFamily(addr, family),
+		}
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOpt(&opt))
+
+	case linux.SCTP_SOCKOPT_BINDX_ADD, linux.SCTP_SOCKOPT_BINDX_REM:
+		addrs, err := s.parseSCTPAddrs(optVal)
+		if err != nil {
+			return err
+		}
+		opt := tcpip.SCTPBindxOption{
+			Remove: name == linux.SCTP_SOCKOPT_BINDX_REM,
+			Addrs:  addrs,
+		}
+		return syserr.TranslateNetstackError(s.Endpoint.SetSockOpt(&opt))
+
+	case linux.SCTP_SOCKOPT_CONNECTX, linux.SCTP_SOCKOPT_CONNECTX_OLD:
+		// Linux returns the association ID from setsockopt(2) for
+		// SCTP_SOCKOPT_CONNECTX, which setsockopt(2) can't do here;
+		// SCTP_SOCKOPT_CONNECTX3 reports it instead.
+		addrs, err := s.parseSCTPAddrs(optVal)
+		if err != nil {
+			return err
+		}
+		_, err = s.sctpConnectx(t, addrs)
+		return err
+	}
+
+	return syserr.ErrProtocolNotAvailable
+}
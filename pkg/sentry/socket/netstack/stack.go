@@ -16,6 +16,7 @@ package netstack
 
 import (
 	"fmt"
+	"slices"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
@@ -74,6 +75,12 @@ func toLinuxARPHardwareType(t header.ARPHardwareType) uint16 {
 		return linux.ARPHRD_LOOPBACK
 	case header.ARPHardwareEther:
 		return linux.ARPHRD_ETHER
+	case header.ARPHardwareTunnel:
+		return linux.ARPHRD_TUNNEL
+	case header.ARPHardwareSIT:
+		return linux.ARPHRD_SIT
+	case header.ARPHardwareIPGRE:
+		return linux.ARPHRD_IPGRE
 	default:
 		panic(fmt.Sprintf("unknown ARPHRD type: %d", t))
 	}
@@ -89,6 +96,7 @@ func (s *Stack) Interfaces() map[int32]inet.Interface {
 			Flags:      uint32(nicStateFlagsToLinux(ni.Flags)),
 			DeviceType: toLinuxARPHardwareType(ni.ARPHardwareType),
 			MTU:        ni.MTU,
+			Kind:       linkKind(ni.Context),
 		}
 	}
 	return is
@@ -381,6 +389,14 @@ func (s *Stack) newInterface(ctx context.Context, msg *nlmsg.Message, linkAttrs
 		return s.newBridge(ctx, linkAttrs, linkInfoAttrs)
 	case "veth":
 		return s.newVeth(ctx, linkAttrs, linkInfoAttrs)
+	case "ipip", "sit":
+		return s.newIPTunnel(ctx, kind, linkAttrs, linkInfoAttrs)
+	case "gre", "gretap", "ip6gre", "ip6gretap":
+		return s.newGRETunnel(ctx, kind, linkAttrs, linkInfoAttrs)
+	case "vxlan":
+		return s.newVXLAN(ctx, linkAttrs, linkInfoAttrs)
+	case "wireguard":
+		return s.newWireGuard(ctx, linkAttrs)
 	}
 	return syserr.ErrNotSupported
 }
@@ -583,6 +599,61 @@ func (s *Stack) SetTCPRecovery(recovery inet.TCPLossRecovery) error {
 	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
 }
 
+// TCPECN implements inet.Stack.TCPECN.
+func (s *Stack) TCPECN() (int32, error) {
+	var ecn tcpip.TCPECNOption
+	if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &ecn); err != nil {
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+	return int32(ecn), nil
+}
+
+// SetTCPECN implements inet.Stack.SetTCPECN.
+func (s *Stack) SetTCPECN(mode int32) error {
+	opt := tcpip.TCPECNOption(mode)
+	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
+}
+
+// TCPFastOpen implements inet.Stack.TCPFastOpen.
+func (s *Stack) TCPFastOpen() (int32, error) {
+	var fastOpen tcpip.TCPFastOpenOption
+	if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &fastOpen); err != nil {
+		return 0, syserr.TranslateNetstackError(err).ToError()
+	}
+	return int32(fastOpen), nil
+}
+
+// SetTCPFastOpen implements inet.Stack.SetTCPFastOpen.
+func (s *Stack) SetTCPFastOpen(mode int32) error {
+	opt := tcpip.TCPFastOpenOption(mode)
+	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
+}
+
+// TCPAvailableCongestionControl implements
+// inet.Stack.TCPAvailableCongestionControl.
+func (s *Stack) TCPAvailableCongestionControl() (string, error) {
+	var avail tcpip.TCPAvailableCongestionControlOption
+	if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &avail); err != nil {
+		return "", syserr.TranslateNetstackError(err).ToError()
+	}
+	return string(avail), nil
+}
+
+// TCPCongestionControl implements inet.Stack.TCPCongestionControl.
+func (s *Stack) TCPCongestionControl() (string, error) {
+	var cc tcpip.CongestionControlOption
+	if err := s.Stack.TransportProtocolOption(tcp.ProtocolNumber, &cc); err != nil {
+		return "", syserr.TranslateNetstackError(err).ToError()
+	}
+	return string(cc), nil
+}
+
+// SetTCPCongestionControl implements inet.Stack.SetTCPCongestionControl.
+func (s *Stack) SetTCPCongestionControl(name string) error {
+	opt := tcpip.CongestionControlOption(name)
+	return syserr.TranslateNetstackError(s.Stack.SetTransportProtocolOption(tcp.ProtocolNumber, &opt)).ToError()
+}
+
 // Statistics implements inet.Stack.Statistics.
 func (s *Stack) Statistics(stat any, arg string) error {
 	switch stats := stat.(type) {
@@ -743,6 +814,8 @@ func (s *Stack) RouteTable() []inet.Route {
 			DstAddr:         dstAddr.AsSlice(),
 			OutputInterface: int32(rt.NIC),
 			GatewayAddr:     rt.Gateway.AsSlice(),
+			Table:           rt.EffectiveTable(),
+			Priority:        rt.Metric,
 		})
 	}
 
@@ -762,7 +835,7 @@ func (s *Stack) localRoute(msg *nlmsg.Message) (tcpip.Route, *syserr.Error) {
 		DstLen:   rtMsg.DstLen,
 		SrcLen:   rtMsg.SrcLen,
 		TOS:      rtMsg.TOS,
-		Table:    rtMsg.Table,
+		Table:    uint32(rtMsg.Table),
 		Protocol: rtMsg.Protocol,
 		Scope:    rtMsg.Scope,
 		Type:     rtMsg.Type,
@@ -803,6 +876,19 @@ func (s *Stack) localRoute(msg *nlmsg.Message) (tcpip.Route, *syserr.Error) {
 			}
 			route.GatewayAddr = value
 		case linux.RTA_PRIORITY:
+			v := nlmsg.BytesView(value)
+			priority, ok := v.Uint32()
+			if !ok {
+				return tcpip.Route{}, syserr.ErrInvalidArgument
+			}
+			route.Priority = priority
+		case linux.RTA_TABLE:
+			v := nlmsg.BytesView(value)
+			table, ok := v.Uint32()
+			if !ok {
+				return tcpip.Route{}, syserr.ErrInvalidArgument
+			}
+			route.Table = table
 		default:
 			log.Warningf("Unknown attribute: %v", ahdr.Type)
 			return tcpip.Route{}, syserr.ErrNotSupported
@@ -840,6 +926,8 @@ func (s *Stack) localRoute(msg *nlmsg.Message) (tcpip.Route, *syserr.Error) {
 		Destination: dest,
 		Gateway:     tcpip.AddrFromSlice(route.GatewayAddr),
 		NIC:         tcpip.NICID(route.OutputInterface),
+		Table:       route.Table,
+		Metric:      route.Priority,
 	}
 
 	if len(route.SrcAddr) != 0 {
@@ -864,6 +952,12 @@ func (s *Stack) RemoveRoute(ctx context.Context, msg *nlmsg.Message) *syserr.Err
 		if localRoute.NIC > 0 && localRoute.NIC != rt.NIC {
 			return false
 		}
+		if localRoute.Metric > 0 && localRoute.Metric != rt.Metric {
+			return false
+		}
+		if localRoute.EffectiveTable() != rt.EffectiveTable() {
+			return false
+		}
 		return rt.Destination.Equal(localRoute.Destination)
 	}); removed == 0 {
 		return syserr.ErrNoProcess
@@ -897,6 +991,272 @@ func (s *Stack) NewRoute(ctx context.Context, msg *nlmsg.Message) *syserr.Error
 	return nil
 }
 
+// RuleTable implements inet.Stack.RuleTable.
+func (s *Stack) RuleTable() []inet.Rule {
+	var rules []inet.Rule
+	for _, r := range s.Stack.GetRules() {
+		var family uint8
+		switch r.NetProto {
+		case ipv4.ProtocolNumber:
+			family = linux.AF_INET
+		case ipv6.ProtocolNumber:
+			family = linux.AF_INET6
+		default:
+			continue
+		}
+		rule := inet.Rule{
+			Family:          family,
+			TOS:             r.TOS,
+			Action:          ruleActionToLinux[r.Action],
+			Table:           r.Table,
+			Priority:        r.Priority,
+			Mark:            r.Mark,
+			MarkMask:        r.MarkMask,
+			InputInterface:  r.InputInterface,
+			OutputInterface: r.OutputInterface,
+			HasUIDRange:     r.HasUIDRange,
+			UIDRange: linux.FibRuleUIDRange{
+				Start: r.UIDStart,
+				End:   r.UIDEnd,
+			},
+		}
+		if r.Invert {
+			rule.Flags |= linux.FIB_RULE_INVERT
+		}
+		if prefix := r.Source.Prefix(); prefix != 0 {
+			src := r.Source.ID()
+			rule.SrcLen = uint8(prefix)
+			rule.SrcAddr = src.AsSlice()
+		}
+		if prefix := r.Destination.Prefix(); prefix != 0 {
+			dst := r.Destination.ID()
+			rule.DstLen = uint8(prefix)
+			rule.DstAddr = dst.AsSlice()
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+var ruleActionToLinux = map[tcpip.RuleAction]uint8{
+	tcpip.RuleActionLookup:      linux.FR_ACT_TO_TBL,
+	tcpip.RuleActionBlackhole:   linux.FR_ACT_BLACKHOLE,
+	tcpip.RuleActionUnreachable: linux.FR_ACT_UNREACHABLE,
+	tcpip.RuleActionProhibit:    linux.FR_ACT_PROHIBIT,
+}
+
+// ruleSelectors records which selectors of a rule are set by a netlink
+// message, as RTM_DELRULE only compares those.
+type ruleSelectors struct {
+	action   bool
+	table    bool
+	priority bool
+	mark     bool
+	markMask bool
+	uidRange bool
+	src      bool
+	dst      bool
+	iif      bool
+	oif      bool
+}
+
+// parseRule constructs a policy routing rule from the netlink message.
+func parseRule(msg *nlmsg.Message) (tcpip.Rule, ruleSelectors, *syserr.Error) {
+	var hdr linux.FibRuleHdr
+	attrs, ok := msg.GetData(&hdr)
+	if !ok {
+		return tcpip.Rule{}, ruleSelectors{}, syserr.ErrInvalidArgument
+	}
+
+	var (
+		rule    tcpip.Rule
+		sel     ruleSelectors
+		addrLen int
+	)
+	switch hdr.Family {
+	case linux.AF_INET:
+		rule.NetProto = ipv4.ProtocolNumber
+		addrLen = header.IPv4AddressSize
+	case linux.AF_INET6:
+		rule.NetProto = ipv6.ProtocolNumber
+		addrLen = header.IPv6AddressSize
+	default:
+		return tcpip.Rule{}, ruleSelectors{}, syserr.ErrAddressFamilyNotSupported
+	}
+
+	switch hdr.Action {
+	case linux.FR_ACT_UNSPEC:
+	case linux.FR_ACT_TO_TBL:
+		rule.Action = tcpip.RuleActionLookup
+	case linux.FR_ACT_BLACKHOLE:
+		rule.Action = tcpip.RuleActionBlackhole
+	case linux.FR_ACT_UNREACHABLE:
+		rule.Action = tcpip.RuleActionUnreachable
+	case linux.FR_ACT_PROHIBIT:
+		rule.Action = tcpip.RuleActionProhibit
+	default:
+		return tcpip.Rule{}, ruleSelectors{}, syserr.ErrNotSupported
+	}
+	sel.action = hdr.Action != linux.FR_ACT_UNSPEC
+	rule.Table = uint32(hdr.Table)
+	sel.table = hdr.Table != linux.RT_TABLE_UNSPEC
+	rule.TOS = hdr.TOS
+	rule.Invert = hdr.Flags&linux.FIB_RULE_INVERT != 0
+
+	for !attrs.Empty() {
+		ahdr, value, rest, ok := attrs.ParseFirst()
+		if !ok {
+			return tcpip.Rule{}, ruleSelectors{}, syserr.ErrInvalidArgument
+		}
+		attrs = rest
+
+		v := nlmsg.BytesView(value)
+		switch ahdr.Type {
+		case linux.FRA_SRC, linux.FRA_DST:
+			prefixLen := int(hdr.SrcLen)
+			if ahdr.Type == linux.FRA_DST {
+				prefixLen = int(hdr.DstLen)
+			}
+			if len(value) != addrLen || prefixLen > addrLen*8 {
+				return tcpip.Rule{}, ruleSelectors{}, syserr.ErrInvalidArgument
+			}
+			subnet := tcpip.AddressWithPrefix{
+				Address:   tcpip.AddrFromSlice(value),
+				PrefixLen: prefixLen,
+			}.Subnet()
+			if ahdr.Type == linux.FRA_SRC {
+				rule.Source, sel.src = subnet, true
+			} else {
+				rule.Destination, sel.dst = subnet, true
+			}
+		case linux.FRA_IIFNAME:
+			rule.InputInterface, sel.iif = v.String(), true
+		case linux.FRA_OIFNAME:
+			rule.OutputInterface, sel.oif = v.String(), true
+		case linux.FRA_PRIORITY, linux.FRA_FWMARK, linux.FRA_FWMASK, linux.FRA_TABLE:
+			val, ok := v.Uint32()
+			if !ok {
+				return tcpip.Rule{}, ruleSelectors{}, syserr.ErrInvalidArgument
+			}
+			switch ahdr.Type {
+			case linux.FRA_PRIORITY:
+				rule.Priority, sel.priority = val, true
+			case linux.FRA_FWMARK:
+				rule.Mark, sel.mark = val, true
+			case linux.FRA_FWMASK:
+				rule.MarkMask, sel.markMask = val, true
+			case linux.FRA_TABLE:
+				rule.Table, sel.table = val, val != linux.RT_TABLE_UNSPEC
+			}
+		case linux.FRA_UID_RANGE:
+			var uidRange linux.FibRuleUIDRange
+			if len(value) != uidRange.SizeBytes() {
+				return tcpip.Rule{}, ruleSelectors{}, syserr.ErrInvalidArgument
+			}
+			uidRange.UnmarshalUnsafe(value)
+			if uidRange.Start > uidRange.End {
+				return tcpip.Rule{}, ruleSelectors{}, syserr.ErrInvalidArgument
+			}
+			rule.HasUIDRange, sel.uidRange = true, true
+			rule.UIDStart = uidRange.Start
+			rule.UIDEnd = uidRange.End
+		case linux.FRA_PROTOCOL:
+			// The origin of the rule is not tracked.
+		default:
+			log.Warningf("Unknown rule attribute: %v", ahdr.Type)
+			return tcpip.Rule{}, ruleSelectors{}, syserr.ErrNotSupported
+		}
+	}
+	if (hdr.SrcLen != 0 && !sel.src) || (hdr.DstLen != 0 && !sel.dst) {
+		return tcpip.Rule{}, ruleSelectors{}, syserr.ErrInvalidArgument
+	}
+	// A mark without a mask matches the whole mark, as in Linux's
+	// net/core/fib_rules.c:fib_nl2rule().
+	if !sel.markMask && rule.Mark != 0 {
+		rule.MarkMask = 0xffffffff
+	}
+	return rule, sel, nil
+}
+
+// NewRule implements inet.Stack.NewRule.
+func (s *Stack) NewRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	rule, sel, err := parseRule(msg)
+	if err != nil {
+		return err
+	}
+	if !sel.action {
+		return syserr.ErrInvalidArgument
+	}
+	if rule.Action == tcpip.RuleActionLookup && rule.Table == tcpip.RouteTableUnspec {
+		return syserr.ErrInvalidArgument
+	}
+	rules := s.Stack.GetRules()
+	if !sel.priority {
+		// Place the rule before the second rule of the family, as in Linux's
+		// net/core/fib_rules.c:fib_default_rule_pref().
+		n := 0
+		for _, r := range rules {
+			if r.NetProto != rule.NetProto {
+				continue
+			}
+			if n++; n == 2 {
+				if r.Priority > 0 {
+					rule.Priority = r.Priority - 1
+				}
+				break
+			}
+		}
+	}
+	if msg.Header().Flags&linux.NLM_F_EXCL != 0 && slices.Contains(rules, rule) {
+		return syserr.ErrExists
+	}
+	s.Stack.AddRule(rule)
+	return nil
+}
+
+// RemoveRule implements inet.Stack.RemoveRule.
+func (s *Stack) RemoveRule(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	rule, sel, err := parseRule(msg)
+	if err != nil {
+		return err
+	}
+	// Only the first matching rule is removed, as in Linux.
+	removed := false
+	if s.Stack.RemoveRules(func(r tcpip.Rule) bool {
+		switch {
+		case removed, r.NetProto != rule.NetProto:
+			return false
+		case sel.action && r.Action != rule.Action:
+			return false
+		case sel.table && r.Table != rule.Table:
+			return false
+		case sel.priority && r.Priority != rule.Priority:
+			return false
+		case sel.mark && r.Mark != rule.Mark:
+			return false
+		case sel.markMask && r.MarkMask != rule.MarkMask:
+			return false
+		case sel.src && r.Source != rule.Source:
+			return false
+		case sel.dst && r.Destination != rule.Destination:
+			return false
+		case sel.iif && r.InputInterface != rule.InputInterface:
+			return false
+		case sel.oif && r.OutputInterface != rule.OutputInterface:
+			return false
+		case sel.uidRange && (!r.HasUIDRange || r.UIDStart != rule.UIDStart || r.UIDEnd != rule.UIDEnd):
+			return false
+		case rule.TOS != 0 && r.TOS != rule.TOS:
+			return false
+		}
+		removed = true
+		return true
+	}) == 0 {
+		return syserr.ErrNoFileOrDir
+	}
+	return nil
+}
+
 // IPTables returns the stack's iptables.
 func (s *Stack) IPTables() (*stack.IPTables, error) {
 	return s.Stack.IPTables(), nil
@@ -922,6 +1282,11 @@ func (s *Stack) RegisteredEndpoints() []stack.TransportEndpoint {
 	return s.Stack.RegisteredEndpoints()
 }
 
+// ConntrackEntries implements inet.Stack.ConntrackEntries.
+func (s *Stack) ConntrackEntries() []stack.ConntrackEntry {
+	return s.Stack.IPTables().ConntrackEntries(stack.ConntrackFilter{}, false /* zeroCounters */)
+}
+
 // CleanupEndpoints implements inet.Stack.CleanupEndpoints.
 func (s *Stack) CleanupEndpoints() []stack.TransportEndpoint {
 	return s.Stack.CleanupEndpoints()
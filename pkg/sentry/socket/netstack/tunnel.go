@@ -0,0 +1,546 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/link/packetsocket"
+	"gvisor.dev/gvisor/pkg/tcpip/link/tunnel"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// linkInfoData parses the IFLA_INFO_DATA attributes of linkInfoAttrs.
+func linkInfoData(linkInfoAttrs map[uint16]nlmsg.BytesView) (map[uint16]nlmsg.BytesView, *syserr.Error) {
+	value, ok := linkInfoAttrs[linux.IFLA_INFO_DATA]
+	if !ok {
+		return nil, nil
+	}
+	attrs, ok := nlmsg.AttrsView(value).Parse()
+	if !ok {
+		return nil, syserr.ErrInvalidArgument
+	}
+	return attrs, nil
+}
+
+// isZero returns true if the value of an attribute is all zeroes. Options that
+// netstack tunnels don't support are accepted if they are disabled.
+func isZero(v nlmsg.BytesView) bool {
+	for _, b := range v {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseUint8 parses a u8 attribute.
+func parseUint8(v nlmsg.BytesView) (uint8, bool) {
+	if len(v) != 1 {
+		return 0, false
+	}
+	return v[0], true
+}
+
+// parseBE16 parses a u16 attribute in network byte order.
+func parseBE16(v nlmsg.BytesView) (uint16, bool) {
+	if len(v) != 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(v), true
+}
+
+// parseBE32 parses a u32 attribute in network byte order.
+func parseBE32(v nlmsg.BytesView) (uint32, bool) {
+	if len(v) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(v), true
+}
+
+// parseUnderlayAddr parses a tunnel address attribute of the given size. The
+// unspecified address is returned as the empty address.
+func parseUnderlayAddr(v nlmsg.BytesView, size int) (tcpip.Address, bool) {
+	if len(v) != size {
+		return tcpip.Address{}, false
+	}
+	if isZero(v) {
+		return tcpip.Address{}, true
+	}
+	return tcpip.AddrFromSlice(v), true
+}
+
+// parseUnderlayLink parses the underlay link of a tunnel.
+func (s *Stack) parseUnderlayLink(v nlmsg.BytesView) (tcpip.NICID, *syserr.Error) {
+	link, ok := v.Uint32()
+	if !ok {
+		return 0, syserr.ErrInvalidArgument
+	}
+	if link != 0 && !s.Stack.HasNIC(tcpip.NICID(link)) {
+		return 0, syserr.ErrNoDevice
+	}
+	return tcpip.NICID(link), nil
+}
+
+// newTunnelNIC creates a NIC for the tunnel endpoint ep. Endpoints of tunnels
+// carrying Ethernet frames are wrapped by an ethernet endpoint.
+func (s *Stack) newTunnelNIC(ctx context.Context, kind string, ep stack.LinkEndpoint, ethernetFrames bool, linkAttrs map[uint16]nlmsg.BytesView) *syserr.Error {
+	ifname := ""
+	if v, ok := linkAttrs[linux.IFLA_IFNAME]; ok {
+		ifname = v.String()
+	}
+	id := s.Stack.NextNICID()
+	if ifname == "" {
+		ifname = fmt.Sprintf("%s%d", kind, id)
+	}
+	linkEP := ep
+	if ethernetFrames {
+		linkEP = ethernet.New(ep)
+	}
+	// The tunnel endpoint is kept in the NIC context, so that the
+	// forwarding database of VXLAN tunnels can be found by interface.
+	err := s.Stack.CreateNICWithOptions(id, packetsocket.New(linkEP), stack.NICOptions{
+		Name:    ifname,
+		Context: ep,
+	})
+	if err != nil {
+		ep.Close()
+		return syserr.TranslateNetstackError(err)
+	}
+	if err := s.setLink(ctx, id, linkAttrs); err != nil {
+		// Removing the NIC closes the tunnel.
+		s.Stack.RemoveNIC(id)
+		return err
+	}
+	return nil
+}
+
+// newIPTunnel creates an ipip or sit interface.
+func (s *Stack) newIPTunnel(ctx context.Context, kind string, linkAttrs map[uint16]nlmsg.BytesView, linkInfoAttrs map[uint16]nlmsg.BytesView) *syserr.Error {
+	opts := tunnel.Options{
+		Config: tunnel.Config{
+			Stack:    s.Stack,
+			NetProto: header.IPv4ProtocolNumber,
+		},
+		Kind: tunnel.KindIPIP,
+	}
+	proto := uint8(linux.IPPROTO_IPIP)
+	if kind == "sit" {
+		opts.Kind = tunnel.KindSIT
+		proto = linux.IPPROTO_IPV6
+	}
+	data, err := linkInfoData(linkInfoAttrs)
+	if err != nil {
+		return err
+	}
+	for attr, v := range data {
+		var ok bool
+		switch attr {
+		case linux.IFLA_IPTUN_LINK:
+			if opts.Link, err = s.parseUnderlayLink(v); err != nil {
+				return err
+			}
+			ok = true
+		case linux.IFLA_IPTUN_LOCAL:
+			opts.Local, ok = parseUnderlayAddr(v, header.IPv4AddressSize)
+		case linux.IFLA_IPTUN_REMOTE:
+			opts.Remote, ok = parseUnderlayAddr(v, header.IPv4AddressSize)
+		case linux.IFLA_IPTUN_TTL:
+			opts.TTL, ok = parseUint8(v)
+		case linux.IFLA_IPTUN_TOS:
+			opts.TOS, ok = parseUint8(v)
+		case linux.IFLA_IPTUN_PROTO:
+			var p uint8
+			p, ok = parseUint8(v)
+			if ok && p != 0 && p != proto {
+				// sit tunnels can't carry IPv4 packets, like ipip
+				// tunnels can't carry anything else.
+				return syserr.ErrNotSupported
+			}
+		case linux.IFLA_IPTUN_PMTUDISC:
+			// Path MTU discovery is always enabled.
+			ok = true
+		default:
+			if !isZero(v) {
+				ctx.Warningf("unsupported %s attribute: %d", kind, attr)
+				return syserr.ErrNotSupported
+			}
+			ok = true
+		}
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+
+	ep, tcpipErr := tunnel.New(opts)
+	if tcpipErr != nil {
+		return syserr.TranslateNetstackError(tcpipErr)
+	}
+	return s.newTunnelNIC(ctx, kind, ep, false /* ethernetFrames */, linkAttrs)
+}
+
+// parseGREFlags parses the IFLA_GRE_IFLAGS and IFLA_GRE_OFLAGS attributes,
+// which contain GRE header flags.
+func parseGREFlags(v nlmsg.BytesView) (key, csum bool, err *syserr.Error) {
+	flags, ok := parseBE16(v)
+	if !ok {
+		return false, false, syserr.ErrInvalidArgument
+	}
+	if flags&^(linux.GRE_KEY|linux.GRE_CSUM) != 0 {
+		// Sequence numbers and the obsolete source routing aren't
+		// supported.
+		return false, false, syserr.ErrNotSupported
+	}
+	return flags&linux.GRE_KEY != 0, flags&linux.GRE_CSUM != 0, nil
+}
+
+// newGRETunnel creates a gre, gretap, ip6gre or ip6gretap interface.
+func (s *Stack) newGRETunnel(ctx context.Context, kind string, linkAttrs map[uint16]nlmsg.BytesView, linkInfoAttrs map[uint16]nlmsg.BytesView) *syserr.Error {
+	opts := tunnel.Options{
+		Config: tunnel.Config{
+			Stack:    s.Stack,
+			NetProto: header.IPv4ProtocolNumber,
+		},
+		Kind: tunnel.KindGRE,
+	}
+	addrSize := header.IPv4AddressSize
+	if kind == "ip6gre" || kind == "ip6gretap" {
+		opts.NetProto = header.IPv6ProtocolNumber
+		addrSize = header.IPv6AddressSize
+	}
+	if kind == "gretap" || kind == "ip6gretap" {
+		opts.Kind = tunnel.KindGRETap
+	}
+	data, err := linkInfoData(linkInfoAttrs)
+	if err != nil {
+		return err
+	}
+	for attr, v := range data {
+		var ok bool
+		switch attr {
+		case linux.IFLA_GRE_LINK:
+			if opts.Link, err = s.parseUnderlayLink(v); err != nil {
+				return err
+			}
+			ok = true
+		case linux.IFLA_GRE_IFLAGS:
+			if opts.InputKey.Present, opts.InputChecksum, err = parseGREFlags(v); err != nil {
+				return err
+			}
+			ok = true
+		case linux.IFLA_GRE_OFLAGS:
+			if opts.OutputKey.Present, opts.OutputChecksum, err = parseGREFlags(v); err != nil {
+				return err
+			}
+			ok = true
+		case linux.IFLA_GRE_IKEY:
+			opts.InputKey.Key, ok = parseBE32(v)
+		case linux.IFLA_GRE_OKEY:
+			opts.OutputKey.Key, ok = parseBE32(v)
+		case linux.IFLA_GRE_LOCAL:
+			opts.Local, ok = parseUnderlayAddr(v, addrSize)
+		case linux.IFLA_GRE_REMOTE:
+			opts.Remote, ok = parseUnderlayAddr(v, addrSize)
+		case linux.IFLA_GRE_TTL:
+			opts.TTL, ok = parseUint8(v)
+		case linux.IFLA_GRE_TOS:
+			opts.TOS, ok = parseUint8(v)
+		case linux.IFLA_GRE_PMTUDISC, linux.IFLA_GRE_ENCAP_LIMIT:
+			// Path MTU discovery is always enabled, and the tunnel
+			// encapsulation limit option is never sent.
+			ok = true
+		case linux.IFLA_GRE_COLLECT_METADATA:
+			// This is a flag, enabled by its presence.
+			return syserr.ErrNotSupported
+		default:
+			if !isZero(v) {
+				ctx.Warningf("unsupported %s attribute: %d", kind, attr)
+				return syserr.ErrNotSupported
+			}
+			ok = true
+		}
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+	// Like on Linux, keys are ignored unless enabled by the flags.
+	if !opts.InputKey.Present {
+		opts.InputKey.Key = 0
+	}
+	if !opts.OutputKey.Present {
+		opts.OutputKey.Key = 0
+	}
+
+	ep, tcpipErr := tunnel.New(opts)
+	if tcpipErr != nil {
+		return syserr.TranslateNetstackError(tcpipErr)
+	}
+	return s.newTunnelNIC(ctx, kind, ep, opts.Kind == tunnel.KindGRETap, linkAttrs)
+}
+
+// newVXLAN creates a vxlan interface.
+func (s *Stack) newVXLAN(ctx context.Context, linkAttrs map[uint16]nlmsg.BytesView, linkInfoAttrs map[uint16]nlmsg.BytesView) *syserr.Error {
+	opts := tunnel.VXLANOptions{
+		Config: tunnel.Config{
+			Stack: s.Stack,
+		},
+		// Learning is enabled by default, as on Linux.
+		Learning: true,
+	}
+	data, err := linkInfoData(linkInfoAttrs)
+	if err != nil {
+		return err
+	}
+	hasVNI := false
+	for attr, v := range data {
+		var ok bool
+		switch attr {
+		case linux.IFLA_VXLAN_ID:
+			opts.VNI, ok = v.Uint32()
+			hasVNI = true
+		case linux.IFLA_VXLAN_GROUP:
+			opts.Remote, ok = parseUnderlayAddr(v, header.IPv4AddressSize)
+		case linux.IFLA_VXLAN_GROUP6:
+			opts.Remote, ok = parseUnderlayAddr(v, header.IPv6AddressSize)
+		case linux.IFLA_VXLAN_LOCAL:
+			opts.Local, ok = parseUnderlayAddr(v, header.IPv4AddressSize)
+		case linux.IFLA_VXLAN_LOCAL6:
+			opts.Local, ok = parseUnderlayAddr(v, header.IPv6AddressSize)
+		case linux.IFLA_VXLAN_LINK:
+			if opts.Link, err = s.parseUnderlayLink(v); err != nil {
+				return err
+			}
+			ok = true
+		case linux.IFLA_VXLAN_TTL:
+			opts.TTL, ok = parseUint8(v)
+		case linux.IFLA_VXLAN_TOS:
+			opts.TOS, ok = parseUint8(v)
+		case linux.IFLA_VXLAN_LEARNING:
+			var learning uint8
+			learning, ok = parseUint8(v)
+			opts.Learning = learning != 0
+		case linux.IFLA_VXLAN_AGEING:
+			var ageing uint32
+			ageing, ok = v.Uint32()
+			opts.Ageing = time.Duration(ageing) * time.Second
+		case linux.IFLA_VXLAN_PORT_RANGE:
+			// struct ifla_vxlan_port_range contains two ports in
+			// network byte order.
+			if len(v) != 4 {
+				break
+			}
+			opts.SourcePortLow = binary.BigEndian.Uint16(v[:2])
+			opts.SourcePortHigh = binary.BigEndian.Uint16(v[2:])
+			ok = true
+		case linux.IFLA_VXLAN_PORT:
+			opts.Port, ok = parseBE16(v)
+		case linux.IFLA_VXLAN_UDP_CSUM:
+			var csum uint8
+			csum, ok = parseUint8(v)
+			opts.UDPChecksum = csum != 0
+		case linux.IFLA_VXLAN_LIMIT, linux.IFLA_VXLAN_DF:
+			// The FDB size isn't limited, and the DF bit is never set.
+			ok = true
+		case linux.IFLA_VXLAN_GBP, linux.IFLA_VXLAN_GPE,
+			linux.IFLA_VXLAN_COLLECT_METADATA, linux.IFLA_VXLAN_REMCSUM_NOPARTIAL,
+			linux.IFLA_VXLAN_TTL_INHERIT:
+			// These are flags, enabled by their presence.
+			return syserr.ErrNotSupported
+		default:
+			if !isZero(v) {
+				ctx.Warningf("unsupported vxlan attribute: %d", attr)
+				return syserr.ErrNotSupported
+			}
+			ok = true
+		}
+		if !ok {
+			return syserr.ErrInvalidArgument
+		}
+	}
+	if !hasVNI {
+		return syserr.ErrInvalidArgument
+	}
+	if opts.Local.Len() != 0 && opts.Remote.Len() != 0 && opts.Local.Len() != opts.Remote.Len() {
+		return syserr.ErrInvalidArgument
+	}
+
+	ep, tcpipErr := tunnel.NewVXLAN(opts)
+	if tcpipErr != nil {
+		return syserr.TranslateNetstackError(tcpipErr)
+	}
+	return s.newTunnelNIC(ctx, "vxlan", ep, true /* ethernetFrames */, linkAttrs)
+}
+
+// FDB implements inet.Stack.FDB.
+func (s *Stack) FDB() []inet.FDBEntry {
+	var entries []inet.FDBEntry
+	for id, ni := range s.Stack.NICInfo() {
+		ep, ok := ni.Context.(*tunnel.VXLANEndpoint)
+		if !ok {
+			continue
+		}
+		for _, e := range ep.FDB() {
+			state := uint16(linux.NUD_REACHABLE)
+			if e.Permanent {
+				state = linux.NUD_PERMANENT
+			}
+			port := e.Port
+			if port == 0 {
+				port = ep.Port()
+			}
+			vni := e.VNI
+			if vni == 0 {
+				vni = ep.VNI()
+			}
+			entries = append(entries, inet.FDBEntry{
+				Index:    int32(id),
+				State:    state,
+				Flags:    linux.NTF_SELF,
+				LinkAddr: []byte(e.LinkAddress),
+				DstAddr:  e.Remote.AsSlice(),
+				Port:     port,
+				VNI:      vni,
+			})
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b inet.FDBEntry) int {
+		return int(a.Index) - int(b.Index)
+	})
+	return entries
+}
+
+// parseFDBEntry parses an RTM_NEWNEIGH or RTM_DELNEIGH request for the
+// forwarding database of a VXLAN interface.
+func (s *Stack) parseFDBEntry(msg *nlmsg.Message) (*tunnel.VXLANEndpoint, tunnel.FDBEntry, *linux.NeighborMessage, *syserr.Error) {
+	var ndm linux.NeighborMessage
+	attrsView, ok := msg.GetData(&ndm)
+	if !ok {
+		return nil, tunnel.FDBEntry{}, nil, syserr.ErrInvalidArgument
+	}
+	if ndm.Family != linux.AF_BRIDGE {
+		// The neighbor tables of netstack aren't exposed.
+		return nil, tunnel.FDBEntry{}, nil, syserr.ErrNotSupported
+	}
+	attrs, ok := attrsView.Parse()
+	if !ok {
+		return nil, tunnel.FDBEntry{}, nil, syserr.ErrInvalidArgument
+	}
+	ni, ok := s.Stack.NICInfo()[tcpip.NICID(ndm.Index)]
+	if !ok {
+		return nil, tunnel.FDBEntry{}, nil, syserr.ErrNoDevice
+	}
+	ep, ok := ni.Context.(*tunnel.VXLANEndpoint)
+	if !ok || ndm.Flags&linux.NTF_MASTER != 0 {
+		// Only VXLAN interfaces have a forwarding database, and
+		// interfaces have no master with one.
+		return nil, tunnel.FDBEntry{}, nil, syserr.ErrNotSupported
+	}
+
+	var entry tunnel.FDBEntry
+	addrSize := header.IPv4AddressSize
+	if ep.Config().Remote.Len() == header.IPv6AddressSize || ep.Config().Local.Len() == header.IPv6AddressSize || ep.Config().NetProto == header.IPv6ProtocolNumber {
+		addrSize = header.IPv6AddressSize
+	}
+	hasLinkAddr := false
+	for attr, v := range attrs {
+		switch attr {
+		case linux.NDA_LLADDR:
+			if len(v) != tcpip.LinkAddressSize {
+				return nil, tunnel.FDBEntry{}, nil, syserr.ErrInvalidArgument
+			}
+			entry.LinkAddress = tcpip.LinkAddress(v)
+			hasLinkAddr = true
+		case linux.NDA_DST:
+			if len(v) != addrSize {
+				return nil, tunnel.FDBEntry{}, nil, syserr.ErrInvalidArgument
+			}
+			entry.Remote = tcpip.AddrFromSlice(v)
+		case linux.NDA_PORT:
+			if entry.Port, ok = parseBE16(v); !ok {
+				return nil, tunnel.FDBEntry{}, nil, syserr.ErrInvalidArgument
+			}
+		case linux.NDA_VNI:
+			if entry.VNI, ok = v.Uint32(); !ok || entry.VNI > header.VXLANMaxVNI {
+				return nil, tunnel.FDBEntry{}, nil, syserr.ErrInvalidArgument
+			}
+		case linux.NDA_IFINDEX, linux.NDA_VLAN:
+			return nil, tunnel.FDBEntry{}, nil, syserr.ErrNotSupported
+		}
+	}
+	if !hasLinkAddr {
+		return nil, tunnel.FDBEntry{}, nil, syserr.ErrInvalidArgument
+	}
+	return ep, entry, &ndm, nil
+}
+
+// NewFDBEntry implements inet.Stack.NewFDBEntry.
+func (s *Stack) NewFDBEntry(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	ep, entry, ndm, err := s.parseFDBEntry(msg)
+	if err != nil {
+		return err
+	}
+	if ndm.State&(linux.NUD_PERMANENT|linux.NUD_REACHABLE) == 0 {
+		return syserr.ErrInvalidArgument
+	}
+	entry.Permanent = ndm.State&linux.NUD_PERMANENT != 0
+	if entry.Remote.Len() == 0 {
+		entry.Remote = ep.Config().Remote
+		if entry.Remote.Len() == 0 {
+			return syserr.ErrInvalidArgument
+		}
+	}
+
+	flags := msg.Header().Flags
+	update := tunnel.FDBCreate
+	switch {
+	case flags&linux.NLM_F_APPEND != 0:
+		update = tunnel.FDBAppend
+	case flags&linux.NLM_F_REPLACE != 0:
+		update = tunnel.FDBReplace
+	}
+	tcpipErr := ep.AddFDBEntry(entry, update)
+	if _, ok := tcpipErr.(*tcpip.ErrDuplicateAddress); ok && update == tunnel.FDBCreate && flags&linux.NLM_F_EXCL == 0 {
+		// Like on Linux, adding an existing entry without NLM_F_EXCL
+		// succeeds.
+		return nil
+	}
+	if tcpipErr != nil {
+		return syserr.TranslateNetstackError(tcpipErr)
+	}
+	return nil
+}
+
+// RemoveFDBEntry implements inet.Stack.RemoveFDBEntry.
+func (s *Stack) RemoveFDBEntry(ctx context.Context, msg *nlmsg.Message) *syserr.Error {
+	ep, entry, _, err := s.parseFDBEntry(msg)
+	if err != nil {
+		return err
+	}
+	if tcpipErr := ep.RemoveFDBEntry(entry.LinkAddress, entry.Remote); tcpipErr != nil {
+		return syserr.TranslateNetstackError(tcpipErr)
+	}
+	return nil
+}
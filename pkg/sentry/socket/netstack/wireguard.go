@@ -0,0 +1,79 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netlink/nlmsg"
+	"gvisor.dev/gvisor/pkg/syserr"
+	"gvisor.dev/gvisor/pkg/tcpip/link/wireguard"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// newWireGuard creates a wireguard interface. Like on Linux, it has no
+// IFLA_INFO_DATA attributes: it is configured through the "wireguard" generic
+// netlink family.
+//
+// The datagrams of the interface are sent and received by this stack, even if
+// the interface is moved to another network namespace.
+func (s *Stack) newWireGuard(ctx context.Context, linkAttrs map[uint16]nlmsg.BytesView) *syserr.Error {
+	ep, err := wireguard.New(wireguard.Options{
+		Stack: s.Stack,
+	})
+	if err != nil {
+		return syserr.TranslateNetstackError(err)
+	}
+	return s.newTunnelNIC(ctx, "wg", ep, false /* ethernetFrames */, linkAttrs)
+}
+
+// linkKind returns the IFLA_INFO_KIND of the interface whose NIC has the given
+// context, which tools like wg(8) use to find their interfaces.
+func linkKind(ctx stack.NICContext) string {
+	switch ctx.(type) {
+	case *wireguard.Endpoint:
+		return "wireguard"
+	default:
+		return ""
+	}
+}
+
+// WireGuardInterface returns the WireGuard endpoint of the interface with the
+// given index or, if index is zero, name, along with the index and name of
+// the interface.
+func (s *Stack) WireGuardInterface(index int32, name string) (*wireguard.Endpoint, int32, string, *syserr.Error) {
+	for id, ni := range s.Stack.NICInfo() {
+		if (index != 0 && int32(id) != index) || (index == 0 && ni.Name != name) {
+			continue
+		}
+		ep, ok := ni.Context.(*wireguard.Endpoint)
+		if !ok {
+			return nil, 0, "", syserr.ErrNotSupported
+		}
+		return ep, int32(id), ni.Name, nil
+	}
+	return nil, 0, "", syserr.ErrNoDevice
+}
+
+// WireGuardInterfaces returns the indices of the WireGuard interfaces of the
+// stack.
+func (s *Stack) WireGuardInterfaces() []int32 {
+	var ids []int32
+	for id, ni := range s.Stack.NICInfo() {
+		if _, ok := ni.Context.(*wireguard.Endpoint); ok {
+			ids = append(ids, int32(id))
+		}
+	}
+	return ids
+}
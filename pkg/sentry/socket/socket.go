@@ -76,6 +76,8 @@ func errOriginToLinux(origin tcpip.SockErrOrigin) uint8 {
 		return linux.SO_EE_ORIGIN_ICMP
 	case tcpip.SockExtErrorOriginICMP6:
 		return linux.SO_EE_ORIGIN_ICMP6
+	case tcpip.SockExtErrorOriginTimestamping:
+		return linux.SO_EE_ORIGIN_TIMESTAMPING
 	default:
 		panic(fmt.Sprintf("unknown socket origin: %d", origin))
 	}
@@ -89,12 +91,19 @@ func sockErrCmsgToLinux(sockErr *tcpip.SockError) linux.SockErrCMsg {
 	}
 
 	ee := linux.SockExtendedErr{
-		Errno:  uint32(syserr.TranslateNetstackError(sockErr.Err).ToLinux()),
 		Origin: errOriginToLinux(sockErr.Cause.Origin()),
 		Type:   sockErr.Cause.Type(),
 		Code:   sockErr.Cause.Code(),
 		Info:   sockErr.Cause.Info(),
 	}
+	if cause, ok := sockErr.Cause.(*tcpip.TimestampingSockError); ok {
+		// Transmit timestamps are not errors; Linux reports them with
+		// ENOMSG and carries the OPT_ID key in ee_data.
+		ee.Errno = uint32(syserr.ErrNoMessage.ToLinux())
+		ee.Data = cause.Key
+	} else {
+		ee.Errno = uint32(syserr.TranslateNetstackError(sockErr.Err).ToLinux())
+	}
 
 	switch sockErr.NetProto {
 	case header.IPv4ProtocolNumber:
@@ -141,12 +150,44 @@ func NewIPControlMessages(family int, cmgs tcpip.ReceivableControlMessages) IPCo
 		HasIPv6PacketInfo:  cmgs.HasIPv6PacketInfo,
 		OriginalDstAddress: orgDstAddr,
 		SockErr:            sockErrCmsgToLinux(cmgs.SockErr),
+		HasUDPGROSize:      cmgs.HasUDPGROSize,
+		UDPGROSize:         int32(cmgs.UDPGROSize),
 	}
 
 	if cm.HasIPv6PacketInfo {
 		cm.IPv6PacketInfo = ipv6PacketInfoToLinux(cmgs.IPv6PacketInfo)
 	}
 
+	if cmgs.HasSCTPRcvInfo || cmgs.HasSCTPSndRcvInfo {
+		info := &cmgs.SCTPRcvInfo
+		if cmgs.HasSCTPRcvInfo {
+			cm.HasSCTPRcvInfo = true
+			cm.SCTPRcvInfo = linux.SCTPRcvInfo{
+				Stream:  info.Stream,
+				SSN:     info.SSN,
+				Flags:   info.Flags,
+				PPID:    info.PPID,
+				TSN:     info.TSN,
+				CumTSN:  info.CumTSN,
+				Context: info.Context,
+				AssocID: int32(info.AssocID),
+			}
+		}
+		if cmgs.HasSCTPSndRcvInfo {
+			cm.HasSCTPSndRcvInfo = true
+			cm.SCTPSndRcvInfo = linux.SCTPSndRcvInfo{
+				Stream:  info.Stream,
+				SSN:     info.SSN,
+				Flags:   info.Flags,
+				PPID:    info.PPID,
+				Context: info.Context,
+				TSN:     info.TSN,
+				CumTSN:  info.CumTSN,
+				AssocID: int32(info.AssocID),
+			}
+		}
+	}
+
 	return cm
 }
 
@@ -162,6 +203,27 @@ type IPControlMessages struct {
 	// was received.
 	Timestamp time.Time `state:".(int64)"`
 
+	// HasTimestamping indicates whether Timestamping is valid/set.
+	HasTimestamping bool
+
+	// Timestamping holds the SCM_TIMESTAMPING timestamps of a received
+	// packet or of a transmit timestamp dequeued from the error queue.
+	Timestamping linux.ScmTimestamping
+
+	// HasTXTimestamping indicates whether TXTimestamping is valid/set.
+	HasTXTimestamping bool
+
+	// TXTimestamping holds the SOF_TIMESTAMPING_TX_* flags requested for a
+	// single message, overriding those set with SO_TIMESTAMPING.
+	TXTimestamping uint32
+
+	// HasTXTime indicates whether TXTime is valid/set.
+	HasTXTime bool
+
+	// TXTime is the earliest departure time of a sent message, in
+	// nanoseconds of the clock selected with SO_TXTIME.
+	TXTime uint64
+
 	// HasInq indicates whether Inq is valid/set.
 	HasInq bool
 
@@ -210,6 +272,40 @@ type IPControlMessages struct {
 
 	// SockErr is the dequeued socket error on recvmsg(MSG_ERRQUEUE).
 	SockErr linux.SockErrCMsg
+
+	// HasSCTPRcvInfo indicates whether SCTPRcvInfo is set.
+	HasSCTPRcvInfo bool
+
+	// SCTPRcvInfo holds the SCTP receive information of a message.
+	SCTPRcvInfo linux.SCTPRcvInfo
+
+	// HasSCTPSndRcvInfo indicates whether SCTPSndRcvInfo is set.
+	HasSCTPSndRcvInfo bool
+
+	// SCTPSndRcvInfo holds the SCTP receive information of a message in
+	// the deprecated SCTP_SNDRCV format, or the send parameters of a
+	// message passed in that format.
+	SCTPSndRcvInfo linux.SCTPSndRcvInfo
+
+	// HasSCTPSndInfo indicates whether SCTPSndInfo is set.
+	HasSCTPSndInfo bool
+
+	// SCTPSndInfo holds the SCTP send parameters of a message.
+	SCTPSndInfo linux.SCTPSndInfo
+
+	// HasUDPSegmentSize indicates whether UDPSegmentSize is valid/set.
+	HasUDPSegmentSize bool
+
+	// UDPSegmentSize is the size of the datagrams a sent message is split
+	// into.
+	UDPSegmentSize uint16
+
+	// HasUDPGROSize indicates whether UDPGROSize is valid/set.
+	HasUDPGROSize bool
+
+	// UDPGROSize is the size of the datagrams that were coalesced into a
+	// received message.
+	UDPGROSize int32
 }
 
 // Release releases Unix domain socket credentials and rights.
@@ -0,0 +1,57 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+// Peer returns the endpoint that e is connected to, which is nil if the peer
+// isn't a sentry endpoint, and whether e is connected.
+func Peer(e Endpoint) (Endpoint, bool) {
+	var b *baseEndpoint
+	switch e := e.(type) {
+	case *connectionedEndpoint:
+		b = &e.baseEndpoint
+	case *connectionlessEndpoint:
+		b = &e.baseEndpoint
+	default:
+		return nil, false
+	}
+
+	b.Lock()
+	c := b.connected
+	b.Unlock()
+	if c == nil {
+		return nil, false
+	}
+	if ce, ok := c.(*connectedEndpoint); ok {
+		if peer, ok := ce.endpoint.(Endpoint); ok {
+			return peer, true
+		}
+	}
+	return nil, true
+}
+
+// ListenQueue returns the number of connections waiting to be accepted by e
+// and the maximum number, if e is listening.
+func ListenQueue(e Endpoint) (pending, backlog int, listening bool) {
+	ce, ok := e.(*connectionedEndpoint)
+	if !ok {
+		return 0, 0, false
+	}
+	ce.Lock()
+	defer ce.Unlock()
+	if !ce.ListeningLocked() {
+		return 0, 0, false
+	}
+	return len(ce.acceptedChan), cap(ce.acceptedChan), true
+}
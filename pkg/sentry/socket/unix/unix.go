@@ -443,6 +443,11 @@ func (s *Socket) Endpoint() transport.Endpoint {
 	return s.ep
 }
 
+// NetworkNamespace returns the network namespace of the socket.
+func (s *Socket) NetworkNamespace() *inet.Namespace {
+	return s.namespace
+}
+
 // extractPath extracts and validates the address.
 func extractPath(sockaddr []byte) (string, *syserr.Error) {
 	addr, family, err := AddressAndFamily(sockaddr)
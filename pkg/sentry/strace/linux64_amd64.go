@@ -358,7 +358,7 @@ var linuxAMD64 = SyscallMap{
 	330: makeSyscallInfo("pkey_alloc", Hex, Hex),
 	331: makeSyscallInfo("pkey_free", Hex),
 	332: makeSyscallInfo("statx", FD, Path, Hex, Hex, Hex),
-	333: makeSyscallInfo("io_pgetevents", Hex, Hex, Hex, Hex, Timespec, SigSet),
+	333: makeSyscallInfo("io_pgetevents", Hex, Hex, Hex, Hex, Timespec, Hex),
 	334: makeSyscallInfo("rseq", Hex, Hex, Hex, Hex),
 	424: makeSyscallInfo("pidfd_send_signal", FD, Signal, Hex, Hex),
 	425: makeSyscallInfo("io_uring_setup", Hex, Hex),
@@ -375,6 +375,10 @@ var linuxAMD64 = SyscallMap{
 	436: makeSyscallInfo("close_range", FD, FD, CloseRangeFlags),
 	439: makeSyscallInfo("faccessat2", FD, Path, Oct, Hex),
 	441: makeSyscallInfo("epoll_pwait2", FD, EpollEvents, Hex, Timespec, SigSet),
+	447: makeSyscallInfo("memfd_secret", Hex),
+	449: makeSyscallInfo("futex_waitv", Hex, Hex, Hex, Timespec, Hex),
+	454: makeSyscallInfo("futex_wake", Hex, Hex, Hex, Hex),
+	455: makeSyscallInfo("futex_wait", Hex, Hex, Hex, Hex, Timespec, Hex),
 }
 
 func init() {
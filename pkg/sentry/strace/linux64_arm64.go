@@ -299,7 +299,7 @@ var linuxARM64 = SyscallMap{
 	286: makeSyscallInfo("preadv2", FD, ReadIOVec, Hex, Hex, Hex),
 	287: makeSyscallInfo("pwritev2", FD, WriteIOVec, Hex, Hex, Hex),
 	291: makeSyscallInfo("statx", FD, Path, Hex, Hex, Hex),
-	292: makeSyscallInfo("io_pgetevents", Hex, Hex, Hex, Hex, Timespec, SigSet),
+	292: makeSyscallInfo("io_pgetevents", Hex, Hex, Hex, Hex, Timespec, Hex),
 	293: makeSyscallInfo("rseq", Hex, Hex, Hex, Hex),
 	424: makeSyscallInfo("pidfd_send_signal", FD, Signal, Hex, Hex),
 	425: makeSyscallInfo("io_uring_setup", Hex, Hex),
@@ -316,6 +316,10 @@ var linuxARM64 = SyscallMap{
 	436: makeSyscallInfo("close_range", FD, FD, CloseRangeFlags),
 	439: makeSyscallInfo("faccessat2", FD, Path, Oct, Hex),
 	441: makeSyscallInfo("epoll_pwait2", FD, EpollEvents, Hex, Timespec, SigSet),
+	447: makeSyscallInfo("memfd_secret", Hex),
+	449: makeSyscallInfo("futex_waitv", Hex, Hex, Hex, Timespec, Hex),
+	454: makeSyscallInfo("futex_wake", Hex, Hex, Hex, Hex),
+	455: makeSyscallInfo("futex_wait", Hex, Hex, Hex, Hex, Timespec, Hex),
 }
 
 func init() {
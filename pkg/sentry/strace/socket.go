@@ -548,6 +548,9 @@ var sockOptNames = map[uint64]abi.ValueSet{
 		linux.SO_OOBINLINE:    "SO_OOBINLINE",
 		linux.SO_TIMESTAMP:    "SO_TIMESTAMP",
 		linux.SO_ACCEPTCONN:   "SO_ACCEPTCONN",
+		linux.SO_MARK:         "SO_MARK",
+		linux.SO_TIMESTAMPING: "SO_TIMESTAMPING",
+		linux.SO_TXTIME:       "SO_TXTIME",
 	},
 	linux.SOL_TCP: {
 		linux.TCP_NODELAY:              "TCP_NODELAY",
@@ -565,6 +568,8 @@ var sockOptNames = map[uint64]abi.ValueSet{
 		linux.TCP_LINGER2:              "TCP_LINGER2",
 		linux.TCP_DEFER_ACCEPT:         "TCP_DEFER_ACCEPT",
 		linux.TCP_REPAIR_OPTIONS:       "TCP_REPAIR_OPTIONS",
+		linux.TCP_MD5SIG:               "TCP_MD5SIG",
+		linux.TCP_MD5SIG_EXT:           "TCP_MD5SIG_EXT",
 		linux.TCP_INQ:                  "TCP_INQ",
 		linux.TCP_FASTOPEN:             "TCP_FASTOPEN",
 		linux.TCP_FASTOPEN_CONNECT:     "TCP_FASTOPEN_CONNECT",
@@ -584,6 +589,14 @@ var sockOptNames = map[uint64]abi.ValueSet{
 		linux.TCP_ULP:                  "TCP_ULP",
 		linux.TCP_WINDOW_CLAMP:         "TCP_WINDOW_CLAMP",
 	},
+	linux.SOL_UDP: {
+		linux.UDP_CORK:         "UDP_CORK",
+		linux.UDP_ENCAP:        "UDP_ENCAP",
+		linux.UDP_NO_CHECK6_TX: "UDP_NO_CHECK6_TX",
+		linux.UDP_NO_CHECK6_RX: "UDP_NO_CHECK6_RX",
+		linux.UDP_SEGMENT:      "UDP_SEGMENT",
+		linux.UDP_GRO:          "UDP_GRO",
+	},
 	linux.SOL_IPV6: {
 		linux.IPV6_V6ONLY:              "IPV6_V6ONLY",
 		linux.IPV6_PATHMTU:             "IPV6_PATHMTU",
@@ -201,10 +201,10 @@ var AMD64 = &kernel.SyscallTable{
 		146: syscalls.PartiallySupported("sched_get_priority_max", SchedGetPriorityMax, "Stub implementation.", nil),
 		147: syscalls.PartiallySupported("sched_get_priority_min", SchedGetPriorityMin, "Stub implementation.", nil),
 		148: syscalls.ErrorWithEvent("sched_rr_get_interval", linuxerr.EPERM, "", nil),
-		149: syscalls.PartiallySupported("mlock", Mlock, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
-		150: syscalls.PartiallySupported("munlock", Munlock, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
-		151: syscalls.PartiallySupported("mlockall", Mlockall, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
-		152: syscalls.PartiallySupported("munlockall", Munlockall, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
+		149: syscalls.PartiallySupported("mlock", Mlock, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
+		150: syscalls.PartiallySupported("munlock", Munlock, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
+		151: syscalls.PartiallySupported("mlockall", Mlockall, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
+		152: syscalls.PartiallySupported("munlockall", Munlockall, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
 		153: syscalls.CapError("vhangup", linux.CAP_SYS_TTY_CONFIG, "", nil),
 		154: syscalls.Error("modify_ldt", linuxerr.EPERM, "", nil),
 		155: syscalls.Supported("pivot_root", PivotRoot),
@@ -258,11 +258,11 @@ var AMD64 = &kernel.SyscallTable{
 		203: syscalls.PartiallySupported("sched_setaffinity", SchedSetaffinity, "Stub implementation.", nil),
 		204: syscalls.PartiallySupported("sched_getaffinity", SchedGetaffinity, "Stub implementation.", nil),
 		205: syscalls.Error("set_thread_area", linuxerr.ENOSYS, "Expected to return ENOSYS on 64-bit", nil),
-		206: syscalls.PartiallySupported("io_setup", IoSetup, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
-		207: syscalls.PartiallySupported("io_destroy", IoDestroy, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
-		208: syscalls.PartiallySupported("io_getevents", IoGetevents, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
-		209: syscalls.PartiallySupported("io_submit", IoSubmit, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
-		210: syscalls.PartiallySupported("io_cancel", IoCancel, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
+		206: syscalls.PartiallySupported("io_setup", IoSetup, "Generally supported with exceptions.", nil),
+		207: syscalls.PartiallySupported("io_destroy", IoDestroy, "Generally supported with exceptions.", nil),
+		208: syscalls.PartiallySupported("io_getevents", IoGetevents, "Generally supported with exceptions.", nil),
+		209: syscalls.PartiallySupported("io_submit", IoSubmit, "Generally supported with exceptions.", nil),
+		210: syscalls.PartiallySupported("io_cancel", IoCancel, "Generally supported with exceptions.", nil),
 		211: syscalls.Error("get_thread_area", linuxerr.ENOSYS, "Expected to return ENOSYS on 64-bit", nil),
 		212: syscalls.CapError("lookup_dcookie", linux.CAP_SYS_ADMIN, "", nil),
 		213: syscalls.Supported("epoll_create", EpollCreate),
@@ -289,9 +289,9 @@ var AMD64 = &kernel.SyscallTable{
 		234: syscalls.Supported("tgkill", Tgkill),
 		235: syscalls.Supported("utimes", Utimes),
 		236: syscalls.Error("vserver", linuxerr.ENOSYS, "Not implemented by Linux", nil),
-		237: syscalls.PartiallySupported("mbind", Mbind, "Stub implementation. Only a single NUMA node is advertised, and mempolicy is ignored accordingly, but mbind() will succeed and has effects reflected by get_mempolicy.", []string{"gvisor.dev/issue/262"}),
-		238: syscalls.PartiallySupported("set_mempolicy", SetMempolicy, "Stub implementation.", nil),
-		239: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "Stub implementation.", nil),
+		237: syscalls.PartiallySupported("mbind", Mbind, "Policies are honored when allocating new pages, but existing pages are never migrated; MPOL_MF_* flags are ignored. Multiple NUMA nodes are only advertised if enabled with --numa.", []string{"gvisor.dev/issue/262"}),
+		238: syscalls.PartiallySupported("set_mempolicy", SetMempolicy, "MPOL_F_STATIC_NODES and MPOL_F_RELATIVE_NODES are ignored.", nil),
+		239: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "MPOL_F_NODE without MPOL_F_ADDR reports the first node in the interleave set.", nil),
 		240: syscalls.Supported("mq_open", MqOpen),
 		241: syscalls.Supported("mq_unlink", MqUnlink),
 		242: syscalls.ErrorWithEvent("mq_timedsend", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}),    // TODO(b/29354921)
@@ -377,7 +377,7 @@ var AMD64 = &kernel.SyscallTable{
 		322: syscalls.SupportedPoint("execveat", Execveat, PointExecveat),
 		323: syscalls.ErrorWithEvent("userfaultfd", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/266"}), // TODO(b/118906345)
 		324: syscalls.PartiallySupported("membarrier", Membarrier, "Not supported on all platforms.", nil),
-		325: syscalls.PartiallySupported("mlock2", Mlock2, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
+		325: syscalls.PartiallySupported("mlock2", Mlock2, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
 
 		// Syscalls implemented after 325 are "backports" from versions
 		// of Linux after 4.4.
@@ -388,7 +388,7 @@ var AMD64 = &kernel.SyscallTable{
 		330: syscalls.ErrorWithEvent("pkey_alloc", linuxerr.ENOSYS, "", nil),
 		331: syscalls.ErrorWithEvent("pkey_free", linuxerr.ENOSYS, "", nil),
 		332: syscalls.Supported("statx", Statx),
-		333: syscalls.ErrorWithEvent("io_pgetevents", linuxerr.ENOSYS, "", nil),
+		333: syscalls.PartiallySupported("io_pgetevents", IoPgetevents, "Generally supported with exceptions.", nil),
 		334: syscalls.PartiallySupported("rseq", RSeq, "Not supported on all platforms.", nil),
 
 		// Linux skips ahead to syscall 424 to sync numbers between arches.
@@ -407,6 +407,10 @@ var AMD64 = &kernel.SyscallTable{
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
+		447: syscalls.Supported("memfd_secret", MemfdSecret),
+		449: syscalls.Supported("futex_waitv", FutexWaitv),
+		454: syscalls.Supported("futex_wake", FutexWake),
+		455: syscalls.Supported("futex_wait", FutexWait),
 	},
 	Emulate: map[hostarch.Addr]uintptr{
 		0xffffffffff600000: 96,  // vsyscall gettimeofday(2)
@@ -431,11 +435,11 @@ var ARM64 = &kernel.SyscallTable{
 	},
 	AuditNumber: linux.AUDIT_ARCH_AARCH64,
 	Table: map[uintptr]kernel.Syscall{
-		0:   syscalls.PartiallySupported("io_setup", IoSetup, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
-		1:   syscalls.PartiallySupported("io_destroy", IoDestroy, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
-		2:   syscalls.PartiallySupported("io_submit", IoSubmit, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
-		3:   syscalls.PartiallySupported("io_cancel", IoCancel, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
-		4:   syscalls.PartiallySupported("io_getevents", IoGetevents, "Generally supported with exceptions. User ring optimizations are not implemented.", []string{"gvisor.dev/issue/204"}),
+		0:   syscalls.PartiallySupported("io_setup", IoSetup, "Generally supported with exceptions.", nil),
+		1:   syscalls.PartiallySupported("io_destroy", IoDestroy, "Generally supported with exceptions.", nil),
+		2:   syscalls.PartiallySupported("io_submit", IoSubmit, "Generally supported with exceptions.", nil),
+		3:   syscalls.PartiallySupported("io_cancel", IoCancel, "Generally supported with exceptions.", nil),
+		4:   syscalls.PartiallySupported("io_getevents", IoGetevents, "Generally supported with exceptions.", nil),
 		5:   syscalls.Supported("setxattr", SetXattr),
 		6:   syscalls.Supported("lsetxattr", Lsetxattr),
 		7:   syscalls.Supported("fsetxattr", Fsetxattr),
@@ -659,16 +663,16 @@ var ARM64 = &kernel.SyscallTable{
 		225: syscalls.CapError("swapoff", linux.CAP_SYS_ADMIN, "", nil),
 		226: syscalls.Supported("mprotect", Mprotect),
 		227: syscalls.PartiallySupported("msync", Msync, "Full data flush is not guaranteed at this time.", nil),
-		228: syscalls.PartiallySupported("mlock", Mlock, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
-		229: syscalls.PartiallySupported("munlock", Munlock, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
-		230: syscalls.PartiallySupported("mlockall", Mlockall, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
-		231: syscalls.PartiallySupported("munlockall", Munlockall, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
+		228: syscalls.PartiallySupported("mlock", Mlock, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
+		229: syscalls.PartiallySupported("munlock", Munlock, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
+		230: syscalls.PartiallySupported("mlockall", Mlockall, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
+		231: syscalls.PartiallySupported("munlockall", Munlockall, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
 		232: syscalls.PartiallySupported("mincore", Mincore, "Stub implementation. The sandbox does not have access to this information. Reports all mapped pages are resident.", nil),
 		233: syscalls.PartiallySupported("madvise", Madvise, "Options MADV_DONTNEED, MADV_DONTFORK are supported. Other advice is ignored.", nil),
 		234: syscalls.ErrorWithEvent("remap_file_pages", linuxerr.ENOSYS, "Deprecated since Linux 3.16.", nil),
-		235: syscalls.PartiallySupported("mbind", Mbind, "Stub implementation. Only a single NUMA node is advertised, and mempolicy is ignored accordingly, but mbind() will succeed and has effects reflected by get_mempolicy.", []string{"gvisor.dev/issue/262"}),
-		236: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "Stub implementation.", nil),
-		237: syscalls.PartiallySupported("set_mempolicy", SetMempolicy, "Stub implementation.", nil),
+		235: syscalls.PartiallySupported("mbind", Mbind, "Policies are honored when allocating new pages, but existing pages are never migrated; MPOL_MF_* flags are ignored. Multiple NUMA nodes are only advertised if enabled with --numa.", []string{"gvisor.dev/issue/262"}),
+		236: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "MPOL_F_NODE without MPOL_F_ADDR reports the first node in the interleave set.", nil),
+		237: syscalls.PartiallySupported("set_mempolicy", SetMempolicy, "MPOL_F_STATIC_NODES and MPOL_F_RELATIVE_NODES are ignored.", nil),
 		238: syscalls.CapError("migrate_pages", linux.CAP_SYS_NICE, "", nil),
 		239: syscalls.CapError("move_pages", linux.CAP_SYS_NICE, "", nil), // requires cap_sys_nice (mostly)
 		240: syscalls.Supported("rt_tgsigqueueinfo", RtTgsigqueueinfo),
@@ -699,7 +703,7 @@ var ARM64 = &kernel.SyscallTable{
 		281: syscalls.SupportedPoint("execveat", Execveat, PointExecveat),
 		282: syscalls.ErrorWithEvent("userfaultfd", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/266"}), // TODO(b/118906345)
 		283: syscalls.PartiallySupported("membarrier", Membarrier, "Not supported on all platforms.", nil),
-		284: syscalls.PartiallySupported("mlock2", Mlock2, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
+		284: syscalls.PartiallySupported("mlock2", Mlock2, "Locked mappings are accounted against RLIMIT_MEMLOCK and reported in VmLck, but are neither locked in host memory nor marked unevictable in the sentry's memory file.", nil),
 
 		// Syscalls after 284 are "backports" from versions of Linux after 4.4.
 		285: syscalls.ErrorWithEvent("copy_file_range", linuxerr.ENOSYS, "", nil),
@@ -709,7 +713,7 @@ var ARM64 = &kernel.SyscallTable{
 		289: syscalls.ErrorWithEvent("pkey_alloc", linuxerr.ENOSYS, "", nil),
 		290: syscalls.ErrorWithEvent("pkey_free", linuxerr.ENOSYS, "", nil),
 		291: syscalls.Supported("statx", Statx),
-		292: syscalls.ErrorWithEvent("io_pgetevents", linuxerr.ENOSYS, "", nil),
+		292: syscalls.PartiallySupported("io_pgetevents", IoPgetevents, "Generally supported with exceptions.", nil),
 		293: syscalls.PartiallySupported("rseq", RSeq, "Not supported on all platforms.", nil),
 
 		// Linux skips ahead to syscall 424 to sync numbers between arches.
@@ -728,6 +732,10 @@ var ARM64 = &kernel.SyscallTable{
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
+		447: syscalls.Supported("memfd_secret", MemfdSecret),
+		449: syscalls.Supported("futex_waitv", FutexWaitv),
+		454: syscalls.Supported("futex_wake", FutexWake),
+		455: syscalls.Supported("futex_wait", FutexWait),
 	},
 	Emulate: map[hostarch.Addr]uintptr{},
 	Missing: func(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
@@ -95,14 +95,58 @@ func IoGetevents(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 	eventsAddr := args[3].Pointer()
 	timespecAddr := args[4].Pointer()
 
+	n, err := getEvents(t, id, minEvents, events, eventsAddr, timespecAddr)
+	if err != nil {
+		return 0, nil, linuxerr.ConvertIntr(err, linuxerr.EINTR)
+	}
+	return n, nil, nil
+}
+
+// IoPgetevents implements linux syscall io_pgetevents(2).
+func IoPgetevents(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	id := args[0].Uint64()
+	minEvents := args[1].Int()
+	events := args[2].Int()
+	eventsAddr := args[3].Pointer()
+	timespecAddr := args[4].Pointer()
+	sigAddr := args[5].Pointer()
+
+	if sigAddr != 0 {
+		maskAddr, maskSize, err := copyInSigSetWithSize(t, sigAddr)
+		if err != nil {
+			return 0, nil, err
+		}
+		// The mask is restored on return to user mode, unless a signal
+		// handler is invoked first (in which case it is restored by
+		// sigreturn).
+		if err := setTempSignalSet(t, maskAddr, maskSize); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	n, err := getEvents(t, id, minEvents, events, eventsAddr, timespecAddr)
+	if err != nil {
+		// Linux: fs/aio.c:SYSCALL_DEFINE6(io_pgetevents) returns
+		// -ERESTARTNOHAND if interrupted without any events.
+		return 0, nil, linuxerr.ConvertIntr(err, linuxerr.ERESTARTNOHAND)
+	}
+	return n, nil, nil
+}
+
+// getEvents implements the common part of io_getevents(2) and
+// io_pgetevents(2). It returns the number of events copied out to
+// eventsAddr.
+//
+// Linux: fs/aio.c:do_io_getevents()
+func getEvents(t *kernel.Task, id uint64, minEvents, events int32, eventsAddr, timespecAddr hostarch.Addr) (uintptr, error) {
 	// Sanity check arguments.
 	if minEvents < 0 || minEvents > events {
-		return 0, nil, linuxerr.EINVAL
+		return 0, linuxerr.EINVAL
 	}
 
 	ctx, ok := t.MemoryManager().LookupAIOContext(t, id)
 	if !ok {
-		return 0, nil, linuxerr.EINVAL
+		return 0, linuxerr.EINVAL
 	}
 
 	// Setup the timeout.
@@ -111,10 +155,10 @@ func IoGetevents(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 	if timespecAddr != 0 {
 		d, err := copyTimespecIn(t, timespecAddr)
 		if err != nil {
-			return 0, nil, err
+			return 0, err
 		}
 		if !d.Valid() {
-			return 0, nil, linuxerr.EINVAL
+			return 0, linuxerr.EINVAL
 		}
 		deadline = t.Kernel().MonotonicClock().Now().Add(d.ToDuration())
 		haveDeadline = true
@@ -123,33 +167,31 @@ func IoGetevents(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 	// Loop over all requests.
 	for count := int32(0); count < events; count++ {
 		// Get a request, per semantics.
-		var v any
+		var ev linux.IOEvent
 		if count >= minEvents {
 			var ok bool
-			v, ok = ctx.PopRequest()
+			ev, ok = ctx.PopRequest()
 			if !ok {
-				return uintptr(count), nil, nil
+				return uintptr(count), nil
 			}
 		} else {
 			var err error
-			v, err = waitForRequest(ctx, t, haveDeadline, deadline)
+			ev, err = waitForRequest(ctx, t, haveDeadline, deadline)
 			if err != nil {
 				if count > 0 || linuxerr.Equals(linuxerr.ETIMEDOUT, err) {
-					return uintptr(count), nil, nil
+					return uintptr(count), nil
 				}
-				return 0, nil, linuxerr.ConvertIntr(err, linuxerr.EINTR)
+				return 0, err
 			}
 		}
 
-		ev := v.(*linux.IOEvent)
-
 		// Copy out the result.
 		if _, err := ev.CopyOut(t, eventsAddr); err != nil {
 			if count > 0 {
-				return uintptr(count), nil, nil
+				return uintptr(count), nil
 			}
 			// Nothing done.
-			return 0, nil, err
+			return 0, err
 		}
 
 		// Keep rolling.
@@ -157,24 +199,24 @@ func IoGetevents(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 	}
 
 	// Everything finished.
-	return uintptr(events), nil, nil
+	return uintptr(events), nil
 }
 
-func waitForRequest(ctx *mm.AIOContext, t *kernel.Task, haveDeadline bool, deadline ktime.Time) (any, error) {
+func waitForRequest(ctx *mm.AIOContext, t *kernel.Task, haveDeadline bool, deadline ktime.Time) (linux.IOEvent, error) {
 	for {
-		if v, ok := ctx.PopRequest(); ok {
+		if ev, ok := ctx.PopRequest(); ok {
 			// Request was readily available. Just return it.
-			return v, nil
+			return ev, nil
 		}
 
 		// Need to wait for request completion.
 		done := ctx.WaitChannel()
 		if done == nil {
 			// Context has been destroyed.
-			return nil, linuxerr.EINVAL
+			return linux.IOEvent{}, linuxerr.EINVAL
 		}
 		if err := t.BlockWithDeadline(done, haveDeadline, deadline); err != nil {
-			return nil, err
+			return linux.IOEvent{}, err
 		}
 	}
 }
@@ -1667,7 +1667,8 @@ func Flock(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 const (
 	memfdPrefix     = "memfd:"
 	memfdMaxNameLen = linux.NAME_MAX - len(memfdPrefix)
-	memfdAllFlags   = uint32(linux.MFD_CLOEXEC | linux.MFD_ALLOW_SEALING)
+	memfdAllFlags   = uint32(linux.MFD_CLOEXEC | linux.MFD_ALLOW_SEALING | linux.MFD_HUGETLB | linux.MFD_NOEXEC_SEAL | linux.MFD_EXEC)
+	memfdHugeFlags  = uint32(linux.MFD_HUGE_MASK << linux.MFD_HUGE_SHIFT)
 )
 
 // MemfdCreate implements the linux syscall memfd_create(2).
@@ -1675,13 +1676,31 @@ func MemfdCreate(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 	addr := args[0].Pointer()
 	flags := args[1].Uint()
 
-	if flags&^memfdAllFlags != 0 {
-		// Unknown bits in flags.
+	if flags&linux.MFD_HUGETLB == 0 {
+		if flags&^memfdAllFlags != 0 {
+			// Unknown bits in flags.
+			return 0, nil, linuxerr.EINVAL
+		}
+	} else {
+		if flags&^(memfdAllFlags|memfdHugeFlags) != 0 {
+			// Unknown bits in flags.
+			return 0, nil, linuxerr.EINVAL
+		}
+		// Only the sentry's huge page size is supported.
+		if sizeLog := (flags >> linux.MFD_HUGE_SHIFT) & linux.MFD_HUGE_MASK; sizeLog != 0 && sizeLog != hostarch.HugePageShift {
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+	if flags&linux.MFD_EXEC != 0 && flags&linux.MFD_NOEXEC_SEAL != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
 
-	allowSeals := flags&linux.MFD_ALLOW_SEALING != 0
 	cloExec := flags&linux.MFD_CLOEXEC != 0
+	opts := tmpfs.MemfdOpts{
+		AllowSeals: flags&linux.MFD_ALLOW_SEALING != 0,
+		NoExec:     flags&linux.MFD_NOEXEC_SEAL != 0,
+		Hugetlb:    flags&linux.MFD_HUGETLB != 0,
+	}
 
 	name, err := t.CopyInString(addr, memfdMaxNameLen)
 	if err != nil {
@@ -1689,7 +1708,7 @@ func MemfdCreate(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 	}
 
 	shmMount := t.Kernel().ShmMount()
-	file, err := tmpfs.NewMemfd(t, t.Credentials(), shmMount, allowSeals, memfdPrefix+name)
+	file, err := tmpfs.NewMemfd(t, t.Credentials(), shmMount, memfdPrefix+name, opts)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -1704,3 +1723,26 @@ func MemfdCreate(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uin
 
 	return uintptr(fd), nil, nil
 }
+
+// MemfdSecret implements the linux syscall memfd_secret(2).
+func MemfdSecret(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	flags := args[0].Uint()
+	if flags&^linux.O_CLOEXEC != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+
+	file, err := tmpfs.NewSecretMem(t, t.Credentials(), t.Kernel().ShmMount())
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	fd, err := t.NewFDFrom(0, file, kernel.FDFlags{
+		CloseOnExec: flags&linux.O_CLOEXEC != 0,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return uintptr(fd), nil, nil
+}
@@ -15,6 +15,7 @@
 package linux
 
 import (
+	"math"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -22,6 +23,7 @@ import (
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/sentry/arch"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/futex"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 )
 
@@ -273,6 +275,155 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	}
 }
 
+// futex2Flags validates flags passed to a FUTEX2 syscall or in struct
+// futex_waitv, and returns true if they specify a private futex.
+func futex2Flags(flags uint32) (bool, error) {
+	if flags&^linux.FUTEX2_VALID_MASK != 0 {
+		return false, linuxerr.EINVAL
+	}
+	// Only 32-bit futexes are supported, as in Linux.
+	if flags&linux.FUTEX2_SIZE_MASK != linux.FUTEX2_SIZE_U32 {
+		return false, linuxerr.EINVAL
+	}
+	return flags&linux.FUTEX2_PRIVATE != 0, nil
+}
+
+// copyInFutex2Timeout copies in the absolute timeout for a FUTEX2 syscall and
+// validates clockid. It returns forever == true if timeoutAddr is NULL.
+func copyInFutex2Timeout(t *kernel.Task, timeoutAddr hostarch.Addr, clockid int32) (ts linux.Timespec, clockRealtime bool, forever bool, err error) {
+	if timeoutAddr == 0 {
+		return linux.Timespec{}, false, true, nil
+	}
+	switch clockid {
+	case linux.CLOCK_MONOTONIC:
+	case linux.CLOCK_REALTIME:
+		clockRealtime = true
+	default:
+		return linux.Timespec{}, false, false, linuxerr.EINVAL
+	}
+	ts, err = copyTimespecIn(t, timeoutAddr)
+	if err != nil {
+		return linux.Timespec{}, false, false, err
+	}
+	if !ts.Valid() {
+		return linux.Timespec{}, false, false, linuxerr.EINVAL
+	}
+	return ts, clockRealtime, false, nil
+}
+
+// FutexWaitv implements linux syscall futex_waitv(2).
+func FutexWaitv(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	waitersAddr := args[0].Pointer()
+	nrFutexes := args[1].Uint()
+	flags := args[2].Uint()
+	timeoutAddr := args[3].Pointer()
+	clockid := args[4].Int()
+
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	if waitersAddr == 0 || nrFutexes == 0 || nrFutexes > linux.FUTEX_WAITV_MAX {
+		return 0, nil, linuxerr.EINVAL
+	}
+	ts, clockRealtime, forever, err := copyInFutex2Timeout(t, timeoutAddr, clockid)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	waitv := make([]linux.FutexWaitv, nrFutexes)
+	if _, err := linux.CopyFutexWaitvSliceIn(t, waitersAddr, waitv); err != nil {
+		return 0, nil, err
+	}
+	fs := make([]futex.WaitvFutex, nrFutexes)
+	for i := range waitv {
+		wv := &waitv[i]
+		if wv.Reserved != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		private, err := futex2Flags(wv.Flags)
+		if err != nil {
+			return 0, nil, err
+		}
+		if wv.Val > math.MaxUint32 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		fs[i] = futex.WaitvFutex{
+			Addr:    hostarch.Addr(wv.Uaddr),
+			Private: private,
+			Val:     uint32(wv.Val),
+		}
+	}
+
+	ws := futex.NewWaiters(len(fs))
+	if woken, err := t.Futex().WaitvPrepare(ws, t, fs); woken >= 0 || err != nil {
+		return uintptr(woken), nil, err
+	}
+
+	c := ws[0].C
+	if forever {
+		err = t.Block(c)
+	} else if clockRealtime {
+		err = t.BlockWithDeadlineFrom(c, t.Kernel().RealtimeClock(), true, ktime.FromTimespec(ts))
+	} else {
+		err = t.BlockWithDeadline(c, true, ktime.FromTimespec(ts))
+	}
+
+	// As in Linux, a wakeup takes precedence over timeouts and signals.
+	if woken := t.Futex().WaitvComplete(ws, t); woken >= 0 {
+		return uintptr(woken), nil, nil
+	}
+	// The timeout is absolute, so the syscall may be restarted with the
+	// original arguments.
+	return 0, nil, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+}
+
+// FutexWake implements linux syscall futex_wake(2).
+func FutexWake(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+	mask := args[1].Uint64()
+	nr := int(args[2].Int())
+	flags := args[3].Uint()
+
+	private, err := futex2Flags(flags)
+	if err != nil {
+		return 0, nil, err
+	}
+	if mask == 0 || mask > math.MaxUint32 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Unlike FUTEX_WAKE, futex_wake(2) wakes no waiters if nr is
+	// non-positive.
+	if nr <= 0 {
+		return 0, nil, nil
+	}
+	n, err := t.Futex().Wake(t, addr, private, uint32(mask), nr)
+	return uintptr(n), nil, err
+}
+
+// FutexWait implements linux syscall futex_wait(2).
+func FutexWait(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+	val := args[1].Uint64()
+	mask := args[2].Uint64()
+	flags := args[3].Uint()
+	timeoutAddr := args[4].Pointer()
+	clockid := args[5].Int()
+
+	private, err := futex2Flags(flags)
+	if err != nil {
+		return 0, nil, err
+	}
+	if val > math.MaxUint32 || mask == 0 || mask > math.MaxUint32 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	ts, clockRealtime, forever, err := copyInFutex2Timeout(t, timeoutAddr, clockid)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := futexWaitAbsolute(t, clockRealtime, ts, forever, addr, private, uint32(val), uint32(mask))
+	return n, nil, err
+}
+
 // SetRobustList implements linux syscall set_robust_list(2).
 func SetRobustList(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	// Despite the syscall using the name 'pid' for this variable, it is
@@ -16,6 +16,7 @@ package linux
 
 import (
 	"fmt"
+	"math/bits"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -25,12 +26,17 @@ import (
 	"gvisor.dev/gvisor/pkg/usermem"
 )
 
-// We unconditionally report a single NUMA node. This also means that our
-// "nodemask_t" is a single unsigned long (uint64).
-const (
-	maxNodes        = 1
-	allowedNodemask = (1 << maxNodes) - 1
-)
+// We report at most 64 NUMA nodes (see kernel.Kernel.NUMANodes). This means
+// that our "nodemask_t" is a single unsigned long (uint64).
+
+// allowedNodemask returns the nodemask containing all NUMA nodes.
+func allowedNodemask(t *kernel.Task) uint64 {
+	nodes := t.Kernel().NUMANodes()
+	if nodes >= 64 {
+		return ^uint64(0)
+	}
+	return (uint64(1) << nodes) - 1
+}
 
 func copyInNodemask(t *kernel.Task, addr hostarch.Addr, maxnode uint32) (uint64, error) {
 	// "nodemask points to a bit mask of node IDs that contains up to maxnode
@@ -57,7 +63,7 @@ func copyInNodemask(t *kernel.Task, addr hostarch.Addr, maxnode uint32) (uint64,
 	val := hostarch.ByteOrder.Uint64(buf)
 	// Check that only allowed bits in the first unsigned long in the nodemask
 	// are set.
-	if val&^allowedNodemask != 0 {
+	if val&^allowedNodemask(t) != 0 {
 		return 0, linuxerr.EINVAL
 	}
 	// Check that all remaining bits in the nodemask are 0.
@@ -118,7 +124,7 @@ func GetMempolicy(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 
 	// "EINVAL: The value specified by maxnode is less than the number of node
 	// IDs supported by the system." - get_mempolicy(2)
-	if nodemask != 0 && maxnode < maxNodes {
+	if nodemask != 0 && uint(maxnode) < t.Kernel().NUMANodes() {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -132,7 +138,7 @@ func GetMempolicy(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 		if nodeFlag || addrFlag {
 			return 0, nil, linuxerr.EINVAL
 		}
-		if err := copyOutNodemask(t, nodemask, maxnode, allowedNodemask); err != nil {
+		if err := copyOutNodemask(t, nodemask, maxnode, allowedNodemask(t)); err != nil {
 			return 0, nil, err
 		}
 		return 0, nil, nil
@@ -163,7 +169,11 @@ func GetMempolicy(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 			if err != nil {
 				return 0, nil, err
 			}
-			policy = linux.MPOL_DEFAULT // maxNodes == 1
+			node, ok := t.MemoryManager().NUMANodeOf(addr)
+			if !ok {
+				return 0, nil, linuxerr.EFAULT
+			}
+			policy = linux.NumaPolicy(node)
 		}
 		if mode != 0 {
 			if _, err := policy.CopyOut(t, mode); err != nil {
@@ -200,7 +210,9 @@ func GetMempolicy(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (ui
 		if policy&^linux.MPOL_MODE_FLAGS != linux.MPOL_INTERLEAVE {
 			return 0, nil, linuxerr.EINVAL
 		}
-		policy = linux.MPOL_DEFAULT // maxNodes == 1
+		// We don't interleave internal kernel pages, so report the first
+		// node in the interleave set.
+		policy = linux.NumaPolicy(bits.TrailingZeros64(nodemaskVal))
 	}
 	if mode != 0 {
 		if _, err := policy.CopyOut(t, mode); err != nil {
@@ -253,8 +265,8 @@ func Mbind(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		return 0, nil, err
 	}
 
-	// Since we claim to have only a single node, all flags can be ignored
-	// (since all pages must already be on that single node).
+	// Existing pages are never migrated between nodes, so MPOL_MF_MOVE and
+	// MPOL_MF_MOVE_ALL are ignored, as is MPOL_MF_STRICT.
 	err = t.MemoryManager().SetNumaPolicy(addr, length, mode, nodemaskVal)
 	return 0, nil, err
 }
@@ -87,7 +87,7 @@ func processVMOp(t *kernel.Task, args arch.SyscallArguments, op processVMOpType)
 	case processVMOpRead:
 		// Read from remote process and write into local.
 		opArgs = processVMOpArgs{
-			readCtx:         remoteTask.CopyContext(t, usermem.IOOpts{}),
+			readCtx:         remoteTask.CopyContext(t, usermem.IOOpts{Remote: true}),
 			readAddr:        rvec,
 			readIovecCount:  riovcnt,
 			writeCtx:        t.CopyContext(t, usermem.IOOpts{AddressSpaceActive: true}),
@@ -100,7 +100,7 @@ func processVMOp(t *kernel.Task, args arch.SyscallArguments, op processVMOpType)
 			readCtx:         t.CopyContext(t, usermem.IOOpts{AddressSpaceActive: true}),
 			readAddr:        lvec,
 			readIovecCount:  liovcnt,
-			writeCtx:        remoteTask.CopyContext(t, usermem.IOOpts{}),
+			writeCtx:        remoteTask.CopyContext(t, usermem.IOOpts{Remote: true}),
 			writeAddr:       rvec,
 			writeIovecCount: riovcnt,
 		}
@@ -974,7 +974,7 @@ func SendMsg(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr
 	}
 
 	// Reject flags that we don't handle yet.
-	if flags & ^(linux.MSG_DONTWAIT|linux.MSG_EOR|linux.MSG_MORE|linux.MSG_NOSIGNAL) != 0 {
+	if flags & ^(linux.MSG_DONTWAIT|linux.MSG_EOR|linux.MSG_MORE|linux.MSG_NOSIGNAL|linux.MSG_FASTOPEN) != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -1016,7 +1016,7 @@ func SendMMsg(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintpt
 	}
 
 	// Reject flags that we don't handle yet.
-	if flags & ^(linux.MSG_DONTWAIT|linux.MSG_EOR|linux.MSG_MORE|linux.MSG_NOSIGNAL) != 0 {
+	if flags & ^(linux.MSG_DONTWAIT|linux.MSG_EOR|linux.MSG_MORE|linux.MSG_NOSIGNAL|linux.MSG_FASTOPEN) != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
 
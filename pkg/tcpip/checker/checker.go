@@ -443,6 +443,30 @@ func ReceiveOriginalDstAddr(want tcpip.FullAddress) ControlMessagesChecker {
 	}
 }
 
+// ReceiveUDPGROSize creates a checker that checks the UDPGROSize field in
+// ControlMessages.
+func ReceiveUDPGROSize(want uint16) ControlMessagesChecker {
+	return func(t *testing.T, cm tcpip.ReceivableControlMessages) {
+		t.Helper()
+		if !cm.HasUDPGROSize {
+			t.Error("got cm.HasUDPGROSize = false, want = true")
+		} else if got := cm.UDPGROSize; got != want {
+			t.Errorf("got cm.UDPGROSize = %d, want %d", got, want)
+		}
+	}
+}
+
+// NoUDPGROSizeReceived creates a checker that checks the absence of the
+// UDPGROSize field in ControlMessages.
+func NoUDPGROSizeReceived() ControlMessagesChecker {
+	return func(t *testing.T, cm tcpip.ReceivableControlMessages) {
+		t.Helper()
+		if cm.HasUDPGROSize {
+			t.Error("got cm.HasUDPGROSize = true, want = false")
+		}
+	}
+}
+
 // TOS creates a checker that checks the TOS field.
 func TOS(tos uint8, label uint32) NetworkChecker {
 	return func(t *testing.T, h []header.Network) {
@@ -488,6 +488,19 @@ func (*ErrNotSupported) IgnoreStats() bool {
 }
 func (*ErrNotSupported) String() string { return "operation not supported" }
 
+// ErrPermissionDenied indicates the operation is prohibited by policy.
+//
+// +stateify savable
+type ErrPermissionDenied struct{}
+
+func (*ErrPermissionDenied) isError() {}
+
+// IgnoreStats implements Error.
+func (*ErrPermissionDenied) IgnoreStats() bool {
+	return false
+}
+func (*ErrPermissionDenied) String() string { return "permission denied" }
+
 // ErrPortInUse indicates the provided port is in use.
 //
 // +stateify savable
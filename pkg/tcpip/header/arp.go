@@ -41,6 +41,11 @@ const (
 	// https://www.iana.org/assignments/arp-parameters/arp-parameters.xhtml#arp-parameters-2
 	ARPHardwareEther    ARPHardwareType = 1
 	ARPHardwareLoopback ARPHardwareType = 2
+	// ARPHardwareTunnel, ARPHardwareSIT and ARPHardwareIPGRE identify IP-in-IP,
+	// IPv6-in-IPv4 and GRE tunnels. They are never put on the wire.
+	ARPHardwareTunnel ARPHardwareType = 3
+	ARPHardwareSIT    ARPHardwareType = 4
+	ARPHardwareIPGRE  ARPHardwareType = 5
 )
 
 // ARPOp is an ARP opcode.
@@ -0,0 +1,59 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	espSPI = 0
+	espSeq = 4
+)
+
+const (
+	// ESPProtocolNumber is the IP protocol number of the IPsec Encapsulating
+	// Security Payload (RFC 4303).
+	ESPProtocolNumber tcpip.TransportProtocolNumber = 50
+
+	// ESPHeaderSize is the size of an ESP header, which is followed by the
+	// payload data, including any IV, and the ICV.
+	ESPHeaderSize = 8
+
+	// ESPTrailerSize is the size of the pad length and next header fields
+	// that end the encrypted payload of an ESP packet.
+	ESPTrailerSize = 2
+)
+
+// ESP represents an ESP header stored in a byte array.
+type ESP []byte
+
+// SPI returns the security parameters index.
+func (b ESP) SPI() uint32 {
+	return binary.BigEndian.Uint32(b[espSPI:])
+}
+
+// SequenceNumber returns the sequence number.
+func (b ESP) SequenceNumber() uint32 {
+	return binary.BigEndian.Uint32(b[espSeq:])
+}
+
+// Encode encodes the ESP header with the given SPI and sequence number.
+func (b ESP) Encode(spi, seq uint32) {
+	binary.BigEndian.PutUint32(b[espSPI:], spi)
+	binary.BigEndian.PutUint32(b[espSeq:], seq)
+}
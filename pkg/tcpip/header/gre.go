@@ -0,0 +1,213 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	greFlagsVersion = 0
+	greProtocolType = 2
+)
+
+const (
+	// GREProtocolNumber is GRE's IP protocol number.
+	GREProtocolNumber tcpip.TransportProtocolNumber = 47
+
+	// IPIPProtocolNumber is the IP protocol number of IPv4 encapsulated in
+	// IP (RFC 2003).
+	IPIPProtocolNumber tcpip.TransportProtocolNumber = 4
+
+	// IPv6EncapsulationProtocolNumber is the IP protocol number of IPv6
+	// encapsulated in IP (RFC 2473, RFC 4213).
+	IPv6EncapsulationProtocolNumber tcpip.TransportProtocolNumber = 41
+
+	// GREMinimumSize is the size of a GRE header without any of the
+	// optional fields.
+	GREMinimumSize = 4
+
+	// GREMaximumSize is the size of a GRE header with all optional fields
+	// present.
+	GREMaximumSize = GREMinimumSize + 12
+
+	// GREChecksumPresent is the C bit of the GRE flags.
+	GREChecksumPresent = 0x8000
+
+	// GREKeyPresent is the K bit of the GRE flags, from RFC 2890.
+	GREKeyPresent = 0x2000
+
+	// GRESequencePresent is the S bit of the GRE flags, from RFC 2890.
+	GRESequencePresent = 0x1000
+
+	// GREVersionMask is the mask of the version bits of the GRE flags.
+	GREVersionMask = 0x7
+
+	// greUnsupportedFlags are the flags that must be zero in a GRE version 0
+	// header: the deprecated routing, strict source route and recursion
+	// control bits and the reserved flags.
+	greUnsupportedFlags = 0x4ff8
+
+	// GRETransparentEthernetBridging is the GRE protocol type of Ethernet
+	// frames carried by gretap tunnels.
+	GRETransparentEthernetBridging tcpip.NetworkProtocolNumber = 0x6558
+)
+
+// GREFields contains the fields of a GRE header. It is used to describe the
+// fields of a packet that needs to be encoded.
+type GREFields struct {
+	// Protocol is the protocol type of the payload, an ethertype.
+	Protocol tcpip.NetworkProtocolNumber
+
+	// ChecksumPresent indicates whether a checksum field is present. The
+	// checksum itself is set with SetChecksum once the payload is known.
+	ChecksumPresent bool
+
+	// KeyPresent indicates whether Key is present.
+	KeyPresent bool
+
+	// Key is the GRE key.
+	Key uint32
+
+	// SequencePresent indicates whether Sequence is present.
+	SequencePresent bool
+
+	// Sequence is the GRE sequence number.
+	Sequence uint32
+}
+
+// GREHeaderSize returns the size of a GRE header with the given fields.
+func GREHeaderSize(f *GREFields) int {
+	size := GREMinimumSize
+	if f.ChecksumPresent {
+		size += 4
+	}
+	if f.KeyPresent {
+		size += 4
+	}
+	if f.SequencePresent {
+		size += 4
+	}
+	return size
+}
+
+// GRE represents a GRE header stored in a byte array, as described in RFC 2784
+// and RFC 2890.
+type GRE []byte
+
+// Flags returns the flags and version field of the GRE header.
+func (b GRE) Flags() uint16 {
+	return binary.BigEndian.Uint16(b[greFlagsVersion:])
+}
+
+// Version returns the GRE version.
+func (b GRE) Version() uint8 {
+	return uint8(b.Flags() & GREVersionMask)
+}
+
+// Protocol returns the protocol type of the payload.
+func (b GRE) Protocol() tcpip.NetworkProtocolNumber {
+	return tcpip.NetworkProtocolNumber(binary.BigEndian.Uint16(b[greProtocolType:]))
+}
+
+// HeaderLength returns the length of the GRE header including the optional
+// fields indicated by its flags.
+func (b GRE) HeaderLength() int {
+	flags := b.Flags()
+	return GREHeaderSize(&GREFields{
+		ChecksumPresent: flags&GREChecksumPresent != 0,
+		KeyPresent:      flags&GREKeyPresent != 0,
+		SequencePresent: flags&GRESequencePresent != 0,
+	})
+}
+
+// IsValid returns true if b holds a complete GRE version 0 header without
+// deprecated RFC 1701 fields.
+func (b GRE) IsValid() bool {
+	if len(b) < GREMinimumSize {
+		return false
+	}
+	if b.Flags()&(greUnsupportedFlags|GREVersionMask) != 0 {
+		return false
+	}
+	return len(b) >= b.HeaderLength()
+}
+
+// Checksum returns the checksum field and whether it is present.
+func (b GRE) Checksum() (uint16, bool) {
+	if b.Flags()&GREChecksumPresent == 0 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(b[GREMinimumSize:]), true
+}
+
+// SetChecksum sets the checksum field. The checksum must be present.
+func (b GRE) SetChecksum(xsum uint16) {
+	binary.BigEndian.PutUint16(b[GREMinimumSize:], xsum)
+}
+
+// Key returns the GRE key and whether it is present.
+func (b GRE) Key() (uint32, bool) {
+	flags := b.Flags()
+	if flags&GREKeyPresent == 0 {
+		return 0, false
+	}
+	off := GREMinimumSize
+	if flags&GREChecksumPresent != 0 {
+		off += 4
+	}
+	return binary.BigEndian.Uint32(b[off:]), true
+}
+
+// Sequence returns the GRE sequence number and whether it is present.
+func (b GRE) Sequence() (uint32, bool) {
+	flags := b.Flags()
+	if flags&GRESequencePresent == 0 {
+		return 0, false
+	}
+	off := GREMinimumSize
+	if flags&GREChecksumPresent != 0 {
+		off += 4
+	}
+	if flags&GREKeyPresent != 0 {
+		off += 4
+	}
+	return binary.BigEndian.Uint32(b[off:]), true
+}
+
+// Encode encodes all the fields of the GRE header. b must be
+// GREHeaderSize(f) bytes long. The checksum, if present, is zeroed.
+func (b GRE) Encode(f *GREFields) {
+	var flags uint16
+	off := GREMinimumSize
+	if f.ChecksumPresent {
+		flags |= GREChecksumPresent
+		binary.BigEndian.PutUint32(b[off:], 0)
+		off += 4
+	}
+	if f.KeyPresent {
+		flags |= GREKeyPresent
+		binary.BigEndian.PutUint32(b[off:], f.Key)
+		off += 4
+	}
+	if f.SequencePresent {
+		flags |= GRESequencePresent
+		binary.BigEndian.PutUint32(b[off:], f.Sequence)
+	}
+	binary.BigEndian.PutUint16(b[greFlagsVersion:], flags)
+	binary.BigEndian.PutUint16(b[greProtocolType:], uint16(f.Protocol))
+}
@@ -189,6 +189,16 @@ const (
 	IPv4FlagDontFragment
 )
 
+// Explicit Congestion Notification codepoints carried in the low two bits of
+// the IPv4 TOS and IPv6 Traffic Class fields, as per RFC 3168 section 5.
+const (
+	ECNMask   = 0x3
+	ECNNotECT = 0x0
+	ECNECT1   = 0x1
+	ECNECT0   = 0x2
+	ECNCE     = 0x3
+)
+
 // ipv4LinkLocalUnicastSubnet is the IPv4 link local unicast subnet as defined
 // by RFC 3927 section 1.
 var ipv4LinkLocalUnicastSubnet = func() tcpip.Subnet {
@@ -421,6 +431,11 @@ func (b IPv4) SetTTL(v byte) {
 	b[ttl] = v
 }
 
+// SetProtocol sets the "protocol" field of the IPv4 header.
+func (b IPv4) SetProtocol(v uint8) {
+	b[protocol] = v
+}
+
 // SetTotalLength sets the "total length" field of the IPv4 header.
 func (b IPv4) SetTotalLength(totalLength uint16) {
 	binary.BigEndian.PutUint16(b[IPv4TotalLenOffset:], totalLength)
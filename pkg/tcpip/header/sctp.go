@@ -0,0 +1,576 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	sctpSrcPort  = 0
+	sctpDstPort  = 2
+	sctpVerTag   = 4
+	sctpChecksum = 8
+)
+
+const (
+	// SCTPProtocolNumber is SCTP's transport protocol number.
+	SCTPProtocolNumber tcpip.TransportProtocolNumber = 132
+
+	// SCTPMinimumSize is the size of the SCTP common header.
+	SCTPMinimumSize = 12
+
+	// SCTPChunkHeaderSize is the size of the type, flags and length fields
+	// that start every chunk.
+	SCTPChunkHeaderSize = 4
+
+	// SCTPParamHeaderSize is the size of the type and length fields that
+	// start every chunk parameter and error cause.
+	SCTPParamHeaderSize = 4
+)
+
+var sctpCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SCTPFields contains the fields of an SCTP common header. It is used to
+// describe the fields of a packet that needs to be encoded.
+type SCTPFields struct {
+	// SrcPort is the "source port" field of the SCTP common header.
+	SrcPort uint16
+
+	// DstPort is the "destination port" field of the SCTP common header.
+	DstPort uint16
+
+	// VerificationTag is the "verification tag" field of the SCTP common
+	// header.
+	VerificationTag uint32
+}
+
+// SCTP represents an SCTP common header stored in a byte array.
+type SCTP []byte
+
+// SourcePort returns the "source port" field of the SCTP header.
+func (b SCTP) SourcePort() uint16 {
+	return binary.BigEndian.Uint16(b[sctpSrcPort:])
+}
+
+// DestinationPort returns the "destination port" field of the SCTP header.
+func (b SCTP) DestinationPort() uint16 {
+	return binary.BigEndian.Uint16(b[sctpDstPort:])
+}
+
+// VerificationTag returns the "verification tag" field of the SCTP header.
+func (b SCTP) VerificationTag() uint32 {
+	return binary.BigEndian.Uint32(b[sctpVerTag:])
+}
+
+// Checksum returns the "checksum" field of the SCTP header.
+//
+// Unlike the TCP and UDP checksums, the SCTP checksum is a CRC32c which is
+// transmitted in little-endian byte order (RFC 4960 Appendix B).
+func (b SCTP) Checksum() uint32 {
+	return binary.LittleEndian.Uint32(b[sctpChecksum:])
+}
+
+// SetSourcePort sets the "source port" field of the SCTP header.
+func (b SCTP) SetSourcePort(port uint16) {
+	binary.BigEndian.PutUint16(b[sctpSrcPort:], port)
+}
+
+// SetDestinationPort sets the "destination port" field of the SCTP header.
+func (b SCTP) SetDestinationPort(port uint16) {
+	binary.BigEndian.PutUint16(b[sctpDstPort:], port)
+}
+
+// SetChecksum sets the "checksum" field of the SCTP header.
+func (b SCTP) SetChecksum(checksum uint32) {
+	binary.LittleEndian.PutUint32(b[sctpChecksum:], checksum)
+}
+
+// Encode encodes all the fields of the SCTP common header, zeroing the
+// checksum.
+func (b SCTP) Encode(s *SCTPFields) {
+	binary.BigEndian.PutUint16(b[sctpSrcPort:], s.SrcPort)
+	binary.BigEndian.PutUint16(b[sctpDstPort:], s.DstPort)
+	binary.BigEndian.PutUint32(b[sctpVerTag:], s.VerificationTag)
+	binary.LittleEndian.PutUint32(b[sctpChecksum:], 0)
+}
+
+// CalculateChecksum calculates the CRC32c of the SCTP packet made up of the
+// common header in b followed by payload. The checksum field is treated as
+// zero.
+func (b SCTP) CalculateChecksum(payload []byte) uint32 {
+	var hdr [SCTPMinimumSize]byte
+	copy(hdr[:], b[:sctpChecksum])
+	crc := crc32.Update(0, sctpCRCTable, hdr[:])
+	return crc32.Update(crc, sctpCRCTable, payload)
+}
+
+// IsChecksumValid returns true iff the checksum in the SCTP common header
+// matches the CRC32c of the header and payload.
+func (b SCTP) IsChecksumValid(payload []byte) bool {
+	return b.CalculateChecksum(payload) == b.Checksum()
+}
+
+// SCTPChunkType is the type of an SCTP chunk.
+type SCTPChunkType uint8
+
+// SCTP chunk types, as per RFC 4960 section 3.2.
+const (
+	SCTPChunkData             SCTPChunkType = 0
+	SCTPChunkInit             SCTPChunkType = 1
+	SCTPChunkInitAck          SCTPChunkType = 2
+	SCTPChunkSack             SCTPChunkType = 3
+	SCTPChunkHeartbeat        SCTPChunkType = 4
+	SCTPChunkHeartbeatAck     SCTPChunkType = 5
+	SCTPChunkAbort            SCTPChunkType = 6
+	SCTPChunkShutdown         SCTPChunkType = 7
+	SCTPChunkShutdownAck      SCTPChunkType = 8
+	SCTPChunkError            SCTPChunkType = 9
+	SCTPChunkCookieEcho       SCTPChunkType = 10
+	SCTPChunkCookieAck        SCTPChunkType = 11
+	SCTPChunkShutdownComplete SCTPChunkType = 14
+)
+
+// SCTP chunk flags.
+const (
+	// SCTPDataFlagEnd marks the last fragment of a user message.
+	SCTPDataFlagEnd = 1 << 0
+
+	// SCTPDataFlagBegin marks the first fragment of a user message.
+	SCTPDataFlagBegin = 1 << 1
+
+	// SCTPDataFlagUnordered marks an unordered user message.
+	SCTPDataFlagUnordered = 1 << 2
+
+	// SCTPDataFlagImmediate asks the peer to SACK without delay (RFC 7053).
+	SCTPDataFlagImmediate = 1 << 3
+
+	// SCTPFlagTBit is the T bit of the ABORT and SHUTDOWN COMPLETE chunks.
+	// It is set when the sender reflected the receiver's verification tag
+	// instead of using its own.
+	SCTPFlagTBit = 1 << 0
+)
+
+// SCTPParamType is the type of an SCTP chunk parameter.
+type SCTPParamType uint16
+
+// SCTP chunk parameter types.
+const (
+	SCTPParamHeartbeatInfo      SCTPParamType = 1
+	SCTPParamIPv4Address        SCTPParamType = 5
+	SCTPParamIPv6Address        SCTPParamType = 6
+	SCTPParamStateCookie        SCTPParamType = 7
+	SCTPParamUnrecognized       SCTPParamType = 8
+	SCTPParamCookiePreservative SCTPParamType = 9
+	SCTPParamSupportedAddrTypes SCTPParamType = 12
+)
+
+// SCTP error cause codes, as per RFC 4960 section 3.3.10.
+const (
+	SCTPCauseInvalidStream      = 1
+	SCTPCauseMissingParam       = 2
+	SCTPCauseStaleCookie        = 3
+	SCTPCauseOutOfResource      = 4
+	SCTPCauseUnresolvableAddr   = 5
+	SCTPCauseUnrecognizedChunk  = 6
+	SCTPCauseInvalidParam       = 7
+	SCTPCauseNoUserData         = 9
+	SCTPCauseUserInitiatedAbort = 12
+	SCTPCauseProtocolViolation  = 13
+)
+
+// SCTPPadLen returns l rounded up to a multiple of 4, the alignment of chunks
+// and parameters.
+func SCTPPadLen(l int) int {
+	return (l + 3) &^ 3
+}
+
+// SCTPChunk represents a single SCTP chunk stored in a byte array. The slice
+// covers the chunk's declared length, not including any trailing padding.
+type SCTPChunk []byte
+
+// Type returns the "chunk type" field.
+func (c SCTPChunk) Type() SCTPChunkType {
+	return SCTPChunkType(c[0])
+}
+
+// Flags returns the "chunk flags" field.
+func (c SCTPChunk) Flags() uint8 {
+	return c[1]
+}
+
+// Length returns the "chunk length" field.
+func (c SCTPChunk) Length() uint16 {
+	return binary.BigEndian.Uint16(c[2:])
+}
+
+// Value returns the chunk value, i.e. everything after the chunk header.
+func (c SCTPChunk) Value() []byte {
+	return c[SCTPChunkHeaderSize:]
+}
+
+// EncodeSCTPChunkHeader writes a chunk header with the given type and flags
+// to b and sets its length to SCTPChunkHeaderSize+valueLen.
+func EncodeSCTPChunkHeader(b []byte, typ SCTPChunkType, flags uint8, valueLen int) {
+	b[0] = uint8(typ)
+	b[1] = flags
+	binary.BigEndian.PutUint16(b[2:], uint16(SCTPChunkHeaderSize+valueLen))
+}
+
+// NewSCTPChunk returns a chunk of the given type with room for valueLen bytes
+// of value and trailing padding. The returned slice includes the padding.
+func NewSCTPChunk(typ SCTPChunkType, flags uint8, valueLen int) []byte {
+	b := make([]byte, SCTPPadLen(SCTPChunkHeaderSize+valueLen))
+	EncodeSCTPChunkHeader(b, typ, flags, valueLen)
+	return b
+}
+
+// ParseSCTPChunks splits the payload of an SCTP packet into chunks. It returns
+// false if any chunk is malformed.
+func ParseSCTPChunks(b []byte) ([]SCTPChunk, bool) {
+	var chunks []SCTPChunk
+	for len(b) > 0 {
+		if len(b) < SCTPChunkHeaderSize {
+			return nil, false
+		}
+		l := int(binary.BigEndian.Uint16(b[2:]))
+		if l < SCTPChunkHeaderSize || l > len(b) {
+			return nil, false
+		}
+		chunks = append(chunks, SCTPChunk(b[:l]))
+		if p := SCTPPadLen(l); p < len(b) {
+			b = b[p:]
+		} else {
+			b = nil
+		}
+	}
+	return chunks, true
+}
+
+// SCTPParam is a single chunk parameter or error cause in type-length-value
+// format.
+type SCTPParam struct {
+	Type  SCTPParamType
+	Value []byte
+}
+
+// ParseSCTPParams parses a sequence of TLV parameters. It returns false if
+// any parameter is malformed.
+func ParseSCTPParams(b []byte) ([]SCTPParam, bool) {
+	var params []SCTPParam
+	for len(b) > 0 {
+		if len(b) < SCTPParamHeaderSize {
+			return nil, false
+		}
+		l := int(binary.BigEndian.Uint16(b[2:]))
+		if l < SCTPParamHeaderSize || l > len(b) {
+			return nil, false
+		}
+		params = append(params, SCTPParam{
+			Type:  SCTPParamType(binary.BigEndian.Uint16(b)),
+			Value: b[SCTPParamHeaderSize:l],
+		})
+		if p := SCTPPadLen(l); p < len(b) {
+			b = b[p:]
+		} else {
+			b = nil
+		}
+	}
+	return params, true
+}
+
+// SCTPParamsLen returns the encoded length of params including padding.
+func SCTPParamsLen(params []SCTPParam) int {
+	l := 0
+	for _, p := range params {
+		l += SCTPPadLen(SCTPParamHeaderSize + len(p.Value))
+	}
+	return l
+}
+
+// EncodeSCTPParams encodes params into b, which must be at least
+// SCTPParamsLen(params) bytes long, and returns the number of bytes written.
+func EncodeSCTPParams(b []byte, params []SCTPParam) int {
+	off := 0
+	for _, p := range params {
+		binary.BigEndian.PutUint16(b[off:], uint16(p.Type))
+		binary.BigEndian.PutUint16(b[off+2:], uint16(SCTPParamHeaderSize+len(p.Value)))
+		n := copy(b[off+SCTPParamHeaderSize:], p.Value)
+		end := off + SCTPParamHeaderSize + n
+		off += SCTPPadLen(SCTPParamHeaderSize + n)
+		clear(b[end:off])
+	}
+	return off
+}
+
+const (
+	sctpDataTSN      = 0
+	sctpDataStreamID = 4
+	sctpDataSSN      = 6
+	sctpDataPPID     = 8
+
+	// SCTPDataHeaderSize is the size of the DATA chunk value that precedes
+	// the user data.
+	SCTPDataHeaderSize = 12
+)
+
+// SCTPDataFields contains the fields of a DATA chunk.
+type SCTPDataFields struct {
+	Flags    uint8
+	TSN      uint32
+	StreamID uint16
+	SSN      uint16
+	PPID     uint32
+}
+
+// SCTPData is the value of a DATA chunk.
+type SCTPData []byte
+
+// TSN returns the "transmission sequence number" field.
+func (d SCTPData) TSN() uint32 {
+	return binary.BigEndian.Uint32(d[sctpDataTSN:])
+}
+
+// StreamID returns the "stream identifier" field.
+func (d SCTPData) StreamID() uint16 {
+	return binary.BigEndian.Uint16(d[sctpDataStreamID:])
+}
+
+// SSN returns the "stream sequence number" field.
+func (d SCTPData) SSN() uint16 {
+	return binary.BigEndian.Uint16(d[sctpDataSSN:])
+}
+
+// PPID returns the "payload protocol identifier" field. It is opaque to SCTP
+// and carried in network byte order, so it is returned unconverted.
+func (d SCTPData) PPID() uint32 {
+	return binary.NativeEndian.Uint32(d[sctpDataPPID:])
+}
+
+// UserData returns the user data carried by the chunk.
+func (d SCTPData) UserData() []byte {
+	return d[SCTPDataHeaderSize:]
+}
+
+// NewSCTPDataChunk returns an encoded DATA chunk, including padding, carrying
+// payload.
+func NewSCTPDataChunk(f *SCTPDataFields, payload []byte) []byte {
+	b := NewSCTPChunk(SCTPChunkData, f.Flags, SCTPDataHeaderSize+len(payload))
+	v := b[SCTPChunkHeaderSize:]
+	binary.BigEndian.PutUint32(v[sctpDataTSN:], f.TSN)
+	binary.BigEndian.PutUint16(v[sctpDataStreamID:], f.StreamID)
+	binary.BigEndian.PutUint16(v[sctpDataSSN:], f.SSN)
+	binary.NativeEndian.PutUint32(v[sctpDataPPID:], f.PPID)
+	copy(v[SCTPDataHeaderSize:], payload)
+	return b
+}
+
+const (
+	sctpInitTag        = 0
+	sctpInitARwnd      = 4
+	sctpInitOutStreams = 8
+	sctpInitInStreams  = 10
+	sctpInitTSN        = 12
+
+	// SCTPInitHeaderSize is the size of the fixed part of the INIT and
+	// INIT ACK chunk values.
+	SCTPInitHeaderSize = 16
+)
+
+// SCTPInitFields contains the fields of an INIT or INIT ACK chunk.
+type SCTPInitFields struct {
+	InitiateTag     uint32
+	ARwnd           uint32
+	OutboundStreams uint16
+	InboundStreams  uint16
+	InitialTSN      uint32
+	Params          []SCTPParam
+}
+
+// SCTPInit is the value of an INIT or INIT ACK chunk.
+type SCTPInit []byte
+
+// InitiateTag returns the "initiate tag" field.
+func (i SCTPInit) InitiateTag() uint32 {
+	return binary.BigEndian.Uint32(i[sctpInitTag:])
+}
+
+// ARwnd returns the "advertised receiver window credit" field.
+func (i SCTPInit) ARwnd() uint32 {
+	return binary.BigEndian.Uint32(i[sctpInitARwnd:])
+}
+
+// OutboundStreams returns the "number of outbound streams" field.
+func (i SCTPInit) OutboundStreams() uint16 {
+	return binary.BigEndian.Uint16(i[sctpInitOutStreams:])
+}
+
+// InboundStreams returns the "number of inbound streams" field.
+func (i SCTPInit) InboundStreams() uint16 {
+	return binary.BigEndian.Uint16(i[sctpInitInStreams:])
+}
+
+// InitialTSN returns the "initial TSN" field.
+func (i SCTPInit) InitialTSN() uint32 {
+	return binary.BigEndian.Uint32(i[sctpInitTSN:])
+}
+
+// Params parses the optional and variable-length parameters.
+func (i SCTPInit) Params() ([]SCTPParam, bool) {
+	return ParseSCTPParams(i[SCTPInitHeaderSize:])
+}
+
+// NewSCTPInitChunk returns an encoded INIT or INIT ACK chunk.
+func NewSCTPInitChunk(typ SCTPChunkType, f *SCTPInitFields) []byte {
+	b := NewSCTPChunk(typ, 0, SCTPInitHeaderSize+SCTPParamsLen(f.Params))
+	v := b[SCTPChunkHeaderSize:]
+	binary.BigEndian.PutUint32(v[sctpInitTag:], f.InitiateTag)
+	binary.BigEndian.PutUint32(v[sctpInitARwnd:], f.ARwnd)
+	binary.BigEndian.PutUint16(v[sctpInitOutStreams:], f.OutboundStreams)
+	binary.BigEndian.PutUint16(v[sctpInitInStreams:], f.InboundStreams)
+	binary.BigEndian.PutUint32(v[sctpInitTSN:], f.InitialTSN)
+	EncodeSCTPParams(v[SCTPInitHeaderSize:], f.Params)
+	return b
+}
+
+// SCTPAddressParam returns the IPv4 or IPv6 address parameter for addr.
+func SCTPAddressParam(addr tcpip.Address) SCTPParam {
+	typ := SCTPParamIPv4Address
+	if addr.Len() == IPv6AddressSize {
+		typ = SCTPParamIPv6Address
+	}
+	return SCTPParam{Type: typ, Value: addr.AsSlice()}
+}
+
+// ParseSCTPAddressParam returns the address carried by an IPv4 or IPv6
+// address parameter.
+func ParseSCTPAddressParam(p SCTPParam) (tcpip.Address, bool) {
+	switch {
+	case p.Type == SCTPParamIPv4Address && len(p.Value) == IPv4AddressSize:
+		return tcpip.AddrFrom4Slice(p.Value), true
+	case p.Type == SCTPParamIPv6Address && len(p.Value) == IPv6AddressSize:
+		return tcpip.AddrFrom16Slice(p.Value), true
+	default:
+		return tcpip.Address{}, false
+	}
+}
+
+const (
+	sctpSackCumTSN  = 0
+	sctpSackARwnd   = 4
+	sctpSackNumGaps = 8
+	sctpSackNumDups = 10
+
+	// SCTPSackHeaderSize is the size of the fixed part of a SACK chunk
+	// value.
+	SCTPSackHeaderSize = 12
+)
+
+// SCTPGapBlock is a gap ack block of a SACK chunk. Start and End are offsets
+// from the cumulative TSN ack.
+type SCTPGapBlock struct {
+	Start uint16
+	End   uint16
+}
+
+// SCTPSackFields contains the fields of a SACK chunk.
+type SCTPSackFields struct {
+	CumTSNAck uint32
+	ARwnd     uint32
+	Gaps      []SCTPGapBlock
+	Dups      []uint32
+}
+
+// SCTPSack is the value of a SACK chunk.
+type SCTPSack []byte
+
+// CumTSNAck returns the "cumulative TSN ack" field.
+func (s SCTPSack) CumTSNAck() uint32 {
+	return binary.BigEndian.Uint32(s[sctpSackCumTSN:])
+}
+
+// ARwnd returns the "advertised receiver window credit" field.
+func (s SCTPSack) ARwnd() uint32 {
+	return binary.BigEndian.Uint32(s[sctpSackARwnd:])
+}
+
+// Gaps returns the gap ack blocks, or false if the chunk is truncated.
+func (s SCTPSack) Gaps() ([]SCTPGapBlock, bool) {
+	n := int(binary.BigEndian.Uint16(s[sctpSackNumGaps:]))
+	d := int(binary.BigEndian.Uint16(s[sctpSackNumDups:]))
+	if len(s) < SCTPSackHeaderSize+4*n+4*d {
+		return nil, false
+	}
+	gaps := make([]SCTPGapBlock, n)
+	for i := range gaps {
+		off := SCTPSackHeaderSize + 4*i
+		gaps[i] = SCTPGapBlock{
+			Start: binary.BigEndian.Uint16(s[off:]),
+			End:   binary.BigEndian.Uint16(s[off+2:]),
+		}
+	}
+	return gaps, true
+}
+
+// NewSCTPSackChunk returns an encoded SACK chunk.
+func NewSCTPSackChunk(f *SCTPSackFields) []byte {
+	b := NewSCTPChunk(SCTPChunkSack, 0, SCTPSackHeaderSize+4*len(f.Gaps)+4*len(f.Dups))
+	v := b[SCTPChunkHeaderSize:]
+	binary.BigEndian.PutUint32(v[sctpSackCumTSN:], f.CumTSNAck)
+	binary.BigEndian.PutUint32(v[sctpSackARwnd:], f.ARwnd)
+	binary.BigEndian.PutUint16(v[sctpSackNumGaps:], uint16(len(f.Gaps)))
+	binary.BigEndian.PutUint16(v[sctpSackNumDups:], uint16(len(f.Dups)))
+	off := SCTPSackHeaderSize
+	for _, g := range f.Gaps {
+		binary.BigEndian.PutUint16(v[off:], g.Start)
+		binary.BigEndian.PutUint16(v[off+2:], g.End)
+		off += 4
+	}
+	for _, d := range f.Dups {
+		binary.BigEndian.PutUint32(v[off:], d)
+		off += 4
+	}
+	return b
+}
+
+// NewSCTPShutdownChunk returns an encoded SHUTDOWN chunk.
+func NewSCTPShutdownChunk(cumTSNAck uint32) []byte {
+	b := NewSCTPChunk(SCTPChunkShutdown, 0, 4)
+	binary.BigEndian.PutUint32(b[SCTPChunkHeaderSize:], cumTSNAck)
+	return b
+}
+
+// SCTPShutdownCumTSNAck returns the "cumulative TSN ack" field of the value
+// of a SHUTDOWN chunk.
+func SCTPShutdownCumTSNAck(v []byte) uint32 {
+	return binary.BigEndian.Uint32(v)
+}
+
+// NewSCTPParamChunk returns an encoded chunk whose value is a sequence of
+// parameters or error causes, e.g. HEARTBEAT, ABORT or ERROR.
+func NewSCTPParamChunk(typ SCTPChunkType, flags uint8, params []SCTPParam) []byte {
+	b := NewSCTPChunk(typ, flags, SCTPParamsLen(params))
+	EncodeSCTPParams(b[SCTPChunkHeaderSize:], params)
+	return b
+}
+
+// NewSCTPErrorCause returns an error cause with the given code and
+// information.
+func NewSCTPErrorCause(code uint16, info []byte) SCTPParam {
+	return SCTPParam{Type: SCTPParamType(code), Value: info}
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package header_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestSCTPChecksum(t *testing.T) {
+	// The CRC32c of 32 zero bytes is 0x8a9136aa (RFC 3720 section B.4). The
+	// checksum field counts as zero, so a zeroed header followed by 20 zero
+	// bytes must produce the same value.
+	h := header.SCTP(make([]byte, header.SCTPMinimumSize))
+	h.SetChecksum(0xffffffff)
+	if got, want := h.CalculateChecksum(make([]byte, 20)), uint32(0x8a9136aa); got != want {
+		t.Fatalf("got CalculateChecksum(...) = %#x, want = %#x", got, want)
+	}
+
+	h.Encode(&header.SCTPFields{SrcPort: 1234, DstPort: 5678, VerificationTag: 0xdeadbeef})
+	payload := header.NewSCTPChunk(header.SCTPChunkCookieAck, 0, 0)
+	h.SetChecksum(h.CalculateChecksum(payload))
+	if !h.IsChecksumValid(payload) {
+		t.Errorf("got IsChecksumValid(...) = false, want = true")
+	}
+	if got, want := h.SourcePort(), uint16(1234); got != want {
+		t.Errorf("got SourcePort() = %d, want = %d", got, want)
+	}
+	if got, want := h.DestinationPort(), uint16(5678); got != want {
+		t.Errorf("got DestinationPort() = %d, want = %d", got, want)
+	}
+	if got, want := h.VerificationTag(), uint32(0xdeadbeef); got != want {
+		t.Errorf("got VerificationTag() = %#x, want = %#x", got, want)
+	}
+	payload[0] ^= 1
+	if h.IsChecksumValid(payload) {
+		t.Errorf("got IsChecksumValid(...) = true after corrupting the payload, want = false")
+	}
+}
+
+func TestSCTPChunks(t *testing.T) {
+	data := header.NewSCTPDataChunk(&header.SCTPDataFields{
+		Flags:    header.SCTPDataFlagBegin | header.SCTPDataFlagEnd,
+		TSN:      100,
+		StreamID: 3,
+		SSN:      7,
+		PPID:     42,
+	}, []byte("hello"))
+	addr := tcpip.AddrFrom4([4]byte{10, 0, 0, 1})
+	init := header.NewSCTPInitChunk(header.SCTPChunkInit, &header.SCTPInitFields{
+		InitiateTag:     1,
+		ARwnd:           65536,
+		OutboundStreams: 10,
+		InboundStreams:  20,
+		InitialTSN:      99,
+		Params:          []header.SCTPParam{header.SCTPAddressParam(addr)},
+	})
+	sack := header.NewSCTPSackChunk(&header.SCTPSackFields{
+		CumTSNAck: 5,
+		ARwnd:     1000,
+		Gaps:      []header.SCTPGapBlock{{Start: 2, End: 3}, {Start: 6, End: 6}},
+		Dups:      []uint32{4},
+	})
+
+	var pkt []byte
+	pkt = append(pkt, data...)
+	pkt = append(pkt, init...)
+	pkt = append(pkt, sack...)
+	chunks, ok := header.ParseSCTPChunks(pkt)
+	if !ok {
+		t.Fatalf("ParseSCTPChunks(...) failed")
+	}
+	if got, want := len(chunks), 3; got != want {
+		t.Fatalf("got len(chunks) = %d, want = %d", got, want)
+	}
+
+	if got, want := chunks[0].Type(), header.SCTPChunkData; got != want {
+		t.Errorf("got chunks[0].Type() = %d, want = %d", got, want)
+	}
+	d := header.SCTPData(chunks[0].Value())
+	if d.TSN() != 100 || d.StreamID() != 3 || d.SSN() != 7 || d.PPID() != 42 {
+		t.Errorf("got DATA (TSN, SID, SSN, PPID) = (%d, %d, %d, %d), want = (100, 3, 7, 42)", d.TSN(), d.StreamID(), d.SSN(), d.PPID())
+	}
+	if !bytes.Equal(d.UserData(), []byte("hello")) {
+		t.Errorf("got UserData() = %q, want = %q", d.UserData(), "hello")
+	}
+
+	i := header.SCTPInit(chunks[1].Value())
+	if i.InitiateTag() != 1 || i.ARwnd() != 65536 || i.OutboundStreams() != 10 || i.InboundStreams() != 20 || i.InitialTSN() != 99 {
+		t.Errorf("got INIT fields = (%d, %d, %d, %d, %d), want = (1, 65536, 10, 20, 99)", i.InitiateTag(), i.ARwnd(), i.OutboundStreams(), i.InboundStreams(), i.InitialTSN())
+	}
+	params, ok := i.Params()
+	if !ok || len(params) != 1 {
+		t.Fatalf("got Params() = (%v, %t), want one parameter", params, ok)
+	}
+	if got, ok := header.ParseSCTPAddressParam(params[0]); !ok || got != addr {
+		t.Errorf("got ParseSCTPAddressParam(...) = (%s, %t), want = (%s, true)", got, ok, addr)
+	}
+
+	s := header.SCTPSack(chunks[2].Value())
+	if s.CumTSNAck() != 5 || s.ARwnd() != 1000 {
+		t.Errorf("got SACK (cum, arwnd) = (%d, %d), want = (5, 1000)", s.CumTSNAck(), s.ARwnd())
+	}
+	gaps, ok := s.Gaps()
+	if !ok {
+		t.Fatalf("Gaps() failed")
+	}
+	if diff := cmp.Diff([]header.SCTPGapBlock{{Start: 2, End: 3}, {Start: 6, End: 6}}, gaps); diff != "" {
+		t.Errorf("gap blocks mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSCTPMalformedChunks(t *testing.T) {
+	for _, b := range [][]byte{
+		{0, 0, 0},
+		{0, 0, 0, 2},
+		{0, 0, 0, 8, 0, 0, 0},
+	} {
+		if _, ok := header.ParseSCTPChunks(b); ok {
+			t.Errorf("ParseSCTPChunks(%v) succeeded, want failure", b)
+		}
+	}
+}
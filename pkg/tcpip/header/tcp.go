@@ -15,7 +15,9 @@
 package header
 
 import (
+	"crypto/md5"
 	"encoding/binary"
+	"hash"
 
 	"github.com/google/btree"
 	"gvisor.dev/gvisor/pkg/tcpip"
@@ -91,6 +93,8 @@ const (
 	TCPOptionTS            = 8
 	TCPOptionSACKPermitted = 4
 	TCPOptionSACK          = 5
+	TCPOptionMD5           = 19
+	TCPOptionFastOpen      = 34
 )
 
 // Option Lengths.
@@ -99,6 +103,18 @@ const (
 	TCPOptionTSLength            = 10
 	TCPOptionWSLength            = 3
 	TCPOptionSackPermittedLength = 2
+	TCPOptionMD5Length           = 18
+	TCPOptionFastOpenLength      = 2
+)
+
+// TCPMD5DigestSize is the size of the digest carried by the MD5 signature
+// option, see RFC 2385 section 3.0.
+const TCPMD5DigestSize = md5.Size
+
+// Fast Open cookie lengths, see RFC 7413 section 4.1.1.
+const (
+	TCPFastOpenCookieMinLength = 4
+	TCPFastOpenCookieMaxLength = 16
 )
 
 // TCPFields contains the fields of a TCP packet. It is used to describe the
@@ -158,6 +174,14 @@ type TCPSynOptions struct {
 	// SACKPermitted is true if the SACK option was provided in the SYN/SYN-ACK.
 	SACKPermitted bool
 
+	// FastOpen is true if the Fast Open option was provided in the
+	// SYN/SYN-ACK.
+	FastOpen bool
+
+	// FastOpenCookie is the cookie carried by the Fast Open option. It is
+	// empty if the option requests a cookie.
+	FastOpenCookie []byte
+
 	// Flags if specified are set on the outgoing SYN. The SYN flag is
 	// always set.
 	Flags TCPFlags
@@ -507,6 +531,22 @@ func ParseSynOptions(opts []byte, isAck bool) TCPSynOptions {
 			synOpts.SACKPermitted = true
 			i += 2
 
+		case TCPOptionFastOpen:
+			if i+2 > limit {
+				return synOpts
+			}
+			l := int(opts[i+1])
+			if l < TCPOptionFastOpenLength || i+l > limit {
+				return synOpts
+			}
+			// Options with a malformed cookie are ignored, see RFC 7413
+			// section 4.1.1.
+			if cookieLen := l - TCPOptionFastOpenLength; cookieLen == 0 || cookieLen >= TCPFastOpenCookieMinLength && cookieLen <= TCPFastOpenCookieMaxLength && cookieLen%2 == 0 {
+				synOpts.FastOpen = true
+				synOpts.FastOpenCookie = append([]byte(nil), opts[i+TCPOptionFastOpenLength:i+l]...)
+			}
+			i += l
+
 		default:
 			// We don't recognize this option, just skip over it.
 			if i+2 > limit {
@@ -633,6 +673,95 @@ func EncodeSACKPermittedOption(b []byte) int {
 	return int(b[1])
 }
 
+// EncodeFastOpenOption encodes a Fast Open option carrying the given cookie
+// into the provided buffer. An empty cookie requests one from the peer. If the
+// buffer is smaller than required it just returns without encoding anything.
+// It returns the number of bytes written to the provided buffer.
+func EncodeFastOpenOption(cookie []byte, b []byte) int {
+	l := TCPOptionFastOpenLength + len(cookie)
+	if len(b) < l {
+		return 0
+	}
+
+	b[0], b[1] = TCPOptionFastOpen, byte(l)
+	copy(b[TCPOptionFastOpenLength:], cookie)
+	return l
+}
+
+// EncodeMD5Option encodes an MD5 signature option with a zeroed digest into
+// the provided buffer. The digest is filled in once the segment is complete,
+// see NewTCPMD5Hash. If the buffer is smaller than required it just returns
+// without encoding anything. It returns the number of bytes written to the
+// provided buffer.
+func EncodeMD5Option(b []byte) int {
+	if len(b) < TCPOptionMD5Length {
+		return 0
+	}
+
+	b[0], b[1] = TCPOptionMD5, TCPOptionMD5Length
+	clear(b[2:TCPOptionMD5Length])
+	return TCPOptionMD5Length
+}
+
+// ParseMD5Option returns the digest carried by the MD5 signature option in the
+// provided options, if any. It returns false if the options do not carry a
+// well-formed MD5 signature option.
+func ParseMD5Option(b []byte) ([]byte, bool) {
+	limit := len(b)
+	for i := 0; i < limit; {
+		switch b[i] {
+		case TCPOptionEOL:
+			return nil, false
+		case TCPOptionNOP:
+			i++
+		default:
+			if i+2 > limit {
+				return nil, false
+			}
+			l := int(b[i+1])
+			if l < 2 || i+l > limit {
+				return nil, false
+			}
+			if b[i] == TCPOptionMD5 {
+				if l != TCPOptionMD5Length {
+					return nil, false
+				}
+				return b[i+2 : i+l], true
+			}
+			i += l
+		}
+	}
+	return nil, false
+}
+
+// NewTCPMD5Hash returns an MD5 hash of the pseudo-header and of the fixed part
+// of the header h of a TCP segment sent from src to dst and carrying
+// payloadLen bytes, as specified in RFC 2385 section 2.0. The options of h are
+// not covered and its checksum is taken to be zero. The signature of the
+// segment is obtained by writing its payload followed by the key to the hash.
+func NewTCPMD5Hash(h TCP, src, dst tcpip.Address, payloadLen int) hash.Hash {
+	d := md5.New()
+	length := len(h) + payloadLen
+	d.Write(src.AsSlice())
+	d.Write(dst.AsSlice())
+	if src.BitLen() == IPv4AddressSizeBits {
+		var b [4]byte
+		b[1] = uint8(TCPProtocolNumber)
+		binary.BigEndian.PutUint16(b[2:], uint16(length))
+		d.Write(b[:])
+	} else {
+		var b [8]byte
+		binary.BigEndian.PutUint32(b[:], uint32(length))
+		b[7] = uint8(TCPProtocolNumber)
+		d.Write(b[:])
+	}
+	var fixed [TCPMinimumSize]byte
+	copy(fixed[:], h[:TCPMinimumSize])
+	binary.BigEndian.PutUint16(fixed[TCPChecksumOffset:], 0)
+	d.Write(fixed[:])
+	return d
+}
+
 // EncodeSACKBlocks encodes the provided SACK blocks as a TCP SACK option block
 // in the provided slice. It tries to fit in as many blocks as possible based on
 // number of bytes available in the provided buffer. It returns the number of
@@ -15,10 +15,12 @@
 package header_test
 
 import (
+	"encoding/hex"
 	"reflect"
 	"slices"
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
 )
 
@@ -148,6 +150,195 @@ func TestTCPParseOptions(t *testing.T) {
 	}
 }
 
+func TestParseSynOptionsFastOpen(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		b          []byte
+		wantOption bool
+		wantCookie []byte
+	}{
+		{
+			name:       "cookie request",
+			b:          []byte{header.TCPOptionFastOpen, 2},
+			wantOption: true,
+			wantCookie: []byte{},
+		},
+		{
+			name:       "cookie",
+			b:          []byte{header.TCPOptionFastOpen, 10, 1, 2, 3, 4, 5, 6, 7, 8},
+			wantOption: true,
+			wantCookie: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		{
+			name: "cookie too short",
+			b:    []byte{header.TCPOptionFastOpen, 4, 1, 2},
+		},
+		{
+			name: "cookie with odd length",
+			b:    []byte{header.TCPOptionFastOpen, 7, 1, 2, 3, 4, 5},
+		},
+		{
+			name: "cookie too long",
+			b:    append([]byte{header.TCPOptionFastOpen, 20}, make([]byte, 18)...),
+		},
+		{
+			name: "truncated",
+			b:    []byte{header.TCPOptionFastOpen, 10, 1, 2, 3, 4},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := header.ParseSynOptions(tc.b, false /* isAck */)
+			if opts.FastOpen != tc.wantOption {
+				t.Errorf("got opts.FastOpen = %t, want = %t", opts.FastOpen, tc.wantOption)
+			}
+			if !slices.Equal(opts.FastOpenCookie, tc.wantCookie) {
+				t.Errorf("got opts.FastOpenCookie = %v, want = %v", opts.FastOpenCookie, tc.wantCookie)
+			}
+		})
+	}
+}
+
+func TestEncodeFastOpenOption(t *testing.T) {
+	cookie := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	b := make([]byte, header.TCPOptionFastOpenLength+len(cookie))
+	if got, want := header.EncodeFastOpenOption(cookie, b), len(b); got != want {
+		t.Fatalf("got header.EncodeFastOpenOption(%v, _) = %d, want = %d", cookie, got, want)
+	}
+	opts := header.ParseSynOptions(b, false /* isAck */)
+	if !opts.FastOpen || !slices.Equal(opts.FastOpenCookie, cookie) {
+		t.Errorf("got ParseSynOptions(%v, false) = {FastOpen: %t, FastOpenCookie: %v}, want = {FastOpen: true, FastOpenCookie: %v}", b, opts.FastOpen, opts.FastOpenCookie, cookie)
+	}
+
+	if got := header.EncodeFastOpenOption(cookie, b[:len(b)-1]); got != 0 {
+		t.Errorf("got header.EncodeFastOpenOption(%v, _) with a short buffer = %d, want = 0", cookie, got)
+	}
+}
+
+func TestParseMD5Option(t *testing.T) {
+	digest := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	for _, tc := range []struct {
+		name       string
+		b          []byte
+		wantOption bool
+	}{
+		{
+			name:       "option",
+			b:          append([]byte{header.TCPOptionMD5, header.TCPOptionMD5Length}, digest...),
+			wantOption: true,
+		},
+		{
+			name:       "after other options",
+			b:          append([]byte{header.TCPOptionNOP, header.TCPOptionNOP, header.TCPOptionTS, 10, 0, 0, 0, 1, 0, 0, 0, 2, header.TCPOptionNOP, header.TCPOptionNOP, header.TCPOptionMD5, header.TCPOptionMD5Length}, digest...),
+			wantOption: true,
+		},
+		{
+			name: "no option",
+			b:    []byte{header.TCPOptionNOP, header.TCPOptionNOP, header.TCPOptionTS, 10, 0, 0, 0, 1, 0, 0, 0, 2},
+		},
+		{
+			name: "after end of options",
+			b:    append([]byte{header.TCPOptionEOL, header.TCPOptionNOP, header.TCPOptionMD5, header.TCPOptionMD5Length}, digest...),
+		},
+		{
+			name: "bad length",
+			b:    append([]byte{header.TCPOptionMD5, header.TCPOptionMD5Length - 2}, digest[:14]...),
+		},
+		{
+			name: "truncated",
+			b:    append([]byte{header.TCPOptionMD5, header.TCPOptionMD5Length}, digest[:8]...),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := header.ParseMD5Option(tc.b)
+			if ok != tc.wantOption {
+				t.Fatalf("got header.ParseMD5Option(%v) = (_, %t), want = (_, %t)", tc.b, ok, tc.wantOption)
+			}
+			if ok && !slices.Equal(got, digest) {
+				t.Errorf("got header.ParseMD5Option(%v) = (%v, _), want = (%v, _)", tc.b, got, digest)
+			}
+		})
+	}
+}
+
+func TestEncodeMD5Option(t *testing.T) {
+	b := make([]byte, header.TCPOptionMD5Length)
+	for i := range b {
+		b[i] = 0xff
+	}
+	if got, want := header.EncodeMD5Option(b), header.TCPOptionMD5Length; got != want {
+		t.Fatalf("got header.EncodeMD5Option(_) = %d, want = %d", got, want)
+	}
+	digest, ok := header.ParseMD5Option(b)
+	if !ok {
+		t.Fatalf("got header.ParseMD5Option(%v) = (_, false), want = (_, true)", b)
+	}
+	if want := make([]byte, header.TCPMD5DigestSize); !slices.Equal(digest, want) {
+		t.Errorf("got digest = %v, want = %v", digest, want)
+	}
+
+	if got := header.EncodeMD5Option(b[:len(b)-1]); got != 0 {
+		t.Errorf("got header.EncodeMD5Option(_) with a short buffer = %d, want = 0", got)
+	}
+}
+
+func TestNewTCPMD5Hash(t *testing.T) {
+	payload := []byte("hello")
+	key := []byte("secret")
+	for _, tc := range []struct {
+		name string
+		src  tcpip.Address
+		dst  tcpip.Address
+		want string
+	}{
+		{
+			name: "IPv4",
+			src:  tcpip.AddrFrom4([4]byte{10, 0, 0, 1}),
+			dst:  tcpip.AddrFrom4([4]byte{10, 0, 0, 2}),
+			want: "9ddcee7b8f6393df8288cbe7b841c28f",
+		},
+		{
+			name: "IPv6",
+			src:  tcpip.AddrFrom16([16]byte{0xfe, 0x80, 15: 1}),
+			dst:  tcpip.AddrFrom16([16]byte{0xfe, 0x80, 15: 2}),
+			want: "1b1f55fa3039fd4a8d79ea7a5ed2eb02",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			const hdrLen = header.TCPMinimumSize + 20
+			h := header.TCP(make([]byte, hdrLen))
+			h.Encode(&header.TCPFields{
+				SrcPort:    1000,
+				DstPort:    2000,
+				SeqNum:     1,
+				DataOffset: hdrLen,
+				Flags:      header.TCPFlagSyn,
+				WindowSize: 0xffff,
+				Checksum:   0xabcd,
+			})
+			opts := h[header.TCPMinimumSize:]
+			offset := header.EncodeNOP(opts)
+			offset += header.EncodeNOP(opts[offset:])
+			header.EncodeMD5Option(opts[offset:])
+
+			d := header.NewTCPMD5Hash(h, tc.src, tc.dst, len(payload))
+			d.Write(payload)
+			d.Write(key)
+			if got := hex.EncodeToString(d.Sum(nil)); got != tc.want {
+				t.Errorf("got signature = %s, want = %s", got, tc.want)
+			}
+
+			// The signature does not cover the options.
+			opts[0] = header.TCPOptionEOL
+			d = header.NewTCPMD5Hash(h, tc.src, tc.dst, len(payload))
+			d.Write(payload)
+			d.Write(key)
+			if got := hex.EncodeToString(d.Sum(nil)); got != tc.want {
+				t.Errorf("got signature with different options = %s, want = %s", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestTCPFlags(t *testing.T) {
 	for _, tt := range []struct {
 		flags header.TCPFlags
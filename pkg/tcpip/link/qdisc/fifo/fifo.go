@@ -117,6 +117,9 @@ func (qd *queueDispatcher) dispatchLoop() {
 				continue
 			}
 			qd.mu.Unlock()
+			for _, pkt := range batch.AsSlice() {
+				pkt.ReportTXTimestamp(tcpip.TXTimestampSoftware)
+			}
 			_, _ = qd.lower.WritePackets(batch)
 			batch.Reset()
 			qd.mu.Lock()
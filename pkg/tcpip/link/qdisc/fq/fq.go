@@ -0,0 +1,441 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fq provides the implementation of a fair queuing discipline modeled
+// after the fq qdisc in Linux. Outbound packets are queued per flow, flows are
+// served in round-robin, and packets are held until their earliest departure
+// time (PacketBuffer.TXTime, as requested with SO_TXTIME).
+package fq
+
+import (
+	"container/heap"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sleep"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+var _ stack.QueueingDiscipline = (*discipline)(nil)
+
+const (
+	// BatchSize is the maximum number of packets written to the lower link
+	// endpoint at once.
+	BatchSize = 47
+
+	// DefaultLimit is the default maximum number of queued packets.
+	DefaultLimit = 10000
+
+	// DefaultFlowLimit is the default maximum number of queued packets per
+	// flow.
+	DefaultFlowLimit = 100
+
+	// DefaultQuantum is the default number of bytes a flow may send in each
+	// round.
+	DefaultQuantum = 2 * 1514
+
+	// DefaultHorizon is the default maximum time in the future a packet may
+	// be scheduled for.
+	DefaultHorizon = 10 * time.Second
+
+	qDiscClosed = 1
+)
+
+// Options configures a fair queuing discipline. Zero fields take their
+// default values.
+//
+// +stateify savable
+type Options struct {
+	// Limit is the maximum number of queued packets.
+	Limit int
+
+	// FlowLimit is the maximum number of queued packets per flow.
+	FlowLimit int
+
+	// Quantum is the number of bytes a flow may send in each round.
+	Quantum int
+
+	// Horizon is the maximum time in the future a packet may be scheduled
+	// for.
+	Horizon time.Duration
+
+	// HorizonCap makes packets scheduled beyond Horizon depart at Horizon
+	// instead of being dropped.
+	HorizonCap bool
+}
+
+// flowState is the scheduling state of a flow.
+type flowState int
+
+const (
+	// flowIdle flows have no queued packets.
+	flowIdle flowState = iota
+
+	// flowActive flows are in the round-robin list.
+	flowActive
+
+	// flowThrottled flows wait for the departure time of their first packet.
+	flowThrottled
+)
+
+// queuedPacket is a packet held by the queuing discipline.
+//
+// +stateify savable
+type queuedPacket struct {
+	pkt        *stack.PacketBuffer
+	timeToSend tcpip.MonotonicTime
+	seq        uint64
+}
+
+// packetHeap orders the packets of a flow by departure time, then by
+// arrival. It implements heap.Interface.
+//
+// +stateify savable
+type packetHeap struct {
+	pkts []queuedPacket
+}
+
+func (h *packetHeap) Len() int {
+	return len(h.pkts)
+}
+
+func (h *packetHeap) Less(i, j int) bool {
+	a, b := &h.pkts[i], &h.pkts[j]
+	if a.timeToSend != b.timeToSend {
+		return a.timeToSend.Before(b.timeToSend)
+	}
+	return a.seq < b.seq
+}
+
+func (h *packetHeap) Swap(i, j int) {
+	h.pkts[i], h.pkts[j] = h.pkts[j], h.pkts[i]
+}
+
+func (h *packetHeap) Push(x any) {
+	h.pkts = append(h.pkts, x.(queuedPacket))
+}
+
+func (h *packetHeap) Pop() any {
+	n := len(h.pkts) - 1
+	p := h.pkts[n]
+	h.pkts[n] = queuedPacket{}
+	h.pkts = h.pkts[:n]
+	return p
+}
+
+// flow holds the queued packets that share a hash.
+//
+// +stateify savable
+type flow struct {
+	hash    uint32
+	packets packetHeap
+	credit  int
+	state   flowState
+
+	// index is the position of the flow in the throttled heap. It is only
+	// valid if state is flowThrottled.
+	index int
+}
+
+// head returns the next packet of the flow.
+func (f *flow) head() *queuedPacket {
+	return &f.packets.pkts[0]
+}
+
+// flowHeap orders throttled flows by the departure time of their next packet.
+// It implements heap.Interface.
+//
+// +stateify savable
+type flowHeap struct {
+	flows []*flow
+}
+
+func (h *flowHeap) Len() int {
+	return len(h.flows)
+}
+
+func (h *flowHeap) Less(i, j int) bool {
+	return h.flows[i].head().timeToSend.Before(h.flows[j].head().timeToSend)
+}
+
+func (h *flowHeap) Swap(i, j int) {
+	h.flows[i], h.flows[j] = h.flows[j], h.flows[i]
+	h.flows[i].index = i
+	h.flows[j].index = j
+}
+
+func (h *flowHeap) Push(x any) {
+	f := x.(*flow)
+	f.index = len(h.flows)
+	h.flows = append(h.flows, f)
+}
+
+func (h *flowHeap) Pop() any {
+	n := len(h.flows) - 1
+	f := h.flows[n]
+	h.flows[n] = nil
+	h.flows = h.flows[:n]
+	return f
+}
+
+// discipline represents a QueueingDiscipline which schedules outgoing packets
+// fairly between flows, identified by PacketBuffer.Hash, and holds each packet
+// until its departure time.
+//
+// +stateify savable
+type discipline struct {
+	wg    sync.WaitGroup `state:"nosave"`
+	lower stack.LinkWriter
+	clock tcpip.Clock
+	opts  Options
+
+	mu sync.Mutex `state:"nosave"`
+	// flows holds the flows with queued packets.
+	//
+	// +checklocks:mu
+	flows map[uint32]*flow
+	// active holds the flows served in round-robin.
+	//
+	// +checklocks:mu
+	active []*flow
+	// throttled holds the flows whose next packet is not due yet.
+	//
+	// +checklocks:mu
+	throttled flowHeap
+	// len is the number of queued packets.
+	//
+	// +checklocks:mu
+	len int
+	// seq is the arrival sequence number of the next packet.
+	//
+	// +checklocks:mu
+	seq uint64
+
+	// timer wakes the dispatcher when a throttled flow becomes due. It is
+	// only accessed by the dispatcher.
+	timer tcpip.Timer `state:"nosave"`
+
+	newPacketWaker sleep.Waker `state:"nosave"`
+	timerWaker     sleep.Waker `state:"nosave"`
+	closeWaker     sleep.Waker `state:"nosave"`
+
+	closed atomicbitops.Int32
+}
+
+// New creates a new fair queuing discipline that writes packets to lower and
+// reads departure times from clock.
+func New(lower stack.LinkWriter, clock tcpip.Clock, opts Options) stack.QueueingDiscipline {
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+	if opts.FlowLimit == 0 {
+		opts.FlowLimit = DefaultFlowLimit
+	}
+	if opts.Quantum == 0 {
+		opts.Quantum = DefaultQuantum
+	}
+	if opts.Horizon == 0 {
+		opts.Horizon = DefaultHorizon
+	}
+	d := &discipline{
+		lower: lower,
+		clock: clock,
+		opts:  opts,
+		flows: make(map[uint32]*flow),
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.dispatchLoop()
+	}()
+	return d
+}
+
+func (d *discipline) dispatchLoop() {
+	s := sleep.Sleeper{}
+	s.AddWaker(&d.newPacketWaker)
+	s.AddWaker(&d.timerWaker)
+	s.AddWaker(&d.closeWaker)
+	defer s.Done()
+
+	var batch stack.PacketBufferList
+	for {
+		switch w := s.Fetch(true); w {
+		case &d.newPacketWaker, &d.timerWaker:
+		case &d.closeWaker:
+			d.mu.Lock()
+			d.purgeLocked()
+			d.mu.Unlock()
+			if d.timer != nil {
+				d.timer.Stop()
+			}
+			return
+		default:
+			panic("unknown waker")
+		}
+		for {
+			d.mu.Lock()
+			next, throttled := d.dequeueLocked(&batch)
+			d.mu.Unlock()
+			if batch.Len() == 0 {
+				if throttled {
+					d.armTimer(next)
+				}
+				break
+			}
+			for _, pkt := range batch.AsSlice() {
+				pkt.ReportTXTimestamp(tcpip.TXTimestampSoftware)
+			}
+			_, _ = d.lower.WritePackets(batch)
+			batch.Reset()
+		}
+	}
+}
+
+// armTimer wakes the dispatcher at next.
+func (d *discipline) armTimer(next tcpip.MonotonicTime) {
+	delay := next.Sub(d.clock.NowMonotonic())
+	if d.timer == nil {
+		d.timer = d.clock.AfterFunc(delay, d.timerWaker.Assert)
+		return
+	}
+	d.timer.Reset(delay)
+}
+
+// dequeueLocked moves up to BatchSize due packets to batch. It returns the
+// departure time of the earliest throttled packet, and whether there is one.
+//
+// +checklocks:d.mu
+func (d *discipline) dequeueLocked(batch *stack.PacketBufferList) (tcpip.MonotonicTime, bool) {
+	now := d.clock.NowMonotonic()
+	for d.throttled.Len() > 0 && !d.throttled.flows[0].head().timeToSend.After(now) {
+		f := heap.Pop(&d.throttled).(*flow)
+		f.state = flowActive
+		d.active = append(d.active, f)
+	}
+
+	for batch.Len() < BatchSize && len(d.active) > 0 {
+		f := d.active[0]
+		if f.packets.Len() == 0 {
+			d.active = d.active[1:]
+			f.state = flowIdle
+			delete(d.flows, f.hash)
+			continue
+		}
+		if f.head().timeToSend.After(now) {
+			d.active = d.active[1:]
+			f.state = flowThrottled
+			heap.Push(&d.throttled, f)
+			continue
+		}
+		if f.credit <= 0 {
+			// The flow used up its share of this round.
+			f.credit += d.opts.Quantum
+			d.active = append(d.active[1:], f)
+			continue
+		}
+		p := heap.Pop(&f.packets).(queuedPacket)
+		f.credit -= p.pkt.Size()
+		d.len--
+		batch.PushBack(p.pkt)
+	}
+
+	if d.throttled.Len() == 0 {
+		return tcpip.MonotonicTime{}, false
+	}
+	return d.throttled.flows[0].head().timeToSend, true
+}
+
+// purgeLocked drops all queued packets.
+//
+// +checklocks:d.mu
+func (d *discipline) purgeLocked() {
+	for _, f := range d.flows {
+		for _, p := range f.packets.pkts {
+			p.pkt.DecRef()
+		}
+	}
+	d.flows = make(map[uint32]*flow)
+	d.active = nil
+	d.throttled = flowHeap{}
+	d.len = 0
+}
+
+// WritePacket implements stack.QueueingDiscipline.WritePacket.
+//
+// The packet must have the following fields populated:
+//   - pkt.EgressRoute
+//   - pkt.GSOOptions
+//   - pkt.NetworkProtocolNumber
+func (d *discipline) WritePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	if d.closed.Load() == qDiscClosed {
+		return &tcpip.ErrClosedForSend{}
+	}
+
+	// As in Linux, packets without a departure time and packets that are
+	// late depart right away.
+	now := d.clock.NowMonotonic()
+	timeToSend := pkt.TXTime
+	if timeToSend.Before(now) {
+		timeToSend = now
+	}
+	if horizon := now.Add(d.opts.Horizon); timeToSend.After(horizon) {
+		if !d.opts.HorizonCap {
+			return &tcpip.ErrNoBufferSpace{}
+		}
+		timeToSend = horizon
+	}
+
+	d.mu.Lock()
+	f, ok := d.flows[pkt.Hash]
+	if d.len >= d.opts.Limit || (ok && f.packets.Len() >= d.opts.FlowLimit) {
+		d.mu.Unlock()
+		return &tcpip.ErrNoBufferSpace{}
+	}
+	if !ok {
+		f = &flow{
+			hash:   pkt.Hash,
+			credit: d.opts.Quantum,
+		}
+		d.flows[pkt.Hash] = f
+	}
+	heap.Push(&f.packets, queuedPacket{
+		pkt:        pkt.IncRef(),
+		timeToSend: timeToSend,
+		seq:        d.seq,
+	})
+	d.seq++
+	d.len++
+	switch f.state {
+	case flowIdle:
+		f.state = flowActive
+		d.active = append(d.active, f)
+	case flowThrottled:
+		// The packet may depart before the previous head of the flow.
+		heap.Fix(&d.throttled, f.index)
+	}
+	d.mu.Unlock()
+
+	d.newPacketWaker.Assert()
+	return nil
+}
+
+// Close implements stack.QueueingDiscipline.Close.
+func (d *discipline) Close() {
+	d.closed.Store(qDiscClosed)
+	d.closeWaker.Assert()
+	d.wg.Wait()
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fq_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fq"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/internal/testutil"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// timestampRecorder implements stack.TXTimestampHandler.
+type timestampRecorder struct {
+	mu    sync.Mutex
+	kinds []tcpip.TXTimestampKind
+}
+
+func (tr *timestampRecorder) HandleTXTimestamp(kind tcpip.TXTimestampKind, _ uint32, _ *stack.PacketBuffer) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.kinds = append(tr.kinds, kind)
+}
+
+func (tr *timestampRecorder) count() int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return len(tr.kinds)
+}
+
+func writePacket(t *testing.T, qDisc stack.QueueingDiscipline, id byte, hash uint32, txTime tcpip.MonotonicTime) tcpip.Error {
+	t.Helper()
+	pkt := testutil.NewPacket(id, 1)
+	defer pkt.DecRef()
+	pkt.Hash = hash
+	pkt.TXTime = txTime
+	return qDisc.WritePacket(pkt)
+}
+
+func TestDepartureTime(t *testing.T) {
+	clock := testutil.NewClock()
+	lower := testutil.NewWriter()
+	qDisc := fq.New(lower, clock, fq.Options{})
+	defer qDisc.Close()
+
+	var timestamps timestampRecorder
+	pkt := testutil.NewPacket(1, 1)
+	pkt.TXTime = clock.NowMonotonic().Add(time.Second)
+	pkt.RequestTXTimestamps(tcpip.TimestampingTXSoftware, 0, &timestamps)
+	if err := qDisc.WritePacket(pkt); err != nil {
+		t.Fatalf("qDisc.WritePacket(_) = %s", err)
+	}
+	pkt.DecRef()
+	clock.WaitTimer(t, time.Second)
+	if err := writePacket(t, qDisc, 2, 0, tcpip.MonotonicTime{}); err != nil {
+		t.Fatalf("writePacket(_, _, 2, ...) = %s", err)
+	}
+
+	// The packet without a departure time is sent first even though it was
+	// queued last.
+	lower.Expect(t, 2)
+	clock.WaitTimer(t, time.Second)
+	lower.ExpectNone(t)
+	if got := timestamps.count(); got != 0 {
+		t.Errorf("got %d transmit timestamps before departure, want 0", got)
+	}
+
+	clock.Advance(time.Second)
+	lower.Expect(t, 1)
+	if got := timestamps.count(); got != 1 {
+		t.Errorf("got %d transmit timestamps after departure, want 1", got)
+	}
+}
+
+func TestHorizon(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		horizonCap bool
+		wantDrop   bool
+	}{
+		{
+			name:     "drop",
+			wantDrop: true,
+		},
+		{
+			name:       "cap",
+			horizonCap: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			clock := faketime.NewManualClock()
+			lower := testutil.NewWriter()
+			qDisc := fq.New(lower, clock, fq.Options{
+				Horizon:    time.Second,
+				HorizonCap: test.horizonCap,
+			})
+			defer qDisc.Close()
+
+			err := writePacket(t, qDisc, 1, 0, clock.NowMonotonic().Add(time.Minute))
+			if dropped := testutil.IsNoBufferSpace(err); dropped != test.wantDrop {
+				t.Fatalf("got writePacket(...) = %v, want dropped = %t", err, test.wantDrop)
+			}
+			if test.wantDrop {
+				return
+			}
+			// The departure time was capped to the horizon.
+			clock.Advance(time.Second)
+			lower.Expect(t, 1)
+		})
+	}
+}
+
+func TestFlowLimit(t *testing.T) {
+	clock := faketime.NewManualClock()
+	lower := testutil.NewWriter()
+	qDisc := fq.New(lower, clock, fq.Options{FlowLimit: 1})
+	defer qDisc.Close()
+
+	txTime := clock.NowMonotonic().Add(time.Second)
+	if err := writePacket(t, qDisc, 1, 1, txTime); err != nil {
+		t.Fatalf("writePacket(_, _, 1, ...) = %s", err)
+	}
+	if err := writePacket(t, qDisc, 2, 1, txTime); !testutil.IsNoBufferSpace(err) {
+		t.Fatalf("got writePacket(_, _, 2, ...) = %v, want = %s", err, &tcpip.ErrNoBufferSpace{})
+	}
+	// Other flows are not limited.
+	if err := writePacket(t, qDisc, 3, 2, txTime); err != nil {
+		t.Fatalf("writePacket(_, _, 3, ...) = %s", err)
+	}
+}
+
+func TestWriteRefusedAfterClosed(t *testing.T) {
+	qDisc := fq.New(testutil.NewWriter(), faketime.NewManualClock(), fq.Options{})
+
+	qDisc.Close()
+	err := qDisc.WritePacket(nil)
+	if _, ok := err.(*tcpip.ErrClosedForSend); !ok {
+		t.Errorf("got err = %s, want %s", err, &tcpip.ErrClosedForSend{})
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
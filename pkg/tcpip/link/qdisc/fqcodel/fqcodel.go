@@ -0,0 +1,563 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fqcodel provides the implementation of a fair queuing discipline
+// with controlled delay, modeled after the fq_codel qdisc in Linux. Outbound
+// packets are hashed into flows which are served with deficit round-robin,
+// and each flow is managed by the CoDel algorithm (RFC 8289), which drops or
+// ECN-marks packets that have been queued for too long.
+package fqcodel
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sleep"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+var _ stack.QueueingDiscipline = (*discipline)(nil)
+
+const (
+	// BatchSize is the maximum number of packets written to the lower link
+	// endpoint at once.
+	BatchSize = 47
+
+	// DefaultTarget is the default acceptable queueing delay.
+	DefaultTarget = 5 * time.Millisecond
+
+	// DefaultInterval is the default time over which the queueing delay must
+	// stay above Target before packets are dropped.
+	DefaultInterval = 100 * time.Millisecond
+
+	// DefaultLimit is the default maximum number of queued packets.
+	DefaultLimit = 10240
+
+	// DefaultFlows is the default number of flows packets are hashed into.
+	DefaultFlows = 1024
+
+	// DefaultQuantum is the default number of bytes a flow may send in each
+	// round.
+	DefaultQuantum = 1514
+
+	// DefaultDropBatchSize is the default maximum number of packets dropped
+	// at once when the queue is full.
+	DefaultDropBatchSize = 64
+
+	qDiscClosed = 1
+)
+
+// Options configures a fair queuing discipline with controlled delay. Zero
+// fields take their default values.
+//
+// +stateify savable
+type Options struct {
+	// Target is the acceptable queueing delay.
+	Target time.Duration
+
+	// Interval is the time over which the queueing delay must stay above
+	// Target before packets are dropped. It should be on the order of the
+	// worst case round trip time.
+	Interval time.Duration
+
+	// Limit is the maximum number of queued packets.
+	Limit int
+
+	// Flows is the number of flows packets are hashed into.
+	Flows int
+
+	// Quantum is the number of bytes a flow may send in each round.
+	Quantum int
+
+	// DropBatchSize is the maximum number of packets dropped at once when
+	// the queue is full.
+	DropBatchSize int
+
+	// DisableECN makes CoDel drop ECN-capable packets instead of marking
+	// them with Congestion Experienced.
+	DisableECN bool
+}
+
+// queuedPacket is a packet held by the queuing discipline.
+//
+// +stateify savable
+type queuedPacket struct {
+	pkt         *stack.PacketBuffer
+	enqueueTime tcpip.MonotonicTime
+}
+
+// flowList identifies the round-robin list a flow is in.
+type flowList int
+
+const (
+	// listNone flows are in neither list.
+	listNone flowList = iota
+
+	// listNew flows became active recently and are served first.
+	listNew
+
+	// listOld flows have used up at least one quantum.
+	listOld
+)
+
+// flow holds the queued packets that share a hash bucket, along with the
+// state of its CoDel instance.
+//
+// +stateify savable
+type flow struct {
+	packets []queuedPacket
+	backlog int
+	deficit int
+	list    flowList
+
+	// dropping is true while CoDel is in its dropping state.
+	dropping bool
+	// aboveTarget is true while the queueing delay is above Target; it
+	// has been so since firstAboveTime minus Interval.
+	aboveTarget    bool
+	firstAboveTime tcpip.MonotonicTime
+	// dropNext is the time of the next drop while dropping.
+	dropNext tcpip.MonotonicTime
+	// count is the number of drops since entering the dropping state and
+	// lastCount its value when the dropping state was last left.
+	count     uint32
+	lastCount uint32
+}
+
+// discipline represents a QueueingDiscipline which schedules outgoing packets
+// fairly between flows, identified by PacketBuffer.Hash, and keeps the
+// queueing delay of each flow under control.
+//
+// +stateify savable
+type discipline struct {
+	wg    sync.WaitGroup `state:"nosave"`
+	lower stack.LinkWriter
+	clock tcpip.Clock
+	opts  Options
+
+	mu sync.Mutex `state:"nosave"`
+	// flows holds the flows, indexed by hash bucket. Flows are created
+	// when first used.
+	//
+	// +checklocks:mu
+	flows []*flow
+	// newFlows and oldFlows hold the flows served in round-robin, new
+	// flows first.
+	//
+	// +checklocks:mu
+	newFlows []*flow
+	// +checklocks:mu
+	oldFlows []*flow
+	// len is the number of queued packets.
+	//
+	// +checklocks:mu
+	len int
+	// backlog is the number of queued bytes.
+	//
+	// +checklocks:mu
+	backlog int
+	// maxPacket is the size of the largest packet seen.
+	//
+	// +checklocks:mu
+	maxPacket int
+
+	newPacketWaker sleep.Waker `state:"nosave"`
+	closeWaker     sleep.Waker `state:"nosave"`
+
+	closed atomicbitops.Int32
+}
+
+// New creates a new fair queuing discipline with controlled delay that writes
+// packets to lower and measures queueing delays with clock.
+func New(lower stack.LinkWriter, clock tcpip.Clock, opts Options) stack.QueueingDiscipline {
+	if opts.Target == 0 {
+		opts.Target = DefaultTarget
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+	if opts.Flows == 0 {
+		opts.Flows = DefaultFlows
+	}
+	if opts.Quantum == 0 {
+		opts.Quantum = DefaultQuantum
+	}
+	if opts.DropBatchSize == 0 {
+		opts.DropBatchSize = DefaultDropBatchSize
+	}
+	d := &discipline{
+		lower: lower,
+		clock: clock,
+		opts:  opts,
+		flows: make([]*flow, opts.Flows),
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.dispatchLoop()
+	}()
+	return d
+}
+
+func (d *discipline) dispatchLoop() {
+	s := sleep.Sleeper{}
+	s.AddWaker(&d.newPacketWaker)
+	s.AddWaker(&d.closeWaker)
+	defer s.Done()
+
+	var batch stack.PacketBufferList
+	for {
+		switch w := s.Fetch(true); w {
+		case &d.newPacketWaker:
+		case &d.closeWaker:
+			d.mu.Lock()
+			d.purgeLocked()
+			d.mu.Unlock()
+			return
+		default:
+			panic("unknown waker")
+		}
+		for {
+			d.mu.Lock()
+			for batch.Len() < BatchSize {
+				pkt := d.dequeueLocked()
+				if pkt == nil {
+					break
+				}
+				batch.PushBack(pkt)
+			}
+			d.mu.Unlock()
+			if batch.Len() == 0 {
+				break
+			}
+			for _, pkt := range batch.AsSlice() {
+				pkt.ReportTXTimestamp(tcpip.TXTimestampSoftware)
+			}
+			_, _ = d.lower.WritePackets(batch)
+			batch.Reset()
+		}
+	}
+}
+
+// dequeueLocked returns the next packet to send, or nil if there is none.
+//
+// +checklocks:d.mu
+func (d *discipline) dequeueLocked() *stack.PacketBuffer {
+	now := d.clock.NowMonotonic()
+	for {
+		var f *flow
+		switch {
+		case len(d.newFlows) > 0:
+			f = d.newFlows[0]
+		case len(d.oldFlows) > 0:
+			f = d.oldFlows[0]
+		default:
+			return nil
+		}
+
+		if f.deficit <= 0 {
+			// The flow used up its share of this round.
+			f.deficit += d.opts.Quantum
+			d.moveToOldLocked(f)
+			continue
+		}
+
+		pkt := d.codelDequeueLocked(f, now)
+		if pkt == nil {
+			// As in Linux, an emptied new flow goes to the end of the old
+			// flows so that it cannot regain priority right away.
+			if f.list == listNew && len(d.oldFlows) > 0 {
+				d.moveToOldLocked(f)
+			} else {
+				d.removeHeadLocked(f)
+			}
+			continue
+		}
+		f.deficit -= pkt.Size()
+		return pkt
+	}
+}
+
+// moveToOldLocked moves f, the head of its list, to the end of the old flows.
+//
+// +checklocks:d.mu
+func (d *discipline) moveToOldLocked(f *flow) {
+	d.removeHeadLocked(f)
+	f.list = listOld
+	d.oldFlows = append(d.oldFlows, f)
+}
+
+// removeHeadLocked removes f, the head of its list, from the list.
+//
+// +checklocks:d.mu
+func (d *discipline) removeHeadLocked(f *flow) {
+	switch f.list {
+	case listNew:
+		d.newFlows[0] = nil
+		d.newFlows = d.newFlows[1:]
+	case listOld:
+		d.oldFlows[0] = nil
+		d.oldFlows = d.oldFlows[1:]
+	}
+	f.list = listNone
+}
+
+// popLocked removes the first packet of f.
+//
+// +checklocks:d.mu
+func (d *discipline) popLocked(f *flow) (queuedPacket, bool) {
+	if len(f.packets) == 0 {
+		return queuedPacket{}, false
+	}
+	p := f.packets[0]
+	f.packets[0] = queuedPacket{}
+	f.packets = f.packets[1:]
+	size := p.pkt.Size()
+	f.backlog -= size
+	d.backlog -= size
+	d.len--
+	return p, true
+}
+
+// shouldDropLocked reports whether CoDel considers that p, which was just
+// dequeued from f, has been queued for too long.
+//
+// +checklocks:d.mu
+func (d *discipline) shouldDropLocked(f *flow, p queuedPacket, now tcpip.MonotonicTime) bool {
+	if now.Sub(p.enqueueTime) < d.opts.Target || d.backlog <= d.maxPacket {
+		f.aboveTarget = false
+		return false
+	}
+	if !f.aboveTarget {
+		f.aboveTarget = true
+		f.firstAboveTime = now.Add(d.opts.Interval)
+		return false
+	}
+	return !now.Before(f.firstAboveTime)
+}
+
+// controlLaw returns the time of the next drop after t, which gets closer as
+// drops accumulate.
+func (d *discipline) controlLaw(f *flow, t tcpip.MonotonicTime) tcpip.MonotonicTime {
+	return t.Add(time.Duration(float64(d.opts.Interval) / math.Sqrt(float64(f.count))))
+}
+
+// congested handles a packet that CoDel chose to drop. If the packet can carry
+// ECN instead, it is marked and congested returns true.
+func (d *discipline) congested(pkt *stack.PacketBuffer) bool {
+	if !d.opts.DisableECN && markCE(pkt) {
+		return true
+	}
+	pkt.DecRef()
+	return false
+}
+
+// codelDequeueLocked returns the next packet of f, dropping or marking
+// packets as decided by CoDel, or nil if f has no packets.
+//
+// This follows codel_dequeue in Linux.
+//
+// +checklocks:d.mu
+func (d *discipline) codelDequeueLocked(f *flow, now tcpip.MonotonicTime) *stack.PacketBuffer {
+	p, ok := d.popLocked(f)
+	if !ok {
+		f.dropping = false
+		return nil
+	}
+	drop := d.shouldDropLocked(f, p, now)
+	switch {
+	case f.dropping:
+		if !drop {
+			f.dropping = false
+			break
+		}
+		for f.dropping && !now.Before(f.dropNext) {
+			f.count++
+			if d.congested(p.pkt) {
+				f.dropNext = d.controlLaw(f, f.dropNext)
+				return p.pkt
+			}
+			if p, ok = d.popLocked(f); !ok {
+				f.dropping = false
+				return nil
+			}
+			if d.shouldDropLocked(f, p, now) {
+				f.dropNext = d.controlLaw(f, f.dropNext)
+			} else {
+				f.dropping = false
+			}
+		}
+	case drop:
+		marked := d.congested(p.pkt)
+		if !marked {
+			p, ok = d.popLocked(f)
+		}
+		f.dropping = true
+		// Resume from the previous drop rate if the dropping state was
+		// left recently.
+		if delta := f.count - f.lastCount; delta > 1 && now.Sub(f.dropNext) < 16*d.opts.Interval {
+			f.count = delta
+		} else {
+			f.count = 1
+		}
+		f.lastCount = f.count
+		f.dropNext = d.controlLaw(f, now)
+		if !marked {
+			if !ok {
+				return nil
+			}
+			d.shouldDropLocked(f, p, now)
+		}
+	}
+	return p.pkt
+}
+
+// markCE sets the Congestion Experienced codepoint on pkt if it is an
+// ECN-capable IP packet, and reports whether it did.
+func markCE(pkt *stack.PacketBuffer) bool {
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		h := header.IPv4(pkt.NetworkHeader().Slice())
+		if len(h) < header.IPv4MinimumSize {
+			return false
+		}
+		tos, _ := h.TOS()
+		if tos&header.ECNMask == header.ECNNotECT {
+			return false
+		}
+		h.SetTOS(tos|header.ECNCE, 0)
+		h.SetChecksum(0)
+		h.SetChecksum(^h.CalculateChecksum())
+		return true
+	case header.IPv6ProtocolNumber:
+		h := header.IPv6(pkt.NetworkHeader().Slice())
+		if len(h) < header.IPv6MinimumSize {
+			return false
+		}
+		tc, flowLabel := h.TOS()
+		if tc&header.ECNMask == header.ECNNotECT {
+			return false
+		}
+		h.SetTOS(tc|header.ECNCE, flowLabel)
+		return true
+	default:
+		return false
+	}
+}
+
+// dropLocked drops packets from the head of the flow with the largest
+// backlog, up to half of its packets, to make room in the queue. It returns
+// the flow it dropped from.
+//
+// +checklocks:d.mu
+func (d *discipline) dropLocked() *flow {
+	var fattest *flow
+	for _, f := range d.flows {
+		if f != nil && (fattest == nil || f.backlog > fattest.backlog) {
+			fattest = f
+		}
+	}
+	n := len(fattest.packets) / 2
+	if n == 0 {
+		n = 1
+	}
+	if n > d.opts.DropBatchSize {
+		n = d.opts.DropBatchSize
+	}
+	for i := 0; i < n; i++ {
+		p, _ := d.popLocked(fattest)
+		p.pkt.DecRef()
+	}
+	return fattest
+}
+
+// purgeLocked drops all queued packets.
+//
+// +checklocks:d.mu
+func (d *discipline) purgeLocked() {
+	for i, f := range d.flows {
+		if f == nil {
+			continue
+		}
+		for _, p := range f.packets {
+			p.pkt.DecRef()
+		}
+		d.flows[i] = nil
+	}
+	d.newFlows = nil
+	d.oldFlows = nil
+	d.len = 0
+	d.backlog = 0
+}
+
+// WritePacket implements stack.QueueingDiscipline.WritePacket.
+//
+// The packet must have the following fields populated:
+//   - pkt.EgressRoute
+//   - pkt.GSOOptions
+//   - pkt.NetworkProtocolNumber
+func (d *discipline) WritePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	if d.closed.Load() == qDiscClosed {
+		return &tcpip.ErrClosedForSend{}
+	}
+
+	size := pkt.Size()
+	d.mu.Lock()
+	bucket := pkt.Hash % uint32(len(d.flows))
+	f := d.flows[bucket]
+	if f == nil {
+		f = &flow{}
+		d.flows[bucket] = f
+	}
+	f.packets = append(f.packets, queuedPacket{
+		pkt:         pkt.IncRef(),
+		enqueueTime: d.clock.NowMonotonic(),
+	})
+	f.backlog += size
+	d.backlog += size
+	d.len++
+	if size > d.maxPacket {
+		d.maxPacket = size
+	}
+	if f.list == listNone {
+		f.list = listNew
+		f.deficit = d.opts.Quantum
+		d.newFlows = append(d.newFlows, f)
+	}
+	// As in Linux, the queue makes room by dropping from the flow with the
+	// largest backlog. The packet is reported as dropped if that flow is its
+	// own.
+	var err tcpip.Error
+	if d.len > d.opts.Limit && d.dropLocked() == f {
+		err = &tcpip.ErrNoBufferSpace{}
+	}
+	d.mu.Unlock()
+
+	d.newPacketWaker.Assert()
+	return err
+}
+
+// Close implements stack.QueueingDiscipline.Close.
+func (d *discipline) Close() {
+	d.closed.Store(qDiscClosed)
+	d.closeWaker.Assert()
+	d.wg.Wait()
+}
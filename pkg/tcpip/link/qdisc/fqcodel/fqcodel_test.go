@@ -0,0 +1,124 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fqcodel_test
+
+import (
+	"os"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fqcodel"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/internal/testutil"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// writePacket writes a packet of size bytes whose first byte is id.
+func writePacket(t *testing.T, qDisc stack.QueueingDiscipline, id byte, hash uint32, size int) tcpip.Error {
+	t.Helper()
+	pkt := testutil.NewPacket(id, size)
+	defer pkt.DecRef()
+	pkt.Hash = hash
+	return qDisc.WritePacket(pkt)
+}
+
+// holdQueue writes a packet that blocks lower until it is released, so that
+// the following packets are queued.
+func holdQueue(t *testing.T, qDisc stack.QueueingDiscipline, lower *testutil.Writer) {
+	t.Helper()
+	if err := writePacket(t, qDisc, 0, 0, 100); err != nil {
+		t.Fatalf("writePacket(_, _, 0, ...) = %s", err)
+	}
+	lower.Expect(t, 0)
+}
+
+func TestDeficitRoundRobin(t *testing.T) {
+	lower := testutil.NewGatedWriter()
+	qDisc := fqcodel.New(lower, faketime.NewManualClock(), fqcodel.Options{Quantum: 1000})
+
+	holdQueue(t, qDisc, lower)
+	for _, p := range []struct {
+		id   byte
+		hash uint32
+	}{
+		{id: 1, hash: 1},
+		{id: 2, hash: 1},
+		{id: 3, hash: 2},
+		{id: 4, hash: 2},
+	} {
+		if err := writePacket(t, qDisc, p.id, p.hash, 1000); err != nil {
+			t.Fatalf("writePacket(_, _, %d, ...) = %s", p.id, err)
+		}
+	}
+	lower.Release()
+
+	// Each flow sends one quantum per round.
+	for _, id := range []byte{1, 3, 2, 4} {
+		lower.Expect(t, id)
+	}
+	qDisc.Close()
+	lower.ExpectNone(t)
+}
+
+func TestLimitDropsFromLargestFlow(t *testing.T) {
+	lower := testutil.NewGatedWriter()
+	qDisc := fqcodel.New(lower, faketime.NewManualClock(), fqcodel.Options{Limit: 3})
+
+	holdQueue(t, qDisc, lower)
+	for _, p := range []struct {
+		id   byte
+		hash uint32
+		size int
+	}{
+		{id: 1, hash: 1, size: 200},
+		{id: 2, hash: 1, size: 200},
+		{id: 3, hash: 2, size: 100},
+		// Drops packet 1 from the head of the larger flow.
+		{id: 4, hash: 2, size: 100},
+	} {
+		if err := writePacket(t, qDisc, p.id, p.hash, p.size); err != nil {
+			t.Fatalf("writePacket(_, _, %d, ...) = %s", p.id, err)
+		}
+	}
+	// Drops packet 2 from the flow of the new packet, which is reported.
+	if err := writePacket(t, qDisc, 5, 1, 300); !testutil.IsNoBufferSpace(err) {
+		t.Fatalf("got writePacket(_, _, 5, ...) = %v, want = %s", err, &tcpip.ErrNoBufferSpace{})
+	}
+	lower.Release()
+
+	for _, id := range []byte{5, 3, 4} {
+		lower.Expect(t, id)
+	}
+	qDisc.Close()
+	lower.ExpectNone(t)
+}
+
+func TestWriteRefusedAfterClosed(t *testing.T) {
+	qDisc := fqcodel.New(testutil.NewGatedWriter(), faketime.NewManualClock(), fqcodel.Options{})
+
+	qDisc.Close()
+	err := qDisc.WritePacket(nil)
+	if _, ok := err.(*tcpip.ErrClosedForSend); !ok {
+		t.Errorf("got err = %s, want %s", err, &tcpip.ErrClosedForSend{})
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
@@ -0,0 +1,190 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil defines types and functions used to test queueing
+// disciplines.
+//
+// Queueing disciplines write to the lower link from a dispatcher goroutine, so
+// tests cannot tell by waiting whether a packet is still to come. Instead,
+// absence checks are made once the dispatcher is known to be idle: either the
+// discipline has been closed, or Clock has observed the dispatcher arm its
+// timer for the next departure while time is stopped.
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// waitTimeout bounds how long tests wait for events that are expected to
+// happen. It only matters when a test fails.
+const waitTimeout = 5 * time.Second
+
+var _ stack.LinkWriter = (*Writer)(nil)
+
+// Writer implements stack.LinkWriter. It reports the first payload byte of
+// every written packet.
+type Writer struct {
+	ids chan byte
+
+	// release, if not nil, holds the first write until it is closed.
+	release chan struct{}
+	held    bool
+}
+
+// NewWriter creates a new Writer.
+func NewWriter() *Writer {
+	return &Writer{ids: make(chan byte, 100)}
+}
+
+// NewGatedWriter creates a new Writer that holds the first write until
+// Release is called, so that packets queue up behind it.
+func NewGatedWriter() *Writer {
+	return &Writer{
+		ids:     make(chan byte, 100),
+		release: make(chan struct{}),
+	}
+}
+
+// Release lets the write held by a gated Writer complete.
+func (w *Writer) Release() {
+	close(w.release)
+}
+
+// WritePackets implements stack.LinkWriter.WritePackets.
+func (w *Writer) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	for _, pkt := range pkts.AsSlice() {
+		w.ids <- pkt.Data().AsRange().ToSlice()[0]
+	}
+	if w.release != nil && !w.held {
+		w.held = true
+		<-w.release
+	}
+	return pkts.Len(), nil
+}
+
+// Expect waits for the next written packet and checks that its first payload
+// byte is want.
+func (w *Writer) Expect(t *testing.T, want byte) {
+	t.Helper()
+	select {
+	case got := <-w.ids:
+		if got != want {
+			t.Fatalf("got packet %d, want packet %d", got, want)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatalf("timed out waiting for packet %d", want)
+	}
+}
+
+// ExpectNone checks that no packet has been written since the last one
+// consumed by Expect. It does not wait, so the dispatcher must be idle: the
+// discipline must be closed, or Clock.WaitTimer must have returned since the
+// last write.
+func (w *Writer) ExpectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case got := <-w.ids:
+		t.Fatalf("got unexpected packet %d", got)
+	default:
+	}
+}
+
+var _ tcpip.Clock = (*Clock)(nil)
+
+// Clock is a faketime.ManualClock that reports when timers are armed.
+//
+// Times are measured from the creation of the clock.
+type Clock struct {
+	*faketime.ManualClock
+
+	// armed receives the time at which a timer was last armed to fire.
+	armed chan time.Duration
+}
+
+// NewClock creates a new Clock.
+func NewClock() *Clock {
+	return &Clock{
+		ManualClock: faketime.NewManualClock(),
+		armed:       make(chan time.Duration, 100),
+	}
+}
+
+// AfterFunc implements tcpip.Clock.AfterFunc.
+func (c *Clock) AfterFunc(d time.Duration, f func()) tcpip.Timer {
+	t := &timer{
+		Timer: c.ManualClock.AfterFunc(d, f),
+		clock: c,
+	}
+	c.notify(d)
+	return t
+}
+
+// notify reports a timer armed to fire after d.
+func (c *Clock) notify(d time.Duration) {
+	// ManualClock starts at the zero monotonic time.
+	c.armed <- c.NowMonotonic().Add(d).Sub(tcpip.MonotonicTime{})
+}
+
+// WaitTimer waits until a timer is armed to fire at time at, skipping timers
+// armed for other times.
+//
+// The dispatcher arms its timer once it has written all packets that are due,
+// so once WaitTimer returns no more packets are due until the clock advances.
+func (c *Clock) WaitTimer(t *testing.T, at time.Duration) {
+	t.Helper()
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case got := <-c.armed:
+			if got == at {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for a timer at %s", at)
+		}
+	}
+}
+
+// timer implements tcpip.Timer and reports when it is reset.
+type timer struct {
+	tcpip.Timer
+	clock *Clock
+}
+
+// Reset implements tcpip.Timer.Reset.
+func (t *timer) Reset(d time.Duration) {
+	t.Timer.Reset(d)
+	t.clock.notify(d)
+}
+
+// IsNoBufferSpace returns whether err is a tcpip.ErrNoBufferSpace.
+func IsNoBufferSpace(err tcpip.Error) bool {
+	_, ok := err.(*tcpip.ErrNoBufferSpace)
+	return ok
+}
+
+// NewPacket returns a packet of size bytes whose first payload byte is id.
+func NewPacket(id byte, size int) *stack.PacketBuffer {
+	payload := make([]byte, size)
+	payload[0] = id
+	return stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: buffer.MakeWithData(payload),
+	})
+}
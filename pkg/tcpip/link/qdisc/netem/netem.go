@@ -0,0 +1,354 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netem provides the implementation of a network emulation queuing
+// discipline modeled after the netem qdisc in Linux. Outbound packets are
+// delayed, dropped, duplicated and reordered at random to emulate the
+// properties of wide area networks, e.g. for fault injection in tests.
+package netem
+
+import (
+	"container/heap"
+	"math/rand"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sleep"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+var _ stack.QueueingDiscipline = (*discipline)(nil)
+
+const (
+	// BatchSize is the maximum number of packets written to the lower link
+	// endpoint at once.
+	BatchSize = 47
+
+	// DefaultLimit is the default maximum number of queued packets.
+	DefaultLimit = 1000
+
+	qDiscClosed = 1
+)
+
+// Options configures a network emulation queuing discipline. Probabilities
+// are fractions of math.MaxUint32, which stands for certainty. Zero fields
+// other than Limit disable the corresponding impairment.
+//
+// +stateify savable
+type Options struct {
+	// Latency is the delay added to packets.
+	Latency time.Duration
+
+	// Jitter is the maximum deviation from Latency. Delays are uniformly
+	// distributed within Latency ± Jitter, so packets may be reordered.
+	Jitter time.Duration
+
+	// Limit is the maximum number of queued packets.
+	Limit int
+
+	// Loss is the probability that a packet is dropped.
+	Loss uint32
+
+	// Duplicate is the probability that a packet is sent twice.
+	Duplicate uint32
+
+	// Reorder is the probability that a packet is sent right away, ahead of
+	// delayed packets. It only applies if Gap is set.
+	Reorder uint32
+
+	// Gap is the number of delayed packets between packets that may be
+	// sent right away.
+	Gap uint32
+}
+
+// queuedPacket is a packet held by the queuing discipline.
+//
+// +stateify savable
+type queuedPacket struct {
+	pkt        *stack.PacketBuffer
+	timeToSend tcpip.MonotonicTime
+	seq        uint64
+}
+
+// packetHeap orders packets by departure time, then by arrival. It implements
+// heap.Interface.
+//
+// +stateify savable
+type packetHeap struct {
+	pkts []queuedPacket
+}
+
+func (h *packetHeap) Len() int {
+	return len(h.pkts)
+}
+
+func (h *packetHeap) Less(i, j int) bool {
+	a, b := &h.pkts[i], &h.pkts[j]
+	if a.timeToSend != b.timeToSend {
+		return a.timeToSend.Before(b.timeToSend)
+	}
+	return a.seq < b.seq
+}
+
+func (h *packetHeap) Swap(i, j int) {
+	h.pkts[i], h.pkts[j] = h.pkts[j], h.pkts[i]
+}
+
+func (h *packetHeap) Push(x any) {
+	h.pkts = append(h.pkts, x.(queuedPacket))
+}
+
+func (h *packetHeap) Pop() any {
+	n := len(h.pkts) - 1
+	p := h.pkts[n]
+	h.pkts[n] = queuedPacket{}
+	h.pkts = h.pkts[:n]
+	return p
+}
+
+// discipline represents a QueueingDiscipline which impairs outgoing packets
+// and holds them until their departure time.
+//
+// +stateify savable
+type discipline struct {
+	wg    sync.WaitGroup `state:"nosave"`
+	lower stack.LinkWriter
+	clock tcpip.Clock
+	opts  Options
+
+	mu sync.Mutex `state:"nosave"`
+	// rng decides which packets are impaired. It is reseeded on restore.
+	//
+	// +checklocks:mu
+	rng *rand.Rand `state:"nosave"`
+	// packets holds the queued packets.
+	//
+	// +checklocks:mu
+	packets packetHeap
+	// seq is the arrival sequence number of the next packet.
+	//
+	// +checklocks:mu
+	seq uint64
+	// counter is the number of packets delayed since a packet was last
+	// reordered.
+	//
+	// +checklocks:mu
+	counter uint32
+
+	// timer wakes the dispatcher when the next packet is due. It is only
+	// accessed by the dispatcher.
+	timer tcpip.Timer `state:"nosave"`
+
+	newPacketWaker sleep.Waker `state:"nosave"`
+	timerWaker     sleep.Waker `state:"nosave"`
+	closeWaker     sleep.Waker `state:"nosave"`
+
+	closed atomicbitops.Int32
+}
+
+// New creates a new network emulation queuing discipline that writes packets
+// to lower, reads departure times from clock and draws random impairments
+// from rng. rng is only used with the discipline's lock held, so it need not
+// be safe for concurrent use unless it is shared.
+func New(lower stack.LinkWriter, clock tcpip.Clock, rng *rand.Rand, opts Options) stack.QueueingDiscipline {
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+	d := &discipline{
+		lower: lower,
+		clock: clock,
+		opts:  opts,
+		rng:   rng,
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.dispatchLoop()
+	}()
+	return d
+}
+
+func (d *discipline) dispatchLoop() {
+	s := sleep.Sleeper{}
+	s.AddWaker(&d.newPacketWaker)
+	s.AddWaker(&d.timerWaker)
+	s.AddWaker(&d.closeWaker)
+	defer s.Done()
+
+	var batch stack.PacketBufferList
+	for {
+		switch w := s.Fetch(true); w {
+		case &d.newPacketWaker, &d.timerWaker:
+		case &d.closeWaker:
+			d.mu.Lock()
+			d.purgeLocked()
+			d.mu.Unlock()
+			if d.timer != nil {
+				d.timer.Stop()
+			}
+			return
+		default:
+			panic("unknown waker")
+		}
+		for {
+			d.mu.Lock()
+			next, delayed := d.dequeueLocked(&batch)
+			d.mu.Unlock()
+			if batch.Len() == 0 {
+				if delayed {
+					d.armTimer(next)
+				}
+				break
+			}
+			for _, pkt := range batch.AsSlice() {
+				pkt.ReportTXTimestamp(tcpip.TXTimestampSoftware)
+			}
+			_, _ = d.lower.WritePackets(batch)
+			batch.Reset()
+		}
+	}
+}
+
+// armTimer wakes the dispatcher at next.
+func (d *discipline) armTimer(next tcpip.MonotonicTime) {
+	delay := next.Sub(d.clock.NowMonotonic())
+	if d.timer == nil {
+		d.timer = d.clock.AfterFunc(delay, d.timerWaker.Assert)
+		return
+	}
+	d.timer.Reset(delay)
+}
+
+// dequeueLocked moves up to BatchSize due packets to batch. It returns the
+// departure time of the next queued packet, and whether there is one.
+//
+// +checklocks:d.mu
+func (d *discipline) dequeueLocked(batch *stack.PacketBufferList) (tcpip.MonotonicTime, bool) {
+	now := d.clock.NowMonotonic()
+	for batch.Len() < BatchSize && d.packets.Len() > 0 && !d.packets.pkts[0].timeToSend.After(now) {
+		p := heap.Pop(&d.packets).(queuedPacket)
+		batch.PushBack(p.pkt)
+	}
+	if d.packets.Len() == 0 {
+		return tcpip.MonotonicTime{}, false
+	}
+	return d.packets.pkts[0].timeToSend, true
+}
+
+// purgeLocked drops all queued packets.
+//
+// +checklocks:d.mu
+func (d *discipline) purgeLocked() {
+	for _, p := range d.packets.pkts {
+		p.pkt.DecRef()
+	}
+	d.packets = packetHeap{}
+}
+
+// chanceLocked reports whether an event of the given probability happens.
+//
+// +checklocks:d.mu
+func (d *discipline) chanceLocked(probability uint32) bool {
+	return probability != 0 && probability >= d.rng.Uint32()
+}
+
+// delayLocked returns a random delay within Latency ± Jitter.
+//
+// +checklocks:d.mu
+func (d *discipline) delayLocked() time.Duration {
+	if d.opts.Jitter == 0 {
+		return d.opts.Latency
+	}
+	delay := d.opts.Latency - d.opts.Jitter + time.Duration(d.rng.Int63n(int64(2*d.opts.Jitter)))
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// enqueueLocked queues pkt, which the caller has a reference on, and returns
+// false if the queue is full.
+//
+// This follows netem_enqueue in Linux.
+//
+// +checklocks:d.mu
+func (d *discipline) enqueueLocked(pkt *stack.PacketBuffer, now tcpip.MonotonicTime) bool {
+	if d.packets.Len() >= d.opts.Limit {
+		return false
+	}
+	timeToSend := now
+	if d.opts.Gap == 0 || d.counter < d.opts.Gap-1 || !d.chanceLocked(d.opts.Reorder) {
+		timeToSend = now.Add(d.delayLocked())
+		d.counter++
+	} else {
+		// The packet jumps ahead of the delayed packets.
+		d.counter = 0
+	}
+	heap.Push(&d.packets, queuedPacket{
+		pkt:        pkt.IncRef(),
+		timeToSend: timeToSend,
+		seq:        d.seq,
+	})
+	d.seq++
+	return true
+}
+
+// WritePacket implements stack.QueueingDiscipline.WritePacket.
+//
+// The packet must have the following fields populated:
+//   - pkt.EgressRoute
+//   - pkt.GSOOptions
+//   - pkt.NetworkProtocolNumber
+func (d *discipline) WritePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	if d.closed.Load() == qDiscClosed {
+		return &tcpip.ErrClosedForSend{}
+	}
+
+	now := d.clock.NowMonotonic()
+	d.mu.Lock()
+	count := 1
+	if d.chanceLocked(d.opts.Duplicate) {
+		count++
+	}
+	if d.chanceLocked(d.opts.Loss) {
+		count--
+	}
+	// As in Linux, lost packets are reported as sent.
+	if count == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	if count > 1 {
+		dup := pkt.Clone()
+		d.enqueueLocked(dup, now)
+		dup.DecRef()
+	}
+	if !d.enqueueLocked(pkt, now) {
+		d.mu.Unlock()
+		return &tcpip.ErrNoBufferSpace{}
+	}
+	d.mu.Unlock()
+
+	d.newPacketWaker.Assert()
+	return nil
+}
+
+// Close implements stack.QueueingDiscipline.Close.
+func (d *discipline) Close() {
+	d.closed.Store(qDiscClosed)
+	d.closeWaker.Assert()
+	d.wg.Wait()
+}
@@ -0,0 +1,28 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netem
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// afterLoad is invoked by stateify.
+func (d *discipline) afterLoad(context.Context) {
+	// The random source isn't saved, and impairments only need to be
+	// statistically correct, so reseed it as the stack does.
+	d.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+}
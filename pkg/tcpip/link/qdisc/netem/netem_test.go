@@ -0,0 +1,157 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netem_test
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/internal/testutil"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/netem"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+func newQDisc(lower stack.LinkWriter, clock tcpip.Clock, opts netem.Options) stack.QueueingDiscipline {
+	return netem.New(lower, clock, rand.New(rand.NewSource(1)), opts)
+}
+
+func writePacket(t *testing.T, qDisc stack.QueueingDiscipline, id byte) tcpip.Error {
+	t.Helper()
+	pkt := testutil.NewPacket(id, 1)
+	defer pkt.DecRef()
+	return qDisc.WritePacket(pkt)
+}
+
+func TestLatency(t *testing.T) {
+	clock := testutil.NewClock()
+	lower := testutil.NewWriter()
+	qDisc := newQDisc(lower, clock, netem.Options{
+		Latency: 100 * time.Millisecond,
+	})
+	defer qDisc.Close()
+
+	if err := writePacket(t, qDisc, 1); err != nil {
+		t.Fatalf("writePacket(_, _, 1) = %s", err)
+	}
+	clock.WaitTimer(t, 100*time.Millisecond)
+	clock.Advance(50 * time.Millisecond)
+	if err := writePacket(t, qDisc, 2); err != nil {
+		t.Fatalf("writePacket(_, _, 2) = %s", err)
+	}
+	clock.WaitTimer(t, 100*time.Millisecond)
+	lower.ExpectNone(t)
+
+	clock.Advance(50 * time.Millisecond)
+	lower.Expect(t, 1)
+	clock.WaitTimer(t, 150*time.Millisecond)
+	lower.ExpectNone(t)
+	clock.Advance(50 * time.Millisecond)
+	lower.Expect(t, 2)
+}
+
+func TestLoss(t *testing.T) {
+	lower := testutil.NewWriter()
+	qDisc := newQDisc(lower, faketime.NewManualClock(), netem.Options{
+		Loss: math.MaxUint32,
+	})
+
+	// Lost packets are reported as sent.
+	if err := writePacket(t, qDisc, 1); err != nil {
+		t.Fatalf("writePacket(_, _, 1) = %s", err)
+	}
+	qDisc.Close()
+	lower.ExpectNone(t)
+}
+
+func TestDuplicate(t *testing.T) {
+	lower := testutil.NewWriter()
+	qDisc := newQDisc(lower, faketime.NewManualClock(), netem.Options{
+		Duplicate: math.MaxUint32,
+	})
+
+	if err := writePacket(t, qDisc, 1); err != nil {
+		t.Fatalf("writePacket(_, _, 1) = %s", err)
+	}
+	lower.Expect(t, 1)
+	lower.Expect(t, 1)
+	qDisc.Close()
+	lower.ExpectNone(t)
+}
+
+func TestReorder(t *testing.T) {
+	clock := testutil.NewClock()
+	lower := testutil.NewWriter()
+	qDisc := newQDisc(lower, clock, netem.Options{
+		Latency: 100 * time.Millisecond,
+		Reorder: math.MaxUint32,
+		Gap:     3,
+	})
+	defer qDisc.Close()
+
+	for id := byte(1); id <= 3; id++ {
+		if err := writePacket(t, qDisc, id); err != nil {
+			t.Fatalf("writePacket(_, _, %d) = %s", id, err)
+		}
+	}
+
+	// Every third packet jumps ahead of the delayed ones.
+	lower.Expect(t, 3)
+	clock.WaitTimer(t, 100*time.Millisecond)
+	lower.ExpectNone(t)
+	clock.Advance(100 * time.Millisecond)
+	lower.Expect(t, 1)
+	lower.Expect(t, 2)
+}
+
+func TestLimit(t *testing.T) {
+	lower := testutil.NewWriter()
+	qDisc := newQDisc(lower, faketime.NewManualClock(), netem.Options{
+		Latency: time.Second,
+		Limit:   2,
+	})
+	defer qDisc.Close()
+
+	for id := byte(1); id <= 2; id++ {
+		if err := writePacket(t, qDisc, id); err != nil {
+			t.Fatalf("writePacket(_, _, %d) = %s", id, err)
+		}
+	}
+	if err := writePacket(t, qDisc, 3); !testutil.IsNoBufferSpace(err) {
+		t.Fatalf("got writePacket(_, _, 3) = %v, want = %s", err, &tcpip.ErrNoBufferSpace{})
+	}
+}
+
+func TestWriteRefusedAfterClosed(t *testing.T) {
+	qDisc := newQDisc(testutil.NewWriter(), faketime.NewManualClock(), netem.Options{})
+
+	qDisc.Close()
+	err := qDisc.WritePacket(nil)
+	if _, ok := err.(*tcpip.ErrClosedForSend); !ok {
+		t.Errorf("got err = %s, want %s", err, &tcpip.ErrClosedForSend{})
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
@@ -0,0 +1,230 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prio provides the implementation of a priority queuing discipline
+// modeled after the prio qdisc in Linux. Outbound packets are classified into
+// bands by the priority derived from their IP TOS or traffic class, and a
+// band is only served when all bands of higher priority are empty.
+package prio
+
+import (
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sleep"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+var _ stack.QueueingDiscipline = (*discipline)(nil)
+
+const (
+	// BatchSize is the maximum number of packets written to the lower link
+	// endpoint at once.
+	BatchSize = 47
+
+	// DefaultBands is the default number of bands.
+	DefaultBands = 3
+
+	// MaxBands is the maximum number of bands.
+	MaxBands = 16
+
+	// DefaultLimit is the default maximum number of queued packets per band.
+	DefaultLimit = 1000
+
+	qDiscClosed = 1
+)
+
+// DefaultPriomap is the default mapping of priorities to bands.
+var DefaultPriomap = [MaxBands]uint8{1, 2, 2, 2, 1, 2, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1}
+
+// tosToPriority maps the TOS bits of an IP TOS, shifted right by one, to a
+// priority. It matches ip_tos2prio in Linux.
+var tosToPriority = [16]uint8{0, 0, 0, 0, 2, 2, 2, 2, 6, 6, 6, 6, 4, 4, 4, 4}
+
+// Options configures a priority queuing discipline. Zero fields take their
+// default values.
+//
+// +stateify savable
+type Options struct {
+	// Bands is the number of bands, at most MaxBands. Band 0 has the highest
+	// priority.
+	Bands int
+
+	// Priomap maps each priority to a band. Entries must be lower than
+	// Bands. It is only used if Bands is set.
+	Priomap [MaxBands]uint8
+
+	// Limit is the maximum number of queued packets per band.
+	Limit int
+}
+
+// discipline represents a QueueingDiscipline which dispatches outgoing packets
+// in strict priority order.
+//
+// +stateify savable
+type discipline struct {
+	wg    sync.WaitGroup `state:"nosave"`
+	lower stack.LinkWriter
+	opts  Options
+
+	mu sync.Mutex `state:"nosave"`
+	// bands holds the queued packets of each band in arrival order.
+	//
+	// +checklocks:mu
+	bands [][]*stack.PacketBuffer
+
+	newPacketWaker sleep.Waker `state:"nosave"`
+	closeWaker     sleep.Waker `state:"nosave"`
+
+	closed atomicbitops.Int32
+}
+
+// New creates a new priority queuing discipline that writes packets to lower.
+func New(lower stack.LinkWriter, opts Options) stack.QueueingDiscipline {
+	if opts.Bands == 0 {
+		opts.Bands = DefaultBands
+		opts.Priomap = DefaultPriomap
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+	d := &discipline{
+		lower: lower,
+		opts:  opts,
+		bands: make([][]*stack.PacketBuffer, opts.Bands),
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.dispatchLoop()
+	}()
+	return d
+}
+
+func (d *discipline) dispatchLoop() {
+	s := sleep.Sleeper{}
+	s.AddWaker(&d.newPacketWaker)
+	s.AddWaker(&d.closeWaker)
+	defer s.Done()
+
+	var batch stack.PacketBufferList
+	for {
+		switch w := s.Fetch(true); w {
+		case &d.newPacketWaker:
+		case &d.closeWaker:
+			d.mu.Lock()
+			d.purgeLocked()
+			d.mu.Unlock()
+			return
+		default:
+			panic("unknown waker")
+		}
+		for {
+			d.mu.Lock()
+			d.dequeueLocked(&batch)
+			d.mu.Unlock()
+			if batch.Len() == 0 {
+				break
+			}
+			for _, pkt := range batch.AsSlice() {
+				pkt.ReportTXTimestamp(tcpip.TXTimestampSoftware)
+			}
+			_, _ = d.lower.WritePackets(batch)
+			batch.Reset()
+		}
+	}
+}
+
+// dequeueLocked moves up to BatchSize packets to batch, highest priority band
+// first.
+//
+// +checklocks:d.mu
+func (d *discipline) dequeueLocked(batch *stack.PacketBufferList) {
+	for i := range d.bands {
+		band := d.bands[i]
+		for batch.Len() < BatchSize && len(band) > 0 {
+			batch.PushBack(band[0])
+			band[0] = nil
+			band = band[1:]
+		}
+		d.bands[i] = band
+	}
+}
+
+// purgeLocked drops all queued packets.
+//
+// +checklocks:d.mu
+func (d *discipline) purgeLocked() {
+	for i, band := range d.bands {
+		for _, pkt := range band {
+			pkt.DecRef()
+		}
+		d.bands[i] = nil
+	}
+}
+
+// priority returns the priority of pkt, derived from its IP TOS or traffic
+// class as for sockets that set IP_TOS in Linux.
+func priority(pkt *stack.PacketBuffer) uint8 {
+	var tos uint8
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		h := header.IPv4(pkt.NetworkHeader().Slice())
+		if len(h) < header.IPv4MinimumSize {
+			return 0
+		}
+		tos, _ = h.TOS()
+	case header.IPv6ProtocolNumber:
+		h := header.IPv6(pkt.NetworkHeader().Slice())
+		if len(h) < header.IPv6MinimumSize {
+			return 0
+		}
+		tos, _ = h.TOS()
+	default:
+		return 0
+	}
+	return tosToPriority[(tos&0x1e)>>1]
+}
+
+// WritePacket implements stack.QueueingDiscipline.WritePacket.
+//
+// The packet must have the following fields populated:
+//   - pkt.EgressRoute
+//   - pkt.GSOOptions
+//   - pkt.NetworkProtocolNumber
+func (d *discipline) WritePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	if d.closed.Load() == qDiscClosed {
+		return &tcpip.ErrClosedForSend{}
+	}
+
+	band := d.opts.Priomap[priority(pkt)]
+	d.mu.Lock()
+	if len(d.bands[band]) >= d.opts.Limit {
+		d.mu.Unlock()
+		return &tcpip.ErrNoBufferSpace{}
+	}
+	d.bands[band] = append(d.bands[band], pkt.IncRef())
+	d.mu.Unlock()
+
+	d.newPacketWaker.Assert()
+	return nil
+}
+
+// Close implements stack.QueueingDiscipline.Close.
+func (d *discipline) Close() {
+	d.closed.Store(qDiscClosed)
+	d.closeWaker.Assert()
+	d.wg.Wait()
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prio_test
+
+import (
+	"os"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/internal/testutil"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/prio"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// Band 0, 1 and 2 of the default priority map, respectively.
+	tosLowDelay   = 0x10
+	tosNormal     = 0
+	tosThroughput = 0x08
+)
+
+// writePacket writes an IPv4 packet with the given TOS whose first payload
+// byte is id.
+func writePacket(t *testing.T, qDisc stack.QueueingDiscipline, id byte, tos uint8) tcpip.Error {
+	t.Helper()
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.IPv4MinimumSize,
+		Payload:            buffer.MakeWithData([]byte{id}),
+	})
+	defer pkt.DecRef()
+	header.IPv4(pkt.NetworkHeader().Push(header.IPv4MinimumSize)).Encode(&header.IPv4Fields{
+		TOS:         tos,
+		TotalLength: uint16(pkt.Size()),
+		TTL:         64,
+		Protocol:    uint8(header.UDPProtocolNumber),
+	})
+	pkt.NetworkProtocolNumber = header.IPv4ProtocolNumber
+	return qDisc.WritePacket(pkt)
+}
+
+// holdQueue writes a packet that blocks lower until it is released, so that
+// the following packets are queued.
+func holdQueue(t *testing.T, qDisc stack.QueueingDiscipline, lower *testutil.Writer) {
+	t.Helper()
+	if err := writePacket(t, qDisc, 0, tosNormal); err != nil {
+		t.Fatalf("writePacket(_, _, 0, ...) = %s", err)
+	}
+	lower.Expect(t, 0)
+}
+
+func TestPriority(t *testing.T) {
+	lower := testutil.NewGatedWriter()
+	qDisc := prio.New(lower, prio.Options{})
+
+	holdQueue(t, qDisc, lower)
+	for _, p := range []struct {
+		id  byte
+		tos uint8
+	}{
+		{id: 1, tos: tosThroughput},
+		{id: 2, tos: tosNormal},
+		{id: 3, tos: tosLowDelay},
+		{id: 4, tos: tosNormal},
+	} {
+		if err := writePacket(t, qDisc, p.id, p.tos); err != nil {
+			t.Fatalf("writePacket(_, _, %d, %#x) = %s", p.id, p.tos, err)
+		}
+	}
+	lower.Release()
+
+	for _, id := range []byte{3, 2, 4, 1} {
+		lower.Expect(t, id)
+	}
+	qDisc.Close()
+	lower.ExpectNone(t)
+}
+
+func TestPriomap(t *testing.T) {
+	lower := testutil.NewGatedWriter()
+	// Priority 0 goes to the first band and everything else to the second.
+	qDisc := prio.New(lower, prio.Options{
+		Bands:   2,
+		Priomap: [prio.MaxBands]uint8{0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+	})
+	defer qDisc.Close()
+
+	holdQueue(t, qDisc, lower)
+	if err := writePacket(t, qDisc, 1, tosLowDelay); err != nil {
+		t.Fatalf("writePacket(_, _, 1, %#x) = %s", tosLowDelay, err)
+	}
+	if err := writePacket(t, qDisc, 2, tosNormal); err != nil {
+		t.Fatalf("writePacket(_, _, 2, %#x) = %s", tosNormal, err)
+	}
+	lower.Release()
+
+	lower.Expect(t, 2)
+	lower.Expect(t, 1)
+}
+
+func TestBandLimit(t *testing.T) {
+	lower := testutil.NewGatedWriter()
+	qDisc := prio.New(lower, prio.Options{Limit: 1})
+	defer qDisc.Close()
+
+	holdQueue(t, qDisc, lower)
+	if err := writePacket(t, qDisc, 1, tosNormal); err != nil {
+		t.Fatalf("writePacket(_, _, 1, %#x) = %s", tosNormal, err)
+	}
+	err := writePacket(t, qDisc, 2, tosNormal)
+	if _, ok := err.(*tcpip.ErrNoBufferSpace); !ok {
+		t.Fatalf("got writePacket(_, _, 2, %#x) = %v, want = %s", tosNormal, err, &tcpip.ErrNoBufferSpace{})
+	}
+	// Other bands are not limited.
+	if err := writePacket(t, qDisc, 3, tosLowDelay); err != nil {
+		t.Fatalf("writePacket(_, _, 3, %#x) = %s", tosLowDelay, err)
+	}
+	lower.Release()
+
+	lower.Expect(t, 3)
+	lower.Expect(t, 1)
+}
+
+func TestWriteRefusedAfterClosed(t *testing.T) {
+	qDisc := prio.New(testutil.NewGatedWriter(), prio.Options{})
+
+	qDisc.Close()
+	err := qDisc.WritePacket(nil)
+	if _, ok := err.(*tcpip.ErrClosedForSend); !ok {
+		t.Errorf("got err = %s, want %s", err, &tcpip.ErrClosedForSend{})
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
@@ -0,0 +1,265 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tbf provides the implementation of a token bucket queuing discipline
+// modeled after the tbf qdisc in Linux. Outbound packets are queued in order
+// and dispatched no faster than the configured rate, allowing bursts up to the
+// size of the bucket.
+package tbf
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sleep"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+var _ stack.QueueingDiscipline = (*discipline)(nil)
+
+const (
+	// BatchSize is the maximum number of packets written to the lower link
+	// endpoint at once.
+	BatchSize = 47
+
+	// DefaultBurst is the default size of the bucket in bytes.
+	DefaultBurst = 10 * 1514
+
+	// DefaultLimit is the default maximum number of queued bytes.
+	DefaultLimit = 64 << 10
+
+	qDiscClosed = 1
+)
+
+// Options configures a token bucket queuing discipline. Zero fields take their
+// default values.
+//
+// +stateify savable
+type Options struct {
+	// Rate is the rate at which packets are dispatched in bytes per second.
+	// A zero Rate does not limit the rate.
+	Rate uint64
+
+	// Burst is the size of the bucket in bytes, the largest number of bytes
+	// that can be dispatched at once. Larger packets are dropped.
+	Burst uint32
+
+	// Limit is the maximum number of queued bytes.
+	Limit uint32
+}
+
+// discipline represents a QueueingDiscipline which dispatches outgoing packets
+// in order, consuming tokens from a bucket that is refilled at a fixed rate.
+//
+// +stateify savable
+type discipline struct {
+	wg    sync.WaitGroup `state:"nosave"`
+	lower stack.LinkWriter
+	clock tcpip.Clock
+	opts  Options
+
+	// buffer is the time it takes to fill the bucket.
+	buffer time.Duration
+
+	mu sync.Mutex `state:"nosave"`
+	// packets holds the queued packets in arrival order.
+	//
+	// +checklocks:mu
+	packets []*stack.PacketBuffer
+	// backlog is the number of queued bytes.
+	//
+	// +checklocks:mu
+	backlog uint32
+	// tokens is the time worth of tokens in the bucket, at most buffer.
+	//
+	// +checklocks:mu
+	tokens time.Duration
+	// lastRefill is the time at which tokens was last updated.
+	//
+	// +checklocks:mu
+	lastRefill tcpip.MonotonicTime
+
+	// timer wakes the dispatcher when there are enough tokens for the next
+	// packet. It is only accessed by the dispatcher.
+	timer tcpip.Timer `state:"nosave"`
+
+	newPacketWaker sleep.Waker `state:"nosave"`
+	timerWaker     sleep.Waker `state:"nosave"`
+	closeWaker     sleep.Waker `state:"nosave"`
+
+	closed atomicbitops.Int32
+}
+
+// New creates a new token bucket queuing discipline that writes packets to
+// lower and refills tokens as time passes on clock.
+func New(lower stack.LinkWriter, clock tcpip.Clock, opts Options) stack.QueueingDiscipline {
+	if opts.Burst == 0 {
+		opts.Burst = DefaultBurst
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+	d := &discipline{
+		lower:      lower,
+		clock:      clock,
+		opts:       opts,
+		lastRefill: clock.NowMonotonic(),
+	}
+	d.buffer = d.cost(opts.Burst)
+	d.tokens = d.buffer
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.dispatchLoop()
+	}()
+	return d
+}
+
+// cost returns the time worth of tokens needed to dispatch size bytes.
+func (d *discipline) cost(size uint32) time.Duration {
+	if d.opts.Rate == 0 {
+		return 0
+	}
+	return time.Duration(uint64(size) * uint64(time.Second) / d.opts.Rate)
+}
+
+func (d *discipline) dispatchLoop() {
+	s := sleep.Sleeper{}
+	s.AddWaker(&d.newPacketWaker)
+	s.AddWaker(&d.timerWaker)
+	s.AddWaker(&d.closeWaker)
+	defer s.Done()
+
+	var batch stack.PacketBufferList
+	for {
+		switch w := s.Fetch(true); w {
+		case &d.newPacketWaker, &d.timerWaker:
+		case &d.closeWaker:
+			d.mu.Lock()
+			d.purgeLocked()
+			d.mu.Unlock()
+			if d.timer != nil {
+				d.timer.Stop()
+			}
+			return
+		default:
+			panic("unknown waker")
+		}
+		for {
+			d.mu.Lock()
+			wait := d.dequeueLocked(&batch)
+			d.mu.Unlock()
+			if batch.Len() == 0 {
+				if wait > 0 {
+					d.armTimer(wait)
+				}
+				break
+			}
+			for _, pkt := range batch.AsSlice() {
+				pkt.ReportTXTimestamp(tcpip.TXTimestampSoftware)
+			}
+			_, _ = d.lower.WritePackets(batch)
+			batch.Reset()
+		}
+	}
+}
+
+// armTimer wakes the dispatcher after delay.
+func (d *discipline) armTimer(delay time.Duration) {
+	if d.timer == nil {
+		d.timer = d.clock.AfterFunc(delay, d.timerWaker.Assert)
+		return
+	}
+	d.timer.Reset(delay)
+}
+
+// dequeueLocked moves up to BatchSize packets for which there are enough
+// tokens to batch. If the next packet has to wait for tokens, it returns how
+// long.
+//
+// +checklocks:d.mu
+func (d *discipline) dequeueLocked(batch *stack.PacketBufferList) time.Duration {
+	now := d.clock.NowMonotonic()
+	d.tokens += now.Sub(d.lastRefill)
+	if d.tokens > d.buffer {
+		d.tokens = d.buffer
+	}
+	d.lastRefill = now
+
+	for batch.Len() < BatchSize && len(d.packets) > 0 {
+		pkt := d.packets[0]
+		size := uint32(pkt.Size())
+		cost := d.cost(size)
+		if cost > d.tokens {
+			return cost - d.tokens
+		}
+		d.tokens -= cost
+		d.packets[0] = nil
+		d.packets = d.packets[1:]
+		d.backlog -= size
+		batch.PushBack(pkt)
+	}
+	return 0
+}
+
+// purgeLocked drops all queued packets.
+//
+// +checklocks:d.mu
+func (d *discipline) purgeLocked() {
+	for _, pkt := range d.packets {
+		pkt.DecRef()
+	}
+	d.packets = nil
+	d.backlog = 0
+}
+
+// WritePacket implements stack.QueueingDiscipline.WritePacket.
+//
+// The packet must have the following fields populated:
+//   - pkt.EgressRoute
+//   - pkt.GSOOptions
+//   - pkt.NetworkProtocolNumber
+func (d *discipline) WritePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	if d.closed.Load() == qDiscClosed {
+		return &tcpip.ErrClosedForSend{}
+	}
+
+	// As in Linux, packets that can never be covered by the bucket are
+	// dropped.
+	size := uint32(pkt.Size())
+	if size > d.opts.Burst {
+		return &tcpip.ErrNoBufferSpace{}
+	}
+
+	d.mu.Lock()
+	if d.backlog+size > d.opts.Limit {
+		d.mu.Unlock()
+		return &tcpip.ErrNoBufferSpace{}
+	}
+	d.packets = append(d.packets, pkt.IncRef())
+	d.backlog += size
+	d.mu.Unlock()
+
+	d.newPacketWaker.Assert()
+	return nil
+}
+
+// Close implements stack.QueueingDiscipline.Close.
+func (d *discipline) Close() {
+	d.closed.Store(qDiscClosed)
+	d.closeWaker.Assert()
+	d.wg.Wait()
+}
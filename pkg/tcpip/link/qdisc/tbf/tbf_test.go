@@ -0,0 +1,121 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tbf_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/internal/testutil"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/tbf"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// writePacket writes a packet of size bytes whose first byte is id.
+func writePacket(t *testing.T, qDisc stack.QueueingDiscipline, id byte, size int) tcpip.Error {
+	t.Helper()
+	pkt := testutil.NewPacket(id, size)
+	defer pkt.DecRef()
+	return qDisc.WritePacket(pkt)
+}
+
+func TestRate(t *testing.T) {
+	clock := testutil.NewClock()
+	lower := testutil.NewWriter()
+	qDisc := tbf.New(lower, clock, tbf.Options{
+		Rate:  1000,
+		Burst: 200,
+	})
+	defer qDisc.Close()
+
+	for id := byte(1); id <= 4; id++ {
+		if err := writePacket(t, qDisc, id, 100); err != nil {
+			t.Fatalf("writePacket(_, _, %d, 100) = %s", id, err)
+		}
+	}
+
+	// The bucket starts full, so the first two packets depart right away.
+	lower.Expect(t, 1)
+	lower.Expect(t, 2)
+	clock.WaitTimer(t, 100*time.Millisecond)
+	lower.ExpectNone(t)
+
+	// Each following packet waits for 100 bytes worth of tokens.
+	clock.Advance(100 * time.Millisecond)
+	lower.Expect(t, 3)
+	clock.WaitTimer(t, 200*time.Millisecond)
+	lower.ExpectNone(t)
+	clock.Advance(100 * time.Millisecond)
+	lower.Expect(t, 4)
+}
+
+func TestPacketLargerThanBurst(t *testing.T) {
+	qDisc := tbf.New(testutil.NewWriter(), faketime.NewManualClock(), tbf.Options{
+		Rate:  1000,
+		Burst: 100,
+	})
+	defer qDisc.Close()
+
+	if err := writePacket(t, qDisc, 1, 101); !testutil.IsNoBufferSpace(err) {
+		t.Fatalf("got writePacket(_, _, 1, 101) = %v, want = %s", err, &tcpip.ErrNoBufferSpace{})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	clock := faketime.NewManualClock()
+	lower := testutil.NewWriter()
+	qDisc := tbf.New(lower, clock, tbf.Options{
+		Rate:  1000,
+		Burst: 100,
+		Limit: 200,
+	})
+	defer qDisc.Close()
+
+	// Drain the bucket so that packets stay queued.
+	if err := writePacket(t, qDisc, 1, 100); err != nil {
+		t.Fatalf("writePacket(_, _, 1, 100) = %s", err)
+	}
+	lower.Expect(t, 1)
+
+	for id := byte(2); id <= 3; id++ {
+		if err := writePacket(t, qDisc, id, 100); err != nil {
+			t.Fatalf("writePacket(_, _, %d, 100) = %s", id, err)
+		}
+	}
+	if err := writePacket(t, qDisc, 4, 100); !testutil.IsNoBufferSpace(err) {
+		t.Fatalf("got writePacket(_, _, 4, 100) = %v, want = %s", err, &tcpip.ErrNoBufferSpace{})
+	}
+}
+
+func TestWriteRefusedAfterClosed(t *testing.T) {
+	qDisc := tbf.New(testutil.NewWriter(), faketime.NewManualClock(), tbf.Options{})
+
+	qDisc.Close()
+	err := qDisc.WritePacket(nil)
+	if _, ok := err.(*tcpip.ErrClosedForSend); !ok {
+		t.Errorf("got err = %s, want %s", err, &tcpip.ErrClosedForSend{})
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
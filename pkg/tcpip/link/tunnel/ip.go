@@ -0,0 +1,309 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// Kind is the encapsulation of an IP tunnel.
+type Kind int
+
+const (
+	// KindIPIP tunnels carry IPv4 packets directly over IP.
+	KindIPIP Kind = iota
+
+	// KindSIT tunnels carry IPv6 packets directly over IPv4.
+	KindSIT
+
+	// KindGRE tunnels carry IPv4 and IPv6 packets over GRE.
+	KindGRE
+
+	// KindGRETap tunnels carry Ethernet frames over GRE.
+	KindGRETap
+)
+
+// String implements fmt.Stringer.
+func (k Kind) String() string {
+	switch k {
+	case KindIPIP:
+		return "ipip"
+	case KindSIT:
+		return "sit"
+	case KindGRE:
+		return "gre"
+	case KindGRETap:
+		return "gretap"
+	default:
+		return "unknown"
+	}
+}
+
+// GREKey is a GRE key. The zero value is no key.
+//
+// +stateify savable
+type GREKey struct {
+	// Present indicates whether the key is present in GRE headers.
+	Present bool
+
+	// Key is the value of the key.
+	Key uint32
+}
+
+// Options are the options of an IP tunnel.
+type Options struct {
+	Config
+
+	// Kind is the encapsulation of the tunnel.
+	Kind Kind
+
+	// InputKey is the key that received GRE packets must carry.
+	InputKey GREKey
+
+	// OutputKey is the key that sent GRE packets carry.
+	OutputKey GREKey
+
+	// InputChecksum requires received GRE packets to carry a checksum.
+	InputChecksum bool
+
+	// OutputChecksum adds a checksum to sent GRE packets.
+	OutputChecksum bool
+}
+
+var _ stack.LinkEndpoint = (*Endpoint)(nil)
+var _ stack.TunnelHandler = (*Endpoint)(nil)
+
+// Endpoint is an IP-in-IP, SIT, GRE or gretap tunnel link endpoint.
+//
+// +stateify savable
+type Endpoint struct {
+	endpoint
+
+	kind           Kind
+	inputKey       GREKey
+	outputKey      GREKey
+	inputChecksum  bool
+	outputChecksum bool
+}
+
+// New creates a new IP tunnel and starts receiving its packets from
+// opts.Stack. Ethernet frames are read from and written to gretap
+// endpoints, so they must be wrapped by an ethernet.Endpoint.
+func New(opts Options) (*Endpoint, tcpip.Error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	overhead := uint32(0)
+	switch opts.Kind {
+	case KindIPIP, KindSIT:
+		if opts.netProto() != header.IPv4ProtocolNumber {
+			return nil, &tcpip.ErrNotSupported{}
+		}
+	case KindGRE, KindGRETap:
+		overhead = uint32(header.GREHeaderSize(&header.GREFields{
+			ChecksumPresent: opts.OutputChecksum,
+			KeyPresent:      opts.OutputKey.Present,
+		}))
+		if opts.Kind == KindGRETap {
+			overhead += header.EthernetMinimumSize
+		}
+	default:
+		return nil, &tcpip.ErrNotSupported{}
+	}
+
+	var linkAddr tcpip.LinkAddress
+	if opts.Kind == KindGRETap {
+		linkAddr = tcpip.GetRandMacAddr()
+	}
+	e := &Endpoint{
+		endpoint: endpoint{
+			cfg:      opts.Config,
+			mtu:      opts.defaultMTU(overhead),
+			linkAddr: linkAddr,
+		},
+		kind:           opts.Kind,
+		inputKey:       opts.InputKey,
+		outputKey:      opts.OutputKey,
+		inputChecksum:  opts.InputChecksum,
+		outputChecksum: opts.OutputChecksum,
+	}
+	e.cfg.Stack.RegisterTunnelHandler(e.protocol(), e)
+	return e, nil
+}
+
+// Kind returns the encapsulation of the tunnel.
+func (e *Endpoint) Kind() Kind {
+	return e.kind
+}
+
+// Config returns the underlay configuration of the tunnel.
+func (e *Endpoint) Config() Config {
+	return e.cfg
+}
+
+// protocol returns the underlay IP protocol of e.
+func (e *Endpoint) protocol() tcpip.TransportProtocolNumber {
+	switch e.kind {
+	case KindIPIP:
+		return header.IPIPProtocolNumber
+	case KindSIT:
+		return header.IPv6EncapsulationProtocolNumber
+	default:
+		return header.GREProtocolNumber
+	}
+}
+
+// Close implements stack.LinkEndpoint.Close.
+func (e *Endpoint) Close() {
+	if e.close() {
+		e.cfg.Stack.UnregisterTunnelHandler(e.protocol(), e)
+	}
+}
+
+// ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType.
+func (e *Endpoint) ARPHardwareType() header.ARPHardwareType {
+	switch e.kind {
+	case KindIPIP:
+		return header.ARPHardwareTunnel
+	case KindSIT:
+		return header.ARPHardwareSIT
+	case KindGRE:
+		return header.ARPHardwareIPGRE
+	default:
+		// Let the ethernet endpoint report itself.
+		return header.ARPHardwareNone
+	}
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+func (e *Endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	n := 0
+	for _, pkt := range pkts.AsSlice() {
+		if err := e.writePacket(pkt); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (e *Endpoint) writePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	if e.cfg.Remote.Len() == 0 {
+		// Without a remote end, there's nowhere to send to.
+		return &tcpip.ErrHostUnreachable{}
+	}
+	encap := encapsulation{
+		remote:   e.cfg.Remote,
+		protocol: e.protocol(),
+		ttl:      e.innerTTL(pkt),
+		tos:      e.innerTOS(pkt),
+	}
+	switch e.kind {
+	case KindIPIP:
+		if pkt.NetworkProtocolNumber != header.IPv4ProtocolNumber {
+			return &tcpip.ErrNotSupported{}
+		}
+	case KindSIT:
+		if pkt.NetworkProtocolNumber != header.IPv6ProtocolNumber {
+			return &tcpip.ErrNotSupported{}
+		}
+	case KindGRE, KindGRETap:
+		fields := header.GREFields{
+			Protocol:        pkt.NetworkProtocolNumber,
+			ChecksumPresent: e.outputChecksum,
+			KeyPresent:      e.outputKey.Present,
+			Key:             e.outputKey.Key,
+		}
+		if e.kind == KindGRETap {
+			fields.Protocol = header.GRETransparentEthernetBridging
+		}
+		encap.headerLength = header.GREHeaderSize(&fields)
+		encap.encode = func(_ *stack.Route, pkt *stack.PacketBuffer) {
+			gre := header.GRE(pkt.TransportHeader().Push(encap.headerLength))
+			gre.Encode(&fields)
+			if fields.ChecksumPresent {
+				gre.SetChecksum(^checksum.Checksum(gre, pkt.Data().Checksum()))
+			}
+		}
+	}
+	return e.write(pkt, &encap)
+}
+
+// HandleTunnelPacket implements stack.TunnelHandler.HandleTunnelPacket.
+func (e *Endpoint) HandleTunnelPacket(pkt *stack.PacketBuffer) bool {
+	if pkt.NetworkProtocolNumber != e.cfg.netProto() {
+		return false
+	}
+	net := pkt.Network()
+	if !e.cfg.acceptsAddresses(pkt.NICID, net.SourceAddress(), net.DestinationAddress()) {
+		return false
+	}
+
+	var (
+		protocol tcpip.NetworkProtocolNumber
+		hdrLen   int
+	)
+	switch e.kind {
+	case KindIPIP:
+		protocol = header.IPv4ProtocolNumber
+	case KindSIT:
+		protocol = header.IPv6ProtocolNumber
+	case KindGRE, KindGRETap:
+		gre, ok := pkt.Data().PullUp(header.GREMinimumSize)
+		if !ok {
+			return false
+		}
+		if hdrLen = header.GRE(gre).HeaderLength(); hdrLen > header.GREMinimumSize {
+			if gre, ok = pkt.Data().PullUp(hdrLen); !ok {
+				return false
+			}
+		}
+		if !header.GRE(gre).IsValid() {
+			return false
+		}
+		protocol = header.GRE(gre).Protocol()
+		switch e.kind {
+		case KindGRE:
+			if protocol != header.IPv4ProtocolNumber && protocol != header.IPv6ProtocolNumber {
+				return false
+			}
+		case KindGRETap:
+			if protocol != header.GRETransparentEthernetBridging {
+				return false
+			}
+			// The ethernet endpoint takes the protocol from the frame.
+			protocol = 0
+		}
+		if key, ok := header.GRE(gre).Key(); ok != e.inputKey.Present || key != e.inputKey.Key {
+			return false
+		}
+		if _, ok := header.GRE(gre).Checksum(); ok {
+			if pkt.Data().Checksum() != 0xffff {
+				// The packet is ours, but corrupted.
+				return true
+			}
+		} else if e.inputChecksum {
+			return true
+		}
+	}
+
+	payload := pkt.Data().ToBuffer()
+	payload.TrimFront(int64(hdrLen))
+	e.deliver(protocol, payload)
+	return true
+}
@@ -0,0 +1,382 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tunnel provides link endpoints that encapsulate the packets written
+// to them in IP packets routed by a netstack stack, and decapsulate the
+// packets received by that stack: IP-in-IP, SIT, GRE, gretap and VXLAN
+// tunnels.
+//
+// Endpoints carrying Ethernet frames (gretap and VXLAN) expect to be wrapped
+// by an ethernet.Endpoint.
+package tunnel
+
+import (
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// defaultUnderlayMTU is the MTU assumed for the underlay when the tunnel
+	// isn't bound to a NIC.
+	defaultUnderlayMTU = 1500
+
+	// maxTunnelDepth is the maximum number of tunnels a packet can be
+	// encapsulated by. Like Linux's XMIT_RECURSION_LIMIT, it breaks routing
+	// loops where the route to a tunnel's remote end goes through the tunnel
+	// itself.
+	maxTunnelDepth = 8
+)
+
+// Config is the underlay configuration shared by all tunnels.
+//
+// +stateify savable
+type Config struct {
+	// Stack is the stack that routes encapsulated packets and receives
+	// them.
+	Stack *stack.Stack
+
+	// Local is the underlay source address. If unspecified, it is selected
+	// by the route to the remote end, and packets sent to any local address
+	// are accepted.
+	Local tcpip.Address
+
+	// Remote is the underlay address of the remote end of the tunnel. If
+	// unspecified, packets from any address are accepted.
+	Remote tcpip.Address
+
+	// NetProto is the underlay network protocol. If zero, it is derived from
+	// Local or Remote, and defaults to IPv4.
+	NetProto tcpip.NetworkProtocolNumber
+
+	// Link is the NIC encapsulated packets are sent and received through.
+	// If zero, any NIC is used.
+	Link tcpip.NICID
+
+	// TTL is the TTL or hop limit of encapsulated packets. If zero, IP
+	// tunnels inherit it from the inner packet, and VXLAN tunnels use the
+	// default of the route.
+	TTL uint8
+
+	// TOS is the TOS or traffic class of encapsulated packets. If its least
+	// significant bit is set, it is inherited from inner IPv4 packets, as on
+	// Linux.
+	TOS uint8
+
+	// MTU is the MTU of the tunnel. If zero, it is the MTU of Link, or
+	// 1500, minus the encapsulation overhead.
+	MTU uint32
+}
+
+// netProto returns the underlay network protocol of c.
+func (c *Config) netProto() tcpip.NetworkProtocolNumber {
+	switch {
+	case c.NetProto != 0:
+		return c.NetProto
+	case c.Local.Len() == header.IPv6AddressSize, c.Remote.Len() == header.IPv6AddressSize:
+		return header.IPv6ProtocolNumber
+	default:
+		return header.IPv4ProtocolNumber
+	}
+}
+
+// addressSize returns the size of the underlay addresses of c.
+func (c *Config) addressSize() int {
+	if c.netProto() == header.IPv6ProtocolNumber {
+		return header.IPv6AddressSize
+	}
+	return header.IPv4AddressSize
+}
+
+// validate checks that the addresses of c belong to its network protocol.
+func (c *Config) validate() tcpip.Error {
+	if c.Stack == nil {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+	for _, addr := range []tcpip.Address{c.Local, c.Remote} {
+		if addr.Len() != 0 && addr.Len() != c.addressSize() {
+			return &tcpip.ErrBadAddress{}
+		}
+	}
+	return nil
+}
+
+// underlayHeaderLength returns the size of the underlay network header.
+func (c *Config) underlayHeaderLength() uint32 {
+	if c.netProto() == header.IPv6ProtocolNumber {
+		return header.IPv6MinimumSize
+	}
+	return header.IPv4MinimumSize
+}
+
+// defaultMTU returns the MTU of a tunnel with the given encapsulation
+// overhead, not counting the underlay network header.
+func (c *Config) defaultMTU(overhead uint32) uint32 {
+	if c.MTU != 0 {
+		return c.MTU
+	}
+	mtu := uint32(defaultUnderlayMTU)
+	if c.Link != 0 {
+		if info, ok := c.Stack.NICInfo()[c.Link]; ok {
+			mtu = info.MTU
+		}
+	}
+	overhead += c.underlayHeaderLength()
+	if mtu < overhead {
+		return 0
+	}
+	return mtu - overhead
+}
+
+// acceptsAddresses returns true if a packet with the given underlay addresses
+// received on the NIC nicID belongs to a tunnel configured with c.
+func (c *Config) acceptsAddresses(nicID tcpip.NICID, src, dst tcpip.Address) bool {
+	if c.Link != 0 && c.Link != nicID {
+		return false
+	}
+	if c.Remote.Len() != 0 && c.Remote != src {
+		return false
+	}
+	if c.Local.Len() != 0 && c.Local != dst {
+		return false
+	}
+	return true
+}
+
+// endpoint holds the state shared by all tunnel link endpoints.
+//
+// +stateify savable
+type endpoint struct {
+	cfg Config
+
+	mu sync.RWMutex `state:"nosave"`
+	// +checklocks:mu
+	dispatcher stack.NetworkDispatcher
+	// +checklocks:mu
+	linkAddr tcpip.LinkAddress
+	// +checklocks:mu
+	mtu uint32
+	// +checklocks:mu
+	closed bool
+	// +checklocks:mu
+	onCloseAction func() `state:"nosave"`
+}
+
+// Attach implements stack.LinkEndpoint.Attach.
+func (e *endpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dispatcher = dispatcher
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (e *endpoint) IsAttached() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.dispatcher != nil
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (e *endpoint) MTU() uint32 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.mtu
+}
+
+// SetMTU implements stack.LinkEndpoint.SetMTU.
+func (e *endpoint) SetMTU(mtu uint32) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mtu = mtu
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities.
+func (*endpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return 0
+}
+
+// MaxHeaderLength implements stack.LinkEndpoint.MaxHeaderLength. Encapsulated
+// packets are built from a copy of the packet, so no space is reserved for
+// the underlay headers.
+func (*endpoint) MaxHeaderLength() uint16 {
+	return 0
+}
+
+// LinkAddress implements stack.LinkEndpoint.LinkAddress.
+func (e *endpoint) LinkAddress() tcpip.LinkAddress {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.linkAddr
+}
+
+// SetLinkAddress implements stack.LinkEndpoint.SetLinkAddress.
+func (e *endpoint) SetLinkAddress(addr tcpip.LinkAddress) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.linkAddr = addr
+}
+
+// Wait implements stack.LinkEndpoint.Wait.
+func (*endpoint) Wait() {}
+
+// AddHeader implements stack.LinkEndpoint.AddHeader.
+func (*endpoint) AddHeader(*stack.PacketBuffer) {}
+
+// ParseHeader implements stack.LinkEndpoint.ParseHeader.
+func (*endpoint) ParseHeader(*stack.PacketBuffer) bool { return true }
+
+// SetOnCloseAction implements stack.LinkEndpoint.SetOnCloseAction.
+func (e *endpoint) SetOnCloseAction(action func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onCloseAction = action
+}
+
+// close marks e closed and runs its close action. It returns false if e was
+// already closed.
+func (e *endpoint) close() bool {
+	e.mu.Lock()
+	closed := e.closed
+	e.closed = true
+	action := e.onCloseAction
+	e.onCloseAction = nil
+	e.mu.Unlock()
+	if closed {
+		return false
+	}
+	if action != nil {
+		action()
+	}
+	return true
+}
+
+// deliver delivers a decapsulated packet with the given payload to the
+// stack e is attached to.
+func (e *endpoint) deliver(protocol tcpip.NetworkProtocolNumber, payload buffer.Buffer) {
+	e.mu.RLock()
+	d := e.dispatcher
+	closed := e.closed
+	e.mu.RUnlock()
+	if d == nil || closed {
+		payload.Release()
+		return
+	}
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		Payload: payload,
+	})
+	d.DeliverNetworkPacket(protocol, pkt)
+	pkt.DecRef()
+}
+
+// innerTTL returns the TTL to use for the encapsulation of pkt.
+func (e *endpoint) innerTTL(pkt *stack.PacketBuffer) uint8 {
+	if e.cfg.TTL != 0 {
+		return e.cfg.TTL
+	}
+	switch h := pkt.NetworkHeader().Slice(); pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		if len(h) >= header.IPv4MinimumSize {
+			return header.IPv4(h).TTL()
+		}
+	case header.IPv6ProtocolNumber:
+		if len(h) >= header.IPv6MinimumSize {
+			return header.IPv6(h).HopLimit()
+		}
+	}
+	return 0
+}
+
+// innerTOS returns the TOS to use for the encapsulation of pkt.
+func (e *endpoint) innerTOS(pkt *stack.PacketBuffer) uint8 {
+	if e.cfg.TOS&1 == 0 {
+		return e.cfg.TOS
+	}
+	if h := pkt.NetworkHeader().Slice(); pkt.NetworkProtocolNumber == header.IPv4ProtocolNumber && len(h) >= header.IPv4MinimumSize {
+		tos, _ := header.IPv4(h).TOS()
+		return tos
+	}
+	return e.cfg.TOS &^ 1
+}
+
+// encapsulation describes the underlay packet to send for an inner packet.
+type encapsulation struct {
+	// remote is the underlay destination.
+	remote tcpip.Address
+
+	// protocol is the underlay transport protocol.
+	protocol tcpip.TransportProtocolNumber
+
+	// ttl and tos are the underlay TTL and TOS. A zero TTL selects the
+	// default of the route.
+	ttl uint8
+	tos uint8
+
+	// headerLength is the length of the tunnel header pushed by encode, in
+	// addition to the payload prefix.
+	headerLength int
+
+	// prefix is prepended to the inner packet in the payload of the
+	// underlay packet.
+	prefix []byte
+
+	// encode pushes and fills the tunnel header once the route is known.
+	encode func(r *stack.Route, pkt *stack.PacketBuffer)
+}
+
+// write sends inner through the tunnel as described by encap.
+func (e *endpoint) write(inner *stack.PacketBuffer, encap *encapsulation) tcpip.Error {
+	if inner.TunnelDepth >= maxTunnelDepth {
+		return &tcpip.ErrHostUnreachable{}
+	}
+	r, err := e.cfg.Stack.FindRoute(e.cfg.Link, e.cfg.Local, encap.remote, e.cfg.netProto(), false /* multicastLoop */)
+	if err != nil {
+		return err
+	}
+	defer r.Release()
+
+	// The inner packet is deep copied, as its views may be written to by
+	// the receiver of the underlay packet.
+	innerBuf := inner.ToBuffer()
+	var payload buffer.Buffer
+	if len(encap.prefix) != 0 {
+		payload = buffer.MakeWithData(encap.prefix)
+	}
+	clone := innerBuf.DeepClone()
+	payload.Merge(&clone)
+	innerBuf.Release()
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: int(r.MaxHeaderLength()) + encap.headerLength,
+		Payload:            payload,
+	})
+	defer pkt.DecRef()
+	pkt.TunnelDepth = inner.TunnelDepth + 1
+	pkt.Owner = inner.Owner
+	pkt.Mark = inner.Mark
+	if encap.encode != nil {
+		encap.encode(r, pkt)
+	}
+
+	ttl := encap.ttl
+	if ttl == 0 {
+		ttl = r.DefaultTTL()
+	}
+	return r.WritePacket(stack.NetworkHeaderParams{
+		Protocol: encap.protocol,
+		TTL:      ttl,
+		TOS:      encap.tos,
+	}, pkt)
+}
@@ -0,0 +1,452 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel_test
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/link/tunnel"
+	"gvisor.dev/gvisor/pkg/tcpip/link/veth"
+	"gvisor.dev/gvisor/pkg/tcpip/network/arp"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+const (
+	underlayNICID = 1
+	tunnelNICID   = 2
+	testPort      = 5000
+)
+
+var (
+	underlayAddrs = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom4([4]byte{10, 0, 0, 1}), PrefixLen: 24},
+		{Address: tcpip.AddrFrom4([4]byte{10, 0, 0, 2}), PrefixLen: 24},
+	}
+	underlayAddrs6 = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}), PrefixLen: 64},
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}), PrefixLen: 64},
+	}
+	innerAddrs = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom4([4]byte{192, 168, 0, 1}), PrefixLen: 24},
+		{Address: tcpip.AddrFrom4([4]byte{192, 168, 0, 2}), PrefixLen: 24},
+	}
+	innerAddrs6 = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}), PrefixLen: 64},
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}), PrefixLen: 64},
+	}
+)
+
+func protocolFor(addr tcpip.Address) tcpip.NetworkProtocolNumber {
+	if addr.Len() == header.IPv6AddressSize {
+		return ipv6.ProtocolNumber
+	}
+	return ipv4.ProtocolNumber
+}
+
+func addAddress(t *testing.T, s *stack.Stack, nicID tcpip.NICID, addr tcpip.AddressWithPrefix) {
+	t.Helper()
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          protocolFor(addr.Address),
+		AddressWithPrefix: addr,
+	}
+	if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+	}
+	s.AddRoute(tcpip.Route{
+		Destination: addr.Subnet(),
+		NIC:         nicID,
+	})
+}
+
+func newStack(t *testing.T) *stack.Stack {
+	t.Helper()
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol, arp.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+	})
+	t.Cleanup(func() {
+		s.Close()
+		s.Wait()
+	})
+	return s
+}
+
+// newStacks returns two stacks connected by a veth pair with the given
+// underlay addresses.
+func newStacks(t *testing.T, addrs [2]tcpip.AddressWithPrefix) [2]*stack.Stack {
+	t.Helper()
+	a, b := veth.NewPair(1500)
+	var stacks [2]*stack.Stack
+	for i, ep := range []*veth.Endpoint{a, b} {
+		s := newStack(t)
+		if err := s.CreateNIC(underlayNICID, ethernet.New(ep)); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", underlayNICID, err)
+		}
+		addAddress(t, s, underlayNICID, addrs[i])
+		stacks[i] = s
+	}
+	return stacks
+}
+
+// exchange checks that a UDP datagram sent from the first stack to the
+// second through the tunnel addresses is received.
+func exchange(t *testing.T, stacks [2]*stack.Stack, addrs [2]tcpip.AddressWithPrefix) {
+	t.Helper()
+	netProto := protocolFor(addrs[0].Address)
+	server, err := gonet.DialUDP(stacks[1], &tcpip.FullAddress{Addr: addrs[1].Address, Port: testPort}, nil, netProto)
+	if err != nil {
+		t.Fatalf("DialUDP(_, %s, nil, %d): %s", addrs[1].Address, netProto, err)
+	}
+	defer server.Close()
+	client, err := gonet.DialUDP(stacks[0], nil, &tcpip.FullAddress{Addr: addrs[1].Address, Port: testPort}, netProto)
+	if err != nil {
+		t.Fatalf("DialUDP(_, nil, %s, %d): %s", addrs[1].Address, netProto, err)
+	}
+	defer client.Close()
+
+	// Link address resolution may drop the first datagrams, so keep
+	// sending until one is received.
+	want := "hello through the tunnel"
+	buf := make([]byte, 100)
+	for i := 0; i < 20; i++ {
+		if _, err := client.Write([]byte(want)); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+		server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, addr, err := server.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+		if got := string(buf[:n]); got != want {
+			t.Fatalf("got payload %q, want %q", got, want)
+		}
+		src := addrs[0].Address
+		if got, want := addr.(*net.UDPAddr).IP, net.IP(src.AsSlice()); !got.Equal(want) {
+			t.Errorf("got source address %s, want %s", got, want)
+		}
+		return
+	}
+	t.Fatalf("datagram to %s wasn't received", addrs[1].Address)
+}
+
+func TestIPTunnels(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		underlay [2]tcpip.AddressWithPrefix
+		inner    [2]tcpip.AddressWithPrefix
+		opts     [2]tunnel.Options
+		ethernet bool
+	}{
+		{
+			name:     "ipip",
+			underlay: underlayAddrs,
+			inner:    innerAddrs,
+			opts:     [2]tunnel.Options{{Kind: tunnel.KindIPIP}, {Kind: tunnel.KindIPIP}},
+		},
+		{
+			name:     "sit",
+			underlay: underlayAddrs,
+			inner:    innerAddrs6,
+			opts:     [2]tunnel.Options{{Kind: tunnel.KindSIT}, {Kind: tunnel.KindSIT}},
+		},
+		{
+			name:     "gre",
+			underlay: underlayAddrs,
+			inner:    innerAddrs,
+			opts:     [2]tunnel.Options{{Kind: tunnel.KindGRE}, {Kind: tunnel.KindGRE}},
+		},
+		{
+			name:     "gre over IPv6",
+			underlay: underlayAddrs6,
+			inner:    innerAddrs6,
+			opts:     [2]tunnel.Options{{Kind: tunnel.KindGRE}, {Kind: tunnel.KindGRE}},
+		},
+		{
+			name:     "gre with key and checksum",
+			underlay: underlayAddrs,
+			inner:    innerAddrs,
+			opts: [2]tunnel.Options{
+				{Kind: tunnel.KindGRE, OutputKey: tunnel.GREKey{Present: true, Key: 42}, OutputChecksum: true},
+				{Kind: tunnel.KindGRE, InputKey: tunnel.GREKey{Present: true, Key: 42}, InputChecksum: true},
+			},
+		},
+		{
+			name:     "gretap",
+			underlay: underlayAddrs,
+			inner:    innerAddrs,
+			opts:     [2]tunnel.Options{{Kind: tunnel.KindGRETap}, {Kind: tunnel.KindGRETap}},
+			ethernet: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stacks := newStacks(t, test.underlay)
+			for i, s := range stacks {
+				opts := test.opts[i]
+				opts.Stack = s
+				opts.Local = test.underlay[i].Address
+				opts.Remote = test.underlay[1-i].Address
+				ep, err := tunnel.New(opts)
+				if err != nil {
+					t.Fatalf("New(%+v): %s", opts, err)
+				}
+				var linkEP stack.LinkEndpoint = ep
+				if test.ethernet {
+					linkEP = ethernet.New(ep)
+				}
+				if err := s.CreateNIC(tunnelNICID, linkEP); err != nil {
+					t.Fatalf("CreateNIC(%d, _): %s", tunnelNICID, err)
+				}
+				addAddress(t, s, tunnelNICID, test.inner[i])
+			}
+			exchange(t, stacks, test.inner)
+		})
+	}
+}
+
+func TestGREKeyMismatch(t *testing.T) {
+	stacks := newStacks(t, underlayAddrs)
+	keys := [2]uint32{1, 2}
+	for i, s := range stacks {
+		ep, err := tunnel.New(tunnel.Options{
+			Config: tunnel.Config{
+				Stack:  s,
+				Local:  underlayAddrs[i].Address,
+				Remote: underlayAddrs[1-i].Address,
+			},
+			Kind:      tunnel.KindGRE,
+			InputKey:  tunnel.GREKey{Present: true, Key: keys[i]},
+			OutputKey: tunnel.GREKey{Present: true, Key: keys[i]},
+		})
+		if err != nil {
+			t.Fatalf("New(_): %s", err)
+		}
+		if err := s.CreateNIC(tunnelNICID, ep); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", tunnelNICID, err)
+		}
+		addAddress(t, s, tunnelNICID, innerAddrs[i])
+	}
+
+	server, err := gonet.DialUDP(stacks[1], &tcpip.FullAddress{Addr: innerAddrs[1].Address, Port: testPort}, nil, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("DialUDP: %s", err)
+	}
+	defer server.Close()
+	client, err := gonet.DialUDP(stacks[0], nil, &tcpip.FullAddress{Addr: innerAddrs[1].Address, Port: testPort}, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("DialUDP: %s", err)
+	}
+	defer client.Close()
+	for i := 0; i < 5; i++ {
+		if _, err := client.Write([]byte("x")); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+	}
+	server.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	if n, _, err := server.ReadFrom(make([]byte, 10)); err == nil {
+		t.Fatalf("received %d bytes with a mismatched GRE key", n)
+	}
+	if got := stacks[1].Stats().IP.PacketsDelivered.Value(); got == 0 {
+		t.Errorf("no GRE packets were delivered to the second stack")
+	}
+}
+
+func TestRoutingLoop(t *testing.T) {
+	s := newStack(t)
+	ep, err := tunnel.New(tunnel.Options{
+		Config: tunnel.Config{
+			Stack:  s,
+			Remote: underlayAddrs[1].Address,
+		},
+		Kind: tunnel.KindIPIP,
+	})
+	if err != nil {
+		t.Fatalf("New(_): %s", err)
+	}
+	if err := s.CreateNIC(tunnelNICID, ep); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", tunnelNICID, err)
+	}
+	addAddress(t, s, tunnelNICID, innerAddrs[0])
+	// The remote end of the tunnel is routed through the tunnel itself.
+	s.AddRoute(tcpip.Route{Destination: header.IPv4EmptySubnet, NIC: tunnelNICID})
+
+	conn, dialErr := gonet.DialUDP(s, nil, &tcpip.FullAddress{Addr: innerAddrs[1].Address, Port: testPort}, ipv4.ProtocolNumber)
+	if dialErr != nil {
+		t.Fatalf("DialUDP: %s", dialErr)
+	}
+	defer conn.Close()
+	// The write must not recurse forever.
+	if _, err := conn.Write([]byte("x")); err == nil {
+		t.Errorf("Write through a routing loop succeeded")
+	}
+}
+
+func TestVXLAN(t *testing.T) {
+	stacks := newStacks(t, underlayAddrs)
+	var eps [2]*tunnel.VXLANEndpoint
+	for i, s := range stacks {
+		ep, err := tunnel.NewVXLAN(tunnel.VXLANOptions{
+			Config: tunnel.Config{
+				Stack:  s,
+				Local:  underlayAddrs[i].Address,
+				Remote: underlayAddrs[1-i].Address,
+			},
+			VNI:      42,
+			Learning: true,
+		})
+		if err != nil {
+			t.Fatalf("NewVXLAN(_): %s", err)
+		}
+		if err := s.CreateNIC(tunnelNICID, ethernet.New(ep)); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", tunnelNICID, err)
+		}
+		addAddress(t, s, tunnelNICID, innerAddrs[i])
+		eps[i] = ep
+	}
+	if got, want := eps[0].MTU(), uint32(1450); got != want {
+		t.Errorf("got MTU() = %d, want = %d", got, want)
+	}
+
+	exchange(t, stacks, innerAddrs)
+
+	// The second tunnel learned where the first one's link address is.
+	found := false
+	for _, entry := range eps[1].FDB() {
+		if entry.LinkAddress == eps[0].LinkAddress() {
+			found = true
+			if entry.Remote != underlayAddrs[0].Address || entry.Permanent {
+				t.Errorf("got learned entry %+v, want remote %s", entry, underlayAddrs[0].Address)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("link address %s wasn't learned: %+v", eps[0].LinkAddress(), eps[1].FDB())
+	}
+}
+
+func TestVXLANDuplicateVNI(t *testing.T) {
+	stacks := newStacks(t, underlayAddrs)
+	opts := tunnel.VXLANOptions{
+		Config: tunnel.Config{Stack: stacks[0]},
+		VNI:    7,
+	}
+	ep, err := tunnel.NewVXLAN(opts)
+	if err != nil {
+		t.Fatalf("NewVXLAN(_): %s", err)
+	}
+	defer ep.Close()
+	if _, err := tunnel.NewVXLAN(opts); err == nil {
+		t.Fatalf("NewVXLAN(_) with a duplicate VNI succeeded")
+	}
+	opts.VNI = 8
+	ep2, err := tunnel.NewVXLAN(opts)
+	if err != nil {
+		t.Fatalf("NewVXLAN(_): %s", err)
+	}
+	ep2.Close()
+}
+
+func TestVXLANFDB(t *testing.T) {
+	s := newStack(t)
+	ep, err := tunnel.NewVXLAN(tunnel.VXLANOptions{
+		Config: tunnel.Config{Stack: s},
+		VNI:    1,
+	})
+	if err != nil {
+		t.Fatalf("NewVXLAN(_): %s", err)
+	}
+	defer ep.Close()
+
+	mac := tcpip.LinkAddress("\x02\x00\x00\x00\x00\x01")
+	entry := tunnel.FDBEntry{
+		LinkAddress: mac,
+		Remote:      underlayAddrs[0].Address,
+		Permanent:   true,
+	}
+	if err := ep.AddFDBEntry(entry, tunnel.FDBCreate); err != nil {
+		t.Fatalf("AddFDBEntry(%+v, FDBCreate): %s", entry, err)
+	}
+	if err := ep.AddFDBEntry(entry, tunnel.FDBCreate); err == nil {
+		t.Fatalf("AddFDBEntry(%+v, FDBCreate) of an existing entry succeeded", entry)
+	}
+	appended := entry
+	appended.Remote = underlayAddrs[1].Address
+	if err := ep.AddFDBEntry(appended, tunnel.FDBAppend); err != nil {
+		t.Fatalf("AddFDBEntry(%+v, FDBAppend): %s", appended, err)
+	}
+	if got := ep.FDB(); len(got) != 2 {
+		t.Fatalf("got FDB() = %+v, want 2 entries", got)
+	}
+	if err := ep.RemoveFDBEntry(mac, underlayAddrs[0].Address); err != nil {
+		t.Fatalf("RemoveFDBEntry(%s, %s): %s", mac, underlayAddrs[0].Address, err)
+	}
+	if got := ep.FDB(); len(got) != 1 || got[0] != appended {
+		t.Fatalf("got FDB() = %+v, want [%+v]", got, appended)
+	}
+	if err := ep.RemoveFDBEntry(mac, tcpip.Address{}); err != nil {
+		t.Fatalf("RemoveFDBEntry(%s, {}): %s", mac, err)
+	}
+	if got := ep.FDB(); len(got) != 0 {
+		t.Fatalf("got FDB() = %+v, want none", got)
+	}
+	if err := ep.RemoveFDBEntry(mac, tcpip.Address{}); err == nil {
+		t.Fatalf("RemoveFDBEntry(%s, {}) of a missing entry succeeded", mac)
+	}
+}
+
+func TestGREHeader(t *testing.T) {
+	fields := header.GREFields{
+		Protocol:        header.IPv4ProtocolNumber,
+		ChecksumPresent: true,
+		KeyPresent:      true,
+		Key:             0xdeadbeef,
+		SequencePresent: true,
+		Sequence:        7,
+	}
+	b := header.GRE(make([]byte, header.GREHeaderSize(&fields)))
+	b.Encode(&fields)
+	if !b.IsValid() {
+		t.Fatalf("encoded header %x isn't valid", []byte(b))
+	}
+	if got := b.HeaderLength(); got != header.GREMaximumSize {
+		t.Errorf("got HeaderLength() = %d, want %d", got, header.GREMaximumSize)
+	}
+	if got := b.Protocol(); got != header.IPv4ProtocolNumber {
+		t.Errorf("got Protocol() = %d, want %d", got, header.IPv4ProtocolNumber)
+	}
+	if key, ok := b.Key(); !ok || key != fields.Key {
+		t.Errorf("got Key() = (%d, %t), want (%d, true)", key, ok, fields.Key)
+	}
+	if seq, ok := b.Sequence(); !ok || seq != fields.Sequence {
+		t.Errorf("got Sequence() = (%d, %t), want (%d, true)", seq, ok, fields.Sequence)
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
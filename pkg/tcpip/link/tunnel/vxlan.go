@@ -0,0 +1,647 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tunnel
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/hash/jenkins"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/ports"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// DefaultVXLANAgeing is the default lifetime of learned FDB entries.
+const DefaultVXLANAgeing = 300 * time.Second
+
+// vxlanOverhead is the encapsulation overhead of VXLAN, not counting the
+// underlay network header.
+const vxlanOverhead = header.UDPMinimumSize + header.VXLANSize + header.EthernetMinimumSize
+
+// VXLANOptions are the options of a VXLAN tunnel.
+type VXLANOptions struct {
+	Config
+
+	// VNI is the VXLAN network identifier of the tunnel.
+	VNI uint32
+
+	// Port is the UDP port VXLAN packets are sent to and received on. If
+	// zero, header.VXLANPort is used.
+	Port uint16
+
+	// SourcePortLow and SourcePortHigh are the range of UDP source ports of
+	// sent packets. If zero, the ephemeral port range of the stack is used.
+	SourcePortLow  uint16
+	SourcePortHigh uint16
+
+	// Learning enables learning the remote ends of link addresses from
+	// received packets.
+	Learning bool
+
+	// Ageing is the lifetime of learned FDB entries. If zero,
+	// DefaultVXLANAgeing is used.
+	Ageing time.Duration
+
+	// UDPChecksum enables UDP checksums of packets sent over IPv4. They are
+	// always computed over IPv6.
+	UDPChecksum bool
+}
+
+// FDBEntry is an entry of the forwarding database of a VXLAN tunnel. It maps
+// the link address of a frame to a remote end of the tunnel.
+type FDBEntry struct {
+	// LinkAddress is the destination link address of frames sent to
+	// Remote. The entry of the zero address is the default entry, used for
+	// frames to multicast and unknown addresses.
+	LinkAddress tcpip.LinkAddress
+
+	// Remote is the underlay address of the remote end.
+	Remote tcpip.Address
+
+	// Port is the UDP port of the remote end. If zero, the port of the
+	// tunnel is used.
+	Port uint16
+
+	// VNI is the VXLAN network identifier used with the remote end. If
+	// zero, the VNI of the tunnel is used.
+	VNI uint32
+
+	// Permanent indicates that the entry was added statically rather than
+	// learned. Permanent entries don't age.
+	Permanent bool
+}
+
+// FDBUpdate describes how VXLANEndpoint.AddFDBEntry treats an existing entry
+// for the same link address.
+type FDBUpdate int
+
+const (
+	// FDBCreate fails with ErrDuplicateAddress if the entry exists.
+	FDBCreate FDBUpdate = iota
+
+	// FDBReplace replaces the remote ends of the existing entry.
+	FDBReplace
+
+	// FDBAppend adds a remote end to the existing entry.
+	FDBAppend
+)
+
+// fdbRemote is a remote end of an FDB entry.
+//
+// +stateify savable
+type fdbRemote struct {
+	remote tcpip.Address
+	port   uint16
+	vni    uint32
+}
+
+// fdbEntry is an FDB entry with all of its remote ends.
+//
+// +stateify savable
+type fdbEntry struct {
+	remotes   []fdbRemote
+	permanent bool
+	updated   tcpip.MonotonicTime
+}
+
+var _ stack.LinkEndpoint = (*VXLANEndpoint)(nil)
+
+// VXLANEndpoint is a VXLAN tunnel link endpoint. It reads and writes Ethernet
+// frames, so it must be wrapped by an ethernet.Endpoint.
+//
+// +stateify savable
+type VXLANEndpoint struct {
+	endpoint
+
+	vni           uint32
+	port          uint16
+	srcPortLow    uint16
+	srcPortHigh   uint16
+	learning      bool
+	ageing        time.Duration
+	udpChecksum   bool
+	joinedGroupOn tcpip.NICID
+	sock          *vxlanSocket
+
+	fdbMu sync.RWMutex `state:"nosave"`
+	// fdb is the forwarding database, keyed by link address.
+	//
+	// +checklocks:fdbMu
+	fdb map[tcpip.LinkAddress]*fdbEntry
+}
+
+// NewVXLAN creates a new VXLAN tunnel and starts receiving its packets from
+// opts.Stack. If opts.Remote is set, it is the remote end of the default FDB
+// entry; if it's a multicast address, the group is joined.
+func NewVXLAN(opts VXLANOptions) (*VXLANEndpoint, tcpip.Error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.VNI > header.VXLANMaxVNI {
+		return nil, &tcpip.ErrInvalidOptionValue{}
+	}
+	e := &VXLANEndpoint{
+		endpoint: endpoint{
+			cfg:      opts.Config,
+			mtu:      opts.defaultMTU(vxlanOverhead),
+			linkAddr: tcpip.GetRandMacAddr(),
+		},
+		vni:         opts.VNI,
+		port:        opts.Port,
+		srcPortLow:  opts.SourcePortLow,
+		srcPortHigh: opts.SourcePortHigh,
+		learning:    opts.Learning,
+		ageing:      opts.Ageing,
+		udpChecksum: opts.UDPChecksum,
+		fdb:         make(map[tcpip.LinkAddress]*fdbEntry),
+	}
+	if e.port == 0 {
+		e.port = header.VXLANPort
+	}
+	if e.srcPortLow == 0 && e.srcPortHigh == 0 {
+		e.srcPortLow, e.srcPortHigh = e.cfg.Stack.PortRange()
+	}
+	if e.srcPortLow > e.srcPortHigh {
+		return nil, &tcpip.ErrInvalidOptionValue{}
+	}
+	if e.ageing == 0 {
+		e.ageing = DefaultVXLANAgeing
+	}
+
+	if remote := e.cfg.Remote; remote.Len() != 0 {
+		if isMulticast(remote) {
+			nicID := e.cfg.Link
+			if nicID == 0 {
+				r, err := e.cfg.Stack.FindRoute(0, e.cfg.Local, remote, e.cfg.netProto(), false /* multicastLoop */)
+				if err != nil {
+					return nil, err
+				}
+				nicID = r.NICID()
+				r.Release()
+			}
+			if err := e.cfg.Stack.JoinGroup(e.cfg.netProto(), nicID, remote); err != nil {
+				return nil, err
+			}
+			e.joinedGroupOn = nicID
+		}
+		e.fdbMu.Lock()
+		e.fdb[zeroLinkAddress] = &fdbEntry{
+			remotes:   []fdbRemote{{remote: remote}},
+			permanent: true,
+		}
+		e.fdbMu.Unlock()
+	}
+
+	sock, err := bindVXLANSocket(e)
+	if err != nil {
+		e.leaveGroup()
+		return nil, err
+	}
+	e.sock = sock
+	return e, nil
+}
+
+// zeroLinkAddress is the link address of the default FDB entry.
+var zeroLinkAddress = tcpip.LinkAddress(make([]byte, tcpip.LinkAddressSize))
+
+func isMulticast(addr tcpip.Address) bool {
+	return header.IsV4MulticastAddress(addr) || header.IsV6MulticastAddress(addr)
+}
+
+// VNI returns the VXLAN network identifier of the tunnel.
+func (e *VXLANEndpoint) VNI() uint32 {
+	return e.vni
+}
+
+// Port returns the UDP port of the tunnel.
+func (e *VXLANEndpoint) Port() uint16 {
+	return e.port
+}
+
+// Config returns the underlay configuration of the tunnel.
+func (e *VXLANEndpoint) Config() Config {
+	return e.cfg
+}
+
+func (e *VXLANEndpoint) leaveGroup() {
+	if e.joinedGroupOn != 0 {
+		_ = e.cfg.Stack.LeaveGroup(e.cfg.netProto(), e.joinedGroupOn, e.cfg.Remote)
+		e.joinedGroupOn = 0
+	}
+}
+
+// Close implements stack.LinkEndpoint.Close.
+func (e *VXLANEndpoint) Close() {
+	if !e.close() {
+		return
+	}
+	e.sock.unbind(e)
+	e.leaveGroup()
+}
+
+// ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType.
+func (*VXLANEndpoint) ARPHardwareType() header.ARPHardwareType {
+	// Let the ethernet endpoint report itself.
+	return header.ARPHardwareNone
+}
+
+// AddFDBEntry adds entry to the forwarding database.
+func (e *VXLANEndpoint) AddFDBEntry(entry FDBEntry, update FDBUpdate) tcpip.Error {
+	if len(entry.LinkAddress) != tcpip.LinkAddressSize || entry.Remote.Len() != e.cfg.addressSize() {
+		return &tcpip.ErrBadAddress{}
+	}
+	remote := fdbRemote{
+		remote: entry.Remote,
+		port:   entry.Port,
+		vni:    entry.VNI,
+	}
+	now := e.cfg.Stack.Clock().NowMonotonic()
+
+	e.fdbMu.Lock()
+	defer e.fdbMu.Unlock()
+	fe, ok := e.fdb[entry.LinkAddress]
+	if !ok || !fe.permanent && now.Sub(fe.updated) >= e.ageing {
+		e.fdb[entry.LinkAddress] = &fdbEntry{
+			remotes:   []fdbRemote{remote},
+			permanent: entry.Permanent,
+			updated:   now,
+		}
+		return nil
+	}
+	switch update {
+	case FDBReplace:
+		fe.remotes = []fdbRemote{remote}
+	case FDBAppend:
+		if slices.Contains(fe.remotes, remote) {
+			return &tcpip.ErrDuplicateAddress{}
+		}
+		fe.remotes = append(fe.remotes, remote)
+	default:
+		return &tcpip.ErrDuplicateAddress{}
+	}
+	fe.permanent = entry.Permanent
+	fe.updated = now
+	return nil
+}
+
+// RemoveFDBEntry removes the remote end remote from the forwarding database
+// entry of addr. If remote is unspecified, the whole entry is removed.
+func (e *VXLANEndpoint) RemoveFDBEntry(addr tcpip.LinkAddress, remote tcpip.Address) tcpip.Error {
+	e.fdbMu.Lock()
+	defer e.fdbMu.Unlock()
+	fe, ok := e.fdb[addr]
+	if !ok {
+		return &tcpip.ErrNoSuchFile{}
+	}
+	if remote.Len() == 0 {
+		delete(e.fdb, addr)
+		return nil
+	}
+	i := slices.IndexFunc(fe.remotes, func(r fdbRemote) bool {
+		return r.remote == remote
+	})
+	if i < 0 {
+		return &tcpip.ErrNoSuchFile{}
+	}
+	fe.remotes = slices.Delete(slices.Clone(fe.remotes), i, i+1)
+	if len(fe.remotes) == 0 {
+		delete(e.fdb, addr)
+	}
+	return nil
+}
+
+// FDB returns the forwarding database, with one entry per remote end.
+func (e *VXLANEndpoint) FDB() []FDBEntry {
+	now := e.cfg.Stack.Clock().NowMonotonic()
+
+	e.fdbMu.RLock()
+	defer e.fdbMu.RUnlock()
+	var entries []FDBEntry
+	for addr, fe := range e.fdb {
+		if !fe.permanent && now.Sub(fe.updated) >= e.ageing {
+			continue
+		}
+		for _, r := range fe.remotes {
+			entries = append(entries, FDBEntry{
+				LinkAddress: addr,
+				Remote:      r.remote,
+				Port:        r.port,
+				VNI:         r.vni,
+				Permanent:   fe.permanent,
+			})
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b FDBEntry) int {
+		return cmp.Compare(a.LinkAddress, b.LinkAddress)
+	})
+	return entries
+}
+
+// remotes returns the remote ends of the frames sent to dst.
+func (e *VXLANEndpoint) remotes(dst tcpip.LinkAddress) []fdbRemote {
+	now := e.cfg.Stack.Clock().NowMonotonic()
+
+	e.fdbMu.RLock()
+	defer e.fdbMu.RUnlock()
+	if !header.IsMulticastEthernetAddress(dst) {
+		if fe, ok := e.fdb[dst]; ok && (fe.permanent || now.Sub(fe.updated) < e.ageing) {
+			return fe.remotes
+		}
+	}
+	if fe, ok := e.fdb[zeroLinkAddress]; ok {
+		return fe.remotes
+	}
+	return nil
+}
+
+// learn records that src is reachable through remote.
+func (e *VXLANEndpoint) learn(src tcpip.LinkAddress, remote tcpip.Address) {
+	if header.IsMulticastEthernetAddress(src) || src == zeroLinkAddress {
+		return
+	}
+	now := e.cfg.Stack.Clock().NowMonotonic()
+
+	e.fdbMu.Lock()
+	defer e.fdbMu.Unlock()
+	if fe, ok := e.fdb[src]; ok {
+		if fe.permanent {
+			return
+		}
+		if len(fe.remotes) == 1 && fe.remotes[0].remote == remote {
+			fe.updated = now
+			return
+		}
+	}
+	e.fdb[src] = &fdbEntry{
+		remotes: []fdbRemote{{remote: remote}},
+		updated: now,
+	}
+}
+
+// sourcePort returns the UDP source port of the encapsulation of a frame
+// with the given Ethernet header, so that the underlay can balance flows.
+func (e *VXLANEndpoint) sourcePort(eth []byte) uint16 {
+	h := jenkins.Sum32(e.cfg.Stack.Seed())
+	h.Write(eth)
+	n := uint64(e.srcPortHigh-e.srcPortLow) + 1
+	return e.srcPortLow + uint16(uint64(h.Sum32())*n>>32)
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+func (e *VXLANEndpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	n := 0
+	for _, pkt := range pkts.AsSlice() {
+		if err := e.writePacket(pkt); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (e *VXLANEndpoint) writePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	eth := pkt.LinkHeader().Slice()
+	if len(eth) < header.EthernetMinimumSize {
+		return &tcpip.ErrMalformedHeader{}
+	}
+	remotes := e.remotes(header.Ethernet(eth).DestinationAddress())
+	if len(remotes) == 0 {
+		return &tcpip.ErrHostUnreachable{}
+	}
+	srcPort := e.sourcePort(eth)
+	for _, r := range remotes {
+		port := r.port
+		if port == 0 {
+			port = e.port
+		}
+		vni := r.vni
+		if vni == 0 {
+			vni = e.vni
+		}
+		prefix := make([]byte, header.VXLANSize)
+		header.VXLAN(prefix).Encode(vni)
+		ttl := e.cfg.TTL
+		if ttl == 0 && isMulticast(r.remote) {
+			ttl = 1
+		}
+		encap := encapsulation{
+			remote:       r.remote,
+			protocol:     header.UDPProtocolNumber,
+			ttl:          ttl,
+			tos:          e.innerTOS(pkt),
+			headerLength: header.UDPMinimumSize,
+			prefix:       prefix,
+			encode: func(route *stack.Route, pkt *stack.PacketBuffer) {
+				length := uint16(pkt.Size() + header.UDPMinimumSize)
+				udp := header.UDP(pkt.TransportHeader().Push(header.UDPMinimumSize))
+				udp.Encode(&header.UDPFields{
+					SrcPort: srcPort,
+					DstPort: port,
+					Length:  length,
+				})
+				if route.RequiresTXTransportChecksum() && (e.udpChecksum || e.cfg.netProto() == header.IPv6ProtocolNumber) {
+					xsum := udp.CalculateChecksum(checksum.Combine(
+						header.PseudoHeaderChecksum(header.UDPProtocolNumber, route.LocalAddress(), route.RemoteAddress(), length),
+						pkt.Data().Checksum(),
+					))
+					if xsum != math.MaxUint16 {
+						xsum = ^xsum
+					}
+					udp.SetChecksum(xsum)
+				}
+			},
+		}
+		if err := e.write(pkt, &encap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receive delivers the frame in pkt, whose data starts at the VXLAN header.
+func (e *VXLANEndpoint) receive(pkt *stack.PacketBuffer) {
+	net := pkt.Network()
+	if (e.cfg.Link != 0 && e.cfg.Link != pkt.NICID) || (e.cfg.Local.Len() != 0 && e.cfg.Local != net.DestinationAddress()) {
+		return
+	}
+	frame, ok := pkt.Data().PullUp(header.VXLANSize + header.EthernetMinimumSize)
+	if !ok {
+		return
+	}
+	if e.learning {
+		e.learn(header.Ethernet(frame[header.VXLANSize:]).SourceAddress(), net.SourceAddress())
+	}
+	payload := pkt.Data().ToBuffer()
+	payload.TrimFront(header.VXLANSize)
+	// The ethernet endpoint takes the protocol from the frame.
+	e.deliver(0, payload)
+}
+
+// vxlanSocketKey identifies the socket shared by the VXLAN tunnels of a stack
+// using the same port and underlay protocol.
+//
+// +stateify savable
+type vxlanSocketKey struct {
+	stack    *stack.Stack
+	netProto tcpip.NetworkProtocolNumber
+	port     uint16
+}
+
+var (
+	// vxlanSocketsMu protects vxlanSockets.
+	vxlanSocketsMu sync.Mutex
+	// +checklocks:vxlanSocketsMu
+	vxlanSockets = make(map[vxlanSocketKey]*vxlanSocket)
+)
+
+var _ stack.TransportEndpoint = (*vxlanSocket)(nil)
+
+// vxlanSocket receives the UDP packets of the VXLAN tunnels sharing a port
+// and dispatches them by VNI.
+//
+// +stateify savable
+type vxlanSocket struct {
+	key vxlanSocketKey
+
+	mu sync.RWMutex `state:"nosave"`
+	// +checklocks:mu
+	endpoints map[uint32]*VXLANEndpoint
+}
+
+// bindVXLANSocket adds e to the socket of its port, creating the socket if
+// needed.
+func bindVXLANSocket(e *VXLANEndpoint) (*vxlanSocket, tcpip.Error) {
+	key := vxlanSocketKey{
+		stack:    e.cfg.Stack,
+		netProto: e.cfg.netProto(),
+		port:     e.port,
+	}
+	vxlanSocketsMu.Lock()
+	defer vxlanSocketsMu.Unlock()
+	s, ok := vxlanSockets[key]
+	if !ok {
+		s = &vxlanSocket{
+			key:       key,
+			endpoints: make(map[uint32]*VXLANEndpoint),
+		}
+		if err := s.register(); err != nil {
+			return nil, err
+		}
+		vxlanSockets[key] = s
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.endpoints[e.vni]; ok {
+		return nil, &tcpip.ErrDuplicateAddress{}
+	}
+	s.endpoints[e.vni] = e
+	return s, nil
+}
+
+// unbind removes e from s, and releases s once it's unused.
+func (s *vxlanSocket) unbind(e *VXLANEndpoint) {
+	vxlanSocketsMu.Lock()
+	defer vxlanSocketsMu.Unlock()
+	s.mu.Lock()
+	delete(s.endpoints, e.vni)
+	empty := len(s.endpoints) == 0
+	s.mu.Unlock()
+	if empty {
+		delete(vxlanSockets, s.key)
+		s.unregister()
+	}
+}
+
+func (s *vxlanSocket) reservation() ports.Reservation {
+	return ports.Reservation{
+		Networks:  []tcpip.NetworkProtocolNumber{s.key.netProto},
+		Transport: header.UDPProtocolNumber,
+		Port:      s.key.port,
+	}
+}
+
+func (s *vxlanSocket) id() stack.TransportEndpointID {
+	return stack.TransportEndpointID{LocalPort: s.key.port}
+}
+
+// register reserves the port of s and starts receiving its packets.
+func (s *vxlanSocket) register() tcpip.Error {
+	st := s.key.stack
+	if _, err := st.ReservePort(st.SecureRNG(), s.reservation(), nil /* testPort */); err != nil {
+		return err
+	}
+	if err := st.RegisterTransportEndpoint([]tcpip.NetworkProtocolNumber{s.key.netProto}, header.UDPProtocolNumber, s.id(), s, ports.Flags{}, 0 /* bindToDevice */); err != nil {
+		st.ReleasePort(s.reservation())
+		return err
+	}
+	return nil
+}
+
+func (s *vxlanSocket) unregister() {
+	st := s.key.stack
+	st.UnregisterTransportEndpoint([]tcpip.NetworkProtocolNumber{s.key.netProto}, header.UDPProtocolNumber, s.id(), s, ports.Flags{}, 0 /* bindToDevice */)
+	st.ReleasePort(s.reservation())
+}
+
+// HandlePacket implements stack.TransportEndpoint.HandlePacket.
+func (s *vxlanSocket) HandlePacket(_ stack.TransportEndpointID, pkt *stack.PacketBuffer) {
+	stats := s.key.stack.Stats()
+	hdr := header.UDP(pkt.TransportHeader().Slice())
+	net := pkt.Network()
+	lengthValid, csumValid := header.UDPValid(
+		hdr,
+		func() uint16 { return pkt.Data().Checksum() },
+		uint16(pkt.Data().Size()),
+		pkt.NetworkProtocolNumber,
+		net.SourceAddress(),
+		net.DestinationAddress(),
+		pkt.RXChecksumValidated)
+	if !lengthValid {
+		stats.UDP.MalformedPacketsReceived.Increment()
+		return
+	}
+	if !csumValid {
+		stats.UDP.ChecksumErrors.Increment()
+		return
+	}
+	stats.UDP.PacketsReceived.Increment()
+
+	v, ok := pkt.Data().PullUp(header.VXLANSize)
+	if !ok || header.VXLAN(v).Flags()&header.VXLANFlagVNI == 0 {
+		return
+	}
+	s.mu.RLock()
+	e, ok := s.endpoints[header.VXLAN(v).VNI()]
+	s.mu.RUnlock()
+	if ok {
+		e.receive(pkt)
+	}
+}
+
+// HandleError implements stack.TransportEndpoint.HandleError.
+func (*vxlanSocket) HandleError(stack.TransportError, *stack.PacketBuffer) {}
+
+// Abort implements stack.TransportEndpoint.Abort.
+func (*vxlanSocket) Abort() {}
+
+// Wait implements stack.TransportEndpoint.Wait.
+func (*vxlanSocket) Wait() {}
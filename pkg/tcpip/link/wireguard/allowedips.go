@@ -0,0 +1,84 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"slices"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// allowedIP maps a subnet to the peer owning it.
+//
+// +stateify savable
+type allowedIP struct {
+	subnet tcpip.Subnet
+	peer   *peer
+}
+
+// allowedIPs is the cryptokey routing table: it maps the subnets of the
+// allowed IPs of peers to the peers. Packets are sent to the peer owning
+// their destination, and are accepted from the peer owning their source.
+//
+// Each subnet is owned by at most one peer, and lookups return the peer
+// owning the longest matching prefix.
+//
+// +stateify savable
+type allowedIPs struct {
+	// entries are sorted by decreasing prefix length.
+	entries []allowedIP
+}
+
+// insert makes p the owner of subnet, taking it from its previous owner.
+func (a *allowedIPs) insert(subnet tcpip.Subnet, p *peer) {
+	for i := range a.entries {
+		if a.entries[i].subnet == subnet {
+			a.entries[i].peer = p
+			return
+		}
+	}
+	a.entries = append(a.entries, allowedIP{subnet: subnet, peer: p})
+	slices.SortStableFunc(a.entries, func(x, y allowedIP) int {
+		return y.subnet.Prefix() - x.subnet.Prefix()
+	})
+}
+
+// lookup returns the peer owning the longest prefix matching addr, or nil.
+func (a *allowedIPs) lookup(addr tcpip.Address) *peer {
+	for _, e := range a.entries {
+		if e.subnet.Contains(addr) {
+			return e.peer
+		}
+	}
+	return nil
+}
+
+// removePeer removes all subnets owned by p.
+func (a *allowedIPs) removePeer(p *peer) {
+	a.entries = slices.DeleteFunc(a.entries, func(e allowedIP) bool {
+		return e.peer == p
+	})
+}
+
+// subnets returns the subnets owned by p.
+func (a *allowedIPs) subnets(p *peer) []tcpip.Subnet {
+	var subnets []tcpip.Subnet
+	for _, e := range a.entries {
+		if e.peer == p {
+			subnets = append(subnets, e.subnet)
+		}
+	}
+	return subnets
+}
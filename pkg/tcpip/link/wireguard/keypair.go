@@ -0,0 +1,98 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"crypto/cipher"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// keypair holds the transport data keys derived from a handshake.
+type keypair struct {
+	send cipher.AEAD
+	recv cipher.AEAD
+
+	// sendCounter is the counter of the next sent message.
+	sendCounter uint64
+
+	// replay filters the counters of received messages.
+	replay replayFilter
+
+	// initiator is true if we initiated the handshake.
+	initiator bool
+
+	// created is when the keypair was derived.
+	created tcpip.MonotonicTime
+
+	// localIndex is the receiver index of messages sent to us with the
+	// keypair, and remoteIndex the one of messages we send.
+	localIndex  uint32
+	remoteIndex uint32
+}
+
+// canSend returns true if messages can still be sent with kp.
+func (kp *keypair) canSend(now tcpip.MonotonicTime) bool {
+	return kp.sendCounter < rejectAfterMessages && now.Sub(kp.created) < rejectAfterTime
+}
+
+// expire prevents kp from being used to send messages.
+func (kp *keypair) expire() {
+	kp.sendCounter = rejectAfterMessages
+}
+
+const (
+	replayBlockBits  = 64
+	replayRingBlocks = 32
+
+	// replayWindowSize is the number of counters below the greatest
+	// received counter that are still accepted, as long as they weren't
+	// received before.
+	replayWindowSize = (replayRingBlocks - 1) * replayBlockBits
+)
+
+// replayFilter is a sliding window of received message counters, as described
+// by RFC 6479.
+type replayFilter struct {
+	last uint64
+	ring [replayRingBlocks]uint64
+}
+
+// validateCounter returns true if counter is below limit, within the window,
+// and wasn't received before. It then marks counter as received.
+func (f *replayFilter) validateCounter(counter, limit uint64) bool {
+	if counter >= limit {
+		return false
+	}
+	block := counter / replayBlockBits
+	if counter > f.last {
+		current := f.last / replayBlockBits
+		diff := block - current
+		if diff > replayRingBlocks {
+			diff = replayRingBlocks
+		}
+		for i := current + 1; i <= current+diff; i++ {
+			f.ring[i%replayRingBlocks] = 0
+		}
+		f.last = counter
+	} else if f.last-counter > replayWindowSize {
+		return false
+	}
+	block %= replayRingBlocks
+	bit := uint64(1) << (counter % replayBlockBits)
+	old := f.ring[block]
+	f.ring[block] = old | bit
+	return old&bit == 0
+}
@@ -0,0 +1,669 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// KeySize is the size of WireGuard keys.
+const KeySize = 32
+
+// Key is a Curve25519 private or public key, or a preshared key.
+type Key [KeySize]byte
+
+// NewPrivateKey generates a private key with randomness read from rng.
+func NewPrivateKey(rng io.Reader) (Key, error) {
+	var k Key
+	if _, err := io.ReadFull(rng, k[:]); err != nil {
+		return Key{}, err
+	}
+	k.clamp()
+	return k, nil
+}
+
+// clamp clamps the private key k as specified by Curve25519.
+func (k *Key) clamp() {
+	k[0] &= 248
+	k[31] = (k[31] & 127) | 64
+}
+
+// PublicKey returns the public key of the private key k.
+func (k Key) PublicKey() Key {
+	var pub Key
+	out, err := curve25519.X25519(k[:], curve25519.Basepoint)
+	if err != nil {
+		// This can't happen with the base point.
+		panic(err)
+	}
+	copy(pub[:], out)
+	return pub
+}
+
+// IsZero returns true if all bytes of k are zero, in constant time.
+func (k Key) IsZero() bool {
+	var zero Key
+	return subtle.ConstantTimeCompare(k[:], zero[:]) == 1
+}
+
+// String implements fmt.Stringer. Keys are printed in hexadecimal.
+func (k Key) String() string {
+	return hex.EncodeToString(k[:])
+}
+
+// sharedSecret returns the Diffie-Hellman shared secret of priv and pub. It
+// returns false if pub is a low order point, as the secret is then zero.
+func sharedSecret(priv, pub Key) (Key, bool) {
+	var ss Key
+	out, err := curve25519.X25519(priv[:], pub[:])
+	if err != nil {
+		return ss, false
+	}
+	copy(ss[:], out)
+	return ss, true
+}
+
+// Protocol constants, from the WireGuard whitepaper.
+const (
+	noiseConstruction = "Noise_IKpsk2_25519_ChaChaPoly_BLAKE2s"
+	wgIdentifier      = "WireGuard v1 zx2c4 Jason@zx2c4.com"
+	wgLabelMAC1       = "mac1----"
+	wgLabelCookie     = "cookie--"
+)
+
+// Message types.
+const (
+	messageInitiationType  = 1
+	messageResponseType    = 2
+	messageCookieReplyType = 3
+	messageTransportType   = 4
+)
+
+// Message sizes.
+const (
+	tai64nSize                 = 12
+	macSize                    = 16
+	cookieNonceSize            = chacha20poly1305.NonceSizeX
+	messageInitiationSize      = 148
+	messageResponseSize        = 92
+	messageCookieReplySize     = 64
+	messageTransportHeaderSize = 16
+	messageKeepaliveSize       = messageTransportHeaderSize + chacha20poly1305.Overhead
+)
+
+var (
+	// initialChainKey is HASH(CONSTRUCTION).
+	initialChainKey [blake2s.Size]byte
+
+	// initialHash is HASH(initialChainKey || IDENTIFIER).
+	initialHash [blake2s.Size]byte
+)
+
+func init() {
+	initialChainKey = blake2s.Sum256([]byte(noiseConstruction))
+	blake2sHash(&initialHash, initialChainKey[:], []byte(wgIdentifier))
+}
+
+// blake2sHash sets dst to the BLAKE2s hash of the concatenation of data.
+func blake2sHash(dst *[blake2s.Size]byte, data ...[]byte) {
+	h := newBlake2s()
+	for _, d := range data {
+		h.Write(d)
+	}
+	h.Sum(dst[:0])
+}
+
+func newBlake2s() hash.Hash {
+	h, err := blake2s.New256(nil)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// mixHash sets dst to HASH(h || data).
+func mixHash(dst, h *[blake2s.Size]byte, data []byte) {
+	blake2sHash(dst, h[:], data)
+}
+
+// mac sets dst to the keyed BLAKE2s-128 MAC of msg.
+func mac(dst []byte, key []byte, msg []byte) {
+	h, err := blake2s.New128(key)
+	if err != nil {
+		panic(err)
+	}
+	h.Write(msg)
+	h.Sum(dst[:0])
+}
+
+// hmacBlake2s sets sum to HMAC-BLAKE2s(key, concatenation of in).
+func hmacBlake2s(sum *[blake2s.Size]byte, key []byte, in ...[]byte) {
+	m := hmac.New(newBlake2s, key)
+	for _, b := range in {
+		m.Write(b)
+	}
+	m.Sum(sum[:0])
+}
+
+// kdf derives len(outs) keys from key and input with the HKDF construction
+// of the WireGuard protocol. The outputs may alias key.
+func kdf(key, input []byte, outs ...*[blake2s.Size]byte) {
+	var prk [blake2s.Size]byte
+	hmacBlake2s(&prk, key, input)
+	var prev []byte
+	for i, out := range outs {
+		hmacBlake2s(out, prk[:], prev, []byte{byte(i + 1)})
+		prev = out[:]
+	}
+}
+
+// mixKey sets chainKey to KDF1(chainKey, input).
+func mixKey(chainKey *[blake2s.Size]byte, input []byte) {
+	kdf(chainKey[:], input, chainKey)
+}
+
+// newAEAD returns the ChaCha20-Poly1305 AEAD of key.
+func newAEAD(key *[blake2s.Size]byte) cipher.AEAD {
+	aead, err := chacha20poly1305.New(key[:])
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// counterNonce returns the AEAD nonce of a message counter: 32 bits of zeros
+// followed by the little endian counter.
+func counterNonce(counter uint64) [chacha20poly1305.NonceSize]byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+// seal appends the encryption of plaintext with key and a zero nonce to dst,
+// as done for the fields of handshake messages.
+func seal(dst []byte, key *[blake2s.Size]byte, plaintext, ad []byte) []byte {
+	nonce := counterNonce(0)
+	return newAEAD(key).Seal(dst, nonce[:], plaintext, ad)
+}
+
+// open decrypts a field of a handshake message.
+func open(key *[blake2s.Size]byte, ciphertext, ad []byte) ([]byte, bool) {
+	nonce := counterNonce(0)
+	plaintext, err := newAEAD(key).Open(nil, nonce[:], ciphertext, ad)
+	return plaintext, err == nil
+}
+
+// timestampWhitener is the granularity of handshake timestamps. Rounding
+// them hides the precise time of the handshake.
+const timestampWhitener = 0x1000000
+
+// tai64n returns the TAI64N timestamp of t.
+func tai64n(t time.Time) [tai64nSize]byte {
+	var ts [tai64nSize]byte
+	binary.BigEndian.PutUint64(ts[:], 0x400000000000000a+uint64(t.Unix()))
+	binary.BigEndian.PutUint32(ts[8:], uint32(t.Nanosecond())&^(timestampWhitener-1))
+	return ts
+}
+
+// handshakeState is the state of the Noise handshake with a peer.
+type handshakeState int
+
+const (
+	handshakeZeroed handshakeState = iota
+	handshakeInitiationCreated
+	handshakeInitiationConsumed
+	handshakeResponseCreated
+	handshakeResponseConsumed
+)
+
+// handshake is the Noise handshake with a peer.
+type handshake struct {
+	state           handshakeState
+	hash            [blake2s.Size]byte
+	chainKey        [blake2s.Size]byte
+	localEphemeral  Key
+	remoteEphemeral Key
+
+	// localIndex is the sender index of the handshake messages sent to the
+	// peer, and 0 if none was sent.
+	localIndex uint32
+
+	// remoteIndex is the sender index of the peer.
+	remoteIndex uint32
+}
+
+// Handshake message offsets.
+const (
+	initiationSenderOffset    = 4
+	initiationEphemeralOffset = 8
+	initiationStaticOffset    = initiationEphemeralOffset + KeySize
+	initiationTimestampOffset = initiationStaticOffset + KeySize + chacha20poly1305.Overhead
+	initiationMAC1Offset      = initiationTimestampOffset + tai64nSize + chacha20poly1305.Overhead
+
+	responseSenderOffset    = 4
+	responseReceiverOffset  = 8
+	responseEphemeralOffset = 12
+	responseEmptyOffset     = responseEphemeralOffset + KeySize
+	responseMAC1Offset      = responseEmptyOffset + chacha20poly1305.Overhead
+
+	cookieReplyReceiverOffset = 4
+	cookieReplyNonceOffset    = 8
+	cookieReplyCookieOffset   = cookieReplyNonceOffset + cookieNonceSize
+
+	transportReceiverOffset = 4
+	transportCounterOffset  = 8
+)
+
+// createInitiation creates a handshake initiation message for p.
+//
+// +checklocks:e.mu
+func (e *Endpoint) createInitiation(p *peer) ([]byte, bool) {
+	if !e.hasPrivateKey || p.staticStatic.IsZero() {
+		return nil, false
+	}
+	ephemeral, err := NewPrivateKey(e.stack.SecureRNG().Reader)
+	if err != nil {
+		return nil, false
+	}
+	ss, ok := sharedSecret(ephemeral, p.publicKey)
+	if !ok {
+		return nil, false
+	}
+
+	hs := &p.hs
+	e.removeHandshakeIndex(p)
+	*hs = handshake{
+		state:          handshakeInitiationCreated,
+		chainKey:       initialChainKey,
+		localEphemeral: ephemeral,
+		localIndex:     e.newIndex(indexEntry{peer: p}),
+	}
+	mixHash(&hs.hash, &initialHash, p.publicKey[:])
+
+	msg := make([]byte, messageInitiationSize)
+	binary.LittleEndian.PutUint32(msg, messageInitiationType)
+	binary.LittleEndian.PutUint32(msg[initiationSenderOffset:], hs.localIndex)
+
+	ephemeralPub := ephemeral.PublicKey()
+	copy(msg[initiationEphemeralOffset:], ephemeralPub[:])
+	mixKey(&hs.chainKey, ephemeralPub[:])
+	mixHash(&hs.hash, &hs.hash, ephemeralPub[:])
+
+	var key [blake2s.Size]byte
+	kdf(hs.chainKey[:], ss[:], &hs.chainKey, &key)
+	static := seal(msg[initiationStaticOffset:initiationStaticOffset], &key, e.publicKey[:], hs.hash[:])
+	mixHash(&hs.hash, &hs.hash, static)
+
+	kdf(hs.chainKey[:], p.staticStatic[:], &hs.chainKey, &key)
+	ts := tai64n(e.stack.Clock().Now())
+	timestamp := seal(msg[initiationTimestampOffset:initiationTimestampOffset], &key, ts[:], hs.hash[:])
+	mixHash(&hs.hash, &hs.hash, timestamp)
+
+	e.addMACs(p, msg)
+	return msg, true
+}
+
+// consumeInitiation processes a handshake initiation message, and returns
+// the peer that sent it.
+//
+// +checklocks:e.mu
+func (e *Endpoint) consumeInitiation(msg []byte) *peer {
+	if !e.hasPrivateKey {
+		return nil
+	}
+	var (
+		hash     [blake2s.Size]byte
+		chainKey = initialChainKey
+		key      [blake2s.Size]byte
+	)
+	mixHash(&hash, &initialHash, e.publicKey[:])
+
+	var remoteEphemeral Key
+	copy(remoteEphemeral[:], msg[initiationEphemeralOffset:])
+	mixKey(&chainKey, remoteEphemeral[:])
+	mixHash(&hash, &hash, remoteEphemeral[:])
+
+	ss, ok := sharedSecret(e.privateKey, remoteEphemeral)
+	if !ok {
+		return nil
+	}
+	kdf(chainKey[:], ss[:], &chainKey, &key)
+	static := msg[initiationStaticOffset:initiationTimestampOffset]
+	peerKey, ok := open(&key, static, hash[:])
+	if !ok {
+		return nil
+	}
+	mixHash(&hash, &hash, static)
+
+	p, ok := e.peers[Key(peerKey)]
+	if !ok || p.staticStatic.IsZero() {
+		return nil
+	}
+	kdf(chainKey[:], p.staticStatic[:], &chainKey, &key)
+	timestamp := msg[initiationTimestampOffset:initiationMAC1Offset]
+	ts, ok := open(&key, timestamp, hash[:])
+	if !ok {
+		return nil
+	}
+	mixHash(&hash, &hash, timestamp)
+
+	// Reject replayed initiations, and initiations sent faster than
+	// allowed, which can only be floods.
+	now := e.stack.Clock().NowMonotonic()
+	if bytes.Compare(ts, p.lastTimestamp[:]) <= 0 {
+		return nil
+	}
+	if p.consumedInitiation && now.Sub(p.lastInitiationConsumption) < handshakeInitiationRate {
+		return nil
+	}
+	copy(p.lastTimestamp[:], ts)
+	p.lastInitiationConsumption = now
+	p.consumedInitiation = true
+
+	e.removeHandshakeIndex(p)
+	p.hs = handshake{
+		state:           handshakeInitiationConsumed,
+		hash:            hash,
+		chainKey:        chainKey,
+		remoteEphemeral: remoteEphemeral,
+		remoteIndex:     binary.LittleEndian.Uint32(msg[initiationSenderOffset:]),
+	}
+	return p
+}
+
+// createResponse creates a handshake response message to the initiation
+// consumed from p.
+//
+// +checklocks:e.mu
+func (e *Endpoint) createResponse(p *peer) ([]byte, bool) {
+	hs := &p.hs
+	if hs.state != handshakeInitiationConsumed {
+		return nil, false
+	}
+	ephemeral, err := NewPrivateKey(e.stack.SecureRNG().Reader)
+	if err != nil {
+		return nil, false
+	}
+	ss1, ok := sharedSecret(ephemeral, hs.remoteEphemeral)
+	if !ok {
+		return nil, false
+	}
+	ss2, ok := sharedSecret(ephemeral, p.publicKey)
+	if !ok {
+		return nil, false
+	}
+
+	hs.localIndex = e.newIndex(indexEntry{peer: p})
+	hs.localEphemeral = ephemeral
+	msg := make([]byte, messageResponseSize)
+	binary.LittleEndian.PutUint32(msg, messageResponseType)
+	binary.LittleEndian.PutUint32(msg[responseSenderOffset:], hs.localIndex)
+	binary.LittleEndian.PutUint32(msg[responseReceiverOffset:], hs.remoteIndex)
+
+	ephemeralPub := ephemeral.PublicKey()
+	copy(msg[responseEphemeralOffset:], ephemeralPub[:])
+	mixHash(&hs.hash, &hs.hash, ephemeralPub[:])
+	mixKey(&hs.chainKey, ephemeralPub[:])
+	mixKey(&hs.chainKey, ss1[:])
+	mixKey(&hs.chainKey, ss2[:])
+
+	var tau, key [blake2s.Size]byte
+	kdf(hs.chainKey[:], p.presharedKey[:], &hs.chainKey, &tau, &key)
+	mixHash(&hs.hash, &hs.hash, tau[:])
+	empty := seal(msg[responseEmptyOffset:responseEmptyOffset], &key, nil, hs.hash[:])
+	mixHash(&hs.hash, &hs.hash, empty)
+	hs.state = handshakeResponseCreated
+
+	e.addMACs(p, msg)
+	return msg, true
+}
+
+// consumeResponse processes a handshake response message, and returns the
+// peer that sent it.
+//
+// +checklocks:e.mu
+func (e *Endpoint) consumeResponse(msg []byte) *peer {
+	entry, ok := e.index[binary.LittleEndian.Uint32(msg[responseReceiverOffset:])]
+	if !ok || entry.keypair != nil {
+		return nil
+	}
+	p := entry.peer
+	hs := &p.hs
+	if hs.state != handshakeInitiationCreated {
+		return nil
+	}
+
+	var remoteEphemeral Key
+	copy(remoteEphemeral[:], msg[responseEphemeralOffset:])
+	ss1, ok := sharedSecret(hs.localEphemeral, remoteEphemeral)
+	if !ok {
+		return nil
+	}
+	ss2, ok := sharedSecret(e.privateKey, remoteEphemeral)
+	if !ok {
+		return nil
+	}
+
+	// Work on copies, so that an invalid response leaves the handshake
+	// intact.
+	hash := hs.hash
+	chainKey := hs.chainKey
+	mixHash(&hash, &hash, remoteEphemeral[:])
+	mixKey(&chainKey, remoteEphemeral[:])
+	mixKey(&chainKey, ss1[:])
+	mixKey(&chainKey, ss2[:])
+
+	var tau, key [blake2s.Size]byte
+	kdf(chainKey[:], p.presharedKey[:], &chainKey, &tau, &key)
+	mixHash(&hash, &hash, tau[:])
+	empty := msg[responseEmptyOffset:responseMAC1Offset]
+	if _, ok := open(&key, empty, hash[:]); !ok {
+		return nil
+	}
+	mixHash(&hash, &hash, empty)
+
+	hs.hash = hash
+	hs.chainKey = chainKey
+	hs.remoteEphemeral = remoteEphemeral
+	hs.remoteIndex = binary.LittleEndian.Uint32(msg[responseSenderOffset:])
+	hs.state = handshakeResponseConsumed
+	return p
+}
+
+// beginSession derives a keypair from the completed handshake with p. The
+// initiator starts using it right away, while the responder waits for the
+// first message encrypted with it, which confirms that the initiator derived
+// it too.
+//
+// +checklocks:e.mu
+func (e *Endpoint) beginSession(p *peer) bool {
+	hs := &p.hs
+	var sendKey, recvKey [blake2s.Size]byte
+	var initiator bool
+	switch hs.state {
+	case handshakeResponseConsumed:
+		kdf(hs.chainKey[:], nil, &sendKey, &recvKey)
+		initiator = true
+	case handshakeResponseCreated:
+		kdf(hs.chainKey[:], nil, &recvKey, &sendKey)
+	default:
+		return false
+	}
+	kp := &keypair{
+		send:        newAEAD(&sendKey),
+		recv:        newAEAD(&recvKey),
+		initiator:   initiator,
+		created:     e.stack.Clock().NowMonotonic(),
+		localIndex:  hs.localIndex,
+		remoteIndex: hs.remoteIndex,
+	}
+	// The index of the handshake now belongs to the keypair.
+	e.index[kp.localIndex] = indexEntry{peer: p, keypair: kp}
+	p.hs = handshake{}
+
+	if initiator {
+		if p.next != nil {
+			// The keypair for which the peer is waiting for
+			// confirmation is superseded, but the peer may have
+			// started using it.
+			e.removeKeypair(p.previous)
+			p.previous = p.next
+			p.next = nil
+		} else {
+			e.removeKeypair(p.previous)
+			p.previous = p.current
+		}
+		p.current = kp
+	} else {
+		e.removeKeypair(p.next)
+		e.removeKeypair(p.previous)
+		p.previous = nil
+		p.next = kp
+	}
+	return true
+}
+
+// receivedWithKeypair rotates the keypairs of p if kp is the keypair waiting
+// for confirmation. It returns true if it was.
+//
+// +checklocks:e.mu
+func (e *Endpoint) receivedWithKeypair(p *peer, kp *keypair) bool {
+	if p.next != kp {
+		return false
+	}
+	e.removeKeypair(p.previous)
+	p.previous = p.current
+	p.current = p.next
+	p.next = nil
+	return true
+}
+
+// addMACs sets the mac1 and mac2 fields of msg, a handshake message to p.
+//
+// +checklocks:e.mu
+func (e *Endpoint) addMACs(p *peer, msg []byte) {
+	mac1 := msg[len(msg)-2*macSize : len(msg)-macSize]
+	mac2 := msg[len(msg)-macSize:]
+	mac(mac1, p.mac1Key[:], msg[:len(msg)-2*macSize])
+	copy(p.lastMAC1[:], mac1)
+	p.hasLastMAC1 = true
+
+	now := e.stack.Clock().NowMonotonic()
+	if p.hasCookie && now.Sub(p.cookieTime) < cookieRefreshTime {
+		mac(mac2, p.cookie[:], msg[:len(msg)-macSize])
+	} else {
+		clear(mac2)
+	}
+}
+
+// checkMAC1 returns true if the mac1 field of the handshake message msg is
+// valid, which proves that the sender knows our public key.
+//
+// +checklocks:e.mu
+func (e *Endpoint) checkMAC1(msg []byte) bool {
+	var want [macSize]byte
+	mac(want[:], e.mac1Key[:], msg[:len(msg)-2*macSize])
+	return hmac.Equal(want[:], msg[len(msg)-2*macSize:len(msg)-macSize])
+}
+
+// checkMAC2 returns true if the mac2 field of the handshake message msg is
+// valid for the cookie of src, which proves that the sender owns src.
+//
+// +checklocks:e.mu
+func (e *Endpoint) checkMAC2(msg []byte, src []byte) bool {
+	cookie := e.cookie(src)
+	var want [macSize]byte
+	mac(want[:], cookie[:], msg[:len(msg)-macSize])
+	return hmac.Equal(want[:], msg[len(msg)-macSize:])
+}
+
+// cookie returns the cookie of the source address src, which is valid for
+// cookieRefreshTime.
+//
+// +checklocks:e.mu
+func (e *Endpoint) cookie(src []byte) [macSize]byte {
+	now := e.stack.Clock().NowMonotonic()
+	if !e.hasCookieSecret || now.Sub(e.cookieSecretTime) >= cookieRefreshTime {
+		if _, err := io.ReadFull(e.stack.SecureRNG().Reader, e.cookieSecret[:]); err != nil {
+			panic(err)
+		}
+		e.cookieSecretTime = now
+		e.hasCookieSecret = true
+	}
+	var cookie [macSize]byte
+	mac(cookie[:], e.cookieSecret[:], src)
+	return cookie
+}
+
+// createCookieReply creates a cookie reply to the handshake message msg
+// received from src.
+//
+// +checklocks:e.mu
+func (e *Endpoint) createCookieReply(msg []byte, src []byte) []byte {
+	reply := make([]byte, messageCookieReplySize)
+	binary.LittleEndian.PutUint32(reply, messageCookieReplyType)
+	// The sender index is at the same offset in both handshake messages.
+	copy(reply[cookieReplyReceiverOffset:], msg[initiationSenderOffset:initiationSenderOffset+4])
+	nonce := reply[cookieReplyNonceOffset:cookieReplyCookieOffset]
+	if _, err := io.ReadFull(e.stack.SecureRNG().Reader, nonce); err != nil {
+		panic(err)
+	}
+	cookie := e.cookie(src)
+	aead, err := chacha20poly1305.NewX(e.cookieKey[:])
+	if err != nil {
+		panic(err)
+	}
+	aead.Seal(reply[cookieReplyCookieOffset:cookieReplyCookieOffset], nonce, cookie[:], msg[len(msg)-2*macSize:len(msg)-macSize])
+	return reply
+}
+
+// consumeCookieReply processes a cookie reply message, storing the cookie
+// for the next handshake messages sent to its peer.
+//
+// +checklocks:e.mu
+func (e *Endpoint) consumeCookieReply(msg []byte) {
+	entry, ok := e.index[binary.LittleEndian.Uint32(msg[cookieReplyReceiverOffset:])]
+	if !ok {
+		return
+	}
+	p := entry.peer
+	if !p.hasLastMAC1 {
+		return
+	}
+	aead, err := chacha20poly1305.NewX(p.cookieKey[:])
+	if err != nil {
+		panic(err)
+	}
+	cookie, err := aead.Open(nil, msg[cookieReplyNonceOffset:cookieReplyCookieOffset], msg[cookieReplyCookieOffset:], p.lastMAC1[:])
+	if err != nil {
+		return
+	}
+	copy(p.cookie[:], cookie)
+	p.cookieTime = e.stack.Clock().NowMonotonic()
+	p.hasCookie = true
+	p.hasLastMAC1 = false
+}
@@ -0,0 +1,296 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+var (
+	addrs = [2]tcpip.FullAddress{
+		{Addr: tcpip.AddrFrom4([4]byte{10, 0, 0, 1}), Port: 51820},
+		{Addr: tcpip.AddrFrom4([4]byte{10, 0, 0, 2}), Port: 51820},
+	}
+	allowed = [2]tcpip.Subnet{
+		tcpip.AddressWithPrefix{Address: tcpip.AddrFrom4([4]byte{192, 168, 0, 1}), PrefixLen: 32}.Subnet(),
+		tcpip.AddressWithPrefix{Address: tcpip.AddrFrom4([4]byte{192, 168, 0, 2}), PrefixLen: 32}.Subnet(),
+	}
+)
+
+func newTestKey(t *testing.T) Key {
+	t.Helper()
+	k, err := NewPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("NewPrivateKey: %s", err)
+	}
+	return k
+}
+
+// newTestEndpoints returns two endpoints configured as peers of each other.
+// Their datagrams aren't sent anywhere: tests pass them from one endpoint to
+// the other with receive.
+func newTestEndpoints(t *testing.T, clock tcpip.Clock) [2]*Endpoint {
+	t.Helper()
+	keys := [2]Key{newTestKey(t), newTestKey(t)}
+	var eps [2]*Endpoint
+	for i := range eps {
+		s := stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+			Clock:              clock,
+		})
+		t.Cleanup(func() {
+			s.Close()
+			s.Wait()
+		})
+		ep, err := New(Options{Stack: s})
+		if err != nil {
+			t.Fatalf("New(_): %s", err)
+		}
+		t.Cleanup(ep.Close)
+		eps[i] = ep
+	}
+	for i, ep := range eps {
+		endpoint := addrs[1-i]
+		cfg := Config{
+			PrivateKey: &keys[i],
+			Peers: []PeerConfig{{
+				PublicKey:  keys[1-i].PublicKey(),
+				Endpoint:   &endpoint,
+				AllowedIPs: []tcpip.Subnet{allowed[1-i]},
+			}},
+		}
+		if err := ep.Configure(cfg); err != nil {
+			t.Fatalf("Configure(_): %s", err)
+		}
+	}
+	return eps
+}
+
+// takeDatagrams returns the datagrams queued by e.
+func takeDatagrams(e *Endpoint) []datagram {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	dgs := e.datagrams
+	e.datagrams = nil
+	return dgs
+}
+
+// receive makes e process the datagrams dgs sent by the endpoint with index
+// from, and returns the datagrams sent in response.
+func receive(e *Endpoint, from int, dgs []datagram) []datagram {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, dg := range dgs {
+		e.handleMessage(dg.data, tcpip.FullAddress{Addr: addrs[from].Addr, Port: dg.srcPort})
+	}
+	dgs = e.datagrams
+	e.datagrams = nil
+	e.deliveries = nil
+	return dgs
+}
+
+// initiate makes eps[0] initiate a handshake, regardless of when the last one
+// was initiated, and returns the initiation.
+func initiate(t *testing.T, eps [2]*Endpoint) []datagram {
+	t.Helper()
+	e := eps[0]
+	e.mu.Lock()
+	p := e.peerList[0]
+	p.sentInitiation = false
+	e.sendInitiation(p, false /* retry */)
+	e.mu.Unlock()
+	dgs := takeDatagrams(e)
+	if len(dgs) != 1 || messageType(dgs[0]) != messageInitiationType {
+		t.Fatalf("got datagrams %v, want an initiation", dgs)
+	}
+	return dgs
+}
+
+func messageType(dg datagram) uint32 {
+	return binary.LittleEndian.Uint32(dg.data)
+}
+
+func TestHandshake(t *testing.T) {
+	eps := newTestEndpoints(t, nil)
+	resp := receive(eps[1], 0, initiate(t, eps))
+	if len(resp) != 1 || messageType(resp[0]) != messageResponseType {
+		t.Fatalf("got datagrams %v in response to the initiation, want a response", resp)
+	}
+	keepalive := receive(eps[0], 1, resp)
+	if len(keepalive) != 1 || messageType(keepalive[0]) != messageTransportType || len(keepalive[0].data) != messageKeepaliveSize {
+		t.Fatalf("got datagrams %v in response to the response, want a keepalive", keepalive)
+	}
+	if got := receive(eps[1], 0, keepalive); len(got) != 0 {
+		t.Fatalf("got datagrams %v in response to the keepalive, want none", got)
+	}
+
+	for i, e := range eps {
+		e.mu.Lock()
+		p := e.peerList[0]
+		if p.current == nil || p.next != nil {
+			t.Errorf("endpoint %d: got keypairs (current %p, next %p), want a confirmed current keypair", i, p.current, p.next)
+		}
+		e.mu.Unlock()
+	}
+
+	// A replayed keepalive is rejected.
+	e := eps[1]
+	e.mu.Lock()
+	rxBytes := e.peerList[0].rxBytes
+	e.mu.Unlock()
+	receive(e, 0, keepalive)
+	e.mu.Lock()
+	if got := e.peerList[0].rxBytes; got != rxBytes {
+		t.Errorf("got rxBytes = %d after a replayed keepalive, want %d", got, rxBytes)
+	}
+	e.mu.Unlock()
+}
+
+func TestReplayedInitiation(t *testing.T) {
+	eps := newTestEndpoints(t, nil)
+	init := initiate(t, eps)
+	if resp := receive(eps[1], 0, init); len(resp) != 1 {
+		t.Fatalf("got %d datagrams in response to the initiation, want 1", len(resp))
+	}
+	if resp := receive(eps[1], 0, init); len(resp) != 0 {
+		t.Fatalf("got %d datagrams in response to a replayed initiation, want none", len(resp))
+	}
+}
+
+func TestCookieUnderLoad(t *testing.T) {
+	clock := faketime.NewManualClock()
+	eps := newTestEndpoints(t, clock)
+	e := eps[1]
+	e.mu.Lock()
+	e.underLoadUntil = clock.NowMonotonic().Add(underLoadDuration)
+	e.mu.Unlock()
+
+	reply := receive(e, 0, initiate(t, eps))
+	if len(reply) != 1 || messageType(reply[0]) != messageCookieReplyType {
+		t.Fatalf("got datagrams %v in response to an initiation under load, want a cookie reply", reply)
+	}
+	receive(eps[0], 1, reply)
+
+	// The next initiation carries a valid mac2.
+	resp := receive(e, 0, initiate(t, eps))
+	if len(resp) != 1 || messageType(resp[0]) != messageResponseType {
+		t.Fatalf("got datagrams %v in response to an initiation with a cookie, want a response", resp)
+	}
+}
+
+func TestRetransmitHandshake(t *testing.T) {
+	clock := faketime.NewManualClock()
+	eps := newTestEndpoints(t, clock)
+	e := eps[0]
+	e.mu.Lock()
+	p := e.peerList[0]
+	p.staged = append(p.staged, stagedPacket{data: []byte{0x45}})
+	e.mu.Unlock()
+	initiate(t, eps)
+
+	// Initiations are retransmitted until a response is received, and the
+	// endpoint gives up after maxTimerHandshakes retransmissions.
+	clock.Advance(rekeyTimeout + maxJitter)
+	e.mu.Lock()
+	if got := p.handshakeAttempts; got != 1 {
+		t.Errorf("got %d handshake attempts, want 1", got)
+	}
+	e.mu.Unlock()
+	for i := 0; i < maxTimerHandshakes+5; i++ {
+		clock.Advance(rekeyTimeout + maxJitter)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if got, want := p.handshakeAttempts, maxTimerHandshakes+1; got != want {
+		t.Errorf("got %d handshake attempts, want %d", got, want)
+	}
+	if p.retransmitHandshake.pending {
+		t.Errorf("handshake retransmission is still pending")
+	}
+	if len(p.staged) != 0 {
+		t.Errorf("got %d staged packets after giving up, want none", len(p.staged))
+	}
+}
+
+func TestReplayFilter(t *testing.T) {
+	var f replayFilter
+	for _, test := range []struct {
+		counter uint64
+		want    bool
+	}{
+		{0, true},
+		{0, false},
+		{1, true},
+		{3, true},
+		{2, true},
+		{3, false},
+		{replayWindowSize + 10, true},
+		{9, false},
+		{10, true},
+		{10, false},
+		{rejectAfterMessages, false},
+		{1 << 20, true},
+		{replayWindowSize + 10, false},
+	} {
+		if got := f.validateCounter(test.counter, rejectAfterMessages); got != test.want {
+			t.Errorf("validateCounter(%d) = %t, want %t", test.counter, got, test.want)
+		}
+	}
+}
+
+func TestAllowedIPs(t *testing.T) {
+	subnet := func(a [4]byte, prefix int) tcpip.Subnet {
+		return tcpip.AddressWithPrefix{Address: tcpip.AddrFrom4(a), PrefixLen: prefix}.Subnet()
+	}
+	p1, p2 := &peer{}, &peer{}
+	var a allowedIPs
+	a.insert(subnet([4]byte{10, 0, 0, 0}, 8), p1)
+	a.insert(subnet([4]byte{10, 1, 0, 0}, 16), p2)
+
+	for _, test := range []struct {
+		addr [4]byte
+		want *peer
+	}{
+		{[4]byte{10, 0, 0, 1}, p1},
+		{[4]byte{10, 1, 2, 3}, p2},
+		{[4]byte{11, 0, 0, 1}, nil},
+	} {
+		if got := a.lookup(tcpip.AddrFrom4(test.addr)); got != test.want {
+			t.Errorf("lookup(%v) = %p, want %p", test.addr, got, test.want)
+		}
+	}
+
+	// Inserting an existing subnet moves it to the new peer.
+	a.insert(subnet([4]byte{10, 0, 0, 0}, 8), p2)
+	if got := a.lookup(tcpip.AddrFrom4([4]byte{10, 0, 0, 1})); got != p2 {
+		t.Errorf("lookup(10.0.0.1) = %p after moving the subnet, want %p", got, p2)
+	}
+	if got := a.subnets(p1); len(got) != 0 {
+		t.Errorf("subnets(p1) = %v, want none", got)
+	}
+	a.removePeer(p2)
+	if got := a.lookup(tcpip.AddrFrom4([4]byte{10, 1, 0, 1})); got != nil {
+		t.Errorf("lookup(10.1.0.1) = %p after removing the peer, want nil", got)
+	}
+}
@@ -0,0 +1,285 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"time"
+
+	"golang.org/x/crypto/blake2s"
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// Timing constants, from the WireGuard whitepaper.
+const (
+	rekeyAfterMessages      = 1 << 60
+	rejectAfterMessages     = 1<<64 - 1<<13 - 1
+	rekeyAfterTime          = 120 * time.Second
+	rejectAfterTime         = 180 * time.Second
+	rekeyAttemptTime        = 90 * time.Second
+	rekeyTimeout            = 5 * time.Second
+	keepaliveTimeout        = 10 * time.Second
+	cookieRefreshTime       = 120 * time.Second
+	handshakeInitiationRate = time.Second / 50
+
+	// maxTimerHandshakes is the number of handshake retransmissions before
+	// giving up.
+	maxTimerHandshakes = int(rekeyAttemptTime / rekeyTimeout)
+
+	// maxJitter is the maximum random delay added to handshake timers.
+	maxJitter = 334 * time.Millisecond
+
+	// maxStagedPackets is the number of packets queued while a handshake
+	// is in progress. Older packets are dropped first.
+	maxStagedPackets = 128
+)
+
+// stagedPacket is an IP packet waiting to be encrypted and sent.
+type stagedPacket struct {
+	data  []byte
+	depth uint8
+	owner tcpip.PacketOwner
+}
+
+// peerTimer is a timer of a peer.
+type peerTimer struct {
+	job     *tcpip.Job
+	pending bool
+}
+
+func (t *peerTimer) schedule(d time.Duration) {
+	t.job.Cancel()
+	t.job.Schedule(d)
+	t.pending = true
+}
+
+func (t *peerTimer) cancel() {
+	t.job.Cancel()
+	t.pending = false
+}
+
+// peer is a WireGuard peer.
+//
+// +stateify savable
+type peer struct {
+	e *Endpoint
+
+	// The fields below are the configuration of the peer.
+	publicKey           Key
+	presharedKey        Key
+	endpoint            tcpip.FullAddress
+	persistentKeepalive time.Duration
+
+	// The fields below are statistics.
+	rxBytes uint64
+	txBytes uint64
+
+	// lastHandshake is the wall clock time of the last completed handshake,
+	// in nanoseconds since the Unix epoch, or 0 if there was none.
+	lastHandshake int64
+
+	// staticStatic is the Diffie-Hellman shared secret of the static keys
+	// of the device and the peer.
+	staticStatic Key
+
+	// mac1Key is HASH(LABEL_MAC1 || peer public key), the key of the mac1
+	// field of handshake messages sent to the peer, and cookieKey is
+	// HASH(LABEL_COOKIE || peer public key), the key of the cookie replies
+	// it sends.
+	mac1Key   [blake2s.Size]byte
+	cookieKey [blake2s.Size]byte
+
+	// The fields below are the session state, which isn't preserved
+	// across save/restore; a new handshake takes place instead.
+	hs                        handshake           `state:"nosave"`
+	lastTimestamp             [tai64nSize]byte    `state:"nosave"`
+	lastInitiationConsumption tcpip.MonotonicTime `state:"nosave"`
+	consumedInitiation        bool                `state:"nosave"`
+	lastSentInitiation        tcpip.MonotonicTime `state:"nosave"`
+	sentInitiation            bool                `state:"nosave"`
+	previous                  *keypair            `state:"nosave"`
+	current                   *keypair            `state:"nosave"`
+	next                      *keypair            `state:"nosave"`
+	cookie                    [macSize]byte       `state:"nosave"`
+	cookieTime                tcpip.MonotonicTime `state:"nosave"`
+	hasCookie                 bool                `state:"nosave"`
+	lastMAC1                  [macSize]byte       `state:"nosave"`
+	hasLastMAC1               bool                `state:"nosave"`
+	staged                    []stagedPacket      `state:"nosave"`
+	handshakeAttempts         int                 `state:"nosave"`
+	needAnotherKeepalive      bool                `state:"nosave"`
+	sentLastMinuteHandshake   bool                `state:"nosave"`
+
+	// The timers of the peer, as described by the WireGuard whitepaper.
+	retransmitHandshake      peerTimer `state:"nosave"`
+	sendKeepalive            peerTimer `state:"nosave"`
+	newHandshake             peerTimer `state:"nosave"`
+	zeroKeyMaterial          peerTimer `state:"nosave"`
+	persistentKeepaliveTimer peerTimer `state:"nosave"`
+}
+
+// newPeer creates a peer of e with the given public key.
+//
+// +checklocks:e.mu
+func (e *Endpoint) newPeer(publicKey Key) *peer {
+	p := &peer{
+		e:         e,
+		publicKey: publicKey,
+	}
+	blake2sHash(&p.mac1Key, []byte(wgLabelMAC1), publicKey[:])
+	blake2sHash(&p.cookieKey, []byte(wgLabelCookie), publicKey[:])
+	p.precompute()
+	p.initTimers()
+	return p
+}
+
+// precompute computes the shared secret of the static keys of the device and
+// p.
+//
+// +checklocks:p.e.mu
+func (p *peer) precompute() {
+	p.staticStatic = Key{}
+	if p.e.hasPrivateKey {
+		p.staticStatic, _ = sharedSecret(p.e.privateKey, p.publicKey)
+	}
+}
+
+// initTimers creates the timers of p.
+func (p *peer) initTimers() {
+	clock := p.e.stack.Clock()
+	locker := (*flushLocker)(p.e)
+	p.retransmitHandshake.job = tcpip.NewJob(clock, locker, p.expiredRetransmitHandshake)
+	p.sendKeepalive.job = tcpip.NewJob(clock, locker, p.expiredSendKeepalive)
+	p.newHandshake.job = tcpip.NewJob(clock, locker, p.expiredNewHandshake)
+	p.zeroKeyMaterial.job = tcpip.NewJob(clock, locker, p.expiredZeroKeyMaterial)
+	p.persistentKeepaliveTimer.job = tcpip.NewJob(clock, locker, p.expiredPersistentKeepalive)
+}
+
+// jitter returns a random delay added to handshake timers, so that peers
+// don't synchronize their handshakes.
+//
+// +checklocks:p.e.mu
+func (p *peer) jitter() time.Duration {
+	return time.Duration(p.e.stack.InsecureRNG().Int63n(int64(maxJitter)))
+}
+
+// The functions below are the timer events of the WireGuard whitepaper.
+
+// +checklocks:p.e.mu
+func (p *peer) timersDataSent() {
+	if !p.newHandshake.pending {
+		p.newHandshake.schedule(keepaliveTimeout + rekeyTimeout + p.jitter())
+	}
+}
+
+// +checklocks:p.e.mu
+func (p *peer) timersDataReceived() {
+	if !p.sendKeepalive.pending {
+		p.sendKeepalive.schedule(keepaliveTimeout)
+	} else {
+		p.needAnotherKeepalive = true
+	}
+}
+
+// +checklocks:p.e.mu
+func (p *peer) timersAnyAuthenticatedPacketSent() {
+	p.sendKeepalive.cancel()
+}
+
+// +checklocks:p.e.mu
+func (p *peer) timersAnyAuthenticatedPacketReceived() {
+	p.newHandshake.cancel()
+}
+
+// +checklocks:p.e.mu
+func (p *peer) timersHandshakeInitiated() {
+	p.retransmitHandshake.schedule(rekeyTimeout + p.jitter())
+}
+
+// +checklocks:p.e.mu
+func (p *peer) timersHandshakeComplete() {
+	p.retransmitHandshake.cancel()
+	p.handshakeAttempts = 0
+	p.sentLastMinuteHandshake = false
+	p.lastHandshake = p.e.stack.Clock().Now().UnixNano()
+}
+
+// +checklocks:p.e.mu
+func (p *peer) timersSessionDerived() {
+	p.zeroKeyMaterial.schedule(rejectAfterTime * 3)
+}
+
+// +checklocks:p.e.mu
+func (p *peer) timersAnyAuthenticatedPacketTraversal() {
+	if p.persistentKeepalive > 0 {
+		p.persistentKeepaliveTimer.schedule(p.persistentKeepalive)
+	}
+}
+
+// +checklocks:p.e.mu
+func (p *peer) expiredRetransmitHandshake() {
+	p.retransmitHandshake.pending = false
+	if p.handshakeAttempts > maxTimerHandshakes {
+		// Give up, and drop the packets waiting for the handshake.
+		p.sendKeepalive.cancel()
+		p.staged = nil
+		if !p.zeroKeyMaterial.pending {
+			p.zeroKeyMaterial.schedule(rejectAfterTime * 3)
+		}
+		return
+	}
+	p.handshakeAttempts++
+	p.e.sendInitiation(p, true /* retry */)
+}
+
+// +checklocks:p.e.mu
+func (p *peer) expiredSendKeepalive() {
+	p.sendKeepalive.pending = false
+	p.e.sendKeepalive(p)
+	if p.needAnotherKeepalive {
+		p.needAnotherKeepalive = false
+		p.sendKeepalive.schedule(keepaliveTimeout)
+	}
+}
+
+// +checklocks:p.e.mu
+func (p *peer) expiredNewHandshake() {
+	p.newHandshake.pending = false
+	p.e.sendInitiation(p, false /* retry */)
+}
+
+// +checklocks:p.e.mu
+func (p *peer) expiredZeroKeyMaterial() {
+	p.zeroKeyMaterial.pending = false
+	p.e.zeroKeys(p)
+}
+
+// +checklocks:p.e.mu
+func (p *peer) expiredPersistentKeepalive() {
+	p.persistentKeepaliveTimer.pending = false
+	if p.persistentKeepalive > 0 {
+		p.e.sendKeepalive(p)
+	}
+}
+
+// stopTimers stops all timers of p.
+//
+// +checklocks:p.e.mu
+func (p *peer) stopTimers() {
+	p.retransmitHandshake.cancel()
+	p.sendKeepalive.cancel()
+	p.newHandshake.cancel()
+	p.zeroKeyMaterial.cancel()
+	p.persistentKeepaliveTimer.cancel()
+}
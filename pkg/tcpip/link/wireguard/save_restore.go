@@ -0,0 +1,26 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import "context"
+
+// afterLoad is invoked by stateify. Sessions aren't saved, so new handshakes
+// take place once packets are sent.
+func (e *Endpoint) afterLoad(context.Context) {
+	e.index = make(map[uint32]indexEntry)
+	for _, p := range e.peerList {
+		p.initTimers()
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard
+
+import (
+	"math"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/ports"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+var _ stack.TransportEndpoint = (*udpBinding)(nil)
+
+// udpBinding receives the UDP datagrams sent to the listen port of an
+// endpoint, over IPv4 and IPv6.
+//
+// +stateify savable
+type udpBinding struct {
+	e         *Endpoint
+	port      uint16
+	netProtos []tcpip.NetworkProtocolNumber
+}
+
+// bindUDP reserves port, or a random port if it's zero, and starts receiving
+// its datagrams for e.
+func bindUDP(e *Endpoint, port uint16) (*udpBinding, tcpip.Error) {
+	b := &udpBinding{e: e}
+	for _, netProto := range []tcpip.NetworkProtocolNumber{header.IPv4ProtocolNumber, header.IPv6ProtocolNumber} {
+		if e.stack.CheckNetworkProtocol(netProto) {
+			b.netProtos = append(b.netProtos, netProto)
+		}
+	}
+	if len(b.netProtos) == 0 {
+		return nil, &tcpip.ErrUnknownProtocol{}
+	}
+	res := ports.Reservation{
+		Networks:  b.netProtos,
+		Transport: header.UDPProtocolNumber,
+		Port:      port,
+	}
+	port, err := e.stack.ReservePort(e.stack.SecureRNG(), res, nil /* testPort */)
+	if err != nil {
+		return nil, err
+	}
+	b.port = port
+	if err := e.stack.RegisterTransportEndpoint(b.netProtos, header.UDPProtocolNumber, b.id(), b, ports.Flags{}, 0 /* bindToDevice */); err != nil {
+		e.stack.ReleasePort(b.reservation())
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *udpBinding) reservation() ports.Reservation {
+	return ports.Reservation{
+		Networks:  b.netProtos,
+		Transport: header.UDPProtocolNumber,
+		Port:      b.port,
+	}
+}
+
+func (b *udpBinding) id() stack.TransportEndpointID {
+	return stack.TransportEndpointID{LocalPort: b.port}
+}
+
+// unregister stops receiving the datagrams of b and releases its port.
+func (b *udpBinding) unregister() {
+	st := b.e.stack
+	st.UnregisterTransportEndpoint(b.netProtos, header.UDPProtocolNumber, b.id(), b, ports.Flags{}, 0 /* bindToDevice */)
+	st.ReleasePort(b.reservation())
+}
+
+// rebind moves the binding of e to port. A zero port selects a new random
+// port.
+//
+// +checklocks:e.bindMu
+func (e *Endpoint) rebind(port uint16) tcpip.Error {
+	e.mu.Lock()
+	closed := e.closed
+	old := e.binding
+	e.mu.Unlock()
+	if closed {
+		return &tcpip.ErrClosedForSend{}
+	}
+	if old != nil && old.port == port {
+		return nil
+	}
+	b, err := bindUDP(e, port)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.binding = b
+	e.mu.Unlock()
+	if old != nil {
+		old.unregister()
+	}
+	return nil
+}
+
+// HandlePacket implements stack.TransportEndpoint.HandlePacket.
+func (b *udpBinding) HandlePacket(_ stack.TransportEndpointID, pkt *stack.PacketBuffer) {
+	stats := b.e.stack.Stats()
+	hdr := header.UDP(pkt.TransportHeader().Slice())
+	net := pkt.Network()
+	lengthValid, csumValid := header.UDPValid(
+		hdr,
+		func() uint16 { return pkt.Data().Checksum() },
+		uint16(pkt.Data().Size()),
+		pkt.NetworkProtocolNumber,
+		net.SourceAddress(),
+		net.DestinationAddress(),
+		pkt.RXChecksumValidated)
+	if !lengthValid {
+		stats.UDP.MalformedPacketsReceived.Increment()
+		return
+	}
+	if !csumValid {
+		stats.UDP.ChecksumErrors.Increment()
+		return
+	}
+	stats.UDP.PacketsReceived.Increment()
+
+	from := tcpip.FullAddress{
+		Addr: net.SourceAddress(),
+		Port: hdr.SourcePort(),
+	}
+	msg := pkt.Data().AsRange().ToSlice()
+
+	e := b.e
+	e.mu.Lock()
+	defer e.unlock()
+	if e.closed {
+		return
+	}
+	e.handleMessage(msg, from)
+}
+
+// HandleError implements stack.TransportEndpoint.HandleError.
+func (*udpBinding) HandleError(stack.TransportError, *stack.PacketBuffer) {}
+
+// Abort implements stack.TransportEndpoint.Abort.
+func (*udpBinding) Abort() {}
+
+// Wait implements stack.TransportEndpoint.Wait.
+func (*udpBinding) Wait() {}
+
+// send sends the datagram dg.
+func (e *Endpoint) send(dg datagram) {
+	netProto := header.IPv4ProtocolNumber
+	if dg.to.Addr.Len() == header.IPv6AddressSize {
+		netProto = header.IPv6ProtocolNumber
+	}
+	r, err := e.stack.FindRouteForFlow(0 /* id */, tcpip.Address{}, dg.to.Addr, netProto, false /* multicastLoop */, stack.RouteFlow{Mark: dg.mark})
+	if err != nil {
+		return
+	}
+	defer r.Release()
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: int(r.MaxHeaderLength()) + header.UDPMinimumSize,
+		Payload:            buffer.MakeWithData(dg.data),
+	})
+	defer pkt.DecRef()
+	pkt.TunnelDepth = dg.depth
+	pkt.Owner = dg.owner
+	pkt.Mark = dg.mark
+
+	length := uint16(pkt.Size() + header.UDPMinimumSize)
+	udp := header.UDP(pkt.TransportHeader().Push(header.UDPMinimumSize))
+	udp.Encode(&header.UDPFields{
+		SrcPort: dg.srcPort,
+		DstPort: dg.to.Port,
+		Length:  length,
+	})
+	if r.RequiresTXTransportChecksum() {
+		xsum := udp.CalculateChecksum(checksum.Combine(
+			header.PseudoHeaderChecksum(header.UDPProtocolNumber, r.LocalAddress(), r.RemoteAddress(), length),
+			pkt.Data().Checksum(),
+		))
+		if xsum != math.MaxUint16 {
+			xsum = ^xsum
+		}
+		udp.SetChecksum(xsum)
+	}
+	if err := r.WritePacket(stack.NetworkHeaderParams{
+		Protocol: header.UDPProtocolNumber,
+		TTL:      r.DefaultTTL(),
+	}, pkt); err == nil {
+		e.stack.Stats().UDP.PacketsSent.Increment()
+	}
+}
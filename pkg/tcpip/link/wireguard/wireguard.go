@@ -0,0 +1,1078 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wireguard provides a WireGuard link endpoint. It encrypts the IP
+// packets written to it and sends them in UDP datagrams through a netstack
+// stack to the peer owning their destination, and delivers the packets it
+// decrypts from the datagrams received by that stack.
+//
+// The protocol is described at https://www.wireguard.com/protocol/.
+package wireguard
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/blake2s"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// DefaultMTU is the default MTU of WireGuard interfaces, which leaves
+	// room for the encapsulation over IPv6 in a 1500 bytes underlay.
+	DefaultMTU = 1420
+
+	// maxTunnelDepth is the maximum number of tunnels a packet can be
+	// encapsulated by. It breaks routing loops where the route to a peer
+	// goes through the interface itself.
+	maxTunnelDepth = 8
+
+	// paddingMultiple is the multiple that the plaintext of transport
+	// messages is padded to.
+	paddingMultiple = 16
+
+	// underLoadHandshakes is the number of handshake messages received in a
+	// second above which the endpoint considers itself under load, and
+	// requires handshake messages to carry a valid cookie.
+	underLoadHandshakes = 128
+
+	// underLoadDuration is how long the endpoint stays under load after the
+	// rate of handshake messages goes over underLoadHandshakes.
+	underLoadDuration = time.Second
+)
+
+// Options are the options of a WireGuard endpoint.
+type Options struct {
+	// Stack is the stack that sends and receives the UDP datagrams of the
+	// endpoint.
+	Stack *stack.Stack
+
+	// MTU is the MTU of the endpoint. If zero, DefaultMTU is used.
+	MTU uint32
+
+	// ListenPort is the UDP port the endpoint receives datagrams on. If
+	// zero, a random port is used.
+	ListenPort uint16
+}
+
+// Config is a change to the configuration of a WireGuard endpoint. Nil fields
+// are left unchanged.
+type Config struct {
+	// PrivateKey is the private key of the endpoint. A zero key removes it.
+	PrivateKey *Key
+
+	// ListenPort is the UDP port the endpoint receives datagrams on. If
+	// zero, a random port is used.
+	ListenPort *uint16
+
+	// Fwmark is the mark of the datagrams sent by the endpoint, used for
+	// policy routing.
+	Fwmark *uint32
+
+	// ReplacePeers removes all peers before Peers are applied.
+	ReplacePeers bool
+
+	// Peers are changes to the peers of the endpoint.
+	Peers []PeerConfig
+}
+
+// PeerConfig is a change to the configuration of a peer. Unless UpdateOnly
+// is set, the peer is created if it doesn't exist.
+type PeerConfig struct {
+	// PublicKey is the public key identifying the peer.
+	PublicKey Key
+
+	// Remove removes the peer.
+	Remove bool
+
+	// UpdateOnly only changes the peer if it exists.
+	UpdateOnly bool
+
+	// PresharedKey is the preshared key mixed into the handshakes with the
+	// peer. A zero key disables it.
+	PresharedKey *Key
+
+	// Endpoint is the address and port the datagrams to the peer are sent
+	// to. It is updated to the source of authenticated datagrams received
+	// from the peer.
+	Endpoint *tcpip.FullAddress
+
+	// PersistentKeepalive is the interval of the keepalives sent to the
+	// peer, to keep NAT mappings alive. Zero disables them.
+	PersistentKeepalive *time.Duration
+
+	// ReplaceAllowedIPs removes the allowed IPs of the peer before
+	// AllowedIPs are added.
+	ReplaceAllowedIPs bool
+
+	// AllowedIPs are added to the allowed IPs of the peer, taking them from
+	// other peers.
+	AllowedIPs []tcpip.Subnet
+}
+
+// Info is the configuration and state of a WireGuard endpoint.
+type Info struct {
+	// PrivateKey and PublicKey are the keys of the endpoint. They are zero
+	// if no private key is set.
+	PrivateKey Key
+	PublicKey  Key
+
+	// ListenPort is the UDP port the endpoint receives datagrams on.
+	ListenPort uint16
+
+	// Fwmark is the mark of the datagrams sent by the endpoint.
+	Fwmark uint32
+
+	// Peers are the peers of the endpoint, in the order they were added.
+	Peers []PeerInfo
+}
+
+// PeerInfo is the configuration and state of a peer.
+type PeerInfo struct {
+	PublicKey           Key
+	PresharedKey        Key
+	Endpoint            tcpip.FullAddress
+	PersistentKeepalive time.Duration
+
+	// LastHandshake is the time of the last completed handshake, or the
+	// zero time if there was none.
+	LastHandshake time.Time
+
+	// RxBytes and TxBytes are the sizes of the datagrams received from and
+	// sent to the peer.
+	RxBytes uint64
+	TxBytes uint64
+
+	AllowedIPs []tcpip.Subnet
+}
+
+// indexEntry is what a local index, the receiver index of the messages sent
+// to us, refers to: the handshake with a peer, or one of its keypairs.
+type indexEntry struct {
+	peer    *peer
+	keypair *keypair
+}
+
+// datagram is a UDP datagram to send once the endpoint is unlocked.
+type datagram struct {
+	to      tcpip.FullAddress
+	srcPort uint16
+	mark    uint32
+	data    []byte
+	depth   uint8
+	owner   tcpip.PacketOwner
+}
+
+// delivery is a decrypted packet to deliver once the endpoint is unlocked.
+type delivery struct {
+	protocol tcpip.NetworkProtocolNumber
+	data     []byte
+}
+
+var _ stack.LinkEndpoint = (*Endpoint)(nil)
+
+// Endpoint is a WireGuard link endpoint.
+//
+// +stateify savable
+type Endpoint struct {
+	stack *stack.Stack
+
+	// bindMu serializes changes to the UDP binding.
+	bindMu sync.Mutex `state:"nosave"`
+
+	// mu protects the fields below. Datagrams and packets produced while
+	// it is held are queued, and sent or delivered by unlock after it is
+	// released, as doing so may reenter the endpoint.
+	mu sync.Mutex `state:"nosave"`
+	// +checklocks:mu
+	dispatcher stack.NetworkDispatcher
+	// +checklocks:mu
+	mtu uint32
+	// +checklocks:mu
+	closed bool
+	// +checklocks:mu
+	onCloseAction func() `state:"nosave"`
+	// +checklocks:mu
+	binding *udpBinding
+	// +checklocks:mu
+	fwmark uint32
+
+	// +checklocks:mu
+	hasPrivateKey bool
+	// +checklocks:mu
+	privateKey Key
+	// +checklocks:mu
+	publicKey Key
+
+	// mac1Key and cookieKey are the keys of the mac1 field of handshake
+	// messages sent to us and of the cookie replies we send, derived from
+	// publicKey.
+	//
+	// +checklocks:mu
+	mac1Key [blake2s.Size]byte
+	// +checklocks:mu
+	cookieKey [blake2s.Size]byte
+
+	// peers maps public keys to peers, and peerList holds them in the
+	// order they were added.
+	//
+	// +checklocks:mu
+	peers map[Key]*peer
+	// +checklocks:mu
+	peerList []*peer
+	// +checklocks:mu
+	allowedIPs allowedIPs
+
+	// index maps local indices to handshakes and keypairs.
+	//
+	// +checklocks:mu
+	index map[uint32]indexEntry `state:"nosave"`
+
+	// cookieSecret is the secret that cookies are derived from. It changes
+	// every cookieRefreshTime.
+	//
+	// +checklocks:mu
+	cookieSecret [blake2s.Size]byte `state:"nosave"`
+	// +checklocks:mu
+	cookieSecretTime tcpip.MonotonicTime `state:"nosave"`
+	// +checklocks:mu
+	hasCookieSecret bool `state:"nosave"`
+
+	// The fields below track the rate of received handshake messages.
+	//
+	// +checklocks:mu
+	handshakeWindowStart tcpip.MonotonicTime `state:"nosave"`
+	// +checklocks:mu
+	handshakeCount int `state:"nosave"`
+	// +checklocks:mu
+	underLoadUntil tcpip.MonotonicTime `state:"nosave"`
+
+	// +checklocks:mu
+	datagrams []datagram `state:"nosave"`
+	// +checklocks:mu
+	deliveries []delivery `state:"nosave"`
+}
+
+// New creates a WireGuard endpoint and starts receiving its datagrams from
+// opts.Stack. It has no private key and no peers until it is configured.
+func New(opts Options) (*Endpoint, tcpip.Error) {
+	if opts.Stack == nil {
+		return nil, &tcpip.ErrInvalidOptionValue{}
+	}
+	e := &Endpoint{
+		stack: opts.Stack,
+		mtu:   opts.MTU,
+		peers: make(map[Key]*peer),
+		index: make(map[uint32]indexEntry),
+	}
+	if e.mtu == 0 {
+		e.mtu = DefaultMTU
+	}
+	b, err := bindUDP(e, opts.ListenPort)
+	if err != nil {
+		return nil, err
+	}
+	e.binding = b
+	return e, nil
+}
+
+// flushLocker locks the mutex of an endpoint, and flushes its queues when
+// unlocking it. It is the locker of the timers of peers.
+type flushLocker Endpoint
+
+// Lock implements sync.Locker.Lock.
+//
+// +checklocksignore
+func (l *flushLocker) Lock() {
+	l.mu.Lock()
+}
+
+// Unlock implements sync.Locker.Unlock.
+//
+// +checklocksignore
+func (l *flushLocker) Unlock() {
+	(*Endpoint)(l).unlock()
+}
+
+// unlock unlocks e.mu, then sends the datagrams and delivers the packets
+// queued while it was held.
+//
+// +checklocksrelease:e.mu
+func (e *Endpoint) unlock() {
+	datagrams := e.datagrams
+	e.datagrams = nil
+	deliveries := e.deliveries
+	e.deliveries = nil
+	d := e.dispatcher
+	e.mu.Unlock()
+
+	for _, dg := range datagrams {
+		e.send(dg)
+	}
+	for _, dl := range deliveries {
+		if d == nil {
+			break
+		}
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithData(dl.data),
+		})
+		d.DeliverNetworkPacket(dl.protocol, pkt)
+		pkt.DecRef()
+	}
+}
+
+// queueDatagram queues data to be sent to p once e is unlocked.
+//
+// +checklocks:e.mu
+func (e *Endpoint) queueDatagram(p *peer, data []byte, depth uint8, owner tcpip.PacketOwner) {
+	e.queueDatagramTo(p.endpoint, data, depth, owner)
+	p.txBytes += uint64(len(data))
+}
+
+// queueDatagramTo queues data to be sent to the given address once e is
+// unlocked.
+//
+// +checklocks:e.mu
+func (e *Endpoint) queueDatagramTo(to tcpip.FullAddress, data []byte, depth uint8, owner tcpip.PacketOwner) {
+	if e.binding == nil {
+		return
+	}
+	e.datagrams = append(e.datagrams, datagram{
+		to:      to,
+		srcPort: e.binding.port,
+		mark:    e.fwmark,
+		data:    data,
+		depth:   depth,
+		owner:   owner,
+	})
+}
+
+// newIndex returns a new random local index referring to entry.
+//
+// +checklocks:e.mu
+func (e *Endpoint) newIndex(entry indexEntry) uint32 {
+	rng := e.stack.SecureRNG()
+	for {
+		i := rng.Uint32()
+		if _, ok := e.index[i]; i != 0 && !ok {
+			e.index[i] = entry
+			return i
+		}
+	}
+}
+
+// removeHandshakeIndex removes the local index of the handshake with p.
+//
+// +checklocks:e.mu
+func (e *Endpoint) removeHandshakeIndex(p *peer) {
+	if i := p.hs.localIndex; i != 0 {
+		if entry, ok := e.index[i]; ok && entry.keypair == nil {
+			delete(e.index, i)
+		}
+		p.hs.localIndex = 0
+	}
+}
+
+// removeKeypair removes the local index of kp, if it isn't nil.
+//
+// +checklocks:e.mu
+func (e *Endpoint) removeKeypair(kp *keypair) {
+	if kp != nil {
+		delete(e.index, kp.localIndex)
+	}
+}
+
+// zeroKeys forgets the keypairs and the handshake of p.
+//
+// +checklocks:e.mu
+func (e *Endpoint) zeroKeys(p *peer) {
+	for _, kp := range []*keypair{p.previous, p.current, p.next} {
+		e.removeKeypair(kp)
+	}
+	p.previous, p.current, p.next = nil, nil, nil
+	e.removeHandshakeIndex(p)
+	p.hs = handshake{}
+}
+
+// Configure applies cfg to the configuration of e.
+func (e *Endpoint) Configure(cfg Config) tcpip.Error {
+	for i := range cfg.Peers {
+		if err := cfg.Peers[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	e.bindMu.Lock()
+	defer e.bindMu.Unlock()
+	if cfg.ListenPort != nil {
+		if err := e.rebind(*cfg.ListenPort); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.unlock()
+	if e.closed {
+		return &tcpip.ErrClosedForSend{}
+	}
+	if cfg.Fwmark != nil {
+		e.fwmark = *cfg.Fwmark
+	}
+	if cfg.PrivateKey != nil {
+		e.setPrivateKey(*cfg.PrivateKey)
+	}
+	if cfg.ReplacePeers {
+		for len(e.peerList) != 0 {
+			e.removePeer(e.peerList[0])
+		}
+	}
+	for i := range cfg.Peers {
+		e.configurePeer(&cfg.Peers[i])
+	}
+	return nil
+}
+
+// validate checks the addresses of pc.
+func (pc *PeerConfig) validate() tcpip.Error {
+	if pc.PublicKey.IsZero() {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+	if pc.Endpoint != nil {
+		switch pc.Endpoint.Addr.Len() {
+		case header.IPv4AddressSize, header.IPv6AddressSize:
+		default:
+			return &tcpip.ErrBadAddress{}
+		}
+		if pc.Endpoint.Port == 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+	}
+	if pc.PersistentKeepalive != nil && (*pc.PersistentKeepalive < 0 || *pc.PersistentKeepalive > 0xffff*time.Second) {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+	return nil
+}
+
+// setPrivateKey sets the private key of e.
+//
+// +checklocks:e.mu
+func (e *Endpoint) setPrivateKey(k Key) {
+	if !k.IsZero() {
+		k.clamp()
+	}
+	if e.hasPrivateKey == !k.IsZero() && subtle.ConstantTimeCompare(k[:], e.privateKey[:]) == 1 {
+		return
+	}
+	if k.IsZero() {
+		e.hasPrivateKey = false
+		e.privateKey = Key{}
+		e.publicKey = Key{}
+	} else {
+		e.hasPrivateKey = true
+		e.privateKey = k
+		e.publicKey = k.PublicKey()
+		// A peer can't have our own public key.
+		if p, ok := e.peers[e.publicKey]; ok {
+			e.removePeer(p)
+		}
+	}
+	blake2sHash(&e.mac1Key, []byte(wgLabelMAC1), e.publicKey[:])
+	blake2sHash(&e.cookieKey, []byte(wgLabelCookie), e.publicKey[:])
+
+	// Sessions established with the previous key can't be used to send
+	// anymore, and handshakes in progress can't complete.
+	for _, p := range e.peerList {
+		p.precompute()
+		e.removeHandshakeIndex(p)
+		p.hs = handshake{}
+		for _, kp := range []*keypair{p.current, p.next} {
+			if kp != nil {
+				kp.expire()
+			}
+		}
+	}
+}
+
+// configurePeer applies pc to the configuration of e.
+//
+// +checklocks:e.mu
+func (e *Endpoint) configurePeer(pc *PeerConfig) {
+	p, ok := e.peers[pc.PublicKey]
+	if !ok {
+		if pc.Remove || pc.UpdateOnly {
+			return
+		}
+		if e.hasPrivateKey && pc.PublicKey == e.publicKey {
+			return
+		}
+		p = e.newPeer(pc.PublicKey)
+		e.peers[p.publicKey] = p
+		e.peerList = append(e.peerList, p)
+	}
+	if pc.Remove {
+		e.removePeer(p)
+		return
+	}
+	if pc.PresharedKey != nil {
+		p.presharedKey = *pc.PresharedKey
+	}
+	if pc.Endpoint != nil {
+		p.endpoint = *pc.Endpoint
+	}
+	if pc.ReplaceAllowedIPs {
+		e.allowedIPs.removePeer(p)
+	}
+	for _, subnet := range pc.AllowedIPs {
+		e.allowedIPs.insert(subnet, p)
+	}
+	if pc.PersistentKeepalive != nil {
+		enabled := p.persistentKeepalive == 0 && *pc.PersistentKeepalive != 0
+		p.persistentKeepalive = *pc.PersistentKeepalive
+		if enabled {
+			e.sendKeepalive(p)
+		}
+	}
+}
+
+// removePeer removes p from e.
+//
+// +checklocks:e.mu
+func (e *Endpoint) removePeer(p *peer) {
+	p.stopTimers()
+	e.zeroKeys(p)
+	p.staged = nil
+	e.allowedIPs.removePeer(p)
+	delete(e.peers, p.publicKey)
+	e.peerList = slices.DeleteFunc(e.peerList, func(q *peer) bool {
+		return q == p
+	})
+}
+
+// Info returns the configuration and state of e.
+func (e *Endpoint) Info() Info {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	info := Info{
+		ListenPort: e.listenPortLocked(),
+		Fwmark:     e.fwmark,
+	}
+	if e.hasPrivateKey {
+		info.PrivateKey = e.privateKey
+		info.PublicKey = e.publicKey
+	}
+	for _, p := range e.peerList {
+		pi := PeerInfo{
+			PublicKey:           p.publicKey,
+			PresharedKey:        p.presharedKey,
+			Endpoint:            p.endpoint,
+			PersistentKeepalive: p.persistentKeepalive,
+			RxBytes:             p.rxBytes,
+			TxBytes:             p.txBytes,
+			AllowedIPs:          e.allowedIPs.subnets(p),
+		}
+		if p.lastHandshake != 0 {
+			pi.LastHandshake = time.Unix(0, p.lastHandshake)
+		}
+		info.Peers = append(info.Peers, pi)
+	}
+	return info
+}
+
+// +checklocks:e.mu
+func (e *Endpoint) listenPortLocked() uint16 {
+	if e.binding == nil {
+		return 0
+	}
+	return e.binding.port
+}
+
+// ListenPort returns the UDP port e receives datagrams on.
+func (e *Endpoint) ListenPort() uint16 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.listenPortLocked()
+}
+
+// Attach implements stack.LinkEndpoint.Attach.
+func (e *Endpoint) Attach(dispatcher stack.NetworkDispatcher) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dispatcher = dispatcher
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (e *Endpoint) IsAttached() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dispatcher != nil
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (e *Endpoint) MTU() uint32 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.mtu
+}
+
+// SetMTU implements stack.LinkEndpoint.SetMTU.
+func (e *Endpoint) SetMTU(mtu uint32) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mtu = mtu
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities.
+func (*Endpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return 0
+}
+
+// MaxHeaderLength implements stack.LinkEndpoint.MaxHeaderLength. Packets are
+// encrypted into new buffers, so no space is reserved for headers.
+func (*Endpoint) MaxHeaderLength() uint16 {
+	return 0
+}
+
+// LinkAddress implements stack.LinkEndpoint.LinkAddress. WireGuard
+// interfaces have no link address.
+func (*Endpoint) LinkAddress() tcpip.LinkAddress {
+	return ""
+}
+
+// SetLinkAddress implements stack.LinkEndpoint.SetLinkAddress.
+func (*Endpoint) SetLinkAddress(tcpip.LinkAddress) {}
+
+// Wait implements stack.LinkEndpoint.Wait.
+func (*Endpoint) Wait() {}
+
+// ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType.
+func (*Endpoint) ARPHardwareType() header.ARPHardwareType {
+	return header.ARPHardwareNone
+}
+
+// AddHeader implements stack.LinkEndpoint.AddHeader.
+func (*Endpoint) AddHeader(*stack.PacketBuffer) {}
+
+// ParseHeader implements stack.LinkEndpoint.ParseHeader.
+func (*Endpoint) ParseHeader(*stack.PacketBuffer) bool { return true }
+
+// SetOnCloseAction implements stack.LinkEndpoint.SetOnCloseAction.
+func (e *Endpoint) SetOnCloseAction(action func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onCloseAction = action
+}
+
+// Close implements stack.LinkEndpoint.Close.
+func (e *Endpoint) Close() {
+	e.bindMu.Lock()
+	defer e.bindMu.Unlock()
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	for _, p := range e.peerList {
+		p.stopTimers()
+		e.zeroKeys(p)
+		p.staged = nil
+	}
+	b := e.binding
+	e.binding = nil
+	action := e.onCloseAction
+	e.onCloseAction = nil
+	e.datagrams = nil
+	e.deliveries = nil
+	e.mu.Unlock()
+
+	if b != nil {
+		b.unregister()
+	}
+	if action != nil {
+		action()
+	}
+}
+
+// WritePackets implements stack.LinkEndpoint.WritePackets.
+func (e *Endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	e.mu.Lock()
+	defer e.unlock()
+	if e.closed {
+		return 0, &tcpip.ErrClosedForSend{}
+	}
+	n := 0
+	for _, pkt := range pkts.AsSlice() {
+		if err := e.writePacket(pkt); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// writePacket stages pkt for the peer owning its destination, and sends the
+// staged packets if a session with the peer is established.
+//
+// +checklocks:e.mu
+func (e *Endpoint) writePacket(pkt *stack.PacketBuffer) tcpip.Error {
+	if pkt.TunnelDepth >= maxTunnelDepth {
+		return &tcpip.ErrHostUnreachable{}
+	}
+	var dst tcpip.Address
+	switch h := pkt.NetworkHeader().Slice(); pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		if len(h) < header.IPv4MinimumSize {
+			return &tcpip.ErrMalformedHeader{}
+		}
+		dst = header.IPv4(h).DestinationAddress()
+	case header.IPv6ProtocolNumber:
+		if len(h) < header.IPv6MinimumSize {
+			return &tcpip.ErrMalformedHeader{}
+		}
+		dst = header.IPv6(h).DestinationAddress()
+	default:
+		return &tcpip.ErrNotSupported{}
+	}
+	p := e.allowedIPs.lookup(dst)
+	if p == nil {
+		return &tcpip.ErrHostUnreachable{}
+	}
+	if p.endpoint.Addr.Len() == 0 {
+		return &tcpip.ErrDestinationRequired{}
+	}
+
+	buf := pkt.ToBuffer()
+	data := buf.Flatten()
+	buf.Release()
+	if len(p.staged) == maxStagedPackets {
+		p.staged = p.staged[1:]
+	}
+	p.staged = append(p.staged, stagedPacket{
+		data:  data,
+		depth: pkt.TunnelDepth,
+		owner: pkt.Owner,
+	})
+	e.sendStaged(p)
+	return nil
+}
+
+// sendStaged sends the packets staged for p if a session with p is
+// established, and initiates a handshake otherwise.
+//
+// +checklocks:e.mu
+func (e *Endpoint) sendStaged(p *peer) {
+	kp := p.current
+	if kp == nil || !kp.canSend(e.stack.Clock().NowMonotonic()) {
+		e.sendInitiation(p, false /* retry */)
+		return
+	}
+	if len(p.staged) == 0 {
+		return
+	}
+	for _, sp := range p.staged {
+		e.sendTransport(p, kp, sp)
+	}
+	p.staged = nil
+	e.keepKeyFreshSending(p)
+}
+
+// sendTransport encrypts sp with kp and sends it to p.
+//
+// +checklocks:e.mu
+func (e *Endpoint) sendTransport(p *peer, kp *keypair, sp stagedPacket) {
+	if p.endpoint.Addr.Len() == 0 {
+		return
+	}
+	plaintextLen := len(sp.data)
+	if len(sp.data) != 0 {
+		padded := (len(sp.data) + paddingMultiple - 1) &^ (paddingMultiple - 1)
+		if mtu := int(e.mtu); padded > mtu {
+			padded = max(mtu, len(sp.data))
+		}
+		plaintextLen = padded
+	}
+	msg := make([]byte, messageTransportHeaderSize, messageTransportHeaderSize+plaintextLen+kp.send.Overhead())
+	binary.LittleEndian.PutUint32(msg, messageTransportType)
+	binary.LittleEndian.PutUint32(msg[transportReceiverOffset:], kp.remoteIndex)
+	counter := kp.sendCounter
+	kp.sendCounter++
+	binary.LittleEndian.PutUint64(msg[transportCounterOffset:], counter)
+	plaintext := make([]byte, plaintextLen)
+	copy(plaintext, sp.data)
+	nonce := counterNonce(counter)
+	msg = kp.send.Seal(msg, nonce[:], plaintext, nil)
+
+	e.queueDatagram(p, msg, sp.depth+1, sp.owner)
+	p.timersAnyAuthenticatedPacketTraversal()
+	p.timersAnyAuthenticatedPacketSent()
+	if len(sp.data) != 0 {
+		p.timersDataSent()
+	}
+}
+
+// sendKeepalive sends a keepalive to p, unless packets are already staged.
+//
+// +checklocks:e.mu
+func (e *Endpoint) sendKeepalive(p *peer) {
+	if len(p.staged) == 0 {
+		p.staged = append(p.staged, stagedPacket{})
+	}
+	e.sendStaged(p)
+}
+
+// sendInitiation sends a handshake initiation to p, unless one was sent less
+// than rekeyTimeout ago. Retries are sent by the retransmission timer and
+// count towards the attempts limit.
+//
+// +checklocks:e.mu
+func (e *Endpoint) sendInitiation(p *peer, retry bool) {
+	if !retry {
+		p.handshakeAttempts = 0
+	}
+	now := e.stack.Clock().NowMonotonic()
+	if p.sentInitiation && now.Sub(p.lastSentInitiation) < rekeyTimeout {
+		return
+	}
+	if p.endpoint.Addr.Len() == 0 {
+		return
+	}
+	msg, ok := e.createInitiation(p)
+	if !ok {
+		return
+	}
+	p.lastSentInitiation = now
+	p.sentInitiation = true
+	e.queueDatagram(p, msg, 0 /* depth */, nil /* owner */)
+	p.timersAnyAuthenticatedPacketTraversal()
+	p.timersAnyAuthenticatedPacketSent()
+	p.timersHandshakeInitiated()
+}
+
+// keepKeyFreshSending initiates a new handshake with p if the current
+// keypair, which we initiated, is getting old.
+//
+// +checklocks:e.mu
+func (e *Endpoint) keepKeyFreshSending(p *peer) {
+	kp := p.current
+	if kp == nil || !kp.initiator {
+		return
+	}
+	if kp.sendCounter > rekeyAfterMessages || e.stack.Clock().NowMonotonic().Sub(kp.created) > rekeyAfterTime {
+		e.sendInitiation(p, false /* retry */)
+	}
+}
+
+// keepKeyFreshReceiving initiates a new handshake with p if the current
+// keypair, which we initiated, is about to expire, as the peer can't
+// initiate it without sending us data.
+//
+// +checklocks:e.mu
+func (e *Endpoint) keepKeyFreshReceiving(p *peer) {
+	kp := p.current
+	if kp == nil || !kp.initiator || p.sentLastMinuteHandshake {
+		return
+	}
+	if e.stack.Clock().NowMonotonic().Sub(kp.created) > rejectAfterTime-keepaliveTimeout-rekeyTimeout {
+		p.sentLastMinuteHandshake = true
+		e.sendInitiation(p, false /* retry */)
+	}
+}
+
+// underLoad records the receipt of a handshake message, and returns true if
+// handshake messages are received faster than they can be processed.
+//
+// +checklocks:e.mu
+func (e *Endpoint) underLoad() bool {
+	now := e.stack.Clock().NowMonotonic()
+	if now.Sub(e.handshakeWindowStart) >= time.Second {
+		e.handshakeWindowStart = now
+		e.handshakeCount = 0
+	}
+	e.handshakeCount++
+	if e.handshakeCount > underLoadHandshakes {
+		e.underLoadUntil = now.Add(underLoadDuration)
+	}
+	return now.Before(e.underLoadUntil)
+}
+
+// cookieSource returns the bytes identifying the source of a message, that
+// cookies are computed over.
+func cookieSource(from tcpip.FullAddress) []byte {
+	return binary.BigEndian.AppendUint16(from.Addr.AsSlice(), from.Port)
+}
+
+// handleMessage processes the message msg received from the given address.
+//
+// +checklocks:e.mu
+func (e *Endpoint) handleMessage(msg []byte, from tcpip.FullAddress) {
+	if len(msg) < 4 {
+		return
+	}
+	switch typ := binary.LittleEndian.Uint32(msg); {
+	case typ == messageInitiationType && len(msg) == messageInitiationSize:
+		if e.checkHandshake(msg, from) {
+			e.handleInitiation(msg, from)
+		}
+	case typ == messageResponseType && len(msg) == messageResponseSize:
+		if e.checkHandshake(msg, from) {
+			e.handleResponse(msg, from)
+		}
+	case typ == messageCookieReplyType && len(msg) == messageCookieReplySize:
+		e.consumeCookieReply(msg)
+	case typ == messageTransportType && len(msg) >= messageKeepaliveSize:
+		e.handleTransport(msg, from)
+	}
+}
+
+// checkHandshake checks the MACs of the handshake message msg. Under load,
+// messages without a valid mac2 are answered with a cookie reply instead of
+// being processed.
+//
+// +checklocks:e.mu
+func (e *Endpoint) checkHandshake(msg []byte, from tcpip.FullAddress) bool {
+	if !e.checkMAC1(msg) {
+		return false
+	}
+	if !e.underLoad() {
+		return true
+	}
+	src := cookieSource(from)
+	if e.checkMAC2(msg, src) {
+		return true
+	}
+	e.queueDatagramTo(from, e.createCookieReply(msg, src), 0 /* depth */, nil /* owner */)
+	return false
+}
+
+// handleInitiation answers a handshake initiation.
+//
+// +checklocks:e.mu
+func (e *Endpoint) handleInitiation(msg []byte, from tcpip.FullAddress) {
+	p := e.consumeInitiation(msg)
+	if p == nil {
+		return
+	}
+	p.endpoint = from
+	p.rxBytes += uint64(len(msg))
+	p.timersAnyAuthenticatedPacketTraversal()
+	p.timersAnyAuthenticatedPacketReceived()
+
+	resp, ok := e.createResponse(p)
+	if !ok || !e.beginSession(p) {
+		return
+	}
+	p.timersSessionDerived()
+	e.queueDatagram(p, resp, 0 /* depth */, nil /* owner */)
+	p.timersAnyAuthenticatedPacketTraversal()
+	p.timersAnyAuthenticatedPacketSent()
+}
+
+// handleResponse completes the handshake we initiated, and confirms the
+// session to the peer with a keepalive or the staged packets.
+//
+// +checklocks:e.mu
+func (e *Endpoint) handleResponse(msg []byte, from tcpip.FullAddress) {
+	p := e.consumeResponse(msg)
+	if p == nil {
+		return
+	}
+	p.endpoint = from
+	p.rxBytes += uint64(len(msg))
+	p.timersAnyAuthenticatedPacketTraversal()
+	p.timersAnyAuthenticatedPacketReceived()
+	if !e.beginSession(p) {
+		return
+	}
+	p.timersSessionDerived()
+	p.timersHandshakeComplete()
+	e.sendKeepalive(p)
+}
+
+// handleTransport decrypts a transport message, and delivers the packet it
+// carries if its source is allowed for the peer that sent it.
+//
+// +checklocks:e.mu
+func (e *Endpoint) handleTransport(msg []byte, from tcpip.FullAddress) {
+	entry, ok := e.index[binary.LittleEndian.Uint32(msg[transportReceiverOffset:])]
+	if !ok || entry.keypair == nil {
+		return
+	}
+	p, kp := entry.peer, entry.keypair
+	if e.stack.Clock().NowMonotonic().Sub(kp.created) >= rejectAfterTime {
+		return
+	}
+	counter := binary.LittleEndian.Uint64(msg[transportCounterOffset:])
+	nonce := counterNonce(counter)
+	plaintext, err := kp.recv.Open(nil, nonce[:], msg[messageTransportHeaderSize:], nil)
+	if err != nil {
+		return
+	}
+	if !kp.replay.validateCounter(counter, rejectAfterMessages) {
+		return
+	}
+
+	p.endpoint = from
+	p.rxBytes += uint64(len(msg))
+	if e.receivedWithKeypair(p, kp) {
+		p.timersHandshakeComplete()
+		e.sendStaged(p)
+	}
+	e.keepKeyFreshReceiving(p)
+	p.timersAnyAuthenticatedPacketTraversal()
+	p.timersAnyAuthenticatedPacketReceived()
+	if len(plaintext) == 0 {
+		// Keepalive.
+		return
+	}
+	p.timersDataReceived()
+
+	var (
+		protocol tcpip.NetworkProtocolNumber
+		src      tcpip.Address
+		length   int
+	)
+	switch plaintext[0] >> 4 {
+	case header.IPv4Version:
+		if len(plaintext) < header.IPv4MinimumSize {
+			return
+		}
+		h := header.IPv4(plaintext)
+		protocol, src, length = header.IPv4ProtocolNumber, h.SourceAddress(), int(h.TotalLength())
+	case header.IPv6Version:
+		if len(plaintext) < header.IPv6MinimumSize {
+			return
+		}
+		h := header.IPv6(plaintext)
+		protocol, src, length = header.IPv6ProtocolNumber, h.SourceAddress(), header.IPv6MinimumSize+int(h.PayloadLength())
+	default:
+		return
+	}
+	// The length of the packet strips the padding.
+	if length > len(plaintext) {
+		return
+	}
+	if e.allowedIPs.lookup(src) != p {
+		return
+	}
+	e.deliveries = append(e.deliveries, delivery{
+		protocol: protocol,
+		data:     plaintext[:length],
+	})
+}
@@ -0,0 +1,454 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wireguard_test
+
+import (
+	"crypto/rand"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/link/veth"
+	"gvisor.dev/gvisor/pkg/tcpip/link/wireguard"
+	"gvisor.dev/gvisor/pkg/tcpip/network/arp"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+const (
+	underlayNICID = 1
+	wgNICID       = 2
+	listenPort    = 51820
+	testPort      = 5000
+)
+
+var (
+	underlayAddrs = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom4([4]byte{10, 0, 0, 1}), PrefixLen: 24},
+		{Address: tcpip.AddrFrom4([4]byte{10, 0, 0, 2}), PrefixLen: 24},
+	}
+	underlayAddrs6 = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}), PrefixLen: 64},
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}), PrefixLen: 64},
+	}
+	innerAddrs = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom4([4]byte{192, 168, 0, 1}), PrefixLen: 24},
+		{Address: tcpip.AddrFrom4([4]byte{192, 168, 0, 2}), PrefixLen: 24},
+	}
+	innerAddrs6 = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}), PrefixLen: 64},
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}), PrefixLen: 64},
+	}
+)
+
+func protocolFor(addr tcpip.Address) tcpip.NetworkProtocolNumber {
+	if addr.Len() == header.IPv6AddressSize {
+		return ipv6.ProtocolNumber
+	}
+	return ipv4.ProtocolNumber
+}
+
+func hostSubnet(addr tcpip.Address) tcpip.Subnet {
+	return tcpip.AddressWithPrefix{Address: addr, PrefixLen: addr.BitLen()}.Subnet()
+}
+
+func addAddress(t *testing.T, s *stack.Stack, nicID tcpip.NICID, addr tcpip.AddressWithPrefix) {
+	t.Helper()
+	protocolAddr := tcpip.ProtocolAddress{
+		Protocol:          protocolFor(addr.Address),
+		AddressWithPrefix: addr,
+	}
+	if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+	}
+	s.AddRoute(tcpip.Route{
+		Destination: addr.Subnet(),
+		NIC:         nicID,
+	})
+}
+
+func newStack(t *testing.T) *stack.Stack {
+	t.Helper()
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol, arp.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+	})
+	t.Cleanup(func() {
+		s.Close()
+		s.Wait()
+	})
+	return s
+}
+
+func newKey(t *testing.T) wireguard.Key {
+	t.Helper()
+	k, err := wireguard.NewPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("NewPrivateKey: %s", err)
+	}
+	return k
+}
+
+// testNetwork is two stacks connected by a veth pair, each with a WireGuard
+// interface.
+type testNetwork struct {
+	stacks [2]*stack.Stack
+	eps    [2]*wireguard.Endpoint
+	keys   [2]wireguard.Key
+}
+
+// newTestNetwork creates a test network with the given underlay and inner
+// addresses. The WireGuard interfaces have private keys but no peers.
+func newTestNetwork(t *testing.T, underlay, inner [2]tcpip.AddressWithPrefix) *testNetwork {
+	t.Helper()
+	var n testNetwork
+	a, b := veth.NewPair(1500)
+	for i, ep := range []*veth.Endpoint{a, b} {
+		s := newStack(t)
+		if err := s.CreateNIC(underlayNICID, ethernet.New(ep)); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", underlayNICID, err)
+		}
+		addAddress(t, s, underlayNICID, underlay[i])
+
+		wg, err := wireguard.New(wireguard.Options{Stack: s, ListenPort: listenPort})
+		if err != nil {
+			t.Fatalf("New(_): %s", err)
+		}
+		n.keys[i] = newKey(t)
+		if err := wg.Configure(wireguard.Config{PrivateKey: &n.keys[i]}); err != nil {
+			t.Fatalf("Configure(_): %s", err)
+		}
+		if err := s.CreateNIC(wgNICID, wg); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", wgNICID, err)
+		}
+		addAddress(t, s, wgNICID, inner[i])
+		n.stacks[i] = s
+		n.eps[i] = wg
+	}
+	return &n
+}
+
+// addPeer configures the interface j as a peer of the interface i. If
+// endpoint isn't nil, it is the underlay address of the peer.
+func (n *testNetwork) addPeer(t *testing.T, i, j int, endpoint *tcpip.FullAddress, allowedIPs ...tcpip.Subnet) {
+	t.Helper()
+	cfg := wireguard.Config{
+		Peers: []wireguard.PeerConfig{{
+			PublicKey:  n.keys[j].PublicKey(),
+			Endpoint:   endpoint,
+			AllowedIPs: allowedIPs,
+		}},
+	}
+	if err := n.eps[i].Configure(cfg); err != nil {
+		t.Fatalf("Configure(%+v): %s", cfg, err)
+	}
+}
+
+// send sends a UDP datagram from the first stack to the second through the
+// inner addresses, and returns true if it was received.
+func send(t *testing.T, stacks [2]*stack.Stack, addrs [2]tcpip.AddressWithPrefix) bool {
+	t.Helper()
+	netProto := protocolFor(addrs[0].Address)
+	server, err := gonet.DialUDP(stacks[1], &tcpip.FullAddress{Addr: addrs[1].Address, Port: testPort}, nil, netProto)
+	if err != nil {
+		t.Fatalf("DialUDP(_, %s, nil, %d): %s", addrs[1].Address, netProto, err)
+	}
+	defer server.Close()
+	client, err := gonet.DialUDP(stacks[0], nil, &tcpip.FullAddress{Addr: addrs[1].Address, Port: testPort}, netProto)
+	if err != nil {
+		t.Fatalf("DialUDP(_, nil, %s, %d): %s", addrs[1].Address, netProto, err)
+	}
+	defer client.Close()
+
+	// The first datagrams are staged until the handshake completes, and
+	// link address resolution may drop the handshake, so keep sending
+	// until one is received.
+	want := "hello through wireguard"
+	buf := make([]byte, 100)
+	for i := 0; i < 20; i++ {
+		if _, err := client.Write([]byte(want)); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+		server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, addr, err := server.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+		if got := string(buf[:n]); got != want {
+			t.Fatalf("got payload %q, want %q", got, want)
+		}
+		src := addrs[0].Address
+		if got, want := addr.(*net.UDPAddr).IP, net.IP(src.AsSlice()); !got.Equal(want) {
+			t.Errorf("got source address %s, want %s", got, want)
+		}
+		return true
+	}
+	return false
+}
+
+func TestTunnel(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		underlay [2]tcpip.AddressWithPrefix
+		inner    [2]tcpip.AddressWithPrefix
+	}{
+		{
+			name:     "IPv4 over IPv4",
+			underlay: underlayAddrs,
+			inner:    innerAddrs,
+		},
+		{
+			name:     "IPv6 over IPv4",
+			underlay: underlayAddrs,
+			inner:    innerAddrs6,
+		},
+		{
+			name:     "IPv4 over IPv6",
+			underlay: underlayAddrs6,
+			inner:    innerAddrs,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			n := newTestNetwork(t, test.underlay, test.inner)
+			// Only the initiator knows the endpoint of its peer: the
+			// responder learns it from the handshake.
+			n.addPeer(t, 0, 1, &tcpip.FullAddress{Addr: test.underlay[1].Address, Port: listenPort}, hostSubnet(test.inner[1].Address))
+			n.addPeer(t, 1, 0, nil, hostSubnet(test.inner[0].Address))
+			if !send(t, n.stacks, test.inner) {
+				t.Fatalf("datagram to %s wasn't received", test.inner[1].Address)
+			}
+
+			info := n.eps[1].Info()
+			if len(info.Peers) != 1 {
+				t.Fatalf("got peers %+v, want 1 peer", info.Peers)
+			}
+			p := info.Peers[0]
+			if want := (tcpip.FullAddress{Addr: test.underlay[0].Address, Port: listenPort}); p.Endpoint != want {
+				t.Errorf("got peer endpoint %+v, want %+v", p.Endpoint, want)
+			}
+			if p.LastHandshake.IsZero() {
+				t.Errorf("got zero last handshake time")
+			}
+			if p.RxBytes == 0 || p.TxBytes == 0 {
+				t.Errorf("got RxBytes = %d, TxBytes = %d, want nonzero", p.RxBytes, p.TxBytes)
+			}
+		})
+	}
+}
+
+func TestRejected(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// allowed is the subnet allowed for the sender by the receiver.
+		allowed tcpip.Subnet
+		// psks are the preshared keys configured on each side.
+		psks [2]wireguard.Key
+	}{
+		{
+			name:    "source not allowed",
+			allowed: hostSubnet(tcpip.AddrFrom4([4]byte{192, 168, 0, 100})),
+		},
+		{
+			name:    "preshared key mismatch",
+			allowed: hostSubnet(innerAddrs[0].Address),
+			psks:    [2]wireguard.Key{{1}, {2}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			n := newTestNetwork(t, underlayAddrs, innerAddrs)
+			n.addPeer(t, 0, 1, &tcpip.FullAddress{Addr: underlayAddrs[1].Address, Port: listenPort}, hostSubnet(innerAddrs[1].Address))
+			n.addPeer(t, 1, 0, nil, test.allowed)
+			for i, ep := range n.eps {
+				cfg := wireguard.Config{
+					Peers: []wireguard.PeerConfig{{
+						PublicKey:    n.keys[1-i].PublicKey(),
+						UpdateOnly:   true,
+						PresharedKey: &test.psks[i],
+					}},
+				}
+				if err := ep.Configure(cfg); err != nil {
+					t.Fatalf("Configure(%+v): %s", cfg, err)
+				}
+			}
+			if send(t, n.stacks, innerAddrs) {
+				t.Fatalf("datagram to %s was received", innerAddrs[1].Address)
+			}
+		})
+	}
+}
+
+func TestNoPeer(t *testing.T) {
+	n := newTestNetwork(t, underlayAddrs, innerAddrs)
+	conn, err := gonet.DialUDP(n.stacks[0], nil, &tcpip.FullAddress{Addr: innerAddrs[1].Address, Port: testPort}, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("DialUDP: %s", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("x")); err == nil {
+		t.Errorf("Write to an address without a peer succeeded")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	s := newStack(t)
+	ep, err := wireguard.New(wireguard.Options{Stack: s})
+	if err != nil {
+		t.Fatalf("New(_): %s", err)
+	}
+	defer ep.Close()
+	if got := ep.ListenPort(); got == 0 {
+		t.Errorf("got ListenPort() = 0, want a random port")
+	}
+
+	priv := newKey(t)
+	peers := [2]wireguard.Key{newKey(t).PublicKey(), newKey(t).PublicKey()}
+	subnets := [2]tcpip.Subnet{
+		hostSubnet(innerAddrs[0].Address),
+		hostSubnet(innerAddrs[1].Address),
+	}
+	port := uint16(listenPort)
+	fwmark := uint32(7)
+	keepalive := 25 * time.Second
+	endpoint := tcpip.FullAddress{Addr: underlayAddrs[1].Address, Port: listenPort}
+	cfg := wireguard.Config{
+		PrivateKey: &priv,
+		ListenPort: &port,
+		Fwmark:     &fwmark,
+		Peers: []wireguard.PeerConfig{
+			{
+				PublicKey:           peers[0],
+				Endpoint:            &endpoint,
+				PersistentKeepalive: &keepalive,
+				AllowedIPs:          subnets[:],
+			},
+			{
+				PublicKey: peers[1],
+			},
+			{
+				// Our own public key is ignored.
+				PublicKey: priv.PublicKey(),
+			},
+			{
+				PublicKey:  newKey(t).PublicKey(),
+				UpdateOnly: true,
+			},
+		},
+	}
+	if err := ep.Configure(cfg); err != nil {
+		t.Fatalf("Configure(%+v): %s", cfg, err)
+	}
+	info := ep.Info()
+	if info.PrivateKey != priv || info.PublicKey != priv.PublicKey() {
+		t.Errorf("got keys (%s, %s), want (%s, %s)", info.PrivateKey, info.PublicKey, priv, priv.PublicKey())
+	}
+	if info.ListenPort != port || info.Fwmark != fwmark {
+		t.Errorf("got ListenPort = %d, Fwmark = %d, want %d, %d", info.ListenPort, info.Fwmark, port, fwmark)
+	}
+	if len(info.Peers) != 2 || info.Peers[0].PublicKey != peers[0] || info.Peers[1].PublicKey != peers[1] {
+		t.Fatalf("got peers %+v, want %s and %s", info.Peers, peers[0], peers[1])
+	}
+	if p := info.Peers[0]; p.Endpoint != endpoint || p.PersistentKeepalive != keepalive || len(p.AllowedIPs) != 2 {
+		t.Errorf("got peer %+v, want endpoint %+v, keepalive %s and 2 allowed IPs", p, endpoint, keepalive)
+	}
+
+	// Allowed IPs move between peers.
+	cfg = wireguard.Config{
+		Peers: []wireguard.PeerConfig{{
+			PublicKey:  peers[1],
+			AllowedIPs: subnets[1:],
+		}},
+	}
+	if err := ep.Configure(cfg); err != nil {
+		t.Fatalf("Configure(%+v): %s", cfg, err)
+	}
+	info = ep.Info()
+	if got := info.Peers[0].AllowedIPs; len(got) != 1 || got[0] != subnets[0] {
+		t.Errorf("got allowed IPs %v of the first peer, want [%s]", got, subnets[0])
+	}
+	if got := info.Peers[1].AllowedIPs; len(got) != 1 || got[0] != subnets[1] {
+		t.Errorf("got allowed IPs %v of the second peer, want [%s]", got, subnets[1])
+	}
+
+	// Peers are removed one by one, or all at once.
+	cfg = wireguard.Config{
+		Peers: []wireguard.PeerConfig{{
+			PublicKey: peers[0],
+			Remove:    true,
+		}},
+	}
+	if err := ep.Configure(cfg); err != nil {
+		t.Fatalf("Configure(%+v): %s", cfg, err)
+	}
+	if got := ep.Info().Peers; len(got) != 1 || got[0].PublicKey != peers[1] {
+		t.Errorf("got peers %+v, want %s", got, peers[1])
+	}
+	if err := ep.Configure(wireguard.Config{ReplacePeers: true}); err != nil {
+		t.Fatalf("Configure({ReplacePeers: true}): %s", err)
+	}
+	if got := ep.Info().Peers; len(got) != 0 {
+		t.Errorf("got peers %+v, want none", got)
+	}
+
+	// A zero private key removes it.
+	var zero wireguard.Key
+	if err := ep.Configure(wireguard.Config{PrivateKey: &zero}); err != nil {
+		t.Fatalf("Configure(_): %s", err)
+	}
+	if info := ep.Info(); !info.PrivateKey.IsZero() || !info.PublicKey.IsZero() {
+		t.Errorf("got keys (%s, %s), want none", info.PrivateKey, info.PublicKey)
+	}
+
+	// A peer must have a public key.
+	cfg = wireguard.Config{Peers: []wireguard.PeerConfig{{}}}
+	if err := ep.Configure(cfg); err == nil {
+		t.Errorf("Configure(%+v) succeeded", cfg)
+	}
+}
+
+func TestListenPortInUse(t *testing.T) {
+	s := newStack(t)
+	ep, err := wireguard.New(wireguard.Options{Stack: s, ListenPort: listenPort})
+	if err != nil {
+		t.Fatalf("New(_): %s", err)
+	}
+	defer ep.Close()
+	if _, err := wireguard.New(wireguard.Options{Stack: s, ListenPort: listenPort}); err == nil {
+		t.Fatalf("New(_) with a port in use succeeded")
+	}
+	port := uint16(listenPort + 1)
+	if err := ep.Configure(wireguard.Config{ListenPort: &port}); err != nil {
+		t.Fatalf("Configure(_): %s", err)
+	}
+	ep2, err := wireguard.New(wireguard.Options{Stack: s, ListenPort: listenPort})
+	if err != nil {
+		t.Fatalf("New(_) with a released port: %s", err)
+	}
+	ep2.Close()
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
@@ -294,6 +294,7 @@ func (f *Fragmentation) releaseReassemblersLocked() {
 
 // PacketFragmenter is the book-keeping struct for packet fragmentation.
 type PacketFragmenter struct {
+	pkt                *stack.PacketBuffer
 	transportHeader    []byte
 	data               buffer.Buffer
 	reserve            int
@@ -327,6 +328,7 @@ func MakePacketFragmenter(pkt *stack.PacketBuffer, fragmentPayloadLen uint32, re
 	fragmentCount := (uint32(fragmentableData.Size()) + fragmentPayloadLen - 1) / fragmentPayloadLen
 
 	return PacketFragmenter{
+		pkt:                pkt,
 		data:               fragmentableData,
 		reserve:            reserve,
 		fragmentPayloadLen: int(fragmentPayloadLen),
@@ -342,7 +344,9 @@ func MakePacketFragmenter(pkt *stack.PacketBuffer, fragmentPayloadLen uint32, re
 //
 // Note that the returned packet will not have its network and link headers
 // populated, but space for them will be reserved. The transport header will be
-// stored in the packet's data.
+// stored in the packet's data. The mark and transmit time of the original
+// packet are copied to every fragment, and its requested transmit timestamps
+// are moved to the first one.
 func (pf *PacketFragmenter) BuildNextFragment() (*stack.PacketBuffer, int, int, bool) {
 	if pf.currentFragment >= pf.fragmentCount {
 		panic("BuildNextFragment should not be called again after the last fragment was returned")
@@ -351,6 +355,11 @@ func (pf *PacketFragmenter) BuildNextFragment() (*stack.PacketBuffer, int, int,
 	fragPkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
 		ReserveHeaderBytes: pf.reserve,
 	})
+	fragPkt.Mark = pf.pkt.Mark
+	fragPkt.TXTime = pf.pkt.TXTime
+	if pf.currentFragment == 0 {
+		pf.pkt.TransferTXTimestamps(fragPkt)
+	}
 
 	// Copy data for the fragment.
 	copied := fragPkt.Data().ReadFrom(&pf.data, pf.fragmentPayloadLen)
@@ -15,8 +15,10 @@
 package ip
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
+	"slices"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/sync"
@@ -108,9 +110,24 @@ const (
 //
 // +stateify savable
 type multicastGroupState struct {
-	// joins is the number of times the group has been joined.
+	// joins is the number of times the group has been joined in EXCLUDE mode.
+	//
+	// Joining a group without specifying sources is an EXCLUDE mode join with
+	// an empty source list.
 	joins uint64
 
+	// includeJoins is the number of times the group has been joined in INCLUDE
+	// mode.
+	includeJoins uint64
+
+	// excludeSources holds, for each source, the number of EXCLUDE mode joins
+	// that exclude it.
+	excludeSources map[tcpip.Address]uint64
+
+	// includeSources holds, for each source, the number of INCLUDE mode joins
+	// that include it.
+	includeSources map[tcpip.Address]uint64
+
 	// transmissionLeft is the number of transmissions left to send.
 	transmissionLeft uint8
 
@@ -156,6 +173,159 @@ func (m *multicastGroupState) clearQueriedIncludeSources() {
 	}
 }
 
+// joined returns true if the group has been joined at least once.
+func (m *multicastGroupState) joined() bool {
+	return m.joins != 0 || m.includeJoins != 0
+}
+
+// addFilter records a join with the specified filter.
+func (m *multicastGroupState) addFilter(f tcpip.MulticastSourceFilter) {
+	if !f.Joined() {
+		return
+	}
+	joins, sources := &m.includeJoins, m.includeSources
+	if f.Exclude {
+		joins, sources = &m.joins, m.excludeSources
+	}
+	*joins++
+	for _, source := range f.Sources {
+		sources[source]++
+	}
+}
+
+// removeFilter removes a join previously recorded with addFilter.
+func (m *multicastGroupState) removeFilter(f tcpip.MulticastSourceFilter) {
+	if !f.Joined() {
+		return
+	}
+	joins, sources := &m.includeJoins, m.includeSources
+	if f.Exclude {
+		joins, sources = &m.joins, m.excludeSources
+	}
+	*joins--
+	for _, source := range f.Sources {
+		if sources[source]--; sources[source] == 0 {
+			delete(sources, source)
+		}
+	}
+}
+
+// filter returns the group's interface state, merged from every join as
+// described in RFC 3376 section 3.2 and RFC 3810 section 4.2.
+//
+// The returned sources are sorted.
+func (m *multicastGroupState) filter() tcpip.MulticastSourceFilter {
+	var f tcpip.MulticastSourceFilter
+	if m.joins != 0 {
+		// The interface is in EXCLUDE mode and excludes the sources that are
+		// excluded by every EXCLUDE mode join and included by none of the INCLUDE
+		// mode joins.
+		f.Exclude = true
+		for source, count := range m.excludeSources {
+			if count == m.joins && m.includeSources[source] == 0 {
+				f.Sources = append(f.Sources, source)
+			}
+		}
+	} else {
+		for source := range m.includeSources {
+			f.Sources = append(f.Sources, source)
+		}
+	}
+	sortAddresses(f.Sources)
+	return f
+}
+
+// queriedSourcesRecord returns the Current-State Record to send in response to
+// a Group-and-Source-Specific Query for the sources in
+// m.queriedIncludeSources.
+//
+// As per RFC 3376 section 5.2 and RFC 3810 section 6.3, the record is an
+// IS_IN record that holds the queried sources that the interface listens to.
+//
+// Returns false if no record should be sent.
+func (m *multicastGroupState) queriedSourcesRecord() (v2ReportRecord, bool) {
+	f := m.filter()
+	record := v2ReportRecord{recordType: MulticastGroupProtocolV2ReportRecordModeIsInclude}
+	for source := range m.queriedIncludeSources {
+		if f.Allows(source) {
+			record.sources = append(record.sources, source)
+		}
+	}
+	sortAddresses(record.sources)
+	return record, len(record.sources) != 0
+}
+
+// sortAddresses sorts addrs so that reports are deterministic.
+func sortAddresses(addrs []tcpip.Address) {
+	slices.SortFunc(addrs, func(a, b tcpip.Address) int {
+		return bytes.Compare(a.AsSlice(), b.AsSlice())
+	})
+}
+
+// v2ReportRecord is a multicast address record to add to a V2 report.
+type v2ReportRecord struct {
+	recordType MulticastGroupProtocolV2ReportRecordType
+	sources    []tcpip.Address
+}
+
+// currentStateRecord returns the Current-State Record describing f.
+func currentStateRecord(f tcpip.MulticastSourceFilter) v2ReportRecord {
+	if f.Exclude {
+		return v2ReportRecord{recordType: MulticastGroupProtocolV2ReportRecordModeIsExclude, sources: f.Sources}
+	}
+	return v2ReportRecord{recordType: MulticastGroupProtocolV2ReportRecordModeIsInclude, sources: f.Sources}
+}
+
+// filterModeChangeRecord returns the Filter-Mode-Change Record that moves a
+// router's view of the group to f.
+func filterModeChangeRecord(f tcpip.MulticastSourceFilter) v2ReportRecord {
+	if f.Exclude {
+		return v2ReportRecord{recordType: MulticastGroupProtocolV2ReportRecordChangeToExcludeMode, sources: f.Sources}
+	}
+	return v2ReportRecord{recordType: MulticastGroupProtocolV2ReportRecordChangeToIncludeMode, sources: f.Sources}
+}
+
+// stateChangeRecords returns the records to send when the interface state of
+// a group changes from oldFilter to newFilter, as per the table in RFC 3376
+// section 5.1 and RFC 3810 section 6.1:
+//
+//	Old State         New State         State-Change Record Sent
+//	---------         ---------         ------------------------
+//	INCLUDE (A)       INCLUDE (B)       ALLOW (B-A), BLOCK (A-B)
+//	EXCLUDE (A)       EXCLUDE (B)       ALLOW (A-B), BLOCK (B-A)
+//	INCLUDE (A)       EXCLUDE (B)       TO_EX (B)
+//	EXCLUDE (A)       INCLUDE (B)       TO_IN (B)
+func stateChangeRecords(oldFilter, newFilter tcpip.MulticastSourceFilter) []v2ReportRecord {
+	if oldFilter.Exclude != newFilter.Exclude {
+		return []v2ReportRecord{filterModeChangeRecord(newFilter)}
+	}
+
+	added, removed := addressDifference(newFilter.Sources, oldFilter.Sources), addressDifference(oldFilter.Sources, newFilter.Sources)
+	if newFilter.Exclude {
+		added, removed = removed, added
+	}
+
+	var records []v2ReportRecord
+	if len(added) != 0 {
+		records = append(records, v2ReportRecord{recordType: MulticastGroupProtocolV2ReportRecordAllowNewSources, sources: added})
+	}
+	if len(removed) != 0 {
+		records = append(records, v2ReportRecord{recordType: MulticastGroupProtocolV2ReportRecordBlockOldSources, sources: removed})
+	}
+	return records
+}
+
+// addressDifference returns the addresses in a that are not in b.
+func addressDifference(a, b []tcpip.Address) []tcpip.Address {
+	var diff []tcpip.Address
+	for _, addr := range a {
+		if !slices.Contains(b, addr) {
+			diff = append(diff, addr)
+		}
+	}
+	return diff
+}
+
 // GenericMulticastProtocolOptions holds options for the generic multicast
 // protocol.
 //
@@ -196,8 +366,8 @@ const (
 
 // MulticastGroupProtocolV2ReportBuilder is a builder for a V2 report.
 type MulticastGroupProtocolV2ReportBuilder interface {
-	// AddRecord adds a record to the report.
-	AddRecord(recordType MulticastGroupProtocolV2ReportRecordType, groupAddress tcpip.Address)
+	// AddRecord adds a record with the specified sources to the report.
+	AddRecord(recordType MulticastGroupProtocolV2ReportRecordType, groupAddress tcpip.Address, sources []tcpip.Address)
 
 	// Send sends the report.
 	//
@@ -406,6 +576,7 @@ func (g *GenericMulticastProtocolState) MakeAllNonMemberLocked() {
 			v2ReportBuilder.AddRecord(
 				MulticastGroupProtocolV2ReportRecordChangeToIncludeMode,
 				groupAddress,
+				nil, /* sources */
 			)
 		}
 	case protocolModeV1Compatibility:
@@ -502,7 +673,7 @@ func (g *GenericMulticastProtocolState) SendQueuedReportsLocked() {
 		if info.delayedReportJobFiresAt.IsZero() {
 			switch g.mode {
 			case protocolModeV2:
-				g.sendV2ReportAndMaybeScheduleChangedTimer(groupAddress, &info, MulticastGroupProtocolV2ReportRecordChangeToExcludeMode)
+				g.sendV2ReportAndMaybeScheduleChangedTimer(groupAddress, &info, filterModeChangeRecord(info.filter()))
 			case protocolModeV1Compatibility, protocolModeV1:
 				g.maybeSendReportLocked(groupAddress, &info)
 			default:
@@ -518,57 +689,123 @@ func (g *GenericMulticastProtocolState) SendQueuedReportsLocked() {
 //
 // Precondition: g.protocolMU must be locked.
 func (g *GenericMulticastProtocolState) JoinGroupLocked(groupAddress tcpip.Address) {
-	info, ok := g.memberships[groupAddress]
-	if ok {
-		info.joins++
-		if info.joins > 1 {
-			// The group has already been joined.
+	g.UpdateGroupFilterLocked(groupAddress, tcpip.MulticastSourceFilter{}, tcpip.MulticastSourceFilter{Exclude: true})
+}
+
+// newMulticastGroupStateLocked returns the state for a group that has never
+// been joined.
+//
+// Precondition: g.protocolMU must be locked.
+func (g *GenericMulticastProtocolState) newMulticastGroupStateLocked(groupAddress tcpip.Address) multicastGroupState {
+	return multicastGroupState{
+		lastToSendReport: false,
+		delayedReportJob: tcpip.NewJob(g.opts.Clock, g.protocolMU, func() {
+			if !g.opts.Protocol.Enabled() {
+				panic(fmt.Sprintf("delayed report job fired for group %s while the multicast group protocol is disabled", groupAddress))
+			}
+
+			info, ok := g.memberships[groupAddress]
+			if !ok {
+				panic(fmt.Sprintf("expected to find group state for group = %s", groupAddress))
+			}
+
+			info.delayedReportJobFiresAt = time.Time{}
+
+			switch g.mode {
+			case protocolModeV2:
+				reportBuilder := g.opts.Protocol.NewReportV2Builder()
+				if len(info.queriedIncludeSources) == 0 {
+					record := currentStateRecord(info.filter())
+					reportBuilder.AddRecord(record.recordType, groupAddress, record.sources)
+				} else if record, ok := info.queriedSourcesRecord(); ok {
+					reportBuilder.AddRecord(record.recordType, groupAddress, record.sources)
+				}
+				// Nothing meaningful we can do with the error here - we only try to
+				// send a delayed report once.
+				_, _ = reportBuilder.Send()
+			case protocolModeV1Compatibility, protocolModeV1:
+				g.maybeSendReportLocked(groupAddress, &info)
+			default:
+				panic(fmt.Sprintf("unrecognized mode = %d", g.mode))
+			}
+
+			info.clearQueriedIncludeSources()
 			g.memberships[groupAddress] = info
+		}),
+		queriedIncludeSources: make(map[tcpip.Address]struct{}),
+		excludeSources:        make(map[tcpip.Address]uint64),
+		includeSources:        make(map[tcpip.Address]uint64),
+	}
+}
+
+// UpdateGroupFilterLocked handles a join of the group changing its source
+// filter from oldFilter to newFilter.
+//
+// A filter that is not joined stands for the absence of a join so the group is
+// joined when oldFilter is not joined, and left when newFilter is not joined.
+//
+// Precondition: g.protocolMU must be locked.
+func (g *GenericMulticastProtocolState) UpdateGroupFilterLocked(groupAddress tcpip.Address, oldFilter, newFilter tcpip.MulticastSourceFilter) {
+	info, ok := g.memberships[groupAddress]
+	if !ok {
+		if !newFilter.Joined() {
 			return
 		}
-	} else {
-		info = multicastGroupState{
-			// Since we just joined the group, its count is 1.
-			joins:            1,
-			lastToSendReport: false,
-			delayedReportJob: tcpip.NewJob(g.opts.Clock, g.protocolMU, func() {
-				if !g.opts.Protocol.Enabled() {
-					panic(fmt.Sprintf("delayed report job fired for group %s while the multicast group protocol is disabled", groupAddress))
-				}
+		info = g.newMulticastGroupStateLocked(groupAddress)
+	}
 
-				info, ok := g.memberships[groupAddress]
-				if !ok {
-					panic(fmt.Sprintf("expected to find group state for group = %s", groupAddress))
-				}
+	wasJoined := info.joined()
+	oldInterfaceFilter := info.filter()
+	info.removeFilter(oldFilter)
+	info.addFilter(newFilter)
 
-				info.delayedReportJobFiresAt = time.Time{}
-
-				switch g.mode {
-				case protocolModeV2:
-					reportBuilder := g.opts.Protocol.NewReportV2Builder()
-					reportBuilder.AddRecord(MulticastGroupProtocolV2ReportRecordModeIsExclude, groupAddress)
-					// Nothing meaningful we can do with the error here - we only try to
-					// send a delayed report once.
-					_, _ = reportBuilder.Send()
-				case protocolModeV1Compatibility, protocolModeV1:
-					g.maybeSendReportLocked(groupAddress, &info)
-				default:
-					panic(fmt.Sprintf("unrecognized mode = %d", g.mode))
-				}
+	switch {
+	case !wasJoined && !info.joined():
+		if ok {
+			g.memberships[groupAddress] = info
+		}
+	case !wasJoined:
+		info.deleteScheduled = false
+		info.clearQueriedIncludeSources()
+		info.delayedReportJobFiresAt = time.Time{}
+		info.lastToSendReport = false
+		g.initializeNewMemberLocked(groupAddress, &info, nil /* callersV2ReportBuilder */)
+		g.memberships[groupAddress] = info
+	case !info.joined():
+		g.leaveGroupLocked(groupAddress, &info, oldInterfaceFilter)
+	default:
+		g.memberships[groupAddress] = info
+
+		// MulticastGroupProtocolv1 has no way to report sources so source changes
+		// are only reported in V2 mode.
+		if g.mode != protocolModeV2 || !g.shouldPerformForGroup(groupAddress) {
+			return
+		}
 
-				info.clearQueriedIncludeSources()
-				g.memberships[groupAddress] = info
-			}),
-			queriedIncludeSources: make(map[tcpip.Address]struct{}),
+		records := stateChangeRecords(oldInterfaceFilter, info.filter())
+		if len(records) == 0 {
+			return
 		}
+
+		// As per RFC 3376 section 5.1 and RFC 3810 section 6.1, the State-Change
+		// Report is retransmitted [Robustness Variable] - 1 more times.
+		info.transmissionLeft = g.robustnessVariable
+		g.sendV2ReportAndMaybeScheduleChangedTimer(groupAddress, &info, records...)
+		g.memberships[groupAddress] = info
 	}
+}
 
-	info.deleteScheduled = false
-	info.clearQueriedIncludeSources()
-	info.delayedReportJobFiresAt = time.Time{}
-	info.lastToSendReport = false
-	g.initializeNewMemberLocked(groupAddress, &info, nil /* callersV2ReportBuilder */)
-	g.memberships[groupAddress] = info
+// GroupFilterRLocked returns the interface state of the group.
+//
+// Returns false if the group is not locally joined.
+//
+// Precondition: g.protocolMU must be read locked.
+func (g *GenericMulticastProtocolState) GroupFilterRLocked(groupAddress tcpip.Address) (tcpip.MulticastSourceFilter, bool) {
+	info, ok := g.memberships[groupAddress]
+	if !ok || info.deleteScheduled {
+		return tcpip.MulticastSourceFilter{}, false
+	}
+	return info.filter(), true
 }
 
 // IsLocallyJoinedRLocked returns true if the group is locally joined.
@@ -582,7 +819,7 @@ func (g *GenericMulticastProtocolState) IsLocallyJoinedRLocked(groupAddress tcpi
 func (g *GenericMulticastProtocolState) sendV2ReportAndMaybeScheduleChangedTimer(
 	groupAddress tcpip.Address,
 	info *multicastGroupState,
-	recordType MulticastGroupProtocolV2ReportRecordType,
+	records ...v2ReportRecord,
 ) bool {
 	if info.transmissionLeft == 0 {
 		return false
@@ -592,7 +829,9 @@ func (g *GenericMulticastProtocolState) sendV2ReportAndMaybeScheduleChangedTimer
 
 	// Send a report immediately to announce us leaving the group.
 	reportBuilder := g.opts.Protocol.NewReportV2Builder()
-	reportBuilder.AddRecord(recordType, groupAddress)
+	for _, record := range records {
+		reportBuilder.AddRecord(record.recordType, groupAddress, record.sources)
+	}
 	if sent, err := reportBuilder.Send(); sent && err == nil {
 		info.transmissionLeft--
 
@@ -631,11 +870,12 @@ func (g *GenericMulticastProtocolState) scheduleStateChangedTimer() {
 				info.transmissionLeft--
 				nonEmptyReport = true
 
-				mode := MulticastGroupProtocolV2ReportRecordChangeToExcludeMode
-				if info.deleteScheduled {
-					mode = MulticastGroupProtocolV2ReportRecordChangeToIncludeMode
-				}
-				reportBuilder.AddRecord(mode, groupAddress)
+				// Retransmissions carry the current state of the group so that
+				// they stay accurate when the state changes while transmissions
+				// are pending. A group that is scheduled to be deleted is in
+				// INCLUDE mode with no sources.
+				record := filterModeChangeRecord(info.filter())
+				reportBuilder.AddRecord(record.recordType, groupAddress, record.sources)
 
 				if info.deleteScheduled && info.transmissionLeft == 0 {
 					// No more transmissions left so we can actually delete the
@@ -673,37 +913,39 @@ func (g *GenericMulticastProtocolState) LeaveGroupLocked(groupAddress tcpip.Addr
 		return false
 	}
 
-	info.joins--
-	if info.joins != 0 {
-		// If we still have outstanding joins, then do nothing further.
-		g.memberships[groupAddress] = info
-		return true
-	}
+	g.UpdateGroupFilterLocked(groupAddress, tcpip.MulticastSourceFilter{Exclude: true}, tcpip.MulticastSourceFilter{})
+	return true
+}
 
+// leaveGroupLocked handles the last join of the group going away.
+//
+// oldInterfaceFilter is the interface state of the group before the last
+// join went away.
+//
+// Precondition: g.protocolMU must be locked.
+func (g *GenericMulticastProtocolState) leaveGroupLocked(groupAddress tcpip.Address, info *multicastGroupState, oldInterfaceFilter tcpip.MulticastSourceFilter) {
 	info.deleteScheduled = true
 	info.cancelDelayedReportJob()
 
 	if !g.shouldPerformForGroup(groupAddress) {
 		delete(g.memberships, groupAddress)
-		return true
+		return
 	}
 
 	switch g.mode {
 	case protocolModeV2:
 		info.transmissionLeft = g.robustnessVariable
-		if g.sendV2ReportAndMaybeScheduleChangedTimer(groupAddress, &info, MulticastGroupProtocolV2ReportRecordChangeToIncludeMode) {
-			g.memberships[groupAddress] = info
+		if g.sendV2ReportAndMaybeScheduleChangedTimer(groupAddress, info, stateChangeRecords(oldInterfaceFilter, tcpip.MulticastSourceFilter{})...) {
+			g.memberships[groupAddress] = *info
 		} else {
 			delete(g.memberships, groupAddress)
 		}
 	case protocolModeV1Compatibility, protocolModeV1:
-		g.transitionToNonMemberLocked(groupAddress, &info)
+		g.transitionToNonMemberLocked(groupAddress, info)
 		delete(g.memberships, groupAddress)
 	default:
 		panic(fmt.Sprintf("unrecognized mode = %d", g.mode))
 	}
-
-	return true
 }
 
 // HandleQueryV2Locked handles a V2 query.
@@ -848,13 +1090,8 @@ func (g *GenericMulticastProtocolState) HandleQueryV2Locked(groupAddress tcpip.A
 
 					// A MODE_IS_EXCLUDE record without any sources indicates that we are
 					// interested in traffic from all sources for the group.
-					//
-					// We currently only hold groups if we have an active interest in the
-					// group.
-					reportBuilder.AddRecord(
-						MulticastGroupProtocolV2ReportRecordModeIsExclude,
-						groupAddress,
-					)
+					record := currentStateRecord(info.filter())
+					reportBuilder.AddRecord(record.recordType, groupAddress, record.sources)
 				}
 
 				_, _ = reportBuilder.Send()
@@ -1012,10 +1249,13 @@ func (g *GenericMulticastProtocolState) initializeNewMemberLocked(groupAddress t
 	switch g.mode {
 	case protocolModeV2:
 		info.transmissionLeft = g.robustnessVariable
+		records := stateChangeRecords(tcpip.MulticastSourceFilter{}, info.filter())
 		if callersV2ReportBuilder == nil {
-			g.sendV2ReportAndMaybeScheduleChangedTimer(groupAddress, info, MulticastGroupProtocolV2ReportRecordChangeToExcludeMode)
+			g.sendV2ReportAndMaybeScheduleChangedTimer(groupAddress, info, records...)
 		} else {
-			callersV2ReportBuilder.AddRecord(MulticastGroupProtocolV2ReportRecordChangeToExcludeMode, groupAddress)
+			for _, record := range records {
+				callersV2ReportBuilder.AddRecord(record.recordType, groupAddress, record.sources)
+			}
 			info.transmissionLeft--
 		}
 	case protocolModeV1Compatibility, protocolModeV1:
@@ -41,7 +41,7 @@ type mockMulticastGroupProtocolProtectedFields struct {
 	sendLeaveGroupAddrCount  map[tcpip.Address]int
 	makeQueuePackets         bool
 	disabled                 bool
-	sentV2Reports            map[tcpip.Address][]ip.MulticastGroupProtocolV2ReportRecordType
+	sentV2Reports            map[tcpip.Address][]mockReportV2Record
 }
 
 type mockMulticastGroupProtocol struct {
@@ -67,7 +67,7 @@ func (m *mockMulticastGroupProtocol) init(opts ip.GenericMulticastProtocolOption
 func (m *mockMulticastGroupProtocol) initLocked() {
 	m.mu.sendReportGroupAddrCount = make(map[tcpip.Address]int)
 	m.mu.sendLeaveGroupAddrCount = make(map[tcpip.Address]int)
-	m.mu.sentV2Reports = make(map[tcpip.Address][]ip.MulticastGroupProtocolV2ReportRecordType)
+	m.mu.sentV2Reports = make(map[tcpip.Address][]mockReportV2Record)
 }
 
 func (m *mockMulticastGroupProtocol) setEnabled(v bool) {
@@ -106,6 +106,12 @@ func (m *mockMulticastGroupProtocol) leaveGroup(addr tcpip.Address) bool {
 	return m.mu.genericMulticastGroup.LeaveGroupLocked(addr)
 }
 
+func (m *mockMulticastGroupProtocol) updateGroupFilter(addr tcpip.Address, oldFilter, newFilter tcpip.MulticastSourceFilter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mu.genericMulticastGroup.UpdateGroupFilterLocked(addr, oldFilter, newFilter)
+}
+
 func (m *mockMulticastGroupProtocol) handleReport(addr tcpip.Address) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -202,6 +208,7 @@ func (m *mockMulticastGroupProtocol) ShouldPerformProtocol(groupAddress tcpip.Ad
 type mockReportV2Record struct {
 	recordType   ip.MulticastGroupProtocolV2ReportRecordType
 	groupAddress tcpip.Address
+	sources      []tcpip.Address
 }
 
 type mockReportV2 struct {
@@ -214,13 +221,13 @@ type mockReportV2Builder struct {
 }
 
 // AddRecord implements ip.MulticastGroupProtocolV2ReportBuilder.
-func (b *mockReportV2Builder) AddRecord(recordType ip.MulticastGroupProtocolV2ReportRecordType, groupAddress tcpip.Address) {
-	b.report.records = append(b.report.records, mockReportV2Record{recordType: recordType, groupAddress: groupAddress})
+func (b *mockReportV2Builder) AddRecord(recordType ip.MulticastGroupProtocolV2ReportRecordType, groupAddress tcpip.Address, sources []tcpip.Address) {
+	b.report.records = append(b.report.records, mockReportV2Record{recordType: recordType, groupAddress: groupAddress, sources: sources})
 }
 
-func recordsToMap(m map[tcpip.Address][]ip.MulticastGroupProtocolV2ReportRecordType, records []mockReportV2Record) {
+func recordsToMap(m map[tcpip.Address][]mockReportV2Record, records []mockReportV2Record) {
 	for _, record := range records {
-		m[record.groupAddress] = append(m[record.groupAddress], record.recordType)
+		m[record.groupAddress] = append(m[record.groupAddress], record)
 	}
 }
 
@@ -274,7 +281,7 @@ func (m *mockMulticastGroupProtocol) check(fields checkFields) string {
 		sendLeaveGroupAddrCount[a] = 1
 	}
 
-	sentV2Reports := make(map[tcpip.Address][]ip.MulticastGroupProtocolV2ReportRecordType)
+	sentV2Reports := make(map[tcpip.Address][]mockReportV2Record)
 	for _, report := range fields.sentV2Reports {
 		recordsToMap(sentV2Reports, report.records)
 	}
@@ -1152,6 +1159,164 @@ func TestJoinCount(t *testing.T) {
 	}
 }
 
+func TestUpdateGroupFilter(t *testing.T) {
+	const maxRespCode = 1
+
+	src1 := tcpip.AddrFrom4([4]byte{10, 0, 0, 1})
+	src2 := tcpip.AddrFrom4([4]byte{10, 0, 0, 2})
+	src3 := tcpip.AddrFrom4([4]byte{10, 0, 0, 3})
+
+	include1 := tcpip.MulticastSourceFilter{Sources: []tcpip.Address{src1}}
+	include2 := tcpip.MulticastSourceFilter{Sources: []tcpip.Address{src2}}
+	exclude13 := tcpip.MulticastSourceFilter{Exclude: true, Sources: []tcpip.Address{src1, src3}}
+
+	report := func(records ...mockReportV2Record) checkFields {
+		for i := range records {
+			records[i].groupAddress = addr1
+		}
+		return checkFields{sentV2Reports: []mockReportV2{{records: records}}}
+	}
+
+	mgp := mockMulticastGroupProtocol{t: t}
+	clock := faketime.NewManualClock()
+	mgp.init(ip.GenericMulticastProtocolOptions{
+		Rand:                      rand.New(rand.NewSource(4)),
+		Clock:                     clock,
+		MaxUnsolicitedReportDelay: maxUnsolicitedReportDelay,
+	}, false /* v1Compatibility */)
+
+	steps := []struct {
+		name              string
+		update            func()
+		want              checkFields
+		wantRetransmit    checkFields
+		wantLocallyJoined bool
+	}{
+		{
+			name: "Join INCLUDE (src1)",
+			update: func() {
+				mgp.updateGroupFilter(addr1, tcpip.MulticastSourceFilter{}, include1)
+			},
+			want: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordAllowNewSources,
+				sources:    []tcpip.Address{src1},
+			}),
+			wantRetransmit: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordChangeToIncludeMode,
+				sources:    []tcpip.Address{src1},
+			}),
+			wantLocallyJoined: true,
+		},
+		{
+			name: "Join INCLUDE (src2)",
+			update: func() {
+				mgp.updateGroupFilter(addr1, tcpip.MulticastSourceFilter{}, include2)
+			},
+			want: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordAllowNewSources,
+				sources:    []tcpip.Address{src2},
+			}),
+			wantRetransmit: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordChangeToIncludeMode,
+				sources:    []tcpip.Address{src1, src2},
+			}),
+			wantLocallyJoined: true,
+		},
+		{
+			name: "Join EXCLUDE (src1, src3)",
+			update: func() {
+				mgp.updateGroupFilter(addr1, tcpip.MulticastSourceFilter{}, exclude13)
+			},
+			// src1 is included by another join so only src3 is excluded.
+			want: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordChangeToExcludeMode,
+				sources:    []tcpip.Address{src3},
+			}),
+			wantRetransmit: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordChangeToExcludeMode,
+				sources:    []tcpip.Address{src3},
+			}),
+			wantLocallyJoined: true,
+		},
+		{
+			name: "Leave EXCLUDE (src1, src3)",
+			update: func() {
+				mgp.updateGroupFilter(addr1, exclude13, tcpip.MulticastSourceFilter{})
+			},
+			want: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordChangeToIncludeMode,
+				sources:    []tcpip.Address{src1, src2},
+			}),
+			wantRetransmit: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordChangeToIncludeMode,
+				sources:    []tcpip.Address{src1, src2},
+			}),
+			wantLocallyJoined: true,
+		},
+		{
+			name: "Leave INCLUDE (src1)",
+			update: func() {
+				mgp.updateGroupFilter(addr1, include1, tcpip.MulticastSourceFilter{})
+			},
+			want: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordBlockOldSources,
+				sources:    []tcpip.Address{src1},
+			}),
+			wantRetransmit: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordChangeToIncludeMode,
+				sources:    []tcpip.Address{src2},
+			}),
+			wantLocallyJoined: true,
+		},
+		{
+			name: "Leave INCLUDE (src2)",
+			update: func() {
+				mgp.updateGroupFilter(addr1, include2, tcpip.MulticastSourceFilter{})
+			},
+			want: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordBlockOldSources,
+				sources:    []tcpip.Address{src2},
+			}),
+			wantRetransmit: report(mockReportV2Record{
+				recordType: ip.MulticastGroupProtocolV2ReportRecordChangeToIncludeMode,
+			}),
+			wantLocallyJoined: false,
+		},
+	}
+
+	for _, step := range steps {
+		step.update()
+		if diff := mgp.check(step.want); diff != "" {
+			t.Fatalf("%s: mockMulticastGroupProtocol mismatch (-want +got):\n%s", step.name, diff)
+		}
+		if got := mgp.isLocallyJoined(addr1); got != step.wantLocallyJoined {
+			t.Fatalf("%s: got mgp.isLocallyJoined(%s) = %t, want = %t", step.name, addr1, got, step.wantLocallyJoined)
+		}
+		clock.Advance(maxUnsolicitedReportDelay)
+		if diff := mgp.check(step.wantRetransmit); diff != "" {
+			t.Fatalf("%s: retransmission mismatch (-want +got):\n%s", step.name, diff)
+		}
+	}
+
+	// A Group-and-Source-Specific Query should be answered with the queried
+	// sources that the interface listens to.
+	mgp.updateGroupFilter(addr1, tcpip.MulticastSourceFilter{}, exclude13)
+	clock.Advance(time.Hour)
+	mgp.check(checkFields{})
+	var sources bytes.Buffer
+	for _, src := range []tcpip.Address{src1, src2, src3} {
+		sources.Write(src.AsSlice())
+	}
+	mgp.handleQueryV2(addr1, maxRespCode, header.MakeAddressIterator(addr1.Len(), &sources), 0 /* robustnessVariable */, 0 /* queryInterval */)
+	clock.Advance(time.Hour)
+	if diff := mgp.check(report(mockReportV2Record{
+		recordType: ip.MulticastGroupProtocolV2ReportRecordModeIsInclude,
+		sources:    []tcpip.Address{src2},
+	})); diff != "" {
+		t.Errorf("mockMulticastGroupProtocol mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestMakeAllNonMemberAndInitialize(t *testing.T) {
 	const unsolicitedTransmissionCount = 2
 
@@ -185,7 +185,7 @@ type igmpv3ReportBuilder struct {
 }
 
 // AddRecord implements ip.MulticastGroupProtocolV2ReportBuilder.
-func (b *igmpv3ReportBuilder) AddRecord(genericRecordType ip.MulticastGroupProtocolV2ReportRecordType, groupAddress tcpip.Address) {
+func (b *igmpv3ReportBuilder) AddRecord(genericRecordType ip.MulticastGroupProtocolV2ReportRecordType, groupAddress tcpip.Address, sources []tcpip.Address) {
 	var recordType header.IGMPv3ReportRecordType
 	switch genericRecordType {
 	case ip.MulticastGroupProtocolV2ReportRecordModeIsInclude:
@@ -207,7 +207,7 @@ func (b *igmpv3ReportBuilder) AddRecord(genericRecordType ip.MulticastGroupProto
 	b.records = append(b.records, header.IGMPv3ReportGroupAddressRecordSerializer{
 		RecordType:   recordType,
 		GroupAddress: groupAddress,
-		Sources:      nil,
+		Sources:      sources,
 	})
 }
 
@@ -561,6 +561,14 @@ func (igmp *igmpState) joinGroup(groupAddress tcpip.Address) {
 	igmp.genericMulticastProtocol.JoinGroupLocked(groupAddress)
 }
 
+// updateGroupFilter handles a join of the group changing its source filter,
+// sending IGMPv3 state change reports if required.
+//
+// +checklocks:igmp.ep.mu
+func (igmp *igmpState) updateGroupFilter(groupAddress tcpip.Address, oldFilter, newFilter tcpip.MulticastSourceFilter) {
+	igmp.genericMulticastProtocol.UpdateGroupFilterLocked(groupAddress, oldFilter, newFilter)
+}
+
 // isInGroup returns true if the specified group has been joined locally.
 //
 // +checklocksread:igmp.ep.mu
@@ -572,6 +572,11 @@ func (e *endpoint) writePacketPostRouting(r *stack.Route, pkt *stack.PacketBuffe
 		return nil
 	}
 
+	// IPsec policies may require the packet to be sent protected instead.
+	if handled, err := e.protocol.stack.XFRMOutput(r, pkt); handled {
+		return err
+	}
+
 	stats := e.stats.ip
 
 	networkMTU, err := calculateNetworkMTU(e.nic.MTU(), uint32(len(pkt.NetworkHeader().Slice())))
@@ -681,6 +686,10 @@ func (e *endpoint) forwardPacketWithRoute(route *stack.Route, pkt *stack.PacketB
 		e.stats.ip.IPTablesForwardDropped.Increment()
 		return nil
 	}
+	if !stk.XFRMCheckForward(pkt) {
+		// The IPsec forward policy rejects the packet.
+		return nil
+	}
 
 	// We need to do a deep copy of the IP packet because
 	// WriteHeaderIncludedPacket may modify the packet buffer, but we do
@@ -787,7 +796,7 @@ func (e *endpoint) forwardUnicastPacket(pkt *stack.PacketBuffer) ip.ForwardingEr
 		return nil
 	}
 
-	r, err := stk.FindRoute(0, tcpip.Address{}, dstAddr, ProtocolNumber, false /* multicastLoop */)
+	r, err := stk.FindRouteForFlow(0, tcpip.Address{}, dstAddr, ProtocolNumber, false /* multicastLoop */, stack.RouteFlow{InputNIC: e.nic.ID(), Mark: pkt.Mark})
 	switch err.(type) {
 	case nil:
 	// TODO(https://gvisor.dev/issues/8105): We should not observe ErrHostUnreachable from route
@@ -1164,6 +1173,10 @@ func (e *endpoint) handleValidatedPacket(h header.IPv4, pkt *stack.PacketBuffer,
 		subnet := addressEndpoint.AddressWithPrefix().Subnet()
 		pkt.NetworkPacketInfo.LocalAddressBroadcast = subnet.IsBroadcast(dstAddr) || dstAddr == header.IPv4Broadcast
 		e.deliverPacketLocally(h, pkt, inNICName)
+	} else if pkt.TransparentProxied() {
+		// Packets redirected to a transparent endpoint are delivered locally
+		// regardless of their destination.
+		e.deliverPacketLocally(h, pkt, inNICName)
 	} else if e.Forwarding() {
 		e.handleForwardingError(e.forwardUnicastPacket(pkt))
 	} else {
@@ -1488,6 +1501,18 @@ func (e *endpoint) leaveGroupLocked(addr tcpip.Address) tcpip.Error {
 	return e.igmp.leaveGroup(addr)
 }
 
+// UpdateGroupFilter implements stack.GroupAddressableEndpoint.
+func (e *endpoint) UpdateGroupFilter(addr tcpip.Address, oldFilter, newFilter tcpip.MulticastSourceFilter) tcpip.Error {
+	if !header.IsV4MulticastAddress(addr) {
+		return &tcpip.ErrBadAddress{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.igmp.updateGroupFilter(addr, oldFilter, newFilter) // +checklocksforce: e.mu==e.igmp.ep.mu.
+	return nil
+}
+
 // IsInGroup implements stack.GroupAddressableEndpoint.
 func (e *endpoint) IsInGroup(addr tcpip.Address) bool {
 	e.mu.RLock()
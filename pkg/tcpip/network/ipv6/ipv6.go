@@ -862,6 +862,11 @@ func (e *endpoint) writePacket(r *stack.Route, pkt *stack.PacketBuffer, protocol
 		return nil
 	}
 
+	// IPsec policies may require the packet to be sent protected instead.
+	if handled, err := e.protocol.stack.XFRMOutput(r, pkt); handled {
+		return err
+	}
+
 	stats := e.stats.ip
 	networkMTU, err := calculateNetworkMTU(e.nic.MTU(), uint32(len(pkt.NetworkHeader().Slice())))
 	if err != nil {
@@ -1012,7 +1017,7 @@ func (e *endpoint) forwardUnicastPacket(pkt *stack.PacketBuffer) ip.ForwardingEr
 		return &ip.ErrParameterProblem{}
 	}
 
-	r, err := stk.FindRoute(0, tcpip.Address{}, dstAddr, ProtocolNumber, false /* multicastLoop */)
+	r, err := stk.FindRouteForFlow(0, tcpip.Address{}, dstAddr, ProtocolNumber, false /* multicastLoop */, stack.RouteFlow{InputNIC: e.nic.ID(), Mark: pkt.Mark})
 	switch err.(type) {
 	case nil:
 	// TODO(https://gvisor.dev/issues/8105): We should not observe ErrHostUnreachable from route
@@ -1044,6 +1049,10 @@ func (e *endpoint) forwardPacketWithRoute(route *stack.Route, pkt *stack.PacketB
 		e.stats.ip.IPTablesForwardDropped.Increment()
 		return nil
 	}
+	if !stk.XFRMCheckForward(pkt) {
+		// The IPsec forward policy rejects the packet.
+		return nil
+	}
 
 	hopLimit := h.HopLimit()
 
@@ -1367,6 +1376,10 @@ func (e *endpoint) handleValidatedPacket(h header.IPv6, pkt *stack.PacketBuffer,
 	// packet. Otherwise, attempt to forward the packet.
 	if addressEndpoint := e.AcquireAssignedAddress(dstAddr, e.nic.Promiscuous(), stack.CanBePrimaryEndpoint, true /* readOnly */); addressEndpoint != nil {
 		e.deliverPacketLocally(h, pkt, inNICName)
+	} else if pkt.TransparentProxied() {
+		// Packets redirected to a transparent endpoint are delivered locally
+		// regardless of their destination.
+		e.deliverPacketLocally(h, pkt, inNICName)
 	} else if e.Forwarding() {
 		e.handleForwardingError(e.forwardUnicastPacket(pkt))
 	} else {
@@ -2267,6 +2280,18 @@ func (e *endpoint) leaveGroupLocked(addr tcpip.Address) tcpip.Error {
 	return e.mu.mld.leaveGroup(addr)
 }
 
+// UpdateGroupFilter implements stack.GroupAddressableEndpoint.
+func (e *endpoint) UpdateGroupFilter(addr tcpip.Address, oldFilter, newFilter tcpip.MulticastSourceFilter) tcpip.Error {
+	if !header.IsV6MulticastAddress(addr) {
+		return &tcpip.ErrBadAddress{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mu.mld.updateGroupFilter(addr, oldFilter, newFilter)
+	return nil
+}
+
 // IsInGroup implements stack.GroupAddressableEndpoint.
 func (e *endpoint) IsInGroup(addr tcpip.Address) bool {
 	e.mu.RLock()
@@ -133,7 +133,7 @@ type mldv2ReportBuilder struct {
 }
 
 // AddRecord implements ip.MulticastGroupProtocolV2ReportBuilder.
-func (b *mldv2ReportBuilder) AddRecord(genericRecordType ip.MulticastGroupProtocolV2ReportRecordType, groupAddress tcpip.Address) {
+func (b *mldv2ReportBuilder) AddRecord(genericRecordType ip.MulticastGroupProtocolV2ReportRecordType, groupAddress tcpip.Address, sources []tcpip.Address) {
 	var recordType header.MLDv2ReportRecordType
 	switch genericRecordType {
 	case ip.MulticastGroupProtocolV2ReportRecordModeIsInclude:
@@ -155,7 +155,7 @@ func (b *mldv2ReportBuilder) AddRecord(genericRecordType ip.MulticastGroupProtoc
 	b.records = append(b.records, header.MLDv2ReportMulticastAddressRecordSerializer{
 		RecordType:       recordType,
 		MulticastAddress: groupAddress,
-		Sources:          nil,
+		Sources:          sources,
 	})
 }
 
@@ -283,6 +283,14 @@ func (mld *mldState) joinGroup(groupAddress tcpip.Address) {
 	mld.genericMulticastProtocol.JoinGroupLocked(groupAddress)
 }
 
+// updateGroupFilter handles a join of the group changing its source filter,
+// sending MLDv2 state change reports if required.
+//
+// Precondition: mld.ep.mu must be locked.
+func (mld *mldState) updateGroupFilter(groupAddress tcpip.Address, oldFilter, newFilter tcpip.MulticastSourceFilter) {
+	mld.genericMulticastProtocol.UpdateGroupFilterLocked(groupAddress, oldFilter, newFilter)
+}
+
 // isInGroup returns true if the specified group has been joined locally.
 //
 // Precondition: mld.ep.mu must be read locked.
@@ -124,9 +124,9 @@ func (f AddressFamily) String() string {
 
 // addressFamilyProtocols maps address families to their protocol number.
 var addressFamilyProtocols = map[AddressFamily]uint8{
-	IP:     linux.NFPROTO_INET,
+	IP:     linux.NFPROTO_IPV4,
 	IP6:    linux.NFPROTO_IPV6,
-	Inet:   linux.NFPROTO_IPV6,
+	Inet:   linux.NFPROTO_INET,
 	Arp:    linux.NFPROTO_ARP,
 	Bridge: linux.NFPROTO_BRIDGE,
 	Netdev: linux.NFPROTO_NETDEV,
@@ -581,6 +581,15 @@ func validateBaseChainInfo(info *BaseChainInfo, family AddressFamily) error {
 	return nil
 }
 
+// ValidateBaseChainInfo checks that the base chain info is valid for a base
+// chain in a table of the given address family.
+func ValidateBaseChainInfo(info *BaseChainInfo, family AddressFamily) error {
+	if err := validateAddressFamily(family); err != nil {
+		return err
+	}
+	return validateBaseChainInfo(info, family)
+}
+
 // Rule represents a single rule in a chain and is represented as a list of
 // operations that are evaluated sequentially (on a packet).
 // Rules must be registered to a chain to be used and evaluated, and rules that
@@ -613,6 +622,8 @@ var (
 	_ operation = (*route)(nil)
 	_ operation = (*byteorder)(nil)
 	_ operation = (*metaLoad)(nil)
+	_ operation = (*metaSet)(nil)
+	_ operation = (*lookup)(nil)
 )
 
 // immediate is an operation that sets the data in a register.
@@ -1602,6 +1613,7 @@ func (key metaKey) String() string {
 var metaDataLengths = map[metaKey]int{
 	linux.NFT_META_LEN:       4,
 	linux.NFT_META_PROTOCOL:  2,
+	linux.NFT_META_MARK:      4,
 	linux.NFT_META_NFPROTO:   1,
 	linux.NFT_META_L4PROTO:   1,
 	linux.NFT_META_SKUID:     4,
@@ -1617,8 +1629,8 @@ var metaDataLengths = map[metaKey]int{
 // validateMetaKey ensures the meta key is valid.
 func validateMetaKey(key metaKey) error {
 	switch key {
-	case linux.NFT_META_LEN, linux.NFT_META_PROTOCOL, linux.NFT_META_NFPROTO,
-		linux.NFT_META_L4PROTO, linux.NFT_META_SKUID, linux.NFT_META_SKGID,
+	case linux.NFT_META_LEN, linux.NFT_META_PROTOCOL, linux.NFT_META_MARK,
+		linux.NFT_META_NFPROTO, linux.NFT_META_L4PROTO, linux.NFT_META_SKUID, linux.NFT_META_SKGID,
 		linux.NFT_META_RTCLASSID, linux.NFT_META_PKTTYPE, linux.NFT_META_PRANDOM,
 		linux.NFT_META_TIME_NS, linux.NFT_META_TIME_DAY, linux.NFT_META_TIME_HOUR:
 		return nil
@@ -1659,9 +1671,23 @@ func (op metaLoad) evaluate(regs *registerSet, pkt *stack.PacketBuffer, rule *Ru
 		}
 		target = binary.BigEndian.AppendUint16(nil, uint16(pkt.NetworkProtocolNumber))
 
+	// Packet Mark (32-bit, host order).
+	case linux.NFT_META_MARK:
+		target = binary.NativeEndian.AppendUint32(nil, pkt.Mark)
+
 	// Netfilter (Family) Protocol (8-bit, single byte).
 	case linux.NFT_META_NFPROTO:
 		family := rule.chain.GetAddressFamily()
+		// Inet chains are evaluated for both IPv4 and IPv6 packets, and report
+		// the protocol of the packet being evaluated.
+		if family == Inet {
+			switch pkt.NetworkProtocolNumber {
+			case header.IPv4ProtocolNumber:
+				family = IP
+			case header.IPv6ProtocolNumber:
+				family = IP6
+			}
+		}
 		target = []byte{family.Protocol()}
 
 	// L4 Transport Layer Protocol (8-bit, single byte).
@@ -1757,10 +1783,10 @@ type metaSet struct {
 func checkMetaKeySetCompatable(key metaKey) error {
 	switch key {
 	// Supported meta keys.
-	case linux.NFT_META_PKTTYPE:
+	case linux.NFT_META_PKTTYPE, linux.NFT_META_MARK:
 		return nil
 	// Should be supported but not yet implemented.
-	case linux.NFT_META_MARK, linux.NFT_META_PRIORITY,
+	case linux.NFT_META_PRIORITY,
 		linux.NFT_META_NFTRACE, linux.NFT_META_SECMARK:
 		return fmt.Errorf("meta key %v is not supported for meta set", key)
 	// All other keys cannot be used with meta set (strictly for loading).
@@ -1795,10 +1821,13 @@ func (op metaSet) evaluate(regs *registerSet, pkt *stack.PacketBuffer, rule *Rul
 
 	// Sets the meta data of the appropriate field.
 	switch op.key {
-	// Only Packet Type is supported for now.
+	// Only Packet Type and Mark are supported for now.
 	case linux.NFT_META_PKTTYPE:
 		pkt.PktType = tcpip.PacketType(src[0])
 		return
+	case linux.NFT_META_MARK:
+		pkt.Mark = binary.NativeEndian.Uint32(src)
+		return
 	}
 
 	// Breaks if could not set the meta data.
@@ -2113,6 +2142,40 @@ func (nf *NFTables) EvaluateHook(family AddressFamily, hook Hook, pkt *stack.Pac
 	panic(fmt.Sprintf("unexpected verdict from hook evaluation: %s", VerdictCodeToString(regs.Verdict().Code)))
 }
 
+// stackHooks maps the stack's iptables hooks to nftables hooks.
+var stackHooks = [stack.NumHooks]Hook{
+	stack.Prerouting:  Prerouting,
+	stack.Input:       Input,
+	stack.Forward:     Forward,
+	stack.Output:      Output,
+	stack.Postrouting: Postrouting,
+}
+
+// CheckPacket implements stack.PacketFilter.CheckPacket.
+//
+// IPv4 and IPv6 packets are evaluated by the chains of the IP or IP6 family
+// and then by those of the Inet family. Any verdict other than accept drops
+// the packet.
+// Note: NFTables must not be modified while it may be evaluating packets.
+func (nf *NFTables) CheckPacket(hook stack.Hook, pkt *stack.PacketBuffer) bool {
+	var family AddressFamily
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		family = IP
+	case header.IPv6ProtocolNumber:
+		family = IP6
+	default:
+		return true
+	}
+	for _, f := range [...]AddressFamily{family, Inet} {
+		v, err := nf.EvaluateHook(f, stackHooks[hook], pkt)
+		if err != nil || v.Code != VC(linux.NF_ACCEPT) {
+			return false
+		}
+	}
+	return true
+}
+
 // evaluateFromRule is a helper function for Chain.evaluate that evaluates the
 // packet through the rules in the chain starting at the specified rule index.
 func (c *Chain) evaluateFromRule(rIdx int, jumpDepth int, regs *registerSet, pkt *stack.PacketBuffer) error {
@@ -133,6 +133,9 @@ const (
 
 	// Arbitrary Packet Type
 	arbitraryPktType = tcpip.PacketOutgoing
+
+	// Arbitrary Packet Mark
+	arbitraryMark = 0x1234
 )
 
 var (
@@ -2815,6 +2818,7 @@ func TestEvaluateMetaLoad(t *testing.T) {
 	tcpFields := arbitraryTCPFields()
 	pkt := makeIPv6TCPPacket(pktSize, ipv6Fields, tcpFields)
 	pkt.Owner = &mockPacketOwner{arbitrarySKUID, arbitrarySKGID}
+	pkt.Mark = arbitraryMark
 
 	// Sets up a fake clock (now = UnixEpoch) and dependent time/random fields.
 	fakeClock := faketime.NewManualClock()
@@ -2881,6 +2885,13 @@ func TestEvaluateMetaLoad(t *testing.T) {
 			op2: mustCreateComparison(t, linux.NFT_REG32_04, linux.NFT_CMP_EQ,
 				binary.NativeEndian.AppendUint32(nil, uint32(tcid))),
 		},
+		{ // cmd: add rule ip6 tab ch meta mark 0x1234
+			tname: "meta load mark test",
+			pkt:   pkt,
+			op1:   mustCreateMetaLoad(t, linux.NFT_META_MARK, linux.NFT_REG32_06),
+			op2: mustCreateComparison(t, linux.NFT_REG32_06, linux.NFT_CMP_EQ,
+				binary.NativeEndian.AppendUint32(nil, arbitraryMark)),
+		},
 		{ // cmd: add rule ip6 tab ch pkttype 2
 			tname: "meta load pkttype test",
 			pkt:   pkt,
@@ -3008,6 +3019,18 @@ func TestEvaluateMetaSet(t *testing.T) {
 			op1: mustCreateImmediate(t, linux.NFT_REG_3, newBytesData([]byte{uint8(testPktType)})),
 			op2: mustCreateMetaSet(t, linux.NFT_META_PKTTYPE, linux.NFT_REG_3),
 		},
+		// cmd: nft --debug=netlink add rule ip tab ch meta mark set 0x1234
+		{
+			tname: "meta set mark test",
+			pkt:   makeIPv4Packet(header.IPv4MinimumSize, arbitraryIPv4Fields()),
+			outPkt: func() *stack.PacketBuffer {
+				pkt := makeIPv4Packet(header.IPv4MinimumSize, arbitraryIPv4Fields())
+				pkt.Mark = arbitraryMark
+				return pkt
+			}(),
+			op1: mustCreateImmediate(t, linux.NFT_REG32_06, newBytesData(binary.NativeEndian.AppendUint32(nil, arbitraryMark))),
+			op2: mustCreateMetaSet(t, linux.NFT_META_MARK, linux.NFT_REG32_06),
+		},
 	} {
 		t.Run(test.tname, func(t *testing.T) {
 			// Sets up an NFTables object with a single table, chain, and rule.
@@ -3634,6 +3657,9 @@ func checkPacketEquality(t *testing.T, expected, actual *stack.PacketBuffer) {
 	if expected.PktType != actual.PktType {
 		t.Fatalf("expected packet type %d for resulting packet, got %d", int(expected.PktType), int(actual.PktType))
 	}
+	if expected.Mark != actual.Mark {
+		t.Fatalf("expected mark %#x for resulting packet, got %#x", expected.Mark, actual.Mark)
+	}
 
 	// Compares checksums first for the expected and actual packet.
 	if expected.NetworkProtocolNumber != actual.NetworkProtocolNumber {
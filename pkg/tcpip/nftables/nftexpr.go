@@ -0,0 +1,458 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nftables
+
+// This file decodes nf_tables expressions from their netlink representation,
+// as sent by the nft binary and libnftnl in NFTA_RULE_EXPRESSIONS.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// ErrUnsupportedExpression is returned (wrapped) by Rule.AddExpression for
+// expression types that are not implemented.
+var ErrUnsupportedExpression = errors.New("unsupported expression")
+
+// SetResolver returns the set referenced by a lookup expression, by name or
+// (if hasID) by the transaction-local set ID.
+type SetResolver func(name string, id uint32, hasID bool) (*Set, error)
+
+// Attrs is a parsed list of netlink attributes keyed by type, with the
+// NLA_F_NESTED and NLA_F_NET_BYTEORDER flags removed.
+type Attrs map[uint16][]byte
+
+// ParseAttrs parses a buffer of netlink attributes.
+func ParseAttrs(buf []byte) (Attrs, error) {
+	attrs := make(Attrs)
+	for len(buf) > 0 {
+		if len(buf) < linux.NetlinkAttrHeaderSize {
+			return nil, fmt.Errorf("truncated attribute header")
+		}
+		length := int(binary.NativeEndian.Uint16(buf[0:2]))
+		atype := binary.NativeEndian.Uint16(buf[2:4]) & linux.NLA_TYPE_MASK
+		if length < linux.NetlinkAttrHeaderSize || length > len(buf) {
+			return nil, fmt.Errorf("invalid attribute length %d", length)
+		}
+		attrs[atype] = buf[linux.NetlinkAttrHeaderSize:length]
+		aligned := (length + linux.NLA_ALIGNTO - 1) &^ (linux.NLA_ALIGNTO - 1)
+		if aligned > len(buf) {
+			aligned = len(buf)
+		}
+		buf = buf[aligned:]
+	}
+	return attrs, nil
+}
+
+// ParseList parses a buffer of NFTA_LIST_ELEM attributes, returning the
+// payload of each element in order.
+func ParseList(buf []byte) ([][]byte, error) {
+	var elems [][]byte
+	for len(buf) > 0 {
+		if len(buf) < linux.NetlinkAttrHeaderSize {
+			return nil, fmt.Errorf("truncated attribute header")
+		}
+		length := int(binary.NativeEndian.Uint16(buf[0:2]))
+		atype := binary.NativeEndian.Uint16(buf[2:4]) & linux.NLA_TYPE_MASK
+		if length < linux.NetlinkAttrHeaderSize || length > len(buf) {
+			return nil, fmt.Errorf("invalid attribute length %d", length)
+		}
+		if atype != linux.NFTA_LIST_ELEM {
+			return nil, fmt.Errorf("unexpected attribute type %d in list", atype)
+		}
+		elems = append(elems, buf[linux.NetlinkAttrHeaderSize:length])
+		aligned := (length + linux.NLA_ALIGNTO - 1) &^ (linux.NLA_ALIGNTO - 1)
+		if aligned > len(buf) {
+			aligned = len(buf)
+		}
+		buf = buf[aligned:]
+	}
+	return elems, nil
+}
+
+// String returns the NUL-terminated string attribute of the given type.
+func (a Attrs) String(atype uint16) (string, bool) {
+	v, ok := a[atype]
+	if !ok {
+		return "", false
+	}
+	if n := len(v); n > 0 && v[n-1] == 0 {
+		v = v[:n-1]
+	}
+	return string(v), true
+}
+
+// BE32 returns the big-endian 32-bit attribute of the given type.
+func (a Attrs) BE32(atype uint16) (uint32, bool) {
+	v, ok := a[atype]
+	if !ok || len(v) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(v), true
+}
+
+// BE64 returns the big-endian 64-bit attribute of the given type.
+func (a Attrs) BE64(atype uint16) (uint64, bool) {
+	v, ok := a[atype]
+	if !ok || len(v) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(v), true
+}
+
+// mustBE32 is like BE32 but returns an error if the attribute is missing or
+// malformed.
+func (a Attrs) mustBE32(atype uint16, what string) (uint32, error) {
+	v, ok := a.BE32(atype)
+	if !ok {
+		return 0, fmt.Errorf("missing or malformed %s attribute", what)
+	}
+	return v, nil
+}
+
+// mustUint8 is like mustBE32 but also checks that the value fits in a uint8.
+func (a Attrs) mustUint8(atype uint16, what string) (uint8, error) {
+	v, err := a.mustBE32(atype, what)
+	if err != nil {
+		return 0, err
+	}
+	if v > math.MaxUint8 {
+		return 0, fmt.Errorf("%s attribute value %d out of range", what, v)
+	}
+	return uint8(v), nil
+}
+
+// ParseDataValue decodes a nested NFTA_DATA_VALUE attribute.
+func ParseDataValue(buf []byte) ([]byte, error) {
+	attrs, err := ParseAttrs(buf)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := attrs[linux.NFTA_DATA_VALUE]
+	if !ok {
+		return nil, fmt.Errorf("missing data value")
+	}
+	if len(v) == 0 || len(v) > linux.NFT_REG_SIZE*linux.NFT_REG_MAX {
+		return nil, fmt.Errorf("invalid data value length %d", len(v))
+	}
+	return v, nil
+}
+
+// parseData decodes nested nft_data attributes, which hold either a value or
+// a verdict.
+func parseData(buf []byte) (registerData, error) {
+	attrs, err := ParseAttrs(buf)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := attrs[linux.NFTA_DATA_VALUE]; ok {
+		if len(v) == 0 || len(v) > linux.NFT_REG_SIZE {
+			return nil, fmt.Errorf("invalid data value length %d", len(v))
+		}
+		return newBytesData(v), nil
+	}
+	vbuf, ok := attrs[linux.NFTA_DATA_VERDICT]
+	if !ok {
+		return nil, fmt.Errorf("data has neither value nor verdict")
+	}
+	vattrs, err := ParseAttrs(vbuf)
+	if err != nil {
+		return nil, err
+	}
+	code, err := vattrs.mustBE32(linux.NFTA_VERDICT_CODE, "verdict code")
+	if err != nil {
+		return nil, err
+	}
+	verdict := Verdict{Code: code}
+	switch int32(code) {
+	case linux.NF_ACCEPT, linux.NF_DROP, linux.NFT_CONTINUE, linux.NFT_BREAK, linux.NFT_RETURN:
+	case linux.NFT_JUMP, linux.NFT_GOTO:
+		chain, ok := vattrs.String(linux.NFTA_VERDICT_CHAIN)
+		if !ok {
+			// TODO(b/345684870): Support NFTA_VERDICT_CHAIN_ID for jumps to
+			// anonymous (binding) chains.
+			return nil, fmt.Errorf("%w: jump or goto without chain name", ErrUnsupportedExpression)
+		}
+		verdict.ChainName = chain
+	default:
+		return nil, fmt.Errorf("%w: verdict %s", ErrUnsupportedExpression, VerdictCodeToString(code))
+	}
+	return newVerdictData(verdict), nil
+}
+
+// AddExpression decodes the netlink-encoded expression with the given name
+// and NFTA_EXPR_DATA payload and adds the resulting operation to the rule.
+// Lookup expressions reference sets via sets, which may be nil if the rule
+// contains no lookups.
+// Returns an error wrapping ErrUnsupportedExpression for expressions that are
+// not implemented.
+func (r *Rule) AddExpression(name string, data []byte, sets SetResolver) error {
+	attrs, err := ParseAttrs(data)
+	if err != nil {
+		return err
+	}
+	op, err := decodeExpression(name, attrs, sets)
+	if err != nil {
+		return fmt.Errorf("%s expression: %w", name, err)
+	}
+	return r.addOperation(op)
+}
+
+// decodeExpression creates the operation corresponding to the expression.
+func decodeExpression(name string, attrs Attrs, sets SetResolver) (operation, error) {
+	switch name {
+	case "immediate":
+		dreg, err := attrs.mustUint8(linux.NFTA_IMMEDIATE_DREG, "dreg")
+		if err != nil {
+			return nil, err
+		}
+		buf, ok := attrs[linux.NFTA_IMMEDIATE_DATA]
+		if !ok {
+			return nil, fmt.Errorf("missing data attribute")
+		}
+		data, err := parseData(buf)
+		if err != nil {
+			return nil, err
+		}
+		return newImmediate(dreg, data)
+
+	case "cmp":
+		sreg, err := attrs.mustUint8(linux.NFTA_CMP_SREG, "sreg")
+		if err != nil {
+			return nil, err
+		}
+		cop, err := attrs.mustBE32(linux.NFTA_CMP_OP, "op")
+		if err != nil {
+			return nil, err
+		}
+		data, err := ParseDataValue(attrs[linux.NFTA_CMP_DATA])
+		if err != nil {
+			return nil, err
+		}
+		return newComparison(sreg, int(cop), data)
+
+	case "range":
+		sreg, err := attrs.mustUint8(linux.NFTA_RANGE_SREG, "sreg")
+		if err != nil {
+			return nil, err
+		}
+		rop, err := attrs.mustBE32(linux.NFTA_RANGE_OP, "op")
+		if err != nil {
+			return nil, err
+		}
+		low, err := ParseDataValue(attrs[linux.NFTA_RANGE_FROM_DATA])
+		if err != nil {
+			return nil, err
+		}
+		high, err := ParseDataValue(attrs[linux.NFTA_RANGE_TO_DATA])
+		if err != nil {
+			return nil, err
+		}
+		return newRanged(sreg, int(rop), low, high)
+
+	case "payload":
+		base, err := attrs.mustUint8(linux.NFTA_PAYLOAD_BASE, "base")
+		if err != nil {
+			return nil, err
+		}
+		offset, err := attrs.mustUint8(linux.NFTA_PAYLOAD_OFFSET, "offset")
+		if err != nil {
+			return nil, err
+		}
+		blen, err := attrs.mustUint8(linux.NFTA_PAYLOAD_LEN, "len")
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := attrs[linux.NFTA_PAYLOAD_DREG]; ok {
+			dreg, err := attrs.mustUint8(linux.NFTA_PAYLOAD_DREG, "dreg")
+			if err != nil {
+				return nil, err
+			}
+			return newPayloadLoad(payloadBase(base), offset, blen, dreg)
+		}
+		sreg, err := attrs.mustUint8(linux.NFTA_PAYLOAD_SREG, "sreg")
+		if err != nil {
+			return nil, err
+		}
+		var csumType, csumOffset, csumFlags uint8
+		if _, ok := attrs[linux.NFTA_PAYLOAD_CSUM_TYPE]; ok {
+			if csumType, err = attrs.mustUint8(linux.NFTA_PAYLOAD_CSUM_TYPE, "csum type"); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := attrs[linux.NFTA_PAYLOAD_CSUM_OFFSET]; ok {
+			if csumOffset, err = attrs.mustUint8(linux.NFTA_PAYLOAD_CSUM_OFFSET, "csum offset"); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := attrs[linux.NFTA_PAYLOAD_CSUM_FLAGS]; ok {
+			if csumFlags, err = attrs.mustUint8(linux.NFTA_PAYLOAD_CSUM_FLAGS, "csum flags"); err != nil {
+				return nil, err
+			}
+		}
+		return newPayloadSet(payloadBase(base), offset, blen, sreg, csumType, csumOffset, csumFlags)
+
+	case "bitwise":
+		sreg, err := attrs.mustUint8(linux.NFTA_BITWISE_SREG, "sreg")
+		if err != nil {
+			return nil, err
+		}
+		dreg, err := attrs.mustUint8(linux.NFTA_BITWISE_DREG, "dreg")
+		if err != nil {
+			return nil, err
+		}
+		blen, err := attrs.mustUint8(linux.NFTA_BITWISE_LEN, "len")
+		if err != nil {
+			return nil, err
+		}
+		bop := uint32(linux.NFT_BITWISE_BOOL)
+		if _, ok := attrs[linux.NFTA_BITWISE_OP]; ok {
+			if bop, err = attrs.mustBE32(linux.NFTA_BITWISE_OP, "op"); err != nil {
+				return nil, err
+			}
+		}
+		switch bop {
+		case linux.NFT_BITWISE_BOOL:
+			mask, err := ParseDataValue(attrs[linux.NFTA_BITWISE_MASK])
+			if err != nil {
+				return nil, err
+			}
+			xor, err := ParseDataValue(attrs[linux.NFTA_BITWISE_XOR])
+			if err != nil {
+				return nil, err
+			}
+			if len(mask) != int(blen) || len(xor) != int(blen) {
+				return nil, fmt.Errorf("mask and xor must be %d bytes", blen)
+			}
+			return newBitwiseBool(sreg, dreg, mask, xor)
+		case linux.NFT_BITWISE_LSHIFT, linux.NFT_BITWISE_RSHIFT:
+			data, err := ParseDataValue(attrs[linux.NFTA_BITWISE_DATA])
+			if err != nil {
+				return nil, err
+			}
+			if len(data) != 4 {
+				return nil, fmt.Errorf("shift amount must be 4 bytes")
+			}
+			shift := binary.NativeEndian.Uint32(data)
+			return newBitwiseShift(sreg, dreg, blen, shift, bop == linux.NFT_BITWISE_RSHIFT)
+		default:
+			return nil, fmt.Errorf("invalid bitwise operator %d", bop)
+		}
+
+	case "byteorder":
+		sreg, err := attrs.mustUint8(linux.NFTA_BYTEORDER_SREG, "sreg")
+		if err != nil {
+			return nil, err
+		}
+		dreg, err := attrs.mustUint8(linux.NFTA_BYTEORDER_DREG, "dreg")
+		if err != nil {
+			return nil, err
+		}
+		bop, err := attrs.mustBE32(linux.NFTA_BYTEORDER_OP, "op")
+		if err != nil {
+			return nil, err
+		}
+		blen, err := attrs.mustUint8(linux.NFTA_BYTEORDER_LEN, "len")
+		if err != nil {
+			return nil, err
+		}
+		size, err := attrs.mustUint8(linux.NFTA_BYTEORDER_SIZE, "size")
+		if err != nil {
+			return nil, err
+		}
+		return newByteorder(sreg, dreg, byteorderOp(bop), blen, size)
+
+	case "meta":
+		key, err := attrs.mustBE32(linux.NFTA_META_KEY, "key")
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := attrs[linux.NFTA_META_DREG]; ok {
+			dreg, err := attrs.mustUint8(linux.NFTA_META_DREG, "dreg")
+			if err != nil {
+				return nil, err
+			}
+			op, err := newMetaLoad(metaKey(key), dreg)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrUnsupportedExpression, err)
+			}
+			return op, nil
+		}
+		sreg, err := attrs.mustUint8(linux.NFTA_META_SREG, "sreg")
+		if err != nil {
+			return nil, err
+		}
+		op, err := newMetaSet(metaKey(key), sreg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedExpression, err)
+		}
+		return op, nil
+
+	case "rt":
+		key, err := attrs.mustBE32(linux.NFTA_RT_KEY, "key")
+		if err != nil {
+			return nil, err
+		}
+		dreg, err := attrs.mustUint8(linux.NFTA_RT_DREG, "dreg")
+		if err != nil {
+			return nil, err
+		}
+		op, err := newRoute(routeKey(key), dreg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedExpression, err)
+		}
+		return op, nil
+
+	case "counter":
+		bytes, _ := attrs.BE64(linux.NFTA_COUNTER_BYTES)
+		packets, _ := attrs.BE64(linux.NFTA_COUNTER_PACKETS)
+		return newCounter(int64(bytes), int64(packets)), nil
+
+	case "lookup":
+		sreg, err := attrs.mustUint8(linux.NFTA_LOOKUP_SREG, "sreg")
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := attrs[linux.NFTA_LOOKUP_DREG]; ok {
+			return nil, fmt.Errorf("%w: map lookups", ErrUnsupportedExpression)
+		}
+		var flags uint32
+		if _, ok := attrs[linux.NFTA_LOOKUP_FLAGS]; ok {
+			if flags, err = attrs.mustBE32(linux.NFTA_LOOKUP_FLAGS, "flags"); err != nil {
+				return nil, err
+			}
+		}
+		if flags&^linux.NFT_LOOKUP_F_INV != 0 {
+			return nil, fmt.Errorf("invalid flags %#x", flags)
+		}
+		name, _ := attrs.String(linux.NFTA_LOOKUP_SET)
+		id, hasID := attrs.BE32(linux.NFTA_LOOKUP_SET_ID)
+		if sets == nil {
+			return nil, fmt.Errorf("no sets available")
+		}
+		set, err := sets(name, id, hasID)
+		if err != nil {
+			return nil, err
+		}
+		return newLookup(set, sreg, flags&linux.NFT_LOOKUP_F_INV != 0)
+
+	default:
+		return nil, ErrUnsupportedExpression
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nftables
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// attr encodes a netlink attribute. Nested attributes are marked with
+// NLA_F_NESTED as libnftnl does.
+func attr(atype uint16, v []byte) []byte {
+	l := linux.NetlinkAttrHeaderSize + len(v)
+	buf := binary.NativeEndian.AppendUint16(nil, uint16(l))
+	buf = binary.NativeEndian.AppendUint16(buf, atype)
+	buf = append(buf, v...)
+	for len(buf)%linux.NLA_ALIGNTO != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+func nested(atype uint16, attrs ...[]byte) []byte {
+	var v []byte
+	for _, a := range attrs {
+		v = append(v, a...)
+	}
+	return attr(atype|linux.NLA_F_NESTED, v)
+}
+
+func be32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+// verdictCode encodes a (possibly negative) verdict code.
+func verdictCode(code int32) []byte {
+	return be32(uint32(code))
+}
+
+// TestParseAttrs tests attribute parsing, including type masking and
+// malformed input.
+func TestParseAttrs(t *testing.T) {
+	buf := append(attr(linux.NFTA_TABLE_NAME, []byte("filter\x00")), nested(linux.NFTA_CHAIN_HOOK, attr(linux.NFTA_HOOK_HOOKNUM, be32(1)))...)
+	attrs, err := ParseAttrs(buf)
+	if err != nil {
+		t.Fatalf("ParseAttrs failed: %v", err)
+	}
+	if name, ok := attrs.String(linux.NFTA_TABLE_NAME); !ok || name != "filter" {
+		t.Errorf("got name %q (present %t), want \"filter\"", name, ok)
+	}
+	hook, err := ParseAttrs(attrs[linux.NFTA_CHAIN_HOOK])
+	if err != nil {
+		t.Fatalf("ParseAttrs of nested attribute failed: %v", err)
+	}
+	if num, ok := hook.BE32(linux.NFTA_HOOK_HOOKNUM); !ok || num != 1 {
+		t.Errorf("got hook number %d (present %t), want 1", num, ok)
+	}
+
+	if _, err := ParseAttrs(buf[:len(buf)-1]); err == nil {
+		t.Errorf("ParseAttrs succeeded for truncated attribute")
+	}
+}
+
+// TestAddExpression tests decoding netlink expressions into operations.
+func TestAddExpression(t *testing.T) {
+	set, err := NewSet("ports", 2, false /* interval */)
+	if err != nil {
+		t.Fatalf("NewSet failed: %v", err)
+	}
+	resolve := func(name string, id uint32, hasID bool) (*Set, error) {
+		if name != set.GetName() {
+			return nil, errors.New("no such set")
+		}
+		return set, nil
+	}
+
+	for _, test := range []struct {
+		tname   string
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{
+			tname: "immediate accept",
+			name:  "immediate",
+			data: append(attr(linux.NFTA_IMMEDIATE_DREG, be32(linux.NFT_REG_VERDICT)),
+				nested(linux.NFTA_IMMEDIATE_DATA,
+					nested(linux.NFTA_DATA_VERDICT, attr(linux.NFTA_VERDICT_CODE, verdictCode(linux.NF_ACCEPT))))...),
+		},
+		{
+			tname:   "immediate jump without chain",
+			name:    "immediate",
+			wantErr: true,
+			data: append(attr(linux.NFTA_IMMEDIATE_DREG, be32(linux.NFT_REG_VERDICT)),
+				nested(linux.NFTA_IMMEDIATE_DATA,
+					nested(linux.NFTA_DATA_VERDICT, attr(linux.NFTA_VERDICT_CODE, verdictCode(linux.NFT_JUMP))))...),
+		},
+		{
+			tname: "cmp",
+			name:  "cmp",
+			data: append(append(attr(linux.NFTA_CMP_SREG, be32(linux.NFT_REG32_00)),
+				attr(linux.NFTA_CMP_OP, be32(linux.NFT_CMP_EQ))...),
+				nested(linux.NFTA_CMP_DATA, attr(linux.NFTA_DATA_VALUE, []byte{6}))...),
+		},
+		{
+			tname:   "cmp without op",
+			name:    "cmp",
+			wantErr: true,
+			data: append(attr(linux.NFTA_CMP_SREG, be32(linux.NFT_REG32_00)),
+				nested(linux.NFTA_CMP_DATA, attr(linux.NFTA_DATA_VALUE, []byte{6}))...),
+		},
+		{
+			tname: "lookup",
+			name:  "lookup",
+			data: append(attr(linux.NFTA_LOOKUP_SET, []byte("ports\x00")),
+				attr(linux.NFTA_LOOKUP_SREG, be32(linux.NFT_REG32_00))...),
+		},
+		{
+			tname:   "lookup of missing set",
+			name:    "lookup",
+			wantErr: true,
+			data: append(attr(linux.NFTA_LOOKUP_SET, []byte("missing\x00")),
+				attr(linux.NFTA_LOOKUP_SREG, be32(linux.NFT_REG32_00))...),
+		},
+	} {
+		t.Run(test.tname, func(t *testing.T) {
+			r := &Rule{}
+			err := r.AddExpression(test.name, test.data, resolve)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("AddExpression succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddExpression failed: %v", err)
+			}
+			if len(r.ops) != 1 {
+				t.Fatalf("got %d operations, want 1", len(r.ops))
+			}
+		})
+	}
+
+	r := &Rule{}
+	if err := r.AddExpression("ct", nil, nil); !errors.Is(err, ErrUnsupportedExpression) {
+		t.Errorf("AddExpression(\"ct\") = %v, want ErrUnsupportedExpression", err)
+	}
+}
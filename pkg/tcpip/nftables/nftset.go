@@ -0,0 +1,183 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nftables
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// Set is a collection of keys that packets can be matched against via lookup
+// operations.
+// Sets are either exact-match (hash) sets or interval sets. Interval sets
+// mirror the kernel's rbtree set representation: each element is a boundary
+// that either starts an interval or (with NFT_SET_ELEM_INTERVAL_END) marks the
+// exclusive end of the preceding interval.
+// Note: maps, timeouts and concatenated keys are not supported.
+type Set struct {
+	// name is the name of the set.
+	name string
+
+	// keyLen is the length of each key in bytes.
+	keyLen int
+
+	// interval is whether the set contains intervals.
+	interval bool
+
+	// elems contains the keys of an exact-match set.
+	elems map[string]struct{}
+
+	// bounds contains the boundaries of an interval set in ascending order.
+	bounds []setBound
+}
+
+// setBound is a single boundary in an interval set.
+type setBound struct {
+	key []byte
+	end bool
+}
+
+// NewSet creates a new empty set with the given name and key length.
+func NewSet(name string, keyLen int, interval bool) (*Set, error) {
+	if keyLen <= 0 || keyLen > registersByteSize {
+		return nil, fmt.Errorf("invalid key length %d for set %s", keyLen, name)
+	}
+	s := &Set{name: name, keyLen: keyLen, interval: interval}
+	if !interval {
+		s.elems = make(map[string]struct{})
+	}
+	return s, nil
+}
+
+// GetName returns the name of the set.
+func (s *Set) GetName() string {
+	return s.name
+}
+
+// KeyLen returns the length of the set's keys in bytes.
+func (s *Set) KeyLen() int {
+	return s.keyLen
+}
+
+// AddElement adds the key to the set. intervalEnd marks the key as the
+// exclusive end of an interval and is only valid for interval sets.
+func (s *Set) AddElement(key []byte, intervalEnd bool) error {
+	if len(key) != s.keyLen {
+		return fmt.Errorf("key length %d does not match set %s key length %d", len(key), s.name, s.keyLen)
+	}
+	if !s.interval {
+		if intervalEnd {
+			return fmt.Errorf("interval end element in non-interval set %s", s.name)
+		}
+		s.elems[string(key)] = struct{}{}
+		return nil
+	}
+	pos, found := slices.BinarySearchFunc(s.bounds, key, func(b setBound, k []byte) int {
+		return bytes.Compare(b.key, k)
+	})
+	if found {
+		s.bounds[pos].end = intervalEnd
+		return nil
+	}
+	s.bounds = slices.Insert(s.bounds, pos, setBound{key: slices.Clone(key), end: intervalEnd})
+	return nil
+}
+
+// RemoveElement removes the key from the set, returning whether it was
+// present.
+func (s *Set) RemoveElement(key []byte) bool {
+	if !s.interval {
+		if _, ok := s.elems[string(key)]; !ok {
+			return false
+		}
+		delete(s.elems, string(key))
+		return true
+	}
+	pos, found := slices.BinarySearchFunc(s.bounds, key, func(b setBound, k []byte) int {
+		return bytes.Compare(b.key, k)
+	})
+	if found {
+		s.bounds = slices.Delete(s.bounds, pos, pos+1)
+	}
+	return found
+}
+
+// contains returns whether the key is a member of the set.
+func (s *Set) contains(key []byte) bool {
+	if !s.interval {
+		_, ok := s.elems[string(key)]
+		return ok
+	}
+	// Finds the greatest boundary that is less than or equal to the key. The key
+	// is in the set iff that boundary starts an interval.
+	pos, found := slices.BinarySearchFunc(s.bounds, key, func(b setBound, k []byte) int {
+		return bytes.Compare(b.key, k)
+	})
+	if !found {
+		if pos == 0 {
+			return false
+		}
+		pos--
+	}
+	return !s.bounds[pos].end
+}
+
+// lookup is an operation that checks whether the data in a register is a
+// member of a set and breaks from the rule if it is not (or if it is, when
+// inverted).
+// Note: lookups into maps (with a destination register) are not supported.
+type lookup struct {
+	set    *Set  // Set to search.
+	sreg   uint8 // Number of the source register.
+	invert bool  // Whether to invert the result.
+}
+
+// newLookup creates a new lookup operation.
+func newLookup(set *Set, sreg uint8, invert bool) (*lookup, error) {
+	if set == nil {
+		return nil, fmt.Errorf("lookup operation requires a set")
+	}
+	if isVerdictRegister(sreg) || !isRegister(sreg) {
+		return nil, fmt.Errorf("invalid source register %d for lookup operation", sreg)
+	}
+	if registerOffset(sreg)+set.keyLen > registersByteSize {
+		return nil, fmt.Errorf("set %s key length %d overflows register %d", set.name, set.keyLen, sreg)
+	}
+	return &lookup{set: set, sreg: sreg, invert: invert}, nil
+}
+
+// evaluate for lookup checks set membership of the source register data and
+// breaks from the rule if the result (after inversion) is false.
+func (op lookup) evaluate(regs *registerSet, pkt *stack.PacketBuffer, rule *Rule) {
+	start := registerOffset(op.sreg)
+	key := regs.data[start : start+op.set.keyLen]
+	if op.set.contains(key) == op.invert {
+		regs.verdict = Verdict{Code: VC(linux.NFT_BREAK)}
+	}
+}
+
+// registerOffset returns the offset of the (non-verdict) register in the
+// register set's data. Keys may span multiple consecutive registers, as in
+// the kernel.
+func registerOffset(reg uint8) int {
+	if is4ByteRegister(reg) {
+		return int(reg-linux.NFT_REG32_00) * linux.NFT_REG32_SIZE
+	}
+	return int(reg-linux.NFT_REG_1) * linux.NFT_REG_SIZE
+}
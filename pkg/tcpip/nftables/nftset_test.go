@@ -0,0 +1,130 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nftables
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+// TestSetContains tests membership of exact-match and interval sets.
+func TestSetContains(t *testing.T) {
+	exact, err := NewSet("exact", 2, false /* interval */)
+	if err != nil {
+		t.Fatalf("NewSet failed: %v", err)
+	}
+	for _, key := range [][]byte{{0, 22}, {0, 80}} {
+		if err := exact.AddElement(key, false /* intervalEnd */); err != nil {
+			t.Fatalf("AddElement(%v) failed: %v", key, err)
+		}
+	}
+	if err := exact.AddElement([]byte{0, 1}, true /* intervalEnd */); err == nil {
+		t.Errorf("AddElement succeeded for interval end in exact-match set")
+	}
+	if err := exact.AddElement([]byte{1}, false /* intervalEnd */); err == nil {
+		t.Errorf("AddElement succeeded for key of wrong length")
+	}
+
+	// Interval set containing [10, 20) and [30, 40).
+	interval, err := NewSet("interval", 1, true /* interval */)
+	if err != nil {
+		t.Fatalf("NewSet failed: %v", err)
+	}
+	for _, b := range []struct {
+		key byte
+		end bool
+	}{{30, false}, {10, false}, {40, true}, {20, true}} {
+		if err := interval.AddElement([]byte{b.key}, b.end); err != nil {
+			t.Fatalf("AddElement(%d) failed: %v", b.key, err)
+		}
+	}
+
+	for _, test := range []struct {
+		tname string
+		set   *Set
+		key   []byte
+		want  bool
+	}{
+		{tname: "exact member", set: exact, key: []byte{0, 22}, want: true},
+		{tname: "exact non-member", set: exact, key: []byte{0, 23}},
+		{tname: "below first interval", set: interval, key: []byte{9}},
+		{tname: "interval start", set: interval, key: []byte{10}, want: true},
+		{tname: "inside interval", set: interval, key: []byte{19}, want: true},
+		{tname: "interval end", set: interval, key: []byte{20}},
+		{tname: "between intervals", set: interval, key: []byte{25}},
+		{tname: "inside second interval", set: interval, key: []byte{35}, want: true},
+		{tname: "above last interval", set: interval, key: []byte{200}},
+	} {
+		t.Run(test.tname, func(t *testing.T) {
+			if got := test.set.contains(test.key); got != test.want {
+				t.Errorf("contains(%v) = %t, want %t", test.key, got, test.want)
+			}
+		})
+	}
+
+	if !exact.RemoveElement([]byte{0, 22}) {
+		t.Errorf("RemoveElement returned false for member")
+	}
+	if exact.contains([]byte{0, 22}) {
+		t.Errorf("contains returned true for removed element")
+	}
+	if exact.RemoveElement([]byte{0, 22}) {
+		t.Errorf("RemoveElement returned true for non-member")
+	}
+}
+
+// TestEvaluateLookup tests that lookups break from the rule when the source
+// register is not in the set, or is in the set when inverted.
+func TestEvaluateLookup(t *testing.T) {
+	set, err := NewSet("ports", 2, false /* interval */)
+	if err != nil {
+		t.Fatalf("NewSet failed: %v", err)
+	}
+	if err := set.AddElement([]byte{0, 80}, false /* intervalEnd */); err != nil {
+		t.Fatalf("AddElement failed: %v", err)
+	}
+	if _, err := newLookup(set, linux.NFT_REG_VERDICT, false /* invert */); err == nil {
+		t.Errorf("newLookup succeeded with verdict register")
+	}
+	if _, err := newLookup(set, linux.NFT_REG32_15, false /* invert */); err != nil {
+		t.Errorf("newLookup failed for key in last 4-byte register: %v", err)
+	}
+
+	for _, test := range []struct {
+		tname     string
+		key       []byte
+		invert    bool
+		wantBreak bool
+	}{
+		{tname: "member", key: []byte{0, 80}},
+		{tname: "non-member", key: []byte{0, 81}, wantBreak: true},
+		{tname: "inverted member", key: []byte{0, 80}, invert: true, wantBreak: true},
+		{tname: "inverted non-member", key: []byte{0, 81}, invert: true},
+	} {
+		t.Run(test.tname, func(t *testing.T) {
+			op, err := newLookup(set, linux.NFT_REG32_01, test.invert)
+			if err != nil {
+				t.Fatalf("newLookup failed: %v", err)
+			}
+			regs := newRegisterSet()
+			copy(regs.data[registerOffset(linux.NFT_REG32_01):], test.key)
+			op.evaluate(&regs, nil, nil)
+			if gotBreak := regs.verdict.Code == VC(linux.NFT_BREAK); gotBreak != test.wantBreak {
+				t.Errorf("lookup of %v broke = %t, want %t", test.key, gotBreak, test.wantBreak)
+			}
+		})
+	}
+}
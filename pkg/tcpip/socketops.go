@@ -15,6 +15,8 @@
 package tcpip
 
 import (
+	"time"
+
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/buffer"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -222,6 +224,15 @@ type SocketOptions struct {
 	// the incoming packet should be returned as an ancillary message.
 	receiveOriginalDstAddress atomicbitops.Uint32
 
+	// transparentEnabled is used to specify if the endpoint may bind to and
+	// send from addresses not assigned to the stack, and receive packets
+	// redirected to it by a TPROXY target.
+	transparentEnabled atomicbitops.Uint32
+
+	// freeBindEnabled is used to specify if the endpoint may bind to addresses
+	// not assigned to the stack.
+	freeBindEnabled atomicbitops.Uint32
+
 	// ipv4RecvErrEnabled determines whether extended reliable error message
 	// passing is enabled for IPv4.
 	ipv4RecvErrEnabled atomicbitops.Uint32
@@ -234,9 +245,30 @@ type SocketOptions struct {
 	errQueueMu sync.Mutex `state:"nosave"`
 	errQueue   sockErrorList
 
+	// errQueueSize is the approximate memory used by the entries of errQueue.
+	// It is protected by errQueueMu.
+	errQueueSize int64
+
+	// timestamping holds the TimestampingFlags set with SO_TIMESTAMPING.
+	timestamping atomicbitops.Uint32
+
+	// timestampingKey is the key of the next packet reported with
+	// TimestampingOptID.
+	timestampingKey atomicbitops.Uint32
+
 	// bindToDevice determines the device to which the socket is bound.
 	bindToDevice atomicbitops.Int32
 
+	// mark is the mark of the packets sent by the socket, as set with
+	// SO_MARK. It is used by policy routing and netfilter.
+	mark atomicbitops.Uint32
+
+	// xfrmInputBypass and xfrmOutputBypass determine whether the socket
+	// bypasses the IPsec input and output policies, as set with
+	// IP_XFRM_POLICY.
+	xfrmInputBypass  atomicbitops.Uint32
+	xfrmOutputBypass atomicbitops.Uint32
+
 	// getSendBufferLimits provides the handler to get the min, default and max
 	// size for send buffer. It is initialized at the creation time and will not
 	// change.
@@ -260,6 +292,18 @@ type SocketOptions struct {
 	// close. We currently implement this option for TCP socket only.
 	linger LingerOption
 
+	// filter is the classic BPF program attached with SO_ATTACH_FILTER, if
+	// any.
+	filter SocketFilter
+
+	// filterLocked determines whether filter is locked with SO_LOCK_FILTER,
+	// in which case it can't be replaced or detached.
+	filterLocked bool
+
+	// reusePortFilter is the classic BPF program attached with
+	// SO_ATTACH_REUSEPORT_CBPF, if any.
+	reusePortFilter SocketFilter
+
 	// rcvlowat specifies the minimum number of bytes which should be
 	// received to indicate the socket as readable.
 	rcvlowat atomicbitops.Int32
@@ -484,6 +528,26 @@ func (so *SocketOptions) SetReceiveOriginalDstAddress(v bool) {
 	storeAtomicBool(&so.receiveOriginalDstAddress, v)
 }
 
+// GetTransparent gets value for IP(V6)_TRANSPARENT option.
+func (so *SocketOptions) GetTransparent() bool {
+	return so.transparentEnabled.Load() != 0
+}
+
+// SetTransparent sets value for IP(V6)_TRANSPARENT option.
+func (so *SocketOptions) SetTransparent(v bool) {
+	storeAtomicBool(&so.transparentEnabled, v)
+}
+
+// GetFreeBind gets value for IP(V6)_FREEBIND option.
+func (so *SocketOptions) GetFreeBind() bool {
+	return so.freeBindEnabled.Load() != 0
+}
+
+// SetFreeBind sets value for IP(V6)_FREEBIND option.
+func (so *SocketOptions) SetFreeBind(v bool) {
+	storeAtomicBool(&so.freeBindEnabled, v)
+}
+
 // GetIPv4RecvError gets value for IP_RECVERR option.
 func (so *SocketOptions) GetIPv4RecvError() bool {
 	return so.ipv4RecvErrEnabled.Load() != 0
@@ -554,6 +618,9 @@ const (
 
 	// SockExtErrorOriginICMP6 indicates an IPv6 ICMP error.
 	SockExtErrorOriginICMP6
+
+	// SockExtErrorOriginTimestamping indicates a transmit timestamp report.
+	SockExtErrorOriginTimestamping
 )
 
 // IsICMPErr indicates if the error originated from an ICMP error.
@@ -603,6 +670,53 @@ func (l *LocalSockError) Info() uint32 {
 	return l.info
 }
 
+// TXTimestampKind is the point of the transmit path at which a transmit
+// timestamp was taken.
+type TXTimestampKind uint32
+
+const (
+	// TXTimestampSoftware is taken when the packet is passed to the link
+	// endpoint of the outgoing interface.
+	TXTimestampSoftware TXTimestampKind = iota
+
+	// TXTimestampSched is taken when the packet is passed to the queueing
+	// discipline of the outgoing interface.
+	TXTimestampSched
+)
+
+// TimestampingSockError is the cause of an error queue entry that reports a
+// transmit timestamp.
+//
+// +stateify savable
+type TimestampingSockError struct {
+	// Kind is the point at which the timestamp was taken.
+	Kind TXTimestampKind
+
+	// Key identifies the packet if TimestampingOptID was set when it was
+	// sent.
+	Key uint32
+}
+
+// Origin implements SockErrorCause.
+func (*TimestampingSockError) Origin() SockErrOrigin {
+	return SockExtErrorOriginTimestamping
+}
+
+// Type implements SockErrorCause.
+func (*TimestampingSockError) Type() uint8 {
+	return 0
+}
+
+// Code implements SockErrorCause.
+func (*TimestampingSockError) Code() uint8 {
+	return 0
+}
+
+// Info implements SockErrorCause.
+func (t *TimestampingSockError) Info() uint32 {
+	return uint32(t.Kind)
+}
+
 // SockError represents a queue entry in the per-socket error queue.
 //
 // +stateify savable
@@ -622,12 +736,25 @@ type SockError struct {
 	Offender FullAddress
 	// NetProto is the network protocol being used to transmit the packet.
 	NetProto NetworkProtocolNumber
+	// Timestamp is the transmit timestamp reported if Cause is a
+	// *TimestampingSockError.
+	Timestamp time.Time `state:".(int64)"`
+}
+
+// sockErrorOverhead approximates the memory used by an error queue entry in
+// addition to its payload, like SKB_TRUESIZE(0) in Linux.
+const sockErrorOverhead = 512
+
+// size returns the approximate memory used by the error queue entry.
+func (e *SockError) size() int64 {
+	return sockErrorOverhead + int64(e.Payload.Size())
 }
 
 // pruneErrQueue resets the queue.
 func (so *SocketOptions) pruneErrQueue() {
 	so.errQueueMu.Lock()
 	so.errQueue.Reset()
+	so.errQueueSize = 0
 	so.errQueueMu.Unlock()
 }
 
@@ -640,6 +767,7 @@ func (so *SocketOptions) DequeueErr() *SockError {
 	err := so.errQueue.Front()
 	if err != nil {
 		so.errQueue.Remove(err)
+		so.errQueueSize -= err.size()
 	}
 	return err
 }
@@ -659,6 +787,27 @@ func (so *SocketOptions) QueueErr(err *SockError) {
 	so.errQueueMu.Lock()
 	defer so.errQueueMu.Unlock()
 	so.errQueue.PushBack(err)
+	so.errQueueSize += err.size()
+}
+
+// QueueTXTimestamp queues a transmit timestamp report onto the error queue. As
+// in Linux, the report is dropped and false is returned if the error queue
+// would exceed the receive buffer size.
+func (so *SocketOptions) QueueTXTimestamp(cause *TimestampingSockError, timestamp time.Time, net NetworkProtocolNumber, payload *buffer.View) bool {
+	err := &SockError{
+		Cause:     cause,
+		Timestamp: timestamp,
+		Payload:   payload,
+		NetProto:  net,
+	}
+	so.errQueueMu.Lock()
+	defer so.errQueueMu.Unlock()
+	if so.errQueueSize+err.size() >= so.GetReceiveBufferSize() {
+		return false
+	}
+	so.errQueue.PushBack(err)
+	so.errQueueSize += err.size()
+	return true
 }
 
 // QueueLocalErr queues a local error onto the local queue.
@@ -672,6 +821,51 @@ func (so *SocketOptions) QueueLocalErr(err Error, net NetworkProtocolNumber, inf
 	})
 }
 
+// TimestampingFlags is a set of flags that control the transmit timestamps
+// reported for the packets sent by a socket, as set with SO_TIMESTAMPING.
+type TimestampingFlags uint32
+
+const (
+	// TimestampingTXSched requests a timestamp when a packet is passed to the
+	// queueing discipline of the outgoing interface.
+	TimestampingTXSched TimestampingFlags = 1 << iota
+
+	// TimestampingTXSoftware requests a timestamp when a packet is passed to
+	// the link endpoint of the outgoing interface.
+	TimestampingTXSoftware
+
+	// TimestampingOptID identifies the packets in timestamp reports with a
+	// per-socket counter.
+	TimestampingOptID
+
+	// TimestampingOptTSOnly omits the packet from timestamp reports.
+	TimestampingOptTSOnly
+)
+
+// TimestampingTXFlags is the set of TimestampingFlags that request transmit
+// timestamps.
+const TimestampingTXFlags = TimestampingTXSched | TimestampingTXSoftware
+
+// GetTimestamping gets value for SO_TIMESTAMPING option.
+func (so *SocketOptions) GetTimestamping() TimestampingFlags {
+	return TimestampingFlags(so.timestamping.Load())
+}
+
+// SetTimestamping sets value for SO_TIMESTAMPING option. As in Linux, the
+// packet counter restarts from zero when TimestampingOptID is enabled.
+func (so *SocketOptions) SetTimestamping(v TimestampingFlags) {
+	if v&TimestampingOptID != 0 && so.GetTimestamping()&TimestampingOptID == 0 {
+		so.timestampingKey.Store(0)
+	}
+	so.timestamping.Store(uint32(v))
+}
+
+// NextTimestampingKey returns the key identifying the next packet reported
+// with TimestampingOptID.
+func (so *SocketOptions) NextTimestampingKey() uint32 {
+	return so.timestampingKey.Add(1) - 1
+}
+
 // GetBindToDevice gets value for SO_BINDTODEVICE option.
 func (so *SocketOptions) GetBindToDevice() int32 {
 	return so.bindToDevice.Load()
@@ -688,6 +882,38 @@ func (so *SocketOptions) SetBindToDevice(bindToDevice int32) Error {
 	return nil
 }
 
+// GetMark gets value for SO_MARK option.
+func (so *SocketOptions) GetMark() uint32 {
+	return so.mark.Load()
+}
+
+// SetMark sets value for SO_MARK option.
+func (so *SocketOptions) SetMark(mark uint32) {
+	so.mark.Store(mark)
+}
+
+// GetXFRMInputBypass gets whether the socket bypasses the IPsec input policy.
+func (so *SocketOptions) GetXFRMInputBypass() bool {
+	return so.xfrmInputBypass.Load() != 0
+}
+
+// SetXFRMInputBypass sets whether the socket bypasses the IPsec input policy.
+func (so *SocketOptions) SetXFRMInputBypass(v bool) {
+	storeAtomicBool(&so.xfrmInputBypass, v)
+}
+
+// GetXFRMOutputBypass gets whether the socket bypasses the IPsec output
+// policy.
+func (so *SocketOptions) GetXFRMOutputBypass() bool {
+	return so.xfrmOutputBypass.Load() != 0
+}
+
+// SetXFRMOutputBypass sets whether the socket bypasses the IPsec output
+// policy.
+func (so *SocketOptions) SetXFRMOutputBypass(v bool) {
+	storeAtomicBool(&so.xfrmOutputBypass, v)
+}
+
 // GetSendBufferSize gets value for SO_SNDBUF option.
 func (so *SocketOptions) GetSendBufferSize() int64 {
 	return so.sendBufferSize.Load()
@@ -756,3 +982,87 @@ func (so *SocketOptions) SetRcvlowat(rcvlowat int32) Error {
 func (so *SocketOptions) GetAcceptConn() bool {
 	return so.handler.GetAcceptConn()
 }
+
+// SocketFilter is a classic BPF program attached to a socket.
+type SocketFilter interface {
+	// Run runs the program over pkt and returns its result.
+	Run(pkt []byte) uint32
+}
+
+// GetFilter gets value for SO_ATTACH_FILTER option.
+func (so *SocketOptions) GetFilter() SocketFilter {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	return so.filter
+}
+
+// SetFilter sets value for SO_ATTACH_FILTER option. A nil filter detaches the
+// attached one, as SO_DETACH_FILTER does.
+func (so *SocketOptions) SetFilter(filter SocketFilter) Error {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	if so.filterLocked {
+		return &ErrNotPermitted{}
+	}
+	if filter == nil && so.filter == nil {
+		return &ErrNoSuchFile{}
+	}
+	so.filter = filter
+	return nil
+}
+
+// GetLockFilter gets value for SO_LOCK_FILTER option.
+func (so *SocketOptions) GetLockFilter() bool {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	return so.filterLocked
+}
+
+// SetLockFilter sets value for SO_LOCK_FILTER option. Once set, it can't be
+// cleared.
+func (so *SocketOptions) SetLockFilter(v bool) Error {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	if so.filterLocked && !v {
+		return &ErrNotPermitted{}
+	}
+	so.filterLocked = v
+	return nil
+}
+
+// RunFilter runs the program attached with SO_ATTACH_FILTER, if any, over the
+// packet in buf. It returns false if the packet must be dropped, and otherwise
+// truncates buf to the length accepted by the program.
+func (so *SocketOptions) RunFilter(buf *buffer.Buffer) bool {
+	filter := so.GetFilter()
+	if filter == nil {
+		return true
+	}
+	n := filter.Run(buf.Flatten())
+	if n == 0 {
+		return false
+	}
+	if int64(n) < buf.Size() {
+		buf.Truncate(int64(n))
+	}
+	return true
+}
+
+// GetReusePortFilter gets value for SO_ATTACH_REUSEPORT_CBPF option.
+func (so *SocketOptions) GetReusePortFilter() SocketFilter {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	return so.reusePortFilter
+}
+
+// SetReusePortFilter sets value for SO_ATTACH_REUSEPORT_CBPF option. A nil
+// filter detaches the attached one, as SO_DETACH_REUSEPORT_BPF does.
+func (so *SocketOptions) SetReusePortFilter(filter SocketFilter) Error {
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	if filter == nil && so.reusePortFilter == nil {
+		return &ErrNoSuchFile{}
+	}
+	so.reusePortFilter = filter
+	return nil
+}
@@ -129,6 +129,10 @@ const (
 type conn struct {
 	ct *ConnTrack
 
+	// id identifies the connection in conntrack netlink messages. It is
+	// immutable.
+	id uint32
+
 	// original is the tuple in original direction. It is immutable.
 	original tuple
 
@@ -150,6 +154,9 @@ type conn struct {
 	// +checklocks:mu
 	destinationManip manipType
 
+	// mark is the connection mark, as set by CONNMARK targets.
+	mark atomicbitops.Uint32
+
 	stateMu stateConnRWMutex `state:"nosave"`
 	// tcb is TCB control block. It is used to keep track of states
 	// of tcp connection.
@@ -161,49 +168,109 @@ type conn struct {
 	//
 	// +checklocks:stateMu
 	lastUsed tcpip.MonotonicTime
+	// seenReply is whether a packet was seen in the reply direction.
+	//
+	// +checklocks:stateMu
+	seenReply bool
+	// counters holds the packets and bytes seen in the original and reply
+	// directions, in that order.
+	//
+	// +checklocks:stateMu
+	counters [2]ConntrackCounters
 }
 
 // timedOut returns whether the connection timed out based on its state.
 func (cn *conn) timedOut(now tcpip.MonotonicTime) bool {
 	cn.stateMu.RLock()
 	defer cn.stateMu.RUnlock()
+	return now.Sub(cn.lastUsed) > cn.timeoutLocked()
+}
+
+// timeoutLocked returns how long the connection may remain unused before it
+// is reaped.
+//
+// +checklocksread:cn.stateMu
+func (cn *conn) timeoutLocked() time.Duration {
 	if cn.tcb.State() == tcpconntrack.ResultAlive {
 		// Use the same default as Linux, which doesn't delete
 		// established connections for 5(!) days.
-		return now.Sub(cn.lastUsed) > establishedTimeout
+		return establishedTimeout
 	}
 	// Use the same default as Linux, which lets connections in most states
 	// other than established remain for <= 120 seconds.
-	return now.Sub(cn.lastUsed) > unestablishedTimeout
+	return unestablishedTimeout
+}
+
+// tcpStateLocked returns the state of a TCP connection as Linux names it.
+//
+// +checklocksread:cn.stateMu
+func (cn *conn) tcpStateLocked() ConntrackTCPState {
+	if cn.tcb.IsEmpty() {
+		return ConntrackTCPNone
+	}
+	switch cn.tcb.State() {
+	case tcpconntrack.ResultConnecting:
+		if cn.seenReply {
+			return ConntrackTCPSynRecv
+		}
+		return ConntrackTCPSynSent
+	case tcpconntrack.ResultAlive:
+		return ConntrackTCPEstablished
+	case tcpconntrack.ResultClosedByResponder, tcpconntrack.ResultClosedByOriginator:
+		return ConntrackTCPTimeWait
+	case tcpconntrack.ResultReset:
+		return ConntrackTCPClose
+	default:
+		return ConntrackTCPNone
+	}
 }
 
 // update the connection tracking state.
 func (cn *conn) update(pkt *PacketBuffer, reply bool) {
+	if cn.updateState(pkt, reply) && cn.confirmed() {
+		cn.ct.notify(ConntrackEventUpdate, cn)
+	}
+}
+
+// updateState updates the connection tracking state and its counters. It
+// returns whether the state reported to userspace changed.
+func (cn *conn) updateState(pkt *PacketBuffer, reply bool) bool {
 	cn.stateMu.Lock()
 	defer cn.stateMu.Unlock()
 
 	// Mark the connection as having been used recently so it isn't reaped.
 	cn.lastUsed = cn.ct.clock.NowMonotonic()
 
+	counters := &cn.counters[0]
+	if reply {
+		counters = &cn.counters[1]
+	}
+	counters.Packets++
+	counters.Bytes += uint64(len(pkt.NetworkHeader().Slice()) + len(pkt.TransportHeader().Slice()) + pkt.Data().Size())
+
+	changed := reply && !cn.seenReply
+	if reply {
+		cn.seenReply = true
+	}
+
 	if pkt.TransportProtocolNumber != header.TCPProtocolNumber {
-		return
+		return changed
 	}
 
 	tcpHeader := header.TCP(pkt.TransportHeader().Slice())
+	state := cn.tcpStateLocked()
 
 	// Update the state of tcb. tcb assumes it's always initialized on the
 	// client. However, we only need to know whether the connection is
 	// established or not, so the client/server distinction isn't important.
 	if cn.tcb.IsEmpty() {
 		cn.tcb.Init(tcpHeader, pkt.Data().Size())
-		return
-	}
-
-	if reply {
+	} else if reply {
 		cn.tcb.UpdateStateReply(tcpHeader, pkt.Data().Size())
 	} else {
 		cn.tcb.UpdateStateOriginal(tcpHeader, pkt.Data().Size())
 	}
+	return changed || cn.tcpStateLocked() != state
 }
 
 // ConnTrack tracks all connections created for NAT rules. Most users are
@@ -232,6 +299,16 @@ type ConnTrack struct {
 	// TODO(b/341946753): Restore when netstack is savable.
 	rand *rand.Rand `state:"nosave"`
 
+	// lastID is the ID of the last connection created.
+	lastID atomicbitops.Uint32
+
+	dispatcherMu sync.RWMutex `state:"nosave"`
+	// dispatcher receives the events of connections, if set. It is saved so
+	// that event subscribers keep receiving events after restore.
+	//
+	// +checklocks:dispatcherMu
+	dispatcher ConntrackDispatcher
+
 	mu connTrackRWMutex `state:"nosave"`
 	// mu protects the buckets slice, but not buckets' contents. Only take
 	// the write lock if you are modifying the slice or saving for S/R.
@@ -287,6 +364,55 @@ func getEmbeddedNetAndTransHeaders(pkt *PacketBuffer, netHdrLength int, getNetAn
 	return nil, nil, false
 }
 
+// sctpTransport adapts an SCTP packet to header.Transport so that its ports
+// can be rewritten by NAT. The SCTP checksum covers the whole packet but not
+// the network header, so it is recomputed when a port changes and is not
+// affected by address changes.
+type sctpTransport struct {
+	hdr header.SCTP
+	pkt *PacketBuffer
+}
+
+// SourcePort implements header.Transport.SourcePort.
+func (t sctpTransport) SourcePort() uint16 {
+	return t.hdr.SourcePort()
+}
+
+// DestinationPort implements header.Transport.DestinationPort.
+func (t sctpTransport) DestinationPort() uint16 {
+	return t.hdr.DestinationPort()
+}
+
+// Checksum implements header.Transport.Checksum. The 32-bit SCTP checksum
+// doesn't fit the interface and is maintained by the port setters instead.
+func (sctpTransport) Checksum() uint16 {
+	return 0
+}
+
+// SetSourcePort implements header.Transport.SetSourcePort.
+func (t sctpTransport) SetSourcePort(port uint16) {
+	t.hdr.SetSourcePort(port)
+	t.updateChecksum()
+}
+
+// SetDestinationPort implements header.Transport.SetDestinationPort.
+func (t sctpTransport) SetDestinationPort(port uint16) {
+	t.hdr.SetDestinationPort(port)
+	t.updateChecksum()
+}
+
+// SetChecksum implements header.Transport.SetChecksum.
+func (sctpTransport) SetChecksum(uint16) {}
+
+// Payload implements header.Transport.Payload.
+func (t sctpTransport) Payload() []byte {
+	return t.pkt.Data().AsRange().ToSlice()
+}
+
+func (t sctpTransport) updateChecksum() {
+	t.hdr.SetChecksum(t.hdr.CalculateChecksum(t.Payload()))
+}
+
 func getHeaders(pkt *PacketBuffer) (netHdr header.Network, transHdr header.Transport, isICMPError bool, ok bool) {
 	switch pkt.TransportProtocolNumber {
 	case header.TCPProtocolNumber:
@@ -299,6 +425,11 @@ func getHeaders(pkt *PacketBuffer) (netHdr header.Network, transHdr header.Trans
 			return pkt.Network(), udpHeader, false, true
 		}
 		return nil, nil, false, false
+	case header.SCTPProtocolNumber:
+		if sctpHeader := header.SCTP(pkt.TransportHeader().Slice()); len(sctpHeader) >= header.SCTPMinimumSize {
+			return pkt.Network(), sctpTransport{hdr: sctpHeader, pkt: pkt}, false, true
+		}
+		return nil, nil, false, false
 	case header.ICMPv4ProtocolNumber:
 		icmpHeader := header.ICMPv4(pkt.TransportHeader().Slice())
 		if len(icmpHeader) < header.ICMPv4MinimumSize {
@@ -426,6 +557,10 @@ func getTupleID(pkt *PacketBuffer) (tupleID, getTupleIDDisposition) {
 		if transHeader := header.UDP(pkt.TransportHeader().Slice()); len(transHeader) >= header.UDPMinimumSize {
 			return getTupleIDForRegularPacket(pkt.Network(), pkt.NetworkProtocolNumber, transHeader, pkt.TransportProtocolNumber), getTupleIDOKAndAllowNewConn
 		}
+	case header.SCTPProtocolNumber:
+		if transHeader := header.SCTP(pkt.TransportHeader().Slice()); len(transHeader) >= header.SCTPMinimumSize {
+			return getTupleIDForRegularPacket(pkt.Network(), pkt.NetworkProtocolNumber, sctpTransport{hdr: transHeader, pkt: pkt}, pkt.TransportProtocolNumber), getTupleIDOKAndAllowNewConn
+		}
 	case header.ICMPv4ProtocolNumber:
 		icmp := header.ICMPv4(pkt.TransportHeader().Slice())
 		if len(icmp) < header.ICMPv4MinimumSize {
@@ -576,6 +711,7 @@ func (ct *ConnTrack) getConnAndUpdate(pkt *PacketBuffer, skipChecksumValidation
 		// for this new connection.
 		conn := &conn{
 			ct:       ct,
+			id:       ct.lastID.Add(1),
 			original: tuple{tupleID: tid},
 			reply:    tuple{tupleID: tid.reply(), reply: true},
 			lastUsed: now,
@@ -683,9 +819,15 @@ func (cn *conn) getFinalizeResult() finalizeResult {
 // goroutine will perform the work to finalize the connection, but all
 // goroutines will block until the finalizing goroutine finishes finalizing.
 func (cn *conn) finalize() bool {
+	confirmed := false
 	cn.finalizeOnce.Do(func() {
-		cn.finalizeResult.Store(uint32(cn.ct.finalize(cn)))
+		res := cn.ct.finalize(cn)
+		cn.finalizeResult.Store(uint32(res))
+		confirmed = res == finalizeResultSuccess
 	})
+	if confirmed {
+		cn.ct.notify(ConntrackEventNew, cn)
+	}
 
 	switch res := cn.getFinalizeResult(); res {
 	case finalizeResultSuccess:
@@ -1052,9 +1194,11 @@ func (ct *ConnTrack) reapUnused(start int, prevInterval time.Duration) (int, tim
 	now := ct.clock.NowMonotonic()
 	checked := 0
 	expired := 0
-	var idx int
+	var (
+		idx       int
+		destroyed []*conn
+	)
 	ct.mu.RLock()
-	defer ct.mu.RUnlock()
 	for i := 0; i < len(ct.buckets)/fractionPerReaping; i++ {
 		idx = (i + start) % len(ct.buckets)
 		bkt := &ct.buckets[idx]
@@ -1064,7 +1208,7 @@ func (ct *ConnTrack) reapUnused(start int, prevInterval time.Duration) (int, tim
 			nextTuple := tuple.Next()
 
 			checked++
-			if ct.reapTupleLocked(tuple, idx, bkt, now) {
+			if ct.reapTupleLocked(tuple, idx, bkt, now, &destroyed) {
 				expired++
 			}
 
@@ -1072,6 +1216,10 @@ func (ct *ConnTrack) reapUnused(start int, prevInterval time.Duration) (int, tim
 		}
 		bkt.mu.Unlock()
 	}
+	ct.mu.RUnlock()
+	for _, cn := range destroyed {
+		ct.notify(ConntrackEventDestroy, cn)
+	}
 	// We already checked buckets[idx].
 	idx++
 
@@ -1093,12 +1241,13 @@ func (ct *ConnTrack) reapUnused(start int, prevInterval time.Duration) (int, tim
 }
 
 // reapTupleLocked tries to remove tuple and its reply from the table. It
-// returns whether the tuple's connection has timed out.
+// returns whether the tuple's connection has timed out. Confirmed
+// connections that are removed are appended to destroyed.
 //
 // Precondition: ct.mu is read locked and bkt.mu is write locked.
 // +checklocksread:ct.mu
 // +checklocks:bkt.mu
-func (ct *ConnTrack) reapTupleLocked(reapingTuple *tuple, bktID int, bkt *bucket, now tcpip.MonotonicTime) bool {
+func (ct *ConnTrack) reapTupleLocked(reapingTuple *tuple, bktID int, bkt *bucket, now tcpip.MonotonicTime, destroyed *[]*conn) bool {
 	if !reapingTuple.conn.timedOut(now) {
 		return false
 	}
@@ -1136,6 +1285,7 @@ func (ct *ConnTrack) reapTupleLocked(reapingTuple *tuple, bktID int, bkt *bucket
 		otherTupleBkt.tuples.Remove(otherTuple)
 		otherTupleBkt.mu.NestedUnlock(bucketLockOthertuple)
 	}
+	*destroyed = append(*destroyed, reapingTuple.conn)
 
 	return true
 }
@@ -0,0 +1,405 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcpconntrack"
+)
+
+// This file exposes the connections tracked by ConnTrack, as Linux does with
+// ctnetlink and /proc/net/nf_conntrack. Only confirmed connections, whose
+// first packet went through all the hooks, are visible.
+
+// ConntrackTCPState is the state of a tracked TCP connection. The values are
+// those of enum tcp_conntrack in Linux.
+type ConntrackTCPState uint8
+
+// The states of tracked TCP connections.
+const (
+	ConntrackTCPNone ConntrackTCPState = iota
+	ConntrackTCPSynSent
+	ConntrackTCPSynRecv
+	ConntrackTCPEstablished
+	ConntrackTCPFinWait
+	ConntrackTCPCloseWait
+	ConntrackTCPLastAck
+	ConntrackTCPTimeWait
+	ConntrackTCPClose
+)
+
+var conntrackTCPStateNames = [...]string{
+	ConntrackTCPNone:        "NONE",
+	ConntrackTCPSynSent:     "SYN_SENT",
+	ConntrackTCPSynRecv:     "SYN_RECV",
+	ConntrackTCPEstablished: "ESTABLISHED",
+	ConntrackTCPFinWait:     "FIN_WAIT",
+	ConntrackTCPCloseWait:   "CLOSE_WAIT",
+	ConntrackTCPLastAck:     "LAST_ACK",
+	ConntrackTCPTimeWait:    "TIME_WAIT",
+	ConntrackTCPClose:       "CLOSE",
+}
+
+// String returns the name Linux gives to the state.
+func (s ConntrackTCPState) String() string {
+	if int(s) < len(conntrackTCPStateNames) {
+		return conntrackTCPStateNames[s]
+	}
+	return "UNKNOWN"
+}
+
+// ConntrackTuple identifies a tracked connection in one direction.
+type ConntrackTuple struct {
+	NetProto   tcpip.NetworkProtocolNumber
+	TransProto tcpip.TransportProtocolNumber
+	SrcAddr    tcpip.Address
+	DstAddr    tcpip.Address
+
+	// SrcPort and DstPort are the ports of TCP, UDP and SCTP connections.
+	// For ICMP echo connections, the identifier is the SrcPort of the
+	// original tuple and the DstPort of the reply tuple, and the other port
+	// is zero.
+	SrcPort uint16
+	DstPort uint16
+}
+
+func (t ConntrackTuple) tupleID() tupleID {
+	return tupleID{
+		srcAddr:                   t.SrcAddr,
+		srcPortOrEchoRequestIdent: t.SrcPort,
+		dstAddr:                   t.DstAddr,
+		dstPortOrEchoReplyIdent:   t.DstPort,
+		transProto:                t.TransProto,
+		netProto:                  t.NetProto,
+	}
+}
+
+func (ti tupleID) conntrackTuple() ConntrackTuple {
+	return ConntrackTuple{
+		NetProto:   ti.netProto,
+		TransProto: ti.transProto,
+		SrcAddr:    ti.srcAddr,
+		DstAddr:    ti.dstAddr,
+		SrcPort:    ti.srcPortOrEchoRequestIdent,
+		DstPort:    ti.dstPortOrEchoReplyIdent,
+	}
+}
+
+// ConntrackCounters holds the packets and bytes seen in one direction of a
+// tracked connection. Bytes are counted from the network header.
+//
+// +stateify savable
+type ConntrackCounters struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// ConntrackEntry is a snapshot of a tracked connection.
+type ConntrackEntry struct {
+	// ID identifies the connection. It is never reused while the
+	// connection is tracked.
+	ID uint32
+
+	// Original is the tuple of the first packet of the connection, and Reply
+	// is the tuple expected of its replies, which reflects NAT.
+	Original ConntrackTuple
+	Reply    ConntrackTuple
+
+	// SeenReply is whether a packet was seen in the reply direction.
+	SeenReply bool
+
+	// Assured is whether the connection is established, or has seen
+	// traffic in both directions for other protocols than TCP.
+	Assured bool
+
+	// SrcNAT and DstNAT are whether the source or the destination of the
+	// connection is translated.
+	SrcNAT bool
+	DstNAT bool
+
+	// TCPState is the state of TCP connections.
+	TCPState ConntrackTCPState
+
+	// Timeout is the time left before the connection is removed, unless it
+	// sees more packets.
+	Timeout time.Duration
+
+	// Mark is the connection mark.
+	Mark uint32
+
+	// OriginalCounters and ReplyCounters count the traffic of each
+	// direction.
+	OriginalCounters ConntrackCounters
+	ReplyCounters    ConntrackCounters
+}
+
+// ConntrackFilter selects tracked connections.
+type ConntrackFilter struct {
+	// NetProto selects connections of the network protocol, or all of them
+	// if zero.
+	NetProto tcpip.NetworkProtocolNumber
+
+	// Mark and MarkMask select connections whose mark, masked with
+	// MarkMask, is Mark.
+	Mark     uint32
+	MarkMask uint32
+}
+
+func (f *ConntrackFilter) matches(cn *conn) bool {
+	if f.NetProto != 0 && cn.original.tupleID.netProto != f.NetProto {
+		return false
+	}
+	return cn.mark.Load()&f.MarkMask == f.Mark
+}
+
+// ConntrackEvent is a change of a tracked connection.
+type ConntrackEvent int
+
+const (
+	// ConntrackEventNew is reported when a connection is confirmed.
+	ConntrackEventNew ConntrackEvent = iota
+
+	// ConntrackEventUpdate is reported when the state of a connection
+	// changes.
+	ConntrackEventUpdate
+
+	// ConntrackEventDestroy is reported when a connection times out or is
+	// deleted.
+	ConntrackEventDestroy
+)
+
+// ConntrackDispatcher receives the events of tracked connections.
+// Implementations must be savable.
+type ConntrackDispatcher interface {
+	// OnConntrackEvent is called when a tracked connection changes. It is
+	// called with no conntrack locks held, possibly while processing a
+	// packet.
+	OnConntrackEvent(ev ConntrackEvent, entry ConntrackEntry)
+}
+
+// entry returns a snapshot of the connection. If zeroCounters is true, the
+// counters of the connection are reset.
+func (cn *conn) entry(now tcpip.MonotonicTime, zeroCounters bool) ConntrackEntry {
+	e := ConntrackEntry{
+		ID:       cn.id,
+		Original: cn.original.tupleID.conntrackTuple(),
+		Mark:     cn.mark.Load(),
+	}
+
+	cn.mu.RLock()
+	e.Reply = cn.reply.tupleID.conntrackTuple()
+	e.SrcNAT = cn.sourceManip == manipPerformed
+	e.DstNAT = cn.destinationManip == manipPerformed
+	cn.mu.RUnlock()
+
+	cn.stateMu.Lock()
+	defer cn.stateMu.Unlock()
+	e.SeenReply = cn.seenReply
+	e.OriginalCounters = cn.counters[0]
+	e.ReplyCounters = cn.counters[1]
+	if zeroCounters {
+		cn.counters = [2]ConntrackCounters{}
+	}
+	if e.Original.TransProto == header.TCPProtocolNumber {
+		e.TCPState = cn.tcpStateLocked()
+		switch cn.tcb.State() {
+		case tcpconntrack.ResultAlive, tcpconntrack.ResultClosedByResponder, tcpconntrack.ResultClosedByOriginator:
+			e.Assured = true
+		}
+	} else {
+		e.Assured = cn.seenReply
+	}
+	if left := cn.timeoutLocked() - now.Sub(cn.lastUsed); left > 0 {
+		e.Timeout = left
+	}
+	return e
+}
+
+// confirmed returns whether the connection went through all the hooks and
+// is visible.
+func (cn *conn) confirmed() bool {
+	return cn.getFinalizeResult() == finalizeResultSuccess
+}
+
+// notify reports an event of the connection to the dispatcher, if any.
+func (ct *ConnTrack) notify(ev ConntrackEvent, cn *conn) {
+	ct.dispatcherMu.RLock()
+	d := ct.dispatcher
+	ct.dispatcherMu.RUnlock()
+	if d != nil {
+		d.OnConntrackEvent(ev, cn.entry(ct.clock.NowMonotonic(), false /* zeroCounters */))
+	}
+}
+
+// conns returns the confirmed connections that match f and haven't timed
+// out.
+func (ct *ConnTrack) conns(f *ConntrackFilter) []*conn {
+	now := ct.clock.NowMonotonic()
+	var conns []*conn
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	for i := range ct.buckets {
+		bkt := &ct.buckets[i]
+		bkt.mu.RLock()
+		for t := bkt.tuples.Front(); t != nil; t = t.Next() {
+			// Connections are listed once, by their original tuple.
+			if t.reply || !t.conn.confirmed() || !f.matches(t.conn) || t.conn.timedOut(now) {
+				continue
+			}
+			conns = append(conns, t.conn)
+		}
+		bkt.mu.RUnlock()
+	}
+	return conns
+}
+
+// confirmedConnForTID returns the confirmed connection with a tuple tid, or
+// nil.
+func (ct *ConnTrack) confirmedConnForTID(tid tupleID) *conn {
+	t := ct.connForTID(tid)
+	if t == nil || !t.conn.confirmed() {
+		return nil
+	}
+	return t.conn
+}
+
+// remove removes a confirmed connection from the table. It returns false if
+// the connection was removed already.
+//
+// +checklocksignore: the buckets are chosen dynamically.
+func (ct *ConnTrack) remove(cn *conn) bool {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	origID := ct.bucket(cn.original.tupleID)
+	replyID := ct.bucket(cn.reply.tupleID)
+	origBkt, replyBkt := &ct.buckets[origID], &ct.buckets[replyID]
+
+	// Buckets are locked in the order of the table.
+	first, second := origBkt, replyBkt
+	if origID > replyID {
+		first, second = replyBkt, origBkt
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	if second != first {
+		second.mu.NestedLock(bucketLockOthertuple)
+		defer second.mu.NestedUnlock(bucketLockOthertuple)
+	}
+
+	// The connection may have been reaped or removed concurrently.
+	found := false
+	for t := origBkt.tuples.Front(); t != nil; t = t.Next() {
+		if t == &cn.original {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	origBkt.tuples.Remove(&cn.original)
+	replyBkt.tuples.Remove(&cn.reply)
+	return true
+}
+
+// conntrack returns the connection tracking table, or nil if connections
+// aren't tracked. Connections are tracked once iptables are modified.
+func (it *IPTables) conntrack() *ConnTrack {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	if !it.modified {
+		return nil
+	}
+	return &it.connections
+}
+
+// SetConntrackDispatcher sets the receiver of the events of tracked
+// connections. A nil d removes the current receiver.
+func (it *IPTables) SetConntrackDispatcher(d ConntrackDispatcher) {
+	ct := &it.connections
+	ct.dispatcherMu.Lock()
+	defer ct.dispatcherMu.Unlock()
+	ct.dispatcher = d
+}
+
+// ConntrackEntries returns the tracked connections that match f. If
+// zeroCounters is true, the counters of the connections are reset after
+// being read.
+func (it *IPTables) ConntrackEntries(f ConntrackFilter, zeroCounters bool) []ConntrackEntry {
+	ct := it.conntrack()
+	if ct == nil {
+		return nil
+	}
+	now := ct.clock.NowMonotonic()
+	conns := ct.conns(&f)
+	entries := make([]ConntrackEntry, 0, len(conns))
+	for _, cn := range conns {
+		entries = append(entries, cn.entry(now, zeroCounters))
+	}
+	return entries
+}
+
+// ConntrackEntry returns the tracked connection with the tuple t in either
+// direction. If zeroCounters is true, the counters of the connection are
+// reset after being read.
+func (it *IPTables) ConntrackEntry(t ConntrackTuple, zeroCounters bool) (ConntrackEntry, bool) {
+	ct := it.conntrack()
+	if ct == nil {
+		return ConntrackEntry{}, false
+	}
+	cn := ct.confirmedConnForTID(t.tupleID())
+	if cn == nil {
+		return ConntrackEntry{}, false
+	}
+	return cn.entry(ct.clock.NowMonotonic(), zeroCounters), true
+}
+
+// DeleteConntrackEntry removes the tracked connection with the tuple t in
+// either direction and returns it. If id isn't zero, the connection must
+// also have this ID. It fails with ErrNoSuchFile if there is no such
+// connection.
+func (it *IPTables) DeleteConntrackEntry(t ConntrackTuple, id uint32) (ConntrackEntry, tcpip.Error) {
+	ct := it.conntrack()
+	if ct == nil {
+		return ConntrackEntry{}, &tcpip.ErrNoSuchFile{}
+	}
+	cn := ct.confirmedConnForTID(t.tupleID())
+	if cn == nil || (id != 0 && cn.id != id) || !ct.remove(cn) {
+		return ConntrackEntry{}, &tcpip.ErrNoSuchFile{}
+	}
+	ct.notify(ConntrackEventDestroy, cn)
+	return cn.entry(ct.clock.NowMonotonic(), false /* zeroCounters */), nil
+}
+
+// FlushConntrack removes the tracked connections that match f. It returns
+// the number of connections removed.
+func (it *IPTables) FlushConntrack(f ConntrackFilter) int {
+	ct := it.conntrack()
+	if ct == nil {
+		return 0
+	}
+	n := 0
+	for _, cn := range ct.conns(&f) {
+		if ct.remove(cn) {
+			ct.notify(ConntrackEventDestroy, cn)
+			n++
+		}
+	}
+	return n
+}
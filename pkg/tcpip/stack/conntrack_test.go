@@ -15,7 +15,9 @@
 package stack
 
 import (
+	"slices"
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip"
@@ -266,6 +268,140 @@ func testWindowScaling(t *testing.T, windowSize uint16, synScale, synAckScale ui
 	ct.checkNumTuples(t, 0)
 }
 
+// testConntrackDispatcher records the events of tracked connections.
+type testConntrackDispatcher struct {
+	events []ConntrackEvent
+}
+
+// OnConntrackEvent implements ConntrackDispatcher.OnConntrackEvent.
+func (d *testConntrackDispatcher) OnConntrackEvent(ev ConntrackEvent, _ ConntrackEntry) {
+	d.events = append(d.events, ev)
+}
+
+func TestConntrackEntries(t *testing.T) {
+	// Initialize conntrack.
+	clock := faketime.NewManualClock()
+	var d testConntrackDispatcher
+	ct := ConnTrack{
+		clock:      clock,
+		dispatcher: &d,
+	}
+	ct.init()
+
+	var (
+		seqOrig        = uint32(10)
+		seqRepl        = uint32(20)
+		flags          = header.TCPFlags(header.TCPFlagSyn)
+		originatorAddr = testutil.MustParse4("1.0.0.1")
+		responderAddr  = testutil.MustParse4("1.0.0.2")
+		originatorPort = uint16(5555)
+		responderPort  = uint16(6666)
+	)
+	original := ConntrackTuple{
+		NetProto:   header.IPv4ProtocolNumber,
+		TransProto: header.TCPProtocolNumber,
+		SrcAddr:    originatorAddr,
+		DstAddr:    responderAddr,
+		SrcPort:    originatorPort,
+		DstPort:    responderPort,
+	}
+
+	// Send a SYN, simulating the Output and Postrouting hooks. The
+	// connection is only visible once confirmed.
+	synPkt := genTCPPacket(genTCPOpts{
+		seqNum:  &seqOrig,
+		flags:   &flags,
+		srcAddr: &originatorAddr,
+		dstAddr: &responderAddr,
+		srcPort: &originatorPort,
+		dstPort: &responderPort,
+	})
+	defer synPkt.DecRef()
+	synPkt.tuple = ct.getConnAndUpdate(synPkt, true /* skipChecksumValidation */)
+	if got := len(ct.conns(&ConntrackFilter{})); got != 0 {
+		t.Fatalf("got %d connections before confirmation, want 0", got)
+	}
+	synPkt.tuple.conn.finalize()
+	cn := synPkt.tuple.conn
+	synPkt.tuple = nil
+
+	conns := ct.conns(&ConntrackFilter{})
+	if len(conns) != 1 || conns[0] != cn {
+		t.Fatalf("got connections %v, want [%p]", conns, cn)
+	}
+	e := cn.entry(clock.NowMonotonic(), false /* zeroCounters */)
+	if e.Original != original {
+		t.Errorf("got original tuple %+v, want %+v", e.Original, original)
+	}
+	if e.TCPState != ConntrackTCPSynSent || e.SeenReply || e.Assured {
+		t.Errorf("got state %s, seen reply %t, assured %t, want SYN_SENT, false, false", e.TCPState, e.SeenReply, e.Assured)
+	}
+	if want := (ConntrackCounters{Packets: 1, Bytes: header.IPv4MinimumSize + header.TCPMinimumSize}); e.OriginalCounters != want {
+		t.Errorf("got original counters %+v, want %+v", e.OriginalCounters, want)
+	}
+	if e.Timeout != unestablishedTimeout {
+		t.Errorf("got timeout %s, want %s", e.Timeout, unestablishedTimeout)
+	}
+
+	// Send the SYN/ACK, simulating the Prerouting hook.
+	seqOrig++
+	flags |= header.TCPFlagAck
+	synAckPkt := genTCPPacket(genTCPOpts{
+		seqNum:  &seqRepl,
+		ackNum:  &seqOrig,
+		flags:   &flags,
+		srcAddr: &responderAddr,
+		dstAddr: &originatorAddr,
+		srcPort: &responderPort,
+		dstPort: &originatorPort,
+	})
+	defer synAckPkt.DecRef()
+	synAckPkt.tuple = ct.getConnAndUpdate(synAckPkt, true /* skipChecksumValidation */)
+	if synAckPkt.tuple == nil || synAckPkt.tuple.conn != cn {
+		t.Fatal("SYN/ACK doesn't belong to the connection")
+	}
+	clock.Advance(time.Second)
+	e = cn.entry(clock.NowMonotonic(), true /* zeroCounters */)
+	if e.TCPState != ConntrackTCPEstablished || !e.SeenReply || !e.Assured {
+		t.Errorf("got state %s, seen reply %t, assured %t, want ESTABLISHED, true, true", e.TCPState, e.SeenReply, e.Assured)
+	}
+	if e.ReplyCounters.Packets != 1 {
+		t.Errorf("got %d reply packets, want 1", e.ReplyCounters.Packets)
+	}
+	if want := establishedTimeout - time.Second; e.Timeout != want {
+		t.Errorf("got timeout %s, want %s", e.Timeout, want)
+	}
+	if e = cn.entry(clock.NowMonotonic(), false /* zeroCounters */); e.OriginalCounters != (ConntrackCounters{}) || e.ReplyCounters != (ConntrackCounters{}) {
+		t.Errorf("got counters %+v and %+v after zeroing them", e.OriginalCounters, e.ReplyCounters)
+	}
+
+	// The connection can be found by either tuple, and filtered by mark.
+	if ct.confirmedConnForTID(original.tupleID()) != cn || ct.confirmedConnForTID(cn.reply.tupleID) != cn {
+		t.Error("connection not found by its tuples")
+	}
+	cn.mark.Store(7)
+	if got := len(ct.conns(&ConntrackFilter{Mark: 3, MarkMask: 3})); got != 1 {
+		t.Errorf("got %d connections with mark 3/3, want 1", got)
+	}
+	if got := len(ct.conns(&ConntrackFilter{Mark: 1, MarkMask: 0xf})); got != 0 {
+		t.Errorf("got %d connections with mark 1/0xf, want 0", got)
+	}
+
+	// Remove the connection, once.
+	if !ct.remove(cn) {
+		t.Fatal("remove() = false, want true")
+	}
+	ct.checkNumTuples(t, 0)
+	if ct.remove(cn) {
+		t.Error("second remove() = true, want false")
+	}
+
+	want := []ConntrackEvent{ConntrackEventNew, ConntrackEventUpdate}
+	if !slices.Equal(d.events, want) {
+		t.Errorf("got events %v, want %v", d.events, want)
+	}
+}
+
 type genTCPOpts struct {
 	windowSize  *uint16
 	windowScale uint8
@@ -215,6 +215,24 @@ func EmptyNATTable() Table {
 	}
 }
 
+// EmptyMangleTable returns a Table with no rules and the mangle table chains
+// mapped to HookUnset.
+func EmptyMangleTable() Table {
+	return Table{
+		Rules: []Rule{},
+		BuiltinChains: [NumHooks]int{
+			Input:       HookUnset,
+			Forward:     HookUnset,
+			Postrouting: HookUnset,
+		},
+		Underflows: [NumHooks]int{
+			Input:       HookUnset,
+			Forward:     HookUnset,
+			Postrouting: HookUnset,
+		},
+	}
+}
+
 // GetTable returns a table with the given id and IP version. It panics when an
 // invalid id is provided.
 func (it *IPTables) GetTable(id TableID, ipv6 bool) Table {
@@ -268,6 +286,27 @@ func (it *IPTables) replaceTable(id TableID, table Table, ipv6, force bool) {
 	}
 }
 
+// SetPacketFilter installs f to be evaluated after the legacy tables at every
+// hook. A nil f removes the current filter.
+func (it *IPTables) SetPacketFilter(f PacketFilter) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if f != nil && !it.modified {
+		it.connections.init()
+		it.startReaper(reaperDelay)
+		it.modified = true
+	}
+	it.filter = f
+}
+
+// PacketFilter returns the filter installed by SetPacketFilter, or nil.
+func (it *IPTables) PacketFilter() PacketFilter {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	return it.filter
+}
+
 // A chainVerdict is what a table decides should be done with a packet.
 type chainVerdict int
 
@@ -292,7 +331,7 @@ type checkTable struct {
 // shouldSkipOrPopulateTables returns true iff IPTables should be skipped.
 //
 // If IPTables should not be skipped, tables will be updated with the
-// specified table.
+// specified table and the installed PacketFilter, if any, is returned.
 //
 // This is called in the hot path even when iptables are disabled, so we ensure
 // it does not allocate. We check recursively for heap allocations, but not for:
@@ -301,12 +340,12 @@ type checkTable struct {
 //   - Calls to dynamic functions, which can allocate.
 //
 // +checkescape:hard
-func (it *IPTables) shouldSkipOrPopulateTables(tables []checkTable, pkt *PacketBuffer) bool {
+func (it *IPTables) shouldSkipOrPopulateTables(tables []checkTable, pkt *PacketBuffer) (PacketFilter, bool) {
 	switch pkt.NetworkProtocolNumber {
 	case header.IPv4ProtocolNumber, header.IPv6ProtocolNumber:
 	default:
 		// IPTables only supports IPv4/IPv6.
-		return true
+		return nil, true
 	}
 
 	it.mu.RLock()
@@ -315,14 +354,14 @@ func (it *IPTables) shouldSkipOrPopulateTables(tables []checkTable, pkt *PacketB
 	if !it.modified {
 		// Many users never configure iptables. Spare them the cost of rule
 		// traversal if rules have never been set.
-		return true
+		return nil, true
 	}
 
 	for i := range tables {
 		table := &tables[i]
 		table.table = it.getTableRLocked(table.tableID, pkt.NetworkProtocolNumber == header.IPv6ProtocolNumber)
 	}
-	return false
+	return it.filter, false
 }
 
 // CheckPrerouting performs the prerouting hook on the packet.
@@ -348,7 +387,8 @@ func (it *IPTables) CheckPrerouting(pkt *PacketBuffer, addressEP AddressableEndp
 		},
 	}
 
-	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
+	filter, skip := it.shouldSkipOrPopulateTables(tables[:], pkt)
+	if skip {
 		return true
 	}
 
@@ -360,6 +400,10 @@ func (it *IPTables) CheckPrerouting(pkt *PacketBuffer, addressEP AddressableEndp
 		}
 	}
 
+	if filter != nil && !filter.CheckPacket(Prerouting, pkt) {
+		return false
+	}
+
 	return true
 }
 
@@ -386,7 +430,8 @@ func (it *IPTables) CheckInput(pkt *PacketBuffer, inNicName string) bool {
 		},
 	}
 
-	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
+	filter, skip := it.shouldSkipOrPopulateTables(tables[:], pkt)
+	if skip {
 		return true
 	}
 
@@ -396,6 +441,10 @@ func (it *IPTables) CheckInput(pkt *PacketBuffer, inNicName string) bool {
 		}
 	}
 
+	if filter != nil && !filter.CheckPacket(Input, pkt) {
+		return false
+	}
+
 	if t := pkt.tuple; t != nil {
 		pkt.tuple = nil
 		return t.conn.finalize()
@@ -422,7 +471,8 @@ func (it *IPTables) CheckForward(pkt *PacketBuffer, inNicName, outNicName string
 		},
 	}
 
-	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
+	filter, skip := it.shouldSkipOrPopulateTables(tables[:], pkt)
+	if skip {
 		return true
 	}
 
@@ -432,6 +482,10 @@ func (it *IPTables) CheckForward(pkt *PacketBuffer, inNicName, outNicName string
 		}
 	}
 
+	if filter != nil && !filter.CheckPacket(Forward, pkt) {
+		return false
+	}
+
 	return true
 }
 
@@ -462,7 +516,8 @@ func (it *IPTables) CheckOutput(pkt *PacketBuffer, r *Route, outNicName string)
 		},
 	}
 
-	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
+	filter, skip := it.shouldSkipOrPopulateTables(tables[:], pkt)
+	if skip {
 		return true
 	}
 
@@ -476,6 +531,10 @@ func (it *IPTables) CheckOutput(pkt *PacketBuffer, r *Route, outNicName string)
 		}
 	}
 
+	if filter != nil && !filter.CheckPacket(Output, pkt) {
+		return false
+	}
+
 	return true
 }
 
@@ -502,7 +561,8 @@ func (it *IPTables) CheckPostrouting(pkt *PacketBuffer, r *Route, addressEP Addr
 		},
 	}
 
-	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
+	filter, skip := it.shouldSkipOrPopulateTables(tables[:], pkt)
+	if skip {
 		return true
 	}
 
@@ -512,6 +572,10 @@ func (it *IPTables) CheckPostrouting(pkt *PacketBuffer, r *Route, addressEP Addr
 		}
 	}
 
+	if filter != nil && !filter.CheckPacket(Postrouting, pkt) {
+		return false
+	}
+
 	if t := pkt.tuple; t != nil {
 		pkt.tuple = nil
 		return t.conn.finalize()
@@ -594,7 +658,7 @@ func (it *IPTables) check(table Table, hook Hook, pkt *PacketBuffer, r *Route, a
 			return true
 		case RuleDrop:
 			return false
-		case RuleJump, RuleReturn:
+		case RuleJump, RuleReturn, RuleContinue:
 			panic("Underflows should only return RuleAccept or RuleDrop.")
 		default:
 			panic(fmt.Sprintf("Unknown verdict: %d", v))
@@ -643,6 +707,10 @@ func (it *IPTables) checkChain(hook Hook, pkt *PacketBuffer, table Table, ruleId
 		case RuleReturn:
 			return chainReturn
 
+		case RuleContinue:
+			ruleIdx++
+			continue
+
 		case RuleJump:
 			// "Jumping" to the next rule just means we're
 			// continuing on down the list.
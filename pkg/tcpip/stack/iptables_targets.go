@@ -275,6 +275,203 @@ func (rt *RedirectTarget) Action(pkt *PacketBuffer, hook Hook, r *Route, address
 	return dnatAction(pkt, hook, r, rt.Port, address, true /* changePort */, true /* changeAddress */)
 }
 
+// TPROXYTarget redirects incoming packets to a local transparent endpoint
+// without modifying them, so that the endpoint sees their original
+// destination. As in Linux, a packet is delivered to the transparent endpoint
+// of the connection it belongs to if there is one, and to the transparent
+// endpoint bound to the target's address and port otherwise. Packets that no
+// transparent endpoint accepts are dropped.
+//
+// +stateify savable
+type TPROXYTarget struct {
+	// Addr is the address of the endpoint packets are redirected to. If it is
+	// unspecified, the primary address of the incoming interface is used.
+	//
+	// Immutable.
+	Addr tcpip.Address
+
+	// Port is the port of the endpoint packets are redirected to. If it is
+	// zero, the packet's destination port is used.
+	//
+	// Immutable.
+	Port uint16
+
+	// Mark and MarkMask change the mark of redirected packets to
+	// (mark &^ MarkMask) ^ Mark.
+	//
+	// Immutable.
+	Mark     uint32
+	MarkMask uint32
+
+	// NetworkProtocol is the network protocol the target is used with.
+	//
+	// Immutable.
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+// Action implements Target.Action.
+func (tt *TPROXYTarget) Action(pkt *PacketBuffer, hook Hook, _ *Route, addressEP AddressableEndpoint) (RuleVerdict, int) {
+	// Sanity check.
+	if tt.NetworkProtocol != pkt.NetworkProtocolNumber {
+		panic(fmt.Sprintf(
+			"TPROXYTarget.Action with NetworkProtocol %d called on packet with NetworkProtocolNumber %d",
+			tt.NetworkProtocol, pkt.NetworkProtocolNumber))
+	}
+
+	// Only incoming packets can be redirected to a local endpoint. Linux
+	// refuses rules that reach the target from other hooks; drop the packets
+	// they match instead.
+	if hook != Prerouting {
+		return RuleDrop, 0
+	}
+
+	var dstPort uint16
+	switch pkt.TransportProtocolNumber {
+	case header.TCPProtocolNumber:
+		tcpHeader := header.TCP(pkt.TransportHeader().Slice())
+		if len(tcpHeader) < header.TCPMinimumSize {
+			return RuleDrop, 0
+		}
+		dstPort = tcpHeader.DestinationPort()
+	case header.UDPProtocolNumber:
+		udpHeader := header.UDP(pkt.TransportHeader().Slice())
+		if len(udpHeader) < header.UDPMinimumSize {
+			return RuleDrop, 0
+		}
+		dstPort = udpHeader.DestinationPort()
+	default:
+		return RuleDrop, 0
+	}
+
+	address := tt.Addr
+	if address.BitLen() == 0 {
+		// addressEP is expected to be set for the prerouting hook.
+		address = addressEP.MainAddress().Address
+		if address.BitLen() == 0 {
+			return RuleDrop, 0
+		}
+	}
+	port := tt.Port
+	if port == 0 {
+		port = dstPort
+	}
+
+	pkt.tproxied = true
+	pkt.tproxyAddr = tcpip.FullAddress{Addr: address, Port: port}
+	pkt.Mark = (pkt.Mark &^ tt.MarkMask) ^ tt.Mark
+	return RuleAccept, 0
+}
+
+// MarkTarget changes the mark of packets to (mark &^ Mask) ^ Mark and
+// continues to the next rule.
+//
+// +stateify savable
+type MarkTarget struct {
+	// Mark is the value XORed into the mark.
+	//
+	// Immutable.
+	Mark uint32
+
+	// Mask selects the bits of the mark that are cleared.
+	//
+	// Immutable.
+	Mask uint32
+
+	// NetworkProtocol is the network protocol the target is used with.
+	//
+	// Immutable.
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+// Action implements Target.Action.
+func (mt *MarkTarget) Action(pkt *PacketBuffer, _ Hook, _ *Route, _ AddressableEndpoint) (RuleVerdict, int) {
+	// Sanity check.
+	if mt.NetworkProtocol != pkt.NetworkProtocolNumber {
+		panic(fmt.Sprintf(
+			"MarkTarget.Action with NetworkProtocol %d called on packet with NetworkProtocolNumber %d",
+			mt.NetworkProtocol, pkt.NetworkProtocolNumber))
+	}
+
+	pkt.Mark = (pkt.Mark &^ mt.Mask) ^ mt.Mark
+	return RuleContinue, 0
+}
+
+// ConnMarkMode is the operation performed by a ConnMarkTarget.
+type ConnMarkMode uint8
+
+const (
+	// ConnMarkSet sets the connection mark to
+	// (connection mark &^ CTMask) ^ Mark.
+	ConnMarkSet ConnMarkMode = iota
+
+	// ConnMarkSave sets the connection mark to
+	// (connection mark &^ CTMask) ^ (packet mark & NFMask).
+	ConnMarkSave
+
+	// ConnMarkRestore sets the packet mark to
+	// (packet mark &^ NFMask) ^ (connection mark & CTMask).
+	ConnMarkRestore
+)
+
+// ConnMarkTarget changes the mark of the connection packets belong to, or
+// restores the packets' mark from it, and continues to the next rule.
+// Untracked packets are left unchanged.
+//
+// +stateify savable
+type ConnMarkTarget struct {
+	// Mode is the operation performed by the target.
+	//
+	// Immutable.
+	Mode ConnMarkMode
+
+	// Mark is the value XORed into the connection mark by ConnMarkSet.
+	//
+	// Immutable.
+	Mark uint32
+
+	// CTMask selects bits of the connection mark.
+	//
+	// Immutable.
+	CTMask uint32
+
+	// NFMask selects bits of the packet mark.
+	//
+	// Immutable.
+	NFMask uint32
+
+	// NetworkProtocol is the network protocol the target is used with.
+	//
+	// Immutable.
+	NetworkProtocol tcpip.NetworkProtocolNumber
+}
+
+// Action implements Target.Action.
+func (ct *ConnMarkTarget) Action(pkt *PacketBuffer, _ Hook, _ *Route, _ AddressableEndpoint) (RuleVerdict, int) {
+	// Sanity check.
+	if ct.NetworkProtocol != pkt.NetworkProtocolNumber {
+		panic(fmt.Sprintf(
+			"ConnMarkTarget.Action with NetworkProtocol %d called on packet with NetworkProtocolNumber %d",
+			ct.NetworkProtocol, pkt.NetworkProtocolNumber))
+	}
+
+	t := pkt.tuple
+	if t == nil {
+		return RuleContinue, 0
+	}
+	connMark := &t.conn.mark
+	switch ct.Mode {
+	case ConnMarkSet:
+		connMark.Store((connMark.Load() &^ ct.CTMask) ^ ct.Mark)
+	case ConnMarkSave:
+		connMark.Store((connMark.Load() &^ ct.CTMask) ^ (pkt.Mark & ct.NFMask))
+	case ConnMarkRestore:
+		pkt.Mark = (pkt.Mark &^ ct.NFMask) ^ (connMark.Load() & ct.CTMask)
+	default:
+		panic(fmt.Sprintf("unknown connmark mode %d", ct.Mode))
+	}
+	return RuleContinue, 0
+}
+
 // SNATTarget modifies the source port/IP in the outgoing packets.
 //
 // +stateify savable
@@ -330,6 +527,10 @@ func snatAction(pkt *PacketBuffer, hook Hook, r *Route, port uint16, address tcp
 		if port == 0 {
 			portsOrIdents = targetPortRangeForTCPAndUDP(header.TCP(pkt.TransportHeader().Slice()).SourcePort())
 		}
+	case header.SCTPProtocolNumber:
+		if port == 0 {
+			portsOrIdents = targetPortRangeForTCPAndUDP(header.SCTP(pkt.TransportHeader().Slice()).SourcePort())
+		}
 	case header.ICMPv4ProtocolNumber, header.ICMPv6ProtocolNumber:
 		// Allow NAT-ing to any 16-bit value for ICMP's Ident field to match Linux
 		// behaviour.
@@ -475,6 +676,12 @@ func rewritePacket(n header.Network, t header.Transport, updateSRCFields, fullCh
 		}
 
 		t.UpdateChecksumPseudoHeaderAddress(oldAddr, newAddr)
+	case sctpTransport:
+		if updateSRCFields {
+			t.SetSourcePort(newPortOrIdent)
+		} else {
+			t.SetDestinationPort(newPortOrIdent)
+		}
 	default:
 		panic(fmt.Sprintf("unhandled transport = %#v", t))
 	}
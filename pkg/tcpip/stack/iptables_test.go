@@ -18,6 +18,7 @@ import (
 	"math/rand"
 	"testing"
 
+	"gvisor.dev/gvisor/pkg/buffer"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -429,3 +430,146 @@ func TestNATConflict(t *testing.T) {
 		})
 	}
 }
+
+// TestSCTPDNAT tests that DNAT rewrites the destination port of SCTP packets
+// and keeps their CRC32c checksum valid.
+func TestSCTPDNAT(t *testing.T) {
+	clock := faketime.NewManualClock()
+	iptables := DefaultTables(clock, rand.New(rand.NewSource(0 /* seed */)))
+	table := Table{
+		Rules: []Rule{
+			// Prerouting
+			{
+				Target: &DNATTarget{NetworkProtocol: netProto, Port: nattedPort, ChangePort: true},
+			},
+			{
+				Target: &AcceptTarget{},
+			},
+
+			// Input
+			{
+				Target: &AcceptTarget{},
+			},
+
+			// Forward
+			{
+				Target: &AcceptTarget{},
+			},
+
+			// Output
+			{
+				Target: &AcceptTarget{},
+			},
+
+			// Postrouting
+			{
+				Target: &AcceptTarget{},
+			},
+		},
+		BuiltinChains: [NumHooks]int{
+			Prerouting:  0,
+			Input:       2,
+			Forward:     3,
+			Output:      4,
+			Postrouting: 5,
+		},
+	}
+	iptables.ForceReplaceTable(NATID, table, ipv6)
+
+	chunk := header.NewSCTPChunk(header.SCTPChunkCookieAck, 0 /* flags */, 0 /* valueLen */)
+	pkt := NewPacketBuffer(PacketBufferOptions{
+		ReserveHeaderBytes: header.IPv6MinimumSize + header.SCTPMinimumSize,
+		Payload:            buffer.MakeWithData(chunk),
+	})
+	defer pkt.DecRef()
+	sctp := header.SCTP(pkt.TransportHeader().Push(header.SCTPMinimumSize))
+	sctp.Encode(&header.SCTPFields{
+		SrcPort:         srcPort,
+		DstPort:         dstPort,
+		VerificationTag: 1,
+	})
+	sctp.SetChecksum(sctp.CalculateChecksum(chunk))
+	pkt.TransportProtocolNumber = header.SCTPProtocolNumber
+	ip := header.IPv6(pkt.NetworkHeader().Push(header.IPv6MinimumSize))
+	ip.Encode(&header.IPv6Fields{
+		PayloadLength:     uint16(len(sctp) + len(chunk)),
+		TransportProtocol: header.SCTPProtocolNumber,
+		HopLimit:          64,
+		SrcAddr:           srcAddr,
+		DstAddr:           dstAddr,
+	})
+	pkt.NetworkProtocolNumber = header.IPv6ProtocolNumber
+
+	if !iptables.CheckPrerouting(pkt, nil /* addressEP */, "" /* inNicName */) {
+		t.Fatal("got iptables.CheckPrerouting(...) = false, want = true")
+	}
+	if got := sctp.DestinationPort(); got != nattedPort {
+		t.Errorf("got sctp.DestinationPort() = %d, want = %d", got, nattedPort)
+	}
+	if got := sctp.SourcePort(); got != srcPort {
+		t.Errorf("got sctp.SourcePort() = %d, want = %d", got, srcPort)
+	}
+	if !sctp.IsChecksumValid(chunk) {
+		t.Errorf("got sctp.IsChecksumValid(_) = false, want = true")
+	}
+}
+
+// TestMarkAndConnMark tests that MARK and CONNMARK targets change the mark of
+// packets and connections, and that it is restored on later packets of the
+// connection.
+func TestMarkAndConnMark(t *testing.T) {
+	clock := faketime.NewManualClock()
+	iptables := DefaultTables(clock, rand.New(rand.NewSource(0 /* seed */)))
+
+	// mangleTable returns a mangle table whose prerouting chain runs targets
+	// then accepts.
+	mangleTable := func(targets ...Target) Table {
+		table := EmptyMangleTable()
+		for _, target := range targets {
+			table.Rules = append(table.Rules, Rule{Filter: EmptyFilter6(), Target: target})
+		}
+		accept := len(table.Rules)
+		table.Rules = append(table.Rules, Rule{Filter: EmptyFilter6(), Target: &AcceptTarget{NetworkProtocol: netProto}})
+		table.BuiltinChains[Prerouting] = 0
+		table.BuiltinChains[Output] = accept
+		table.Underflows[Prerouting] = accept
+		table.Underflows[Output] = accept
+		return table
+	}
+
+	const (
+		initialMark = 0x101
+		wantMark    = 0x110
+	)
+
+	iptables.ReplaceTable(MangleID, mangleTable(
+		&MarkTarget{Mark: 0x10, Mask: 0xff, NetworkProtocol: netProto},
+		&ConnMarkTarget{Mode: ConnMarkSave, CTMask: ^uint32(0), NFMask: ^uint32(0), NetworkProtocol: netProto},
+	), ipv6)
+
+	pkt := v6PacketBuffer()
+	defer pkt.DecRef()
+	pkt.Mark = initialMark
+	if !iptables.CheckPrerouting(pkt, nil /* addressEP */, "" /* inNicName */) {
+		t.Fatal("got iptables.CheckPrerouting(...) = false, want = true")
+	}
+	if pkt.Mark != wantMark {
+		t.Errorf("got pkt.Mark = %#x, want = %#x", pkt.Mark, wantMark)
+	}
+	if connMark, ok := pkt.ConnMark(); !ok || connMark != wantMark {
+		t.Errorf("got pkt.ConnMark() = (%#x, %t), want = (%#x, true)", connMark, ok, wantMark)
+	}
+
+	iptables.ReplaceTable(MangleID, mangleTable(
+		&ConnMarkTarget{Mode: ConnMarkRestore, CTMask: ^uint32(0), NFMask: ^uint32(0), NetworkProtocol: netProto},
+	), ipv6)
+
+	pkt2 := v6PacketBuffer()
+	defer pkt2.DecRef()
+	if !iptables.CheckPrerouting(pkt2, nil /* addressEP */, "" /* inNicName */) {
+		t.Fatal("got iptables.CheckPrerouting(...) = false, want = true")
+	}
+	if pkt2.Mark != wantMark {
+		t.Errorf("got pkt2.Mark = %#x, want = %#x", pkt2.Mark, wantMark)
+	}
+}
@@ -74,6 +74,11 @@ const (
 
 	// RuleReturn indicates the packet should return to the previous chain.
 	RuleReturn
+
+	// RuleContinue indicates the packet should continue to the next rule
+	// in the chain. It is returned by targets that only modify the packet,
+	// like Linux's XT_CONTINUE.
+	RuleContinue
 )
 
 // IPTables holds all the tables for a netstack.
@@ -101,6 +106,21 @@ type IPTables struct {
 	//
 	// +checklocks:mu
 	modified bool
+
+	// filter is an additional packet filter evaluated after the legacy
+	// tables at every hook. It is used to back nf_tables rulesets.
+	//
+	// +checklocks:mu
+	filter PacketFilter
+}
+
+// PacketFilter is a packet filter that is evaluated alongside the legacy
+// iptables tables. Implementations must be savable.
+type PacketFilter interface {
+	// CheckPacket evaluates the packet at the given hook, possibly modifying
+	// it in place. It returns true iff the packet may continue traversing
+	// the stack.
+	CheckPacket(hook Hook, pkt *PacketBuffer) bool
 }
 
 // Modified returns whether iptables has been modified. It is inherently racy
@@ -79,6 +79,14 @@ type nic struct {
 	// +checklocks:packetEPsMu
 	packetEPs map[tcpip.NetworkProtocolNumber]*packetEndpointList
 
+	// defaultQDisc is the queueing discipline the NIC was created with. It
+	// is used whenever no other discipline is set.
+	defaultQDisc QueueingDiscipline
+
+	// qDiscMu protects qDisc, which may be replaced while the NIC is in use.
+	qDiscMu nicQDiscRWMutex `state:"nosave"`
+
+	// +checklocks:qDiscMu
 	qDisc QueueingDiscipline
 
 	// deliverLinkPackets specifies whether this NIC delivers packets to
@@ -154,6 +162,7 @@ func (*delegatingQueueingDiscipline) Close() {}
 
 // WritePacket passes the packet through to the underlying LinkWriter's WritePackets.
 func (qDisc *delegatingQueueingDiscipline) WritePacket(pkt *PacketBuffer) tcpip.Error {
+	pkt.ReportTXTimestamp(tcpip.TXTimestampSoftware)
 	var pkts PacketBufferList
 	pkts.PushBack(pkt)
 	_, err := qDisc.LinkWriter.WritePackets(pkts)
@@ -186,6 +195,7 @@ func newNIC(stack *Stack, id tcpip.NICID, ep LinkEndpoint, opts NICOptions) *nic
 		networkEndpoints:          make(map[tcpip.NetworkProtocolNumber]NetworkEndpoint),
 		linkAddrResolvers:         make(map[tcpip.NetworkProtocolNumber]*linkResolver),
 		duplicateAddressDetectors: make(map[tcpip.NetworkProtocolNumber]DuplicateAddressDetector),
+		defaultQDisc:              qDisc,
 		qDisc:                     qDisc,
 		deliverLinkPackets:        opts.DeliverLinkPackets,
 	}
@@ -331,7 +341,10 @@ func (n *nic) remove(closeLinkEndpoint bool) (func(), tcpip.Error) {
 
 	var deferAct func()
 	// Prevent packets from going down to the link before shutting the link down.
-	n.qDisc.Close()
+	if qDisc := n.queueingDiscipline(); qDisc != n.defaultQDisc {
+		qDisc.Close()
+	}
+	n.defaultQDisc.Close()
 	n.NetworkLinkEndpoint.Attach(nil)
 	if closeLinkEndpoint {
 		ep := n.NetworkLinkEndpoint
@@ -415,6 +428,35 @@ func (n *nic) writeRawPacketWithLinkHeaderInPayload(pkt *PacketBuffer) tcpip.Err
 	return n.writeRawPacket(pkt)
 }
 
+// queueingDiscipline returns the queueing discipline outgoing packets are
+// written to.
+func (n *nic) queueingDiscipline() QueueingDiscipline {
+	n.qDiscMu.RLock()
+	defer n.qDiscMu.RUnlock()
+	return n.qDisc
+}
+
+// setQueueingDiscipline replaces the queueing discipline of the NIC with the
+// one returned by newQDisc, or restores the default discipline if newQDisc is
+// nil. The previous discipline is closed, dropping the packets it holds,
+// unless it is the default one.
+func (n *nic) setQueueingDiscipline(newQDisc func(lower LinkWriter) QueueingDiscipline) {
+	qDisc := n.defaultQDisc
+	if newQDisc != nil {
+		// NetworkLinkEndpoint is the LinkEndpoint the NIC was created with.
+		qDisc = newQDisc(n.NetworkLinkEndpoint.(LinkEndpoint))
+	}
+
+	n.qDiscMu.Lock()
+	old := n.qDisc
+	n.qDisc = qDisc
+	n.qDiscMu.Unlock()
+
+	if old != n.defaultQDisc {
+		old.Close()
+	}
+}
+
 func (n *nic) writeRawPacket(pkt *PacketBuffer) tcpip.Error {
 	// Always an outgoing packet.
 	pkt.PktType = tcpip.PacketOutgoing
@@ -423,7 +465,8 @@ func (n *nic) writeRawPacket(pkt *PacketBuffer) tcpip.Error {
 		n.DeliverLinkPacket(pkt.NetworkProtocolNumber, pkt)
 	}
 
-	if err := n.qDisc.WritePacket(pkt); err != nil {
+	pkt.ReportTXTimestamp(tcpip.TXTimestampSched)
+	if err := n.queueingDiscipline().WritePacket(pkt); err != nil {
 		if _, ok := err.(*tcpip.ErrNoBufferSpace); ok {
 			n.stats.txPacketsDroppedNoBufferSpace.Increment()
 		}
@@ -723,6 +766,22 @@ func (n *nic) leaveGroup(protocol tcpip.NetworkProtocolNumber, addr tcpip.Addres
 	return gep.LeaveGroup(addr)
 }
 
+// updateGroupFilter changes the source filter of a join of the given multicast
+// address from oldFilter to newFilter.
+func (n *nic) updateGroupFilter(protocol tcpip.NetworkProtocolNumber, addr tcpip.Address, oldFilter, newFilter tcpip.MulticastSourceFilter) tcpip.Error {
+	ep := n.getNetworkEndpoint(protocol)
+	if ep == nil {
+		return &tcpip.ErrNotSupported{}
+	}
+
+	gep, ok := ep.(GroupAddressableEndpoint)
+	if !ok {
+		return &tcpip.ErrNotSupported{}
+	}
+
+	return gep.UpdateGroupFilter(addr, oldFilter, newFilter)
+}
+
 // isInGroup returns true if n has joined the multicast group addr.
 func (n *nic) isInGroup(addr tcpip.Address) bool {
 	for _, ep := range n.networkEndpoints {
@@ -831,6 +890,9 @@ func (n *nic) DeliverLinkPacket(protocol tcpip.NetworkProtocolNumber, pkt *Packe
 func (n *nic) DeliverTransportPacket(protocol tcpip.TransportProtocolNumber, pkt *PacketBuffer) TransportPacketDisposition {
 	state, ok := n.stack.transportProtocols[protocol]
 	if !ok {
+		if n.stack.deliverTunnelPacket(protocol, pkt) {
+			return TransportPacketHandled
+		}
 		n.stats.unknownL4ProtocolRcvdPacketCounts.Increment(uint64(protocol))
 		return TransportPacketProtocolUnreachable
 	}
@@ -860,9 +922,15 @@ func (n *nic) DeliverTransportPacket(protocol tcpip.TransportProtocolNumber, pkt
 		RemotePort:    srcPort,
 		RemoteAddress: src,
 	}
+	// Packets the IPsec input policy rejects are only delivered to sockets
+	// that bypass the policy.
+	pkt.xfrmRejected = !n.stack.xfrmInputAllowed(XFRMDirectionIn, pkt)
 	if n.stack.demux.deliverPacket(protocol, pkt, id) {
 		return TransportPacketHandled
 	}
+	if pkt.xfrmRejected {
+		return TransportPacketHandled
+	}
 
 	// Try to deliver to per-stack default handler.
 	if state.defaultHandler != nil {
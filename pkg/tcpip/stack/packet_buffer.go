@@ -134,6 +134,21 @@ type PacketBuffer struct {
 	// Only set for locally generated packets.
 	Owner tcpip.PacketOwner
 
+	// Mark is the firewall mark of the packet. It is set from the SO_MARK
+	// option of the sending socket for locally generated packets and can be
+	// changed by iptables targets. Policy routing rules can select on it.
+	Mark uint32
+
+	// TXTime is the earliest time at which the packet may be transmitted, as
+	// requested with SO_TXTIME. It is honoured by queueing disciplines that
+	// support earliest departure times. The zero value means the packet may
+	// be transmitted immediately.
+	TXTime tcpip.MonotonicTime
+
+	// txTimestamps holds the transmit timestamps requested for the packet,
+	// if any.
+	txTimestamps *txTimestampRequest
+
 	// The following fields are only set by the qdisc layer when the packet
 	// is added to a queue.
 	EgressRoute RouteInfo
@@ -147,6 +162,14 @@ type PacketBuffer struct {
 	// iptables NAT table.
 	dnatDone bool
 
+	// tproxied indicates that a TPROXY target redirected the packet to the
+	// transparent endpoint bound to tproxyAddr.
+	tproxied bool
+
+	// tproxyAddr is the local address the packet was redirected to. It is only
+	// set if tproxied is true.
+	tproxyAddr tcpip.FullAddress
+
 	// PktType indicates the SockAddrLink.PacketType of the packet as defined in
 	// https://www.man7.org/linux/man-pages/man7/packet.7.html.
 	PktType tcpip.PacketType
@@ -154,6 +177,23 @@ type PacketBuffer struct {
 	// NICID is the ID of the last interface the network packet was handled at.
 	NICID tcpip.NICID
 
+	// TunnelDepth is the number of tunnels an outgoing packet has been
+	// encapsulated by. It is used to break routing loops through tunnels.
+	TunnelDepth uint8
+
+	// XFRMBypass indicates that the IPsec output policy must not be applied
+	// to an outgoing packet, because the packet was already transformed or
+	// its socket bypasses the policy.
+	XFRMBypass bool
+
+	// xfrmInput is the IPsec state an incoming packet was received through,
+	// if any.
+	xfrmInput *xfrmState `state:"nosave"`
+
+	// xfrmRejected indicates that the IPsec input policy rejects an incoming
+	// packet, unless its socket bypasses the policy.
+	xfrmRejected bool
+
 	// RXChecksumValidated indicates that checksum verification may be
 	// safely skipped.
 	RXChecksumValidated bool
@@ -380,13 +420,21 @@ func (pk *PacketBuffer) Clone() *PacketBuffer {
 	newPk.headers = pk.headers
 	newPk.Hash = pk.Hash
 	newPk.Owner = pk.Owner
+	newPk.Mark = pk.Mark
+	newPk.TXTime = pk.TXTime
 	newPk.GSOOptions = pk.GSOOptions
 	newPk.NetworkProtocolNumber = pk.NetworkProtocolNumber
 	newPk.dnatDone = pk.dnatDone
 	newPk.snatDone = pk.snatDone
+	newPk.tproxied = pk.tproxied
+	newPk.tproxyAddr = pk.tproxyAddr
 	newPk.TransportProtocolNumber = pk.TransportProtocolNumber
 	newPk.PktType = pk.PktType
 	newPk.NICID = pk.NICID
+	newPk.TunnelDepth = pk.TunnelDepth
+	newPk.XFRMBypass = pk.XFRMBypass
+	newPk.xfrmInput = pk.xfrmInput
+	newPk.xfrmRejected = pk.xfrmRejected
 	newPk.RXChecksumValidated = pk.RXChecksumValidated
 	newPk.NetworkPacketInfo = pk.NetworkPacketInfo
 	newPk.tuple = pk.tuple
@@ -418,6 +466,83 @@ func (pk *PacketBuffer) Network() header.Network {
 	}
 }
 
+// ConnMark returns the mark of the connection the packet belongs to. It
+// returns false if the packet isn't tracked.
+func (pk *PacketBuffer) ConnMark() (uint32, bool) {
+	if pk.tuple == nil {
+		return 0, false
+	}
+	return pk.tuple.conn.mark.Load(), true
+}
+
+// TXTimestampHandler handles the transmit timestamps reported for packets.
+type TXTimestampHandler interface {
+	// HandleTXTimestamp is called when a transmit timestamp of the given kind
+	// is taken for pkt. key is the key the timestamps were requested with.
+	HandleTXTimestamp(kind tcpip.TXTimestampKind, key uint32, pkt *PacketBuffer)
+}
+
+// txTimestampRequest holds the transmit timestamps requested for a packet.
+//
+// +stateify savable
+type txTimestampRequest struct {
+	flags   tcpip.TimestampingFlags
+	key     uint32
+	handler TXTimestampHandler
+}
+
+// RequestTXTimestamps requests that the transmit timestamps in flags be
+// reported to h when the packet reaches the corresponding points of the
+// transmit path.
+func (pk *PacketBuffer) RequestTXTimestamps(flags tcpip.TimestampingFlags, key uint32, h TXTimestampHandler) {
+	if flags&tcpip.TimestampingTXFlags == 0 {
+		return
+	}
+	pk.txTimestamps = &txTimestampRequest{
+		flags:   flags,
+		key:     key,
+		handler: h,
+	}
+}
+
+// ReportTXTimestamp reports a transmit timestamp of the given kind for the
+// packet if one was requested. Queueing disciplines must report
+// tcpip.TXTimestampSoftware timestamps right before they pass packets to the
+// link endpoint.
+func (pk *PacketBuffer) ReportTXTimestamp(kind tcpip.TXTimestampKind) {
+	req := pk.txTimestamps
+	if req == nil {
+		return
+	}
+	var flag tcpip.TimestampingFlags
+	switch kind {
+	case tcpip.TXTimestampSoftware:
+		flag = tcpip.TimestampingTXSoftware
+	case tcpip.TXTimestampSched:
+		flag = tcpip.TimestampingTXSched
+	default:
+		panic(fmt.Sprintf("unknown transmit timestamp kind: %d", kind))
+	}
+	if req.flags&flag != 0 {
+		req.handler.HandleTXTimestamp(kind, req.key, pk)
+	}
+}
+
+// TransferTXTimestamps moves the transmit timestamps requested for the packet
+// to dst. It is used when a packet is replaced by others, such as fragments,
+// so that only the first of them is reported as in Linux.
+func (pk *PacketBuffer) TransferTXTimestamps(dst *PacketBuffer) {
+	dst.txTimestamps = pk.txTimestamps
+	pk.txTimestamps = nil
+}
+
+// TransparentProxied returns true if a TPROXY target redirected the packet to
+// a local transparent endpoint. Such packets are delivered locally even if
+// their destination address is not assigned to the stack.
+func (pk *PacketBuffer) TransparentProxied() bool {
+	return pk.tproxied
+}
+
 // CloneToInbound makes a semi-deep copy of the packet buffer (similar to
 // Clone) to be used as an inbound packet.
 //
@@ -464,6 +589,7 @@ func (pk *PacketBuffer) DeepCopyForForwarding(reservedHeaderBytes int) *PacketBu
 		newPk.TransportProtocolNumber = pk.TransportProtocolNumber
 	}
 
+	newPk.Mark = pk.Mark
 	newPk.tuple = pk.tuple
 
 	return newPk
@@ -767,3 +893,21 @@ func BufferSince(h PacketHeader) buffer.Buffer {
 	clone.TrimFront(int64(offset))
 	return clone
 }
+
+// FilterSince runs the program attached to a socket with SO_ATTACH_FILTER, if
+// any, over the packet starting from and including a particular header. It
+// returns false if the packet must be dropped, and otherwise the length of the
+// packet data accepted by the program.
+func FilterSince(ops *tcpip.SocketOptions, h PacketHeader) (int, bool) {
+	size := h.pk.Data().Size()
+	if ops.GetFilter() == nil {
+		return size, true
+	}
+	buf := BufferSince(h)
+	defer buf.Release()
+	hdrLen := int(buf.Size()) - size
+	if !ops.RunFilter(&buf) {
+		return 0, false
+	}
+	return min(size, max(int(buf.Size())-hdrLen, 0)), true
+}
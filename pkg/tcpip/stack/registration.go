@@ -332,6 +332,13 @@ type GroupAddressableEndpoint interface {
 	// LeaveGroup attempts to leave the specified group.
 	LeaveGroup(group tcpip.Address) tcpip.Error
 
+	// UpdateGroupFilter changes the source filter of a join of the specified
+	// group from oldFilter to newFilter.
+	//
+	// The group is joined if oldFilter is not joined and left if newFilter is
+	// not joined.
+	UpdateGroupFilter(group tcpip.Address, oldFilter, newFilter tcpip.MulticastSourceFilter) tcpip.Error
+
 	// IsInGroup returns true if the endpoint is a member of the specified group.
 	IsInGroup(group tcpip.Address) bool
 }
@@ -1160,6 +1167,10 @@ type QueueingDiscipline interface {
 	// To participate in transparent bridging, a LinkEndpoint implementation
 	// should call eth.Encode with header.EthernetFields.SrcAddr set to
 	// pkg.EgressRoute.LocalLinkAddress if it is provided.
+	//
+	// Implementations must call PacketBuffer.ReportTXTimestamp with
+	// tcpip.TXTimestampSoftware right before passing a packet to the link
+	// endpoint.
 	WritePacket(*PacketBuffer) tcpip.Error
 
 	Close()
@@ -315,6 +315,10 @@ func (r *Route) RequiresTXTransportChecksum() bool {
 	if r.local() {
 		return false
 	}
+	if r.outgoingNIC.stack.xfrm.hasPolicies.Load() {
+		// Checksums must be computed before IPsec encrypts packets.
+		return true
+	}
 	return r.outgoingNIC.NetworkLinkEndpoint.Capabilities()&CapabilityTXChecksumOffload == 0
 }
 
@@ -328,6 +332,10 @@ func (r *Route) HasGVisorGSOCapability() bool {
 
 // HasHostGSOCapability returns true if the route supports host GSO.
 func (r *Route) HasHostGSOCapability() bool {
+	if r.outgoingNIC.stack.xfrm.hasPolicies.Load() {
+		// Segments must be built before IPsec encrypts packets.
+		return false
+	}
 	if gso, ok := r.outgoingNIC.NetworkLinkEndpoint.(GSOEndpoint); ok {
 		return gso.SupportedGSO() == HostGSOSupported
 	}
@@ -16,6 +16,7 @@ package stack
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
 	"time"
 
@@ -26,4 +27,111 @@ import (
 func (s *Stack) afterLoad(context.Context) {
 	s.insecureRNG = rand.New(rand.NewSource(time.Now().UnixNano()))
 	s.secureRNG = cryptorand.RNGFrom(cryptorand.Reader)
+	s.restoreXFRM()
+}
+
+// saveTunnelHandlers is invoked by stateify.
+func (s *Stack) saveTunnelHandlers() tunnelHandlerMap {
+	handlers, _ := s.tunnelHandlers.Load().(tunnelHandlerMap)
+	return handlers
+}
+
+// loadTunnelHandlers is invoked by stateify.
+func (s *Stack) loadTunnelHandlers(_ context.Context, handlers tunnelHandlerMap) {
+	s.tunnelHandlers.Store(handlers)
+}
+
+// restoreXFRM rebuilds the ciphers of the IPsec states of the stack and rearms
+// the timers of their lifetimes, which aren't saved.
+func (s *Stack) restoreXFRM() {
+	db := &s.xfrm
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	now := s.clock.Now()
+	for _, st := range db.states {
+		st.mu.Lock()
+		st.restoreLocked(s, now)
+		st.mu.Unlock()
+	}
+}
+
+// restoreLocked rebuilds the cipher of a restored state and rearms the timers
+// of its lifetime. As in Linux, time limits are measured from the addition or
+// first use of the state, and limits reached while the stack was saved expire
+// right away.
+//
+// +checklocks:st.mu
+func (st *xfrmState) restoreLocked(s *Stack, now time.Time) {
+	if alg := st.cfg.AEAD; alg != nil {
+		aead, err := newXFRMAEAD(alg)
+		if err != nil {
+			panic(fmt.Sprintf("newXFRMAEAD(%q) for restored state %+v: %s", alg.Name, st.cfg.ID, err))
+		}
+		st.aead = aead
+	}
+	remaining := func(limit time.Duration, since time.Time) time.Duration {
+		if limit == 0 {
+			return 0
+		}
+		return max(limit-now.Sub(since), 1)
+	}
+	if st.larval() {
+		st.armTimersLocked(s, 0 /* soft */, remaining(xfrmLarvalLifetime, st.info.AddTime))
+		return
+	}
+	lft := st.cfg.Lifetime
+	if st.softExpired {
+		lft.SoftAdd, lft.SoftUse = 0, 0
+	}
+	st.armTimersLocked(s, remaining(lft.SoftAdd, st.info.AddTime), remaining(lft.HardAdd, st.info.AddTime))
+	if useTime := st.info.UseTime; !useTime.IsZero() {
+		st.armTimersLocked(s, remaining(lft.SoftUse, useTime), remaining(lft.HardUse, useTime))
+	}
+}
+
+// saveXFRMTime returns t in nanoseconds since the Unix epoch, or 0 if t is
+// zero.
+func saveXFRMTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// loadXFRMTime is the inverse of saveXFRMTime.
+func loadXFRMTime(nsec int64) time.Time {
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
+
+// saveAddTime is invoked by stateify.
+func (i *XFRMStateInfo) saveAddTime() int64 {
+	return saveXFRMTime(i.AddTime)
+}
+
+// loadAddTime is invoked by stateify.
+func (i *XFRMStateInfo) loadAddTime(_ context.Context, nsec int64) {
+	i.AddTime = loadXFRMTime(nsec)
+}
+
+// saveUseTime is invoked by stateify.
+func (i *XFRMStateInfo) saveUseTime() int64 {
+	return saveXFRMTime(i.UseTime)
+}
+
+// loadUseTime is invoked by stateify.
+func (i *XFRMStateInfo) loadUseTime(_ context.Context, nsec int64) {
+	i.UseTime = loadXFRMTime(nsec)
+}
+
+// saveAddTime is invoked by stateify.
+func (p *xfrmPolicy) saveAddTime() int64 {
+	return saveXFRMTime(p.addTime)
+}
+
+// loadAddTime is invoked by stateify.
+func (p *xfrmPolicy) loadAddTime(_ context.Context, nsec int64) {
+	p.addTime = loadXFRMTime(nsec)
 }
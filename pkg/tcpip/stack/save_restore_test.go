@@ -0,0 +1,140 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gvisor.dev/gvisor/pkg/state"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+func TestXFRMSaveRestore(t *testing.T) {
+	clock := faketime.NewManualClock()
+	// Times at the Unix epoch would be saved as zero times.
+	clock.Advance(time.Hour)
+	newStack := func() *Stack {
+		s := New(Options{Clock: clock})
+		t.Cleanup(func() {
+			s.Close()
+			s.Wait()
+		})
+		return s
+	}
+	s := newStack()
+
+	src := tcpip.AddrFrom4([4]byte{10, 0, 0, 1})
+	dst := tcpip.AddrFrom4([4]byte{10, 0, 0, 2})
+	cfg := XFRMState{
+		ID: XFRMStateID{
+			Destination: dst,
+			SPI:         0x100,
+			Protocol:    header.ESPProtocolNumber,
+		},
+		NetProto:     header.IPv4ProtocolNumber,
+		Source:       src,
+		Mode:         XFRMModeTransport,
+		ReplayWindow: 32,
+		AEAD: &XFRMAlgorithm{
+			Name:      XFRMAlgorithmAESGCM,
+			Key:       []byte("0123456789abcdefsalt"),
+			ICVLength: 16,
+		},
+		Lifetime: XFRMLifetime{HardAdd: 2 * time.Minute},
+	}
+	if _, err := s.AddXFRMState(cfg); err != nil {
+		t.Fatalf("AddXFRMState(%+v): %s", cfg, err)
+	}
+	larval, err := s.AllocateXFRMSPI(XFRMState{
+		ID: XFRMStateID{
+			Destination: src,
+			Protocol:    header.ESPProtocolNumber,
+		},
+		NetProto: header.IPv4ProtocolNumber,
+		Source:   dst,
+		Mode:     XFRMModeTransport,
+	}, 0x200, 0x200)
+	if err != nil {
+		t.Fatalf("AllocateXFRMSPI(_, 0x200, 0x200): %s", err)
+	}
+	policy := XFRMPolicy{
+		Selector: XFRMSelector{
+			NetProto:             header.IPv4ProtocolNumber,
+			DestinationAddress:   dst,
+			DestinationPrefixLen: 32,
+		},
+		Direction: XFRMDirectionOut,
+		Templates: []XFRMTemplate{{
+			ID: XFRMStateID{
+				Destination: dst,
+				Protocol:    header.ESPProtocolNumber,
+			},
+			Source: src,
+			Mode:   XFRMModeTransport,
+		}},
+	}
+	if _, err := s.AddXFRMPolicy(policy, false /* update */); err != nil {
+		t.Fatalf("AddXFRMPolicy(%+v, false): %s", policy, err)
+	}
+	clock.Advance(time.Second)
+
+	var buf bytes.Buffer
+	ctx := context.Background()
+	if _, err := state.Save(ctx, &buf, &s.xfrm); err != nil {
+		t.Fatalf("state.Save(_, _, %T): %s", &s.xfrm, err)
+	}
+	restored := newStack()
+	if _, err := state.Load(ctx, &buf, &restored.xfrm); err != nil {
+		t.Fatalf("state.Load(_, _, %T): %s", &restored.xfrm, err)
+	}
+	restored.restoreXFRM()
+
+	if diff := cmp.Diff(s.XFRMStates(), restored.XFRMStates()); diff != "" {
+		t.Errorf("XFRMStates() mismatch after restore (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(s.XFRMPolicies(), restored.XFRMPolicies()); diff != "" {
+		t.Errorf("XFRMPolicies() mismatch after restore (-want +got):\n%s", diff)
+	}
+
+	// The restored cipher must decrypt what the original one encrypts.
+	orig, st := s.xfrmState(cfg.ID), restored.xfrmState(cfg.ID)
+	if st.aead == nil {
+		t.Fatalf("got nil cipher for restored state %+v", cfg.ID)
+	}
+	nonce := make([]byte, st.aead.NonceSize())
+	plain := []byte("hello through IPsec")
+	if got, err := st.aead.Open(nil, nonce, orig.aead.Seal(nil, nonce, plain, nil), nil); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("got Open(Seal(%q)) = (%q, %v) with the restored cipher, want = (%q, nil)", plain, got, err, plain)
+	}
+
+	// The timers of the lifetimes of the states must be rearmed.
+	clock.Advance(xfrmLarvalLifetime)
+	if info, ok := restored.GetXFRMState(larval.ID); ok {
+		t.Errorf("got GetXFRMState(%+v) = %+v after the larval lifetime, want = not found", larval.ID, info)
+	}
+	if _, ok := restored.GetXFRMState(cfg.ID); !ok {
+		t.Errorf("GetXFRMState(%+v) before its hard limit: not found", cfg.ID)
+	}
+	clock.Advance(cfg.Lifetime.HardAdd)
+	if info, ok := restored.GetXFRMState(cfg.ID); ok {
+		t.Errorf("got GetXFRMState(%+v) = %+v after its hard limit, want = not found", cfg.ID, info)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"slices"
 	"sync/atomic"
 	"time"
 
@@ -88,10 +89,16 @@ type Stack struct {
 	// routeMu protects annotated fields below.
 	routeMu routeStackRWMutex `state:"nosave"`
 
-	// routeTable is a list of routes sorted by prefix length, longest (most specific) first.
+	// routeTable is a list of the routes of all routing tables sorted by
+	// prefix length, longest (most specific) first, and then by metric,
+	// lowest first.
 	// +checklocks:routeMu
 	routeTable tcpip.RouteList
 
+	// rules is the list of policy routing rules sorted by priority.
+	// +checklocks:routeMu
+	rules []tcpip.Rule
+
 	mu stackRWMutex `state:"nosave"`
 	// +checklocks:mu
 	nics map[tcpip.NICID]*nic
@@ -180,6 +187,14 @@ type Stack struct {
 	// tsOffsetSecret is the secret key for generating timestamp offsets
 	// initialized at stack startup.
 	tsOffsetSecret uint32
+
+	// tunnelHandlers holds the handlers of IP protocols carrying tunnelled
+	// packets. It is replaced, not modified, while holding mu. It is saved
+	// because tunnel endpoints only register their handlers when created.
+	tunnelHandlers atomic.Value `state:".(tunnelHandlerMap)"`
+
+	// xfrm holds the IPsec states and policies of the stack.
+	xfrm xfrmDB
 }
 
 // NetworkProtocolFactory instantiates a network protocol.
@@ -418,6 +433,7 @@ func New(opts Options) *Stack {
 	for _, netProtoFactory := range opts.NetworkProtocols {
 		netProto := netProtoFactory(s)
 		s.networkProtocols[netProto.Number()] = netProto
+		s.addDefaultRules(netProto.Number())
 	}
 
 	// Add specified transport protocols.
@@ -771,7 +787,7 @@ func (s *Stack) addRouteLocked(route *tcpip.Route) {
 	routePrefix := route.Destination.Prefix()
 	n := s.routeTable.Front()
 	for ; n != nil; n = n.Next() {
-		if n.Destination.Prefix() < routePrefix {
+		if prefix := n.Destination.Prefix(); prefix < routePrefix || (prefix == routePrefix && n.Metric > route.Metric) {
 			s.routeTable.InsertBefore(n, route)
 			return
 		}
@@ -816,6 +832,58 @@ func (s *Stack) ReplaceRoute(route tcpip.Route) {
 	s.addRouteLocked(&route)
 }
 
+// addDefaultRules installs the rules that Linux creates for every address
+// family: lookups in the local, main and default tables, in that order.
+func (s *Stack) addDefaultRules(netProto tcpip.NetworkProtocolNumber) {
+	for _, r := range []struct {
+		priority uint32
+		table    uint32
+	}{
+		{0, tcpip.RouteTableLocal},
+		{32766, tcpip.RouteTableMain},
+		{32767, tcpip.RouteTableDefault},
+	} {
+		s.AddRule(tcpip.Rule{
+			Priority: r.priority,
+			NetProto: netProto,
+			Action:   tcpip.RuleActionLookup,
+			Table:    r.table,
+		})
+	}
+}
+
+// AddRule adds a policy routing rule. The rule is evaluated after the rules
+// with the same or lower priorities.
+func (s *Stack) AddRule(rule tcpip.Rule) {
+	s.routeMu.Lock()
+	defer s.routeMu.Unlock()
+	i := len(s.rules)
+	for j, r := range s.rules {
+		if r.Priority > rule.Priority {
+			i = j
+			break
+		}
+	}
+	s.rules = slices.Insert(s.rules, i, rule)
+}
+
+// GetRules returns the policy routing rules, sorted by priority.
+func (s *Stack) GetRules() []tcpip.Rule {
+	s.routeMu.RLock()
+	defer s.routeMu.RUnlock()
+	return slices.Clone(s.rules)
+}
+
+// RemoveRules removes matching policy routing rules, it returns the number
+// of rules that are removed.
+func (s *Stack) RemoveRules(match func(tcpip.Rule) bool) int {
+	s.routeMu.Lock()
+	defer s.routeMu.Unlock()
+	n := len(s.rules)
+	s.rules = slices.DeleteFunc(s.rules, match)
+	return n - len(s.rules)
+}
+
 // NewEndpoint creates a new transport layer endpoint of the given protocol.
 func (s *Stack) NewEndpoint(transport tcpip.TransportProtocolNumber, network tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
 	t, ok := s.transportProtocols[transport]
@@ -1085,6 +1153,38 @@ func (s *Stack) SetNICAddress(id tcpip.NICID, addr tcpip.LinkAddress) tcpip.Erro
 	return nil
 }
 
+// SetNICQueueingDiscipline replaces the queueing discipline of a NIC with the
+// one returned by newQDisc, which is passed the link endpoint the discipline
+// writes packets to. If newQDisc is nil, the discipline the NIC was created
+// with (NICOptions.QDisc) is restored. Packets held by a replaced discipline
+// are dropped.
+func (s *Stack) SetNICQueueingDiscipline(id tcpip.NICID, newQDisc func(lower LinkWriter) QueueingDiscipline) tcpip.Error {
+	s.mu.RLock()
+	nic, ok := s.nics[id]
+	s.mu.RUnlock()
+	if !ok {
+		return &tcpip.ErrUnknownNICID{}
+	}
+	nic.setQueueingDiscipline(newQDisc)
+	return nil
+}
+
+// NICQueueingDiscipline returns the current queueing discipline of a NIC, or
+// nil if packets are written to its link endpoint directly.
+func (s *Stack) NICQueueingDiscipline(id tcpip.NICID) (QueueingDiscipline, tcpip.Error) {
+	s.mu.RLock()
+	nic, ok := s.nics[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, &tcpip.ErrUnknownNICID{}
+	}
+	qDisc := nic.queueingDiscipline()
+	if _, ok := qDisc.(*delegatingQueueingDiscipline); ok {
+		return nil, nil
+	}
+	return qDisc, nil
+}
+
 // SetNICName sets a NIC's name.
 func (s *Stack) SetNICName(id tcpip.NICID, name string) tcpip.Error {
 	s.mu.Lock()
@@ -1301,10 +1401,16 @@ func (s *Stack) GetMainNICAddress(id tcpip.NICID, protocol tcpip.NetworkProtocol
 	return nic.PrimaryAddress(protocol)
 }
 
-func (s *Stack) getAddressEP(nic *nic, localAddr, remoteAddr, srcHint tcpip.Address, netProto tcpip.NetworkProtocolNumber) AssignableAddressEndpoint {
+// getAddressEP returns the address endpoint of nic to send from localAddr to
+// remoteAddr with. If transparent is true, a temporary endpoint is created for
+// a localAddr that is not assigned to nic.
+func (s *Stack) getAddressEP(nic *nic, localAddr, remoteAddr, srcHint tcpip.Address, netProto tcpip.NetworkProtocolNumber, transparent bool) AssignableAddressEndpoint {
 	if localAddr.BitLen() == 0 {
 		return nic.primaryEndpoint(netProto, remoteAddr, srcHint)
 	}
+	if transparent {
+		return nic.getAddressOrCreateTempInner(netProto, localAddr, true /* createTemp */, CanBePrimaryEndpoint)
+	}
 	return nic.findEndpoint(netProto, localAddr, CanBePrimaryEndpoint)
 }
 
@@ -1321,7 +1427,7 @@ func (s *Stack) NewRouteForMulticast(nicID tcpip.NICID, remoteAddr tcpip.Address
 		return nil
 	}
 
-	if addressEndpoint := s.getAddressEP(nic, tcpip.Address{} /* localAddr */, remoteAddr, tcpip.Address{} /* srcHint */, netProto); addressEndpoint != nil {
+	if addressEndpoint := s.getAddressEP(nic, tcpip.Address{} /* localAddr */, remoteAddr, tcpip.Address{} /* srcHint */, netProto, false /* transparent */); addressEndpoint != nil {
 		return constructAndValidateRoute(netProto, addressEndpoint, nic, nic, tcpip.Address{} /* gateway */, tcpip.Address{} /* localAddr */, remoteAddr, s.handleLocal, false /* multicastLoop */, 0 /* mtu */)
 	}
 	return nil
@@ -1435,7 +1541,7 @@ func isNICForwarding(nic *nic, proto tcpip.NetworkProtocolNumber) bool {
 // +checklocksread:s.mu
 func (s *Stack) findRouteWithLocalAddrFromAnyInterfaceRLocked(outgoingNIC *nic, localAddr, remoteAddr, srcHint, gateway tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool, mtu uint32) *Route {
 	for _, aNIC := range s.nics {
-		addressEndpoint := s.getAddressEP(aNIC, localAddr, remoteAddr, srcHint, netProto)
+		addressEndpoint := s.getAddressEP(aNIC, localAddr, remoteAddr, srcHint, netProto, false /* transparent */)
 		if addressEndpoint == nil {
 			continue
 		}
@@ -1459,6 +1565,135 @@ func (s *Stack) findRouteWithLocalAddrFromAnyInterfaceRLocked(outgoingNIC *nic,
 // remote address is provided, the stack will use a remote address equal to the
 // local address.
 func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool) (*Route, tcpip.Error) {
+	return s.FindRouteForFlow(id, localAddr, remoteAddr, netProto, multicastLoop, RouteFlow{})
+}
+
+// RouteFlow holds the properties of a flow, other than its addresses and
+// outgoing NIC, that policy routing rules can select on.
+type RouteFlow struct {
+	// InputNIC is the NIC the flow was received on, if it is being
+	// forwarded.
+	InputNIC tcpip.NICID
+
+	// Mark is the mark of the flow.
+	Mark uint32
+
+	// UID is the user ID of the owner of the flow.
+	UID uint32
+
+	// TOS is the type of service of the flow.
+	TOS uint8
+
+	// Transparent indicates that the flow belongs to a transparent endpoint,
+	// which may send from local addresses not assigned to the stack.
+	Transparent bool
+}
+
+// ruleMatchesRLocked returns true if the rule selects the given flow.
+//
+// +checklocksread:s.mu
+func (s *Stack) ruleMatchesRLocked(rule *tcpip.Rule, id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, flow RouteFlow) bool {
+	if rule.NetProto != netProto {
+		return false
+	}
+	nicName := func(id tcpip.NICID) string {
+		if nic, ok := s.nics[id]; ok {
+			return nic.Name()
+		}
+		return ""
+	}
+	match := func() bool {
+		if rule.Source.Prefix() != 0 && !rule.Source.Contains(localAddr) {
+			return false
+		}
+		if rule.Destination.Prefix() != 0 && !rule.Destination.Contains(remoteAddr) {
+			return false
+		}
+		if rule.TOS != 0 && rule.TOS != flow.TOS {
+			return false
+		}
+		if (flow.Mark^rule.Mark)&rule.MarkMask != 0 {
+			return false
+		}
+		if rule.InputInterface != "" && rule.InputInterface != nicName(flow.InputNIC) {
+			return false
+		}
+		if rule.OutputInterface != "" && rule.OutputInterface != nicName(id) {
+			return false
+		}
+		if rule.HasUIDRange && (flow.UID < rule.UIDStart || flow.UID > rule.UIDEnd) {
+			return false
+		}
+		return true
+	}()
+	return match != rule.Invert
+}
+
+// findRouteInTableRLocked looks up a route in the routing table. If it finds
+// no route, but the table has a route that can be used by forwarding, it sets
+// chosenRoute to that route if chosenRoute is unset.
+//
+// +checklocksread:s.mu
+// +checklocksread:s.routeMu
+func (s *Stack) findRouteInTableRLocked(table uint32, id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop, needRoute, onlyGlobalAddresses, transparent bool, chosenRoute *tcpip.Route) *Route {
+	for route := s.routeTable.Front(); route != nil; route = route.Next() {
+		if route.EffectiveTable() != table {
+			continue
+		}
+		if remoteAddr.BitLen() != 0 && !route.Destination.Contains(remoteAddr) {
+			continue
+		}
+
+		nic, ok := s.nics[route.NIC]
+		if !ok || !nic.Enabled() {
+			continue
+		}
+
+		if id == 0 || id == route.NIC {
+			if addressEndpoint := s.getAddressEP(nic, localAddr, remoteAddr, route.SourceHint, netProto, transparent); addressEndpoint != nil {
+				var gateway tcpip.Address
+				if needRoute {
+					gateway = route.Gateway
+				}
+				r := constructAndValidateRoute(netProto, addressEndpoint, nic /* outgoingNIC */, nic /* outgoingNIC */, gateway, localAddr, remoteAddr, s.handleLocal, multicastLoop, route.MTU)
+				if r == nil {
+					panic(fmt.Sprintf("non-forwarding route validation failed with route table entry = %#v, id = %d, localAddr = %s, remoteAddr = %s", route, id, localAddr, remoteAddr))
+				}
+				return r
+			}
+		}
+
+		// If the stack has forwarding enabled, we haven't found a valid route to
+		// the remote address yet, and we are routing locally generated traffic,
+		// keep track of the first valid route. We keep iterating because we
+		// prefer routes that let us use a local address that is assigned to the
+		// outgoing interface. There is no requirement to do this from any RFC
+		// but simply a choice made to better follow a strong host model which
+		// the netstack follows at the time of writing.
+		//
+		// Note that for incoming traffic that we are forwarding (for which the
+		// NIC and local address are unspecified), we do not keep iterating, as
+		// there is no reason to prefer routes that let us use a local address
+		// when routing forwarded (as opposed to locally-generated) traffic.
+		locallyGenerated := (id != 0 || localAddr != tcpip.Address{})
+		if onlyGlobalAddresses && chosenRoute.Equal(tcpip.Route{}) && isNICForwarding(nic, netProto) {
+			if locallyGenerated {
+				*chosenRoute = *route
+				continue
+			}
+
+			if r := s.findRouteWithLocalAddrFromAnyInterfaceRLocked(nic, localAddr, remoteAddr, route.SourceHint, route.Gateway, netProto, multicastLoop, route.MTU); r != nil {
+				return r
+			}
+		}
+	}
+
+	return nil
+}
+
+// FindRouteForFlow is like FindRoute, but selects the routing table with the
+// policy routing rules that match the flow.
+func (s *Stack) FindRouteForFlow(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, netProto tcpip.NetworkProtocolNumber, multicastLoop bool, flow RouteFlow) (*Route, tcpip.Error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -1483,7 +1718,7 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 	// through the interface if the interface is valid and enabled.
 	if id != 0 && !needRoute {
 		if nic, ok := s.nics[id]; ok && nic.Enabled() {
-			if addressEndpoint := s.getAddressEP(nic, localAddr, remoteAddr, tcpip.Address{} /* srcHint */, netProto); addressEndpoint != nil {
+			if addressEndpoint := s.getAddressEP(nic, localAddr, remoteAddr, tcpip.Address{} /* srcHint */, netProto, flow.Transparent); addressEndpoint != nil {
 				return makeRoute(
 					netProto,
 					tcpip.Address{}, /* gateway */
@@ -1507,64 +1742,42 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 
 	onlyGlobalAddresses := !header.IsV6LinkLocalUnicastAddress(localAddr) && !isLinkLocal
 
-	// Find a route to the remote with the route table.
+	// Find a route to the remote with the route tables selected by the
+	// policy routing rules.
 	var chosenRoute tcpip.Route
-	if r := func() *Route {
+	if r, err := func() (*Route, tcpip.Error) {
 		s.routeMu.RLock()
 		defer s.routeMu.RUnlock()
 
-		for route := s.routeTable.Front(); route != nil; route = route.Next() {
-			if remoteAddr.BitLen() != 0 && !route.Destination.Contains(remoteAddr) {
+		for i := range s.rules {
+			rule := &s.rules[i]
+			if !s.ruleMatchesRLocked(rule, id, localAddr, remoteAddr, netProto, flow) {
 				continue
 			}
-
-			nic, ok := s.nics[route.NIC]
-			if !ok || !nic.Enabled() {
-				continue
+			switch rule.Action {
+			case tcpip.RuleActionLookup:
+			// Compare Linux's net/core/fib_rules.c:fib_rules_lookup() and
+			// net/ipv4/fib_rules.c:fib4_rule_action().
+			case tcpip.RuleActionBlackhole:
+				return nil, &tcpip.ErrInvalidEndpointState{}
+			case tcpip.RuleActionUnreachable:
+				return nil, &tcpip.ErrNetworkUnreachable{}
+			case tcpip.RuleActionProhibit:
+				return nil, &tcpip.ErrPermissionDenied{}
+			default:
+				panic(fmt.Sprintf("unknown rule action %d", rule.Action))
 			}
-
-			if id == 0 || id == route.NIC {
-				if addressEndpoint := s.getAddressEP(nic, localAddr, remoteAddr, route.SourceHint, netProto); addressEndpoint != nil {
-					var gateway tcpip.Address
-					if needRoute {
-						gateway = route.Gateway
-					}
-					r := constructAndValidateRoute(netProto, addressEndpoint, nic /* outgoingNIC */, nic /* outgoingNIC */, gateway, localAddr, remoteAddr, s.handleLocal, multicastLoop, route.MTU)
-					if r == nil {
-						panic(fmt.Sprintf("non-forwarding route validation failed with route table entry = %#v, id = %d, localAddr = %s, remoteAddr = %s", route, id, localAddr, remoteAddr))
-					}
-					return r
-				}
+			if r := s.findRouteInTableRLocked(rule.Table, id, localAddr, remoteAddr, netProto, multicastLoop, needRoute, onlyGlobalAddresses, flow.Transparent, &chosenRoute); r != nil {
+				return r, nil
 			}
-
-			// If the stack has forwarding enabled, we haven't found a valid route to
-			// the remote address yet, and we are routing locally generated traffic,
-			// keep track of the first valid route. We keep iterating because we
-			// prefer routes that let us use a local address that is assigned to the
-			// outgoing interface. There is no requirement to do this from any RFC
-			// but simply a choice made to better follow a strong host model which
-			// the netstack follows at the time of writing.
-			//
-			// Note that for incoming traffic that we are forwarding (for which the
-			// NIC and local address are unspecified), we do not keep iterating, as
-			// there is no reason to prefer routes that let us use a local address
-			// when routing forwarded (as opposed to locally-generated) traffic.
-			locallyGenerated := (id != 0 || localAddr != tcpip.Address{})
-			if onlyGlobalAddresses && chosenRoute.Equal(tcpip.Route{}) && isNICForwarding(nic, netProto) {
-				if locallyGenerated {
-					chosenRoute = *route
-					continue
-				}
-
-				if r := s.findRouteWithLocalAddrFromAnyInterfaceRLocked(nic, localAddr, remoteAddr, route.SourceHint, route.Gateway, netProto, multicastLoop, route.MTU); r != nil {
-					return r
-				}
+			// Stop at the first table with a route usable for forwarding.
+			if !chosenRoute.Equal(tcpip.Route{}) {
+				break
 			}
 		}
-
-		return nil
-	}(); r != nil {
-		return r, nil
+		return nil, nil
+	}(); r != nil || err != nil {
+		return r, err
 	}
 
 	if !chosenRoute.Equal(tcpip.Route{}) {
@@ -1584,7 +1797,7 @@ func (s *Stack) FindRoute(id tcpip.NICID, localAddr, remoteAddr tcpip.Address, n
 		// Use the specified NIC to get the local address endpoint.
 		if id != 0 {
 			if aNIC, ok := s.nics[id]; ok {
-				if addressEndpoint := s.getAddressEP(aNIC, localAddr, remoteAddr, chosenRoute.SourceHint, netProto); addressEndpoint != nil {
+				if addressEndpoint := s.getAddressEP(aNIC, localAddr, remoteAddr, chosenRoute.SourceHint, netProto, flow.Transparent); addressEndpoint != nil {
 					if r := constructAndValidateRoute(netProto, addressEndpoint, aNIC /* localAddressNIC */, nic /* outgoingNIC */, gateway, localAddr, remoteAddr, s.handleLocal, multicastLoop, chosenRoute.MTU); r != nil {
 						return r, nil
 					}
@@ -2166,6 +2379,21 @@ func (s *Stack) LeaveGroup(protocol tcpip.NetworkProtocolNumber, nicID tcpip.NIC
 	return &tcpip.ErrUnknownNICID{}
 }
 
+// UpdateGroupFilter changes the source filter of a join of the given multicast
+// group on the given NIC from oldFilter to newFilter.
+//
+// The group is joined if oldFilter is not joined and left if newFilter is not
+// joined.
+func (s *Stack) UpdateGroupFilter(protocol tcpip.NetworkProtocolNumber, nicID tcpip.NICID, multicastAddr tcpip.Address, oldFilter, newFilter tcpip.MulticastSourceFilter) tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if nic, ok := s.nics[nicID]; ok {
+		return nic.updateGroupFilter(protocol, multicastAddr, oldFilter, newFilter)
+	}
+	return &tcpip.ErrUnknownNICID{}
+}
+
 // IsInGroup returns true if the NIC with ID nicID has joined the multicast
 // group multicastAddr.
 func (s *Stack) IsInGroup(nicID tcpip.NICID, multicastAddr tcpip.Address) (bool, tcpip.Error) {
@@ -28,9 +28,11 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"gvisor.dev/gvisor/pkg/abi/linux/errno"
 	"gvisor.dev/gvisor/pkg/buffer"
 	"gvisor.dev/gvisor/pkg/rand"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/syserr"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/faketime"
 	"gvisor.dev/gvisor/pkg/tcpip/header"
@@ -4478,6 +4480,169 @@ func TestRemoveRoutes(t *testing.T) {
 	}
 }
 
+func TestPolicyRouting(t *testing.T) {
+	s := stack.New(stack.Options{
+		NetworkProtocols: []stack.NetworkProtocolFactory{fakeNetFactory},
+	})
+
+	addrs := []tcpip.Address{
+		tcpip.AddrFromSlice([]byte("\x01\x00\x00\x00")),
+		tcpip.AddrFromSlice([]byte("\x02\x00\x00\x00")),
+	}
+	for i, addr := range addrs {
+		nicID := tcpip.NICID(i + 1)
+		if err := s.CreateNIC(nicID, channel.New(10, defaultMTU, "")); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+		}
+		protocolAddr := tcpip.ProtocolAddress{
+			Protocol:          fakeNetNumber,
+			AddressWithPrefix: addr.WithPrefix(),
+		}
+		if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+			t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+		}
+	}
+
+	const table = 100
+	anySubnet, err := tcpip.NewSubnet(tcpip.AddrFromSlice([]byte("\x00\x00\x00\x00")), tcpip.MaskFrom("\x00\x00\x00\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blackholeSubnet := tcpip.AddrFromSlice([]byte("\x07\x00\x00\x00")).WithPrefix().Subnet()
+	prohibitSubnet := tcpip.AddrFromSlice([]byte("\x08\x00\x00\x00")).WithPrefix().Subnet()
+	unreachableSubnet := tcpip.AddrFromSlice([]byte("\x09\x00\x00\x00")).WithPrefix().Subnet()
+	s.SetRouteTable([]tcpip.Route{
+		{Destination: anySubnet, NIC: 1},
+		{Destination: anySubnet, NIC: 2, Table: table},
+	})
+	s.AddRule(tcpip.Rule{Priority: 100, NetProto: fakeNetNumber, HasUIDRange: true, UIDStart: 1000, UIDEnd: 1999, Table: table})
+	s.AddRule(tcpip.Rule{Priority: 200, NetProto: fakeNetNumber, Mark: 1, MarkMask: 1, Table: table})
+	s.AddRule(tcpip.Rule{Priority: 300, NetProto: fakeNetNumber, Destination: unreachableSubnet, Action: tcpip.RuleActionUnreachable})
+	s.AddRule(tcpip.Rule{Priority: 300, NetProto: fakeNetNumber, Destination: blackholeSubnet, Action: tcpip.RuleActionBlackhole})
+	s.AddRule(tcpip.Rule{Priority: 300, NetProto: fakeNetNumber, Destination: prohibitSubnet, Action: tcpip.RuleActionProhibit})
+
+	remoteAddr := tcpip.AddrFromSlice([]byte("\x05\x00\x00\x00"))
+	tests := []struct {
+		name      string
+		remote    tcpip.Address
+		flow      stack.RouteFlow
+		wantNIC   tcpip.NICID
+		wantLocal tcpip.Address
+		wantErr   tcpip.Error
+		wantErrno errno.Errno
+	}{
+		{
+			name:      "main table",
+			remote:    remoteAddr,
+			wantNIC:   1,
+			wantLocal: addrs[0],
+		},
+		{
+			name:      "uid range",
+			remote:    remoteAddr,
+			flow:      stack.RouteFlow{UID: 1500},
+			wantNIC:   2,
+			wantLocal: addrs[1],
+		},
+		{
+			name:      "uid out of range",
+			remote:    remoteAddr,
+			flow:      stack.RouteFlow{UID: 2000},
+			wantNIC:   1,
+			wantLocal: addrs[0],
+		},
+		{
+			name:      "matching mark",
+			remote:    remoteAddr,
+			flow:      stack.RouteFlow{Mark: 3},
+			wantNIC:   2,
+			wantLocal: addrs[1],
+		},
+		{
+			name:      "non-matching mark",
+			remote:    remoteAddr,
+			flow:      stack.RouteFlow{Mark: 2},
+			wantNIC:   1,
+			wantLocal: addrs[0],
+		},
+		{
+			name:      "unreachable",
+			remote:    unreachableSubnet.ID(),
+			wantErr:   &tcpip.ErrNetworkUnreachable{},
+			wantErrno: errno.ENETUNREACH,
+		},
+		{
+			name:      "blackhole",
+			remote:    blackholeSubnet.ID(),
+			wantErr:   &tcpip.ErrInvalidEndpointState{},
+			wantErrno: errno.EINVAL,
+		},
+		{
+			name:      "prohibit",
+			remote:    prohibitSubnet.ID(),
+			wantErr:   &tcpip.ErrPermissionDenied{},
+			wantErrno: errno.EACCES,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := s.FindRouteForFlow(0, tcpip.Address{}, test.remote, fakeNetNumber, false /* multicastLoop */, test.flow)
+			if err != test.wantErr {
+				t.Fatalf("FindRouteForFlow(0, '', %s, %d, false, %+v) = (_, %s), want = (_, %s)", test.remote, fakeNetNumber, test.flow, err, test.wantErr)
+			}
+			if err != nil {
+				// The errno must match what Linux reports for the rule action.
+				if got := syserr.TranslateNetstackError(err).ToLinux(); got != test.wantErrno {
+					t.Errorf("got errno %d, want %d", got, test.wantErrno)
+				}
+				return
+			}
+			defer r.Release()
+			if got := r.NICID(); got != test.wantNIC {
+				t.Errorf("got r.NICID() = %d, want = %d", got, test.wantNIC)
+			}
+			if got := r.LocalAddress(); got != test.wantLocal {
+				t.Errorf("got r.LocalAddress() = %s, want = %s", got, test.wantLocal)
+			}
+		})
+	}
+
+	// Without the rules, only the main table is used.
+	if got, want := s.RemoveRules(func(r tcpip.Rule) bool { return r.Priority >= 100 && r.Priority <= 300 }), 5; got != want {
+		t.Fatalf("got s.RemoveRules(_) = %d, want = %d", got, want)
+	}
+	flow := stack.RouteFlow{UID: 1500, Mark: 1}
+	r, routeErr := s.FindRouteForFlow(0, tcpip.Address{}, remoteAddr, fakeNetNumber, false /* multicastLoop */, flow)
+	if routeErr != nil {
+		t.Fatalf("FindRouteForFlow(0, '', %s, %d, false, %+v): %s", remoteAddr, fakeNetNumber, flow, routeErr)
+	}
+	defer r.Release()
+	if got, want := r.NICID(), tcpip.NICID(1); got != want {
+		t.Errorf("got r.NICID() = %d, want = %d", got, want)
+	}
+}
+
+func TestRouteMetric(t *testing.T) {
+	s := stack.New(stack.Options{})
+
+	subnet, err := tcpip.NewSubnet(tcpip.AddrFromSlice([]byte("\x00\x00\x00\x00")), tcpip.MaskFrom("\x00\x00\x00\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.AddRoute(tcpip.Route{Destination: subnet, NIC: 1, Metric: 200})
+	s.AddRoute(tcpip.Route{Destination: subnet, NIC: 2, Metric: 100})
+	s.AddRoute(tcpip.Route{Destination: subnet, NIC: 3, Metric: 300})
+
+	var got []tcpip.NICID
+	for _, r := range s.GetRouteTable() {
+		got = append(got, r.NIC)
+	}
+	if diff := cmp.Diff([]tcpip.NICID{2, 1, 3}, got); diff != "" {
+		t.Errorf("route NICs mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestFindRouteWithForwarding(t *testing.T) {
 	const (
 		nicID1 = 1
@@ -5417,6 +5582,78 @@ func TestWritePacketToRemote(t *testing.T) {
 	})
 }
 
+// countingQDisc is a stack.QueueingDiscipline which counts and drops written
+// packets.
+type countingQDisc struct {
+	written int
+	closed  bool
+}
+
+func (q *countingQDisc) WritePacket(*stack.PacketBuffer) tcpip.Error {
+	q.written++
+	return nil
+}
+
+func (q *countingQDisc) Close() {
+	q.closed = true
+}
+
+func TestSetNICQueueingDiscipline(t *testing.T) {
+	const nicID = 1
+	e := channel.New(1, defaultMTU, linkAddr1)
+	s := stack.New(stack.Options{})
+	if err := s.CreateNIC(nicID, e); err != nil {
+		t.Fatalf("CreateNIC(%d, _) = %s", nicID, err)
+	}
+
+	var qDisc countingQDisc
+	if err := s.SetNICQueueingDiscipline(nicID, func(lower stack.LinkWriter) stack.QueueingDiscipline {
+		if lower != e {
+			t.Errorf("got lower = %v, want = %v", lower, e)
+		}
+		return &qDisc
+	}); err != nil {
+		t.Fatalf("s.SetNICQueueingDiscipline(%d, _) = %s", nicID, err)
+	}
+	if got, err := s.NICQueueingDiscipline(nicID); err != nil || got != &qDisc {
+		t.Fatalf("got s.NICQueueingDiscipline(%d) = (%v, %v), want = (%v, nil)", nicID, got, err, &qDisc)
+	}
+	if err := s.WriteRawPacket(nicID, header.IPv4ProtocolNumber, buffer.MakeWithData([]byte{1})); err != nil {
+		t.Fatalf("s.WriteRawPacket(%d, ...) = %s", nicID, err)
+	}
+	if qDisc.written != 1 {
+		t.Errorf("got qDisc.written = %d, want = 1", qDisc.written)
+	}
+	if pkt := e.Read(); pkt != nil {
+		pkt.DecRef()
+		t.Errorf("got packet written to the link endpoint, want packet held by the queueing discipline")
+	}
+
+	// Removing the discipline closes it and restores direct writes.
+	if err := s.SetNICQueueingDiscipline(nicID, nil); err != nil {
+		t.Fatalf("s.SetNICQueueingDiscipline(%d, nil) = %s", nicID, err)
+	}
+	if !qDisc.closed {
+		t.Errorf("got qDisc.closed = false, want = true")
+	}
+	if got, err := s.NICQueueingDiscipline(nicID); err != nil || got != nil {
+		t.Fatalf("got s.NICQueueingDiscipline(%d) = (%v, %v), want = (nil, nil)", nicID, got, err)
+	}
+	if err := s.WriteRawPacket(nicID, header.IPv4ProtocolNumber, buffer.MakeWithData([]byte{2})); err != nil {
+		t.Fatalf("s.WriteRawPacket(%d, ...) = %s", nicID, err)
+	}
+	pkt := e.Read()
+	if pkt == nil {
+		t.Fatalf("got e.Read() = nil, want packet")
+	}
+	pkt.DecRef()
+
+	err := s.SetNICQueueingDiscipline(nicID+1, nil)
+	if _, ok := err.(*tcpip.ErrUnknownNICID); !ok {
+		t.Errorf("got s.SetNICQueueingDiscipline(%d, nil) = %v, want = %s", nicID+1, err, &tcpip.ErrUnknownNICID{})
+	}
+}
+
 func TestClearNeighborCacheOnNICDisable(t *testing.T) {
 	const (
 		nicID    = 1
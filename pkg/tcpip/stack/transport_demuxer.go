@@ -158,8 +158,9 @@ func (epsByNIC *endpointsByNIC) transportEndpoints() []TransportEndpoint {
 
 // handlePacket is called by the stack when new packets arrive to this transport
 // endpoint. It returns false if the packet could not be matched to any
-// transport endpoint, true otherwise.
-func (epsByNIC *endpointsByNIC) handlePacket(id TransportEndpointID, pkt *PacketBuffer) bool {
+// transport endpoint, true otherwise. If transparentOnly is true, the packet is
+// only matched to a transparent endpoint.
+func (epsByNIC *endpointsByNIC) handlePacket(id TransportEndpointID, pkt *PacketBuffer, transparentOnly bool) bool {
 	epsByNIC.mu.RLock()
 
 	mpep, ok := epsByNIC.endpoints[pkt.NICID]
@@ -173,12 +174,23 @@ func (epsByNIC *endpointsByNIC) handlePacket(id TransportEndpointID, pkt *Packet
 	// If this is a broadcast or multicast datagram, deliver the datagram to all
 	// endpoints bound to the right device.
 	if isInboundMulticastOrBroadcast(pkt, id.LocalAddress) {
-		mpep.handlePacketAll(id, pkt)
+		if !pkt.xfrmRejected {
+			mpep.handlePacketAll(id, pkt)
+		}
 		epsByNIC.mu.RUnlock() // Don't use defer for performance reasons.
 		return true
 	}
 	// multiPortEndpoints are guaranteed to have at least one element.
-	transEP := mpep.selectEndpoint(id, epsByNIC.seed)
+	transEP := mpep.selectEndpoint(id, pkt, epsByNIC.seed)
+	if transparentOnly && !isTransparentEndpoint(transEP) {
+		epsByNIC.mu.RUnlock()
+		return false
+	}
+	if pkt.xfrmRejected && !xfrmInputBypass(transEP) {
+		// The IPsec input policy rejects the packet.
+		epsByNIC.mu.RUnlock()
+		return true
+	}
 	if queuedProtocol, mustQueue := mpep.demux.queuedProtocols[protocolIDs{mpep.netProto, mpep.transProto}]; mustQueue {
 		queuedProtocol.QueuePacket(transEP, id, pkt)
 		epsByNIC.mu.RUnlock()
@@ -207,7 +219,7 @@ func (epsByNIC *endpointsByNIC) handleError(n *nic, id TransportEndpointID, tran
 	// broadcast like we are doing with handlePacket above?
 
 	// multiPortEndpoints are guaranteed to have at least one element.
-	transEP := mpep.selectEndpoint(id, epsByNIC.seed)
+	transEP := mpep.selectEndpoint(id, nil /* pkt */, epsByNIC.seed)
 	epsByNIC.mu.RUnlock()
 
 	transEP.HandleError(transErr, pkt)
@@ -376,8 +388,10 @@ func reciprocalScale(val, n uint32) uint32 {
 
 // selectEndpoint calculates a hash of destination and source addresses and
 // ports then uses it to select a socket. In this case, all packets from one
-// address will be sent to same endpoint.
-func (ep *multiPortEndpoint) selectEndpoint(id TransportEndpointID, seed uint32) TransportEndpoint {
+// address will be sent to same endpoint. If pkt is not nil and a program is
+// attached to the group with SO_ATTACH_REUSEPORT_CBPF, the program selects the
+// socket instead.
+func (ep *multiPortEndpoint) selectEndpoint(id TransportEndpointID, pkt *PacketBuffer, seed uint32) TransportEndpoint {
 	ep.mu.RLock()
 	defer ep.mu.RUnlock()
 
@@ -389,6 +403,12 @@ func (ep *multiPortEndpoint) selectEndpoint(id TransportEndpointID, seed uint32)
 		return ep.endpoints[len(ep.endpoints)-1]
 	}
 
+	if pkt != nil {
+		if transEP := ep.selectEndpointByFilterLocked(pkt); transEP != nil {
+			return transEP
+		}
+	}
+
 	payload := []byte{
 		byte(id.LocalPort),
 		byte(id.LocalPort >> 8),
@@ -406,6 +426,35 @@ func (ep *multiPortEndpoint) selectEndpoint(id TransportEndpointID, seed uint32)
 	return ep.endpoints[idx]
 }
 
+// selectEndpointByFilterLocked runs the program attached to the group with
+// SO_ATTACH_REUSEPORT_CBPF over the payload of pkt, and returns the endpoint
+// at the index returned by the program. The group's program is the one
+// attached to the first endpoint that has one. It returns nil if there is no
+// program or if the index is out of range.
+//
+// +checklocksread:ep.mu
+func (ep *multiPortEndpoint) selectEndpointByFilterLocked(pkt *PacketBuffer) TransportEndpoint {
+	for _, transEP := range ep.endpoints {
+		sockEP, ok := transEP.(interface {
+			SocketOptions() *tcpip.SocketOptions
+		})
+		if !ok {
+			continue
+		}
+		filter := sockEP.SocketOptions().GetReusePortFilter()
+		if filter == nil {
+			continue
+		}
+		buf := pkt.Data().ToBuffer()
+		defer buf.Release()
+		if idx := filter.Run(buf.Flatten()); idx < uint32(len(ep.endpoints)) {
+			return ep.endpoints[idx]
+		}
+		return nil
+	}
+	return nil
+}
+
 func (ep *multiPortEndpoint) handlePacketAll(id TransportEndpointID, pkt *PacketBuffer) {
 	ep.mu.RLock()
 	queuedProtocol, mustQueue := ep.demux.queuedProtocols[protocolIDs{ep.netProto, ep.transProto}]
@@ -558,6 +607,10 @@ func (d *transportDemuxer) deliverPacket(protocol tcpip.TransportProtocolNumber,
 		return false
 	}
 
+	if pkt.tproxied {
+		return d.deliverTransparentPacket(eps, pkt, id)
+	}
+
 	// If the packet is a UDP broadcast or multicast, then find all matching
 	// transport endpoints.
 	if protocol == header.UDPProtocolNumber && isInboundMulticastOrBroadcast(pkt, id.LocalAddress) {
@@ -573,10 +626,10 @@ func (d *transportDemuxer) deliverPacket(protocol tcpip.TransportProtocolNumber,
 		// copy except for the final one.
 		for _, ep := range destEPs[:len(destEPs)-1] {
 			clone := pkt.Clone()
-			ep.handlePacket(id, clone)
+			ep.handlePacket(id, clone, false /* transparentOnly */)
 			clone.DecRef()
 		}
-		destEPs[len(destEPs)-1].handlePacket(id, pkt)
+		destEPs[len(destEPs)-1].handlePacket(id, pkt, false /* transparentOnly */)
 		return true
 	}
 
@@ -600,7 +653,32 @@ func (d *transportDemuxer) deliverPacket(protocol tcpip.TransportProtocolNumber,
 		}
 		return false
 	}
-	return ep.handlePacket(id, pkt)
+	return ep.handlePacket(id, pkt, false /* transparentOnly */)
+}
+
+// deliverTransparentPacket delivers a packet redirected by a TPROXY target to
+// the transparent endpoint of the connection it belongs to, or else to the
+// transparent endpoint bound to the address it was redirected to. As in Linux,
+// the packet is dropped if there is no such endpoint.
+func (d *transportDemuxer) deliverTransparentPacket(eps *transportEndpoints, pkt *PacketBuffer, id TransportEndpointID) bool {
+	eps.mu.RLock()
+	epsByNIC, ok := eps.endpoints[id]
+	if !ok {
+		epsByNIC = eps.findEndpointLocked(TransportEndpointID{
+			LocalPort:    pkt.tproxyAddr.Port,
+			LocalAddress: pkt.tproxyAddr.Addr,
+		})
+	}
+	eps.mu.RUnlock()
+	if epsByNIC != nil && epsByNIC.handlePacket(id, pkt, true /* transparentOnly */) {
+		return true
+	}
+	if pkt.TransportProtocolNumber == header.UDPProtocolNumber {
+		d.stack.stats.UDP.UnknownPortErrors.Increment()
+	}
+	// Report the packet as delivered so that the transport protocol does not
+	// reply to it as if it was sent to a closed port.
+	return true
 }
 
 // deliverRawPacket attempts to deliver the given packet and returns whether it
@@ -681,7 +759,7 @@ func (d *transportDemuxer) findTransportEndpoint(netProto tcpip.NetworkProtocolN
 		}
 	}
 
-	ep := mpep.selectEndpoint(id, epsByNIC.seed)
+	ep := mpep.selectEndpoint(id, nil /* pkt */, epsByNIC.seed)
 	epsByNIC.mu.RUnlock()
 	return ep
 }
@@ -724,6 +802,13 @@ func (d *transportDemuxer) unregisterRawEndpoint(netProto tcpip.NetworkProtocolN
 	eps.mu.Unlock()
 }
 
+// isTransparentEndpoint returns true if ep has the IP_TRANSPARENT socket option
+// set.
+func isTransparentEndpoint(ep TransportEndpoint) bool {
+	e, ok := ep.(interface{ SocketOptions() *tcpip.SocketOptions })
+	return ok && e.SocketOptions().GetTransparent()
+}
+
 func isInboundMulticastOrBroadcast(pkt *PacketBuffer, localAddr tcpip.Address) bool {
 	return pkt.NetworkPacketInfo.LocalAddressBroadcast || header.IsV4MulticastAddress(localAddr) || header.IsV6MulticastAddress(localAddr)
 }
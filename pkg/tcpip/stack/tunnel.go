@@ -0,0 +1,90 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"fmt"
+	"slices"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// TunnelHandler receives packets of an IP protocol that carries another
+// network layer packet (e.g. GRE or IP-in-IP) and that isn't implemented by
+// a transport protocol.
+type TunnelHandler interface {
+	// HandleTunnelPacket is called for every packet addressed to the stack
+	// that carries the protocol the handler is registered for. The packet's
+	// network header is parsed and its data starts at the tunnel header.
+	//
+	// It returns false if the packet doesn't belong to the tunnel, in which
+	// case the packet is offered to the next handler.
+	HandleTunnelPacket(pkt *PacketBuffer) bool
+}
+
+// tunnelHandlerMap maps IP protocols to the handlers registered for them.
+// Maps stored in Stack.tunnelHandlers are never modified.
+type tunnelHandlerMap map[tcpip.TransportProtocolNumber][]TunnelHandler
+
+// RegisterTunnelHandler registers h to receive packets of the given IP
+// protocol. protocol must not be a registered transport protocol.
+func (s *Stack) RegisterTunnelHandler(protocol tcpip.TransportProtocolNumber, h TunnelHandler) {
+	if _, ok := s.transportProtocols[protocol]; ok {
+		panic(fmt.Sprintf("tunnel handler registered for transport protocol %d", protocol))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, _ := s.tunnelHandlers.Load().(tunnelHandlerMap)
+	handlers := make(tunnelHandlerMap, len(old)+1)
+	for p, hs := range old {
+		handlers[p] = hs
+	}
+	handlers[protocol] = append(slices.Clip(old[protocol]), h)
+	s.tunnelHandlers.Store(handlers)
+}
+
+// UnregisterTunnelHandler unregisters a handler registered with
+// RegisterTunnelHandler.
+func (s *Stack) UnregisterTunnelHandler(protocol tcpip.TransportProtocolNumber, h TunnelHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, _ := s.tunnelHandlers.Load().(tunnelHandlerMap)
+	handlers := make(tunnelHandlerMap, len(old))
+	for p, hs := range old {
+		handlers[p] = hs
+	}
+	hs := slices.DeleteFunc(slices.Clone(old[protocol]), func(registered TunnelHandler) bool {
+		return registered == h
+	})
+	if len(hs) == 0 {
+		delete(handlers, protocol)
+	} else {
+		handlers[protocol] = hs
+	}
+	s.tunnelHandlers.Store(handlers)
+}
+
+// deliverTunnelPacket offers pkt to the tunnel handlers registered for
+// protocol. It returns true if one of them consumed it.
+func (s *Stack) deliverTunnelPacket(protocol tcpip.TransportProtocolNumber, pkt *PacketBuffer) bool {
+	handlers, _ := s.tunnelHandlers.Load().(tunnelHandlerMap)
+	for _, h := range handlers[protocol] {
+		if h.HandleTunnelPacket(pkt) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,1552 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"slices"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// This file implements IPsec (RFC 4301) with the state (security
+// association) and policy databases of the Linux XFRM framework. Only ESP
+// (RFC 4303) in transport and tunnel mode is supported, with AES-GCM
+// (RFC 4106) as the only algorithm. Encryption is done in software.
+
+const (
+	// XFRMAlgorithmAESGCM is the name of the AES-GCM AEAD algorithm of ESP,
+	// as used by Linux.
+	XFRMAlgorithmAESGCM = "rfc4106(gcm(aes))"
+
+	// xfrmGCMSaltSize is the size of the salt that ends rfc4106 keys.
+	xfrmGCMSaltSize = 4
+
+	// xfrmGCMIVSize is the size of the explicit IV of ESP packets.
+	xfrmGCMIVSize = 8
+
+	// xfrmMaxReplayWindow is the largest supported anti-replay window, that
+	// of the legacy replay state of Linux.
+	xfrmMaxReplayWindow = 32
+
+	// xfrmLarvalLifetime is the lifetime of the states allocated by
+	// AllocateXFRMSPI until they are completed, like XFRM_ACQ_EXPIRES.
+	xfrmLarvalLifetime = 30 * time.Second
+
+	// xfrmStateESN is the XFRM_STATE_ESN flag of states.
+	xfrmStateESN = 128
+)
+
+// XFRMMode is the mode of an IPsec state.
+type XFRMMode uint8
+
+const (
+	// XFRMModeTransport protects the payload of IP packets.
+	XFRMModeTransport XFRMMode = iota
+
+	// XFRMModeTunnel protects whole IP packets, which are encapsulated in
+	// packets between the endpoints of the tunnel.
+	XFRMModeTunnel
+)
+
+// XFRMDirection is the direction of the traffic an IPsec policy applies to.
+// Values match XFRM_POLICY_IN, XFRM_POLICY_OUT and XFRM_POLICY_FWD.
+type XFRMDirection uint8
+
+const (
+	// XFRMDirectionIn applies to packets delivered locally.
+	XFRMDirectionIn XFRMDirection = iota
+
+	// XFRMDirectionOut applies to packets sent, including forwarded ones.
+	XFRMDirectionOut
+
+	// XFRMDirectionForward applies to packets forwarded.
+	XFRMDirectionForward
+)
+
+// XFRMSelector selects the packets IPsec states and policies apply to. Zero
+// fields match all packets.
+//
+// +stateify savable
+type XFRMSelector struct {
+	// NetProto is the network protocol of the packets.
+	NetProto tcpip.NetworkProtocolNumber
+
+	// SourceAddress and SourcePrefixLen select the source addresses.
+	SourceAddress   tcpip.Address
+	SourcePrefixLen uint8
+
+	// DestinationAddress and DestinationPrefixLen select the destination
+	// addresses.
+	DestinationAddress   tcpip.Address
+	DestinationPrefixLen uint8
+
+	// Protocol is the transport protocol of the packets.
+	Protocol tcpip.TransportProtocolNumber
+
+	// SourcePort and DestinationPort are compared to the ports of the packets
+	// under their masks. The ports of ICMP packets are their type and code.
+	SourcePort          uint16
+	SourcePortMask      uint16
+	DestinationPort     uint16
+	DestinationPortMask uint16
+
+	// NICID is the interface the packets are received on or sent through.
+	NICID tcpip.NICID
+}
+
+// xfrmFlow holds the fields of a packet that selectors match.
+type xfrmFlow struct {
+	netProto tcpip.NetworkProtocolNumber
+	src      tcpip.Address
+	dst      tcpip.Address
+	protocol tcpip.TransportProtocolNumber
+	srcPort  uint16
+	dstPort  uint16
+	nicID    tcpip.NICID
+}
+
+// xfrmFlowOf returns the flow of a packet with a network header. It returns
+// false if the packet isn't an IP packet.
+func xfrmFlowOf(pkt *PacketBuffer, nicID tcpip.NICID) (xfrmFlow, bool) {
+	f := xfrmFlow{
+		netProto: pkt.NetworkProtocolNumber,
+		nicID:    nicID,
+	}
+	switch h := pkt.NetworkHeader().Slice(); f.netProto {
+	case header.IPv4ProtocolNumber:
+		if len(h) < header.IPv4MinimumSize {
+			return f, false
+		}
+		ip := header.IPv4(h)
+		f.src, f.dst, f.protocol = ip.SourceAddress(), ip.DestinationAddress(), ip.TransportProtocol()
+		if ip.FragmentOffset() != 0 {
+			// Only the first fragment has ports.
+			return f, true
+		}
+	case header.IPv6ProtocolNumber:
+		if len(h) < header.IPv6MinimumSize {
+			return f, false
+		}
+		ip := header.IPv6(h)
+		f.src, f.dst = ip.SourceAddress(), ip.DestinationAddress()
+		if f.protocol = pkt.TransportProtocolNumber; f.protocol == 0 {
+			f.protocol = ip.TransportProtocol()
+		}
+	default:
+		return f, false
+	}
+
+	th := pkt.TransportHeader().Slice()
+	if len(th) == 0 {
+		// The transport header isn't parsed yet.
+		th, _ = pkt.Data().PullUp(4)
+	}
+	if len(th) < 4 {
+		return f, true
+	}
+	switch f.protocol {
+	case header.TCPProtocolNumber, header.UDPProtocolNumber, header.SCTPProtocolNumber:
+		f.srcPort = binary.BigEndian.Uint16(th)
+		f.dstPort = binary.BigEndian.Uint16(th[2:])
+	case header.ICMPv4ProtocolNumber, header.ICMPv6ProtocolNumber:
+		f.srcPort = uint16(th[0])
+		f.dstPort = uint16(th[1])
+	}
+	return f, true
+}
+
+// xfrmPrefixMatch returns whether the first prefixLen bits of addr and
+// prefix are equal.
+func xfrmPrefixMatch(addr, prefix tcpip.Address, prefixLen uint8) bool {
+	if prefixLen == 0 {
+		return true
+	}
+	if addr.Len() != prefix.Len() || int(prefixLen) > addr.Len()*8 {
+		return false
+	}
+	a, p := addr.AsSlice(), prefix.AsSlice()
+	n := prefixLen / 8
+	if !bytes.Equal(a[:n], p[:n]) {
+		return false
+	}
+	if rem := prefixLen % 8; rem != 0 {
+		mask := byte(0xff << (8 - rem))
+		return a[n]&mask == p[n]&mask
+	}
+	return true
+}
+
+// matches returns whether the selector selects the flow.
+func (sel *XFRMSelector) matches(f *xfrmFlow) bool {
+	return (sel.NetProto == 0 || sel.NetProto == f.netProto) &&
+		xfrmPrefixMatch(f.src, sel.SourceAddress, sel.SourcePrefixLen) &&
+		xfrmPrefixMatch(f.dst, sel.DestinationAddress, sel.DestinationPrefixLen) &&
+		(sel.Protocol == 0 || sel.Protocol == f.protocol) &&
+		(f.srcPort^sel.SourcePort)&sel.SourcePortMask == 0 &&
+		(f.dstPort^sel.DestinationPort)&sel.DestinationPortMask == 0 &&
+		(sel.NICID == 0 || sel.NICID == f.nicID)
+}
+
+// XFRMStateID identifies an IPsec state.
+//
+// +stateify savable
+type XFRMStateID struct {
+	// Destination is the destination address of the protected packets.
+	Destination tcpip.Address
+
+	// SPI is the security parameters index.
+	SPI uint32
+
+	// Protocol is the IPsec protocol of the state.
+	Protocol tcpip.TransportProtocolNumber
+}
+
+// XFRMAlgorithm is an AEAD algorithm of an IPsec state.
+//
+// +stateify savable
+type XFRMAlgorithm struct {
+	// Name is the name of the algorithm in the Linux crypto API.
+	Name string
+
+	// Key is the key of the algorithm, including its salt.
+	Key []byte
+
+	// ICVLength is the length of the integrity check value in bytes.
+	ICVLength int
+}
+
+// XFRMLifetime holds the limits of the lifetime of IPsec states and
+// policies. Zero fields are unlimited. States are reported when they reach a
+// soft limit and removed when they reach a hard limit.
+//
+// +stateify savable
+type XFRMLifetime struct {
+	SoftBytes   uint64
+	HardBytes   uint64
+	SoftPackets uint64
+	HardPackets uint64
+
+	// SoftAdd and HardAdd are measured from the addition of the state.
+	SoftAdd time.Duration
+	HardAdd time.Duration
+
+	// SoftUse and HardUse are measured from the first use of the state.
+	SoftUse time.Duration
+	HardUse time.Duration
+}
+
+// XFRMState is the configuration of an IPsec state, also known as a
+// security association.
+//
+// +stateify savable
+type XFRMState struct {
+	// ID identifies the state.
+	ID XFRMStateID
+
+	// NetProto is the network protocol of the addresses of the state.
+	NetProto tcpip.NetworkProtocolNumber
+
+	// Source is the source address of the protected packets.
+	Source tcpip.Address
+
+	// Mode is the mode of the state.
+	Mode XFRMMode
+
+	// ReqID links the state to the templates of policies with the same
+	// ReqID.
+	ReqID uint32
+
+	// Selector restricts the traffic the state protects.
+	Selector XFRMSelector
+
+	// ReplayWindow is the size of the anti-replay window in packets. Zero
+	// disables replay protection.
+	ReplayWindow uint8
+
+	// Flags holds the XFRM_STATE_* flags of the state.
+	Flags uint8
+
+	// AEAD is the algorithm of the state. It is nil for states allocated by
+	// AllocateXFRMSPI that haven't been updated yet.
+	AEAD *XFRMAlgorithm
+
+	// Lifetime holds the limits of the lifetime of the state.
+	Lifetime XFRMLifetime
+}
+
+// XFRMStateInfo is an IPsec state with its counters.
+//
+// +stateify savable
+type XFRMStateInfo struct {
+	XFRMState
+
+	// AddTime is the time the state was added.
+	AddTime time.Time `state:".(int64)"`
+
+	// UseTime is the time the state was first used, if any.
+	UseTime time.Time `state:".(int64)"`
+
+	// Bytes and Packets count the traffic protected by the state.
+	Bytes   uint64
+	Packets uint64
+
+	// OutputSequence is the sequence number of the last packet sent.
+	OutputSequence uint32
+
+	// InputSequence is the highest sequence number received.
+	InputSequence uint32
+
+	// ReplayBitmap holds the sequence numbers received in the anti-replay
+	// window, the lowest bit being InputSequence.
+	ReplayBitmap uint32
+
+	// ReplayDrops counts the packets dropped as replays.
+	ReplayDrops uint32
+
+	// IntegrityFailures counts the packets dropped because they failed
+	// authentication.
+	IntegrityFailures uint32
+}
+
+// XFRMTemplate describes the state that must protect the packets of an
+// IPsec policy.
+//
+// +stateify savable
+type XFRMTemplate struct {
+	// ID selects the state. An unspecified destination selects that of the
+	// packets in transport mode, and a zero SPI selects any.
+	ID XFRMStateID
+
+	// NetProto is the network protocol of the addresses of the template.
+	NetProto tcpip.NetworkProtocolNumber
+
+	// Source is the source address of the state. An unspecified address
+	// selects any.
+	Source tcpip.Address
+
+	// ReqID selects states with the same ReqID, unless it is zero.
+	ReqID uint32
+
+	// Mode is the mode of the state.
+	Mode XFRMMode
+
+	// Share is the XFRM_SHARE_* mode of the template. It is only reported.
+	Share uint8
+
+	// Optional templates don't have to be applied.
+	Optional bool
+
+	// AuthAlgorithms, EncryptionAlgorithms and CompressionAlgorithms are
+	// the masks of the algorithms the state may use. They are only reported.
+	AuthAlgorithms        uint32
+	EncryptionAlgorithms  uint32
+	CompressionAlgorithms uint32
+}
+
+// XFRMPolicyAction is the action of an IPsec policy. Values match
+// XFRM_POLICY_ALLOW and XFRM_POLICY_BLOCK.
+type XFRMPolicyAction uint8
+
+const (
+	// XFRMPolicyAllow lets the packets through, protected by the templates
+	// of the policy.
+	XFRMPolicyAllow XFRMPolicyAction = iota
+
+	// XFRMPolicyBlock drops the packets.
+	XFRMPolicyBlock
+)
+
+// XFRMPolicy is an IPsec policy.
+//
+// +stateify savable
+type XFRMPolicy struct {
+	// Selector selects the packets of the policy.
+	Selector XFRMSelector
+
+	// Direction is the direction of the packets of the policy.
+	Direction XFRMDirection
+
+	// Priority orders the policies, the lowest value first.
+	Priority uint32
+
+	// Index identifies the policy. A zero index is allocated when the
+	// policy is added.
+	Index uint32
+
+	// Action is the action of the policy.
+	Action XFRMPolicyAction
+
+	// Flags and Share hold the XFRM_POLICY_* flags and XFRM_SHARE_* mode of
+	// the policy. They are only reported.
+	Flags uint8
+	Share uint8
+
+	// Templates describe the states that protect the packets. Policies
+	// without templates let packets through unprotected.
+	Templates []XFRMTemplate
+
+	// Lifetime holds the limits of the lifetime of the policy. It is only
+	// reported.
+	Lifetime XFRMLifetime
+}
+
+// XFRMPolicyInfo is an IPsec policy with its counters.
+type XFRMPolicyInfo struct {
+	XFRMPolicy
+
+	// AddTime is the time the policy was added.
+	AddTime time.Time
+
+	// UseTime is the time the policy was last used, if any.
+	UseTime time.Time
+}
+
+// XFRMStats are the IPsec statistics of a stack, named after those of
+// /proc/net/xfrm_stat on Linux.
+//
+// +stateify savable
+type XFRMStats struct {
+	InError           tcpip.StatCounter
+	InNoStates        tcpip.StatCounter
+	InStateProtoError tcpip.StatCounter
+	InStateSeqError   tcpip.StatCounter
+	InStateExpired    tcpip.StatCounter
+	InTmplMismatch    tcpip.StatCounter
+	InPolBlock        tcpip.StatCounter
+	OutError          tcpip.StatCounter
+	OutNoStates       tcpip.StatCounter
+	OutStateSeqError  tcpip.StatCounter
+	OutStateExpired   tcpip.StatCounter
+	OutPolBlock       tcpip.StatCounter
+}
+
+// XFRMDispatcher receives the IPsec events of a stack. Implementations must
+// be savable.
+type XFRMDispatcher interface {
+	// OnXFRMStateExpired is called when a state reaches a soft or hard
+	// limit of its lifetime. The state is removed when it reaches a hard
+	// limit.
+	OnXFRMStateExpired(info XFRMStateInfo, hard bool)
+}
+
+// xfrmState is an IPsec state of the database.
+//
+// +stateify savable
+type xfrmState struct {
+	// cfg is the configuration of the state. It is immutable.
+	cfg XFRMState
+
+	// aead and salt are the cipher of the state, if any. aead is rebuilt
+	// from cfg on restore.
+	aead cipher.AEAD `state:"nosave"`
+	salt [xfrmGCMSaltSize]byte
+
+	mu sync.Mutex `state:"nosave"`
+
+	// info holds the counters of the state.
+	// +checklocks:mu
+	info XFRMStateInfo
+
+	// softExpired is set once the state has reached a soft limit.
+	// +checklocks:mu
+	softExpired bool
+
+	// dead is set once the state is removed from the database.
+	// +checklocks:mu
+	dead bool
+
+	// timers fire when the state reaches time limits of its lifetime. They
+	// are rearmed on restore.
+	// +checklocks:mu
+	timers []tcpip.Timer `state:"nosave"`
+}
+
+// xfrmPolicy is an IPsec policy of the database.
+//
+// +stateify savable
+type xfrmPolicy struct {
+	// cfg is the policy. It is immutable.
+	cfg XFRMPolicy
+
+	addTime time.Time `state:".(int64)"`
+
+	// useTime is the time the policy was last used, in nanoseconds since the
+	// Unix epoch.
+	useTime atomicbitops.Int64
+}
+
+// xfrmDB holds the IPsec states and policies of a stack.
+//
+// +stateify savable
+type xfrmDB struct {
+	mu sync.RWMutex `state:"nosave"`
+
+	// +checklocks:mu
+	states map[XFRMStateID]*xfrmState
+
+	// policies are sorted by priority, and then by insertion order.
+	// +checklocks:mu
+	policies []*xfrmPolicy
+
+	// policyIndex generates the indices of policies, as Linux does.
+	// +checklocks:mu
+	policyIndex uint32
+
+	// dispatcher receives the IPsec events of the stack, if set. It is saved
+	// so that event subscribers keep receiving events after restore.
+	// +checklocks:mu
+	dispatcher XFRMDispatcher
+
+	// hasPolicies is set when the database holds policies, so that packets
+	// can skip policy lookups otherwise.
+	hasPolicies atomicbitops.Bool
+
+	// espRegistered is set once the handler of ESP packets is registered
+	// with the stack. The handler is saved with the tunnel handlers of the
+	// stack, so it isn't registered again after restore.
+	// +checklocks:mu
+	espRegistered bool
+
+	stats XFRMStats
+}
+
+// XFRMStats returns the IPsec statistics of the stack.
+func (s *Stack) XFRMStats() *XFRMStats {
+	return &s.xfrm.stats
+}
+
+// SetXFRMDispatcher sets the receiver of the IPsec events of the stack.
+func (s *Stack) SetXFRMDispatcher(d XFRMDispatcher) {
+	s.xfrm.mu.Lock()
+	defer s.xfrm.mu.Unlock()
+	s.xfrm.dispatcher = d
+}
+
+// xfrmDispatcher returns the receiver of the IPsec events of the stack.
+func (s *Stack) xfrmDispatcher() XFRMDispatcher {
+	s.xfrm.mu.RLock()
+	defer s.xfrm.mu.RUnlock()
+	return s.xfrm.dispatcher
+}
+
+// newXFRMState validates cfg and creates a state for it.
+func newXFRMState(cfg XFRMState, now time.Time) (*xfrmState, tcpip.Error) {
+	if cfg.ID.Protocol != header.ESPProtocolNumber {
+		return nil, &tcpip.ErrNotSupported{}
+	}
+	if cfg.Mode != XFRMModeTransport && cfg.Mode != XFRMModeTunnel {
+		return nil, &tcpip.ErrNotSupported{}
+	}
+	switch cfg.NetProto {
+	case header.IPv4ProtocolNumber, header.IPv6ProtocolNumber:
+	default:
+		return nil, &tcpip.ErrNotSupported{}
+	}
+	if cfg.ID.Destination.Len() == 0 || cfg.ID.Destination.Len() != cfg.Source.Len() {
+		return nil, &tcpip.ErrInvalidOptionValue{}
+	}
+	if cfg.Flags&xfrmStateESN != 0 {
+		// Extended sequence numbers aren't supported.
+		return nil, &tcpip.ErrNotSupported{}
+	}
+	if cfg.ReplayWindow > xfrmMaxReplayWindow {
+		cfg.ReplayWindow = xfrmMaxReplayWindow
+	}
+
+	var (
+		aead cipher.AEAD
+		salt [xfrmGCMSaltSize]byte
+	)
+	if alg := cfg.AEAD; alg != nil {
+		var err tcpip.Error
+		if aead, err = newXFRMAEAD(alg); err != nil {
+			return nil, err
+		}
+		copy(salt[:], alg.Key[len(alg.Key)-xfrmGCMSaltSize:])
+		// The key is copied, as the caller owns it.
+		cfg.AEAD = &XFRMAlgorithm{
+			Name:      alg.Name,
+			Key:       slices.Clone(alg.Key),
+			ICVLength: alg.ICVLength,
+		}
+	}
+	return &xfrmState{
+		cfg:  cfg,
+		aead: aead,
+		salt: salt,
+		info: XFRMStateInfo{
+			XFRMState: cfg,
+			AddTime:   now,
+		},
+	}, nil
+}
+
+// newXFRMAEAD returns the cipher of alg, without its salt.
+func newXFRMAEAD(alg *XFRMAlgorithm) (cipher.AEAD, tcpip.Error) {
+	if alg.Name != XFRMAlgorithmAESGCM {
+		return nil, &tcpip.ErrNotSupported{}
+	}
+	if len(alg.Key) <= xfrmGCMSaltSize {
+		return nil, &tcpip.ErrInvalidOptionValue{}
+	}
+	block, err := aes.NewCipher(alg.Key[:len(alg.Key)-xfrmGCMSaltSize])
+	if err != nil {
+		return nil, &tcpip.ErrInvalidOptionValue{}
+	}
+	// Go doesn't support the 8 bytes ICV allowed by RFC 4106.
+	if alg.ICVLength != 12 && alg.ICVLength != 16 {
+		return nil, &tcpip.ErrNotSupported{}
+	}
+	aead, err := cipher.NewGCMWithTagSize(block, alg.ICVLength)
+	if err != nil {
+		return nil, &tcpip.ErrInvalidOptionValue{}
+	}
+	return aead, nil
+}
+
+// larval returns whether the state was allocated by AllocateXFRMSPI and not
+// updated yet. Packets are never processed by larval states.
+func (st *xfrmState) larval() bool {
+	return st.aead == nil
+}
+
+// armTimersLocked starts the timers of the time limits of the lifetime of
+// the state that are measured from d ago.
+//
+// +checklocks:st.mu
+func (st *xfrmState) armTimersLocked(s *Stack, soft, hard time.Duration) {
+	if soft != 0 {
+		st.timers = append(st.timers, s.clock.AfterFunc(soft, func() {
+			s.expireXFRMState(st, false /* hard */)
+		}))
+	}
+	if hard != 0 {
+		st.timers = append(st.timers, s.clock.AfterFunc(hard, func() {
+			s.expireXFRMState(st, true /* hard */)
+		}))
+	}
+}
+
+// killLocked marks the state as removed from the database.
+//
+// +checklocks:st.mu
+func (st *xfrmState) killLocked() {
+	st.dead = true
+	for _, t := range st.timers {
+		t.Stop()
+	}
+	st.timers = nil
+}
+
+// snapshot returns the state with its counters.
+func (st *xfrmState) snapshot() XFRMStateInfo {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.info
+}
+
+// expireXFRMState reports that st reached a limit of its lifetime, and
+// removes it if the limit is hard.
+func (s *Stack) expireXFRMState(st *xfrmState, hard bool) {
+	st.mu.Lock()
+	if st.dead || (!hard && st.softExpired) {
+		st.mu.Unlock()
+		return
+	}
+	if hard {
+		st.killLocked()
+	} else {
+		st.softExpired = true
+	}
+	info := st.info
+	st.mu.Unlock()
+
+	if hard {
+		s.xfrm.mu.Lock()
+		if s.xfrm.states[st.cfg.ID] == st {
+			delete(s.xfrm.states, st.cfg.ID)
+		}
+		s.xfrm.mu.Unlock()
+	}
+	if d := s.xfrmDispatcher(); d != nil {
+		d.OnXFRMStateExpired(info, hard)
+	}
+}
+
+// AddXFRMState adds an IPsec state. It fails with ErrDuplicateAddress if a
+// state with the same ID exists.
+func (s *Stack) AddXFRMState(cfg XFRMState) (XFRMStateInfo, tcpip.Error) {
+	return s.addXFRMState(cfg, false /* update */)
+}
+
+// UpdateXFRMState replaces an IPsec state, keeping its counters. It fails
+// with ErrNoSuchFile if there is no state with the same ID.
+func (s *Stack) UpdateXFRMState(cfg XFRMState) (XFRMStateInfo, tcpip.Error) {
+	return s.addXFRMState(cfg, true /* update */)
+}
+
+func (s *Stack) addXFRMState(cfg XFRMState, update bool) (XFRMStateInfo, tcpip.Error) {
+	if cfg.AEAD == nil {
+		// ESP needs an algorithm.
+		return XFRMStateInfo{}, &tcpip.ErrInvalidOptionValue{}
+	}
+	st, err := newXFRMState(cfg, s.clock.Now())
+	if err != nil {
+		return XFRMStateInfo{}, err
+	}
+
+	db := &s.xfrm
+	db.mu.Lock()
+	old, ok := db.states[cfg.ID]
+	if ok && !update {
+		db.mu.Unlock()
+		return XFRMStateInfo{}, &tcpip.ErrDuplicateAddress{}
+	}
+	if !ok && update {
+		db.mu.Unlock()
+		return XFRMStateInfo{}, &tcpip.ErrNoSuchFile{}
+	}
+
+	st.mu.Lock()
+	if old != nil {
+		old.mu.Lock()
+		if !old.larval() {
+			// Keep the counters of the replaced state.
+			st.info = old.info
+			st.info.XFRMState = st.cfg
+		}
+		old.killLocked()
+		old.mu.Unlock()
+	}
+	lft := &st.cfg.Lifetime
+	st.armTimersLocked(s, lft.SoftAdd, lft.HardAdd)
+	info := st.info
+	st.mu.Unlock()
+
+	if db.states == nil {
+		db.states = make(map[XFRMStateID]*xfrmState)
+	}
+	db.states[cfg.ID] = st
+	registerESP := !db.espRegistered
+	db.espRegistered = true
+	db.mu.Unlock()
+
+	if registerESP {
+		s.RegisterTunnelHandler(header.ESPProtocolNumber, xfrmESPHandler{s})
+	}
+	return info, nil
+}
+
+// AllocateXFRMSPI allocates an SPI in [min, max] for a state to be
+// completed by UpdateXFRMState, and adds the incomplete state with the given
+// configuration, which doesn't need an algorithm. The incomplete state is
+// removed if it isn't updated within 30 seconds.
+//
+// If an incomplete state with the same addresses, mode and ReqID exists, it
+// is returned instead.
+func (s *Stack) AllocateXFRMSPI(cfg XFRMState, min, max uint32) (XFRMStateInfo, tcpip.Error) {
+	if min > max {
+		return XFRMStateInfo{}, &tcpip.ErrInvalidOptionValue{}
+	}
+	cfg.AEAD = nil
+	cfg.Lifetime = XFRMLifetime{}
+
+	db := &s.xfrm
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, st := range db.states {
+		c := &st.cfg
+		if st.larval() && c.ID.Destination == cfg.ID.Destination && c.ID.Protocol == cfg.ID.Protocol &&
+			c.Source == cfg.Source && c.Mode == cfg.Mode && c.ReqID == cfg.ReqID &&
+			c.ID.SPI >= min && c.ID.SPI <= max {
+			return st.snapshot(), nil
+		}
+	}
+
+	found := false
+	for i := uint64(0); i <= uint64(max-min) && i < 1<<16; i++ {
+		cfg.ID.SPI = min
+		if min != max {
+			cfg.ID.SPI = min + s.secureRNG.Uint32()%(max-min+1)
+		}
+		if _, ok := db.states[cfg.ID]; !ok && cfg.ID.SPI != 0 {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return XFRMStateInfo{}, &tcpip.ErrNoSuchFile{}
+	}
+
+	st, err := newXFRMState(cfg, s.clock.Now())
+	if err != nil {
+		return XFRMStateInfo{}, err
+	}
+	st.mu.Lock()
+	st.armTimersLocked(s, 0 /* soft */, xfrmLarvalLifetime)
+	info := st.info
+	st.mu.Unlock()
+	if db.states == nil {
+		db.states = make(map[XFRMStateID]*xfrmState)
+	}
+	db.states[cfg.ID] = st
+	return info, nil
+}
+
+// RemoveXFRMState removes the IPsec state with the given ID. It fails with
+// ErrNoSuchFile if there is none.
+func (s *Stack) RemoveXFRMState(id XFRMStateID) (XFRMStateInfo, tcpip.Error) {
+	db := &s.xfrm
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	st, ok := db.states[id]
+	if !ok {
+		return XFRMStateInfo{}, &tcpip.ErrNoSuchFile{}
+	}
+	delete(db.states, id)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.killLocked()
+	return st.info, nil
+}
+
+// GetXFRMState returns the IPsec state with the given ID.
+func (s *Stack) GetXFRMState(id XFRMStateID) (XFRMStateInfo, bool) {
+	st := s.xfrmState(id)
+	if st == nil {
+		return XFRMStateInfo{}, false
+	}
+	return st.snapshot(), true
+}
+
+// XFRMStates returns the IPsec states of the stack, sorted by destination
+// and SPI.
+func (s *Stack) XFRMStates() []XFRMStateInfo {
+	db := &s.xfrm
+	db.mu.RLock()
+	states := make([]XFRMStateInfo, 0, len(db.states))
+	for _, st := range db.states {
+		states = append(states, st.snapshot())
+	}
+	db.mu.RUnlock()
+	slices.SortFunc(states, func(a, b XFRMStateInfo) int {
+		if c := bytes.Compare(a.ID.Destination.AsSlice(), b.ID.Destination.AsSlice()); c != 0 {
+			return c
+		}
+		if a.ID.SPI != b.ID.SPI {
+			if a.ID.SPI < b.ID.SPI {
+				return -1
+			}
+			return 1
+		}
+		return int(a.ID.Protocol) - int(b.ID.Protocol)
+	})
+	return states
+}
+
+// FlushXFRMStates removes the IPsec states of the given protocol, or all of
+// them if protocol is zero. It returns the number of states removed.
+func (s *Stack) FlushXFRMStates(protocol tcpip.TransportProtocolNumber) int {
+	db := &s.xfrm
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	n := 0
+	for id, st := range db.states {
+		if protocol != 0 && id.Protocol != protocol {
+			continue
+		}
+		delete(db.states, id)
+		st.mu.Lock()
+		st.killLocked()
+		st.mu.Unlock()
+		n++
+	}
+	return n
+}
+
+// xfrmState returns the state with the given ID, or nil.
+func (s *Stack) xfrmState(id XFRMStateID) *xfrmState {
+	db := &s.xfrm
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.states[id]
+}
+
+// validate checks that the policy can be enforced.
+func (p *XFRMPolicy) validate() tcpip.Error {
+	if p.Direction > XFRMDirectionForward || p.Action > XFRMPolicyBlock {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+	required := 0
+	for i := range p.Templates {
+		t := &p.Templates[i]
+		if t.Mode != XFRMModeTransport && t.Mode != XFRMModeTunnel {
+			return &tcpip.ErrNotSupported{}
+		}
+		if t.Optional {
+			continue
+		}
+		if t.ID.Protocol != header.ESPProtocolNumber {
+			return &tcpip.ErrNotSupported{}
+		}
+		if t.Mode == XFRMModeTunnel && t.ID.Destination.Len() == 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		required++
+	}
+	if required > 1 {
+		// Bundles of states aren't supported.
+		return &tcpip.ErrNotSupported{}
+	}
+	return nil
+}
+
+// requiredTemplate returns the template that must be applied to the packets
+// of the policy, if any.
+func (p *xfrmPolicy) requiredTemplate() *XFRMTemplate {
+	for i := range p.cfg.Templates {
+		if t := &p.cfg.Templates[i]; !t.Optional {
+			return t
+		}
+	}
+	return nil
+}
+
+// info returns the policy with its counters.
+func (p *xfrmPolicy) info() XFRMPolicyInfo {
+	info := XFRMPolicyInfo{
+		XFRMPolicy: p.cfg,
+		AddTime:    p.addTime,
+	}
+	if t := p.useTime.Load(); t != 0 {
+		info.UseTime = time.Unix(0, t)
+	}
+	return info
+}
+
+// AddXFRMPolicy adds an IPsec policy. If update is false, it fails with
+// ErrDuplicateAddress if a policy with the same direction and selector, or
+// with the same index, exists; otherwise such a policy is replaced.
+func (s *Stack) AddXFRMPolicy(cfg XFRMPolicy, update bool) (XFRMPolicyInfo, tcpip.Error) {
+	if err := cfg.validate(); err != nil {
+		return XFRMPolicyInfo{}, err
+	}
+	cfg.Templates = slices.Clone(cfg.Templates)
+
+	db := &s.xfrm
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	old := -1
+	for i, p := range db.policies {
+		if (p.cfg.Direction == cfg.Direction && p.cfg.Selector == cfg.Selector) || (cfg.Index != 0 && p.cfg.Index == cfg.Index) {
+			old = i
+			break
+		}
+	}
+	if old >= 0 {
+		if !update {
+			return XFRMPolicyInfo{}, &tcpip.ErrDuplicateAddress{}
+		}
+		cfg.Index = db.policies[old].cfg.Index
+		db.policies = slices.Delete(db.policies, old, old+1)
+	} else if cfg.Index == 0 {
+		cfg.Index = db.newPolicyIndexLocked(cfg.Direction)
+	}
+
+	p := &xfrmPolicy{
+		cfg:     cfg,
+		addTime: s.clock.Now(),
+	}
+	i := len(db.policies)
+	for j, q := range db.policies {
+		if q.cfg.Priority > cfg.Priority {
+			i = j
+			break
+		}
+	}
+	db.policies = slices.Insert(db.policies, i, p)
+	db.hasPolicies.Store(true)
+	return p.info(), nil
+}
+
+// newPolicyIndexLocked returns an unused policy index. As on Linux, the
+// direction is stored in the low bits of the index.
+//
+// +checklocks:db.mu
+func (db *xfrmDB) newPolicyIndexLocked(dir XFRMDirection) uint32 {
+	for {
+		db.policyIndex += 8
+		index := db.policyIndex | uint32(dir)
+		if index == 0 || slices.ContainsFunc(db.policies, func(p *xfrmPolicy) bool { return p.cfg.Index == index }) {
+			continue
+		}
+		return index
+	}
+}
+
+// findPolicyLocked returns the position of the policy with the given index,
+// or with the given direction and selector if index is zero, or -1.
+//
+// +checklocks:db.mu
+func (db *xfrmDB) findPolicyLocked(dir XFRMDirection, sel *XFRMSelector, index uint32) int {
+	return slices.IndexFunc(db.policies, func(p *xfrmPolicy) bool {
+		if index != 0 {
+			return p.cfg.Index == index
+		}
+		return p.cfg.Direction == dir && p.cfg.Selector == *sel
+	})
+}
+
+// RemoveXFRMPolicy removes the IPsec policy with the given index, or with
+// the given direction and selector if index is zero. It fails with
+// ErrNoSuchFile if there is none.
+func (s *Stack) RemoveXFRMPolicy(dir XFRMDirection, sel XFRMSelector, index uint32) (XFRMPolicyInfo, tcpip.Error) {
+	db := &s.xfrm
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	i := db.findPolicyLocked(dir, &sel, index)
+	if i < 0 {
+		return XFRMPolicyInfo{}, &tcpip.ErrNoSuchFile{}
+	}
+	p := db.policies[i]
+	db.policies = slices.Delete(db.policies, i, i+1)
+	db.hasPolicies.Store(len(db.policies) != 0)
+	return p.info(), nil
+}
+
+// GetXFRMPolicy returns the IPsec policy with the given index, or with the
+// given direction and selector if index is zero.
+func (s *Stack) GetXFRMPolicy(dir XFRMDirection, sel XFRMSelector, index uint32) (XFRMPolicyInfo, bool) {
+	db := &s.xfrm
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	i := db.findPolicyLocked(dir, &sel, index)
+	if i < 0 {
+		return XFRMPolicyInfo{}, false
+	}
+	return db.policies[i].info(), true
+}
+
+// XFRMPolicies returns the IPsec policies of the stack, in the order they
+// are looked up.
+func (s *Stack) XFRMPolicies() []XFRMPolicyInfo {
+	db := &s.xfrm
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	policies := make([]XFRMPolicyInfo, 0, len(db.policies))
+	for _, p := range db.policies {
+		policies = append(policies, p.info())
+	}
+	return policies
+}
+
+// FlushXFRMPolicies removes all the IPsec policies of the stack. It returns
+// the number of policies removed.
+func (s *Stack) FlushXFRMPolicies() int {
+	db := &s.xfrm
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	n := len(db.policies)
+	db.policies = nil
+	db.hasPolicies.Store(false)
+	return n
+}
+
+// lookupXFRMPolicy returns the policy of the given direction that applies to
+// the flow, or nil.
+func (s *Stack) lookupXFRMPolicy(dir XFRMDirection, f *xfrmFlow) *xfrmPolicy {
+	db := &s.xfrm
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, p := range db.policies {
+		if p.cfg.Direction == dir && p.cfg.Selector.matches(f) {
+			p.useTime.Store(s.clock.Now().UnixNano())
+			return p
+		}
+	}
+	return nil
+}
+
+// matchesState returns whether the template accepts packets received through
+// st.
+func (t *XFRMTemplate) matchesState(st *xfrmState) bool {
+	c := &st.cfg
+	return t.ID.Protocol == c.ID.Protocol && t.Mode == c.Mode &&
+		(t.ID.SPI == 0 || t.ID.SPI == c.ID.SPI) &&
+		(t.ReqID == 0 || t.ReqID == c.ReqID) &&
+		(t.ID.Destination.Len() == 0 || t.ID.Destination == c.ID.Destination) &&
+		(t.Source.Len() == 0 || t.Source == c.Source)
+}
+
+// findOutputState returns the state that applies the template to the flow,
+// or nil. As on Linux, states that haven't expired are preferred, and then
+// the newest ones, so that traffic moves to new states once they are added
+// by rekeying.
+func (s *Stack) findOutputState(t *XFRMTemplate, f *xfrmFlow) *xfrmState {
+	dst, src := t.ID.Destination, t.Source
+	if t.Mode == XFRMModeTransport {
+		if dst.Len() == 0 {
+			dst = f.dst
+		}
+		if src.Len() == 0 {
+			src = f.src
+		}
+	}
+
+	db := &s.xfrm
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var (
+		best        *xfrmState
+		bestExpired bool
+		bestAdded   time.Time
+	)
+	for _, st := range db.states {
+		c := &st.cfg
+		if st.larval() || c.ID.Destination != dst || (src.Len() != 0 && c.Source != src) ||
+			c.ID.Protocol != t.ID.Protocol || c.Mode != t.Mode ||
+			(t.ID.SPI != 0 && t.ID.SPI != c.ID.SPI) || (t.ReqID != 0 && t.ReqID != c.ReqID) ||
+			!c.Selector.matches(f) {
+			continue
+		}
+		st.mu.Lock()
+		dead, expired, added := st.dead, st.softExpired, st.info.AddTime
+		st.mu.Unlock()
+		if dead {
+			continue
+		}
+		if best == nil || (bestExpired && !expired) || (bestExpired == expired && added.After(bestAdded)) {
+			best, bestExpired, bestAdded = st, expired, added
+		}
+	}
+	return best
+}
+
+// accountLocked counts a packet of the given size protected by the state and
+// checks the limits of its lifetime. It returns false if the packet must be
+// dropped, and whether a soft or hard limit was reached.
+//
+// +checklocks:st.mu
+func (st *xfrmState) accountLocked(s *Stack, size int) (ok, soft, hard bool) {
+	if st.dead {
+		return false, false, false
+	}
+	info := &st.info
+	if info.UseTime.IsZero() {
+		info.UseTime = s.clock.Now()
+		lft := &st.cfg.Lifetime
+		st.armTimersLocked(s, lft.SoftUse, lft.HardUse)
+	}
+	info.Bytes += uint64(size)
+	info.Packets++
+	lft := &st.cfg.Lifetime
+	if (lft.HardBytes != 0 && info.Bytes >= lft.HardBytes) || (lft.HardPackets != 0 && info.Packets >= lft.HardPackets) {
+		return false, false, true
+	}
+	soft = (lft.SoftBytes != 0 && info.Bytes >= lft.SoftBytes) || (lft.SoftPackets != 0 && info.Packets >= lft.SoftPackets)
+	return true, soft && !st.softExpired, false
+}
+
+// XFRMOutput applies the IPsec output policy of the stack to pkt, an
+// outgoing packet with a complete network header routed through r. It
+// returns false if pkt must be sent as is. Otherwise, pkt must not be sent,
+// and the returned error is the result of sending it protected, if it is.
+//
+// Packets the policy requires protection for are dropped if there is no
+// state to protect them, as Linux does by default.
+func (s *Stack) XFRMOutput(r *Route, pkt *PacketBuffer) (bool, tcpip.Error) {
+	if !s.xfrm.hasPolicies.Load() || pkt.XFRMBypass {
+		return false, nil
+	}
+	f, ok := xfrmFlowOf(pkt, r.NICID())
+	if !ok {
+		return false, nil
+	}
+	p := s.lookupXFRMPolicy(XFRMDirectionOut, &f)
+	if p == nil {
+		return false, nil
+	}
+	if p.cfg.Action == XFRMPolicyBlock {
+		s.xfrm.stats.OutPolBlock.Increment()
+		return true, &tcpip.ErrNotPermitted{}
+	}
+	t := p.requiredTemplate()
+	if t == nil {
+		return false, nil
+	}
+	st := s.findOutputState(t, &f)
+	if st == nil {
+		s.xfrm.stats.OutNoStates.Increment()
+		return true, nil
+	}
+	return true, s.espOutput(st, pkt)
+}
+
+// espOutput sends pkt protected by the ESP state st.
+func (s *Stack) espOutput(st *xfrmState, pkt *PacketBuffer) tcpip.Error {
+	if t := pkt.GSOOptions.Type; t != GSONone && t != GSOGvisor {
+		// Host segmentation offload would need to happen before
+		// encryption. Routes don't offer it while policies are installed,
+		// but endpoints may have picked it before.
+		s.xfrm.stats.OutError.Increment()
+		return &tcpip.ErrNotSupported{}
+	}
+
+	full := BufferSince(pkt.NetworkHeader())
+	defer full.Release()
+	data := full.Flatten()
+	nh := pkt.NetworkHeader().Slice()
+
+	var (
+		payload    []byte
+		nextHeader uint8
+		netProto   tcpip.NetworkProtocolNumber
+		src, dst   tcpip.Address
+		ttl, tos   uint8
+	)
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber:
+		ip := header.IPv4(nh)
+		nextHeader, ttl = ip.Protocol(), ip.TTL()
+		tos, _ = ip.TOS()
+		src, dst = ip.SourceAddress(), ip.DestinationAddress()
+	case header.IPv6ProtocolNumber:
+		ip := header.IPv6(nh)
+		nextHeader, ttl = ip.NextHeader(), ip.HopLimit()
+		tos, _ = ip.TOS()
+		src, dst = ip.SourceAddress(), ip.DestinationAddress()
+	}
+	switch st.cfg.Mode {
+	case XFRMModeTransport:
+		if pkt.NetworkProtocolNumber == header.IPv6ProtocolNumber && len(nh) != header.IPv6MinimumSize {
+			// ESP would have to be inserted among extension headers.
+			s.xfrm.stats.OutError.Increment()
+			return &tcpip.ErrNotSupported{}
+		}
+		// IPv4 options aren't carried over.
+		payload = data[len(nh):]
+		netProto = pkt.NetworkProtocolNumber
+	case XFRMModeTunnel:
+		payload = data
+		nextHeader = uint8(header.IPIPProtocolNumber)
+		if pkt.NetworkProtocolNumber == header.IPv6ProtocolNumber {
+			nextHeader = uint8(header.IPv6EncapsulationProtocolNumber)
+		}
+		netProto = st.cfg.NetProto
+		src, dst = st.cfg.Source, st.cfg.ID.Destination
+		// The route picks the hop limit of the outer header.
+		ttl = 0
+	}
+
+	st.mu.Lock()
+	ok, soft, hard := st.accountLocked(s, len(payload))
+	if ok {
+		st.info.OutputSequence++
+		if st.info.OutputSequence == 0 {
+			// The sequence number must not cycle.
+			st.info.OutputSequence--
+			ok, hard = false, true
+		}
+	}
+	seq := st.info.OutputSequence
+	st.mu.Unlock()
+	if soft || hard {
+		s.expireXFRMState(st, hard)
+	}
+	if !ok {
+		s.xfrm.stats.OutStateExpired.Increment()
+		return nil
+	}
+
+	// The payload is padded to 4 bytes with the trailer, as GCM doesn't
+	// need more.
+	padLen := (4 - (len(payload)+header.ESPTrailerSize)%4) % 4
+	plainLen := len(payload) + padLen + header.ESPTrailerSize
+	out := make([]byte, header.ESPHeaderSize+xfrmGCMIVSize+plainLen+st.aead.Overhead())
+	header.ESP(out).Encode(st.cfg.ID.SPI, seq)
+	iv := out[header.ESPHeaderSize:][:xfrmGCMIVSize]
+	// RFC 4106 only requires IVs to be unique for a key, which the sequence
+	// number is.
+	binary.BigEndian.PutUint64(iv, uint64(seq))
+	plain := out[header.ESPHeaderSize+xfrmGCMIVSize:][:plainLen]
+	copy(plain, payload)
+	for i := 0; i < padLen; i++ {
+		plain[len(payload)+i] = byte(i + 1)
+	}
+	plain[plainLen-2] = byte(padLen)
+	plain[plainLen-1] = nextHeader
+	var nonce [xfrmGCMSaltSize + xfrmGCMIVSize]byte
+	copy(nonce[:], st.salt[:])
+	copy(nonce[xfrmGCMSaltSize:], iv)
+	st.aead.Seal(plain[:0], nonce[:], plain, out[:header.ESPHeaderSize])
+
+	r, err := s.FindRoute(0, src, dst, netProto, false /* multicastLoop */)
+	if err != nil {
+		s.xfrm.stats.OutError.Increment()
+		return err
+	}
+	defer r.Release()
+	outPkt := NewPacketBuffer(PacketBufferOptions{
+		ReserveHeaderBytes: int(r.MaxHeaderLength()),
+		Payload:            buffer.MakeWithData(out),
+	})
+	defer outPkt.DecRef()
+	outPkt.XFRMBypass = true
+	outPkt.Owner = pkt.Owner
+	outPkt.Mark = pkt.Mark
+	if ttl == 0 {
+		ttl = r.DefaultTTL()
+	}
+	return r.WritePacket(NetworkHeaderParams{
+		Protocol: header.ESPProtocolNumber,
+		TTL:      ttl,
+		TOS:      tos,
+	}, outPkt)
+}
+
+// xfrmESPHandler receives the ESP packets addressed to the stack.
+//
+// +stateify savable
+type xfrmESPHandler struct {
+	s *Stack
+}
+
+// HandleTunnelPacket implements TunnelHandler.HandleTunnelPacket.
+func (h xfrmESPHandler) HandleTunnelPacket(pkt *PacketBuffer) bool {
+	s := h.s
+	stats := &s.xfrm.stats
+	hdr, ok := pkt.Data().PullUp(header.ESPHeaderSize)
+	if !ok {
+		stats.InError.Increment()
+		return true
+	}
+	esp := header.ESP(hdr)
+	st := s.xfrmState(XFRMStateID{
+		Destination: pkt.Network().DestinationAddress(),
+		SPI:         esp.SPI(),
+		Protocol:    header.ESPProtocolNumber,
+	})
+	if st == nil || st.larval() || st.cfg.NetProto != pkt.NetworkProtocolNumber {
+		stats.InNoStates.Increment()
+		return true
+	}
+	seq := esp.SequenceNumber()
+
+	buf := pkt.Data().ToBuffer()
+	data := buf.Flatten()
+	buf.Release()
+	if len(data) < header.ESPHeaderSize+xfrmGCMIVSize+header.ESPTrailerSize+st.aead.Overhead() {
+		stats.InError.Increment()
+		return true
+	}
+
+	st.mu.Lock()
+	replay := !st.checkReplayLocked(seq)
+	st.mu.Unlock()
+	if replay {
+		stats.InStateSeqError.Increment()
+		return true
+	}
+
+	var nonce [xfrmGCMSaltSize + xfrmGCMIVSize]byte
+	copy(nonce[:], st.salt[:])
+	copy(nonce[xfrmGCMSaltSize:], data[header.ESPHeaderSize:])
+	plain, err := st.aead.Open(nil, nonce[:], data[header.ESPHeaderSize+xfrmGCMIVSize:], data[:header.ESPHeaderSize])
+	if err != nil {
+		st.mu.Lock()
+		st.info.IntegrityFailures++
+		st.mu.Unlock()
+		stats.InStateProtoError.Increment()
+		return true
+	}
+
+	st.mu.Lock()
+	// The window may have moved while the packet was decrypted.
+	replay = !st.checkReplayLocked(seq)
+	var soft, hard bool
+	if !replay {
+		ok, soft, hard = st.accountLocked(s, len(plain))
+		if ok {
+			st.advanceReplayLocked(seq)
+		}
+	}
+	st.mu.Unlock()
+	if soft || hard {
+		s.expireXFRMState(st, hard)
+	}
+	if replay {
+		stats.InStateSeqError.Increment()
+		return true
+	}
+	if !ok {
+		stats.InStateExpired.Increment()
+		return true
+	}
+
+	padLen := int(plain[len(plain)-2])
+	nextHeader := plain[len(plain)-1]
+	if padLen+header.ESPTrailerSize > len(plain) {
+		stats.InError.Increment()
+		return true
+	}
+	inner := plain[:len(plain)-header.ESPTrailerSize-padLen]
+
+	var (
+		netProto tcpip.NetworkProtocolNumber
+		packet   []byte
+	)
+	switch st.cfg.Mode {
+	case XFRMModeTransport:
+		netProto = pkt.NetworkProtocolNumber
+		switch nh := pkt.NetworkHeader().Slice(); netProto {
+		case header.IPv4ProtocolNumber:
+			packet = append(slices.Clip(nh), inner...)
+			ip := header.IPv4(packet)
+			ip.SetProtocol(nextHeader)
+			ip.SetTotalLength(uint16(len(packet)))
+			// The packet was reassembled if it was fragmented.
+			ip.SetFlagsFragmentOffset(ip.Flags()&header.IPv4FlagDontFragment, 0)
+			ip.SetChecksum(0)
+			ip.SetChecksum(^ip.CalculateChecksum())
+		case header.IPv6ProtocolNumber:
+			// Extension headers before ESP have been processed already.
+			packet = append(slices.Clip(nh[:header.IPv6MinimumSize]), inner...)
+			ip := header.IPv6(packet)
+			ip.SetNextHeader(nextHeader)
+			ip.SetPayloadLength(uint16(len(inner)))
+		}
+	case XFRMModeTunnel:
+		switch tcpip.TransportProtocolNumber(nextHeader) {
+		case header.IPIPProtocolNumber:
+			netProto = header.IPv4ProtocolNumber
+		case header.IPv6EncapsulationProtocolNumber:
+			netProto = header.IPv6ProtocolNumber
+		default:
+			stats.InError.Increment()
+			return true
+		}
+		packet = inner
+	}
+
+	s.mu.RLock()
+	nic, ok := s.nics[pkt.NICID]
+	s.mu.RUnlock()
+	if !ok {
+		return true
+	}
+	newPkt := NewPacketBuffer(PacketBufferOptions{
+		Payload: buffer.MakeWithData(packet),
+	})
+	defer newPkt.DecRef()
+	newPkt.xfrmInput = st
+	nic.DeliverNetworkPacket(netProto, newPkt)
+	return true
+}
+
+// checkReplayLocked returns whether a packet with the given sequence number
+// may be accepted.
+//
+// +checklocks:st.mu
+func (st *xfrmState) checkReplayLocked(seq uint32) bool {
+	if st.cfg.ReplayWindow == 0 {
+		return true
+	}
+	if seq == 0 {
+		return false
+	}
+	last := st.info.InputSequence
+	if seq > last {
+		return true
+	}
+	diff := last - seq
+	if diff >= uint32(st.cfg.ReplayWindow) {
+		return false
+	}
+	return st.info.ReplayBitmap&(1<<diff) == 0
+}
+
+// advanceReplayLocked records the reception of a packet with the given
+// sequence number.
+//
+// +checklocks:st.mu
+func (st *xfrmState) advanceReplayLocked(seq uint32) {
+	info := &st.info
+	if seq > info.InputSequence {
+		if diff := seq - info.InputSequence; diff < xfrmMaxReplayWindow {
+			info.ReplayBitmap = info.ReplayBitmap<<diff | 1
+		} else {
+			info.ReplayBitmap = 1
+		}
+		info.InputSequence = seq
+		return
+	}
+	if diff := info.InputSequence - seq; diff < xfrmMaxReplayWindow {
+		info.ReplayBitmap |= 1 << diff
+	}
+}
+
+// xfrmInputAllowed returns whether the IPsec policy of the given direction
+// lets pkt, a received packet, through. Packets are let through if they were
+// received through the states required by the policy.
+func (s *Stack) xfrmInputAllowed(dir XFRMDirection, pkt *PacketBuffer) bool {
+	if !s.xfrm.hasPolicies.Load() {
+		return true
+	}
+	f, ok := xfrmFlowOf(pkt, pkt.NICID)
+	if !ok {
+		return true
+	}
+	p := s.lookupXFRMPolicy(dir, &f)
+	if p == nil {
+		return true
+	}
+	if p.cfg.Action == XFRMPolicyBlock {
+		s.xfrm.stats.InPolBlock.Increment()
+		return false
+	}
+	t := p.requiredTemplate()
+	if t == nil {
+		return true
+	}
+	if pkt.xfrmInput == nil || !t.matchesState(pkt.xfrmInput) {
+		s.xfrm.stats.InTmplMismatch.Increment()
+		return false
+	}
+	return true
+}
+
+// XFRMCheckForward returns whether the IPsec forward policy of the stack
+// lets pkt, a packet being forwarded, through.
+func (s *Stack) XFRMCheckForward(pkt *PacketBuffer) bool {
+	return s.xfrmInputAllowed(XFRMDirectionForward, pkt)
+}
+
+// xfrmInputBypass returns whether the socket of ep receives packets
+// regardless of the IPsec input policy, as set with IP_XFRM_POLICY.
+func xfrmInputBypass(ep TransportEndpoint) bool {
+	sockEP, ok := ep.(interface {
+		SocketOptions() *tcpip.SocketOptions
+	})
+	return ok && sockEP.SocketOptions().GetXFRMInputBypass()
+}
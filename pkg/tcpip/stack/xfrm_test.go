@@ -0,0 +1,398 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
+	"gvisor.dev/gvisor/pkg/tcpip/link/veth"
+	"gvisor.dev/gvisor/pkg/tcpip/network/arp"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+const (
+	xfrmNICID    = 1
+	xfrmTestPort = 5000
+)
+
+var (
+	xfrmAddrs = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom4([4]byte{10, 0, 0, 1}), PrefixLen: 24},
+		{Address: tcpip.AddrFrom4([4]byte{10, 0, 0, 2}), PrefixLen: 24},
+	}
+	xfrmAddrs6 = [2]tcpip.AddressWithPrefix{
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}), PrefixLen: 64},
+		{Address: tcpip.AddrFrom16([16]byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}), PrefixLen: 64},
+	}
+
+	// xfrmKey is an AES-128 key followed by the salt of rfc4106.
+	xfrmKey = []byte("0123456789abcdefsalt")
+)
+
+func xfrmNetProto(addr tcpip.Address) tcpip.NetworkProtocolNumber {
+	if addr.Len() == header.IPv6AddressSize {
+		return ipv6.ProtocolNumber
+	}
+	return ipv4.ProtocolNumber
+}
+
+// newXFRMStacks returns two stacks connected by a veth pair with the given
+// addresses.
+func newXFRMStacks(t *testing.T, addrs [2]tcpip.AddressWithPrefix) [2]*stack.Stack {
+	t.Helper()
+	a, b := veth.NewPair(1500)
+	var stacks [2]*stack.Stack
+	for i, ep := range []*veth.Endpoint{a, b} {
+		s := stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol, arp.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{udp.NewProtocol},
+		})
+		t.Cleanup(func() {
+			s.Close()
+			s.Wait()
+		})
+		if err := s.CreateNIC(xfrmNICID, ethernet.New(ep)); err != nil {
+			t.Fatalf("CreateNIC(%d, _): %s", xfrmNICID, err)
+		}
+		protocolAddr := tcpip.ProtocolAddress{
+			Protocol:          xfrmNetProto(addrs[i].Address),
+			AddressWithPrefix: addrs[i],
+		}
+		if err := s.AddProtocolAddress(xfrmNICID, protocolAddr, stack.AddressProperties{}); err != nil {
+			t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", xfrmNICID, protocolAddr, err)
+		}
+		s.AddRoute(tcpip.Route{
+			Destination: addrs[i].Subnet(),
+			NIC:         xfrmNICID,
+		})
+		stacks[i] = s
+	}
+	return stacks
+}
+
+// xfrmSelector selects the UDP datagrams from src to dst.
+func xfrmSelector(src, dst tcpip.Address) stack.XFRMSelector {
+	return stack.XFRMSelector{
+		NetProto:             xfrmNetProto(src),
+		SourceAddress:        src,
+		SourcePrefixLen:      uint8(src.BitLen()),
+		DestinationAddress:   dst,
+		DestinationPrefixLen: uint8(dst.BitLen()),
+		Protocol:             udp.ProtocolNumber,
+	}
+}
+
+// xfrmSPI returns the SPI of the state protecting the traffic to the i-th
+// stack.
+func xfrmSPI(i int) uint32 {
+	return 0x100 + uint32(i)
+}
+
+// configureXFRM adds states and policies protecting the UDP traffic between
+// the stacks in the given mode, with the given key for the traffic to the
+// second stack.
+func configureXFRM(t *testing.T, stacks [2]*stack.Stack, addrs [2]tcpip.AddressWithPrefix, mode stack.XFRMMode, key []byte) {
+	t.Helper()
+	for i, s := range stacks {
+		for j := range stacks {
+			k := xfrmKey
+			if j == 1 {
+				k = key
+			}
+			st := stack.XFRMState{
+				ID: stack.XFRMStateID{
+					Destination: addrs[j].Address,
+					SPI:         xfrmSPI(j),
+					Protocol:    header.ESPProtocolNumber,
+				},
+				NetProto:     xfrmNetProto(addrs[j].Address),
+				Source:       addrs[1-j].Address,
+				Mode:         mode,
+				ReplayWindow: 32,
+				AEAD: &stack.XFRMAlgorithm{
+					Name:      stack.XFRMAlgorithmAESGCM,
+					Key:       k,
+					ICVLength: 16,
+				},
+			}
+			if _, err := s.AddXFRMState(st); err != nil {
+				t.Fatalf("AddXFRMState(%+v): %s", st, err)
+			}
+		}
+
+		local, remote := addrs[i].Address, addrs[1-i].Address
+		for _, p := range []stack.XFRMPolicy{
+			{
+				Selector:  xfrmSelector(local, remote),
+				Direction: stack.XFRMDirectionOut,
+				Templates: []stack.XFRMTemplate{{
+					ID: stack.XFRMStateID{
+						Destination: remote,
+						Protocol:    header.ESPProtocolNumber,
+					},
+					Source: local,
+					Mode:   mode,
+				}},
+			},
+			{
+				Selector:  xfrmSelector(remote, local),
+				Direction: stack.XFRMDirectionIn,
+				Templates: []stack.XFRMTemplate{{
+					ID: stack.XFRMStateID{
+						Destination: local,
+						Protocol:    header.ESPProtocolNumber,
+					},
+					Source: remote,
+					Mode:   mode,
+				}},
+			},
+		} {
+			if _, err := s.AddXFRMPolicy(p, false /* update */); err != nil {
+				t.Fatalf("AddXFRMPolicy(%+v, false): %s", p, err)
+			}
+		}
+	}
+}
+
+// exchangeXFRM sends UDP datagrams from the first stack to the second, and
+// returns whether one was received.
+func exchangeXFRM(t *testing.T, stacks [2]*stack.Stack, addrs [2]tcpip.AddressWithPrefix) bool {
+	t.Helper()
+	netProto := xfrmNetProto(addrs[0].Address)
+	server, err := gonet.DialUDP(stacks[1], &tcpip.FullAddress{Addr: addrs[1].Address, Port: xfrmTestPort}, nil, netProto)
+	if err != nil {
+		t.Fatalf("DialUDP(_, %s, nil, %d): %s", addrs[1].Address, netProto, err)
+	}
+	defer server.Close()
+	client, err := gonet.DialUDP(stacks[0], nil, &tcpip.FullAddress{Addr: addrs[1].Address, Port: xfrmTestPort}, netProto)
+	if err != nil {
+		t.Fatalf("DialUDP(_, nil, %s, %d): %s", addrs[1].Address, netProto, err)
+	}
+	defer client.Close()
+
+	// Link address resolution may drop the first datagrams, so keep
+	// sending until one is received.
+	want := []byte("hello through IPsec")
+	buf := make([]byte, 100)
+	for i := 0; i < 10; i++ {
+		if _, err := client.Write(want); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+		server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			continue
+		}
+		if got := buf[:n]; !bytes.Equal(got, want) {
+			t.Fatalf("got ReadFrom(_) = %q, want = %q", got, want)
+		}
+		return true
+	}
+	return false
+}
+
+func TestXFRMESP(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		addrs [2]tcpip.AddressWithPrefix
+		mode  stack.XFRMMode
+	}{
+		{name: "IPv4 transport", addrs: xfrmAddrs, mode: stack.XFRMModeTransport},
+		{name: "IPv4 tunnel", addrs: xfrmAddrs, mode: stack.XFRMModeTunnel},
+		{name: "IPv6 transport", addrs: xfrmAddrs6, mode: stack.XFRMModeTransport},
+		{name: "IPv6 tunnel", addrs: xfrmAddrs6, mode: stack.XFRMModeTunnel},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stacks := newXFRMStacks(t, test.addrs)
+			configureXFRM(t, stacks, test.addrs, test.mode, xfrmKey)
+			if !exchangeXFRM(t, stacks, test.addrs) {
+				t.Fatalf("no datagram received")
+			}
+
+			id := stack.XFRMStateID{
+				Destination: test.addrs[1].Address,
+				SPI:         xfrmSPI(1),
+				Protocol:    header.ESPProtocolNumber,
+			}
+			for i, s := range stacks {
+				info, ok := s.GetXFRMState(id)
+				if !ok {
+					t.Fatalf("GetXFRMState(%+v) on stack %d: not found", id, i)
+				}
+				if info.Packets == 0 {
+					t.Errorf("got state %+v on stack %d, want packets", info, i)
+				}
+			}
+		})
+	}
+}
+
+func TestXFRMIntegrityFailure(t *testing.T) {
+	stacks := newXFRMStacks(t, xfrmAddrs)
+	configureXFRM(t, stacks, xfrmAddrs, stack.XFRMModeTransport, []byte("fedcba9876543210salt"))
+	// The stacks use different keys for the traffic to the second stack.
+	if _, err := stacks[1].UpdateXFRMState(stack.XFRMState{
+		ID: stack.XFRMStateID{
+			Destination: xfrmAddrs[1].Address,
+			SPI:         xfrmSPI(1),
+			Protocol:    header.ESPProtocolNumber,
+		},
+		NetProto: ipv4.ProtocolNumber,
+		Source:   xfrmAddrs[0].Address,
+		AEAD: &stack.XFRMAlgorithm{
+			Name:      stack.XFRMAlgorithmAESGCM,
+			Key:       xfrmKey,
+			ICVLength: 16,
+		},
+	}); err != nil {
+		t.Fatalf("UpdateXFRMState(_): %s", err)
+	}
+	if exchangeXFRM(t, stacks, xfrmAddrs) {
+		t.Fatalf("datagram received with the wrong key")
+	}
+	if got := stacks[1].XFRMStats().InStateProtoError.Value(); got == 0 {
+		t.Errorf("got InStateProtoError = 0, want > 0")
+	}
+}
+
+func TestXFRMPolicyWithoutState(t *testing.T) {
+	stacks := newXFRMStacks(t, xfrmAddrs)
+	configureXFRM(t, stacks, xfrmAddrs, stack.XFRMModeTransport, xfrmKey)
+	if n := stacks[0].FlushXFRMStates(header.ESPProtocolNumber); n != 2 {
+		t.Fatalf("got FlushXFRMStates(%d) = %d, want = 2", header.ESPProtocolNumber, n)
+	}
+	if exchangeXFRM(t, stacks, xfrmAddrs) {
+		t.Fatalf("datagram received without a state")
+	}
+	if got := stacks[0].XFRMStats().OutNoStates.Value(); got == 0 {
+		t.Errorf("got OutNoStates = 0, want > 0")
+	}
+}
+
+func TestXFRMInputPolicy(t *testing.T) {
+	stacks := newXFRMStacks(t, xfrmAddrs)
+	configureXFRM(t, stacks, xfrmAddrs, stack.XFRMModeTransport, xfrmKey)
+	// The first stack sends in the clear, which the second one rejects.
+	if n := stacks[0].FlushXFRMPolicies(); n != 2 {
+		t.Fatalf("got FlushXFRMPolicies() = %d, want = 2", n)
+	}
+	if exchangeXFRM(t, stacks, xfrmAddrs) {
+		t.Fatalf("unprotected datagram received")
+	}
+	if got := stacks[1].XFRMStats().InTmplMismatch.Value(); got == 0 {
+		t.Errorf("got InTmplMismatch = 0, want > 0")
+	}
+}
+
+func TestXFRMDatabase(t *testing.T) {
+	s := newXFRMStacks(t, xfrmAddrs)[0]
+	st := stack.XFRMState{
+		ID: stack.XFRMStateID{
+			Destination: xfrmAddrs[1].Address,
+			SPI:         xfrmSPI(1),
+			Protocol:    header.ESPProtocolNumber,
+		},
+		NetProto: ipv4.ProtocolNumber,
+		Source:   xfrmAddrs[0].Address,
+		AEAD: &stack.XFRMAlgorithm{
+			Name:      stack.XFRMAlgorithmAESGCM,
+			Key:       xfrmKey,
+			ICVLength: 16,
+		},
+	}
+	_, err := s.UpdateXFRMState(st)
+	if _, ok := err.(*tcpip.ErrNoSuchFile); !ok {
+		t.Errorf("got UpdateXFRMState(_) = %v, want = %s", err, &tcpip.ErrNoSuchFile{})
+	}
+	if _, err := s.AddXFRMState(st); err != nil {
+		t.Fatalf("AddXFRMState(_): %s", err)
+	}
+	_, err = s.AddXFRMState(st)
+	if _, ok := err.(*tcpip.ErrDuplicateAddress); !ok {
+		t.Errorf("got AddXFRMState(_) = %v, want = %s", err, &tcpip.ErrDuplicateAddress{})
+	}
+	bad := st
+	bad.AEAD = &stack.XFRMAlgorithm{Name: "cbc(aes)", Key: xfrmKey}
+	_, err = s.UpdateXFRMState(bad)
+	if _, ok := err.(*tcpip.ErrNotSupported); !ok {
+		t.Errorf("got UpdateXFRMState(_) = %v, want = %s", err, &tcpip.ErrNotSupported{})
+	}
+
+	larval := st
+	larval.AEAD = nil
+	info, err := s.AllocateXFRMSPI(larval, 0x1000, 0x1fff)
+	if err != nil {
+		t.Fatalf("AllocateXFRMSPI(_, 0x1000, 0x1fff): %s", err)
+	}
+	if spi := info.ID.SPI; spi < 0x1000 || spi > 0x1fff {
+		t.Errorf("got SPI %#x, want in [0x1000, 0x1fff]", spi)
+	}
+	again, err := s.AllocateXFRMSPI(larval, 0x1000, 0x1fff)
+	if err != nil {
+		t.Fatalf("AllocateXFRMSPI(_, 0x1000, 0x1fff): %s", err)
+	}
+	if again.ID != info.ID {
+		t.Errorf("got AllocateXFRMSPI(_, 0x1000, 0x1fff) = %+v, want = %+v", again.ID, info.ID)
+	}
+	if got := len(s.XFRMStates()); got != 2 {
+		t.Errorf("got %d states, want = 2", got)
+	}
+	if _, err := s.RemoveXFRMState(info.ID); err != nil {
+		t.Errorf("RemoveXFRMState(%+v): %s", info.ID, err)
+	}
+
+	p := stack.XFRMPolicy{
+		Selector:  xfrmSelector(xfrmAddrs[0].Address, xfrmAddrs[1].Address),
+		Direction: stack.XFRMDirectionOut,
+		Action:    stack.XFRMPolicyBlock,
+	}
+	pinfo, err := s.AddXFRMPolicy(p, false /* update */)
+	if err != nil {
+		t.Fatalf("AddXFRMPolicy(_, false): %s", err)
+	}
+	if got, want := pinfo.Index&7, uint32(stack.XFRMDirectionOut); got != want {
+		t.Errorf("got index %#x with direction %d, want = %d", pinfo.Index, got, want)
+	}
+	_, err = s.AddXFRMPolicy(p, false /* update */)
+	if _, ok := err.(*tcpip.ErrDuplicateAddress); !ok {
+		t.Errorf("got AddXFRMPolicy(_, false) = %v, want = %s", err, &tcpip.ErrDuplicateAddress{})
+	}
+	p.Priority = 10
+	updated, err := s.AddXFRMPolicy(p, true /* update */)
+	if err != nil {
+		t.Fatalf("AddXFRMPolicy(_, true): %s", err)
+	}
+	if updated.Index != pinfo.Index || updated.Priority != 10 {
+		t.Errorf("got AddXFRMPolicy(_, true) = %+v, want index %#x and priority 10", updated, pinfo.Index)
+	}
+	if got, ok := s.GetXFRMPolicy(0, stack.XFRMSelector{}, pinfo.Index); !ok || got.Priority != 10 {
+		t.Errorf("got GetXFRMPolicy(0, {}, %#x) = (%+v, %t), want priority 10", pinfo.Index, got, ok)
+	}
+	if _, err := s.RemoveXFRMPolicy(p.Direction, p.Selector, 0); err != nil {
+		t.Errorf("RemoveXFRMPolicy(_, _, 0): %s", err)
+	}
+	if got := len(s.XFRMPolicies()); got != 0 {
+		t.Errorf("got %d policies, want = 0", got)
+	}
+}
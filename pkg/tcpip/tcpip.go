@@ -623,6 +623,32 @@ type SendableControlMessages struct {
 
 	// IPv6PacketInfo holds interface and address data on an incoming packet.
 	IPv6PacketInfo IPv6PacketInfo
+
+	// HasSCTPSndInfo indicates whether SCTPSndInfo is set.
+	HasSCTPSndInfo bool
+
+	// SCTPSndInfo holds the SCTP send parameters of the message.
+	SCTPSndInfo SCTPSndInfo
+
+	// HasTimestamping indicates whether Timestamping is valid/set.
+	HasTimestamping bool
+
+	// Timestamping holds the transmit timestamps requested for the message,
+	// in place of those requested with SO_TIMESTAMPING.
+	Timestamping TimestampingFlags
+
+	// HasTXTime indicates whether TXTime is valid/set.
+	HasTXTime bool
+
+	// TXTime is the earliest time at which the message may be transmitted.
+	TXTime MonotonicTime
+
+	// HasUDPSegmentSize indicates whether UDPSegmentSize is valid/set.
+	HasUDPSegmentSize bool
+
+	// UDPSegmentSize is the size of the datagrams the message is split into,
+	// in place of the one set with UDPSegmentOption.
+	UDPSegmentSize uint16
 }
 
 // ReceivableControlMessages contains socket control messages that can be
@@ -689,6 +715,24 @@ type ReceivableControlMessages struct {
 
 	// SockErr is the dequeued socket error on recvmsg(MSG_ERRQUEUE).
 	SockErr *SockError
+
+	// HasSCTPRcvInfo indicates whether SCTPRcvInfo should be reported as an
+	// SCTP_RCVINFO control message.
+	HasSCTPRcvInfo bool
+
+	// HasSCTPSndRcvInfo indicates whether SCTPRcvInfo should be reported as
+	// an SCTP_SNDRCV control message.
+	HasSCTPSndRcvInfo bool
+
+	// SCTPRcvInfo holds the SCTP receive information of the message.
+	SCTPRcvInfo SCTPRcvInfo
+
+	// HasUDPGROSize indicates whether UDPGROSize is valid/set.
+	HasUDPGROSize bool
+
+	// UDPGROSize is the size of the datagrams that were coalesced into the
+	// message, the last of which may be shorter.
+	UDPGROSize uint16
 }
 
 // PacketOwner is used to get UID and GID of the packet.
@@ -732,6 +776,15 @@ type ReadResult struct {
 	// LinkPacketInfo is the link-layer information of the received packet if
 	// ReadOptions.NeedLinkPacketInfo is true.
 	LinkPacketInfo LinkPacketInfo
+
+	// EndOfRecord indicates that the read consumed the end of a message. It
+	// is only set by endpoints which preserve message boundaries without
+	// truncating messages, e.g. SCTP.
+	EndOfRecord bool
+
+	// Notification indicates that the data read is an SCTP notification
+	// rather than user data.
+	Notification bool
 }
 
 // Endpoint is the interface implemented by transport protocols (e.g., tcp, udp)
@@ -922,6 +975,11 @@ type WriteOptions struct {
 
 	// ControlMessages contains optional overrides used when writing a packet.
 	ControlMessages SendableControlMessages
+
+	// FastOpen has the same semantics as Linux's MSG_FASTOPEN. It connects a
+	// TCP endpoint to To and, if a Fast Open cookie for To is known, sends
+	// the data in the SYN.
+	FastOpen bool
 }
 
 // SockOptInt represents socket options which values have the int type.
@@ -996,6 +1054,54 @@ const (
 	// IPv6Checksum is used to request the stack to populate and validate the IPv6
 	// checksum for transport level headers.
 	IPv6Checksum
+
+	// TCPFastOpenQueueLenOption is used by SetSockOptInt/GetSockOptInt to
+	// enable TCP Fast Open on a listening endpoint. Its value is the maximum
+	// number of Fast Open connections that may be pending completion of the
+	// 3-way handshake, as specified using the TCP_FASTOPEN option.
+	TCPFastOpenQueueLenOption
+
+	// TCPFastOpenConnectOption is used by SetSockOptInt/GetSockOptInt to
+	// make connect defer sending the SYN until data is written, so that the
+	// data can be sent in the SYN, as specified using the
+	// TCP_FASTOPEN_CONNECT option.
+	TCPFastOpenConnectOption
+
+	// SCTPNoDelayOption is used by SetSockOptInt/GetSockOptInt to disable
+	// bundling of small messages, as specified using the SCTP_NODELAY
+	// option.
+	SCTPNoDelayOption
+
+	// SCTPAutocloseOption is used by SetSockOptInt/GetSockOptInt to specify
+	// the number of seconds after which an idle association of a one-to-many
+	// endpoint is shut down, as specified using the SCTP_AUTOCLOSE option.
+	SCTPAutocloseOption
+
+	// SCTPMaxSegOption is used by SetSockOptInt/GetSockOptInt to specify the
+	// maximum size of a DATA chunk, as specified using the SCTP_MAXSEG
+	// option.
+	SCTPMaxSegOption
+
+	// SCTPDisableFragmentsOption is used by SetSockOptInt/GetSockOptInt to
+	// make messages that don't fit in a single packet fail rather than be
+	// fragmented, as specified using the SCTP_DISABLE_FRAGMENTS option.
+	SCTPDisableFragmentsOption
+
+	// SCTPRecvRcvInfoOption is used by SetSockOptInt/GetSockOptInt to
+	// request SCTP_RCVINFO control messages, as specified using the
+	// SCTP_RECVRCVINFO option.
+	SCTPRecvRcvInfoOption
+
+	// UDPSegmentOption is used by SetSockOptInt/GetSockOptInt to specify the
+	// size of the datagrams that messages written to a UDP endpoint are split
+	// into, as specified using the UDP_SEGMENT option. Zero disables
+	// segmentation.
+	UDPSegmentOption
+
+	// UDPGROOption is used by SetSockOptInt/GetSockOptInt to make a UDP
+	// endpoint coalesce the datagrams it receives from the same peer, as
+	// specified using the UDP_GRO option.
+	UDPGROOption
 )
 
 const (
@@ -1101,6 +1207,59 @@ const (
 	TCPRACKNoDupTh
 )
 
+// TCPECNOption controls the use of Explicit Congestion Notification by TCP.
+// Its values mirror those of Linux's net.ipv4.tcp_ecn sysctl.
+//
+// See: https://tools.ietf.org/html/rfc3168.
+type TCPECNOption int32
+
+func (*TCPECNOption) isGettableTransportProtocolOption() {}
+
+func (*TCPECNOption) isSettableTransportProtocolOption() {}
+
+const (
+	// TCPECNDisabled disables ECN for both outgoing and incoming
+	// connections.
+	TCPECNDisabled TCPECNOption = iota
+
+	// TCPECNEnabled requests ECN on outgoing connections and accepts it
+	// when requested by incoming connections.
+	TCPECNEnabled
+
+	// TCPECNPassive only accepts ECN when requested by incoming
+	// connections.
+	TCPECNPassive
+)
+
+// TCPFastOpenOption controls the use of TCP Fast Open by TCP. It is a
+// bitmask of TCPFastOpen* flags and mirrors Linux's net.ipv4.tcp_fastopen
+// sysctl.
+//
+// See: https://tools.ietf.org/html/rfc7413.
+type TCPFastOpenOption int32
+
+func (*TCPFastOpenOption) isGettableTransportProtocolOption() {}
+
+func (*TCPFastOpenOption) isSettableTransportProtocolOption() {}
+
+const (
+	// TCPFastOpenClient enables sending data in the SYN of outgoing
+	// connections.
+	TCPFastOpenClient TCPFastOpenOption = 0x1
+
+	// TCPFastOpenServer enables accepting data in the SYN of incoming
+	// connections on listeners that enabled Fast Open.
+	TCPFastOpenServer TCPFastOpenOption = 0x2
+
+	// TCPFastOpenClientNoCookie sends data in the SYN of outgoing
+	// connections even if no cookie is known for the peer.
+	TCPFastOpenClientNoCookie TCPFastOpenOption = 0x4
+
+	// TCPFastOpenServerNoCookie accepts data in the SYN of incoming
+	// connections even if it does not carry a valid cookie.
+	TCPFastOpenServerNoCookie TCPFastOpenOption = 0x200
+)
+
 // TCPDelayEnabled enables/disables Nagle's algorithm in TCP.
 type TCPDelayEnabled bool
 
@@ -1237,6 +1396,9 @@ type TCPInfoOption struct {
 
 	// ReorderSeen indicates if reordering is seen in the endpoint.
 	ReorderSeen bool
+
+	// ECN indicates if Explicit Congestion Notification was negotiated.
+	ECN bool
 }
 
 func (*TCPInfoOption) isGettableSocketOption() {}
@@ -1363,6 +1525,27 @@ func (*TCPSynRetriesOption) isGettableTransportProtocolOption() {}
 
 func (*TCPSynRetriesOption) isSettableTransportProtocolOption() {}
 
+// TCPMD5SigOption is used by SetSockOpt to install or remove the key used to
+// sign and verify the segments exchanged with a set of peers using the TCP
+// MD5 signature option, as specified using the TCP_MD5SIG and TCP_MD5SIG_EXT
+// options.
+//
+// See: https://tools.ietf.org/html/rfc2385.
+type TCPMD5SigOption struct {
+	// Address and PrefixLen select the peers the key is used with.
+	Address   Address
+	PrefixLen int
+
+	// NIC, if non-zero, restricts the key to peers reached through the NIC.
+	NIC NICID
+
+	// Key is the key. An empty key removes the key previously installed for
+	// the same peers.
+	Key []byte
+}
+
+func (*TCPMD5SigOption) isSettableSocketOption() {}
+
 // MulticastInterfaceOption is used by SetSockOpt/GetSockOpt to specify a
 // default interface for multicast.
 type MulticastInterfaceOption struct {
@@ -1392,11 +1575,82 @@ type RemoveMembershipOption MembershipOption
 
 func (*RemoveMembershipOption) isSettableSocketOption() {}
 
-// SocketDetachFilterOption is used by SetSockOpt to detach a previously attached
-// classic BPF filter on a given endpoint.
-type SocketDetachFilterOption int
+// MulticastSourceFilter is the source filter applied to a multicast group
+// membership, as described by RFC 3376 section 3.1 and RFC 3810 section 4.
+//
+// A membership that has not been joined is equivalent to an INCLUDE mode
+// filter with no sources. A membership joined without specifying a source
+// (any-source multicast) is an EXCLUDE mode filter with no sources.
+//
+// +stateify savable
+type MulticastSourceFilter struct {
+	// Exclude is true if the filter is in EXCLUDE mode.
+	Exclude bool
+
+	// Sources is the filter's source list.
+	Sources []Address
+}
+
+// Joined returns true if the filter describes a joined membership.
+func (f *MulticastSourceFilter) Joined() bool {
+	return f.Exclude || len(f.Sources) != 0
+}
+
+// Allows returns true if the filter accepts traffic sent by src.
+func (f *MulticastSourceFilter) Allows(src Address) bool {
+	for _, s := range f.Sources {
+		if s == src {
+			return !f.Exclude
+		}
+	}
+	return f.Exclude
+}
+
+// SourceMembershipOption is used to identify a source of a multicast group on
+// an interface.
+type SourceMembershipOption struct {
+	NIC           NICID
+	InterfaceAddr Address
+	MulticastAddr Address
+	SourceAddr    Address
+}
+
+// AddSourceMembershipOption identifies a source to add to an INCLUDE mode
+// membership, joining the group if needed.
+type AddSourceMembershipOption SourceMembershipOption
+
+func (*AddSourceMembershipOption) isSettableSocketOption() {}
+
+// DropSourceMembershipOption identifies a source to remove from an INCLUDE
+// mode membership, leaving the group if no sources remain.
+type DropSourceMembershipOption SourceMembershipOption
+
+func (*DropSourceMembershipOption) isSettableSocketOption() {}
+
+// BlockSourceOption identifies a source to add to an EXCLUDE mode
+// membership.
+type BlockSourceOption SourceMembershipOption
+
+func (*BlockSourceOption) isSettableSocketOption() {}
+
+// UnblockSourceOption identifies a source to remove from an EXCLUDE mode
+// membership.
+type UnblockSourceOption SourceMembershipOption
+
+func (*UnblockSourceOption) isSettableSocketOption() {}
+
+// MulticastSourceFilterOption is used by SetSockOpt/GetSockOpt to replace or
+// read the source filter of a multicast membership on an interface.
+type MulticastSourceFilterOption struct {
+	NIC           NICID
+	InterfaceAddr Address
+	MulticastAddr Address
+	Filter        MulticastSourceFilter
+}
+
+func (*MulticastSourceFilterOption) isGettableSocketOption() {}
 
-func (*SocketDetachFilterOption) isSettableSocketOption() {}
+func (*MulticastSourceFilterOption) isSettableSocketOption() {}
 
 // OriginalDestinationOption is used to get the original destination address
 // and port of a redirected packet.
@@ -1432,6 +1686,238 @@ const (
 	TCPTimeWaitReuseLoopbackOnly
 )
 
+// SCTPAssocID identifies an SCTP association.
+type SCTPAssocID int32
+
+// SCTP message flags, as used by SCTPSndInfo and SCTPRcvInfo.
+const (
+	// SCTPFlagUnordered marks a message for unordered delivery.
+	SCTPFlagUnordered = 1 << 0
+
+	// SCTPFlagAddrOver makes the message be sent to the given address
+	// instead of the primary path.
+	SCTPFlagAddrOver = 1 << 1
+
+	// SCTPFlagAbort aborts the association. The message is the abort reason.
+	SCTPFlagAbort = 1 << 2
+
+	// SCTPFlagSackImmediately asks the peer to acknowledge the message
+	// without delay.
+	SCTPFlagSackImmediately = 1 << 3
+
+	// SCTPFlagSendAll sends the message on every association of a
+	// one-to-many endpoint.
+	SCTPFlagSendAll = 1 << 6
+
+	// SCTPFlagEOF gracefully shuts down the association after the message.
+	SCTPFlagEOF = 1 << 9
+)
+
+// SCTPSndInfo holds the parameters used to send an SCTP message.
+//
+// +stateify savable
+type SCTPSndInfo struct {
+	Stream  uint16
+	Flags   uint16
+	PPID    uint32
+	Context uint32
+	AssocID SCTPAssocID
+}
+
+// SCTPRcvInfo holds information about a received SCTP message.
+//
+// +stateify savable
+type SCTPRcvInfo struct {
+	Stream  uint16
+	SSN     uint16
+	Flags   uint16
+	PPID    uint32
+	TSN     uint32
+	CumTSN  uint32
+	Context uint32
+	AssocID SCTPAssocID
+}
+
+// SCTPEventsOption is used by SetSockOpt/GetSockOpt to subscribe to SCTP
+// notifications. Bit i enables the notification of type 0x8000+i, which
+// matches the layout of struct sctp_event_subscribe.
+type SCTPEventsOption uint16
+
+func (*SCTPEventsOption) isGettableSocketOption() {}
+
+func (*SCTPEventsOption) isSettableSocketOption() {}
+
+// SCTP notification subscriptions.
+const (
+	SCTPEventDataIO      SCTPEventsOption = 1 << 0
+	SCTPEventAssociation SCTPEventsOption = 1 << 1
+	SCTPEventAddress     SCTPEventsOption = 1 << 2
+	SCTPEventSendFailure SCTPEventsOption = 1 << 3
+	SCTPEventPeerError   SCTPEventsOption = 1 << 4
+	SCTPEventShutdown    SCTPEventsOption = 1 << 5
+)
+
+// SCTPInitMsgOption is used by SetSockOpt/GetSockOpt to set the parameters
+// used when initiating associations.
+type SCTPInitMsgOption struct {
+	// NumOStreams is the number of outbound streams requested.
+	NumOStreams uint16
+
+	// MaxInStreams is the maximum number of inbound streams accepted.
+	MaxInStreams uint16
+
+	// MaxAttempts is the maximum number of INIT retransmissions.
+	MaxAttempts uint16
+
+	// MaxInitTimeout is the maximum retransmission timeout of INIT.
+	MaxInitTimeout time.Duration
+}
+
+func (*SCTPInitMsgOption) isGettableSocketOption() {}
+
+func (*SCTPInitMsgOption) isSettableSocketOption() {}
+
+// SCTPRTOInfoOption is used by SetSockOpt/GetSockOpt to set the
+// retransmission timeout bounds. A zero value leaves the corresponding
+// setting unchanged.
+type SCTPRTOInfoOption struct {
+	AssocID SCTPAssocID
+	Initial time.Duration
+	Max     time.Duration
+	Min     time.Duration
+}
+
+func (*SCTPRTOInfoOption) isGettableSocketOption() {}
+
+func (*SCTPRTOInfoOption) isSettableSocketOption() {}
+
+// SCTPAssocInfoOption is used by SetSockOpt/GetSockOpt to set association
+// parameters. A zero MaxRetrans or CookieLife leaves the corresponding
+// setting unchanged; the remaining fields are read-only.
+type SCTPAssocInfoOption struct {
+	AssocID          SCTPAssocID
+	MaxRetrans       uint16
+	PeerDestinations uint16
+	PeerRwnd         uint32
+	LocalRwnd        uint32
+	CookieLife       time.Duration
+}
+
+func (*SCTPAssocInfoOption) isGettableSocketOption() {}
+
+func (*SCTPAssocInfoOption) isSettableSocketOption() {}
+
+// SCTPDefaultSndInfoOption is used by SetSockOpt/GetSockOpt to set the send
+// parameters used by messages sent without an SCTP_SNDINFO or SCTP_SNDRCV
+// control message.
+type SCTPDefaultSndInfoOption SCTPSndInfo
+
+func (*SCTPDefaultSndInfoOption) isGettableSocketOption() {}
+
+func (*SCTPDefaultSndInfoOption) isSettableSocketOption() {}
+
+// SCTPPrimaryAddrOption is used by SetSockOpt/GetSockOpt to set the peer
+// address used as the primary path of an association.
+type SCTPPrimaryAddrOption struct {
+	AssocID SCTPAssocID
+	Addr    FullAddress
+}
+
+func (*SCTPPrimaryAddrOption) isGettableSocketOption() {}
+
+func (*SCTPPrimaryAddrOption) isSettableSocketOption() {}
+
+// SCTPPeerAddrInfo describes a path of an SCTP association.
+type SCTPPeerAddrInfo struct {
+	AssocID SCTPAssocID
+	Addr    FullAddress
+
+	// Active is true if the path is considered reachable.
+	Active bool
+
+	Cwnd uint32
+	SRTT time.Duration
+	RTO  time.Duration
+	MTU  uint32
+}
+
+// SCTPStatusOption is used by GetSockOpt to retrieve the status of an SCTP
+// association.
+type SCTPStatusOption struct {
+	AssocID SCTPAssocID
+
+	// State is the association state, with values matching Linux's enum
+	// sctp_sstat_state.
+	State int32
+
+	Rwnd               uint32
+	UnackedData        uint16
+	PendingData        uint16
+	InStreams          uint16
+	OutStreams         uint16
+	FragmentationPoint uint32
+	Primary            SCTPPeerAddrInfo
+}
+
+func (*SCTPStatusOption) isGettableSocketOption() {}
+
+// SCTPBindxOption is used by SetSockOpt to add local addresses to, or remove
+// them from, a bound SCTP endpoint.
+type SCTPBindxOption struct {
+	Remove bool
+	Addrs  []FullAddress
+}
+
+func (*SCTPBindxOption) isSettableSocketOption() {}
+
+// SCTPConnectxOption is used by SetSockOpt to initiate an association to a
+// multi-homed peer. On success AssocID holds the new association.
+type SCTPConnectxOption struct {
+	Addrs   []FullAddress
+	AssocID SCTPAssocID
+}
+
+func (*SCTPConnectxOption) isSettableSocketOption() {}
+
+// SCTPPeerAddrsOption is used by GetSockOpt to retrieve the peer addresses
+// of an association.
+type SCTPPeerAddrsOption struct {
+	AssocID SCTPAssocID
+	Addrs   []FullAddress
+}
+
+func (*SCTPPeerAddrsOption) isGettableSocketOption() {}
+
+// SCTPLocalAddrsOption is used by GetSockOpt to retrieve the local addresses
+// of an endpoint or association.
+type SCTPLocalAddrsOption struct {
+	AssocID SCTPAssocID
+	Addrs   []FullAddress
+}
+
+func (*SCTPLocalAddrsOption) isGettableSocketOption() {}
+
+// SCTPAssocIDListOption is used by GetSockOpt to retrieve the associations of
+// a one-to-many endpoint.
+type SCTPAssocIDListOption []SCTPAssocID
+
+func (*SCTPAssocIDListOption) isGettableSocketOption() {}
+
+// SCTPPeeloffOption is used by GetSockOpt to branch an association of a
+// one-to-many endpoint off into a new one-to-one endpoint.
+type SCTPPeeloffOption struct {
+	// AssocID is the association to branch off.
+	AssocID SCTPAssocID
+
+	// WaiterQueue is the waiter queue of the new endpoint.
+	WaiterQueue *waiter.Queue
+
+	// Endpoint is set to the new endpoint on success.
+	Endpoint Endpoint
+}
+
+func (*SCTPPeeloffOption) isGettableSocketOption() {}
+
 // LingerOption is used by SetSockOpt/GetSockOpt to set/get the
 // duration for which a socket lingers before returning from Close.
 //
@@ -1543,6 +2029,31 @@ type Route struct {
 	// If MTU is 0, this field is ignored and the MTU of the NIC for which this route
 	// is configured is used for egress packets.
 	MTU uint32
+
+	// Table is the ID of the routing table the route belongs to. If Table is
+	// RouteTableUnspec, the route belongs to RouteTableMain.
+	Table uint32
+
+	// Metric is the priority of the route among routes with the same
+	// destination prefix. Routes with lower metrics are preferred.
+	Metric uint32
+}
+
+// Routing table IDs with special meaning, as in Linux's
+// include/uapi/linux/rtnetlink.h.
+const (
+	RouteTableUnspec  = 0
+	RouteTableDefault = 253
+	RouteTableMain    = 254
+	RouteTableLocal   = 255
+)
+
+// EffectiveTable returns the ID of the routing table the route belongs to.
+func (r Route) EffectiveTable() uint32 {
+	if r.Table == RouteTableUnspec {
+		return RouteTableMain
+	}
+	return r.Table
 }
 
 // String implements the fmt.Stringer interface.
@@ -1553,13 +2064,98 @@ func (r Route) String() string {
 		_, _ = fmt.Fprintf(&out, " via %s", r.Gateway)
 	}
 	_, _ = fmt.Fprintf(&out, " nic %d", r.NIC)
+	if r.Metric != 0 {
+		_, _ = fmt.Fprintf(&out, " metric %d", r.Metric)
+	}
+	if table := r.EffectiveTable(); table != RouteTableMain {
+		_, _ = fmt.Fprintf(&out, " table %d", table)
+	}
 	return out.String()
 }
 
 // Equal returns true if the given Route is equal to this Route.
 func (r Route) Equal(to Route) bool {
 	// NOTE: This relies on the fact that r.Destination == to.Destination
-	return r.Destination.Equal(to.Destination) && r.NIC == to.NIC
+	return r.Destination.Equal(to.Destination) && r.NIC == to.NIC &&
+		r.EffectiveTable() == to.EffectiveTable() && r.Metric == to.Metric
+}
+
+// RuleAction is the action taken by a policy routing rule that matches a
+// flow.
+type RuleAction uint8
+
+const (
+	// RuleActionLookup looks the route up in the rule's table. If the table
+	// has no route for the flow, the next rule is evaluated.
+	RuleActionLookup RuleAction = iota
+
+	// RuleActionBlackhole fails the route lookup. Netstack has no way to
+	// silently drop the traffic of a flow, so as in Linux the lookup fails
+	// with ErrInvalidEndpointState (EINVAL).
+	RuleActionBlackhole
+
+	// RuleActionUnreachable fails the route lookup with ErrNetworkUnreachable
+	// (ENETUNREACH).
+	RuleActionUnreachable
+
+	// RuleActionProhibit fails the route lookup with ErrPermissionDenied
+	// (EACCES).
+	RuleActionProhibit
+)
+
+// Rule is a policy routing rule. Rules are evaluated in increasing order of
+// priority and select the routing table that is used to route a flow, as
+// configured by ip-rule(8).
+//
+// +stateify savable
+type Rule struct {
+	// Priority orders the rule among the other rules. Rules with lower
+	// priorities are evaluated first.
+	Priority uint32
+
+	// NetProto is the network protocol of the flows matched by the rule.
+	NetProto NetworkProtocolNumber
+
+	// Source, if it has a non-zero prefix, must contain the source address
+	// of the flow for the rule to match.
+	Source Subnet
+
+	// Destination, if it has a non-zero prefix, must contain the destination
+	// address of the flow for the rule to match.
+	Destination Subnet
+
+	// TOS, if non-zero, must be equal to the TOS of the flow for the rule to
+	// match.
+	TOS uint8
+
+	// Mark and MarkMask restrict the rule to flows whose mark has the bits
+	// of Mark in the positions selected by MarkMask.
+	Mark     uint32
+	MarkMask uint32
+
+	// InputInterface, if not empty, is the name of the NIC the flow must have
+	// been received on for the rule to match.
+	InputInterface string
+
+	// OutputInterface, if not empty, is the name of the NIC the flow must be
+	// bound to for the rule to match.
+	OutputInterface string
+
+	// UIDStart and UIDEnd are the inclusive range of the user IDs of the
+	// flows matched by the rule. They are only checked if HasUIDRange is
+	// true.
+	HasUIDRange bool
+	UIDStart    uint32
+	UIDEnd      uint32
+
+	// Invert inverts the result of the selectors above.
+	Invert bool
+
+	// Action is the action taken when the rule matches.
+	Action RuleAction
+
+	// Table is the routing table used by RuleActionLookup.
+	Table uint32
 }
 
 // TransportProtocolNumber is the number of a transport protocol.
@@ -2243,6 +2839,55 @@ type TCPStats struct {
 	// SpuriousRTORecovery is the number of spurious RTOs.
 	SpuriousRTORecovery *StatCounter
 
+	// ECNNegotiated is the number of connections that negotiated Explicit
+	// Congestion Notification during the handshake.
+	ECNNegotiated *StatCounter
+
+	// CESegmentsReceived is the number of data segments received with the
+	// Congestion Experienced codepoint set.
+	CESegmentsReceived *StatCounter
+
+	// ECNReductions is the number of times the congestion window was reduced
+	// in response to an ECN-Echo from the peer.
+	ECNReductions *StatCounter
+
+	// FastOpenActive is the number of outgoing connections whose data sent
+	// in the SYN was acknowledged by the peer.
+	FastOpenActive *StatCounter
+
+	// FastOpenActiveFail is the number of outgoing connections whose data
+	// sent in the SYN was not acknowledged by the peer.
+	FastOpenActiveFail *StatCounter
+
+	// FastOpenPassive is the number of incoming connections accepted with a
+	// valid Fast Open cookie.
+	FastOpenPassive *StatCounter
+
+	// FastOpenPassiveFail is the number of incoming SYNs whose Fast Open
+	// cookie was invalid.
+	FastOpenPassiveFail *StatCounter
+
+	// FastOpenListenOverflow is the number of incoming SYNs with a valid Fast
+	// Open cookie whose data was not accepted because the listener had too
+	// many pending Fast Open connections.
+	FastOpenListenOverflow *StatCounter
+
+	// FastOpenCookieReqd is the number of incoming SYNs requesting a Fast
+	// Open cookie.
+	FastOpenCookieReqd *StatCounter
+
+	// MD5NotFound is the number of segments dropped because they did not
+	// carry an MD5 signature although a key is installed for the peer.
+	MD5NotFound *StatCounter
+
+	// MD5Unexpected is the number of segments dropped because they carried
+	// an MD5 signature although no key is installed for the peer.
+	MD5Unexpected *StatCounter
+
+	// MD5Failure is the number of segments dropped because their MD5
+	// signature was invalid.
+	MD5Failure *StatCounter
+
 	// ForwardMaxInFlightDrop is the number of connection requests that are
 	// dropped due to exceeding the maximum number of in-flight connection
 	// requests.
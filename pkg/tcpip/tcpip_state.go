@@ -26,3 +26,11 @@ func (c *ReceivableControlMessages) saveTimestamp() int64 {
 func (c *ReceivableControlMessages) loadTimestamp(_ context.Context, nsec int64) {
 	c.Timestamp = time.Unix(0, nsec)
 }
+
+func (e *SockError) saveTimestamp() int64 {
+	return e.Timestamp.UnixNano()
+}
+
+func (e *SockError) loadTimestamp(_ context.Context, nsec int64) {
+	e.Timestamp = time.Unix(0, nsec)
+}
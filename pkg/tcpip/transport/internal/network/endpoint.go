@@ -18,6 +18,7 @@ package network
 
 import (
 	"fmt"
+	"slices"
 
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/buffer"
@@ -55,8 +56,6 @@ type Endpoint struct {
 	// +checklocks:mu
 	connectedRoute *stack.Route `state:"manual"`
 	// +checklocks:mu
-	multicastMemberships map[multicastMembership]struct{}
-	// +checklocks:mu
 	ipv4TTL uint8
 	// +checklocks:mu
 	ipv6HopLimit int16
@@ -74,6 +73,16 @@ type Endpoint struct {
 	// +checklocks:mu
 	ipv6TClass uint8
 
+	// Lock ordering: mu > multicastMu.
+	multicastMu sync.RWMutex `state:"nosave"`
+	// multicastMemberships holds the source filter of each multicast group the
+	// endpoint joined. It has a dedicated mutex for the same reason as info:
+	// the source filters are consulted when delivering packets to the
+	// endpoint.
+	//
+	// +checklocks:multicastMu
+	multicastMemberships map[multicastMembership]tcpip.MulticastSourceFilter
+
 	// Lock ordering: mu > infoMu.
 	infoMu sync.RWMutex `state:"nosave"`
 	// info has a dedicated mutex so that we can avoid lock ordering violations
@@ -115,10 +124,24 @@ type multicastMembership struct {
 	multicastAddr tcpip.Address
 }
 
+const (
+	// maxIPv4MulticastSources is the maximum number of sources in the source
+	// filter of an IPv4 multicast membership, matching Linux's default
+	// net.ipv4.igmp_max_msf.
+	maxIPv4MulticastSources = 10
+
+	// maxIPv6MulticastSources is the maximum number of sources in the source
+	// filter of an IPv6 multicast membership, matching Linux's default
+	// net.ipv6.mld_max_msf.
+	maxIPv6MulticastSources = 64
+)
+
 // Init initializes the endpoint.
 func (e *Endpoint) Init(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber, ops *tcpip.SocketOptions, waiterQueue *waiter.Queue) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	e.multicastMu.Lock()
+	defer e.multicastMu.Unlock()
 	if e.multicastMemberships != nil {
 		panic(fmt.Sprintf("endpoint is already initialized; got e.multicastMemberships = %#v, want = nil", e.multicastMemberships))
 	}
@@ -146,7 +169,7 @@ func (e *Endpoint) Init(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, tr
 
 	// Linux defaults to TTL=1.
 	e.multicastTTL = 1
-	e.multicastMemberships = make(map[multicastMembership]struct{})
+	e.multicastMemberships = make(map[multicastMembership]tcpip.MulticastSourceFilter)
 	e.setEndpointState(transport.DatagramEndpointStateInitial)
 }
 
@@ -180,10 +203,12 @@ func (e *Endpoint) Close() {
 		return
 	}
 
-	for mem := range e.multicastMemberships {
-		e.stack.LeaveGroup(e.netProto, mem.nicID, mem.multicastAddr)
+	e.multicastMu.Lock()
+	for mem, filter := range e.multicastMemberships {
+		e.stack.UpdateGroupFilter(e.netProto, mem.nicID, mem.multicastAddr, filter, tcpip.MulticastSourceFilter{})
 	}
 	e.multicastMemberships = nil
+	e.multicastMu.Unlock()
 
 	if e.connectedRoute != nil {
 		e.connectedRoute.Release()
@@ -225,10 +250,12 @@ func (e *Endpoint) calculateTTL(route *stack.Route) uint8 {
 
 // WriteContext holds the context for a write.
 type WriteContext struct {
-	e     *Endpoint
-	route *stack.Route
-	ttl   uint8
-	tos   uint8
+	e            *Endpoint
+	route        *stack.Route
+	ttl          uint8
+	tos          uint8
+	timestamping tcpip.TimestampingFlags
+	txTime       tcpip.MonotonicTime
 }
 
 func (c *WriteContext) MTU() uint32 {
@@ -339,6 +366,16 @@ func (c *WriteContext) WritePacket(pkt *stack.PacketBuffer, headerIncluded bool)
 	c.e.mu.RLock()
 	pkt.Owner = c.e.owner
 	c.e.mu.RUnlock()
+	pkt.Mark = c.e.ops.GetMark()
+	pkt.XFRMBypass = c.e.ops.GetXFRMOutputBypass()
+	pkt.TXTime = c.txTime
+	if c.timestamping&tcpip.TimestampingTXFlags != 0 {
+		var key uint32
+		if c.e.ops.GetTimestamping()&tcpip.TimestampingOptID != 0 {
+			key = c.e.ops.NextTimestampingKey()
+		}
+		pkt.RequestTXTimestamps(c.timestamping, key, c.e)
+	}
 
 	if headerIncluded {
 		return c.route.WriteHeaderIncludedPacket(pkt)
@@ -553,14 +590,42 @@ func (e *Endpoint) AcquireContextForWrite(opts tcpip.WriteOptions) (WriteContext
 		panic(fmt.Sprintf("invalid protocol number = %d", netProto))
 	}
 
+	timestamping := e.ops.GetTimestamping()
+	if opts.ControlMessages.HasTimestamping {
+		timestamping = opts.ControlMessages.Timestamping
+	}
+
 	return WriteContext{
-		e:     e,
-		route: route,
-		ttl:   ttl,
-		tos:   tos,
+		e:            e,
+		route:        route,
+		ttl:          ttl,
+		tos:          tos,
+		timestamping: timestamping,
+		txTime:       opts.ControlMessages.TXTime,
 	}, nil
 }
 
+// HandleTXTimestamp implements stack.TXTimestampHandler.
+func (e *Endpoint) HandleTXTimestamp(kind tcpip.TXTimestampKind, key uint32, pkt *stack.PacketBuffer) {
+	// As in Linux, the packet is looped back with the report unless
+	// TimestampingOptTSOnly is set.
+	var payload *buffer.View
+	if e.ops.GetTimestamping()&tcpip.TimestampingOptTSOnly == 0 {
+		payload = pkt.ToView()
+	}
+	cause := &tcpip.TimestampingSockError{
+		Kind: kind,
+		Key:  key,
+	}
+	if !e.ops.QueueTXTimestamp(cause, e.stack.Clock().Now(), pkt.NetworkProtocolNumber, payload) {
+		if payload != nil {
+			payload.Release()
+		}
+		return
+	}
+	e.waiterQueue.Notify(waiter.EventErr)
+}
+
 // Disconnect disconnects the endpoint from its peer.
 func (e *Endpoint) Disconnect() {
 	e.mu.Lock()
@@ -611,7 +676,11 @@ func (e *Endpoint) connectRouteRLocked(nicID tcpip.NICID, localAddr tcpip.Addres
 	}
 
 	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop())
+	flow := stack.RouteFlow{Mark: e.ops.GetMark(), Transparent: e.ops.GetTransparent()}
+	if e.owner != nil {
+		flow.UID = e.owner.KUID()
+	}
+	r, err := e.stack.FindRouteForFlow(nicID, localAddr, addr.Addr, netProto, e.ops.GetMulticastLoop(), flow)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -756,7 +825,12 @@ func (e *Endpoint) BindAndThen(addr tcpip.FullAddress, f func(tcpip.NetworkProto
 	if addr.Addr.BitLen() != 0 && !e.isBroadcastOrMulticast(addr.NIC, netProto, addr.Addr) {
 		nicID = e.stack.CheckLocalAddress(nicID, netProto, addr.Addr)
 		if nicID == 0 {
-			return &tcpip.ErrBadLocalAddress{}
+			// Transparent and free-bind endpoints may bind to addresses that
+			// are not assigned to the stack.
+			if !e.ops.GetTransparent() && !e.ops.GetFreeBind() {
+				return &tcpip.ErrBadLocalAddress{}
+			}
+			nicID = addr.NIC
 		}
 	}
 
@@ -939,78 +1013,75 @@ func (e *Endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 		e.multicastAddr = addr
 
 	case *tcpip.AddMembershipOption:
-		if !(header.IsV4MulticastAddress(v.MulticastAddr) && e.netProto == header.IPv4ProtocolNumber) && !(header.IsV6MulticastAddress(v.MulticastAddr) && e.netProto == header.IPv6ProtocolNumber) {
-			return &tcpip.ErrInvalidOptionValue{}
-		}
-
-		nicID := v.NIC
-
-		if v.InterfaceAddr.Unspecified() {
-			if nicID == 0 {
-				if r, err := e.stack.FindRoute(0, tcpip.Address{}, v.MulticastAddr, e.netProto, false /* multicastLoop */); err == nil {
-					nicID = r.NICID()
-					r.Release()
-				}
-			}
-		} else {
-			nicID = e.stack.CheckLocalAddress(nicID, e.netProto, v.InterfaceAddr)
-		}
-		if nicID == 0 {
-			return &tcpip.ErrUnknownDevice{}
+		mem, err := e.resolveMembership(v.NIC, v.InterfaceAddr, v.MulticastAddr)
+		if err != nil {
+			return err
 		}
 
-		memToInsert := multicastMembership{nicID: nicID, multicastAddr: v.MulticastAddr}
-
-		e.mu.Lock()
-		defer e.mu.Unlock()
+		e.multicastMu.Lock()
+		defer e.multicastMu.Unlock()
 
-		if _, ok := e.multicastMemberships[memToInsert]; ok {
+		if _, ok := e.multicastMemberships[mem]; ok {
 			return &tcpip.ErrPortInUse{}
 		}
 
-		if err := e.stack.JoinGroup(e.netProto, nicID, v.MulticastAddr); err != nil {
+		return e.updateMembershipLocked(mem, tcpip.MulticastSourceFilter{}, tcpip.MulticastSourceFilter{Exclude: true})
+
+	case *tcpip.RemoveMembershipOption:
+		mem, err := e.resolveMembership(v.NIC, v.InterfaceAddr, v.MulticastAddr)
+		if err != nil {
 			return err
 		}
 
-		e.multicastMemberships[memToInsert] = struct{}{}
+		e.multicastMu.Lock()
+		defer e.multicastMu.Unlock()
 
-	case *tcpip.RemoveMembershipOption:
-		if !(header.IsV4MulticastAddress(v.MulticastAddr) && e.netProto == header.IPv4ProtocolNumber) && !(header.IsV6MulticastAddress(v.MulticastAddr) && e.netProto == header.IPv6ProtocolNumber) {
-			return &tcpip.ErrInvalidOptionValue{}
+		filter, ok := e.multicastMemberships[mem]
+		if !ok {
+			return &tcpip.ErrBadLocalAddress{}
 		}
 
-		nicID := v.NIC
-		if v.InterfaceAddr.Unspecified() {
-			if nicID == 0 {
-				if r, err := e.stack.FindRoute(0, tcpip.Address{}, v.MulticastAddr, e.netProto, false /* multicastLoop */); err == nil {
-					nicID = r.NICID()
-					r.Release()
-				}
-			}
-		} else {
-			nicID = e.stack.CheckLocalAddress(nicID, e.netProto, v.InterfaceAddr)
-		}
-		if nicID == 0 {
-			return &tcpip.ErrUnknownDevice{}
-		}
+		return e.updateMembershipLocked(mem, filter, tcpip.MulticastSourceFilter{})
 
-		memToRemove := multicastMembership{nicID: nicID, multicastAddr: v.MulticastAddr}
+	case *tcpip.AddSourceMembershipOption:
+		return e.updateMembershipSource(tcpip.SourceMembershipOption(*v), false /* exclude */, true /* add */)
 
-		e.mu.Lock()
-		defer e.mu.Unlock()
+	case *tcpip.DropSourceMembershipOption:
+		return e.updateMembershipSource(tcpip.SourceMembershipOption(*v), false /* exclude */, false /* add */)
 
-		if _, ok := e.multicastMemberships[memToRemove]; !ok {
-			return &tcpip.ErrBadLocalAddress{}
-		}
+	case *tcpip.BlockSourceOption:
+		return e.updateMembershipSource(tcpip.SourceMembershipOption(*v), true /* exclude */, true /* add */)
 
-		if err := e.stack.LeaveGroup(e.netProto, nicID, v.MulticastAddr); err != nil {
+	case *tcpip.UnblockSourceOption:
+		return e.updateMembershipSource(tcpip.SourceMembershipOption(*v), true /* exclude */, false /* add */)
+
+	case *tcpip.MulticastSourceFilterOption:
+		mem, err := e.resolveMembership(v.NIC, v.InterfaceAddr, v.MulticastAddr)
+		if err != nil {
 			return err
 		}
+		if len(v.Filter.Sources) > e.maxMulticastSources() {
+			return &tcpip.ErrNoBufferSpace{}
+		}
 
-		delete(e.multicastMemberships, memToRemove)
+		newFilter := tcpip.MulticastSourceFilter{Exclude: v.Filter.Exclude}
+		for _, source := range v.Filter.Sources {
+			if !slices.Contains(newFilter.Sources, source) {
+				newFilter.Sources = append(newFilter.Sources, source)
+			}
+		}
 
-	case *tcpip.SocketDetachFilterOption:
-		return nil
+		e.multicastMu.Lock()
+		defer e.multicastMu.Unlock()
+
+		// As in Linux, the group must have been joined before its filter can be
+		// replaced.
+		filter, ok := e.multicastMemberships[mem]
+		if !ok {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+
+		return e.updateMembershipLocked(mem, filter, newFilter)
 	}
 	return nil
 }
@@ -1026,12 +1097,146 @@ func (e *Endpoint) GetSockOpt(opt tcpip.GettableSocketOption) tcpip.Error {
 		}
 		e.mu.Unlock()
 
+	case *tcpip.MulticastSourceFilterOption:
+		mem, err := e.resolveMembership(o.NIC, o.InterfaceAddr, o.MulticastAddr)
+		if err != nil {
+			return err
+		}
+
+		e.multicastMu.RLock()
+		defer e.multicastMu.RUnlock()
+
+		filter, ok := e.multicastMemberships[mem]
+		if !ok {
+			return &tcpip.ErrBadLocalAddress{}
+		}
+		o.Filter = tcpip.MulticastSourceFilter{
+			Exclude: filter.Exclude,
+			Sources: slices.Clone(filter.Sources),
+		}
+
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
 	}
 	return nil
 }
 
+// resolveMembership returns the membership identified by a multicast group and
+// either the ID or an address of the NIC the group is joined on.
+func (e *Endpoint) resolveMembership(nicID tcpip.NICID, interfaceAddr, multicastAddr tcpip.Address) (multicastMembership, tcpip.Error) {
+	if !(header.IsV4MulticastAddress(multicastAddr) && e.netProto == header.IPv4ProtocolNumber) && !(header.IsV6MulticastAddress(multicastAddr) && e.netProto == header.IPv6ProtocolNumber) {
+		return multicastMembership{}, &tcpip.ErrInvalidOptionValue{}
+	}
+
+	if interfaceAddr.Unspecified() {
+		if nicID == 0 {
+			if r, err := e.stack.FindRoute(0, tcpip.Address{}, multicastAddr, e.netProto, false /* multicastLoop */); err == nil {
+				nicID = r.NICID()
+				r.Release()
+			}
+		}
+	} else {
+		nicID = e.stack.CheckLocalAddress(nicID, e.netProto, interfaceAddr)
+	}
+	if nicID == 0 {
+		return multicastMembership{}, &tcpip.ErrUnknownDevice{}
+	}
+
+	return multicastMembership{nicID: nicID, multicastAddr: multicastAddr}, nil
+}
+
+// maxMulticastSources returns the maximum number of sources in the source
+// filter of a multicast membership.
+func (e *Endpoint) maxMulticastSources() int {
+	if e.netProto == header.IPv4ProtocolNumber {
+		return maxIPv4MulticastSources
+	}
+	return maxIPv6MulticastSources
+}
+
+// updateMembershipLocked changes the source filter of the membership from
+// oldFilter to newFilter, joining or leaving the group as needed.
+//
+// +checklocks:e.multicastMu
+func (e *Endpoint) updateMembershipLocked(mem multicastMembership, oldFilter, newFilter tcpip.MulticastSourceFilter) tcpip.Error {
+	if err := e.stack.UpdateGroupFilter(e.netProto, mem.nicID, mem.multicastAddr, oldFilter, newFilter); err != nil {
+		return err
+	}
+
+	if newFilter.Joined() {
+		e.multicastMemberships[mem] = newFilter
+	} else {
+		delete(e.multicastMemberships, mem)
+	}
+	return nil
+}
+
+// updateMembershipSource adds or removes a source from the source filter of a
+// membership, following the semantics of Linux's ip_mc_source.
+//
+// exclude is the filter mode the operation applies to. Adding a source to an
+// INCLUDE mode filter joins the group if needed, and removing the last source
+// of an INCLUDE mode filter leaves the group.
+func (e *Endpoint) updateMembershipSource(opt tcpip.SourceMembershipOption, exclude, add bool) tcpip.Error {
+	mem, err := e.resolveMembership(opt.NIC, opt.InterfaceAddr, opt.MulticastAddr)
+	if err != nil {
+		return err
+	}
+
+	e.multicastMu.Lock()
+	defer e.multicastMu.Unlock()
+
+	filter, ok := e.multicastMemberships[mem]
+	switch {
+	case !ok:
+		if exclude || !add {
+			// The group must have been joined.
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+	case filter.Exclude != exclude:
+		// Only a membership without sources may switch filter modes.
+		if len(filter.Sources) != 0 || !add {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+	}
+
+	newFilter := tcpip.MulticastSourceFilter{Exclude: exclude, Sources: slices.Clone(filter.Sources)}
+	i := slices.Index(newFilter.Sources, opt.SourceAddr)
+	if add {
+		if i >= 0 {
+			return &tcpip.ErrBadLocalAddress{}
+		}
+		if len(newFilter.Sources) >= e.maxMulticastSources() {
+			return &tcpip.ErrNoBufferSpace{}
+		}
+		newFilter.Sources = append(newFilter.Sources, opt.SourceAddr)
+	} else {
+		if i < 0 {
+			return &tcpip.ErrBadLocalAddress{}
+		}
+		newFilter.Sources = slices.Delete(newFilter.Sources, i, i+1)
+	}
+
+	return e.updateMembershipLocked(mem, filter, newFilter)
+}
+
+// IsMulticastSourceAllowed returns true if the source filter of the
+// endpoint's membership of the multicast group dst on the NIC nicID accepts
+// packets sent by src.
+//
+// As in Linux, packets sent to a group the endpoint has not joined are
+// accepted.
+func (e *Endpoint) IsMulticastSourceAllowed(nicID tcpip.NICID, dst, src tcpip.Address) bool {
+	if !header.IsV4MulticastAddress(dst) && !header.IsV6MulticastAddress(dst) {
+		return true
+	}
+
+	e.multicastMu.RLock()
+	defer e.multicastMu.RUnlock()
+	filter, ok := e.multicastMemberships[multicastMembership{nicID: nicID, multicastAddr: dst}]
+	return !ok || filter.Allows(src)
+}
+
 // Info returns a copy of the endpoint info.
 func (e *Endpoint) Info() stack.TransportEndpointInfo {
 	e.infoMu.RLock()
@@ -29,11 +29,13 @@ func (e *Endpoint) Resume(s *stack.Stack) {
 
 	e.stack = s
 
-	for m := range e.multicastMemberships {
-		if err := e.stack.JoinGroup(e.netProto, m.nicID, m.multicastAddr); err != nil {
-			panic(fmt.Sprintf("e.stack.JoinGroup(%d, %d, %s): %s", e.netProto, m.nicID, m.multicastAddr, err))
+	e.multicastMu.RLock()
+	for m, filter := range e.multicastMemberships {
+		if err := e.stack.UpdateGroupFilter(e.netProto, m.nicID, m.multicastAddr, tcpip.MulticastSourceFilter{}, filter); err != nil {
+			panic(fmt.Sprintf("e.stack.UpdateGroupFilter(%d, %d, %s, {}, %#v): %s", e.netProto, m.nicID, m.multicastAddr, filter, err))
 		}
 	}
+	e.multicastMu.RUnlock()
 
 	info := e.Info()
 
@@ -41,16 +43,20 @@ func (e *Endpoint) Resume(s *stack.Stack) {
 	case transport.DatagramEndpointStateInitial, transport.DatagramEndpointStateClosed:
 	case transport.DatagramEndpointStateBound:
 		if info.ID.LocalAddress.BitLen() != 0 && !e.isBroadcastOrMulticast(info.RegisterNICID, e.effectiveNetProto, info.ID.LocalAddress) {
-			if e.stack.CheckLocalAddress(info.RegisterNICID, e.effectiveNetProto, info.ID.LocalAddress) == 0 {
+			if e.stack.CheckLocalAddress(info.RegisterNICID, e.effectiveNetProto, info.ID.LocalAddress) == 0 && !e.ops.GetTransparent() && !e.ops.GetFreeBind() {
 				panic(fmt.Sprintf("got e.stack.CheckLocalAddress(%d, %d, %s) = 0, want != 0", info.RegisterNICID, e.effectiveNetProto, info.ID.LocalAddress))
 			}
 		}
 	case transport.DatagramEndpointStateConnected:
 		var err tcpip.Error
 		multicastLoop := e.ops.GetMulticastLoop()
-		e.connectedRoute, err = e.stack.FindRoute(info.RegisterNICID, info.ID.LocalAddress, info.ID.RemoteAddress, e.effectiveNetProto, multicastLoop)
+		flow := stack.RouteFlow{Mark: e.ops.GetMark(), Transparent: e.ops.GetTransparent()}
+		if e.owner != nil {
+			flow.UID = e.owner.KUID()
+		}
+		e.connectedRoute, err = e.stack.FindRouteForFlow(info.RegisterNICID, info.ID.LocalAddress, info.ID.RemoteAddress, e.effectiveNetProto, multicastLoop, flow)
 		if err != nil {
-			panic(fmt.Sprintf("e.stack.FindRoute(%d, %s, %s, %d, %t): %s", info.RegisterNICID, info.ID.LocalAddress, info.ID.RemoteAddress, e.effectiveNetProto, multicastLoop, err))
+			panic(fmt.Sprintf("e.stack.FindRouteForFlow(%d, %s, %s, %d, %t, %#v): %s", info.RegisterNICID, info.ID.LocalAddress, info.ID.RemoteAddress, e.effectiveNetProto, multicastLoop, flow, err))
 		}
 	default:
 		panic(fmt.Sprintf("unhandled state = %s", state))
@@ -327,7 +327,7 @@ func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 		e.stats.WriteErrors.WriteClosed.Increment()
 	case *tcpip.ErrInvalidEndpointState:
 		e.stats.WriteErrors.InvalidEndpointState.Increment()
-	case *tcpip.ErrHostUnreachable, *tcpip.ErrBroadcastDisabled, *tcpip.ErrNetworkUnreachable:
+	case *tcpip.ErrHostUnreachable, *tcpip.ErrBroadcastDisabled, *tcpip.ErrNetworkUnreachable, *tcpip.ErrPermissionDenied:
 		// Errors indicating any problem with IP routing of the packet.
 		e.stats.SendErrors.NoRoute.Increment()
 	default:
@@ -487,9 +487,6 @@ func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 // SetSockOpt implements tcpip.Endpoint.SetSockOpt.
 func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 	switch opt := opt.(type) {
-	case *tcpip.SocketDetachFilterOption:
-		return nil
-
 	case *tcpip.ICMPv6Filter:
 		if e.net.NetProto() != header.IPv6ProtocolNumber {
 			return &tcpip.ErrUnknownProtocolOption{}
@@ -645,6 +642,12 @@ func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
 			panic(fmt.Sprintf("unhandled state = %s", state))
 		}
 
+		// Multicast packets are only delivered if the membership's source
+		// filter accepts their source.
+		if !e.net.IsMulticastSourceAllowed(pkt.NICID, dstAddr, srcAddr) {
+			return false
+		}
+
 		wasEmpty := e.rcvBufSize == 0
 
 		// Push new packet into receive list and increment the buffer size.
@@ -724,6 +727,10 @@ func (e *endpoint) HandlePacket(pkt *stack.PacketBuffer) {
 			panic(fmt.Sprintf("unrecognized protocol number = %d", info.NetProto))
 		}
 
+		if !e.ops.RunFilter(&combinedBuf) {
+			return false
+		}
+
 		packet.data = stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: combinedBuf.Clone()})
 		packet.receivedAt = e.stack.Clock().Now()
 
@@ -0,0 +1,1164 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"encoding/binary"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/rand"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// assocState is the state of an association, as per RFC 4960 section 4. The
+// values match Linux's enum sctp_sstat_state, as reported by SCTP_STATUS.
+type assocState int32
+
+const (
+	assocClosed           assocState = 1
+	assocCookieWait       assocState = 2
+	assocCookieEchoed     assocState = 3
+	assocEstablished      assocState = 4
+	assocShutdownPending  assocState = 5
+	assocShutdownSent     assocState = 6
+	assocShutdownReceived assocState = 7
+	assocShutdownAckSent  assocState = 8
+)
+
+// path is a transport address of the peer.
+//
+// +stateify savable
+type path struct {
+	addr tcpip.Address
+	mtu  int
+
+	// active is false once the path exceeded its error threshold.
+	active     bool
+	errorCount int
+
+	rttMeasured bool
+	srtt        time.Duration
+	rttvar      time.Duration
+	rto         time.Duration
+
+	// Congestion control state, as per RFC 4960 section 7.2.
+	cwnd              int
+	ssthresh          int
+	partialBytesAcked int
+	flight            int
+
+	// Heartbeat state.
+	hbTimer       assocTimer
+	hbNonce       uint64
+	hbOutstanding bool
+}
+
+// assocTimer is a timer of an association. Each arming gets a new
+// generation, so that callbacks that raced with stopping or rearming the
+// timer do nothing.
+//
+// +stateify savable
+type assocTimer struct {
+	timer tcpip.Timer `state:"nosave"`
+	gen   uint32
+	armed bool
+}
+
+// stop disarms the timer.
+func (t *assocTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.armed = false
+	t.gen++
+}
+
+// association is an SCTP association. It is owned by an endpoint and
+// protected by the endpoint's mutex.
+//
+// +stateify savable
+type association struct {
+	// epMu protects ep, which only changes when the association is peeled
+	// off. Timer callbacks use it to find the endpoint to lock.
+	epMu sync.Mutex `state:"nosave"`
+	ep   *endpoint
+
+	id       tcpip.SCTPAssocID
+	state    assocState
+	peerPort uint16
+
+	// localAddr is the local address the association was set up on.
+	localAddr tcpip.Address
+
+	paths   []*path
+	primary *path
+
+	// rtxPath is the path used for retransmissions after a timeout, if it
+	// differs from the primary path.
+	rtxPath *path
+
+	myTag      uint32
+	peerTag    uint32
+	initialTSN uint32
+
+	outStreams   uint16
+	inStreams    uint16
+	maxInStreams uint16
+
+	// Handshake state.
+	initAttempts    int
+	maxInitAttempts int
+	t1RTO           time.Duration
+	maxInitTimeout  time.Duration
+	cookieEcho      []byte
+	t1              assocTimer
+
+	// Send state.
+	nextTSN      uint32
+	cumAckTSN    uint32
+	peerRwnd     uint32
+	outSSN       []uint16
+	sendQ        []*outChunk
+	queuedBytes  int
+	flight       int
+	fastRecovery bool
+	recoverTSN   uint32
+	errorCount   int
+	maxRetrans   int
+	rtoInitial   time.Duration
+	rtoMin       time.Duration
+	rtoMax       time.Duration
+	t3           assocTimer
+
+	// Receive state.
+	cumTSN       uint32
+	rcvTSNs      map[uint32]struct{}
+	frags        map[uint32]*inChunk
+	ordered      map[uint32]*inChunk
+	rcvHeld      int
+	inSSN        []uint16
+	dups         []uint32
+	sackNeeded   bool
+	sackPath     *path
+	lastRwnd     uint32
+	peerShutdown bool
+
+	// Shutdown state.
+	shutdownRequested bool
+	t2                assocTimer
+
+	autocloseTimer assocTimer
+}
+
+func newAssociation(e *endpoint, peerPort uint16) *association {
+	return &association{
+		ep:              e,
+		id:              e.protocol.newAssocID(),
+		state:           assocClosed,
+		peerPort:        peerPort,
+		maxInitAttempts: int(e.initMsg.MaxAttempts),
+		t1RTO:           e.rtoInitial,
+		maxInitTimeout:  e.initMsg.MaxInitTimeout,
+		maxRetrans:      e.assocMaxRetrans,
+		rtoInitial:      e.rtoInitial,
+		rtoMin:          e.rtoMin,
+		rtoMax:          e.rtoMax,
+		rcvTSNs:         make(map[uint32]struct{}),
+		frags:           make(map[uint32]*inChunk),
+		ordered:         make(map[uint32]*inChunk),
+	}
+}
+
+// newTag returns a random, non-zero verification tag.
+func newTag(rng *rand.RNG) uint32 {
+	for {
+		if t := rng.Uint32(); t != 0 {
+			return t
+		}
+	}
+}
+
+// endpoint returns the endpoint that owns a.
+func (a *association) endpoint() *endpoint {
+	a.epMu.Lock()
+	defer a.epMu.Unlock()
+	return a.ep
+}
+
+// setEndpoint changes the owner of a.
+//
+// Precondition: the mutexes of the old and new owners must be held.
+func (a *association) setEndpoint(e *endpoint) {
+	a.epMu.Lock()
+	a.ep = e
+	a.epMu.Unlock()
+}
+
+// lockEndpoint locks and returns the endpoint that owns a.
+func (a *association) lockEndpoint() *endpoint {
+	for {
+		e := a.endpoint()
+		e.mu.Lock()
+		if a.endpoint() == e {
+			return e
+		}
+		e.mu.Unlock()
+	}
+}
+
+// armLocked arms t to run fn after d.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) armLocked(t *assocTimer, d time.Duration, fn func()) {
+	t.stop()
+	t.armed = true
+	gen := t.gen
+	t.timer = a.ep.stack.Clock().AfterFunc(d, func() {
+		e := a.lockEndpoint()
+		if t.armed && t.gen == gen {
+			t.armed = false
+			fn()
+		}
+		e.unlockAndNotify()
+	})
+}
+
+// stopTimersLocked stops all the timers of a.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) stopTimersLocked() {
+	a.t1.stop()
+	a.t2.stop()
+	a.t3.stop()
+	a.autocloseTimer.stop()
+	for _, p := range a.paths {
+		p.hbTimer.stop()
+	}
+}
+
+// addPathLocked adds addr to the paths of a, unless it is unusable.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) addPathLocked(addr tcpip.Address) *path {
+	if p := a.pathFor(addr); p != nil {
+		return p
+	}
+	e := a.ep
+	switch netProtoOf(addr) {
+	case header.IPv4ProtocolNumber:
+		if e.netProto == header.IPv6ProtocolNumber && e.ops.GetV6Only() {
+			return nil
+		}
+	case header.IPv6ProtocolNumber:
+		if e.netProto != header.IPv6ProtocolNumber {
+			return nil
+		}
+	}
+	p := &path{
+		addr:   addr,
+		active: true,
+		rto:    a.rtoInitial,
+	}
+	r, err := a.routeLocked(p)
+	if err != nil {
+		return nil
+	}
+	p.mtu = min(int(r.MTU()), 0xffff)
+	r.Release()
+	p.cwnd = min(4*p.mtu, max(2*p.mtu, 4380))
+	p.ssthresh = 1 << 30
+	a.paths = append(a.paths, p)
+	if a.primary == nil {
+		a.primary = p
+	}
+	return p
+}
+
+// pathFor returns the path to addr, if any.
+func (a *association) pathFor(addr tcpip.Address) *path {
+	for _, p := range a.paths {
+		if p.addr == addr {
+			return p
+		}
+	}
+	return nil
+}
+
+// activePath returns the path to send new data on: the primary path if it is
+// active and an alternate active path otherwise.
+func (a *association) activePath() *path {
+	if a.primary.active {
+		return a.primary
+	}
+	for _, p := range a.paths {
+		if p.active {
+			return p
+		}
+	}
+	return a.primary
+}
+
+// alternatePath returns an active path other than p, or p if there is none.
+func (a *association) alternatePath(p *path) *path {
+	for _, q := range a.paths {
+		if q != p && q.active {
+			return q
+		}
+	}
+	return p
+}
+
+// routeLocked returns a route to p.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) routeLocked(p *path) (*stack.Route, tcpip.Error) {
+	e := a.ep
+	netProto := netProtoOf(p.addr)
+	var local tcpip.Address
+	switch {
+	case a.localAddr.Len() == p.addr.Len():
+		local = a.localAddr
+	default:
+		for _, addr := range e.localAddrs {
+			if addr.Len() == p.addr.Len() {
+				local = addr
+				break
+			}
+		}
+	}
+	flow := stack.RouteFlow{Mark: e.ops.GetMark(), Transparent: e.ops.GetTransparent()}
+	if e.owner != nil {
+		flow.UID = e.owner.KUID()
+	}
+	return e.stack.FindRouteForFlow(e.bindToDevice, local, p.addr, netProto, false /* multicastLoop */, flow)
+}
+
+// sendChunksLocked sends a packet made of chunks to p.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) sendChunksLocked(p *path, vtag uint32, chunks ...[]byte) {
+	r, err := a.routeLocked(p)
+	if err != nil {
+		a.ep.stats.SendErrors.NoRoute.Increment()
+		return
+	}
+	defer r.Release()
+	if err := sendPacket(r, a.ep.localPort, a.peerPort, vtag, a.ep.owner, a.ep.ops.GetMark(), chunks...); err != nil {
+		a.ep.stats.SendErrors.SendToNetworkFailed.Increment()
+	}
+}
+
+// sendInitLocked sends the INIT chunk and arms the T1-init timer.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) sendInitLocked() {
+	var params []header.SCTPParam
+	if e := a.ep; len(e.localAddrs) > 1 {
+		for _, addr := range e.localAddrs {
+			params = append(params, header.SCTPAddressParam(addr))
+		}
+	}
+	init := header.NewSCTPInitChunk(header.SCTPChunkInit, &header.SCTPInitFields{
+		InitiateTag:     a.myTag,
+		ARwnd:           a.rwndLocked(),
+		OutboundStreams: a.outStreams,
+		InboundStreams:  a.maxInStreams,
+		InitialTSN:      a.initialTSN,
+		Params:          params,
+	})
+	a.sendChunksLocked(a.handshakePath(), 0 /* vtag */, init)
+	a.armLocked(&a.t1, a.t1RTO, a.onT1ExpiredLocked)
+}
+
+// handshakePath returns the path to send handshake chunks on. Each
+// retransmission uses the next path, as per RFC 4960 section 5.1.
+func (a *association) handshakePath() *path {
+	return a.paths[a.initAttempts%len(a.paths)]
+}
+
+// onT1ExpiredLocked retransmits the INIT or COOKIE ECHO chunk.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) onT1ExpiredLocked() {
+	a.initAttempts++
+	if a.initAttempts > a.maxInitAttempts {
+		a.terminateLocked(&tcpip.ErrTimeout{}, assocChangeCantStrAssoc)
+		return
+	}
+	a.t1RTO = min(2*a.t1RTO, a.maxInitTimeout)
+	switch a.state {
+	case assocCookieWait:
+		a.sendInitLocked()
+	case assocCookieEchoed:
+		a.sendChunksLocked(a.handshakePath(), a.peerTag, a.cookieEcho)
+		a.armLocked(&a.t1, a.t1RTO, a.onT1ExpiredLocked)
+	}
+}
+
+// handleSegmentLocked processes the chunks of a packet from the peer.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleSegmentLocked(s *segment) {
+	if !a.checkTagLocked(s) {
+		return
+	}
+	p := a.pathFor(s.id.RemoteAddress)
+	if p == nil {
+		p = a.primary
+	}
+
+	e := a.ep
+	for i, c := range s.chunks {
+		if a.ep != e || a.state == assocClosed {
+			// The association was terminated or peeled off.
+			return
+		}
+		switch c.Type() {
+		case header.SCTPChunkData:
+			a.handleDataLocked(c, p)
+		case header.SCTPChunkInit:
+			if len(s.chunks) != 1 {
+				return
+			}
+			e.handleInitLocked(s, c, a)
+		case header.SCTPChunkInitAck:
+			a.handleInitAckLocked(s, c)
+		case header.SCTPChunkSack:
+			a.handleSackLocked(c)
+		case header.SCTPChunkHeartbeat:
+			a.sendChunksLocked(p, a.peerTag, header.NewSCTPParamChunk(header.SCTPChunkHeartbeatAck, 0, mustParams(c.Value())))
+		case header.SCTPChunkHeartbeatAck:
+			a.handleHeartbeatAckLocked(c)
+		case header.SCTPChunkAbort:
+			a.handleAbortLocked()
+			return
+		case header.SCTPChunkShutdown:
+			a.handleShutdownLocked(c)
+		case header.SCTPChunkShutdownAck:
+			a.handleShutdownAckLocked()
+		case header.SCTPChunkShutdownComplete:
+			if a.state == assocShutdownAckSent {
+				a.terminateLocked(nil /* err */, assocChangeShutdownComp)
+			}
+			return
+		case header.SCTPChunkError:
+			// Errors are informational; nothing reports them to the
+			// user yet.
+		case header.SCTPChunkCookieEcho:
+			// Chunks bundled after the COOKIE ECHO are processed by
+			// handleCookieEchoLocked.
+			if i == 0 {
+				e.handleCookieEchoLocked(s, a)
+			}
+			return
+		case header.SCTPChunkCookieAck:
+			if a.state == assocCookieEchoed {
+				a.establishLocked()
+			}
+		default:
+			if !a.handleUnknownChunkLocked(c, p) {
+				return
+			}
+		}
+	}
+	if a.state != assocClosed && a.ep == e {
+		a.transmitLocked()
+	}
+}
+
+// mustParams parses the parameters of a chunk value, ignoring malformed
+// trailing data.
+func mustParams(v []byte) []header.SCTPParam {
+	params, _ := header.ParseSCTPParams(v)
+	return params
+}
+
+// checkTagLocked validates the verification tag of s, as per RFC 4960
+// section 8.5.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) checkTagLocked(s *segment) bool {
+	c := s.chunks[0]
+	switch c.Type() {
+	case header.SCTPChunkInit:
+		return s.vtag == 0
+	case header.SCTPChunkCookieEcho:
+		// The tag is validated against the cookie.
+		return true
+	case header.SCTPChunkAbort, header.SCTPChunkShutdownComplete:
+		if c.Flags()&header.SCTPFlagTBit != 0 {
+			return s.vtag == a.peerTag
+		}
+		return s.vtag == a.myTag
+	case header.SCTPChunkShutdownAck:
+		// An endpoint in COOKIE-WAIT treats a SHUTDOWN ACK as out of the
+		// blue, as per RFC 4960 section 8.5.1.
+		if a.state == assocCookieWait {
+			a.ep.protocol.handleOOTB(s)
+			return false
+		}
+	}
+	return s.vtag == a.myTag
+}
+
+// handleUnknownChunkLocked handles a chunk of an unknown type as per RFC 4960
+// section 3.2. It returns false if the rest of the packet must be discarded.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleUnknownChunkLocked(c header.SCTPChunk, p *path) bool {
+	if c.Type()&0x40 != 0 {
+		cause := header.NewSCTPErrorCause(header.SCTPCauseUnrecognizedChunk, c)
+		a.sendChunksLocked(p, a.peerTag, header.NewSCTPParamChunk(header.SCTPChunkError, 0, []header.SCTPParam{cause}))
+	}
+	return c.Type()&0x80 != 0
+}
+
+// handleInitLocked answers an INIT with an INIT ACK carrying a state cookie.
+// a is the existing association with the peer, if any.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handleInitLocked(s *segment, c header.SCTPChunk, a *association) {
+	v := c.Value()
+	if len(v) < header.SCTPInitHeaderSize {
+		return
+	}
+	init := header.SCTPInit(v)
+	if init.InitiateTag() == 0 {
+		return
+	}
+	if init.OutboundStreams() == 0 || init.InboundStreams() == 0 {
+		cause := header.NewSCTPErrorCause(header.SCTPCauseInvalidParam, nil)
+		e.protocol.sendControl(s, init.InitiateTag(), header.NewSCTPParamChunk(header.SCTPChunkAbort, 0, []header.SCTPParam{cause}))
+		return
+	}
+	params, ok := init.Params()
+	if !ok {
+		return
+	}
+
+	rng := e.stack.SecureRNG()
+	ck := cookie{
+		created:     e.stack.Clock().Now(),
+		lifespan:    e.cookieLife,
+		myTag:       newTag(&rng),
+		myInitTSN:   rng.Uint32(),
+		peerTag:     init.InitiateTag(),
+		peerInitTSN: init.InitialTSN(),
+		outStreams:  min(e.initMsg.NumOStreams, init.InboundStreams()),
+		inStreams:   min(e.initMsg.MaxInStreams, init.OutboundStreams()),
+		peerRwnd:    init.ARwnd(),
+		localPort:   e.localPort,
+		peerPort:    s.id.RemotePort,
+		localAddr:   s.id.LocalAddress,
+		peerAddrs:   peerAddrsFromInit(s, params),
+	}
+	if a != nil && (a.state == assocCookieWait || a.state == assocCookieEchoed) {
+		// Collision with our own INIT: answer with the parameters already
+		// sent, as per RFC 4960 section 5.2.1.
+		ck.myTag = a.myTag
+		ck.myInitTSN = a.initialTSN
+		ck.outStreams = min(a.outStreams, init.InboundStreams())
+	}
+
+	ackParams := []header.SCTPParam{{
+		Type:  header.SCTPParamStateCookie,
+		Value: ck.encode(e.protocol.secret[:]),
+	}}
+	if len(e.localAddrs) > 1 {
+		for _, addr := range e.localAddrs {
+			if addr.Len() == s.id.LocalAddress.Len() && addr != s.id.LocalAddress {
+				ackParams = append(ackParams, header.SCTPAddressParam(addr))
+			}
+		}
+	}
+	outStreams := e.initMsg.NumOStreams
+	if a != nil && a.state < assocEstablished {
+		outStreams = a.outStreams
+	}
+	ack := header.NewSCTPInitChunk(header.SCTPChunkInitAck, &header.SCTPInitFields{
+		InitiateTag:     ck.myTag,
+		ARwnd:           uint32(max(0, int(e.ops.GetReceiveBufferSize())-e.rcvBufUsed)),
+		OutboundStreams: outStreams,
+		InboundStreams:  e.initMsg.MaxInStreams,
+		InitialTSN:      ck.myInitTSN,
+		Params:          ackParams,
+	})
+	e.protocol.sendControl(s, ck.peerTag, ack)
+}
+
+// peerAddrsFromInit returns the transport addresses of the sender of an INIT
+// or INIT ACK: its source address followed by the addresses it listed.
+func peerAddrsFromInit(s *segment, params []header.SCTPParam) []tcpip.Address {
+	addrs := []tcpip.Address{s.id.RemoteAddress}
+	for _, p := range params {
+		addr, ok := header.ParseSCTPAddressParam(p)
+		if !ok || addr.Unspecified() || addr == s.id.RemoteAddress {
+			continue
+		}
+		if addr.Len() == header.IPv4AddressSize && header.IsV4LoopbackAddress(addr) != header.IsV4LoopbackAddress(s.id.RemoteAddress) {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// handleInitAckLocked completes the first half of the handshake by echoing
+// the peer's state cookie.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleInitAckLocked(s *segment, c header.SCTPChunk) {
+	if a.state != assocCookieWait {
+		return
+	}
+	v := c.Value()
+	if len(v) < header.SCTPInitHeaderSize {
+		return
+	}
+	init := header.SCTPInit(v)
+	params, ok := init.Params()
+	if !ok || init.InitiateTag() == 0 {
+		return
+	}
+	if init.OutboundStreams() == 0 || init.InboundStreams() == 0 {
+		a.abortLocked(nil /* cause */)
+		return
+	}
+	var ck []byte
+	for _, p := range params {
+		if p.Type == header.SCTPParamStateCookie {
+			ck = p.Value
+		}
+	}
+	if ck == nil {
+		cause := header.NewSCTPErrorCause(header.SCTPCauseMissingParam, binary.BigEndian.AppendUint16([]byte{0, 0, 0, 1}, uint16(header.SCTPParamStateCookie)))
+		a.sendChunksLocked(a.primary, init.InitiateTag(), header.NewSCTPParamChunk(header.SCTPChunkAbort, 0, []header.SCTPParam{cause}))
+		a.terminateLocked(&tcpip.ErrConnectionRefused{}, assocChangeCantStrAssoc)
+		return
+	}
+
+	a.peerTag = init.InitiateTag()
+	a.outStreams = min(a.outStreams, init.InboundStreams())
+	a.inStreams = min(a.maxInStreams, init.OutboundStreams())
+	a.peerRwnd = init.ARwnd()
+	a.resetReceiveSequenceLocked(init.InitialTSN())
+	for _, addr := range peerAddrsFromInit(s, params) {
+		if a.addPathLocked(addr) != nil {
+			a.ep.addPeerLocked(a, addr)
+		}
+	}
+
+	a.cookieEcho = header.NewSCTPChunk(header.SCTPChunkCookieEcho, 0, len(ck))
+	copy(a.cookieEcho[header.SCTPChunkHeaderSize:], ck)
+	a.state = assocCookieEchoed
+	a.sendChunksLocked(a.handshakePath(), a.peerTag, a.cookieEcho)
+	a.armLocked(&a.t1, a.t1RTO, a.onT1ExpiredLocked)
+}
+
+// handleCookieEchoLocked validates a COOKIE ECHO and sets up the association
+// it describes. a is the existing association with the peer, if any.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handleCookieEchoLocked(s *segment, a *association) {
+	ck, ok := decodeCookie(s.chunks[0].Value(), e.protocol.secret[:])
+	if !ok || s.vtag != ck.myTag || ck.localPort != e.localPort || ck.peerPort != s.id.RemotePort {
+		return
+	}
+	if now := e.stack.Clock().Now(); ck.expired(now) {
+		staleness := binary.BigEndian.AppendUint32(nil, uint32(now.Sub(ck.created.Add(ck.lifespan)).Microseconds()))
+		cause := header.NewSCTPErrorCause(header.SCTPCauseStaleCookie, staleness)
+		e.protocol.sendControl(s, ck.peerTag, header.NewSCTPParamChunk(header.SCTPChunkError, 0, []header.SCTPParam{cause}))
+		return
+	}
+
+	switch {
+	case a == nil:
+		if a = e.newAssocFromCookieLocked(s, &ck); a == nil {
+			return
+		}
+	case ck.myTag == a.myTag && ck.peerTag == a.peerTag:
+		// A duplicate COOKIE ECHO (case D of RFC 4960 section 5.2.4).
+		if a.state < assocEstablished {
+			a.establishLocked()
+		}
+	case ck.myTag == a.myTag:
+		// An INIT collision (case B).
+		if a.state < assocEstablished {
+			a.initFromCookieLocked(&ck)
+			a.establishLocked()
+		} else {
+			a.peerTag = ck.peerTag
+		}
+	case ck.peerTag == a.peerTag:
+		// Case C: the cookie is silently discarded.
+		return
+	default:
+		// The peer restarted (case A).
+		if a.state >= assocShutdownAckSent {
+			return
+		}
+		a.restartLocked(&ck)
+	}
+
+	owner := a.endpoint()
+	if owner != e {
+		// The association was handed to a new endpoint, which is still
+		// locked by newAssocFromCookieLocked.
+		defer owner.unlockAndNotify()
+	}
+	a.sendChunksLocked(a.pathFor(s.id.RemoteAddress), a.peerTag, header.NewSCTPChunk(header.SCTPChunkCookieAck, 0, 0))
+	if len(s.chunks) > 1 {
+		rest := *s
+		rest.chunks = s.chunks[1:]
+		a.handleSegmentLocked(&rest)
+	} else {
+		a.transmitLocked()
+	}
+}
+
+// newAssocFromCookieLocked creates an established association from a
+// validated cookie. The association of a one-to-one endpoint is handed to a
+// new endpoint which is queued for Accept and returned locked.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) newAssocFromCookieLocked(s *segment, ck *cookie) *association {
+	owner := e
+	if !e.oneToMany {
+		if len(e.acceptQueue) > e.backlog {
+			return nil
+		}
+		owner = e.newChildLocked(&waiter.Queue{})
+		owner.mu.Lock()
+	}
+
+	a := newAssociation(owner, s.id.RemotePort)
+	a.localAddr = ck.localAddr
+	for _, addr := range ck.peerAddrs {
+		a.addPathLocked(addr)
+	}
+	if p := a.pathFor(s.id.RemoteAddress); p != nil {
+		a.primary = p
+	}
+	if a.primary == nil {
+		if owner != e {
+			owner.mu.Unlock()
+		}
+		return nil
+	}
+	a.initFromCookieLocked(ck)
+	owner.addAssocLocked(a)
+	a.establishLocked()
+
+	if owner != e {
+		e.acceptQueue = append(e.acceptQueue, owner)
+		for _, p := range a.paths {
+			e.forward[peerKey{addr: p.addr, port: a.peerPort}] = owner
+		}
+		e.notify(waiter.ReadableEvents)
+	}
+	return a
+}
+
+// initFromCookieLocked sets the parameters of a from a cookie.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) initFromCookieLocked(ck *cookie) {
+	a.myTag = ck.myTag
+	a.peerTag = ck.peerTag
+	a.initialTSN = ck.myInitTSN
+	a.outStreams = ck.outStreams
+	a.inStreams = ck.inStreams
+	a.peerRwnd = ck.peerRwnd
+	a.resetSendSequenceLocked()
+	a.resetReceiveSequenceLocked(ck.peerInitTSN)
+}
+
+// restartLocked resets a for a peer that restarted, as per RFC 4960 section
+// 5.2.4.1. Queued data is discarded.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) restartLocked(ck *cookie) {
+	a.stopTimersLocked()
+	a.discardSendQueueLocked()
+	a.rcvTSNs = make(map[uint32]struct{})
+	a.frags = make(map[uint32]*inChunk)
+	a.ordered = make(map[uint32]*inChunk)
+	a.rcvHeld = 0
+	a.initFromCookieLocked(ck)
+	for _, p := range a.paths {
+		p.cwnd = min(4*p.mtu, max(2*p.mtu, 4380))
+		p.ssthresh = 1 << 30
+		p.partialBytesAcked = 0
+		p.errorCount = 0
+		p.active = true
+	}
+	a.errorCount = 0
+	a.state = assocEstablished
+	a.ep.queueNotificationLocked(notifyAssocChange, newAssocChange(assocChangeRestart, 0, a.outStreams, a.inStreams, a.id))
+	a.startHeartbeatsLocked()
+}
+
+// resetSendSequenceLocked initializes the send sequence numbers.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) resetSendSequenceLocked() {
+	a.nextTSN = a.initialTSN
+	a.cumAckTSN = a.initialTSN - 1
+	a.outSSN = make([]uint16, a.outStreams)
+}
+
+// resetReceiveSequenceLocked initializes the receive sequence numbers given
+// the peer's initial TSN.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) resetReceiveSequenceLocked(peerInitialTSN uint32) {
+	a.cumTSN = peerInitialTSN - 1
+	a.inSSN = make([]uint16, a.inStreams)
+}
+
+// establishLocked moves a to the ESTABLISHED state.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) establishLocked() {
+	e := a.ep
+	a.t1.stop()
+	a.cookieEcho = nil
+	a.state = assocEstablished
+	// No data was sent before, so the streams start afresh.
+	a.outSSN = make([]uint16, a.outStreams)
+	// Messages queued during the handshake may use streams the peer did
+	// not agree to.
+	a.sendQ = filterStreams(a.sendQ, a.outStreams, &a.queuedBytes, &e.sndBufUsed)
+	e.queueNotificationLocked(notifyAssocChange, newAssocChange(assocChangeCommUp, 0, a.outStreams, a.inStreams, a.id))
+	if !e.oneToMany && e.state == stateConnecting {
+		e.state = stateConnected
+	}
+	e.notify(waiter.WritableEvents)
+	a.startHeartbeatsLocked()
+	a.resetAutocloseLocked()
+	if a.shutdownRequested {
+		a.shutdownLocked()
+	}
+}
+
+// startHeartbeatsLocked arms the heartbeat timers of all paths.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) startHeartbeatsLocked() {
+	for _, p := range a.paths {
+		a.armHeartbeatLocked(p)
+	}
+}
+
+func (a *association) armHeartbeatLocked(p *path) {
+	a.armLocked(&p.hbTimer, defaultHBInterval+p.rto, func() { a.onHeartbeatTimerLocked(p) })
+}
+
+// onHeartbeatTimerLocked sends a heartbeat on p, accounting for the previous
+// one if it was not acknowledged.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) onHeartbeatTimerLocked(p *path) {
+	if a.state < assocEstablished {
+		return
+	}
+	if p.hbOutstanding {
+		a.errorCount++
+		if a.errorCount > a.maxRetrans {
+			a.ep.setHardErrorLocked(&tcpip.ErrTimeout{})
+			a.abortLocked(nil /* cause */)
+			return
+		}
+		a.pathErrorLocked(p)
+		p.rto = min(2*p.rto, a.rtoMax)
+	}
+
+	rng := a.ep.stack.SecureRNG()
+	p.hbNonce = rng.Uint64()
+	p.hbOutstanding = true
+	info := make([]byte, 0, 1+header.IPv6AddressSize+16)
+	info = putAddr(info, p.addr)
+	info = binary.BigEndian.AppendUint64(info, p.hbNonce)
+	info = binary.BigEndian.AppendUint64(info, uint64(a.ep.stack.Clock().NowMonotonic().Sub(tcpip.MonotonicTime{})))
+	hb := header.NewSCTPParamChunk(header.SCTPChunkHeartbeat, 0, []header.SCTPParam{{Type: header.SCTPParamHeartbeatInfo, Value: info}})
+	a.sendChunksLocked(p, a.peerTag, hb)
+	a.armHeartbeatLocked(p)
+}
+
+// handleHeartbeatAckLocked confirms the reachability of the path that was
+// probed.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleHeartbeatAckLocked(c header.SCTPChunk) {
+	params := mustParams(c.Value())
+	if len(params) == 0 || params[0].Type != header.SCTPParamHeartbeatInfo {
+		return
+	}
+	addr, rest, ok := getAddr(params[0].Value)
+	if !ok || len(rest) < 16 {
+		return
+	}
+	p := a.pathFor(addr)
+	if p == nil || !p.hbOutstanding || binary.BigEndian.Uint64(rest) != p.hbNonce {
+		return
+	}
+	p.hbOutstanding = false
+	sent := tcpip.MonotonicTime{}.Add(time.Duration(binary.BigEndian.Uint64(rest[8:])))
+	a.updateRTOLocked(p, a.ep.stack.Clock().NowMonotonic().Sub(sent))
+	a.errorCount = 0
+	a.pathConfirmedLocked(p)
+}
+
+// pathErrorLocked accounts for a failure to reach p, marking it inactive
+// once it exceeds its error threshold.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) pathErrorLocked(p *path) {
+	p.errorCount++
+	if p.active && p.errorCount > defaultPathMaxRetrans {
+		p.active = false
+		a.ep.queueNotificationLocked(notifyPeerAddrChange, newPeerAddrChange(tcpip.FullAddress{Addr: p.addr, Port: a.peerPort}, addrUnreachable, a.id))
+	}
+}
+
+// pathConfirmedLocked records that p is reachable.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) pathConfirmedLocked(p *path) {
+	p.errorCount = 0
+	if !p.active {
+		p.active = true
+		a.ep.queueNotificationLocked(notifyPeerAddrChange, newPeerAddrChange(tcpip.FullAddress{Addr: p.addr, Port: a.peerPort}, addrAvailable, a.id))
+	}
+}
+
+// resetAutocloseLocked rearms the autoclose timer of an association of a
+// one-to-many endpoint.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) resetAutocloseLocked() {
+	if !a.ep.oneToMany || a.ep.autoclose == 0 || a.state != assocEstablished {
+		a.autocloseTimer.stop()
+		return
+	}
+	a.armLocked(&a.autocloseTimer, a.ep.autoclose, a.shutdownLocked)
+}
+
+// abortLocked sends an ABORT to the peer and terminates a. If cause is not
+// nil, it is sent as a user-initiated abort reason.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) abortLocked(cause []byte) {
+	if a.state == assocClosed {
+		return
+	}
+	var params []header.SCTPParam
+	if cause != nil {
+		params = append(params, header.NewSCTPErrorCause(header.SCTPCauseUserInitiatedAbort, cause))
+	}
+	abort := header.NewSCTPParamChunk(header.SCTPChunkAbort, 0, params)
+	if a.state == assocCookieWait {
+		// The peer's tag is not known yet; there is no one to abort.
+		a.terminateLocked(&tcpip.ErrConnectionAborted{}, assocChangeCantStrAssoc)
+		return
+	}
+	a.sendChunksLocked(a.activePath(), a.peerTag, abort)
+	state := uint16(assocChangeCommLost)
+	if a.state < assocEstablished {
+		state = assocChangeCantStrAssoc
+	}
+	a.terminateLocked(&tcpip.ErrConnectionAborted{}, state)
+}
+
+// handleAbortLocked terminates a after the peer aborted it.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleAbortLocked() {
+	if a.state < assocEstablished {
+		a.terminateLocked(&tcpip.ErrConnectionRefused{}, assocChangeCantStrAssoc)
+		return
+	}
+	a.terminateLocked(&tcpip.ErrConnectionReset{}, assocChangeCommLost)
+}
+
+// shutdownLocked starts a graceful shutdown of a once its queued data has
+// been acknowledged.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) shutdownLocked() {
+	switch a.state {
+	case assocCookieWait, assocCookieEchoed:
+		a.shutdownRequested = true
+	case assocEstablished:
+		a.state = assocShutdownPending
+		a.autocloseTimer.stop()
+		a.maybeSendShutdownLocked()
+	}
+}
+
+// maybeSendShutdownLocked sends SHUTDOWN or SHUTDOWN ACK once all queued
+// data has been acknowledged.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) maybeSendShutdownLocked() {
+	if len(a.sendQ) != 0 {
+		return
+	}
+	switch a.state {
+	case assocShutdownPending:
+		a.state = assocShutdownSent
+		a.errorCount = 0
+		a.sendShutdownLocked()
+	case assocShutdownReceived:
+		a.state = assocShutdownAckSent
+		a.errorCount = 0
+		a.sendShutdownLocked()
+	}
+}
+
+// sendShutdownLocked sends the SHUTDOWN or SHUTDOWN ACK chunk of the current
+// state and arms the T2-shutdown timer.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) sendShutdownLocked() {
+	p := a.activePath()
+	var chunk []byte
+	switch a.state {
+	case assocShutdownSent:
+		chunk = header.NewSCTPShutdownChunk(a.cumTSN)
+	case assocShutdownAckSent:
+		chunk = header.NewSCTPChunk(header.SCTPChunkShutdownAck, 0, 0)
+	default:
+		return
+	}
+	a.sendChunksLocked(p, a.peerTag, chunk)
+	a.armLocked(&a.t2, p.rto, a.onT2ExpiredLocked)
+}
+
+// onT2ExpiredLocked retransmits SHUTDOWN or SHUTDOWN ACK.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) onT2ExpiredLocked() {
+	a.errorCount++
+	if a.errorCount > a.maxRetrans {
+		a.abortLocked(nil /* cause */)
+		return
+	}
+	p := a.activePath()
+	a.pathErrorLocked(p)
+	p.rto = min(2*p.rto, a.rtoMax)
+	a.sendShutdownLocked()
+}
+
+// handleShutdownLocked handles a SHUTDOWN from the peer.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleShutdownLocked(c header.SCTPChunk) {
+	if len(c.Value()) < 4 {
+		return
+	}
+	switch a.state {
+	case assocEstablished, assocShutdownPending, assocShutdownSent:
+	default:
+		return
+	}
+	a.processCumAckLocked(header.SCTPShutdownCumTSNAck(c.Value()))
+	a.peerShutdownLocked()
+	switch a.state {
+	case assocEstablished, assocShutdownPending:
+		a.state = assocShutdownReceived
+		a.autocloseTimer.stop()
+		a.maybeSendShutdownLocked()
+	case assocShutdownSent:
+		a.state = assocShutdownAckSent
+		a.errorCount = 0
+		a.sendShutdownLocked()
+	}
+}
+
+// peerShutdownLocked records that the peer won't send any more data.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) peerShutdownLocked() {
+	if a.peerShutdown {
+		return
+	}
+	a.peerShutdown = true
+	e := a.ep
+	e.queueNotificationLocked(notifyShutdownEvent, newShutdownEvent(a.id))
+	if !e.oneToMany {
+		e.rcvShutdown = true
+		e.notify(waiter.ReadableEvents)
+	}
+}
+
+// handleShutdownAckLocked completes a shutdown started by a.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleShutdownAckLocked() {
+	if a.state != assocShutdownSent && a.state != assocShutdownAckSent {
+		return
+	}
+	a.sendChunksLocked(a.activePath(), a.peerTag, header.NewSCTPChunk(header.SCTPChunkShutdownComplete, 0, 0))
+	a.terminateLocked(nil /* err */, assocChangeShutdownComp)
+}
+
+// terminateLocked removes a from its endpoint. err is the error reported to
+// the user of a one-to-one endpoint and notif the state reported by the
+// SCTP_ASSOC_CHANGE notification.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) terminateLocked(err tcpip.Error, notif uint16) {
+	if a.state == assocClosed {
+		return
+	}
+	e := a.ep
+	wasConnecting := a.state < assocEstablished
+	a.state = assocClosed
+	a.stopTimersLocked()
+	a.discardSendQueueLocked()
+	a.rcvHeld = 0
+	clear(a.frags)
+	clear(a.ordered)
+	e.queueNotificationLocked(notifyAssocChange, newAssocChange(notif, 0, a.outStreams, a.inStreams, a.id))
+
+	if !e.oneToMany {
+		e.rcvShutdown = true
+		e.sndShutdown = true
+		if err != nil {
+			e.setHardErrorLocked(err)
+			if wasConnecting {
+				e.UpdateLastError(err)
+			}
+		}
+		e.state = stateClosed
+		e.notify(waiter.EventHUp | waiter.EventErr | waiter.ReadableEvents | waiter.WritableEvents)
+	}
+	e.removeAssocLocked(a)
+}
+
+// setHardErrorLocked records the error that terminated the association of a
+// one-to-one endpoint.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) setHardErrorLocked(err tcpip.Error) {
+	if !e.oneToMany && e.hardError == nil {
+		e.hardError = err
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// cookie is the state carried by the State Cookie of an INIT ACK, as per RFC
+// 4960 section 5.1.3. It holds everything needed to create the association
+// once the COOKIE ECHO arrives, so no state is kept for half-open
+// associations.
+type cookie struct {
+	created  time.Time
+	lifespan time.Duration
+
+	myTag, peerTag         uint32
+	myInitTSN, peerInitTSN uint32
+
+	// outStreams and inStreams are the negotiated stream counts.
+	outStreams, inStreams uint16
+
+	peerRwnd uint32
+
+	localPort, peerPort uint16
+	localAddr           tcpip.Address
+	peerAddrs           []tcpip.Address
+}
+
+const (
+	// cookieFixedSize is the size of the fixed fields of an encoded cookie.
+	cookieFixedSize = 8 + 8 + 4*5 + 2*4 + 2
+
+	// cookieMACSize is the size of the HMAC-SHA256 trailer of a cookie.
+	cookieMACSize = sha256.Size
+)
+
+func putAddr(b []byte, addr tcpip.Address) []byte {
+	b = append(b, byte(addr.Len()))
+	return append(b, addr.AsSlice()...)
+}
+
+func getAddr(b []byte) (tcpip.Address, []byte, bool) {
+	if len(b) < 1 {
+		return tcpip.Address{}, nil, false
+	}
+	l := int(b[0])
+	b = b[1:]
+	if len(b) < l {
+		return tcpip.Address{}, nil, false
+	}
+	switch l {
+	case 0:
+		return tcpip.Address{}, b, true
+	case 4:
+		return tcpip.AddrFrom4Slice(b[:l]), b[l:], true
+	case 16:
+		return tcpip.AddrFrom16Slice(b[:l]), b[l:], true
+	default:
+		return tcpip.Address{}, nil, false
+	}
+}
+
+// encode returns the cookie signed with secret.
+func (c *cookie) encode(secret []byte) []byte {
+	b := make([]byte, 0, cookieFixedSize+17*(len(c.peerAddrs)+1)+cookieMACSize)
+	b = binary.BigEndian.AppendUint64(b, uint64(c.created.UnixNano()))
+	b = binary.BigEndian.AppendUint64(b, uint64(c.lifespan))
+	b = binary.BigEndian.AppendUint32(b, c.myTag)
+	b = binary.BigEndian.AppendUint32(b, c.peerTag)
+	b = binary.BigEndian.AppendUint32(b, c.myInitTSN)
+	b = binary.BigEndian.AppendUint32(b, c.peerInitTSN)
+	b = binary.BigEndian.AppendUint32(b, c.peerRwnd)
+	b = binary.BigEndian.AppendUint16(b, c.outStreams)
+	b = binary.BigEndian.AppendUint16(b, c.inStreams)
+	b = binary.BigEndian.AppendUint16(b, c.localPort)
+	b = binary.BigEndian.AppendUint16(b, c.peerPort)
+	b = putAddr(b, c.localAddr)
+	b = append(b, byte(len(c.peerAddrs)))
+	for _, a := range c.peerAddrs {
+		b = putAddr(b, a)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(b)
+	return mac.Sum(b)
+}
+
+// decodeCookie authenticates and decodes an encoded cookie. It returns false
+// if the cookie is malformed or was not signed with secret.
+func decodeCookie(b []byte, secret []byte) (cookie, bool) {
+	var c cookie
+	if len(b) < cookieFixedSize+cookieMACSize {
+		return c, false
+	}
+	body, sum := b[:len(b)-cookieMACSize], b[len(b)-cookieMACSize:]
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return c, false
+	}
+
+	c.created = time.Unix(0, int64(binary.BigEndian.Uint64(body[0:])))
+	c.lifespan = time.Duration(binary.BigEndian.Uint64(body[8:]))
+	c.myTag = binary.BigEndian.Uint32(body[16:])
+	c.peerTag = binary.BigEndian.Uint32(body[20:])
+	c.myInitTSN = binary.BigEndian.Uint32(body[24:])
+	c.peerInitTSN = binary.BigEndian.Uint32(body[28:])
+	c.peerRwnd = binary.BigEndian.Uint32(body[32:])
+	c.outStreams = binary.BigEndian.Uint16(body[36:])
+	c.inStreams = binary.BigEndian.Uint16(body[38:])
+	c.localPort = binary.BigEndian.Uint16(body[40:])
+	c.peerPort = binary.BigEndian.Uint16(body[42:])
+	rest := body[44:]
+
+	var ok bool
+	if c.localAddr, rest, ok = getAddr(rest); !ok || len(rest) < 1 {
+		return c, false
+	}
+	n := int(rest[0])
+	rest = rest[1:]
+	for i := 0; i < n; i++ {
+		var a tcpip.Address
+		if a, rest, ok = getAddr(rest); !ok {
+			return c, false
+		}
+		c.peerAddrs = append(c.peerAddrs, a)
+	}
+	return c, len(rest) == 0
+}
+
+// expired returns true if the cookie's lifespan has elapsed at now.
+func (c *cookie) expired(now time.Time) bool {
+	return now.Sub(c.created) > c.lifespan
+}
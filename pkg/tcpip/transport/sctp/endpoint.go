@@ -0,0 +1,1849 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/ports"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// endpointState is the state of an endpoint.
+type endpointState uint32
+
+const (
+	// stateInitial is the state of a new endpoint.
+	stateInitial endpointState = iota
+
+	// stateBound is the state of an endpoint bound to a local port.
+	stateBound
+
+	// stateListen is the state of an endpoint accepting associations.
+	stateListen
+
+	// stateConnecting is the state of a one-to-one endpoint whose
+	// association is being set up.
+	stateConnecting
+
+	// stateConnected is the state of a one-to-one endpoint with an
+	// established association.
+	stateConnected
+
+	// stateClosed is the state of an endpoint that can no longer be used
+	// to communicate.
+	stateClosed
+)
+
+// String implements fmt.Stringer.
+func (s endpointState) String() string {
+	switch s {
+	case stateInitial:
+		return "INITIAL"
+	case stateBound:
+		return "BOUND"
+	case stateListen:
+		return "LISTEN"
+	case stateConnecting:
+		return "CONNECTING"
+	case stateConnected:
+		return "CONNECTED"
+	case stateClosed:
+		return "CLOSED"
+	default:
+		return fmt.Sprintf("endpointState(%d)", s)
+	}
+}
+
+// sctpMessage is a user message or notification waiting to be read.
+//
+// +stateify savable
+type sctpMessage struct {
+	sctpMessageEntry
+
+	from         tcpip.FullAddress
+	info         tcpip.SCTPRcvInfo
+	notification bool
+	data         []byte
+
+	// off is the offset of the first unread byte of data. Messages can be
+	// read piecewise with short buffers.
+	off int
+}
+
+// binding is a local address that the endpoint is registered with the stack
+// for.
+//
+// +stateify savable
+type binding struct {
+	netProtos []tcpip.NetworkProtocolNumber
+	id        stack.TransportEndpointID
+
+	// reserved is true if the binding holds a port reservation. Endpoints
+	// created for accepted or peeled off associations share the port of
+	// their parent and don't reserve it.
+	reserved bool
+}
+
+// endpoint represents an SCTP endpoint. This struct serves as the interface
+// between users of the endpoint and the protocol implementation; it is legal
+// to have concurrent goroutines make calls into the endpoint, they are
+// properly synchronized.
+//
+// Received packets are queued by HandlePacket and processed by a separate
+// goroutine, so that the protocol never runs in the context of the sender of
+// a packet. This keeps endpoints that exchange packets over loopback from
+// deadlocking on each other's locks.
+//
+// It implements tcpip.Endpoint.
+//
+// +stateify savable
+type endpoint struct {
+	tcpip.DefaultSocketOptionsHandler
+
+	// The following fields are initialized at creation time and do not
+	// change throughout the lifetime of the endpoint.
+	stack       *stack.Stack `state:"manual"`
+	protocol    *protocol
+	waiterQueue *waiter.Queue
+	netProto    tcpip.NetworkProtocolNumber
+	oneToMany   bool
+	stats       tcpip.TransportEndpointStats
+	ops         tcpip.SocketOptions
+
+	// The following fields are used to queue received packets, and are
+	// protected by pktMu.
+	pktMu      sync.Mutex `state:"nosave"`
+	pktQueue   segmentList
+	processing bool `state:"nosave"`
+
+	// frozen indicates if the packets should be delivered to the endpoint
+	// during restore.
+	frozen bool
+
+	// dead is set once the endpoint no longer handles any association. It
+	// allows a parent endpoint to stop forwarding packets without taking
+	// the endpoint's lock.
+	dead atomicbitops.Bool
+
+	lastErrorMu sync.Mutex `state:"nosave"`
+	lastError   tcpip.Error
+
+	// The following fields are protected by the mu mutex.
+	mu                 sync.Mutex `state:"nosave"`
+	state              endpointState
+	effectiveNetProtos []tcpip.NetworkProtocolNumber
+	portFlags          ports.Flags
+	bindToDevice       tcpip.NICID
+	localPort          uint16
+	owner              tcpip.PacketOwner
+
+	// localAddrs are the addresses the endpoint is bound to. It is empty
+	// if the endpoint is bound to the wildcard address.
+	localAddrs []tcpip.Address
+	bindings   []binding
+
+	// assocs holds the associations of the endpoint, indexed by ID. A
+	// one-to-one endpoint holds at most one association.
+	assocs map[tcpip.SCTPAssocID]*association
+
+	// peers indexes the associations by the transport addresses of their
+	// peers.
+	peers map[peerKey]*association
+
+	// forward holds the endpoints that own associations created or peeled
+	// off by this endpoint. Packets that the stack delivered here before
+	// the owner registered itself are forwarded to it.
+	forward map[peerKey]*endpoint
+
+	// backlog and acceptQueue are used by listening one-to-one endpoints.
+	backlog     int
+	acceptQueue []*endpoint
+
+	rcvList    sctpMessageList
+	rcvBufUsed int
+
+	// rcvShutdown and sndShutdown indicate that a one-to-one endpoint can
+	// no longer receive or send data, respectively.
+	rcvShutdown bool
+	sndShutdown bool
+
+	// sndBufUsed is the number of bytes of user data queued for sending
+	// and not yet acknowledged.
+	sndBufUsed int
+
+	// hardError is the error that terminated the association of a
+	// one-to-one endpoint. It is reported once by Connect, Read or Write.
+	hardError tcpip.Error
+
+	// connectNotified is true once Connect reported the success of a
+	// connection.
+	connectNotified bool
+
+	// userClosed is true once Close was called.
+	userClosed bool
+
+	// notifyMask holds the events to notify waiters of once mu is released.
+	notifyMask waiter.EventMask
+
+	// Socket options.
+	nodelay          bool
+	autoclose        time.Duration
+	maxSeg           int
+	disableFragments bool
+	recvRcvInfo      bool
+	events           tcpip.SCTPEventsOption
+	initMsg          tcpip.SCTPInitMsgOption
+	rtoInitial       time.Duration
+	rtoMin           time.Duration
+	rtoMax           time.Duration
+	assocMaxRetrans  int
+	cookieLife       time.Duration
+	defaultSndInfo   tcpip.SCTPSndInfo
+}
+
+func newEndpoint(p *protocol, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue, oneToMany bool) *endpoint {
+	e := &endpoint{
+		stack:       p.stack,
+		protocol:    p,
+		waiterQueue: waiterQueue,
+		netProto:    netProto,
+		oneToMany:   oneToMany,
+		assocs:      make(map[tcpip.SCTPAssocID]*association),
+		peers:       make(map[peerKey]*association),
+		forward:     make(map[peerKey]*endpoint),
+		initMsg: tcpip.SCTPInitMsgOption{
+			NumOStreams:    defaultOutStreams,
+			MaxInStreams:   defaultMaxInStreams,
+			MaxAttempts:    defaultMaxInitAttempts,
+			MaxInitTimeout: defaultRTOMax,
+		},
+		rtoInitial:      defaultRTOInitial,
+		rtoMin:          defaultRTOMin,
+		rtoMax:          defaultRTOMax,
+		assocMaxRetrans: defaultAssocMaxRetrans,
+		cookieLife:      defaultCookieLife,
+	}
+	e.ops.InitHandler(e, e.stack, tcpip.GetStackSendBufferLimits, tcpip.GetStackReceiveBufferLimits)
+	e.ops.SetSendBufferSize(DefaultSendBufferSize, false /* notify */)
+	e.ops.SetReceiveBufferSize(DefaultReceiveBufferSize, false /* notify */)
+
+	var ss tcpip.SendBufferSizeOption
+	if err := e.stack.Option(&ss); err == nil {
+		e.ops.SetSendBufferSize(int64(ss.Default), false /* notify */)
+	}
+	var rs tcpip.ReceiveBufferSizeOption
+	if err := e.stack.Option(&rs); err == nil {
+		e.ops.SetReceiveBufferSize(int64(rs.Default), false /* notify */)
+	}
+	return e
+}
+
+// newChildLocked returns a new one-to-one endpoint that inherits the
+// configuration of e. It is used for accepted and peeled off associations.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) newChildLocked(wq *waiter.Queue) *endpoint {
+	n := newEndpoint(e.protocol, e.netProto, wq, false /* oneToMany */)
+	n.ops.SetSendBufferSize(e.ops.GetSendBufferSize(), false /* notify */)
+	n.ops.SetReceiveBufferSize(e.ops.GetReceiveBufferSize(), false /* notify */)
+	n.ops.SetV6Only(e.ops.GetV6Only())
+	n.ops.SetLinger(e.ops.GetLinger())
+	n.state = stateConnected
+	n.connectNotified = true
+	n.effectiveNetProtos = e.effectiveNetProtos
+	n.bindToDevice = e.bindToDevice
+	n.localPort = e.localPort
+	n.localAddrs = slices.Clone(e.localAddrs)
+	n.owner = e.owner
+	n.nodelay = e.nodelay
+	n.maxSeg = e.maxSeg
+	n.disableFragments = e.disableFragments
+	n.recvRcvInfo = e.recvRcvInfo
+	n.events = e.events
+	n.initMsg = e.initMsg
+	n.rtoInitial = e.rtoInitial
+	n.rtoMin = e.rtoMin
+	n.rtoMax = e.rtoMax
+	n.assocMaxRetrans = e.assocMaxRetrans
+	n.cookieLife = e.cookieLife
+	n.defaultSndInfo = e.defaultSndInfo
+	return n
+}
+
+// notify queues events to be delivered to waiters once e.mu is released.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) notify(mask waiter.EventMask) {
+	e.notifyMask |= mask
+}
+
+// unlockAndNotify releases e.mu and notifies waiters of the events queued
+// while it was held.
+func (e *endpoint) unlockAndNotify() {
+	mask := e.notifyMask
+	e.notifyMask = 0
+	e.mu.Unlock()
+	if mask != 0 {
+		e.waiterQueue.Notify(mask)
+	}
+}
+
+// LastError implements tcpip.Endpoint.LastError.
+func (e *endpoint) LastError() tcpip.Error {
+	e.lastErrorMu.Lock()
+	defer e.lastErrorMu.Unlock()
+
+	err := e.lastError
+	e.lastError = nil
+	return err
+}
+
+// UpdateLastError implements tcpip.SocketOptionsHandler.UpdateLastError.
+func (e *endpoint) UpdateLastError(err tcpip.Error) {
+	e.lastErrorMu.Lock()
+	e.lastError = err
+	e.lastErrorMu.Unlock()
+}
+
+// WakeupWriters implements tcpip.SocketOptionsHandler.WakeupWriters.
+func (e *endpoint) WakeupWriters() {
+	e.waiterQueue.Notify(waiter.WritableEvents)
+}
+
+// OnReusePortSet implements tcpip.SocketOptionsHandler.OnReusePortSet.
+func (e *endpoint) OnReusePortSet(v bool) {
+	e.mu.Lock()
+	e.portFlags.LoadBalanced = v
+	e.mu.Unlock()
+}
+
+// Abort implements stack.TransportEndpoint.Abort.
+func (e *endpoint) Abort() {
+	e.mu.Lock()
+	for _, a := range e.assocList() {
+		a.abortLocked(nil /* cause */)
+	}
+	e.unlockAndNotify()
+	e.Close()
+}
+
+// Close implements tcpip.Endpoint.Close.
+func (e *endpoint) Close() {
+	e.mu.Lock()
+	if e.userClosed {
+		e.mu.Unlock()
+		return
+	}
+	e.userClosed = true
+
+	// Associations that were never accepted are aborted.
+	pending := e.acceptQueue
+	e.acceptQueue = nil
+
+	// As in Linux, unread data or a zero linger time abort the
+	// associations instead of shutting them down gracefully.
+	linger := e.ops.GetLinger()
+	abort := !e.rcvList.Empty() || (linger.Enabled && linger.Timeout == 0)
+	for _, a := range e.assocList() {
+		if abort || a.state < assocEstablished {
+			a.abortLocked(nil /* cause */)
+		} else {
+			a.shutdownLocked()
+		}
+	}
+	e.rcvList.Reset()
+	e.rcvBufUsed = 0
+	e.rcvShutdown = true
+	e.sndShutdown = true
+	clear(e.forward)
+	e.maybeCleanupLocked()
+	e.notify(waiter.EventHUp | waiter.EventErr | waiter.ReadableEvents | waiter.WritableEvents)
+	e.unlockAndNotify()
+
+	for _, n := range pending {
+		n.Abort()
+	}
+}
+
+// maybeCleanupLocked releases the resources of a closed endpoint once its
+// last association is gone.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) maybeCleanupLocked() {
+	if !e.userClosed || len(e.assocs) != 0 {
+		return
+	}
+	e.unbindLocked()
+	e.state = stateClosed
+	e.dead.Store(true)
+}
+
+// unbindLocked unregisters e from the stack and releases its ports.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) unbindLocked() {
+	for _, b := range e.bindings {
+		e.unregisterLocked(b)
+	}
+	e.bindings = nil
+}
+
+func (e *endpoint) unregisterLocked(b binding) {
+	e.stack.UnregisterTransportEndpoint(b.netProtos, ProtocolNumber, b.id, e, e.portFlags, e.bindToDevice)
+	if b.reserved {
+		e.stack.ReleasePort(ports.Reservation{
+			Networks:     b.netProtos,
+			Transport:    ProtocolNumber,
+			Addr:         b.id.LocalAddress,
+			Port:         b.id.LocalPort,
+			Flags:        e.portFlags,
+			BindToDevice: e.bindToDevice,
+		})
+	}
+}
+
+// assocList returns the associations of e sorted by ID.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) assocList() []*association {
+	l := make([]*association, 0, len(e.assocs))
+	for _, a := range e.assocs {
+		l = append(l, a)
+	}
+	slices.SortFunc(l, func(a, b *association) int {
+		return int(a.id) - int(b.id)
+	})
+	return l
+}
+
+// oneToOneAssoc returns the association of a one-to-one endpoint, if any.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) oneToOneAssoc() *association {
+	for _, a := range e.assocs {
+		return a
+	}
+	return nil
+}
+
+// ModerateRecvBuf implements tcpip.Endpoint.ModerateRecvBuf.
+func (*endpoint) ModerateRecvBuf(int) {}
+
+// Read implements tcpip.Endpoint.Read. Each call reads from at most one
+// message; EndOfRecord is set when the end of the message is read.
+func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult, tcpip.Error) {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	m := e.rcvList.Front()
+	if m == nil {
+		if e.oneToMany || !e.rcvShutdown {
+			return tcpip.ReadResult{}, &tcpip.ErrWouldBlock{}
+		}
+		if err := e.hardError; err != nil {
+			e.hardError = nil
+			return tcpip.ReadResult{}, err
+		}
+		e.stats.ReadErrors.ReadClosed.Increment()
+		return tcpip.ReadResult{}, &tcpip.ErrClosedForReceive{}
+	}
+
+	data := m.data[m.off:]
+	res := tcpip.ReadResult{
+		Total:        len(data),
+		Notification: m.notification,
+	}
+	if opts.NeedRemoteAddr {
+		res.RemoteAddr = m.from
+	}
+	if !m.notification {
+		res.ControlMessages.SCTPRcvInfo = m.info
+		res.ControlMessages.HasSCTPRcvInfo = e.recvRcvInfo
+		res.ControlMessages.HasSCTPSndRcvInfo = e.events&tcpip.SCTPEventDataIO != 0
+	}
+
+	n, err := dst.Write(data)
+	if n == 0 && err != nil && len(data) != 0 {
+		return res, &tcpip.ErrBadBuffer{}
+	}
+	res.Count = n
+	res.EndOfRecord = n == len(data)
+	if opts.Peek {
+		return res, nil
+	}
+
+	m.off += n
+	if m.off == len(m.data) {
+		e.rcvList.Remove(m)
+		e.rcvBufUsed -= len(m.data)
+		// Let the peers know about the space that was freed.
+		for _, a := range e.assocs {
+			a.maybeSendWindowUpdateLocked()
+		}
+	}
+	return res, nil
+}
+
+// queueMessageLocked makes m available to readers.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) queueMessageLocked(m *sctpMessage) {
+	if e.rcvShutdown && !m.notification {
+		return
+	}
+	e.rcvList.PushBack(m)
+	e.rcvBufUsed += len(m.data)
+	e.notify(waiter.ReadableEvents)
+}
+
+// queueNotificationLocked queues the notification b of type typ if the
+// endpoint is subscribed to it.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) queueNotificationLocked(typ int, b []byte) {
+	if e.userClosed || e.events&(1<<(typ-0x8000)) == 0 {
+		return
+	}
+	e.rcvList.PushBack(&sctpMessage{
+		notification: true,
+		data:         b,
+	})
+	e.rcvBufUsed += len(b)
+	e.notify(waiter.ReadableEvents)
+}
+
+// Write implements tcpip.Endpoint.Write. Each call sends a single message.
+func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcpip.Error) {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	info := e.defaultSndInfo
+	if opts.ControlMessages.HasSCTPSndInfo {
+		info = opts.ControlMessages.SCTPSndInfo
+	}
+	size := p.Len()
+	if size == 0 && info.Flags&(tcpip.SCTPFlagEOF|tcpip.SCTPFlagAbort) == 0 {
+		return 0, &tcpip.ErrInvalidOptionValue{}
+	}
+	if info.Flags&tcpip.SCTPFlagAbort == 0 && int64(size) > e.ops.GetSendBufferSize() {
+		return 0, &tcpip.ErrMessageTooLong{}
+	}
+
+	var targets []*association
+	if e.oneToMany && info.Flags&tcpip.SCTPFlagSendAll != 0 {
+		targets = e.assocList()
+	} else {
+		a, err := e.writeTargetLocked(info, opts.To)
+		if err != nil {
+			return 0, err
+		}
+		targets = []*association{a}
+	}
+
+	for _, a := range targets {
+		if info.Flags&tcpip.SCTPFlagAbort != 0 {
+			continue
+		}
+		if info.Stream >= a.outStreams {
+			return 0, &tcpip.ErrInvalidOptionValue{}
+		}
+		if e.disableFragments && size > a.fragPointLocked() {
+			return 0, &tcpip.ErrMessageTooLong{}
+		}
+		if a.state > assocEstablished && size != 0 {
+			return 0, &tcpip.ErrClosedForSend{}
+		}
+	}
+
+	if info.Flags&tcpip.SCTPFlagAbort == 0 && size != 0 {
+		if e.sndBufUsed+len(targets)*size > int(e.ops.GetSendBufferSize()) {
+			return 0, &tcpip.ErrWouldBlock{}
+		}
+	}
+
+	v := make([]byte, size)
+	if _, err := io.ReadFull(p, v); err != nil {
+		return 0, &tcpip.ErrBadBuffer{}
+	}
+
+	for _, a := range targets {
+		switch {
+		case info.Flags&tcpip.SCTPFlagAbort != 0:
+			a.abortLocked(v)
+			continue
+		case size != 0:
+			a.enqueueMessageLocked(info, v)
+		}
+		if info.Flags&tcpip.SCTPFlagEOF != 0 {
+			a.shutdownLocked()
+		}
+		a.transmitLocked()
+	}
+	e.stats.PacketsSent.Increment()
+	return int64(size), nil
+}
+
+// writeTargetLocked returns the association that a message sent with info
+// to the optional address to should be sent on. Associations are set up
+// implicitly when needed.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) writeTargetLocked(info tcpip.SCTPSndInfo, to *tcpip.FullAddress) (*association, tcpip.Error) {
+	if !e.oneToMany {
+		switch e.state {
+		case stateConnecting, stateConnected:
+			if e.sndShutdown {
+				return nil, &tcpip.ErrClosedForSend{}
+			}
+			if a := e.oneToOneAssoc(); a != nil {
+				return a, nil
+			}
+			return nil, &tcpip.ErrClosedForSend{}
+		case stateInitial, stateBound:
+			if to == nil {
+				return nil, &tcpip.ErrNotConnected{}
+			}
+			a, err := e.connectLocked([]tcpip.FullAddress{*to})
+			if err != nil {
+				return nil, err
+			}
+			e.state = stateConnecting
+			return a, nil
+		case stateClosed:
+			if err := e.hardError; err != nil {
+				e.hardError = nil
+				return nil, err
+			}
+			return nil, &tcpip.ErrClosedForSend{}
+		default:
+			return nil, &tcpip.ErrClosedForSend{}
+		}
+	}
+
+	if e.state == stateClosed {
+		return nil, &tcpip.ErrClosedForSend{}
+	}
+	if info.AssocID != 0 {
+		a, ok := e.assocs[info.AssocID]
+		if !ok {
+			return nil, &tcpip.ErrInvalidOptionValue{}
+		}
+		return a, nil
+	}
+	if to == nil {
+		return nil, &tcpip.ErrDestinationRequired{}
+	}
+	addr, _, err := e.checkV4MappedLocked(*to, false /* bind */)
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := e.peers[peerKey{addr: addr.Addr, port: addr.Port}]; ok {
+		return a, nil
+	}
+	if info.Flags&(tcpip.SCTPFlagEOF|tcpip.SCTPFlagAbort) != 0 {
+		return nil, &tcpip.ErrInvalidOptionValue{}
+	}
+	return e.connectLocked([]tcpip.FullAddress{addr})
+}
+
+// checkV4MappedLocked determines the effective network protocol and
+// converts addr to its canonical form.
+func (e *endpoint) checkV4MappedLocked(addr tcpip.FullAddress, bind bool) (tcpip.FullAddress, tcpip.NetworkProtocolNumber, tcpip.Error) {
+	info := stack.TransportEndpointInfo{NetProto: e.netProto}
+	return info.AddrNetProtoLocked(addr, e.ops.GetV6Only(), bind)
+}
+
+// Disconnect implements tcpip.Endpoint.Disconnect.
+func (*endpoint) Disconnect() tcpip.Error {
+	return &tcpip.ErrNotSupported{}
+}
+
+// Connect implements tcpip.Endpoint.Connect. A one-to-one endpoint reports
+// the progress of the association set up like a TCP endpoint; a one-to-many
+// endpoint sets up the association in the background.
+func (e *endpoint) Connect(addr tcpip.FullAddress) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+	return e.connectUserLocked([]tcpip.FullAddress{addr}, nil /* id */)
+}
+
+// connectUserLocked starts an association to addrs on behalf of the user.
+// If id is not nil, it is set to the ID of the new association.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) connectUserLocked(addrs []tcpip.FullAddress, id *tcpip.SCTPAssocID) tcpip.Error {
+	if e.oneToMany {
+		if e.state == stateClosed {
+			return &tcpip.ErrInvalidEndpointState{}
+		}
+		for _, addr := range addrs {
+			addr, _, err := e.checkV4MappedLocked(addr, false /* bind */)
+			if err != nil {
+				return err
+			}
+			if a, ok := e.peers[peerKey{addr: addr.Addr, port: addr.Port}]; ok {
+				if a.state < assocEstablished {
+					return &tcpip.ErrAlreadyConnecting{}
+				}
+				return &tcpip.ErrAlreadyConnected{}
+			}
+		}
+		a, err := e.connectLocked(addrs)
+		if err != nil {
+			return err
+		}
+		if id != nil {
+			*id = a.id
+		}
+		return nil
+	}
+
+	switch e.state {
+	case stateConnected:
+		// The caller may not have been notified yet of the success of a
+		// previous connection attempt.
+		if !e.connectNotified {
+			e.connectNotified = true
+			return nil
+		}
+		return &tcpip.ErrAlreadyConnected{}
+	case stateConnecting:
+		return &tcpip.ErrAlreadyConnecting{}
+	case stateListen:
+		return &tcpip.ErrInvalidEndpointState{}
+	case stateClosed:
+		if err := e.hardError; err != nil {
+			e.hardError = nil
+			return err
+		}
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+
+	a, err := e.connectLocked(addrs)
+	if err != nil {
+		return err
+	}
+	if id != nil {
+		*id = a.id
+	}
+	e.state = stateConnecting
+	return &tcpip.ErrConnectStarted{}
+}
+
+// connectLocked creates an association to the peer reachable at addrs and
+// sends an INIT to the first of them.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) connectLocked(addrs []tcpip.FullAddress) (*association, tcpip.Error) {
+	if len(addrs) == 0 {
+		return nil, &tcpip.ErrInvalidOptionValue{}
+	}
+	var (
+		peerAddrs []tcpip.Address
+		port      uint16
+	)
+	for i, addr := range addrs {
+		addr, _, err := e.checkV4MappedLocked(addr, false /* bind */)
+		if err != nil {
+			return nil, err
+		}
+		if addr.Port == 0 || (i > 0 && addr.Port != port) {
+			return nil, &tcpip.ErrInvalidEndpointState{}
+		}
+		port = addr.Port
+		if !slices.Contains(peerAddrs, addr.Addr) {
+			peerAddrs = append(peerAddrs, addr.Addr)
+		}
+	}
+
+	if e.state == stateInitial {
+		if err := e.bindLocked([]tcpip.FullAddress{{}}); err != nil {
+			return nil, err
+		}
+	}
+
+	a := newAssociation(e, port)
+	for _, addr := range peerAddrs {
+		a.addPathLocked(addr)
+	}
+	if a.primary == nil {
+		return nil, &tcpip.ErrHostUnreachable{}
+	}
+	r, err := a.routeLocked(a.primary)
+	if err != nil {
+		return nil, err
+	}
+	a.localAddr = r.LocalAddress()
+	r.Release()
+
+	rng := e.stack.SecureRNG()
+	a.myTag = newTag(&rng)
+	a.initialTSN = rng.Uint32()
+	a.resetSendSequenceLocked()
+	a.maxInStreams = e.initMsg.MaxInStreams
+	a.outStreams = e.initMsg.NumOStreams
+	a.state = assocCookieWait
+	e.addAssocLocked(a)
+	a.sendInitLocked()
+	return a, nil
+}
+
+// Shutdown implements tcpip.Endpoint.Shutdown. It is a no-op on one-to-many
+// endpoints, as in Linux.
+func (e *endpoint) Shutdown(flags tcpip.ShutdownFlags) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if e.oneToMany {
+		return nil
+	}
+	switch e.state {
+	case stateConnecting, stateConnected:
+	case stateListen:
+		if flags&tcpip.ShutdownRead != 0 {
+			e.rcvShutdown = true
+			e.notify(waiter.ReadableEvents)
+		}
+		return nil
+	default:
+		return &tcpip.ErrNotConnected{}
+	}
+
+	if flags&tcpip.ShutdownRead != 0 {
+		e.rcvShutdown = true
+		e.notify(waiter.ReadableEvents)
+	}
+	if flags&tcpip.ShutdownWrite != 0 && !e.sndShutdown {
+		e.sndShutdown = true
+		if a := e.oneToOneAssoc(); a != nil {
+			a.shutdownLocked()
+		}
+		e.notify(waiter.WritableEvents)
+	}
+	return nil
+}
+
+// Listen implements tcpip.Endpoint.Listen. On a one-to-many endpoint a
+// backlog of zero stops accepting new associations.
+func (e *endpoint) Listen(backlog int) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	switch e.state {
+	case stateInitial:
+		if err := e.bindLocked([]tcpip.FullAddress{{}}); err != nil {
+			return err
+		}
+	case stateBound, stateListen:
+	default:
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+
+	if e.oneToMany {
+		if backlog == 0 {
+			e.state = stateBound
+		} else {
+			e.state = stateListen
+		}
+		return nil
+	}
+	if len(e.assocs) != 0 {
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+	e.backlog = max(backlog, 0)
+	e.state = stateListen
+	e.rcvShutdown = false
+	return nil
+}
+
+// Accept implements tcpip.Endpoint.Accept.
+func (e *endpoint) Accept(peerAddr *tcpip.FullAddress) (tcpip.Endpoint, *waiter.Queue, tcpip.Error) {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if e.oneToMany {
+		return nil, nil, &tcpip.ErrNotSupported{}
+	}
+	if e.state != stateListen {
+		return nil, nil, &tcpip.ErrInvalidEndpointState{}
+	}
+	if len(e.acceptQueue) == 0 {
+		return nil, nil, &tcpip.ErrWouldBlock{}
+	}
+	n := e.acceptQueue[0]
+	e.acceptQueue[0] = nil
+	e.acceptQueue = e.acceptQueue[1:]
+	if peerAddr != nil {
+		addr, err := n.GetRemoteAddress()
+		if err == nil {
+			*peerAddr = addr
+		}
+	}
+	return n, n.waiterQueue, nil
+}
+
+// Bind implements tcpip.Endpoint.Bind.
+func (e *endpoint) Bind(addr tcpip.FullAddress) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	if e.state != stateInitial {
+		return &tcpip.ErrAlreadyBound{}
+	}
+	return e.bindLocked([]tcpip.FullAddress{addr})
+}
+
+// bindLocked binds an endpoint in the initial state to addrs. All addresses
+// must use the same port; a wildcard address must be the only one.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) bindLocked(addrs []tcpip.FullAddress) tcpip.Error {
+	var port uint16
+	for i, addr := range addrs {
+		if i > 0 && addr.Port != port && addr.Port != 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		if i == 0 {
+			port = addr.Port
+		}
+	}
+	e.bindToDevice = tcpip.NICID(e.ops.GetBindToDevice())
+	for _, addr := range addrs {
+		addr.Port = port
+		b, err := e.bindAddrLocked(addr, len(addrs) > 1)
+		if err != nil {
+			e.unbindLocked()
+			e.localAddrs = nil
+			return err
+		}
+		// Subsequent addresses must use the port that was picked for the
+		// first one.
+		port = b.id.LocalPort
+	}
+	e.localPort = port
+	e.state = stateBound
+	return nil
+}
+
+// bindAddrLocked reserves the port of addr and registers e for it. If
+// specific is true, addr must not be the wildcard address.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) bindAddrLocked(addr tcpip.FullAddress, specific bool) (binding, tcpip.Error) {
+	addr, netProto, err := e.checkV4MappedLocked(addr, true /* bind */)
+	if err != nil {
+		return binding{}, err
+	}
+	netProtos := []tcpip.NetworkProtocolNumber{netProto}
+	if addr.Addr.Unspecified() {
+		if specific {
+			return binding{}, &tcpip.ErrInvalidOptionValue{}
+		}
+		// A dual-stack endpoint bound to the wildcard address accepts
+		// IPv4 packets as well.
+		if netProto == header.IPv6ProtocolNumber && !e.ops.GetV6Only() {
+			netProtos = []tcpip.NetworkProtocolNumber{header.IPv6ProtocolNumber, header.IPv4ProtocolNumber}
+		}
+	} else {
+		if slices.Contains(e.localAddrs, addr.Addr) {
+			return binding{}, &tcpip.ErrPortInUse{}
+		}
+		if nic := e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr); nic == 0 {
+			return binding{}, &tcpip.ErrBadLocalAddress{}
+		}
+	}
+
+	port, err := e.stack.ReservePort(e.stack.SecureRNG(), ports.Reservation{
+		Networks:     netProtos,
+		Transport:    ProtocolNumber,
+		Addr:         addr.Addr,
+		Port:         addr.Port,
+		Flags:        e.portFlags,
+		BindToDevice: e.bindToDevice,
+	}, nil /* testPort */)
+	if err != nil {
+		return binding{}, err
+	}
+	b := binding{
+		netProtos: netProtos,
+		id: stack.TransportEndpointID{
+			LocalPort:    port,
+			LocalAddress: addr.Addr,
+		},
+		reserved: true,
+	}
+	if err := e.stack.RegisterTransportEndpoint(netProtos, ProtocolNumber, b.id, e, e.portFlags, e.bindToDevice); err != nil {
+		e.stack.ReleasePort(ports.Reservation{
+			Networks:     netProtos,
+			Transport:    ProtocolNumber,
+			Addr:         addr.Addr,
+			Port:         port,
+			Flags:        e.portFlags,
+			BindToDevice: e.bindToDevice,
+		})
+		return binding{}, err
+	}
+	e.bindings = append(e.bindings, b)
+	if !addr.Addr.Unspecified() {
+		e.localAddrs = append(e.localAddrs, addr.Addr)
+	}
+	e.effectiveNetProtos = appendNetProtos(e.effectiveNetProtos, netProtos)
+	return b, nil
+}
+
+func appendNetProtos(l, netProtos []tcpip.NetworkProtocolNumber) []tcpip.NetworkProtocolNumber {
+	for _, p := range netProtos {
+		if !slices.Contains(l, p) {
+			l = append(l, p)
+		}
+	}
+	return l
+}
+
+// bindxLocked adds addresses to, or removes them from, a bound endpoint.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) bindxLocked(opt *tcpip.SCTPBindxOption) tcpip.Error {
+	if len(opt.Addrs) == 0 {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+	if !opt.Remove {
+		switch e.state {
+		case stateInitial:
+			return e.bindLocked(opt.Addrs)
+		case stateClosed:
+			return &tcpip.ErrInvalidEndpointState{}
+		}
+		if len(e.localAddrs) == 0 {
+			// The endpoint is already bound to every address.
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		for _, addr := range opt.Addrs {
+			if addr.Port != 0 && addr.Port != e.localPort {
+				return &tcpip.ErrInvalidOptionValue{}
+			}
+			addr.Port = e.localPort
+			if _, err := e.bindAddrLocked(addr, true /* specific */); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if e.state == stateInitial || e.state == stateClosed {
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+	for _, addr := range opt.Addrs {
+		addr, _, err := e.checkV4MappedLocked(addr, true /* bind */)
+		if err != nil {
+			return err
+		}
+		if addr.Port != 0 && addr.Port != e.localPort {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		i := slices.IndexFunc(e.bindings, func(b binding) bool {
+			return b.reserved && b.id.LocalAddress == addr.Addr
+		})
+		if i < 0 || addr.Addr.Unspecified() {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		if len(e.localAddrs) == 1 {
+			// The last address can't be removed.
+			return &tcpip.ErrInvalidEndpointState{}
+		}
+		e.unregisterLocked(e.bindings[i])
+		e.bindings = slices.Delete(e.bindings, i, i+1)
+		e.localAddrs = slices.DeleteFunc(e.localAddrs, func(a tcpip.Address) bool {
+			return a == addr.Addr
+		})
+	}
+	return nil
+}
+
+// addAssocLocked adds a to the associations of e. Endpoints that don't own
+// a port register themselves for the addresses of the peer.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) addAssocLocked(a *association) {
+	e.assocs[a.id] = a
+	for _, p := range a.paths {
+		e.addPeerLocked(a, p.addr)
+	}
+}
+
+// addPeerLocked indexes a by the peer address addr.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) addPeerLocked(a *association, addr tcpip.Address) {
+	key := peerKey{addr: addr, port: a.peerPort}
+	if _, ok := e.peers[key]; ok {
+		return
+	}
+	e.peers[key] = a
+	if e.ownsPortLocked() {
+		return
+	}
+	netProto := netProtoOf(addr)
+	b := binding{
+		netProtos: []tcpip.NetworkProtocolNumber{netProto},
+		id: stack.TransportEndpointID{
+			LocalPort:     e.localPort,
+			RemotePort:    a.peerPort,
+			RemoteAddress: addr,
+		},
+	}
+	if err := e.stack.RegisterTransportEndpoint(b.netProtos, ProtocolNumber, b.id, e, e.portFlags, e.bindToDevice); err != nil {
+		// Packets from this address keep reaching the parent, which
+		// forwards them.
+		return
+	}
+	e.bindings = append(e.bindings, b)
+}
+
+// ownsPortLocked returns true if e holds a reservation for its port, as
+// opposed to sharing the port of a parent endpoint.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) ownsPortLocked() bool {
+	for _, b := range e.bindings {
+		if b.reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// removeAssocLocked removes a from the associations of e.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) removeAssocLocked(a *association) {
+	delete(e.assocs, a.id)
+	for key, pa := range e.peers {
+		if pa != a {
+			continue
+		}
+		delete(e.peers, key)
+		if i := slices.IndexFunc(e.bindings, func(b binding) bool {
+			return !b.reserved && b.id.RemoteAddress == key.addr && b.id.RemotePort == key.port
+		}); i >= 0 {
+			e.unregisterLocked(e.bindings[i])
+			e.bindings = slices.Delete(e.bindings, i, i+1)
+		}
+	}
+	e.maybeCleanupLocked()
+}
+
+func netProtoOf(addr tcpip.Address) tcpip.NetworkProtocolNumber {
+	if addr.Len() == header.IPv4AddressSize {
+		return header.IPv4ProtocolNumber
+	}
+	return header.IPv6ProtocolNumber
+}
+
+// GetLocalAddress implements tcpip.Endpoint.GetLocalAddress.
+func (e *endpoint) GetLocalAddress() (tcpip.FullAddress, tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	addr := tcpip.FullAddress{
+		NIC:  e.bindToDevice,
+		Port: e.localPort,
+	}
+	switch {
+	case len(e.localAddrs) != 0:
+		addr.Addr = e.localAddrs[0]
+	case !e.oneToMany:
+		if a := e.oneToOneAssoc(); a != nil {
+			addr.Addr = a.localAddr
+		}
+	}
+	return addr, nil
+}
+
+// GetRemoteAddress implements tcpip.Endpoint.GetRemoteAddress.
+func (e *endpoint) GetRemoteAddress() (tcpip.FullAddress, tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.oneToMany {
+		return tcpip.FullAddress{}, &tcpip.ErrNotConnected{}
+	}
+	a := e.oneToOneAssoc()
+	if a == nil || a.primary == nil {
+		return tcpip.FullAddress{}, &tcpip.ErrNotConnected{}
+	}
+	return tcpip.FullAddress{Addr: a.primary.addr, Port: a.peerPort}, nil
+}
+
+// Readiness returns the current readiness of the endpoint. For example, if
+// waiter.EventIn is set, the endpoint is immediately readable.
+func (e *endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var result waiter.EventMask
+	if e.state == stateListen && !e.oneToMany {
+		if len(e.acceptQueue) != 0 {
+			result |= waiter.ReadableEvents
+		}
+		return result & mask
+	}
+
+	if !e.rcvList.Empty() || (!e.oneToMany && e.rcvShutdown) {
+		result |= waiter.ReadableEvents
+	}
+	hasSpace := e.sndBufUsed < int(e.ops.GetSendBufferSize())
+	switch {
+	case e.oneToMany:
+		if hasSpace {
+			result |= waiter.WritableEvents
+		}
+	case e.state == stateConnected:
+		if hasSpace || e.sndShutdown {
+			result |= waiter.WritableEvents
+		}
+	case e.state == stateClosed:
+		result |= waiter.WritableEvents | waiter.EventHUp
+		if e.hardError != nil {
+			result |= waiter.EventErr
+		}
+	}
+	if !e.oneToMany && e.rcvShutdown && e.sndShutdown {
+		result |= waiter.EventHUp
+	}
+
+	e.lastErrorMu.Lock()
+	if e.lastError != nil {
+		result |= waiter.EventErr
+	}
+	e.lastErrorMu.Unlock()
+	return result & mask
+}
+
+// HandlePacket is called by the stack when new packets arrive to this
+// transport endpoint.
+func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketBuffer) {
+	s, ok := newSegment(id, pkt)
+	if !ok {
+		e.stats.ReceiveErrors.MalformedPacketsReceived.Increment()
+		return
+	}
+	e.stats.PacketsReceived.Increment()
+	e.enqueue(s)
+}
+
+// enqueue queues s for processing, starting a processing goroutine if none
+// is running.
+func (e *endpoint) enqueue(s *segment) {
+	e.pktMu.Lock()
+	if e.frozen {
+		e.pktMu.Unlock()
+		return
+	}
+	e.pktQueue.PushBack(s)
+	start := !e.processing
+	e.processing = true
+	e.pktMu.Unlock()
+
+	if start {
+		go e.processPackets() // S/R-SAFE: the queue is drained before save.
+	}
+}
+
+// processPackets handles queued packets until the queue is empty.
+func (e *endpoint) processPackets() {
+	for {
+		e.pktMu.Lock()
+		s := e.pktQueue.Front()
+		if s == nil {
+			e.processing = false
+			e.pktMu.Unlock()
+			return
+		}
+		e.pktQueue.Remove(s)
+		e.pktMu.Unlock()
+
+		e.mu.Lock()
+		e.handleSegmentLocked(s)
+		e.unlockAndNotify()
+	}
+}
+
+// handleSegmentLocked dispatches a received packet to its association.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) handleSegmentLocked(s *segment) {
+	key := s.remote()
+	if a, ok := e.peers[key]; ok {
+		a.handleSegmentLocked(s)
+		return
+	}
+	if n, ok := e.forward[key]; ok {
+		if !n.dead.Load() {
+			n.enqueue(s)
+			return
+		}
+		delete(e.forward, key)
+	}
+
+	// The packet doesn't belong to any association.
+	listening := e.state == stateListen && !e.userClosed
+	switch c := s.chunks[0]; c.Type() {
+	case header.SCTPChunkInit:
+		if !listening {
+			e.protocol.handleOOTB(s)
+			return
+		}
+		if s.vtag != 0 || len(s.chunks) != 1 {
+			return
+		}
+		e.handleInitLocked(s, c, nil /* a */)
+	case header.SCTPChunkCookieEcho:
+		if !listening {
+			e.protocol.handleOOTB(s)
+			return
+		}
+		e.handleCookieEchoLocked(s, nil /* a */)
+	default:
+		e.protocol.handleOOTB(s)
+	}
+}
+
+// HandleError implements stack.TransportEndpoint.HandleError. Path failures
+// are detected by retransmission timeouts and heartbeats instead.
+func (*endpoint) HandleError(stack.TransportError, *stack.PacketBuffer) {}
+
+// State implements tcpip.Endpoint.State.
+func (e *endpoint) State() uint32 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return uint32(e.state)
+}
+
+// Info returns a copy of the endpoint info.
+func (e *endpoint) Info() tcpip.EndpointInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	info := stack.TransportEndpointInfo{
+		NetProto:   e.netProto,
+		TransProto: ProtocolNumber,
+		ID: stack.TransportEndpointID{
+			LocalPort: e.localPort,
+		},
+		BindNICID: e.bindToDevice,
+	}
+	if len(e.localAddrs) != 0 {
+		info.ID.LocalAddress = e.localAddrs[0]
+		info.BindAddr = e.localAddrs[0]
+	}
+	if !e.oneToMany {
+		if a := e.oneToOneAssoc(); a != nil && a.primary != nil {
+			info.ID.LocalAddress = a.localAddr
+			info.ID.RemoteAddress = a.primary.addr
+			info.ID.RemotePort = a.peerPort
+		}
+	}
+	return &info
+}
+
+// Stats returns a pointer to the endpoint stats.
+func (e *endpoint) Stats() tcpip.EndpointStats {
+	return &e.stats
+}
+
+// Wait implements stack.TransportEndpoint.Wait.
+func (*endpoint) Wait() {}
+
+// SetOwner implements tcpip.Endpoint.SetOwner.
+func (e *endpoint) SetOwner(owner tcpip.PacketOwner) {
+	e.mu.Lock()
+	e.owner = owner
+	e.mu.Unlock()
+}
+
+// SocketOptions implements tcpip.Endpoint.SocketOptions.
+func (e *endpoint) SocketOptions() *tcpip.SocketOptions {
+	return &e.ops
+}
+
+// freeze prevents any more packets from being delivered to the endpoint.
+func (e *endpoint) freeze() {
+	e.pktMu.Lock()
+	e.frozen = true
+	e.pktMu.Unlock()
+}
+
+// thaw unfreezes a previously frozen endpoint using endpoint.freeze() allows
+// new packets to be delivered again. Packets that were queued when the
+// endpoint was saved are processed.
+func (e *endpoint) thaw() {
+	e.pktMu.Lock()
+	e.frozen = false
+	start := !e.processing && !e.pktQueue.Empty()
+	e.processing = e.processing || start
+	e.pktMu.Unlock()
+
+	if start {
+		go e.processPackets() // S/R-SAFE: the endpoint is not frozen.
+	}
+}
+
+// HasNIC returns true if the NICID is defined in the stack or id is 0.
+func (e *endpoint) HasNIC(id int32) bool {
+	return id == 0 || e.stack.HasNIC(tcpip.NICID(id))
+}
+
+// assocForOptLocked returns the association that an option with the given
+// association ID applies to. One-to-one endpoints ignore the ID.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) assocForOptLocked(id tcpip.SCTPAssocID) (*association, tcpip.Error) {
+	if !e.oneToMany {
+		if a := e.oneToOneAssoc(); a != nil {
+			return a, nil
+		}
+		return nil, &tcpip.ErrNotConnected{}
+	}
+	if a, ok := e.assocs[id]; ok {
+		return a, nil
+	}
+	return nil, &tcpip.ErrInvalidOptionValue{}
+}
+
+// SetSockOptInt implements tcpip.Endpoint.SetSockOptInt.
+func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	switch opt {
+	case tcpip.SCTPNoDelayOption:
+		e.nodelay = v != 0
+		for _, a := range e.assocs {
+			a.transmitLocked()
+		}
+
+	case tcpip.SCTPAutocloseOption:
+		if !e.oneToMany {
+			return &tcpip.ErrNotSupported{}
+		}
+		if v < 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.autoclose = time.Duration(v) * time.Second
+		for _, a := range e.assocs {
+			a.resetAutocloseLocked()
+		}
+
+	case tcpip.SCTPMaxSegOption:
+		// The smallest value matches the minimum IPv6 MTU, as in Linux.
+		if v != 0 && (v < 512 || v > 0xffff) {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.maxSeg = v
+
+	case tcpip.SCTPDisableFragmentsOption:
+		e.disableFragments = v != 0
+
+	case tcpip.SCTPRecvRcvInfoOption:
+		e.recvRcvInfo = v != 0
+
+	default:
+		return &tcpip.ErrUnknownProtocolOption{}
+	}
+	return nil
+}
+
+// GetSockOptInt implements tcpip.Endpoint.GetSockOptInt.
+func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch opt {
+	case tcpip.ReceiveQueueSizeOption:
+		return e.rcvBufUsed, nil
+
+	case tcpip.SendQueueSizeOption:
+		return e.sndBufUsed, nil
+
+	case tcpip.SCTPNoDelayOption:
+		return boolToInt(e.nodelay), nil
+
+	case tcpip.SCTPAutocloseOption:
+		if !e.oneToMany {
+			return -1, &tcpip.ErrNotSupported{}
+		}
+		return int(e.autoclose / time.Second), nil
+
+	case tcpip.SCTPMaxSegOption:
+		if e.maxSeg != 0 {
+			return e.maxSeg, nil
+		}
+		if a := e.oneToOneAssoc(); a != nil && !e.oneToMany {
+			return a.fragPointLocked(), nil
+		}
+		return 0, nil
+
+	case tcpip.SCTPDisableFragmentsOption:
+		return boolToInt(e.disableFragments), nil
+
+	case tcpip.SCTPRecvRcvInfoOption:
+		return boolToInt(e.recvRcvInfo), nil
+
+	default:
+		return -1, &tcpip.ErrUnknownProtocolOption{}
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// SetSockOpt implements tcpip.Endpoint.SetSockOpt.
+func (e *endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	switch o := opt.(type) {
+	case *tcpip.SCTPEventsOption:
+		e.events = *o
+
+	case *tcpip.SCTPInitMsgOption:
+		// As in Linux, zero fields leave the current settings unchanged.
+		if o.NumOStreams != 0 {
+			e.initMsg.NumOStreams = o.NumOStreams
+		}
+		if o.MaxInStreams != 0 {
+			e.initMsg.MaxInStreams = o.MaxInStreams
+		}
+		if o.MaxAttempts != 0 {
+			e.initMsg.MaxAttempts = o.MaxAttempts
+		}
+		if o.MaxInitTimeout != 0 {
+			e.initMsg.MaxInitTimeout = o.MaxInitTimeout
+		}
+
+	case *tcpip.SCTPRTOInfoOption:
+		initial, rtoMin, rtoMax := e.rtoInitial, e.rtoMin, e.rtoMax
+		var a *association
+		if o.AssocID != 0 || !e.oneToMany {
+			var err tcpip.Error
+			if a, err = e.assocForOptLocked(o.AssocID); err != nil && e.oneToMany {
+				return err
+			}
+			if a != nil {
+				initial, rtoMin, rtoMax = a.rtoInitial, a.rtoMin, a.rtoMax
+			}
+		}
+		if o.Initial != 0 {
+			initial = o.Initial
+		}
+		if o.Min != 0 {
+			rtoMin = o.Min
+		}
+		if o.Max != 0 {
+			rtoMax = o.Max
+		}
+		if rtoMin > rtoMax || initial < rtoMin || initial > rtoMax {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		if a != nil {
+			a.rtoInitial, a.rtoMin, a.rtoMax = initial, rtoMin, rtoMax
+		} else {
+			e.rtoInitial, e.rtoMin, e.rtoMax = initial, rtoMin, rtoMax
+		}
+
+	case *tcpip.SCTPAssocInfoOption:
+		var a *association
+		if o.AssocID != 0 || !e.oneToMany {
+			var err tcpip.Error
+			if a, err = e.assocForOptLocked(o.AssocID); err != nil && e.oneToMany {
+				return err
+			}
+		}
+		if o.MaxRetrans != 0 {
+			if a != nil {
+				a.maxRetrans = int(o.MaxRetrans)
+			} else {
+				e.assocMaxRetrans = int(o.MaxRetrans)
+			}
+		}
+		if o.CookieLife != 0 {
+			e.cookieLife = o.CookieLife
+		}
+
+	case *tcpip.SCTPDefaultSndInfoOption:
+		if e.oneToMany && o.AssocID != 0 {
+			if _, ok := e.assocs[o.AssocID]; !ok {
+				return &tcpip.ErrInvalidOptionValue{}
+			}
+		}
+		e.defaultSndInfo = tcpip.SCTPSndInfo(*o)
+		e.defaultSndInfo.AssocID = 0
+
+	case *tcpip.SCTPPrimaryAddrOption:
+		a, err := e.assocForOptLocked(o.AssocID)
+		if err != nil {
+			return err
+		}
+		addr, _, err := e.checkV4MappedLocked(o.Addr, false /* bind */)
+		if err != nil {
+			return err
+		}
+		p := a.pathFor(addr.Addr)
+		if p == nil {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		a.primary = p
+
+	case *tcpip.SCTPBindxOption:
+		return e.bindxLocked(o)
+
+	case *tcpip.SCTPConnectxOption:
+		return e.connectUserLocked(o.Addrs, &o.AssocID)
+
+	default:
+		return nil
+	}
+	return nil
+}
+
+// GetSockOpt implements tcpip.Endpoint.GetSockOpt.
+func (e *endpoint) GetSockOpt(opt tcpip.GettableSocketOption) tcpip.Error {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	switch o := opt.(type) {
+	case *tcpip.SCTPEventsOption:
+		*o = e.events
+
+	case *tcpip.SCTPInitMsgOption:
+		*o = e.initMsg
+
+	case *tcpip.SCTPRTOInfoOption:
+		o.Initial, o.Min, o.Max = e.rtoInitial, e.rtoMin, e.rtoMax
+		if o.AssocID != 0 || !e.oneToMany {
+			a, err := e.assocForOptLocked(o.AssocID)
+			if err != nil && e.oneToMany {
+				return err
+			}
+			if a != nil {
+				o.Initial, o.Min, o.Max = a.rtoInitial, a.rtoMin, a.rtoMax
+			}
+		}
+
+	case *tcpip.SCTPAssocInfoOption:
+		o.MaxRetrans = uint16(e.assocMaxRetrans)
+		o.CookieLife = e.cookieLife
+		o.LocalRwnd = uint32(e.ops.GetReceiveBufferSize())
+		if o.AssocID != 0 || !e.oneToMany {
+			a, err := e.assocForOptLocked(o.AssocID)
+			if err != nil && e.oneToMany {
+				return err
+			}
+			if a != nil {
+				o.MaxRetrans = uint16(a.maxRetrans)
+				o.PeerDestinations = uint16(len(a.paths))
+				o.PeerRwnd = a.peerRwnd
+				o.LocalRwnd = a.rwndLocked()
+			}
+		}
+
+	case *tcpip.SCTPDefaultSndInfoOption:
+		*o = tcpip.SCTPDefaultSndInfoOption(e.defaultSndInfo)
+
+	case *tcpip.SCTPPrimaryAddrOption:
+		a, err := e.assocForOptLocked(o.AssocID)
+		if err != nil {
+			return err
+		}
+		o.Addr = tcpip.FullAddress{Addr: a.primary.addr, Port: a.peerPort}
+
+	case *tcpip.SCTPStatusOption:
+		a, err := e.assocForOptLocked(o.AssocID)
+		if err != nil {
+			return err
+		}
+		unacked := 0
+		for _, c := range a.sendQ {
+			if c.sent && !c.acked {
+				unacked++
+			}
+		}
+		*o = tcpip.SCTPStatusOption{
+			AssocID:            a.id,
+			State:              int32(a.state),
+			Rwnd:               a.peerRwnd,
+			UnackedData:        uint16(min(unacked, 0xffff)),
+			PendingData:        uint16(min(len(a.sendQ)-unacked, 0xffff)),
+			InStreams:          a.inStreams,
+			OutStreams:         a.outStreams,
+			FragmentationPoint: uint32(a.fragPointLocked()),
+			Primary:            a.peerAddrInfo(a.primary),
+		}
+
+	case *tcpip.SCTPPeerAddrsOption:
+		a, err := e.assocForOptLocked(o.AssocID)
+		if err != nil {
+			return err
+		}
+		o.Addrs = o.Addrs[:0]
+		for _, p := range a.paths {
+			o.Addrs = append(o.Addrs, tcpip.FullAddress{Addr: p.addr, Port: a.peerPort})
+		}
+
+	case *tcpip.SCTPLocalAddrsOption:
+		var a *association
+		if o.AssocID != 0 || !e.oneToMany {
+			a, _ = e.assocForOptLocked(o.AssocID)
+		}
+		o.Addrs = o.Addrs[:0]
+		for _, addr := range e.localAddrsLocked(a) {
+			o.Addrs = append(o.Addrs, tcpip.FullAddress{Addr: addr, Port: e.localPort})
+		}
+
+	case *tcpip.SCTPAssocIDListOption:
+		if !e.oneToMany {
+			return &tcpip.ErrNotSupported{}
+		}
+		*o = (*o)[:0]
+		for _, a := range e.assocList() {
+			*o = append(*o, a.id)
+		}
+
+	case *tcpip.SCTPPeeloffOption:
+		return e.peeloffLocked(o)
+
+	default:
+		return &tcpip.ErrUnknownProtocolOption{}
+	}
+	return nil
+}
+
+// peerAddrInfo describes p.
+func (a *association) peerAddrInfo(p *path) tcpip.SCTPPeerAddrInfo {
+	return tcpip.SCTPPeerAddrInfo{
+		AssocID: a.id,
+		Addr:    tcpip.FullAddress{Addr: p.addr, Port: a.peerPort},
+		Active:  p.active,
+		Cwnd:    uint32(p.cwnd),
+		SRTT:    p.srtt,
+		RTO:     p.rto,
+		MTU:     uint32(p.mtu),
+	}
+}
+
+// localAddrsLocked returns the local addresses of e, or those used by a if it
+// is not nil. An endpoint bound to the wildcard address uses every address
+// of the stack.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) localAddrsLocked(a *association) []tcpip.Address {
+	if len(e.localAddrs) != 0 {
+		return e.localAddrs
+	}
+	if a != nil && a.localAddr.BitLen() != 0 {
+		return []tcpip.Address{a.localAddr}
+	}
+	if e.state == stateInitial {
+		return nil
+	}
+	var addrs []tcpip.Address
+	for _, nicAddrs := range e.stack.AllAddresses() {
+		for _, pa := range nicAddrs {
+			switch pa.Protocol {
+			case header.IPv4ProtocolNumber:
+				if e.netProto == header.IPv6ProtocolNumber && e.ops.GetV6Only() {
+					continue
+				}
+			case header.IPv6ProtocolNumber:
+				if e.netProto != header.IPv6ProtocolNumber {
+					continue
+				}
+			default:
+				continue
+			}
+			addrs = append(addrs, pa.AddressWithPrefix.Address)
+		}
+	}
+	slices.SortFunc(addrs, func(a, b tcpip.Address) int {
+		return bytes.Compare(a.AsSlice(), b.AsSlice())
+	})
+	return addrs
+}
+
+// peeloffLocked branches the association identified by opt.AssocID off into
+// a new one-to-one endpoint.
+//
+// Precondition: e.mu must be held.
+func (e *endpoint) peeloffLocked(opt *tcpip.SCTPPeeloffOption) tcpip.Error {
+	if !e.oneToMany {
+		return &tcpip.ErrNotSupported{}
+	}
+	a, ok := e.assocs[opt.AssocID]
+	if !ok {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+
+	n := e.newChildLocked(opt.WaiterQueue)
+	n.mu.Lock()
+	e.removeAssocLocked(a)
+	a.setEndpoint(n)
+	n.addAssocLocked(a)
+	if a.state < assocEstablished {
+		n.state = stateConnecting
+		n.connectNotified = false
+	}
+	n.rcvShutdown = a.peerShutdown
+	for _, p := range a.paths {
+		e.forward[peerKey{addr: p.addr, port: a.peerPort}] = n
+	}
+
+	// Data that was received on the association and not read yet moves
+	// along with it.
+	for m := e.rcvList.Front(); m != nil; {
+		next := m.Next()
+		if !m.notification && m.info.AssocID == a.id {
+			e.rcvList.Remove(m)
+			e.rcvBufUsed -= len(m.data)
+			n.rcvList.PushBack(m)
+			n.rcvBufUsed += len(m.data)
+		}
+		m = next
+	}
+	e.sndBufUsed -= a.queuedBytes
+	n.sndBufUsed += a.queuedBytes
+	if a.autocloseTimer.armed {
+		a.autocloseTimer.stop()
+	}
+	e.notify(waiter.WritableEvents)
+	n.unlockAndNotify()
+
+	opt.Endpoint = n
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"context"
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/ports"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// afterLoad is invoked by stateify.
+func (e *endpoint) afterLoad(ctx context.Context) {
+	stack.RestoreStackFromContext(ctx).RegisterRestoredEndpoint(e)
+}
+
+// beforeSave is invoked by stateify.
+func (e *endpoint) beforeSave() {
+	e.freeze()
+	e.stack.RegisterResumableEndpoint(e)
+}
+
+// Restore implements tcpip.RestoredEndpoint.Restore.
+func (e *endpoint) Restore(s *stack.Stack) {
+	e.mu.Lock()
+	defer e.unlockAndNotify()
+
+	e.stack = s
+	e.ops.InitHandler(e, e.stack, tcpip.GetStackSendBufferLimits, tcpip.GetStackReceiveBufferLimits)
+
+	// Our saved state holds the bindings, but neither the port reservations
+	// nor the registrations with the stack.
+	for _, b := range e.bindings {
+		if b.reserved {
+			if _, err := e.stack.ReservePort(e.stack.SecureRNG(), ports.Reservation{
+				Networks:     b.netProtos,
+				Transport:    ProtocolNumber,
+				Addr:         b.id.LocalAddress,
+				Port:         b.id.LocalPort,
+				Flags:        e.portFlags,
+				BindToDevice: e.bindToDevice,
+			}, nil /* testPort */); err != nil {
+				panic(fmt.Sprintf("unable to re-reserve port %d: %s", b.id.LocalPort, err))
+			}
+		}
+		if err := e.stack.RegisterTransportEndpoint(b.netProtos, ProtocolNumber, b.id, e, e.portFlags, e.bindToDevice); err != nil {
+			panic(fmt.Sprintf("unable to re-register endpoint %+v: %s", b.id, err))
+		}
+	}
+	for _, a := range e.assocs {
+		a.restoreTimersLocked()
+	}
+	e.thaw()
+}
+
+// Resume implements tcpip.ResumableEndpoint.Resume.
+func (e *endpoint) Resume() {
+	e.thaw()
+}
+
+// restoreTimersLocked rearms the timers that were running when a was saved.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) restoreTimersLocked() {
+	if a.t1.armed {
+		a.armLocked(&a.t1, a.t1RTO, a.onT1ExpiredLocked)
+	}
+	if a.t2.armed {
+		a.armLocked(&a.t2, a.activePath().rto, a.onT2ExpiredLocked)
+	}
+	if a.t3.armed {
+		a.armLocked(&a.t3, a.activePath().rto, a.onT3ExpiredLocked)
+	}
+	if a.autocloseTimer.armed {
+		a.autocloseTimer.armed = false
+		a.resetAutocloseLocked()
+	}
+	for _, p := range a.paths {
+		if p.hbTimer.armed {
+			a.armHeartbeatLocked(p)
+		}
+	}
+}
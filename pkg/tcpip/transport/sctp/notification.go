@@ -0,0 +1,119 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+// Notification types, as per RFC 6458 section 6.1. Notification type
+// 0x8000+i is enabled by bit i of tcpip.SCTPEventsOption.
+const (
+	notifyAssocChange    = 0x8001
+	notifyPeerAddrChange = 0x8002
+	notifyShutdownEvent  = 0x8005
+)
+
+// States reported by SCTP_ASSOC_CHANGE notifications.
+const (
+	assocChangeCommUp       = 0
+	assocChangeCommLost     = 1
+	assocChangeRestart      = 2
+	assocChangeShutdownComp = 3
+	assocChangeCantStrAssoc = 4
+)
+
+// States reported by SCTP_PEER_ADDR_CHANGE notifications.
+const (
+	addrAvailable   = 0
+	addrUnreachable = 1
+)
+
+const (
+	// assocChangeSize is sizeof(struct sctp_assoc_change).
+	assocChangeSize = 20
+
+	// peerAddrChangeSize is sizeof(struct sctp_paddr_change).
+	peerAddrChangeSize = 148
+
+	// shutdownEventSize is sizeof(struct sctp_shutdown_event).
+	shutdownEventSize = 12
+
+	// sockaddrStorageSize is sizeof(struct sockaddr_storage).
+	sockaddrStorageSize = 128
+)
+
+// Socket address families, as used by struct sockaddr.
+const (
+	afInet  = 2
+	afInet6 = 10
+)
+
+// Notifications are laid out in host byte order, like the C structures that
+// they represent.
+
+func notificationHeader(b []byte, typ uint16) {
+	binary.NativeEndian.PutUint16(b[0:], typ)
+	binary.NativeEndian.PutUint16(b[2:], 0)
+	binary.NativeEndian.PutUint32(b[4:], uint32(len(b)))
+}
+
+// newAssocChange returns an SCTP_ASSOC_CHANGE notification.
+func newAssocChange(state, errCode, outStreams, inStreams uint16, id tcpip.SCTPAssocID) []byte {
+	b := make([]byte, assocChangeSize)
+	notificationHeader(b, notifyAssocChange)
+	binary.NativeEndian.PutUint16(b[8:], state)
+	binary.NativeEndian.PutUint16(b[10:], errCode)
+	binary.NativeEndian.PutUint16(b[12:], outStreams)
+	binary.NativeEndian.PutUint16(b[14:], inStreams)
+	binary.NativeEndian.PutUint32(b[16:], uint32(id))
+	return b
+}
+
+// newPeerAddrChange returns an SCTP_PEER_ADDR_CHANGE notification.
+func newPeerAddrChange(addr tcpip.FullAddress, state int32, id tcpip.SCTPAssocID) []byte {
+	b := make([]byte, peerAddrChangeSize)
+	notificationHeader(b, notifyPeerAddrChange)
+	encodeSockaddr(b[8:8+sockaddrStorageSize], addr)
+	binary.NativeEndian.PutUint32(b[136:], uint32(state))
+	binary.NativeEndian.PutUint32(b[140:], 0)
+	binary.NativeEndian.PutUint32(b[144:], uint32(id))
+	return b
+}
+
+// newShutdownEvent returns an SCTP_SHUTDOWN_EVENT notification.
+func newShutdownEvent(id tcpip.SCTPAssocID) []byte {
+	b := make([]byte, shutdownEventSize)
+	notificationHeader(b, notifyShutdownEvent)
+	binary.NativeEndian.PutUint32(b[8:], uint32(id))
+	return b
+}
+
+// encodeSockaddr encodes addr as a struct sockaddr_in or sockaddr_in6 into
+// b.
+func encodeSockaddr(b []byte, addr tcpip.FullAddress) {
+	if addr.Addr.Len() == header.IPv4AddressSize {
+		binary.NativeEndian.PutUint16(b[0:], afInet)
+		binary.BigEndian.PutUint16(b[2:], addr.Port)
+		copy(b[4:], addr.Addr.AsSlice())
+		return
+	}
+	binary.NativeEndian.PutUint16(b[0:], afInet6)
+	binary.BigEndian.PutUint16(b[2:], addr.Port)
+	copy(b[8:], addr.Addr.AsSlice())
+}
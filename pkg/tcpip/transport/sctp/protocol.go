@@ -0,0 +1,259 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sctp contains the implementation of the SCTP transport protocol
+// (RFC 4960).
+//
+// Both socket styles of RFC 6458 are supported: one-to-one endpoints
+// (SOCK_STREAM) carry a single association, while one-to-many endpoints
+// (SOCK_SEQPACKET) carry any number of associations, each identified by an
+// association ID.
+package sctp
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/header/parse"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/raw"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	// ProtocolNumber is the sctp protocol number.
+	ProtocolNumber = header.SCTPProtocolNumber
+
+	// DefaultSendBufferSize is the default size of the send buffer for an
+	// endpoint.
+	DefaultSendBufferSize = 208 << 10 // 208KiB
+
+	// DefaultReceiveBufferSize is the default size of the receive buffer
+	// for an endpoint.
+	DefaultReceiveBufferSize = 208 << 10 // 208KiB
+)
+
+// Protocol parameters, as per RFC 4960 section 15 and the defaults of
+// Linux's net.sctp sysctls.
+const (
+	defaultRTOInitial      = 3 * time.Second
+	defaultRTOMin          = 1 * time.Second
+	defaultRTOMax          = 60 * time.Second
+	defaultMaxInitAttempts = 8
+	defaultAssocMaxRetrans = 10
+	defaultPathMaxRetrans  = 5
+	defaultCookieLife      = 60 * time.Second
+	defaultHBInterval      = 30 * time.Second
+	defaultOutStreams      = 10
+	defaultMaxInStreams    = 65535
+
+	// minAssocID is the first association ID handed out. Lower values are
+	// reserved for SCTP_FUTURE_ASSOC, SCTP_CURRENT_ASSOC and SCTP_ALL_ASSOC.
+	minAssocID = 3
+)
+
+// +stateify savable
+type protocol struct {
+	stack *stack.Stack
+
+	// secret is the key used to sign state cookies. It is immutable.
+	secret [32]byte
+
+	// nextAssocID is the next association ID to hand out.
+	nextAssocID atomicbitops.Int32
+}
+
+// Number returns the sctp protocol number.
+func (*protocol) Number() tcpip.TransportProtocolNumber {
+	return ProtocolNumber
+}
+
+// NewEndpoint creates a new one-to-one sctp endpoint.
+func (p *protocol) NewEndpoint(netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
+	return newEndpoint(p, netProto, waiterQueue, false /* oneToMany */), nil
+}
+
+// NewOneToManyEndpoint creates a new one-to-many (SOCK_SEQPACKET) sctp
+// endpoint on s.
+func NewOneToManyEndpoint(s *stack.Stack, netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
+	p, ok := s.TransportProtocolInstance(ProtocolNumber).(*protocol)
+	if !ok {
+		return nil, &tcpip.ErrUnknownProtocol{}
+	}
+	if !s.CheckNetworkProtocol(netProto) {
+		return nil, &tcpip.ErrUnknownProtocol{}
+	}
+	return newEndpoint(p, netProto, waiterQueue, true /* oneToMany */), nil
+}
+
+// NewRawEndpoint creates a new raw SCTP endpoint. It implements
+// stack.TransportProtocol.NewRawEndpoint.
+func (p *protocol) NewRawEndpoint(netProto tcpip.NetworkProtocolNumber, waiterQueue *waiter.Queue) (tcpip.Endpoint, tcpip.Error) {
+	return raw.NewEndpoint(p.stack, netProto, header.SCTPProtocolNumber, waiterQueue)
+}
+
+// MinimumPacketSize returns the minimum valid sctp packet size.
+func (*protocol) MinimumPacketSize() int {
+	return header.SCTPMinimumSize
+}
+
+// ParsePorts returns the source and destination ports stored in the given
+// sctp packet.
+func (*protocol) ParsePorts(v []byte) (src, dst uint16, err tcpip.Error) {
+	h := header.SCTP(v)
+	return h.SourcePort(), h.DestinationPort(), nil
+}
+
+// HandleUnknownDestinationPacket handles packets that are targeted at this
+// protocol but don't match any existing endpoint. These are "out of the blue"
+// packets, which are answered as per RFC 4960 section 8.4.
+func (p *protocol) HandleUnknownDestinationPacket(id stack.TransportEndpointID, pkt *stack.PacketBuffer) stack.UnknownDestinationPacketDisposition {
+	s, ok := newSegment(id, pkt)
+	if !ok {
+		return stack.UnknownDestinationPacketMalformed
+	}
+	p.handleOOTB(s)
+	return stack.UnknownDestinationPacketHandled
+}
+
+// handleOOTB responds to an out of the blue packet.
+func (p *protocol) handleOOTB(s *segment) {
+	var (
+		vtag  = s.vtag
+		reply = header.SCTPChunkAbort
+	)
+	for _, c := range s.chunks {
+		switch c.Type() {
+		case header.SCTPChunkAbort, header.SCTPChunkShutdownComplete, header.SCTPChunkCookieAck:
+			return
+		case header.SCTPChunkError:
+			// Only stale cookie errors must be ignored, but there is
+			// nothing to report on an error for an unknown association
+			// either.
+			return
+		case header.SCTPChunkInit:
+			if len(c.Value()) < header.SCTPInitHeaderSize {
+				return
+			}
+			// Answer with the initiate tag of the INIT, as there is no
+			// verification tag to reflect.
+			vtag = header.SCTPInit(c.Value()).InitiateTag()
+			p.sendControl(s, vtag, header.NewSCTPChunk(header.SCTPChunkAbort, 0, 0))
+			return
+		case header.SCTPChunkShutdownAck:
+			reply = header.SCTPChunkShutdownComplete
+		}
+	}
+	// The verification tag of the packet is reflected, as signaled by the
+	// T bit.
+	p.sendControl(s, vtag, header.NewSCTPChunk(reply, header.SCTPFlagTBit, 0))
+}
+
+// sendControl sends a single chunk in reply to s.
+func (p *protocol) sendControl(s *segment, vtag uint32, chunk []byte) {
+	r, err := p.stack.FindRoute(s.nicID, s.id.LocalAddress, s.id.RemoteAddress, s.netProto, false /* multicastLoop */)
+	if err != nil {
+		return
+	}
+	defer r.Release()
+	_ = sendPacket(r, s.id.LocalPort, s.id.RemotePort, vtag, nil /* owner */, 0 /* mark */, chunk)
+}
+
+// sendPacket sends an SCTP packet made of chunks over r.
+func sendPacket(r *stack.Route, srcPort, dstPort uint16, vtag uint32, owner tcpip.PacketOwner, mark uint32, chunks ...[]byte) tcpip.Error {
+	size := 0
+	for _, c := range chunks {
+		size += len(c)
+	}
+	payload := make([]byte, 0, size)
+	for _, c := range chunks {
+		payload = append(payload, c...)
+	}
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.SCTPMinimumSize + int(r.MaxHeaderLength()),
+		Payload:            buffer.MakeWithData(payload),
+	})
+	defer pkt.DecRef()
+	pkt.Owner = owner
+	pkt.Mark = mark
+
+	h := header.SCTP(pkt.TransportHeader().Push(header.SCTPMinimumSize))
+	pkt.TransportProtocolNumber = ProtocolNumber
+	h.Encode(&header.SCTPFields{
+		SrcPort:         srcPort,
+		DstPort:         dstPort,
+		VerificationTag: vtag,
+	})
+	// There is no offload for CRC32c, so the checksum is always computed.
+	h.SetChecksum(h.CalculateChecksum(payload))
+
+	return r.WritePacket(stack.NetworkHeaderParams{
+		Protocol: ProtocolNumber,
+		TTL:      r.DefaultTTL(),
+		TOS:      stack.DefaultTOS,
+	}, pkt)
+}
+
+// newAssocID returns a new association ID.
+func (p *protocol) newAssocID() tcpip.SCTPAssocID {
+	for {
+		id := p.nextAssocID.Add(1)
+		if id >= minAssocID {
+			return tcpip.SCTPAssocID(id)
+		}
+		// Wrapped around; skip the reserved values.
+		p.nextAssocID.CompareAndSwap(id, minAssocID-1)
+	}
+}
+
+// SetOption implements stack.TransportProtocol.SetOption.
+func (*protocol) SetOption(tcpip.SettableTransportProtocolOption) tcpip.Error {
+	return &tcpip.ErrUnknownProtocolOption{}
+}
+
+// Option implements stack.TransportProtocol.Option.
+func (*protocol) Option(tcpip.GettableTransportProtocolOption) tcpip.Error {
+	return &tcpip.ErrUnknownProtocolOption{}
+}
+
+// Close implements stack.TransportProtocol.Close.
+func (*protocol) Close() {}
+
+// Wait implements stack.TransportProtocol.Wait.
+func (*protocol) Wait() {}
+
+// Pause implements stack.TransportProtocol.Pause.
+func (*protocol) Pause() {}
+
+// Resume implements stack.TransportProtocol.Resume.
+func (*protocol) Resume() {}
+
+// Parse implements stack.TransportProtocol.Parse.
+func (*protocol) Parse(pkt *stack.PacketBuffer) bool {
+	return parse.SCTP(pkt)
+}
+
+// NewProtocol returns an SCTP transport protocol.
+func NewProtocol(s *stack.Stack) stack.TransportProtocol {
+	p := &protocol{stack: s}
+	if _, err := s.SecureRNG().Reader.Read(p.secret[:]); err != nil {
+		panic(err)
+	}
+	p.nextAssocID.Store(minAssocID - 1)
+	return p
+}
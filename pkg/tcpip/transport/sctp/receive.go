@@ -0,0 +1,305 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"encoding/binary"
+	"slices"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+)
+
+const (
+	// maxDups is the maximum number of duplicate TSNs reported by a SACK.
+	maxDups = 16
+
+	// maxTSNGap bounds how far ahead of the cumulative TSN received data
+	// may be, which bounds the size of the gap ack blocks of a SACK.
+	maxTSNGap = 1 << 16
+)
+
+// inChunk is a received DATA chunk that is waiting for the rest of its
+// message or for the delivery of the preceding messages of its stream.
+//
+// +stateify savable
+type inChunk struct {
+	from   tcpip.Address
+	tsn    uint32
+	stream uint16
+	ssn    uint16
+	ppid   uint32
+	flags  uint8
+	data   []byte
+}
+
+// orderedKey returns the key of a message in association.ordered.
+func orderedKey(stream, ssn uint16) uint32 {
+	return uint32(stream)<<16 | uint32(ssn)
+}
+
+// rwndLocked returns the receive window advertised to the peer.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) rwndLocked() uint32 {
+	e := a.ep
+	return uint32(max(0, int(e.ops.GetReceiveBufferSize())-e.rcvBufUsed-a.rcvHeld))
+}
+
+// handleDataLocked processes a DATA chunk received over p.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleDataLocked(c header.SCTPChunk, p *path) {
+	switch a.state {
+	case assocEstablished, assocShutdownPending, assocShutdownSent:
+	default:
+		return
+	}
+	v := c.Value()
+	if len(v) < header.SCTPDataHeaderSize {
+		return
+	}
+	d := header.SCTPData(v)
+	if len(d.UserData()) == 0 {
+		cause := header.NewSCTPErrorCause(header.SCTPCauseNoUserData, binary.BigEndian.AppendUint32(nil, d.TSN()))
+		a.sendChunksLocked(p, a.peerTag, header.NewSCTPParamChunk(header.SCTPChunkAbort, 0, []header.SCTPParam{cause}))
+		a.terminateLocked(&tcpip.ErrConnectionReset{}, assocChangeCommLost)
+		return
+	}
+
+	a.sackNeeded = true
+	a.sackPath = p
+	a.resetAutocloseLocked()
+	tsn := d.TSN()
+	if _, ok := a.rcvTSNs[tsn]; ok || tsnLE(tsn, a.cumTSN) {
+		if len(a.dups) < maxDups {
+			a.dups = append(a.dups, tsn)
+		}
+		return
+	}
+	if !tsnLT(tsn, a.cumTSN+maxTSNGap) {
+		return
+	}
+	if d.StreamID() >= a.inStreams {
+		// The chunk is acknowledged but its data is discarded, as per RFC
+		// 4960 section 6.5.
+		info := binary.BigEndian.AppendUint16(nil, d.StreamID())
+		info = append(info, 0, 0)
+		cause := header.NewSCTPErrorCause(header.SCTPCauseInvalidStream, info)
+		a.sendChunksLocked(p, a.peerTag, header.NewSCTPParamChunk(header.SCTPChunkError, 0, []header.SCTPParam{cause}))
+		a.recordTSNLocked(tsn)
+		return
+	}
+	data := d.UserData()
+	if uint32(len(data)) > a.rwndLocked() && (tsn != a.cumTSN+1 || !a.ep.rcvList.Empty()) {
+		// There is no room for the data; the peer retransmits it once
+		// the window opens.
+		a.ep.stats.ReceiveErrors.ReceiveBufferOverflow.Increment()
+		return
+	}
+	a.recordTSNLocked(tsn)
+
+	ic := &inChunk{
+		from:   p.addr,
+		tsn:    tsn,
+		stream: d.StreamID(),
+		ssn:    d.SSN(),
+		ppid:   d.PPID(),
+		flags:  c.Flags(),
+		data:   slices.Clone(data),
+	}
+	const beginEnd = header.SCTPDataFlagBegin | header.SCTPDataFlagEnd
+	if ic.flags&beginEnd == beginEnd {
+		a.handleMessageLocked(ic, ic.data)
+		return
+	}
+	a.frags[tsn] = ic
+	a.rcvHeld += len(ic.data)
+	a.reassembleLocked(ic)
+}
+
+// recordTSNLocked records the receipt of tsn, advancing the cumulative TSN.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) recordTSNLocked(tsn uint32) {
+	a.rcvTSNs[tsn] = struct{}{}
+	for {
+		if _, ok := a.rcvTSNs[a.cumTSN+1]; !ok {
+			return
+		}
+		a.cumTSN++
+		delete(a.rcvTSNs, a.cumTSN)
+	}
+}
+
+// reassembleLocked checks whether the message that ic is a fragment of is
+// complete, and handles it if so. Fragments of a message carry consecutive
+// TSNs.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) reassembleLocked(ic *inChunk) {
+	first := ic
+	for first.flags&header.SCTPDataFlagBegin == 0 {
+		prev, ok := a.frags[first.tsn-1]
+		if !ok || prev.stream != ic.stream || prev.flags&header.SCTPDataFlagEnd != 0 {
+			return
+		}
+		first = prev
+	}
+	last := ic
+	size := 0
+	for t := first.tsn; ; t++ {
+		f, ok := a.frags[t]
+		if !ok || f.stream != ic.stream {
+			return
+		}
+		size += len(f.data)
+		if f.flags&header.SCTPDataFlagEnd != 0 {
+			last = f
+			break
+		}
+	}
+
+	data := make([]byte, 0, size)
+	for t := first.tsn; ; t++ {
+		f := a.frags[t]
+		delete(a.frags, t)
+		data = append(data, f.data...)
+		if f == last {
+			break
+		}
+	}
+	a.rcvHeld -= size
+	m := *first
+	m.tsn = last.tsn
+	a.handleMessageLocked(&m, data)
+}
+
+// handleMessageLocked delivers a complete message, or holds it until the
+// preceding messages of its stream are delivered.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleMessageLocked(ic *inChunk, data []byte) {
+	if ic.flags&header.SCTPDataFlagUnordered != 0 {
+		a.deliverLocked(ic, data)
+		return
+	}
+	if ic.ssn != a.inSSN[ic.stream] {
+		ic.data = data
+		a.ordered[orderedKey(ic.stream, ic.ssn)] = ic
+		a.rcvHeld += len(data)
+		return
+	}
+	a.deliverLocked(ic, data)
+	a.inSSN[ic.stream]++
+	for {
+		key := orderedKey(ic.stream, a.inSSN[ic.stream])
+		next, ok := a.ordered[key]
+		if !ok {
+			return
+		}
+		delete(a.ordered, key)
+		a.rcvHeld -= len(next.data)
+		a.deliverLocked(next, next.data)
+		a.inSSN[ic.stream]++
+	}
+}
+
+// deliverLocked makes a message available to readers.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) deliverLocked(ic *inChunk, data []byte) {
+	var flags uint16
+	if ic.flags&header.SCTPDataFlagUnordered != 0 {
+		flags |= tcpip.SCTPFlagUnordered
+	}
+	a.ep.queueMessageLocked(&sctpMessage{
+		from: tcpip.FullAddress{Addr: ic.from, Port: a.peerPort},
+		info: tcpip.SCTPRcvInfo{
+			Stream:  ic.stream,
+			SSN:     ic.ssn,
+			Flags:   flags,
+			PPID:    ic.ppid,
+			TSN:     ic.tsn,
+			CumTSN:  a.cumTSN,
+			AssocID: a.id,
+		},
+		data: data,
+	})
+}
+
+// sackChunkLocked returns a SACK chunk reporting the received data.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) sackChunkLocked() []byte {
+	offs := make([]uint32, 0, len(a.rcvTSNs))
+	for tsn := range a.rcvTSNs {
+		offs = append(offs, tsn-a.cumTSN)
+	}
+	slices.Sort(offs)
+
+	// Keep the chunk within a minimum sized packet.
+	maxGaps := (header.IPv6MinimumMTU-header.IPv6MinimumSize-header.SCTPMinimumSize-header.SCTPChunkHeaderSize-header.SCTPSackHeaderSize)/4 - len(a.dups)
+	var gaps []header.SCTPGapBlock
+	for _, off := range offs {
+		if n := len(gaps); n != 0 && uint32(gaps[n-1].End)+1 == off {
+			gaps[n-1].End++
+			continue
+		}
+		if len(gaps) == maxGaps {
+			break
+		}
+		gaps = append(gaps, header.SCTPGapBlock{Start: uint16(off), End: uint16(off)})
+	}
+
+	a.lastRwnd = a.rwndLocked()
+	c := header.NewSCTPSackChunk(&header.SCTPSackFields{
+		CumTSNAck: a.cumTSN,
+		ARwnd:     a.lastRwnd,
+		Gaps:      gaps,
+		Dups:      a.dups,
+	})
+	a.dups = nil
+	a.sackNeeded = false
+	return c
+}
+
+// sendSackLocked sends a SACK to the source of the last DATA chunk.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) sendSackLocked() {
+	p := a.sackPath
+	if p == nil || !p.active {
+		p = a.activePath()
+	}
+	a.sendChunksLocked(p, a.peerTag, a.sackChunkLocked())
+}
+
+// maybeSendWindowUpdateLocked sends a SACK once reading opened the receive
+// window significantly, as per RFC 4960 section 6.2.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) maybeSendWindowUpdateLocked() {
+	switch a.state {
+	case assocEstablished, assocShutdownPending, assocShutdownSent:
+	default:
+		return
+	}
+	rwnd := a.rwndLocked()
+	threshold := min(uint32(a.ep.ops.GetReceiveBufferSize())/2, uint32(a.primary.mtu))
+	if rwnd > a.lastRwnd && rwnd-a.lastRwnd >= threshold {
+		a.sendSackLocked()
+	}
+}
@@ -0,0 +1,577 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/testutil"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/sctp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	nicID   = 1
+	timeout = 10 * time.Second
+)
+
+var (
+	addr1 = testutil.MustParse4("127.0.0.1")
+	addr2 = testutil.MustParse4("127.0.0.2")
+)
+
+func newStack(t *testing.T) *stack.Stack {
+	t.Helper()
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{sctp.NewProtocol},
+	})
+	t.Cleanup(s.Destroy)
+	if err := s.CreateNIC(nicID, loopback.New()); err != nil {
+		t.Fatalf("CreateNIC(%d, _): %s", nicID, err)
+	}
+	for _, addr := range []tcpip.Address{addr1, addr2} {
+		protocolAddr := tcpip.ProtocolAddress{
+			Protocol:          ipv4.ProtocolNumber,
+			AddressWithPrefix: tcpip.AddressWithPrefix{Address: addr, PrefixLen: 8},
+		}
+		if err := s.AddProtocolAddress(nicID, protocolAddr, stack.AddressProperties{}); err != nil {
+			t.Fatalf("AddProtocolAddress(%d, %+v, {}): %s", nicID, protocolAddr, err)
+		}
+	}
+	s.SetRouteTable([]tcpip.Route{{
+		Destination: testutil.MustParseSubnet4("127.0.0.0/8"),
+		NIC:         nicID,
+	}})
+	return s
+}
+
+type testEndpoint struct {
+	tcpip.Endpoint
+	wq *waiter.Queue
+}
+
+func newOneToOne(t *testing.T, s *stack.Stack) testEndpoint {
+	t.Helper()
+	var wq waiter.Queue
+	ep, err := s.NewEndpoint(sctp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint: %s", err)
+	}
+	t.Cleanup(ep.Close)
+	return testEndpoint{ep, &wq}
+}
+
+func newOneToMany(t *testing.T, s *stack.Stack) testEndpoint {
+	t.Helper()
+	var wq waiter.Queue
+	ep, err := sctp.NewOneToManyEndpoint(s, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewOneToManyEndpoint: %s", err)
+	}
+	t.Cleanup(ep.Close)
+	return testEndpoint{ep, &wq}
+}
+
+// wait blocks until ep is ready for one of the events of mask.
+func (ep testEndpoint) wait(t *testing.T, mask waiter.EventMask) {
+	t.Helper()
+	we, ch := waiter.NewChannelEntry(mask)
+	ep.wq.EventRegister(&we)
+	defer ep.wq.EventUnregister(&we)
+	if ep.Readiness(mask) != 0 {
+		return
+	}
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+		t.Fatalf("timed out waiting for events %#x", mask)
+	}
+}
+
+// read reads the next message or notification.
+func (ep testEndpoint) read(t *testing.T) ([]byte, tcpip.ReadResult) {
+	t.Helper()
+	var (
+		buf bytes.Buffer
+		res tcpip.ReadResult
+	)
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		r, err := ep.Read(&buf, tcpip.ReadOptions{NeedRemoteAddr: true})
+		if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+			ep.wait(t, waiter.ReadableEvents)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Read: %s", err)
+		}
+		res.Count += r.Count
+		res.Total = r.Total
+		res.RemoteAddr = r.RemoteAddr
+		res.ControlMessages = r.ControlMessages
+		res.Notification = r.Notification
+		if r.EndOfRecord {
+			res.EndOfRecord = true
+			return buf.Bytes(), res
+		}
+	}
+	t.Fatalf("timed out reading a message")
+	return nil, res
+}
+
+// readData reads the next message, skipping notifications.
+func (ep testEndpoint) readData(t *testing.T) ([]byte, tcpip.ReadResult) {
+	t.Helper()
+	for {
+		b, res := ep.read(t)
+		if !res.Notification {
+			return b, res
+		}
+	}
+}
+
+func (ep testEndpoint) write(t *testing.T, b []byte, opts tcpip.WriteOptions) {
+	t.Helper()
+	for {
+		var r bytes.Reader
+		r.Reset(b)
+		n, err := ep.Write(&r, opts)
+		if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+			ep.wait(t, waiter.WritableEvents)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+		if int(n) != len(b) {
+			t.Fatalf("Write returned %d, want %d", n, len(b))
+		}
+		return
+	}
+}
+
+// connect connects a one-to-one endpoint to addr and waits for the outcome.
+func (ep testEndpoint) connect(addr tcpip.FullAddress) tcpip.Error {
+	we, ch := waiter.NewChannelEntry(waiter.WritableEvents)
+	ep.wq.EventRegister(&we)
+	defer ep.wq.EventUnregister(&we)
+	switch err := ep.Connect(addr); err.(type) {
+	case *tcpip.ErrConnectStarted:
+	default:
+		return err
+	}
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+		return &tcpip.ErrTimeout{}
+	}
+	return ep.Connect(addr)
+}
+
+func listenOneToOne(t *testing.T, s *stack.Stack) (testEndpoint, tcpip.FullAddress) {
+	t.Helper()
+	ep := newOneToOne(t, s)
+	if err := ep.Bind(tcpip.FullAddress{Addr: addr1}); err != nil {
+		t.Fatalf("Bind: %s", err)
+	}
+	if err := ep.Listen(10); err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	addr, err := ep.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("GetLocalAddress: %s", err)
+	}
+	return ep, addr
+}
+
+func (ep testEndpoint) accept(t *testing.T) testEndpoint {
+	t.Helper()
+	for {
+		n, wq, err := ep.Accept(nil)
+		if _, ok := err.(*tcpip.ErrWouldBlock); ok {
+			ep.wait(t, waiter.ReadableEvents)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Accept: %s", err)
+		}
+		t.Cleanup(n.Close)
+		return testEndpoint{n, wq}
+	}
+}
+
+func TestOneToOneEcho(t *testing.T) {
+	s := newStack(t)
+	listener, addr := listenOneToOne(t, s)
+
+	client := newOneToOne(t, s)
+	if err := client.connect(addr); err != nil {
+		t.Fatalf("connect(%v): %s", addr, err)
+	}
+	server := listener.accept(t)
+
+	for _, msg := range []string{"hello", "world"} {
+		client.write(t, []byte(msg), tcpip.WriteOptions{})
+		got, _ := server.readData(t)
+		if string(got) != msg {
+			t.Fatalf("server got %q, want %q", got, msg)
+		}
+		server.write(t, got, tcpip.WriteOptions{})
+		if got, _ := client.readData(t); string(got) != msg {
+			t.Fatalf("client got %q, want %q", got, msg)
+		}
+	}
+
+	clientAddr, err := client.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("GetLocalAddress: %s", err)
+	}
+	peer, err := server.GetRemoteAddress()
+	if err != nil {
+		t.Fatalf("GetRemoteAddress: %s", err)
+	}
+	if peer.Port != clientAddr.Port {
+		t.Errorf("got peer port %d, want %d", peer.Port, clientAddr.Port)
+	}
+}
+
+func TestMessageBoundaries(t *testing.T) {
+	s := newStack(t)
+	listener, addr := listenOneToOne(t, s)
+	client := newOneToOne(t, s)
+	if err := client.connect(addr); err != nil {
+		t.Fatalf("connect(%v): %s", addr, err)
+	}
+	server := listener.accept(t)
+
+	msgs := []string{"a", "bb", "ccc"}
+	for _, msg := range msgs {
+		client.write(t, []byte(msg), tcpip.WriteOptions{})
+	}
+	for _, want := range msgs {
+		got, res := server.readData(t)
+		if string(got) != want || !res.EndOfRecord {
+			t.Fatalf("got %q (end of record %t), want %q", got, res.EndOfRecord, want)
+		}
+	}
+
+	// A short read leaves the rest of the message for the next read.
+	client.write(t, []byte("partial"), tcpip.WriteOptions{})
+	server.wait(t, waiter.ReadableEvents)
+	var buf bytes.Buffer
+	res, err := server.Read(&tcpip.LimitedWriter{W: &buf, N: 3}, tcpip.ReadOptions{})
+	if err != nil {
+		t.Fatalf("Read: %s", err)
+	}
+	if res.EndOfRecord || buf.String() != "par" {
+		t.Fatalf("got %q (end of record %t), want %q without end of record", buf.String(), res.EndOfRecord, "par")
+	}
+	if got, _ := server.readData(t); string(got) != "tial" {
+		t.Fatalf("got %q, want %q", got, "tial")
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	s := newStack(t)
+	listener, addr := listenOneToOne(t, s)
+	client := newOneToOne(t, s)
+	if err := client.SetSockOptInt(tcpip.SCTPMaxSegOption, 1024); err != nil {
+		t.Fatalf("SetSockOptInt(SCTPMaxSegOption, 1024): %s", err)
+	}
+	if err := client.connect(addr); err != nil {
+		t.Fatalf("connect(%v): %s", addr, err)
+	}
+	server := listener.accept(t)
+
+	msg := make([]byte, 100<<10)
+	for i := range msg {
+		msg[i] = byte(i * 7)
+	}
+	client.write(t, msg, tcpip.WriteOptions{})
+	got, res := server.readData(t)
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("got %d bytes, want %d matching bytes", len(got), len(msg))
+	}
+	if !res.EndOfRecord {
+		t.Errorf("got EndOfRecord = false, want true")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := newStack(t)
+	listener, addr := listenOneToOne(t, s)
+	client := newOneToOne(t, s)
+	if err := client.connect(addr); err != nil {
+		t.Fatalf("connect(%v): %s", addr, err)
+	}
+	server := listener.accept(t)
+
+	client.write(t, []byte("last"), tcpip.WriteOptions{})
+	if err := client.Shutdown(tcpip.ShutdownWrite); err != nil {
+		t.Fatalf("Shutdown: %s", err)
+	}
+	if got, _ := server.readData(t); string(got) != "last" {
+		t.Fatalf("got %q, want %q", got, "last")
+	}
+	server.wait(t, waiter.ReadableEvents)
+	var buf bytes.Buffer
+	if _, err := server.Read(&buf, tcpip.ReadOptions{}); err == nil {
+		t.Fatalf("Read after peer shutdown succeeded")
+	} else if _, ok := err.(*tcpip.ErrClosedForReceive); !ok {
+		t.Fatalf("Read after peer shutdown: got %s, want %s", err, &tcpip.ErrClosedForReceive{})
+	}
+}
+
+func TestConnectRefused(t *testing.T) {
+	s := newStack(t)
+	client := newOneToOne(t, s)
+	addr := tcpip.FullAddress{Addr: addr1, Port: 9}
+	if err := client.connect(addr); err == nil {
+		t.Fatalf("connect(%v) succeeded", addr)
+	} else if _, ok := err.(*tcpip.ErrConnectionRefused); !ok {
+		t.Fatalf("connect(%v): got %s, want %s", addr, err, &tcpip.ErrConnectionRefused{})
+	}
+}
+
+func TestOneToManyStreams(t *testing.T) {
+	s := newStack(t)
+	server := newOneToMany(t, s)
+	if err := server.Bind(tcpip.FullAddress{Addr: addr1}); err != nil {
+		t.Fatalf("Bind: %s", err)
+	}
+	if err := server.Listen(10); err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	events := tcpip.SCTPEventDataIO | tcpip.SCTPEventAssociation
+	if err := server.SetSockOpt(&events); err != nil {
+		t.Fatalf("SetSockOpt(%#x): %s", events, err)
+	}
+	addr, err := server.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("GetLocalAddress: %s", err)
+	}
+
+	client := newOneToMany(t, s)
+	if err := client.SetSockOptInt(tcpip.SCTPRecvRcvInfoOption, 1); err != nil {
+		t.Fatalf("SetSockOptInt(SCTPRecvRcvInfoOption, 1): %s", err)
+	}
+	const stream = 3
+	client.write(t, []byte("ping"), tcpip.WriteOptions{
+		To: &addr,
+		ControlMessages: tcpip.SendableControlMessages{
+			HasSCTPSndInfo: true,
+			SCTPSndInfo:    tcpip.SCTPSndInfo{Stream: stream, PPID: 42},
+		},
+	})
+
+	// The association is announced before its data.
+	b, res := server.read(t)
+	if !res.Notification {
+		t.Fatalf("got data %q, want an association change notification", b)
+	}
+	if typ := binary.NativeEndian.Uint16(b); typ != 0x8001 {
+		t.Fatalf("got notification type %#x, want %#x", typ, 0x8001)
+	}
+	assocID := tcpip.SCTPAssocID(binary.NativeEndian.Uint32(b[16:]))
+
+	b, res = server.readData(t)
+	if string(b) != "ping" {
+		t.Fatalf("got %q, want %q", b, "ping")
+	}
+	info := res.ControlMessages.SCTPRcvInfo
+	if !res.ControlMessages.HasSCTPSndRcvInfo || info.Stream != stream || info.PPID != 42 || info.AssocID != assocID {
+		t.Fatalf("got receive info %+v (set %t), want stream %d, ppid 42 and association %d", info, res.ControlMessages.HasSCTPSndRcvInfo, stream, assocID)
+	}
+
+	var ids tcpip.SCTPAssocIDListOption
+	if err := server.GetSockOpt(&ids); err != nil {
+		t.Fatalf("GetSockOpt(SCTPAssocIDListOption): %s", err)
+	}
+	if len(ids) != 1 || ids[0] != assocID {
+		t.Fatalf("got associations %v, want [%d]", ids, assocID)
+	}
+
+	// Reply on the association, selected by ID.
+	server.write(t, []byte("pong"), tcpip.WriteOptions{
+		ControlMessages: tcpip.SendableControlMessages{
+			HasSCTPSndInfo: true,
+			SCTPSndInfo:    tcpip.SCTPSndInfo{Stream: stream, AssocID: assocID},
+		},
+	})
+	b, res = client.readData(t)
+	if string(b) != "pong" {
+		t.Fatalf("got %q, want %q", b, "pong")
+	}
+	if !res.ControlMessages.HasSCTPRcvInfo || res.ControlMessages.SCTPRcvInfo.Stream != stream {
+		t.Fatalf("got receive info %+v (set %t), want stream %d", res.ControlMessages.SCTPRcvInfo, res.ControlMessages.HasSCTPRcvInfo, stream)
+	}
+	if res.RemoteAddr.Port != addr.Port {
+		t.Errorf("got sender port %d, want %d", res.RemoteAddr.Port, addr.Port)
+	}
+
+	var status tcpip.SCTPStatusOption
+	status.AssocID = assocID
+	if err := server.GetSockOpt(&status); err != nil {
+		t.Fatalf("GetSockOpt(SCTPStatusOption): %s", err)
+	}
+	// SCTP_ESTABLISHED.
+	if status.State != 4 {
+		t.Errorf("got state %d, want 4", status.State)
+	}
+}
+
+func TestInvalidStream(t *testing.T) {
+	s := newStack(t)
+	listener, addr := listenOneToOne(t, s)
+	client := newOneToOne(t, s)
+	if err := client.connect(addr); err != nil {
+		t.Fatalf("connect(%v): %s", addr, err)
+	}
+	listener.accept(t)
+
+	var r bytes.Reader
+	r.Reset([]byte("x"))
+	_, err := client.Write(&r, tcpip.WriteOptions{
+		ControlMessages: tcpip.SendableControlMessages{
+			HasSCTPSndInfo: true,
+			SCTPSndInfo:    tcpip.SCTPSndInfo{Stream: 1000},
+		},
+	})
+	if _, ok := err.(*tcpip.ErrInvalidOptionValue); !ok {
+		t.Fatalf("Write on stream 1000: got %v, want %s", err, &tcpip.ErrInvalidOptionValue{})
+	}
+}
+
+func TestMultiHoming(t *testing.T) {
+	s := newStack(t)
+	listener := newOneToOne(t, s)
+	bindx := tcpip.SCTPBindxOption{Addrs: []tcpip.FullAddress{{Addr: addr1}, {Addr: addr2}}}
+	if err := listener.SetSockOpt(&bindx); err != nil {
+		t.Fatalf("SetSockOpt(%+v): %s", bindx, err)
+	}
+	if err := listener.Listen(1); err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	addr, err := listener.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("GetLocalAddress: %s", err)
+	}
+
+	client := newOneToOne(t, s)
+	if err := client.connect(addr); err != nil {
+		t.Fatalf("connect(%v): %s", addr, err)
+	}
+	listener.accept(t)
+
+	peers := tcpip.SCTPPeerAddrsOption{}
+	if err := client.GetSockOpt(&peers); err != nil {
+		t.Fatalf("GetSockOpt(SCTPPeerAddrsOption): %s", err)
+	}
+	if len(peers.Addrs) != 2 {
+		t.Fatalf("got peer addresses %v, want 2 addresses", peers.Addrs)
+	}
+	primary := tcpip.SCTPPrimaryAddrOption{Addr: tcpip.FullAddress{Addr: addr2, Port: addr.Port}}
+	if err := client.SetSockOpt(&primary); err != nil {
+		t.Fatalf("SetSockOpt(%+v): %s", primary, err)
+	}
+	if got, err := client.GetRemoteAddress(); err != nil || got.Addr != addr2 {
+		t.Fatalf("GetRemoteAddress() = %v, %v; want address %s", got, err, addr2)
+	}
+}
+
+func TestPeeloff(t *testing.T) {
+	s := newStack(t)
+	server := newOneToMany(t, s)
+	if err := server.Bind(tcpip.FullAddress{Addr: addr1}); err != nil {
+		t.Fatalf("Bind: %s", err)
+	}
+	if err := server.Listen(10); err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	addr, err := server.GetLocalAddress()
+	if err != nil {
+		t.Fatalf("GetLocalAddress: %s", err)
+	}
+
+	client := newOneToOne(t, s)
+	if err := client.connect(addr); err != nil {
+		t.Fatalf("connect(%v): %s", addr, err)
+	}
+	client.write(t, []byte("first"), tcpip.WriteOptions{})
+	server.readData(t)
+	var ids tcpip.SCTPAssocIDListOption
+	if err := server.GetSockOpt(&ids); err != nil || len(ids) != 1 {
+		t.Fatalf("GetSockOpt(SCTPAssocIDListOption) = %v, %v; want one association", ids, err)
+	}
+
+	var wq waiter.Queue
+	peeloff := tcpip.SCTPPeeloffOption{AssocID: ids[0], WaiterQueue: &wq}
+	if err := server.GetSockOpt(&peeloff); err != nil {
+		t.Fatalf("GetSockOpt(SCTPPeeloffOption): %s", err)
+	}
+	peeled := testEndpoint{peeloff.Endpoint, &wq}
+	t.Cleanup(peeled.Close)
+
+	client.write(t, []byte("second"), tcpip.WriteOptions{})
+	if got, _ := peeled.readData(t); string(got) != "second" {
+		t.Fatalf("got %q, want %q", got, "second")
+	}
+	peeled.write(t, []byte("reply"), tcpip.WriteOptions{})
+	if got, _ := client.readData(t); string(got) != "reply" {
+		t.Fatalf("got %q, want %q", got, "reply")
+	}
+	if err := server.GetSockOpt(&ids); err != nil || len(ids) != 0 {
+		t.Fatalf("GetSockOpt(SCTPAssocIDListOption) = %v, %v; want no associations", ids, err)
+	}
+}
+
+func TestAbortOnClose(t *testing.T) {
+	s := newStack(t)
+	listener, addr := listenOneToOne(t, s)
+	client := newOneToOne(t, s)
+	if err := client.connect(addr); err != nil {
+		t.Fatalf("connect(%v): %s", addr, err)
+	}
+	server := listener.accept(t)
+
+	// Closing with unread data aborts the association.
+	server.write(t, []byte("unread"), tcpip.WriteOptions{})
+	client.wait(t, waiter.ReadableEvents)
+	client.Close()
+
+	server.wait(t, waiter.EventHUp)
+	var buf bytes.Buffer
+	if _, err := server.Read(&buf, tcpip.ReadOptions{}); err == nil {
+		t.Fatalf("Read after abort succeeded")
+	} else if _, ok := err.(*tcpip.ErrConnectionReset); !ok {
+		t.Fatalf("Read after abort: got %s, want %s", err, &tcpip.ErrConnectionReset{})
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// segment is a received SCTP packet. Its chunks refer to a private copy of
+// the packet, so that it can be queued after the packet buffer is released.
+//
+// +stateify savable
+type segment struct {
+	segmentEntry
+
+	nicID    tcpip.NICID
+	netProto tcpip.NetworkProtocolNumber
+
+	// id is the packet's endpoint ID: LocalAddress and LocalPort hold its
+	// destination and RemoteAddress and RemotePort its source.
+	id stack.TransportEndpointID
+
+	vtag   uint32
+	chunks []header.SCTPChunk
+}
+
+// newSegment validates pkt and returns it as a segment. It returns false if
+// the packet is malformed or its checksum is incorrect.
+func newSegment(id stack.TransportEndpointID, pkt *stack.PacketBuffer) (*segment, bool) {
+	hdr := header.SCTP(pkt.TransportHeader().Slice())
+	if len(hdr) < header.SCTPMinimumSize {
+		return nil, false
+	}
+	payload := pkt.Data().AsRange().ToSlice()
+	if !pkt.RXChecksumValidated && !hdr.IsChecksumValid(payload) {
+		return nil, false
+	}
+	chunks, ok := header.ParseSCTPChunks(payload)
+	if !ok || len(chunks) == 0 {
+		return nil, false
+	}
+	return &segment{
+		nicID:    pkt.NICID,
+		netProto: pkt.NetworkProtocolNumber,
+		id:       id,
+		vtag:     hdr.VerificationTag(),
+		chunks:   chunks,
+	}, true
+}
+
+// remote returns the source of the segment.
+func (s *segment) remote() peerKey {
+	return peerKey{addr: s.id.RemoteAddress, port: s.id.RemotePort}
+}
+
+// hasChunk returns true if the segment carries a chunk of type typ.
+func (s *segment) hasChunk(typ header.SCTPChunkType) bool {
+	for _, c := range s.chunks {
+		if c.Type() == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// peerKey identifies a transport address of a peer.
+//
+// +stateify savable
+type peerKey struct {
+	addr tcpip.Address
+	port uint16
+}
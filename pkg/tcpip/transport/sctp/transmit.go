@@ -0,0 +1,610 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctp
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// outChunk is a DATA chunk that is queued for sending or waiting to be
+// acknowledged.
+//
+// +stateify savable
+type outChunk struct {
+	stream uint16
+	ppid   uint32
+	flags  uint8
+	data   []byte
+
+	// tsn and ssn are assigned when the chunk is first sent, so that
+	// messages queued during the handshake use the negotiated sequence
+	// numbers.
+	sent bool
+	tsn  uint32
+	ssn  uint16
+
+	sendCount int
+	sentAt    tcpip.MonotonicTime
+	path      *path
+
+	// inFlight is true if the chunk counts towards the data in flight.
+	inFlight bool
+
+	// acked is true if the chunk was acknowledged by a gap ack block.
+	acked bool
+
+	// retransmit is true if the chunk is due for retransmission.
+	retransmit bool
+
+	// missReports counts the SACKs that reported the chunk missing.
+	missReports int
+}
+
+// size returns the size of the chunk on the wire, excluding padding.
+func (c *outChunk) size() int {
+	return header.SCTPChunkHeaderSize + header.SCTPDataHeaderSize + len(c.data)
+}
+
+// tsnLT returns true if a precedes b in serial number arithmetic.
+func tsnLT(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// tsnLE returns true if a precedes or equals b in serial number arithmetic.
+func tsnLE(a, b uint32) bool {
+	return int32(a-b) <= 0
+}
+
+// fragPointLocked returns the largest amount of user data carried by a DATA
+// chunk.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) fragPointLocked() int {
+	mtu := 0xffff
+	for _, p := range a.paths {
+		mtu = min(mtu, p.mtu)
+	}
+	fp := mtu - header.SCTPMinimumSize - header.SCTPChunkHeaderSize - header.SCTPDataHeaderSize
+	if a.ep.maxSeg != 0 {
+		fp = min(fp, a.ep.maxSeg)
+	}
+	return fp &^ 3
+}
+
+// enqueueMessageLocked queues the user message v for sending, fragmenting it
+// as needed.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) enqueueMessageLocked(info tcpip.SCTPSndInfo, v []byte) {
+	var flags uint8
+	if info.Flags&tcpip.SCTPFlagUnordered != 0 {
+		flags |= header.SCTPDataFlagUnordered
+	}
+	if info.Flags&tcpip.SCTPFlagSackImmediately != 0 {
+		flags |= header.SCTPDataFlagImmediate
+	}
+	fp := a.fragPointLocked()
+	for off := 0; off < len(v); {
+		n := min(fp, len(v)-off)
+		f := flags
+		if off == 0 {
+			f |= header.SCTPDataFlagBegin
+		}
+		if off+n == len(v) {
+			f |= header.SCTPDataFlagEnd
+		}
+		a.sendQ = append(a.sendQ, &outChunk{
+			stream: info.Stream,
+			ppid:   info.PPID,
+			flags:  f,
+			data:   v[off : off+n],
+		})
+		off += n
+	}
+	a.queuedBytes += len(v)
+	a.ep.sndBufUsed += len(v)
+	a.resetAutocloseLocked()
+}
+
+// filterStreams removes the chunks of q sent on streams not below n, and
+// returns the remaining chunks. The bytes removed are subtracted from the
+// counters.
+func filterStreams(q []*outChunk, n uint16, counters ...*int) []*outChunk {
+	out := q[:0]
+	for _, c := range q {
+		if c.stream < n {
+			out = append(out, c)
+			continue
+		}
+		for _, cnt := range counters {
+			*cnt -= len(c.data)
+		}
+	}
+	clear(q[len(out):])
+	return out
+}
+
+// discardSendQueueLocked drops all queued and unacknowledged data.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) discardSendQueueLocked() {
+	a.ep.sndBufUsed -= a.queuedBytes
+	a.queuedBytes = 0
+	a.sendQ = nil
+	a.flight = 0
+	for _, p := range a.paths {
+		p.flight = 0
+	}
+	a.rtxPath = nil
+	a.ep.notify(waiter.WritableEvents)
+}
+
+// packer bundles chunks into packets sent to a single path.
+type packer struct {
+	a      *association
+	p      *path
+	chunks [][]byte
+	size   int
+	budget int
+	sent   int
+}
+
+func (a *association) newPacker(p *path) packer {
+	return packer{
+		a:      a,
+		p:      p,
+		budget: p.mtu - header.SCTPMinimumSize,
+	}
+}
+
+// add appends c to the current packet, sending the packet first if c does
+// not fit in it.
+func (pk *packer) add(c []byte) {
+	if len(pk.chunks) != 0 && pk.size+len(c) > pk.budget {
+		pk.flush()
+	}
+	pk.chunks = append(pk.chunks, c)
+	pk.size += len(c)
+}
+
+// full returns true if no more DATA chunks fit in the current packet.
+func (pk *packer) full() bool {
+	return pk.size+header.SCTPChunkHeaderSize+header.SCTPDataHeaderSize >= pk.budget
+}
+
+// flush sends the current packet.
+func (pk *packer) flush() {
+	if len(pk.chunks) == 0 {
+		return
+	}
+	pk.a.sendChunksLocked(pk.p, pk.a.peerTag, pk.chunks...)
+	pk.chunks = nil
+	pk.size = 0
+	pk.sent++
+}
+
+// transmitLocked sends the retransmissions and new data allowed by the
+// congestion and receive windows, and any pending SACK.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) transmitLocked() {
+	switch a.state {
+	case assocEstablished, assocShutdownPending, assocShutdownReceived:
+		a.sendRetransmissionsLocked()
+		a.sendNewDataLocked()
+	}
+	if a.sackNeeded {
+		a.sendSackLocked()
+	}
+}
+
+// dataChunkLocked encodes c for sending on p and accounts for it being in
+// flight.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) dataChunkLocked(c *outChunk, p *path, now tcpip.MonotonicTime) []byte {
+	c.sendCount++
+	c.sentAt = now
+	c.path = p
+	c.retransmit = false
+	c.missReports = 0
+	if !c.inFlight {
+		c.inFlight = true
+		p.flight += c.size()
+		a.flight += c.size()
+	}
+	a.peerRwnd -= min(a.peerRwnd, uint32(len(c.data)))
+	return header.NewSCTPDataChunk(&header.SCTPDataFields{
+		Flags:    c.flags,
+		TSN:      c.tsn,
+		StreamID: c.stream,
+		SSN:      c.ssn,
+		PPID:     c.ppid,
+	}, c.data)
+}
+
+// maybeBundleSackLocked adds a pending SACK to the packet being built.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) maybeBundleSackLocked(pk *packer) {
+	if a.sackNeeded {
+		pk.add(a.sackChunkLocked())
+	}
+}
+
+// sendRetransmissionsLocked retransmits the chunks marked for
+// retransmission. At least one packet is sent regardless of the congestion
+// window, as per RFC 4960 section 6.3.3.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) sendRetransmissionsLocked() {
+	p := a.rtxPath
+	if p == nil || !p.active {
+		p = a.activePath()
+	}
+	pk := a.newPacker(p)
+	now := a.ep.stack.Clock().NowMonotonic()
+	for _, c := range a.sendQ {
+		if !c.sent {
+			break
+		}
+		if !c.retransmit || c.acked {
+			continue
+		}
+		if pk.sent > 0 && p.flight >= p.cwnd {
+			break
+		}
+		if len(pk.chunks) == 0 {
+			a.maybeBundleSackLocked(&pk)
+		}
+		pk.add(a.dataChunkLocked(c, p, now))
+	}
+	pk.flush()
+	if pk.sent > 0 {
+		a.armT3Locked(p)
+	}
+}
+
+// sendNewDataLocked sends queued chunks that were never sent.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) sendNewDataLocked() {
+	p := a.activePath()
+	pk := a.newPacker(p)
+	now := a.ep.stack.Clock().NowMonotonic()
+
+	i := 0
+	for i < len(a.sendQ) && a.sendQ[i].sent {
+		i++
+	}
+	unsent := a.sendQ[i:]
+	if len(unsent) == 0 {
+		return
+	}
+	if !a.ep.nodelay && a.flight != 0 {
+		// As with Nagle's algorithm, small messages are held back while
+		// data is outstanding so that they can be bundled.
+		pending := 0
+		for _, c := range unsent {
+			pending += c.size()
+		}
+		if pending < pk.budget {
+			return
+		}
+	}
+
+	for j, c := range unsent {
+		if p.flight >= p.cwnd {
+			break
+		}
+		// A single chunk may be sent into a closed window to probe it.
+		if uint32(len(c.data)) > a.peerRwnd && a.flight != 0 {
+			break
+		}
+		c.sent = true
+		c.tsn = a.nextTSN
+		a.nextTSN++
+		if c.flags&header.SCTPDataFlagUnordered == 0 && c.flags&header.SCTPDataFlagBegin != 0 {
+			// All fragments of a message share its stream sequence
+			// number.
+			ssn := a.outSSN[c.stream]
+			a.outSSN[c.stream]++
+			for _, f := range unsent[j:] {
+				f.ssn = ssn
+				if f.flags&header.SCTPDataFlagEnd != 0 {
+					break
+				}
+			}
+		}
+		if len(pk.chunks) == 0 {
+			a.maybeBundleSackLocked(&pk)
+		}
+		pk.add(a.dataChunkLocked(c, p, now))
+		if pk.full() {
+			pk.flush()
+		}
+	}
+	pk.flush()
+	if pk.sent > 0 {
+		a.armT3Locked(p)
+	}
+}
+
+// armT3Locked arms the T3-rtx timer, unless it is already running.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) armT3Locked(p *path) {
+	if !a.t3.armed {
+		a.armLocked(&a.t3, p.rto, a.onT3ExpiredLocked)
+	}
+}
+
+// handleSackLocked processes a SACK chunk.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) handleSackLocked(c header.SCTPChunk) {
+	v := header.SCTPSack(c.Value())
+	if len(v) < header.SCTPSackHeaderSize {
+		return
+	}
+	gaps, ok := v.Gaps()
+	if !ok {
+		return
+	}
+	switch a.state {
+	case assocEstablished, assocShutdownPending, assocShutdownReceived:
+	default:
+		return
+	}
+	a.ackLocked(v.CumTSNAck(), gaps, true /* isSack */, v.ARwnd())
+}
+
+// processCumAckLocked processes the cumulative TSN ack of a SHUTDOWN chunk.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) processCumAckLocked(cum uint32) {
+	a.ackLocked(cum, nil /* gaps */, false /* isSack */, 0 /* arwnd */)
+}
+
+// ackLocked processes an acknowledgement of the data up to cum, and of the
+// gap ack blocks of a SACK, as per RFC 4960 section 6.2.1.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) ackLocked(cum uint32, gaps []header.SCTPGapBlock, isSack bool, arwnd uint32) {
+	if tsnLT(cum, a.cumAckTSN) || !tsnLT(cum, a.nextTSN) {
+		// A stale acknowledgement, or one for data that was never sent.
+		return
+	}
+	e := a.ep
+	now := e.stack.Clock().NowMonotonic()
+	newCum := cum != a.cumAckTSN
+
+	newlyAcked := make(map[*path]int)
+	var (
+		rttChunk *outChunk
+		freed    int
+	)
+	ack := func(c *outChunk) {
+		if c.inFlight {
+			c.inFlight = false
+			c.path.flight -= c.size()
+			a.flight -= c.size()
+		}
+		if !c.acked {
+			newlyAcked[c.path] += len(c.data)
+			if c.sendCount == 1 {
+				rttChunk = c
+			}
+		}
+	}
+
+	// Cumulative acknowledgement.
+	n := 0
+	for _, c := range a.sendQ {
+		if !c.sent || tsnLT(cum, c.tsn) {
+			break
+		}
+		ack(c)
+		freed += len(c.data)
+		n++
+	}
+	clear(a.sendQ[:n])
+	a.sendQ = a.sendQ[n:]
+	a.cumAckTSN = cum
+	a.queuedBytes -= freed
+	e.sndBufUsed -= freed
+
+	// Gap acknowledgements.
+	var highestNewlyAcked uint32
+	haveHighest := false
+	if isSack {
+		for _, c := range a.sendQ {
+			if !c.sent {
+				break
+			}
+			acked := false
+			for _, g := range gaps {
+				if off := c.tsn - cum; off >= uint32(g.Start) && off <= uint32(g.End) {
+					acked = true
+					break
+				}
+			}
+			switch {
+			case acked && !c.acked:
+				ack(c)
+				c.acked = true
+				c.retransmit = false
+				highestNewlyAcked = c.tsn
+				haveHighest = true
+			case !acked && c.acked:
+				// The peer reneged on the data; it is retransmitted
+				// if it remains unacknowledged.
+				c.acked = false
+			}
+		}
+	}
+
+	if rttChunk != nil {
+		a.updateRTOLocked(rttChunk.path, now.Sub(rttChunk.sentAt))
+	}
+	if len(newlyAcked) != 0 {
+		a.errorCount = 0
+	}
+
+	// Congestion window updates, as per RFC 4960 section 7.2.
+	if a.fastRecovery && tsnLE(a.recoverTSN, cum) {
+		a.fastRecovery = false
+	}
+	if newCum && !a.fastRecovery {
+		for p, acked := range newlyAcked {
+			if p.cwnd <= p.ssthresh {
+				p.cwnd += min(acked, p.mtu)
+				continue
+			}
+			p.partialBytesAcked += acked
+			if p.partialBytesAcked >= p.cwnd {
+				p.partialBytesAcked -= p.cwnd
+				p.cwnd += p.mtu
+			}
+		}
+	}
+	for p := range newlyAcked {
+		if p != nil {
+			a.pathConfirmedLocked(p)
+		}
+	}
+
+	// Fast retransmit, as per RFC 4960 section 7.2.4.
+	if haveHighest {
+		lost := make(map[*path]bool)
+		for _, c := range a.sendQ {
+			if !c.sent || !tsnLT(c.tsn, highestNewlyAcked) {
+				break
+			}
+			if c.acked || !c.inFlight {
+				continue
+			}
+			c.missReports++
+			if c.missReports == 3 {
+				c.retransmit = true
+				c.inFlight = false
+				c.path.flight -= c.size()
+				a.flight -= c.size()
+				lost[c.path] = true
+			}
+		}
+		if len(lost) != 0 && !a.fastRecovery {
+			a.fastRecovery = true
+			a.recoverTSN = a.nextTSN - 1
+			for p := range lost {
+				p.ssthresh = max(p.cwnd/2, 4*p.mtu)
+				p.cwnd = p.ssthresh
+				p.partialBytesAcked = 0
+			}
+		}
+	}
+
+	if isSack {
+		a.peerRwnd = arwnd - min(arwnd, uint32(a.flight))
+	}
+	if a.flight == 0 {
+		a.t3.stop()
+		a.rtxPath = nil
+		for _, p := range a.paths {
+			p.partialBytesAcked = 0
+		}
+	} else if newCum {
+		// Restart the timer for the earliest outstanding data.
+		a.t3.stop()
+		for _, c := range a.sendQ {
+			if c.inFlight {
+				a.armT3Locked(c.path)
+				break
+			}
+		}
+	}
+	if freed != 0 {
+		e.notify(waiter.WritableEvents)
+	}
+	a.maybeSendShutdownLocked()
+}
+
+// onT3ExpiredLocked retransmits the outstanding data after a retransmission
+// timeout, as per RFC 4960 section 6.3.3.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) onT3ExpiredLocked() {
+	var p *path
+	for _, c := range a.sendQ {
+		if c.inFlight {
+			p = c.path
+			break
+		}
+	}
+	if p == nil {
+		return
+	}
+
+	a.errorCount++
+	if a.errorCount > a.maxRetrans {
+		a.ep.setHardErrorLocked(&tcpip.ErrTimeout{})
+		a.abortLocked(nil /* cause */)
+		return
+	}
+	a.pathErrorLocked(p)
+	p.rto = min(2*p.rto, a.rtoMax)
+	p.ssthresh = max(p.cwnd/2, 4*p.mtu)
+	p.cwnd = p.mtu
+	p.partialBytesAcked = 0
+
+	for _, c := range a.sendQ {
+		if c.inFlight {
+			c.inFlight = false
+			c.path.flight -= c.size()
+			a.flight -= c.size()
+			c.retransmit = true
+		}
+	}
+	a.fastRecovery = false
+	a.rtxPath = a.alternatePath(p)
+	a.transmitLocked()
+}
+
+// updateRTOLocked updates the retransmission timeout of p with a new round
+// trip time measurement, as per RFC 4960 section 6.3.1.
+//
+// Precondition: a.ep.mu must be held.
+func (a *association) updateRTOLocked(p *path, rtt time.Duration) {
+	if p == nil || rtt < 0 {
+		return
+	}
+	if !p.rttMeasured {
+		p.rttMeasured = true
+		p.srtt = rtt
+		p.rttvar = rtt / 2
+	} else {
+		delta := p.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		p.rttvar = (3*p.rttvar + delta) / 4
+		p.srtt = (7*p.srtt + rtt) / 8
+	}
+	p.rto = min(max(p.srtt+4*p.rttvar, a.rtoMin), a.rtoMax)
+}
@@ -190,7 +190,18 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 		netProto = s.pkt.NetworkProtocolNumber
 	}
 
-	route, err := l.stack.FindRoute(s.pkt.NICID, s.pkt.Network().DestinationAddress(), s.pkt.Network().SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
+	// Connections accepted by a transparent listener may have a local address
+	// that is not assigned to the stack. They also inherit the listener's mark
+	// and owner.
+	var flow stack.RouteFlow
+	if l.listenEP != nil {
+		flow.Mark = l.listenEP.ops.GetMark()
+		flow.Transparent = l.listenEP.ops.GetTransparent()
+		if l.listenEP.owner != nil {
+			flow.UID = l.listenEP.owner.KUID()
+		}
+	}
+	route, err := l.stack.FindRouteForFlow(s.pkt.NICID, s.pkt.Network().DestinationAddress(), s.pkt.Network().SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */, flow)
 	if err != nil {
 		return nil, err // +checklocksignore
 	}
@@ -209,6 +220,10 @@ func (l *listenContext) createConnectingEndpoint(s *segment, rcvdSynOpts header.
 	n.maybeEnableTimestamp(rcvdSynOpts)
 	n.maybeEnableSACKPermitted(rcvdSynOpts)
 
+	if l.listenEP != nil {
+		n.md5Keys.inherit(&l.listenEP.md5Keys, s.id.RemoteAddress, s.pkt.NICID)
+	}
+
 	n.initGSO()
 
 	// Bootstrap the auto tuning algorithm. Starting at zero will result in
@@ -290,10 +305,20 @@ func (l *listenContext) startHandshake(s *segment, opts header.TCPSynOptions, qu
 
 	ep.isRegistered = true
 
+	// Agree to ECN if the peer requested it. Connections completed with a
+	// SYN cookie never do as the cookie does not encode it.
+	ep.maybeEnableECN(s)
+
 	// Initialize and start the handshake.
 	h = ep.newPassiveHandshake(isn, irs, opts, deferAccept)
 	h.listenEP = l.listenEP
+	l.handleFastOpenSyn(h, s, opts) // +checklocksforce
 	h.start()
+	if h.fastOpen && s.payloadSize() > 0 {
+		// The data of the SYN was acknowledged in the SYN-ACK, so make it
+		// available for reading.
+		ep.readyToRead(s)
+	}
 	h.ep.mu.Unlock()
 	return h, nil
 }
@@ -363,6 +388,13 @@ func (e *Endpoint) propagateInheritableOptionsLocked(n *Endpoint) {
 	n.boundBindToDevice = e.boundBindToDevice
 	n.boundPortFlags = e.boundPortFlags
 	n.userMSS = e.userMSS
+	n.ops.SetTransparent(e.ops.GetTransparent())
+	n.ops.SetFreeBind(e.ops.GetFreeBind())
+	n.ops.SetMark(e.ops.GetMark())
+	if filter := e.ops.GetFilter(); filter != nil {
+		n.ops.SetFilter(filter)
+		n.ops.SetLockFilter(e.ops.GetLockFilter())
+	}
 }
 
 // reserveTupleLocked reserves an accepted endpoint's tuple.
@@ -424,6 +456,11 @@ type acceptQueue struct {
 
 	// capacity is the maximum number of endpoints that can be in endpoints.
 	capacity int
+
+	// fastOpenPending is the number of Fast Open endpoints that were
+	// delivered to endpoints before completing their handshake and have not
+	// completed it yet.
+	fastOpenPending int
 }
 
 func (a *acceptQueue) isFull() bool {
@@ -462,6 +499,7 @@ func (e *Endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 
 		opts := parseSynSegmentOptions(s)
 
+		fastOpen := false
 		useSynCookies, err := func() (bool, tcpip.Error) {
 			var alwaysUseSynCookies tcpip.TCPAlwaysUseSynCookies
 			if err := e.stack.TransportProtocolOption(header.TCPProtocolNumber, &alwaysUseSynCookies); err != nil {
@@ -487,19 +525,34 @@ func (e *Endpoint) handleListenSegment(ctx *listenContext, s *segment) tcpip.Err
 				e.stats.FailedConnectionAttempts.Increment()
 				return false, err
 			}
-			e.acceptQueue.pendingEndpoints[h.ep] = struct{}{}
+			if h.fastOpen {
+				// A Fast Open endpoint is delivered to the accept
+				// queue without waiting for the handshake to complete,
+				// as per RFC 7413 section 4.2.2.
+				e.acceptQueue.endpoints.PushBack(h.ep)
+				fastOpen = true
+			} else {
+				e.acceptQueue.pendingEndpoints[h.ep] = struct{}{}
+			}
 
 			return false, nil
 		}()
 		if err != nil {
 			return err
 		}
+		if fastOpen {
+			e.waiterQueue.Notify(waiter.ReadableEvents)
+		}
 		if !useSynCookies {
 			return nil
 		}
 
 		net := s.pkt.Network()
-		route, err := e.stack.FindRoute(s.pkt.NICID, net.DestinationAddress(), net.SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */)
+		flow := stack.RouteFlow{Mark: e.ops.GetMark(), Transparent: e.ops.GetTransparent()}
+		if e.owner != nil {
+			flow.UID = e.owner.KUID()
+		}
+		route, err := e.stack.FindRouteForFlow(s.pkt.NICID, net.DestinationAddress(), net.SourceAddress(), s.pkt.NetworkProtocolNumber, false /* multicastLoop */, flow)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,519 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"math"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+const (
+	// bbrHighGain is the gain used in startup to double the sending rate
+	// every round, 2/ln(2).
+	bbrHighGain = 2.885
+
+	// bbrDrainGain is the pacing gain used in drain to empty the queue
+	// created in startup within one round.
+	bbrDrainGain = 1 / bbrHighGain
+
+	// bbrCwndGain is the congestion window gain used in ProbeBW.
+	bbrCwndGain = 2.0
+
+	// bbrBwRounds is the length, in rounds, of the bottleneck bandwidth max
+	// filter window.
+	bbrBwRounds = len(bbrPacingGainCycle) + 2
+
+	// bbrMinRTTWindow is the length of the min RTT filter window.
+	bbrMinRTTWindow = 10 * time.Second
+
+	// bbrProbeRTTDuration is the minimum time spent in ProbeRTT.
+	bbrProbeRTTDuration = 200 * time.Millisecond
+
+	// bbrMinCwnd is the minimum congestion window in packets, used in
+	// ProbeRTT.
+	bbrMinCwnd = 4
+
+	// bbrQuantizationBudget is the number of packets added to the in-flight
+	// target to account for delayed and stretched ACKs.
+	bbrQuantizationBudget = 3
+
+	// bbrFullBwThresh is the growth of the bottleneck bandwidth estimate
+	// below which a round counts towards the pipe being full.
+	bbrFullBwThresh = 1.25
+
+	// bbrFullBwRounds is the number of rounds without significant bandwidth
+	// growth after which the pipe is estimated to be full.
+	bbrFullBwRounds = 3
+
+	// bbrPacingMargin is the fraction below the estimated bottleneck
+	// bandwidth at which BBR paces to reduce queueing.
+	bbrPacingMargin = 0.01
+)
+
+// bbrPacingGainCycle is the sequence of pacing gains cycled through in
+// ProbeBW: probe for more bandwidth, drain the resulting queue, then cruise.
+var bbrPacingGainCycle = [...]float64{5.0 / 4, 3.0 / 4, 1, 1, 1, 1, 1, 1}
+
+// bbrMode is the state of the BBR state machine.
+type bbrMode int
+
+const (
+	// bbrStartup ramps up the sending rate quickly to find the bottleneck
+	// bandwidth.
+	bbrStartup bbrMode = iota
+
+	// bbrDrain drains the queue created in startup.
+	bbrDrain
+
+	// bbrProbeBW cycles the pacing gain to probe for and share bandwidth.
+	bbrProbeBW
+
+	// bbrProbeRTT reduces the amount of data in flight to measure the
+	// propagation delay.
+	bbrProbeRTT
+)
+
+// bbrState stores the variables related to TCP BBR (v1) congestion control.
+//
+// BBR builds a model of the path from the delivery rate samples and round trip
+// times of the connection, and uses it to set the pacing rate and congestion
+// window. The implementation follows Linux's net/ipv4/tcp_bbr.c.
+//
+// See: https://datatracker.ietf.org/doc/html/draft-cardwell-iccrg-bbr-congestion-control-00
+//
+// +stateify savable
+type bbrState struct {
+	s *sender
+
+	mode bbrMode
+
+	// btlBw is a max filter of the delivery rate over the last bbrBwRounds
+	// rounds, in packets per second.
+	btlBw maxFilter
+
+	// minRTT is the minimum RTT seen within the last bbrMinRTTWindow, and
+	// minRTTStamp is when it was measured.
+	minRTT      time.Duration
+	minRTTStamp tcpip.MonotonicTime
+
+	// probeRTTDoneStamp is the earliest time at which ProbeRTT can end, or
+	// zero if not yet known. probeRTTRoundDone is set once a full round has
+	// elapsed in ProbeRTT.
+	probeRTTDoneStamp tcpip.MonotonicTime
+	probeRTTRoundDone bool
+
+	// roundCount is the number of packet-timed rounds so far, roundStart is
+	// set if the current ACK started a new round and nextRoundDelivered is
+	// the value of rateState.delivered that ends the current round.
+	roundCount         uint64
+	roundStart         bool
+	nextRoundDelivered int
+
+	pacingGain float64
+	cwndGain   float64
+
+	// fullBw is the bandwidth at the last significant bandwidth increase,
+	// fullBwCount is the number of rounds since then, and fullBwReached is
+	// set once the pipe is estimated to be full.
+	fullBw        float64
+	fullBwCount   int
+	fullBwReached bool
+
+	// cycleIdx is the current index in bbrPacingGainCycle and cycleStamp is
+	// when that phase began.
+	cycleIdx   int
+	cycleStamp tcpip.MonotonicTime
+
+	// priorCwnd is the congestion window before loss recovery or ProbeRTT.
+	priorCwnd int
+
+	// inRecovery is set while the sender is in loss recovery, during which
+	// packetConservation is set for the first round.
+	inRecovery         bool
+	packetConservation bool
+
+	// pacingRate is the current pacing rate in bytes per second.
+	pacingRate float64
+}
+
+// newBBRCC initializes the state for the BBR congestion control algorithm.
+func newBBRCC(s *sender) *bbrState {
+	now := s.ep.stack.Clock().NowMonotonic()
+	b := &bbrState{
+		s:           s,
+		minRTT:      effectivelyInfinity,
+		minRTTStamp: now,
+		cycleStamp:  now,
+	}
+	b.nextRoundDelivered = s.rate.delivered
+	b.enterStartup()
+	b.initPacingRate()
+	return b
+}
+
+// enterStartup enters the Startup mode.
+func (b *bbrState) enterStartup() {
+	b.mode = bbrStartup
+	b.pacingGain = bbrHighGain
+	b.cwndGain = bbrHighGain
+}
+
+// enterProbeBW enters the ProbeBW mode at a random phase other than the
+// bandwidth draining one, so that flows sharing a bottleneck don't probe in
+// lockstep.
+func (b *bbrState) enterProbeBW(now tcpip.MonotonicTime) {
+	b.mode = bbrProbeBW
+	b.cwndGain = bbrCwndGain
+	b.cycleIdx = len(bbrPacingGainCycle) - 1 - b.s.ep.stack.InsecureRNG().Intn(len(bbrPacingGainCycle)-1)
+	b.advanceCyclePhase(now)
+}
+
+// resetMode enters Startup or ProbeBW, depending on whether the pipe has
+// been filled.
+func (b *bbrState) resetMode(now tcpip.MonotonicTime) {
+	if !b.fullBwReached {
+		b.enterStartup()
+	} else {
+		b.enterProbeBW(now)
+	}
+}
+
+// bw returns the estimated bottleneck bandwidth in packets per second.
+func (b *bbrState) bw() float64 {
+	return b.btlBw.get()
+}
+
+// mss returns the sender's maximum segment size.
+func (b *bbrState) mss() float64 {
+	return float64(b.s.MaxPayloadSize)
+}
+
+// initPacingRate sets the initial pacing rate from the initial congestion
+// window and the smoothed RTT, if any.
+func (b *bbrState) initPacingRate() {
+	b.s.rtt.Lock()
+	srtt := b.s.rtt.TCPRTTState.SRTT
+	b.s.rtt.Unlock()
+	if srtt <= 0 {
+		srtt = time.Millisecond
+	}
+	b.pacingRate = bbrHighGain * float64(b.s.SndCwnd) * b.mss() / srtt.Seconds()
+}
+
+// setPacingRate sets the pacing rate to gain times the bandwidth estimate.
+// Until the pipe is full, the rate is never decreased.
+func (b *bbrState) setPacingRate(gain float64) {
+	bw := b.bw()
+	if bw == 0 {
+		return
+	}
+	rate := gain * bw * b.mss() * (1 - bbrPacingMargin)
+	if b.fullBwReached || rate > b.pacingRate {
+		b.pacingRate = rate
+	}
+}
+
+// inflight returns the congestion window that would allow for gain times the
+// estimated bandwidth-delay product to be in flight.
+func (b *bbrState) inflight(gain float64) int {
+	if b.minRTT == effectivelyInfinity {
+		// No RTT sample yet.
+		return InitialCwnd
+	}
+	bdp := b.bw() * b.minRTT.Seconds()
+	return int(math.Ceil(gain*bdp)) + bbrQuantizationBudget
+}
+
+// saveCwnd saves the congestion window before entering recovery or ProbeRTT
+// so that it can be restored afterwards.
+func (b *bbrState) saveCwnd() {
+	if !b.inRecovery && b.mode != bbrProbeRTT {
+		b.priorCwnd = b.s.SndCwnd
+	} else {
+		b.priorCwnd = max(b.priorCwnd, b.s.SndCwnd)
+	}
+}
+
+// updateBw updates the round count and bandwidth estimate from the sample.
+func (b *bbrState) updateBw(rs *rateSample) {
+	b.roundStart = false
+	if rs.delivered <= 0 || rs.interval <= 0 {
+		return
+	}
+	if rs.priorDelivered >= b.nextRoundDelivered {
+		b.nextRoundDelivered = b.s.rate.delivered
+		b.roundCount++
+		b.roundStart = true
+		b.packetConservation = false
+	}
+	// Application limited samples underestimate the bandwidth, so only use
+	// them if they increase the estimate.
+	if !rs.isAppLimited || rs.deliveryRate >= b.bw() {
+		b.btlBw.update(b.roundCount, rs.deliveryRate, bbrBwRounds)
+	}
+}
+
+// isNextCyclePhase returns whether the current ProbeBW gain cycle phase is
+// complete.
+func (b *bbrState) isNextCyclePhase(rs *rateSample, now tcpip.MonotonicTime) bool {
+	fullLength := now.Sub(b.cycleStamp) > b.minRTT
+	switch {
+	case b.pacingGain == 1:
+		return fullLength
+	case b.pacingGain > 1:
+		// Keep probing until the extra data is in flight or there are
+		// losses.
+		return fullLength && (b.s.FastRecovery.Active || rs.priorInFlight >= b.inflight(b.pacingGain))
+	default:
+		// Drain until the queue is gone, but no longer than a round.
+		return fullLength || rs.priorInFlight <= b.inflight(1)
+	}
+}
+
+// advanceCyclePhase moves to the next ProbeBW gain cycle phase.
+func (b *bbrState) advanceCyclePhase(now tcpip.MonotonicTime) {
+	b.cycleIdx = (b.cycleIdx + 1) % len(bbrPacingGainCycle)
+	b.cycleStamp = now
+	b.pacingGain = bbrPacingGainCycle[b.cycleIdx]
+}
+
+// checkFullBwReached estimates whether the pipe is full, i.e. whether the
+// bandwidth estimate stopped growing for bbrFullBwRounds rounds.
+func (b *bbrState) checkFullBwReached(rs *rateSample) {
+	if b.fullBwReached || !b.roundStart || rs.isAppLimited {
+		return
+	}
+	if bw := b.bw(); bw >= b.fullBw*bbrFullBwThresh {
+		b.fullBw = bw
+		b.fullBwCount = 0
+		return
+	}
+	b.fullBwCount++
+	b.fullBwReached = b.fullBwCount >= bbrFullBwRounds
+}
+
+// checkDrain leaves Startup once the pipe is full, and leaves Drain once the
+// queue built in Startup has drained.
+func (b *bbrState) checkDrain(now tcpip.MonotonicTime) {
+	if b.mode == bbrStartup && b.fullBwReached {
+		b.mode = bbrDrain
+		b.pacingGain = bbrDrainGain
+		b.cwndGain = bbrHighGain
+	}
+	if b.mode == bbrDrain && b.s.Outstanding <= b.inflight(1) {
+		b.enterProbeBW(now)
+	}
+}
+
+// updateMinRTT updates the min RTT estimate and enters or leaves ProbeRTT.
+func (b *bbrState) updateMinRTT(rs *rateSample, now tcpip.MonotonicTime) {
+	expired := now.Sub(b.minRTTStamp) > bbrMinRTTWindow
+	if rs.rtt >= 0 && (rs.rtt < b.minRTT || expired) {
+		b.minRTT = rs.rtt
+		b.minRTTStamp = now
+	}
+
+	if expired && b.mode != bbrProbeRTT {
+		b.mode = bbrProbeRTT
+		b.pacingGain = 1
+		b.cwndGain = 1
+		b.saveCwnd()
+		b.probeRTTDoneStamp = tcpip.MonotonicTime{}
+	}
+
+	if b.mode != bbrProbeRTT {
+		return
+	}
+	// Don't let application limited periods mistakenly look like the
+	// end of ProbeRTT.
+	b.s.rate.markAppLimited(b.s.Outstanding)
+	if b.probeRTTDoneStamp == (tcpip.MonotonicTime{}) {
+		if b.s.Outstanding <= bbrMinCwnd {
+			b.probeRTTDoneStamp = now.Add(bbrProbeRTTDuration)
+			b.probeRTTRoundDone = false
+			b.nextRoundDelivered = b.s.rate.delivered
+		}
+		return
+	}
+	if b.roundStart {
+		b.probeRTTRoundDone = true
+	}
+	if b.probeRTTRoundDone && now.After(b.probeRTTDoneStamp) {
+		b.minRTTStamp = now
+		b.s.SndCwnd = max(b.s.SndCwnd, b.priorCwnd)
+		b.resetMode(now)
+	}
+}
+
+// setCwnd sets the congestion window from the model, or by packet
+// conservation during the first round of loss recovery.
+func (b *bbrState) setCwnd(rs *rateSample) {
+	s := b.s
+	acked := rs.newlyDelivered
+	cwnd := s.SndCwnd
+
+	if s.FastRecovery.Active || s.state == tcpip.RTORecovery {
+		if !b.inRecovery {
+			// Entering recovery: start packet conservation for a round.
+			b.inRecovery = true
+			b.packetConservation = true
+			b.nextRoundDelivered = s.rate.delivered
+			cwnd = s.Outstanding + acked
+		}
+	} else if b.inRecovery {
+		// Leaving recovery: restore the window from before the loss.
+		b.inRecovery = false
+		cwnd = max(cwnd, b.priorCwnd)
+	}
+
+	if b.packetConservation {
+		cwnd = max(cwnd, s.Outstanding+acked)
+	} else {
+		target := b.inflight(b.cwndGain)
+		if b.fullBwReached {
+			cwnd = min(cwnd+acked, target)
+		} else if cwnd < target || s.rate.delivered < InitialCwnd {
+			cwnd += acked
+		}
+		cwnd = max(cwnd, bbrMinCwnd)
+	}
+
+	if b.mode == bbrProbeRTT {
+		cwnd = min(cwnd, bbrMinCwnd)
+	}
+	s.SndCwnd = max(cwnd, 1)
+}
+
+// UpdateRate implements rateControl.UpdateRate.
+func (b *bbrState) UpdateRate(rs *rateSample) {
+	now := b.s.ep.stack.Clock().NowMonotonic()
+	b.updateBw(rs)
+	if b.mode == bbrProbeBW && b.isNextCyclePhase(rs, now) {
+		b.advanceCyclePhase(now)
+	}
+	b.checkFullBwReached(rs)
+	b.checkDrain(now)
+	b.updateMinRTT(rs, now)
+
+	b.setPacingRate(b.pacingGain)
+	b.setCwnd(rs)
+}
+
+// PacingRate implements rateControl.PacingRate.
+func (b *bbrState) PacingRate() float64 {
+	return b.pacingRate
+}
+
+// Update implements congestionControl.Update. BBR is driven by delivery rate
+// samples instead, see UpdateRate.
+func (b *bbrState) Update(int, time.Duration) {}
+
+// HandleLossDetected implements congestionControl.HandleLossDetected.
+func (b *bbrState) HandleLossDetected() {
+	b.saveCwnd()
+	// BBR doesn't use ssthresh, but the sender derives the congestion
+	// window in recovery from it; keep it at the amount in flight so that
+	// recovery starts out conserving packets.
+	b.s.Ssthresh = max(b.s.Outstanding, bbrMinCwnd)
+}
+
+// HandleRTOExpired implements congestionControl.HandleRTOExpired.
+func (b *bbrState) HandleRTOExpired() {
+	b.saveCwnd()
+	b.s.SndCwnd = 1
+	// The window saved above is restored once the lost data has been
+	// delivered. Losses may have been caused by a change in the path, so
+	// restart the full pipe detection.
+	b.inRecovery = true
+	b.fullBw = 0
+}
+
+// PostRecovery implements congestionControl.PostRecovery.
+func (b *bbrState) PostRecovery() {
+	b.s.Ssthresh = InitialSsthresh
+	b.inRecovery = false
+	b.packetConservation = false
+	b.s.SndCwnd = max(b.s.SndCwnd, b.priorCwnd)
+}
+
+// HandleECNEcho implements congestionControl.HandleECNEcho.
+//
+// As in Linux, BBR builds its model from delivery rate and RTT samples and
+// ignores ECN.
+func (*bbrState) HandleECNEcho() {}
+
+// maxFilter is a windowed max filter that tracks the best three samples
+// within the window, as in Linux's lib/minmax.c (Kathleen Nichols'
+// algorithm).
+//
+// +stateify savable
+type maxFilter struct {
+	s [3]maxSample
+}
+
+// maxSample is a sample in a maxFilter.
+//
+// +stateify savable
+type maxSample struct {
+	t uint64
+	v float64
+}
+
+// get returns the maximum value within the window.
+func (m *maxFilter) get() float64 {
+	return m.s[0].v
+}
+
+// reset sets all samples to the given one.
+func (m *maxFilter) reset(t uint64, v float64) {
+	m.s = [3]maxSample{{t, v}, {t, v}, {t, v}}
+}
+
+// update adds a sample taken at time t to a filter with window length win.
+func (m *maxFilter) update(t uint64, v float64, win int) {
+	w := uint64(win)
+	if v >= m.s[0].v || t-m.s[2].t > w {
+		// New maximum, or nothing left in the window.
+		m.reset(t, v)
+		return
+	}
+	if v >= m.s[1].v {
+		m.s[1] = maxSample{t, v}
+		m.s[2] = m.s[1]
+	} else if v >= m.s[2].v {
+		m.s[2] = maxSample{t, v}
+	}
+
+	// Expire and update the best samples as the window passes.
+	dt := t - m.s[0].t
+	switch {
+	case dt > w:
+		m.s[0], m.s[1], m.s[2] = m.s[1], m.s[2], maxSample{t, v}
+		if t-m.s[0].t > w {
+			m.s[0], m.s[1], m.s[2] = m.s[1], m.s[2], maxSample{t, v}
+		}
+	case m.s[1].t == m.s[0].t && dt > w/4:
+		// A quarter of the window has passed without a better sample;
+		// take a second choice from the second quarter.
+		m.s[1] = maxSample{t, v}
+		m.s[2] = m.s[1]
+	case m.s[2].t == m.s[1].t && dt > w/2:
+		// Half the window has passed; take a third choice from the last
+		// half.
+		m.s[2] = maxSample{t, v}
+	}
+}
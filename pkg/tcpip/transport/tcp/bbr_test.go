@@ -0,0 +1,190 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/faketime"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+func newTestSender(clock tcpip.Clock, cc string) *sender {
+	s := stack.New(stack.Options{
+		TransportProtocols: []stack.TransportProtocolFactory{NewProtocol},
+		Clock:              clock,
+	})
+	ep := &Endpoint{
+		stack: s,
+		cc:    tcpip.CongestionControlOption(cc),
+	}
+	iss := seqnum.Value(0)
+	return &sender{
+		ep: ep,
+		TCPSenderState: stack.TCPSenderState{
+			SndUna:         iss + 1,
+			SndNxt:         iss + 1,
+			SndCwnd:        InitialCwnd,
+			Ssthresh:       InitialSsthresh,
+			MaxPayloadSize: 1000,
+		},
+	}
+}
+
+// TestMaxFilter tests that the windowed max filter forgets samples that fall
+// out of the window.
+func TestMaxFilter(t *testing.T) {
+	var m maxFilter
+	const win = 10
+	m.update(0, 100, win)
+	m.update(1, 50, win)
+	m.update(6, 70, win)
+	if got := m.get(); got != 100 {
+		t.Fatalf("got max %v, want 100", got)
+	}
+	// The first sample expires, leaving the best of the later ones.
+	m.update(11, 10, win)
+	if got := m.get(); got != 70 {
+		t.Fatalf("got max %v after expiry, want 70", got)
+	}
+	m.update(12, 200, win)
+	if got := m.get(); got != 200 {
+		t.Fatalf("got max %v after new max, want 200", got)
+	}
+}
+
+// TestRateSample tests that the delivery rate is the number of packets
+// delivered over the sampling interval.
+func TestRateSample(t *testing.T) {
+	clock := faketime.NewManualClock()
+	var r rateState
+
+	segs := make([]*segment, 10)
+	for i := range segs {
+		segs[i] = &segment{xmitTime: clock.NowMonotonic(), xmitCount: 1}
+		r.onSent(segs[i], segs[i].xmitTime, i)
+	}
+
+	clock.Advance(10 * time.Millisecond)
+	r.beginAck(len(segs))
+	for _, seg := range segs {
+		r.onDelivered(seg, 1, clock.NowMonotonic())
+	}
+	rs := r.endAck()
+	if rs.newlyDelivered != 10 || rs.delivered != 10 {
+		t.Fatalf("got newlyDelivered = %d, delivered = %d, want 10, 10", rs.newlyDelivered, rs.delivered)
+	}
+	if rs.interval != 10*time.Millisecond {
+		t.Errorf("got interval %v, want 10ms", rs.interval)
+	}
+	if want := 1000.0; math.Abs(rs.deliveryRate-want) > 1e-6 {
+		t.Errorf("got delivery rate %v packets/s, want %v", rs.deliveryRate, want)
+	}
+	if rs.rtt != 10*time.Millisecond {
+		t.Errorf("got rtt %v, want 10ms", rs.rtt)
+	}
+
+	// An ACK that delivers nothing doesn't generate a valid sample.
+	r.beginAck(0)
+	if rs := r.endAck(); rs.interval != 0 || rs.newlyDelivered != 0 {
+		t.Errorf("got interval %v and %d newly delivered packets for empty ACK, want 0", rs.interval, rs.newlyDelivered)
+	}
+}
+
+// TestBBRStartupExit tests that BBR leaves startup once the bandwidth
+// estimate stops growing, and then paces at the estimated bandwidth.
+func TestBBRStartupExit(t *testing.T) {
+	clock := faketime.NewManualClock()
+	snd := newTestSender(clock, ccBBR)
+	b := newBBRCC(snd)
+	snd.cc = b
+
+	if b.mode != bbrStartup {
+		t.Fatalf("got mode %v, want startup", b.mode)
+	}
+	if b.PacingRate() <= 0 {
+		t.Fatalf("got initial pacing rate %v, want > 0", b.PacingRate())
+	}
+
+	const (
+		perRound = 10
+		bw       = 1000.0 // packets per second.
+		rtt      = 10 * time.Millisecond
+	)
+	for round := 0; round < 10 && !b.fullBwReached; round++ {
+		clock.Advance(rtt)
+		snd.rate.delivered += perRound
+		b.UpdateRate(&rateSample{
+			priorDelivered: snd.rate.delivered - perRound,
+			priorTime:      clock.NowMonotonic().Add(-rtt),
+			interval:       rtt,
+			delivered:      perRound,
+			deliveryRate:   bw,
+			newlyDelivered: perRound,
+			rtt:            rtt,
+		})
+	}
+	if !b.fullBwReached {
+		t.Fatalf("BBR did not detect a full pipe")
+	}
+	// Nothing is in flight, so drain completes immediately.
+	if b.mode != bbrProbeBW {
+		t.Errorf("got mode %v, want ProbeBW", b.mode)
+	}
+	if b.minRTT != rtt {
+		t.Errorf("got min RTT %v, want %v", b.minRTT, rtt)
+	}
+	want := b.pacingGain * bw * float64(snd.MaxPayloadSize) * (1 - bbrPacingMargin)
+	if got := b.PacingRate(); math.Abs(got-want) > 1e-6 {
+		t.Errorf("got pacing rate %v, want %v", got, want)
+	}
+	if got, want := snd.SndCwnd, b.inflight(bbrCwndGain); got > want {
+		t.Errorf("got cwnd %d, want <= %d", got, want)
+	}
+}
+
+// TestBBRRecovery tests that BBR conserves packets in recovery and restores
+// the congestion window afterwards.
+func TestBBRRecovery(t *testing.T) {
+	clock := faketime.NewManualClock()
+	snd := newTestSender(clock, ccBBR)
+	b := newBBRCC(snd)
+	snd.cc = b
+
+	snd.SndCwnd = 40
+	snd.Outstanding = 30
+	b.HandleLossDetected()
+	snd.FastRecovery.Active = true
+
+	snd.Outstanding = 20
+	snd.rate.delivered += 2
+	b.UpdateRate(&rateSample{priorDelivered: -1, newlyDelivered: 2, rtt: unknownRTT})
+	if got, want := snd.SndCwnd, 22; got != want {
+		t.Errorf("got cwnd %d in recovery, want %d", got, want)
+	}
+
+	snd.FastRecovery.Active = false
+	b.PostRecovery()
+	if got, want := snd.SndCwnd, 40; got != want {
+		t.Errorf("got cwnd %d after recovery, want %d", got, want)
+	}
+	if snd.Ssthresh != InitialSsthresh {
+		t.Errorf("got ssthresh %d after recovery, want %d", snd.Ssthresh, InitialSsthresh)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"math"
 	"time"
 
+	"gvisor.dev/gvisor/pkg/buffer"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/checksum"
@@ -112,6 +113,25 @@ type handshake struct {
 	// sendSYNOpts is the cached values for the SYN options to be sent.
 	sendSYNOpts header.TCPSynOptions
 
+	// fastOpenOption is true if the SYN/SYN-ACK carries a Fast Open option
+	// with fastOpenCookie. An active handshake with an empty cookie requests
+	// one from the peer.
+	fastOpenOption bool
+	fastOpenCookie []byte
+
+	// fastOpenData is the data sent in the SYN of an active Fast Open
+	// handshake.
+	fastOpenData buffer.Buffer
+
+	// fastOpen is true if a passive handshake accepted the data of a SYN
+	// with a valid Fast Open cookie. The endpoint is then delivered to the
+	// listener without waiting for the handshake to complete.
+	fastOpen bool
+
+	// fastOpenQueued is true while a passive Fast Open handshake counts
+	// towards the listener's pending Fast Open connections.
+	fastOpenQueued bool
+
 	// sampleRTTWithTSOnly is true when the segment was retransmitted or we can't
 	// tell; then RTT can only be sampled when the incoming segment has timestamp
 	// options enabled.
@@ -275,9 +295,13 @@ func (h *handshake) resetToSynRcvd(iss seqnum.Value, irs seqnum.Value, opts head
 }
 
 // checkAck checks if the ACK number, if present, of a segment received during
-// a TCP 3-way handshake is valid.
+// a TCP 3-way handshake is valid. It may also acknowledge data sent in a Fast
+// Open SYN.
 func (h *handshake) checkAck(s *segment) bool {
-	return !(s.flags.Contains(header.TCPFlagAck) && s.ackNumber != h.iss+1)
+	if !s.flags.Contains(header.TCPFlagAck) {
+		return true
+	}
+	return s.ackNumber.InRange(h.iss+1, h.iss.Add(seqnum.Size(h.fastOpenData.Size())+2))
 }
 
 // synSentState handles a segment received when the TCP 3-way handshake is in
@@ -325,6 +349,18 @@ func (h *handshake) synSentState(s *segment) tcpip.Error {
 	// Remember if the SACKPermitted option was negotiated.
 	h.ep.maybeEnableSACKPermitted(rcvSynOpts)
 
+	// Remember if ECN was negotiated. We only requested it if our SYN was an
+	// ECN-setup SYN. A SYN-ACK agrees to it with ECE alone, while a SYN in a
+	// simultaneous open is itself an ECN-setup SYN.
+	if isECNSetupSyn(h.flags) {
+		if s.flags.Contains(header.TCPFlagAck) {
+			h.ep.ecnEnabled = isECNSetupSynAck(s.flags)
+		} else {
+			h.ep.ecnEnabled = isECNSetupSyn(s.flags)
+		}
+		h.flags &^= ecnSetupFlags
+	}
+
 	// Remember the sequence we'll ack from now on.
 	h.ackNum = s.sequenceNumber + 1
 	h.flags |= header.TCPFlagAck
@@ -334,10 +370,15 @@ func (h *handshake) synSentState(s *segment) tcpip.Error {
 	// If this is a SYN ACK response, we only need to acknowledge the SYN
 	// and the handshake is completed.
 	if s.flags.Contains(header.TCPFlagAck) {
+		h.handleFastOpenSynAck(rcvSynOpts)
 		h.state = handshakeCompleted
 		h.transitionToStateEstablishedLocked(s)
 
-		h.ep.sendEmptyRaw(header.TCPFlagAck, h.iss+1, h.ackNum, h.rcvWnd>>h.effectiveRcvWndScale())
+		// Any data of a Fast Open SYN that the peer did not acknowledge
+		// is resent right away and acknowledges the SYN-ACK.
+		if h.ep.snd.SndNxt == h.ep.snd.SndUna {
+			h.ep.sendEmptyRaw(header.TCPFlagAck, h.ep.snd.SndNxt, h.ackNum, h.rcvWnd>>h.effectiveRcvWndScale())
+		}
 		return nil
 	}
 
@@ -345,6 +386,9 @@ func (h *handshake) synSentState(s *segment) tcpip.Error {
 	// but resend our own SYN and wait for it to be acknowledged in the
 	// SYN-RCVD state.
 	h.state = handshakeSynRcvd
+	if h.ep.ecnEnabled {
+		h.flags |= header.TCPFlagEce
+	}
 	ttl := calculateTTL(h.ep.route, h.ep.ipv4TTL, h.ep.ipv6HopLimit)
 	amss := h.ep.amss
 	h.ep.setEndpointState(StateSynRecv)
@@ -585,8 +629,21 @@ func (h *handshake) start() {
 		}
 	}
 
+	synOpts.FastOpen = h.fastOpenOption
+	synOpts.FastOpenCookie = h.fastOpenCookie
+
+	// Request ECN on active opens and agree to it on passive opens, see
+	// RFC 3168 section 6.1.1.
+	if h.state == handshakeSynRcvd {
+		if h.ep.ecnEnabled {
+			h.flags |= header.TCPFlagEce
+		}
+	} else if h.ep.ecnOption() == tcpip.TCPECNEnabled {
+		h.flags |= ecnSetupFlags
+	}
+
 	h.sendSYNOpts = synOpts
-	h.ep.sendSynTCP(h.ep.route, tcpFields{
+	h.ep.sendSynDataTCP(h.ep.route, tcpFields{
 		id:     h.ep.TransportEndpointInfo.ID,
 		ttl:    calculateTTL(h.ep.route, h.ep.ipv4TTL, h.ep.ipv6HopLimit),
 		tos:    h.ep.sendTOS,
@@ -594,7 +651,7 @@ func (h *handshake) start() {
 		seq:    h.iss,
 		ack:    h.ackNum,
 		rcvWnd: h.rcvWnd,
-	}, synOpts)
+	}, synOpts, h.fastOpenData)
 }
 
 // retransmitHandler handles retransmissions of un-acked SYNs.
@@ -622,6 +679,16 @@ func (h *handshake) retransmitHandlerLocked() tcpip.Error {
 	// the connection with another ACK or data (as ACKs are never
 	// retransmitted on their own).
 	if h.active || !h.acked || h.deferAccept != 0 && e.stack.Clock().NowMonotonic().Sub(h.startTime) > h.deferAccept {
+		// The ECN-setup SYN may have been dropped by a middlebox, so fall
+		// back to a non-ECN-setup SYN as per RFC 3168 section 6.1.1.1.
+		if h.state == handshakeSynSent {
+			h.flags &^= ecnSetupFlags
+			// Likewise, the Fast Open option or the data of the SYN may
+			// be what is dropped, so retransmit a regular SYN. Any data
+			// is then sent once the handshake completes.
+			h.sendSYNOpts.FastOpen = false
+			h.sendSYNOpts.FastOpenCookie = nil
+		}
 		e.sendSynTCP(e.route, tcpFields{
 			id:     e.TransportEndpointInfo.ID,
 			ttl:    calculateTTL(e.route, e.ipv4TTL, e.ipv6HopLimit),
@@ -652,7 +719,11 @@ func (h *handshake) transitionToStateEstablishedLocked(s *segment) {
 	// Transfer handshake state to TCP connection. We disable
 	// receive window scaling if the peer doesn't support it
 	// (indicated by a negative send window scale).
-	h.ep.snd = newSender(h.ep, h.iss, h.ackNum-1, h.sndWnd, h.mss, h.sndWndScale)
+	//
+	// Data of a Fast Open SYN acknowledged by the peer is treated as part of
+	// the SYN.
+	fastOpenAcked := h.fastOpenAcked(s)
+	h.ep.snd = newSender(h.ep, h.iss.Add(fastOpenAcked), h.ackNum-1, h.sndWnd, h.mss, h.sndWndScale)
 
 	now := h.ep.stack.Clock().NowMonotonic()
 
@@ -677,12 +748,17 @@ func (h *handshake) transitionToStateEstablishedLocked(s *segment) {
 	h.ep.rcvQueueMu.Unlock()
 
 	h.ep.setEndpointState(StateEstablished)
+	if h.ep.ecnEnabled {
+		h.ep.stack.Stats().TCP.ECNNegotiated.Increment()
+	}
 
 	// Completing the 3-way handshake is an indication that the route is valid
 	// and the remote is reachable as the only way we can complete a handshake
 	// is if our SYN reached the remote and their ACK reached us.
 	h.ep.route.ConfirmReachable()
 
+	h.queueFastOpenData(fastOpenAcked)
+
 	// Tell waiters that the endpoint is connected and writable.
 	h.ep.waiterQueue.Notify(waiter.WritableEvents)
 }
@@ -744,7 +820,7 @@ func putOptions(options []byte) {
 	optionPool.Put(optionsToArray(options))
 }
 
-func makeSynOptions(opts header.TCPSynOptions) []byte {
+func makeSynOptions(opts header.TCPSynOptions, md5 bool) []byte {
 	// Emulate linux option order. This is as follows:
 	//
 	// if md5: NOP NOP MD5SIG 18 md5sig(16)
@@ -762,9 +838,18 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 	//	cookie(variable) [padding to four bytes]
 	//
 	options := getOptions()
+	offset := 0
+
+	// The digest of the MD5 signature option is filled in once the segment
+	// is built.
+	if md5 {
+		offset += header.EncodeNOP(options[offset:])
+		offset += header.EncodeNOP(options[offset:])
+		offset += header.EncodeMD5Option(options[offset:])
+	}
 
 	// Always encode the mss.
-	offset := header.EncodeMSSOption(uint32(opts.MSS), options)
+	offset += header.EncodeMSSOption(uint32(opts.MSS), options[offset:])
 
 	// Special ordering is required here. If both TS and SACK are enabled,
 	// then the SACK option precedes TS, with no padding. If they are
@@ -788,13 +873,18 @@ func makeSynOptions(opts header.TCPSynOptions) []byte {
 		offset += header.EncodeWSOption(opts.WS, options[offset:])
 	}
 
+	if opts.FastOpen {
+		offset += header.EncodeFastOpenOption(opts.FastOpenCookie, options[offset:])
+	}
+
 	// Padding to the end; note that this never apply unless we add a
 	// fastopen option, we always expect the offset to remain the same.
-	if delta := header.AddTCPOptionPadding(options, offset); delta != 0 {
+	delta := header.AddTCPOptionPadding(options, offset)
+	if delta != 0 && !opts.FastOpen {
 		panic("unexpected option encoding")
 	}
 
-	return options[:offset]
+	return options[:offset+delta]
 }
 
 // tcpFields is a struct to carry different parameters required by the
@@ -809,13 +899,31 @@ type tcpFields struct {
 	rcvWnd seqnum.Size
 	opts   []byte
 	txHash uint32
+	mark   uint32
 	df     bool
+
+	// xfrmBypass is set if the segment bypasses the IPsec output policy.
+	xfrmBypass bool
+
+	// md5Key is the key used to sign the segment, if opts has an MD5
+	// signature option.
+	md5Key []byte
 }
 
 func (e *Endpoint) sendSynTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOptions) tcpip.Error {
-	tf.opts = makeSynOptions(opts)
+	return e.sendSynDataTCP(r, tf, opts, buffer.Buffer{})
+}
+
+// sendSynDataTCP sends a SYN or SYN-ACK carrying data, as is done by TCP Fast
+// Open. The data is not consumed.
+func (e *Endpoint) sendSynDataTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOptions, data buffer.Buffer) tcpip.Error {
+	tf.md5Key = e.md5Keys.lookup(tf.id.RemoteAddress, r.NICID())
+	tf.opts = makeSynOptions(opts, tf.md5Key != nil)
 	// We ignore SYN send errors and let the callers re-attempt send.
-	p := stack.NewPacketBuffer(stack.PacketBufferOptions{ReserveHeaderBytes: header.TCPMinimumSize + int(r.MaxHeaderLength()) + len(tf.opts)})
+	p := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.TCPMinimumSize + int(r.MaxHeaderLength()) + len(tf.opts),
+		Payload:            data.Clone(),
+	})
 	defer p.DecRef()
 	if err := e.sendTCP(r, tf, p, stack.GSO{}); err != nil {
 		e.stats.SendErrors.SynSendToNetworkFailed.Increment()
@@ -827,6 +935,8 @@ func (e *Endpoint) sendSynTCP(r *stack.Route, tf tcpFields, opts header.TCPSynOp
 // This method takes ownership of pkt.
 func (e *Endpoint) sendTCP(r *stack.Route, tf tcpFields, pkt *stack.PacketBuffer, gso stack.GSO) tcpip.Error {
 	tf.txHash = e.txHash
+	tf.mark = e.ops.GetMark()
+	tf.xfrmBypass = e.ops.GetXFRMOutputBypass()
 	if err := sendTCP(r, tf, pkt, gso, e.owner); err != nil {
 		e.stats.SendErrors.SegmentSendToNetworkFailed.Increment()
 		return err
@@ -849,6 +959,9 @@ func buildTCPHdr(r *stack.Route, tf tcpFields, pkt *stack.PacketBuffer, gso stac
 		WindowSize: uint16(tf.rcvWnd),
 	})
 	copy(tcp[header.TCPMinimumSize:], tf.opts)
+	if tf.md5Key != nil {
+		signTCPHdr(r, tcp, pkt, tf.md5Key)
+	}
 
 	xsum := r.PseudoHeaderChecksum(ProtocolNumber, uint16(pkt.Size()))
 	// Only calculate the checksum if offloading isn't supported.
@@ -893,6 +1006,8 @@ func sendTCPBatch(r *stack.Route, tf tcpFields, pkt *stack.PacketBuffer, gso sta
 		}
 		pkt.Hash = tf.txHash
 		pkt.Owner = owner
+		pkt.Mark = tf.mark
+		pkt.XFRMBypass = tf.xfrmBypass
 
 		buildTCPHdr(r, tf, pkt, gso)
 		tf.seq = tf.seq.Add(seqnum.Size(packetSize))
@@ -927,6 +1042,8 @@ func sendTCP(r *stack.Route, tf tcpFields, pkt *stack.PacketBuffer, gso stack.GS
 	pkt.GSOOptions = gso
 	pkt.Hash = tf.txHash
 	pkt.Owner = owner
+	pkt.Mark = tf.mark
+	pkt.XFRMBypass = tf.xfrmBypass
 	buildTCPHdr(r, tf, pkt, gso)
 
 	if err := r.WritePacket(stack.NetworkHeaderParams{Protocol: ProtocolNumber, TTL: tf.ttl, TOS: tf.tos, DF: tf.df}, pkt); err != nil {
@@ -940,14 +1057,20 @@ func sendTCP(r *stack.Route, tf tcpFields, pkt *stack.PacketBuffer, gso stack.GS
 	return nil
 }
 
-// makeOptions makes an options slice.
-func (e *Endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
+// makeOptions makes an options slice. If md5 is true, it starts with an MD5
+// signature option whose digest is filled in once the segment is built.
+func (e *Endpoint) makeOptions(sackBlocks []header.SACKBlock, md5 bool) []byte {
 	options := getOptions()
 	offset := 0
 
 	// N.B. the ordering here matches the ordering used by Linux internally
 	// and described in the raw makeOptions function. We don't include
 	// unnecessary cases here (post connection.)
+	if md5 {
+		offset += header.EncodeNOP(options[offset:])
+		offset += header.EncodeNOP(options[offset:])
+		offset += header.EncodeMD5Option(options[offset:])
+	}
 	if e.SendTSOk {
 		// Embed the timestamp if timestamp has been enabled.
 		//
@@ -965,7 +1088,10 @@ func (e *Endpoint) makeOptions(sackBlocks []header.SACKBlock) []byte {
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeTSOption(e.tsValNow(), e.recentTimestamp(), options[offset:])
 	}
-	if e.SACKPermitted && len(sackBlocks) > 0 {
+	// Like Linux, leave out the SACK blocks if there is no room for at
+	// least one: the two NOPs, the option kind and length, and an 8-byte
+	// block.
+	if e.SACKPermitted && len(sackBlocks) > 0 && len(options)-offset >= 2+2+8 {
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeNOP(options[offset:])
 		offset += header.EncodeSACKBlocks(sackBlocks, options[offset:])
@@ -999,19 +1125,25 @@ func (e *Endpoint) sendRaw(pkt *stack.PacketBuffer, flags header.TCPFlags, seq,
 	if e.EndpointState() == StateEstablished && e.rcv.pendingRcvdSegments.Len() > 0 && (flags&header.TCPFlagAck != 0) {
 		sackBlocks = e.sack.Blocks[:e.sack.NumBlocks]
 	}
-	options := e.makeOptions(sackBlocks)
+	md5Key := e.md5Key()
+	options := e.makeOptions(sackBlocks, md5Key != nil)
 	defer putOptions(options)
 	pkt.ReserveHeaderBytes(header.TCPMinimumSize + int(e.route.MaxHeaderLength()) + len(options))
+	tos := e.sendTOS
+	if e.ecnEnabled {
+		flags, tos = e.ecnFlagsAndTOS(pkt, flags, seq)
+	}
 	return e.sendTCP(e.route, tcpFields{
 		id:     e.TransportEndpointInfo.ID,
 		ttl:    calculateTTL(e.route, e.ipv4TTL, e.ipv6HopLimit),
-		tos:    e.sendTOS,
+		tos:    tos,
 		flags:  flags,
 		seq:    seq,
 		ack:    ack,
 		rcvWnd: rcvWnd,
 		opts:   options,
 		df:     e.pmtud == tcpip.PMTUDiscoveryWant || e.pmtud == tcpip.PMTUDiscoveryDo,
+		md5Key: md5Key,
 	}, pkt, e.gso)
 }
 
@@ -1402,8 +1534,12 @@ func (e *Endpoint) handshakeFailed(err tcpip.Error) {
 	// transitions out of Listen state by the time the SYN is processed. In
 	// such cases the handshake is never initialized and the newly created
 	// endpoint is closed right away.
-	if e.h != nil && e.h.retransmitTimer != nil {
-		e.h.retransmitTimer.stop()
+	if e.h != nil {
+		if e.h.retransmitTimer != nil {
+			e.h.retransmitTimer.stop()
+		}
+		// Drop the data that was to be sent in a Fast Open SYN.
+		e.h.fastOpenData.Release()
 	}
 	e.hardError = err
 	e.cleanupLocked()
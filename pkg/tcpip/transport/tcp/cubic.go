@@ -295,6 +295,15 @@ func (c *cubicState) PostRecovery() {
 	c.T = c.s.ep.stack.Clock().NowMonotonic()
 }
 
+// HandleECNEcho implements congestionControl.HandleECNEcho.
+func (c *cubicState) HandleECNEcho() {
+	// See: https://tools.ietf.org/html/rfc8312#section-4.5. An ECN-Echo is a
+	// congestion event like a detected loss, except that nothing needs to be
+	// retransmitted so the window is reduced right away.
+	c.HandleLossDetected()
+	c.s.SndCwnd = c.s.Ssthresh
+}
+
 // reduceSlowStartThreshold returns new SsThresh as described in
 // https://tools.ietf.org/html/rfc8312#section-4.7.
 func (c *cubicState) reduceSlowStartThreshold() {
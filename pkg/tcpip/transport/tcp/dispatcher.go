@@ -106,6 +106,13 @@ func deliverAccepted(ep *Endpoint) bool {
 	lEP := ep.h.listenEP
 	lEP.acceptMu.Lock()
 
+	// A Fast Open endpoint was delivered when its handshake started.
+	if ep.h.fastOpen {
+		lEP.acceptMu.Unlock()
+		ep.leaveFastOpenQueue()
+		return true
+	}
+
 	// Remove endpoint from list of pendingEndpoints as the handshake is now
 	// complete.
 	delete(lEP.acceptQueue.pendingEndpoints, ep)
@@ -441,6 +448,16 @@ func (d *dispatcher) queuePacket(stackEP stack.TransportEndpoint, id stack.Trans
 		return
 	}
 
+	if !ep.checkMD5(s) {
+		return
+	}
+
+	// The socket filter can only accept or drop a segment, truncating it is
+	// not supported.
+	if _, ok := stack.FilterSince(&ep.ops, pkt.TransportHeader()); !ok {
+		return
+	}
+
 	ep.stack.Stats().TCP.ValidSegmentsReceived.Increment()
 	ep.stats.SegmentsReceived.Increment()
 	if (s.flags & header.TCPFlagRst) != 0 {
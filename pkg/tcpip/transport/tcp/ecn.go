@@ -0,0 +1,115 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// ecnSetupFlags are the flags set on an ECN-setup SYN. An ECN-setup SYN-ACK
+// only carries ECE. See RFC 3168 section 6.1.1.
+const ecnSetupFlags = header.TCPFlagEce | header.TCPFlagCwr
+
+// isECNSetupSyn returns true if flags are those of an ECN-setup SYN.
+func isECNSetupSyn(flags header.TCPFlags) bool {
+	return flags&ecnSetupFlags == ecnSetupFlags
+}
+
+// isECNSetupSynAck returns true if flags are those of an ECN-setup SYN-ACK.
+func isECNSetupSynAck(flags header.TCPFlags) bool {
+	return flags&ecnSetupFlags == header.TCPFlagEce
+}
+
+// ecnOption returns the ECN setting of the stack.
+func (e *Endpoint) ecnOption() tcpip.TCPECNOption {
+	var v tcpip.TCPECNOption
+	if err := e.stack.TransportProtocolOption(ProtocolNumber, &v); err != nil {
+		return tcpip.TCPECNDisabled
+	}
+	return v
+}
+
+// maybeEnableECN enables ECN for a passively opened endpoint if the stack
+// accepts ECN and the peer sent an ECN-setup SYN.
+//
+// +checklocks:e.mu
+func (e *Endpoint) maybeEnableECN(s *segment) {
+	if isECNSetupSyn(s.flags) && e.ecnOption() != tcpip.TCPECNDisabled {
+		e.ecnEnabled = true
+	}
+}
+
+// ecnFlagsAndTOS returns the flags and TOS with which a segment is sent on a
+// connection that negotiated ECN. Only new data is sent as ECN-capable; pure
+// ACKs, window probes and retransmissions are not, as per RFC 3168 sections
+// 6.1.4 and 6.1.5.
+//
+// +checklocks:e.mu
+// +checklocksalias:e.snd.ep.mu=e.mu
+// +checklocksalias:e.rcv.ep.mu=e.mu
+func (e *Endpoint) ecnFlagsAndTOS(pkt *stack.PacketBuffer, flags header.TCPFlags, seq seqnum.Value) (header.TCPFlags, uint8) {
+	tos := e.sendTOS
+	if flags&header.TCPFlagRst != 0 || e.snd == nil || e.rcv == nil {
+		return flags, tos
+	}
+	if e.rcv.ecnEcho {
+		flags |= header.TCPFlagEce
+	}
+	if pkt.Data().Size() > 0 && !seq.LessThan(e.snd.SndNxt) {
+		tos |= header.ECNECT0
+		if e.snd.ecnCWR {
+			flags |= header.TCPFlagCwr
+			e.snd.ecnCWR = false
+		}
+	}
+	return flags, tos
+}
+
+// updateECN tracks congestion experienced marks on received data segments
+// until the peer signals that it reduced its congestion window, as per
+// RFC 3168 section 6.1.3.
+//
+// +checklocks:r.ep.mu
+func (r *receiver) updateECN(s *segment) {
+	if s.payloadSize() == 0 {
+		return
+	}
+	if s.flags.Contains(header.TCPFlagCwr) {
+		r.ecnEcho = false
+	}
+	if s.ecn == header.ECNCE {
+		r.ecnEcho = true
+		r.ep.stack.Stats().TCP.CESegmentsReceived.Increment()
+	}
+}
+
+// handleECNEcho reduces the congestion window in response to an ECN-Echo from
+// the peer. The window is reduced at most once per window of data and not at
+// all while recovering from loss, which already reduced it. See RFC 3168
+// section 6.1.2.
+//
+// +checklocks:s.ep.mu
+func (s *sender) handleECNEcho() {
+	if s.inRecovery() || s.SndUna.LessThan(s.ecnRecover) {
+		return
+	}
+	s.cc.HandleECNEcho()
+	s.ecnRecover = s.SndNxt
+	s.ecnCWR = true
+	s.ep.stack.Stats().TCP.ECNReductions.Increment()
+}
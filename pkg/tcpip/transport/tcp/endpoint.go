@@ -514,6 +514,25 @@ type Endpoint struct {
 	// listener.
 	deferAccept time.Duration
 
+	// fastOpenQLen if non-zero enables TCP Fast Open on a listening endpoint
+	// and is the maximum number of Fast Open connections that may be pending
+	// completion of the 3-way handshake. It is set by TCP_FASTOPEN.
+	fastOpenQLen int
+
+	// fastOpenConnect is true if connect should defer sending the SYN until
+	// data is written, so that the data can be sent in the SYN. It is set by
+	// TCP_FASTOPEN_CONNECT.
+	fastOpenConnect bool
+
+	// fastOpenDeferred is true if the SYN of an active Fast Open handshake
+	// is deferred until data is written. It is read without e.mu by
+	// Readiness.
+	fastOpenDeferred atomicbitops.Bool
+
+	// md5Keys holds the keys used to sign and verify segments with the TCP
+	// MD5 signature option. They are set by TCP_MD5SIG and TCP_MD5SIG_EXT.
+	md5Keys md5Keys
+
 	// acceptMu protects accepQueue
 	acceptMu sync.Mutex `state:"nosave"`
 
@@ -553,6 +572,10 @@ type Endpoint struct {
 	// applied while sending packets. Defaults to 0 as on Linux.
 	sendTOS uint8
 
+	// ecnEnabled is true if Explicit Congestion Notification was negotiated
+	// during the handshake, as per RFC 3168 section 6.1.1.
+	ecnEnabled bool
+
 	gso stack.GSO
 
 	stats Stats
@@ -934,8 +957,23 @@ func (e *Endpoint) Readiness(mask waiter.EventMask) waiter.EventMask {
 		// connected when SO_LINGER is set.
 		result |= waiter.EventHUp
 
-	case StateConnecting, StateSynSent, StateSynRecv:
-		// Ready for nothing.
+	case StateConnecting, StateSynSent:
+		// Ready for nothing, unless the SYN waits for data to be written
+		// as is done by TCP_FASTOPEN_CONNECT.
+		if e.fastOpenDeferred.Load() {
+			result |= mask & waiter.WritableEvents
+		}
+
+	case StateSynRecv:
+		// A Fast Open endpoint may be accepted in SYN-RCVD state with
+		// the data of the SYN.
+		if (mask & waiter.ReadableEvents) != 0 {
+			e.rcvQueueMu.Lock()
+			if e.RcvBufUsed > 0 {
+				result |= waiter.ReadableEvents
+			}
+			e.rcvQueueMu.Unlock()
+		}
 
 	case StateClose, StateError, StateTimeWait:
 		// Ready for anything.
@@ -1048,6 +1086,21 @@ func (e *Endpoint) Abort() {
 	e.closeLocked()
 }
 
+// Destroy aborts the connection of the endpoint like Abort, except that users
+// of the endpoint get ErrConnectionAborted. It implements SOCK_DESTROY, see
+// net/ipv4/tcp.c:tcp_abort.
+func (e *Endpoint) Destroy() {
+	defer e.drainClosingSegmentQueue()
+	e.LockUser()
+	defer e.UnlockUser()
+	if e.EndpointState().connected() {
+		e.resetConnectionLocked(&tcpip.ErrConnectionAborted{})
+		e.waiterQueue.Notify(waiter.EventHUp | waiter.EventErr | waiter.ReadableEvents | waiter.WritableEvents)
+		return
+	}
+	e.closeLocked()
+}
+
 // Close puts the endpoint in a closed state and frees all resources associated
 // with it. It must be called only once and with no other concurrent calls to
 // the endpoint.
@@ -1189,6 +1242,7 @@ func (e *Endpoint) cleanupLocked() {
 		e.snd.probeTimer.cleanup()
 		e.snd.reorderTimer.cleanup()
 		e.snd.corkTimer.cleanup()
+		e.snd.pacingTimer.cleanup()
 	}
 
 	if e.finWait2Timer != nil {
@@ -1203,6 +1257,7 @@ func (e *Endpoint) cleanupLocked() {
 	// the client.
 	e.closePendingAcceptableConnectionsLocked()
 	e.keepalive.timer.cleanup()
+	e.leaveFastOpenQueue()
 
 	if e.isRegistered {
 		e.stack.StartTransportEndpointCleanup(e.effectiveNetProtos, ProtocolNumber, e.TransportEndpointInfo.ID, e, e.boundPortFlags, e.boundBindToDevice)
@@ -1488,7 +1543,10 @@ func (e *Endpoint) checkReadLocked() tcpip.Error {
 	// An application can initiate a non-blocking connect and then block
 	// on a receive. It can expect to read any data after the handshake
 	// is complete. RFC793, section 3.9, p58.
-	if e.EndpointState() == StateSynSent {
+	//
+	// Likewise for a Fast Open endpoint that was accepted in SYN-RCVD
+	// state once it has no data left from the SYN.
+	if s := e.EndpointState(); s == StateSynSent || s == StateSynRecv && e.RcvBufUsed == 0 {
 		return &tcpip.ErrWouldBlock{}
 	}
 
@@ -1651,6 +1709,15 @@ func (e *Endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 	e.LockUser()
 	defer e.UnlockUser()
 
+	if opts.FastOpen {
+		if err := e.connectFastOpen(opts.To); err != nil {
+			return 0, err
+		}
+	}
+	if h := e.h; h != nil && e.fastOpenDeferred.Load() && e.EndpointState() == StateSynSent {
+		return e.sendFastOpenSyn(h, p, opts) // +checklocksforce:h.ep.mu
+	}
+
 	// Return if either we didn't queue anything or if an error occurred while
 	// attempting to queue data.
 	nextSeg, n, err := e.queueSegment(p, opts)
@@ -1852,9 +1919,6 @@ func (e *Endpoint) WakeupWriters() {
 
 // SetSockOptInt sets a socket option.
 func (e *Endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
-	// Lower 2 bits represents ECN bits. RFC 3168, section 23.1
-	const inetECNMask = 3
-
 	switch opt {
 	case tcpip.KeepaliveCountOption:
 		e.LockUser()
@@ -1866,16 +1930,16 @@ func (e *Endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
 
 	case tcpip.IPv4TOSOption:
 		e.LockUser()
-		// TODO(gvisor.dev/issue/995): ECN is not currently supported,
-		// ignore the bits for now.
-		e.sendTOS = uint8(v) & ^uint8(inetECNMask)
+		// The ECN bits are owned by TCP once ECN is negotiated, see
+		// RFC 3168 section 6.1.
+		e.sendTOS = uint8(v) & ^uint8(header.ECNMask)
 		e.UnlockUser()
 
 	case tcpip.IPv6TrafficClassOption:
 		e.LockUser()
-		// TODO(gvisor.dev/issue/995): ECN is not currently supported,
-		// ignore the bits for now.
-		e.sendTOS = uint8(v) & ^uint8(inetECNMask)
+		// The ECN bits are owned by TCP once ECN is negotiated, see
+		// RFC 3168 section 6.1.
+		e.sendTOS = uint8(v) & ^uint8(header.ECNMask)
 		e.UnlockUser()
 
 	case tcpip.MaxSegOption:
@@ -1941,6 +2005,35 @@ func (e *Endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
 		e.LockUser()
 		e.windowClamp = uint32(v)
 		e.UnlockUser()
+
+	case tcpip.TCPFastOpenQueueLenOption:
+		if v < 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.LockUser()
+		defer e.UnlockUser()
+		switch e.EndpointState() {
+		case StateInitial, StateBound, StateClose, StateListen:
+			e.fastOpenQLen = v
+		default:
+			return &tcpip.ErrInvalidEndpointState{}
+		}
+
+	case tcpip.TCPFastOpenConnectOption:
+		if v != 0 && v != 1 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		if e.fastOpenOption()&tcpip.TCPFastOpenClient == 0 {
+			return &tcpip.ErrNotSupported{}
+		}
+		e.LockUser()
+		defer e.UnlockUser()
+		switch e.EndpointState() {
+		case StateInitial, StateBound, StateClose:
+			e.fastOpenConnect = v != 0
+		default:
+			return &tcpip.ErrInvalidEndpointState{}
+		}
 	}
 	return nil
 }
@@ -2026,6 +2119,9 @@ func (e *Endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 		e.tcpLingerTimeout = time.Duration(*v)
 		e.UnlockUser()
 
+	case *tcpip.TCPMD5SigOption:
+		return e.setMD5Key(v)
+
 	case *tcpip.TCPDeferAcceptOption:
 		e.LockUser()
 		if time.Duration(*v) > MaxRTO {
@@ -2034,9 +2130,6 @@ func (e *Endpoint) SetSockOpt(opt tcpip.SettableSocketOption) tcpip.Error {
 		e.deferAccept = time.Duration(*v)
 		e.UnlockUser()
 
-	case *tcpip.SocketDetachFilterOption:
-		return nil
-
 	default:
 		return nil
 	}
@@ -2126,6 +2219,21 @@ func (e *Endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 		e.UnlockUser()
 		return v, nil
 
+	case tcpip.TCPFastOpenQueueLenOption:
+		e.LockUser()
+		v := e.fastOpenQLen
+		e.UnlockUser()
+		return v, nil
+
+	case tcpip.TCPFastOpenConnectOption:
+		e.LockUser()
+		v := 0
+		if e.fastOpenConnect {
+			v = 1
+		}
+		e.UnlockUser()
+		return v, nil
+
 	case tcpip.MulticastTTLOption:
 		return 1, nil
 
@@ -2158,6 +2266,7 @@ func (e *Endpoint) getTCPInfo() tcpip.TCPInfoOption {
 		info.SndCwnd = uint32(snd.SndCwnd)
 		info.ReorderSeen = snd.rc.Reord
 	}
+	info.ECN = e.ecnEnabled
 	e.UnlockUser()
 	return info
 }
@@ -2237,7 +2346,15 @@ func (*Endpoint) Disconnect() tcpip.Error {
 func (e *Endpoint) Connect(addr tcpip.FullAddress) tcpip.Error {
 	e.LockUser()
 	defer e.UnlockUser()
-	err := e.connect(addr, true)
+	return e.connectLocked(addr, e.fastOpenConnect)
+}
+
+// connectLocked connects the endpoint to its peer. If fastOpen is true, the
+// SYN may be deferred until data is written so that it carries the data.
+//
+// +checklocks:e.mu
+func (e *Endpoint) connectLocked(addr tcpip.FullAddress, fastOpen bool) tcpip.Error {
+	err := e.connect(addr, true /* handshake */, fastOpen)
 	if err != nil {
 		if !err.IgnoreStats() {
 			// Connect failed. Let's wake up any waiters.
@@ -2385,7 +2502,7 @@ func (e *Endpoint) registerEndpoint(addr tcpip.FullAddress, netProto tcpip.Netwo
 
 // connect connects the endpoint to its peer.
 // +checklocks:e.mu
-func (e *Endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
+func (e *Endpoint) connect(addr tcpip.FullAddress, handshake, fastOpen bool) tcpip.Error {
 	connectingAddr := addr.Addr
 
 	addr, netProto, err := e.checkV4MappedLocked(addr, false /* bind */)
@@ -2439,7 +2556,11 @@ func (e *Endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
 	}
 
 	// Find a route to the desired destination.
-	r, err := e.stack.FindRoute(nicID, e.TransportEndpointInfo.ID.LocalAddress, addr.Addr, netProto, false /* multicastLoop */)
+	flow := stack.RouteFlow{Mark: e.ops.GetMark(), Transparent: e.ops.GetTransparent()}
+	if e.owner != nil {
+		flow.UID = e.owner.KUID()
+	}
+	r, err := e.stack.FindRouteForFlow(nicID, e.TransportEndpointInfo.ID.LocalAddress, addr.Addr, netProto, false /* multicastLoop */, flow)
 	if err != nil {
 		return err
 	}
@@ -2491,8 +2612,13 @@ func (e *Endpoint) connect(addr tcpip.FullAddress, handshake bool) tcpip.Error {
 	// Start a new handshake.
 	h := e.newHandshake()
 	e.setEndpointState(StateSynSent)
-	h.start()
 	e.stack.Stats().TCP.ActiveConnectionOpenings.Increment()
+	if fastOpen && e.deferFastOpenSyn(h) {
+		// Like Linux, report the endpoint as connected. The SYN is sent
+		// by the first write.
+		return nil
+	}
+	h.start()
 
 	return &tcpip.ErrConnectStarted{}
 }
@@ -2760,11 +2886,15 @@ func (e *Endpoint) bindLocked(addr tcpip.FullAddress) (err tcpip.Error) {
 
 	var nic tcpip.NICID
 	// If an address is specified, we must ensure that it's one of our
-	// local addresses.
+	// local addresses, unless the endpoint is transparent or may bind to
+	// addresses that are not assigned to the stack.
 	if addr.Addr.Len() != 0 {
 		nic = e.stack.CheckLocalAddress(addr.NIC, netProto, addr.Addr)
 		if nic == 0 {
-			return &tcpip.ErrBadLocalAddress{}
+			if !e.ops.GetTransparent() && !e.ops.GetFreeBind() {
+				return &tcpip.ErrBadLocalAddress{}
+			}
+			nic = addr.NIC
 		}
 		e.TransportEndpointInfo.ID.LocalAddress = addr.Addr
 	}
@@ -3135,7 +3265,7 @@ func (e *Endpoint) maybeEnableSACKPermitted(synOpts header.TCPSynOptions) {
 // maxOptionSize return the maximum size of TCP options.
 func (e *Endpoint) maxOptionSize() (size int) {
 	var maxSackBlocks [header.TCPMaxSACKBlocks]header.SACKBlock
-	options := e.makeOptions(maxSackBlocks[:])
+	options := e.makeOptions(maxSackBlocks[:], e.md5Key() != nil)
 	size = len(options)
 	putOptions(options)
 
@@ -3201,6 +3331,10 @@ func (e *Endpoint) initHostGSO() {
 }
 
 func (e *Endpoint) initGSO() {
+	// Signed segments cannot be split without being signed again.
+	if e.md5Key() != nil {
+		return
+	}
 	if e.route.HasHostGSOCapability() {
 		e.initHostGSO()
 	} else if e.route.HasGVisorGSOCapability() {
@@ -142,6 +142,7 @@ func (e *Endpoint) Restore(s *stack.Stack) {
 		snd.reorderTimer.init(s.Clock(), timerHandler(e, e.snd.rc.reorderTimerExpired))
 		snd.probeTimer.init(s.Clock(), timerHandler(e, e.snd.probeTimerExpired))
 		snd.corkTimer.init(s.Clock(), timerHandler(e, e.snd.corkTimerExpired))
+		snd.pacingTimer.init(s.Clock(), timerHandler(e, e.snd.pacingTimerExpired))
 	}
 	e.stack = s
 	e.protocol = protocolFromStack(s)
@@ -194,7 +195,7 @@ func (e *Endpoint) Restore(s *stack.Stack) {
 		// we do not restore SACK information.
 		e.scoreboard.Reset()
 		e.mu.Lock()
-		err := e.connect(tcpip.FullAddress{NIC: e.boundNICID, Addr: e.connectingAddress, Port: e.TransportEndpointInfo.ID.RemotePort}, false /* handshake */)
+		err := e.connect(tcpip.FullAddress{NIC: e.boundNICID, Addr: e.connectingAddress, Port: e.TransportEndpointInfo.ID.RemotePort}, false /* handshake */, false /* fastOpen */)
 		if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
 			panic("endpoint connecting failed: " + err.String())
 		}
@@ -213,6 +214,11 @@ func (e *Endpoint) Restore(s *stack.Stack) {
 			// drain all the segments in the queue after restore.
 			e.snd.corkTimer.enable(MinRTO)
 		}
+		if snd := e.snd; snd != nil && snd.writeNext != nil && snd.pacingRate() != 0 {
+			// Rearm the pacing timer, as segments held back by pacing
+			// may have nothing in flight to clock them out.
+			snd.pacingTimer.enable(max(snd.pacingNext.Sub(e.stack.Clock().NowMonotonic()), 0))
+		}
 		e.mu.Unlock()
 		connectedLoading.Done()
 	case epState == StateListen:
@@ -258,7 +264,11 @@ func (e *Endpoint) Restore(s *stack.Stack) {
 		e.mu.Lock()
 		defer e.mu.Unlock()
 		e.setEndpointState(epState)
-		r, err := e.stack.FindRoute(e.boundNICID, e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.RemoteAddress, e.effectiveNetProtos[0], false /* multicastLoop */)
+		flow := stack.RouteFlow{Mark: e.ops.GetMark(), Transparent: e.ops.GetTransparent()}
+		if e.owner != nil {
+			flow.UID = e.owner.KUID()
+		}
+		r, err := e.stack.FindRouteForFlow(e.boundNICID, e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.RemoteAddress, e.effectiveNetProtos[0], false /* multicastLoop */, flow)
 		if err != nil {
 			panic(fmt.Sprintf("FindRoute failed when restoring endpoint w/ ID: %+v", e.ID))
 		}
@@ -0,0 +1,316 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+const (
+	// fastOpenCookieSize is the size of the Fast Open cookies generated by
+	// listeners. This mirrors TCP_FASTOPEN_COOKIE_SIZE in Linux.
+	fastOpenCookieSize = 8
+
+	// maxFastOpenCacheEntries is the maximum number of peers whose Fast Open
+	// cookie is cached.
+	maxFastOpenCacheEntries = 1024
+)
+
+// fastOpenCacheEntry is the Fast Open state cached for a peer.
+//
+// +stateify savable
+type fastOpenCacheEntry struct {
+	// cookie is the cookie last received from the peer.
+	cookie []byte
+
+	// mss is the MSS advertised by the peer along with the cookie.
+	mss uint16
+}
+
+// fastOpenCache caches the Fast Open cookies received from peers, so that
+// later connections to them can send data in the SYN. See RFC 7413 section
+// 4.1.3.
+//
+// +stateify savable
+type fastOpenCache struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// +checklocks:mu
+	entries map[tcpip.Address]fastOpenCacheEntry
+}
+
+// get returns the entry cached for addr.
+func (c *fastOpenCache) get(addr tcpip.Address) (fastOpenCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[addr]
+	return e, ok
+}
+
+// set caches cookie and mss for addr, evicting an arbitrary entry if the
+// cache is full.
+func (c *fastOpenCache) set(addr tcpip.Address, cookie []byte, mss uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[tcpip.Address]fastOpenCacheEntry)
+	}
+	if _, ok := c.entries[addr]; !ok && len(c.entries) >= maxFastOpenCacheEntries {
+		for a := range c.entries {
+			delete(c.entries, a)
+			break
+		}
+	}
+	c.entries[addr] = fastOpenCacheEntry{cookie: cookie, mss: mss}
+}
+
+// fastOpenCookie returns the Fast Open cookie of the peer of id. Cookies are a
+// keyed hash of the addresses of the connection, as per RFC 7413 section
+// 4.1.2, so they remain valid for as long as the stack exists.
+func (p *protocol) fastOpenCookie(id stack.TransportEndpointID) []byte {
+	h := sha256.New()
+
+	// Per hash.Hash.Writer:
+	//
+	// It never returns an error.
+	_, _ = h.Write(p.fastOpenSecret[:])
+	_, _ = h.Write(id.RemoteAddress.AsSlice())
+	_, _ = h.Write(id.LocalAddress.AsSlice())
+	return h.Sum(nil)[:fastOpenCookieSize]
+}
+
+// fastOpenOption returns the Fast Open setting of the stack.
+func (e *Endpoint) fastOpenOption() tcpip.TCPFastOpenOption {
+	var v tcpip.TCPFastOpenOption
+	if err := e.stack.TransportProtocolOption(ProtocolNumber, &v); err != nil {
+		return 0
+	}
+	return v
+}
+
+// handleFastOpenSyn handles the Fast Open option of a SYN received by a
+// listener. If the SYN carries a valid cookie, its data is acknowledged in the
+// SYN-ACK and h is marked so that the endpoint is delivered to the listener
+// right away. Otherwise, a cookie is sent in the SYN-ACK if the peer requested
+// one or sent an invalid one. See RFC 7413 section 4.2.2.
+//
+// +checklocks:l.listenEP.mu
+// +checklocks:l.listenEP.acceptMu
+// +checklocks:h.ep.mu
+func (l *listenContext) handleFastOpenSyn(h *handshake, s *segment, opts header.TCPSynOptions) {
+	lEP := l.listenEP
+	if lEP == nil || lEP.fastOpenQLen == 0 {
+		return
+	}
+	fo := h.ep.fastOpenOption()
+	if fo&tcpip.TCPFastOpenServer == 0 || !opts.FastOpen && s.payloadSize() == 0 {
+		return
+	}
+	// Like Linux, there is no room left for the Fast Open option in a
+	// signed SYN-ACK.
+	if h.ep.md5Key() != nil {
+		return
+	}
+	stats := l.stack.Stats().TCP
+	if lEP.acceptQueue.fastOpenPending >= lEP.fastOpenQLen {
+		stats.FastOpenListenOverflow.Increment()
+		return
+	}
+
+	if fo&tcpip.TCPFastOpenServerNoCookie == 0 {
+		if !opts.FastOpen {
+			return
+		}
+		cookie := l.protocol.fastOpenCookie(s.id)
+		if len(opts.FastOpenCookie) == 0 {
+			stats.FastOpenCookieReqd.Increment()
+			h.fastOpenOption, h.fastOpenCookie = true, cookie
+			return
+		}
+		if subtle.ConstantTimeCompare(opts.FastOpenCookie, cookie) != 1 {
+			stats.FastOpenPassiveFail.Increment()
+			h.fastOpenOption, h.fastOpenCookie = true, cookie
+			return
+		}
+	}
+
+	stats.FastOpenPassive.Increment()
+	h.fastOpen = true
+	h.fastOpenQueued = true
+	lEP.acceptQueue.fastOpenPending++
+	h.ackNum = h.ackNum.Add(seqnum.Size(s.payloadSize()))
+}
+
+// leaveFastOpenQueue stops counting a passive Fast Open endpoint towards the
+// listener's pending Fast Open connections, once it completed or failed its
+// handshake.
+//
+// +checklocks:e.mu
+func (e *Endpoint) leaveFastOpenQueue() {
+	h := e.h
+	if h == nil || !h.fastOpenQueued {
+		return
+	}
+	h.fastOpenQueued = false
+	lEP := h.listenEP
+	lEP.acceptMu.Lock()
+	lEP.acceptQueue.fastOpenPending--
+	lEP.acceptMu.Unlock()
+}
+
+// deferFastOpenSyn prepares the active handshake h to use Fast Open. It
+// returns true if the SYN must be deferred until data is written, so that the
+// data is sent in it. That is the case if a cookie is cached for the peer, or
+// if the stack sends data in the SYN without one. Otherwise, the SYN requests a
+// cookie.
+//
+// +checklocks:e.mu
+// +checklocks:h.ep.mu
+func (e *Endpoint) deferFastOpenSyn(h *handshake) bool {
+	fo := e.fastOpenOption()
+	if fo&tcpip.TCPFastOpenClient == 0 || e.md5Key() != nil {
+		return false
+	}
+	if c, ok := e.protocol.fastOpenCache.get(e.TransportEndpointInfo.ID.RemoteAddress); ok {
+		h.fastOpenOption, h.fastOpenCookie = true, c.cookie
+	} else if fo&tcpip.TCPFastOpenClientNoCookie == 0 {
+		h.fastOpenOption = true
+		return false
+	}
+	e.fastOpenDeferred.Store(true)
+	h.retransmitTimer.stop()
+	return true
+}
+
+// fastOpenSynDataSize returns the maximum amount of data sent in a Fast Open
+// SYN. Like Linux, it leaves room for the largest TCP options.
+//
+// +checklocks:e.mu
+func (e *Endpoint) fastOpenSynDataSize() int {
+	mss := calculateAdvertisedMSS(e.userMSS, e.route)
+	peerMSS := uint16(header.TCPDefaultMSS)
+	if c, ok := e.protocol.fastOpenCache.get(e.TransportEndpointInfo.ID.RemoteAddress); ok && c.mss != 0 {
+		peerMSS = c.mss
+	}
+	if peerMSS < mss {
+		mss = peerMSS
+	}
+	return int(mss) - maxOptionSize
+}
+
+// sendFastOpenSyn sends the deferred SYN of the active Fast Open handshake h
+// along with as much data read from p as fits in it. It returns the amount of
+// data sent.
+//
+// +checklocks:e.mu
+// +checklocks:h.ep.mu
+func (e *Endpoint) sendFastOpenSyn(h *handshake, p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcpip.Error) {
+	// The lock is kept while copying the data so that the endpoint is
+	// still in SYN-SENT state when sending the SYN.
+	opts.Atomic = true
+	e.sndQueueInfo.sndQueueMu.Lock()
+	data, err := e.readFromPayloader(p, opts, e.fastOpenSynDataSize())
+	e.sndQueueInfo.sndQueueMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	h.fastOpenData = data
+	e.fastOpenDeferred.Store(false)
+	h.retransmitTimer.reinit(InitialRTO)
+	h.start()
+	return data.Size(), nil
+}
+
+// connectFastOpen connects the endpoint to addr for a write with the FastOpen
+// option, as is done by MSG_FASTOPEN.
+//
+// +checklocks:e.mu
+func (e *Endpoint) connectFastOpen(addr *tcpip.FullAddress) tcpip.Error {
+	if e.fastOpenOption()&tcpip.TCPFastOpenClient == 0 {
+		return &tcpip.ErrNotSupported{}
+	}
+	if addr == nil {
+		// Like Linux, fail as connect(2) would without an address.
+		if e.EndpointState().connected() {
+			return &tcpip.ErrAlreadyConnected{}
+		}
+		return &tcpip.ErrInvalidEndpointState{}
+	}
+	return e.connectLocked(*addr, true /* fastOpen */)
+}
+
+// handleFastOpenSynAck caches the Fast Open cookie carried by a SYN-ACK in
+// response to a SYN that had the Fast Open option.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) handleFastOpenSynAck(rcvSynOpts header.TCPSynOptions) {
+	if !h.fastOpenOption || !rcvSynOpts.FastOpen || len(rcvSynOpts.FastOpenCookie) == 0 {
+		return
+	}
+	h.ep.protocol.fastOpenCache.set(h.ep.TransportEndpointInfo.ID.RemoteAddress, rcvSynOpts.FastOpenCookie, rcvSynOpts.MSS)
+}
+
+// fastOpenAcked returns the amount of data sent in the SYN of an active Fast
+// Open handshake that is acknowledged by s.
+//
+// +checklocks:h.ep.mu
+func (h *handshake) fastOpenAcked(s *segment) seqnum.Size {
+	if !h.active || h.fastOpenData.Size() == 0 || !s.flags.Contains(header.TCPFlagAck) {
+		return 0
+	}
+	acked := (h.iss + 1).Size(s.ackNumber)
+	if int64(acked) > h.fastOpenData.Size() {
+		return 0
+	}
+	return acked
+}
+
+// queueFastOpenData queues the data sent in the SYN of an active Fast Open
+// handshake that was not acknowledged by the peer, so that it is sent once the
+// handshake completes.
+//
+// +checklocks:h.ep.mu
+// +checklocksalias:h.ep.snd.ep.mu=h.ep.mu
+func (h *handshake) queueFastOpenData(acked seqnum.Size) {
+	data := h.fastOpenData
+	h.fastOpenData = buffer.Buffer{}
+	if data.Size() == 0 {
+		return
+	}
+	e := h.ep
+	if int64(acked) == data.Size() {
+		data.Release()
+		e.stack.Stats().TCP.FastOpenActive.Increment()
+		return
+	}
+	e.stack.Stats().TCP.FastOpenActiveFail.Increment()
+	data.TrimFront(int64(acked))
+
+	s := newOutgoingSegment(e.TransportEndpointInfo.ID, e.stack.Clock(), data)
+	e.sndQueueInfo.sndQueueMu.Lock()
+	e.sndQueueInfo.SndBufUsed += int(data.Size())
+	e.snd.writeList.PushBack(s)
+	e.sndQueueInfo.sndQueueMu.Unlock()
+	e.sendData(s)
+}
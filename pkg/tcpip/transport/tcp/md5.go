@@ -0,0 +1,205 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"crypto/subtle"
+
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+// md5Key is a key used to sign and verify the segments exchanged with a set
+// of peers using the TCP MD5 signature option. See RFC 2385.
+//
+// +stateify savable
+type md5Key struct {
+	// addr and prefixLen select the peers the key is used with.
+	addr      tcpip.Address
+	prefixLen int
+
+	// nic, if non-zero, restricts the key to peers reached through the NIC.
+	nic tcpip.NICID
+
+	key []byte
+}
+
+// matches returns whether k is used with the peer at addr reached through
+// nic.
+func (k *md5Key) matches(addr tcpip.Address, nic tcpip.NICID) bool {
+	if k.nic != 0 && k.nic != nic || k.addr.Len() != addr.Len() {
+		return false
+	}
+	subnet := tcpip.AddressWithPrefix{Address: k.addr, PrefixLen: k.prefixLen}.Subnet()
+	return subnet.Contains(addr)
+}
+
+// md5Keys holds the TCP MD5 signature keys of an endpoint. It has its own
+// lock as incoming segments are verified without holding the endpoint lock.
+//
+// +stateify savable
+type md5Keys struct {
+	mu sync.RWMutex `state:"nosave"`
+
+	// +checklocks:mu
+	keys []md5Key
+}
+
+// set installs the key of opt, or removes the key previously installed for
+// the same peers if it is empty.
+func (m *md5Keys) set(opt *tcpip.TCPMD5SigOption) tcpip.Error {
+	if opt.PrefixLen < 0 || opt.PrefixLen > opt.Address.BitLen() {
+		return &tcpip.ErrInvalidOptionValue{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.keys {
+		k := &m.keys[i]
+		if k.addr != opt.Address || k.prefixLen != opt.PrefixLen || k.nic != opt.NIC {
+			continue
+		}
+		if len(opt.Key) == 0 {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+		} else {
+			k.key = append([]byte(nil), opt.Key...)
+		}
+		return nil
+	}
+	if len(opt.Key) == 0 {
+		// Like Linux, fail to remove a key that is not installed.
+		return &tcpip.ErrNoSuchFile{}
+	}
+	m.keys = append(m.keys, md5Key{
+		addr:      opt.Address,
+		prefixLen: opt.PrefixLen,
+		nic:       opt.NIC,
+		key:       append([]byte(nil), opt.Key...),
+	})
+	return nil
+}
+
+// lookup returns the key used with the peer at addr reached through nic, or
+// nil if there is none. Like Linux, the key with the longest prefix wins.
+func (m *md5Keys) lookup(addr tcpip.Address, nic tcpip.NICID) []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var best *md5Key
+	for i := range m.keys {
+		k := &m.keys[i]
+		if k.matches(addr, nic) && (best == nil || k.prefixLen > best.prefixLen) {
+			best = k
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.key
+}
+
+// inherit installs the key used by a listener with the peer at addr reached
+// through nic, if any, in the keys of an endpoint it accepted.
+func (m *md5Keys) inherit(l *md5Keys, addr tcpip.Address, nic tcpip.NICID) {
+	key := l.lookup(addr, nic)
+	if key == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = []md5Key{{
+		addr:      addr,
+		prefixLen: addr.BitLen(),
+		key:       key,
+	}}
+}
+
+// setMD5Key implements the TCPMD5SigOption socket option.
+func (e *Endpoint) setMD5Key(opt *tcpip.TCPMD5SigOption) tcpip.Error {
+	if opt.NIC != 0 && !e.stack.HasNIC(opt.NIC) {
+		return &tcpip.ErrUnknownNICID{}
+	}
+
+	e.LockUser()
+	defer e.UnlockUser()
+	if err := e.md5Keys.set(opt); err != nil {
+		return err
+	}
+
+	// Like Linux, stop using segmentation offload once the endpoint's
+	// segments are signed, as they can no longer be split without being
+	// signed again. The signature option also leaves less room for the
+	// payload.
+	if e.route == nil || e.md5Key() == nil {
+		return nil
+	}
+	e.gso = stack.GSO{}
+	if e.EndpointState().connected() {
+		e.snd.ep.AssertLockHeld(e)
+		e.snd.gso = false
+		e.snd.updateMaxPayloadSize(int(e.route.MTU()), 0)
+	}
+	return nil
+}
+
+// md5Key returns the key used to sign the segments exchanged with the
+// endpoint's peer, or nil if they are not signed.
+func (e *Endpoint) md5Key() []byte {
+	return e.md5Keys.lookup(e.TransportEndpointInfo.ID.RemoteAddress, e.route.NICID())
+}
+
+// signTCPHdr fills in the digest of the MD5 signature option of the segment
+// whose header tcp was pushed to pkt, as specified in RFC 2385 section 2.0.
+func signTCPHdr(r *stack.Route, tcp header.TCP, pkt *stack.PacketBuffer, key []byte) {
+	digest, ok := header.ParseMD5Option(tcp.Options())
+	if !ok {
+		panic("MD5 signature option missing from signed segment")
+	}
+	d := header.NewTCPMD5Hash(tcp, r.LocalAddress(), r.RemoteAddress(), pkt.Data().Size())
+	pkt.Data().ReadTo(d, true /* peek */)
+	d.Write(key)
+	d.Sum(digest[:0])
+}
+
+// checkMD5 returns whether the segment s may be delivered to the endpoint
+// given its MD5 signature option. Like Linux, segments lacking the signature
+// expected from the peer, carrying a signature while none is expected, or
+// carrying an invalid signature are dropped.
+func (e *Endpoint) checkMD5(s *segment) bool {
+	key := e.md5Keys.lookup(s.id.RemoteAddress, s.pkt.NICID)
+	digest, ok := header.ParseMD5Option(s.options)
+	stats := e.stack.Stats().TCP
+	switch {
+	case key == nil && !ok:
+		return true
+	case key == nil:
+		stats.MD5Unexpected.Increment()
+		return false
+	case !ok:
+		stats.MD5NotFound.Increment()
+		return false
+	}
+
+	d := header.NewTCPMD5Hash(header.TCP(s.pkt.TransportHeader().Slice()), s.id.RemoteAddress, s.id.LocalAddress, s.pkt.Data().Size())
+	s.pkt.Data().ReadTo(d, true /* peek */)
+	d.Write(key)
+	var want [header.TCPMD5DigestSize]byte
+	if subtle.ConstantTimeCompare(d.Sum(want[:0]), digest) != 1 {
+		stats.MD5Failure.Increment()
+		return false
+	}
+	return true
+}
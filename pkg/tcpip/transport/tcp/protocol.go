@@ -84,6 +84,7 @@ const (
 const (
 	ccReno  = "reno"
 	ccCubic = "cubic"
+	ccBBR   = "bbr"
 )
 
 // +stateify savable
@@ -93,6 +94,8 @@ type protocol struct {
 	mu                         sync.RWMutex `state:"nosave"`
 	sackEnabled                bool
 	recovery                   tcpip.TCPRecovery
+	ecn                        tcpip.TCPECNOption
+	fastOpen                   tcpip.TCPFastOpenOption
 	delayEnabled               bool
 	alwaysUseSynCookies        bool
 	sendBufferSize             tcpip.TCPSendBufferSizeRangeOption
@@ -109,9 +112,13 @@ type protocol struct {
 	synRetries                 uint8
 	dispatcher                 dispatcher
 
+	// fastOpenCache caches the Fast Open cookies received from peers.
+	fastOpenCache fastOpenCache
+
 	// The following secrets are initialized once and stay unchanged after.
 	seqnumSecret   [16]byte
 	tsOffsetSecret [16]byte
+	fastOpenSecret [16]byte
 }
 
 // Number returns the tcp protocol number.
@@ -255,6 +262,26 @@ func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) tcpip
 		p.mu.Unlock()
 		return nil
 
+	case *tcpip.TCPECNOption:
+		switch *v {
+		case tcpip.TCPECNDisabled, tcpip.TCPECNEnabled, tcpip.TCPECNPassive:
+		default:
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		p.mu.Lock()
+		p.ecn = *v
+		p.mu.Unlock()
+		return nil
+
+	case *tcpip.TCPFastOpenOption:
+		if *v < 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		p.mu.Lock()
+		p.fastOpen = *v
+		p.mu.Unlock()
+		return nil
+
 	case *tcpip.TCPDelayEnabled:
 		p.mu.Lock()
 		p.delayEnabled = bool(*v)
@@ -392,6 +419,18 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) tcpip.Er
 		p.mu.RUnlock()
 		return nil
 
+	case *tcpip.TCPECNOption:
+		p.mu.RLock()
+		*v = p.ecn
+		p.mu.RUnlock()
+		return nil
+
+	case *tcpip.TCPFastOpenOption:
+		p.mu.RLock()
+		*v = p.fastOpen
+		p.mu.RUnlock()
+		return nil
+
 	case *tcpip.TCPDelayEnabled:
 		p.mu.RLock()
 		*v = tcpip.TCPDelayEnabled(p.delayEnabled)
@@ -526,16 +565,30 @@ func NewProtocolCUBIC(s *stack.Stack) stack.TransportProtocol {
 	return newProtocol(s, ccCubic)
 }
 
+// availableCongestionControl returns the names of the supported congestion
+// control algorithms.
+func availableCongestionControl() []string {
+	names := make([]string, 0, len(congestionControlAlgorithms))
+	for _, cc := range congestionControlAlgorithms {
+		names = append(names, cc.name)
+	}
+	return names
+}
+
 func newProtocol(s *stack.Stack, cc string) stack.TransportProtocol {
 	rng := s.SecureRNG()
 	var seqnumSecret [16]byte
 	var tsOffsetSecret [16]byte
+	var fastOpenSecret [16]byte
 	if n, err := rng.Reader.Read(seqnumSecret[:]); err != nil || n != len(seqnumSecret) {
 		panic(fmt.Sprintf("Read() failed: %v", err))
 	}
 	if n, err := rng.Reader.Read(tsOffsetSecret[:]); err != nil || n != len(tsOffsetSecret) {
 		panic(fmt.Sprintf("Read() failed: %v", err))
 	}
+	if n, err := rng.Reader.Read(fastOpenSecret[:]); err != nil || n != len(fastOpenSecret) {
+		panic(fmt.Sprintf("Read() failed: %v", err))
+	}
 	p := protocol{
 		stack: s,
 		sendBufferSize: tcpip.TCPSendBufferSizeRangeOption{
@@ -550,7 +603,7 @@ func newProtocol(s *stack.Stack, cc string) stack.TransportProtocol {
 		},
 		sackEnabled:                true,
 		congestionControl:          cc,
-		availableCongestionControl: []string{ccReno, ccCubic},
+		availableCongestionControl: availableCongestionControl(),
 		moderateReceiveBuffer:      true,
 		lingerTimeout:              DefaultTCPLingerTimeout,
 		timeWaitTimeout:            DefaultTCPTimeWaitTimeout,
@@ -560,8 +613,11 @@ func newProtocol(s *stack.Stack, cc string) stack.TransportProtocol {
 		maxRTO:                     MaxRTO,
 		maxRetries:                 MaxRetries,
 		recovery:                   tcpip.TCPRACKLossDetection,
+		ecn:                        tcpip.TCPECNPassive,
+		fastOpen:                   tcpip.TCPFastOpenClient,
 		seqnumSecret:               seqnumSecret,
 		tsOffsetSecret:             tsOffsetSecret,
+		fastOpenSecret:             fastOpenSecret,
 	}
 	p.dispatcher.init(s.InsecureRNG(), runtime.GOMAXPROCS(0))
 	return &p
@@ -0,0 +1,183 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp
+
+import (
+	"time"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// rateState holds the connection state used to estimate the delivery rate of
+// the connection.
+//
+// See: https://datatracker.ietf.org/doc/html/draft-cheng-iccrg-delivery-rate-estimation
+//
+// +stateify savable
+type rateState struct {
+	// delivered is the total number of packets delivered (cumulatively or
+	// selectively acknowledged) so far. It is C.delivered in the draft.
+	delivered int
+
+	// deliveredTime is the time at which delivered was last updated.
+	deliveredTime tcpip.MonotonicTime
+
+	// firstSentTime is the send time of the packet that was most recently
+	// marked as delivered, or the time at which the connection became busy
+	// again after being idle.
+	firstSentTime tcpip.MonotonicTime
+
+	// appLimited is the value of delivered at which the current application
+	// limited phase ends, or zero if the connection isn't application
+	// limited.
+	appLimited int
+
+	// sample is the sample being built for the ACK being processed.
+	sample rateSample
+}
+
+// rateTxState is the delivery state recorded in a segment when it is sent.
+//
+// +stateify savable
+type rateTxState struct {
+	delivered     int
+	deliveredTime tcpip.MonotonicTime
+	firstSentTime tcpip.MonotonicTime
+	appLimited    bool
+}
+
+// rateSample is a delivery rate sample, generated for each ACK that delivers
+// data.
+//
+// +stateify savable
+type rateSample struct {
+	// priorDelivered is rateState.delivered at the time the most recently
+	// sent packet delivered by the ACK was sent. A negative value indicates
+	// that no packet has been delivered.
+	priorDelivered int
+
+	// priorTime is rateState.deliveredTime at the time the most recently
+	// sent packet delivered by the ACK was sent.
+	priorTime tcpip.MonotonicTime
+
+	// sendElapsed and ackElapsed are the send and ACK phases of the
+	// sampling interval.
+	sendElapsed time.Duration
+	ackElapsed  time.Duration
+
+	// interval is the length of the sampling interval. It is zero if the
+	// sample is invalid.
+	interval time.Duration
+
+	// delivered is the number of packets delivered over interval.
+	delivered int
+
+	// deliveryRate is the delivery rate in packets per second.
+	deliveryRate float64
+
+	// newlyDelivered is the number of packets delivered by this ACK.
+	newlyDelivered int
+
+	// priorInFlight is the number of packets in flight before the ACK was
+	// processed.
+	priorInFlight int
+
+	// rtt is the round-trip time of the most recently sent packet delivered
+	// by the ACK, or unknownRTT if that packet was retransmitted.
+	rtt time.Duration
+
+	// isAppLimited indicates whether the sample was taken while the
+	// connection was application limited, in which case deliveryRate may
+	// underestimate the available bandwidth.
+	isAppLimited bool
+}
+
+// onSent records the delivery state in seg as it is transmitted. inFlight is
+// the number of packets in flight, not including seg.
+func (r *rateState) onSent(seg *segment, now tcpip.MonotonicTime, inFlight int) {
+	if inFlight == 0 {
+		// The connection was idle; restart the sampling interval so that
+		// the idle period isn't included in it.
+		r.firstSentTime = now
+		r.deliveredTime = now
+	}
+	seg.tx = rateTxState{
+		delivered:     r.delivered,
+		deliveredTime: r.deliveredTime,
+		firstSentTime: r.firstSentTime,
+		appLimited:    r.appLimited != 0,
+	}
+}
+
+// beginAck resets the sample for a new ACK.
+func (r *rateState) beginAck(inFlight int) {
+	r.sample = rateSample{
+		priorDelivered: -1,
+		priorInFlight:  inFlight,
+		rtt:            unknownRTT,
+	}
+}
+
+// onDelivered updates the delivery state when the packets in seg are
+// cumulatively or selectively acknowledged for the first time.
+func (r *rateState) onDelivered(seg *segment, packets int, now tcpip.MonotonicTime) {
+	r.delivered += packets
+	r.deliveredTime = now
+	r.sample.newlyDelivered += packets
+
+	// Use the most recently sent packet to generate the sample, as it
+	// reflects the most recent state of the path.
+	if seg.tx.delivered < r.sample.priorDelivered {
+		return
+	}
+	r.sample.priorDelivered = seg.tx.delivered
+	r.sample.priorTime = seg.tx.deliveredTime
+	r.sample.isAppLimited = seg.tx.appLimited
+	r.sample.sendElapsed = seg.xmitTime.Sub(seg.tx.firstSentTime)
+	r.sample.ackElapsed = now.Sub(seg.tx.deliveredTime)
+	r.sample.rtt = unknownRTT
+	if seg.xmitCount == 1 {
+		r.sample.rtt = now.Sub(seg.xmitTime)
+	}
+	r.firstSentTime = seg.xmitTime
+}
+
+// endAck completes and returns the sample for the ACK being processed.
+func (r *rateState) endAck() *rateSample {
+	rs := &r.sample
+	if r.appLimited != 0 && r.delivered > r.appLimited {
+		r.appLimited = 0
+	}
+	if rs.priorDelivered < 0 {
+		return rs
+	}
+	rs.delivered = r.delivered - rs.priorDelivered
+
+	// The sampling interval is the longer of the send and ACK phases, so
+	// that ACK compression or aggregation doesn't inflate the rate.
+	rs.interval = max(rs.sendElapsed, rs.ackElapsed)
+	if rs.interval <= 0 {
+		rs.interval = 0
+		return rs
+	}
+	rs.deliveryRate = float64(rs.delivered) / rs.interval.Seconds()
+	return rs
+}
+
+// markAppLimited marks the connection as application limited, given the
+// number of packets in flight.
+func (r *rateState) markAppLimited(inFlight int) {
+	r.appLimited = max(r.delivered+inFlight, 1)
+}
@@ -50,6 +50,11 @@ type receiver struct {
 
 	// Time when the last ack was received.
 	lastRcvdAckTime tcpip.MonotonicTime
+
+	// ecnEcho is set from the receipt of a segment marked with congestion
+	// experienced until the peer acknowledges it with CWR. ECE is set on
+	// every segment sent in the meantime.
+	ecnEcho bool
 }
 
 func newReceiver(ep *Endpoint, irs seqnum.Value, rcvWnd seqnum.Size, rcvWndScale uint8) *receiver {
@@ -478,6 +483,10 @@ func (r *receiver) handleRcvdSegment(s *segment) (drop bool, err tcpip.Error) {
 	// Store the time of the last ack.
 	r.lastRcvdAckTime = r.ep.stack.Clock().NowMonotonic()
 
+	if r.ep.ecnEnabled {
+		r.updateECN(s)
+	}
+
 	// Defer segment processing if it can't be consumed now.
 	if !r.consumeSegment(s, segSeq, segLen) {
 		if segLen > 0 || s.flags.Contains(header.TCPFlagFin) {
@@ -105,3 +105,12 @@ func (r *renoState) HandleRTOExpired() {
 func (r *renoState) PostRecovery() {
 	// noop.
 }
+
+// HandleECNEcho implements congestionControl.HandleECNEcho.
+func (r *renoState) HandleECNEcho() {
+	// See: https://tools.ietf.org/html/rfc3168#section-6.1.2. The sender
+	// halves the congestion window and reduces the slow start threshold as
+	// it would for a lost packet.
+	r.reduceSlowStartThreshold()
+	r.s.SndCwnd = r.s.Ssthresh
+}
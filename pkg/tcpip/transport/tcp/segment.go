@@ -90,21 +90,31 @@ type segment struct {
 
 	// lost indicates if the segment is marked as lost by RACK.
 	lost bool
+
+	// tx holds the sender's delivery state at the time the segment was last
+	// transmitted, used for delivery rate sampling.
+	tx rateTxState
+
+	// ecn is the ECN codepoint of the IP header the segment was received in.
+	ecn uint8
 }
 
 func newIncomingSegment(id stack.TransportEndpointID, clock tcpip.Clock, pkt *stack.PacketBuffer) (*segment, error) {
 	hdr := header.TCP(pkt.TransportHeader().Slice())
 	var srcAddr tcpip.Address
 	var dstAddr tcpip.Address
+	var tos uint8
 	switch netProto := pkt.NetworkProtocolNumber; netProto {
 	case header.IPv4ProtocolNumber:
 		hdr := header.IPv4(pkt.NetworkHeader().Slice())
 		srcAddr = hdr.SourceAddress()
 		dstAddr = hdr.DestinationAddress()
+		tos, _ = hdr.TOS()
 	case header.IPv6ProtocolNumber:
 		hdr := header.IPv6(pkt.NetworkHeader().Slice())
 		srcAddr = hdr.SourceAddress()
 		dstAddr = hdr.DestinationAddress()
+		tos, _ = hdr.TOS()
 	default:
 		panic(fmt.Sprintf("unknown network protocol number %d", netProto))
 	}
@@ -132,6 +142,7 @@ func newIncomingSegment(id stack.TransportEndpointID, clock tcpip.Clock, pkt *st
 	s.dataMemSize = pkt.MemSize()
 	s.pkt = pkt.Clone()
 	s.csumValid = csumValid
+	s.ecn = tos & header.ECNMask
 
 	if !s.pkt.RXChecksumValidated {
 		s.csum = csum
@@ -161,6 +172,7 @@ func (s *segment) clone() *segment {
 	t.ep = s.ep
 	t.qFlags = s.qFlags
 	t.dataMemSize = s.dataMemSize
+	t.ecn = s.ecn
 	t.pkt = s.pkt.Clone()
 	return t
 }
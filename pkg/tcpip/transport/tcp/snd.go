@@ -82,6 +82,38 @@ type congestionControl interface {
 	// recovery phase. This provides congestion control algorithms a way
 	// to adjust their state when exiting recovery.
 	PostRecovery()
+
+	// HandleECNEcho is invoked when the peer echoes a congestion experienced
+	// mark. It is invoked at most once per window of data and never while
+	// recovering from loss.
+	HandleECNEcho()
+}
+
+// rateControl is implemented by congestion control algorithms that are driven
+// by delivery rate samples and pace the sender.
+type rateControl interface {
+	// UpdateRate is invoked when processing inbound acks that deliver data,
+	// in or out of recovery, with the delivery rate sample for the ack.
+	UpdateRate(rs *rateSample)
+
+	// PacingRate returns the rate, in bytes per second, at which the sender
+	// should pace data. Zero disables pacing.
+	PacingRate() float64
+}
+
+// congestionControlAlgorithm is a congestion control algorithm that can be
+// selected with TCP_CONGESTION.
+type congestionControlAlgorithm struct {
+	name string
+	new  func(s *sender) congestionControl
+}
+
+// congestionControlAlgorithms are the supported congestion control
+// algorithms, in the order reported by tcp_available_congestion_control.
+var congestionControlAlgorithms = []congestionControlAlgorithm{
+	{ccReno, func(s *sender) congestionControl { return newRenoCC(s) }},
+	{ccCubic, func(s *sender) congestionControl { return newCubicCC(s) }},
+	{ccBBR, func(s *sender) congestionControl { return newBBRCC(s) }},
 }
 
 // lossRecovery is an interface that must be implemented by any supported
@@ -178,6 +210,25 @@ type sender struct {
 	// corkTimer is used to drain the segments which are held when TCP_CORK
 	// option is enabled.
 	corkTimer timer `state:"nosave"`
+
+	// rate holds the state used to sample the delivery rate.
+	rate rateState
+
+	// pacingNext is the earliest time at which the next segment may be sent
+	// when the congestion control algorithm paces the sender.
+	pacingNext tcpip.MonotonicTime
+
+	// pacingTimer is used to resume sending when pacing delays a segment.
+	pacingTimer timer `state:"nosave"`
+
+	// ecnCWR is set when the congestion window was reduced in response to an
+	// ECN-Echo and the next new data segment must carry CWR.
+	ecnCWR bool
+
+	// ecnRecover is the value of SndNxt when the congestion window was last
+	// reduced in response to an ECN-Echo. Further ECN-Echoes are ignored
+	// until it is acknowledged, as per RFC 3168 section 6.1.2.
+	ecnRecover seqnum.Value
 }
 
 // rtt is a synchronization wrapper used to appease stateify. See the comment
@@ -215,7 +266,8 @@ func newSender(ep *Endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 			},
 			RTO: 1 * time.Second,
 		},
-		gso: ep.gso.Type != stack.GSONone,
+		gso:        ep.gso.Type != stack.GSONone,
+		ecnRecover: iss,
 	}
 
 	if s.gso {
@@ -236,6 +288,7 @@ func newSender(ep *Endpoint, iss, irs seqnum.Value, sndWnd seqnum.Size, mss uint
 	s.reorderTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.rc.reorderTimerExpired))
 	s.probeTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.probeTimerExpired))
 	s.corkTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.corkTimerExpired))
+	s.pacingTimer.init(s.ep.stack.Clock(), timerHandler(s.ep, s.pacingTimerExpired))
 
 	s.ep.AssertLockHeld(ep)
 	s.updateMaxPayloadSize(int(ep.route.MTU()), 0)
@@ -273,14 +326,64 @@ func (s *sender) initCongestionControl(congestionControlName tcpip.CongestionCon
 	s.SndCwnd = InitialCwnd
 	s.Ssthresh = InitialSsthresh
 
-	switch congestionControlName {
-	case ccCubic:
-		return newCubicCC(s)
-	case ccReno:
-		fallthrough
-	default:
-		return newRenoCC(s)
+	for _, cc := range congestionControlAlgorithms {
+		if tcpip.CongestionControlOption(cc.name) == congestionControlName {
+			return cc.new(s)
+		}
+	}
+	return newRenoCC(s)
+}
+
+// pacingRate returns the rate in bytes per second at which the sender paces
+// data, or zero if the congestion control algorithm doesn't pace.
+func (s *sender) pacingRate() float64 {
+	if rc, ok := s.cc.(rateControl); ok {
+		return rc.PacingRate()
+	}
+	return 0
+}
+
+// paced returns whether sending the next segment must be delayed by pacing,
+// arming the pacing timer if so.
+// +checklocks:s.ep.mu
+func (s *sender) paced() bool {
+	if s.pacingRate() == 0 {
+		return false
+	}
+	wait := s.pacingNext.Sub(s.ep.stack.Clock().NowMonotonic())
+	if wait <= 0 {
+		return false
+	}
+	if !s.pacingTimer.enabled() {
+		s.pacingTimer.enable(wait)
+	}
+	return true
+}
+
+// updatePacing schedules the earliest send time of the next segment after
+// size bytes were sent.
+func (s *sender) updatePacing(size int) {
+	rate := s.pacingRate()
+	if rate == 0 {
+		return
+	}
+	now := s.ep.stack.Clock().NowMonotonic()
+	if s.pacingNext.Before(now) {
+		s.pacingNext = now
 	}
+	s.pacingNext = s.pacingNext.Add(time.Duration(float64(size) / rate * float64(time.Second)))
+}
+
+// pacingTimerExpired resumes sending data delayed by pacing.
+// +checklocks:s.ep.mu
+func (s *sender) pacingTimerExpired() tcpip.Error {
+	// Check if the timer actually expired or if it's a spurious wake due
+	// to a previously orphaned runtime timer.
+	if s.pacingTimer.isUninitialized() || !s.pacingTimer.checkExpiration() {
+		return nil
+	}
+	s.sendData()
+	return nil
 }
 
 // initLossRecovery initiates the loss recovery algorithm for the sender.
@@ -1028,14 +1131,26 @@ func (s *sender) sendData() {
 			s.updateWriteNext(seg.Next())
 			continue
 		}
+		if s.paced() {
+			break
+		}
 		if sent := s.maybeSendSegment(seg, limit, end); !sent {
 			break
 		}
 		dataSent = true
 		s.Outstanding += s.pCount(seg, s.MaxPayloadSize)
+		s.updatePacing(seg.payloadSize())
 		s.updateWriteNext(seg.Next())
 	}
 
+	// If the congestion window isn't full and there's nothing left to send,
+	// the connection is application limited and the delivery rate samples
+	// taken until the data in flight is delivered may underestimate the
+	// bandwidth.
+	if s.writeNext == nil && s.Outstanding < s.SndCwnd {
+		s.rate.markAppLimited(s.Outstanding)
+	}
+
 	s.postXmit(dataSent, true /* shouldScheduleProbe */)
 }
 
@@ -1286,6 +1401,7 @@ func (s *sender) walkSACK(rcvdSeg *segment) bool {
 				s.rc.detectReorder(seg)
 				seg.acked = true
 				s.SackedOut += s.pCount(seg, s.MaxPayloadSize)
+				s.rate.onDelivered(seg, s.pCount(seg, s.MaxPayloadSize), rcvdSeg.rcvdTime)
 			}
 			seg = seg.Next()
 		}
@@ -1429,6 +1545,7 @@ func (s *sender) inRecovery() bool {
 // +checklocksalias:s.rc.snd.ep.mu=s.ep.mu
 func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 	bestRTT := unknownRTT
+	s.rate.beginAck(s.Outstanding)
 
 	// Check if we can extract an RTT measurement from this ack.
 	if !rcvdSeg.parsedOptions.TS && s.RTTMeasureSeqNum.LessThan(rcvdSeg.ackNumber) {
@@ -1502,6 +1619,11 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 		s.detectTLPRecovery(ack, rcvdSeg)
 	}
 
+	// React to congestion experienced by the peer. Old ACKs are ignored.
+	if s.ep.ecnEnabled && rcvdSeg.flags.Contains(header.TCPFlagEce) && s.SndUna.LessThanEq(ack) && ack.LessThanEq(s.SndNxt) {
+		s.handleECNEcho()
+	}
+
 	// Stash away the current window size.
 	s.SndWnd = rcvdSeg.window
 
@@ -1588,6 +1710,9 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 				s.rc.update(seg, rcvdSeg)
 				s.rc.detectReorder(seg)
 			}
+			if !seg.acked {
+				s.rate.onDelivered(seg, s.pCount(seg, s.MaxPayloadSize), rcvdSeg.rcvdTime)
+			}
 
 			s.writeList.Remove(seg)
 
@@ -1650,6 +1775,13 @@ func (s *sender) handleRcvdSegment(rcvdSeg *segment) {
 		}
 	}
 
+	// Pass the delivery rate sample to rate based congestion control.
+	if rs := s.rate.endAck(); rs.newlyDelivered > 0 {
+		if rc, ok := s.cc.(rateControl); ok {
+			rc.UpdateRate(rs)
+		}
+	}
+
 	if s.ep.SACKPermitted && s.ep.tcpRecovery&tcpip.TCPRACKLossDetection != 0 {
 		// Update RACK reorder window.
 		// See: https://tools.ietf.org/html/draft-ietf-tcpm-rack-08#section-7.2
@@ -1704,6 +1836,7 @@ func (s *sender) sendSegment(seg *segment) tcpip.Error {
 		}
 	}
 	seg.xmitTime = s.ep.stack.Clock().NowMonotonic()
+	s.rate.onSent(seg, seg.xmitTime, s.Outstanding)
 	seg.xmitCount++
 	seg.lost = false
 
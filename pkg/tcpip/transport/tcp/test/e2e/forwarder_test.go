@@ -82,6 +82,11 @@ func TestForwarderDoesNotRejectECNFlags(t *testing.T) {
 			defer c.Cleanup()
 
 			s := c.Stack()
+			// Disable ECN so that the SYN-ACK doesn't negotiate it.
+			ecn := tcpip.TCPECNDisabled
+			if err := s.SetTransportProtocolOption(tcp.ProtocolNumber, &ecn); err != nil {
+				t.Fatalf("SetTransportProtocolOption(%d, &%d): %s", tcp.ProtocolNumber, ecn, err)
+			}
 			ch := make(chan tcpip.Error, 1)
 			f := tcp.NewForwarder(s, 65536, 10, func(r *tcp.ForwarderRequest) {
 				var err tcpip.Error
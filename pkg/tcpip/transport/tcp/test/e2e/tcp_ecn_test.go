@@ -0,0 +1,368 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_ecn_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checker"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/test/e2e"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/testing/context"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+func setStackECN(t *testing.T, c *context.Context, v tcpip.TCPECNOption) {
+	t.Helper()
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &v); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%d): %s", tcp.ProtocolNumber, v, err)
+	}
+}
+
+// connectECN performs an active open in which the stack requests ECN and the
+// peer replies with synAckFlags. It returns the peer's next sequence number.
+func connectECN(t *testing.T, c *context.Context, synAckFlags header.TCPFlags) seqnum.Value {
+	t.Helper()
+
+	c.Create(-1 /* epRcvBuf */)
+	we, ch := waiter.NewChannelEntry(waiter.WritableEvents)
+	c.WQ.EventRegister(&we)
+	defer c.WQ.EventUnregister(&we)
+
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != nil {
+		if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
+			t.Fatalf("Connect failed: %s", err)
+		}
+	}
+
+	// The SYN must be an ECN-setup SYN.
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b,
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPFlags(header.TCPFlagSyn|header.TCPFlagEce|header.TCPFlagCwr),
+		),
+	)
+	tcpHdr := header.TCP(header.IPv4(b.AsSlice()).Payload())
+	c.IRS = seqnum.Value(tcpHdr.SequenceNumber())
+	c.Port = tcpHdr.SourcePort()
+
+	iss := seqnum.Value(context.TestInitialSequenceNumber)
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagSyn | header.TCPFlagAck | synAckFlags,
+		SeqNum:  iss,
+		AckNum:  c.IRS.Add(1),
+		RcvWnd:  30000,
+	})
+
+	b = c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b,
+		checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPFlags(header.TCPFlagAck),
+		),
+	)
+
+	select {
+	case <-ch:
+		if err := c.EP.LastError(); err != nil {
+			t.Fatalf("Connect failed: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for connection")
+	}
+	return iss.Add(1)
+}
+
+func writeData(t *testing.T, c *context.Context, data []byte) {
+	t.Helper()
+	var r bytes.Reader
+	r.Reset(data)
+	if _, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+}
+
+func TestECNActiveOpen(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	setStackECN(t, c, tcpip.TCPECNEnabled)
+	seq := connectECN(t, c, header.TCPFlagEce)
+
+	if got := c.Stack().Stats().TCP.ECNNegotiated.Value(); got != 1 {
+		t.Errorf("got stats.TCP.ECNNegotiated = %d, want = 1", got)
+	}
+	var info tcpip.TCPInfoOption
+	if err := c.EP.GetSockOpt(&info); err != nil {
+		t.Fatalf("GetSockOpt(&%T) failed: %s", info, err)
+	}
+	if !info.ECN {
+		t.Errorf("got TCPInfoOption.ECN = false, want = true")
+	}
+
+	// New data is sent ECN-capable.
+	data := []byte{1, 2, 3}
+	writeData(t, c, data)
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b,
+		checker.TOS(header.ECNECT0, 0),
+		checker.TCP(
+			checker.TCPSeqNum(uint32(c.IRS)+1),
+			checker.TCPFlagsMatch(header.TCPFlagAck, ^header.TCPFlagPsh),
+		),
+	)
+
+	// Echo congestion back to the sender, which must reduce its window and
+	// signal that it did so on the next new data segment.
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck | header.TCPFlagEce,
+		SeqNum:  seq,
+		AckNum:  c.IRS.Add(1 + seqnum.Size(len(data))),
+		RcvWnd:  30000,
+	})
+	// The ACK is processed asynchronously, wait for the reduction.
+	for deadline := time.Now().Add(time.Second); c.Stack().Stats().TCP.ECNReductions.Value() != 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("got stats.TCP.ECNReductions = %d, want = 1", c.Stack().Stats().TCP.ECNReductions.Value())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	writeData(t, c, data)
+	b = c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b,
+		checker.TOS(header.ECNECT0, 0),
+		checker.TCP(
+			checker.TCPSeqNum(uint32(c.IRS)+1+uint32(len(data))),
+			checker.TCPFlagsMatch(header.TCPFlagAck|header.TCPFlagCwr, ^header.TCPFlagPsh),
+		),
+	)
+}
+
+func TestECNActiveOpenNotAccepted(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	setStackECN(t, c, tcpip.TCPECNEnabled)
+	// A SYN-ACK with both ECE and CWR set does not agree to ECN.
+	connectECN(t, c, header.TCPFlagEce|header.TCPFlagCwr)
+
+	data := []byte{1, 2, 3}
+	writeData(t, c, data)
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b, checker.TOS(0, 0))
+	if got := c.Stack().Stats().TCP.ECNNegotiated.Value(); got != 0 {
+		t.Errorf("got stats.TCP.ECNNegotiated = %d, want = 0", got)
+	}
+}
+
+// synAckInfo describes a SYN-ACK sent by a listener in reply to the SYN with
+// initial sequence number irs.
+type synAckInfo struct {
+	flags header.TCPFlags
+	iss   seqnum.Value
+	irs   seqnum.Value
+}
+
+// listenAndSyn starts a listener and sends it an ECN-setup SYN. It returns
+// the SYN-ACK sent in reply.
+func listenAndSyn(t *testing.T, c *context.Context) *synAckInfo {
+	t.Helper()
+
+	var err tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %s", err)
+	}
+	if err := c.EP.Listen(10); err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+
+	irs := seqnum.Value(context.TestInitialSequenceNumber)
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagSyn | header.TCPFlagEce | header.TCPFlagCwr,
+		SeqNum:  irs,
+		RcvWnd:  30000,
+	})
+
+	b := c.GetPacket()
+	tcpHdr := header.TCP(header.IPv4(b.AsSlice()).Payload())
+	s := &synAckInfo{
+		flags: tcpHdr.Flags(),
+		iss:   seqnum.Value(tcpHdr.SequenceNumber()),
+		irs:   irs,
+	}
+	b.Release()
+	return s
+}
+
+func TestECNPassiveOpen(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	// Accepting ECN on incoming connections is the default.
+	synAck := listenAndSyn(t, c)
+	if want := header.TCPFlagSyn | header.TCPFlagAck | header.TCPFlagEce; synAck.flags != want {
+		t.Fatalf("got SYN-ACK flags = %s, want = %s", synAck.flags, want)
+	}
+
+	we, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	c.WQ.EventRegister(&we)
+	defer c.WQ.EventUnregister(&we)
+
+	seq := synAck.irs.Add(1)
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  seq,
+		AckNum:  synAck.iss.Add(1),
+		RcvWnd:  30000,
+	})
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for accept")
+	}
+	ep, _, err := c.EP.Accept(nil)
+	if err != nil {
+		t.Fatalf("Accept failed: %s", err)
+	}
+	defer ep.Close()
+
+	// Data marked with congestion experienced is acknowledged with ECE.
+	data := []byte{1, 2, 3}
+	c.SendPacket(data, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  seq,
+		AckNum:  synAck.iss.Add(1),
+		RcvWnd:  30000,
+		TOS:     header.ECNCE,
+	})
+	seq = seq.Add(seqnum.Size(len(data)))
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b,
+		checker.TCP(
+			checker.TCPAckNum(uint32(seq)),
+			checker.TCPFlags(header.TCPFlagAck|header.TCPFlagEce),
+		),
+	)
+	if got := c.Stack().Stats().TCP.CESegmentsReceived.Value(); got != 1 {
+		t.Errorf("got stats.TCP.CESegmentsReceived = %d, want = 1", got)
+	}
+
+	// ECE is echoed until data with CWR is received.
+	c.SendPacket(data, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagAck | header.TCPFlagCwr,
+		SeqNum:  seq,
+		AckNum:  synAck.iss.Add(1),
+		RcvWnd:  30000,
+		TOS:     header.ECNECT0,
+	})
+	seq = seq.Add(seqnum.Size(len(data)))
+	b = c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b,
+		checker.TCP(
+			checker.TCPAckNum(uint32(seq)),
+			checker.TCPFlags(header.TCPFlagAck),
+		),
+	)
+}
+
+func TestECNPassiveOpenDisabled(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	setStackECN(t, c, tcpip.TCPECNDisabled)
+	synAck := listenAndSyn(t, c)
+	if want := header.TCPFlagSyn | header.TCPFlagAck; synAck.flags != want {
+		t.Fatalf("got SYN-ACK flags = %s, want = %s", synAck.flags, want)
+	}
+}
+
+func TestECNSynRetransmitFallback(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	setStackECN(t, c, tcpip.TCPECNEnabled)
+	c.Create(-1 /* epRcvBuf */)
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != nil {
+		if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
+			t.Fatalf("Connect failed: %s", err)
+		}
+	}
+
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b,
+		checker.TCP(checker.TCPFlags(header.TCPFlagSyn|header.TCPFlagEce|header.TCPFlagCwr)),
+	)
+
+	// The retransmitted SYN is not an ECN-setup SYN.
+	b = c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b,
+		checker.TCP(checker.TCPFlags(header.TCPFlagSyn)),
+	)
+}
+
+func TestSetECNOptionInvalid(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	v := tcpip.TCPECNOption(3)
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &v); err == nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%d) succeeded, want error", tcp.ProtocolNumber, v)
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	// Allow TCP async work to complete to avoid false reports of leaks.
+	// TODO(gvisor.dev/issue/5940): Use fake clock in tests.
+	time.Sleep(1 * time.Second)
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
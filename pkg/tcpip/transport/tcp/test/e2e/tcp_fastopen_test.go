@@ -0,0 +1,471 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_fastopen_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checker"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/test/e2e"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/testing/context"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+func setStackFastOpen(t *testing.T, c *context.Context, v tcpip.TCPFastOpenOption) {
+	t.Helper()
+	if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &v); err != nil {
+		t.Fatalf("SetTransportProtocolOption(%d, &%d): %s", tcp.ProtocolNumber, v, err)
+	}
+}
+
+// fastOpenOptions returns the TCP options of a segment carrying the MSS option,
+// if mss isn't zero, and a Fast Open option with cookie.
+func fastOpenOptions(mss uint32, cookie []byte) []byte {
+	opts := make([]byte, header.TCPOptionsMaximumSize)
+	offset := 0
+	if mss != 0 {
+		offset += header.EncodeMSSOption(mss, opts[offset:])
+	}
+	offset += header.EncodeFastOpenOption(cookie, opts[offset:])
+	offset += header.AddTCPOptionPadding(opts, offset)
+	return opts[:offset]
+}
+
+// synOptions returns the SYN options of the TCP segment in b.
+func synOptions(t *testing.T, b *buffer.View) header.TCPSynOptions {
+	t.Helper()
+	tcpHdr := header.TCP(header.IPv4(b.AsSlice()).Payload())
+	return header.ParseSynOptions(tcpHdr.Options(), tcpHdr.Flags().Contains(header.TCPFlagAck))
+}
+
+// listenFastOpen makes c.EP a listener accepting Fast Open connections.
+func listenFastOpen(t *testing.T, c *context.Context) {
+	t.Helper()
+	setStackFastOpen(t, c, tcpip.TCPFastOpenClient|tcpip.TCPFastOpenServer)
+
+	var err tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %s", err)
+	}
+	if err := c.EP.SetSockOptInt(tcpip.TCPFastOpenQueueLenOption, 5); err != nil {
+		t.Fatalf("SetSockOptInt(TCPFastOpenQueueLenOption, 5) failed: %s", err)
+	}
+	if err := c.EP.Listen(10); err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+}
+
+// sendFastOpenSyn sends a SYN from srcPort carrying a Fast Open option with
+// cookie and data. It returns the SYN-ACK replied by the listener.
+func sendFastOpenSyn(t *testing.T, c *context.Context, srcPort uint16, cookie, data []byte) *buffer.View {
+	t.Helper()
+	irs := seqnum.Value(context.TestInitialSequenceNumber)
+	c.SendPacket(data, &context.Headers{
+		SrcPort: srcPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagSyn,
+		SeqNum:  irs,
+		RcvWnd:  30000,
+		TCPOpts: fastOpenOptions(0, cookie),
+	})
+
+	b := c.GetPacket()
+	checker.IPv4(t, b, checker.TCP(
+		checker.SrcPort(context.StackPort),
+		checker.DstPort(srcPort),
+		checker.TCPFlags(header.TCPFlagAck|header.TCPFlagSyn),
+	))
+	return b
+}
+
+// requestCookie requests a Fast Open cookie from the listener c.EP.
+func requestCookie(t *testing.T, c *context.Context, srcPort uint16) []byte {
+	t.Helper()
+	synAck := sendFastOpenSyn(t, c, srcPort, nil, nil)
+	defer synAck.Release()
+	opts := synOptions(t, synAck)
+	if !opts.FastOpen || len(opts.FastOpenCookie) == 0 {
+		t.Fatalf("got SYN-ACK options %+v, want a Fast Open cookie", opts)
+	}
+	return opts.FastOpenCookie
+}
+
+func TestFastOpenPassiveCookieRequest(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	listenFastOpen(t, c)
+	cookie := requestCookie(t, c, context.TestPort)
+	if got, want := len(cookie), 8; got != want {
+		t.Errorf("got len(cookie) = %d, want = %d", got, want)
+	}
+	if got := c.Stack().Stats().TCP.FastOpenCookieReqd.Value(); got != 1 {
+		t.Errorf("got stats.TCP.FastOpenCookieReqd = %d, want = 1", got)
+	}
+
+	// The cookie only depends on the addresses of the connection.
+	if got := requestCookie(t, c, context.TestPort+1); !bytes.Equal(got, cookie) {
+		t.Errorf("got cookie = %x, want = %x", got, cookie)
+	}
+}
+
+func TestFastOpenPassiveDataInSyn(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	listenFastOpen(t, c)
+	cookie := requestCookie(t, c, context.TestPort)
+
+	we, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	c.WQ.EventRegister(&we)
+	defer c.WQ.EventUnregister(&we)
+
+	// The data of a SYN with a valid cookie is acknowledged by the SYN-ACK.
+	data := []byte{1, 2, 3, 4}
+	srcPort := uint16(context.TestPort + 1)
+	synAck := sendFastOpenSyn(t, c, srcPort, cookie, data)
+	defer synAck.Release()
+	irs := seqnum.Value(context.TestInitialSequenceNumber)
+	checker.IPv4(t, synAck, checker.TCP(checker.TCPAckNum(uint32(irs)+1+uint32(len(data)))))
+	if got := c.Stack().Stats().TCP.FastOpenPassive.Value(); got != 1 {
+		t.Errorf("got stats.TCP.FastOpenPassive = %d, want = 1", got)
+	}
+
+	// The endpoint is accepted before the handshake completes.
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for accept")
+	}
+	ep, _, err := c.EP.Accept(nil)
+	if err != nil {
+		t.Fatalf("Accept failed: %s", err)
+	}
+	defer ep.Close()
+	if got, want := tcp.EndpointState(ep.State()), tcp.StateSynRecv; got != want {
+		t.Errorf("got accepted endpoint state = %s, want = %s", got, want)
+	}
+
+	var buf bytes.Buffer
+	if _, err := ep.Read(&buf, tcpip.ReadOptions{}); err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	if got := buf.Bytes(); !bytes.Equal(got, data) {
+		t.Errorf("got Read = %v, want = %v", got, data)
+	}
+
+	// Complete the handshake.
+	iss := seqnum.Value(header.TCP(header.IPv4(synAck.AsSlice()).Payload()).SequenceNumber())
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: srcPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  irs.Add(1 + seqnum.Size(len(data))),
+		AckNum:  iss.Add(1),
+		RcvWnd:  30000,
+	})
+	for i := 0; tcp.EndpointState(ep.State()) != tcp.StateEstablished; i++ {
+		if i == 100 {
+			t.Fatalf("got accepted endpoint state = %s, want = %s", tcp.EndpointState(ep.State()), tcp.StateEstablished)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFastOpenPassiveInvalidCookie(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	listenFastOpen(t, c)
+	cookie := requestCookie(t, c, context.TestPort)
+
+	// The data of a SYN with an invalid cookie isn't acknowledged, and the
+	// SYN-ACK carries the valid cookie.
+	badCookie := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	synAck := sendFastOpenSyn(t, c, context.TestPort+1, badCookie, []byte{1, 2, 3, 4})
+	defer synAck.Release()
+	checker.IPv4(t, synAck, checker.TCP(checker.TCPAckNum(uint32(context.TestInitialSequenceNumber)+1)))
+	if opts := synOptions(t, synAck); !bytes.Equal(opts.FastOpenCookie, cookie) {
+		t.Errorf("got SYN-ACK cookie = %x, want = %x", opts.FastOpenCookie, cookie)
+	}
+	if got := c.Stack().Stats().TCP.FastOpenPassiveFail.Value(); got != 1 {
+		t.Errorf("got stats.TCP.FastOpenPassiveFail = %d, want = 1", got)
+	}
+	if got := c.Stack().Stats().TCP.FastOpenPassive.Value(); got != 0 {
+		t.Errorf("got stats.TCP.FastOpenPassive = %d, want = 0", got)
+	}
+}
+
+func TestFastOpenPassiveDisabled(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	listenFastOpen(t, c)
+	setStackFastOpen(t, c, tcpip.TCPFastOpenClient)
+
+	synAck := sendFastOpenSyn(t, c, context.TestPort, nil, nil)
+	defer synAck.Release()
+	if opts := synOptions(t, synAck); opts.FastOpen {
+		t.Errorf("got SYN-ACK options %+v, want no Fast Open option", opts)
+	}
+}
+
+// newFastOpenEndpoint returns an endpoint with TCP_FASTOPEN_CONNECT enabled.
+func newFastOpenEndpoint(t *testing.T, c *context.Context, wq *waiter.Queue) tcpip.Endpoint {
+	t.Helper()
+	ep, err := c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+	if err := ep.SetSockOptInt(tcpip.TCPFastOpenConnectOption, 1); err != nil {
+		t.Fatalf("SetSockOptInt(TCPFastOpenConnectOption, 1) failed: %s", err)
+	}
+	return ep
+}
+
+// replySynAck replies to the SYN in syn with a SYN-ACK acknowledging acked
+// bytes of its data and carrying the given cookie. It returns the source port
+// and initial sequence number of the SYN.
+func replySynAck(t *testing.T, c *context.Context, syn *buffer.View, acked int, cookie []byte) (uint16, seqnum.Value) {
+	t.Helper()
+	tcpHdr := header.TCP(header.IPv4(syn.AsSlice()).Payload())
+	port := tcpHdr.SourcePort()
+	irs := seqnum.Value(tcpHdr.SequenceNumber())
+	c.SendPacket(nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: port,
+		Flags:   header.TCPFlagSyn | header.TCPFlagAck,
+		SeqNum:  context.TestInitialSequenceNumber,
+		AckNum:  irs.Add(1 + seqnum.Size(acked)),
+		RcvWnd:  30000,
+		TCPOpts: fastOpenOptions(1460, cookie),
+	})
+	return port, irs
+}
+
+// cacheCookie performs an active Fast Open without a cached cookie, which
+// caches cookie for the peer.
+func cacheCookie(t *testing.T, c *context.Context, cookie []byte) {
+	t.Helper()
+	c.Create(-1 /* epRcvBuf */)
+	if err := c.EP.SetSockOptInt(tcpip.TCPFastOpenConnectOption, 1); err != nil {
+		t.Fatalf("SetSockOptInt(TCPFastOpenConnectOption, 1) failed: %s", err)
+	}
+
+	// Without a cookie, the SYN is sent right away and requests one.
+	err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort})
+	if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
+		t.Fatalf("got Connect = %v, want = %s", err, &tcpip.ErrConnectStarted{})
+	}
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b, checker.TCP(
+		checker.DstPort(context.TestPort),
+		checker.TCPFlags(header.TCPFlagSyn),
+	))
+	if opts := synOptions(t, b); !opts.FastOpen || len(opts.FastOpenCookie) != 0 {
+		t.Fatalf("got SYN options %+v, want a Fast Open cookie request", opts)
+	}
+
+	replySynAck(t, c, b, 0, cookie)
+	ack := c.GetPacket()
+	defer ack.Release()
+	checker.IPv4(t, ack, checker.TCP(checker.TCPFlags(header.TCPFlagAck)))
+}
+
+// connectWithData performs an active Fast Open with a cached cookie. It returns
+// the connected endpoint and the SYN carrying data.
+func connectWithData(t *testing.T, c *context.Context, wq *waiter.Queue, cookie, data []byte) (tcpip.Endpoint, *buffer.View) {
+	t.Helper()
+	ep := newFastOpenEndpoint(t, c, wq)
+
+	// The SYN is deferred until data is written, and the endpoint is
+	// writable in the meantime.
+	if err := ep.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != nil {
+		t.Fatalf("Connect failed: %s", err)
+	}
+	c.CheckNoPacket("SYN sent before data was written")
+	if got := ep.Readiness(waiter.WritableEvents); got != waiter.WritableEvents {
+		t.Errorf("got Readiness(WritableEvents) = %v, want = %v", got, waiter.WritableEvents)
+	}
+
+	var r bytes.Reader
+	r.Reset(data)
+	n, err := ep.Write(&r, tcpip.WriteOptions{})
+	if err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("got Write = %d, want = %d", n, len(data))
+	}
+
+	b := c.GetPacket()
+	checker.IPv4(t, b, checker.TCP(
+		checker.DstPort(context.TestPort),
+		checker.TCPFlags(header.TCPFlagSyn),
+		checker.Payload(data),
+	))
+	if opts := synOptions(t, b); !bytes.Equal(opts.FastOpenCookie, cookie) {
+		t.Errorf("got SYN cookie = %x, want = %x", opts.FastOpenCookie, cookie)
+	}
+	return ep, b
+}
+
+func TestFastOpenActive(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	cookie := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	cacheCookie(t, c, cookie)
+
+	var wq waiter.Queue
+	data := []byte{1, 2, 3, 4}
+	ep, syn := connectWithData(t, c, &wq, cookie, data)
+	defer ep.Close()
+	defer syn.Release()
+
+	// The peer acknowledges the data of the SYN, so it isn't sent again.
+	port, irs := replySynAck(t, c, syn, len(data), cookie)
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b, checker.TCP(
+		checker.DstPort(context.TestPort),
+		checker.SrcPort(port),
+		checker.TCPFlags(header.TCPFlagAck),
+		checker.TCPSeqNum(uint32(irs)+1+uint32(len(data))),
+	))
+	c.CheckNoPacket("data of the SYN sent again")
+	if got := c.Stack().Stats().TCP.FastOpenActive.Value(); got != 1 {
+		t.Errorf("got stats.TCP.FastOpenActive = %d, want = 1", got)
+	}
+}
+
+func TestFastOpenActiveDataNotAcked(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	cookie := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	cacheCookie(t, c, cookie)
+
+	var wq waiter.Queue
+	data := []byte{1, 2, 3, 4}
+	ep, syn := connectWithData(t, c, &wq, cookie, data)
+	defer ep.Close()
+	defer syn.Release()
+
+	// The peer only acknowledges the SYN, so its data is sent again once
+	// the handshake completes.
+	_, irs := replySynAck(t, c, syn, 0, cookie)
+	for {
+		b := c.GetPacket()
+		tcpHdr := header.TCP(header.IPv4(b.AsSlice()).Payload())
+		if len(tcpHdr.Payload()) == 0 {
+			b.Release()
+			continue
+		}
+		checker.IPv4(t, b, checker.TCP(
+			checker.DstPort(context.TestPort),
+			checker.TCPSeqNum(uint32(irs)+1),
+			checker.Payload(data),
+		))
+		b.Release()
+		break
+	}
+	if got := c.Stack().Stats().TCP.FastOpenActiveFail.Value(); got != 1 {
+		t.Errorf("got stats.TCP.FastOpenActiveFail = %d, want = 1", got)
+	}
+}
+
+func TestFastOpenActiveWriteOption(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	cookie := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	cacheCookie(t, c, cookie)
+
+	// A write with the FastOpen option connects the endpoint, as
+	// MSG_FASTOPEN does.
+	var wq waiter.Queue
+	ep, err := c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+	defer ep.Close()
+
+	data := []byte{1, 2, 3, 4}
+	var r bytes.Reader
+	r.Reset(data)
+	n, err := ep.Write(&r, tcpip.WriteOptions{
+		To:       &tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort},
+		FastOpen: true,
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("got Write = %d, want = %d", n, len(data))
+	}
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b, checker.TCP(
+		checker.DstPort(context.TestPort),
+		checker.TCPFlags(header.TCPFlagSyn),
+		checker.Payload(data),
+	))
+}
+
+func TestFastOpenSockOpts(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	setStackFastOpen(t, c, 0)
+	c.Create(-1 /* epRcvBuf */)
+	if err := c.EP.SetSockOptInt(tcpip.TCPFastOpenConnectOption, 1); err == nil {
+		t.Errorf("got SetSockOptInt(TCPFastOpenConnectOption, 1) = nil with Fast Open disabled, want error")
+	}
+	if err := c.EP.SetSockOptInt(tcpip.TCPFastOpenQueueLenOption, -1); err == nil {
+		t.Errorf("got SetSockOptInt(TCPFastOpenQueueLenOption, -1) = nil, want error")
+	}
+	if err := c.EP.SetSockOptInt(tcpip.TCPFastOpenQueueLenOption, 3); err != nil {
+		t.Fatalf("SetSockOptInt(TCPFastOpenQueueLenOption, 3) failed: %s", err)
+	}
+	if v, err := c.EP.GetSockOptInt(tcpip.TCPFastOpenQueueLenOption); err != nil || v != 3 {
+		t.Errorf("got GetSockOptInt(TCPFastOpenQueueLenOption) = (%d, %v), want = (3, nil)", v, err)
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	// Allow TCP async work to complete to avoid false reports of leaks.
+	// TODO(gvisor.dev/issue/5940): Use fake clock in tests.
+	time.Sleep(1 * time.Second)
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
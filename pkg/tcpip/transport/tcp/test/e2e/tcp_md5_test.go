@@ -0,0 +1,379 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_md5_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/refs"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checker"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/seqnum"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/test/e2e"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp/testing/context"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+var (
+	testKey  = []byte("test key")
+	otherKey = []byte("other key")
+)
+
+func setMD5Key(t *testing.T, ep tcpip.Endpoint, addr tcpip.Address, prefixLen int, key []byte) {
+	t.Helper()
+	opt := tcpip.TCPMD5SigOption{Address: addr, PrefixLen: prefixLen, Key: key}
+	if err := ep.SetSockOpt(&opt); err != nil {
+		t.Fatalf("SetSockOpt(&%+v): %s", opt, err)
+	}
+}
+
+// md5Options returns the TCP options of a segment carrying an MD5 signature
+// option followed by opts.
+func md5Options(opts []byte) []byte {
+	b := make([]byte, header.TCPOptionsMaximumSize)
+	offset := header.EncodeNOP(b)
+	offset += header.EncodeNOP(b[offset:])
+	offset += header.EncodeMD5Option(b[offset:])
+	offset += copy(b[offset:], opts)
+	return b[:offset]
+}
+
+// sendSigned sends a segment carrying payload and an MD5 signature computed
+// with key. h.TCPOpts must include an MD5 signature option.
+func sendSigned(t *testing.T, c *context.Context, payload []byte, h *context.Headers, key []byte) {
+	t.Helper()
+	buf := c.BuildSegment(payload, h)
+	b := buf.Flatten()
+	buf.Release()
+
+	ip := header.IPv4(b)
+	tcpHdr := header.TCP(ip.Payload())
+	digest, ok := header.ParseMD5Option(tcpHdr.Options())
+	if !ok {
+		t.Fatalf("segment options %v lack an MD5 signature option", tcpHdr.Options())
+	}
+	d := header.NewTCPMD5Hash(tcpHdr, ip.SourceAddress(), ip.DestinationAddress(), len(payload))
+	d.Write(payload)
+	d.Write(key)
+	d.Sum(digest[:0])
+
+	tcpHdr.SetChecksum(0)
+	xsum := header.PseudoHeaderChecksum(tcp.ProtocolNumber, ip.SourceAddress(), ip.DestinationAddress(), uint16(len(tcpHdr)))
+	xsum = checksum.Checksum(payload, xsum)
+	tcpHdr.SetChecksum(^tcpHdr.CalculateChecksum(xsum))
+	c.SendSegment(buffer.MakeWithData(b))
+}
+
+// checkSigned checks that the segment in b carries a valid MD5 signature
+// computed with key.
+func checkSigned(t *testing.T, b *buffer.View, key []byte) {
+	t.Helper()
+	ip := header.IPv4(b.AsSlice())
+	tcpHdr := header.TCP(ip.Payload())
+	digest, ok := header.ParseMD5Option(tcpHdr.Options())
+	if !ok {
+		t.Fatalf("segment options %v lack an MD5 signature option", tcpHdr.Options())
+	}
+	d := header.NewTCPMD5Hash(tcpHdr, ip.SourceAddress(), ip.DestinationAddress(), len(tcpHdr.Payload()))
+	d.Write(tcpHdr.Payload())
+	d.Write(key)
+	if want := d.Sum(nil); !bytes.Equal(digest, want) {
+		t.Errorf("got MD5 signature = %x, want = %x", digest, want)
+	}
+}
+
+// connectSigned connects c.EP, which must have testKey installed for
+// context.TestAddr, completing the handshake with signed segments. It returns
+// the ISS of c.EP.
+func connectSigned(t *testing.T, c *context.Context) seqnum.Value {
+	t.Helper()
+	we, ch := waiter.NewChannelEntry(waiter.WritableEvents)
+	c.WQ.EventRegister(&we)
+	defer c.WQ.EventUnregister(&we)
+
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != nil {
+		if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
+			t.Fatalf("Connect failed: %s", err)
+		}
+	}
+
+	syn := c.GetPacket()
+	defer syn.Release()
+	checker.IPv4(t, syn, checker.TCP(
+		checker.DstPort(context.TestPort),
+		checker.TCPFlags(header.TCPFlagSyn),
+	))
+	checkSigned(t, syn, testKey)
+	tcpHdr := header.TCP(header.IPv4(syn.AsSlice()).Payload())
+	if opts := header.ParseSynOptions(tcpHdr.Options(), false /* isAck */); opts.MSS == 0 {
+		t.Errorf("got SYN options %+v, want an MSS", opts)
+	}
+	c.Port = tcpHdr.SourcePort()
+	c.IRS = seqnum.Value(tcpHdr.SequenceNumber())
+
+	iss := seqnum.Value(context.TestInitialSequenceNumber)
+	sendSigned(t, c, nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagSyn | header.TCPFlagAck,
+		SeqNum:  iss,
+		AckNum:  c.IRS.Add(1),
+		RcvWnd:  30000,
+		TCPOpts: md5Options(nil),
+	}, testKey)
+
+	ack := c.GetPacket()
+	defer ack.Release()
+	checker.IPv4(t, ack, checker.TCP(
+		checker.TCPFlags(header.TCPFlagAck),
+		checker.TCPSeqNum(uint32(c.IRS)+1),
+		checker.TCPAckNum(uint32(iss)+1),
+	))
+	checkSigned(t, ack, testKey)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for connection")
+	}
+	if got, want := tcp.EndpointState(c.EP.State()), tcp.StateEstablished; got != want {
+		t.Fatalf("got endpoint state = %s, want = %s", got, want)
+	}
+	return iss
+}
+
+func TestMD5ActiveOpen(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.Create(-1)
+	setMD5Key(t, c.EP, context.TestAddr, 32, testKey)
+	iss := connectSigned(t, c)
+
+	data := []byte{1, 2, 3, 4}
+	h := context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  iss.Add(1),
+		AckNum:  c.IRS.Add(1),
+		RcvWnd:  30000,
+	}
+	stats := c.Stack().Stats().TCP
+
+	// Segments lacking a signature are dropped.
+	c.SendPacket(data, &h)
+	c.CheckNoPacket("unsigned segment was acknowledged")
+	if got := stats.MD5NotFound.Value(); got != 1 {
+		t.Errorf("got stats.TCP.MD5NotFound = %d, want = 1", got)
+	}
+
+	// So are segments signed with another key.
+	h.TCPOpts = md5Options(nil)
+	sendSigned(t, c, data, &h, otherKey)
+	c.CheckNoPacket("segment with an invalid signature was acknowledged")
+	if got := stats.MD5Failure.Value(); got != 1 {
+		t.Errorf("got stats.TCP.MD5Failure = %d, want = 1", got)
+	}
+
+	sendSigned(t, c, data, &h, testKey)
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b, checker.TCP(
+		checker.TCPFlags(header.TCPFlagAck),
+		checker.TCPAckNum(uint32(iss)+1+uint32(len(data))),
+	))
+	checkSigned(t, b, testKey)
+
+	var buf bytes.Buffer
+	if _, err := c.EP.Read(&buf, tcpip.ReadOptions{}); err != nil {
+		t.Fatalf("Read failed: %s", err)
+	}
+	if got := buf.Bytes(); !bytes.Equal(got, data) {
+		t.Errorf("got Read = %v, want = %v", got, data)
+	}
+
+	// Data segments are signed too.
+	var r bytes.Reader
+	r.Reset(data)
+	if _, err := c.EP.Write(&r, tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	b = c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b, checker.TCP(
+		checker.TCPSeqNum(uint32(c.IRS)+1),
+		checker.Payload(data),
+	))
+	checkSigned(t, b, testKey)
+}
+
+func TestMD5UnexpectedSignature(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	iss := seqnum.Value(context.TestInitialSequenceNumber)
+	c.CreateConnected(iss, 30000, -1 /* epRcvBuf */)
+
+	// Signed segments are dropped by endpoints without a key for the peer.
+	sendSigned(t, c, []byte{1, 2, 3, 4}, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: c.Port,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  iss.Add(1),
+		AckNum:  c.IRS.Add(1),
+		RcvWnd:  30000,
+		TCPOpts: md5Options(nil),
+	}, testKey)
+	c.CheckNoPacket("signed segment was acknowledged")
+	if got := c.Stack().Stats().TCP.MD5Unexpected.Value(); got != 1 {
+		t.Errorf("got stats.TCP.MD5Unexpected = %d, want = 1", got)
+	}
+}
+
+func TestMD5PassiveOpen(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	var err tcpip.Error
+	c.EP, err = c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &c.WQ)
+	if err != nil {
+		t.Fatalf("NewEndpoint failed: %s", err)
+	}
+	// The key with the longest prefix matching the peer is used.
+	setMD5Key(t, c.EP, context.TestAddr, 8, otherKey)
+	setMD5Key(t, c.EP, context.TestAddr, 32, testKey)
+	if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+		t.Fatalf("Bind failed: %s", err)
+	}
+	if err := c.EP.Listen(10); err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+
+	irs := seqnum.Value(context.TestInitialSequenceNumber)
+	h := context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagSyn,
+		SeqNum:  irs,
+		RcvWnd:  30000,
+	}
+
+	// Unsigned SYNs are dropped.
+	c.SendPacket(nil, &h)
+	c.CheckNoPacket("unsigned SYN was answered")
+	if got := c.Stack().Stats().TCP.MD5NotFound.Value(); got != 1 {
+		t.Errorf("got stats.TCP.MD5NotFound = %d, want = 1", got)
+	}
+
+	h.TCPOpts = md5Options(nil)
+	sendSigned(t, c, nil, &h, testKey)
+	synAck := c.GetPacket()
+	defer synAck.Release()
+	checker.IPv4(t, synAck, checker.TCP(
+		checker.SrcPort(context.StackPort),
+		checker.DstPort(context.TestPort),
+		checker.TCPFlags(header.TCPFlagAck|header.TCPFlagSyn),
+		checker.TCPAckNum(uint32(irs)+1),
+	))
+	checkSigned(t, synAck, testKey)
+
+	we, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	c.WQ.EventRegister(&we)
+	defer c.WQ.EventUnregister(&we)
+
+	iss := seqnum.Value(header.TCP(header.IPv4(synAck.AsSlice()).Payload()).SequenceNumber())
+	sendSigned(t, c, nil, &context.Headers{
+		SrcPort: context.TestPort,
+		DstPort: context.StackPort,
+		Flags:   header.TCPFlagAck,
+		SeqNum:  irs.Add(1),
+		AckNum:  iss.Add(1),
+		RcvWnd:  30000,
+		TCPOpts: md5Options(nil),
+	}, testKey)
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for accept")
+	}
+	ep, _, err := c.EP.Accept(nil)
+	if err != nil {
+		t.Fatalf("Accept failed: %s", err)
+	}
+	defer ep.Close()
+
+	// The accepted endpoint signs its segments with the listener's key.
+	data := []byte{1, 2, 3, 4}
+	var r bytes.Reader
+	r.Reset(data)
+	if _, err := ep.Write(&r, tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b, checker.TCP(
+		checker.TCPSeqNum(uint32(iss)+1),
+		checker.Payload(data),
+	))
+	checkSigned(t, b, testKey)
+}
+
+func TestMD5RemoveKey(t *testing.T) {
+	c := context.New(t, e2e.DefaultMTU)
+	defer c.Cleanup()
+
+	c.Create(-1)
+	opt := tcpip.TCPMD5SigOption{Address: context.TestAddr, PrefixLen: 32}
+	if err := c.EP.SetSockOpt(&opt); err == nil {
+		t.Errorf("got SetSockOpt(&%+v) = nil, want = %s", opt, &tcpip.ErrNoSuchFile{})
+	} else if _, ok := err.(*tcpip.ErrNoSuchFile); !ok {
+		t.Errorf("got SetSockOpt(&%+v) = %s, want = %s", opt, err, &tcpip.ErrNoSuchFile{})
+	}
+
+	setMD5Key(t, c.EP, context.TestAddr, 32, testKey)
+	setMD5Key(t, c.EP, context.TestAddr, 32, nil)
+
+	if err := c.EP.Connect(tcpip.FullAddress{Addr: context.TestAddr, Port: context.TestPort}); err != nil {
+		if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
+			t.Fatalf("Connect failed: %s", err)
+		}
+	}
+	b := c.GetPacket()
+	defer b.Release()
+	checker.IPv4(t, b, checker.TCP(checker.TCPFlags(header.TCPFlagSyn)))
+	if _, ok := header.ParseMD5Option(header.TCP(header.IPv4(b.AsSlice()).Payload()).Options()); ok {
+		t.Errorf("got SYN with an MD5 signature option after the key was removed")
+	}
+}
+
+func TestMain(m *testing.M) {
+	refs.SetLeakMode(refs.LeaksPanic)
+	code := m.Run()
+	// Allow TCP async work to complete to avoid false reports of leaks.
+	// TODO(gvisor.dev/issue/5940): Use fake clock in tests.
+	time.Sleep(1 * time.Second)
+	refs.DoLeakCheck()
+	os.Exit(code)
+}
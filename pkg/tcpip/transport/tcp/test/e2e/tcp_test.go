@@ -5821,6 +5821,7 @@ func TestStackSetCongestionControl(t *testing.T) {
 	}{
 		{"reno", nil},
 		{"cubic", nil},
+		{"bbr", nil},
 		{"blahblah", &tcpip.ErrNoSuchFile{}},
 	}
 
@@ -5873,7 +5874,7 @@ func TestStackAvailableCongestionControl(t *testing.T) {
 	if err := s.TransportProtocolOption(tcp.ProtocolNumber, &aCC); err != nil {
 		t.Fatalf("s.TransportProtocolOption(%v, %v) = %v", tcp.ProtocolNumber, &aCC, err)
 	}
-	if got, want := aCC, tcpip.TCPAvailableCongestionControlOption("reno cubic"); got != want {
+	if got, want := aCC, tcpip.TCPAvailableCongestionControlOption("reno cubic bbr"); got != want {
 		t.Fatalf("got tcpip.TCPAvailableCongestionControlOption: %v, want: %v", got, want)
 	}
 }
@@ -5895,7 +5896,7 @@ func TestStackSetAvailableCongestionControl(t *testing.T) {
 	if err := s.TransportProtocolOption(tcp.ProtocolNumber, &cc); err != nil {
 		t.Fatalf("s.TransportProtocolOptio(%d, &%T(%s)): %s", tcp.ProtocolNumber, cc, cc, err)
 	}
-	if got, want := cc, tcpip.TCPAvailableCongestionControlOption("reno cubic"); got != want {
+	if got, want := cc, tcpip.TCPAvailableCongestionControlOption("reno cubic bbr"); got != want {
 		t.Fatalf("got tcpip.TCPAvailableCongestionControlOption = %s, want = %s", got, want)
 	}
 }
@@ -5907,6 +5908,7 @@ func TestEndpointSetCongestionControl(t *testing.T) {
 	}{
 		{"reno", nil},
 		{"cubic", nil},
+		{"bbr", nil},
 		{"blahblah", &tcpip.ErrNoSuchFile{}},
 	}
 
@@ -9170,6 +9172,12 @@ func TestECNFlagsAccept(t *testing.T) {
 			c := context.New(t, e2e.DefaultMTU)
 			defer c.Cleanup()
 
+			// Disable ECN so that the SYN-ACK doesn't negotiate it.
+			ecn := tcpip.TCPECNDisabled
+			if err := c.Stack().SetTransportProtocolOption(tcp.ProtocolNumber, &ecn); err != nil {
+				t.Fatalf("SetTransportProtocolOption(%d, &%d): %s", tcp.ProtocolNumber, ecn, err)
+			}
+
 			// Create EP and start listening.
 			wq := &waiter.Queue{}
 			ep, err := c.Stack().NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, wq)
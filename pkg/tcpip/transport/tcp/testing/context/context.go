@@ -114,6 +114,9 @@ type Headers struct {
 	// TCPOpts holds the options to be sent in the option field of the TCP
 	// header.
 	TCPOpts []byte
+
+	// TOS is the value of the TOS field in the IPv4 header.
+	TOS uint8
 }
 
 // Options contains options for creating a new test context.
@@ -463,6 +466,7 @@ func (c *Context) BuildSegmentWithAddrs(payload []byte, h *Headers, src, dst tcp
 	ip := header.IPv4(buf)
 	ip.Encode(&header.IPv4Fields{
 		TotalLength: uint16(len(buf)),
+		TOS:         h.TOS,
 		TTL:         65,
 		Protocol:    uint8(tcp.ProtocolNumber),
 		SrcAddr:     src,
@@ -46,8 +46,23 @@ type udpPacket struct {
 	tosOrTClass uint8
 	// ttlOrHopLimit stores either the TTL for IPv4 or the HopLimit for IPv6
 	ttlOrHopLimit uint8
+	// segmentSize and segments describe the datagrams coalesced into pkt when
+	// UDP_GRO is enabled: all but the last of the segments are segmentSize
+	// bytes long.
+	segmentSize int
+	segments    int
 }
 
+const (
+	// maxSegments is the maximum number of datagrams a write may be split
+	// into with UDP_SEGMENT. It matches Linux's UDP_MAX_SEGMENTS.
+	maxSegments = 128
+
+	// maxGROSegments is the maximum number of datagrams coalesced into one
+	// with UDP_GRO. It matches Linux's UDP_GRO_CNT_MAX.
+	maxGROSegments = 64
+)
+
 // endpoint represents a UDP endpoint. This struct serves as the interface
 // between users of the endpoint and the protocol implementation; it is legal to
 // have concurrent goroutines make calls into the endpoint, they are properly
@@ -74,6 +89,9 @@ type endpoint struct {
 	rcvList    udpPacketList
 	rcvBufSize int
 	rcvClosed  bool
+	// gro indicates whether received datagrams are coalesced, as specified
+	// using the UDP_GRO option.
+	gro bool
 
 	lastErrorMu sync.Mutex `state:"nosave"`
 	lastError   tcpip.Error
@@ -89,6 +107,11 @@ type endpoint struct {
 
 	readShutdown bool
 
+	// segmentSize is the size of the datagrams written messages are split
+	// into, as specified using the UDP_SEGMENT option. Zero disables
+	// segmentation.
+	segmentSize uint16
+
 	// effectiveNetProtos contains the network protocols actually in use. In
 	// most cases it will only contain "netProto", but in cases like IPv6
 	// endpoints with v6only set to false, this could include multiple
@@ -286,6 +309,11 @@ func (e *endpoint) Read(dst io.Writer, opts tcpip.ReadOptions) (tcpip.ReadResult
 		cm.OriginalDstAddress = p.destinationAddress
 	}
 
+	if p.segments > 1 {
+		cm.HasUDPGROSize = true
+		cm.UDPGROSize = uint16(p.segmentSize)
+	}
+
 	// Read Result
 	res := tcpip.ReadResult{
 		Total:           p.pkt.Data().Size(),
@@ -369,7 +397,7 @@ func (e *endpoint) Write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 		e.stats.WriteErrors.WriteClosed.Increment()
 	case *tcpip.ErrInvalidEndpointState:
 		e.stats.WriteErrors.InvalidEndpointState.Increment()
-	case *tcpip.ErrHostUnreachable, *tcpip.ErrBroadcastDisabled, *tcpip.ErrNetworkUnreachable:
+	case *tcpip.ErrHostUnreachable, *tcpip.ErrBroadcastDisabled, *tcpip.ErrNetworkUnreachable, *tcpip.ErrPermissionDenied:
 		// Errors indicating any problem with IP routing of the packet.
 		e.stats.SendErrors.NoRoute.Increment()
 	default:
@@ -432,10 +460,25 @@ func (e *endpoint) prepareForWrite(p tcpip.Payloader, opts tcpip.WriteOptions) (
 		return udpPacketInfo{}, &tcpip.ErrMessageTooLong{}
 	}
 
+	segmentSize := int(e.segmentSize)
+	if opts.ControlMessages.HasUDPSegmentSize {
+		segmentSize = int(opts.ControlMessages.UDPSegmentSize)
+	}
+	if segmentSize != 0 {
+		// Like Linux, fail writes that can't be split into datagrams that fit
+		// in the MTU, that would be split into too many datagrams, or whose
+		// datagrams would be sent without a checksum.
+		if header.UDPMinimumSize+segmentSize > int(ctx.MTU()) || p.Len() > segmentSize*maxSegments || e.ops.GetNoChecksum() {
+			ctx.Release()
+			return udpPacketInfo{}, &tcpip.ErrInvalidOptionValue{}
+		}
+	}
+
 	return udpPacketInfo{
-		ctx:        ctx,
-		localPort:  e.localPort,
-		remotePort: dst.Port,
+		ctx:         ctx,
+		localPort:   e.localPort,
+		remotePort:  dst.Port,
+		segmentSize: segmentSize,
 	}, nil
 }
 
@@ -463,12 +506,47 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 
 	dataSz := p.Len()
 	pktInfo := udpInfo.ctx.PacketInfo()
-	pkt := udpInfo.ctx.TryNewPacketBufferFromPayloader(header.UDPMinimumSize+int(pktInfo.MaxHeaderLength), p)
+	reserveHdrBytes := header.UDPMinimumSize + int(pktInfo.MaxHeaderLength)
+	pkt := udpInfo.ctx.TryNewPacketBufferFromPayloader(reserveHdrBytes, p)
 	if pkt == nil {
 		return 0, &tcpip.ErrWouldBlock{}
 	}
 	defer pkt.DecRef()
 
+	if udpInfo.segmentSize == 0 || dataSz <= udpInfo.segmentSize {
+		if err := e.writePacket(&udpInfo, pkt); err != nil {
+			return 0, err
+		}
+		return int64(dataSz), nil
+	}
+
+	// Split the payload into datagrams of segmentSize bytes, the last of
+	// which may be shorter. The segmentation is done in software, and the
+	// whole payload stays charged to the send buffer until all the datagrams
+	// have been written.
+	data := pkt.Data().ToBuffer()
+	defer data.Release()
+	for data.Size() > 0 {
+		seg := data.Clone()
+		seg.Truncate(int64(udpInfo.segmentSize))
+		data.TrimFront(int64(udpInfo.segmentSize))
+		segPkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			ReserveHeaderBytes: reserveHdrBytes,
+			Payload:            seg,
+		})
+		err := e.writePacket(&udpInfo, segPkt)
+		segPkt.DecRef()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(dataSz), nil
+}
+
+// writePacket writes pkt as a single datagram.
+func (e *endpoint) writePacket(udpInfo *udpPacketInfo, pkt *stack.PacketBuffer) tcpip.Error {
+	pktInfo := udpInfo.ctx.PacketInfo()
+
 	// Initialize the UDP header.
 	udp := header.UDP(pkt.TransportHeader().Push(header.UDPMinimumSize))
 	pkt.TransportProtocolNumber = ProtocolNumber
@@ -516,12 +594,12 @@ func (e *endpoint) write(p tcpip.Payloader, opts tcpip.WriteOptions) (int64, tcp
 	}
 	if err := udpInfo.ctx.WritePacket(pkt, false /* headerIncluded */); err != nil {
 		e.stack.Stats().UDP.PacketSendErrors.Increment()
-		return 0, err
+		return err
 	}
 
 	// Track count of packets sent.
 	e.stack.Stats().UDP.PacketsSent.Increment()
-	return int64(dataSz), nil
+	return nil
 }
 
 // OnReuseAddressSet implements tcpip.SocketOptionsHandler.
@@ -540,7 +618,25 @@ func (e *endpoint) OnReusePortSet(v bool) {
 
 // SetSockOptInt implements tcpip.Endpoint.
 func (e *endpoint) SetSockOptInt(opt tcpip.SockOptInt, v int) tcpip.Error {
-	return e.net.SetSockOptInt(opt, v)
+	switch opt {
+	case tcpip.UDPSegmentOption:
+		if v < 0 || v > math.MaxUint16 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		e.mu.Lock()
+		e.segmentSize = uint16(v)
+		e.mu.Unlock()
+		return nil
+
+	case tcpip.UDPGROOption:
+		e.rcvMu.Lock()
+		e.gro = v != 0
+		e.rcvMu.Unlock()
+		return nil
+
+	default:
+		return e.net.SetSockOptInt(opt, v)
+	}
 }
 
 var _ tcpip.SocketOptionsHandler = (*endpoint)(nil)
@@ -568,6 +664,21 @@ func (e *endpoint) GetSockOptInt(opt tcpip.SockOptInt) (int, tcpip.Error) {
 		e.rcvMu.Unlock()
 		return v, nil
 
+	case tcpip.UDPSegmentOption:
+		e.mu.RLock()
+		v := int(e.segmentSize)
+		e.mu.RUnlock()
+		return v, nil
+
+	case tcpip.UDPGROOption:
+		e.rcvMu.Lock()
+		v := e.gro
+		e.rcvMu.Unlock()
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+
 	default:
 		return e.net.GetSockOptInt(opt)
 	}
@@ -583,6 +694,10 @@ type udpPacketInfo struct {
 	ctx        network.WriteContext
 	localPort  uint16
 	remotePort uint16
+
+	// segmentSize is the size of the datagrams the payload is split into, or
+	// zero if it is sent as a single datagram.
+	segmentSize int
 }
 
 // Disconnect implements tcpip.Endpoint.
@@ -920,9 +1035,20 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 		return
 	}
 
+	// Multicast packets are only delivered if the membership's source filter
+	// accepts their source.
+	if !e.net.IsMulticastSourceAllowed(pkt.NICID, netHdr.DestinationAddress(), netHdr.SourceAddress()) {
+		return
+	}
+
 	e.stack.Stats().UDP.PacketsReceived.Increment()
 	e.stats.PacketsReceived.Increment()
 
+	size, ok := stack.FilterSince(&e.ops, pkt.TransportHeader())
+	if !ok {
+		return
+	}
+
 	e.rcvMu.Lock()
 	// Drop the packet if our buffer is not ready to receive packets.
 	if !e.rcvReady || e.rcvClosed {
@@ -943,7 +1069,6 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 
 	wasEmpty := e.rcvBufSize == 0
 
-	// Push new packet into receive list and increment the buffer size.
 	packet := &udpPacket{
 		netProto: pkt.NetworkProtocolNumber,
 		senderAddress: tcpip.FullAddress{
@@ -960,8 +1085,13 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 		// the underlying buffer. Clone does not copy the data, just the metadata.
 		pkt: pkt.Clone(),
 	}
-	e.rcvList.PushBack(packet)
-	e.rcvBufSize += pkt.Data().Size()
+	// Datagrams truncated by a socket filter are never coalesced.
+	if size < pkt.Data().Size() {
+		packet.pkt.Data().CapLength(size)
+	} else {
+		packet.segmentSize = size
+		packet.segments = 1
+	}
 
 	// Save any useful information from the network header to the packet.
 	packet.tosOrTClass, _ = pkt.Network().TOS()
@@ -981,6 +1111,15 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 	packet.packetInfo.NIC = pkt.NICID
 	packet.receivedAt = e.stack.Clock().Now()
 
+	// Push new packet into receive list, unless it was coalesced with the
+	// last one, and increment the buffer size.
+	if e.gro && e.coalesceLocked(packet) {
+		packet.pkt.DecRef()
+	} else {
+		e.rcvList.PushBack(packet)
+	}
+	e.rcvBufSize += size
+
 	e.rcvMu.Unlock()
 
 	// Notify any waiters that there's data to be read now.
@@ -989,6 +1128,48 @@ func (e *endpoint) HandlePacket(id stack.TransportEndpointID, pkt *stack.PacketB
 	}
 }
 
+// coalesceLocked appends the payload of p to the last packet in the receive
+// list if they come from the same flow and p can be its next segment, and
+// returns whether it did. Like Linux, all the segments of a coalesced
+// datagram have the same size, except for the last one which may be shorter.
+//
+// The packet at the front of the receive list is never appended to, as it may
+// be read without e.rcvMu held.
+//
+// +checklocks:e.rcvMu
+func (e *endpoint) coalesceLocked(p *udpPacket) bool {
+	last := e.rcvList.Back()
+	if last == nil || last == e.rcvList.Front() || p.segments == 0 || last.segments == 0 {
+		return false
+	}
+	if last.netProto != p.netProto ||
+		last.senderAddress != p.senderAddress ||
+		last.destinationAddress != p.destinationAddress ||
+		last.packetInfo != p.packetInfo ||
+		last.tosOrTClass != p.tosOrTClass ||
+		last.ttlOrHopLimit != p.ttlOrHopLimit {
+		return false
+	}
+
+	size, lastSize := p.pkt.Data().Size(), last.pkt.Data().Size()
+	switch {
+	case size == 0 || size > last.segmentSize:
+		return false
+	case lastSize != last.segments*last.segmentSize:
+		// The last segment is already shorter than the others.
+		return false
+	case last.segments >= maxGROSegments:
+		return false
+	case header.UDPMinimumSize+lastSize+size > header.UDPMaximumSize:
+		return false
+	}
+
+	buf := p.pkt.Data().ToBuffer()
+	last.pkt.Data().MergeBuffer(&buf)
+	last.segments++
+	return true
+}
+
 func (e *endpoint) onICMPError(err tcpip.Error, transErr stack.TransportError, pkt *stack.PacketBuffer) {
 	// Update last error first.
 	e.lastErrorMu.Lock()
@@ -2293,6 +2293,204 @@ func TestWritePayloadSizeTooBig(t *testing.T) {
 	}
 }
 
+func TestWriteSegmented(t *testing.T) {
+	const mtu = 1280
+	for _, flow := range []context.TestFlow{context.UnicastV4, context.UnicastV6} {
+		t.Run(fmt.Sprintf("flow:%s", flow), func(t *testing.T) {
+			for _, test := range []struct {
+				name         string
+				segmentSize  int
+				cmsgSize     uint16
+				payloadSize  int
+				wantSegments []int
+			}{
+				{
+					name:         "option",
+					segmentSize:  100,
+					payloadSize:  250,
+					wantSegments: []int{100, 100, 50},
+				},
+				{
+					name:         "control message",
+					cmsgSize:     120,
+					payloadSize:  240,
+					wantSegments: []int{120, 120},
+				},
+				{
+					name:         "control message overrides option",
+					segmentSize:  100,
+					cmsgSize:     200,
+					payloadSize:  250,
+					wantSegments: []int{200, 50},
+				},
+				{
+					name:         "payload fits in one segment",
+					segmentSize:  100,
+					payloadSize:  80,
+					wantSegments: []int{80},
+				},
+			} {
+				t.Run(test.name, func(t *testing.T) {
+					c := context.NewWithOptions(t, []stack.TransportProtocolFactory{udp.NewProtocol}, context.Options{MTU: mtu})
+					defer c.Cleanup()
+
+					c.CreateEndpointForFlow(flow, udp.ProtocolNumber)
+					if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, test.segmentSize); err != nil {
+						t.Fatalf("SetSockOptInt(UDPSegmentOption, %d): %s", test.segmentSize, err)
+					}
+
+					writeOpts := getWriteOptionsForFlow(flow)
+					if test.cmsgSize != 0 {
+						writeOpts.ControlMessages.HasUDPSegmentSize = true
+						writeOpts.ControlMessages.UDPSegmentSize = test.cmsgSize
+					}
+					payload := newRandomPayload(test.payloadSize)
+					var r bytes.Reader
+					r.Reset(payload)
+					if n, err := c.EP.Write(&r, writeOpts); err != nil {
+						t.Fatalf("Write: %s", err)
+					} else if n != int64(len(payload)) {
+						t.Fatalf("got Write = %d, want = %d", n, len(payload))
+					}
+
+					h := flow.MakeHeader4Tuple(context.Outgoing)
+					for _, size := range test.wantSegments {
+						p := c.LinkEP.Read()
+						if p == nil {
+							t.Fatalf("segment of %d bytes wasn't written out", size)
+						}
+						v := p.ToView()
+						flow.CheckerFn()(t, v,
+							checker.SrcAddr(h.Src.Addr),
+							checker.DstAddr(h.Dst.Addr),
+							checker.UDP(
+								checker.DstPort(h.Dst.Port),
+								checker.NoChecksum(false),
+								checker.Payload(payload[:size]),
+							),
+						)
+						v.Release()
+						p.DecRef()
+						payload = payload[size:]
+					}
+					if p := c.LinkEP.Read(); p != nil {
+						p.DecRef()
+						t.Fatal("unexpected segment written out")
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestWriteSegmentedInvalid(t *testing.T) {
+	const mtu = 1280
+	for _, flow := range []context.TestFlow{context.UnicastV4, context.UnicastV6} {
+		t.Run(fmt.Sprintf("flow:%s", flow), func(t *testing.T) {
+			for _, test := range []struct {
+				name        string
+				segmentSize int
+				payloadSize int
+				noChecksum  bool
+			}{
+				{
+					name:        "segment exceeds MTU",
+					segmentSize: mtu,
+					payloadSize: 2 * mtu,
+				},
+				{
+					name:        "too many segments",
+					segmentSize: 10,
+					payloadSize: 10*128 + 1,
+				},
+				{
+					name:        "no checksum",
+					segmentSize: 100,
+					payloadSize: 250,
+					noChecksum:  true,
+				},
+			} {
+				t.Run(test.name, func(t *testing.T) {
+					c := context.NewWithOptions(t, []stack.TransportProtocolFactory{udp.NewProtocol}, context.Options{MTU: mtu})
+					defer c.Cleanup()
+
+					c.CreateEndpointForFlow(flow, udp.ProtocolNumber)
+					c.EP.SocketOptions().SetNoChecksum(test.noChecksum)
+					if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, test.segmentSize); err != nil {
+						t.Fatalf("SetSockOptInt(UDPSegmentOption, %d): %s", test.segmentSize, err)
+					}
+					testWriteFails(c, flow, test.payloadSize, &tcpip.ErrInvalidOptionValue{})
+				})
+			}
+		})
+	}
+}
+
+func TestSegmentOption(t *testing.T) {
+	c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol})
+	defer c.Cleanup()
+
+	c.CreateEndpoint(ipv4.ProtocolNumber, udp.ProtocolNumber)
+	for _, v := range []int{-1, math.MaxUint16 + 1} {
+		if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, v); err == nil {
+			t.Errorf("SetSockOptInt(UDPSegmentOption, %d) succeeded, want error", v)
+		}
+	}
+	if err := c.EP.SetSockOptInt(tcpip.UDPSegmentOption, 1000); err != nil {
+		t.Fatalf("SetSockOptInt(UDPSegmentOption, 1000): %s", err)
+	}
+	if v, err := c.EP.GetSockOptInt(tcpip.UDPSegmentOption); err != nil {
+		t.Fatalf("GetSockOptInt(UDPSegmentOption): %s", err)
+	} else if v != 1000 {
+		t.Errorf("got GetSockOptInt(UDPSegmentOption) = %d, want = 1000", v)
+	}
+}
+
+func TestReceiveCoalesced(t *testing.T) {
+	for _, flow := range []context.TestFlow{context.UnicastV4, context.UnicastV6} {
+		t.Run(fmt.Sprintf("flow:%s", flow), func(t *testing.T) {
+			for _, gro := range []bool{true, false} {
+				t.Run(fmt.Sprintf("gro:%t", gro), func(t *testing.T) {
+					c := context.New(t, []stack.TransportProtocolFactory{udp.NewProtocol})
+					defer c.Cleanup()
+
+					c.CreateEndpointForFlow(flow, udp.ProtocolNumber)
+					if err := c.EP.Bind(tcpip.FullAddress{Port: context.StackPort}); err != nil {
+						t.Fatalf("Bind: %s", err)
+					}
+					v := 0
+					if gro {
+						v = 1
+					}
+					if err := c.EP.SetSockOptInt(tcpip.UDPGROOption, v); err != nil {
+						t.Fatalf("SetSockOptInt(UDPGROOption, %d): %s", v, err)
+					}
+
+					// The datagram at the front of the queue is never
+					// coalesced, and a short datagram ends a coalesced one.
+					var payloads [][]byte
+					for _, size := range []int{100, 100, 100, 50, 100} {
+						payload := newRandomPayload(size)
+						payloads = append(payloads, payload)
+						c.InjectPacket(flow.NetProto(), context.BuildUDPPacket(payload, flow, context.Incoming, testTOS, testTTL, false))
+					}
+
+					if !gro {
+						for _, payload := range payloads {
+							c.ReadFromEndpointExpectSuccess(payload, flow, checker.NoUDPGROSizeReceived())
+						}
+						return
+					}
+					c.ReadFromEndpointExpectSuccess(payloads[0], flow, checker.NoUDPGROSizeReceived())
+					coalesced := append(append(append([]byte(nil), payloads[1]...), payloads[2]...), payloads[3]...)
+					c.ReadFromEndpointExpectSuccess(coalesced, flow, checker.ReceiveUDPGROSize(100))
+					c.ReadFromEndpointExpectSuccess(payloads[4], flow, checker.NoUDPGROSizeReceived())
+				})
+			}
+		})
+	}
+}
+
 func TestMain(m *testing.M) {
 	refs.SetLeakMode(refs.LeaksPanic)
 	code := m.Run()
@@ -135,6 +135,12 @@ type IOOpts struct {
 	// has an active AddressSpace and can therefore use AddressSpace copying
 	// without performing activation. See mm/io.go for details.
 	AddressSpaceActive bool
+
+	// If Remote is true, the IO is performed through an interface for
+	// accessing the memory of arbitrary processes, such as /proc/[pid]/mem,
+	// process_vm_readv(2), or ptrace(PTRACE_PEEKDATA), and may not access
+	// memory that is private to the address space (memfd_secret(2)).
+	Remote bool
 }
 
 // IOReadWriter is an io.ReadWriter that reads from / writes to addresses
@@ -155,6 +155,15 @@ var allowedSyscalls = seccomp.MakeSyscallRules(map[uintptr]seccomp.SyscallRule{
 	},
 	unix.SYS_LSEEK:   seccomp.MatchAll{},
 	unix.SYS_MADVISE: seccomp.MatchAll{},
+	// Used by pgalloc.MemoryFile if NUMA emulation is enabled.
+	unix.SYS_MBIND: seccomp.PerArg{
+		seccomp.AnyValue{}, /* addr */
+		seccomp.AnyValue{}, /* len */
+		seccomp.EqualTo(linux.MPOL_BIND),
+		seccomp.AnyValue{}, /* nodemask */
+		seccomp.AnyValue{}, /* maxnode */
+		seccomp.EqualTo(0), /* flags */
+	},
 	unix.SYS_MEMBARRIER: seccomp.PerArg{
 		seccomp.EqualTo(linux.MEMBARRIER_CMD_GLOBAL),
 		seccomp.EqualTo(0),
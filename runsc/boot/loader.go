@@ -73,6 +73,7 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/raw"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/sctp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
 	"gvisor.dev/gvisor/runsc/boot/filter"
@@ -89,8 +90,13 @@ import (
 
 	// Include other supported socket providers.
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/genetlink"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/netfilter"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/route"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/sockdiag"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/uevent"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/wireguard"
+	_ "gvisor.dev/gvisor/pkg/sentry/socket/netlink/xfrm"
 	_ "gvisor.dev/gvisor/pkg/sentry/socket/unix"
 )
 
@@ -210,6 +216,10 @@ type Loader struct {
 	// /sys/kernel/mm/transparent_hugepage/shmem_enabled.
 	hostShmemHuge string
 
+	// numaHostNodes is the list of host NUMA nodes backing each NUMA node in
+	// the sandbox.
+	numaHostNodes []int
+
 	// mu guards the fields below.
 	mu sync.Mutex
 
@@ -356,6 +366,10 @@ type Args struct {
 	// /sys/kernel/mm/transparent_hugepage/shmem_enabled, or empty if this is
 	// unknown.
 	HostShmemHuge string
+	// NUMAHostNodes is the list of host NUMA nodes backing each NUMA node in
+	// the sandbox. If it contains fewer than two nodes, the sandbox presents a
+	// single NUMA node.
+	NUMAHostNodes []int
 
 	SaveFDs []*fd.FD
 }
@@ -434,6 +448,7 @@ func New(args Args) (*Loader, error) {
 		stopProfiling:  stopProfiling,
 		productName:    args.ProductName,
 		hostShmemHuge:  args.HostShmemHuge,
+		numaHostNodes:  args.NUMAHostNodes,
 		containerIDs:   make(map[string]string),
 		containerSpecs: make(map[string]*specs.Spec),
 		saveFDs:        args.SaveFDs,
@@ -502,7 +517,7 @@ func New(args Args) (*Loader, error) {
 	l.k = &kernel.Kernel{Platform: p}
 
 	// Create memory file.
-	mf, err := createMemoryFile(args.Conf.AppHugePages, args.HostShmemHuge)
+	mf, err := createMemoryFile(args.Conf.AppHugePages, args.HostShmemHuge, args.NUMAHostNodes)
 	if err != nil {
 		return nil, fmt.Errorf("creating memory file: %w", err)
 	}
@@ -587,6 +602,7 @@ func New(args Args) (*Loader, error) {
 		RootUserNamespace:    creds.UserNamespace,
 		RootNetworkNamespace: netns,
 		ApplicationCores:     uint(args.NumCPU),
+		NUMANodes:            uint(mf.NUMANodes()),
 		Vdso:                 vdso,
 		VdsoParams:           params,
 		RootUTSNamespace:     kernel.NewUTSNamespace(args.Spec.Hostname, args.Spec.Hostname, creds.UserNamespace),
@@ -594,6 +610,7 @@ func New(args Args) (*Loader, error) {
 		PIDNamespace:         kernel.NewRootPIDNamespace(creds.UserNamespace),
 		MaxFDLimit:           maxFDLimit,
 		UnixSocketOpts:       unixSocketOpts,
+		AllowSecretMemSave:   args.Conf.AllowSecretMemSave,
 	}); err != nil {
 		return nil, fmt.Errorf("initializing kernel: %w", err)
 	}
@@ -783,7 +800,7 @@ func createPlatform(conf *config.Config, deviceFile *fd.FD) (platform.Platform,
 	return p.New(deviceFile)
 }
 
-func createMemoryFile(appHugePages bool, hostShmemHuge string) (*pgalloc.MemoryFile, error) {
+func createMemoryFile(appHugePages bool, hostShmemHuge string, numaHostNodes []int) (*pgalloc.MemoryFile, error) {
 	const memfileName = "runsc-memory"
 	memfd, err := memutil.CreateMemFD(memfileName, 0)
 	if err != nil {
@@ -820,6 +837,10 @@ func createMemoryFile(appHugePages bool, hostShmemHuge string) (*pgalloc.MemoryF
 			log.Infof("Disabling application huge pages: host shmem_huge is unknown value %q", hostShmemHuge)
 		}
 	}
+	if len(numaHostNodes) > 1 {
+		log.Infof("Enabling NUMA emulation: sandbox nodes backed by host nodes %v", numaHostNodes)
+		mfopts.NUMAHostNodes = numaHostNodes
+	}
 
 	mf, err := pgalloc.NewMemoryFile(memfile, mfopts)
 	if err != nil {
@@ -1496,6 +1517,7 @@ func newEmptySandboxNetworkStack(clock tcpip.Clock, allowPacketEndpointWrite boo
 	transProtos := []stack.TransportProtocolFactory{
 		tcp.NewProtocol,
 		udp.NewProtocol,
+		sctp.NewProtocol,
 		icmp.NewProtocol4,
 		icmp.NewProtocol6,
 	}
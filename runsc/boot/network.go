@@ -34,6 +34,8 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/link/fdbased"
 	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
 	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fifo"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fq"
+	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fqcodel"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.dev/gvisor/pkg/tcpip/link/xdp"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
@@ -393,6 +395,12 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			case config.QDiscFIFO:
 				log.Infof("Enabling FIFO QDisc on %q", link.Name)
 				qDisc = fifo.New(linkEP, runtime.GOMAXPROCS(0), 1000)
+			case config.QDiscFQ:
+				log.Infof("Enabling FQ QDisc on %q", link.Name)
+				qDisc = fq.New(linkEP, n.Stack.Clock(), fq.Options{})
+			case config.QDiscFQCoDel:
+				log.Infof("Enabling FQ-CoDel QDisc on %q", link.Name)
+				qDisc = fqcodel.New(linkEP, n.Stack.Clock(), fqcodel.Options{})
 			}
 
 			log.Infof("Enabling interface %q with id %d on addresses %+v (%v) w/ %d channels", link.Name, nicID, link.Addresses, mac, link.NumChannels)
@@ -486,6 +494,12 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		case config.QDiscFIFO:
 			log.Infof("Enabling FIFO QDisc on %q", link.Name)
 			qDisc = fifo.New(linkEP, runtime.GOMAXPROCS(0), 1000)
+		case config.QDiscFQ:
+			log.Infof("Enabling FQ QDisc on %q", link.Name)
+			qDisc = fq.New(linkEP, n.Stack.Clock(), fq.Options{})
+		case config.QDiscFQCoDel:
+			log.Infof("Enabling FQ-CoDel QDisc on %q", link.Name)
+			qDisc = fqcodel.New(linkEP, n.Stack.Clock(), fqcodel.Options{})
 		}
 
 		log.Infof("Enabling interface %q with id %d on addresses %+v (%v) w/ %d channels", link.Name, nicID, link.Addresses, mac, link.NumChannels)
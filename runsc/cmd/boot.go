@@ -162,6 +162,10 @@ type Boot struct {
 	// Value of /sys/kernel/mm/transparent_hugepage/shmem_enabled on the host.
 	hostShmemHuge string
 
+	// numaHostNodes is the list of host NUMA nodes backing each NUMA node in
+	// the sandbox, in the format of cpuset.mems.
+	numaHostNodes string
+
 	// FDs for profile data.
 	profileFDs profile.FDArgs
 
@@ -218,6 +222,7 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&b.productName, "product-name", "", "value to show in /sys/devices/virtual/dmi/id/product_name")
 	f.StringVar(&b.nvidiaDriverVersion, "nvidia-driver-version", "", "Nvidia driver version on the host")
 	f.StringVar(&b.hostShmemHuge, "host-shmem-huge", "", "value of /sys/kernel/mm/transparent_hugepage/shmem_enabled on the host")
+	f.StringVar(&b.numaHostNodes, "numa-host-nodes", "", "list of host NUMA nodes backing the sandbox's NUMA nodes, used if --numa is set")
 
 	// Open FDs that are donated to the sandbox.
 	f.IntVar(&b.specFD, "spec-fd", -1, "required fd with the container spec")
@@ -309,6 +314,17 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 		util.Fatalf("reading spec: %v", err)
 	}
 
+	// This also requires /sys, so must happen before chroot.
+	if conf.NUMA && len(b.numaHostNodes) == 0 {
+		if nodes, err := numaHostNodes(spec); err != nil {
+			log.Warningf("Failed to infer --numa-host-nodes: %v", err)
+		} else {
+			b.numaHostNodes = nodes
+			log.Infof("Setting numa-host-nodes: %q", b.numaHostNodes)
+			argOverride["numa-host-nodes"] = b.numaHostNodes
+		}
+	}
+
 	if b.setUpRoot {
 		if err := setUpChroot(spec, conf); err != nil {
 			util.Fatalf("error setting up chroot: %v", err)
@@ -481,6 +497,14 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 		log.Infof("Core tag enabled (core tag=%d)", coreTags[0])
 	}
 
+	var numaHostNodes []int
+	if conf.NUMA && len(b.numaHostNodes) != 0 {
+		numaHostNodes, err = hostmm.ParseNodeList(b.numaHostNodes)
+		if err != nil {
+			util.Fatalf("parsing --numa-host-nodes: %v", err)
+		}
+	}
+
 	// Create the loader.
 	bootArgs := boot.Args{
 		ID:                  f.Arg(0),
@@ -505,6 +529,7 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 		ProfileOpts:         b.profileFDs.ToOpts(),
 		NvidiaDriverVersion: b.nvidiaDriverVersion,
 		HostShmemHuge:       b.hostShmemHuge,
+		NUMAHostNodes:       numaHostNodes,
 		SaveFDs:             b.saveFDs.GetFDs(),
 	}
 	l, err := boot.New(bootArgs)
@@ -727,3 +752,38 @@ func exportFinalMetrics(f *os.File) error {
 	}
 	return nil
 }
+
+// numaHostNodes returns the value of --numa-host-nodes that should be used for
+// the given spec: all online host NUMA nodes, restricted to the spec's
+// cpuset.mems if specified.
+func numaHostNodes(spec *specs.Spec) (string, error) {
+	nodes, err := hostmm.OnlineNUMANodes()
+	if err != nil {
+		return "", err
+	}
+	if spec.Linux != nil && spec.Linux.Resources != nil && spec.Linux.Resources.CPU != nil && spec.Linux.Resources.CPU.Mems != "" {
+		mems, err := hostmm.ParseNodeList(spec.Linux.Resources.CPU.Mems)
+		if err != nil {
+			return "", fmt.Errorf("parsing cpuset.mems %q: %w", spec.Linux.Resources.CPU.Mems, err)
+		}
+		allowed := make(map[int]struct{}, len(mems))
+		for _, n := range mems {
+			allowed[n] = struct{}{}
+		}
+		var filtered []int
+		for _, n := range nodes {
+			if _, ok := allowed[n]; ok {
+				filtered = append(filtered, n)
+			}
+		}
+		nodes = filtered
+	}
+	if len(nodes) == 0 {
+		return "", fmt.Errorf("no usable host NUMA nodes")
+	}
+	strs := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		strs = append(strs, strconv.Itoa(n))
+	}
+	return strings.Join(strs, ","), nil
+}
@@ -319,6 +319,11 @@ type Config struct {
 	// AppHugePages enables support for application huge pages.
 	AppHugePages bool `flag:"app-huge-pages"`
 
+	// NUMA enables emulation of the host's NUMA topology, restricted to the
+	// nodes in the container's cpuset.mems if specified. If NUMA is false,
+	// the sandbox presents a single NUMA node.
+	NUMA bool `flag:"numa"`
+
 	// NVProxy enables support for Nvidia GPUs.
 	NVProxy bool `flag:"nvproxy"`
 
@@ -375,6 +380,11 @@ type Config struct {
 	// sockets should be disconnected upon save."
 	NetDisconnectOk bool `flag:"net-disconnect-ok"`
 
+	// AllowSecretMemSave indicates whether the sandbox may be checkpointed
+	// while memfd_secret(2) memory is in use, in which case the contents of
+	// that memory are included in the checkpoint image.
+	AllowSecretMemSave bool `flag:"allow-secretmem-save"`
+
 	// TestOnlyAutosaveImagePath if not empty enables auto save for syscall tests
 	// and stores the directory path to the saved state file.
 	TestOnlyAutosaveImagePath string `flag:"TESTONLY-autosave-image-path"`
@@ -676,6 +686,14 @@ const (
 
 	// QDiscFIFO applies a simple fifo based queue to the underlying FD.
 	QDiscFIFO
+
+	// QDiscFQ applies per-flow fair queueing to the underlying FD, pacing
+	// packets to the departure times set with SO_TXTIME.
+	QDiscFQ
+
+	// QDiscFQCoDel applies per-flow fair queueing with controlled delay to
+	// the underlying FD.
+	QDiscFQCoDel
 )
 
 func queueingDisciplinePtr(v QueueingDiscipline) *QueueingDiscipline {
@@ -689,6 +707,10 @@ func (q *QueueingDiscipline) Set(v string) error {
 		*q = QDiscNone
 	case "fifo":
 		*q = QDiscFIFO
+	case "fq":
+		*q = QDiscFQ
+	case "fq_codel":
+		*q = QDiscFQCoDel
 	default:
 		return fmt.Errorf("invalid qdisc %q", v)
 	}
@@ -707,6 +729,10 @@ func (q QueueingDiscipline) String() string {
 		return "none"
 	case QDiscFIFO:
 		return "fifo"
+	case QDiscFQ:
+		return "fq"
+	case QDiscFQCoDel:
+		return "fq_codel"
 	}
 	panic(fmt.Sprintf("Invalid qdisc %d", q))
 }
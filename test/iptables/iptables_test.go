@@ -491,6 +491,10 @@ func TestNATOutRECVORIGDSTADDR(t *testing.T) {
 	singleTest(t, &NATOutRECVORIGDSTADDR{})
 }
 
+func TestManglePreTPROXYRECVORIGDSTADDR(t *testing.T) {
+	singleTest(t, &ManglePreTPROXYRECVORIGDSTADDR{})
+}
+
 func TestNATPostSNATUDP(t *testing.T) {
 	singleTest(t, &NATPostSNATUDP{})
 }
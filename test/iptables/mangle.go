@@ -0,0 +1,57 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iptables
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+func init() {
+	RegisterTestCase(&ManglePreTPROXYRECVORIGDSTADDR{})
+}
+
+// ManglePreTPROXYRECVORIGDSTADDR tests that IP{V6}_RECVORIGDSTADDR gets the
+// original destination of packets that a TPROXY target redirected to a
+// transparent socket on the PREROUTING chain.
+type ManglePreTPROXYRECVORIGDSTADDR struct{ containerCase }
+
+var _ TestCase = (*ManglePreTPROXYRECVORIGDSTADDR)(nil)
+
+// Name implements TestCase.Name.
+func (*ManglePreTPROXYRECVORIGDSTADDR) Name() string {
+	return "ManglePreTPROXYRECVORIGDSTADDR"
+}
+
+// ContainerAction implements TestCase.ContainerAction.
+func (*ManglePreTPROXYRECVORIGDSTADDR) ContainerAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	if err := mangleTable(ipv6, "-A", "PREROUTING", "-p", "udp", "--dport", fmt.Sprintf("%d", acceptPort), "-j", "TPROXY", "--on-port", fmt.Sprintf("%d", redirectPort)); err != nil {
+		return err
+	}
+
+	// Unlike REDIRECT, TPROXY doesn't rewrite packets, so the socket bound to
+	// redirectPort sees the port packets were sent to.
+	if err := recvWithRECVORIGDSTADDR(ctx, ipv6, nil, redirectPort, acceptPort, true /* transparent */); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LocalAction implements TestCase.LocalAction.
+func (*ManglePreTPROXYRECVORIGDSTADDR) LocalAction(ctx context.Context, ip net.IP, ipv6 bool) error {
+	return sendUDPLoop(ctx, ip, acceptPort, ipv6)
+}
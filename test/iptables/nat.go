@@ -718,7 +718,7 @@ func (*NATPreRECVORIGDSTADDR) ContainerAction(ctx context.Context, ip net.IP, ip
 		return err
 	}
 
-	if err := recvWithRECVORIGDSTADDR(ctx, ipv6, nil, redirectPort); err != nil {
+	if err := recvWithRECVORIGDSTADDR(ctx, ipv6, nil, redirectPort, redirectPort, false /* transparent */); err != nil {
 		return err
 	}
 
@@ -758,7 +758,7 @@ func (*NATOutRECVORIGDSTADDR) ContainerAction(ctx context.Context, ip net.IP, ip
 	if ipv6 {
 		expectedIP = &net.IP{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
 	}
-	if err := recvWithRECVORIGDSTADDR(ctx, ipv6, expectedIP, redirectPort); err != nil {
+	if err := recvWithRECVORIGDSTADDR(ctx, ipv6, expectedIP, redirectPort, redirectPort, false /* transparent */); err != nil {
 		return err
 	}
 
@@ -776,17 +776,22 @@ func (*NATOutRECVORIGDSTADDR) LocalAction(ctx context.Context, ip net.IP, ipv6 b
 	return nil
 }
 
-func recvWithRECVORIGDSTADDR(ctx context.Context, ipv6 bool, expectedDst *net.IP, port uint16) error {
+// recvWithRECVORIGDSTADDR receives a packet on port and verifies that
+// IP{V6}_RECVORIGDSTADDR reports expectedDst, or any local address if it is
+// nil, and expectedPort. If transparent is true, IP{V6}_TRANSPARENT is set on
+// the socket.
+func recvWithRECVORIGDSTADDR(ctx context.Context, ipv6 bool, expectedDst *net.IP, port, expectedPort uint16, transparent bool) error {
 	// The net package doesn't give guaranteed access to a connection's
 	// underlying FD, and thus we cannot call getsockopt. We have to use
 	// traditional syscalls for IP_RECVORIGDSTADDR.
 
 	// Create the listening socket.
 	var (
-		family                 = unix.AF_INET
-		level                  = unix.SOL_IP
-		option                 = unix.IP_RECVORIGDSTADDR
-		bindAddr unix.Sockaddr = &unix.SockaddrInet4{
+		family                          = unix.AF_INET
+		level                           = unix.SOL_IP
+		option                          = unix.IP_RECVORIGDSTADDR
+		transparentOption               = unix.IP_TRANSPARENT
+		bindAddr          unix.Sockaddr = &unix.SockaddrInet4{
 			Port: int(port),
 			Addr: [4]byte{0, 0, 0, 0}, // INADDR_ANY
 		}
@@ -795,6 +800,7 @@ func recvWithRECVORIGDSTADDR(ctx context.Context, ipv6 bool, expectedDst *net.IP
 		family = unix.AF_INET6
 		level = unix.SOL_IPV6
 		option = 74 // IPV6_RECVORIGDSTADDR, which is missing from the syscall package.
+		transparentOption = unix.IPV6_TRANSPARENT
 		bindAddr = &unix.SockaddrInet6{
 			Port: int(port),
 			Addr: [16]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, // in6addr_any
@@ -806,6 +812,12 @@ func recvWithRECVORIGDSTADDR(ctx context.Context, ipv6 bool, expectedDst *net.IP
 	}
 	defer unix.Close(sockfd)
 
+	if transparent {
+		if err := unix.SetsockoptInt(sockfd, level, transparentOption, 1); err != nil {
+			return fmt.Errorf("failed SetsockoptInt(%d, %d, %d, 1): %v", sockfd, level, transparentOption, err)
+		}
+	}
+
 	if err := unix.Bind(sockfd, bindAddr); err != nil {
 		return fmt.Errorf("failed Bind(%d, %+v): %v", sockfd, bindAddr, err)
 	}
@@ -854,11 +866,11 @@ func recvWithRECVORIGDSTADDR(ctx context.Context, ipv6 bool, expectedDst *net.IP
 		}
 	}
 
-	// Verify that the address has the post-NAT port and address.
+	// Verify that the address has the expected port and address.
 	if ipv6 {
-		return addrMatches6(addr.(unix.RawSockaddrInet6), localAddrs, redirectPort)
+		return addrMatches6(addr.(unix.RawSockaddrInet6), localAddrs, expectedPort)
 	}
-	return addrMatches4(addr.(unix.RawSockaddrInet4), localAddrs, redirectPort)
+	return addrMatches4(addr.(unix.RawSockaddrInet4), localAddrs, expectedPort)
 }
 
 func recvOrigDstAddr4(sockfd int) (unix.RawSockaddrInet4, error) {
@@ -14,12 +14,15 @@
 
 #include <fcntl.h>
 #include <linux/aio_abi.h>
+#include <sched.h>
+#include <signal.h>
 #include <sys/mman.h>
 #include <sys/syscall.h>
 #include <sys/types.h>
 #include <unistd.h>
 
 #include <algorithm>
+#include <atomic>
 #include <string>
 
 #include "gtest/gtest.h"
@@ -30,6 +33,7 @@
 #include "test/util/memory_util.h"
 #include "test/util/posix_error.h"
 #include "test/util/proc_util.h"
+#include "test/util/signal_util.h"
 #include "test/util/temp_path.h"
 #include "test/util/test_util.h"
 
@@ -61,6 +65,34 @@ PosixErrorOr<size_t> VmaSizeAt(uintptr_t addr) {
 
 constexpr char kData[] = "hello world!";
 
+// Copied from fs/aio.c.
+constexpr unsigned AIO_RING_MAGIC = 0xa10a10a1;
+struct aio_ring {
+  unsigned id;
+  unsigned nr;
+  unsigned head;
+  unsigned tail;
+  unsigned magic;
+  unsigned compat_features;
+  unsigned incompat_features;
+  unsigned header_length;
+  struct io_event io_events[0];
+};
+
+#ifndef SYS_io_pgetevents
+#if defined(__x86_64__)
+#define SYS_io_pgetevents 333
+#elif defined(__aarch64__)
+#define SYS_io_pgetevents 292
+#endif
+#endif
+
+// Copied from include/uapi/linux/aio_abi.h.
+struct aio_sigset {
+  const sigset_t* sigmask;
+  size_t sigsetsize;
+};
+
 int SubmitCtx(aio_context_t ctx, long nr, struct iocb** iocbpp) {
   return syscall(__NR_io_submit, ctx, nr, iocbpp);
 }
@@ -109,31 +141,15 @@ class AIOTest : public FileTest {
 };
 
 TEST_F(AIOTest, BasicWrite) {
-  // Copied from fs/aio.c.
-  constexpr unsigned AIO_RING_MAGIC = 0xa10a10a1;
-  struct aio_ring {
-    unsigned id;
-    unsigned nr;
-    unsigned head;
-    unsigned tail;
-    unsigned magic;
-    unsigned compat_features;
-    unsigned incompat_features;
-    unsigned header_length;
-    struct io_event io_events[0];
-  };
-
   // Setup a context that is 128 entries deep.
   ASSERT_THAT(SetupContext(128), SyscallSucceeds());
 
-  // Check that 'ctx_' points to a valid address. libaio uses it to check if
-  // aio implementation uses aio_ring. gVisor doesn't and returns all zeroes.
-  // Linux implements aio_ring, so skip the zeroes check.
-  //
-  // TODO(gvisor.dev/issue/204): Remove when gVisor implements aio_ring.
+  // Check that 'ctx_' points to an aio_ring. libaio uses it to reap events
+  // without a syscall.
   auto ring = reinterpret_cast<struct aio_ring*>(ctx_);
-  auto magic = IsRunningOnGvisor() ? 0 : AIO_RING_MAGIC;
-  EXPECT_EQ(ring->magic, magic);
+  EXPECT_EQ(ring->magic, AIO_RING_MAGIC);
+  EXPECT_EQ(ring->header_length, sizeof(struct aio_ring));
+  EXPECT_GE(ring->nr, 128);
 
   struct iocb cb = CreateCallback();
   struct iocb* cbs[1] = {&cb};
@@ -157,6 +173,33 @@ TEST_F(AIOTest, BasicWrite) {
   EXPECT_STREQ(verify_buf, kData);
 }
 
+// Tests that completions can be reaped directly from the aio_ring, as libaio
+// does.
+TEST_F(AIOTest, UserRing) {
+  ASSERT_THAT(SetupContext(128), SyscallSucceeds());
+  auto ring = reinterpret_cast<struct aio_ring*>(ctx_);
+
+  struct iocb cb = CreateCallback();
+  struct iocb* cbs[1] = {&cb};
+  ASSERT_THAT(Submit(1, cbs), SyscallSucceedsWithValue(1));
+
+  // Wait for the completion to be published in the ring.
+  unsigned head = __atomic_load_n(&ring->head, __ATOMIC_ACQUIRE);
+  while (__atomic_load_n(&ring->tail, __ATOMIC_ACQUIRE) == head) {
+    sched_yield();
+  }
+  const struct io_event ev = ring->io_events[head];
+  EXPECT_EQ(ev.data, 0x123);
+  EXPECT_EQ(ev.obj, reinterpret_cast<uint64_t>(&cb));
+  EXPECT_EQ(ev.res, strlen(kData));
+  __atomic_store_n(&ring->head, (head + 1) % ring->nr, __ATOMIC_RELEASE);
+
+  // The event has been consumed, so io_getevents shouldn't return it again.
+  struct timespec timeout = {};
+  struct io_event events[1];
+  EXPECT_THAT(GetEvents(0, 1, events, &timeout), SyscallSucceedsWithValue(0));
+}
+
 TEST_F(AIOTest, BadWrite) {
   // Create a pipe and immediately close the read end.
   int pipefd[2];
@@ -357,6 +400,78 @@ TEST_F(AIOTest, Timeout) {
   ASSERT_THAT(GetEvents(1, 1, events, &timeout), SyscallSucceedsWithValue(0));
 }
 
+#ifdef SYS_io_pgetevents
+
+TEST_F(AIOTest, Pgetevents) {
+  ASSERT_THAT(SetupContext(128), SyscallSucceeds());
+
+  struct iocb cb = CreateCallback();
+  struct iocb* cbs[1] = {&cb};
+  ASSERT_THAT(Submit(1, cbs), SyscallSucceedsWithValue(1));
+
+  sigset_t mask;
+  sigemptyset(&mask);
+  sigaddset(&mask, SIGUSR1);
+  struct aio_sigset sig = {&mask, sizeof(mask)};
+  struct io_event events[1];
+  ASSERT_THAT(RetryEINTR(syscall)(SYS_io_pgetevents, ctx_, 1, 1, events,
+                                  nullptr, &sig),
+              SyscallSucceedsWithValue(1));
+  EXPECT_EQ(events[0].data, 0x123);
+  EXPECT_EQ(events[0].res, strlen(kData));
+}
+
+TEST_F(AIOTest, PgeteventsInvalidSigsetSize) {
+  ASSERT_THAT(SetupContext(128), SyscallSucceeds());
+
+  sigset_t mask;
+  sigemptyset(&mask);
+  struct aio_sigset sig = {&mask, sizeof(mask) / 2};
+  struct timespec timeout = {};
+  struct io_event events[1];
+  EXPECT_THAT(syscall(SYS_io_pgetevents, ctx_, 0, 1, events, &timeout, &sig),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+std::atomic<int> pgetevents_signaled;
+
+void PgeteventsSigHandler(int) { pgetevents_signaled.store(1); }
+
+// Tests that a signal that is blocked by the thread but allowed by the
+// io_pgetevents mask interrupts it, and that the original mask is restored
+// afterward.
+TEST_F(AIOTest, PgeteventsSignalMaskAllowsSignal) {
+  ASSERT_THAT(SetupContext(128), SyscallSucceeds());
+
+  struct sigaction sa = {};
+  sa.sa_handler = PgeteventsSigHandler;
+  sigemptyset(&sa.sa_mask);
+  const auto cleanup_sa =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSigaction(SIGUSR1, sa));
+  const auto cleanup_mask =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSignalMask(SIG_BLOCK, SIGUSR1));
+
+  // Leave SIGUSR1 pending while it is blocked.
+  pgetevents_signaled.store(0);
+  ASSERT_THAT(tgkill(getpid(), syscall(SYS_gettid), SIGUSR1), SyscallSucceeds());
+  EXPECT_EQ(pgetevents_signaled.load(), 0);
+
+  sigset_t mask;
+  sigemptyset(&mask);
+  struct aio_sigset sig = {&mask, sizeof(mask)};
+  struct io_event events[1];
+  EXPECT_THAT(syscall(SYS_io_pgetevents, ctx_, 1, 1, events, nullptr, &sig),
+              SyscallFailsWithErrno(EINTR));
+  EXPECT_EQ(pgetevents_signaled.load(), 1);
+
+  // The original mask must be restored.
+  sigset_t cur;
+  ASSERT_THAT(sigprocmask(SIG_BLOCK, nullptr, &cur), SyscallSucceeds());
+  EXPECT_TRUE(sigismember(&cur, SIGUSR1));
+}
+
+#endif  // SYS_io_pgetevents
+
 class AIOReadWriteParamTest : public AIOTest,
                               public ::testing::WithParamInterface<int> {};
 
@@ -157,6 +157,39 @@ int futex_unlock_pi(bool priv, std::atomic<int>* uaddr) {
   return RetryEINTR(syscall)(SYS_futex, uaddr, op, nullptr, nullptr);
 }
 
+#ifndef SYS_futex_waitv
+#define SYS_futex_waitv 449
+#endif
+
+// Definitions from <linux/futex.h>, which may be missing from older headers.
+constexpr uint32_t kFutex2SizeU32 = 0x02;
+constexpr uint32_t kFutex2Private = FUTEX_PRIVATE_FLAG;
+constexpr int kFutexWaitvMax = 128;
+
+struct futex_waitv_entry {
+  uint64_t val;
+  uint64_t uaddr;
+  uint32_t flags;
+  uint32_t __reserved;
+};
+
+futex_waitv_entry make_waitv(bool priv, std::atomic<int>* uaddr, int val) {
+  futex_waitv_entry w = {};
+  w.val = static_cast<uint32_t>(val);
+  w.uaddr = reinterpret_cast<uint64_t>(uaddr);
+  w.flags = kFutex2SizeU32 | (priv ? kFutex2Private : 0);
+  return w;
+}
+
+int futex_waitv(std::vector<futex_waitv_entry>& waiters,
+                absl::Time deadline = absl::InfiniteFuture(),
+                clockid_t clockid = CLOCK_REALTIME) {
+  auto const deadline_ts = absl::ToTimespec(deadline);
+  return RetryEINTR(syscall)(
+      SYS_futex_waitv, waiters.data(), waiters.size(), 0,
+      deadline == absl::InfiniteFuture() ? nullptr : &deadline_ts, clockid);
+}
+
 // Fixture for futex tests parameterized by whether to use private or shared
 // futexes.
 class PrivateAndSharedFutexTest : public ::testing::TestWithParam<bool> {
@@ -538,6 +571,120 @@ TEST_P(PrivateAndSharedFutexTest, WakeWrongKind) {
   EXPECT_THAT(futex_wake(!IsPrivate(), &a, 1), SyscallSucceedsWithValue(0));
 }
 
+TEST_P(PrivateAndSharedFutexTest, Waitv_WrongVal) {
+  std::atomic<int> a(1);
+  std::atomic<int> b(1);
+  std::vector<futex_waitv_entry> waiters = {
+      make_waitv(IsPrivate(), &a, a),
+      make_waitv(IsPrivate(), &b, b + 1),
+  };
+  EXPECT_THAT(futex_waitv(waiters), SyscallFailsWithErrno(EAGAIN));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_Timeout) {
+  std::atomic<int> a(1);
+  std::vector<futex_waitv_entry> waiters = {make_waitv(IsPrivate(), &a, a)};
+
+  MonotonicTimer timer;
+  timer.Start();
+  constexpr absl::Duration kTimeout = absl::Seconds(1);
+  EXPECT_THAT(futex_waitv(waiters, absl::Now() + kTimeout),
+              SyscallFailsWithErrno(ETIMEDOUT));
+  EXPECT_GE(timer.Duration(), kTimeout);
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_MonotonicTimeout) {
+  std::atomic<int> a(1);
+  std::vector<futex_waitv_entry> waiters = {make_waitv(IsPrivate(), &a, a)};
+
+  struct timespec now;
+  ASSERT_THAT(clock_gettime(CLOCK_MONOTONIC, &now), SyscallSucceeds());
+  struct timespec deadline = now;
+  deadline.tv_sec++;
+  EXPECT_THAT(RetryEINTR(syscall)(SYS_futex_waitv, waiters.data(),
+                                  waiters.size(), 0, &deadline,
+                                  CLOCK_MONOTONIC),
+              SyscallFailsWithErrno(ETIMEDOUT));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_Wake) {
+  constexpr int kInitialValue = 1;
+  std::atomic<int> a(kInitialValue);
+  std::atomic<int> b(kInitialValue);
+  std::atomic<int> c(kInitialValue);
+
+  // Prevent save/restore from interrupting futex_waitv, which will cause it
+  // to return EAGAIN instead of the expected result if futex_waitv is
+  // restarted after we change the value of b below.
+  DisableSave ds;
+  ScopedThread thread([&] {
+    std::vector<futex_waitv_entry> waiters = {
+        make_waitv(IsPrivate(), &a, kInitialValue),
+        make_waitv(IsPrivate(), &b, kInitialValue),
+        make_waitv(IsPrivate(), &c, kInitialValue),
+    };
+    EXPECT_THAT(futex_waitv(waiters), SyscallSucceedsWithValue(1));
+  });
+  absl::SleepFor(kWaiterStartupDelay);
+
+  // Change b so that if futex_wake happens before futex_waitv, the latter
+  // returns EAGAIN instead of hanging the test.
+  b.fetch_add(1);
+  EXPECT_THAT(futex_wake(IsPrivate(), &b, 1), SyscallSucceedsWithValue(1));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_WakeWrongKind) {
+  std::atomic<int> a(1);
+  std::vector<futex_waitv_entry> waiters = {make_waitv(IsPrivate(), &a, a)};
+
+  ScopedThread thread([&] {
+    EXPECT_THAT(futex_waitv(waiters, absl::Now() + kIneffectiveWakeTimeout),
+                SyscallFailsWithErrno(ETIMEDOUT));
+  });
+  absl::SleepFor(kWaiterStartupDelay);
+
+  // A wakeup of the other kind must not wake the waiter.
+  EXPECT_THAT(futex_wake(!IsPrivate(), &a, 1), SyscallSucceedsWithValue(0));
+}
+
+TEST_P(PrivateAndSharedFutexTest, Waitv_InvalidArguments) {
+  std::atomic<int> a(1);
+  std::vector<futex_waitv_entry> waiters = {make_waitv(IsPrivate(), &a, a)};
+
+  // Non-zero flags.
+  EXPECT_THAT(syscall(SYS_futex_waitv, waiters.data(), waiters.size(), 1,
+                      nullptr, CLOCK_MONOTONIC),
+              SyscallFailsWithErrno(EINVAL));
+  // No futexes.
+  EXPECT_THAT(syscall(SYS_futex_waitv, waiters.data(), 0, 0, nullptr,
+                      CLOCK_MONOTONIC),
+              SyscallFailsWithErrno(EINVAL));
+  // Too many futexes.
+  EXPECT_THAT(syscall(SYS_futex_waitv, waiters.data(), kFutexWaitvMax + 1, 0,
+                      nullptr, CLOCK_MONOTONIC),
+              SyscallFailsWithErrno(EINVAL));
+  // Invalid clock.
+  struct timespec ts = {};
+  EXPECT_THAT(syscall(SYS_futex_waitv, waiters.data(), waiters.size(), 0, &ts,
+                      CLOCK_BOOTTIME),
+              SyscallFailsWithErrno(EINVAL));
+  // Unsupported size.
+  waiters[0].flags &= ~kFutex2SizeU32;
+  EXPECT_THAT(futex_waitv(waiters), SyscallFailsWithErrno(EINVAL));
+  // Non-zero reserved field.
+  waiters[0] = make_waitv(IsPrivate(), &a, a);
+  waiters[0].__reserved = 1;
+  EXPECT_THAT(futex_waitv(waiters), SyscallFailsWithErrno(EINVAL));
+  // Value out of range.
+  waiters[0] = make_waitv(IsPrivate(), &a, a);
+  waiters[0].val = uint64_t{1} << 32;
+  EXPECT_THAT(futex_waitv(waiters), SyscallFailsWithErrno(EINVAL));
+  // Misaligned address.
+  waiters[0] = make_waitv(IsPrivate(), &a, a);
+  waiters[0].uaddr++;
+  EXPECT_THAT(futex_waitv(waiters), SyscallFailsWithErrno(EINVAL));
+}
+
 INSTANTIATE_TEST_SUITE_P(SharedPrivate, PrivateAndSharedFutexTest,
                          ::testing::Bool());
 
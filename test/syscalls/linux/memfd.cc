@@ -18,7 +18,9 @@
 #include <linux/unistd.h>
 #include <string.h>
 #include <sys/mman.h>
+#include <sys/stat.h>
 #include <sys/syscall.h>
+#include <unistd.h>
 
 #include <vector>
 
@@ -50,6 +52,23 @@ namespace {
 #define F_SEAL_SHRINK 0x0002
 #define F_SEAL_GROW 0x0004
 #define F_SEAL_WRITE 0x0008
+#define F_SEAL_EXEC 0x0020
+
+#ifndef MFD_HUGETLB
+#define MFD_HUGETLB 0x0004U
+#endif /* MFD_HUGETLB */
+
+#ifndef MFD_NOEXEC_SEAL
+#define MFD_NOEXEC_SEAL 0x0008U
+#endif /* MFD_NOEXEC_SEAL */
+
+#ifndef MFD_EXEC
+#define MFD_EXEC 0x0010U
+#endif /* MFD_EXEC */
+
+#ifndef MFD_HUGE_2MB
+#define MFD_HUGE_2MB (21U << 26)
+#endif /* MFD_HUGE_2MB */
 
 using ::gvisor::testing::IsTmpfs;
 using ::testing::StartsWith;
@@ -538,6 +557,99 @@ TEST(MemfdTest, MultipleWritableAndNonWritableRefsToSameFileRegion) {
   m2.reset();
 }
 
+// MFD_NOEXEC_SEAL memfds are created non-executable with F_SEAL_EXEC, and
+// MFD_NOEXEC_SEAL implies MFD_ALLOW_SEALING.
+TEST(MemfdTest, NoExecSeal) {
+  int fd = memfd_create(kMemfdName, MFD_NOEXEC_SEAL);
+  SKIP_IF(!IsRunningOnGvisor() && fd < 0 && errno == EINVAL);
+  ASSERT_THAT(fd, SyscallSucceeds());
+  const FileDescriptor memfd(fd);
+
+  struct stat st;
+  ASSERT_THAT(fstat(memfd.get(), &st), SyscallSucceeds());
+  EXPECT_EQ(st.st_mode & 0777, 0666);
+  EXPECT_THAT(fcntl(memfd.get(), F_GET_SEALS),
+              SyscallSucceedsWithValue(F_SEAL_EXEC));
+
+  // Execute permissions can't be added, but other permissions can change.
+  EXPECT_THAT(fchmod(memfd.get(), 0755), SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(fchmod(memfd.get(), 0600), SyscallSucceeds());
+
+  EXPECT_THAT(fcntl(memfd.get(), F_ADD_SEALS, F_SEAL_GROW), SyscallSucceeds());
+  EXPECT_THAT(fcntl(memfd.get(), F_GET_SEALS),
+              SyscallSucceedsWithValue(F_SEAL_GROW | F_SEAL_EXEC));
+}
+
+// MFD_NOEXEC_SEAL and MFD_ALLOW_SEALING permit further seals.
+TEST(MemfdTest, NoExecSealAllowSealing) {
+  int fd = memfd_create(kMemfdName, MFD_NOEXEC_SEAL | MFD_ALLOW_SEALING);
+  SKIP_IF(!IsRunningOnGvisor() && fd < 0 && errno == EINVAL);
+  ASSERT_THAT(fd, SyscallSucceeds());
+  const FileDescriptor memfd(fd);
+
+  EXPECT_THAT(fcntl(memfd.get(), F_GET_SEALS),
+              SyscallSucceedsWithValue(F_SEAL_EXEC));
+  EXPECT_THAT(fcntl(memfd.get(), F_ADD_SEALS, F_SEAL_GROW), SyscallSucceeds());
+}
+
+// Adding F_SEAL_EXEC to an executable memfd also seals writes.
+TEST(MemfdTest, SealExecImpliesWriteSeals) {
+  int fd = memfd_create(kMemfdName, MFD_EXEC | MFD_ALLOW_SEALING);
+  SKIP_IF(!IsRunningOnGvisor() && fd < 0 && errno == EINVAL);
+  ASSERT_THAT(fd, SyscallSucceeds());
+  const FileDescriptor memfd(fd);
+
+  ASSERT_THAT(fcntl(memfd.get(), F_ADD_SEALS, F_SEAL_EXEC), SyscallSucceeds());
+  int seals;
+  ASSERT_THAT(seals = fcntl(memfd.get(), F_GET_SEALS), SyscallSucceeds());
+  EXPECT_EQ(seals & (F_SEAL_EXEC | F_SEAL_SHRINK | F_SEAL_GROW | F_SEAL_WRITE),
+            F_SEAL_EXEC | F_SEAL_SHRINK | F_SEAL_GROW | F_SEAL_WRITE);
+  EXPECT_THAT(fchmod(memfd.get(), 0644), SyscallFailsWithErrno(EPERM));
+  char c = 0;
+  EXPECT_THAT(write(memfd.get(), &c, 1), SyscallFailsWithErrno(EPERM));
+}
+
+TEST(MemfdTest, ExecAndNoExecSealAreExclusive) {
+  EXPECT_THAT(memfd_create(kMemfdName, MFD_EXEC | MFD_NOEXEC_SEAL),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MemfdTest, HugeSizeRequiresHugetlb) {
+  EXPECT_THAT(memfd_create(kMemfdName, MFD_HUGE_2MB),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// Hugetlb memfds can't be written with write(2), and can only be truncated to
+// multiples of the huge page size.
+TEST(MemfdTest, Hugetlb) {
+  // Native Linux only supports MFD_HUGETLB if huge pages are reserved.
+  SKIP_IF(!IsRunningOnGvisor());
+  constexpr size_t kHugePageSize = 2 << 20;
+  const FileDescriptor memfd =
+      ASSERT_NO_ERRNO_AND_VALUE(MemfdCreate(kMemfdName, MFD_HUGETLB));
+
+  char c = 0;
+  EXPECT_THAT(write(memfd.get(), &c, 1), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(ftruncate(memfd.get(), kPageSize), SyscallFailsWithErrno(EINVAL));
+  ASSERT_THAT(ftruncate(memfd.get(), kHugePageSize), SyscallSucceeds());
+
+  // Mappings must start at a huge page boundary in the file.
+  EXPECT_THAT(mmap(nullptr, kPageSize, PROT_READ, MAP_SHARED, memfd.get(),
+                   kPageSize),
+              SyscallFailsWithErrno(EINVAL));
+  const Mapping m = ASSERT_NO_ERRNO_AND_VALUE(Mmap(nullptr, kHugePageSize,
+                                                   PROT_READ | PROT_WRITE,
+                                                   MAP_SHARED, memfd.get(), 0));
+  memset(m.ptr(), 'a', kHugePageSize);
+
+  // The data is visible through read(2).
+  std::vector<char> buf(kPageSize);
+  ASSERT_THAT(
+      pread(memfd.get(), buf.data(), buf.size(), kHugePageSize - buf.size()),
+      SyscallSucceedsWithValue(buf.size()));
+  EXPECT_EQ(buf, std::vector<char>(kPageSize, 'a'));
+}
+
 }  // namespace
 }  // namespace testing
 }  // namespace gvisor
@@ -0,0 +1,144 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <fcntl.h>
+#include <string.h>
+#include <sys/mman.h>
+#include <sys/syscall.h>
+#include <sys/uio.h>
+#include <unistd.h>
+
+#include "gtest/gtest.h"
+#include "absl/strings/str_format.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/memory_util.h"
+#include "test/util/test_util.h"
+
+namespace gvisor {
+namespace testing {
+namespace {
+
+#ifndef SYS_memfd_secret
+#define SYS_memfd_secret 447
+#endif
+
+// memfd_secret may be unavailable (ENOSYS) on hosts that don't enable it.
+PosixErrorOr<FileDescriptor> MemfdSecret(unsigned int flags) {
+  int fd = syscall(SYS_memfd_secret, flags);
+  if (fd < 0) {
+    return PosixError(errno, absl::StrFormat("memfd_secret(%#x)", flags));
+  }
+  return FileDescriptor(fd);
+}
+
+bool MemfdSecretSupported() {
+  int fd = syscall(SYS_memfd_secret, 0);
+  if (fd < 0) {
+    return errno != ENOSYS;
+  }
+  close(fd);
+  return true;
+}
+
+TEST(MemfdSecretTest, InvalidFlags) {
+  SKIP_IF(!MemfdSecretSupported());
+  EXPECT_THAT(syscall(SYS_memfd_secret, O_NONBLOCK),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MemfdSecretTest, CloExec) {
+  SKIP_IF(!MemfdSecretSupported());
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(MemfdSecret(O_CLOEXEC));
+  EXPECT_THAT(fcntl(fd.get(), F_GETFD), SyscallSucceedsWithValue(FD_CLOEXEC));
+}
+
+TEST(MemfdSecretTest, ReadWriteUnsupported) {
+  SKIP_IF(!MemfdSecretSupported());
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(MemfdSecret(0));
+  ASSERT_THAT(ftruncate(fd.get(), kPageSize), SyscallSucceeds());
+
+  char buf[16] = {};
+  EXPECT_THAT(write(fd.get(), buf, sizeof(buf)), SyscallFailsWithErrno(EINVAL));
+  EXPECT_THAT(read(fd.get(), buf, sizeof(buf)), SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MemfdSecretTest, SizeCanOnlyBeSetOnce) {
+  SKIP_IF(!MemfdSecretSupported());
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(MemfdSecret(0));
+  ASSERT_THAT(ftruncate(fd.get(), kPageSize), SyscallSucceeds());
+  EXPECT_THAT(ftruncate(fd.get(), 2 * kPageSize),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MemfdSecretTest, PrivateMappingFails) {
+  SKIP_IF(!MemfdSecretSupported());
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(MemfdSecret(0));
+  ASSERT_THAT(ftruncate(fd.get(), kPageSize), SyscallSucceeds());
+  EXPECT_THAT(reinterpret_cast<intptr_t>(mmap(nullptr, kPageSize,
+                                              PROT_READ | PROT_WRITE,
+                                              MAP_PRIVATE, fd.get(), 0)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST(MemfdSecretTest, SharedMapping) {
+  SKIP_IF(!MemfdSecretSupported());
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(MemfdSecret(0));
+  ASSERT_THAT(ftruncate(fd.get(), kPageSize), SyscallSucceeds());
+  const Mapping m1 = ASSERT_NO_ERRNO_AND_VALUE(Mmap(
+      nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED, fd.get(), 0));
+  const Mapping m2 = ASSERT_NO_ERRNO_AND_VALUE(
+      Mmap(nullptr, kPageSize, PROT_READ, MAP_SHARED, fd.get(), 0));
+
+  // The owning process can access secret memory through its mappings.
+  memset(m1.ptr(), 'x', kPageSize);
+  EXPECT_EQ(static_cast<char*>(m2.ptr())[kPageSize - 1], 'x');
+}
+
+// Secret memory can't be accessed by process_vm_readv(2), even by the process
+// that owns it.
+TEST(MemfdSecretTest, ProcessVMReadvFails) {
+  SKIP_IF(!MemfdSecretSupported());
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(MemfdSecret(0));
+  ASSERT_THAT(ftruncate(fd.get(), kPageSize), SyscallSucceeds());
+  const Mapping m = ASSERT_NO_ERRNO_AND_VALUE(Mmap(
+      nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED, fd.get(), 0));
+  memset(m.ptr(), 'x', kPageSize);
+
+  char buf[16];
+  struct iovec local = {.iov_base = buf, .iov_len = sizeof(buf)};
+  struct iovec remote = {.iov_base = m.ptr(), .iov_len = sizeof(buf)};
+  EXPECT_THAT(process_vm_readv(getpid(), &local, 1, &remote, 1, 0),
+              SyscallFailsWithErrno(EFAULT));
+}
+
+// Secret memory can't be accessed through /proc/[pid]/mem.
+TEST(MemfdSecretTest, ProcPidMemFails) {
+  SKIP_IF(!MemfdSecretSupported());
+  const FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(MemfdSecret(0));
+  ASSERT_THAT(ftruncate(fd.get(), kPageSize), SyscallSucceeds());
+  const Mapping m = ASSERT_NO_ERRNO_AND_VALUE(Mmap(
+      nullptr, kPageSize, PROT_READ | PROT_WRITE, MAP_SHARED, fd.get(), 0));
+  memset(m.ptr(), 'x', kPageSize);
+
+  const FileDescriptor mem =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/proc/self/mem", O_RDONLY));
+  char buf[16];
+  EXPECT_THAT(pread(mem.get(), buf, sizeof(buf), m.addr()),
+              SyscallFailsWithErrno(EIO));
+}
+
+}  // namespace
+}  // namespace testing
+}  // namespace gvisor
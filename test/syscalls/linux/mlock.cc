@@ -18,11 +18,20 @@
 #include <unistd.h>
 
 #include <cerrno>
+#include <cstdint>
 #include <cstring>
+#include <string>
 
 #include "gmock/gmock.h"
+#include "absl/strings/ascii.h"
+#include "absl/strings/numbers.h"
+#include "absl/strings/str_cat.h"
+#include "absl/strings/str_split.h"
+#include "absl/strings/string_view.h"
+#include "absl/strings/strip.h"
 #include "test/util/capability_util.h"
 #include "test/util/cleanup.h"
+#include "test/util/fs_util.h"
 #include "test/util/memory_util.h"
 #include "test/util/multiprocess_util.h"
 #include "test/util/rlimit_util.h"
@@ -60,6 +69,24 @@ bool IsPageMlocked(uintptr_t addr) {
   return true;
 }
 
+// Returns the VmLck value from /proc/self/status, in kB.
+PosixErrorOr<uint64_t> LockedKB() {
+  ASSIGN_OR_RETURN_ERRNO(std::string status,
+                         GetContents("/proc/self/status"));
+  for (absl::string_view line : absl::StrSplit(status, '\n')) {
+    if (!absl::ConsumePrefix(&line, "VmLck:")) {
+      continue;
+    }
+    line = absl::StripAsciiWhitespace(line);
+    uint64_t kb;
+    if (!absl::ConsumeSuffix(&line, " kB") || !absl::SimpleAtoi(line, &kb)) {
+      return PosixError(EINVAL, absl::StrCat("malformed VmLck: ", line));
+    }
+    return kb;
+  }
+  return PosixError(ENOENT, "VmLck not found in /proc/self/status");
+}
+
 TEST(MlockTest, Basic) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(CanMlock()));
   auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
@@ -113,6 +140,20 @@ TEST(MlockTest, Fork) {
       IsPosixErrorOkAndHolds(0));
 }
 
+TEST(MlockTest, VmLck) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(CanMlock()));
+  auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
+      MmapAnon(2 * kPageSize, PROT_READ | PROT_WRITE, MAP_PRIVATE));
+  uint64_t const before = ASSERT_NO_ERRNO_AND_VALUE(LockedKB());
+  ASSERT_THAT(mlock(mapping.ptr(), mapping.len()), SyscallSucceeds());
+  EXPECT_THAT(LockedKB(),
+              IsPosixErrorOkAndHolds(before + mapping.len() / 1024));
+  ASSERT_THAT(munlock(mapping.ptr(), kPageSize), SyscallSucceeds());
+  EXPECT_THAT(LockedKB(), IsPosixErrorOkAndHolds(before + kPageSize / 1024));
+  ASSERT_THAT(munlock(mapping.ptr(), mapping.len()), SyscallSucceeds());
+  EXPECT_THAT(LockedKB(), IsPosixErrorOkAndHolds(before));
+}
+
 TEST(MlockTest, RlimitMemlockZero) {
   AutoCapability cap(CAP_IPC_LOCK, false);
   Cleanup reset_rlimit =
@@ -185,6 +226,13 @@ TEST(MlockallTest, Future) {
   EXPECT_THAT(InForkedProcess(do_test), IsPosixErrorOkAndHolds(0));
 }
 
+TEST(MlockallTest, FutureRlimitMemlockZero) {
+  AutoCapability cap(CAP_IPC_LOCK, false);
+  Cleanup reset_rlimit =
+      ASSERT_NO_ERRNO_AND_VALUE(ScopedSetSoftRlimit(RLIMIT_MEMLOCK, 0));
+  EXPECT_THAT(mlockall(MCL_FUTURE), SyscallFailsWithErrno(EPERM));
+}
+
 TEST(MunlockallTest, Basic) {
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(CanMlock()));
   auto const mapping = ASSERT_NO_ERRNO_AND_VALUE(
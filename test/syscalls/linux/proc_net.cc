@@ -584,6 +584,70 @@ TEST(ProcSysNetIpv4Recovery, CanReadAndWrite) {
   EXPECT_EQ(strcmp(buf, "100\n"), 0);
 }
 
+TEST(ProcSysNetIpv4Ecn, Exists) {
+  EXPECT_THAT(open("/proc/sys/net/ipv4/tcp_ecn", O_RDONLY), SyscallSucceeds());
+}
+
+TEST(ProcSysNetIpv4Ecn, CanReadAndWrite) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_NET_ADMIN))) ||
+          IsRunningWithHostinet());
+
+  auto const fd =
+      ASSERT_NO_ERRNO_AND_VALUE(Open("/proc/sys/net/ipv4/tcp_ecn", O_RDWR));
+
+  char initial[10] = {'\0'};
+  ASSERT_THAT(PreadFd(fd.get(), initial, sizeof(initial), 0),
+              SyscallSucceedsWithValue(2));
+  EXPECT_TRUE(initial[0] >= '0' && initial[0] <= '2')
+      << "unexpected tcp_ecn: " << initial;
+
+  char to_write = '1';
+  EXPECT_THAT(PwriteFd(fd.get(), &to_write, sizeof(to_write), 0),
+              SyscallSucceedsWithValue(sizeof(to_write)));
+  char buf[10] = {'\0'};
+  EXPECT_THAT(PreadFd(fd.get(), buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(2));
+  EXPECT_EQ(strcmp(buf, "1\n"), 0);
+
+  if (IsRunningOnGvisor()) {
+    // Only the modes documented for net.ipv4.tcp_ecn are accepted.
+    char kInvalid[] = "3";
+    EXPECT_THAT(PwriteFd(fd.get(), kInvalid, strlen(kInvalid), 0),
+                SyscallFailsWithErrno(EINVAL));
+  }
+
+  EXPECT_THAT(PwriteFd(fd.get(), initial, 1, 0), SyscallSucceedsWithValue(1));
+}
+
+TEST(ProcSysNetIpv4FastOpen, Exists) {
+  EXPECT_THAT(open("/proc/sys/net/ipv4/tcp_fastopen", O_RDONLY),
+              SyscallSucceeds());
+}
+
+TEST(ProcSysNetIpv4FastOpen, CanReadAndWrite) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability((CAP_NET_ADMIN))) ||
+          IsRunningWithHostinet());
+
+  auto const fd = ASSERT_NO_ERRNO_AND_VALUE(
+      Open("/proc/sys/net/ipv4/tcp_fastopen", O_RDWR));
+
+  char initial[10] = {'\0'};
+  int n;
+  ASSERT_THAT(n = PreadFd(fd.get(), initial, sizeof(initial), 0),
+              SyscallSucceeds());
+  ASSERT_GT(n, 0);
+
+  char kMessage[] = "3";
+  EXPECT_THAT(PwriteFd(fd.get(), kMessage, strlen(kMessage), 0),
+              SyscallSucceedsWithValue(strlen(kMessage)));
+  char buf[10] = {'\0'};
+  EXPECT_THAT(PreadFd(fd.get(), buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(2));
+  EXPECT_EQ(strcmp(buf, "3\n"), 0);
+
+  EXPECT_THAT(PwriteFd(fd.get(), initial, n, 0), SyscallSucceedsWithValue(n));
+}
+
 TEST(ProcSysNetIpv4IpForward, Exists) {
   auto fd = ASSERT_NO_ERRNO_AND_VALUE(Open(kIpForward, O_RDONLY));
 }
@@ -0,0 +1,466 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <errno.h>
+#include <netinet/in.h>
+#include <poll.h>
+#include <sys/socket.h>
+#include <unistd.h>
+
+// linux/sctp.h depends on the definitions of sys/socket.h and netinet/in.h.
+#include <linux/sctp.h>
+
+#include <cstdint>
+#include <cstring>
+#include <string>
+
+#include "gmock/gmock.h"
+#include "gtest/gtest.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/posix_error.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+#ifndef SOL_SCTP
+#define SOL_SCTP 132
+#endif
+
+#ifndef MSG_NOTIFICATION
+#define MSG_NOTIFICATION 0x8000
+#endif
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr int kTimeoutMillis = 10000;
+
+// SCTP may not be available on the host, e.g. if the sctp module isn't
+// loaded.
+PosixErrorOr<FileDescriptor> SCTPSocket(int type) {
+  int fd = socket(AF_INET, type, IPPROTO_SCTP);
+  if (fd < 0) {
+    return PosixError(errno, "socket");
+  }
+  return FileDescriptor(fd);
+}
+
+#define SKIP_IF_NO_SCTP()                                             \
+  do {                                                                \
+    int fd = socket(AF_INET, SOCK_STREAM, IPPROTO_SCTP);              \
+    SKIP_IF(fd < 0 && (errno == EPROTONOSUPPORT || errno == EINVAL || \
+                       errno == ESOCKTNOSUPPORT));                    \
+    ASSERT_THAT(fd, SyscallSucceeds());                               \
+    close(fd);                                                        \
+  } while (0)
+
+sockaddr_in LoopbackAddr(uint16_t port) {
+  sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  addr.sin_port = port;
+  return addr;
+}
+
+// BindLoopback binds fd to an ephemeral loopback port and returns the bound
+// address.
+PosixErrorOr<sockaddr_in> BindLoopback(int fd) {
+  sockaddr_in addr = LoopbackAddr(0);
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      bind(fd, reinterpret_cast<sockaddr*>(&addr), sizeof(addr)));
+  socklen_t addrlen = sizeof(addr);
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      getsockname(fd, reinterpret_cast<sockaddr*>(&addr), &addrlen));
+  return addr;
+}
+
+void WaitReadable(int fd) {
+  pollfd pfd = {fd, POLLIN, 0};
+  ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, kTimeoutMillis),
+              SyscallSucceedsWithValue(1));
+}
+
+// RecvMsg reads a message from fd into buf and returns the msg_flags.
+int RecvMsg(int fd, char* buf, size_t len, ssize_t* n, char* control = nullptr,
+            size_t controllen = 0, msghdr* out = nullptr) {
+  iovec iov = {buf, len};
+  msghdr msg = {};
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  msg.msg_control = control;
+  msg.msg_controllen = controllen;
+  *n = RetryEINTR(recvmsg)(fd, &msg, 0);
+  if (out != nullptr) {
+    *out = msg;
+  }
+  return msg.msg_flags;
+}
+
+struct OneToOnePair {
+  FileDescriptor client;
+  FileDescriptor server;
+};
+
+PosixErrorOr<OneToOnePair> ConnectedOneToOne() {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor listener,
+                         SCTPSocket(SOCK_STREAM));
+  ASSIGN_OR_RETURN_ERRNO(sockaddr_in addr, BindLoopback(listener.get()));
+  RETURN_ERROR_IF_SYSCALL_FAIL(listen(listener.get(), 1));
+
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor client, SCTPSocket(SOCK_STREAM));
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      connect(client.get(), reinterpret_cast<sockaddr*>(&addr), sizeof(addr)));
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor server,
+                         Accept(listener.get(), nullptr, nullptr));
+  return OneToOnePair{std::move(client), std::move(server)};
+}
+
+TEST(SCTPSocketTest, OneToOneMessageBoundaries) {
+  SKIP_IF_NO_SCTP();
+  OneToOnePair p = ASSERT_NO_ERRNO_AND_VALUE(ConnectedOneToOne());
+
+  const std::string first = "first message";
+  const std::string second = "second";
+  ASSERT_THAT(send(p.client.get(), first.data(), first.size(), 0),
+              SyscallSucceedsWithValue(first.size()));
+  ASSERT_THAT(send(p.client.get(), second.data(), second.size(), 0),
+              SyscallSucceedsWithValue(second.size()));
+
+  // Each read returns at most one message, whose end is marked by MSG_EOR.
+  char buf[64];
+  ssize_t n;
+  ASSERT_NO_FATAL_FAILURE(WaitReadable(p.server.get()));
+  int flags = RecvMsg(p.server.get(), buf, sizeof(buf), &n);
+  ASSERT_EQ(n, static_cast<ssize_t>(first.size()));
+  EXPECT_EQ(std::string(buf, n), first);
+  EXPECT_TRUE(flags & MSG_EOR);
+
+  ASSERT_NO_FATAL_FAILURE(WaitReadable(p.server.get()));
+  flags = RecvMsg(p.server.get(), buf, sizeof(buf), &n);
+  ASSERT_EQ(n, static_cast<ssize_t>(second.size()));
+  EXPECT_EQ(std::string(buf, n), second);
+  EXPECT_TRUE(flags & MSG_EOR);
+}
+
+TEST(SCTPSocketTest, PartialRead) {
+  SKIP_IF_NO_SCTP();
+  OneToOnePair p = ASSERT_NO_ERRNO_AND_VALUE(ConnectedOneToOne());
+
+  const std::string msg = "0123456789";
+  ASSERT_THAT(send(p.client.get(), msg.data(), msg.size(), 0),
+              SyscallSucceedsWithValue(msg.size()));
+
+  // A message that doesn't fit isn't truncated; the rest of it is returned
+  // by the next read.
+  char buf[4];
+  ssize_t n;
+  ASSERT_NO_FATAL_FAILURE(WaitReadable(p.server.get()));
+  int flags = RecvMsg(p.server.get(), buf, sizeof(buf), &n);
+  ASSERT_EQ(n, static_cast<ssize_t>(sizeof(buf)));
+  EXPECT_FALSE(flags & MSG_EOR);
+  EXPECT_FALSE(flags & MSG_TRUNC);
+
+  char rest[64];
+  flags = RecvMsg(p.server.get(), rest, sizeof(rest), &n);
+  ASSERT_EQ(n, static_cast<ssize_t>(msg.size() - sizeof(buf)));
+  EXPECT_EQ(std::string(buf, sizeof(buf)) + std::string(rest, n), msg);
+  EXPECT_TRUE(flags & MSG_EOR);
+}
+
+TEST(SCTPSocketTest, ShutdownReadsEOF) {
+  SKIP_IF_NO_SCTP();
+  OneToOnePair p = ASSERT_NO_ERRNO_AND_VALUE(ConnectedOneToOne());
+
+  p.client.reset();
+  char buf[16];
+  ASSERT_NO_FATAL_FAILURE(WaitReadable(p.server.get()));
+  EXPECT_THAT(RetryEINTR(recv)(p.server.get(), buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(0));
+}
+
+TEST(SCTPSocketTest, Status) {
+  SKIP_IF_NO_SCTP();
+  OneToOnePair p = ASSERT_NO_ERRNO_AND_VALUE(ConnectedOneToOne());
+
+  sctp_status status = {};
+  socklen_t len = sizeof(status);
+  ASSERT_THAT(
+      getsockopt(p.client.get(), SOL_SCTP, SCTP_STATUS, &status, &len),
+      SyscallSucceeds());
+  EXPECT_EQ(len, sizeof(status));
+  EXPECT_EQ(status.sstat_state, SCTP_ESTABLISHED);
+  EXPECT_GT(status.sstat_outstrms, 0);
+  EXPECT_GT(status.sstat_instrms, 0);
+  EXPECT_GT(status.sstat_fragmentation_point, 0u);
+  EXPECT_EQ(status.sstat_primary.spinfo_state, SCTP_ACTIVE);
+}
+
+TEST(SCTPSocketTest, IntOptions) {
+  SKIP_IF_NO_SCTP();
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(SCTPSocket(SOCK_STREAM));
+
+  for (int opt : {SCTP_NODELAY, SCTP_DISABLE_FRAGMENTS, SCTP_RECVRCVINFO}) {
+    SCOPED_TRACE(opt);
+    int v = 1;
+    ASSERT_THAT(setsockopt(fd.get(), SOL_SCTP, opt, &v, sizeof(v)),
+                SyscallSucceeds());
+    v = 0;
+    socklen_t len = sizeof(v);
+    ASSERT_THAT(getsockopt(fd.get(), SOL_SCTP, opt, &v, &len),
+                SyscallSucceeds());
+    EXPECT_EQ(len, sizeof(v));
+    EXPECT_EQ(v, 1);
+  }
+
+  // SCTP_AUTOCLOSE only applies to one-to-many sockets.
+  int v = 10;
+  EXPECT_THAT(
+      setsockopt(fd.get(), SOL_SCTP, SCTP_AUTOCLOSE, &v, sizeof(v)),
+      SyscallFailsWithErrno(EOPNOTSUPP));
+}
+
+TEST(SCTPSocketTest, InitMsg) {
+  SKIP_IF_NO_SCTP();
+  FileDescriptor fd = ASSERT_NO_ERRNO_AND_VALUE(SCTPSocket(SOCK_STREAM));
+
+  sctp_initmsg init = {};
+  init.sinit_num_ostreams = 7;
+  init.sinit_max_instreams = 9;
+  ASSERT_THAT(setsockopt(fd.get(), SOL_SCTP, SCTP_INITMSG, &init, sizeof(init)),
+              SyscallSucceeds());
+
+  sctp_initmsg got = {};
+  socklen_t len = sizeof(got);
+  ASSERT_THAT(getsockopt(fd.get(), SOL_SCTP, SCTP_INITMSG, &got, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(got.sinit_num_ostreams, 7);
+  EXPECT_EQ(got.sinit_max_instreams, 9);
+}
+
+// OneToManySetup returns a listening one-to-many socket with the
+// association and data I/O events enabled, a client one-to-many socket, and
+// the server's address.
+struct OneToManySetup {
+  FileDescriptor server;
+  FileDescriptor client;
+  sockaddr_in addr;
+};
+
+PosixErrorOr<OneToManySetup> NewOneToMany() {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor server, SCTPSocket(SOCK_SEQPACKET));
+  ASSIGN_OR_RETURN_ERRNO(sockaddr_in addr, BindLoopback(server.get()));
+  RETURN_ERROR_IF_SYSCALL_FAIL(listen(server.get(), 1));
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor client, SCTPSocket(SOCK_SEQPACKET));
+  return OneToManySetup{std::move(server), std::move(client), addr};
+}
+
+TEST(SCTPSocketTest, OneToManyStreamsAndRcvInfo) {
+  SKIP_IF_NO_SCTP();
+  OneToManySetup s = ASSERT_NO_ERRNO_AND_VALUE(NewOneToMany());
+
+  int one = 1;
+  ASSERT_THAT(setsockopt(s.server.get(), SOL_SCTP, SCTP_RECVRCVINFO, &one,
+                         sizeof(one)),
+              SyscallSucceeds());
+
+  // The association is set up implicitly by the first message.
+  const std::string payload = "on stream 1";
+  char control[CMSG_SPACE(sizeof(sctp_sndinfo))] = {};
+  iovec iov = {const_cast<char*>(payload.data()), payload.size()};
+  msghdr msg = {};
+  msg.msg_name = &s.addr;
+  msg.msg_namelen = sizeof(s.addr);
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  msg.msg_control = control;
+  msg.msg_controllen = sizeof(control);
+  cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+  cmsg->cmsg_level = SOL_SCTP;
+  cmsg->cmsg_type = SCTP_SNDINFO;
+  cmsg->cmsg_len = CMSG_LEN(sizeof(sctp_sndinfo));
+  sctp_sndinfo sndinfo = {};
+  sndinfo.snd_sid = 1;
+  sndinfo.snd_ppid = htonl(42);
+  memcpy(CMSG_DATA(cmsg), &sndinfo, sizeof(sndinfo));
+  ASSERT_THAT(RetryEINTR(sendmsg)(s.client.get(), &msg, 0),
+              SyscallSucceedsWithValue(payload.size()));
+
+  char buf[64];
+  char rcontrol[CMSG_SPACE(sizeof(sctp_rcvinfo))] = {};
+  ssize_t n;
+  msghdr out;
+  ASSERT_NO_FATAL_FAILURE(WaitReadable(s.server.get()));
+  int flags = RecvMsg(s.server.get(), buf, sizeof(buf), &n, rcontrol,
+                      sizeof(rcontrol), &out);
+  ASSERT_EQ(n, static_cast<ssize_t>(payload.size()));
+  EXPECT_EQ(std::string(buf, n), payload);
+  EXPECT_TRUE(flags & MSG_EOR);
+  EXPECT_FALSE(flags & MSG_NOTIFICATION);
+
+  cmsghdr* rcmsg = CMSG_FIRSTHDR(&out);
+  ASSERT_NE(rcmsg, nullptr);
+  EXPECT_EQ(rcmsg->cmsg_level, SOL_SCTP);
+  EXPECT_EQ(rcmsg->cmsg_type, SCTP_RCVINFO);
+  ASSERT_EQ(rcmsg->cmsg_len, CMSG_LEN(sizeof(sctp_rcvinfo)));
+  sctp_rcvinfo rcvinfo;
+  memcpy(&rcvinfo, CMSG_DATA(rcmsg), sizeof(rcvinfo));
+  EXPECT_EQ(rcvinfo.rcv_sid, 1);
+  EXPECT_EQ(rcvinfo.rcv_ppid, htonl(42));
+  EXPECT_NE(rcvinfo.rcv_assoc_id, 0);
+}
+
+TEST(SCTPSocketTest, OneToManyAssocChangeNotification) {
+  SKIP_IF_NO_SCTP();
+  OneToManySetup s = ASSERT_NO_ERRNO_AND_VALUE(NewOneToMany());
+
+  sctp_event_subscribe events = {};
+  events.sctp_association_event = 1;
+  ASSERT_THAT(setsockopt(s.server.get(), SOL_SCTP, SCTP_EVENTS, &events,
+                         sizeof(events)),
+              SyscallSucceeds());
+
+  const char data = 'x';
+  ASSERT_THAT(RetryEINTR(sendto)(s.client.get(), &data, sizeof(data), 0,
+                                 reinterpret_cast<sockaddr*>(&s.addr),
+                                 sizeof(s.addr)),
+              SyscallSucceedsWithValue(sizeof(data)));
+
+  // The notification that the association is up precedes its data.
+  char buf[256];
+  ssize_t n;
+  ASSERT_NO_FATAL_FAILURE(WaitReadable(s.server.get()));
+  int flags = RecvMsg(s.server.get(), buf, sizeof(buf), &n);
+  // Linux may append the supported features to the notification.
+  ASSERT_GE(n, static_cast<ssize_t>(sizeof(sctp_assoc_change)));
+  EXPECT_TRUE(flags & MSG_NOTIFICATION);
+  EXPECT_TRUE(flags & MSG_EOR);
+  sctp_assoc_change change;
+  memcpy(&change, buf, sizeof(change));
+  EXPECT_EQ(change.sac_type, SCTP_ASSOC_CHANGE);
+  EXPECT_EQ(change.sac_state, SCTP_COMM_UP);
+
+  ASSERT_NO_FATAL_FAILURE(WaitReadable(s.server.get()));
+  flags = RecvMsg(s.server.get(), buf, sizeof(buf), &n);
+  ASSERT_EQ(n, static_cast<ssize_t>(sizeof(data)));
+  EXPECT_EQ(buf[0], data);
+  EXPECT_FALSE(flags & MSG_NOTIFICATION);
+
+  int num = 0;
+  socklen_t len = sizeof(num);
+  ASSERT_THAT(getsockopt(s.server.get(), SOL_SCTP, SCTP_GET_ASSOC_NUMBER, &num,
+                         &len),
+              SyscallSucceeds());
+  EXPECT_EQ(num, 1);
+}
+
+TEST(SCTPSocketTest, Peeloff) {
+  SKIP_IF_NO_SCTP();
+  OneToManySetup s = ASSERT_NO_ERRNO_AND_VALUE(NewOneToMany());
+
+  int one = 1;
+  ASSERT_THAT(setsockopt(s.server.get(), SOL_SCTP, SCTP_RECVRCVINFO, &one,
+                         sizeof(one)),
+              SyscallSucceeds());
+
+  const char data = 'p';
+  ASSERT_THAT(RetryEINTR(sendto)(s.client.get(), &data, sizeof(data), 0,
+                                 reinterpret_cast<sockaddr*>(&s.addr),
+                                 sizeof(s.addr)),
+              SyscallSucceedsWithValue(sizeof(data)));
+
+  char buf[16];
+  char control[CMSG_SPACE(sizeof(sctp_rcvinfo))] = {};
+  ssize_t n;
+  msghdr out;
+  ASSERT_NO_FATAL_FAILURE(WaitReadable(s.server.get()));
+  RecvMsg(s.server.get(), buf, sizeof(buf), &n, control, sizeof(control),
+          &out);
+  ASSERT_EQ(n, static_cast<ssize_t>(sizeof(data)));
+  cmsghdr* cmsg = CMSG_FIRSTHDR(&out);
+  ASSERT_NE(cmsg, nullptr);
+  sctp_rcvinfo rcvinfo;
+  memcpy(&rcvinfo, CMSG_DATA(cmsg), sizeof(rcvinfo));
+
+  // Branch the association off into its own one-to-one socket.
+  sctp_peeloff_arg_t arg = {};
+  arg.associd = rcvinfo.rcv_assoc_id;
+  socklen_t len = sizeof(arg);
+  ASSERT_THAT(getsockopt(s.server.get(), SOL_SCTP, SCTP_SOCKOPT_PEELOFF, &arg,
+                         &len),
+              SyscallSucceeds());
+  FileDescriptor peeled(arg.sd);
+
+  int type;
+  len = sizeof(type);
+  ASSERT_THAT(getsockopt(peeled.get(), SOL_SOCKET, SO_TYPE, &type, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(type, SOCK_STREAM);
+
+  int num = -1;
+  len = sizeof(num);
+  ASSERT_THAT(getsockopt(s.server.get(), SOL_SCTP, SCTP_GET_ASSOC_NUMBER, &num,
+                         &len),
+              SyscallSucceeds());
+  EXPECT_EQ(num, 0);
+
+  // The peeled off socket replies on the association.
+  const char reply = 'r';
+  ASSERT_THAT(RetryEINTR(send)(peeled.get(), &reply, sizeof(reply), 0),
+              SyscallSucceedsWithValue(sizeof(reply)));
+  ASSERT_NO_FATAL_FAILURE(WaitReadable(s.client.get()));
+  ASSERT_THAT(RetryEINTR(recv)(s.client.get(), buf, sizeof(buf), 0),
+              SyscallSucceedsWithValue(sizeof(reply)));
+  EXPECT_EQ(buf[0], reply);
+}
+
+TEST(SCTPSocketTest, GetPeerAddrs) {
+  SKIP_IF_NO_SCTP();
+  FileDescriptor listener = ASSERT_NO_ERRNO_AND_VALUE(SCTPSocket(SOCK_STREAM));
+  sockaddr_in addr = ASSERT_NO_ERRNO_AND_VALUE(BindLoopback(listener.get()));
+  ASSERT_THAT(listen(listener.get(), 1), SyscallSucceeds());
+  FileDescriptor client = ASSERT_NO_ERRNO_AND_VALUE(SCTPSocket(SOCK_STREAM));
+
+  // Connect with the connectx interface, which reports the association ID.
+  sctp_getaddrs_old param = {};
+  param.addr_num = sizeof(addr);
+  param.addrs = reinterpret_cast<sockaddr*>(&addr);
+  socklen_t len = sizeof(param);
+  ASSERT_THAT(getsockopt(client.get(), SOL_SCTP, SCTP_SOCKOPT_CONNECTX3, &param,
+                         &len),
+              SyscallSucceeds());
+  FileDescriptor server =
+      ASSERT_NO_ERRNO_AND_VALUE(Accept(listener.get(), nullptr, nullptr));
+
+  // The result is a struct sctp_getaddrs followed by the packed addresses.
+  char buf[sizeof(sctp_getaddrs) + 4 * sizeof(sockaddr_in)] = {};
+  len = sizeof(buf);
+  ASSERT_THAT(
+      getsockopt(client.get(), SOL_SCTP, SCTP_GET_PEER_ADDRS, buf, &len),
+      SyscallSucceeds());
+  sctp_getaddrs hdr;
+  memcpy(&hdr, buf, sizeof(hdr));
+  ASSERT_EQ(hdr.addr_num, 1u);
+  EXPECT_EQ(len, sizeof(hdr) + sizeof(sockaddr_in));
+  sockaddr_in peer;
+  memcpy(&peer, buf + sizeof(hdr), sizeof(peer));
+  EXPECT_EQ(peer.sin_family, AF_INET);
+  EXPECT_EQ(peer.sin_port, addr.sin_port);
+  EXPECT_EQ(peer.sin_addr.s_addr, addr.sin_addr.s_addr);
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -20,10 +20,12 @@
 
 #include <cstdio>
 #include <cstring>
+#include <utility>
 
 #include "gmock/gmock.h"
 #include "gtest/gtest.h"
 #include "test/syscalls/linux/ip_socket_test_util.h"
+#include "test/util/capability_util.h"
 #include "test/util/socket_util.h"
 #include "test/util/test_util.h"
 
@@ -453,6 +455,143 @@ TEST_P(IPUnboundSocketTest, SetReuseAddr) {
   EXPECT_EQ(get_sz, sizeof(get));
 }
 
+// TransparentOption returns the level and name of the IP_TRANSPARENT option
+// for the given domain.
+std::pair<int, int> TransparentOption(int domain) {
+  if (domain == AF_INET6) {
+    return {IPPROTO_IPV6, IPV6_TRANSPARENT};
+  }
+  return {IPPROTO_IP, IP_TRANSPARENT};
+}
+
+TEST_P(IPUnboundSocketTest, TransparentDefault) {
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  auto [level, name] = TransparentOption(GetParam().domain);
+
+  int get = -1;
+  socklen_t get_sz = sizeof(get);
+  ASSERT_THAT(getsockopt(socket->get(), level, name, &get, &get_sz),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get, kSockOptOff);
+  EXPECT_EQ(get_sz, sizeof(get));
+}
+
+TEST_P(IPUnboundSocketTest, SetTransparent) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  auto [level, name] = TransparentOption(GetParam().domain);
+
+  ASSERT_THAT(
+      setsockopt(socket->get(), level, name, &kSockOptOn, sizeof(kSockOptOn)),
+      SyscallSucceeds());
+
+  int get = -1;
+  socklen_t get_sz = sizeof(get);
+  ASSERT_THAT(getsockopt(socket->get(), level, name, &get, &get_sz),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get, kSockOptOn);
+  EXPECT_EQ(get_sz, sizeof(get));
+}
+
+TEST_P(IPUnboundSocketTest, SetTransparentWithoutCapability) {
+  SKIP_IF(ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)) ||
+          ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  auto [level, name] = TransparentOption(GetParam().domain);
+
+  EXPECT_THAT(
+      setsockopt(socket->get(), level, name, &kSockOptOn, sizeof(kSockOptOn)),
+      SyscallFailsWithErrno(EPERM));
+}
+
+TEST_P(IPUnboundSocketTest, FreeBindDefault) {
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  int get = -1;
+  socklen_t get_sz = sizeof(get);
+  ASSERT_THAT(
+      getsockopt(socket->get(), IPPROTO_IP, IP_FREEBIND, &get, &get_sz),
+      SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get, kSockOptOff);
+  EXPECT_EQ(get_sz, sizeof(get));
+}
+
+TEST_P(IPUnboundSocketTest, BindNonLocalAddress) {
+  SKIP_IF(GetParam().domain != AF_INET);
+
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  // 192.0.2.1 is reserved for documentation (TEST-NET-1) and is never local.
+  addr.sin_addr.s_addr = htonl(0xc0000201);
+  EXPECT_THAT(bind(socket->get(), AsSockAddr(&addr), sizeof(addr)),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+
+  ASSERT_THAT(setsockopt(socket->get(), IPPROTO_IP, IP_FREEBIND, &kSockOptOn,
+                         sizeof(kSockOptOn)),
+              SyscallSucceeds());
+
+  int get = -1;
+  socklen_t get_sz = sizeof(get);
+  ASSERT_THAT(
+      getsockopt(socket->get(), IPPROTO_IP, IP_FREEBIND, &get, &get_sz),
+      SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get, kSockOptOn);
+
+  ASSERT_THAT(bind(socket->get(), AsSockAddr(&addr), sizeof(addr)),
+              SyscallSucceeds());
+
+  sockaddr_in bound = {};
+  socklen_t bound_len = sizeof(bound);
+  ASSERT_THAT(getsockname(socket->get(), AsSockAddr(&bound), &bound_len),
+              SyscallSucceeds());
+  EXPECT_EQ(bound.sin_addr.s_addr, addr.sin_addr.s_addr);
+}
+
+TEST_P(IPUnboundSocketTest, MarkDefault) {
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  int get = -1;
+  socklen_t get_sz = sizeof(get);
+  ASSERT_THAT(getsockopt(socket->get(), SOL_SOCKET, SO_MARK, &get, &get_sz),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get, 0);
+  EXPECT_EQ(get_sz, sizeof(get));
+}
+
+TEST_P(IPUnboundSocketTest, SetMark) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  constexpr int kMark = 0x1234;
+  ASSERT_THAT(
+      setsockopt(socket->get(), SOL_SOCKET, SO_MARK, &kMark, sizeof(kMark)),
+      SyscallSucceeds());
+
+  int get = -1;
+  socklen_t get_sz = sizeof(get);
+  ASSERT_THAT(getsockopt(socket->get(), SOL_SOCKET, SO_MARK, &get, &get_sz),
+              SyscallSucceedsWithValue(0));
+  EXPECT_EQ(get, kMark);
+  EXPECT_EQ(get_sz, sizeof(get));
+}
+
+TEST_P(IPUnboundSocketTest, SetMarkWithoutCapability) {
+  SKIP_IF(ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)) ||
+          ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_RAW)));
+
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  constexpr int kMark = 0x1234;
+  EXPECT_THAT(
+      setsockopt(socket->get(), SOL_SOCKET, SO_MARK, &kMark, sizeof(kMark)),
+      SyscallFailsWithErrno(EPERM));
+}
+
 INSTANTIATE_TEST_SUITE_P(
     IPUnboundSockets, IPUnboundSocketTest,
     ::testing::ValuesIn(VecCat<SocketKind>(
@@ -15,6 +15,7 @@
 #include "test/syscalls/linux/socket_ipv4_udp_unbound.h"
 
 #include <arpa/inet.h>
+#include <netinet/in.h>
 #include <sys/socket.h>
 #include <sys/types.h>
 #include <sys/un.h>
@@ -2338,5 +2339,289 @@ TEST_P(IPv4UDPUnboundSocketTest, IpMulticastIPPacketInfo) {
   EXPECT_EQ(received_pktinfo.ipi_addr.s_addr, group.imr_multiaddr.s_addr);
 }
 
+
+namespace {
+
+// Binds receiver to the any address and sender to the loopback address so
+// that multicast packets sent by sender come from 127.0.0.1, and returns the
+// multicast address to send to in order to reach receiver.
+TestAddress BindForSourceFilterTest(int sender, int receiver) {
+  auto sender_addr = V4Loopback();
+  EXPECT_THAT(bind(sender, AsSockAddr(&sender_addr.addr), sender_addr.addr_len),
+              SyscallSucceeds());
+
+  auto receiver_addr = V4Any();
+  EXPECT_THAT(
+      bind(receiver, AsSockAddr(&receiver_addr.addr), receiver_addr.addr_len),
+      SyscallSucceeds());
+  socklen_t receiver_addr_len = receiver_addr.addr_len;
+  EXPECT_THAT(getsockname(receiver, AsSockAddr(&receiver_addr.addr),
+                          &receiver_addr_len),
+              SyscallSucceeds());
+
+  auto send_addr = V4Multicast();
+  reinterpret_cast<sockaddr_in*>(&send_addr.addr)->sin_port =
+      reinterpret_cast<sockaddr_in*>(&receiver_addr.addr)->sin_port;
+  return send_addr;
+}
+
+// Sends a packet from sender to send_addr and returns whether receiver
+// received it.
+bool SourceFilterAllowsPacket(int sender, int receiver,
+                              const TestAddress& send_addr) {
+  char send_buf[200];
+  RandomizeBuffer(send_buf, sizeof(send_buf));
+  EXPECT_THAT(RetryEINTR(sendto)(sender, send_buf, sizeof(send_buf), 0,
+                                 AsSockAddr(&send_addr.addr),
+                                 send_addr.addr_len),
+              SyscallSucceedsWithValue(sizeof(send_buf)));
+
+  char recv_buf[sizeof(send_buf)] = {};
+  auto received =
+      RecvTimeout(receiver, recv_buf, sizeof(recv_buf), kNegativeTimeoutSecs);
+  if (!received.ok()) {
+    EXPECT_THAT(received, PosixErrorIs(EAGAIN, ::testing::_));
+    return false;
+  }
+  EXPECT_EQ(received.ValueOrDie(), sizeof(send_buf));
+  EXPECT_EQ(0, memcmp(send_buf, recv_buf, sizeof(send_buf)));
+  return true;
+}
+
+}  // namespace
+
+// Check that a source-specific membership only receives packets from the
+// sources it includes.
+TEST_P(IPv4UDPUnboundSocketTest, IpAddSourceMembership) {
+  // TODO(b/267210840): Get multicast working with hostinet.
+  SKIP_IF(IsRunningWithHostinet());
+
+  auto socket1 = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  auto socket2 = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  auto send_addr = BindForSourceFilterTest(socket1->get(), socket2->get());
+
+  ip_mreq_source req = {};
+  req.imr_multiaddr.s_addr = inet_addr(kMulticastAddress);
+  req.imr_interface.s_addr = htonl(INADDR_LOOPBACK);
+  req.imr_sourceaddr.s_addr = inet_addr("127.0.0.2");
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_ADD_SOURCE_MEMBERSHIP,
+                         &req, sizeof(req)),
+              SyscallSucceeds());
+  EXPECT_FALSE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+
+  // Adding a source twice is an error.
+  EXPECT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_ADD_SOURCE_MEMBERSHIP,
+                         &req, sizeof(req)),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+
+  req.imr_sourceaddr.s_addr = htonl(INADDR_LOOPBACK);
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_ADD_SOURCE_MEMBERSHIP,
+                         &req, sizeof(req)),
+              SyscallSucceeds());
+  EXPECT_TRUE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_DROP_SOURCE_MEMBERSHIP,
+                         &req, sizeof(req)),
+              SyscallSucceeds());
+  EXPECT_FALSE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+
+  // Blocking a source is only valid for EXCLUDE mode memberships.
+  EXPECT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_BLOCK_SOURCE, &req,
+                         sizeof(req)),
+              SyscallFailsWithErrno(EINVAL));
+
+  // Dropping the last source leaves the group.
+  req.imr_sourceaddr.s_addr = inet_addr("127.0.0.2");
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_DROP_SOURCE_MEMBERSHIP,
+                         &req, sizeof(req)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_DROP_SOURCE_MEMBERSHIP,
+                         &req, sizeof(req)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// Check that blocking a source of an any-source membership stops packets from
+// that source.
+TEST_P(IPv4UDPUnboundSocketTest, IpBlockSource) {
+  // TODO(b/267210840): Get multicast working with hostinet.
+  SKIP_IF(IsRunningWithHostinet());
+
+  auto socket1 = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  auto socket2 = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  auto send_addr = BindForSourceFilterTest(socket1->get(), socket2->get());
+
+  ip_mreq_source req = {};
+  req.imr_multiaddr.s_addr = inet_addr(kMulticastAddress);
+  req.imr_interface.s_addr = htonl(INADDR_LOOPBACK);
+  req.imr_sourceaddr.s_addr = htonl(INADDR_LOOPBACK);
+
+  // A membership is required to block a source.
+  EXPECT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_BLOCK_SOURCE, &req,
+                         sizeof(req)),
+              SyscallFailsWithErrno(EINVAL));
+
+  ip_mreq group = {};
+  group.imr_multiaddr = req.imr_multiaddr;
+  group.imr_interface = req.imr_interface;
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_ADD_MEMBERSHIP, &group,
+                         sizeof(group)),
+              SyscallSucceeds());
+  EXPECT_TRUE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_BLOCK_SOURCE, &req,
+                         sizeof(req)),
+              SyscallSucceeds());
+  EXPECT_FALSE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_UNBLOCK_SOURCE, &req,
+                         sizeof(req)),
+              SyscallSucceeds());
+  EXPECT_TRUE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+  EXPECT_THAT(setsockopt(socket2->get(), IPPROTO_IP, IP_UNBLOCK_SOURCE, &req,
+                         sizeof(req)),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+}
+
+// Check that IP_MSFILTER replaces and reads back the source filter of a
+// membership.
+TEST_P(IPv4UDPUnboundSocketTest, IpMsfilter) {
+  auto socket = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+
+  constexpr int kMaxSources = 10;
+  char buf[IP_MSFILTER_SIZE(kMaxSources + 1)] = {};
+  ip_msfilter* msf = reinterpret_cast<ip_msfilter*>(buf);
+  msf->imsf_multiaddr.s_addr = inet_addr(kMulticastAddress);
+  msf->imsf_interface.s_addr = htonl(INADDR_LOOPBACK);
+  msf->imsf_fmode = MCAST_EXCLUDE;
+  msf->imsf_numsrc = 2;
+  msf->imsf_slist[0].s_addr = inet_addr("127.0.0.2");
+  msf->imsf_slist[1].s_addr = inet_addr("127.0.0.3");
+
+  // The group must be joined before its filter can be set.
+  EXPECT_THAT(setsockopt(socket->get(), IPPROTO_IP, IP_MSFILTER, msf,
+                         IP_MSFILTER_SIZE(2)),
+              SyscallFailsWithErrno(EINVAL));
+  socklen_t len = IP_MSFILTER_SIZE(2);
+  EXPECT_THAT(getsockopt(socket->get(), IPPROTO_IP, IP_MSFILTER, msf, &len),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+
+  ip_mreq group = {};
+  group.imr_multiaddr = msf->imsf_multiaddr;
+  group.imr_interface = msf->imsf_interface;
+  ASSERT_THAT(setsockopt(socket->get(), IPPROTO_IP, IP_ADD_MEMBERSHIP, &group,
+                         sizeof(group)),
+              SyscallSucceeds());
+  ASSERT_THAT(setsockopt(socket->get(), IPPROTO_IP, IP_MSFILTER, msf,
+                         IP_MSFILTER_SIZE(2)),
+              SyscallSucceeds());
+
+  // Only room for one source is provided but the total number of sources is
+  // reported.
+  memset(msf->imsf_slist, 0, 2 * sizeof(msf->imsf_slist[0]));
+  msf->imsf_fmode = MCAST_INCLUDE;
+  msf->imsf_numsrc = 1;
+  len = IP_MSFILTER_SIZE(1);
+  ASSERT_THAT(getsockopt(socket->get(), IPPROTO_IP, IP_MSFILTER, msf, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, IP_MSFILTER_SIZE(1));
+  EXPECT_EQ(msf->imsf_fmode, MCAST_EXCLUDE);
+  EXPECT_EQ(msf->imsf_numsrc, 2u);
+  EXPECT_THAT(msf->imsf_slist[0].s_addr,
+              ::testing::AnyOf(inet_addr("127.0.0.2"), inet_addr("127.0.0.3")));
+
+  // The number of sources is limited.
+  msf->imsf_numsrc = kMaxSources + 1;
+  for (int i = 0; i < kMaxSources + 1; i++) {
+    msf->imsf_slist[i].s_addr = htonl(INADDR_LOOPBACK + i + 1);
+  }
+  EXPECT_THAT(setsockopt(socket->get(), IPPROTO_IP, IP_MSFILTER, msf,
+                         IP_MSFILTER_SIZE(kMaxSources + 1)),
+              SyscallFailsWithErrno(ENOBUFS));
+
+  // An INCLUDE mode filter without sources leaves the group.
+  msf->imsf_fmode = MCAST_INCLUDE;
+  msf->imsf_numsrc = 0;
+  ASSERT_THAT(setsockopt(socket->get(), IPPROTO_IP, IP_MSFILTER, msf,
+                         IP_MSFILTER_SIZE(0)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(socket->get(), IPPROTO_IP, IP_DROP_MEMBERSHIP, &group,
+                         sizeof(group)),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+}
+
+// Check the protocol-independent MCAST_* source filter options.
+TEST_P(IPv4UDPUnboundSocketTest, McastJoinSourceGroup) {
+  // TODO(b/267210840): Get multicast working with hostinet.
+  SKIP_IF(IsRunningWithHostinet());
+
+  auto socket1 = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  auto socket2 = ASSERT_NO_ERRNO_AND_VALUE(NewSocket());
+  auto send_addr = BindForSourceFilterTest(socket1->get(), socket2->get());
+
+  group_source_req req = {};
+  req.gsr_interface = ASSERT_NO_ERRNO_AND_VALUE(GetLoopbackIndex());
+  sockaddr_in* group = reinterpret_cast<sockaddr_in*>(&req.gsr_group);
+  group->sin_family = AF_INET;
+  group->sin_addr.s_addr = inet_addr(kMulticastAddress);
+  sockaddr_in* source = reinterpret_cast<sockaddr_in*>(&req.gsr_source);
+  source->sin_family = AF_INET;
+  source->sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, MCAST_JOIN_SOURCE_GROUP,
+                         &req, sizeof(req)),
+              SyscallSucceeds());
+  EXPECT_TRUE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+
+  // Read the filter back.
+  char buf[GROUP_FILTER_SIZE(1)] = {};
+  group_filter* gf = reinterpret_cast<group_filter*>(buf);
+  gf->gf_interface = req.gsr_interface;
+  gf->gf_group = req.gsr_group;
+  gf->gf_numsrc = 1;
+  socklen_t len = sizeof(buf);
+  ASSERT_THAT(getsockopt(socket2->get(), IPPROTO_IP, MCAST_MSFILTER, gf, &len),
+              SyscallSucceeds());
+  EXPECT_EQ(len, GROUP_FILTER_SIZE(1));
+  EXPECT_EQ(gf->gf_fmode, MCAST_INCLUDE);
+  EXPECT_EQ(gf->gf_numsrc, 1u);
+  sockaddr_in* got = reinterpret_cast<sockaddr_in*>(&gf->gf_slist[0]);
+  EXPECT_EQ(got->sin_family, AF_INET);
+  EXPECT_EQ(got->sin_addr.s_addr, htonl(INADDR_LOOPBACK));
+
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, MCAST_LEAVE_SOURCE_GROUP,
+                         &req, sizeof(req)),
+              SyscallSucceeds());
+  EXPECT_FALSE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+
+  // Join the group for all sources but block the sender.
+  group_req greq = {};
+  greq.gr_interface = req.gsr_interface;
+  greq.gr_group = req.gsr_group;
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, MCAST_JOIN_GROUP, &greq,
+                         sizeof(greq)),
+              SyscallSucceeds());
+  EXPECT_TRUE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, MCAST_BLOCK_SOURCE, &req,
+                         sizeof(req)),
+              SyscallSucceeds());
+  EXPECT_FALSE(
+      SourceFilterAllowsPacket(socket1->get(), socket2->get(), send_addr));
+  ASSERT_THAT(setsockopt(socket2->get(), IPPROTO_IP, MCAST_LEAVE_GROUP, &greq,
+                         sizeof(greq)),
+              SyscallSucceeds());
+  EXPECT_THAT(setsockopt(socket2->get(), IPPROTO_IP, MCAST_LEAVE_GROUP, &greq,
+                         sizeof(greq)),
+              SyscallFailsWithErrno(EADDRNOTAVAIL));
+}
+
 }  // namespace testing
 }  // namespace gvisor
@@ -0,0 +1,444 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <linux/genetlink.h>
+#include <linux/if_link.h>
+#include <linux/netlink.h>
+#include <linux/rtnetlink.h>
+#include <linux/wireguard.h>
+#include <net/if.h>
+#include <sys/socket.h>
+
+#include <cstdint>
+#include <cstring>
+#include <string>
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/posix_error.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+// Tests for NETLINK_GENERIC sockets.
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// NlMessage builds a netlink message with nested attributes.
+class NlMessage {
+ public:
+  NlMessage(uint16_t type, uint16_t flags, uint32_t seq) {
+    struct nlmsghdr hdr = {};
+    hdr.nlmsg_type = type;
+    hdr.nlmsg_flags = NLM_F_REQUEST | flags;
+    hdr.nlmsg_seq = seq;
+    Append(&hdr, sizeof(hdr));
+  }
+
+  // AddGenlHeader adds a generic netlink header.
+  void AddGenlHeader(uint8_t cmd, uint8_t version) {
+    struct genlmsghdr genl = {};
+    genl.cmd = cmd;
+    genl.version = version;
+    Append(&genl, sizeof(genl));
+  }
+
+  // AddAttr adds an attribute.
+  void AddAttr(uint16_t type, const void* data, size_t len) {
+    struct nlattr attr = {};
+    attr.nla_type = type;
+    attr.nla_len = NLA_HDRLEN + len;
+    Append(&attr, sizeof(attr));
+    Append(data, len);
+    buf_.resize(NLA_ALIGN(buf_.size()));
+    Finish();
+  }
+
+  void AddString(uint16_t type, const std::string& s) {
+    AddAttr(type, s.c_str(), s.size() + 1);
+  }
+
+  // BeginNested starts a nested attribute, ended by EndNested.
+  void BeginNested(uint16_t type) {
+    nested_.push_back(buf_.size());
+    AddAttr(type | NLA_F_NESTED, nullptr, 0);
+  }
+
+  void EndNested() {
+    struct nlattr* attr =
+        reinterpret_cast<struct nlattr*>(buf_.data() + nested_.back());
+    attr->nla_len = buf_.size() - nested_.back();
+    nested_.pop_back();
+  }
+
+  void* data() {
+    Finish();
+    return buf_.data();
+  }
+  size_t size() const { return buf_.size(); }
+
+  void Append(const void* p, size_t len) {
+    const char* c = reinterpret_cast<const char*>(p);
+    buf_.insert(buf_.end(), c, c + len);
+    Finish();
+  }
+
+ private:
+  // Finish updates the length of the message.
+  void Finish() {
+    reinterpret_cast<struct nlmsghdr*>(buf_.data())->nlmsg_len = buf_.size();
+  }
+
+  std::vector<char> buf_;
+  std::vector<size_t> nested_;
+};
+
+// GenlAttrs returns the attributes of a generic netlink message.
+std::vector<const struct nlattr*> GenlAttrs(const struct nlmsghdr* hdr) {
+  std::vector<const struct nlattr*> attrs;
+  const char* p = reinterpret_cast<const char*>(NLMSG_DATA(hdr)) + GENL_HDRLEN;
+  int len = hdr->nlmsg_len - NLMSG_LENGTH(GENL_HDRLEN);
+  while (len >= NLA_HDRLEN) {
+    const struct nlattr* attr = reinterpret_cast<const struct nlattr*>(p);
+    if (attr->nla_len < NLA_HDRLEN || attr->nla_len > len) {
+      break;
+    }
+    attrs.push_back(attr);
+    p += NLA_ALIGN(attr->nla_len);
+    len -= NLA_ALIGN(attr->nla_len);
+  }
+  return attrs;
+}
+
+const void* AttrData(const struct nlattr* attr) {
+  return reinterpret_cast<const char*>(attr) + NLA_HDRLEN;
+}
+
+// NestedAttrs returns the attributes nested in attr.
+std::vector<const struct nlattr*> NestedAttrs(const struct nlattr* attr) {
+  std::vector<const struct nlattr*> attrs;
+  const char* p = reinterpret_cast<const char*>(AttrData(attr));
+  int len = attr->nla_len - NLA_HDRLEN;
+  while (len >= NLA_HDRLEN) {
+    const struct nlattr* nested = reinterpret_cast<const struct nlattr*>(p);
+    if (nested->nla_len < NLA_HDRLEN || nested->nla_len > len) {
+      break;
+    }
+    attrs.push_back(nested);
+    p += NLA_ALIGN(nested->nla_len);
+    len -= NLA_ALIGN(nested->nla_len);
+  }
+  return attrs;
+}
+
+// ResolveFamily returns the ID of the generic netlink family with the given
+// name.
+PosixErrorOr<uint16_t> ResolveFamily(const FileDescriptor& fd,
+                                     const std::string& name) {
+  NlMessage req(GENL_ID_CTRL, 0, 1);
+  req.AddGenlHeader(CTRL_CMD_GETFAMILY, 1);
+  req.AddString(CTRL_ATTR_FAMILY_NAME, name);
+
+  uint16_t id = 0;
+  RETURN_IF_ERRNO(NetlinkRequestResponseSingle(
+      fd, req.data(), req.size(), [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != GENL_ID_CTRL) {
+          return;
+        }
+        for (const struct nlattr* attr : GenlAttrs(hdr)) {
+          if (attr->nla_type == CTRL_ATTR_FAMILY_ID) {
+            memcpy(&id, AttrData(attr), sizeof(id));
+          }
+        }
+      }));
+  if (id == 0) {
+    return PosixError(ENOENT, "family not found");
+  }
+  return id;
+}
+
+// The controller family resolves its own name to its fixed ID.
+TEST(NetlinkGenericTest, ResolveController) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_GENERIC));
+  EXPECT_THAT(ResolveFamily(fd, "nlctrl"),
+              IsPosixErrorOkAndHolds(GENL_ID_CTRL));
+}
+
+// Resolving a family that doesn't exist fails with ENOENT.
+TEST(NetlinkGenericTest, ResolveUnknownFamily) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_GENERIC));
+
+  NlMessage req(GENL_ID_CTRL, NLM_F_ACK, 1);
+  req.AddGenlHeader(CTRL_CMD_GETFAMILY, 1);
+  req.AddString(CTRL_ATTR_FAMILY_NAME, "gvisor_no_such_family");
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, 1, req.data(), req.size()),
+              PosixErrorIs(ENOENT, ::testing::_));
+}
+
+// The controller describes its commands and its "notify" multicast group.
+TEST(NetlinkGenericTest, ControllerOpsAndGroups) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_GENERIC));
+
+  NlMessage req(GENL_ID_CTRL, 0, 1);
+  req.AddGenlHeader(CTRL_CMD_GETFAMILY, 1);
+  req.AddString(CTRL_ATTR_FAMILY_NAME, "nlctrl");
+
+  bool found_op = false;
+  uint32_t notify_id = 0;
+  ASSERT_NO_ERRNO(NetlinkRequestResponseSingle(
+      fd, req.data(), req.size(), [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != GENL_ID_CTRL) {
+          return;
+        }
+        for (const struct nlattr* attr : GenlAttrs(hdr)) {
+          switch (attr->nla_type & NLA_TYPE_MASK) {
+            case CTRL_ATTR_OPS:
+              for (const struct nlattr* op : NestedAttrs(attr)) {
+                uint32_t id = 0;
+                uint32_t flags = 0;
+                for (const struct nlattr* a : NestedAttrs(op)) {
+                  if (a->nla_type == CTRL_ATTR_OP_ID) {
+                    memcpy(&id, AttrData(a), sizeof(id));
+                  } else if (a->nla_type == CTRL_ATTR_OP_FLAGS) {
+                    memcpy(&flags, AttrData(a), sizeof(flags));
+                  }
+                }
+                if (id == CTRL_CMD_GETFAMILY && (flags & GENL_CMD_CAP_DO) &&
+                    (flags & GENL_CMD_CAP_DUMP)) {
+                  found_op = true;
+                }
+              }
+              break;
+            case CTRL_ATTR_MCAST_GROUPS:
+              for (const struct nlattr* group : NestedAttrs(attr)) {
+                std::string name;
+                uint32_t id = 0;
+                for (const struct nlattr* a : NestedAttrs(group)) {
+                  if (a->nla_type == CTRL_ATTR_MCAST_GRP_NAME) {
+                    name = reinterpret_cast<const char*>(AttrData(a));
+                  } else if (a->nla_type == CTRL_ATTR_MCAST_GRP_ID) {
+                    memcpy(&id, AttrData(a), sizeof(id));
+                  }
+                }
+                if (name == "notify") {
+                  notify_id = id;
+                }
+              }
+              break;
+          }
+        }
+      }));
+  EXPECT_TRUE(found_op);
+  EXPECT_EQ(notify_id, GENL_ID_CTRL);
+}
+
+// Dumping the families includes the controller.
+TEST(NetlinkGenericTest, DumpFamilies) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_GENERIC));
+
+  NlMessage req(GENL_ID_CTRL, NLM_F_DUMP, 1);
+  req.AddGenlHeader(CTRL_CMD_GETFAMILY, 1);
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, req.data(), req.size(),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != GENL_ID_CTRL) {
+          return;
+        }
+        for (const struct nlattr* attr : GenlAttrs(hdr)) {
+          if (attr->nla_type == CTRL_ATTR_FAMILY_NAME &&
+              strcmp(reinterpret_cast<const char*>(AttrData(attr)),
+                     "nlctrl") == 0) {
+            found = true;
+          }
+        }
+      },
+      false));
+  EXPECT_TRUE(found);
+}
+
+// Commands that a family doesn't implement fail with EOPNOTSUPP.
+TEST(NetlinkGenericTest, UnknownCommand) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_GENERIC));
+
+  NlMessage req(GENL_ID_CTRL, NLM_F_ACK, 1);
+  req.AddGenlHeader(CTRL_CMD_UNSPEC, 1);
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, 1, req.data(), req.size()),
+              PosixErrorIs(EOPNOTSUPP, ::testing::_));
+}
+
+// Sockets join and leave registered multicast groups, which getsockname(2)
+// reports.
+TEST(NetlinkGenericTest, JoinMulticastGroup) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_GENERIC));
+
+  int group = GENL_ID_CTRL;
+  ASSERT_THAT(setsockopt(fd.get(), SOL_NETLINK, NETLINK_ADD_MEMBERSHIP, &group,
+                         sizeof(group)),
+              SyscallSucceeds());
+
+  struct sockaddr_nl addr = {};
+  socklen_t addrlen = sizeof(addr);
+  ASSERT_THAT(getsockname(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                          &addrlen),
+              SyscallSucceeds());
+  EXPECT_EQ(addr.nl_groups, 1u << (GENL_ID_CTRL - 1));
+
+  ASSERT_THAT(setsockopt(fd.get(), SOL_NETLINK, NETLINK_DROP_MEMBERSHIP,
+                         &group, sizeof(group)),
+              SyscallSucceeds());
+  addrlen = sizeof(addr);
+  ASSERT_THAT(getsockname(fd.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                          &addrlen),
+              SyscallSucceeds());
+  EXPECT_EQ(addr.nl_groups, 0);
+}
+
+// Joining a multicast group that no family registered fails.
+TEST(NetlinkGenericTest, JoinUnknownMulticastGroup) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_GENERIC));
+
+  int group = 0x7fff;
+  EXPECT_THAT(setsockopt(fd.get(), SOL_NETLINK, NETLINK_ADD_MEMBERSHIP, &group,
+                         sizeof(group)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// A WireGuard interface created through NETLINK_ROUTE is configured and
+// queried through the "wireguard" family.
+TEST(NetlinkGenericTest, WireGuardDevice) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  SKIP_IF(IsRunningWithHostinet());
+
+  constexpr char kName[] = "wg_test";
+  FileDescriptor rtfd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_ROUTE));
+  NlMessage link(RTM_NEWLINK, NLM_F_ACK | NLM_F_CREATE | NLM_F_EXCL, 1);
+  struct ifinfomsg ifm = {};
+  ifm.ifi_family = AF_UNSPEC;
+  link.Append(&ifm, sizeof(ifm));
+  link.AddString(IFLA_IFNAME, kName);
+  link.BeginNested(IFLA_LINKINFO);
+  link.AddString(IFLA_INFO_KIND, "wireguard");
+  link.EndNested();
+  PosixError err = NetlinkRequestAckOrError(rtfd, 1, link.data(), link.size());
+  // Linux hosts may not have the wireguard module.
+  SKIP_IF(!IsRunningOnGvisor() && err.errno_value() == EOPNOTSUPP);
+  ASSERT_NO_ERRNO(err);
+  const int index = if_nametoindex(kName);
+  ASSERT_NE(index, 0);
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_GENERIC));
+  const uint16_t id =
+      ASSERT_NO_ERRNO_AND_VALUE(ResolveFamily(fd, WG_GENL_NAME));
+
+  uint8_t private_key[WG_KEY_LEN];
+  for (int i = 0; i < WG_KEY_LEN; i++) {
+    private_key[i] = i + 1;
+  }
+  private_key[0] &= 248;
+  private_key[31] = (private_key[31] & 127) | 64;
+  uint8_t peer_key[WG_KEY_LEN];
+  memset(peer_key, 0x42, sizeof(peer_key));
+  const uint16_t port = 51820;
+  const uint8_t allowed_ip[4] = {10, 0, 0, 2};
+  const uint8_t cidr = 32;
+  const uint16_t family = AF_INET;
+
+  NlMessage set(id, NLM_F_ACK, 2);
+  set.AddGenlHeader(WG_CMD_SET_DEVICE, WG_GENL_VERSION);
+  set.AddString(WGDEVICE_A_IFNAME, kName);
+  set.AddAttr(WGDEVICE_A_PRIVATE_KEY, private_key, sizeof(private_key));
+  set.AddAttr(WGDEVICE_A_LISTEN_PORT, &port, sizeof(port));
+  set.BeginNested(WGDEVICE_A_PEERS);
+  set.BeginNested(0);
+  set.AddAttr(WGPEER_A_PUBLIC_KEY, peer_key, sizeof(peer_key));
+  set.BeginNested(WGPEER_A_ALLOWEDIPS);
+  set.BeginNested(0);
+  set.AddAttr(WGALLOWEDIP_A_FAMILY, &family, sizeof(family));
+  set.AddAttr(WGALLOWEDIP_A_IPADDR, allowed_ip, sizeof(allowed_ip));
+  set.AddAttr(WGALLOWEDIP_A_CIDR_MASK, &cidr, sizeof(cidr));
+  set.EndNested();
+  set.EndNested();
+  set.EndNested();
+  set.EndNested();
+  EXPECT_NO_ERRNO(NetlinkRequestAckOrError(fd, 2, set.data(), set.size()));
+
+  NlMessage get(id, NLM_F_DUMP, 3);
+  get.AddGenlHeader(WG_CMD_GET_DEVICE, WG_GENL_VERSION);
+  get.AddAttr(WGDEVICE_A_IFINDEX, &index, sizeof(index));
+  bool found_key = false;
+  bool found_port = false;
+  bool found_peer = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, get.data(), get.size(),
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != id) {
+          return;
+        }
+        for (const struct nlattr* attr : GenlAttrs(hdr)) {
+          switch (attr->nla_type & NLA_TYPE_MASK) {
+            case WGDEVICE_A_PRIVATE_KEY:
+              found_key = memcmp(AttrData(attr), private_key,
+                                 sizeof(private_key)) == 0;
+              break;
+            case WGDEVICE_A_LISTEN_PORT:
+              found_port =
+                  *reinterpret_cast<const uint16_t*>(AttrData(attr)) == port;
+              break;
+            case WGDEVICE_A_PEERS: {
+              // The public key is the first attribute of the peer.
+              const struct nlattr* peer =
+                  reinterpret_cast<const struct nlattr*>(AttrData(attr));
+              const struct nlattr* key =
+                  reinterpret_cast<const struct nlattr*>(AttrData(peer));
+              found_peer = (key->nla_type & NLA_TYPE_MASK) ==
+                               WGPEER_A_PUBLIC_KEY &&
+                           memcmp(AttrData(key), peer_key,
+                                  sizeof(peer_key)) == 0;
+              break;
+            }
+          }
+        }
+      },
+      false));
+  EXPECT_TRUE(found_key);
+  EXPECT_TRUE(found_port);
+  EXPECT_TRUE(found_peer);
+
+  // Remove the interface.
+  NlMessage del(RTM_DELLINK, NLM_F_ACK, 4);
+  ifm.ifi_index = index;
+  del.Append(&ifm, sizeof(ifm));
+  EXPECT_NO_ERRNO(NetlinkRequestAckOrError(rtfd, 4, del.data(), del.size()));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -0,0 +1,168 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <arpa/inet.h>
+#include <linux/netfilter.h>
+#include <linux/netfilter/nf_tables.h>
+#include <linux/netfilter/nfnetlink.h>
+#include <linux/netlink.h>
+#include <sys/socket.h>
+
+#include <cstdint>
+#include <cstring>
+#include <string>
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+// Tests for NETLINK_NETFILTER sockets using the nf_tables subsystem.
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+constexpr char kTableName[] = "gvisor_test";
+
+// NfMessage builds a buffer of nfnetlink messages.
+class NfMessage {
+ public:
+  // Begin starts a new message.
+  void Begin(uint16_t type, uint16_t flags, uint8_t family, uint32_t seq,
+             uint16_t res_id = 0) {
+    start_ = buf_.size();
+    struct nlmsghdr hdr = {};
+    hdr.nlmsg_type = type;
+    hdr.nlmsg_flags = NLM_F_REQUEST | flags;
+    hdr.nlmsg_seq = seq;
+    Append(&hdr, sizeof(hdr));
+    struct nfgenmsg nfg = {};
+    nfg.nfgen_family = family;
+    nfg.version = NFNETLINK_V0;
+    nfg.res_id = htons(res_id);
+    Append(&nfg, sizeof(nfg));
+    Finish();
+  }
+
+  // AddString adds a string attribute to the current message.
+  void AddString(uint16_t type, const std::string& s) {
+    struct nlattr attr = {};
+    attr.nla_type = type;
+    attr.nla_len = NLA_HDRLEN + s.size() + 1;
+    Append(&attr, sizeof(attr));
+    Append(s.c_str(), s.size() + 1);
+    buf_.resize(NLMSG_ALIGN(buf_.size()));
+    Finish();
+  }
+
+  void* data() { return buf_.data(); }
+  size_t size() const { return buf_.size(); }
+
+ private:
+  void Append(const void* p, size_t len) {
+    const char* c = reinterpret_cast<const char*>(p);
+    buf_.insert(buf_.end(), c, c + len);
+  }
+
+  // Finish updates the length of the current message.
+  void Finish() {
+    struct nlmsghdr* hdr =
+        reinterpret_cast<struct nlmsghdr*>(buf_.data() + start_);
+    hdr->nlmsg_len = buf_.size() - start_;
+  }
+
+  std::vector<char> buf_;
+  size_t start_ = 0;
+};
+
+uint16_t NftMsgType(uint16_t msg) { return NFNL_SUBSYS_NFTABLES << 8 | msg; }
+
+// BatchRequest wraps a single nf_tables message of the given type, acked, in a
+// batch.
+NfMessage BatchRequest(uint16_t type, uint16_t flags, uint32_t seq) {
+  NfMessage m;
+  m.Begin(NFNL_MSG_BATCH_BEGIN, 0, AF_UNSPEC, seq, NFNL_SUBSYS_NFTABLES);
+  m.Begin(NftMsgType(type), NLM_F_ACK | flags, NFPROTO_IPV4, seq + 1);
+  m.AddString(NFTA_TABLE_NAME, kTableName);
+  m.Begin(NFNL_MSG_BATCH_END, 0, AF_UNSPEC, seq + 2, NFNL_SUBSYS_NFTABLES);
+  return m;
+}
+
+// Tables can be created within a batch, queried, and deleted.
+TEST(NetlinkNetfilterTest, CreateGetDeleteTable) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_NETFILTER));
+
+  NfMessage create = BatchRequest(NFT_MSG_NEWTABLE, NLM_F_CREATE, 1);
+  EXPECT_NO_ERRNO(
+      NetlinkRequestAckOrError(fd, 2, create.data(), create.size()));
+
+  NfMessage get;
+  get.Begin(NftMsgType(NFT_MSG_GETTABLE), 0, NFPROTO_IPV4, 4);
+  get.AddString(NFTA_TABLE_NAME, kTableName);
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponseSingle(
+      fd, get.data(), get.size(), [&](const struct nlmsghdr* hdr) {
+        EXPECT_EQ(hdr->nlmsg_type, NftMsgType(NFT_MSG_NEWTABLE));
+        const struct nfgenmsg* nfg =
+            reinterpret_cast<const struct nfgenmsg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(nfg->nfgen_family, NFPROTO_IPV4);
+        const struct nlattr* attr = reinterpret_cast<const struct nlattr*>(
+            reinterpret_cast<const char*>(nfg) + NLMSG_ALIGN(sizeof(*nfg)));
+        EXPECT_EQ(attr->nla_type & NLA_TYPE_MASK, NFTA_TABLE_NAME);
+        EXPECT_STREQ(reinterpret_cast<const char*>(attr) + NLA_HDRLEN,
+                     kTableName);
+        found = true;
+      }));
+  EXPECT_TRUE(found);
+
+  // Creating the table again with NLM_F_EXCL fails.
+  NfMessage excl = BatchRequest(NFT_MSG_NEWTABLE, NLM_F_CREATE | NLM_F_EXCL, 5);
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, 6, excl.data(), excl.size()),
+              PosixErrorIs(EEXIST, ::testing::_));
+
+  NfMessage del = BatchRequest(NFT_MSG_DELTABLE, 0, 8);
+  EXPECT_NO_ERRNO(NetlinkRequestAckOrError(fd, 9, del.data(), del.size()));
+
+  NfMessage get_deleted;
+  get_deleted.Begin(NftMsgType(NFT_MSG_GETTABLE), NLM_F_ACK, NFPROTO_IPV4, 11);
+  get_deleted.AddString(NFTA_TABLE_NAME, kTableName);
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, 11, get_deleted.data(),
+                                       get_deleted.size()),
+              PosixErrorIs(ENOENT, ::testing::_));
+}
+
+// Deleting a table that doesn't exist fails.
+TEST(NetlinkNetfilterTest, DeleteMissingTable) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_NETFILTER));
+
+  NfMessage del = BatchRequest(NFT_MSG_DELTABLE, 0, 1);
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, 2, del.data(), del.size()),
+              PosixErrorIs(ENOENT, ::testing::_));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
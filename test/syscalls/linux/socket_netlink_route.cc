@@ -17,7 +17,11 @@
 #include <ifaddrs.h>
 #include <linux/fib_rules.h>
 #include <linux/if.h>
+#include <linux/if_ether.h>
+#include <linux/if_link.h>
+#include <linux/neighbour.h>
 #include <linux/netlink.h>
+#include <linux/pkt_sched.h>
 #include <linux/rtnetlink.h>
 #include <linux/veth.h>
 #include <string.h>
@@ -1299,10 +1303,11 @@ TEST_P(NetlinkRouteIpInvariantTest, DeleteRoute) {
 }
 
 TEST_P(NetlinkRouteIpInvariantTest, AddAndRemoveRoute) {
-  // Gvisor does not support `RTM_NEWROUTE` or `RTM_DELROUTE`.
-  SKIP_IF(IsRunningOnGvisor() && GvisorPlatform() != Platform::kStarnix);
   // CAP_NET_ADMIN is required to modify the routing table.
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  SKIP_IF(IsRunningWithHostinet());
+  // Routes are not savable.
+  DisableSave ds;
 
   // Based on the test parameter, build an IPv4 or IPv6 destination subnet.
   int family = GetParam();
@@ -1351,8 +1356,7 @@ TEST_P(NetlinkRouteIpInvariantTest, AddAndRemoveRoute) {
 
 // GetRuleDump tests a RTM_GETRULE + NLM_F_DUMP request.
 TEST(NetlinkRouteTest, GetRuleDump) {
-  // Gvisor does not support `RTM_GETRULE`
-  SKIP_IF(IsRunningOnGvisor() && GvisorPlatform() != Platform::kStarnix);
+  SKIP_IF(IsRunningWithHostinet());
 
   FileDescriptor fd =
       ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_ROUTE));
@@ -1406,10 +1410,11 @@ TEST(NetlinkRouteTest, GetRuleDump) {
 }
 
 TEST_P(NetlinkRouteIpInvariantTest, AddAndRemoveRule) {
-  // Gvisor does not support `RTM_NEWRULE` or `RTM_DELRULE`.
-  SKIP_IF(IsRunningOnGvisor() && GvisorPlatform() != Platform::kStarnix);
   // CAP_NET_ADMIN is required to modify the rule table.
   SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  SKIP_IF(IsRunningWithHostinet());
+  // Rules are not savable.
+  DisableSave ds;
 
   // Based on the test parameter, build an IPv4 or IPv6 destination subnet.
   int family = GetParam();
@@ -1787,6 +1792,226 @@ TEST(NetlinkRouteTest, VethAdd) {
   linkinfo->rta_len = (uint64_t)NLMSG_TAIL(&req.hdr) - (uint64_t)linkinfo;
   EXPECT_NO_ERRNO(NetlinkRequestAckOrError(fd, kSeq, &req, req.hdr.nlmsg_len));
 }
+
+TEST(NetlinkRouteTest, VxlanAddAndFDB) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  SKIP_IF(IsRunningWithHostinet());
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_ROUTE));
+
+  struct link_request {
+    struct nlmsghdr hdr;
+    struct ifinfomsg ifm;
+    char buf[1024];
+  };
+
+  struct link_request lreq = {};
+  lreq.hdr.nlmsg_len = NLMSG_LENGTH(sizeof(struct ifinfomsg));
+  lreq.hdr.nlmsg_type = RTM_NEWLINK;
+  lreq.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_ACK | NLM_F_CREATE;
+  lreq.hdr.nlmsg_seq = kSeq;
+  lreq.ifm.ifi_family = AF_UNSPEC;
+
+  const char vxlan_name[] = "vxlan_test";
+  addattr(&lreq.hdr, sizeof(lreq), IFLA_IFNAME, vxlan_name,
+          strlen(vxlan_name));
+
+  struct rtattr* linkinfo = NLMSG_TAIL(&lreq.hdr);
+  {
+    addattr(&lreq.hdr, sizeof(lreq), IFLA_LINKINFO, nullptr, 0);
+    addattr(&lreq.hdr, sizeof(lreq), IFLA_INFO_KIND, "vxlan", 5);
+
+    struct rtattr* vxlan_data = NLMSG_TAIL(&lreq.hdr);
+    {
+      addattr(&lreq.hdr, sizeof(lreq), IFLA_INFO_DATA, nullptr, 0);
+      uint32_t vni = 42;
+      addattr(&lreq.hdr, sizeof(lreq), IFLA_VXLAN_ID, &vni, sizeof(vni));
+      uint16_t dst_port = htons(4789);
+      addattr(&lreq.hdr, sizeof(lreq), IFLA_VXLAN_PORT, &dst_port,
+              sizeof(dst_port));
+    }
+    vxlan_data->rta_len =
+        (uint64_t)NLMSG_TAIL(&lreq.hdr) - (uint64_t)vxlan_data;
+  }
+  linkinfo->rta_len = (uint64_t)NLMSG_TAIL(&lreq.hdr) - (uint64_t)linkinfo;
+  ASSERT_NO_ERRNO(
+      NetlinkRequestAckOrError(fd, kSeq, &lreq, lreq.hdr.nlmsg_len));
+
+  int index = 0;
+  for (const Link& link : ASSERT_NO_ERRNO_AND_VALUE(DumpLinks())) {
+    if (link.name == vxlan_name) {
+      index = link.index;
+    }
+  }
+  ASSERT_NE(index, 0);
+
+  struct neigh_request {
+    struct nlmsghdr hdr;
+    struct ndmsg ndm;
+    char buf[256];
+  };
+
+  const uint8_t lladdr[ETH_ALEN] = {0x02, 0x00, 0x00, 0x00, 0x00, 0x01};
+  struct in_addr dst;
+  ASSERT_EQ(inet_pton(AF_INET, "10.0.0.2", &dst), 1);
+
+  auto fdb_request = [&](uint16_t type, uint16_t flags) {
+    struct neigh_request nreq = {};
+    nreq.hdr.nlmsg_len = NLMSG_LENGTH(sizeof(struct ndmsg));
+    nreq.hdr.nlmsg_type = type;
+    nreq.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_ACK | flags;
+    nreq.hdr.nlmsg_seq = kSeq;
+    nreq.ndm.ndm_family = AF_BRIDGE;
+    nreq.ndm.ndm_ifindex = index;
+    nreq.ndm.ndm_state = NUD_PERMANENT;
+    nreq.ndm.ndm_flags = NTF_SELF;
+    addattr(&nreq.hdr, sizeof(nreq), NDA_LLADDR, lladdr, sizeof(lladdr));
+    addattr(&nreq.hdr, sizeof(nreq), NDA_DST, &dst, sizeof(dst));
+    return nreq;
+  };
+
+  struct neigh_request nreq =
+      fdb_request(RTM_NEWNEIGH, NLM_F_CREATE | NLM_F_EXCL);
+  ASSERT_NO_ERRNO(
+      NetlinkRequestAckOrError(fd, kSeq, &nreq, nreq.hdr.nlmsg_len));
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, kSeq, &nreq, nreq.hdr.nlmsg_len),
+              PosixErrorIs(EEXIST, _));
+
+  struct neigh_request dump = {};
+  dump.hdr.nlmsg_len = NLMSG_LENGTH(sizeof(struct ndmsg));
+  dump.hdr.nlmsg_type = RTM_GETNEIGH;
+  dump.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  dump.hdr.nlmsg_seq = kSeq;
+  dump.ndm.ndm_family = AF_BRIDGE;
+  dump.ndm.ndm_ifindex = index;
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &dump, dump.hdr.nlmsg_len,
+      [&](const struct nlmsghdr* hdr) {
+        EXPECT_THAT(hdr->nlmsg_type, AnyOf(Eq(RTM_NEWNEIGH), Eq(NLMSG_DONE)));
+        if (hdr->nlmsg_type == NLMSG_DONE) {
+          return;
+        }
+        ASSERT_GE(hdr->nlmsg_len, NLMSG_SPACE(sizeof(struct ndmsg)));
+        const struct ndmsg* ndm =
+            reinterpret_cast<const struct ndmsg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(ndm->ndm_family, AF_BRIDGE);
+        EXPECT_EQ(ndm->ndm_ifindex, index);
+
+        bool lladdr_matches = false;
+        bool dst_matches = false;
+        int len = NLMSG_PAYLOAD(hdr, sizeof(struct ndmsg));
+        for (const struct rtattr* rta = NDA_RTA(ndm); RTA_OK(rta, len);
+             rta = RTA_NEXT(rta, len)) {
+          if (rta->rta_type == NDA_LLADDR &&
+              RTA_PAYLOAD(rta) == sizeof(lladdr)) {
+            lladdr_matches = memcmp(RTA_DATA(rta), lladdr, sizeof(lladdr)) == 0;
+          }
+          if (rta->rta_type == NDA_DST && RTA_PAYLOAD(rta) == sizeof(dst)) {
+            dst_matches = memcmp(RTA_DATA(rta), &dst, sizeof(dst)) == 0;
+          }
+        }
+        if (lladdr_matches && dst_matches) {
+          EXPECT_EQ(ndm->ndm_state, NUD_PERMANENT);
+          found = true;
+        }
+      },
+      false));
+  EXPECT_TRUE(found);
+
+  nreq = fdb_request(RTM_DELNEIGH, 0);
+  ASSERT_NO_ERRNO(
+      NetlinkRequestAckOrError(fd, kSeq, &nreq, nreq.hdr.nlmsg_len));
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, kSeq, &nreq, nreq.hdr.nlmsg_len),
+              PosixErrorIs(ENOENT, _));
+}
+
+TEST(NetlinkRouteTest, AddDumpAndDeleteQDisc) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  SKIP_IF(IsRunningWithHostinet());
+
+  Link loopback_link = ASSERT_NO_ERRNO_AND_VALUE(LoopbackLink());
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_ROUTE));
+
+  struct qdisc_request {
+    struct nlmsghdr hdr;
+    struct tcmsg tcm;
+    char buf[256];
+  };
+
+  auto qdisc_request = [&](uint16_t type, uint16_t flags) {
+    struct qdisc_request req = {};
+    req.hdr.nlmsg_len = NLMSG_LENGTH(sizeof(struct tcmsg));
+    req.hdr.nlmsg_type = type;
+    req.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_ACK | flags;
+    req.hdr.nlmsg_seq = kSeq;
+    req.tcm.tcm_family = AF_UNSPEC;
+    req.tcm.tcm_ifindex = loopback_link.index;
+    req.tcm.tcm_handle = 0x10000;
+    req.tcm.tcm_parent = TC_H_ROOT;
+    addattr(&req.hdr, sizeof(req), TCA_KIND, "fq_codel", 9);
+
+    struct rtattr* options = NLMSG_TAIL(&req.hdr);
+    addattr(&req.hdr, sizeof(req), TCA_OPTIONS, nullptr, 0);
+    uint32_t limit = 100;
+    addattr(&req.hdr, sizeof(req), TCA_FQ_CODEL_LIMIT, &limit, sizeof(limit));
+    options->rta_len = (uint64_t)NLMSG_TAIL(&req.hdr) - (uint64_t)options;
+    return req;
+  };
+
+  struct qdisc_request req =
+      qdisc_request(RTM_NEWQDISC, NLM_F_CREATE | NLM_F_EXCL);
+  ASSERT_NO_ERRNO(NetlinkRequestAckOrError(fd, kSeq, &req, req.hdr.nlmsg_len));
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, kSeq, &req, req.hdr.nlmsg_len),
+              PosixErrorIs(EEXIST, _));
+
+  struct qdisc_request dump = {};
+  dump.hdr.nlmsg_len = NLMSG_LENGTH(sizeof(struct tcmsg));
+  dump.hdr.nlmsg_type = RTM_GETQDISC;
+  dump.hdr.nlmsg_flags = NLM_F_REQUEST | NLM_F_DUMP;
+  dump.hdr.nlmsg_seq = kSeq;
+  dump.tcm.tcm_family = AF_UNSPEC;
+
+  bool found = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponse(
+      fd, &dump, dump.hdr.nlmsg_len,
+      [&](const struct nlmsghdr* hdr) {
+        EXPECT_THAT(hdr->nlmsg_type, AnyOf(Eq(RTM_NEWQDISC), Eq(NLMSG_DONE)));
+        if (hdr->nlmsg_type == NLMSG_DONE) {
+          return;
+        }
+        ASSERT_GE(hdr->nlmsg_len, NLMSG_SPACE(sizeof(struct tcmsg)));
+        const struct tcmsg* tcm =
+            reinterpret_cast<const struct tcmsg*>(NLMSG_DATA(hdr));
+        if (tcm->tcm_ifindex != loopback_link.index ||
+            tcm->tcm_parent != TC_H_ROOT) {
+          return;
+        }
+        int len = NLMSG_PAYLOAD(hdr, sizeof(struct tcmsg));
+        for (const struct rtattr* rta = reinterpret_cast<const struct rtattr*>(
+                 reinterpret_cast<const char*>(tcm) +
+                 NLMSG_ALIGN(sizeof(struct tcmsg)));
+             RTA_OK(rta, len); rta = RTA_NEXT(rta, len)) {
+          if (rta->rta_type == TCA_KIND &&
+              strcmp(reinterpret_cast<const char*>(RTA_DATA(rta)),
+                     "fq_codel") == 0) {
+            EXPECT_EQ(tcm->tcm_handle, 0x10000u);
+            found = true;
+          }
+        }
+      },
+      false));
+  EXPECT_TRUE(found);
+
+  req = qdisc_request(RTM_DELQDISC, 0);
+  ASSERT_NO_ERRNO(NetlinkRequestAckOrError(fd, kSeq, &req, req.hdr.nlmsg_len));
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, kSeq, &req, req.hdr.nlmsg_len),
+              PosixErrorIs(ENOENT, _));
+}
+
 }  // namespace
 
 }  // namespace testing
@@ -0,0 +1,342 @@
+// Copyright 2024 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include <arpa/inet.h>
+#include <linux/inet_diag.h>
+#include <linux/netlink.h>
+#include <linux/sock_diag.h>
+#include <linux/unix_diag.h>
+#include <netinet/in.h>
+#include <netinet/tcp.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/un.h>
+
+#include <cstdint>
+#include <cstring>
+#include <vector>
+
+#include "gtest/gtest.h"
+#include "test/syscalls/linux/socket_netlink_util.h"
+#include "test/util/capability_util.h"
+#include "test/util/file_descriptor.h"
+#include "test/util/posix_error.h"
+#include "test/util/socket_util.h"
+#include "test/util/test_util.h"
+
+// Tests for NETLINK_SOCK_DIAG sockets.
+
+namespace gvisor {
+namespace testing {
+
+namespace {
+
+// InetDiagRequest is an inet_diag request with optional bytecode.
+struct InetDiagRequest {
+  struct nlmsghdr hdr;
+  struct inet_diag_req_v2 req;
+  struct nlattr bc_attr;
+  struct inet_diag_bc_op bc[4];
+};
+
+// NewInetDiagRequest returns a request for TCP sockets of the given family.
+InetDiagRequest NewInetDiagRequest(int family, uint16_t type, uint16_t flags,
+                                   uint32_t seq) {
+  InetDiagRequest r = {};
+  r.hdr.nlmsg_len = NLMSG_LENGTH(sizeof(r.req));
+  r.hdr.nlmsg_type = type;
+  r.hdr.nlmsg_flags = NLM_F_REQUEST | flags;
+  r.hdr.nlmsg_seq = seq;
+  r.req.sdiag_family = family;
+  r.req.sdiag_protocol = IPPROTO_TCP;
+  r.req.idiag_states = ~0u;
+  r.req.id.idiag_cookie[0] = INET_DIAG_NOCOOKIE;
+  r.req.id.idiag_cookie[1] = INET_DIAG_NOCOOKIE;
+  return r;
+}
+
+// Inode returns the inode number of the socket fd.
+PosixErrorOr<uint32_t> Inode(int fd) {
+  struct stat st;
+  RETURN_ERROR_IF_SYSCALL_FAIL(fstat(fd, &st));
+  return st.st_ino;
+}
+
+// LoopbackListener returns a TCP socket listening on an ephemeral port of
+// 127.0.0.1, and its port in host byte order.
+PosixErrorOr<FileDescriptor> LoopbackListener(uint16_t* port) {
+  ASSIGN_OR_RETURN_ERRNO(FileDescriptor fd,
+                         Socket(AF_INET, SOCK_STREAM, IPPROTO_TCP));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  RETURN_ERROR_IF_SYSCALL_FAIL(
+      bind(fd.get(), reinterpret_cast<struct sockaddr*>(&addr), sizeof(addr)));
+  RETURN_ERROR_IF_SYSCALL_FAIL(listen(fd.get(), 5));
+  socklen_t addrlen = sizeof(addr);
+  RETURN_ERROR_IF_SYSCALL_FAIL(getsockname(
+      fd.get(), reinterpret_cast<struct sockaddr*>(&addr), &addrlen));
+  *port = ntohs(addr.sin_port);
+  return fd;
+}
+
+// DumpInet dumps the sockets matching req, and returns their descriptions.
+PosixErrorOr<std::vector<struct inet_diag_msg>> DumpInet(
+    const FileDescriptor& fd, InetDiagRequest* req) {
+  std::vector<struct inet_diag_msg> msgs;
+  RETURN_IF_ERRNO(NetlinkRequestResponse(
+      fd, req, req->hdr.nlmsg_len,
+      [&](const struct nlmsghdr* hdr) {
+        if (hdr->nlmsg_type != SOCK_DIAG_BY_FAMILY) {
+          return;
+        }
+        msgs.push_back(
+            *reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr)));
+      },
+      false));
+  return msgs;
+}
+
+// A listening TCP socket is reported with its port, state and inode.
+TEST(NetlinkSockDiagTest, TCPListener) {
+  SKIP_IF(IsRunningWithHostinet());
+
+  uint16_t port;
+  FileDescriptor listener = ASSERT_NO_ERRNO_AND_VALUE(LoopbackListener(&port));
+  const uint32_t ino = ASSERT_NO_ERRNO_AND_VALUE(Inode(listener.get()));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req =
+      NewInetDiagRequest(AF_INET, SOCK_DIAG_BY_FAMILY, NLM_F_DUMP, 1);
+  req.req.idiag_states = 1 << TCP_LISTEN;
+  std::vector<struct inet_diag_msg> msgs =
+      ASSERT_NO_ERRNO_AND_VALUE(DumpInet(fd, &req));
+
+  bool found = false;
+  for (const struct inet_diag_msg& msg : msgs) {
+    EXPECT_EQ(msg.idiag_family, AF_INET);
+    EXPECT_EQ(msg.idiag_state, TCP_LISTEN);
+    if (msg.idiag_inode == ino) {
+      found = true;
+      EXPECT_EQ(ntohs(msg.id.idiag_sport), port);
+      EXPECT_EQ(msg.id.idiag_src[0], htonl(INADDR_LOOPBACK));
+      EXPECT_EQ(msg.idiag_uid, getuid());
+    }
+  }
+  EXPECT_TRUE(found);
+}
+
+// The bytecode of a dump request filters the reported sockets.
+TEST(NetlinkSockDiagTest, Bytecode) {
+  SKIP_IF(IsRunningWithHostinet());
+
+  uint16_t port1, port2;
+  FileDescriptor listener1 =
+      ASSERT_NO_ERRNO_AND_VALUE(LoopbackListener(&port1));
+  FileDescriptor listener2 =
+      ASSERT_NO_ERRNO_AND_VALUE(LoopbackListener(&port2));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req =
+      NewInetDiagRequest(AF_INET, SOCK_DIAG_BY_FAMILY, NLM_F_DUMP, 1);
+  // sport >= port1 && sport <= port1.
+  req.bc[0] = {INET_DIAG_BC_S_GE, 8, 20};
+  req.bc[1] = {0, 0, port1};
+  req.bc[2] = {INET_DIAG_BC_S_LE, 8, 12};
+  req.bc[3] = {0, 0, port1};
+  req.bc_attr.nla_type = INET_DIAG_REQ_BYTECODE;
+  req.bc_attr.nla_len = NLA_HDRLEN + sizeof(req.bc);
+  req.hdr.nlmsg_len = sizeof(req);
+  std::vector<struct inet_diag_msg> msgs =
+      ASSERT_NO_ERRNO_AND_VALUE(DumpInet(fd, &req));
+
+  ASSERT_EQ(msgs.size(), 1);
+  EXPECT_EQ(ntohs(msgs[0].id.idiag_sport), port1);
+}
+
+// Invalid bytecode is rejected.
+TEST(NetlinkSockDiagTest, InvalidBytecode) {
+  SKIP_IF(IsRunningWithHostinet());
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewInetDiagRequest(
+      AF_INET, SOCK_DIAG_BY_FAMILY, NLM_F_DUMP | NLM_F_ACK, 1);
+  // The comparison is missing its port.
+  req.bc[0] = {INET_DIAG_BC_S_GE, 4, 8};
+  req.bc_attr.nla_type = INET_DIAG_REQ_BYTECODE;
+  req.bc_attr.nla_len = NLA_HDRLEN + sizeof(req.bc[0]);
+  req.hdr.nlmsg_len = offsetof(InetDiagRequest, bc) + sizeof(req.bc[0]);
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, 1, &req, req.hdr.nlmsg_len),
+              PosixErrorIs(EINVAL, ::testing::_));
+}
+
+// A single socket is looked up by its addresses and cookie, and TCP_INFO is
+// reported on request.
+TEST(NetlinkSockDiagTest, ExactLookup) {
+  SKIP_IF(IsRunningWithHostinet());
+
+  uint16_t port;
+  FileDescriptor listener = ASSERT_NO_ERRNO_AND_VALUE(LoopbackListener(&port));
+  const uint32_t ino = ASSERT_NO_ERRNO_AND_VALUE(Inode(listener.get()));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req = NewInetDiagRequest(AF_INET, SOCK_DIAG_BY_FAMILY, 0, 1);
+  req.req.idiag_ext = 1 << (INET_DIAG_INFO - 1);
+  req.req.id.idiag_sport = htons(port);
+  req.req.id.idiag_src[0] = htonl(INADDR_LOOPBACK);
+
+  uint32_t cookie[2] = {};
+  bool found_info = false;
+  ASSERT_NO_ERRNO(NetlinkRequestResponseSingle(
+      fd, &req, req.hdr.nlmsg_len, [&](const struct nlmsghdr* hdr) {
+        ASSERT_EQ(hdr->nlmsg_type, SOCK_DIAG_BY_FAMILY);
+        const struct inet_diag_msg* msg =
+            reinterpret_cast<const struct inet_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->idiag_inode, ino);
+        memcpy(cookie, msg->id.idiag_cookie, sizeof(cookie));
+
+        const char* p = reinterpret_cast<const char*>(msg) +
+                        NLMSG_ALIGN(sizeof(*msg));
+        int len = hdr->nlmsg_len - NLMSG_LENGTH(sizeof(*msg));
+        while (len >= static_cast<int>(NLA_HDRLEN)) {
+          const struct nlattr* attr =
+              reinterpret_cast<const struct nlattr*>(p);
+          if (attr->nla_type == INET_DIAG_INFO) {
+            const struct tcp_info* info =
+                reinterpret_cast<const struct tcp_info*>(p + NLA_HDRLEN);
+            EXPECT_EQ(info->tcpi_state, TCP_LISTEN);
+            found_info = true;
+          }
+          p += NLA_ALIGN(attr->nla_len);
+          len -= NLA_ALIGN(attr->nla_len);
+        }
+      }));
+  EXPECT_TRUE(found_info);
+
+  // A stale cookie doesn't match the socket.
+  req.hdr.nlmsg_flags |= NLM_F_ACK;
+  req.hdr.nlmsg_seq = 2;
+  req.req.id.idiag_cookie[0] = cookie[0] + 1;
+  req.req.id.idiag_cookie[1] = cookie[1];
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, 2, &req, req.hdr.nlmsg_len),
+              PosixErrorIs(ESTALE, ::testing::_));
+}
+
+// SOCK_DESTROY aborts the connection of a TCP socket.
+TEST(NetlinkSockDiagTest, Destroy) {
+  SKIP_IF(!ASSERT_NO_ERRNO_AND_VALUE(HaveCapability(CAP_NET_ADMIN)));
+  SKIP_IF(IsRunningWithHostinet());
+
+  uint16_t port;
+  FileDescriptor listener = ASSERT_NO_ERRNO_AND_VALUE(LoopbackListener(&port));
+  FileDescriptor client =
+      ASSERT_NO_ERRNO_AND_VALUE(Socket(AF_INET, SOCK_STREAM, IPPROTO_TCP));
+  struct sockaddr_in addr = {};
+  addr.sin_family = AF_INET;
+  addr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+  addr.sin_port = htons(port);
+  ASSERT_THAT(connect(client.get(), reinterpret_cast<struct sockaddr*>(&addr),
+                      sizeof(addr)),
+              SyscallSucceeds());
+  FileDescriptor server =
+      ASSERT_NO_ERRNO_AND_VALUE(Accept(listener.get(), nullptr, nullptr));
+  struct sockaddr_in local = {};
+  socklen_t addrlen = sizeof(local);
+  ASSERT_THAT(getsockname(client.get(),
+                          reinterpret_cast<struct sockaddr*>(&local), &addrlen),
+              SyscallSucceeds());
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req =
+      NewInetDiagRequest(AF_INET, SOCK_DESTROY, NLM_F_ACK, 1);
+  req.req.id.idiag_sport = local.sin_port;
+  req.req.id.idiag_dport = htons(port);
+  req.req.id.idiag_src[0] = htonl(INADDR_LOOPBACK);
+  req.req.id.idiag_dst[0] = htonl(INADDR_LOOPBACK);
+  PosixError err = NetlinkRequestAckOrError(fd, 1, &req, req.hdr.nlmsg_len);
+  // Linux hosts may be built without CONFIG_INET_DIAG_DESTROY.
+  SKIP_IF(!IsRunningOnGvisor() && err.errno_value() == EOPNOTSUPP);
+  ASSERT_NO_ERRNO(err);
+
+  char c;
+  EXPECT_THAT(read(client.get(), &c, sizeof(c)),
+              SyscallFailsWithErrno(ECONNABORTED));
+}
+
+// Unix domain socket pairs are reported as each other's peer.
+TEST(NetlinkSockDiagTest, UnixPeer) {
+  int fds[2];
+  ASSERT_THAT(socketpair(AF_UNIX, SOCK_STREAM, 0, fds), SyscallSucceeds());
+  FileDescriptor a(fds[0]);
+  FileDescriptor b(fds[1]);
+  const uint32_t ino_a = ASSERT_NO_ERRNO_AND_VALUE(Inode(a.get()));
+  const uint32_t ino_b = ASSERT_NO_ERRNO_AND_VALUE(Inode(b.get()));
+
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  struct {
+    struct nlmsghdr hdr;
+    struct unix_diag_req req;
+  } req = {};
+  req.hdr.nlmsg_len = sizeof(req);
+  req.hdr.nlmsg_type = SOCK_DIAG_BY_FAMILY;
+  req.hdr.nlmsg_flags = NLM_F_REQUEST;
+  req.hdr.nlmsg_seq = 1;
+  req.req.sdiag_family = AF_UNIX;
+  req.req.udiag_states = ~0u;
+  req.req.udiag_ino = ino_a;
+  req.req.udiag_show = UDIAG_SHOW_PEER;
+  req.req.udiag_cookie[0] = INET_DIAG_NOCOOKIE;
+  req.req.udiag_cookie[1] = INET_DIAG_NOCOOKIE;
+
+  uint32_t peer = 0;
+  ASSERT_NO_ERRNO(NetlinkRequestResponseSingle(
+      fd, &req, sizeof(req), [&](const struct nlmsghdr* hdr) {
+        ASSERT_EQ(hdr->nlmsg_type, SOCK_DIAG_BY_FAMILY);
+        const struct unix_diag_msg* msg =
+            reinterpret_cast<const struct unix_diag_msg*>(NLMSG_DATA(hdr));
+        EXPECT_EQ(msg->udiag_ino, ino_a);
+        EXPECT_EQ(msg->udiag_type, SOCK_STREAM);
+        EXPECT_EQ(msg->udiag_state, TCP_ESTABLISHED);
+
+        const struct nlattr* attr = reinterpret_cast<const struct nlattr*>(
+            reinterpret_cast<const char*>(msg) + NLMSG_ALIGN(sizeof(*msg)));
+        if (hdr->nlmsg_len >= NLMSG_LENGTH(sizeof(*msg)) + NLA_HDRLEN &&
+            attr->nla_type == UNIX_DIAG_PEER) {
+          memcpy(&peer, reinterpret_cast<const char*>(attr) + NLA_HDRLEN,
+                 sizeof(peer));
+        }
+      }));
+  EXPECT_EQ(peer, ino_b);
+}
+
+// Requests for families without sock_diag support fail with ENOENT.
+TEST(NetlinkSockDiagTest, UnsupportedFamily) {
+  FileDescriptor fd =
+      ASSERT_NO_ERRNO_AND_VALUE(NetlinkBoundSocket(NETLINK_SOCK_DIAG));
+  InetDiagRequest req =
+      NewInetDiagRequest(AF_APPLETALK, SOCK_DIAG_BY_FAMILY, NLM_F_ACK, 1);
+  EXPECT_THAT(NetlinkRequestAckOrError(fd, 1, &req, req.hdr.nlmsg_len),
+              PosixErrorIs(ENOENT, ::testing::_));
+}
+
+}  // namespace
+
+}  // namespace testing
+}  // namespace gvisor
@@ -17,6 +17,7 @@
 #include <netinet/icmp6.h>
 #include <netinet/ip_icmp.h>
 
+#include <algorithm>
 #include <cerrno>
 #include <ctime>
 #include <utility>
@@ -25,6 +26,8 @@
 #ifdef __linux__
 #include <linux/errqueue.h>
 #include <linux/filter.h>
+#include <linux/net_tstamp.h>
+#include <linux/udp.h>
 #endif  // __linux__
 #include <netinet/in.h>
 #include <poll.h>
@@ -1605,6 +1608,116 @@ TEST_P(UdpSocketTest, SoNoCheck) {
 }
 
 #ifdef __linux__
+TEST_P(UdpSocketTest, UdpSegmentOffByDefault) {
+  int v = -1;
+  socklen_t optlen = sizeof(v);
+  ASSERT_THAT(getsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &v, &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(v, 0);
+  EXPECT_EQ(optlen, sizeof(v));
+}
+
+TEST_P(UdpSocketTest, UdpSegmentSetAndGet) {
+  int v = 1000;
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &v, sizeof(v)),
+              SyscallSucceeds());
+  v = -1;
+  socklen_t optlen = sizeof(v);
+  ASSERT_THAT(getsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &v, &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(v, 1000);
+
+  v = -1;
+  EXPECT_THAT(setsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &v, sizeof(v)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(UdpSocketTest, UdpSegmentSend) {
+  ASSERT_NO_ERRNO(BindLoopback());
+  constexpr int kSegmentSize = 100;
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &kSegmentSize,
+                         sizeof(kSegmentSize)),
+              SyscallSucceeds());
+
+  char buf[2 * kSegmentSize + kSegmentSize / 2];
+  RandomizeBuffer(buf, sizeof(buf));
+  ASSERT_THAT(sendto(sock_.get(), buf, sizeof(buf), 0, bind_addr_, addrlen_),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  // Each segment is received as a datagram of its own.
+  char received[sizeof(buf)];
+  for (size_t off = 0; off < sizeof(buf); off += kSegmentSize) {
+    size_t want = std::min(sizeof(buf) - off, size_t{kSegmentSize});
+    ASSERT_THAT(RetryEINTR(recv)(bind_.get(), received, sizeof(received), 0),
+                SyscallSucceedsWithValue(want));
+    EXPECT_EQ(memcmp(buf + off, received, want), 0);
+  }
+}
+
+TEST_P(UdpSocketTest, UdpSegmentControlMessage) {
+  ASSERT_NO_ERRNO(BindLoopback());
+  constexpr uint16_t kSegmentSize = 200;
+
+  char buf[2 * kSegmentSize + kSegmentSize / 4];
+  RandomizeBuffer(buf, sizeof(buf));
+  iovec iov = {};
+  iov.iov_base = buf;
+  iov.iov_len = sizeof(buf);
+  char control[CMSG_SPACE(sizeof(uint16_t))] = {};
+  msghdr msg = {};
+  msg.msg_name = bind_addr_;
+  msg.msg_namelen = addrlen_;
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  msg.msg_control = control;
+  msg.msg_controllen = sizeof(control);
+  cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+  cmsg->cmsg_level = SOL_UDP;
+  cmsg->cmsg_type = UDP_SEGMENT;
+  cmsg->cmsg_len = CMSG_LEN(sizeof(uint16_t));
+  memcpy(CMSG_DATA(cmsg), &kSegmentSize, sizeof(kSegmentSize));
+  ASSERT_THAT(RetryEINTR(sendmsg)(sock_.get(), &msg, 0),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  char received[sizeof(buf)];
+  for (size_t off = 0; off < sizeof(buf); off += kSegmentSize) {
+    size_t want = std::min(sizeof(buf) - off, size_t{kSegmentSize});
+    ASSERT_THAT(RetryEINTR(recv)(bind_.get(), received, sizeof(received), 0),
+                SyscallSucceedsWithValue(want));
+    EXPECT_EQ(memcmp(buf + off, received, want), 0);
+  }
+}
+
+TEST_P(UdpSocketTest, UdpSegmentTooManySegments) {
+  ASSERT_NO_ERRNO(BindLoopback());
+  constexpr int kSegmentSize = 10;
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_UDP, UDP_SEGMENT, &kSegmentSize,
+                         sizeof(kSegmentSize)),
+              SyscallSucceeds());
+
+  // Linux splits a send into at most 128 segments.
+  char buf[129 * kSegmentSize];
+  RandomizeBuffer(buf, sizeof(buf));
+  EXPECT_THAT(sendto(sock_.get(), buf, sizeof(buf), 0, bind_addr_, addrlen_),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(UdpSocketTest, UdpGroSetAndGet) {
+  int v = -1;
+  socklen_t optlen = sizeof(v);
+  ASSERT_THAT(getsockopt(bind_.get(), SOL_UDP, UDP_GRO, &v, &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(v, kSockOptOff);
+
+  v = kSockOptOn;
+  ASSERT_THAT(setsockopt(bind_.get(), SOL_UDP, UDP_GRO, &v, sizeof(v)),
+              SyscallSucceeds());
+  v = -1;
+  ASSERT_THAT(getsockopt(bind_.get(), SOL_UDP, UDP_GRO, &v, &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(v, kSockOptOn);
+}
+
 TEST_P(UdpSocketTest, ErrorQueue) {
   char cmsgbuf[CMSG_SPACE(sizeof(sock_extended_err))];
   msghdr msg;
@@ -1783,6 +1896,177 @@ TEST_P(UdpSocketTest, TimestampIoctlPersistence) {
   ASSERT_EQ(tv.tv_usec, tv2.tv_usec);
 }
 
+TEST_P(UdpSocketTest, SoTimestampingSetAndGet) {
+  int v = -1;
+  socklen_t optlen = sizeof(v);
+  ASSERT_THAT(
+      getsockopt(sock_.get(), SOL_SOCKET, SO_TIMESTAMPING, &v, &optlen),
+      SyscallSucceeds());
+  EXPECT_EQ(v, 0);
+
+  const int flags = SOF_TIMESTAMPING_TX_SOFTWARE | SOF_TIMESTAMPING_SOFTWARE |
+                    SOF_TIMESTAMPING_OPT_ID | SOF_TIMESTAMPING_OPT_TSONLY;
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_SOCKET, SO_TIMESTAMPING, &flags,
+                         sizeof(flags)),
+              SyscallSucceeds());
+  optlen = sizeof(v);
+  ASSERT_THAT(
+      getsockopt(sock_.get(), SOL_SOCKET, SO_TIMESTAMPING, &v, &optlen),
+      SyscallSucceeds());
+  EXPECT_EQ(v, flags);
+  EXPECT_EQ(optlen, sizeof(v));
+
+  const int invalid = 1 << 30;
+  EXPECT_THAT(setsockopt(sock_.get(), SOL_SOCKET, SO_TIMESTAMPING, &invalid,
+                         sizeof(invalid)),
+              SyscallFailsWithErrno(EINVAL));
+}
+
+// Reads a transmit timestamp from the error queue of fd and checks that it is
+// a software timestamp with OPT_ID key want_key and no payload.
+void RecvTxTimestamp(int fd, uint32_t want_key) {
+  char buf[8];
+  iovec iov = {buf, sizeof(buf)};
+  char cmsgbuf[CMSG_SPACE(sizeof(struct scm_timestamping)) +
+               CMSG_SPACE(sizeof(struct sock_extended_err) +
+                          sizeof(struct sockaddr_in6))];
+  msghdr msg = {};
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  msg.msg_control = cmsgbuf;
+  msg.msg_controllen = sizeof(cmsgbuf);
+  ASSERT_THAT(recvmsg(fd, &msg, MSG_ERRQUEUE), SyscallSucceedsWithValue(0));
+  EXPECT_EQ(msg.msg_flags & MSG_ERRQUEUE, MSG_ERRQUEUE);
+  EXPECT_EQ(msg.msg_namelen, 0);
+
+  struct cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+  ASSERT_NE(cmsg, nullptr);
+  ASSERT_EQ(cmsg->cmsg_level, SOL_SOCKET);
+  ASSERT_EQ(cmsg->cmsg_type, SCM_TIMESTAMPING);
+  ASSERT_EQ(cmsg->cmsg_len, CMSG_LEN(sizeof(struct scm_timestamping)));
+  struct scm_timestamping tss = {};
+  memcpy(&tss, CMSG_DATA(cmsg), sizeof(tss));
+  EXPECT_TRUE(tss.ts[0].tv_sec != 0 || tss.ts[0].tv_nsec != 0);
+
+  cmsg = CMSG_NXTHDR(&msg, cmsg);
+  ASSERT_NE(cmsg, nullptr);
+  EXPECT_TRUE(
+      (cmsg->cmsg_level == SOL_IP && cmsg->cmsg_type == IP_RECVERR) ||
+      (cmsg->cmsg_level == SOL_IPV6 && cmsg->cmsg_type == IPV6_RECVERR));
+  struct sock_extended_err ee = {};
+  memcpy(&ee, CMSG_DATA(cmsg), sizeof(ee));
+  EXPECT_EQ(ee.ee_errno, ENOMSG);
+  EXPECT_EQ(ee.ee_origin, SO_EE_ORIGIN_TIMESTAMPING);
+  EXPECT_EQ(ee.ee_info, SCM_TSTAMP_SND);
+  EXPECT_EQ(ee.ee_data, want_key);
+}
+
+TEST_P(UdpSocketTest, SoTimestampingTxSoftware) {
+  // TODO(gvisor.dev/issue/1202): SO_TIMESTAMPING is not supported by
+  // hostinet.
+  SKIP_IF(IsRunningWithHostinet());
+
+  ASSERT_NO_ERRNO(BindLoopback());
+  ASSERT_THAT(connect(sock_.get(), bind_addr_, addrlen_), SyscallSucceeds());
+
+  const int flags = SOF_TIMESTAMPING_TX_SOFTWARE | SOF_TIMESTAMPING_SOFTWARE |
+                    SOF_TIMESTAMPING_OPT_ID | SOF_TIMESTAMPING_OPT_TSONLY;
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_SOCKET, SO_TIMESTAMPING, &flags,
+                         sizeof(flags)),
+              SyscallSucceeds());
+
+  char buf[3] = {};
+  for (uint32_t key = 0; key < 2; key++) {
+    ASSERT_THAT(RetryEINTR(write)(sock_.get(), buf, sizeof(buf)),
+                SyscallSucceedsWithValue(sizeof(buf)));
+
+    struct pollfd pfd = {sock_.get(), 0, 0};
+    ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, /*timeout=*/1000),
+                SyscallSucceedsWithValue(1));
+    EXPECT_EQ(pfd.revents & POLLERR, POLLERR);
+
+    ASSERT_NO_FATAL_FAILURE(RecvTxTimestamp(sock_.get(), key));
+  }
+
+  // Timestamps aren't errors.
+  int err = -1;
+  socklen_t optlen = sizeof(err);
+  ASSERT_THAT(getsockopt(sock_.get(), SOL_SOCKET, SO_ERROR, &err, &optlen),
+              SyscallSucceeds());
+  EXPECT_EQ(err, 0);
+  char recv_buf[8];
+  EXPECT_THAT(recv(sock_.get(), recv_buf, sizeof(recv_buf), MSG_ERRQUEUE),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+TEST_P(UdpSocketTest, SoTxtimeSetAndGet) {
+  struct sock_txtime txtime = {};
+  socklen_t optlen = sizeof(txtime);
+  ASSERT_THAT(
+      getsockopt(sock_.get(), SOL_SOCKET, SO_TXTIME, &txtime, &optlen),
+      SyscallSucceeds());
+  EXPECT_EQ(txtime.clockid, 0);
+  EXPECT_EQ(txtime.flags, 0);
+
+  const struct sock_txtime want = {CLOCK_MONOTONIC, SOF_TXTIME_REPORT_ERRORS};
+  ASSERT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_TXTIME, &want, sizeof(want)),
+      SyscallSucceeds());
+  optlen = sizeof(txtime);
+  ASSERT_THAT(
+      getsockopt(sock_.get(), SOL_SOCKET, SO_TXTIME, &txtime, &optlen),
+      SyscallSucceeds());
+  EXPECT_EQ(txtime.clockid, want.clockid);
+  EXPECT_EQ(txtime.flags, want.flags);
+  EXPECT_EQ(optlen, sizeof(txtime));
+
+  const struct sock_txtime invalid = {CLOCK_MONOTONIC, 1 << 30};
+  EXPECT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_TXTIME, &invalid, sizeof(invalid)),
+      SyscallFailsWithErrno(EINVAL));
+}
+
+TEST_P(UdpSocketTest, ScmTxtime) {
+  // TODO(gvisor.dev/issue/1202): SO_TXTIME is not supported by hostinet.
+  SKIP_IF(IsRunningWithHostinet());
+
+  ASSERT_NO_ERRNO(BindLoopback());
+  ASSERT_THAT(connect(sock_.get(), bind_addr_, addrlen_), SyscallSucceeds());
+
+  char buf[3] = {};
+  iovec iov = {buf, sizeof(buf)};
+  char cmsgbuf[CMSG_SPACE(sizeof(uint64_t))] = {};
+  msghdr msg = {};
+  msg.msg_iov = &iov;
+  msg.msg_iovlen = 1;
+  msg.msg_control = cmsgbuf;
+  msg.msg_controllen = sizeof(cmsgbuf);
+  struct cmsghdr* cmsg = CMSG_FIRSTHDR(&msg);
+  cmsg->cmsg_level = SOL_SOCKET;
+  cmsg->cmsg_type = SCM_TXTIME;
+  cmsg->cmsg_len = CMSG_LEN(sizeof(uint64_t));
+  struct timespec now = {};
+  ASSERT_THAT(clock_gettime(CLOCK_MONOTONIC, &now), SyscallSucceeds());
+  const uint64_t txtime =
+      absl::ToInt64Nanoseconds(absl::DurationFromTimespec(now));
+  memcpy(CMSG_DATA(cmsg), &txtime, sizeof(txtime));
+
+  // SCM_TXTIME requires SO_TXTIME.
+  ASSERT_THAT(RetryEINTR(sendmsg)(sock_.get(), &msg, 0),
+              SyscallFailsWithErrno(EINVAL));
+
+  const struct sock_txtime opt = {CLOCK_MONOTONIC, 0};
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_SOCKET, SO_TXTIME, &opt, sizeof(opt)),
+              SyscallSucceeds());
+  ASSERT_THAT(RetryEINTR(sendmsg)(sock_.get(), &msg, 0),
+              SyscallSucceedsWithValue(sizeof(buf)));
+
+  // A departure time in the past doesn't delay the packet.
+  struct pollfd pfd = {bind_.get(), POLLIN, 0};
+  ASSERT_THAT(RetryEINTR(poll)(&pfd, 1, /*timeout=*/1000),
+              SyscallSucceedsWithValue(1));
+}
+
 TEST_P(UdpSocketTest, RecvBufLimitsEmptyRcvBuf) {
   // Discover minimum buffer size by setting it to zero.
   constexpr int kRcvBufSz = 0;
@@ -1905,8 +2189,6 @@ TEST_P(UdpSocketTest, RecvBufLimits) {
 
 #ifdef __linux__
 
-// TODO(gvisor.dev/2746): Support SO_ATTACH_FILTER/SO_DETACH_FILTER.
-// gVisor currently silently ignores attaching a filter.
 TEST_P(UdpSocketTest, SetSocketDetachFilter) {
   // Program generated using sudo tcpdump -i lo udp and port 1234 -dd
   struct sock_filter code[] = {
@@ -1935,11 +2217,158 @@ TEST_P(UdpSocketTest, SetSocketDetachFilter) {
       SyscallSucceeds());
 }
 
+TEST_P(UdpSocketTest, FilterDropsPackets) {
+  ASSERT_NO_ERRNO(BindLoopback());
+
+  // Drop every packet.
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_RET | BPF_K, 0),
+  };
+  struct sock_fprog bpf = {
+      .len = ABSL_ARRAYSIZE(code),
+      .filter = code,
+  };
+  ASSERT_THAT(
+      setsockopt(bind_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &bpf, sizeof(bpf)),
+      SyscallSucceeds());
+
+  char buf[16] = {};
+  ASSERT_THAT(sendto(sock_.get(), buf, sizeof(buf), 0, bind_addr_, addrlen_),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  char received[sizeof(buf)];
+  EXPECT_THAT(recv(bind_.get(), received, sizeof(received), MSG_DONTWAIT),
+              SyscallFailsWithErrno(EAGAIN));
+
+  // Packets are received again once the filter is detached.
+  constexpr int val = 0;
+  ASSERT_THAT(
+      setsockopt(bind_.get(), SOL_SOCKET, SO_DETACH_FILTER, &val, sizeof(val)),
+      SyscallSucceeds());
+  ASSERT_THAT(sendto(sock_.get(), buf, sizeof(buf), 0, bind_addr_, addrlen_),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  EXPECT_THAT(RecvTimeout(bind_.get(), received, sizeof(received),
+                          1 /*timeout*/),
+              IsPosixErrorOkAndHolds(sizeof(buf)));
+}
+
+TEST_P(UdpSocketTest, FilterTruncatesPackets) {
+  ASSERT_NO_ERRNO(BindLoopback());
+
+  // Keep the UDP header and the first 4 bytes of the payload.
+  constexpr int kPayloadLen = 4;
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_RET | BPF_K, 8 /* UDP header */ + kPayloadLen),
+  };
+  struct sock_fprog bpf = {
+      .len = ABSL_ARRAYSIZE(code),
+      .filter = code,
+  };
+  ASSERT_THAT(
+      setsockopt(bind_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &bpf, sizeof(bpf)),
+      SyscallSucceeds());
+
+  char buf[16];
+  RandomizeBuffer(buf, sizeof(buf));
+  ASSERT_THAT(sendto(sock_.get(), buf, sizeof(buf), 0, bind_addr_, addrlen_),
+              SyscallSucceedsWithValue(sizeof(buf)));
+  char received[sizeof(buf)];
+  ASSERT_THAT(RecvTimeout(bind_.get(), received, sizeof(received),
+                          1 /*timeout*/),
+              IsPosixErrorOkAndHolds(kPayloadLen));
+  EXPECT_EQ(memcmp(buf, received, kPayloadLen), 0);
+}
+
+TEST_P(UdpSocketTest, LockFilter) {
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_RET | BPF_K, 0xffffffff),
+  };
+  struct sock_fprog bpf = {
+      .len = ABSL_ARRAYSIZE(code),
+      .filter = code,
+  };
+  ASSERT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &bpf, sizeof(bpf)),
+      SyscallSucceeds());
+  ASSERT_THAT(setsockopt(sock_.get(), SOL_SOCKET, SO_LOCK_FILTER, &kSockOptOn,
+                         sizeof(kSockOptOn)),
+              SyscallSucceeds());
+
+  int val = 0;
+  socklen_t val_len = sizeof(val);
+  ASSERT_THAT(
+      getsockopt(sock_.get(), SOL_SOCKET, SO_LOCK_FILTER, &val, &val_len),
+      SyscallSucceeds());
+  EXPECT_EQ(val, 1);
+
+  // The filter can neither be replaced nor detached, and the lock can't be
+  // released.
+  EXPECT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &bpf, sizeof(bpf)),
+      SyscallFailsWithErrno(EPERM));
+  val = 0;
+  EXPECT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_DETACH_FILTER, &val, sizeof(val)),
+      SyscallFailsWithErrno(EPERM));
+  EXPECT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_LOCK_FILTER, &val, sizeof(val)),
+      SyscallFailsWithErrno(EPERM));
+}
+
+TEST_P(UdpSocketTest, ReusePortCBPF) {
+  struct sockaddr_storage addr_storage = InetLoopbackAddr();
+  struct sockaddr* addr = AsSockAddr(&addr_storage);
+  FileDescriptor socks[2];
+  for (auto& s : socks) {
+    s = ASSERT_NO_ERRNO_AND_VALUE(Socket(GetParam(), SOCK_DGRAM, IPPROTO_UDP));
+    ASSERT_THAT(setsockopt(s.get(), SOL_SOCKET, SO_REUSEPORT, &kSockOptOn,
+                           sizeof(kSockOptOn)),
+                SyscallSucceeds());
+    ASSERT_THAT(bind(s.get(), addr, addrlen_), SyscallSucceeds());
+    socklen_t addrlen = addrlen_;
+    ASSERT_THAT(getsockname(s.get(), addr, &addrlen), SyscallSucceeds());
+  }
+
+  // Direct every packet to the second socket of the group.
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_RET | BPF_K, 1),
+  };
+  struct sock_fprog bpf = {
+      .len = ABSL_ARRAYSIZE(code),
+      .filter = code,
+  };
+  ASSERT_THAT(setsockopt(socks[0].get(), SOL_SOCKET, SO_ATTACH_REUSEPORT_CBPF,
+                         &bpf, sizeof(bpf)),
+              SyscallSucceeds());
+
+  for (int i = 0; i < 10; i++) {
+    char buf[16] = {};
+    ASSERT_THAT(sendto(sock_.get(), buf, sizeof(buf), 0, addr, addrlen_),
+                SyscallSucceedsWithValue(sizeof(buf)));
+    EXPECT_THAT(RecvTimeout(socks[1].get(), buf, sizeof(buf), 1 /*timeout*/),
+                IsPosixErrorOkAndHolds(sizeof(buf)));
+  }
+  char buf[16];
+  EXPECT_THAT(recv(socks[0].get(), buf, sizeof(buf), MSG_DONTWAIT),
+              SyscallFailsWithErrno(EAGAIN));
+}
+
+TEST_P(UdpSocketTest, AttachInvalidFilter) {
+  // The last instruction of a program must be a return.
+  struct sock_filter code[] = {
+      BPF_STMT(BPF_LD | BPF_W | BPF_ABS, 0),
+  };
+  struct sock_fprog bpf = {
+      .len = ABSL_ARRAYSIZE(code),
+      .filter = code,
+  };
+  EXPECT_THAT(
+      setsockopt(sock_.get(), SOL_SOCKET, SO_ATTACH_FILTER, &bpf, sizeof(bpf)),
+      SyscallFailsWithErrno(EINVAL));
+}
+
 #endif  // __linux__
 
 TEST_P(UdpSocketTest, SetSocketDetachFilterNoInstalledFilter) {
-  // TODO(gvisor.dev/2746): Support SO_ATTACH_FILTER/SO_DETACH_FILTER.
-  SKIP_IF(IsRunningOnGvisor());
   constexpr int val = 0;
   ASSERT_THAT(
       setsockopt(sock_.get(), SOL_SOCKET, SO_DETACH_FILTER, &val, sizeof(val)),